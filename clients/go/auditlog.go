@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// auditLogUsage lists the auditlog subcommands.
+const auditLogUsage = `usage: embednexus auditlog <command> [arguments]
+
+commands:
+  verify <file> ...   check the hash chain of an audit log, rotated files first
+`
+
+// runAuditLog implements "embednexus auditlog <command>", the tools working
+// on the audit logs written with --audit-log.
+func runAuditLog(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, auditLogUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "verify":
+		return runAuditLogVerify(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, auditLogUsage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "embednexus: unknown auditlog command %q\n%s", args[0], auditLogUsage)
+	return exitUsage
+}
+
+// runAuditLogVerify implements "embednexus auditlog verify file ...": the
+// files, the rotated ones oldest first as a shell glob sorts them, are
+// checked as one chain. A break is exitMismatch; a chain that does not
+// start at entry 1 verifies, with a note that earlier files were not given.
+func runAuditLogVerify(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus auditlog verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus auditlog verify <file> ... (e.g. audit.jsonl.* audit.jsonl)")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	s, err := client.VerifyAuditLog(flags.Args()...)
+	var chainErr *client.AuditChainError
+	switch {
+	case errors.As(err, &chainErr):
+		fmt.Fprintf(stderr, "embednexus: audit log chain broken: %v\n", err)
+		return exitMismatch
+	case err != nil:
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "ok: %d entries, %d to %d, last hash %s\n", s.Entries, s.FirstSeq, s.LastSeq, s.LastHash)
+	if s.FirstSeq > 1 {
+		fmt.Fprintf(stdout, "note: the chain starts at entry %d; the files holding the entries before it were not given\n", s.FirstSeq)
+	}
+	return exitOK
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// cacheUsage lists the cache subcommands.
+const cacheUsage = `usage: embednexus cache <command> [arguments]
+
+commands:
+  stats <file>                         report the size and entries of a --cache-file, by model
+  purge (--model name | --all) <file>  drop the entries of a model, or every entry
+`
+
+// runCache implements "embednexus cache <command>", the tools working on
+// the disk caches written with --cache-file.
+func runCache(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, cacheUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "stats":
+		return runCacheStats(args[1:], stdout, stderr)
+	case "purge":
+		return runCachePurge(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cacheUsage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "embednexus: unknown cache command %q\n%s", args[0], cacheUsage)
+	return exitUsage
+}
+
+// runCacheStats implements "embednexus cache stats file".
+func runCacheStats(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus cache stats", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprintln(stderr, "usage: embednexus cache stats <file>") }
+	cache, code := openCacheFile(flags, args, stderr)
+	if cache == nil {
+		return code
+	}
+	defer cache.Close()
+	s := cache.Stats()
+	fmt.Fprintf(stdout, "%s: %d entries, %d bytes (%d live)\n", s.Path, s.Entries, s.Bytes, s.LiveBytes)
+	if s.Dropped > 0 {
+		fmt.Fprintf(stdout, "note: dropped a torn or corrupt tail of %d bytes\n", s.Dropped)
+	}
+	models := make([]string, 0, len(s.Models))
+	for model := range s.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Fprintf(stdout, "  %s: %d\n", model, s.Models[model])
+	}
+	return exitOK
+}
+
+// runCachePurge implements "embednexus cache purge --model name file" and
+// "embednexus cache purge --all file".
+func runCachePurge(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus cache purge", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprintln(stderr, "usage: embednexus cache purge (--model name | --all) <file>") }
+	model := flags.String("model", "", "drop the entries of this model, those truncated to a dimension included")
+	all := flags.Bool("all", false, "drop every entry")
+	cache, code := openCacheFile(flags, args, stderr)
+	if cache == nil {
+		return code
+	}
+	defer cache.Close()
+	if (*model == "") == !*all {
+		flags.Usage()
+		return exitUsage
+	}
+	n, err := cache.Purge(*model)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "purged %d entries\n", n)
+	return exitOK
+}
+
+// openCacheFile parses args with flags and opens the cache file they name,
+// returning nil and the exit code on failure.
+func openCacheFile(flags *flag.FlagSet, args []string, stderr io.Writer) (*client.DiskCache, int) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, exitOK
+		}
+		return nil, exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, exitUsage
+	}
+	cache, err := client.OpenDiskCache(flags.Arg(0), client.DiskCacheOptions{})
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return nil, exitFailure
+	}
+	return cache, exitOK
+}
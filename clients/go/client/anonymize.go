@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// AnonymizeKeep are the payload fields an Anonymizer copies verbatim: the
+// structural ones protocol debugging needs, such as the model and the
+// negotiated versions, but never customer text.
+var AnonymizeKeep = []string{
+	"kind",
+	"transport",
+	"protocol_version",
+	"model",
+	"encoding",
+	"dtype",
+	"dtypes",
+	"state",
+	"capabilities",
+	"features",
+	"client",
+}
+
+// anonymizedPattern matches the values an Anonymizer writes.
+var anonymizedPattern = regexp.MustCompile(`^sha256:[0-9a-f]{12}…\((len|dim)=\d+\)$`)
+
+// Anonymizer replaces the contents of message payloads, the "params" of
+// requests and the "result" of responses, with salted hashes, so a
+// transcript can be shared without the text or embeddings it carried.
+// Each string becomes "sha256:<hash>…(len=<characters>)" and each array of
+// numbers, such as an embedding vector, "sha256:<hash>…(dim=<length>)".
+// Fields in AnonymizeKeep, numbers outside arrays, object keys, envelope
+// fields, and redacted values are left as they are, and anonymizing twice
+// changes nothing further.
+//
+// The same value hashes the same way under the same salt, so two sessions
+// anonymized with one salt still compare equal where their payloads did.
+type Anonymizer struct {
+	salt []byte
+}
+
+// NewAnonymizer returns an Anonymizer keyed by salt. An empty salt picks a
+// random one, so the hashes cannot be matched against guessed inputs, nor
+// against another transcript.
+func NewAnonymizer(salt string) *Anonymizer {
+	if salt != "" {
+		return &Anonymizer{salt: []byte(salt)}
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(fmt.Sprintf("anonymizer salt: %v", err))
+	}
+	return &Anonymizer{salt: random}
+}
+
+// Anonymize returns message with its payload anonymized. A message without
+// a payload, or that is not a JSON object, is returned unchanged.
+func (a *Anonymizer) Anonymize(message json.RawMessage) json.RawMessage {
+	message, _ = a.anonymize(message)
+	return message
+}
+
+// anonymize returns message anonymized and the number of values hashed.
+func (a *Anonymizer) anonymize(message json.RawMessage) (json.RawMessage, int) {
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return message, 0
+	}
+	env, ok := v.(map[string]any)
+	if !ok {
+		return message, 0
+	}
+	hashed := 0
+	for _, field := range []string{"params", "result"} {
+		if payload, ok := env[field]; ok {
+			var n int
+			env[field], n = a.walk(payload)
+			hashed += n
+		}
+	}
+	if hashed == 0 {
+		return message, 0
+	}
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return message, 0
+	}
+	return raw, hashed
+}
+
+func (a *Anonymizer) walk(v any) (any, int) {
+	switch node := v.(type) {
+	case string:
+		if anonymizedPattern.MatchString(node) || strings.HasPrefix(node, redactedPrefix) {
+			return node, 0
+		}
+		return a.hash([]byte(node), "len", utf8.RuneCountInString(node)), 1
+	case map[string]any:
+		hashed := 0
+		for k, child := range node {
+			if keptField(k) {
+				continue
+			}
+			var n int
+			node[k], n = a.walk(child)
+			hashed += n
+		}
+		return node, hashed
+	case []any:
+		if isVector(node) {
+			raw, _ := json.Marshal(node)
+			return a.hash(raw, "dim", len(node)), 1
+		}
+		hashed := 0
+		for i, child := range node {
+			var n int
+			node[i], n = a.walk(child)
+			hashed += n
+		}
+		return node, hashed
+	}
+	return v, 0
+}
+
+func (a *Anonymizer) hash(content []byte, unit string, n int) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write(content)
+	return fmt.Sprintf("sha256:%s…(%s=%d)", hex.EncodeToString(mac.Sum(nil)[:6]), unit, n)
+}
+
+// isVector reports whether v is a non-empty array of numbers.
+func isVector(v []any) bool {
+	for _, x := range v {
+		if _, ok := x.(json.Number); !ok {
+			return false
+		}
+	}
+	return len(v) > 0
+}
+
+func keptField(name string) bool {
+	name = normalizeFieldName(name)
+	for _, keep := range AnonymizeKeep {
+		if name == keep {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizer(t *testing.T) {
+	message := `{"jsonrpc":"2.0","id":3,"method":"mcp.embed","params":{"model":"mini-lm","inputs":["customer text","ünïcode"],"dimensions":4},"meta":{"sequence":3}}`
+	a := NewAnonymizer("salt")
+	var v map[string]any
+	if err := json.Unmarshal(a.Anonymize(json.RawMessage(message)), &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	params := v["params"].(map[string]any)
+	inputs := params["inputs"].([]any)
+	if !regexp.MustCompile(`^sha256:[0-9a-f]{12}…\(len=13\)$`).MatchString(inputs[0].(string)) || !strings.HasSuffix(inputs[1].(string), "(len=7)") {
+		t.Fatalf("inputs = %v", inputs)
+	}
+	if v["method"] != "mcp.embed" || params["model"] != "mini-lm" || params["dimensions"] != float64(4) || v["meta"].(map[string]any)["sequence"] != float64(3) {
+		t.Fatalf("structure changed: %v", v)
+	}
+
+	response := `{"jsonrpc":"2.0","id":3,"result":{"vectors":[[0.1,0.2,0.3],[0.4,0.5,0.6]],"model":"mini-lm"}}`
+	anon := a.Anonymize(json.RawMessage(response))
+	if err := json.Unmarshal(anon, &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	vectors := v["result"].(map[string]any)["vectors"].([]any)
+	if len(vectors) != 2 || !strings.HasSuffix(vectors[0].(string), "(dim=3)") || vectors[0] == vectors[1] {
+		t.Fatalf("vectors = %v", vectors)
+	}
+	// Anonymizing is deterministic under a salt and idempotent; another
+	// salt hashes differently.
+	if again := a.Anonymize(json.RawMessage(response)); string(again) != string(anon) {
+		t.Fatalf("same salt, different hashes:\n%s\n%s", again, anon)
+	}
+	if twice := a.Anonymize(anon); string(twice) != string(anon) {
+		t.Fatalf("anonymizing twice changed the message:\n%s\n%s", twice, anon)
+	}
+	if other := NewAnonymizer("pepper").Anonymize(json.RawMessage(response)); string(other) == string(anon) {
+		t.Fatal("different salts hashed alike")
+	}
+	if random := NewAnonymizer("").Anonymize(json.RawMessage(response)); string(random) == string(anon) {
+		t.Fatal("random salt hashed like a fixed one")
+	}
+}
+
+func TestRecorderAnonymizesAfterRedacting(t *testing.T) {
+	r := NewFileRecorder(filepath.Join(t.TempDir(), "t.json"), TransportHTTP)
+	r.Config = RecorderConfig{Anonymize: true, AnonymizeSalt: "salt"}
+	r.Record(Entry{Direction: DirectionRequest, Message: json.RawMessage(`{"method":"mcp.embed","params":{"api_key":"sk-1","input_text":"secret"}}`)})
+	var v map[string]any
+	if err := json.Unmarshal(r.entries[0].Message, &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	params := v["params"].(map[string]any)
+	if key := params["api_key"].(string); !strings.HasPrefix(key, redactedPrefix) {
+		t.Fatalf("api_key = %q, want it redacted", key)
+	}
+	if text := params["input_text"].(string); !strings.HasPrefix(text, "sha256:") || !strings.HasSuffix(text, "(len=6)") {
+		t.Fatalf("input_text = %q, want it anonymized", text)
+	}
+}
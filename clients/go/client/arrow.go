@@ -0,0 +1,363 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The Arrow IPC file format, as the Arrow columnar specification lays it
+// out: the magic, the stream of encapsulated messages, a footer locating
+// each record batch, and the magic again. Messages carry their metadata as
+// flatbuffers of the Message, Schema, and File definitions.
+const (
+	arrowMagic = "ARROW1"
+
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt             = 2
+	arrowTypeFloatingPoint   = 3
+	arrowTypeFixedSizeBinary = 15
+	arrowTypeFixedSizeList   = 16
+
+	arrowPrecisionSingle = 1
+)
+
+// arrowPadding pads messages and bodies to the 8 bytes Arrow aligns to.
+var arrowPadding [8]byte
+
+// fbBuilder writes a flatbuffer front to back: a table before the strings,
+// vectors, and tables it refers to, whose offsets are patched in once they
+// are written, since flatbuffer offsets only point forward. The buffer
+// starts with the offset of the root table, and is 8-aligned wherever it
+// is placed in a file.
+type fbBuilder struct {
+	buf []byte
+}
+
+func newFBBuilder() *fbBuilder { return &fbBuilder{buf: make([]byte, 4, 512)} }
+
+// fbField is a member of a table: a scalar of size bytes, or for size 4
+// and no value an offset the caller patches.
+type fbField struct {
+	slot  int
+	size  int
+	value uint64
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// table writes a table of fields, after its vtable, and returns its
+// position and those of its fields, in the order given.
+func (b *fbBuilder) table(fields ...fbField) (int, []int) {
+	offsets := make([]int, len(fields))
+	size, slots := 4, 0
+	for i, f := range fields {
+		size = (size + f.size - 1) / f.size * f.size
+		offsets[i] = size
+		size += f.size
+		slots = max(slots, f.slot+1)
+	}
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*slots))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	b.buf = append(b.buf, make([]byte, 2*slots)...)
+	for i, f := range fields {
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*f.slot:], uint16(offsets[i]))
+	}
+	// The table is 8-aligned, so its members are aligned to their size.
+	b.align(8)
+	table := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[table:], uint32(table-vtable))
+	for i, f := range fields {
+		at := table + offsets[i]
+		offsets[i] = at
+		switch f.size {
+		case 1:
+			b.buf[at] = byte(f.value)
+		case 2:
+			binary.LittleEndian.PutUint16(b.buf[at:], uint16(f.value))
+		case 4:
+			binary.LittleEndian.PutUint32(b.buf[at:], uint32(f.value))
+		case 8:
+			binary.LittleEndian.PutUint64(b.buf[at:], f.value)
+		}
+	}
+	return table, offsets
+}
+
+// vector writes the length of a vector of n elements of size bytes, their
+// first aligned to align, and returns its position and that of the first.
+func (b *fbBuilder) vector(n, size, align int) (int, int) {
+	for len(b.buf)%4 != 0 || (len(b.buf)+4)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	vec := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(n))
+	b.buf = append(b.buf, make([]byte, n*size)...)
+	return vec, vec + 4
+}
+
+func (b *fbBuilder) string(s string) int {
+	b.align(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(append(b.buf, s...), 0)
+	return pos
+}
+
+// patch points the offset at at to target.
+func (b *fbBuilder) patch(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+// arrowField is a non-nullable field of a schema: its name, its Type
+// union member, the members of that type's table, and its children.
+type arrowField struct {
+	name     string
+	typeID   byte
+	typ      []fbField
+	children []arrowField
+}
+
+// embedArrowSchema is the schema of OutputArrow, for vectors of dim
+// components.
+func embedArrowSchema(dim int) []arrowField {
+	return []arrowField{
+		{name: "index", typeID: arrowTypeInt, typ: []fbField{{slot: 0, size: 4, value: 64}, {slot: 1, size: 1, value: 1}}},
+		{name: "text_hash", typeID: arrowTypeFixedSizeBinary, typ: []fbField{{slot: 0, size: 4, value: sha256.Size}}},
+		{name: "embedding", typeID: arrowTypeFixedSizeList, typ: []fbField{{slot: 0, size: 4, value: uint64(dim)}}, children: []arrowField{
+			{name: "item", typeID: arrowTypeFloatingPoint, typ: []fbField{{slot: 0, size: 2, value: arrowPrecisionSingle}}},
+		}},
+	}
+}
+
+// schema writes a little-endian Schema table of fields.
+func (b *fbBuilder) schema(fields []arrowField) int {
+	table, at := b.table(fbField{slot: 0, size: 2}, fbField{slot: 1, size: 4})
+	b.patch(at[1], b.fields(fields))
+	return table
+}
+
+func (b *fbBuilder) fields(fields []arrowField) int {
+	vec, elems := b.vector(len(fields), 4, 4)
+	for i, f := range fields {
+		table, at := b.table(
+			fbField{slot: 0, size: 4},
+			fbField{slot: 1, size: 1},
+			fbField{slot: 2, size: 1, value: uint64(f.typeID)},
+			fbField{slot: 3, size: 4},
+			fbField{slot: 5, size: 4},
+		)
+		b.patch(elems+4*i, table)
+		b.patch(at[0], b.string(f.name))
+		typ, _ := b.table(f.typ...)
+		b.patch(at[3], typ)
+		b.patch(at[4], b.fields(f.children))
+	}
+	return vec
+}
+
+// arrowMessage is the metadata of a message whose header, of union member
+// headerType, header writes, and whose body is bodyLen bytes.
+func arrowMessage(headerType byte, bodyLen int64, header func(b *fbBuilder) int) []byte {
+	b := newFBBuilder()
+	table, at := b.table(
+		fbField{slot: 0, size: 2, value: arrowMetadataV5},
+		fbField{slot: 1, size: 1, value: uint64(headerType)},
+		fbField{slot: 2, size: 4},
+		fbField{slot: 3, size: 8, value: uint64(bodyLen)},
+	)
+	b.patch(0, table)
+	b.patch(at[2], header(b))
+	return b.buf
+}
+
+// arrowBlock locates a record batch in the footer of a file.
+type arrowBlock struct {
+	offset  int64
+	metaLen int32
+	bodyLen int64
+}
+
+// arrowFileWriter writes embedding records as OutputArrow, a record batch
+// per Write. The schema is written with the first batch, whose vectors fix
+// the dimension of the file; the footer that makes it readable is written
+// by Close. Rows are written from buffers the writer keeps, so a batch
+// allocates only its metadata, whatever its size.
+type arrowFileWriter struct {
+	w      io.Writer
+	off    int64
+	dim    int
+	blocks []arrowBlock
+	// text and row are the scratch space of a row: its text, to hash, and
+	// the bytes of its index or hash.
+	text []byte
+	row  [sha256.Size]byte
+}
+
+func newArrowFileWriter(w io.Writer) *arrowFileWriter {
+	return &arrowFileWriter{w: w, dim: -1}
+}
+
+func (aw *arrowFileWriter) write(p []byte) error {
+	n, err := aw.w.Write(p)
+	aw.off += int64(n)
+	return err
+}
+
+// message writes an encapsulated message's prefix and metadata, padded to
+// 8 bytes, and returns the length of all three.
+func (aw *arrowFileWriter) message(meta []byte) (int32, error) {
+	pad := -len(meta) & 7
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)+pad))
+	if err := aw.write(prefix[:]); err != nil {
+		return 0, err
+	}
+	if err := aw.write(meta); err != nil {
+		return 0, err
+	}
+	if err := aw.write(arrowPadding[:pad]); err != nil {
+		return 0, err
+	}
+	return int32(len(prefix) + len(meta) + pad), nil
+}
+
+// start writes the magic and the schema for vectors of dim components.
+func (aw *arrowFileWriter) start(dim int) error {
+	aw.dim = dim
+	if err := aw.write([]byte(arrowMagic + "\x00\x00")); err != nil {
+		return err
+	}
+	_, err := aw.message(arrowMessage(arrowHeaderSchema, 0, func(b *fbBuilder) int {
+		return b.schema(embedArrowSchema(dim))
+	}))
+	return err
+}
+
+// Write writes a record batch of the rows of texts, their indices, and
+// vectors, all the same length.
+func (aw *arrowFileWriter) Write(indices []int64, texts []string, vectors [][]float32) error {
+	n := len(vectors)
+	if n == 0 {
+		return nil
+	}
+	if aw.dim < 0 {
+		if err := aw.start(len(vectors[0])); err != nil {
+			return err
+		}
+	}
+	for i, v := range vectors {
+		if len(v) != aw.dim {
+			return fmt.Errorf("arrow: vector %d has %d components, want %d", indices[i], len(v), aw.dim)
+		}
+	}
+	rows := int64(n)
+	hashes := 8 * rows
+	floats := hashes + sha256.Size*rows
+	floatLen := 4 * rows * int64(aw.dim)
+	bodyLen := floats + floatLen + (-floatLen & 7)
+	meta := arrowMessage(arrowHeaderRecordBatch, bodyLen, func(b *fbBuilder) int {
+		table, at := b.table(fbField{slot: 0, size: 8, value: uint64(rows)}, fbField{slot: 1, size: 4}, fbField{slot: 2, size: 4})
+		// The field nodes and buffers of index, text_hash, embedding, and
+		// its items, in that order; no column has nulls, so every validity
+		// buffer is empty.
+		nodes, elems := b.vector(4, 16, 8)
+		for i, length := range [4]int64{rows, rows, rows, rows * int64(aw.dim)} {
+			binary.LittleEndian.PutUint64(b.buf[elems+16*i:], uint64(length))
+		}
+		b.patch(at[1], nodes)
+		buffers, elems := b.vector(7, 16, 8)
+		for i, buf := range [7][2]int64{{0, 0}, {0, hashes}, {hashes, 0}, {hashes, floats - hashes}, {floats, 0}, {floats, 0}, {floats, floatLen}} {
+			binary.LittleEndian.PutUint64(b.buf[elems+16*i:], uint64(buf[0]))
+			binary.LittleEndian.PutUint64(b.buf[elems+16*i+8:], uint64(buf[1]))
+		}
+		b.patch(at[2], buffers)
+		return table
+	})
+	block := arrowBlock{offset: aw.off, bodyLen: bodyLen}
+	var err error
+	if block.metaLen, err = aw.message(meta); err != nil {
+		return err
+	}
+	for _, index := range indices {
+		binary.LittleEndian.PutUint64(aw.row[:8], uint64(index))
+		if err := aw.write(aw.row[:8]); err != nil {
+			return err
+		}
+	}
+	for _, text := range texts {
+		aw.text = append(aw.text[:0], text...)
+		aw.row = sha256.Sum256(aw.text)
+		if err := aw.write(aw.row[:]); err != nil {
+			return err
+		}
+	}
+	for _, v := range vectors {
+		if view, ok := float32Bytes(v); ok {
+			if err := aw.write(view); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, x := range v {
+			binary.LittleEndian.PutUint32(aw.row[:4], math.Float32bits(x))
+			if err := aw.write(aw.row[:4]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := aw.write(arrowPadding[:-floatLen&7]); err != nil {
+		return err
+	}
+	aw.blocks = append(aw.blocks, block)
+	return nil
+}
+
+// Close ends the stream and writes the footer. A file without a batch has
+// the schema of vectors of no components.
+func (aw *arrowFileWriter) Close() error {
+	if aw.dim < 0 {
+		if err := aw.start(0); err != nil {
+			return err
+		}
+	}
+	var eos [8]byte
+	binary.LittleEndian.PutUint32(eos[:], 0xFFFFFFFF)
+	if err := aw.write(eos[:]); err != nil {
+		return err
+	}
+	b := newFBBuilder()
+	table, at := b.table(fbField{slot: 0, size: 2, value: arrowMetadataV5}, fbField{slot: 1, size: 4}, fbField{slot: 3, size: 4})
+	b.patch(0, table)
+	b.patch(at[1], b.schema(embedArrowSchema(aw.dim)))
+	vec, elems := b.vector(len(aw.blocks), 24, 8)
+	for i, block := range aw.blocks {
+		binary.LittleEndian.PutUint64(b.buf[elems+24*i:], uint64(block.offset))
+		binary.LittleEndian.PutUint32(b.buf[elems+24*i+8:], uint32(block.metaLen))
+		binary.LittleEndian.PutUint64(b.buf[elems+24*i+16:], uint64(block.bodyLen))
+	}
+	b.patch(at[2], vec)
+	if err := aw.write(b.buf); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(b.buf)))
+	if err := aw.write(size[:]); err != nil {
+		return err
+	}
+	return aw.write([]byte(arrowMagic))
+}
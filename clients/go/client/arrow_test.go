@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// arrowMessageAt returns the metadata length, prefix included, of the
+// message at off in an Arrow file.
+func arrowMessageAt(t *testing.T, file []byte, off int) int {
+	t.Helper()
+	if binary.LittleEndian.Uint32(file[off:]) != 0xFFFFFFFF {
+		t.Fatalf("no message at %d: % x", off, file[off:off+8])
+	}
+	return 8 + int(binary.LittleEndian.Uint32(file[off+4:]))
+}
+
+func TestRunEmbedArrow(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.arrow")
+	if err := os.WriteFile(input, []byte("a\n\nbbb\n  cc  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var failing atomic.Bool
+	err := RunEmbed(context.Background(), Options{
+		Config:     embedFileServer(&failing),
+		InputFile:  input,
+		OutputFile: output,
+		Output:     Renderer{Format: OutputArrow},
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	file, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(file, []byte("ARROW1\x00\x00")) || !bytes.HasSuffix(file, []byte("ARROW1")) {
+		t.Fatalf("file is not framed by the Arrow magic: % x", file)
+	}
+	footer := len(file) - 10 - int(binary.LittleEndian.Uint32(file[len(file)-10:]))
+	if footer%8 != 0 || !bytes.Equal(file[footer-8:footer], []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}) {
+		t.Fatalf("footer at %d does not follow the end of the stream", footer)
+	}
+
+	// The file holds the schema and one batch, whose body is the indices,
+	// the hashes of the texts, and the vectors, bit for bit.
+	batch := 8 + arrowMessageAt(t, file, 8)
+	body := file[batch+arrowMessageAt(t, file, batch) : footer-8]
+	texts := []string{"a", "bbb", "cc"}
+	var want []byte
+	for _, index := range []int64{0, 2, 3} {
+		want = binary.LittleEndian.AppendUint64(want, uint64(index))
+	}
+	for _, text := range texts {
+		sum := sha256.Sum256([]byte(text))
+		want = append(want, sum[:]...)
+	}
+	for _, text := range texts {
+		for _, x := range []float32{float32(len(text)), 0.5, -0.5} {
+			want = binary.LittleEndian.AppendUint32(want, math.Float32bits(x))
+		}
+	}
+	want = append(want, 0, 0, 0, 0)
+	if !bytes.Equal(body, want) {
+		t.Fatalf("batch body\n% x\nwant\n% x", body, want)
+	}
+
+	for name, opts := range map[string]Options{
+		"stdout":     {Config: embedFileServer(&failing), InputFile: input, Output: Renderer{Format: OutputArrow}},
+		"inputs":     {Config: embedFileServer(&failing), Inputs: []string{"a"}, OutputFile: output, Output: Renderer{Format: OutputArrow}},
+		"resumed":    {Config: embedFileServer(&failing), InputFile: input, OutputFile: output, ResumeFrom: 1, Output: Renderer{Format: OutputArrow}},
+		"checkpoint": {Config: embedFileServer(&failing), InputFile: input, OutputFile: output, Checkpoint: filepath.Join(dir, "cp.json"), Output: Renderer{Format: OutputArrow}},
+	} {
+		if err := RunEmbed(context.Background(), opts); err == nil || !strings.Contains(err.Error(), OutputArrow) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := (Renderer{Format: OutputArrow}).Render(io.Discard, nil, nil); err == nil {
+		t.Fatal("Render wrote an Arrow document")
+	}
+}
+
+func TestArrowFileWriterAllocations(t *testing.T) {
+	batch := func(n int) ([]int64, []string, [][]float32) {
+		indices, texts, vectors := make([]int64, n), make([]string, n), make([][]float32, n)
+		for i := range vectors {
+			indices[i], texts[i], vectors[i] = int64(i), strings.Repeat("text ", 20), make([]float32, 256)
+		}
+		return indices, texts, vectors
+	}
+	// Write allocates for the metadata of a batch, never for its rows.
+	aw := newArrowFileWriter(io.Discard)
+	allocs := func(n int) float64 {
+		indices, texts, vectors := batch(n)
+		return testing.AllocsPerRun(10, func() {
+			if err := aw.Write(indices, texts, vectors); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if small, large := allocs(4), allocs(4096); large > small {
+		t.Fatalf("a batch of 4096 rows allocated %.0f times, one of 4 %.0f", large, small)
+	}
+	if err := aw.Write([]int64{0}, []string{"x"}, [][]float32{{1}}); err == nil {
+		t.Fatal("Write accepted a vector of another dimension")
+	}
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of an audit log: a request the client sent and
+// how it ended. Hash is the SHA-256 of the entry's JSON without Hash, and
+// that JSON holds Prev, the hash of the entry before, so the entries form
+// a chain that an edit or a removed entry breaks.
+type AuditEntry struct {
+	// Seq numbers the entries of a chain from 1.
+	Seq    int64  `json:"seq"`
+	Time   string `json:"time"`
+	Method string `json:"method"`
+	// RequestID is the client's request ID; see WithRequestID.
+	RequestID string `json:"request_id,omitempty"`
+	// InputSHA256 is the SHA-256 of the request params as sent, matching a
+	// known input without the log holding its text.
+	InputSHA256 string `json:"input_sha256"`
+	// Status is "ok" or the ErrorClass of the failure.
+	Status string `json:"status"`
+	// LatencyMicros is the round trip in microseconds.
+	LatencyMicros int64  `json:"latency_us"`
+	Prev          string `json:"prev"`
+	Hash          string `json:"hash"`
+}
+
+// hash returns the chain hash of e.
+func (e AuditEntry) hash() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLogOptions configures an AuditLog.
+type AuditLogOptions struct {
+	// Sync flushes the file to stable storage after every entry, at the
+	// cost of an fsync per request.
+	Sync bool
+	// MaxBytes rotates the file once it has grown to this size: it is
+	// renamed with the UTC time appended and a new file continues the
+	// chain. Zero never rotates.
+	MaxBytes int64
+}
+
+// AuditLog appends an AuditEntry for every request it intercepts to a file
+// of JSON lines. Add its Intercept method with WithInterceptor; it then
+// records every attempt, retries included. A log reopened after a restart,
+// or after a rotation, continues the chain of its last entry. Only one
+// AuditLog may write a file at a time.
+type AuditLog struct {
+	path string
+	opts AuditLogOptions
+	now  func() time.Time
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	seq  int64
+	prev string
+}
+
+// OpenAuditLog opens the audit log at path, creating it when missing.
+func OpenAuditLog(path string, opts AuditLogOptions) (*AuditLog, error) {
+	if opts.MaxBytes < 0 {
+		return nil, errors.New("audit log max bytes must not be negative")
+	}
+	a := &AuditLog{path: path, opts: opts, now: time.Now}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	last, err := lastAuditEntry(path)
+	if err == nil && last == nil {
+		// A fresh file after a rotation continues the rotated chain.
+		if rotated := rotatedAuditLogs(path); len(rotated) > 0 {
+			last, err = lastAuditEntry(rotated[len(rotated)-1])
+		}
+	}
+	if err != nil {
+		a.f.Close()
+		return nil, err
+	}
+	if last != nil {
+		a.seq, a.prev = last.Seq, last.Hash
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("audit log: %w", err)
+	}
+	a.f, a.size = f, info.Size()
+	return nil
+}
+
+// Intercept is the Interceptor writing the entry of each request. A request
+// whose entry cannot be written fails with the write error, so no request
+// goes unrecorded unnoticed.
+func (a *AuditLog) Intercept(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	start := time.Now()
+	resp, err := next(ctx, req)
+	elapsed := time.Since(start)
+	status := "ok"
+	if failure := callError(resp, err); failure != nil {
+		status = ErrorClass(failure)
+	}
+	sum := sha256.Sum256(req.Params)
+	entry := AuditEntry{
+		Time:          a.now().UTC().Format(time.RFC3339Nano),
+		Method:        req.Method,
+		InputSHA256:   hex.EncodeToString(sum[:]),
+		Status:        status,
+		LatencyMicros: elapsed.Microseconds(),
+	}
+	if req.Meta != nil {
+		entry.RequestID = req.Meta.RequestID
+	}
+	if werr := a.append(entry); werr != nil {
+		return nil, errors.Join(werr, err)
+	}
+	return resp, err
+}
+
+// append chains entry to the log and writes it.
+func (a *AuditLog) append(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return errors.New("audit log: closed")
+	}
+	if a.opts.MaxBytes > 0 && a.size >= a.opts.MaxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	entry.Seq, entry.Prev = a.seq+1, a.prev
+	entry.Hash = entry.hash()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	n, err := a.f.Write(append(line, '\n'))
+	a.size += int64(n)
+	if err == nil && a.opts.Sync {
+		err = a.f.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	a.seq, a.prev = entry.Seq, entry.Hash
+	return nil
+}
+
+// rotate renames the full file aside and opens a new one.
+func (a *AuditLog) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	a.f = nil
+	rotated := a.path + "." + a.now().UTC().Format("20060102T150405.000000000Z")
+	if err := os.Rename(a.path, rotated); err != nil {
+		return fmt.Errorf("audit log: rotate: %w", err)
+	}
+	return a.open()
+}
+
+// Close closes the file; later requests fail.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// rotatedAuditLogs returns the files rotated from the log at path, oldest
+// first.
+func rotatedAuditLogs(path string) []string {
+	matches, _ := filepath.Glob(path + ".[0-9]*T*Z")
+	sort.Strings(matches)
+	return matches
+}
+
+// auditTailBytes bounds the end of a log read to find its last entry.
+const auditTailBytes = 64 << 10
+
+// lastAuditEntry returns the last entry of the log at path, or nil when it
+// is empty. A torn last line, left by a crash, is an error: the log needs
+// an operator's attention before the chain grows past it.
+func lastAuditEntry(path string) (*AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	if info.Size() == 0 {
+		return nil, nil
+	}
+	offset := max(info.Size()-auditTailBytes, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	tail = bytes.TrimSuffix(tail, []byte("\n"))
+	if i := bytes.LastIndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	var last AuditEntry
+	if err := json.Unmarshal(tail, &last); err != nil || last.Hash != last.hash() {
+		return nil, fmt.Errorf("audit log %s: last entry is damaged; verify the log", path)
+	}
+	return &last, nil
+}
+
+// AuditChainError reports where an audit log's chain breaks.
+type AuditChainError struct {
+	Path string
+	// Line is the 1-based line of the offending entry.
+	Line   int
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Reason)
+}
+
+// AuditSummary describes a verified audit log.
+type AuditSummary struct {
+	Entries int
+	// FirstSeq is the sequence number the verified chain starts from,
+	// above 1 when its earlier files were not given.
+	FirstSeq, LastSeq int64
+	// LastHash is the hash of the last entry. The chain cannot show
+	// entries removed from its end; comparing LastSeq and LastHash with a
+	// copy kept elsewhere does.
+	LastHash string
+}
+
+// VerifyAuditLog checks the chain of the audit log files at paths, given
+// oldest first as rotated files sort, and reports the first break as an
+// *AuditChainError.
+func VerifyAuditLog(paths ...string) (AuditSummary, error) {
+	var s AuditSummary
+	var prev string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return s, err
+		}
+		err = verifyAuditFile(f, path, &s, &prev)
+		f.Close()
+		if err != nil {
+			return s, err
+		}
+	}
+	if s.Entries == 0 {
+		return s, errors.New("audit log has no entries")
+	}
+	return s, nil
+}
+
+func verifyAuditFile(r io.Reader, path string, s *AuditSummary, prev *string) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), auditTailBytes)
+	for line := 1; sc.Scan(); line++ {
+		fail := func(format string, args ...any) error {
+			return &AuditChainError{Path: path, Line: line, Reason: fmt.Sprintf(format, args...)}
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fail("malformed entry: %v", err)
+		}
+		if e.Hash != e.hash() {
+			return fail("entry %d does not match its hash", e.Seq)
+		}
+		switch {
+		case s.Entries == 0 && e.Seq == 1 && e.Prev != "":
+			return fail("the first entry names a previous entry")
+		case s.Entries == 0:
+			s.FirstSeq = e.Seq
+		case e.Seq != s.LastSeq+1:
+			return fail("entry %d follows entry %d", e.Seq, s.LastSeq)
+		case e.Prev != *prev:
+			return fail("entry %d does not chain to entry %d", e.Seq, s.LastSeq)
+		}
+		s.Entries++
+		s.LastSeq, s.LastHash, *prev = e.Seq, e.Hash, e.Hash
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	session := func(calls int) {
+		t.Helper()
+		audit, err := OpenAuditLog(path, AuditLogOptions{Sync: true, MaxBytes: 600})
+		if err != nil {
+			t.Fatalf("OpenAuditLog: %v", err)
+		}
+		c, err := NewClient("", WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)}), WithInterceptor(audit.Intercept))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		for i := 0; i < calls; i++ {
+			if _, err := c.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+		}
+		_ = c.Call(context.Background(), "test.missing", map[string]string{"text": "secret input"}, nil)
+		c.Close(context.Background())
+		if err := audit.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	// The second session continues the chain of the first.
+	session(3)
+	session(2)
+
+	files := append(rotatedAuditLogs(path), path)
+	if len(files) < 2 {
+		t.Fatalf("the log never rotated: %v", files)
+	}
+	s, err := VerifyAuditLog(files...)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog: %v", err)
+	}
+	if s.Entries != 7 || s.FirstSeq != 1 || s.LastSeq != 7 || len(s.LastHash) != 64 {
+		t.Fatalf("summary %+v", s)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret input") || !strings.Contains(string(data), `"status":"api"`) {
+		t.Fatalf("log of the failed call:\n%s", data)
+	}
+
+	// Editing an entry or dropping one breaks the chain.
+	edited := strings.Replace(string(data), `"status":"api"`, `"status":"ok"`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var chainErr *AuditChainError
+	if _, err := VerifyAuditLog(files...); !errors.As(err, &chainErr) || !strings.Contains(chainErr.Reason, "hash") {
+		t.Fatalf("verify of an edited log: %v", err)
+	}
+	if s, err := VerifyAuditLog(files[1]); err != nil || s.FirstSeq == 1 {
+		t.Fatalf("verify of a later file alone: %+v, %v", s, err)
+	}
+	second, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := strings.Cut(string(second), "\n")
+	if err := os.WriteFile(files[1], []byte(rest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(files[:2]...); !errors.As(err, &chainErr) || chainErr.Path != files[1] || chainErr.Line != 1 {
+		t.Fatalf("verify of a log missing an entry: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrAuthRefresh reports that the TokenSource failed to supply a token. It
+// wraps the source's error and matches ErrUnauthorized.
+var ErrAuthRefresh error = &classError{"auth token refresh failed", ErrUnauthorized}
+
+// tokenExpiryDelta is how long before its expiry a token is refreshed, so
+// it does not expire in flight.
+const tokenExpiryDelta = 10 * time.Second
+
+// Token is an access token, shaped like the oauth2.Token of
+// golang.org/x/oauth2; the clients/go/embedoauth2 module adapts an
+// oauth2.TokenSource to a TokenSource.
+type Token struct {
+	AccessToken Secret
+	// TokenType is the scheme of the Authorization value, "Bearer" when
+	// empty.
+	TokenType string
+	// Expiry is when the token stops being valid. Zero means never.
+	Expiry time.Time
+}
+
+// valid reports whether t can still be sent at now.
+func (t *Token) valid(now time.Time) bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || now.Add(tokenExpiryDelta).Before(t.Expiry))
+}
+
+// authorization is the Authorization value presenting t.
+func (t *Token) authorization() string {
+	scheme := t.TokenType
+	if scheme == "" {
+		scheme = "Bearer"
+	}
+	return scheme + " " + string(t.AccessToken)
+}
+
+// TokenSource supplies the tokens authenticating requests, as the oauth2
+// package's TokenSource does. Token may block while it fetches one.
+type TokenSource interface {
+	Token() (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func() (*Token, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token() (*Token, error) { return f() }
+
+// WithTokenSource sets ClientConfig.TokenSource, authenticating every
+// request with the tokens ts supplies.
+func WithTokenSource(ts TokenSource) Option {
+	return func(o *clientOptions) error {
+		if ts == nil {
+			return errors.New("WithTokenSource: token source must not be nil")
+		}
+		o.tokenSource = ts
+		return nil
+	}
+}
+
+// tokenCache holds the current token of a TokenSource, fetching one when
+// there is none or it is about to expire.
+type tokenCache struct {
+	src TokenSource
+	// sem admits one caller at a time, so concurrent requests wait for a
+	// single fetch rather than each starting one.
+	sem chan struct{}
+	tok *Token
+}
+
+func newTokenCache(src TokenSource) *tokenCache {
+	return &tokenCache{src: src, sem: make(chan struct{}, 1)}
+}
+
+// token returns a valid token, fetching a new one in place of rejected,
+// a token the server turned down, when that is still the current one.
+func (tc *tokenCache) token(ctx context.Context, rejected *Token) (*Token, error) {
+	select {
+	case tc.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-tc.sem }()
+	if tc.tok != nil && tc.tok != rejected && tc.tok.valid(time.Now()) {
+		return tc.tok, nil
+	}
+	tok, err := tc.src.Token()
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%w: %w", ErrAuthRefresh, err)
+	case tok == nil || tok.AccessToken == "":
+		return nil, fmt.Errorf("%w: the token source returned no access token", ErrAuthRefresh)
+	}
+	tc.tok = tok
+	return tok, nil
+}
+
+// needsAuthInterceptor reports whether requests need interceptAuth: every
+// request of a TokenSource, whose token changes, and those of transports
+// without headers for an APIKey, which the others send themselves.
+func (cfg ClientConfig) needsAuthInterceptor(transport string) bool {
+	return cfg.TokenSource != nil || (cfg.APIKey != "" || cfg.APIKeyFile != "") && !sendsHeaders(transport)
+}
+
+// sendsHeaders reports whether transport authenticates with HTTP headers
+// rather than Meta.Authorization.
+func sendsHeaders(transport string) bool {
+	switch transport {
+	case TransportHTTP, TransportTLS, TransportHTTP3, TransportGRPC, TransportWebSocket:
+		return true
+	}
+	return false
+}
+
+// authorizationKey carries the Authorization value interceptAuth chose to
+// the transports sending headers, in place of their APIKey.
+type authorizationKey struct{}
+
+// contextAuthorization returns the Authorization value carried by ctx.
+func contextAuthorization(ctx context.Context) (string, bool) {
+	auth, ok := ctx.Value(authorizationKey{}).(string)
+	return auth, ok
+}
+
+// redactAuthorization returns a copy of meta with its Authorization
+// redacted, and whether it had one.
+func redactAuthorization(meta *Meta) (*Meta, bool) {
+	if meta == nil || meta.Authorization == "" {
+		return meta, false
+	}
+	redacted := *meta
+	redacted.Authorization = Secret(meta.Authorization).String()
+	return &redacted, true
+}
+
+// interceptAuth authenticates req with ClientConfig.TokenSource or APIKey.
+// It runs last, so the recorder and the interceptors before it never see
+// the credential. A request whose token the server rejects with a 401 is
+// sent once more with a fresh one.
+func (c *Client) interceptAuth(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	if c.tokens == nil {
+		return c.sendAuthorized(ctx, req, next, "Bearer "+string(c.cfg.creds.apiKey(c.cfg.APIKey)))
+	}
+	tok, err := c.tokens.token(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.sendAuthorized(ctx, req, next, tok.authorization())
+	if !rejectedToken(resp, err) {
+		return resp, err
+	}
+	c.log.InfoContext(ctx, "token rejected; refreshing", "method", req.Method, "rpc_id", req.ID)
+	if tok, err = c.tokens.token(ctx, tok); err != nil {
+		return nil, err
+	}
+	return c.sendAuthorized(ctx, req, next, tok.authorization())
+}
+
+// sendAuthorized sends req presenting authorization, as a header or, over
+// the transports without headers, in a copy of req's meta. A server that
+// echoes the request meta has the credential dropped from its response.
+func (c *Client) sendAuthorized(ctx context.Context, req *Request, next Invoker, authorization string) (*Response, error) {
+	if sendsHeaders(c.transport.Kind()) {
+		return next(context.WithValue(ctx, authorizationKey{}, authorization), req)
+	}
+	authed := *req
+	var meta Meta
+	if req.Meta != nil {
+		meta = *req.Meta
+	}
+	meta.Authorization = authorization
+	authed.Meta = &meta
+	resp, err := next(ctx, &authed)
+	if resp != nil && resp.Meta != nil && resp.Meta.Authorization != "" {
+		echoed, meta := *resp, *resp.Meta
+		meta.Authorization, echoed.Meta = "", &meta
+		resp = &echoed
+	}
+	return resp, err
+}
+
+// rejectedToken reports whether the server answered with a 401, or its
+// JSON-RPC equivalent, that a fresh token may cure. A 403 refuses the
+// identity rather than the token, so it is not retried.
+func rejectedToken(resp *Response, err error) bool {
+	var apiErr *APIError
+	return errors.As(callError(resp, err), &apiErr) && (apiErr.Status == http.StatusUnauthorized || apiErr.Code == CodeUnauthorized)
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyOverInProc(t *testing.T) {
+	const key = "sk-live-secret"
+	var seen []string
+	handler := func(req Request) (Response, error) {
+		if req.Meta != nil {
+			seen = append(seen, req.Meta.Authorization)
+		}
+		// Echo the meta back, as some servers do.
+		return *defaultHandler(&req), nil
+	}
+	sink := &recordingSink{}
+	var logs strings.Builder
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: handler, LogBodies: true}),
+		WithAPIKey(key),
+		WithTranscriptRecorder(sink),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	if len(seen) != 2 || seen[0] != "Bearer "+key || seen[1] != seen[0] {
+		t.Fatalf("server saw authorization %q", seen)
+	}
+	for _, e := range sink.entries {
+		if strings.Contains(string(e.Message), key) {
+			t.Fatalf("transcript recorded the key: %s", e.Message)
+		}
+	}
+	if !strings.Contains(logs.String(), "request_body") || strings.Contains(logs.String(), key) {
+		t.Fatalf("logs leak the key or lack bodies:\n%s", logs.String())
+	}
+
+	if _, err := NewClient("http://localhost/mcp", WithAPIKey("")); err == nil {
+		t.Fatal("WithAPIKey accepted an empty key")
+	}
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer right" {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithAPIKey("right"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize with the right key: %v", err)
+	}
+	c.Close(context.Background())
+
+	c, err = NewClient(srv.URL, WithAPIKey("wrong"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	_, err = c.Initialize(context.Background())
+	var apiErr *APIError
+	if !errors.Is(err, ErrUnauthorized) || !errors.As(err, &apiErr) || apiErr.Message != "invalid api key" {
+		t.Fatalf("Initialize with the wrong key: got %v, want ErrUnauthorized with the server's message", err)
+	}
+}
+
+// tokenServer accepts only the token in *want.
+func tokenServer(t *testing.T, want *atomic.Value) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+want.Load().(string) {
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		}
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTokenSourceRefreshesRejectedToken(t *testing.T) {
+	var want atomic.Value
+	want.Store("t2")
+	srv := tokenServer(t, &want)
+	var fetches atomic.Int32
+	ts := TokenSourceFunc(func() (*Token, error) {
+		n := fetches.Add(1)
+		return &Token{AccessToken: Secret(fmt.Sprintf("t%d", n)), Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	sink := &recordingSink{}
+	c, err := NewClient(srv.URL, WithTokenSource(ts), WithTranscriptRecorder(sink))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	// t1 is turned down, so the request is retried once with t2.
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("fetched %d tokens, want 2", n)
+	}
+	for _, e := range sink.entries {
+		if strings.Contains(string(e.Message), `"t1"`) || strings.Contains(string(e.Message), "Bearer") {
+			t.Fatalf("transcript recorded a token: %s", e.Message)
+		}
+	}
+
+	// A token that stays rejected fails after the single retry.
+	want.Store("never")
+	if _, err := c.Embed(context.Background(), "text"); !errors.Is(err, ErrUnauthorized) || fetches.Load() != 3 {
+		t.Fatalf("Embed with a revoked token: %v after %d fetches", err, fetches.Load())
+	}
+}
+
+func TestTokenSourceSingleFlight(t *testing.T) {
+	var want atomic.Value
+	want.Store("shared")
+	srv := tokenServer(t, &want)
+	var fetches atomic.Int32
+	ts := TokenSourceFunc(func() (*Token, error) {
+		fetches.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return &Token{AccessToken: "shared", TokenType: "Bearer"}, nil
+	})
+	c, err := NewClient(srv.URL, WithTokenSource(ts))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Ping(context.Background())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("16 concurrent requests fetched %d tokens, want 1", n)
+	}
+}
+
+func TestTokenSourceExpiryAndFailure(t *testing.T) {
+	var want atomic.Value
+	want.Store("short")
+	srv := tokenServer(t, &want)
+	var fetches atomic.Int32
+	fail := errors.New("idp unavailable")
+	ts := TokenSourceFunc(func() (*Token, error) {
+		if fetches.Add(1) > 2 {
+			return nil, fail
+		}
+		// Inside the refresh margin, so every request fetches anew.
+		return &Token{AccessToken: "short", Expiry: time.Now().Add(time.Second)}, nil
+	})
+	c, err := NewClient(srv.URL, WithTokenSource(ts))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 2; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping %d: %v", i, err)
+		}
+	}
+	_, err = c.Ping(context.Background())
+	if !errors.Is(err, ErrAuthRefresh) || !errors.Is(err, ErrUnauthorized) || !errors.Is(err, fail) {
+		t.Fatalf("Ping with a failing source: got %v, want ErrAuthRefresh wrapping its error", err)
+	}
+
+	if _, err := NewClient(srv.URL, WithTokenSource(ts), WithAPIKey("k")); err == nil {
+		t.Fatal("an api key and a token source were combined")
+	}
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outlier detection defaults applied when an OutlierPolicy leaves a
+// setting unset.
+const (
+	DefaultOutlierErrorRate   = 0.5
+	DefaultOutlierMinRequests = 5
+)
+
+// healthDecay is the weight of each outcome in the moving averages of
+// EndpointScore.
+const healthDecay = 0.2
+
+// latencyFloor is the shortest latency Score divides by, so an endpoint
+// not yet timed is not weighted without bound.
+const latencyFloor = time.Millisecond
+
+// EndpointScore is the health the client tracks of one endpoint of
+// WithEndpoints, which Stats reports and a Balancer ranks endpoints by.
+type EndpointScore struct {
+	// Label is the endpoint label, as FailoverEvent names endpoints, and
+	// Index the endpoint's position in WithEndpoints.
+	Label string
+	Index int
+	// Requests counts the requests sent to the endpoint, and Failures those
+	// that failed it: connection failures, timeouts, and 5xx statuses.
+	// Application errors are answers, and count as successes.
+	Requests, Failures int64
+	// SuccessRate and Latency are exponentially weighted moving averages of
+	// the outcomes of its requests and of the round trips of those that
+	// succeeded. An endpoint not yet tried, or just readmitted, has a
+	// SuccessRate of 1; one never timed has no Latency.
+	SuccessRate float64
+	Latency     time.Duration
+	// Score is SuccessRate per millisecond of Latency, taken to be at least
+	// a millisecond: the share of requests NewWeightedBalancer gives the
+	// endpoint against the others.
+	Score float64
+	// Ejected reports an endpoint taking no requests until EjectedUntil,
+	// after which the next request probes it: one that succeeds readmits
+	// the endpoint, one that fails ejects it again. Without WithBalancer it
+	// is an endpoint failover skips while it cools down.
+	Ejected      bool
+	EjectedUntil time.Time
+}
+
+// Balancer spreads the requests of a client with several WithEndpoints
+// over them, replacing failover's preference order; see WithBalancer.
+// Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Pick returns the Index of each endpoint the next request may try, in
+	// the order it tries them as earlier ones fail with a connection-class
+	// error, chosen among endpoints, those not ejected. Endpoints left out
+	// are not tried.
+	Pick(endpoints []EndpointScore) []int
+}
+
+// NewWeightedBalancer returns a Balancer sending each endpoint a share of
+// the requests proportional to its Score, interleaved by smooth weighted
+// round-robin and so without randomness, and failing over to the others
+// by Score.
+func NewWeightedBalancer() Balancer {
+	return &weightedBalancer{current: make(map[int]float64)}
+}
+
+type weightedBalancer struct {
+	mu sync.Mutex
+	// current holds each endpoint's running weight, raised by its Score
+	// at every pick and lowered by the total when it is picked.
+	current map[int]float64
+}
+
+func (b *weightedBalancer) Pick(endpoints []EndpointScore) []int {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	var total float64
+	best := 0
+	for i, e := range endpoints {
+		b.current[e.Index] += e.Score
+		total += e.Score
+		if b.current[e.Index] > b.current[endpoints[best].Index] {
+			best = i
+		}
+	}
+	b.current[endpoints[best].Index] -= total
+	b.mu.Unlock()
+
+	rest := make([]EndpointScore, 0, len(endpoints)-1)
+	rest = append(rest, endpoints[:best]...)
+	rest = append(rest, endpoints[best+1:]...)
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Score > rest[j].Score })
+	order := []int{endpoints[best].Index}
+	for _, e := range rest {
+		order = append(order, e.Index)
+	}
+	return order
+}
+
+// OutlierPolicy ejects an endpoint whose requests fail too often from the
+// rotation of WithBalancer for a cool-down; see EndpointScore.Ejected.
+type OutlierPolicy struct {
+	// MaxErrorRate is the failure rate, as one minus the endpoint's
+	// SuccessRate, above which it is ejected. Zero selects
+	// DefaultOutlierErrorRate.
+	MaxErrorRate float64
+	// MinRequests is how many requests an endpoint takes after it is
+	// admitted before it can be ejected. Zero selects
+	// DefaultOutlierMinRequests.
+	MinRequests int
+	// Cooldown is how long an ejected endpoint takes no requests. Zero
+	// selects the failover cooldown of WithFailoverCooldown.
+	Cooldown time.Duration
+}
+
+func (p OutlierPolicy) withDefaults(cooldown time.Duration) OutlierPolicy {
+	if p.MaxErrorRate == 0 {
+		p.MaxErrorRate = DefaultOutlierErrorRate
+	}
+	if p.MinRequests == 0 {
+		p.MinRequests = DefaultOutlierMinRequests
+	}
+	if p.Cooldown == 0 {
+		p.Cooldown = cooldown
+	}
+	return p
+}
+
+func (p OutlierPolicy) validate() error {
+	if p.MaxErrorRate < 0 || p.MaxErrorRate >= 1 {
+		return fmt.Errorf("outlier error rate must be in [0, 1), got %g", p.MaxErrorRate)
+	}
+	if p.MinRequests < 0 || p.Cooldown < 0 {
+		return errors.New("outlier settings must not be negative")
+	}
+	return nil
+}
+
+// WithBalancer has a client with several WithEndpoints spread its
+// requests over them as b picks, rather than send them all to the most
+// preferred healthy one, with endpoints failing too often ejected as
+// WithOutlierDetection says. NewWeightedBalancer is the balancer routing
+// by health; Stats reports each endpoint's EndpointScore either way.
+func WithBalancer(b Balancer) Option {
+	return func(o *clientOptions) error {
+		if b == nil {
+			return errors.New("WithBalancer: balancer is nil")
+		}
+		o.balancer = b
+		return nil
+	}
+}
+
+// WithOutlierDetection sets the OutlierPolicy of WithBalancer, which
+// otherwise ejects endpoints by the policy's defaults.
+func WithOutlierDetection(p OutlierPolicy) Option {
+	return func(o *clientOptions) error {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("WithOutlierDetection: %w", err)
+		}
+		o.outliers = p
+		return nil
+	}
+}
+
+// endpointHealth is the health a failoverTransport tracks of a member.
+type endpointHealth struct {
+	requests, failures int64
+	success            float64
+	latency            time.Duration
+	// admitted counts the requests since the member was admitted, and
+	// ejectedUntil is set while it is ejected by outlier detection.
+	admitted     int
+	ejectedUntil time.Time
+	// probing marks an ejected member whose probe is in flight.
+	probing bool
+}
+
+func newEndpointHealth() endpointHealth {
+	return endpointHealth{success: 1}
+}
+
+// score reports h for the member labelled label at index.
+func (h *endpointHealth) score(label string, index int) EndpointScore {
+	return EndpointScore{
+		Label:        label,
+		Index:        index,
+		Requests:     h.requests,
+		Failures:     h.failures,
+		SuccessRate:  h.success,
+		Latency:      h.latency,
+		Score:        h.success * float64(time.Millisecond) / float64(max(h.latency, latencyFloor)),
+		Ejected:      !h.ejectedUntil.IsZero(),
+		EjectedUntil: h.ejectedUntil,
+	}
+}
+
+// observe counts a request that took d and failed the endpoint or not.
+func (h *endpointHealth) observe(d time.Duration, failed bool) {
+	h.requests++
+	h.admitted++
+	outcome := 1.0
+	if failed {
+		h.failures++
+		outcome = 0
+	}
+	h.success += healthDecay * (outcome - h.success)
+	switch {
+	case failed:
+	case h.latency == 0:
+		h.latency = d
+	default:
+		h.latency += time.Duration(healthDecay * float64(d-h.latency))
+	}
+}
+
+// endpointFailure reports whether err, the failure of a request, counts
+// against the health of its endpoint.
+func endpointFailure(err error) bool {
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &apiErr):
+		return apiErr.Status >= 500
+	}
+	return isConnectionError(err) || errors.Is(err, ErrReadTimeout) || errors.Is(err, ErrWriteTimeout)
+}
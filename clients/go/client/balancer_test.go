@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestWeightedBalancerSimulation plays two endpoints on a fake clock the
+// stubs advance by their latency, one of which slows, fails and recovers.
+func TestWeightedBalancerSimulation(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	var latencyB atomic.Int64
+	var downB atomic.Bool
+	latencyB.Store(int64(10 * time.Millisecond))
+	a := &stubTransport{kind: "a", fn: func(req *Request) (*Response, error) {
+		clock.tick(10 * time.Millisecond)
+		return defaultHandler(req), nil
+	}}
+	b := &stubTransport{kind: "b", fn: func(req *Request) (*Response, error) {
+		if downB.Load() {
+			return nil, refused
+		}
+		clock.tick(time.Duration(latencyB.Load()))
+		return defaultHandler(req), nil
+	}}
+	var events []FailoverEvent
+	tr := newStubFailover(time.Minute, &events, a, b)
+	tr.now = clock.now
+	tr.balance(NewWeightedBalancer(), OutlierPolicy{Cooldown: 10 * time.Second})
+	c := NewWithTransport(ClientConfig{}, tr)
+	ctx := context.Background()
+
+	// phase sends n calls, all of which succeed, and returns how many
+	// reached b.
+	phase := func(name string, n int) int64 {
+		t.Helper()
+		before := b.calls.Load()
+		for i := 0; i < n; i++ {
+			if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+				t.Fatalf("%s: call %d: %v", name, i, err)
+			}
+		}
+		return b.calls.Load() - before
+	}
+
+	// Equal endpoints share the traffic evenly, but for b's lead while it
+	// is untimed.
+	if got := phase("equal", 100); got < 45 || got > 55 {
+		t.Fatalf("b took %d of 100 calls while equal", got)
+	}
+
+	// A slow endpoint takes less, by its score: a quarter of a's at four
+	// times the latency, once the average has caught up.
+	latencyB.Store(int64(40 * time.Millisecond))
+	phase("slowing", 50)
+	if got := phase("slow", 100); got < 15 || got > 25 {
+		t.Fatalf("b took %d of 100 calls while slow", got)
+	}
+
+	// A failing endpoint is ejected, and then takes none.
+	downB.Store(true)
+	phase("failing", 100)
+	st := c.Stats()
+	if len(st.Endpoints) != 2 || !st.Endpoints[1].Ejected || st.Endpoints[0].Ejected || st.Endpoints[1].Failures == 0 {
+		t.Fatalf("endpoints %+v", st.Endpoints)
+	}
+	if got := phase("ejected", 100); got != 0 {
+		t.Fatalf("ejected b took %d calls", got)
+	}
+	if st := c.Stats(); st.Endpoints[0].Failures != 0 || st.Endpoints[0].SuccessRate != 1 || st.Endpoints[0].Latency != 10*time.Millisecond {
+		t.Fatalf("endpoints %+v", st.Endpoints)
+	}
+
+	// After the cool-down a probe readmits the recovered endpoint, and the
+	// traffic returns to it as its latency does.
+	downB.Store(false)
+	latencyB.Store(int64(10 * time.Millisecond))
+	clock.tick(10 * time.Second)
+	if got := phase("probe", 1); got != 1 {
+		t.Fatalf("probe reached b %d times", got)
+	}
+	if st := c.Stats(); st.Endpoints[1].Ejected || st.Endpoints[1].SuccessRate != 1 {
+		t.Fatalf("endpoints after the probe %+v", st.Endpoints)
+	}
+	phase("recovering", 50)
+	if got := phase("recovered", 100); got < 40 {
+		t.Fatalf("b took %d of 100 calls after recovering", got)
+	}
+	if len(events) != 0 {
+		t.Fatalf("balancing reported failovers %+v", events)
+	}
+}
+
+func TestOutlierProbeFailureEjectsAgain(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	a, b := okStub("a"), failingStub("b", refused)
+	var events []FailoverEvent
+	tr := newStubFailover(time.Minute, &events, a, b)
+	tr.now = clock.now
+	tr.balance(NewWeightedBalancer(), OutlierPolicy{MinRequests: 1, Cooldown: time.Second})
+	c := NewWithTransport(ClientConfig{}, tr)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	tried := b.calls.Load()
+	first := c.Stats().Endpoints[1]
+	if !first.Ejected {
+		t.Fatalf("b not ejected: %+v", first)
+	}
+	// The probe fails, which ejects b for another cool-down at once.
+	clock.tick(time.Second)
+	if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+		t.Fatalf("probe call: %v", err)
+	}
+	again := c.Stats().Endpoints[1]
+	if b.calls.Load() != tried+1 || !again.Ejected || !again.EjectedUntil.After(first.EjectedUntil) {
+		t.Fatalf("after the probe: %d calls, %+v", b.calls.Load(), again)
+	}
+}
+
+func TestWeightedBalancerProportions(t *testing.T) {
+	b := NewWeightedBalancer()
+	endpoints := []EndpointScore{{Index: 0, Score: 3}, {Index: 1, Score: 1}}
+	counts := make([]int, 2)
+	for i := 0; i < 400; i++ {
+		order := b.Pick(endpoints)
+		if len(order) != 2 || order[0] == order[1] {
+			t.Fatalf("pick %d: %v", i, order)
+		}
+		counts[order[0]]++
+	}
+	if counts[0] != 300 || counts[1] != 100 {
+		t.Fatalf("counts %v", counts)
+	}
+	if order := b.Pick(nil); order != nil {
+		t.Fatalf("pick among none: %v", order)
+	}
+}
+
+func TestNewClientWithBalancer(t *testing.T) {
+	var hits [2]atomic.Int64
+	servers := make([]ClientConfig, 2)
+	for i := range servers {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+			httpHandler(defaultHandler).ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		servers[i] = ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL}
+	}
+	c, err := NewClient("", WithEndpoints(servers...), WithBalancer(NewWeightedBalancer()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 20; i++ {
+		if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if hits[0].Load() == 0 || hits[1].Load() == 0 {
+		t.Fatalf("hits %d, %d", hits[0].Load(), hits[1].Load())
+	}
+	st := c.Stats()
+	if len(st.Endpoints) != 2 || st.Endpoints[0].Requests+st.Endpoints[1].Requests != 20 {
+		t.Fatalf("endpoints %+v", st.Endpoints)
+	}
+
+	for _, opt := range []Option{
+		WithBalancer(nil),
+		WithOutlierDetection(OutlierPolicy{MaxErrorRate: 1}),
+		WithOutlierDetection(OutlierPolicy{Cooldown: -time.Second}),
+	} {
+		if _, err := NewClient("", WithEndpoints(servers...), opt); err == nil {
+			t.Fatal("invalid balancer option accepted")
+		}
+	}
+}
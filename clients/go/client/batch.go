@@ -0,0 +1,410 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// Batch defaults for EmbedBatch.
+const (
+	// DefaultMaxBatchSize is the chunk size used when neither the caller nor
+	// the server's capabilities set one.
+	DefaultMaxBatchSize = 64
+	// DefaultBatchConcurrency is how many chunks are in flight at once.
+	DefaultBatchConcurrency = 4
+)
+
+// EmbedOption customizes a single Embed or EmbedBatch call. The batching
+// options only affect EmbedBatch.
+type EmbedOption func(*embedOptions)
+
+type embedOptions struct {
+	// call names the method of Client the options were given, as
+	// checkEmbed records it.
+	call string
+	// model is the model the call embeds with, ClientConfig.Model unless
+	// WithModel says otherwise.
+	model       string
+	size        int
+	concurrency int
+	partial     bool
+	progress    func(done, total int)
+	noCache     bool
+	dtype       vectors.DType
+	dimensions  int
+	// expectedDim is the dimension of WithExpectedDimension.
+	expectedDim int
+	info        *EmbedInfo
+	// spool is set by WithSpoolOnFailure.
+	spool bool
+	// clientTruncate is set by planDimensions when the client, not the
+	// server, truncates to dimensions.
+	clientTruncate bool
+	truncate       TruncateMode
+	// truncated lists the inputs planTruncation trimmed.
+	truncated []int
+	// usage collects the Usage and the other reports for info; see
+	// tallyUsage.
+	usage *resultTally
+	// preprocessed marks inputs ClientConfig.Preprocess has been applied
+	// to, and keepChunks a call reporting the vectors of chunked inputs
+	// in info rather than failing with ErrChunkedInput.
+	preprocessed, keepChunks bool
+
+	// The per-call options of RequestOptions; see planCall.
+	timeout  time.Duration
+	noRetry  bool
+	priority Priority
+	alone    bool
+	// maxRequestBytes is the limit of WithMaxRequestBytes.
+	maxRequestBytes int
+	// overrides holds the names of the per-call options the call set, and
+	// conflicts those it set to different values.
+	overrides map[string]bool
+	conflicts []string
+}
+
+// WithNoCache bypasses the embedding cache for one call: every input is sent
+// to the server and the results are not stored.
+func WithNoCache() EmbedOption {
+	return func(o *embedOptions) { o.noCache = true }
+}
+
+// WithBatchSize overrides the number of inputs sent per request.
+func WithBatchSize(n int) EmbedOption {
+	return func(o *embedOptions) { o.size = n }
+}
+
+// WithConcurrency bounds how many chunk requests are in flight at once.
+func WithConcurrency(n int) EmbedOption {
+	return func(o *embedOptions) { o.concurrency = n }
+}
+
+// WithPartialResults makes EmbedBatch keep going when a chunk fails. The
+// returned slice holds every successful vector in the position of its
+// input, nil for inputs of failed chunks, alongside a *BatchError holding
+// one *ChunkError per failure. EmbedBatchItems pairs each input with its
+// own error.
+func WithPartialResults() EmbedOption {
+	return func(o *embedOptions) { o.partial = true }
+}
+
+// WithProgress calls fn with the number of inputs embedded so far after each
+// chunk completes. Calls are serialized and done only increases.
+func WithProgress(fn func(done, total int)) EmbedOption {
+	return func(o *embedOptions) { o.progress = fn }
+}
+
+// ChunkError identifies the chunk of an EmbedBatch call that failed; Start
+// and End delimit its inputs as a half-open range.
+type ChunkError struct {
+	Chunk      int
+	Start, End int
+	Err        error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("embed batch chunk %d (inputs %d-%d): %v", e.Chunk, e.Start, e.End-1, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// BatchProgressError is returned by an EmbedBatch call whose context ended
+// before it finished, saying how far it got. Err is the context error or,
+// without WithPartialResults, the *ChunkError of the chunk it cut short.
+type BatchProgressError struct {
+	// Completed of Chunks chunks were embedded, Embedded of Total inputs.
+	Completed, Chunks int
+	Embedded, Total   int
+	Err               error
+}
+
+func (e *BatchProgressError) Error() string {
+	return fmt.Sprintf("embed batch stopped after %d of %d chunks (%d of %d inputs): %v", e.Completed, e.Chunks, e.Embedded, e.Total, e.Err)
+}
+
+func (e *BatchProgressError) Unwrap() error { return e.Err }
+
+// BatchError is the error of an EmbedBatch call under WithPartialResults
+// that did not embed every input. errors.Is and errors.As see each of
+// Errors.
+type BatchError struct {
+	// Errors holds the *ChunkError of each failed chunk, in chunk order,
+	// then the *BatchProgressError of a call whose context ended first.
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *BatchError) Unwrap() []error { return e.Errors }
+
+// BatchItem is the outcome of one input of EmbedBatchItems.
+type BatchItem struct {
+	// Index is the position of the input in texts.
+	Index int
+	// Vector is the input's embedding, nil when Err is set.
+	Vector []float32
+	// Err is the *ChunkError of the input's failed chunk, the
+	// *BatchProgressError of a call whose context ended before the input
+	// was embedded, or the error of a call that failed before embedding
+	// anything.
+	Err error
+}
+
+// EmbedBatchItems is EmbedBatch under WithPartialResults returning one
+// BatchItem per input: items[i] is always texts[i]'s, whatever order the
+// chunks complete in. The error is the call's *BatchError, or the error of
+// a call that failed before embedding anything, which every item then
+// carries.
+func (c *Client) EmbedBatchItems(ctx context.Context, texts []string, opts ...EmbedOption) ([]BatchItem, error) {
+	vecs, err := c.EmbedBatch(ctx, texts, append(slices.Clip(opts), WithPartialResults())...)
+	items := make([]BatchItem, len(texts))
+	for i := range items {
+		items[i].Index = i
+		if vecs != nil {
+			items[i].Vector = vecs[i]
+		}
+	}
+	if err == nil {
+		return items, nil
+	}
+	var batchErr *BatchError
+	if vecs == nil || !errors.As(err, &batchErr) {
+		for i := range items {
+			items[i].Err = err
+		}
+		return items, err
+	}
+	stopped := err
+	for _, e := range batchErr.Errors {
+		chunkErr, ok := e.(*ChunkError)
+		if !ok {
+			stopped = e
+			continue
+		}
+		for i := chunkErr.Start; i < chunkErr.End; i++ {
+			items[i].Vector, items[i].Err = nil, chunkErr
+		}
+	}
+	for i := range items {
+		if items[i].Vector == nil && items[i].Err == nil {
+			items[i].Err = stopped
+		}
+	}
+	return items, err
+}
+
+// EmbedBatch embeds texts in chunks of at most the batch size, issuing up to
+// DefaultBatchConcurrency chunks at a time, and returns the vectors in input
+// order. The batch size comes from WithBatchSize, ClientConfig.MaxBatchSize,
+// or the max_batch_size the server advertises for embed in its capabilities,
+// in that order, falling back to DefaultMaxBatchSize.
+//
+// In JSONRPC2 mode over the http, tls, and http3 transports the chunks in
+// flight together go out as one JSON-RPC 2.0 batch request.
+//
+// Options that cannot be combined fail the call with a *ValidationError
+// before anything is sent. With ClientConfig.ValidateModel the model is
+// checked against ListModels first. By default the first failing chunk cancels the rest and its
+// *ChunkError is returned; see WithPartialResults for the alternative. A
+// call whose ctx ends returns a *BatchProgressError wrapping ctx.Err().
+func (c *Client) EmbedBatch(ctx context.Context, texts []string, opts ...EmbedOption) ([][]float32, error) {
+	if err := c.gate.check(ctx); err != nil {
+		return nil, err
+	}
+	o := embedOptions{model: c.cfg.Model, size: c.cfg.MaxBatchSize, concurrency: DefaultBatchConcurrency}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if route, ok := c.routes[o.model]; ok {
+		return route.EmbedBatch(ctx, texts, opts...)
+	}
+	if err := c.checkEmbed("EmbedBatch", &o); err != nil {
+		return nil, fmt.Errorf("embed batch: %w", err)
+	}
+	if o.spool {
+		return c.embedOrSpool(ctx, texts, o, opts)
+	}
+	if c.preprocess != nil && !o.preprocessed {
+		return c.embedPreprocessed(ctx, texts, o, opts)
+	}
+	ctx, cancelCall := c.planCall(ctx, &o)
+	defer cancelCall()
+	ctx = o.tallyUsage(ctx)
+	out := make([][]float32, len(texts))
+	if len(texts) == 0 {
+		return out, nil
+	}
+	if c.cfg.ValidateModel {
+		if err := c.validateModel(ctx, o.model); err != nil {
+			return nil, fmt.Errorf("embed batch: %w", err)
+		}
+	}
+	if err := c.planDimensions(ctx, &o); err != nil {
+		return nil, fmt.Errorf("embed batch: %w", err)
+	}
+	texts, err := c.planTruncation(ctx, texts, &o)
+	if err != nil {
+		return nil, fmt.Errorf("embed batch: %w", err)
+	}
+	if o.size == 0 {
+		size, err := c.negotiatedBatchSize(ctx)
+		if err != nil {
+			return nil, err
+		}
+		o.size = size
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		errs      []*ChunkError
+		done      int
+		completed int
+	)
+	sem := make(chan struct{}, o.concurrency)
+	launched := 0
+	// In JSONRPC2 mode, groups of chunks go out as one batch each.
+	var group *rpcBatch
+	grouping, grouped := c.rpcBatchSize(o), 0
+launch:
+	for start := 0; start < len(texts); start += o.size {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break launch
+		}
+		chunk, end := launched, min(start+o.size, len(texts))
+		launched++
+		chunkCtx := ctx
+		var member *batchMember
+		if grouping > 0 {
+			if grouped%grouping == 0 {
+				left := (len(texts) - start + o.size - 1) / o.size
+				group = newRPCBatch(c.transport.(batchTransport), min(grouping, left))
+			}
+			grouped++
+			member = &batchMember{b: group}
+			chunkCtx = context.WithValue(ctx, batchMemberKey{}, member)
+		}
+		wg.Add(1)
+		go func(chunk, start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			vectors, err := c.embedInputs(withChunkDest(chunkCtx, start), texts[start:end], o)
+			if member != nil {
+				member.leave(ctx)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, &ChunkError{Chunk: chunk, Start: start, End: end, Err: err})
+				if !o.partial {
+					cancel()
+				}
+				return
+			}
+			copy(out[start:end], vectors)
+			done += end - start
+			completed++
+			if o.progress != nil {
+				o.progress(done, len(texts))
+			}
+		}(chunk, start, end)
+	}
+	wg.Wait()
+	progress := func(err error) error {
+		chunks := (len(texts) + o.size - 1) / o.size
+		return &BatchProgressError{Completed: completed, Chunks: chunks, Embedded: done, Total: len(texts), Err: err}
+	}
+
+	if !o.partial {
+		if len(errs) > 0 {
+			// Chunks cancelled by the first failure report context.Canceled;
+			// surface the failure that caused it.
+			first := errs[0]
+			for _, e := range errs {
+				if !errors.Is(e.Err, context.Canceled) || parent.Err() != nil {
+					first = e
+					break
+				}
+			}
+			if parent.Err() != nil {
+				return nil, progress(first)
+			}
+			return nil, first
+		}
+		if err := parent.Err(); err != nil {
+			return nil, progress(err)
+		}
+		o.reportInfo(texts)
+		return out, nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Chunk < errs[j].Chunk })
+	joined := make([]error, 0, len(errs)+1)
+	for _, e := range errs {
+		joined = append(joined, e)
+	}
+	o.reportInfo(texts)
+	if err := parent.Err(); err != nil && done < len(texts) {
+		joined = append(joined, progress(err))
+	}
+	if len(joined) == 0 {
+		return out, nil
+	}
+	return out, &BatchError{Errors: joined}
+}
+
+// negotiatedBatchSize asks the server for its embed batch limit once and
+// caches the answer. Servers that do not advertise one, or reject the
+// query, and dry runs get DefaultMaxBatchSize.
+func (c *Client) negotiatedBatchSize(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	size := c.batchSize
+	c.mu.Unlock()
+	if size > 0 {
+		return size, nil
+	}
+
+	var caps struct {
+		Embed struct {
+			MaxBatchSize int `json:"max_batch_size"`
+		} `json:"embed"`
+	}
+	params := map[string]any{"requested": []string{"embed"}}
+	if id := c.SessionID(); id != "" {
+		params["session_id"] = id
+	}
+	err := c.Call(ctx, MethodCapabilities, params, &caps)
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr), errors.Is(err, ErrDryRun):
+	case err != nil:
+		return 0, err
+	}
+	size = caps.Embed.MaxBatchSize
+	if size <= 0 {
+		size = DefaultMaxBatchSize
+	}
+	c.mu.Lock()
+	c.batchSize = size
+	c.mu.Unlock()
+	return size, nil
+}
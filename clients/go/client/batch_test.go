@@ -0,0 +1,262 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchStub answers embed requests with defaultHandler, advertising
+// maxBatch in its capabilities, failing chunks that contain "bad", and
+// recording the size of every chunk it receives.
+type batchStub struct {
+	maxBatch int
+	delay    time.Duration
+
+	mu       sync.Mutex
+	chunks   []int
+	inflight atomic.Int64
+	peak     atomic.Int64
+}
+
+func (s *batchStub) transport() *stubTransport {
+	return &stubTransport{kind: "stub", fn: s.handle}
+}
+
+func (s *batchStub) handle(req *Request) (*Response, error) {
+	switch req.Method {
+	case MethodCapabilities:
+		raw, _ := json.Marshal(map[string]any{"embed": map[string]int{"max_batch_size": s.maxBatch}})
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}, nil
+	case MethodEmbed:
+		n := s.inflight.Add(1)
+		defer s.inflight.Add(-1)
+		for p := s.peak.Load(); n > p && !s.peak.CompareAndSwap(p, n); p = s.peak.Load() {
+		}
+		time.Sleep(s.delay)
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		s.mu.Lock()
+		s.chunks = append(s.chunks, len(params.Inputs))
+		s.mu.Unlock()
+		for _, in := range params.Inputs {
+			if strings.Contains(in, "bad") {
+				return nil, fmt.Errorf("http request: unexpected status 500: %s", in)
+			}
+		}
+	}
+	return defaultHandler(req), nil
+}
+
+func batchInputs(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i+1)
+	}
+	return texts
+}
+
+func TestEmbedBatchPreservesOrder(t *testing.T) {
+	stub := &batchStub{delay: 5 * time.Millisecond}
+	c := NewWithTransport(ClientConfig{}, stub.transport())
+	texts := batchInputs(23)
+
+	var progress []int
+	vectors, err := c.EmbedBatch(context.Background(), texts,
+		WithBatchSize(5), WithConcurrency(3),
+		WithProgress(func(done, total int) {
+			if total != len(texts) {
+				t.Errorf("progress total %d", total)
+			}
+			progress = append(progress, done)
+		}))
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	for i, v := range vectors {
+		if int(v[0]) != len(texts[i]) {
+			t.Fatalf("vector %d belongs to input of length %v", i, v[0])
+		}
+	}
+	if len(stub.chunks) != 5 {
+		t.Fatalf("expected 5 chunks, got %v", stub.chunks)
+	}
+	if peak := stub.peak.Load(); peak < 2 || peak > 3 {
+		t.Fatalf("expected up to 3 chunks in flight, saw %d", peak)
+	}
+	if len(progress) != 5 || progress[4] != len(texts) {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("progress went backwards: %v", progress)
+		}
+	}
+}
+
+func TestEmbedBatchNegotiatesSize(t *testing.T) {
+	stub := &batchStub{maxBatch: 4}
+	c := NewWithTransport(ClientConfig{}, stub.transport())
+	for i := 0; i < 2; i++ {
+		if _, err := c.EmbedBatch(context.Background(), batchInputs(10)); err != nil {
+			t.Fatalf("EmbedBatch: %v", err)
+		}
+	}
+	if len(stub.chunks) != 6 {
+		t.Fatalf("expected 3 chunks per batch, got %v", stub.chunks)
+	}
+	for _, n := range stub.chunks {
+		if n > 4 {
+			t.Fatalf("chunk of %d exceeds the negotiated limit", n)
+		}
+	}
+	// The capability is queried once; ClientConfig.MaxBatchSize skips it.
+	calls := c.nextID.Load() - int64(len(stub.chunks))
+	if calls != 1 {
+		t.Fatalf("expected one capabilities call, got %d", calls)
+	}
+	stub = &batchStub{maxBatch: 4}
+	c = NewWithTransport(ClientConfig{MaxBatchSize: 7}, stub.transport())
+	if _, err := c.EmbedBatch(context.Background(), batchInputs(10)); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(stub.chunks) != 2 || c.nextID.Load() != 2 {
+		t.Fatalf("expected 2 chunks without negotiation, got %v after %d calls", stub.chunks, c.nextID.Load())
+	}
+}
+
+func TestEmbedBatchChunkFailure(t *testing.T) {
+	texts := batchInputs(12)
+	texts[7] = "bad input"
+
+	c := NewWithTransport(ClientConfig{}, (&batchStub{}).transport())
+	_, err := c.EmbedBatch(context.Background(), texts, WithBatchSize(4), WithConcurrency(1))
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Chunk != 1 || chunkErr.Start != 4 || chunkErr.End != 8 {
+		t.Fatalf("expected chunk 1 (inputs 4-7) to fail, got %v", err)
+	}
+
+	vectors, err := c.EmbedBatch(context.Background(), texts, WithBatchSize(4), WithPartialResults())
+	if !errors.As(err, &chunkErr) || chunkErr.Chunk != 1 {
+		t.Fatalf("expected a chunk 1 error with partial results, got %v", err)
+	}
+	for i, v := range vectors {
+		if failed := i >= 4 && i < 8; failed != (v == nil) {
+			t.Fatalf("input %d: vector %v", i, v)
+		}
+	}
+}
+
+// TestEmbedBatchItemsMapping checks, over random batches, that every item
+// of EmbedBatchItems belongs to its input whatever order the chunks complete
+// in and whichever of them fail.
+func TestEmbedBatchItemsMapping(t *testing.T) {
+	for seed := int64(1); seed <= 40; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		size := 1 + rng.Intn(4)
+		texts := batchInputs(1 + rng.Intn(20))
+		chunks := (len(texts) + size - 1) / size
+		failed := make([]bool, chunks)
+		for i := range failed {
+			failed[i] = rng.Intn(3) == 0
+		}
+		// Each chunk answers only once the one before it in order has.
+		order := rng.Perm(chunks)
+		turn := make([]chan struct{}, chunks+1)
+		for i := range turn {
+			turn[i] = make(chan struct{})
+		}
+		close(turn[0])
+		stub := &stubTransport{kind: "stub", fn: func(req *Request) (*Response, error) {
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			chunk := (len(params.Inputs[0]) - 1) / size
+			pos := slices.Index(order, chunk)
+			<-turn[pos]
+			defer close(turn[pos+1])
+			if failed[chunk] {
+				return nil, fmt.Errorf("http request: unexpected status 500: chunk %d", chunk)
+			}
+			return defaultHandler(req), nil
+		}}
+		c := NewWithTransport(ClientConfig{}, stub)
+		items, err := c.EmbedBatchItems(context.Background(), texts, WithBatchSize(size), WithConcurrency(chunks))
+		if len(items) != len(texts) {
+			t.Fatalf("seed %d: %d items for %d inputs", seed, len(items), len(texts))
+		}
+		var batchErr *BatchError
+		if slices.Contains(failed, true) != errors.As(err, &batchErr) {
+			t.Fatalf("seed %d: failed chunks %v, error %v", seed, failed, err)
+		}
+		for i, item := range items {
+			chunkErr, _ := item.Err.(*ChunkError)
+			switch {
+			case item.Index != i:
+				t.Fatalf("seed %d: item %d has index %d", seed, i, item.Index)
+			case failed[i/size] && (item.Vector != nil || chunkErr == nil || chunkErr.Chunk != i/size || i < chunkErr.Start || i >= chunkErr.End):
+				t.Fatalf("seed %d: item %d of failed chunk %d is %+v", seed, i, i/size, item)
+			case !failed[i/size] && (item.Err != nil || int(item.Vector[0]) != len(texts[i])):
+				t.Fatalf("seed %d: item %d is %+v", seed, i, item)
+			}
+		}
+		for i, e := range errs(err) {
+			if chunkErr := e.(*ChunkError); i > 0 && chunkErr.Chunk <= errs(err)[i-1].(*ChunkError).Chunk {
+				t.Fatalf("seed %d: chunk errors out of order: %v", seed, err)
+			}
+		}
+	}
+}
+
+// errs returns the errors err unwraps to.
+func errs(err error) []error {
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+func TestEmbedBatchItemsStopped(t *testing.T) {
+	reached, release := make(chan struct{}), make(chan struct{})
+	handler := func(req *Request) *Response {
+		if strings.Contains(string(req.Params), "hold") {
+			close(reached)
+			<-release
+		}
+		return defaultHandler(req)
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(handler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reached
+		cancel()
+	}()
+	items, err := c.EmbedBatchItems(ctx, []string{"a", "hold", "c"}, WithBatchSize(1), WithConcurrency(1))
+	close(release)
+	var progress *BatchProgressError
+	if len(items) != 3 || !errors.As(err, &progress) {
+		t.Fatalf("EmbedBatchItems = %+v, %v", items, err)
+	}
+	if items[0].Err != nil || items[0].Vector == nil {
+		t.Fatalf("item 0 is %+v", items[0])
+	}
+	for _, item := range items[1:] {
+		if item.Vector != nil || !errors.Is(item.Err, context.Canceled) {
+			t.Fatalf("item %d of a cancelled call is %+v", item.Index, item)
+		}
+	}
+	if _, ok := items[2].Err.(*BatchProgressError); !ok {
+		t.Fatalf("item 2, never sent, has error %v", items[2].Err)
+	}
+}
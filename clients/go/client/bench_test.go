@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The benchmarks of this file, with those of ./vectors, form the suite
+// `make bench` runs against bench/baseline.txt. Each runs over the
+// inproc transport, so none needs a server, and draws its inputs from a
+// seeded source, so runs compare.
+
+// benchSeed seeds every synthetic input of the suite.
+const benchSeed = 20240611
+
+// benchWords builds n inputs of 8 to 40 words from a fixed vocabulary.
+func benchWords(n int) []string {
+	rng := rand.New(rand.NewSource(benchSeed))
+	vocab := strings.Fields("embedding vector model server transport request batch token stream cache index corpus query nearest cosine page job result session frame")
+	inputs := make([]string, n)
+	for i := range inputs {
+		words := make([]string, 8+rng.Intn(33))
+		for j := range words {
+			words[j] = vocab[rng.Intn(len(vocab))]
+		}
+		inputs[i] = strings.Join(words, " ")
+	}
+	return inputs
+}
+
+// benchVectors returns n vectors of dim components in [-1, 1).
+func benchVectors(n, dim int) [][]float32 {
+	rng := rand.New(rand.NewSource(benchSeed))
+	out := make([][]float32, n)
+	for i := range out {
+		out[i] = make([]float32, dim)
+		for j := range out[i] {
+			out[i][j] = 2*rng.Float32() - 1
+		}
+	}
+	return out
+}
+
+// benchHandler answers embeds with seeded vectors of dim components, in
+// encoding, and everything else as defaultHandler does.
+func benchHandler(dim int, encoding string) fakeHandler {
+	pool := benchVectors(64, dim)
+	return func(req *Request) *Response {
+		if req.Method != MethodEmbed {
+			return defaultHandler(req)
+		}
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		entries := make([]embeddingEntry, len(params.Inputs))
+		for i := range entries {
+			entries[i] = embeddingEntry{Index: i, Vector: pool[i%len(pool)]}
+		}
+		var result any = embedResult{Model: params.Model, Embeddings: entries}
+		if encoding == EncodingBase64 {
+			result = base64EmbedResult(params.Model, entries)
+		}
+		raw, _ := json.Marshal(result)
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}
+}
+
+func benchClient(b *testing.B, cfg ClientConfig, handle fakeHandler) *Client {
+	b.Helper()
+	cfg.Transport, cfg.Handler = TransportInProc, inprocHandler(handle)
+	c, err := New(cfg)
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	b.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+// BenchmarkRequestEncode encodes embed requests of 1, 32, and 256 inputs
+// into a pooled frame, as every transport does before sending.
+func BenchmarkRequestEncode(b *testing.B) {
+	for _, n := range []int{1, 32, 256} {
+		req, _ := newRequest(1, MethodEmbed, embedParams{Model: DefaultModel, Inputs: benchWords(n), EncodingFormat: EncodingBase64}, time.Unix(0, 0))
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := encodeFrame(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				f.release()
+			}
+		})
+	}
+}
+
+// BenchmarkResponseDecode decodes an embed result of 256 vectors of 768
+// dimensions as numeric arrays and as base64.
+func BenchmarkResponseDecode(b *testing.B) {
+	const batch, dim = 256, 768
+	handle := map[string]fakeHandler{EncodingFloat: benchHandler(dim, EncodingFloat), EncodingBase64: benchHandler(dim, EncodingBase64)}
+	req, _ := newRequest(1, MethodEmbed, embedParams{Model: DefaultModel, Inputs: benchWords(batch)}, time.Unix(0, 0))
+	for _, encoding := range []string{EncodingFloat, EncodingBase64} {
+		raw := handle[encoding](req).Result
+		b.Run(encoding, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := embedResult{batch: batch, dim: dim}
+				if err := json.Unmarshal(raw, &r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCodecDecode decodes the response envelope of an embed of 512
+// vectors of 1024 dimensions, and its result, from the wire bytes of JSON
+// with numeric arrays and base64 vectors and of MessagePack with bin ones.
+func BenchmarkCodecDecode(b *testing.B) {
+	const batch, dim = 512, 1024
+	req, _ := newRequest(1, MethodEmbed, embedParams{Model: DefaultModel, Inputs: benchWords(batch)}, time.Unix(0, 0))
+	float := benchHandler(dim, EncodingFloat)(req)
+	var result embedResult
+	if err := json.Unmarshal(float.Result, &result); err != nil {
+		b.Fatal(err)
+	}
+	wire := map[string][]byte{}
+	wire["json-float"], _ = json.Marshal(float)
+	wire["json-base64"], _ = json.Marshal(benchHandler(dim, EncodingBase64)(req))
+	for name, codec := range map[string]Codec{"msgpack": MsgPackCodec, "cbor": CBORCodec, "cbor-typed": CBORTypedArrayCodec} {
+		wire[name], _ = codec.Marshal(map[string]any{"jsonrpc": JSONRPCVersion, "id": req.ID, "result": result})
+	}
+	for _, name := range []string{"json-float", "json-base64", "msgpack", "cbor", "cbor-typed"} {
+		codec, raw := JSONCodec, wire[name]
+		switch name {
+		case "msgpack":
+			codec = MsgPackCodec
+		case "cbor", "cbor-typed":
+			codec = CBORCodec
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var resp Response
+				if err := codec.Unmarshal(raw, &resp); err != nil {
+					b.Fatal(err)
+				}
+				r := embedResult{batch: batch, dim: dim}
+				if err := json.Unmarshal(resp.Result, &r); err != nil || len(r.Embeddings) != batch {
+					b.Fatalf("%d vectors, %v", len(r.Embeddings), err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEmbedBatchChunking embeds 2,048 inputs in chunks of 64, four at
+// a time, end to end over the inproc transport.
+func BenchmarkEmbedBatchChunking(b *testing.B) {
+	c := benchClient(b, ClientConfig{}, benchHandler(256, EncodingBase64))
+	texts := benchWords(2048)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vectors, err := c.EmbedBatch(context.Background(), texts, WithBatchSize(64), WithConcurrency(4))
+		if err != nil || len(vectors) != len(texts) {
+			b.Fatalf("EmbedBatch: %d vectors, %v", len(vectors), err)
+		}
+	}
+}
+
+// BenchmarkEmbedBatchInto embeds 256 inputs of 768 dimensions with
+// EmbedBatch and with EmbedBatchInto reusing one buffer, the difference in
+// B/op being the vectors EmbedBatchInto decodes in place. It is left out of
+// the suite `make bench` checks; run it with -bench EmbedBatchInto.
+func BenchmarkEmbedBatchInto(b *testing.B) {
+	const batch, dim = 256, 768
+	c := benchClient(b, ClientConfig{}, benchHandler(dim, EncodingBase64))
+	texts := benchWords(batch)
+	dst := make([]float32, batch*dim)
+	opts := []EmbedOption{WithExpectedDimension(dim)}
+	for _, name := range []string{"EmbedBatch", "EmbedBatchInto"} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if name == "EmbedBatch" {
+					_, err = c.EmbedBatch(context.Background(), texts, opts...)
+				} else {
+					_, err = c.EmbedBatchInto(context.Background(), texts, dst, opts...)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTranscriptRecording embeds single inputs with no recorder and
+// with a FileRecorder streaming JSONL, the difference being the cost of
+// recording a call.
+func BenchmarkTranscriptRecording(b *testing.B) {
+	inputs := benchWords(256)
+	for _, name := range []string{"off", "jsonl"} {
+		b.Run(name, func(b *testing.B) {
+			var cfg ClientConfig
+			if name == "jsonl" {
+				rec := NewFileRecorder(filepath.Join(b.TempDir(), "bench.jsonl"), TransportInProc)
+				b.Cleanup(func() { _ = rec.Close() })
+				cfg.Recorder = rec
+			}
+			c := benchClient(b, cfg, benchHandler(256, EncodingBase64))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Embed(context.Background(), inputs[i%len(inputs)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Benchmark configures the load RunBenchmark drives.
+type Benchmark struct {
+	// Duration is how long requests are measured for.
+	Duration time.Duration
+	// Warmup is how long requests are sent, and left out of the report,
+	// before measuring starts.
+	Warmup time.Duration
+	// RPS, when positive, starts requests at this constant rate whatever
+	// the server's latency, with Options.Concurrency bounding how many are
+	// in flight. A request waiting for a free slot is timed from when it
+	// was due, so a slow server cannot hide its queueing delay by slowing
+	// the load down. Zero keeps Options.Concurrency requests in flight.
+	RPS float64
+}
+
+// BenchmarkReport is what RunBenchmark measured. Latencies are those of the
+// successful requests, and byte counts the sizes of the JSON-RPC envelopes
+// sent and received, retries included, before any compression.
+type BenchmarkReport struct {
+	// Mode is "concurrency" for a closed loop and "rps" for a constant
+	// arrival rate.
+	Mode          string           `json:"mode"`
+	Concurrency   int              `json:"concurrency"`
+	TargetRPS     float64          `json:"target_rps,omitempty"`
+	Warmup        float64          `json:"warmup_s"`
+	Duration      float64          `json:"duration_s"`
+	Requests      int              `json:"requests"`
+	Errors        int              `json:"errors"`
+	ErrorsByClass map[string]int   `json:"errors_by_class,omitempty"`
+	Throughput    float64          `json:"throughput_rps"`
+	Latency       BenchmarkLatency `json:"latency_ms"`
+	BytesSent     int64            `json:"bytes_sent"`
+	BytesReceived int64            `json:"bytes_received"`
+	// FaultsInjected counts the faults Options.Chaos injected into the
+	// attempts of the measured requests, by kind.
+	FaultsInjected map[string]int `json:"faults_injected,omitempty"`
+	// Interrupted reports a run whose context was done before Duration
+	// elapsed.
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// BenchmarkLatency summarizes request latencies in milliseconds.
+type BenchmarkLatency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// RunBenchmark initializes a session with the server described by opts and
+// embeds opts.Inputs, or the non-blank lines of opts.InputFile, one per
+// request and over and over, under the load opts.Benchmark describes: up
+// to opts.Concurrency requests in flight, DefaultBatchConcurrency when
+// zero. It writes the BenchmarkReport to opts.Stdout as opts.Output renders
+// it, and a line of progress about once a second to opts.Progress.
+//
+// A run whose ctx is done, or whose opts.Stop closes, early reports the
+// requests completed so far, marked Interrupted, and returns nil.
+func RunBenchmark(ctx context.Context, opts Options) (err error) {
+	b := opts.Benchmark
+	switch {
+	case b.Duration <= 0:
+		return errors.New("benchmark: duration must be positive")
+	case b.Warmup < 0 || b.RPS < 0 || opts.Concurrency < 0:
+		return errors.New("benchmark: warmup, rate, and concurrency must not be negative")
+	case opts.InputFile != "" && len(opts.Inputs) > 0:
+		return errors.New("benchmark: an input file and inputs cannot be combined")
+	case opts.DryRun:
+		return opts.dryRun(ctx, RunBenchmark)
+	}
+	inputs := opts.Inputs
+	if opts.InputFile != "" {
+		if inputs, err = readBenchmarkInputs(opts.InputFile); err != nil {
+			return err
+		}
+	}
+	if len(inputs) == 0 {
+		return errors.New("benchmark: no inputs")
+	}
+	stats := &benchmarkStats{errors: map[string]int{}}
+	opts.ClientOptions = append(opts.ClientOptions[:len(opts.ClientOptions):len(opts.ClientOptions)], WithInterceptor(stats.intercept))
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p, ok := c.transport.(interface{ protocol() string }); ok {
+			markers.Protocol = p.protocol()
+		}
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	if _, err := c.Initialize(ctx); err != nil {
+		return err
+	}
+	report, err := runBenchmark(ctx, c, inputs, opts, stats)
+	if err != nil {
+		return err
+	}
+	if opts.Stdout == nil {
+		return nil
+	}
+	out := opts.Output
+	out.Indent = "  "
+	if err := out.Render(opts.Stdout, report, []any{report}); err != nil {
+		return fmt.Errorf("write benchmark: %w", err)
+	}
+	return nil
+}
+
+// readBenchmarkInputs returns the non-blank lines of path.
+func readBenchmarkInputs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var inputs []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, DefaultMaxFrameSize)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return inputs, nil
+}
+
+// runBenchmark drives c and reports what stats measured.
+func runBenchmark(ctx context.Context, c *Client, inputs []string, opts Options, stats *benchmarkStats) (BenchmarkReport, error) {
+	b := opts.Benchmark
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	report := BenchmarkReport{Mode: "concurrency", Concurrency: concurrency, TargetRPS: b.RPS, Warmup: b.Warmup.Seconds()}
+	if b.RPS > 0 {
+		report.Mode = "rps"
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		next    atomic.Int64
+		wg      sync.WaitGroup
+		fatalMu sync.Mutex
+		fatal   error
+	)
+	start := time.Now()
+	measureFrom := start.Add(b.Warmup)
+	end := measureFrom.Add(b.Duration)
+	// request embeds the next input, timed from when it was due.
+	request := func(due time.Time) {
+		measured := !due.Before(measureFrom)
+		reqCtx := runCtx
+		sample := &benchmarkSample{}
+		if measured {
+			reqCtx = context.WithValue(runCtx, benchmarkSampleKey{}, sample)
+		}
+		_, err := c.Embed(reqCtx, inputs[(next.Add(1)-1)%int64(len(inputs))])
+		latency := time.Since(due)
+		switch {
+		case errors.Is(err, ErrDryRun):
+			fatalMu.Lock()
+			fatal = err
+			fatalMu.Unlock()
+			cancel()
+		case !measured, err != nil && runCtx.Err() != nil:
+			// Warmup requests and those cut short by the end of the run
+			// are not counted.
+		default:
+			stats.add(latency, err, sample)
+		}
+	}
+
+	// issueCtx ends when the run does or opts.Stop closes, after which no
+	// request starts; those in flight finish under runCtx.
+	issueCtx, stopIssuing := context.WithCancel(runCtx)
+	defer stopIssuing()
+	if opts.Stop != nil {
+		go func() {
+			select {
+			case <-opts.Stop:
+				stopIssuing()
+			case <-issueCtx.Done():
+			}
+		}()
+	}
+
+	progressDone := make(chan struct{})
+	if opts.Progress != nil {
+		go stats.progress(runCtx, opts.Progress, measureFrom, progressDone)
+	} else {
+		close(progressDone)
+	}
+
+	if b.RPS > 0 {
+		slots := make(chan struct{}, concurrency)
+		for i := 0; ; i++ {
+			due := start.Add(time.Duration(float64(i) * float64(time.Second) / b.RPS))
+			if !due.Before(end) || !sleepUntil(issueCtx, due) {
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-issueCtx.Done():
+					return
+				}
+				defer func() { <-slots }()
+				request(due)
+			}()
+		}
+		sleepUntil(issueCtx, end)
+	} else {
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for issueCtx.Err() == nil {
+					now := time.Now()
+					if !now.Before(end) {
+						return
+					}
+					request(now)
+				}
+			}()
+		}
+		sleepUntil(issueCtx, end)
+	}
+	stopped := time.Now()
+	interrupted := ctx.Err() != nil
+	select {
+	case <-opts.Stop:
+		interrupted = true
+	default:
+	}
+	report.Interrupted = interrupted && stopped.Before(end)
+	wg.Wait()
+	cancel()
+	<-progressDone
+	if fatal != nil {
+		return report, fatal
+	}
+	window := b.Duration
+	if stopped.Before(end) {
+		window = max(stopped.Sub(measureFrom), 0)
+	}
+	stats.fill(&report, window)
+	return report, nil
+}
+
+// sleepUntil waits for t and reports whether ctx was still live then.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// benchmarkSampleKey carries the *benchmarkSample of a measured request.
+type benchmarkSampleKey struct{}
+
+// benchmarkSample counts the envelope bytes of one measured request, and
+// the faults injected into its attempts.
+type benchmarkSample struct {
+	sent, received atomic.Int64
+
+	mu     sync.Mutex
+	faults map[string]int
+}
+
+func (s *benchmarkSample) fault(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.faults == nil {
+		s.faults = make(map[string]int)
+	}
+	s.faults[kind]++
+}
+
+// benchmarkStats accumulates the measured requests of a benchmark.
+type benchmarkStats struct {
+	mu             sync.Mutex
+	latencies      []time.Duration
+	requests       int
+	errors         map[string]int
+	faults         map[string]int
+	sent, received int64
+}
+
+// intercept counts the envelope bytes of every attempt of a measured
+// request.
+func (s *benchmarkStats) intercept(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	sample, _ := ctx.Value(benchmarkSampleKey{}).(*benchmarkSample)
+	if sample == nil {
+		return next(ctx, req)
+	}
+	if body, err := json.Marshal(req.Wire()); err == nil {
+		sample.sent.Add(int64(len(body)))
+	}
+	resp, err := next(ctx, req)
+	if resp != nil {
+		if body, merr := json.Marshal(resp); merr == nil {
+			sample.received.Add(int64(len(body)))
+		}
+	}
+	return resp, err
+}
+
+func (s *benchmarkStats) add(latency time.Duration, err error, sample *benchmarkSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.sent += sample.sent.Load()
+	s.received += sample.received.Load()
+	sample.mu.Lock()
+	for kind, n := range sample.faults {
+		if s.faults == nil {
+			s.faults = make(map[string]int)
+		}
+		s.faults[kind] += n
+	}
+	sample.mu.Unlock()
+	if err != nil {
+		s.errors[ErrorClass(err)]++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// progress reports the measured requests to w about once a second until
+// ctx is done, then closes done.
+func (s *benchmarkStats) progress(ctx context.Context, w io.Writer, measureFrom time.Time, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(embedProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if now.Before(measureFrom.Add(embedProgressInterval / 2)) {
+				fmt.Fprintln(w, "benchmark: warming up")
+				continue
+			}
+			s.mu.Lock()
+			requests, failed := s.requests, s.requests-len(s.latencies)
+			s.mu.Unlock()
+			elapsed := now.Sub(measureFrom)
+			fmt.Fprintf(w, "benchmark: %s, %d requests, %.0f req/s, %d errors\n", elapsed.Round(time.Second), requests, float64(requests)/elapsed.Seconds(), failed)
+		}
+	}
+}
+
+// fill completes report with the requests measured over window.
+func (s *benchmarkStats) fill(report *BenchmarkReport, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report.Duration = window.Seconds()
+	report.Requests = s.requests
+	report.Errors = s.requests - len(s.latencies)
+	if report.Errors > 0 {
+		report.ErrorsByClass = s.errors
+	}
+	if window > 0 {
+		report.Throughput = float64(len(s.latencies)) / window.Seconds()
+	}
+	report.BytesSent, report.BytesReceived = s.sent, s.received
+	report.FaultsInjected = s.faults
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	report.Latency = BenchmarkLatency{
+		P50: ms(latencyPercentile(sorted, 50)),
+		P90: ms(latencyPercentile(sorted, 90)),
+		P99: ms(latencyPercentile(sorted, 99)),
+	}
+	if len(sorted) > 0 {
+		report.Latency.Max = ms(sorted[len(sorted)-1])
+	}
+}
+
+// latencyPercentile returns the nearest-rank p-th percentile of sorted, or
+// 0 when it is empty.
+func latencyPercentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBenchmark(t *testing.T) {
+	var embeds atomic.Int64
+	handler := func(req Request) (Response, error) {
+		if req.Method == MethodEmbed && embeds.Add(1)%5 == 0 {
+			return Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeModelNotFound, Message: "no such model"}}, nil
+		}
+		return *defaultHandler(&req), nil
+	}
+	run := func(t *testing.T, ctx context.Context, b Benchmark, stop <-chan struct{}) BenchmarkReport {
+		t.Helper()
+		var out strings.Builder
+		err := RunBenchmark(ctx, Options{
+			Config:      ClientConfig{Transport: TransportInProc, Handler: handler},
+			Inputs:      []string{"alpha", "beta"},
+			Concurrency: 2,
+			Benchmark:   b,
+			Stdout:      &out,
+			Stop:        stop,
+		})
+		if err != nil {
+			t.Fatalf("RunBenchmark: %v", err)
+		}
+		var report BenchmarkReport
+		if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+			t.Fatalf("report %q: %v", out.String(), err)
+		}
+		return report
+	}
+
+	t.Run("concurrency", func(t *testing.T) {
+		r := run(t, context.Background(), Benchmark{Duration: 200 * time.Millisecond, Warmup: 50 * time.Millisecond}, nil)
+		if r.Mode != "concurrency" || r.Concurrency != 2 || r.Duration != 0.2 || r.Warmup != 0.05 || r.Interrupted {
+			t.Fatalf("report %+v", r)
+		}
+		if r.Requests == 0 || r.Errors == 0 || r.ErrorsByClass["model_not_found"] != r.Errors || r.Throughput <= 0 {
+			t.Fatalf("counts %+v", r)
+		}
+		if l := r.Latency; l.P50 <= 0 || l.P50 > l.P90 || l.P90 > l.P99 || l.P99 > l.Max {
+			t.Fatalf("latency %+v", l)
+		}
+		if r.BytesSent == 0 || r.BytesReceived == 0 {
+			t.Fatalf("bytes %+v", r)
+		}
+	})
+
+	t.Run("rps", func(t *testing.T) {
+		r := run(t, context.Background(), Benchmark{Duration: 300 * time.Millisecond, RPS: 100}, nil)
+		if r.Mode != "rps" || r.TargetRPS != 100 || r.Requests < 20 || r.Requests > 31 {
+			t.Fatalf("report %+v", r)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		r := run(t, ctx, Benchmark{Duration: time.Minute}, nil)
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("interrupted benchmark ran for %s", elapsed)
+		}
+		if !r.Interrupted || r.Requests == 0 || r.Duration <= 0 || r.Duration >= 60 {
+			t.Fatalf("report %+v", r)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		time.AfterFunc(150*time.Millisecond, func() { close(stop) })
+		r := run(t, context.Background(), Benchmark{Duration: time.Minute}, stop)
+		if !r.Interrupted || r.Requests == 0 || r.Duration >= 60 {
+			t.Fatalf("report %+v", r)
+		}
+	})
+
+	if err := RunBenchmark(context.Background(), Options{Inputs: []string{"a"}}); err == nil {
+		t.Fatal("a benchmark without a duration ran")
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for p, want := range map[int]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := latencyPercentile(sorted, p); got != want {
+			t.Errorf("p%d = %s, want %s", p, got, want)
+		}
+	}
+	if got := latencyPercentile(sorted[:1], 50); got != time.Millisecond {
+		t.Errorf("p50 of one = %s", got)
+	}
+	if got := latencyPercentile(nil, 99); got != 0 {
+		t.Errorf("p99 of none = %s", got)
+	}
+}
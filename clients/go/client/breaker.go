@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown is how long an open circuit breaker fast-fails
+// calls before letting a probe through.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// ErrCircuitOpen is returned without contacting the server while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed passes calls through and counts connection failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails calls with ErrCircuitOpen until the cool-down ends.
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe call through; its outcome closes
+	// or reopens the circuit.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitEvent reports a circuit breaker state transition.
+type CircuitEvent struct {
+	From, To CircuitState
+	// Cause is the connection failure that opened the circuit, or nil for
+	// the other transitions.
+	Cause error
+}
+
+// CircuitBreaker stops calling a server that keeps failing to connect. Only
+// connection-class failures count toward Threshold; API errors, timeouts of
+// a live server, and cancelled calls do not.
+type CircuitBreaker struct {
+	// Threshold is how many consecutive connection failures open the
+	// circuit. Zero disables the breaker.
+	Threshold int
+	// Cooldown is how long the open circuit fails fast before a probe is
+	// allowed. Zero selects DefaultBreakerCooldown.
+	Cooldown time.Duration
+	// OnStateChange, when set, is called for every transition. It runs while
+	// the breaker is locked and must not call back into the Client.
+	OnStateChange func(CircuitEvent)
+}
+
+func (b CircuitBreaker) validate() error {
+	if b.Threshold < 0 || b.Cooldown < 0 {
+		return errors.New("circuit breaker settings must not be negative")
+	}
+	return nil
+}
+
+// breaker is the circuit breaker state shared by every call on a Client.
+type breaker struct {
+	cfg CircuitBreaker
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(cfg CircuitBreaker) *breaker {
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = DefaultBreakerCooldown
+	}
+	return &breaker{cfg: cfg, now: time.Now}
+}
+
+// transition moves to state. The caller holds mu.
+func (b *breaker) transition(to CircuitState, cause error) {
+	from := b.state
+	b.state = to
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(CircuitEvent{From: from, To: to, Cause: cause})
+	}
+}
+
+// allow reports whether a call may proceed and whether it is the half-open
+// probe. Every allowed call must be followed by done.
+func (b *breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		remaining := b.cfg.Cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return false, fmt.Errorf("%w: retry in %s", ErrCircuitOpen, remaining.Round(time.Millisecond))
+		}
+		b.transition(CircuitHalfOpen, nil)
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, fmt.Errorf("%w: probe in flight", ErrCircuitOpen)
+		}
+	case CircuitClosed:
+		return false, nil
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done records the outcome of an allowed call.
+func (b *breaker) done(ctx context.Context, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The caller gave up; that says nothing about the server.
+	case err != nil && isConnectionError(err):
+		b.failures++
+		if probe || (b.state == CircuitClosed && b.failures >= b.cfg.Threshold) {
+			b.openedAt = b.now()
+			b.transition(CircuitOpen, err)
+		}
+	default:
+		b.failures = 0
+		if probe {
+			b.transition(CircuitClosed, nil)
+		}
+	}
+}
+
+// CircuitState reports the state of ClientConfig.CircuitBreaker, which is
+// always CircuitClosed when no breaker is configured.
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.state
+}
+
+// guard runs attempt behind the circuit breaker, if one is configured.
+func (c *Client) guard(ctx context.Context, attempt func() error) error {
+	if c.breaker == nil {
+		return attempt()
+	}
+	probe, err := c.breaker.allow()
+	if err != nil {
+		return err
+	}
+	err = attempt()
+	c.breaker.done(ctx, probe, err)
+	return err
+}
+
+// interceptBreaker is the Interceptor applying ClientConfig.CircuitBreaker.
+func (c *Client) interceptBreaker(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	var resp *Response
+	err := c.guard(ctx, func() error {
+		var err error
+		resp, err = next(ctx, req)
+		return err
+	})
+	return resp, err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	var down atomic.Bool
+	down.Store(true)
+	stub := &stubTransport{kind: "stub", fn: func(req *Request) (*Response, error) {
+		if down.Load() {
+			return nil, refused
+		}
+		return defaultHandler(req), nil
+	}}
+	var events []CircuitEvent
+	c := NewWithTransport(ClientConfig{CircuitBreaker: CircuitBreaker{
+		Threshold:     3,
+		Cooldown:      time.Minute,
+		OnStateChange: func(ev CircuitEvent) { events = append(events, ev) },
+	}}, stub)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// closed -> open after three consecutive connection failures.
+	for i := 0; i < 3; i++ {
+		if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("call %d: expected the dial error, got %v", i, err)
+		}
+	}
+	if c.CircuitState() != CircuitOpen {
+		t.Fatalf("expected an open circuit, got %s", c.CircuitState())
+	}
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, ErrCircuitOpen) || stub.calls.Load() != 3 {
+		t.Fatalf("expected a fast failure without a round trip, got %v after %d calls", err, stub.calls.Load())
+	}
+
+	// open -> half-open once the cool-down passes; a failed probe reopens.
+	now = now.Add(time.Minute)
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("expected the probe to reach the transport, got %v", err)
+	}
+	if c.CircuitState() != CircuitOpen {
+		t.Fatalf("a failed probe should reopen the circuit, got %s", c.CircuitState())
+	}
+
+	// half-open -> closed when the probe succeeds.
+	now = now.Add(time.Minute)
+	down.Store(false)
+	if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	var got []CircuitState
+	for _, ev := range events {
+		got = append(got, ev.To)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("transitions %v, want %v", got, want)
+	}
+	if !errors.Is(events[0].Cause, syscall.ECONNREFUSED) || events[0].From != CircuitClosed || events[4].Cause != nil {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestCircuitBreakerIgnoresApplicationErrors(t *testing.T) {
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportHTTP, Endpoint: statusServer(t, 404).URL}),
+		WithCircuitBreaker(2, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 5; i++ {
+		var apiErr *APIError
+		if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.As(err, &apiErr) {
+			t.Fatalf("call %d: expected the 404, got %v", i, err)
+		}
+	}
+	if c.CircuitState() != CircuitClosed {
+		t.Fatalf("application errors tripped the breaker: %s", c.CircuitState())
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := newBreaker(CircuitBreaker{Threshold: 1, Cooldown: time.Second})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+	probe, _ := b.allow()
+	b.done(ctx, probe, ErrConnectionLost)
+
+	now = now.Add(time.Second)
+	if probe, err := b.allow(); !probe || err != nil {
+		t.Fatalf("expected a probe, got %v, %v", probe, err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("a second caller passed while the probe was in flight: %v", err)
+	}
+	// A cancelled probe leaves the circuit half-open for the next caller.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	b.done(cancelled, true, context.Canceled)
+	if probe, err := b.allow(); !probe || err != nil {
+		t.Fatalf("expected another probe after cancellation, got %v, %v", probe, err)
+	}
+}
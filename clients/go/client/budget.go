@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// The phases a call spends its latency budget in, as BudgetExceededError
+// reports them.
+const (
+	// PhaseQueue is the time before a request reaches the transport:
+	// waiting on the rate limiter, for an in-flight slot, or between
+	// retries.
+	PhaseQueue = "queue"
+	// PhaseDial is resolving the endpoint and opening its connection, TLS
+	// handshake included, or spawning the stdio server.
+	PhaseDial = "dial"
+	// PhaseSend is writing the request.
+	PhaseSend = "send"
+	// PhaseReceive is waiting for the answer and reading it.
+	PhaseReceive = "receive"
+)
+
+// The most of a latency budget a dial and a send may take, as fractions of
+// the whole; the queue and receive phases may take what remains.
+const (
+	budgetDialShare = 1.0 / 3
+	budgetSendShare = 1.0 / 4
+)
+
+// ErrBudgetExceeded matches the *BudgetExceededError of a call that ran out
+// of the latency budget of WithBudget. It matches ErrTimeout as well.
+var ErrBudgetExceeded error = &classError{"latency budget exceeded", ErrTimeout}
+
+// BudgetExceededError reports a call ended by its latency budget, and the
+// phase that spent it.
+type BudgetExceededError struct {
+	// Budget is the budget given WithBudget.
+	Budget time.Duration
+	// Phase is the phase running when the budget ran out, or whose share
+	// of it ran out first.
+	Phase string
+	// Elapsed is the part of the budget spent, less than Budget when the
+	// phase overran its share.
+	Elapsed time.Duration
+	// Err is the failure the call ended with, context.DeadlineExceeded for
+	// one the budget canceled.
+	Err error
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Elapsed < e.Budget {
+		return fmt.Sprintf("latency budget of %s: %s phase overran its share after %s: %v", e.Budget, e.Phase, e.Elapsed, e.Err)
+	}
+	return fmt.Sprintf("latency budget of %s spent in %s phase: %v", e.Budget, e.Phase, e.Err)
+}
+
+func (e *BudgetExceededError) Unwrap() []error { return []error{ErrBudgetExceeded, e.Err} }
+
+// WithBudget returns ctx giving the calls made with it d to complete,
+// retries and queueing included, from the start of the first. The client
+// splits it between the phases of each request: a dial may take a third
+// of d and a send a quarter, while waiting in queues and for the answer
+// may take what is left. A retry whose backoff and fastest attempt so far
+// cannot fit in what is left is not attempted. A call the budget ends
+// fails with a *BudgetExceededError naming the phase that spent it. Over
+// http3 the dial and receive phases count as the send phase.
+func WithBudget(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &latencyBudget{total: d})
+}
+
+// budgetKey carries the *latencyBudget of WithBudget.
+type budgetKey struct{}
+
+// budgetRunKey carries the *budgetRun of a call.
+type budgetRunKey struct{}
+
+// latencyBudget is the budget shared by the calls of a ctx, which starts
+// with the first of them.
+type latencyBudget struct {
+	total time.Duration
+
+	once     sync.Once
+	deadline time.Time
+}
+
+func (b *latencyBudget) start(now time.Time) time.Time {
+	b.once.Do(func() { b.deadline = now.Add(b.total) })
+	return b.deadline
+}
+
+// budgetRun spends a latency budget on one call: it follows the call's
+// phases, and cancels it when the budget or the share of the current phase
+// runs out.
+type budgetRun struct {
+	b         *latencyBudget
+	deadline  time.Time
+	now       func() time.Time
+	afterFunc func(time.Duration, func()) func() bool
+	cancel    context.CancelFunc
+
+	mu    sync.Mutex
+	phase string
+	stop  func() bool
+	// attemptStart is when the current attempt reached the transport, and
+	// fastest the quickest attempt so far.
+	attemptStart time.Time
+	fastest      time.Duration
+	// expired is the phase that spent the budget, and spent how much of it
+	// was.
+	expired string
+	spent   time.Duration
+}
+
+// startBudget returns ctx carrying the budgetRun of a call, canceled when
+// its budget runs out, or ctx itself and nil without a budget.
+func (c *Client) startBudget(ctx context.Context) (context.Context, *budgetRun) {
+	b, ok := ctx.Value(budgetKey{}).(*latencyBudget)
+	if !ok {
+		return ctx, nil
+	}
+	now := c.now()
+	r := &budgetRun{b: b, deadline: b.start(now), now: c.now, afterFunc: c.afterFunc}
+	ctx, r.cancel = context.WithCancel(context.WithValue(ctx, budgetRunKey{}, r))
+	r.enter(PhaseQueue)
+	return ctx, r
+}
+
+// afterFunc is the Client's default afterFunc.
+func afterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// markPhase moves the call of ctx, if it has a budget, into phase.
+func markPhase(ctx context.Context, phase string) {
+	if r, ok := ctx.Value(budgetRunKey{}).(*budgetRun); ok {
+		r.enter(phase)
+	}
+}
+
+// enter starts phase, arming the timer that ends the call when the phase
+// overruns its share or the budget runs out.
+func (r *budgetRun) enter(phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expired != "" || r.phase == phase {
+		return
+	}
+	now := r.now()
+	switch {
+	case phase == PhaseSend && r.phase == PhaseQueue:
+		r.attemptStart = now
+	case phase == PhaseQueue && !r.attemptStart.IsZero():
+		if d := now.Sub(r.attemptStart); r.fastest == 0 || d < r.fastest {
+			r.fastest = d
+		}
+	}
+	r.phase = phase
+	limit := r.deadline
+	var share float64
+	switch phase {
+	case PhaseDial:
+		share = budgetDialShare
+	case PhaseSend:
+		share = budgetSendShare
+	}
+	if share > 0 {
+		if end := now.Add(time.Duration(share * float64(r.b.total))); end.Before(limit) {
+			limit = end
+		}
+	}
+	if r.stop != nil {
+		r.stop()
+	}
+	r.stop = r.afterFunc(max(limit.Sub(now), 0), func() { r.expire(phase) })
+}
+
+// expire ends the call, which ran out of budget in phase.
+func (r *budgetRun) expire(phase string) {
+	r.mu.Lock()
+	if r.expired != "" || r.phase != phase {
+		r.mu.Unlock()
+		return
+	}
+	r.expired = phase
+	r.spent = r.now().Sub(r.deadline.Add(-r.b.total))
+	r.mu.Unlock()
+	r.cancel()
+}
+
+// fits reports whether a retry after wait could still complete within the
+// budget, taking as long as the fastest attempt so far.
+func (r *budgetRun) fits(wait time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now().Add(wait + r.fastest).Before(r.deadline)
+}
+
+// finish stops the timer and returns err, a failure of the call, as a
+// *BudgetExceededError if the budget ended it.
+func (r *budgetRun) finish(err error) error {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.stop()
+	}
+	expired, spent := r.expired, r.spent
+	r.mu.Unlock()
+	r.cancel()
+	if err == nil || expired == "" {
+		return err
+	}
+	if errors.Is(err, context.Canceled) {
+		err = context.DeadlineExceeded
+	}
+	return &BudgetExceededError{Budget: r.b.total, Phase: expired, Elapsed: spent, Err: err}
+}
+
+// trace follows the phases of an http request.
+func (r *budgetRun) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { r.enter(PhaseDial) },
+		ConnectStart: func(string, string) { r.enter(PhaseDial) },
+		GotConn:      func(httptrace.GotConnInfo) { r.enter(PhaseSend) },
+		WroteRequest: func(httptrace.WroteRequestInfo) { r.enter(PhaseReceive) },
+	}
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTimer is a timer of fakeClock.afterFunc.
+type fakeTimer struct {
+	at   time.Time
+	d    time.Duration
+	f    func()
+	done bool
+}
+
+func (f *fakeClock) afterFunc(d time.Duration, fn func()) func() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	timer := &fakeTimer{at: f.t.Add(d), d: d, f: fn}
+	f.timers = append(f.timers, timer)
+	return func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		live := !timer.done
+		timer.done = true
+		return live
+	}
+}
+
+// waitTimer waits for the nth timer to be armed and returns its duration,
+// failing if it was stopped already.
+func (f *fakeClock) waitTimer(t *testing.T, n int) time.Duration {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		if len(f.timers) >= n {
+			timer := f.timers[n-1]
+			f.mu.Unlock()
+			if timer.done {
+				t.Fatalf("timer %d stopped, %d armed", n, len(f.timers))
+			}
+			return timer.d
+		}
+		f.mu.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers armed, want %d", len(f.timers), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// budgetClient returns a client of tr timing its budgets with a fake clock.
+func budgetClient(cfg ClientConfig, tr Transport) (*Client, *fakeClock) {
+	c := NewWithTransport(cfg, tr)
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c.now, c.afterFunc = clock.now, clock.afterFunc
+	return c, clock
+}
+
+// checkBudgetExceeded checks that err reports the budget of 300ms spent in
+// phase after elapsed.
+func checkBudgetExceeded(t *testing.T, err error, phase string, elapsed time.Duration) {
+	t.Helper()
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("got %v, want a BudgetExceededError", err)
+	}
+	if budgetErr.Phase != phase || budgetErr.Elapsed != elapsed || budgetErr.Budget != 300*time.Millisecond {
+		t.Fatalf("budget of %s spent in %s phase after %s, want %s phase after %s", budgetErr.Budget, budgetErr.Phase, budgetErr.Elapsed, phase, elapsed)
+	}
+	if !errors.Is(err, ErrBudgetExceeded) || !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("%v does not match ErrBudgetExceeded, ErrTimeout, and context.DeadlineExceeded", err)
+	}
+	if ErrorClass(err) != "timeout" {
+		t.Fatalf("error class %q", ErrorClass(err))
+	}
+}
+
+// embedAsync runs an Embed of ctx, returning its error on the channel.
+func embedAsync(ctx context.Context, c *Client, text string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(ctx, text)
+		done <- err
+	}()
+	return done
+}
+
+func TestBudgetQueuePhase(t *testing.T) {
+	stub := &stallStub{kind: "stub", stall: func(_ int64, req *Request) bool { return strings.Contains(string(req.Params), "hold") }}
+	c, clock := budgetClient(ClientConfig{MaxInFlight: 1}, stub)
+	ctx := WithBudget(context.Background(), 300*time.Millisecond)
+	// Timers 1 to 3: queueing, sending, and queueing again.
+	if _, err := c.Embed(ctx, "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	// The calls of ctx share the budget, which runs from the first.
+	clock.tick(200 * time.Millisecond)
+
+	holdCtx, release := context.WithCancel(context.Background())
+	defer release()
+	held := embedAsync(holdCtx, c, "hold")
+	pollStats(t, c, func(s Stats) bool { return s.InFlight == 1 })
+	done := embedAsync(ctx, c, "abcd")
+	if d := clock.waitTimer(t, 4); d != 100*time.Millisecond {
+		t.Fatalf("queued with %s of the budget left, want 100ms", d)
+	}
+	clock.tick(100 * time.Millisecond)
+	checkBudgetExceeded(t, <-done, PhaseQueue, 300*time.Millisecond)
+	release()
+	<-held
+	if stub.calls.Load() != 2 {
+		t.Fatalf("%d requests sent, want none for the call out of budget", stub.calls.Load())
+	}
+}
+
+func TestBudgetStreamPhases(t *testing.T) {
+	for _, tc := range []struct {
+		phase string
+		// timer is the number of the timer of the phase: queueing,
+		// sending, dialing, sending again, and receiving follow each other.
+		timer   int
+		elapsed time.Duration
+		dial    func(ctx context.Context) (io.ReadWriteCloser, error)
+	}{
+		{PhaseDial, 3, 100 * time.Millisecond, func(ctx context.Context) (io.ReadWriteCloser, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+		// Nobody reads the request.
+		{PhaseSend, 4, 75 * time.Millisecond, func(context.Context) (io.ReadWriteCloser, error) {
+			conn, peer := net.Pipe()
+			t.Cleanup(func() { peer.Close() })
+			return conn, nil
+		}},
+		// Nobody answers it.
+		{PhaseReceive, 5, 300 * time.Millisecond, func(context.Context) (io.ReadWriteCloser, error) {
+			conn, peer := net.Pipe()
+			t.Cleanup(func() { peer.Close() })
+			go func() { _, _ = io.Copy(io.Discard, peer) }()
+			return conn, nil
+		}},
+	} {
+		t.Run(tc.phase, func(t *testing.T) {
+			tr := newStreamTransport("test", tc.dial, ClientConfig{}.withDefaults().streamOptions())
+			c, clock := budgetClient(ClientConfig{}, tr)
+			defer c.Close(context.Background())
+			done := embedAsync(WithBudget(context.Background(), 300*time.Millisecond), c, "abc")
+			clock.tick(clock.waitTimer(t, tc.timer))
+			checkBudgetExceeded(t, <-done, tc.phase, tc.elapsed)
+		})
+	}
+}
+
+func TestBudgetSkipsRetries(t *testing.T) {
+	for _, tc := range []struct {
+		retryAfter time.Duration
+		calls      int64
+	}{
+		// A wait outlasting the budget is not started.
+		{time.Second, 1},
+		{time.Millisecond, 2},
+	} {
+		stub := &stubTransport{kind: "stub"}
+		stub.fn = func(req *Request) (*Response, error) {
+			if stub.calls.Load() == 1 {
+				return nil, &APIError{Status: 503, Message: "busy", Retryable: true, RetryAfter: tc.retryAfter}
+			}
+			return defaultHandler(req), nil
+		}
+		c, _ := budgetClient(ClientConfig{Retry: RetryPolicy{MaxAttempts: 3}}, stub)
+		_, err := c.Embed(WithBudget(context.Background(), 300*time.Millisecond), "abc")
+		if stub.calls.Load() != tc.calls {
+			t.Fatalf("Retry-After %s: %d requests sent, want %d", tc.retryAfter, stub.calls.Load(), tc.calls)
+		}
+		var apiErr *APIError
+		if tc.calls == 1 && (!errors.As(err, &apiErr) || errors.Is(err, ErrBudgetExceeded)) {
+			t.Fatalf("Retry-After %s: got %v, want the API error", tc.retryAfter, err)
+		}
+		if tc.calls == 2 && err != nil {
+			t.Fatalf("Retry-After %s: %v", tc.retryAfter, err)
+		}
+	}
+}
+
+func TestBudgetHTTPPhases(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-stop }))
+	defer srv.Close()
+	defer close(stop)
+	tr, err := NewTransport(ClientConfig{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, clock := budgetClient(ClientConfig{}, tr)
+	defer c.Close(context.Background())
+	done := embedAsync(WithBudget(context.Background(), 300*time.Millisecond), c, "abc")
+	clock.waitTimer(t, 5)
+	clock.tick(300 * time.Millisecond)
+	checkBudgetExceeded(t, <-done, PhaseReceive, 300*time.Millisecond)
+	// Queueing, sending, dialing, sending, and receiving.
+	var got []time.Duration
+	for _, timer := range clock.timers {
+		got = append(got, timer.d)
+	}
+	if want := []time.Duration{300 * time.Millisecond, 75 * time.Millisecond, 100 * time.Millisecond, 75 * time.Millisecond, 300 * time.Millisecond}; !slices.Equal(got, want) {
+		t.Fatalf("timers %v, want %v", got, want)
+	}
+}
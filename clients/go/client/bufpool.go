@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer bounds the buffers put back in framePool, so one
+// large batch does not pin its buffer for the life of the process.
+const maxPooledBuffer = 1 << 20
+
+// framePool holds the frames the transports encode requests into.
+var framePool = sync.Pool{New: func() any {
+	f := new(pooledFrame)
+	f.enc = json.NewEncoder(&f.buf)
+	return f
+}}
+
+// pooledFrame is a request encoded into a buffer of framePool. Whoever
+// reads the bytes holds a reference, and the frame goes back to the pool
+// when the last one is released; the bytes must not be touched after the
+// reference they were read under is released.
+type pooledFrame struct {
+	buf  bytes.Buffer
+	enc  *json.Encoder
+	refs atomic.Int32
+}
+
+// encodeFrame encodes req as json.Marshal does into a pooled frame. The
+// caller holds the first reference.
+func encodeFrame(req *Request) (*pooledFrame, error) {
+	f := framePool.Get().(*pooledFrame)
+	f.refs.Store(1)
+	if err := f.enc.Encode(req.Wire()); err != nil {
+		f.release()
+		return nil, err
+	}
+	// Encode ends the value with a newline json.Marshal does not write.
+	f.buf.Truncate(f.buf.Len() - 1)
+	return f, nil
+}
+
+// bytes returns the encoded request.
+func (f *pooledFrame) bytes() []byte { return f.buf.Bytes() }
+
+func (f *pooledFrame) retain() { f.refs.Add(1) }
+
+func (f *pooledFrame) release() {
+	if f.refs.Add(-1) != 0 || f.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	f.buf.Reset()
+	framePool.Put(f)
+}
+
+// body returns a request body reading f under a reference of its own,
+// released when the body is closed. http.Transport may close a body from
+// another goroutine while a read of it is under way, so reads and Close
+// exclude each other and a closed body reads nothing.
+func (f *pooledFrame) body() io.ReadCloser {
+	f.retain()
+	b := &pooledBody{f: f}
+	b.r.Reset(f.bytes())
+	return b
+}
+
+// getBody is the http.Request GetBody of f.
+func (f *pooledFrame) getBody() (io.ReadCloser, error) { return f.body(), nil }
+
+// errBodyClosed is what a read of a closed pooledBody returns.
+var errBodyClosed = errors.New("request body closed")
+
+type pooledBody struct {
+	mu sync.Mutex
+	r  bytes.Reader
+	f  *pooledFrame
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f == nil {
+		return 0, errBodyClosed
+	}
+	return b.r.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f != nil {
+		b.f.release()
+		b.f = nil
+		b.r.Reset(nil)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEncodeFrameMatchesMarshal(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				req, _ := newRequest(int64(i), MethodEmbed, embedParams{Model: "m", Inputs: []string{strings.Repeat("<&>", g*i)}}, time.Unix(0, 0))
+				want, _ := json.Marshal(req)
+				f, err := encodeFrame(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				body := f.body()
+				got, _ := io.ReadAll(body)
+				body.Close()
+				if !bytes.Equal(f.bytes(), want) || !bytes.Equal(got, want) {
+					t.Errorf("encoded %s, want %s", f.bytes(), want)
+				}
+				f.release()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestPooledBodyReadAfterClose(t *testing.T) {
+	req, _ := newRequest(1, MethodPing, nil, time.Now())
+	f, err := encodeFrame(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := f.body()
+	f.release()
+	if f.refs.Load() != 1 {
+		t.Fatalf("the open body holds %d references, want 1", f.refs.Load())
+	}
+	body.Close()
+	body.Close()
+	if _, err := body.Read(make([]byte, 8)); err != errBodyClosed {
+		t.Fatalf("read after close: %v", err)
+	}
+}
+
+// TestFramePoolUnderLoad sends many requests at once over each transport,
+// from many goroutines, checking every answer against its own input: a
+// frame reused while still being written would send another request's
+// bytes. Run it with -race.
+func TestFramePoolUnderLoad(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+	configs := map[string]ClientConfig{
+		"http":      {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"websocket": {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		"inproc":    {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			var wg sync.WaitGroup
+			for g := 0; g < 32; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 20; i++ {
+						input := strings.Repeat("x", 1+(g*20+i)%300)
+						v, err := c.Embed(context.Background(), input, WithNoCache())
+						if err != nil || len(v) == 0 || v[0] != float32(len(input)) {
+							t.Errorf("Embed of %d bytes: %v, %v", len(input), v, err)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkEncodeRequest compares the body of a 32-input embed request
+// encoded with json.Marshal, as every transport did, with the pooled frame.
+func BenchmarkEncodeRequest(b *testing.B) {
+	inputs := make([]string, 32)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("input %d of the benchmark batch, long enough to be typical", i)
+	}
+	req, _ := newRequest(1, MethodEmbed, embedParams{Model: DefaultModel, Inputs: inputs, EncodingFormat: EncodingBase64}, time.Now())
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body, err := json.Marshal(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, bytes.NewReader(body))
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f, err := encodeFrame(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			body := f.body()
+			_, _ = io.Copy(io.Discard, body)
+			body.Close()
+			f.release()
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+)
+
+// The commit and date of the build, which release builds set with
+//
+//	go build -ldflags "-X github.com/Zaevrynth/Zaevrynth/clients/go/client.buildCommit=$(git rev-parse HEAD) -X github.com/Zaevrynth/Zaevrynth/clients/go/client.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Left empty, they are read from the VCS stamp go build records in the
+// binary, when it has one.
+var (
+	buildCommit string
+	buildDate   string
+)
+
+// BuildInfo describes the build of the client in the running binary.
+type BuildInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Commit is the VCS revision it was built from, empty when unknown,
+	// and Modified reports uncommitted changes in that tree.
+	Commit   string `json:"commit,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+	// Date is when it was built or, failing that, the time of Commit, in
+	// RFC 3339.
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	// ProtocolVersions are the MCP protocol versions it speaks, most
+	// preferred first, and TranscriptVersion the transcripts it writes.
+	ProtocolVersions  []string `json:"protocol_versions"`
+	TranscriptVersion int      `json:"transcript_version"`
+}
+
+var readBuild = sync.OnceValue(func() BuildInfo {
+	b := BuildInfo{
+		Name:              ClientName,
+		Version:           ClientVersion,
+		Commit:            buildCommit,
+		Date:              buildDate,
+		GoVersion:         runtime.Version(),
+		TranscriptVersion: TranscriptVersion,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if buildCommit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.modified":
+			if buildCommit == "" {
+				b.Modified = s.Value == "true"
+			}
+		case "vcs.time":
+			if b.Date == "" {
+				b.Date = s.Value
+			}
+		}
+	}
+	return b
+})
+
+// Build reports the build of the client.
+func Build() BuildInfo {
+	b := readBuild()
+	b.ProtocolVersions = slices.Clone(SupportedProtocolVersions)
+	return b
+}
+
+// UserAgent is the abbreviated form of b the client sends as the
+// User-Agent of its http and ws requests and in its handshake, and
+// transcripts record: the name and version with the commit's first twelve
+// digits, as in "zaevrynth-go-client/0.1.0 (1a2b3c4d5e6f, modified)".
+func (b BuildInfo) UserAgent() string {
+	ua := b.Name + "/" + b.Version
+	if b.Commit == "" {
+		return ua
+	}
+	commit := b.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if b.Modified {
+		commit += ", modified"
+	}
+	return ua + " (" + commit + ")"
+}
+
+// userAgent is the UserAgent of Build.
+var userAgent = sync.OnceValue(func() string { return Build().UserAgent() })
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestBuildUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		b    BuildInfo
+		want string
+	}{
+		{BuildInfo{Name: "c", Version: "1.0"}, "c/1.0"},
+		{BuildInfo{Name: "c", Version: "1.0", Commit: "1a2b3c4d5e6f7a8b9c0d"}, "c/1.0 (1a2b3c4d5e6f)"},
+		{BuildInfo{Name: "c", Version: "1.0", Commit: "1a2b3c", Modified: true}, "c/1.0 (1a2b3c, modified)"},
+	} {
+		if got := tc.b.UserAgent(); got != tc.want {
+			t.Errorf("UserAgent of %+v = %q, want %q", tc.b, got, tc.want)
+		}
+	}
+	b := Build()
+	if b.Name != ClientName || b.Version != ClientVersion || !slices.Equal(b.ProtocolVersions, SupportedProtocolVersions) || b.TranscriptVersion != TranscriptVersion || b.GoVersion == "" {
+		t.Fatalf("Build = %+v", b)
+	}
+}
+
+func TestHandshakeSendsUserAgent(t *testing.T) {
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	want := Build().UserAgent()
+	if len(agents) != 1 || agents[0] != want {
+		t.Fatalf("User-Agent %q, want %q", agents, want)
+	}
+	var req struct {
+		Params struct {
+			Client struct {
+				UserAgent string `json:"user_agent"`
+			} `json:"client"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(sink.entries[0].Message, &req); err != nil || req.Params.Client.UserAgent != want {
+		t.Fatalf("handshake client %+v, %v", req.Params.Client, err)
+	}
+}
@@ -0,0 +1,272 @@
+package client
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCacheEntries bounds an embedding cache enabled by WithCache without
+// any limit of its own.
+const DefaultCacheEntries = 10000
+
+// CacheConfig configures the embedding cache. Entries are keyed on the
+// model, the model version the server last reported, and the normalized
+// input text, and evicted least recently used first once
+// either limit is exceeded. With Disk set the cache persists: an in-memory
+// LRU, when limited, serves what it holds and asks Disk for the rest.
+type CacheConfig struct {
+	// MaxEntries bounds the number of cached vectors. Zero means no limit.
+	MaxEntries int
+	// MaxBytes bounds the cached vectors and keys by size. Zero means no
+	// limit.
+	MaxBytes int64
+	// Normalize maps an input to its cache key. Nil trims surrounding
+	// whitespace and collapses internal runs of whitespace to one space;
+	// inputs that normalize alike share one entry, so set Normalize to an
+	// identity function if the server treats whitespace as significant.
+	Normalize func(string) string
+	// Disk keeps the entries across restarts, behind the in-memory LRU if
+	// MaxEntries or MaxBytes is set, else alone. The caller opens it with
+	// OpenDiskCache and closes it after the client; several clients may
+	// share it.
+	Disk *DiskCache
+}
+
+func (cfg CacheConfig) enabled() bool {
+	return cfg.MaxEntries > 0 || cfg.MaxBytes > 0 || cfg.Disk != nil
+}
+
+// memory reports whether the cache has an in-memory tier.
+func (cfg CacheConfig) memory() bool { return cfg.MaxEntries > 0 || cfg.MaxBytes > 0 }
+
+// key returns the cache key of input for model.
+func (cfg CacheConfig) key(model, input string) string {
+	normalize := cfg.Normalize
+	if normalize == nil {
+		normalize = normalizeInput
+	}
+	return model + "\x00" + normalize(input)
+}
+
+func (cfg CacheConfig) validate() error {
+	if cfg.MaxEntries < 0 || cfg.MaxBytes < 0 {
+		return errors.New("cache limits must not be negative")
+	}
+	return nil
+}
+
+// CacheStats reports the embedding cache's activity since the client was
+// built.
+type CacheStats struct {
+	// Hits and Misses count lookups, a hit served by either tier.
+	Hits, Misses int64
+	// Evictions, Entries, and Bytes describe the in-memory LRU: its
+	// evictions and current contents.
+	Evictions int64
+	Entries   int
+	Bytes     int64
+	// Disk describes CacheConfig.Disk, when set.
+	Disk *DiskCacheStats
+}
+
+// normalizeInput is the default CacheConfig.Normalize.
+func normalizeInput(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+type cacheEntry struct {
+	key    string
+	vector []float32
+}
+
+func (e *cacheEntry) size() int64 { return int64(len(e.key) + 4*len(e.vector)) }
+
+// cacheStore is a tier of the embedding cache, or the tiers layered: the
+// in-memory embedCache, a DiskCache, or a layeredCache of both. Keys are
+// those of CacheConfig.key. Vectors are copied in and out so callers cannot
+// alter cached entries.
+type cacheStore interface {
+	get(key string) ([]float32, bool)
+	put(key string, vector []float32)
+	clear()
+	snapshot() CacheStats
+}
+
+// newCacheStore returns the tiers cfg enables.
+func newCacheStore(cfg CacheConfig) cacheStore {
+	switch {
+	case cfg.Disk == nil:
+		return newEmbedCache(cfg)
+	case cfg.memory():
+		return &layeredCache{mem: newEmbedCache(cfg), disk: cfg.Disk}
+	}
+	return cfg.Disk
+}
+
+// layeredCache serves lookups from memory first and then from disk, keeping
+// what the disk serves in memory too, and writes to both.
+type layeredCache struct {
+	mem          *embedCache
+	disk         *DiskCache
+	hits, misses atomic.Int64
+}
+
+func (l *layeredCache) get(key string) ([]float32, bool) {
+	if v, ok := l.mem.get(key); ok {
+		l.hits.Add(1)
+		return v, true
+	}
+	v, ok := l.disk.get(key)
+	if !ok {
+		l.misses.Add(1)
+		return nil, false
+	}
+	l.hits.Add(1)
+	l.mem.put(key, v)
+	return v, true
+}
+
+func (l *layeredCache) put(key string, vector []float32) {
+	l.mem.put(key, vector)
+	l.disk.put(key, vector)
+}
+
+func (l *layeredCache) clear() {
+	l.mem.clear()
+	l.disk.clear()
+}
+
+func (l *layeredCache) snapshot() CacheStats {
+	s := l.mem.snapshot()
+	s.Hits, s.Misses = l.hits.Load(), l.misses.Load()
+	s.Disk = l.disk.snapshot().Disk
+	return s
+}
+
+// embedCache is an LRU cache of embeddings shared by every goroutine using a
+// Client.
+type embedCache struct {
+	cfg CacheConfig
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	stats   CacheStats
+}
+
+func newEmbedCache(cfg CacheConfig) *embedCache {
+	return &embedCache{cfg: cfg, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the cached vector for key and counts the lookup.
+func (c *embedCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return append([]float32(nil), el.Value.(*cacheEntry).vector...), true
+}
+
+// put stores a copy of vector under key and evicts entries over the limits.
+// A vector larger than MaxBytes on its own is not cached.
+func (c *embedCache) put(key string, vector []float32) {
+	e := &cacheEntry{key: key, vector: append([]float32(nil), vector...)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cfg.MaxBytes > 0 && e.size() > c.cfg.MaxBytes {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(e)
+	c.stats.Entries++
+	c.stats.Bytes += e.size()
+	for (c.cfg.MaxEntries > 0 && c.stats.Entries > c.cfg.MaxEntries) || (c.cfg.MaxBytes > 0 && c.stats.Bytes > c.cfg.MaxBytes) {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops el. The caller holds mu.
+func (c *embedCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size()
+}
+
+func (c *embedCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.stats.Entries, c.stats.Bytes = 0, 0
+}
+
+func (c *embedCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// modelVersions records the model version the server last reported for
+// each model, which the cache keys carry: vectors cached before the server
+// reported another version are not served after it. A disk cache tells the
+// versions of the models the client has not embedded with yet.
+type modelVersions struct {
+	disk *DiskCache
+
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+func newModelVersions(cfg CacheConfig) *modelVersions {
+	return &modelVersions{disk: cfg.Disk, versions: make(map[string]string)}
+}
+
+// get returns the version of model the cache keys carry, empty for a
+// server that reports none.
+func (m *modelVersions) get(model string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.versions[model]
+	if !ok && m.disk != nil {
+		v = m.disk.latestVersion(model)
+		m.versions[model] = v
+	}
+	return v
+}
+
+// note records the version a response reported for model.
+func (m *modelVersions) note(model, version string) {
+	if m == nil || version == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[model] = version
+}
+
+// CacheStats reports the embedding cache's counters. It is the zero value
+// when no cache is configured.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.snapshot()
+}
+
+// InvalidateCache drops every cached embedding, those of CacheConfig.Disk
+// included. The hit, miss, and eviction counters are kept.
+func (c *Client) InvalidateCache() {
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
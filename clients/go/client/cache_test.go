@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// embedStub answers with defaultHandler and records the inputs of every embed
+// request it receives.
+func embedStub() (*stubTransport, func() [][]string) {
+	var mu sync.Mutex
+	var sent [][]string
+	stub := &stubTransport{kind: "stub", fn: func(req *Request) (*Response, error) {
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		mu.Lock()
+		sent = append(sent, params.Inputs)
+		mu.Unlock()
+		return defaultHandler(req), nil
+	}}
+	return stub, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]string(nil), sent...)
+	}
+}
+
+func TestCacheHitsSkipTransport(t *testing.T) {
+	stub, _ := embedStub()
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{MaxEntries: 10}}, stub)
+	ctx := context.Background()
+
+	first, err := c.Embed(ctx, "hello  world")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	first[0] = 99 // must not leak into the cache
+	again, err := c.Embed(ctx, " hello world\n")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if stub.calls.Load() != 1 || again[0] != 12 {
+		t.Fatalf("expected one round trip and the cached vector, got %d calls and %v", stub.calls.Load(), again)
+	}
+	if _, err := c.Embed(ctx, "hello world", WithNoCache()); err != nil || stub.calls.Load() != 2 {
+		t.Fatalf("WithNoCache should reach the transport: %v after %d calls", err, stub.calls.Load())
+	}
+	if s := c.CacheStats(); s.Hits != 1 || s.Misses != 1 || s.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	c.InvalidateCache()
+	if _, err := c.Embed(ctx, "hello world"); err != nil || stub.calls.Load() != 3 {
+		t.Fatalf("expected a miss after InvalidateCache: %v after %d calls", err, stub.calls.Load())
+	}
+	if s := c.CacheStats(); s.Misses != 2 || s.Entries != 1 {
+		t.Fatalf("unexpected stats after invalidation %+v", s)
+	}
+}
+
+func TestCacheLRUEviction(t *testing.T) {
+	stub, _ := embedStub()
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{MaxEntries: 2}}, stub)
+	ctx := context.Background()
+	for _, text := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.Embed(ctx, text); err != nil {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+	}
+	// "c" evicts "b", then "a" is used again, so re-adding "b" evicts "c".
+	if s := c.CacheStats(); s.Hits != 2 || s.Misses != 4 || s.Evictions != 2 || s.Entries != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	calls := stub.calls.Load()
+	if _, err := c.Embed(ctx, "a"); err != nil || stub.calls.Load() != calls {
+		t.Fatalf("expected %q to still be cached", "a")
+	}
+
+	sized := NewWithTransport(ClientConfig{Cache: CacheConfig{MaxBytes: int64(2 * (len(DefaultModel) + 2 + 12))}}, stub)
+	for _, text := range []string{"x", "y", "z"} {
+		if _, err := sized.Embed(ctx, text); err != nil {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+	}
+	if s := sized.CacheStats(); s.Entries != 2 || s.Evictions != 1 || s.Bytes > sized.cfg.Cache.MaxBytes {
+		t.Fatalf("unexpected byte-bounded stats %+v", s)
+	}
+}
+
+func TestCacheBatchSendsOnlyMisses(t *testing.T) {
+	stub, sent := embedStub()
+	c, err := NewClient("", WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), MaxBatchSize: 10}), WithCache(CacheConfig{}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	c.transport = stub
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "aa"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	vectors, err := c.EmbedBatch(ctx, []string{"aa", "bbb", "c", "bbb"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	for i, want := range []float32{2, 3, 1, 3} {
+		if vectors[i][0] != want {
+			t.Fatalf("vector %d = %v, want length %v", i, vectors[i], want)
+		}
+	}
+	if want := [][]string{{"aa"}, {"bbb", "c"}}; !reflect.DeepEqual(sent(), want) {
+		t.Fatalf("sent %v, want %v", sent(), want)
+	}
+	if s := c.CacheStats(); s.Hits != 1 || s.Misses != 3 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	stub, _ := embedStub()
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{MaxEntries: 4}}, stub)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				text := fmt.Sprint(g*i%7, "x")
+				v, err := c.Embed(context.Background(), text)
+				if err != nil || int(v[0]) != len(text) {
+					t.Errorf("Embed(%q) = %v, %v", text, v, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if s := c.CacheStats(); s.Hits+s.Misses != 16*50 || s.Entries > 4 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,393 @@
+//go:build !windows
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cancelAfter is how long the cancellation tests let a call go on writing
+// once the server has stopped reading before cancelling it.
+const cancelAfter = 100 * time.Millisecond
+
+// hugeInput is too large for the socket buffers to take in one write.
+var hugeInput = strings.Repeat("x", 8<<20)
+
+// cancelServer serves the fake protocol on a unix socket, holding back
+// answers to requests mentioning "hold" until released.
+type cancelServer struct {
+	path    string
+	accepts atomic.Int32
+	// stall makes the next connection stop reading after stallAfter bytes;
+	// stalled is signalled when it does.
+	stall   atomic.Bool
+	stalled chan struct{}
+	// held is signalled when an answer is held back, release lets it go.
+	held    chan struct{}
+	release chan struct{}
+	done    chan struct{}
+}
+
+// stallAfter is the share of its input a stalled connection reads.
+const stallAfter = 64 << 10
+
+func newCancelServer(t *testing.T) *cancelServer {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "enx")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s := &cancelServer{
+		path:    filepath.Join(dir, "s.sock"),
+		stalled: make(chan struct{}, 1),
+		held:    make(chan struct{}, 1),
+		release: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	ln, err := net.Listen("unix", s.path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		close(s.done)
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.accepts.Add(1)
+			go s.serve(conn, s.stall.Swap(false))
+		}
+	}()
+	return s
+}
+
+func (s *cancelServer) serve(conn net.Conn, stall bool) {
+	defer conn.Close()
+	var r io.Reader = conn
+	if stall {
+		r = io.MultiReader(io.LimitReader(conn, stallAfter), &blockingReader{s.stalled, s.done})
+	}
+	reader := bufio.NewReader(r)
+	f := newFraming(FramingNewline, 0)
+	for {
+		payload, err := f.read(reader)
+		if err != nil {
+			return
+		}
+		var req Request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return
+		}
+		// A stream is held back after its first frame, a call before its
+		// answer.
+		held := -1
+		if bytes.Contains(req.Params, []byte("hold")) {
+			held = 0
+			if req.Method == MethodEmbedStream {
+				held = 1
+			}
+		}
+		for i, resp := range streamFrames(&req, defaultHandler) {
+			if i == held {
+				s.held <- struct{}{}
+				select {
+				case <-s.release:
+				case <-s.done:
+					return
+				}
+			}
+			out, _ := json.Marshal(resp)
+			if err := f.write(conn, out); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// blockingReader signals reading and reads nothing until done is closed.
+type blockingReader struct {
+	reading chan<- struct{}
+	done    <-chan struct{}
+}
+
+func (r *blockingReader) Read([]byte) (int, error) {
+	select {
+	case r.reading <- struct{}{}:
+	default:
+	}
+	<-r.done
+	return 0, io.EOF
+}
+
+// cancelOn returns a context cancelled once signal fires.
+func cancelOn(signal <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-signal:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func TestCancelStreamTransport(t *testing.T) {
+	for _, mode := range []struct {
+		name  string
+		depth int
+	}{{"serialized", 0}, {"pipelined", 4}} {
+		for _, tc := range []struct {
+			name string
+			// cancel runs a call with ctx, cancelled as the case says, and
+			// returns its error.
+			cancel func(t *testing.T, s *cancelServer, c *Client) error
+			// reconnects reports whether the connection is replaced.
+			reconnects bool
+		}{
+			{"before send", func(t *testing.T, s *cancelServer, c *Client) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err := c.Embed(ctx, "never sent")
+				return err
+			}, false},
+			{"mid-upload", func(t *testing.T, s *cancelServer, c *Client) error {
+				ctx, cancel := cancelOn(s.stalled)
+				defer cancel()
+				_, err := c.Embed(ctx, hugeInput)
+				return err
+			}, true},
+			{"awaiting response", func(t *testing.T, s *cancelServer, c *Client) error {
+				ctx, cancel := cancelOn(s.held)
+				defer cancel()
+				_, err := c.Embed(ctx, "hold")
+				// The answer arrives once the call is gone.
+				go func() { s.release <- struct{}{} }()
+				return err
+			}, false},
+			{"mid-stream", func(t *testing.T, s *cancelServer, c *Client) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				results, err := c.EmbedStream(ctx, []string{"hold", "b", "c"})
+				if err != nil {
+					return err
+				}
+				if r := <-results; r.Err != nil {
+					t.Fatalf("first result: %v", r.Err)
+				}
+				<-s.held
+				cancel()
+				var last error
+				for r := range results {
+					last = r.Err
+				}
+				go func() { s.release <- struct{}{} }()
+				if last == nil {
+					last = ctx.Err()
+				}
+				return last
+			}, false},
+		} {
+			t.Run(mode.name+"/"+tc.name, func(t *testing.T) {
+				s := newCancelServer(t)
+				c, err := New(ClientConfig{Transport: TransportUnix, SocketPath: s.path, MaxPipelineDepth: mode.depth})
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+				defer c.Close(context.Background())
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				s.stall.Store(tc.name == "mid-upload")
+				if _, err := c.Embed(ctx, "warm up"); err != nil {
+					t.Fatalf("Embed: %v", err)
+				}
+
+				start := time.Now()
+				err = tc.cancel(t, s, c)
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("cancelled call: %v, want context.Canceled", err)
+				}
+				if elapsed := time.Since(start); elapsed > 5*time.Second {
+					t.Fatalf("cancelled call returned after %s", elapsed)
+				}
+				// The next call is answered on a connection left in step.
+				vecs, err := c.Embed(ctx, "after")
+				if err != nil {
+					t.Fatalf("Embed after cancelling: %v", err)
+				}
+				if vecs[0] != float32(len("after")) {
+					t.Fatalf("Embed after cancelling got %v, an answer to another call", vecs)
+				}
+				want := int32(1)
+				if tc.reconnects {
+					want = 2
+				}
+				if got := s.accepts.Load(); got != want {
+					t.Fatalf("%d connections, want %d", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCancelHTTPUpload(t *testing.T) {
+	var received atomic.Int64
+	reading := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength < int64(len(hugeInput)) {
+			httpHandler(defaultHandler).ServeHTTP(w, r)
+			return
+		}
+		reading <- struct{}{}
+		// Read slowly, until the client gives up.
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Body.Read(buf)
+			received.Add(int64(n))
+			if err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := cancelOn(reading)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Embed(ctx, hugeInput); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Embed: %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelled call returned after %s", elapsed)
+	}
+	if got := received.Load(); got >= int64(len(hugeInput)) {
+		t.Fatalf("server received the whole %d-byte body", got)
+	}
+	if _, err := c.Embed(context.Background(), "after"); err != nil {
+		t.Fatalf("Embed after cancelling: %v", err)
+	}
+}
+
+func TestCancelWebSocketUpload(t *testing.T) {
+	var accepts atomic.Int32
+	accepted := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	serve := wsHandler(defaultHandler)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accepts.Add(1) > 1 {
+			serve.ServeHTTP(w, r)
+			return
+		}
+		// The first connection reads nothing.
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		accepted <- struct{}{}
+		<-stop
+	}))
+	// Small buffers keep the kernel from taking the whole message in.
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if tcp, ok := conn.(*net.TCPConn); ok && state == http.StateNew {
+			tcp.SetReadBuffer(4 << 10)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-accepted
+		time.Sleep(cancelAfter)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := c.Embed(ctx, hugeInput); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Embed: %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelled call returned after %s", elapsed)
+	}
+	// A connection cut mid-message is replaced.
+	if _, err := c.Embed(context.Background(), "after"); err != nil {
+		t.Fatalf("Embed after cancelling: %v", err)
+	}
+	if got := accepts.Load(); got != 2 {
+		t.Fatalf("%d connections, want 2", got)
+	}
+}
+
+func TestCancelBatchProgress(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		reached, release := make(chan struct{}), make(chan struct{})
+		handler := func(req *Request) *Response {
+			if bytes.Contains(req.Params, []byte("hold")) {
+				close(reached)
+				<-release
+			}
+			return defaultHandler(req)
+		}
+		c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(handler)})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-reached
+			cancel()
+		}()
+		opts := []EmbedOption{WithBatchSize(1), WithConcurrency(1)}
+		if partial {
+			opts = append(opts, WithPartialResults())
+		}
+		out, err := c.EmbedBatch(ctx, []string{"a", "b", "hold", "c"}, opts...)
+		close(release)
+		var progress *BatchProgressError
+		if !errors.As(err, &progress) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("partial %v: EmbedBatch: %v, want a *BatchProgressError wrapping context.Canceled", partial, err)
+		}
+		if progress.Completed != 2 || progress.Chunks != 4 || progress.Embedded != 2 || progress.Total != 4 {
+			t.Fatalf("partial %v: progress %+v, want 2 of 4 chunks and inputs", partial, progress)
+		}
+		if partial && (out[0] == nil || out[1] == nil || out[2] != nil || out[3] != nil) {
+			t.Fatalf("partial results %v", out)
+		}
+		if _, err := c.Embed(context.Background(), "after"); err != nil {
+			t.Fatalf("partial %v: Embed after cancelling: %v", partial, err)
+		}
+		c.Close(context.Background())
+	}
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// CanonicalJSON returns raw, a JSON value, in the canonical form transcript
+// messages are written in, so that recording the same session twice yields
+// the same bytes: object keys sorted, no insignificant whitespace, "<", ">",
+// and "&" left unescaped, and every number with a fraction or exponent in
+// the shortest form that reads back as the same float64. Integers are kept
+// digit for digit. Input that is not valid JSON is returned unchanged.
+func CanonicalJSON(raw []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return raw
+	}
+	out, err := marshalCanonical(canonicalValue(v), false)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// canonicalValue rewrites the numbers of v, decoded with UseNumber, in
+// their canonical form. The encoder sorts the keys of the objects.
+func canonicalValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			v[k] = canonicalValue(x)
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = canonicalValue(x)
+		}
+	case json.Number:
+		return canonicalNumber(v)
+	}
+	return v
+}
+
+func canonicalNumber(n json.Number) json.Number {
+	if !strings.ContainsAny(string(n), ".eE") {
+		return n
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	// encoding/json renders a float64 in its shortest round-trip form.
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return n
+	}
+	return json.Number(raw)
+}
+
+// marshalCanonical encodes v without escaping "<", ">", and "&", indented
+// by two spaces per level when indented is set, with no trailing newline.
+// Recorders write transcripts with it, after CanonicalJSON has rewritten
+// their messages; the markers and entry fields keep their declared order.
+func marshalCanonical(v any, indented bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indented {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,22 @@
+package client
+
+import "testing"
+
+func TestCanonicalJSON(t *testing.T) {
+	cases := []struct {
+		raw, want string
+	}{
+		{`{"b": 1, "a": {"d": [3, 2], "c": null}}`, `{"a":{"c":null,"d":[3,2]},"b":1}`},
+		{`{"x": 1.50, "y": 1e2, "z": -2.5E-7}`, `{"x":1.5,"y":100,"z":-2.5e-7}`},
+		{`{"id": 12345678901234567890}`, `{"id":12345678901234567890}`},
+		{`{"note": "<a&b>"}`, `{"note":"<a&b>"}`},
+		{`[true, "s"]`, `[true,"s"]`},
+		{`{"cut": `, `{"cut": `},
+		{`{} {}`, `{} {}`},
+	}
+	for _, tc := range cases {
+		if got := string(CanonicalJSON([]byte(tc.raw))); got != tc.want {
+			t.Errorf("CanonicalJSON(%s) = %s, want %s", tc.raw, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CapabilityPolicy bounds how long the client trusts the model list it
+// caches for ClientConfig.ValidateModel, WithDimensions, truncation, and
+// response validation. A list older than TTL is fetched again before its
+// next use, or with BackgroundRefresh served once more while a refresh
+// runs. Whatever the policy, the list is refreshed when the server answers
+// an embed for a model it lists with ErrModelNotFound, or with vectors
+// that break RuleDimension against the listed dimension, and the request
+// is retried once against the new list; see Client.RefreshCapabilities.
+//
+// The zero value keeps a list until it is found stale that way.
+type CapabilityPolicy struct {
+	// TTL is how long a fetched model list stays fresh; zero keeps it.
+	TTL time.Duration
+	// BackgroundRefresh has a call finding the list past its TTL use it
+	// while one refresh runs in the background, instead of waiting for
+	// the refresh. It needs a TTL.
+	BackgroundRefresh bool
+}
+
+func (p CapabilityPolicy) validate() error {
+	if p.TTL < 0 {
+		return errors.New("capability TTL must not be negative")
+	}
+	if p.BackgroundRefresh && p.TTL == 0 {
+		return errors.New("background capability refresh needs a capability TTL")
+	}
+	return nil
+}
+
+// WithCapabilityTTL has the model list the client caches fetched again
+// once it is older than ttl; see CapabilityPolicy. It overrides
+// WithConfig's Capabilities.TTL.
+func WithCapabilityTTL(ttl time.Duration) Option {
+	return func(o *clientOptions) error {
+		if ttl <= 0 {
+			return fmt.Errorf("WithCapabilityTTL: TTL must be positive, got %v", ttl)
+		}
+		o.capabilityTTL = ttl
+		return nil
+	}
+}
+
+// WithBackgroundCapabilityRefresh refreshes a model list past its TTL in
+// the background; see CapabilityPolicy.BackgroundRefresh.
+func WithBackgroundCapabilityRefresh() Option {
+	return func(o *clientOptions) error {
+		o.backgroundCapabilities = true
+		return nil
+	}
+}
+
+// capabilityCache holds the model list of the last listing and the refresh
+// in flight, which concurrent callers share.
+type capabilityCache struct {
+	mu      sync.Mutex
+	models  []ModelInfo
+	fetched time.Time
+	flight  *capabilityRefresh
+}
+
+// capabilityRefresh is a refresh in flight. Its waiters read models and
+// err once done is closed.
+type capabilityRefresh struct {
+	done   chan struct{}
+	models []ModelInfo
+	err    error
+}
+
+// store caches models, listed at now.
+func (cc *capabilityCache) store(models []ModelInfo, now time.Time) {
+	cc.mu.Lock()
+	cc.models, cc.fetched = models, now
+	cc.mu.Unlock()
+}
+
+// cached returns the cached list, nil when none is, whatever its age.
+func (cc *capabilityCache) cached() []ModelInfo {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.models
+}
+
+// age returns how long ago the cached list was fetched, 0 when none is.
+func (cc *capabilityCache) age(now time.Time) time.Duration {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.models == nil {
+		return 0
+	}
+	return now.Sub(cc.fetched)
+}
+
+// RefreshCapabilities fetches the server's model list again and caches it,
+// replacing the cached one, which the client otherwise refreshes as
+// ClientConfig.Capabilities says. A refresh already in flight is joined
+// rather than repeated. On failure the cached list is kept.
+func (c *Client) RefreshCapabilities(ctx context.Context) error {
+	if err := c.gate.check(ctx); err != nil {
+		return err
+	}
+	if _, err := c.refreshCapabilities(ctx); err != nil {
+		return fmt.Errorf("refresh capabilities: %w", err)
+	}
+	return nil
+}
+
+// startRefresh starts listing the models, unless a listing is in flight
+// already, and returns the one in flight. The listing runs apart from ctx,
+// so one caller giving up does not fail the others.
+func (c *Client) startRefresh(ctx context.Context) *capabilityRefresh {
+	cc := &c.capabilities
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.flight != nil {
+		return cc.flight
+	}
+	f := &capabilityRefresh{done: make(chan struct{})}
+	cc.flight = f
+	go func() {
+		f.models, f.err = c.listModels(context.WithoutCancel(ctx))
+		c.metrics.stats.capabilityRefresh()
+		cc.mu.Lock()
+		cc.flight = nil
+		cc.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// refreshCapabilities lists the models, or waits for the listing in
+// flight.
+func (c *Client) refreshCapabilities(ctx context.Context) ([]ModelInfo, error) {
+	f := c.startRefresh(ctx)
+	select {
+	case <-f.done:
+		return f.models, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// currentModels returns the model list as ClientConfig.Capabilities allows
+// using it, listing the models when none is cached or the cached one has
+// expired, and reports whether it was fetched for this call.
+func (c *Client) currentModels(ctx context.Context) ([]ModelInfo, bool, error) {
+	policy := c.cfg.Capabilities
+	cc := &c.capabilities
+	cc.mu.Lock()
+	models, fetched := cc.models, cc.fetched
+	cc.mu.Unlock()
+	if models != nil && (policy.TTL == 0 || c.now().Sub(fetched) < policy.TTL) {
+		return models, false, nil
+	}
+	if models != nil && policy.BackgroundRefresh {
+		c.startRefresh(ctx)
+		return models, false, nil
+	}
+	models, err := c.refreshCapabilities(ctx)
+	return models, true, err
+}
+
+// staleCapabilities reports whether err, the failure of an embed for
+// model, may come from a cached model list the server no longer serves:
+// the model is listed and the server does not know it, or its vectors
+// are not of the listed dimension.
+func (c *Client) staleCapabilities(model string, err error) bool {
+	var listed bool
+	for _, m := range c.capabilities.cached() {
+		listed = listed || m.Name == model
+	}
+	var verr *ResponseValidationError
+	return listed && (errors.Is(err, ErrModelNotFound) || errors.As(err, &verr) && verr.Rule == RuleDimension)
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// swappingServer serves DefaultModel at dim components, with the model
+// list answering after release is closed when it is set, and answers the
+// next notFound embeds with CodeModelNotFound.
+type swappingServer struct {
+	mu       sync.Mutex
+	dim      int
+	notFound int
+	release  chan struct{}
+	requests map[string]int
+}
+
+func (s *swappingServer) handle(req *Request) *Response {
+	s.mu.Lock()
+	if s.requests == nil {
+		s.requests = make(map[string]int)
+	}
+	s.requests[req.Method]++
+	dim, release := s.dim, s.release
+	notFound := req.Method == MethodEmbed && s.notFound > 0
+	if notFound {
+		s.notFound--
+	}
+	s.mu.Unlock()
+	resp := &Response{JSONRPC: JSONRPCVersion, ID: req.ID}
+	switch {
+	case req.Method == MethodListModels:
+		if release != nil {
+			<-release
+		}
+		resp.Result, _ = json.Marshal(listModelsResult{Models: []ModelInfo{{Name: DefaultModel, Dimension: dim}}})
+	case notFound:
+		resp.Error = &RPCError{Code: CodeModelNotFound, Message: "model swapped out"}
+	case req.Method == MethodEmbed:
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		entries := make([]embeddingEntry, len(params.Inputs))
+		for i := range params.Inputs {
+			entries[i] = embeddingEntry{Index: i, Vector: make([]float32, dim)}
+		}
+		resp.Result, _ = json.Marshal(embedResult{Model: params.Model, Embeddings: entries})
+	default:
+		return defaultHandler(req)
+	}
+	return resp
+}
+
+func (s *swappingServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+func (s *swappingServer) client(t *testing.T, cfg ClientConfig) *Client {
+	t.Helper()
+	srv := httptest.NewServer(httpHandler(s.handle))
+	t.Cleanup(srv.Close)
+	cfg.Transport, cfg.Endpoint = TransportHTTP, srv.URL
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestCapabilityTTL(t *testing.T) {
+	s := &swappingServer{dim: 3}
+	c := s.client(t, ClientConfig{ValidateModel: true, Capabilities: CapabilityPolicy{TTL: time.Minute}})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	embed := func() {
+		t.Helper()
+		if _, err := c.EmbedBatch(context.Background(), []string{"a"}); err != nil {
+			t.Fatalf("EmbedBatch: %v", err)
+		}
+	}
+
+	embed()
+	now = now.Add(30 * time.Second)
+	embed()
+	if s.count(MethodListModels) != 1 || c.Stats().CapabilitiesAge != 30*time.Second {
+		t.Fatalf("%d listings, age %v", s.count(MethodListModels), c.Stats().CapabilitiesAge)
+	}
+	now = now.Add(time.Minute)
+	embed()
+	if st := c.Stats(); s.count(MethodListModels) != 2 || st.CapabilitiesAge != 0 || st.CapabilityRefreshes != 2 {
+		t.Fatalf("%d listings, stats %+v", s.count(MethodListModels), st)
+	}
+
+	// In the background the expired list answers while it is refreshed.
+	c.cfg.Capabilities.BackgroundRefresh = true
+	s.mu.Lock()
+	s.release = make(chan struct{})
+	s.mu.Unlock()
+	now = now.Add(2 * time.Minute)
+	embed()
+	if age := c.Stats().CapabilitiesAge; age != 2*time.Minute {
+		t.Fatalf("age %v while refreshing", age)
+	}
+	close(s.release)
+	for deadline := time.Now().Add(5 * time.Second); c.Stats().CapabilityRefreshes != 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh did not finish: %+v", c.Stats())
+		}
+	}
+	if age := c.Stats().CapabilitiesAge; age != 0 {
+		t.Fatalf("age %v after the refresh", age)
+	}
+}
+
+func TestRefreshCapabilitiesSingleFlight(t *testing.T) {
+	s := &swappingServer{dim: 3, release: make(chan struct{})}
+	c := s.client(t, ClientConfig{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.RefreshCapabilities(context.Background())
+		}()
+	}
+	// A caller giving up leaves the refresh to the others.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.RefreshCapabilities(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RefreshCapabilities with an expired context: %v", err)
+	}
+	close(s.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("RefreshCapabilities: %v", err)
+		}
+	}
+	if n := s.count(MethodListModels); n != 1 || c.Stats().CapabilityRefreshes != 1 {
+		t.Fatalf("%d listings for concurrent refreshes, stats %+v", n, c.Stats())
+	}
+	if dim := c.knownDimension(DefaultModel, 0); dim != 3 {
+		t.Fatalf("cached dimension %d", dim)
+	}
+}
+
+func TestCapabilityInvalidation(t *testing.T) {
+	t.Run("dimension", func(t *testing.T) {
+		s := &swappingServer{dim: 3}
+		c := s.client(t, ClientConfig{})
+		if err := c.RefreshCapabilities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		s.mu.Lock()
+		s.dim = 4
+		s.mu.Unlock()
+		v, err := c.Embed(context.Background(), "a")
+		if err != nil || len(v) != 4 {
+			t.Fatalf("Embed after the swap: %v, %v", v, err)
+		}
+		if s.count(MethodListModels) != 2 || s.count(MethodEmbed) != 2 || c.knownDimension(DefaultModel, 0) != 4 {
+			t.Fatalf("requests %v", s.requests)
+		}
+	})
+
+	t.Run("model not found", func(t *testing.T) {
+		s := &swappingServer{dim: 3, notFound: 1}
+		c := s.client(t, ClientConfig{})
+		if err := c.RefreshCapabilities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Embed(context.Background(), "a"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if s.count(MethodListModels) != 2 || s.count(MethodEmbed) != 2 {
+			t.Fatalf("requests %v", s.requests)
+		}
+
+		// The retry is made once.
+		s.mu.Lock()
+		s.notFound = 2
+		s.mu.Unlock()
+		if _, err := c.Embed(context.Background(), "b"); !errors.Is(err, ErrModelNotFound) {
+			t.Fatalf("Embed: %v", err)
+		}
+		if s.count(MethodListModels) != 3 || s.count(MethodEmbed) != 4 {
+			t.Fatalf("requests %v", s.requests)
+		}
+	})
+
+	t.Run("nothing cached", func(t *testing.T) {
+		s := &swappingServer{dim: 3, notFound: 1}
+		c := s.client(t, ClientConfig{})
+		if _, err := c.Embed(context.Background(), "a"); !errors.Is(err, ErrModelNotFound) {
+			t.Fatalf("Embed: %v", err)
+		}
+		if s.count(MethodListModels) != 0 || s.count(MethodEmbed) != 1 {
+			t.Fatalf("requests %v", s.requests)
+		}
+	})
+}
+
+func TestCapabilityOptions(t *testing.T) {
+	c, err := NewClient("http://localhost:1", WithCapabilityTTL(time.Minute), WithBackgroundCapabilityRefresh())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if c.cfg.Capabilities != (CapabilityPolicy{TTL: time.Minute, BackgroundRefresh: true}) {
+		t.Fatalf("policy %+v", c.cfg.Capabilities)
+	}
+	if _, err := NewClient("http://localhost:1", WithCapabilityTTL(0)); err == nil {
+		t.Fatal("WithCapabilityTTL(0) accepted")
+	}
+	if _, err := NewClient("http://localhost:1", WithBackgroundCapabilityRefresh()); err == nil {
+		t.Fatal("a background refresh without a TTL was accepted")
+	}
+}
@@ -0,0 +1,677 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// CBORCodec carries envelopes as CBOR (RFC 8949) in its core deterministic
+// encoding, so equal envelopes always encode to the same bytes, which a
+// server can verify a signature over after encoding them again: integers
+// and lengths take their shortest form, floats the shortest of half,
+// single, and double precision that holds them exactly, nothing has an
+// indefinite length, and maps, struct fields included, are sorted by their
+// encoded keys, shorter ones first. A value encodes as the CBOR
+// counterpart of its JSON but for []byte, which travels as a byte string;
+// []float32, vectors among them, are arrays of floats. json.Marshaler
+// values encode as the value their JSON holds.
+//
+// Decoding goes through JSON, as that of MsgPackCodec does: a byte string
+// becomes the base64 string of its bytes, and so does a float32 typed
+// array of RFC 8746, tag 81 or 85, as its little-endian components, which
+// vectors read back. Half- and single-precision floats are written with
+// the digits of a float32. Maps with keys other than text, other tags,
+// simple values but false, true, and null, non-finite floats, and
+// indefinite lengths fail to decode. Its ContentType is application/cbor.
+var CBORCodec Codec = cborCodec{}
+
+// CBORTypedArrayCodec is CBORCodec encoding []float32 and [N]float32 as
+// RFC 8746 typed arrays, tag 85 of their little-endian components, for
+// peers that decode them; see InitializeResult.CBORTypedArrays.
+var CBORTypedArrayCodec Codec = cborCodec{typedArrays: true}
+
+type cborCodec struct {
+	typedArrays bool
+}
+
+func (cborCodec) Name() string { return CodecCBOR }
+
+func (c cborCodec) Marshal(v any) ([]byte, error) {
+	e := cborEncoder{typedArrays: c.typedArrays}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	return e.buf, nil
+}
+
+func (cborCodec) ContentType() string { return "application/" + CodecCBOR }
+
+func (c cborCodec) Unmarshal(data []byte, v any) error {
+	if resp, ok := v.(*Response); ok {
+		return c.decodeResponse(data, resp)
+	}
+	doc, err := c.ProjectJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(doc, v)
+}
+
+// ProjectJSON returns the JSON the item in data transcodes to.
+func (cborCodec) ProjectJSON(data []byte) ([]byte, error) {
+	d := cborDecoder{data: data}
+	return d.document()
+}
+
+func (cborCodec) decodeResponse(data []byte, resp *Response) error {
+	d := cborDecoder{data: data}
+	return d.response(resp)
+}
+
+// CBOR major types, in the top three bits of an item's first byte.
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// RFC 8746 tags of float32 typed arrays.
+const (
+	cborTagFloat32BE = 81
+	cborTagFloat32LE = 85
+)
+
+// maxCBORDepth bounds the nesting of a decoded document, as maxMsgPackDepth
+// does.
+const maxCBORDepth = 10000
+
+var errCBORShort = errors.New("cbor: unexpected end of data")
+
+type cborEncoder struct {
+	buf         []byte
+	typedArrays bool
+}
+
+// head appends the head of an item of major type major and argument n, in
+// its shortest form.
+func (e *cborEncoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, major|26), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, major|27), n)
+	}
+}
+
+func (e *cborEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xf6)
+		return nil
+	}
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		e.buf = append(e.buf, 0xf6)
+		return nil
+	}
+	if v.CanInterface() && v.Type().Implements(jsonMarshalerType) {
+		raw, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return e.encodeJSON(raw)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xf5)
+		} else {
+			e.buf = append(e.buf, 0xf4)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(v.Float())
+	case reflect.String:
+		e.text(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xf6)
+			return nil
+		}
+		switch v.Type().Elem().Kind() {
+		case reflect.Uint8:
+			e.head(cborBytes, uint64(v.Len()))
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		case reflect.Float32:
+			e.float32s(v)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Float32 {
+			e.float32s(v)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	case reflect.Pointer, reflect.Interface:
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *cborEncoder) int(i int64) {
+	if i >= 0 {
+		e.head(cborUint, uint64(i))
+		return
+	}
+	e.head(cborNegInt, uint64(-1-i))
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// float appends f in the shortest precision that holds it exactly, NaN as
+// the half-precision quiet NaN.
+func (e *cborEncoder) float(f float64) {
+	switch {
+	case math.IsNaN(f):
+		e.buf = append(e.buf, 0xf9, 0x7e, 0x00)
+	case float64(float32(f)) != f:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xfb), math.Float64bits(f))
+	default:
+		if h, ok := float16Bits(float32(f)); ok {
+			e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xf9), h)
+			return
+		}
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xfa), math.Float32bits(float32(f)))
+	}
+}
+
+// float16Bits returns the half-precision bits of f, reporting false when a
+// half cannot hold it exactly.
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp, mant := int(bits>>23&0xff), bits&0x7fffff
+	switch {
+	case exp == 0 && mant == 0:
+		return sign, true
+	case exp == 0xff:
+		// NaNs are written by float; this is an infinity.
+		return sign | 0x7c00, mant == 0
+	case exp == 0:
+		// Single-precision subnormals are below the smallest half.
+		return 0, false
+	}
+	e := exp - 127
+	switch {
+	case e >= -14 && e <= 15:
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(e+15)<<10 | uint16(mant>>13), true
+	case e >= -24 && e < -14:
+		// A half subnormal, m times 2^-24.
+		full, shift := mant|1<<23, uint(-1-e)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
+
+// float16 returns the value of half-precision bits h.
+func float16(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// float32s appends the float32 components of v, as a typed array when the
+// peer decodes them.
+func (e *cborEncoder) float32s(v reflect.Value) {
+	n := v.Len()
+	if !e.typedArrays {
+		e.head(cborArray, uint64(n))
+		for i := 0; i < n; i++ {
+			e.float(v.Index(i).Float())
+		}
+		return
+	}
+	e.head(cborTag, cborTagFloat32LE)
+	e.head(cborBytes, uint64(4*n))
+	for i := 0; i < n; i++ {
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Index(i).Float())))
+	}
+}
+
+func (e *cborEncoder) array(v reflect.Value) error {
+	e.head(cborArray, uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cborKeyLess orders text keys as their encodings sort bytewise: by
+// length, then by their bytes.
+func cborKeyLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func (e *cborEncoder) encodeMap(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf = append(e.buf, 0xf6)
+		return nil
+	}
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return cborKeyLess(keys[i].String(), keys[j].String()) })
+	e.head(cborMap, uint64(len(keys)))
+	for _, k := range keys {
+		e.text(k.String())
+		if err := e.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cborFields caches the fields of the struct types encoded, in key order.
+var cborFields sync.Map
+
+func cborFieldsOf(t reflect.Type) []msgpackField {
+	if fields, ok := cborFields.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+	fields := append([]msgpackField(nil), msgpackFieldsOf(t)...)
+	sort.Slice(fields, func(i, j int) bool { return cborKeyLess(fields[i].name, fields[j].name) })
+	cborFields.Store(t, fields)
+	return fields
+}
+
+func (e *cborEncoder) encodeStruct(v reflect.Value) error {
+	fields := cborFieldsOf(v.Type())
+	values := make([]reflect.Value, len(fields))
+	n := 0
+	for i, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		values[i] = fv
+		n++
+	}
+	e.head(cborMap, uint64(n))
+	for i, f := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+		e.text(f.name)
+		if err := e.encode(values[i]); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// encodeJSON appends the value of the JSON document raw.
+func (e *cborEncoder) encodeJSON(raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return e.encodeAny(v)
+}
+
+// encodeAny appends a value decoded from JSON, its numbers kept as
+// json.Number: integers encode as integers, the others as floats.
+func (e *cborEncoder) encodeAny(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xf6)
+	case bool:
+		return e.encode(reflect.ValueOf(v))
+	case string:
+		e.text(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			e.int(i)
+			return nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			e.head(cborUint, u)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		e.float(f)
+	case []any:
+		e.head(cborArray, uint64(len(v)))
+		for _, elem := range v {
+			if err := e.encodeAny(elem); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return cborKeyLess(keys[i], keys[j]) })
+		e.head(cborMap, uint64(len(keys)))
+		for _, k := range keys {
+			e.text(k)
+			if err := e.encodeAny(v[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cborDecoder transcodes CBOR into JSON.
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+// document transcodes the one item of the data.
+func (d *cborDecoder) document() ([]byte, error) {
+	doc, err := d.value(nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d bytes after the item", len(d.data)-d.off)
+	}
+	return doc, nil
+}
+
+// response decodes a Response envelope as msgpackDecoder.response does.
+func (d *cborDecoder) response(resp *Response) error {
+	major, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	if major != cborMap {
+		return fmt.Errorf("cbor: a response of major type %d, not a map", major>>5)
+	}
+	if n > uint64(len(d.data)-d.off) {
+		return errCBORShort
+	}
+	for i := uint64(0); i < n; i++ {
+		key, err := d.key()
+		if err != nil {
+			return err
+		}
+		var dst []byte
+		if string(key) == "result" {
+			dst = make([]byte, 0, (len(d.data)-d.off)*4/3+64)
+		}
+		member, err := d.value(dst, 1)
+		if err != nil {
+			return err
+		}
+		var target any
+		switch string(key) {
+		case "result":
+			resp.Result = member
+			continue
+		case "jsonrpc":
+			target = &resp.JSONRPC
+		case "id":
+			target = &resp.ID
+		case "error":
+			target = &resp.Error
+		case "meta":
+			target = &resp.Meta
+		default:
+			continue
+		}
+		if err := json.Unmarshal(member, target); err != nil {
+			return fmt.Errorf("cbor: response %s: %w", key, err)
+		}
+	}
+	if d.off != len(d.data) {
+		return fmt.Errorf("cbor: %d bytes after the response", len(d.data)-d.off)
+	}
+	return nil
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, errCBORShort
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head reads the head of an item: its major type and argument. For simple
+// values and floats the argument is the raw bits that follow.
+func (d *cborDecoder) head() (major byte, n uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		raw, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, c := range raw {
+			n = n<<8 | uint64(c)
+		}
+		return major, n, nil
+	case info == 31:
+		return 0, 0, errors.New("cbor: indefinite lengths are not deterministic")
+	}
+	return 0, 0, fmt.Errorf("cbor: reserved additional information %d", info)
+}
+
+// key reads a map key, which must be text.
+func (d *cborDecoder) key() ([]byte, error) {
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborText {
+		return nil, fmt.Errorf("cbor: a map key of major type %d, not text", major>>5)
+	}
+	return d.next(n)
+}
+
+// value appends the JSON of the next item to dst.
+func (d *cborDecoder) value(dst []byte, depth int) ([]byte, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: exceeded max depth")
+	}
+	start := d.off
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return strconv.AppendUint(dst, n, 10), nil
+	case cborNegInt:
+		// -1-n, which for the largest n is beyond int64.
+		dst = append(dst, '-')
+		if n == math.MaxUint64 {
+			return append(dst, "18446744073709551616"...), nil
+		}
+		return strconv.AppendUint(dst, n+1, 10), nil
+	case cborBytes:
+		raw, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return appendBase64String(dst, raw), nil
+	case cborText:
+		s, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(dst, s), nil
+	case cborArray:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errCBORShort
+		}
+		dst = append(dst, '[')
+		for i := uint64(0); i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = d.value(dst, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case cborMap:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errCBORShort
+		}
+		dst = append(dst, '{')
+		for i := uint64(0); i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			key, err := d.key()
+			if err != nil {
+				return nil, err
+			}
+			dst = append(appendJSONString(dst, key), ':')
+			if dst, err = d.value(dst, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, '}'), nil
+	case cborTag:
+		return d.typedArray(dst, n)
+	}
+	switch d.data[start] {
+	case 0xf4:
+		return append(dst, "false"...), nil
+	case 0xf5:
+		return append(dst, "true"...), nil
+	case 0xf6:
+		return append(dst, "null"...), nil
+	case 0xf9:
+		return d.float(dst, float16(uint16(n)))
+	case 0xfa:
+		return d.float(dst, float64(math.Float32frombits(uint32(n))))
+	case 0xfb:
+		f := math.Float64frombits(n)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("cbor: unsupported float %v", f)
+		}
+		return appendJSONFloat(dst, f, 64)
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value 0x%02x", d.data[start])
+}
+
+// float appends a half- or single-precision f with the digits of a
+// float32.
+func (d *cborDecoder) float(dst []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("cbor: unsupported float %v", f)
+	}
+	return appendJSONFloat(dst, f, 32)
+}
+
+// typedArray appends the base64 string of the little-endian components of
+// the float32 typed array tagged tag.
+func (d *cborDecoder) typedArray(dst []byte, tag uint64) ([]byte, error) {
+	if tag != cborTagFloat32LE && tag != cborTagFloat32BE {
+		return nil, fmt.Errorf("cbor: unsupported tag %d", tag)
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborBytes || n%4 != 0 {
+		return nil, fmt.Errorf("cbor: tag %d of an item other than float32s", tag)
+	}
+	raw, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if tag == cborTagFloat32LE {
+		return appendBase64String(dst, raw), nil
+	}
+	le := make([]byte, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.LittleEndian.PutUint32(le[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	return appendBase64String(dst, le), nil
+}
+
+// appendBase64String appends raw as a JSON string of its base64.
+func appendBase64String(dst, raw []byte) []byte {
+	start := len(dst) + 1
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(raw))+2)...)
+	base64.StdEncoding.Encode(dst[start:], raw)
+	dst[start-1], dst[len(dst)-1] = '"', '"'
+	return dst
+}
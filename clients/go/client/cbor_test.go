@@ -0,0 +1,304 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCBORDeterministicEncoding(t *testing.T) {
+	// The examples of RFC 8949 Appendix A, in their preferred encoding, and
+	// maps sorted by encoded key.
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{0, "00"}, {23, "17"}, {24, "1818"}, {100, "1864"}, {1000, "1903e8"},
+		{1000000, "1a000f4240"}, {uint64(1000000000000), "1b000000e8d4a51000"},
+		{-1, "20"}, {-1000, "3903e7"}, {int64(math.MinInt64), "3b7fffffffffffffff"},
+		{0.0, "f90000"}, {math.Copysign(0, -1), "f98000"}, {1.0, "f93c00"},
+		{1.1, "fb3ff199999999999a"}, {1.5, "f93e00"}, {65504.0, "f97bff"},
+		{100000.0, "fa47c35000"}, {3.4028234663852886e+38, "fa7f7fffff"},
+		{1.0e+300, "fb7e37e43c8800759c"}, {5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"}, {-4.0, "f9c400"}, {-4.1, "fbc010666666666666"},
+		{math.Inf(1), "f97c00"}, {math.NaN(), "f97e00"}, {math.Inf(-1), "f9fc00"},
+		{float32(0.1), "fa3dcccccd"},
+		{false, "f4"}, {true, "f5"}, {nil, "f6"},
+		{"", "60"}, {"a", "6161"}, {"IETF", "6449455446"}, {"ü", "62c3bc"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]int{}, "80"}, {[]int{1, 2, 3}, "83010203"},
+		{map[string]any{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{map[string]int{"b": 1, "aa": 2, "a": 3}, "a361610361620162616102"},
+		{json.RawMessage(`{"bb":1.5,"a":[-2,null]}`), "a261618221f6626262f93e00"},
+		{struct {
+			Long  string `json:"long"`
+			B     int    `json:"b"`
+			Empty string `json:"empty,omitempty"`
+		}{"x", 1, ""}, "a2616201646c6f6e676178"},
+	} {
+		raw, err := CBORCodec.Marshal(tc.v)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", tc.v, err)
+		}
+		if got := hex.EncodeToString(raw); got != tc.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+
+	// Equal envelopes encode to equal bytes, however their maps were built.
+	a := map[string]any{"inputs": []string{"x"}, "model": "m", "dimensions": 8}
+	b := map[string]any{"dimensions": 8, "model": "m", "inputs": []string{"x"}}
+	ra, _ := CBORCodec.Marshal(a)
+	rb, _ := CBORCodec.Marshal(b)
+	if !bytes.Equal(ra, rb) {
+		t.Fatalf("% x and % x", ra, rb)
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	req, err := newRequest(7, MethodEmbed, embedParams{Model: "m", Inputs: []string{"héllo", strings.Repeat("x", 300)}, Dimensions: 64}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := CBORCodec.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got Request
+	if err := CBORCodec.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !bytes.Equal(CanonicalJSON(mustJSON(t, &got)), CanonicalJSON(mustJSON(t, req))) {
+		t.Fatalf("round trip %s, want %s", mustJSON(t, &got), mustJSON(t, req))
+	}
+
+	// Vectors travel as arrays of floats, or as typed arrays, and decode
+	// back either way.
+	vector := []float32{1, 0.5, -0.25, 3.4028235e38, 1e-7, 0.1}
+	result := map[string]any{"model": "m", "embeddings": []map[string]any{{"index": 0, "vector": vector}}}
+	for _, codec := range []Codec{CBORCodec, CBORTypedArrayCodec} {
+		raw, err := codec.Marshal(result)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		typed := bytes.Contains(raw, []byte{0xd8, 85, 0x58, 4 * byte(len(vector)), 0, 0, 0x80, 0x3f})
+		if typed != (codec == CBORTypedArrayCodec) {
+			t.Fatalf("typed array %v: % x", typed, raw)
+		}
+		var decoded embedResult
+		if err := CBORCodec.Unmarshal(raw, &decoded); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !reflect.DeepEqual([]float32(decoded.Embeddings[0].Vector), vector) {
+			t.Fatalf("vector %v, want %v", decoded.Embeddings[0].Vector, vector)
+		}
+	}
+	// A big-endian typed array reads the same.
+	var v vectorData
+	if err := CBORCodec.Unmarshal([]byte{0xd8, 81, 0x48, 0x3f, 0x80, 0, 0, 0xbe, 0x80, 0, 0}, &v); err != nil || !reflect.DeepEqual([]float32(v), []float32{1, -0.25}) {
+		t.Fatalf("big-endian typed array %v, %v", v, err)
+	}
+
+	// The envelope's members, errors included, map as they do from JSON.
+	raw, err = CBORCodec.Marshal(&Response{JSONRPC: JSONRPCVersion, ID: 7, Error: &RPCError{Code: CodeModelNotFound, Message: "no such model"}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var resp Response
+	if err := CBORCodec.Unmarshal(raw, &resp); err != nil || resp.ID != 7 || resp.Error == nil || resp.Error.Code != CodeModelNotFound || resp.Error.Message != "no such model" {
+		t.Fatalf("response %+v, %v", resp, err)
+	}
+	raw, _ = CBORCodec.Marshal(&Response{JSONRPC: JSONRPCVersion, ID: 8, Result: mustJSON(t, map[string]any{"n": -40000, "f": 0.1, "big": uint64(math.MaxUint64)})})
+	if err := CBORCodec.Unmarshal(raw, &resp); err != nil || string(resp.Result) != `{"f":0.1,"n":-40000,"big":18446744073709551615}` {
+		t.Fatalf("result %s, %v", resp.Result, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated":   raw[:len(raw)-1],
+		"trailing":    append(append([]byte(nil), raw...), 0xf6),
+		"indefinite":  {0x9f, 0x01, 0xff},
+		"int key":     {0xa1, 0x01, 0xf6},
+		"NaN":         {0xf9, 0x7e, 0x00},
+		"infinity":    {0xfb, 0x7f, 0xf0, 0, 0, 0, 0, 0, 0},
+		"tag":         {0xc1, 0x00},
+		"undefined":   {0xf7},
+		"huge array":  {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge string": {0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"odd typed":   {0xd8, 85, 0x43, 0, 0, 0},
+	} {
+		var v any
+		if err := CBORCodec.Unmarshal(data, &v); err == nil {
+			t.Errorf("%s: decoded %v", name, v)
+		}
+	}
+}
+
+func TestFloat16Bits(t *testing.T) {
+	// Every half converts back to itself, and nothing else converts.
+	for h := 0; h <= math.MaxUint16; h++ {
+		f := float16(uint16(h))
+		if math.IsNaN(f) {
+			continue
+		}
+		got, ok := float16Bits(float32(f))
+		if !ok || got != uint16(h) {
+			t.Fatalf("half %04x: %v is %04x, %v", h, f, got, ok)
+		}
+	}
+	for _, f := range []float32{0.1, 65520, 1 + 1.0/2048, math.SmallestNonzeroFloat32, 1e-8} {
+		if h, ok := float16Bits(f); ok {
+			t.Errorf("%v became half %04x", f, h)
+		}
+	}
+}
+
+// cborServer answers with defaultHandler in CBOR once the handshake picks
+// it, decoding typed arrays when typedArrays is set, and checks the
+// signature of every signed request over the bytes it received.
+type cborServer struct {
+	typedArrays bool
+	signer      *signer
+
+	mu           sync.Mutex
+	contentTypes []string
+	params       map[string]json.RawMessage
+	signed       int
+	bodies       [][]byte
+}
+
+func (s *cborServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.contentTypes = append(s.contentTypes, r.Header.Get("Content-Type"))
+	s.bodies = append(s.bodies, body)
+	s.mu.Unlock()
+	if s.signer != nil {
+		ts, _ := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+		if r.Header.Get(SignatureHeader) != s.signer.signRequest(time.Unix(ts, 0), body) {
+			http.Error(w, "signature does not verify", http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		s.signed++
+		s.mu.Unlock()
+	}
+	codec := codecFor(r.Header.Get("Content-Type"))
+	var req Request
+	if err := codec.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := defaultHandler(&req)
+	var answer any = resp
+	switch req.Method {
+	case MethodInitialize:
+		s.mu.Lock()
+		_ = json.Unmarshal(req.Params, &s.params)
+		s.mu.Unlock()
+		var result map[string]any
+		_ = json.Unmarshal(resp.Result, &result)
+		result["codec"], result["cbor_typed_arrays"] = CodecCBOR, s.typedArrays
+		resp.Result, _ = json.Marshal(result)
+	case MethodEmbed:
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		if params.Inputs[0] == "missing" {
+			answer = &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeModelNotFound, Message: "no such model"}}
+			break
+		}
+		var result embedResult
+		_ = json.Unmarshal(resp.Result, &result)
+		answer = map[string]any{"jsonrpc": resp.JSONRPC, "id": resp.ID, "result": result}
+		if codec == CBORCodec && s.typedArrays {
+			codec = CBORTypedArrayCodec
+		}
+	}
+	raw, err := codec.Marshal(answer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	_, _ = w.Write(raw)
+}
+
+func TestCBORNegotiation(t *testing.T) {
+	for _, typedArrays := range []bool{false, true} {
+		s := &cborServer{typedArrays: typedArrays}
+		srv := httptest.NewServer(s)
+		rec := &markingRecorder{}
+		var stdout strings.Builder
+		err := RunEmbed(context.Background(), Options{
+			Config:             ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Codecs: []string{CodecCBOR}},
+			TranscriptRecorder: rec,
+			Inputs:             []string{"a", "bb"},
+			Stdout:             &stdout,
+		})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("RunEmbed: %v", err)
+		}
+		if got := string(s.params["codecs"]) + string(s.params["cbor_typed_arrays"]); got != `["cbor","json"]true` {
+			t.Fatalf("offered %s", got)
+		}
+		if n := len(s.contentTypes); n < 2 || s.contentTypes[0] != "application/json" || s.contentTypes[n-1] != "application/cbor" {
+			t.Fatalf("content types %v", s.contentTypes)
+		}
+		if !strings.Contains(stdout.String(), "[2,0.5,-0.5]") {
+			t.Fatalf("output %s", stdout.String())
+		}
+		if rec.markers.Codec != CodecCBOR {
+			t.Fatalf("markers %+v", rec.markers)
+		}
+		// The transcript holds the same JSON whichever way the vectors
+		// traveled.
+		last := rec.entries[len(rec.entries)-1].Message
+		var result struct {
+			Result embedResult `json:"result"`
+		}
+		if err := json.Unmarshal(last, &result); err != nil || len(result.Result.Embeddings) != 2 || result.Result.Embeddings[1].Vector[0] != 2 {
+			t.Fatalf("recorded response %s: %v", last, err)
+		}
+	}
+}
+
+func TestCBORSigning(t *testing.T) {
+	signing := SigningConfig{KeyID: "k", Secret: "s"}
+	s := &cborServer{signer: &signer{cfg: signing.withDefaults()}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithCodecs(CodecCBOR), WithSigning(signing))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil || c.Codec() != CodecCBOR {
+		t.Fatalf("Initialize: codec %s, %v", c.Codec(), err)
+	}
+	// Requests are signed over the CBOR sent, so the server verifies them.
+	if _, err := c.Embed(context.Background(), "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if s.signed != 2 || s.bodies[1][0]&0xe0 != cborMap {
+		t.Fatalf("%d signed requests, the last % x", s.signed, s.bodies[1])
+	}
+	// An error answered in CBOR maps to the error it names.
+	if _, err := c.Embed(context.Background(), "missing"); !errors.Is(err, ErrModelNotFound) {
+		t.Fatalf("Embed of a missing model: %v", err)
+	}
+	if err := (ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Codecs: []string{CodecCBOR, CodecMsgPack}, Signing: signing}).Validate(); err == nil {
+		t.Fatal("Validate accepted msgpack with signing")
+	}
+}
@@ -0,0 +1,370 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The kinds of ChaosFault.
+const (
+	// FaultLatency delays the request before it is sent.
+	FaultLatency = "latency"
+	// FaultError answers the request with an error of ChaosFault.Class in
+	// place of the server.
+	FaultError = "error"
+	// FaultDrop sends the request, so the server handles it, then loses the
+	// connection halfway through the answer.
+	FaultDrop = "drop"
+	// FaultDuplicate sends the request twice, as a network replaying it
+	// would, and answers with the first response, the second discarded as
+	// a late duplicate.
+	FaultDuplicate = "duplicate"
+)
+
+// The distributions of a FaultLatency delay.
+const (
+	// LatencyFixed waits ChaosFault.Latency, the default.
+	LatencyFixed = "fixed"
+	// LatencyUniform waits uniformly between Latency-Jitter and
+	// Latency+Jitter.
+	LatencyUniform = "uniform"
+	// LatencyNormal waits a normally distributed time of mean Latency and
+	// standard deviation Jitter.
+	LatencyNormal = "normal"
+	// LatencyExponential waits an exponentially distributed time of mean
+	// Latency, a long tail of slow requests.
+	LatencyExponential = "exponential"
+)
+
+// chaosKinds are the kinds of ChaosFault.
+var chaosKinds = []string{FaultLatency, FaultError, FaultDrop, FaultDuplicate}
+
+// chaosErrorClasses are the ErrorClass names a FaultError can inject, and
+// the JSON-RPC code of each answered as an error response; those coded 0
+// fail the request without a response.
+var chaosErrorClasses = map[string]int{
+	"api":               CodeInternalError,
+	"timeout":           CodeTimeout,
+	"unauthorized":      CodeUnauthorized,
+	"model_not_found":   CodeModelNotFound,
+	"payload_too_large": CodePayloadTooLarge,
+	"connection":        0,
+	"protocol":          0,
+}
+
+// ChaosFault is one fault of a ChaosConfig.
+type ChaosFault struct {
+	// Kind is FaultLatency, FaultError, FaultDrop, or FaultDuplicate.
+	Kind string `json:"kind"`
+	// Probability is the chance, from 0 to 1, that the fault hits a request
+	// it applies to.
+	Probability float64 `json:"probability"`
+	// Methods limits the fault to requests of these methods; empty applies
+	// it to all.
+	Methods []string `json:"methods,omitempty"`
+	// Latency and Jitter set the delay of a FaultLatency, drawn from
+	// Distribution: LatencyFixed, the default, LatencyUniform,
+	// LatencyNormal, or LatencyExponential. In JSON they are durations such
+	// as "50ms".
+	Latency      time.Duration `json:"-"`
+	Jitter       time.Duration `json:"-"`
+	Distribution string        `json:"distribution,omitempty"`
+	// Class is the ErrorClass of a FaultError: "api", the default, for an
+	// internal server error, "timeout", "unauthorized", "model_not_found",
+	// or "payload_too_large", answered as the JSON-RPC error response a
+	// server would send, or "connection" and "protocol", failing the
+	// request as a refused connection or an undecodable answer would.
+	Class string `json:"class,omitempty"`
+	// Retryable marks an injected error response retryable, as "api" and
+	// "timeout" are unless it says otherwise.
+	Retryable *bool `json:"retryable,omitempty"`
+}
+
+// chaosFaultJSON is ChaosFault as a chaos file spells it.
+type chaosFaultJSON struct {
+	Kind         string   `json:"kind"`
+	Probability  float64  `json:"probability"`
+	Methods      []string `json:"methods,omitempty"`
+	Latency      string   `json:"latency,omitempty"`
+	Jitter       string   `json:"jitter,omitempty"`
+	Distribution string   `json:"distribution,omitempty"`
+	Class        string   `json:"class,omitempty"`
+	Retryable    *bool    `json:"retryable,omitempty"`
+}
+
+func (f ChaosFault) MarshalJSON() ([]byte, error) {
+	w := chaosFaultJSON{Kind: f.Kind, Probability: f.Probability, Methods: f.Methods, Distribution: f.Distribution, Class: f.Class, Retryable: f.Retryable}
+	if f.Latency != 0 {
+		w.Latency = f.Latency.String()
+	}
+	if f.Jitter != 0 {
+		w.Jitter = f.Jitter.String()
+	}
+	return json.Marshal(w)
+}
+
+func (f *ChaosFault) UnmarshalJSON(data []byte) error {
+	var w chaosFaultJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return err
+	}
+	*f = ChaosFault{Kind: w.Kind, Probability: w.Probability, Methods: w.Methods, Distribution: w.Distribution, Class: w.Class, Retryable: w.Retryable}
+	for _, d := range []struct {
+		name string
+		text string
+		dst  *time.Duration
+	}{{"latency", w.Latency, &f.Latency}, {"jitter", w.Jitter, &f.Jitter}} {
+		if d.text == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.text)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+	return nil
+}
+
+func (f ChaosFault) validate() error {
+	switch {
+	case !slices.Contains(chaosKinds, f.Kind):
+		return fmt.Errorf("kind must be one of %v, got %q", chaosKinds, f.Kind)
+	case f.Probability < 0 || f.Probability > 1 || math.IsNaN(f.Probability):
+		return fmt.Errorf("probability must be between 0 and 1, got %v", f.Probability)
+	case f.Latency < 0 || f.Jitter < 0:
+		return errors.New("latency and jitter must not be negative")
+	case f.Kind == FaultLatency && f.Latency == 0:
+		return errors.New("a latency fault needs a latency")
+	case f.Kind != FaultLatency && (f.Latency != 0 || f.Jitter != 0 || f.Distribution != ""):
+		return fmt.Errorf("only a latency fault takes a latency, jitter, or distribution")
+	case f.Kind != FaultError && (f.Class != "" || f.Retryable != nil):
+		return fmt.Errorf("only an error fault takes a class or retryable")
+	}
+	switch f.Distribution {
+	case "", LatencyFixed, LatencyUniform, LatencyNormal, LatencyExponential:
+	default:
+		return fmt.Errorf("distribution must be %s, %s, %s, or %s, got %q", LatencyFixed, LatencyUniform, LatencyNormal, LatencyExponential, f.Distribution)
+	}
+	if f.Class != "" {
+		code, ok := chaosErrorClasses[f.Class]
+		if !ok {
+			return fmt.Errorf("unknown error class %q", f.Class)
+		}
+		if code == 0 && f.Retryable != nil {
+			return fmt.Errorf("error class %s fails without a response to mark retryable", f.Class)
+		}
+	}
+	return nil
+}
+
+// ChaosConfig configures a Chaos: the faults it injects, and the seed of
+// the random choices among them.
+type ChaosConfig struct {
+	// Seed seeds the random source, so a run repeating the requests of
+	// another, in the same order, meets the same faults. Zero picks a seed
+	// at random, which Chaos.Seed reports.
+	Seed int64 `json:"seed,omitempty"`
+	// Faults are tried in order on every request, each hitting it with its
+	// Probability. The delays of the latency faults that hit add up, and
+	// of the other faults that hit only the first takes effect.
+	Faults []ChaosFault `json:"faults"`
+}
+
+// Chaos injects faults into the requests it intercepts, to exercise a
+// client's retry, hedging, and circuit breaker settings without a
+// misbehaving server. Add its Intercept method with WithInterceptor, or
+// set Options.Chaos, which puts it below the retries, the breaker, and the
+// rest of the built-ins, so each attempt meets the faults anew, and above
+// the transcript recorder, which records what it injected as the
+// transport's doing. EmbedStream bypasses it.
+type Chaos struct {
+	faults []ChaosFault
+	seed   int64
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	injected map[string]int64
+}
+
+// NewChaos returns a Chaos injecting the faults of cfg.
+func NewChaos(cfg ChaosConfig) (*Chaos, error) {
+	for i, f := range cfg.Faults {
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("chaos fault %d: %w", i, err)
+		}
+	}
+	seed := cfg.Seed
+	for seed == 0 {
+		seed = rand.Int63()
+	}
+	return &Chaos{
+		faults:   slices.Clone(cfg.Faults),
+		seed:     seed,
+		rng:      rand.New(rand.NewSource(seed)),
+		injected: make(map[string]int64),
+	}, nil
+}
+
+// LoadChaos reads a ChaosConfig from the JSON file at path, such as
+//
+//	{"seed": 7, "faults": [
+//	  {"kind": "latency", "probability": 0.5, "latency": "40ms", "jitter": "10ms", "distribution": "normal"},
+//	  {"kind": "error", "probability": 0.1, "class": "timeout", "methods": ["mcp.embed"]},
+//	  {"kind": "drop", "probability": 0.05}
+//	]}
+//
+// and returns a Chaos injecting its faults.
+func LoadChaos(path string) (*Chaos, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("chaos: %w", err)
+	}
+	var cfg ChaosConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("chaos: %s: %w", path, err)
+	}
+	c, err := NewChaos(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("chaos: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Seed returns the seed of c's random source.
+func (c *Chaos) Seed() int64 { return c.seed }
+
+// Injected returns how many faults of each kind c has injected.
+func (c *Chaos) Injected() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int64, len(c.injected))
+	for k, n := range c.injected {
+		out[k] = n
+	}
+	return out
+}
+
+// roll decides the faults that hit a request of method: the total delay,
+// and the fault other than latency that takes effect, if any.
+func (c *Chaos) roll(method string) (delay time.Duration, hit *ChaosFault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.faults {
+		f := &c.faults[i]
+		if len(f.Methods) > 0 && !slices.Contains(f.Methods, method) {
+			continue
+		}
+		// Every fault that applies draws, hit or not, so one seed makes the
+		// same choices whatever the earlier ones were.
+		if c.rng.Float64() >= f.Probability {
+			continue
+		}
+		switch {
+		case f.Kind == FaultLatency:
+			delay += c.delay(f)
+		case hit != nil:
+			continue
+		default:
+			hit = f
+		}
+		c.injected[f.Kind]++
+	}
+	return delay, hit
+}
+
+// delay draws the delay of latency fault f.
+func (c *Chaos) delay(f *ChaosFault) time.Duration {
+	var d float64
+	switch f.Distribution {
+	case LatencyUniform:
+		d = float64(f.Latency-f.Jitter) + c.rng.Float64()*2*float64(f.Jitter)
+	case LatencyNormal:
+		d = float64(f.Latency) + c.rng.NormFloat64()*float64(f.Jitter)
+	case LatencyExponential:
+		d = c.rng.ExpFloat64() * float64(f.Latency)
+	default:
+		d = float64(f.Latency)
+	}
+	return time.Duration(max(d, 0))
+}
+
+// Intercept is the Interceptor injecting c's faults.
+func (c *Chaos) Intercept(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	delay, f := c.roll(req.Method)
+	if sample, _ := ctx.Value(benchmarkSampleKey{}).(*benchmarkSample); sample != nil {
+		if delay > 0 {
+			sample.fault(FaultLatency)
+		}
+		if f != nil {
+			sample.fault(f.Kind)
+		}
+	}
+	if delay > 0 {
+		if !sleepUntil(ctx, time.Now().Add(delay)) {
+			return nil, ctx.Err()
+		}
+	}
+	if f == nil {
+		return next(ctx, req)
+	}
+	switch f.Kind {
+	case FaultError:
+		return chaosError(req, f)
+	case FaultDrop:
+		resp, err := next(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		var n int64
+		if body, merr := json.Marshal(resp); merr == nil {
+			n = int64(len(body) / 2)
+		}
+		return nil, readFailure(&classError{msg: "chaos: connection dropped mid-response", class: ErrConnectionLost}, n)
+	default:
+		resp, err := next(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		dup := *req
+		next(ctx, &dup)
+		return resp, nil
+	}
+}
+
+// chaosError fails req with error fault f.
+func chaosError(req *Request, f *ChaosFault) (*Response, error) {
+	class := f.Class
+	if class == "" {
+		class = "api"
+	}
+	switch class {
+	case "connection":
+		return nil, &classError{msg: "chaos: connection refused", class: ErrConnectionLost}
+	case "protocol":
+		return nil, fmt.Errorf("chaos: %w: undecodable response", ErrProtocol)
+	}
+	retryable := class == "api" || class == "timeout"
+	if f.Retryable != nil {
+		retryable = *f.Retryable
+	}
+	data, _ := json.Marshal(map[string]bool{"retryable": retryable})
+	return &Response{
+		JSONRPC: JSONRPCVersion,
+		ID:      req.ID,
+		Error:   &RPCError{Code: chaosErrorClasses[class], Message: "chaos: injected " + class + " error", Data: data},
+	}, nil
+}
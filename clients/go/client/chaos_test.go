@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chaosClient returns a client over an in-process server with chaos below
+// its retries, and the count of embeds the server handled.
+func chaosClient(t *testing.T, chaos *Chaos, retries int) (*Client, *atomic.Int64) {
+	t.Helper()
+	var embeds atomic.Int64
+	handler := func(req Request) (Response, error) {
+		if req.Method == MethodEmbed {
+			embeds.Add(1)
+		}
+		return *defaultHandler(&req), nil
+	}
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: handler, Retry: RetryPolicy{MaxAttempts: retries, BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}}),
+		WithInterceptor(chaos.Intercept))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, &embeds
+}
+
+func newChaos(t *testing.T, faults ...ChaosFault) *Chaos {
+	t.Helper()
+	chaos, err := NewChaos(ChaosConfig{Seed: 1, Faults: faults})
+	if err != nil {
+		t.Fatalf("NewChaos: %v", err)
+	}
+	return chaos
+}
+
+func TestChaosFaults(t *testing.T) {
+	retryable := false
+	cases := map[string]struct {
+		fault     ChaosFault
+		class     string
+		retryable bool
+		embeds    int64
+	}{
+		"api error":       {ChaosFault{Kind: FaultError}, "api", true, 0},
+		"timeout":         {ChaosFault{Kind: FaultError, Class: "timeout"}, "timeout", true, 0},
+		"final timeout":   {ChaosFault{Kind: FaultError, Class: "timeout", Retryable: &retryable}, "timeout", false, 0},
+		"model not found": {ChaosFault{Kind: FaultError, Class: "model_not_found"}, "model_not_found", false, 0},
+		"refused":         {ChaosFault{Kind: FaultError, Class: "connection"}, "connection", false, 0},
+		"protocol":        {ChaosFault{Kind: FaultError, Class: "protocol"}, "protocol", false, 0},
+		"drop":            {ChaosFault{Kind: FaultDrop}, "connection", false, 1},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.fault.Probability = 1
+			chaos := newChaos(t, tc.fault)
+			c, embeds := chaosClient(t, chaos, 1)
+			_, err := c.Embed(context.Background(), "abc")
+			if got := ErrorClass(err); got != tc.class {
+				t.Fatalf("Embed: %v, class %q, want %q", err, got, tc.class)
+			}
+			if isRetryableStatus(err) != tc.retryable {
+				t.Fatalf("Embed: %v, retryable %v", err, !tc.retryable)
+			}
+			if n := embeds.Load(); n != tc.embeds {
+				t.Fatalf("server handled %d embeds, want %d", n, tc.embeds)
+			}
+			if tc.fault.Kind == FaultDrop && BytesRead(err) == 0 {
+				t.Fatalf("a dropped answer read no bytes: %v", err)
+			}
+			if got := chaos.Injected(); got[tc.fault.Kind] != 1 || len(got) != 1 {
+				t.Fatalf("Injected = %v", got)
+			}
+		})
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		c, embeds := chaosClient(t, newChaos(t, ChaosFault{Kind: FaultDuplicate, Probability: 1}), 1)
+		if _, err := c.Embed(context.Background(), "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if n := embeds.Load(); n != 2 {
+			t.Fatalf("server handled %d embeds, want 2", n)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		c, _ := chaosClient(t, newChaos(t, ChaosFault{Kind: FaultLatency, Probability: 1, Latency: 30 * time.Millisecond}), 1)
+		start := time.Now()
+		if _, err := c.Embed(context.Background(), "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+			t.Fatalf("Embed took %v", elapsed)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		if _, err := c.Embed(ctx, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Embed past its deadline: %v", err)
+		}
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		chaos := newChaos(t, ChaosFault{Kind: FaultError, Probability: 1, Methods: []string{MethodPing}})
+		c, _ := chaosClient(t, chaos, 1)
+		if _, err := c.Embed(context.Background(), "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if err := c.Call(context.Background(), MethodPing, nil, nil); ErrorClass(err) != "api" {
+			t.Fatalf("ping: %v", err)
+		}
+	})
+}
+
+func TestChaosBelowRetries(t *testing.T) {
+	// Half the attempts fail, and the retries see each of them through.
+	faults := []ChaosFault{{Kind: FaultError, Probability: 0.5}, {Kind: FaultDrop, Probability: 0.2}}
+	chaos := newChaos(t, faults...)
+	c, embeds := chaosClient(t, chaos, 20)
+	for i := 0; i < 20; i++ {
+		if _, err := c.Embed(context.Background(), "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	injected := chaos.Injected()
+	if injected[FaultError] == 0 || injected[FaultDrop] == 0 {
+		t.Fatalf("Injected = %v", injected)
+	}
+	if n := embeds.Load(); n != 20+injected[FaultDrop] {
+		t.Fatalf("server handled %d embeds, want 20 and %d dropped", n, injected[FaultDrop])
+	}
+
+	// The same seed makes the same choices.
+	again := newChaos(t, faults...)
+	c, _ = chaosClient(t, again, 20)
+	for i := 0; i < 20; i++ {
+		if _, err := c.Embed(context.Background(), "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	if got := again.Injected(); got[FaultError] != injected[FaultError] || got[FaultDrop] != injected[FaultDrop] {
+		t.Fatalf("seed 1 injected %v, then %v", injected, got)
+	}
+}
+
+func TestLoadChaos(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "chaos.json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	chaos, err := LoadChaos(write(`{"seed": 7, "faults": [
+		{"kind": "latency", "probability": 0.5, "latency": "40ms", "jitter": "10ms", "distribution": "normal"},
+		{"kind": "error", "probability": 0.1, "class": "timeout", "methods": ["mcp.embed"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("LoadChaos: %v", err)
+	}
+	if chaos.Seed() != 7 || len(chaos.faults) != 2 || chaos.faults[0].Latency != 40*time.Millisecond || chaos.faults[0].Jitter != 10*time.Millisecond || chaos.faults[1].Class != "timeout" {
+		t.Fatalf("loaded %d %+v", chaos.Seed(), chaos.faults)
+	}
+	data, err := json.Marshal(chaos.faults[0])
+	if err != nil || !strings.Contains(string(data), `"latency":"40ms"`) {
+		t.Fatalf("marshaled %s, %v", data, err)
+	}
+	if seeded, _ := NewChaos(ChaosConfig{}); seeded.Seed() == 0 {
+		t.Fatal("no seed picked")
+	}
+
+	for _, body := range []string{
+		`{"faults": [{"kind": "flood", "probability": 1}]}`,
+		`{"faults": [{"kind": "error", "probability": 1.5}]}`,
+		`{"faults": [{"kind": "latency", "probability": 1}]}`,
+		`{"faults": [{"kind": "latency", "probability": 1, "latency": "soon"}]}`,
+		`{"faults": [{"kind": "latency", "probability": 1, "latency": "1s", "distribution": "zipf"}]}`,
+		`{"faults": [{"kind": "drop", "probability": 1, "class": "timeout"}]}`,
+		`{"faults": [{"kind": "error", "probability": 1, "class": "gone"}]}`,
+		`{"faults": [{"kind": "error", "probability": 1, "class": "connection", "retryable": true}]}`,
+		`{"faults": [{"kind": "error", "probability": 1, "typo": 1}]}`,
+		`{"fault": []}`,
+	} {
+		if _, err := LoadChaos(write(body)); err == nil {
+			t.Errorf("LoadChaos accepted %s", body)
+		}
+	}
+}
+
+func TestRunBenchmarkChaos(t *testing.T) {
+	chaos := newChaos(t, ChaosFault{Kind: FaultLatency, Probability: 1, Latency: time.Millisecond, Distribution: LatencyExponential}, ChaosFault{Kind: FaultError, Probability: 0.3, Methods: []string{MethodEmbed}})
+	var out strings.Builder
+	err := RunBenchmark(context.Background(), Options{
+		Config:    ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) { return *defaultHandler(&req), nil }},
+		Inputs:    []string{"alpha"},
+		Benchmark: Benchmark{Duration: 100 * time.Millisecond},
+		Stdout:    &out,
+		Chaos:     chaos,
+	})
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	var r BenchmarkReport
+	if err := json.Unmarshal([]byte(out.String()), &r); err != nil {
+		t.Fatalf("report %q: %v", out.String(), err)
+	}
+	if r.Requests == 0 || r.FaultsInjected[FaultLatency] != r.Requests || r.FaultsInjected[FaultError] != r.Errors || r.ErrorsByClass["api"] != r.Errors || r.Errors == 0 {
+		t.Fatalf("report %+v", r)
+	}
+}
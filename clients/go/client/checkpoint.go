@@ -0,0 +1,356 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// DefaultCheckpointInterval is how many inputs EmbedBatchWithCheckpoint
+// embeds between checkpoints.
+const DefaultCheckpointInterval = 1024
+
+// ErrCheckpointMismatch reports a checkpoint saved for other inputs, or
+// another model, than those EmbedBatchWithCheckpoint was called with.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match the call")
+
+// BatchCheckpoint is the progress of an EmbedBatchWithCheckpoint call, as
+// its CheckpointStore persists it.
+type BatchCheckpoint struct {
+	// InputHash is the InputsHash of the call's inputs, and Inputs their
+	// number; a call with other inputs fails with ErrCheckpointMismatch.
+	InputHash string `json:"input_hash"`
+	Inputs    int    `json:"inputs"`
+	// Model is the model the vectors were embedded with.
+	Model string `json:"model,omitempty"`
+	// Chunks are the runs of inputs embedded so far, in the order they
+	// completed.
+	Chunks []CheckpointChunk `json:"chunks"`
+}
+
+// CheckpointChunk is a run of inputs whose vectors a CheckpointStore
+// holds.
+type CheckpointChunk struct {
+	// Start and End delimit the inputs as a half-open range.
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Location is where WriteVectors put the vectors.
+	Location string `json:"location"`
+}
+
+// completed marks the inputs cp's chunks hold.
+func (cp *BatchCheckpoint) completed() []bool {
+	done := make([]bool, cp.Inputs)
+	for _, ch := range cp.Chunks {
+		for i := ch.Start; i < ch.End; i++ {
+			done[i] = true
+		}
+	}
+	return done
+}
+
+// CheckpointStore persists the progress of EmbedBatchWithCheckpoint, so a
+// call made again after a crash or a failure embeds only what the last
+// one did not. NewFileCheckpointStore keeps it in a directory.
+type CheckpointStore interface {
+	// Load returns the checkpoint saved last, or nil when there is none.
+	Load(ctx context.Context) (*BatchCheckpoint, error)
+	// Save replaces the checkpoint atomically: a Load after a crash
+	// returns this checkpoint or the one before it, never a mix.
+	Save(ctx context.Context, cp *BatchCheckpoint) error
+	// WriteVectors stores the vectors of the inputs from start on, before
+	// the checkpoint naming them is saved, and returns their location.
+	WriteVectors(ctx context.Context, start int, vectors [][]float32) (string, error)
+	// ReadVectors returns the vectors stored at location.
+	ReadVectors(ctx context.Context, location string) ([][]float32, error)
+}
+
+// InputsHash returns the hash a BatchCheckpoint keeps of inputs: the
+// SHA-256, in hex, of each input's length as a uvarint followed by its
+// bytes, so neither a changed input nor a moved boundary between two goes
+// unnoticed.
+func InputsHash(inputs []string) string {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	for _, s := range inputs {
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EmbedBatchWithCheckpoint is EmbedBatch for long batches a service must
+// be able to resume: every DefaultCheckpointInterval inputs it stores the
+// vectors embedded so far in store and saves a checkpoint of them, and
+// called again with the same inputs it skips those and stitches the
+// stored vectors into the result. A checkpoint saved for other inputs or
+// another model fails the call with ErrCheckpointMismatch rather than
+// misalign the vectors.
+//
+// The chunks of each interval that succeed are stored even when others
+// fail, so a resumed call retries only those. By default the call stops
+// at the first interval with a failure; with WithPartialResults it goes
+// on, returning every vector it has, nil for the inputs that failed,
+// alongside the error. WithProgress counts the inputs of the whole call,
+// the resumed ones included. The checkpoint stays in store when the call
+// completes, so calling again returns the same vectors without embedding.
+func (c *Client) EmbedBatchWithCheckpoint(ctx context.Context, inputs []string, store CheckpointStore, opts ...EmbedOption) ([][]float32, error) {
+	var o embedOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	model := o.model
+	if model == "" {
+		model = c.cfg.Model
+	}
+	hash := InputsHash(inputs)
+	cp, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+	switch {
+	case cp == nil:
+		cp = &BatchCheckpoint{InputHash: hash, Inputs: len(inputs), Model: model}
+	case cp.InputHash != hash || cp.Inputs != len(inputs):
+		return nil, fmt.Errorf("%w: saved for %d inputs hashing %.12s, called with %d hashing %.12s", ErrCheckpointMismatch, cp.Inputs, cp.InputHash, len(inputs), hash)
+	case cp.Model != model:
+		return nil, fmt.Errorf("%w: saved for model %q, called with %q", ErrCheckpointMismatch, cp.Model, model)
+	}
+	for _, ch := range cp.Chunks {
+		if ch.Start < 0 || ch.End > len(inputs) || ch.Start >= ch.End {
+			return nil, fmt.Errorf("checkpoint: chunk %d-%d out of range for %d inputs", ch.Start, ch.End, len(inputs))
+		}
+	}
+
+	done := cp.completed()
+	embedded := 0
+	for _, d := range done {
+		if d {
+			embedded++
+		}
+	}
+	var pending []int
+	for i, d := range done {
+		if !d {
+			pending = append(pending, i)
+		}
+	}
+	var errs []error
+	for len(pending) > 0 && ctx.Err() == nil {
+		window := pending[:min(len(pending), DefaultCheckpointInterval)]
+		pending = pending[len(window):]
+		texts := make([]string, len(window))
+		for i, idx := range window {
+			texts[i] = inputs[idx]
+		}
+		callOpts := append(slices.Clone(opts), WithPartialResults())
+		if o.progress != nil {
+			base := embedded
+			callOpts = append(callOpts, WithProgress(func(n, _ int) { o.progress(base+n, len(inputs)) }))
+		}
+		vectors, err := c.EmbedBatch(ctx, texts, callOpts...)
+		if vectors != nil {
+			n, serr := storeRuns(ctx, store, cp, window, vectors)
+			embedded += n
+			if serr != nil {
+				return nil, serr
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if !o.partial {
+				break
+			}
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err == nil && len(pending) > 0 {
+		err = ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("embed batch with checkpoint: %d of %d inputs embedded: %w", embedded, len(inputs), err)
+		if !o.partial {
+			return nil, err
+		}
+	}
+	result, rerr := readCheckpointVectors(ctx, store, cp)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return result, err
+}
+
+// storeRuns stores the vectors of the inputs at the indexes of window
+// that vectors holds, a run of consecutive inputs at a time, and saves cp
+// naming them, returning how many it stored.
+func storeRuns(ctx context.Context, store CheckpointStore, cp *BatchCheckpoint, window []int, vectors [][]float32) (int, error) {
+	stored := 0
+	for i := 0; i < len(window); {
+		if vectors[i] == nil {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(window) && vectors[j] != nil && window[j] == window[j-1]+1 {
+			j++
+		}
+		location, err := store.WriteVectors(ctx, window[i], vectors[i:j])
+		if err != nil {
+			return stored, fmt.Errorf("store vectors %d-%d: %w", window[i], window[j-1], err)
+		}
+		cp.Chunks = append(cp.Chunks, CheckpointChunk{Start: window[i], End: window[j-1] + 1, Location: location})
+		stored += j - i
+		i = j
+	}
+	if stored == 0 {
+		return 0, nil
+	}
+	if err := store.Save(ctx, cp); err != nil {
+		return stored, fmt.Errorf("save checkpoint: %w", err)
+	}
+	return stored, nil
+}
+
+// readCheckpointVectors stitches the vectors cp's chunks name into one
+// slice in input order, nil for the inputs no chunk holds.
+func readCheckpointVectors(ctx context.Context, store CheckpointStore, cp *BatchCheckpoint) ([][]float32, error) {
+	result := make([][]float32, cp.Inputs)
+	for _, ch := range cp.Chunks {
+		vectors, err := store.ReadVectors(ctx, ch.Location)
+		if err != nil {
+			return nil, fmt.Errorf("read vectors %d-%d: %w", ch.Start, ch.End-1, err)
+		}
+		if len(vectors) != ch.End-ch.Start {
+			return nil, fmt.Errorf("read vectors %d-%d: %d stored at %s", ch.Start, ch.End-1, len(vectors), ch.Location)
+		}
+		copy(result[ch.Start:ch.End], vectors)
+	}
+	return result, nil
+}
+
+// FileCheckpointStore is a CheckpointStore keeping the checkpoint of one
+// call in a directory: the checkpoint in checkpoint.json, and the vectors
+// of each run of inputs in a file of its own, as the NDJSON records of
+// RunEmbed. Every file is written to a temporary name, synced, and
+// renamed into place.
+type FileCheckpointStore struct {
+	dir string
+}
+
+// checkpointFile is the name of the checkpoint of a FileCheckpointStore.
+const checkpointFile = "checkpoint.json"
+
+// NewFileCheckpointStore returns a FileCheckpointStore in dir, creating
+// the directory when it does not exist.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("checkpoint store: %w", err)
+	}
+	return &FileCheckpointStore{dir: dir}, nil
+}
+
+func (s *FileCheckpointStore) Load(context.Context) (*BatchCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, checkpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp BatchCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", filepath.Join(s.dir, checkpointFile), err)
+	}
+	return &cp, nil
+}
+
+func (s *FileCheckpointStore) Save(_ context.Context, cp *BatchCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, checkpointFile), append(data, '\n'))
+}
+
+func (s *FileCheckpointStore) WriteVectors(_ context.Context, start int, vectors [][]float32) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, v := range vectors {
+		if err := enc.Encode(embedLine{Index: int64(start + i), Vector: v}); err != nil {
+			return "", err
+		}
+	}
+	name := fmt.Sprintf("vectors-%d-%d.ndjson", start, start+len(vectors))
+	return name, writeFileAtomic(filepath.Join(s.dir, name), buf.Bytes())
+}
+
+func (s *FileCheckpointStore) ReadVectors(_ context.Context, location string) ([][]float32, error) {
+	if location != filepath.Base(location) {
+		return nil, fmt.Errorf("vector location %q is outside the store", location)
+	}
+	f, err := os.Open(filepath.Join(s.dir, location))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []embedLine
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var rec embedLine
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Index < records[j].Index })
+	vectors := make([][]float32, len(records))
+	for i, rec := range records {
+		vectors[i] = rec.Vector
+	}
+	return vectors, nil
+}
+
+// Remove deletes the checkpoint and the vectors it names, for a
+// completed call whose results the caller has kept.
+func (s *FileCheckpointStore) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// writeFileAtomic replaces the file at path with data, syncing it before
+// renaming it into place, so a crash leaves the old file or the new one.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, werr := tmp.Write(data)
+	if werr == nil {
+		werr = tmp.Sync()
+	}
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Rename(tmp.Name(), path)
+	}
+	if werr != nil {
+		os.Remove(tmp.Name())
+	}
+	return werr
+}
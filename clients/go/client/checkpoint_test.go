@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEmbedBatchWithCheckpoint(t *testing.T) {
+	var failing atomic.Bool
+	var embedded atomic.Int64
+	// While failing, the server rejects every chunk holding a "bad" input.
+	handler := func(req Request) (Response, error) {
+		if req.Method == MethodEmbed {
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			if failing.Load() && strings.Contains(strings.Join(params.Inputs, " "), "bad") {
+				return Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32000, Message: "overloaded"}}, nil
+			}
+			embedded.Add(int64(len(params.Inputs)))
+		}
+		return *defaultHandler(&req), nil
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: handler})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "job")
+	store, err := NewFileCheckpointStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore: %v", err)
+	}
+
+	inputs := []string{"a", "bb", "bad", "cccc", "ddddd", "e"}
+	failing.Store(true)
+	vectors, err := c.EmbedBatchWithCheckpoint(ctx, inputs, store, WithBatchSize(2), WithPartialResults(), WithNoCache())
+	if err == nil || !strings.Contains(err.Error(), "4 of 6 inputs embedded") {
+		t.Fatalf("first call: %v", err)
+	}
+	// The chunk of "bad" failed, the others were stored.
+	if vectors[2] != nil || vectors[3] != nil || vectors[4] == nil || vectors[4][0] != 5 {
+		t.Fatalf("first call vectors %v", vectors)
+	}
+	cp, err := store.Load(ctx)
+	if err != nil || cp == nil || cp.InputHash != InputsHash(inputs) || len(cp.Chunks) != 2 {
+		t.Fatalf("checkpoint %+v, %v", cp, err)
+	}
+
+	// The resumed call embeds only the failed chunk.
+	failing.Store(false)
+	embedded.Store(0)
+	var progress [][2]int
+	vectors, err = c.EmbedBatchWithCheckpoint(ctx, inputs, store, WithBatchSize(2), WithNoCache(), WithProgress(func(done, total int) { progress = append(progress, [2]int{done, total}) }))
+	if err != nil {
+		t.Fatalf("resumed call: %v", err)
+	}
+	if embedded.Load() != 2 {
+		t.Fatalf("resumed call embedded %d inputs", embedded.Load())
+	}
+	for i, v := range vectors {
+		if v == nil || v[0] != float32(len(inputs[i])) {
+			t.Fatalf("vector %d = %v", i, v)
+		}
+	}
+	if len(progress) != 1 || progress[0] != [2]int{6, 6} {
+		t.Fatalf("progress %v", progress)
+	}
+
+	// A completed checkpoint answers again without embedding.
+	embedded.Store(0)
+	if again, err := c.EmbedBatchWithCheckpoint(ctx, inputs, store, WithNoCache()); err != nil || embedded.Load() != 0 || len(again) != len(inputs) || again[5][0] != 1 {
+		t.Fatalf("completed call: %v, %d embedded", err, embedded.Load())
+	}
+	// Stores leave no temporary files behind.
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Fatalf("left %s behind", e.Name())
+		}
+	}
+
+	// Other inputs, or another model, are not resumed.
+	moved := append([]string{"a", "bba", "d"}, inputs[3:]...)
+	if _, err := c.EmbedBatchWithCheckpoint(ctx, moved, store); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("changed inputs: %v", err)
+	}
+	if _, err := c.EmbedBatchWithCheckpoint(ctx, inputs, store, WithModel("other")); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("changed model: %v", err)
+	}
+
+	if err := store.Remove(); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("store directory after Remove: %v", err)
+	}
+}
+
+func TestEmbedBatchWithCheckpointStopsWithoutPartialResults(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		if req.Method == MethodEmbed && strings.Contains(string(req.Params), "bad") {
+			return Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32000, Message: "overloaded"}}, nil
+		}
+		return *defaultHandler(&req), nil
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	store, err := NewFileCheckpointStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore: %v", err)
+	}
+	vectors, err := c.EmbedBatchWithCheckpoint(context.Background(), []string{"a", "bad", "c"}, store, WithBatchSize(1))
+	var chunkErr *ChunkError
+	if vectors != nil || !errors.As(err, &chunkErr) {
+		t.Fatalf("EmbedBatchWithCheckpoint: %v, %v", vectors, err)
+	}
+	// The inputs that did embed are kept for the retry.
+	if cp, _ := store.Load(context.Background()); cp == nil || len(cp.completed()) != 3 || !cp.completed()[0] || cp.completed()[1] {
+		t.Fatalf("checkpoint %+v", cp)
+	}
+}
+
+func TestInputsHash(t *testing.T) {
+	if InputsHash([]string{"ab", "c"}) == InputsHash([]string{"a", "bc"}) {
+		t.Fatal("a moved boundary hashes alike")
+	}
+	if InputsHash(nil) != InputsHash([]string{}) || InputsHash([]string{""}) == InputsHash(nil) {
+		t.Fatal("empty input lists hash wrong")
+	}
+}
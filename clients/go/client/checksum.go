@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ErrChecksumMissing reports an embed response without the checksums
+// ClientConfig.RequireChecksums asks for. It matches ErrProtocol.
+var ErrChecksumMissing error = &classError{"response checksum missing", ErrProtocol}
+
+// VectorChecksum returns the checksum of vectors, hashed one after the
+// other: the XXH64, seed 0, of their components as little-endian IEEE 754
+// float32s, in 16 hex digits. Servers send that of each vector as the
+// checksum of its entry in the embed result or its stream frame, and that
+// of the whole batch, in index order, as the checksum of the result.
+func VectorChecksum(vectors ...[]float32) string {
+	return fmt.Sprintf("%016x", vectorSum(vectors))
+}
+
+// vectorSum is the XXH64 VectorChecksum formats.
+func vectorSum(vectors [][]float32) uint64 {
+	h := newXXHash64()
+	var buf [256]byte
+	for _, v := range vectors {
+		for len(v) > 0 {
+			n := min(len(v), len(buf)/4)
+			for i, f := range v[:n] {
+				binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+			}
+			h.Write(buf[:4*n])
+			v = v[n:]
+		}
+	}
+	return h.Sum64()
+}
+
+// checksumMatches reports whether sum, in either case, is the checksum of
+// vectors.
+func checksumMatches(sum string, vectors ...[]float32) bool {
+	want, err := strconv.ParseUint(sum, 16, 64)
+	return err == nil && len(sum) == 16 && want == vectorSum(vectors)
+}
+
+// ChecksumError is an embed response whose vectors do not match the
+// checksums the server sent with them, or, with
+// ClientConfig.RequireChecksums, that came without them. It matches
+// ErrChecksumMismatch or ErrChecksumMissing, and ErrProtocol.
+type ChecksumError struct {
+	// Method is the request answered, MethodEmbed or MethodEmbedStream.
+	Method string
+	// Indices are the inputs whose vectors fail their checksums or lack
+	// them, in order. A batch checksum that fails without a per-vector
+	// one failing to narrow it down names every input.
+	Indices []int
+	// Missing reports checksums required but absent.
+	Missing bool
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: %s: vectors %v", e.Method, e.Unwrap(), e.Indices)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	if e.Missing {
+		return ErrChecksumMissing
+	}
+	return ErrChecksumMismatch
+}
+
+// WithRequireChecksums fails every embed response without a checksum for
+// each of its vectors, per vector or for the batch, with a
+// *ChecksumError. Checksums a server sends are verified either way.
+func WithRequireChecksums() Option {
+	return func(o *clientOptions) error {
+		o.requireChecksums = true
+		return nil
+	}
+}
+
+// verifyChecksums checks the vectors of an mcp.embed result against the
+// checksums in it, the batch one over the vectors in index order, and with
+// require that every vector has one.
+func (r *embedResult) verifyChecksums(require bool) error {
+	var bad, missing []int
+	for _, e := range r.Embeddings {
+		switch {
+		case e.Checksum != "":
+			if !checksumMatches(e.Checksum, e.Vector) {
+				bad = append(bad, e.Index)
+			}
+		case r.Checksum == "":
+			missing = append(missing, e.Index)
+		}
+	}
+	if len(bad) == 0 && r.Checksum != "" {
+		ordered := append([]embeddingEntry(nil), r.Embeddings...)
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Index < ordered[j].Index })
+		vectors := make([][]float32, len(ordered))
+		for i, e := range ordered {
+			vectors[i] = e.Vector
+		}
+		if !checksumMatches(r.Checksum, vectors...) {
+			for _, e := range ordered {
+				bad = append(bad, e.Index)
+			}
+		}
+	}
+	switch {
+	case len(bad) > 0:
+		sort.Ints(bad)
+		return &ChecksumError{Method: MethodEmbed, Indices: bad}
+	case len(missing) > 0 && require:
+		sort.Ints(missing)
+		return &ChecksumError{Method: MethodEmbed, Indices: missing, Missing: true}
+	}
+	return nil
+}
+
+// verifyChecksum checks the vector of an mcp.embed.stream frame against
+// its checksum, and with require that it has one. Frames without a vector
+// have nothing to check.
+func (f *embedFrame) verifyChecksum(require bool) error {
+	switch {
+	case f.Done || f.Error != nil:
+	case f.Checksum != "":
+		if !checksumMatches(f.Checksum, f.Vector) {
+			return &ChecksumError{Method: MethodEmbedStream, Indices: []int{f.Index}}
+		}
+	case require:
+		return &ChecksumError{Method: MethodEmbedStream, Indices: []int{f.Index}, Missing: true}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		h := newXXHash64()
+		h.Write([]byte(tc.in))
+		if got := h.Sum64(); got != tc.want {
+			t.Errorf("XXH64(%q) = %016x, want %016x", tc.in, got, tc.want)
+		}
+		// Written a byte at a time, across the stripes.
+		h = newXXHash64()
+		for i := range tc.in {
+			h.Write([]byte(tc.in[i : i+1]))
+		}
+		if got := h.Sum64(); got != tc.want {
+			t.Errorf("XXH64(%q) bytewise = %016x, want %016x", tc.in, got, tc.want)
+		}
+	}
+	long := make([]float32, 1000)
+	for i := range long {
+		long[i] = float32(i) / 7
+	}
+	if VectorChecksum(long) != VectorChecksum(long[:333], long[333:]) {
+		t.Fatal("the checksum of a vector depends on how it is split")
+	}
+}
+
+// checksumHandler answers as defaultHandler does with every vector's
+// checksum and the batch's, then applies tamper to the result.
+func checksumHandler(tamper func(*embedResult)) fakeHandler {
+	return func(req *Request) *Response {
+		resp := defaultHandler(req)
+		if req.Method != MethodEmbed {
+			return resp
+		}
+		var result embedResult
+		_ = json.Unmarshal(resp.Result, &result)
+		vectors := make([][]float32, len(result.Embeddings))
+		for i, e := range result.Embeddings {
+			result.Embeddings[i].Checksum = VectorChecksum(e.Vector)
+			vectors[i] = e.Vector
+		}
+		result.Checksum = VectorChecksum(vectors...)
+		result.EncodingFormat = ""
+		tamper(&result)
+		resp.Result, _ = json.Marshal(result)
+		return resp
+	}
+}
+
+func TestEmbedChecksums(t *testing.T) {
+	texts := []string{"a", "bb", "ccc"}
+	embed := func(t *testing.T, tamper func(*embedResult), require bool) ([][]float32, error) {
+		t.Helper()
+		c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(checksumHandler(tamper)), RequireChecksums: require})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		defer c.Close(context.Background())
+		return c.EmbedBatch(context.Background(), texts)
+	}
+	checksumErr := func(t *testing.T, err error, sentinel error) *ChecksumError {
+		t.Helper()
+		var ce *ChecksumError
+		if !errors.Is(err, sentinel) || !errors.Is(err, ErrProtocol) || !errors.As(err, &ce) {
+			t.Fatalf("error %v, want %v", err, sentinel)
+		}
+		return ce
+	}
+
+	if vectors, err := embed(t, func(*embedResult) {}, true); err != nil || len(vectors) != len(texts) {
+		t.Fatalf("EmbedBatch: %v, %v", vectors, err)
+	}
+
+	// A component changed on the way fails the vector's checksum, and the
+	// batch one is not needed to name it.
+	_, err := embed(t, func(r *embedResult) { r.Embeddings[1].Vector[2] = -0.25 }, false)
+	if ce := checksumErr(t, err, ErrChecksumMismatch); fmt.Sprint(ce.Indices) != "[1]" || ce.Method != MethodEmbed {
+		t.Fatalf("error %+v", ce)
+	}
+	if !strings.Contains(err.Error(), "vectors [1]") {
+		t.Fatalf("error %q does not name the vector", err)
+	}
+
+	// With only the batch checksum, every vector is suspect.
+	_, err = embed(t, func(r *embedResult) {
+		for i := range r.Embeddings {
+			r.Embeddings[i].Checksum = ""
+		}
+		r.Embeddings[2].Vector[0] = 9
+	}, false)
+	if ce := checksumErr(t, err, ErrChecksumMismatch); fmt.Sprint(ce.Indices) != "[0 1 2]" {
+		t.Fatalf("error %+v", ce)
+	}
+
+	// A checksum that is not one fails as a mismatch.
+	_, err = embed(t, func(r *embedResult) { r.Embeddings[0].Checksum = "not-hex" }, false)
+	checksumErr(t, err, ErrChecksumMismatch)
+
+	// Without checksums the response passes unless they are required.
+	strip := func(r *embedResult) {
+		r.Checksum = ""
+		for i := range r.Embeddings[1:] {
+			r.Embeddings[i+1].Checksum = ""
+		}
+	}
+	if _, err := embed(t, strip, false); err != nil {
+		t.Fatalf("EmbedBatch without checksums: %v", err)
+	}
+	_, err = embed(t, strip, true)
+	if ce := checksumErr(t, err, ErrChecksumMissing); fmt.Sprint(ce.Indices) != "[1 2]" || !ce.Missing {
+		t.Fatalf("error %+v", ce)
+	}
+
+	c, err := NewClient("http://localhost:1", WithRequireChecksums())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if !c.cfg.RequireChecksums {
+		t.Fatal("WithRequireChecksums did not require checksums")
+	}
+}
+
+func TestEmbedStreamChecksums(t *testing.T) {
+	texts := []string{"a", "bb", "ccc"}
+	// Frames carry their vectors' checksums, except that of input 0; the
+	// vector of input 1 is changed after its checksum was taken.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		frames := streamFrames(&req, defaultHandler)
+		if req.Method != MethodEmbedStream {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(frames[0])
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		for _, resp := range frames {
+			var f embedFrame
+			_ = json.Unmarshal(resp.Result, &f)
+			if !f.Done {
+				if f.Index != 0 {
+					f.Checksum = VectorChecksum(f.Vector)
+				}
+				if f.Index == 1 {
+					f.Vector[1] = 0.75
+				}
+				resp.Result, _ = json.Marshal(f)
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		}
+	}))
+	defer srv.Close()
+
+	for _, require := range []bool{false, true} {
+		c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, RequireChecksums: require})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		ch, err := c.EmbedStream(context.Background(), texts)
+		if err != nil {
+			t.Fatalf("EmbedStream: %v", err)
+		}
+		byIndex := map[int]EmbedResult{}
+		for _, r := range collect(t, ch) {
+			byIndex[r.Index] = r
+		}
+		c.Close(context.Background())
+		// A vector failing its checksum fails its input alone.
+		if len(byIndex) != len(texts) || byIndex[2].Err != nil || !errors.Is(byIndex[1].Err, ErrChecksumMismatch) {
+			t.Fatalf("require %v: results %+v", require, byIndex)
+		}
+		if missing := errors.Is(byIndex[0].Err, ErrChecksumMissing); missing != require || !require && byIndex[0].Err != nil {
+			t.Fatalf("require %v: result 0: %v", require, byIndex[0].Err)
+		}
+	}
+}
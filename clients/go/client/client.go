@@ -0,0 +1,743 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/codec"
+)
+
+// Client identity advertised during the handshake.
+const (
+	ClientName    = "zaevrynth-go-client"
+	ClientVersion = "0.1.0"
+)
+
+// Method names understood by the MCP server.
+const (
+	MethodInitialize   = "mcp.initialize"
+	MethodPing         = "mcp.ping"
+	MethodCapabilities = "mcp.capabilities"
+	MethodEmbed        = "mcp.embed"
+	MethodEmbedStream  = "mcp.embed.stream"
+	MethodListModels   = "mcp.models.list"
+)
+
+// Client issues MCP calls over a single Transport.
+type Client struct {
+	cfg       ClientConfig
+	transport Transport
+	nextID    atomic.Int64
+	now       func() time.Time
+	// afterFunc runs f after d, returning the func that stops it; the
+	// latency budgets of WithBudget time their phases with it.
+	afterFunc func(d time.Duration, f func()) func() bool
+	// log is ClientConfig.Logger tagged with the transport, or a no-op.
+	log *slog.Logger
+	// limiter, when set, paces every request sent to the transport.
+	limiter *rateLimiter
+	// breaker, when set, fast-fails calls while the server is unreachable.
+	breaker *breaker
+	// hedger, when set, hedges slow replayable requests.
+	hedger *hedger
+	// cache, when set, serves repeated embeds without a round trip, and
+	// versions gives the model versions its keys carry.
+	cache    cacheStore
+	versions *modelVersions
+	// coalescer, when set, merges concurrent single-input embeds.
+	coalescer *coalescer
+	// flights, when set, shares a request between identical embeds.
+	flights *flightGroup
+	// tokens, when set, holds the token of ClientConfig.TokenSource.
+	tokens *tokenCache
+	// signer, when set, signs requests with ClientConfig.Signing.
+	signer *signer
+	// tracer, when set, traces requests for ClientConfig.TracerProvider.
+	tracer Tracer
+	// metrics counts requests for Stats and reports them to
+	// ClientConfig.Metrics.
+	metrics *clientMetrics
+	// events reports connections to Stats and, with the retries and
+	// breaker transitions, to ClientConfig.EventListener.
+	events *clientEvents
+	// notes delivers the notifications the server pushes.
+	notes *notificationQueue
+	// preprocess, when set, runs ClientConfig.Preprocess on the inputs.
+	preprocess *preprocessor
+	// onSlow, when set, reports calls exceeding ClientConfig.SlowRequests.
+	onSlow func(SlowRequestInfo)
+	// inFlight counts outstanding requests against ClientConfig.MaxInFlight.
+	inFlight *inFlight
+	// invoke sends Call requests through every interceptor; direct skips
+	// the retry, breaker, and rate limit ones.
+	invoke, direct Invoker
+	// routes maps the models given WithModelRoute to the clients of their
+	// endpoints. It is fixed once NewClient returns.
+	routes map[string]*Client
+	// gate admits calls until Close.
+	gate closeGate
+	// pipelined reports a transport sharing its stream between calls,
+	// which records their envelopes; see wireRecorder.
+	pipelined bool
+	// capabilities caches the model list; see ClientConfig.Capabilities.
+	capabilities capabilityCache
+	// spooler, when set, replays ClientConfig.Spool.
+	spooler *spoolReplayer
+
+	mu      sync.Mutex
+	session *Session
+	// batchSize caches the embed batch limit advertised by the server.
+	batchSize int
+	// countTokensUnsupported records that the server lacks
+	// MethodCountTokens.
+	countTokensUnsupported bool
+	// protocolVersion is the version negotiated by Initialize.
+	protocolVersion string
+	// codec is ClientConfig.Codec or the codec negotiated by Initialize;
+	// empty means CodecJSON.
+	codec string
+}
+
+// Session describes the server session established by Initialize.
+type Session struct {
+	ID            string `json:"id"`
+	Transport     string `json:"transport"`
+	ServerVersion string `json:"server_version"`
+	// SSEEndpoint is where an http server pushes events, and ALPN the
+	// protocol a tls connection negotiated, for servers that report them.
+	SSEEndpoint string `json:"sse_endpoint,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+}
+
+// PeerCertificate describes the peer certificate a tls server reports in
+// the handshake.
+type PeerCertificate struct {
+	Subject     string `json:"subject"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// InitializeResult is the server's reply to the handshake.
+type InitializeResult struct {
+	Session             Session `json:"session"`
+	HeartbeatIntervalMS int64   `json:"heartbeat_interval_ms"`
+	// ProtocolVersion is the server's pick from the offered versions;
+	// servers that predate negotiation leave it empty.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	// Codec is the server's pick from the offered codecs; servers that
+	// predate codecs leave it empty, for CodecJSON.
+	Codec string `json:"codec,omitempty"`
+	// CBORTypedArrays reports that the server decodes the RFC 8746 typed
+	// arrays the client offered to decode, so with CodecCBOR picked the
+	// client sends its float32 arrays as CBORTypedArrayCodec does.
+	CBORTypedArrays bool `json:"cbor_typed_arrays,omitempty"`
+	// PeerCertificate is the certificate of the tls session's peer, for
+	// servers that report it.
+	PeerCertificate *PeerCertificate `json:"peer_certificate,omitempty"`
+}
+
+// New builds a Client for cfg. No connection is made until the first call.
+func New(cfg ClientConfig) (*Client, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := cfg.withCredentials()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(cfg, transport), nil
+}
+
+// NewWithTransport builds a Client that issues its calls over transport, for
+// example one returned by NewConnTransport. cfg supplies the model and
+// recorder; its transport-selection fields are ignored.
+func NewWithTransport(cfg ClientConfig, transport Transport) *Client {
+	cfg.Transport = transport.Kind()
+	if loaded, err := cfg.withCredentials(); err != nil {
+		cfg.logger().Error("load credentials", "err", err)
+	} else {
+		cfg = loaded
+	}
+	return newClient(cfg.withDefaults(), transport)
+}
+
+func newClient(cfg ClientConfig, transport Transport) *Client {
+	c := &Client{cfg: cfg, transport: transport, now: time.Now, afterFunc: afterFunc, log: slog.New(requestIDHandler{cfg.logger().Handler()}), inFlight: newInFlight(cfg.MaxInFlight, cfg.Scheduling)}
+	if cfg.RateLimit.RPS > 0 {
+		c.limiter = newRateLimiter(cfg.RateLimit)
+	}
+	if cfg.CircuitBreaker.Threshold > 0 {
+		breakerCfg := cfg.CircuitBreaker
+		if onChange := breakerCfg.OnStateChange; cfg.Logger != nil || cfg.EventListener != nil {
+			breakerCfg.OnStateChange = func(ev CircuitEvent) {
+				c.log.Warn("circuit breaker state changed", "from", ev.From.String(), "to", ev.To.String(), "cause", ev.Cause)
+				c.events.circuit(ev)
+				if onChange != nil {
+					onChange(ev)
+				}
+			}
+		}
+		c.breaker = newBreaker(breakerCfg)
+	}
+	if cfg.Hedging.enabled() {
+		c.hedger = newHedger(cfg.Hedging)
+	}
+	if cfg.Cache.enabled() {
+		c.cache, c.versions = newCacheStore(cfg.Cache), newModelVersions(cfg.Cache)
+	}
+	if cfg.Coalescing.enabled() {
+		c.coalescer = newCoalescer(c, cfg.Coalescing)
+	}
+	if cfg.SingleFlight {
+		c.flights = newFlightGroup(c)
+	}
+	if cfg.TokenSource != nil {
+		c.tokens = newTokenCache(cfg.TokenSource)
+	}
+	if cfg.Signing.enabled() {
+		c.signer = &signer{cfg: cfg.Signing}
+	}
+	if cfg.TracerProvider != nil {
+		c.tracer = cfg.TracerProvider.Tracer(tracerName)
+	}
+	c.metrics = newClientMetrics(cfg.Metrics, c.transport.Kind())
+	if cfg.SlowRequests.enabled() {
+		c.onSlow = cfg.SlowRequests.slowReporter(c.log)
+	}
+	c.events = newClientEvents(cfg, c.metrics.stats, c.log)
+	c.inFlight.onHighWait = c.events.priorityWait
+	if p, err := newPreprocessor(cfg.Preprocess); err != nil {
+		c.log.Error("preprocessor", "err", err)
+	} else {
+		c.preprocess = p
+	}
+	c.notes = newNotificationQueue(cfg.Notifications, c.metrics.stats, cfg.Recorder)
+	if ot, ok := transport.(observedTransport); ok {
+		ev := c.events.transportEvents()
+		ev.notification = c.notes.push
+		ot.observe(ev)
+	}
+	if pt, ok := transport.(pipeliningTransport); ok {
+		c.pipelined = pt.pipelined()
+	}
+	if ct, ok := transport.(codecTransport); ok && cfg.Codec != "" && cfg.Codec != CodecJSON {
+		if chosen, ok := codec.Lookup(cfg.Codec); ok {
+			ct.setCodec(chosen)
+			c.codec = cfg.Codec
+		}
+	}
+	c.buildChains()
+	if cfg.Spool != nil {
+		c.startSpool()
+	}
+	return c
+}
+
+// Config returns the effective configuration, including defaults.
+func (c *Client) Config() ClientConfig { return c.cfg }
+
+// Call sends method with params and decodes the result into result, which may
+// be nil when the caller does not need the payload. Calls are paced by
+// ClientConfig.RateLimit, transient failures are retried according to
+// ClientConfig.Retry, and while ClientConfig.CircuitBreaker is open calls
+// fail with ErrCircuitOpen; see Interceptor for the full chain. Methods that
+// are not idempotent are sent with an idempotency key, reused by every
+// retry, which also makes them safe to retry.
+func (c *Client) Call(ctx context.Context, method string, params, result any, opts ...CallOption) error {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return c.send(ctx, c.invoke, method, params, result, o)
+}
+
+// exchange sends one request and decodes its response, bypassing the rate
+// limiter, retries, and circuit breaker.
+func (c *Client) exchange(ctx context.Context, method string, params, result any) error {
+	return c.send(ctx, c.direct, method, params, result, callOptions{})
+}
+
+// send builds the request for method, passes it to invoke, and decodes the
+// response into result.
+func (c *Client) send(ctx context.Context, invoke Invoker, method string, params, result any, o callOptions) error {
+	if err := c.gate.enter(ctx); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer c.gate.exit(ctx)
+	req, err := newRequest(c.nextID.Add(1), method, params, c.now())
+	if err != nil {
+		return err
+	}
+	req.bare = c.cfg.WireProtocol == JSONRPC2
+	ctx, req.Meta.RequestID = requestID(ctx, c.now())
+	req.Meta.IdempotencyKey = o.idempotencyKey
+	if req.Meta.IdempotencyKey == "" && !replayableMethods[method] {
+		req.Meta.IdempotencyKey = newIdempotencyKey()
+	}
+	if n, ok := ctx.Value(clientDimensionsKey{}).(int); ok {
+		req.Meta.ClientDimensions = n
+	}
+	ctx, budget := c.startBudget(ctx)
+	req.options, _ = ctx.Value(requestOptionsKey{}).(*RequestOptions)
+	if err := c.checkRequestSize(ctx, req); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if o.maxResponseBytes > 0 {
+		ctx = context.WithValue(ctx, maxResponseKey{}, o.maxResponseBytes)
+	}
+	var slow *slowWatch
+	if c.cfg.SlowRequests.Threshold > 0 {
+		slow = c.watchSlow(req, batchSize(params))
+		ctx = context.WithValue(ctx, slowWatchKey{}, slow)
+	}
+	resp, err := invoke(ctx, req)
+	if budget != nil {
+		err = budget.finish(err)
+	}
+	if slow != nil {
+		slow.check(c, c.cfg.SlowRequests.Threshold, false, callError(resp, err))
+	}
+	if o.serverRequestID != nil {
+		*o.serverRequestID = serverRequestID(resp)
+	}
+	if err := callError(resp, err); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			apiErr.RequestID = req.Meta.RequestID
+			if apiErr.ServerRequestID == "" {
+				apiErr.ServerRequestID = serverRequestID(resp)
+			}
+		}
+		return fmt.Errorf("%s: %w (request %s)", method, err, req.Meta.RequestID)
+	}
+	if resp == nil {
+		return fmt.Errorf("%s: no response: %w", method, ErrProtocol)
+	}
+	if c.cfg.DryRun {
+		if result == nil {
+			return nil
+		}
+		if err := dryRunResult(resp, result); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		return nil
+	}
+	if err := c.checkFields(method, "result", resp.Result); err != nil {
+		return err
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("%s: decode result: %w: %w", method, ErrProtocol, err)
+		}
+	}
+	return nil
+}
+
+// logExchange reports one request and its response, nil after a transport
+// failure, at debug level: the method, request ID, elapsed time, and size
+// of both envelopes, and the envelopes themselves with
+// ClientConfig.LogBodies.
+func (c *Client) logExchange(ctx context.Context, req *Request, resp *Response, start time.Time, err error) {
+	if !c.log.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{slog.String("method", req.Method), slog.Int64("rpc_id", req.ID), slog.Duration("elapsed", time.Since(start))}
+	sent, _ := json.Marshal(req.Wire())
+	attrs = append(attrs, slog.Int("request_bytes", len(sent)))
+	if meta, ok := redactAuthorization(req.Wire().Meta); ok {
+		logged := *req
+		logged.Meta = meta
+		sent, _ = json.Marshal(&logged)
+	}
+	var received []byte
+	if resp != nil {
+		received, _ = json.Marshal(resp)
+		attrs = append(attrs, slog.Int("response_bytes", len(received)))
+		if meta, ok := redactAuthorization(resp.Meta); ok {
+			logged := *resp
+			logged.Meta = meta
+			received, _ = json.Marshal(&logged)
+		}
+	}
+	if c.cfg.LogBodies {
+		attrs = append(attrs, slog.String("request_body", string(sent)))
+		if resp != nil {
+			attrs = append(attrs, slog.String("response_body", string(received)))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	c.log.LogAttrs(ctx, slog.LevelDebug, "mcp request", attrs...)
+}
+
+// Initialize performs the MCP handshake, negotiating the protocol version
+// and codec, and stores the resulting session. A server that shares no version with the
+// client fails it with an *IncompatibleProtocolError.
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+	params := map[string]any{
+		"transport": map[string]any{
+			"kind":     c.transport.Kind(),
+			"endpoint": c.endpointLabel(),
+		},
+		"client": map[string]any{
+			"name":       ClientName,
+			"language":   ClientMarker,
+			"version":    ClientVersion,
+			"user_agent": userAgent(),
+		},
+		"capabilities":      []string{"handshake", "ping", "capabilities"},
+		"protocol_versions": c.cfg.offeredProtocolVersions(),
+	}
+	offeredCodecs := c.offeredCodecs()
+	if offeredCodecs != nil {
+		params["codecs"] = offeredCodecs
+		for _, name := range offeredCodecs {
+			if name == CodecCBOR {
+				// CBORCodec decodes float32 typed arrays whatever it sends.
+				params["cbor_typed_arrays"] = true
+			}
+		}
+	}
+	var result InitializeResult
+	err := c.Call(ctx, MethodInitialize, params, &result)
+	if c.cfg.DryRun && errors.Is(err, ErrDryRun) {
+		// A dry run goes on with an empty session.
+		err = nil
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == CodeIncompatibleProtocol {
+			return nil, fmt.Errorf("%s: %w", MethodInitialize, incompatibleFromRPC(rpcErr, c.cfg.offeredProtocolVersions()))
+		}
+		return nil, err
+	}
+	version, err := c.cfg.negotiateProtocol(result.ProtocolVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodInitialize, err)
+	}
+	if err := c.useCodec(result.Codec, offeredCodecs, result.CBORTypedArrays); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodInitialize, err)
+	}
+	c.mu.Lock()
+	c.session = &result.Session
+	c.protocolVersion = version
+	c.mu.Unlock()
+	return &result, nil
+}
+
+// endpointLabel is the endpoint the handshake advertises, the transport's
+// own when it has several.
+func (c *Client) endpointLabel() string {
+	if l, ok := c.transport.(interface{ endpointLabel() string }); ok {
+		return l.endpointLabel()
+	}
+	return c.cfg.endpointLabel()
+}
+
+// SessionID returns the identifier assigned by Initialize, or "" before the
+// handshake has completed.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return ""
+	}
+	return c.session.ID
+}
+
+type embedParams struct {
+	Model  string   `json:"model"`
+	Inputs []string `json:"inputs"`
+	// Dimensions asks the server to truncate the vectors; see WithDimensions.
+	Dimensions int `json:"dimensions,omitempty"`
+	// EncodingFormat is the vector encoding the client accepts besides
+	// EncodingFloat.
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	// Resumable asks mcp.embed.stream for numbered frames and a resume
+	// token; see StreamResumePolicy.
+	Resumable bool `json:"resumable,omitempty"`
+}
+
+type embedResult struct {
+	Model string `json:"model"`
+	// ModelVersion is the exact version of Model that answered, for
+	// servers that report one.
+	ModelVersion string           `json:"model_version,omitempty"`
+	Embeddings   []embeddingEntry `json:"embeddings"`
+	// EncodingFormat names the encoding the server chose, so transcripts
+	// show it; empty means EncodingFloat.
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	// Usage is the token count of the request, when the server reports it.
+	Usage *Usage `json:"usage,omitempty"`
+	// Checksum is the VectorChecksum of the batch, for servers that send
+	// one.
+	Checksum string `json:"checksum,omitempty"`
+
+	// batch and dim, when known before decoding, size the vectors'
+	// allocation; see UnmarshalJSON. dest, when set, holds the vectors
+	// instead, for EmbedBatchInto.
+	batch, dim int
+	dest       *embedDest
+}
+
+type embeddingEntry struct {
+	Index  int        `json:"index"`
+	Vector vectorData `json:"vector"`
+	// Truncated reports that the server cut the input to the model's
+	// limit, for servers that say so.
+	Truncated bool `json:"truncated,omitempty"`
+	// Checksum is the VectorChecksum of Vector, for servers that send one.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Embed returns the embedding of text using the configured model. With
+// ClientConfig.Cache set, a cached embedding is returned without contacting
+// the server unless WithNoCache is passed.
+func (c *Client) Embed(ctx context.Context, text string, opts ...EmbedOption) ([]float32, error) {
+	if err := c.gate.check(ctx); err != nil {
+		return nil, err
+	}
+	o := embedOptions{model: c.cfg.Model}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if route, ok := c.routes[o.model]; ok {
+		return route.Embed(ctx, text, opts...)
+	}
+	if err := c.checkEmbed("Embed", &o); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbed, err)
+	}
+	if o.spool {
+		vectors, err := c.embedOrSpool(ctx, []string{text}, o, opts)
+		if err != nil {
+			return nil, err
+		}
+		return vectors[0], nil
+	}
+	var chunk []Chunk
+	if c.preprocess != nil {
+		var prepared string
+		if prepared, chunk = c.preprocess.apply(text); len(chunk) > 1 {
+			vecs, err := c.EmbedBatch(ctx, []string{text}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return vecs[0], nil
+		}
+		text = prepared
+	}
+	ctx, cancel := c.planCall(ctx, &o)
+	defer cancel()
+	ctx = o.tallyUsage(ctx)
+	if err := c.planDimensions(ctx, &o); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbed, err)
+	}
+	inputs, err := c.planTruncation(ctx, []string{text}, &o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbed, err)
+	}
+	vectors, err := c.embedInputs(ctx, inputs, o)
+	if err != nil {
+		return nil, err
+	}
+	o.reportInfo(inputs)
+	if o.info != nil && chunk != nil {
+		chunk[0].Vector = vectors[0]
+		o.info.Chunks = [][]Chunk{chunk}
+	}
+	return vectors[0], nil
+}
+
+// embedInputs returns the vectors of inputs in input order, truncated as
+// planned by planDimensions.
+func (c *Client) embedInputs(ctx context.Context, inputs []string, o embedOptions) ([][]float32, error) {
+	if !o.clientTruncate {
+		return c.lookupEmbeddings(ctx, inputs, o)
+	}
+	full, err := c.lookupEmbeddings(withoutDest(context.WithValue(ctx, clientDimensionsKey{}, o.dimensions)), inputs, o)
+	if err != nil {
+		return nil, err
+	}
+	return truncateVectors(full, o.dimensions)
+}
+
+// lookupEmbeddings serves what it can from the cache unless WithNoCache was
+// given, and fetches the rest, each distinct input once, in a single
+// request. Vectors the server truncated are cached apart from full ones.
+// With ClientConfig.SingleFlight a single input shares its request with
+// identical calls in flight.
+func (c *Client) lookupEmbeddings(ctx context.Context, inputs []string, o embedOptions) ([][]float32, error) {
+	dimensions := 0
+	if !o.clientTruncate {
+		dimensions = o.dimensions
+	}
+	if c.flights.shareable(ctx, inputs) {
+		return c.flights.lookup(withoutDest(ctx), inputs[0], o, dimensions)
+	}
+	if c.cache == nil || o.noCache {
+		return c.fetchEmbeddings(ctx, o.model, inputs, dimensions)
+	}
+	// The cache keeps the vectors it is given.
+	ctx = withoutDest(ctx)
+	version := c.versions.get(o.model)
+	model := cacheModel(o.model, dimensions, version)
+	vectors := make([][]float32, len(inputs))
+	var missing, missingKeys, served, servedKeys []string
+	// pending and hits map the keys of the inputs missing and served to
+	// the indices they fill.
+	pending, hits := make(map[string][]int), make(map[string][]int)
+	for i, in := range inputs {
+		key := c.cfg.Cache.key(model, in)
+		if idx, ok := pending[key]; ok {
+			pending[key] = append(idx, i)
+			continue
+		}
+		v, ok := c.cache.get(key)
+		c.metrics.cacheLookup(ok)
+		if ok {
+			vectors[i] = v
+			if _, ok := hits[key]; !ok {
+				served, servedKeys = append(served, in), append(servedKeys, key)
+			}
+			hits[key] = append(hits[key], i)
+			continue
+		}
+		pending[key] = []int{i}
+		missing, missingKeys = append(missing, in), append(missingKeys, key)
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+	fetched, err := c.fetchEmbeddings(ctx, o.model, missing, dimensions)
+	if err != nil {
+		return nil, err
+	}
+	fresh := c.versions.get(o.model)
+	if fresh != version && len(served) > 0 {
+		// The server answered with another version than the one the hits
+		// were cached under: they are fetched again rather than mixed in.
+		again, err := c.fetchEmbeddings(ctx, o.model, served, dimensions)
+		if err != nil {
+			return nil, err
+		}
+		for key, idx := range hits {
+			pending[key] = idx
+		}
+		missing, missingKeys, fetched = append(missing, served...), append(missingKeys, servedKeys...), append(fetched, again...)
+	}
+	for j, key := range missingKeys {
+		if fresh != version {
+			c.cache.put(c.cfg.Cache.key(cacheModel(o.model, dimensions, fresh), missing[j]), fetched[j])
+		} else {
+			c.cache.put(key, fetched[j])
+		}
+		for _, i := range pending[key] {
+			vectors[i] = fetched[j]
+		}
+	}
+	return vectors, nil
+}
+
+// cacheModel returns the model the vectors of model at version, truncated
+// by the server to dimensions, are cached under. A server reporting a new
+// version so leaves the vectors of the old one behind.
+func cacheModel(model string, dimensions int, version string) string {
+	if dimensions > 0 {
+		model = fmt.Sprintf("%s@%d", model, dimensions)
+	}
+	if version != "" {
+		model += "#" + version
+	}
+	return model
+}
+
+// cachedVersion reports whether entries cached under cached are of model,
+// and the version they are of.
+func cachedVersion(cached, model string) (string, bool) {
+	rest, ok := strings.CutPrefix(cached, model)
+	if !ok {
+		return "", false
+	}
+	if dims, ok := strings.CutPrefix(rest, "@"); ok {
+		rest = ""
+		if i := strings.IndexByte(dims, '#'); i >= 0 {
+			dims, rest = dims[:i], dims[i:]
+		}
+		if _, err := strconv.Atoi(dims); err != nil {
+			return "", false
+		}
+	}
+	if rest == "" {
+		return "", true
+	}
+	return strings.CutPrefix(rest, "#")
+}
+
+// fetchEmbeddings embeds inputs in a single request and returns the vectors
+// in input order. A positive dimensions is passed to the server. With
+// ClientConfig.Coalescing a single input may share its request with those
+// of other callers.
+func (c *Client) fetchEmbeddings(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	if c.coalescer.coalescible(ctx, inputs) {
+		v, err := c.coalescer.fetch(withoutDest(ctx), model, inputs[0], dimensions)
+		if err != nil {
+			return nil, err
+		}
+		return [][]float32{v}, nil
+	}
+	return c.fetchBatch(ctx, model, inputs, dimensions)
+}
+
+// fetchBatch is fetchEmbeddings without coalescing. A failure that the
+// cached model list may have caused refreshes it and is retried once.
+func (c *Client) fetchBatch(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	vectors, err := c.fetchBatchOnce(ctx, model, inputs, dimensions)
+	if err != nil && c.staleCapabilities(model, err) {
+		if _, rerr := c.refreshCapabilities(ctx); rerr == nil {
+			return c.fetchBatchOnce(ctx, model, inputs, dimensions)
+		}
+	}
+	return vectors, err
+}
+
+// fetchBatchOnce sends one mcp.embed request for inputs.
+func (c *Client) fetchBatchOnce(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	result := embedResult{batch: len(inputs), dim: c.knownDimension(model, dimensions)}
+	if d := requestDest(ctx); d != nil && (result.dim == 0 || result.dim == d.dim) {
+		result.dim, result.dest = d.dim, d
+	}
+	params := embedParams{Model: model, Inputs: inputs, Dimensions: dimensions, EncodingFormat: EncodingBase64}
+	if err := c.Call(ctx, MethodEmbed, params, &result); err != nil {
+		return nil, err
+	}
+	tallyResult(ctx, &result, inputs)
+	c.versions.note(model, result.ModelVersion)
+	v := c.validator(MethodEmbed, len(inputs), result.dim)
+	if err := v.count(len(result.Embeddings)); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(inputs))
+	for _, e := range result.Embeddings {
+		if err := v.check(e.Index, e.Vector); err != nil {
+			return nil, err
+		}
+		vectors[e.Index] = e.Vector
+	}
+	if err := result.verifyChecksums(c.cfg.RequireChecksums); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientStdioSession(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportStdio, Command: helperCommand(t)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	init, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if init.Session.ID != fakeSessionID || c.SessionID() != fakeSessionID {
+		t.Fatalf("unexpected session: %+v", init.Session)
+	}
+	vec, err := c.Embed(ctx, "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 3 || vec[0] != 5 {
+		t.Fatalf("unexpected vector: %v", vec)
+	}
+}
+
+func TestClientHTTPSession(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := c.Call(context.Background(), "mcp.unknown", nil, nil); err == nil || !strings.Contains(err.Error(), "-32601") {
+		t.Fatalf("expected method-not-found error, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  ClientConfig
+		want string
+	}{
+		{"stdio without command", ClientConfig{Transport: TransportStdio}, "server command"},
+		{"tls with http scheme", ClientConfig{Transport: TransportTLS, Endpoint: "http://localhost"}, "https://"},
+		{"unix relative path", ClientConfig{Transport: TransportUnix, SocketPath: "server.sock"}, "absolute"},
+		{"unknown framing", ClientConfig{Transport: TransportStdio, Command: []string{"server"}, Framing: "carrier-pigeon"}, "framing"},
+		{"negative timeout", ClientConfig{Transport: TransportHTTP, ReadTimeout: -time.Second}, "negative"},
+		{"unknown transport", ClientConfig{Transport: "carrier-pigeon"}, "unknown transport"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestEntryTimed(t *testing.T) {
+	sent := time.Date(2026, 10, 14, 8, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	req := Entry{Direction: DirectionRequest}.Timed(sent, time.Time{})
+	if req.SentAt != "2026-10-14T06:00:00Z" || req.ReceivedAt != "" || req.DurationMS != 0 {
+		t.Fatalf("request timings = %+v", req)
+	}
+	resp := Entry{Direction: DirectionResponse}.Timed(sent, sent.Add(1500*time.Microsecond))
+	if resp.ReceivedAt != "2026-10-14T06:00:00.0015Z" || resp.DurationMS != 1.5 {
+		t.Fatalf("response timings = %+v", resp)
+	}
+}
+
+func TestRunRecordsTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go", "stdio.json")
+	var out strings.Builder
+	err := Run(context.Background(), Options{
+		Config:           ClientConfig{Transport: TransportStdio, Command: helperCommand(t)},
+		RecordTranscript: path,
+		Stdout:           &out,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("decode transcript: %v", err)
+	}
+	if doc.Client != ClientMarker || doc.Transport != TransportStdio {
+		t.Fatalf("unexpected markers: client=%q transport=%q", doc.Client, doc.Transport)
+	}
+	methods := []string{}
+	for i, entry := range doc.Messages {
+		if entry.SentAt == "" || (entry.Direction == DirectionResponse) != (entry.ReceivedAt != "") {
+			t.Fatalf("entry %d timings: sent_at=%q received_at=%q", i, entry.SentAt, entry.ReceivedAt)
+		}
+		if entry.Direction != DirectionRequest {
+			continue
+		}
+		var req Request
+		if err := json.Unmarshal(entry.Message, &req); err != nil {
+			t.Fatalf("decode entry: %v", err)
+		}
+		methods = append(methods, req.Method)
+	}
+	want := []string{MethodInitialize, MethodPing, MethodCapabilities}
+	if strings.Join(methods, ",") != strings.Join(want, ",") {
+		t.Fatalf("recorded methods %v, want %v", methods, want)
+	}
+	if len(doc.Messages) != 6 {
+		t.Fatalf("expected 6 entries, got %d", len(doc.Messages))
+	}
+	if !strings.Contains(out.String(), fakeSessionID) {
+		t.Fatalf("summary missing session id: %s", out.String())
+	}
+}
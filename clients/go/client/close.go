@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClientClosed is returned by calls made once Close has begun.
+var ErrClientClosed = errors.New("client closed")
+
+// closeGate tracks the calls and streams in progress so Close can stop
+// admitting new ones and wait for the rest.
+type closeGate struct {
+	mu sync.Mutex
+	// closing is set once Close begins. It is read without mu so that
+	// calls turned away do not contend for it with the exits Close waits
+	// on.
+	closing atomic.Bool
+	active  int
+	// idle is closed once closing is set and active drops to zero.
+	idle chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+// admittedKey marks a context whose work was already admitted by the gate,
+// so the requests it issues are not turned away while it drains.
+type admittedKey struct{}
+
+// enter admits a call, failing once Close has begun. Every successful enter
+// must be paired with exit.
+func (g *closeGate) enter(ctx context.Context) error {
+	if ctx.Value(admittedKey{}) != nil {
+		return nil
+	}
+	if g.closing.Load() {
+		return ErrClientClosed
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closing.Load() {
+		return ErrClientClosed
+	}
+	g.active++
+	return nil
+}
+
+// check fails once Close has begun, as enter would, for a call that may be
+// answered without reaching enter, such as from the embedding cache.
+func (g *closeGate) check(ctx context.Context) error {
+	if ctx.Value(admittedKey{}) == nil && g.closing.Load() {
+		return ErrClientClosed
+	}
+	return nil
+}
+
+// exit ends a call admitted by enter.
+func (g *closeGate) exit(ctx context.Context) {
+	if ctx.Value(admittedKey{}) != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active--
+	if g.closing.Load() && g.active == 0 {
+		close(g.idle)
+	}
+}
+
+// shut stops admitting calls and returns a channel closed once the admitted
+// ones have finished.
+func (g *closeGate) shut() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closing.Store(true)
+	g.idle = make(chan struct{})
+	if g.active == 0 {
+		close(g.idle)
+	}
+	return g.idle
+}
+
+// shutting reports whether Close has begun.
+func (g *closeGate) shutting() bool {
+	return g.closing.Load()
+}
+
+// pending returns the number of admitted calls still running.
+func (g *closeGate) pending() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active
+}
+
+// Close shuts the client down. New calls fail with ErrClientClosed at once,
+// while calls and streams already under way may finish until ctx is done.
+// Then the transports of the client and its model routes are torn down:
+// connections are closed, idle HTTP connections dropped, background
+// heartbeats stopped, and a stdio server is sent SIGTERM and, if it is still
+// running after a grace period, killed. Calls cut short by ctx fail with a
+// transport error, and Close reports how many there were. The replay of
+// ClientConfig.Spool stops first, leaving the entries it has not replayed
+// in the spool for the next client. Calling Close
+// again waits for the first call and returns its result.
+func (c *Client) Close(ctx context.Context) error {
+	c.gate.once.Do(func() { c.gate.err = c.shutdown(ctx) })
+	return c.gate.err
+}
+
+func (c *Client) shutdown(ctx context.Context) error {
+	var errs []error
+	c.stopSpool()
+	select {
+	case <-c.gate.shut():
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("close: %d calls still in flight: %w", c.gate.pending(), ctx.Err()))
+	}
+	for _, model := range c.routeModels() {
+		if err := c.routes[model].Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("route %q: %w", model, err))
+		}
+	}
+	if err := c.transport.Close(); err != nil && !errors.Is(err, errTransportClosed) {
+		errs = append(errs, err)
+	}
+	c.notes.close()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkGoroutines returns a function that fails t unless the goroutine count
+// falls back to its current value.
+func checkGoroutines(t *testing.T) func() {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				t.Fatalf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, buf[:runtime.Stack(buf, true)])
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// blockingHandler answers embed requests only once release is closed and
+// signals each arrival on started.
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) fakeHandler {
+	return func(req *Request) *Response {
+		if req.Method == MethodEmbed {
+			started <- struct{}{}
+			<-release
+		}
+		return defaultHandler(req)
+	}
+}
+
+func TestCloseRejectsNewCalls(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Close(context.Background()); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "late"); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Embed after Close: %v", err)
+	}
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Call after Close: %v", err)
+	}
+	if _, err := c.EmbedStream(ctx, []string{"late"}); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("EmbedStream after Close: %v", err)
+	}
+}
+
+func TestCloseRejectsCachedEmbeds(t *testing.T) {
+	c, err := NewClient("", WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)}), WithCache(CacheConfig{}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := c.EmbedBatch(ctx, []string{"cached"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c.Embed(ctx, "cached"); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("Embed after Close: %v", err)
+	}
+	if _, err := c.EmbedBatch(ctx, []string{"cached"}); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("EmbedBatch after Close: %v", err)
+	}
+}
+
+func TestCloseDrainsInFlightCalls(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(blockingHandler(started, release))})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+	embedded := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(ctx, "slow")
+		embedded <- err
+	}()
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close(ctx) }()
+	// Close stops admitting calls before the in-flight one finishes.
+	for !c.gate.shutting() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.ListModels(ctx); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("ListModels during Close: %v", err)
+	}
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned before the call finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-embedded; err != nil {
+		t.Fatalf("in-flight Embed: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestCloseDrainsStreams(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+	ch, err := c.EmbedStream(ctx, []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close(ctx) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned while the stream was unread: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if results := collect(t, ch); len(results) != 2 {
+		t.Fatalf("stream cut short: %+v", results)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestCloseDeadlineTearsDown(t *testing.T) {
+	c, err := New(ClientConfig{Command: helperCommandMode(t, helperSilent)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	called := make(chan error, 1)
+	go func() { called <- c.Call(context.Background(), MethodPing, nil, nil) }()
+	for c.gate.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 calls still in flight") {
+		t.Fatalf("expected the deadline with one call pending, got %v", err)
+	}
+	// Tearing the transport down ends the abandoned call.
+	select {
+	case err := <-called:
+		if err == nil {
+			t.Fatal("abandoned call succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("abandoned call still running after Close")
+	}
+	if again := c.Close(context.Background()); again == nil || again.Error() != err.Error() {
+		t.Fatalf("second Close = %v, want the first result %v", again, err)
+	}
+}
+
+func TestCloseTerminatesLingeringServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGTERM on windows")
+	}
+	marker := filepath.Join(t.TempDir(), "terminated")
+	t.Setenv(crashMarkerEnv, marker)
+	c, err := New(ClientConfig{Command: helperCommandMode(t, helperLingering)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("the server did not get SIGTERM: %v", err)
+	}
+}
+
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	done := checkGoroutines(t)
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	configs := map[string]ClientConfig{
+		"stdio":  {Command: helperCommand(t)},
+		"http":   {Transport: TransportHTTP, Endpoint: httpSrv.URL, HeartbeatInterval: 10 * time.Millisecond},
+		"ws":     {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv), WSPingInterval: 10 * time.Millisecond},
+		"inproc": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+	}
+	ctx := context.Background()
+	for name, cfg := range configs {
+		c, err := NewClient("", WithConfig(cfg), WithModelRoute(specialModel, httpSrv.URL))
+		if err != nil {
+			t.Fatalf("%s: NewClient: %v", name, err)
+		}
+		if _, err := c.Embed(ctx, "warm up"); err != nil {
+			t.Fatalf("%s: Embed: %v", name, err)
+		}
+		if _, err := c.Embed(ctx, "routed", WithModel(specialModel)); err != nil {
+			t.Fatalf("%s: routed Embed: %v", name, err)
+		}
+		if results := collect(t, mustStream(t, c, "a", "b")); len(results) != 2 {
+			t.Fatalf("%s: stream: %+v", name, results)
+		}
+		// Let the heartbeat and keepalive loops start.
+		time.Sleep(30 * time.Millisecond)
+		if err := c.Close(ctx); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+	}
+	httpSrv.Close()
+	wsSrv.Close()
+	done()
+}
+
+// mustStream starts an EmbedStream of texts.
+func mustStream(t *testing.T, c *Client, texts ...string) <-chan EmbedResult {
+	t.Helper()
+	ch, err := c.EmbedStream(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	return ch
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CoalescingPolicy merges the single-input embeds of concurrent callers
+// into batch requests, which servers answer far more cheaply than as many
+// requests of one. The zero value sends every call on its own.
+type CoalescingPolicy struct {
+	// MaxDelay is how long a batch waits for more inputs after its first,
+	// the most latency coalescing adds to a call. Zero disables it.
+	MaxDelay time.Duration
+	// MaxBatch sends a batch as soon as it holds this many inputs, or the
+	// server's advertised batch limit once known if that is smaller. Zero
+	// selects DefaultMaxBatchSize.
+	MaxBatch int
+}
+
+func (p CoalescingPolicy) enabled() bool { return p.MaxDelay > 0 }
+
+func (p CoalescingPolicy) validate() error {
+	if p.MaxDelay < 0 || p.MaxBatch < 0 {
+		return errors.New("coalescing delay and batch size must not be negative")
+	}
+	return nil
+}
+
+// WithCoalescing merges the single-input embeds that concurrent callers
+// issue within maxDelay of each other into one request of up to maxBatch
+// inputs; see CoalescingPolicy. It overrides WithConfig's Coalescing.
+func WithCoalescing(maxDelay time.Duration, maxBatch int) Option {
+	return func(o *clientOptions) error {
+		if maxDelay <= 0 || maxBatch <= 0 {
+			return fmt.Errorf("WithCoalescing: delay and batch size must be positive, got %v and %d", maxDelay, maxBatch)
+		}
+		o.coalescing = &CoalescingPolicy{MaxDelay: maxDelay, MaxBatch: maxBatch}
+		return nil
+	}
+}
+
+// coalescer gathers single-input fetches into batches, one open batch per
+// model and dimensions, since a request carries one of each.
+type coalescer struct {
+	c      *Client
+	policy CoalescingPolicy
+
+	mu   sync.Mutex
+	open map[coalesceKey]*coalesceBatch
+}
+
+type coalesceKey struct {
+	model      string
+	dimensions int
+	// clientDimensions is the truncation the client does afterwards, sent
+	// as meta.client_dimensions.
+	clientDimensions int
+}
+
+// coalesceBatch is a batch gathering inputs, then sent. Its waiters read
+// vectors and err once done is closed.
+type coalesceBatch struct {
+	key    coalesceKey
+	inputs []string
+	joined []time.Time
+	timer  *time.Timer
+	// ctx is the batch request's own, canceled once every waiter has
+	// dropped out.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// waiting counts the callers still interested in the answer.
+	waiting int
+
+	done    chan struct{}
+	vectors [][]float32
+	err     error
+}
+
+func newCoalescer(c *Client, policy CoalescingPolicy) *coalescer {
+	if policy.MaxBatch <= 0 {
+		policy.MaxBatch = DefaultMaxBatchSize
+	}
+	return &coalescer{c: c, policy: policy, open: make(map[coalesceKey]*coalesceBatch)}
+}
+
+// coalescible reports whether a fetch of inputs made with ctx may share a
+// request with others: a single input, from a caller that has not named
+// its request with WithRequestID, outside a JSON-RPC 2.0 batch.
+func (co *coalescer) coalescible(ctx context.Context, inputs []string) bool {
+	return co != nil && len(inputs) == 1 && RequestIDFromContext(ctx) == "" && !inRPCBatch(ctx) && !sendsAlone(ctx)
+}
+
+// fetch adds input to the open batch for its model and dimensions and
+// waits for its vector. A caller whose ctx ends first returns its error
+// and leaves the batch to the others; a batch every caller has left is
+// abandoned. A failure of the batch request is every caller's.
+func (co *coalescer) fetch(ctx context.Context, model, input string, dimensions int) ([]float32, error) {
+	key := coalesceKey{model: model, dimensions: dimensions}
+	if n, ok := ctx.Value(clientDimensionsKey{}).(int); ok {
+		key.clientDimensions = n
+	}
+	limit := co.policy.MaxBatch
+	co.c.mu.Lock()
+	if co.c.batchSize > 0 {
+		limit = min(limit, co.c.batchSize)
+	}
+	co.c.mu.Unlock()
+
+	co.mu.Lock()
+	b := co.open[key]
+	if b == nil {
+		b = &coalesceBatch{key: key, done: make(chan struct{})}
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+		if key.clientDimensions > 0 {
+			b.ctx = context.WithValue(b.ctx, clientDimensionsKey{}, key.clientDimensions)
+		}
+		b.timer = time.AfterFunc(co.policy.MaxDelay, func() { co.send(b) })
+		co.open[key] = b
+	}
+	i := len(b.inputs)
+	b.inputs = append(b.inputs, input)
+	b.joined = append(b.joined, time.Now())
+	b.waiting++
+	full := len(b.inputs) >= limit
+	if full {
+		delete(co.open, key)
+	}
+	co.mu.Unlock()
+	if full && b.timer.Stop() {
+		go co.send(b)
+	}
+
+	select {
+	case <-b.done:
+		if b.err != nil {
+			return nil, b.err
+		}
+		return b.vectors[i], nil
+	case <-ctx.Done():
+		co.mu.Lock()
+		b.waiting--
+		if b.waiting == 0 {
+			b.cancel()
+			// Later callers start a batch of their own.
+			if co.open[b.key] == b {
+				delete(co.open, b.key)
+			}
+		}
+		co.mu.Unlock()
+		return nil, fmt.Errorf("%s: %w", MethodEmbed, ctx.Err())
+	}
+}
+
+// send closes b to new inputs and sends it, unless every caller has left.
+func (co *coalescer) send(b *coalesceBatch) {
+	defer close(b.done)
+	defer b.cancel()
+	co.mu.Lock()
+	if co.open[b.key] == b {
+		delete(co.open, b.key)
+	}
+	waiting := b.waiting
+	co.mu.Unlock()
+	if waiting == 0 {
+		b.err = context.Canceled
+		return
+	}
+	now := time.Now()
+	delays := make([]time.Duration, len(b.joined))
+	for i, t := range b.joined {
+		delays[i] = now.Sub(t)
+	}
+	co.c.metrics.stats.coalesced(delays)
+	b.vectors, b.err = co.c.fetchBatch(b.ctx, b.key.model, b.inputs, b.key.dimensions)
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchServer is an inproc handler recording the inputs of each embed
+// request, answering through handle once let through.
+type batchServer struct {
+	mu      sync.Mutex
+	batches []int
+	arrived chan struct{}
+	handle  fakeHandler
+}
+
+func (s *batchServer) serve(req *Request) *Response {
+	if req.Method == MethodEmbed {
+		s.mu.Lock()
+		s.batches = append(s.batches, len(embedInputs(req)))
+		s.mu.Unlock()
+		if s.arrived != nil {
+			s.arrived <- struct{}{}
+		}
+	}
+	return s.handle(req)
+}
+
+func (s *batchServer) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...)
+}
+
+func embedInputs(req *Request) []string {
+	var params embedParams
+	_ = json.Unmarshal(req.Params, &params)
+	return params.Inputs
+}
+
+func coalescingClient(t *testing.T, srv *batchServer, maxDelay time.Duration, maxBatch int) *Client {
+	t.Helper()
+	c, err := NewClient("", WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(srv.serve)}), WithCoalescing(maxDelay, maxBatch))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+// embedCoalesced embeds an input of length i+1 with each ctxs[i] at
+// once, returning each call's error.
+func embedCoalesced(t *testing.T, ctxs []context.Context, c *Client) []error {
+	t.Helper()
+	errs := make([]error, len(ctxs))
+	var wg sync.WaitGroup
+	for i, ctx := range ctxs {
+		wg.Add(1)
+		go func(i int, ctx context.Context) {
+			defer wg.Done()
+			input := strings.Repeat("x", i+1)
+			v, err := c.Embed(ctx, input)
+			if err == nil && v[0] != float32(len(input)) {
+				err = errors.New("vector of another input")
+			}
+			errs[i] = err
+		}(i, ctx)
+	}
+	wg.Wait()
+	return errs
+}
+
+func backgrounds(n int) []context.Context {
+	ctxs := make([]context.Context, n)
+	for i := range ctxs {
+		ctxs[i] = context.Background()
+	}
+	return ctxs
+}
+
+func TestCoalescingMergesConcurrentEmbeds(t *testing.T) {
+	srv := &batchServer{handle: defaultHandler}
+	// The batch fills long before its window closes.
+	c := coalescingClient(t, srv, time.Minute, 8)
+	for i, err := range embedCoalesced(t, backgrounds(8), c) {
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if got := srv.sizes(); len(got) != 1 || got[0] != 8 {
+		t.Fatalf("embed requests of %v inputs, want one of 8", got)
+	}
+
+	// A lone call goes out when the window closes.
+	c = coalescingClient(t, srv, 20*time.Millisecond, 8)
+	if _, err := c.Embed(context.Background(), "alone"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	s := c.Stats()
+	if s.Coalesced != 1 || s.CoalescedBatches != 1 || s.Requests[MethodEmbed] != 1 {
+		t.Fatalf("coalesced %d inputs in %d batches, %d embed requests", s.Coalesced, s.CoalescedBatches, s.Requests[MethodEmbed])
+	}
+	if s.CoalesceDelay.Count != 1 || s.CoalesceDelay.Max < 20*time.Millisecond {
+		t.Fatalf("coalesce delay %+v, want one of at least 20ms", s.CoalesceDelay)
+	}
+}
+
+func TestCoalescingCallerDropsOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := &batchServer{arrived: make(chan struct{}, 1), handle: func(req *Request) *Response {
+		<-release
+		return defaultHandler(req)
+	}}
+	c := coalescingClient(t, srv, time.Minute, 3)
+	ctxs := backgrounds(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxs[1] = ctx
+	go func() {
+		<-srv.arrived
+		cancel()
+		// The canceled caller returns while the batch is still out.
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	errs := embedCoalesced(t, ctxs, c)
+	if !errors.Is(errs[1], context.Canceled) {
+		t.Fatalf("canceled caller: %v", errs[1])
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("the batch failed with its caller: %v", errs)
+	}
+}
+
+func TestCoalescingRejoinAfterEveryCallerLeft(t *testing.T) {
+	srv := &batchServer{handle: defaultHandler}
+	c := coalescingClient(t, srv, 200*time.Millisecond, 8)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Embed(ctx, "gone"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("abandoned call: %v", err)
+	}
+	// The abandoned batch's window is still open.
+	v, err := c.Embed(context.Background(), "back")
+	if err != nil || v[0] != 4 {
+		t.Fatalf("call after the last caller left: %v, %v", v, err)
+	}
+	if got := srv.sizes(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("embed requests of %v inputs, want one of 1", got)
+	}
+}
+
+func TestCoalescingBatchErrorReachesEveryWaiter(t *testing.T) {
+	srv := &batchServer{handle: func(req *Request) *Response {
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32000, Message: "model unloaded"}}
+	}}
+	c := coalescingClient(t, srv, time.Minute, 4)
+	for i, err := range embedCoalesced(t, backgrounds(4), c) {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Message != "model unloaded" {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if got := srv.sizes(); len(got) != 1 {
+		t.Fatalf("embed requests of %v inputs, want one", got)
+	}
+}
+
+func TestCoalescingKeepsNamedRequests(t *testing.T) {
+	srv := &batchServer{handle: defaultHandler}
+	c := coalescingClient(t, srv, time.Minute, 8)
+	// A call naming its request is not delayed by the window.
+	if _, err := c.Embed(WithRequestID(context.Background(), "mine"), "named"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if s := c.Stats(); s.Coalesced != 0 {
+		t.Fatalf("coalesced %d named calls", s.Coalesced)
+	}
+	if _, err := NewClient("", WithCoalescing(0, 8)); err == nil {
+		t.Fatal("expected a zero delay to be rejected")
+	}
+}
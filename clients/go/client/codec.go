@@ -0,0 +1,180 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/codec"
+)
+
+// Codecs a session can carry its envelopes in, the names of
+// ClientConfig.Codecs.
+const (
+	// CodecJSON is the default, and what every server speaks.
+	CodecJSON = codec.JSONName
+	// CodecMsgPack is MessagePack; see MsgPackCodec.
+	CodecMsgPack = "msgpack"
+	// CodecCBOR is CBOR in its deterministic encoding; see CBORCodec.
+	CodecCBOR = "cbor"
+)
+
+// Codec encodes the envelopes of a session; see package codec, whose
+// registry the codecs of ClientConfig.Codecs and ClientConfig.Codec are
+// looked up in. MsgPackCodec and CBORCodec are registered with JSONCodec.
+type Codec = codec.Codec
+
+// JSONCodec is encoding/json, the codec of every session that did not
+// negotiate another.
+var JSONCodec = codec.JSON
+
+func init() {
+	codec.Register(MsgPackCodec)
+	codec.Register(CBORCodec)
+}
+
+// codecFor returns the codec of a body of contentType: the registered
+// codec whose media type it is, and JSONCodec for any other.
+func codecFor(contentType string) Codec {
+	if c, ok := codec.ForContentType(contentType); ok {
+		return c
+	}
+	return JSONCodec
+}
+
+// responseDecoder is implemented by the codecs that decode a Response
+// with its result kept as JSON directly, without the projection.
+type responseDecoder interface {
+	decodeResponse(data []byte, resp *Response) error
+}
+
+// decodeResponse decodes a response envelope in c from data. The result
+// is the JSON projection of the one c encoded, which is what transcripts
+// record.
+func decodeResponse(c Codec, data []byte, resp *Response) error {
+	if d, ok := c.(responseDecoder); ok {
+		return d.decodeResponse(data, resp)
+	}
+	doc, err := codec.Project(c, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(doc, resp)
+}
+
+func validateCodecs(names []string) error {
+	for _, name := range names {
+		if err := validateCodec(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCodec(name string) error {
+	if _, ok := codec.Lookup(name); !ok {
+		return fmt.Errorf("unknown codec %q: want one of %s", name, strings.Join(codec.Names(), ", "))
+	}
+	return nil
+}
+
+// WithCodecs offers the server the codecs named, in order of preference,
+// besides JSON; see ClientConfig.Codecs.
+func WithCodecs(names ...string) Option {
+	return func(o *clientOptions) error {
+		if err := validateCodecs(names); err != nil {
+			return err
+		}
+		o.codecs = names
+		return nil
+	}
+}
+
+// codecTransport is implemented by transports whose envelopes can travel in
+// a negotiated or configured codec.
+type codecTransport interface {
+	setCodec(codec Codec)
+}
+
+// WithCodec sends every envelope in the codec named, from the handshake
+// on; see ClientConfig.Codec.
+func WithCodec(name string) Option {
+	return func(o *clientOptions) error {
+		if err := validateCodec(name); err != nil {
+			return err
+		}
+		o.codec = name
+		return nil
+	}
+}
+
+// offeredCodecs is what the handshake advertises: ClientConfig.Codecs and
+// JSON, or nothing when none are configured, ClientConfig.Codec is, or the
+// transport cannot carry them.
+func (c *Client) offeredCodecs() []string {
+	if len(c.cfg.Codecs) == 0 || c.cfg.Codec != "" {
+		return nil
+	}
+	if _, ok := c.transport.(codecTransport); !ok {
+		return nil
+	}
+	offered := make([]string, 0, len(c.cfg.Codecs)+1)
+	for _, name := range c.cfg.Codecs {
+		if name != CodecJSON {
+			offered = append(offered, name)
+		}
+	}
+	return append(offered, CodecJSON)
+}
+
+// useCodec switches the transport to the codec the server picked from
+// offered, sending CBOR typed arrays when typedArrays says the server
+// decodes them. Servers that predate negotiation pick none, which is JSON.
+func (c *Client) useCodec(picked string, offered []string, typedArrays bool) error {
+	if picked == "" {
+		picked = CodecJSON
+	}
+	if offered == nil {
+		// A session in ClientConfig.Codec keeps it.
+		if picked != CodecJSON && picked != c.cfg.Codec {
+			return fmt.Errorf("server picked codec %q, which was not offered: %w", picked, ErrProtocol)
+		}
+		return nil
+	}
+	found := false
+	for _, name := range offered {
+		found = found || name == picked
+	}
+	if !found {
+		return fmt.Errorf("server picked codec %q, want one of %s: %w", picked, strings.Join(offered, ", "), ErrProtocol)
+	}
+	chosen, _ := codec.Lookup(picked)
+	if picked == CodecCBOR && typedArrays {
+		chosen = CBORTypedArrayCodec
+	}
+	c.transport.(codecTransport).setCodec(chosen)
+	c.mu.Lock()
+	c.codec = picked
+	c.mu.Unlock()
+	return nil
+}
+
+// Codec returns the name of the codec the session's envelopes travel in:
+// ClientConfig.Codec, the one Initialize negotiated, or CodecJSON.
+func (c *Client) Codec() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.codec == "" {
+		return CodecJSON
+	}
+	return c.codec
+}
+
+// codecMarker is the codec a transcript's header names: the negotiated
+// one, or none for JSON.
+func (c *Client) codecMarker() string {
+	if codec := c.Codec(); codec != CodecJSON {
+		return codec
+	}
+	return ""
+}
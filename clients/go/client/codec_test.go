@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/codec"
+)
+
+// hexJSONCodec is a third-party codec: JSON in hex, which the client knows
+// nothing of but its registration.
+type hexJSONCodec struct{}
+
+func (hexJSONCodec) Name() string        { return "hexjson" }
+func (hexJSONCodec) ContentType() string { return "application/x-hexjson" }
+
+func (hexJSONCodec) Marshal(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	return []byte(hex.EncodeToString(raw)), err
+}
+
+func (hexJSONCodec) Unmarshal(data []byte, v any) error {
+	raw, err := hex.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func init() { codec.Register(hexJSONCodec{}) }
+
+func TestRegisteredCodec(t *testing.T) {
+	s := &msgpackServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	rec := &markingRecorder{}
+	var stdout strings.Builder
+	err := RunEmbed(context.Background(), Options{
+		Config:             ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Codecs: []string{"hexjson"}},
+		TranscriptRecorder: rec,
+		Inputs:             []string{"a", "bb"},
+		Stdout:             &stdout,
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	if got := strings.Join(s.offered, ","); got != "hexjson,json" {
+		t.Fatalf("offered %s", got)
+	}
+	if last := s.contentTypes[len(s.contentTypes)-1]; last != "application/x-hexjson" {
+		t.Fatalf("content types %v", s.contentTypes)
+	}
+	if !strings.Contains(stdout.String(), "[2,0.5,-0.5]") {
+		t.Fatalf("output %s", stdout.String())
+	}
+	// The transcript records the JSON projection of the hex.
+	last := rec.entries[len(rec.entries)-1].Message
+	var result struct {
+		Result embedResult `json:"result"`
+	}
+	if rec.markers.Codec != "hexjson" || json.Unmarshal(last, &result) != nil || len(result.Result.Embeddings) != 2 {
+		t.Fatalf("markers %+v, recorded response %s", rec.markers, last)
+	}
+}
+
+func TestConfiguredCodec(t *testing.T) {
+	s := &msgpackServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithCodec(CodecCBOR), WithCodecs(CodecMsgPack))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	// The handshake travels in the codec too, and offers none.
+	if s.offered != nil || c.Codec() != CodecCBOR {
+		t.Fatalf("offered %v, codec %s", s.offered, c.Codec())
+	}
+	for _, ct := range s.contentTypes {
+		if ct != "application/cbor" {
+			t.Fatalf("content types %v", s.contentTypes)
+		}
+	}
+
+	if _, err := NewClient(srv.URL, WithCodec("bson")); err == nil || !strings.Contains(err.Error(), "cbor, hexjson, json, msgpack") {
+		t.Fatalf("WithCodec accepted an unknown codec: %v", err)
+	}
+	for name, cfg := range map[string]ClientConfig{
+		"stdio":   {Transport: TransportStdio, Command: []string{"server"}, Codec: CodecCBOR},
+		"openai":  {Transport: TransportHTTP, Endpoint: srv.URL, WireProtocol: OpenAICompat, Codec: CodecCBOR},
+		"signing": {Transport: TransportHTTP, Endpoint: srv.URL, Codec: CodecMsgPack, Signing: SigningConfig{KeyID: "k", Secret: "s"}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+	if err := (ClientConfig{Transport: TransportStdio, Command: []string{"server"}, Codec: CodecJSON}).Validate(); err != nil {
+		t.Errorf("the json codec over stdio: %v", err)
+	}
+}
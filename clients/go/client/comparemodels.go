@@ -0,0 +1,437 @@
+package client
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// DefaultCompareWorst is how many of the least similar inputs a model
+// comparison lists when CompareModels.Worst is zero.
+const DefaultCompareWorst = 10
+
+// CompareModels configures RunCompareModels.
+type CompareModels struct {
+	// ModelA and ModelB are the models whose embeddings are compared, each
+	// chosen per call as by WithModel, so WithModelRoute can send them to
+	// different servers.
+	ModelA, ModelB string
+	// Worst is how many of the least similar inputs the report lists;
+	// zero selects DefaultCompareWorst.
+	Worst int
+}
+
+// ModelComparison is the report of RunCompareModels.
+type ModelComparison struct {
+	ModelA string `json:"model_a"`
+	ModelB string `json:"model_b"`
+	// VersionA and VersionB are the model versions the server reports
+	// answering with, when it does.
+	VersionA string `json:"model_version_a,omitempty"`
+	VersionB string `json:"model_version_b,omitempty"`
+	// Inputs counts the inputs embedded, and Compared those with a cosine
+	// similarity: the others had vectors of different dimensions, or one
+	// with no direction.
+	Inputs              int `json:"inputs"`
+	Compared            int `json:"compared"`
+	DimensionMismatches int `json:"dimension_mismatches"`
+	ZeroVectors         int `json:"zero_vectors,omitempty"`
+	// DimensionA and DimensionB are the dimensions of the first vectors of
+	// either model.
+	DimensionA int               `json:"dimension_a"`
+	DimensionB int               `json:"dimension_b"`
+	Similarity SimilarityStats   `json:"similarity"`
+	Worst      []InputComparison `json:"worst"`
+	// Interrupted reports a run that Options.Stop wound down before it
+	// embedded every input.
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// SimilarityStats summarizes the cosine similarities of the compared
+// inputs.
+type SimilarityStats struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	P1     float64 `json:"p1"`
+	P5     float64 `json:"p5"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// InputComparison is how far the embeddings of one input moved between the
+// models.
+type InputComparison struct {
+	// Index is the input's position, or its line number from 0 in an input
+	// file.
+	Index int64 `json:"index"`
+	// Text is the input, listed in the report's Worst only.
+	Text string `json:"text,omitempty"`
+	// Similarity is the cosine similarity of the two vectors, nil when
+	// Error says why there is none.
+	Similarity *float64 `json:"similarity"`
+	DimensionA int      `json:"dimension_a"`
+	DimensionB int      `json:"dimension_b"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// RunCompareModels initializes a session with the server described by opts
+// and embeds opts.Inputs, or the non-blank lines of opts.InputFile a window
+// at a time, with both models of opts.CompareModels, measuring the cosine
+// similarity of each input's two vectors. OutputJSON, the default, writes
+// the ModelComparison to opts.Stdout; the other formats stream an
+// InputComparison record per input instead and report the summary to
+// opts.Progress. Inputs whose vectors differ in dimension are counted and
+// reported rather than failing the run.
+func RunCompareModels(ctx context.Context, opts Options) (err error) {
+	cm := opts.CompareModels
+	switch {
+	case cm.ModelA == "" || cm.ModelB == "":
+		return errors.New("compare-models: both models must be named")
+	case cm.Worst < 0 || opts.Concurrency < 0:
+		return errors.New("compare-models: worst and concurrency must not be negative")
+	case opts.InputFile != "" && len(opts.Inputs) > 0:
+		return errors.New("compare-models: an input file and inputs cannot be combined")
+	case opts.InputFile == "" && len(opts.Inputs) == 0:
+		return errors.New("compare-models: no inputs")
+	case opts.Output.fileOnly():
+		return fmt.Errorf("compare-models: %s output is not supported", opts.Output.Format)
+	case opts.DryRun:
+		return opts.dryRun(ctx, RunCompareModels)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p, ok := c.transport.(interface{ protocol() string }); ok {
+			markers.Protocol = p.protocol()
+		}
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	if _, err := c.Initialize(ctx); err != nil {
+		return err
+	}
+	out := opts.Output
+	if out.Format == "" {
+		out.Format = OutputJSON
+	}
+	out.Indent = "  "
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	w := bufio.NewWriter(stdout)
+	var records *RecordWriter
+	if out.Format != OutputJSON {
+		records = out.NewRecordWriter(w)
+	}
+	cmp := newModelComparer(c, opts, records)
+	if opts.InputFile != "" {
+		err = cmp.compareFile(ctx)
+	} else {
+		indices := make([]int64, len(opts.Inputs))
+		for i := range indices {
+			indices[i] = int64(i)
+		}
+		err = cmp.compareAt(ctx, opts.Inputs, indices)
+	}
+	if err != nil {
+		return err
+	}
+	report := cmp.report()
+	if records != nil {
+		if err := records.Flush(); err != nil {
+			return fmt.Errorf("write comparison: %w", err)
+		}
+		if opts.Progress != nil {
+			s := report.Similarity
+			fmt.Fprintf(opts.Progress, "compare-models: %s against %s: %d inputs, %d compared, mean %.4f, p5 %.4f, min %.4f, %d dimension mismatches\n",
+				report.ModelB, report.ModelA, report.Inputs, report.Compared, s.Mean, s.P5, s.Min, report.DimensionMismatches)
+		}
+	} else if err := out.Render(w, report, nil); err != nil {
+		return fmt.Errorf("write comparison: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write comparison: %w", err)
+	}
+	return nil
+}
+
+// modelComparer accumulates the comparison of a RunCompareModels session.
+type modelComparer struct {
+	c       *Client
+	opts    Options
+	records *RecordWriter
+	worst   int
+
+	result       ModelComparison
+	similarities []float64
+	// least holds the Worst least similar inputs, the most similar of them
+	// on top.
+	least comparisonHeap
+}
+
+func newModelComparer(c *Client, opts Options, records *RecordWriter) *modelComparer {
+	worst := opts.CompareModels.Worst
+	if worst == 0 {
+		worst = DefaultCompareWorst
+	}
+	return &modelComparer{
+		c:       c,
+		opts:    opts,
+		records: records,
+		worst:   worst,
+		result:  ModelComparison{ModelA: opts.CompareModels.ModelA, ModelB: opts.CompareModels.ModelB},
+	}
+}
+
+// compareFile compares the non-blank lines of opts.InputFile, a window at a
+// time.
+func (m *modelComparer) compareFile(ctx context.Context) error {
+	in, err := os.Open(m.opts.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var size int64
+	if info, err := in.Stat(); err == nil {
+		size = info.Size()
+	}
+	counter := &countingReader{r: in}
+	scanner := bufio.NewScanner(counter)
+	scanner.Buffer(nil, DefaultMaxFrameSize)
+	progress := newEmbedProgress(m.opts, size)
+	var (
+		line    int64
+		texts   []string
+		indices []int64
+	)
+	flush := func() error {
+		if err := m.compareAt(ctx, texts, indices); err != nil {
+			return fmt.Errorf("%s: line %d: %w", m.opts.InputFile, indices[0]+1, err)
+		}
+		progress.done(int64(len(texts)), line, counter.n.Load())
+		texts, indices = texts[:0], indices[:0]
+		return nil
+	}
+	for scanner.Scan() {
+		line++
+		if text := strings.TrimSpace(scanner.Text()); text != "" {
+			texts = append(texts, text)
+			indices = append(indices, line-1)
+		}
+		if int(line)%embedFileWindow == 0 && len(texts) > 0 {
+			if m.stopped() {
+				m.result.Interrupted = true
+				return nil
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", m.opts.InputFile, err)
+	}
+	if len(texts) > 0 {
+		if m.stopped() {
+			m.result.Interrupted = true
+			return nil
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	progress.finish(line)
+	return nil
+}
+
+func (m *modelComparer) stopped() bool {
+	select {
+	case <-m.opts.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// compareAt embeds texts with both models at once and compares each pair.
+func (m *modelComparer) compareAt(ctx context.Context, texts []string, indices []int64) error {
+	cm := m.opts.CompareModels
+	embed := func(model string, info *EmbedInfo) ([][]float32, error) {
+		embedOpts := []EmbedOption{WithModel(model), WithEmbedInfo(info)}
+		if m.opts.Concurrency > 0 {
+			embedOpts = append(embedOpts, WithConcurrency(m.opts.Concurrency))
+		}
+		vecs, err := m.c.EmbedBatch(ctx, texts, embedOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+		return vecs, nil
+	}
+	var infoA, infoB EmbedInfo
+	var vecsB [][]float32
+	var errB error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		vecsB, errB = embed(cm.ModelB, &infoB)
+	}()
+	vecsA, errA := embed(cm.ModelA, &infoA)
+	<-done
+	if err := errors.Join(errA, errB); err != nil {
+		return err
+	}
+	if m.result.VersionA == "" {
+		m.result.VersionA = infoA.ModelVersion
+	}
+	if m.result.VersionB == "" {
+		m.result.VersionB = infoB.ModelVersion
+	}
+	for i, a := range vecsA {
+		b := vecsB[i]
+		if m.result.Inputs == 0 {
+			m.result.DimensionA, m.result.DimensionB = len(a), len(b)
+		}
+		m.result.Inputs++
+		ic := InputComparison{Index: indices[i], DimensionA: len(a), DimensionB: len(b)}
+		sim, err := vectors.Cosine(a, b)
+		switch {
+		case errors.Is(err, vectors.ErrLengthMismatch):
+			m.result.DimensionMismatches++
+			ic.Error = "dimension mismatch"
+		case err != nil:
+			m.result.ZeroVectors++
+			ic.Error = err.Error()
+		default:
+			s := float64(sim)
+			ic.Similarity = &s
+			m.result.Compared++
+			m.similarities = append(m.similarities, s)
+		}
+		if m.records != nil {
+			if err := m.records.Write(ic); err != nil {
+				return fmt.Errorf("write comparison: %w", err)
+			}
+		}
+		if ic.Similarity != nil {
+			m.keepWorst(ic, texts[i])
+		}
+	}
+	// A table is aligned as a whole, so only the other formats stream.
+	if m.records != nil && m.opts.Output.Format != OutputTable {
+		if err := m.records.Flush(); err != nil {
+			return fmt.Errorf("write comparison: %w", err)
+		}
+	}
+	return nil
+}
+
+// keepWorst keeps ic among the least similar inputs if it is one.
+func (m *modelComparer) keepWorst(ic InputComparison, text string) {
+	if len(m.least) == m.worst {
+		if *ic.Similarity >= *m.least[0].Similarity {
+			return
+		}
+		heap.Pop(&m.least)
+	}
+	ic.Text = text
+	heap.Push(&m.least, ic)
+}
+
+// report returns the comparison of every input compared.
+func (m *modelComparer) report() ModelComparison {
+	r := m.result
+	r.Worst = append([]InputComparison{}, m.least...)
+	sort.Slice(r.Worst, func(i, j int) bool {
+		a, b := r.Worst[i], r.Worst[j]
+		if *a.Similarity != *b.Similarity {
+			return *a.Similarity < *b.Similarity
+		}
+		return a.Index < b.Index
+	})
+	sorted := m.similarities
+	if len(sorted) == 0 {
+		return r
+	}
+	sort.Float64s(sorted)
+	var sum float64
+	for _, s := range sorted {
+		sum += s
+	}
+	mean := sum / float64(len(sorted))
+	var dev float64
+	for _, s := range sorted {
+		dev += (s - mean) * (s - mean)
+	}
+	r.Similarity = SimilarityStats{
+		Mean:   mean,
+		StdDev: math.Sqrt(dev / float64(len(sorted))),
+		Min:    sorted[0],
+		P1:     similarityPercentile(sorted, 1),
+		P5:     similarityPercentile(sorted, 5),
+		P50:    similarityPercentile(sorted, 50),
+		P95:    similarityPercentile(sorted, 95),
+		Max:    sorted[len(sorted)-1],
+	}
+	return r
+}
+
+// similarityPercentile returns the nearest-rank p-th percentile of sorted,
+// which must not be empty.
+func similarityPercentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// comparisonHeap is a max-heap of compared inputs by similarity, the later
+// input on top among equals, so the least similar inputs, the first of
+// equals, are the ones kept.
+type comparisonHeap []InputComparison
+
+func (h comparisonHeap) Len() int { return len(h) }
+func (h comparisonHeap) Less(i, j int) bool {
+	if *h[i].Similarity != *h[j].Similarity {
+		return *h[i].Similarity > *h[j].Similarity
+	}
+	return h[i].Index > h[j].Index
+}
+func (h comparisonHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *comparisonHeap) Push(x any)   { *h = append(*h, x.(InputComparison)) }
+func (h *comparisonHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compareHandler embeds with model v1 as defaultHandler does, with v2
+// moves the inputs holding "drift", and with v3 adds a dimension.
+func compareHandler(req Request) (Response, error) {
+	resp := *defaultHandler(&req)
+	if req.Method != MethodEmbed {
+		return resp, nil
+	}
+	var params embedParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Model == "v1" {
+		return resp, err
+	}
+	entries := make([]embeddingEntry, len(params.Inputs))
+	for i, input := range params.Inputs {
+		v := []float32{float32(len(input)), 0.5, -0.5}
+		switch {
+		case params.Model == "v3":
+			v = append(v, 1)
+		case strings.Contains(input, "drift"):
+			v = []float32{0, 1, 1}
+		}
+		entries[i] = embeddingEntry{Index: i, Vector: v}
+	}
+	resp.Result, _ = json.Marshal(embedResult{Model: params.Model, Embeddings: entries})
+	return resp, nil
+}
+
+func TestRunCompareModels(t *testing.T) {
+	run := func(t *testing.T, modelB string, opts Options) string {
+		t.Helper()
+		var out strings.Builder
+		opts.Config = ClientConfig{Transport: TransportInProc, Handler: compareHandler}
+		opts.CompareModels = CompareModels{ModelA: "v1", ModelB: modelB, Worst: 2}
+		opts.Stdout = &out
+		if err := RunCompareModels(context.Background(), opts); err != nil {
+			t.Fatalf("RunCompareModels: %v", err)
+		}
+		return out.String()
+	}
+
+	t.Run("json", func(t *testing.T) {
+		out := run(t, "v2", Options{Inputs: []string{"alpha", "drift far", "beta", "gamma", "drift more"}})
+		var r ModelComparison
+		if err := json.Unmarshal([]byte(out), &r); err != nil {
+			t.Fatalf("report %q: %v", out, err)
+		}
+		if r.ModelA != "v1" || r.ModelB != "v2" || r.Inputs != 5 || r.Compared != 5 || r.DimensionMismatches != 0 || r.DimensionA != 3 || r.DimensionB != 3 {
+			t.Fatalf("report %+v", r)
+		}
+		if s := r.Similarity; s.Max < 0.9999 || s.Min >= 0.5 || s.Min > s.P50 || s.P50 > s.Max || s.Mean <= s.Min || s.StdDev <= 0 {
+			t.Fatalf("similarity %+v", s)
+		}
+		// The two drifted inputs are the worst, the earlier first of equals.
+		if len(r.Worst) != 2 || r.Worst[0].Index != 1 || r.Worst[0].Text != "drift far" || r.Worst[1].Index != 4 || *r.Worst[0].Similarity > *r.Worst[1].Similarity {
+			t.Fatalf("worst %+v", r.Worst)
+		}
+	})
+
+	t.Run("ndjson file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sample.txt")
+		var lines strings.Builder
+		for i := 0; i < embedFileWindow+10; i++ {
+			switch {
+			case i == 7:
+				fmt.Fprintln(&lines, "drift seven")
+			case i%1000 == 3:
+				fmt.Fprintln(&lines)
+			default:
+				fmt.Fprintf(&lines, "line %d\n", i)
+			}
+		}
+		if err := os.WriteFile(path, []byte(lines.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var progress strings.Builder
+		out := run(t, "v2", Options{InputFile: path, Output: Renderer{Format: OutputNDJSON}, Progress: &progress})
+		records := strings.Split(strings.TrimSpace(out), "\n")
+		blank := (embedFileWindow + 10 + 996) / 1000
+		if len(records) != embedFileWindow+10-blank {
+			t.Fatalf("%d records, want %d", len(records), embedFileWindow+10-blank)
+		}
+		var drifted InputComparison
+		if err := json.Unmarshal([]byte(records[6]), &drifted); err != nil || drifted.Index != 7 || drifted.Similarity == nil || *drifted.Similarity > 0.5 || drifted.DimensionB != 3 {
+			t.Fatalf("record %s: %v", records[6], err)
+		}
+		summary := fmt.Sprintf("v2 against v1: %d inputs, %d compared, mean 0.99", len(records), len(records))
+		if !strings.Contains(progress.String(), summary) || !strings.Contains(progress.String(), "0 dimension mismatches") {
+			t.Fatalf("progress:\n%s", progress.String())
+		}
+	})
+
+	t.Run("dimension mismatch", func(t *testing.T) {
+		out := run(t, "v3", Options{Inputs: []string{"alpha", "beta"}})
+		var r ModelComparison
+		if err := json.Unmarshal([]byte(out), &r); err != nil {
+			t.Fatalf("report %q: %v", out, err)
+		}
+		if r.Inputs != 2 || r.Compared != 0 || r.DimensionMismatches != 2 || r.DimensionA != 3 || r.DimensionB != 4 || len(r.Worst) != 0 || r.Similarity != (SimilarityStats{}) {
+			t.Fatalf("report %+v", r)
+		}
+	})
+
+	for _, opts := range []Options{
+		{Inputs: []string{"a"}},
+		{Inputs: []string{"a"}, CompareModels: CompareModels{ModelA: "v1"}},
+		{CompareModels: CompareModels{ModelA: "v1", ModelB: "v2"}},
+		{Inputs: []string{"a"}, InputFile: "x", CompareModels: CompareModels{ModelA: "v1", ModelB: "v2"}},
+	} {
+		if err := RunCompareModels(context.Background(), opts); err == nil {
+			t.Errorf("RunCompareModels(%+v) ran", opts)
+		}
+	}
+}
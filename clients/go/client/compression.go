@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentDecoder wraps a response body encoded with one Content-Encoding.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// The content codings built in: gzip from the standard library and zstd
+// from github.com/klauspost/compress.
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// zstdMaxWindow bounds the window a zstd response may ask the decoder to
+// hold, at the 8 MiB RFC 9659 sets for the zstd content coding.
+const zstdMaxWindow = 8 << 20
+
+// decodeZstd is the built-in zstd ContentDecoder. It decodes on the
+// reading goroutine, and closing the body releases the decoder.
+func decodeZstd(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// contentCodecs negotiates and decodes response encodings for the http and
+// tls transports.
+type contentCodecs struct {
+	decoders       map[string]ContentDecoder
+	acceptEncoding string
+	compressAbove  int
+}
+
+func newContentCodecs(cfg ClientConfig) contentCodecs {
+	decoders := map[string]ContentDecoder{
+		encodingGzip: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		encodingZstd: decodeZstd,
+	}
+	for name, dec := range cfg.ContentDecoders {
+		decoders[strings.ToLower(name)] = dec
+	}
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return contentCodecs{decoders: decoders, acceptEncoding: strings.Join(names, ", "), compressAbove: cfg.CompressRequestsAbove}
+}
+
+// encodeRequest gzips body when it exceeds the configured threshold and
+// returns the Content-Encoding to send, if any.
+func (c contentCodecs) encodeRequest(body []byte) ([]byte, string, error) {
+	if c.compressAbove <= 0 || len(body) <= c.compressAbove {
+		return body, "", nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), encodingGzip, nil
+}
+
+// decodeResponse wraps body according to its Content-Encoding header.
+func (c contentCodecs) decodeResponse(encoding string, body io.Reader) (io.ReadCloser, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == "identity" {
+		return io.NopCloser(body), nil
+	}
+	dec, ok := c.decoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	r, err := dec(body)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", encoding, err)
+	}
+	return r, nil
+}
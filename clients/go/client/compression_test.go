@@ -0,0 +1,166 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodingServer serves defaultHandler, encoding responses with encode when
+// the client advertises encoding. It decompresses gzip request bodies and
+// counts them in gzipped, and keeps the last Accept-Encoding in accepted.
+func encodingServer(t *testing.T, encoding string, encode func(io.Writer) io.WriteCloser, gzipped *atomic.Int64) *httptest.Server {
+	t.Helper()
+	return encodingServerAccepting(t, encoding, encode, gzipped, nil)
+}
+
+func encodingServerAccepting(t *testing.T, encoding string, encode func(io.Writer) io.WriteCloser, gzipped *atomic.Int64, accepted *atomic.Value) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accepted != nil {
+			accepted.Store(r.Header.Get("Accept-Encoding"))
+		}
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+			gzipped.Add(1)
+		}
+		var req Request
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := io.Writer(w)
+		if encode != nil && strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+			w.Header().Set("Content-Encoding", encoding)
+			enc := encode(w)
+			defer enc.Close()
+			out = enc
+		}
+		_ = json.NewEncoder(out).Encode(defaultHandler(&req))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func gzipEncoder(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+// zstdEncoder counts the responses it encodes in encoded.
+func zstdEncoder(t *testing.T, encoded *atomic.Int64) func(io.Writer) io.WriteCloser {
+	return func(w io.Writer) io.WriteCloser {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			t.Error(err)
+		}
+		encoded.Add(1)
+		return zw
+	}
+}
+
+func TestHTTPResponseEncodingsDecodeIdentically(t *testing.T) {
+	var gzipped, zstdEncoded atomic.Int64
+	var accepted atomic.Value
+	servers := map[string]*httptest.Server{
+		"identity": encodingServer(t, "", nil, &gzipped),
+		"gzip":     encodingServer(t, "gzip", gzipEncoder, &gzipped),
+		"zstd":     encodingServerAccepting(t, "zstd", zstdEncoder(t, &zstdEncoded), &gzipped, &accepted),
+	}
+	results := map[string][]json.RawMessage{}
+	for name, srv := range servers {
+		sink := &recordingSink{}
+		c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Recorder: sink})
+		if err != nil {
+			t.Fatalf("%s: New: %v", name, err)
+		}
+		if _, err := c.Embed(context.Background(), strings.Repeat("payload ", 1000)); err != nil {
+			t.Fatalf("%s: Embed: %v", name, err)
+		}
+		c.Close(context.Background())
+		var resp Response
+		if err := json.Unmarshal(sink.entries[1].Message, &resp); err != nil {
+			t.Fatalf("%s: recorded response is not decoded JSON: %v", name, err)
+		}
+		results[name] = append(results[name], resp.Result)
+	}
+	for _, name := range []string{"gzip", "zstd"} {
+		if !reflect.DeepEqual(results["identity"], results[name]) {
+			t.Fatalf("decoded results differ:\nidentity %s\n%-8s %s", results["identity"], name, results[name])
+		}
+	}
+	if got := accepted.Load(); got != "gzip, zstd" {
+		t.Fatalf("Accept-Encoding %q, want gzip, zstd", got)
+	}
+	if zstdEncoded.Load() == 0 {
+		t.Fatal("no response was encoded with zstd")
+	}
+}
+
+func TestHTTPCompressesLargeRequests(t *testing.T) {
+	var gzipped atomic.Int64
+	srv := encodingServer(t, "", nil, &gzipped)
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, CompressRequestsAbove: 1 << 10})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "short"); err != nil {
+		t.Fatalf("small Embed: %v", err)
+	}
+	if gzipped.Load() != 0 {
+		t.Fatal("small request was compressed")
+	}
+	if _, err := c.Embed(ctx, strings.Repeat("x", 4<<10)); err != nil {
+		t.Fatalf("large Embed: %v", err)
+	}
+	if gzipped.Load() != 1 {
+		t.Fatal("large request was not compressed")
+	}
+}
+
+func TestHTTPCustomContentDecoder(t *testing.T) {
+	var gzipped atomic.Int64
+	b64 := func(w io.Writer) io.WriteCloser { return base64.NewEncoder(base64.StdEncoding, w) }
+	srv := encodingServer(t, "x-base64", b64, &gzipped)
+
+	decoders := map[string]ContentDecoder{
+		"x-base64": func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+		},
+	}
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, ContentDecoders: decoders})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	// Without the decoder the encoding is neither advertised nor accepted.
+	if got := newContentCodecs(ClientConfig{}).acceptEncoding; got != "gzip, zstd" {
+		t.Fatalf("unexpected default Accept-Encoding %q", got)
+	}
+	if got := newContentCodecs(ClientConfig{ContentDecoders: decoders}).acceptEncoding; got != "gzip, x-base64, zstd" {
+		t.Fatalf("Accept-Encoding %q with a custom decoder", got)
+	}
+	if _, err := newContentCodecs(ClientConfig{}).decodeResponse("x-base64", strings.NewReader("")); err == nil {
+		t.Fatal("expected an unsupported encoding error")
+	}
+}
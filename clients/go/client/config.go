@@ -0,0 +1,668 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Transport identifiers accepted by ClientConfig.Transport.
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+	TransportTLS   = "tls"
+	TransportUnix  = "unix"
+	// TransportWebSocket covers both ws:// and wss:// endpoints.
+	TransportWebSocket = "ws"
+	// TransportInProc serves requests with ClientConfig.Handler in memory.
+	TransportInProc = "inproc"
+)
+
+// Default endpoints mirror the ones captured in the golden fixtures.
+const (
+	DefaultHTTPEndpoint = "http://127.0.0.1:8890/mcp"
+	DefaultTLSEndpoint  = "https://localhost:9443/mcp"
+	DefaultModel        = "text-embedding-3-large"
+)
+
+// Connection pool defaults for the http and tls transports.
+const (
+	DefaultMaxIdleConns    = 100
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// ClientConfig describes how a Client reaches the MCP server.
+type ClientConfig struct {
+	// Transport selects the wire transport (stdio, http, tls, http3, grpc,
+	// ws, unix, or inproc).
+	Transport string
+	// Endpoint is the server URL for the http, tls, grpc, and ws transports. With
+	// Transport unset, its scheme picks the transport as ParseEndpoint does.
+	Endpoint string
+	// Command is the server executable and arguments spawned by the stdio
+	// transport.
+	Command []string
+	// SocketPath is the filesystem path dialed by the unix transport.
+	SocketPath string
+	// APIKey is sent as an "Authorization: Bearer" header by the http, tls,
+	// and http3 transports and with the WebSocket handshake, and as
+	// Meta.Authorization by the stdio, unix, and inproc transports, which
+	// have no headers. It is attached past the transcript recorder and left
+	// out of debug logs, so it is never recorded or logged.
+	APIKey Secret
+	// APIKeyFile, in place of APIKey, names a file holding the key on one
+	// line, trailing newline trimmed, such as a mounted Kubernetes secret.
+	APIKeyFile string
+	// TokenSource, in place of APIKey, supplies the tokens requests present
+	// in the same way, such as OAuth2 access tokens. A token is fetched
+	// when the first request needs one and again when it nears its expiry,
+	// once for all the requests waiting on it, and a request the server
+	// rejects with a 401 is retried once with a fresh token. A failing
+	// source fails the request with ErrAuthRefresh. Over ws the token is
+	// presented when the connection is opened.
+	TokenSource TokenSource
+	// Signing, when its KeyID is set, signs every request of the http, tls,
+	// and http3 transports with an HMAC over its body and checks the
+	// signatures of responses; see SigningConfig.
+	Signing SigningConfig
+	// CredentialReloadInterval, when positive, has APIKeyFile and the
+	// TLSClientCert and TLSClientKey files checked for changes at most this
+	// often, on the next request or handshake, so rotated credentials are
+	// picked up without a restart. Reloaded credentials apply to new
+	// requests and connections, while open connections drain with the old
+	// ones. A file that fails to load keeps the previous credentials in use
+	// and is logged as an error.
+	CredentialReloadInterval time.Duration
+	// OnCredentialReload, when set, is called with the fingerprints of the
+	// old and new credentials after each reload.
+	OnCredentialReload func(CredentialReload)
+	// TracerProvider, when set, traces every request with a client span
+	// named after its method, propagating its context to the server as a
+	// W3C traceparent; see TracerProvider.
+	TracerProvider TracerProvider
+	// WireDump, when set, receives a hex dump of every byte the client
+	// sends and receives, below the JSON encoding and framing, with
+	// direction markers and timestamps. Over tls the bytes are those inside
+	// TLS, which restricts the connection to HTTP/1.1 and is not available
+	// through a proxy; http3 and inproc cannot be dumped. A configuration
+	// with credentials is refused unless WireDumpUnsafe is set.
+	WireDump io.Writer
+	// WireDumpMaxBytes bounds the bytes shown of each read or write; zero
+	// selects DefaultWireDumpMaxBytes.
+	WireDumpMaxBytes int
+	// WireDumpUnsafe allows WireDump to show API keys and tokens.
+	WireDumpUnsafe bool
+	// Metrics, when set, receives request counts, latencies, retries,
+	// cache lookups, and bytes exchanged; see MetricsSink.
+	Metrics MetricsSink
+	// Handler answers requests for the inproc transport.
+	Handler Handler
+	// TLSConfig is an optional base configuration (for example RootCAs) for
+	// the tls and wss transports. It is cloned before the TLS* fields below
+	// are applied on top of it.
+	TLSConfig *tls.Config
+	// TLSClientCert and TLSClientKey are PEM files holding the client
+	// certificate chain and private key presented for mutual TLS. Both must be
+	// set together.
+	TLSClientCert string
+	TLSClientKey  string
+	// TLSCAFiles lists PEM bundles trusted for server verification instead of
+	// the system store.
+	TLSCAFiles []string
+	// TLSPinSHA256 pins the server leaf certificate's SubjectPublicKeyInfo
+	// SHA-256 digest (hex or base64). The handshake fails with
+	// ErrCertPinMismatch unless one pin matches; chain verification still
+	// applies.
+	TLSPinSHA256 []string
+	// TLSAllowedSANs, after chain and hostname verification, requires each
+	// DNS SAN of the server leaf certificate to match one of these names,
+	// exactly or, for a pattern such as "*.example.com", in its leftmost
+	// label. A wildcard SAN must appear as is. The handshake fails with
+	// ErrSANNotAllowed, listing the SANs presented.
+	TLSAllowedSANs []string
+	// TLSMinVersion is the lowest protocol version accepted from the server:
+	// "1.0", "1.1", "1.2", or "1.3". Empty keeps TLSConfig's MinVersion, or
+	// TLS 1.2 when that is unset. A server below it fails with
+	// ErrTLSVersionTooLow.
+	TLSMinVersion string
+	// TLSCipherSuites restricts the TLS 1.0-1.2 cipher suites offered, by
+	// IANA name (for example TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256). TLS 1.3
+	// suites are not configurable.
+	TLSCipherSuites []string
+	// WSHandshakeTimeout bounds the WebSocket dial and opening handshake.
+	WSHandshakeTimeout time.Duration
+	// WSPingInterval is the WebSocket keepalive period. The connection is
+	// torn down when no pong arrives within two intervals.
+	WSPingInterval time.Duration
+	// HTTP3RoundTripper builds the QUIC round tripper used by the http3
+	// transport from the TLS configuration derived from the TLS* fields,
+	// such as embedhttp3.RoundTripper. Its errors wrap ErrHTTP3Unavailable
+	// when no connection could be established. Closing the client closes
+	// it if it is an io.Closer.
+	HTTP3RoundTripper func(*tls.Config) http.RoundTripper
+	// AllowFallback lets the http3 transport switch to HTTP/2 over TCP when
+	// a round trip fails with ErrHTTP3Unavailable or no HTTP3RoundTripper
+	// is set.
+	AllowFallback bool
+	// DialTimeout bounds connection setup for the http, tls, stdio, and unix
+	// transports: the TCP dial and TLS handshake, process start, or socket
+	// dial. Expiry surfaces as ErrDialTimeout.
+	DialTimeout time.Duration
+	// ReadTimeout bounds how long a request waits for its response once the
+	// request has been sent. Expiry surfaces as ErrReadTimeout.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds sending a request; for stdio it is how long the
+	// subprocess may take to accept input. Expiry surfaces as
+	// ErrWriteTimeout.
+	WriteTimeout time.Duration
+	// ProxyURL routes the http and tls transports through an http://,
+	// https://, or socks5:// proxy; credentials may be given as user:pass@.
+	// When empty, HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are honored.
+	ProxyURL string
+	// DNS looks the endpoint's host name up again on an interval and
+	// spreads new connections across its addresses. The zero value
+	// disables it.
+	DNS DNSPolicy
+	// Framing selects how the stdio, unix, and inproc transports delimit
+	// envelopes: FramingNewline (the default) or FramingLengthPrefixed. Both
+	// ends must be configured alike; the mode is not negotiated.
+	Framing string
+	// MaxFrameSize bounds an inbound frame on those transports. Larger frames
+	// fail with ErrFrameTooLarge. Zero selects DefaultMaxFrameSize.
+	MaxFrameSize int
+	// MaxPipelineDepth lets the stdio, unix, and inproc transports write up
+	// to this many requests to their stream before the first is answered,
+	// routing each response to its request by ID, so a slow request no
+	// longer holds up the ones behind it. Zero or one sends one request at
+	// a time.
+	MaxPipelineDepth int
+	// MaxResponseBytes bounds the response to one request over the http,
+	// tls, http3, stdio, and unix transports, after any Content-Encoding is
+	// removed; a streamed response counts all its frames. Larger responses
+	// fail with ErrResponseTooLarge before more is buffered, and
+	// WithMaxResponseBytes overrides the limit for a call. Zero selects
+	// DefaultMaxResponseBytes.
+	MaxResponseBytes int
+	// MaxRequestBytes bounds the encoded params of one request, as
+	// Stats.BytesSent counts them. A larger request fails with
+	// ErrRequestTooLarge before it is sent, and WithMaxRequestBytes
+	// overrides the limit for a call. Zero sets no limit.
+	MaxRequestBytes int
+	// MaxIdleConns and MaxIdleConnsPerHost cap the idle keep-alive
+	// connections the http and tls transports hold for reuse. Zero selects
+	// DefaultMaxIdleConns; MaxIdleConnsPerHost defaults to MaxIdleConns since
+	// a client talks to a single server.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes keep-alive connections left idle this long. Zero
+	// selects DefaultIdleConnTimeout.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives makes the http and tls transports use a fresh
+	// connection for every request.
+	DisableKeepAlives bool
+	// CompressRequestsAbove gzips http and tls request bodies larger than
+	// this many bytes. Zero sends every body uncompressed.
+	CompressRequestsAbove int
+	// ContentDecoders adds response Content-Encodings to the gzip and zstd
+	// the http and tls transports decode, or replaces the decoder of one of
+	// those. Every key is advertised in Accept-Encoding.
+	ContentDecoders map[string]ContentDecoder
+	// HeartbeatInterval enables heartbeats on the http and tls transports:
+	// after this long without a call an unrecorded mcp.ping is sent, and TCP
+	// keepalive probes idle sockets at the same period. Zero disables them.
+	HeartbeatInterval time.Duration
+	// HeartbeatTimeout bounds each heartbeat ping. Zero uses the interval.
+	HeartbeatTimeout time.Duration
+	// HeartbeatFailures is how many consecutive failed heartbeats tear the
+	// pooled connections down so the next call re-dials. Zero selects
+	// DefaultHeartbeatFailures.
+	HeartbeatFailures int
+	// MaxRestarts is how many times the stdio transport may respawn a server
+	// that exited or closed its pipes over the transport's lifetime. Zero
+	// disables restarts. A request that was lost with the server is replayed
+	// on the new process when it is safe to resend; otherwise it fails with
+	// ErrConnectionLost and the next request triggers the restart.
+	MaxRestarts int
+	// RestartBackoff is the delay before the first restart, doubling for each
+	// further restart. Zero selects DefaultRestartBackoff.
+	RestartBackoff time.Duration
+	// OnReconnect, when set, is called after each successful restart. It runs
+	// while the transport is locked and must not call back into the Client.
+	OnReconnect func(ReconnectEvent)
+	// ForceProtocolVersion, for debugging, offers only this protocol version
+	// during the handshake and uses it whatever the server answers.
+	ForceProtocolVersion string
+	// WireProtocol selects the envelopes exchanged with the server:
+	// WireNative (the default when empty), JSONRPC2, for servers that
+	// speak plain JSON-RPC 2.0, or OpenAICompat, for servers offering the
+	// OpenAI embeddings API instead. It is not negotiated.
+	WireProtocol string
+	// Codecs names the codecs, such as CodecMsgPack and CodecCBOR or any
+	// other registered with package codec, offered at the handshake in
+	// order of preference besides CodecJSON. Once the server
+	// picks one, the envelopes of the http, tls, and http3 transports travel
+	// in it, but for JSON-RPC 2.0 batches, notifications, and streamed
+	// responses; the other transports offer none. Transcripts record each
+	// envelope as JSON and the codec in their header. Of the codecs only
+	// CodecCBOR, whose encoding is deterministic, can be combined with
+	// Signing, which then covers the CBOR bytes sent.
+	Codecs []string
+	// Codec, when set, names the codec every envelope of the http, tls,
+	// and http3 transports travels in from the handshake on, for servers
+	// configured to expect it; Codecs is then not offered.
+	Codec string
+	// Model is the embedding model used when a call does not name one.
+	Model string
+	// MaxBatchSize caps the inputs EmbedBatch sends per request. Zero uses
+	// the limit advertised in the server's capabilities.
+	MaxBatchSize int
+	// ValidateModel makes EmbedBatch check Model against ListModels before
+	// sending any input, failing with ErrModelNotFound for a model the
+	// server does not list.
+	ValidateModel bool
+	// Retry retries calls that fail with a transient error. The zero value
+	// disables retries.
+	Retry RetryPolicy
+	// RateLimit paces the requests the client sends, including retries.
+	// The zero value sends them unthrottled.
+	RateLimit RateLimit
+	// CircuitBreaker fast-fails calls after repeated connection failures.
+	// The zero value disables it.
+	CircuitBreaker CircuitBreaker
+	// Spool, when set, keeps the WithSpoolOnFailure calls that cannot
+	// reach the server and replays them once it answers. The caller opens
+	// it with OpenSpool; it serves this client alone, which releases it on
+	// Close.
+	Spool *Spool
+	// Hedging sends a second copy of slow replayable requests and takes
+	// the first answer. The zero value disables it.
+	Hedging HedgePolicy
+	// EventListener, when set, learns of connections opened, reused, and
+	// closed, failovers, retries, circuit breaker transitions, and
+	// high-priority calls kept waiting; see EventListener.
+	EventListener EventListener
+	// EventListenerTimeout is how long an EventListener method may run
+	// before the listener is dropped; zero selects
+	// DefaultEventListenerTimeout.
+	EventListenerTimeout time.Duration
+	// Notifications bounds the notifications buffered for
+	// Client.Notifications; see NotificationPolicy.
+	Notifications NotificationPolicy
+	// SlowRequests reports calls slower than its thresholds. The zero value
+	// disables it.
+	SlowRequests SlowRequestPolicy
+	// StreamResume has EmbedStream resume streams whose connection was
+	// lost. The zero value disables it.
+	StreamResume StreamResumePolicy
+	// Capabilities bounds how long the cached model list is trusted. The
+	// zero value keeps it until the server's answers show it stale.
+	Capabilities CapabilityPolicy
+	// MaxInFlight bounds the requests outstanding at once across every
+	// goroutine sharing the client; further calls block until a slot frees
+	// or their context is done. A stream holds its slot until it closes.
+	// Zero means unlimited.
+	MaxInFlight int
+	// Scheduling orders the calls waiting for a MaxInFlight slot by their
+	// priority; see SchedulingPolicy.
+	Scheduling SchedulingPolicy
+	// Cache serves repeated Embed and EmbedBatch inputs from memory, or
+	// from a DiskCache across restarts. The zero value disables it.
+	Cache CacheConfig
+	// MaxBufferedVectors bounds the vectors a JobResult.Vectors iterator
+	// holds at once, and so the size of the pages it asks for. Zero selects
+	// DefaultMaxBufferedVectors.
+	MaxBufferedVectors int
+	// Coalescing merges the single-input embeds of concurrent callers into
+	// batch requests. The zero value disables it.
+	Coalescing CoalescingPolicy
+	// SingleFlight shares one request between concurrent Embed calls for
+	// the same input, model, and dimensions, each getting its own copy of
+	// the vector or the error. A call ending early leaves the request to
+	// the others; the last to leave cancels it. With Cache set, the shared
+	// request fills the cache once.
+	SingleFlight bool
+	// Preprocess runs the inputs of Embed, EmbedBatch, and the calls
+	// built on them through its steps before they are embedded; see
+	// WithPreprocessor. EmbedStream and jobs send their inputs as given.
+	Preprocess []PreprocessStep
+	// Interceptors wrap every request in order; see Interceptor.
+	Interceptors []Interceptor
+	// Recorder, when set, receives every envelope exchanged by the client.
+	Recorder Recorder
+	// Logger, when set, receives a debug record for every request, with its
+	// ID and the size of both envelopes, info records for every dial and
+	// TLS handshake, and a warning for every retry, circuit breaker
+	// transition, and slow request, each tagged with the transport. Without one nothing is
+	// logged.
+	Logger *slog.Logger
+	// LogBodies adds the request and response envelopes to the debug
+	// records. They carry the inputs and vectors, so it is off by default.
+	LogBodies bool
+	// DryRun answers every request in the client instead of sending it; see
+	// WithDryRun.
+	DryRun bool
+	// LaxValidation passes the vectors of embed responses through without
+	// checking their length and values; see WithLaxValidation.
+	LaxValidation bool
+	// RequireChecksums fails embed responses without checksums; see
+	// WithRequireChecksums.
+	RequireChecksums bool
+	// StrictDecoding rejects responses holding fields the client does not
+	// know; see WithStrictDecoding.
+	StrictDecoding bool
+
+	// creds holds the credentials loaded from files, shared by the copies
+	// of the configuration a client and its transport hold.
+	creds *credentialFiles
+}
+
+// Secret is a credential that formats as "[REDACTED]", in logs, %v of a
+// ClientConfig, and JSON alike, so it does not leak into debug output.
+type Secret string
+
+func (Secret) String() string { return "[REDACTED]" }
+
+func (s Secret) GoString() string { return `"[REDACTED]"` }
+
+func (s Secret) MarshalJSON() ([]byte, error) { return []byte(`"[REDACTED]"`), nil }
+
+// withDefaults returns a copy of cfg with unset fields populated.
+func (cfg ClientConfig) withDefaults() ClientConfig {
+	if cfg.Transport == "" && cfg.Endpoint != "" {
+		if e, err := ParseEndpoint(cfg.Endpoint); err == nil {
+			_ = e.apply(&cfg, e.Transport)
+		}
+	}
+	if cfg.Transport == "" {
+		cfg.Transport = TransportStdio
+	}
+	if cfg.Endpoint == "" {
+		switch cfg.Transport {
+		case TransportHTTP:
+			cfg.Endpoint = DefaultHTTPEndpoint
+		case TransportTLS, TransportHTTP3:
+			cfg.Endpoint = DefaultTLSEndpoint
+		case TransportGRPC:
+			cfg.Endpoint = DefaultGRPCEndpoint
+		}
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.WSHandshakeTimeout == 0 {
+		cfg.WSHandshakeTimeout = DefaultWSHandshakeTimeout
+	}
+	if cfg.WSPingInterval == 0 {
+		cfg.WSPingInterval = DefaultWSPingInterval
+	}
+	if cfg.Framing == "" {
+		cfg.Framing = FramingNewline
+	}
+	if cfg.MaxFrameSize == 0 {
+		cfg.MaxFrameSize = DefaultMaxFrameSize
+	}
+	if cfg.MaxResponseBytes == 0 {
+		cfg.MaxResponseBytes = DefaultMaxResponseBytes
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+	if cfg.IdleConnTimeout == 0 {
+		cfg.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if cfg.RestartBackoff == 0 {
+		cfg.RestartBackoff = DefaultRestartBackoff
+	}
+	cfg.Retry = cfg.Retry.withDefaults()
+	if cfg.Signing.enabled() {
+		cfg.Signing = cfg.Signing.withDefaults()
+	}
+	return cfg
+}
+
+// Validate reports configuration errors before any connection is attempted.
+func (cfg ClientConfig) Validate() error {
+	if strings.ContainsAny(string(cfg.APIKey), "\r\n") {
+		return errors.New("api key must not contain line breaks")
+	}
+	if cfg.APIKey != "" && cfg.TokenSource != nil || cfg.APIKeyFile != "" && cfg.TokenSource != nil {
+		return errors.New("an api key and a token source cannot be combined")
+	}
+	if cfg.APIKey != "" && cfg.APIKeyFile != "" {
+		return errors.New("an api key and an api key file cannot be combined")
+	}
+	if cfg.CredentialReloadInterval < 0 {
+		return errors.New("credential reload interval must not be negative")
+	}
+	if err := cfg.Signing.validate(cfg.Transport); err != nil {
+		return err
+	}
+	if err := cfg.validateWireDump(); err != nil {
+		return err
+	}
+	if (cfg.TLSClientCert == "") != (cfg.TLSClientKey == "") {
+		return errors.New("tls client certificate and key must be provided together")
+	}
+	if cfg.TLSMinVersion != "" {
+		if _, err := parseTLSVersion(cfg.TLSMinVersion); err != nil {
+			return err
+		}
+	}
+	if _, err := parseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		return err
+	}
+	if _, err := parseSANPatterns(cfg.TLSAllowedSANs); err != nil {
+		return err
+	}
+	if cfg.DialTimeout < 0 || cfg.ReadTimeout < 0 || cfg.WriteTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if !validFraming(cfg.Framing) {
+		return fmt.Errorf("unknown framing %q: want %s or %s", cfg.Framing, FramingNewline, FramingLengthPrefixed)
+	}
+	if !validWireProtocol(cfg.WireProtocol) {
+		return unknownWireProtocol(cfg.WireProtocol)
+	}
+	if cfg.WireProtocol == OpenAICompat {
+		switch {
+		case cfg.Transport != TransportHTTP && cfg.Transport != TransportTLS && cfg.Transport != TransportHTTP3:
+			return fmt.Errorf("the %s wire protocol needs the http, tls, or http3 transport, not %s", OpenAICompat, cfg.Transport)
+		case cfg.Signing.enabled():
+			return fmt.Errorf("signing covers JSON-RPC envelopes, which the %s wire protocol does not send", OpenAICompat)
+		}
+	}
+	if err := validateCodecs(cfg.Codecs); err != nil {
+		return err
+	}
+	if cfg.Codec != "" {
+		if err := validateCodec(cfg.Codec); err != nil {
+			return err
+		}
+		if cfg.Codec != CodecJSON && (cfg.WireProtocol == OpenAICompat || cfg.Transport != TransportHTTP && cfg.Transport != TransportTLS && cfg.Transport != TransportHTTP3) {
+			return fmt.Errorf("codec %s needs the http, tls, or http3 transport in the native or %s wire protocol", cfg.Codec, JSONRPC2)
+		}
+	}
+	if cfg.Signing.enabled() {
+		for _, name := range append([]string{cfg.Codec}, cfg.Codecs...) {
+			if name != "" && name != CodecJSON && name != CodecCBOR {
+				return fmt.Errorf("signing covers the bytes of envelopes, which only the deterministic %s codec encodes the same way every time, not %s", CodecCBOR, name)
+			}
+		}
+	}
+	if cfg.MaxFrameSize < 0 {
+		return errors.New("max frame size must not be negative")
+	}
+	if cfg.MaxResponseBytes < 0 {
+		return errors.New("max response bytes must not be negative")
+	}
+	if cfg.MaxRequestBytes < 0 {
+		return errors.New("max request bytes must not be negative")
+	}
+	if err := cfg.validatePipeline(); err != nil {
+		return err
+	}
+	if cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 || cfg.IdleConnTimeout < 0 {
+		return errors.New("connection pool limits must not be negative")
+	}
+	if cfg.CompressRequestsAbove < 0 {
+		return errors.New("request compression threshold must not be negative")
+	}
+	if cfg.HeartbeatInterval < 0 || cfg.HeartbeatTimeout < 0 || cfg.HeartbeatFailures < 0 {
+		return errors.New("heartbeat settings must not be negative")
+	}
+	if cfg.MaxRestarts < 0 || cfg.RestartBackoff < 0 {
+		return errors.New("restart limits must not be negative")
+	}
+	if cfg.MaxBatchSize < 0 {
+		return errors.New("max batch size must not be negative")
+	}
+	if cfg.MaxInFlight < 0 {
+		return errors.New("max in-flight requests must not be negative")
+	}
+	if cfg.MaxBufferedVectors < 0 {
+		return errors.New("max buffered vectors must not be negative")
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		return err
+	}
+	if err := cfg.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := cfg.CircuitBreaker.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Hedging.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Cache.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Coalescing.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Scheduling.validate(); err != nil {
+		return err
+	}
+	if err := cfg.DNS.validate(); err != nil {
+		return err
+	}
+	if _, err := newPreprocessor(cfg.Preprocess); err != nil {
+		return fmt.Errorf("preprocess: %w", err)
+	}
+	if err := cfg.Notifications.validate(); err != nil {
+		return err
+	}
+	if cfg.EventListenerTimeout < 0 {
+		return errors.New("event listener timeout must not be negative")
+	}
+	if err := cfg.SlowRequests.validate(); err != nil {
+		return err
+	}
+	if err := cfg.StreamResume.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Capabilities.validate(); err != nil {
+		return err
+	}
+	// The stdio and unix transports ignore Endpoint, so a URL there names a
+	// server they would not reach.
+	if cfg.Endpoint != "" && (cfg.Transport == TransportStdio || cfg.Transport == TransportUnix) {
+		if e, err := ParseEndpoint(cfg.Endpoint); err == nil && !e.accepts(cfg.Transport) {
+			return fmt.Errorf("the %s transport cannot reach endpoint %q, which selects the %s transport", cfg.Transport, cfg.Endpoint, e.Transport)
+		}
+	}
+	switch cfg.Transport {
+	case TransportStdio:
+		if len(cfg.Command) == 0 {
+			return errors.New("stdio transport requires a server command")
+		}
+	case TransportHTTP, TransportTLS, TransportHTTP3:
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+		}
+		want := "http"
+		if cfg.Transport != TransportHTTP {
+			want = "https"
+		}
+		if u.Scheme != want {
+			return fmt.Errorf("%s transport requires a %s:// endpoint, got %q", cfg.Transport, want, cfg.Endpoint)
+		}
+		if cfg.Transport == TransportHTTP3 && cfg.HTTP3RoundTripper == nil && !cfg.AllowFallback {
+			return errors.New("http3 transport requires an HTTP3RoundTripper or AllowFallback")
+		}
+		if cfg.ProxyURL != "" {
+			if _, err := parseProxyURL(cfg.ProxyURL); err != nil {
+				return err
+			}
+		}
+	case TransportGRPC:
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+		}
+		if u.Scheme != "grpc" && u.Scheme != "grpcs" || u.Host == "" {
+			return fmt.Errorf("grpc transport requires a grpc:// or grpcs:// endpoint, got %q", cfg.Endpoint)
+		}
+		if cfg.WireProtocol != "" && cfg.WireProtocol != WireNative {
+			return fmt.Errorf("the grpc transport sends proto messages, not the %s wire protocol", cfg.WireProtocol)
+		}
+		if cfg.ProxyURL != "" {
+			if _, err := parseProxyURL(cfg.ProxyURL); err != nil {
+				return err
+			}
+		}
+	case TransportWebSocket:
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return fmt.Errorf("ws transport requires a ws:// or wss:// endpoint, got %q", cfg.Endpoint)
+		}
+		if cfg.WSHandshakeTimeout < 0 || cfg.WSPingInterval < 0 {
+			return errors.New("websocket timeouts must not be negative")
+		}
+	case TransportInProc:
+		if cfg.Handler == nil {
+			return errors.New("inproc transport requires a handler")
+		}
+	case TransportUnix:
+		if cfg.SocketPath == "" {
+			return errors.New("unix transport requires a socket path")
+		}
+		if !filepath.IsAbs(cfg.SocketPath) {
+			return fmt.Errorf("unix socket path must be absolute, got %q", cfg.SocketPath)
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+	return nil
+}
+
+// endpointLabel is the endpoint advertised during the handshake.
+func (cfg ClientConfig) endpointLabel() string {
+	switch cfg.Transport {
+	case TransportStdio:
+		return "stdio://session"
+	case TransportUnix:
+		return "unix://" + cfg.SocketPath
+	case TransportInProc:
+		return "inproc://session"
+	default:
+		if cfg.Endpoint == "" {
+			return cfg.Transport + "://session"
+		}
+		return cfg.Endpoint
+	}
+}
@@ -0,0 +1,586 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A configuration file is a YAML mapping of the embednexus CLI flag names to
+// their values, so the same file serves the CLI and library callers:
+//
+//	transport: tls
+//	endpoint: https://embed.internal:9443/mcp
+//	tls-ca: [ca.pem]
+//	request-timeout: 5s
+//
+// Nested mappings join their keys with "-" (tls: {ca: ...} is tls-ca), "_"
+// is read as "-", and lists are written inline or as "- item" lines. Only
+// this subset of YAML is understood: scalars, lists of scalars, mappings,
+// and comments.
+
+// ConfigFile is a parsed configuration file.
+type ConfigFile struct {
+	// Path is where the file was read from, prefixed to its errors.
+	Path    string
+	entries []configEntry
+}
+
+type configEntry struct {
+	key    string
+	values []string
+	line   int
+	// env names the variable an entry of the environment came from.
+	env string
+}
+
+// where locates e in error messages.
+func (f *ConfigFile) where(e configEntry) string {
+	if e.env != "" {
+		return e.env
+	}
+	return fmt.Sprintf("%s:%d", f.Path, e.line)
+}
+
+// ConfigWarning reports a key of a ConfigFile nothing reads.
+type ConfigWarning struct {
+	Path string
+	Line int
+	Key  string
+	// Suggestion is the known key closest to Key, when one is close.
+	Suggestion string
+}
+
+func (w ConfigWarning) String() string {
+	s := fmt.Sprintf("%s:%d: unknown key %q", w.Path, w.Line, w.Key)
+	if w.Suggestion != "" {
+		s += fmt.Sprintf(" (did you mean %q?)", w.Suggestion)
+	}
+	return s
+}
+
+// DefaultConfigPath is the configuration file read when none is named:
+// embednexus/config.yaml below $XDG_CONFIG_HOME, or below ~/.config when
+// that is unset. It is empty when neither can be determined.
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "embednexus", "config.yaml")
+}
+
+// LoadConfigFile reads and parses the configuration file at path.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfigFile(path, data)
+}
+
+// ParseConfigFile parses data, the configuration file at path.
+func ParseConfigFile(path string, data []byte) (*ConfigFile, error) {
+	f := &ConfigFile{Path: path}
+	type parent struct {
+		indent int
+		prefix string
+	}
+	var (
+		parents []parent
+		// open is the entry of a key with nothing after its colon, which
+		// the following lines make a list, a mapping, or leave empty.
+		open       *configEntry
+		openIndent int
+		list       *configEntry
+		seen       = make(map[string]int)
+	)
+	add := func(e configEntry) error {
+		if first, ok := seen[e.key]; ok {
+			return fmt.Errorf("%s:%d: key %q repeats line %d", path, e.line, e.key, first)
+		}
+		seen[e.key] = e.line
+		f.entries = append(f.entries, e)
+		return nil
+	}
+	closeOpen := func() error {
+		if open == nil {
+			return nil
+		}
+		e := *open
+		open = nil
+		return add(e)
+	}
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := i + 1
+		text := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		content := strings.TrimLeft(text, " ")
+		if content == "" || line == 1 && content == "---" {
+			continue
+		}
+		indent := len(text) - len(content)
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("%s:%d: indent with spaces, not tabs", path, line)
+		}
+		if item, ok := strings.CutPrefix(content, "-"); ok && (item == "" || item[0] == ' ') {
+			switch {
+			case open != nil && indent >= openIndent:
+				list, open = open, nil
+				list.values = []string{}
+				if err := add(*list); err != nil {
+					return nil, err
+				}
+				list = &f.entries[len(f.entries)-1]
+			case list == nil:
+				return nil, fmt.Errorf("%s:%d: list item outside a list", path, line)
+			}
+			v, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			list.values = append(list.values, v)
+			continue
+		}
+		list = nil
+		key, rest, ok := strings.Cut(content, ":")
+		if !ok || rest != "" && rest[0] != ' ' {
+			return nil, fmt.Errorf("%s:%d: want key: value, got %q", path, line, content)
+		}
+		if open != nil {
+			if indent > openIndent {
+				parents = append(parents, parent{openIndent, open.key + "-"})
+				open = nil
+			} else if err := closeOpen(); err != nil {
+				return nil, err
+			}
+		}
+		for len(parents) > 0 && indent <= parents[len(parents)-1].indent {
+			parents = parents[:len(parents)-1]
+		}
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+		if len(parents) > 0 {
+			key = parents[len(parents)-1].prefix + key
+		}
+		e := configEntry{key: key, line: line}
+		rest = strings.TrimSpace(rest)
+		switch {
+		case rest == "":
+			open, openIndent = &e, indent
+			continue
+		case strings.HasPrefix(rest, "["):
+			inner, ok := strings.CutSuffix(rest[1:], "]")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: unterminated list %s", path, line, rest)
+			}
+			e.values = []string{}
+			if strings.TrimSpace(inner) != "" {
+				for _, item := range strings.Split(inner, ",") {
+					v, err := yamlScalar(strings.TrimSpace(item))
+					if err != nil {
+						return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+					}
+					e.values = append(e.values, v)
+				}
+			}
+		default:
+			v, err := yamlScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			e.values = []string{v}
+		}
+		if err := add(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := closeOpen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// stripYAMLComment cuts line at a "#" that starts a comment: outside quotes
+// and at the start or after a space.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar returns the value of a plain, single-, or double-quoted scalar.
+// null and ~ are empty.
+func yamlScalar(s string) (string, error) {
+	switch {
+	case s == "~" || s == "null":
+		return "", nil
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("malformed double-quoted value %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("malformed single-quoted value %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// Keys lists the keys of f in the order they appear.
+func (f *ConfigFile) Keys() []string {
+	keys := make([]string, len(f.entries))
+	for i, e := range f.entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+// Lookup returns the values of key, or of its alias: one for a scalar,
+// any number for a list. Of a key given twice, under its name and an
+// alias, the later wins.
+func (f *ConfigFile) Lookup(key string) ([]string, bool) {
+	e, ok := f.lookup(key)
+	return e.values, ok
+}
+
+// Line returns the line key is set on, or 0.
+func (f *ConfigFile) Line(key string) int {
+	e, _ := f.lookup(key)
+	return e.line
+}
+
+func (f *ConfigFile) lookup(key string) (configEntry, bool) {
+	var found configEntry
+	ok := false
+	for _, e := range f.entries {
+		if e.key == key || canonicalConfigKey(e.key) == key {
+			found, ok = e, true
+		}
+	}
+	return found, ok
+}
+
+// Unknown reports the keys of f that are not among known, each with the
+// nearest known key as a suggestion when it is a likely typo.
+func (f *ConfigFile) Unknown(known []string) []ConfigWarning {
+	var warnings []ConfigWarning
+	for _, e := range f.entries {
+		best, bestDistance := "", len(e.key)/3+2
+		found := false
+		for _, k := range known {
+			if k == e.key {
+				found = true
+				break
+			}
+			if d := editDistance(e.key, k); d < bestDistance {
+				best, bestDistance = k, d
+			}
+		}
+		if !found {
+			warnings = append(warnings, ConfigWarning{Path: f.Path, Line: e.line, Key: e.key, Suggestion: best})
+		}
+	}
+	return warnings
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// configFields maps the keys ConfigFile.Config reads onto ClientConfig,
+// named after the CLI flags setting the same fields.
+var configFields = map[string]func(cfg *ClientConfig, values []string) error{
+	"transport":                  configString(func(c *ClientConfig) *string { return &c.Transport }),
+	"endpoint":                   configString(func(c *ClientConfig) *string { return &c.Endpoint }),
+	"command":                    func(c *ClientConfig, v []string) error { c.Command = configCommand(v); return nil },
+	"socket":                     configString(func(c *ClientConfig) *string { return &c.SocketPath }),
+	"api-key":                    func(c *ClientConfig, v []string) error { s, err := configScalar(v); c.APIKey = Secret(s); return err },
+	"api-key-file":               configString(func(c *ClientConfig) *string { return &c.APIKeyFile }),
+	"credential-reload-interval": configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.CredentialReloadInterval} }),
+	"model":                      configString(func(c *ClientConfig) *string { return &c.Model }),
+	"tls-client-cert":            configString(func(c *ClientConfig) *string { return &c.TLSClientCert }),
+	"tls-client-key":             configString(func(c *ClientConfig) *string { return &c.TLSClientKey }),
+	"tls-ca":                     configList(func(c *ClientConfig) *[]string { return &c.TLSCAFiles }),
+	"tls-pin-sha256":             configList(func(c *ClientConfig) *[]string { return &c.TLSPinSHA256 }),
+	"tls-allowed-san":            configList(func(c *ClientConfig) *[]string { return &c.TLSAllowedSANs }),
+	"tls-min-version":            configString(func(c *ClientConfig) *string { return &c.TLSMinVersion }),
+	"tls-ciphers":                configList(func(c *ClientConfig) *[]string { return &c.TLSCipherSuites }),
+	"ws-handshake-timeout":       configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.WSHandshakeTimeout} }),
+	"ws-ping-interval":           configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.WSPingInterval} }),
+	"dial-timeout":               configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.DialTimeout} }),
+	"request-timeout":            configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.ReadTimeout, &c.WriteTimeout} }),
+	"framing":                    configString(func(c *ClientConfig) *string { return &c.Framing }),
+	"wire-protocol":              configString(func(c *ClientConfig) *string { return &c.WireProtocol }),
+	"codecs":                     configList(func(c *ClientConfig) *[]string { return &c.Codecs }),
+	"codec":                      configString(func(c *ClientConfig) *string { return &c.Codec }),
+	"max-frame-size":             configInt(func(c *ClientConfig) *int { return &c.MaxFrameSize }),
+	"max-response-bytes":         configInt(func(c *ClientConfig) *int { return &c.MaxResponseBytes }),
+	"max-request-bytes":          configInt(func(c *ClientConfig) *int { return &c.MaxRequestBytes }),
+	"proxy-url":                  configString(func(c *ClientConfig) *string { return &c.ProxyURL }),
+	"dns-refresh":                configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.DNS.Refresh} }),
+	"dns-spread":                 configString(func(c *ClientConfig) *string { return &c.DNS.Spread }),
+	"compress-requests-above":    configInt(func(c *ClientConfig) *int { return &c.CompressRequestsAbove }),
+	"capability-ttl":             configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.Capabilities.TTL} }),
+	"heartbeat-interval":         configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.HeartbeatInterval} }),
+	"heartbeat-timeout":          configDuration(func(c *ClientConfig) []*time.Duration { return []*time.Duration{&c.HeartbeatTimeout} }),
+	"max-restarts":               configInt(func(c *ClientConfig) *int { return &c.MaxRestarts }),
+	"allow-fallback":             configBool(func(c *ClientConfig) *bool { return &c.AllowFallback }),
+	"force-protocol-version":     configString(func(c *ClientConfig) *string { return &c.ForceProtocolVersion }),
+}
+
+// configAliases are further names of keys: the shorter environment
+// variables that read better in a container spec.
+var configAliases = map[string]string{
+	"timeout": "request-timeout",
+}
+
+// canonicalConfigKey resolves an alias to the key it stands for.
+func canonicalConfigKey(key string) string {
+	if k, ok := configAliases[key]; ok {
+		return k
+	}
+	return key
+}
+
+// ConfigKeys lists the keys ConfigFile.Config reads, aliases included.
+func ConfigKeys() []string {
+	keys := make([]string, 0, len(configFields)+len(configAliases))
+	for k := range configFields {
+		keys = append(keys, k)
+	}
+	for k := range configAliases {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Config returns the ClientConfig f describes, with a warning for each key
+// it does not read. An endpoint implies its transport as in NewClient, and
+// a unix:// endpoint sets the socket path.
+func (f *ConfigFile) Config() (ClientConfig, []ConfigWarning, error) {
+	var cfg ClientConfig
+	var errs []error
+	for _, e := range f.entries {
+		set, ok := configFields[canonicalConfigKey(e.key)]
+		if !ok {
+			continue
+		}
+		if err := set(&cfg, e.values); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", f.where(e), e.key, err))
+		}
+	}
+	if cfg.Endpoint != "" {
+		endpoint := cfg.Endpoint
+		cfg.Endpoint = ""
+		if err := applyEndpoint(&cfg, endpoint); err != nil {
+			for _, e := range f.entries {
+				if e.key == "endpoint" {
+					errs = append(errs, fmt.Errorf("%s: %w", f.where(e), err))
+				}
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return ClientConfig{}, nil, err
+	}
+	return cfg, f.Unknown(ConfigKeys()), nil
+}
+
+// WithConfigFile loads the configuration file at path as the base
+// configuration, as WithConfig does. Keys it does not read are ignored;
+// callers wanting them reported use LoadConfigFile and ConfigFile.Config.
+func WithConfigFile(path string) Option {
+	return func(o *clientOptions) error {
+		f, err := LoadConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("WithConfigFile: %w", err)
+		}
+		cfg, _, err := f.Config()
+		if err != nil {
+			return fmt.Errorf("WithConfigFile: %w", err)
+		}
+		o.cfg = cfg
+		return nil
+	}
+}
+
+// RecorderConfigKeys lists the keys ConfigFile.RecorderConfig reads, named
+// after the CLI flags setting the same fields.
+var RecorderConfigKeys = []string{"redact", "no-default-redactions", "anonymize", "anonymize-salt"}
+
+// RecorderConfig returns the redactions and anonymization f describes,
+// such as the rules file of "embednexus transcript scrub":
+//
+//	redact:
+//	  - customer_id
+//	  - /messages/*/message/params/inputs
+//	anonymize-salt: team-salt
+//
+// As with the flags, an anonymize-salt implies anonymize. Keys it does
+// not read are reported as warnings.
+func (f *ConfigFile) RecorderConfig() (RecorderConfig, []ConfigWarning, error) {
+	var cfg RecorderConfig
+	var errs []error
+	flag := func(e configEntry, field *bool) {
+		v, err := configScalar(e.values)
+		if err == nil {
+			if *field, err = strconv.ParseBool(v); err != nil {
+				err = fmt.Errorf("want true or false, got %q", v)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", f.where(e), e.key, err))
+		}
+	}
+	for _, e := range f.entries {
+		switch e.key {
+		case "redact":
+			cfg.Redactions = append(cfg.Redactions, e.values...)
+		case "no-default-redactions":
+			flag(e, &cfg.NoDefaultRedactions)
+		case "anonymize":
+			flag(e, &cfg.Anonymize)
+		case "anonymize-salt":
+			salt, err := configScalar(e.values)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", f.where(e), e.key, err))
+			}
+			cfg.AnonymizeSalt = salt
+		}
+	}
+	cfg.Anonymize = cfg.Anonymize || cfg.AnonymizeSalt != ""
+	if err := errors.Join(errs...); err != nil {
+		return RecorderConfig{}, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return RecorderConfig{}, nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	return cfg, f.Unknown(RecorderConfigKeys), nil
+}
+
+func configScalar(values []string) (string, error) {
+	if len(values) != 1 {
+		return "", fmt.Errorf("want a single value, got %d", len(values))
+	}
+	return values[0], nil
+}
+
+func configString(field func(*ClientConfig) *string) func(*ClientConfig, []string) error {
+	return func(c *ClientConfig, values []string) error {
+		v, err := configScalar(values)
+		*field(c) = v
+		return err
+	}
+}
+
+// configList also splits a scalar at commas, as the matching flags do.
+func configList(field func(*ClientConfig) *[]string) func(*ClientConfig, []string) error {
+	return func(c *ClientConfig, values []string) error {
+		var out []string
+		for _, v := range values {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					out = append(out, item)
+				}
+			}
+		}
+		*field(c) = out
+		return nil
+	}
+}
+
+// configCommand takes a command line as a scalar, split at spaces as by
+// --command, or as a list of arguments.
+func configCommand(values []string) []string {
+	if len(values) == 1 {
+		return strings.Fields(values[0])
+	}
+	return values
+}
+
+func configDuration(fields func(*ClientConfig) []*time.Duration) func(*ClientConfig, []string) error {
+	return func(c *ClientConfig, values []string) error {
+		v, err := configScalar(values)
+		if err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		for _, p := range fields(c) {
+			*p = d
+		}
+		return nil
+	}
+}
+
+func configInt(field func(*ClientConfig) *int) func(*ClientConfig, []string) error {
+	return func(c *ClientConfig, values []string) error {
+		v, err := configScalar(values)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("want an integer, got %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func configBool(field func(*ClientConfig) *bool) func(*ClientConfig, []string) error {
+	return func(c *ClientConfig, values []string) error {
+		v, err := configScalar(values)
+		if err != nil {
+			return err
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("want true or false, got %q", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleConfig = `---
+# Reach the staging embedder over TLS.
+transport: tls
+endpoint: "https://embed.internal:9443/mcp"  # quoted
+tls:
+  ca: [ca.pem, 'extra ca.pem']
+  pin_sha256:
+    - abc#def
+    - "012"
+request-timeout: 5s
+command: zaevrynth-server --stdio
+max_frame_size: 1024
+allow-fallback: true
+tls-cipher: TLS_AES_128_GCM_SHA256
+`
+
+func TestParseConfigFile(t *testing.T) {
+	f, err := ParseConfigFile("config.yaml", []byte(sampleConfig))
+	if err != nil {
+		t.Fatalf("ParseConfigFile: %v", err)
+	}
+	want := []string{"transport", "endpoint", "tls-ca", "tls-pin-sha256", "request-timeout", "command", "max-frame-size", "allow-fallback", "tls-cipher"}
+	if got := f.Keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys %q, want %q", got, want)
+	}
+	for key, values := range map[string][]string{
+		"endpoint":       {"https://embed.internal:9443/mcp"},
+		"tls-ca":         {"ca.pem", "extra ca.pem"},
+		"tls-pin-sha256": {"abc#def", "012"},
+	} {
+		if got, _ := f.Lookup(key); !reflect.DeepEqual(got, values) {
+			t.Errorf("%s = %q, want %q", key, got, values)
+		}
+	}
+	if line := f.Line("request-timeout"); line != 10 {
+		t.Errorf("request-timeout on line %d, want 10", line)
+	}
+
+	cfg, warnings, err := f.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if cfg.Transport != TransportTLS || cfg.Endpoint != "https://embed.internal:9443/mcp" || cfg.ReadTimeout != 5*time.Second || cfg.WriteTimeout != 5*time.Second {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Command, []string{"zaevrynth-server", "--stdio"}) || cfg.MaxFrameSize != 1024 || !cfg.AllowFallback || len(cfg.TLSCAFiles) != 2 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if len(warnings) != 1 || warnings[0].String() != `config.yaml:14: unknown key "tls-cipher" (did you mean "tls-ciphers"?)` {
+		t.Fatalf("warnings %v", warnings)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	for doc, want := range map[string]string{
+		"transport: tls\ntransport: http\n": `c.yaml:2: key "transport" repeats line 1`,
+		"transport tls\n":                   "c.yaml:1: want key: value",
+		"- stray\n":                         "c.yaml:1: list item outside a list",
+		"tls-ca: [a.pem\n":                  "c.yaml:1: unterminated list",
+		"endpoint: \"open\n":                "c.yaml:1: malformed double-quoted value",
+		"tls:\n\tca: a.pem\n":               "c.yaml:2: indent with spaces",
+	} {
+		if _, err := ParseConfigFile("c.yaml", []byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error %v, want %q", doc, err, want)
+		}
+	}
+	f, err := ParseConfigFile("c.yaml", []byte("dial-timeout: soon\nmax-restarts: [1, 2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = f.Config()
+	if err == nil || !strings.Contains(err.Error(), "c.yaml:1: dial-timeout") || !strings.Contains(err.Error(), "c.yaml:2: max-restarts: want a single value") {
+		t.Fatalf("Config error %v", err)
+	}
+}
+
+func TestConfigFileRecorderConfig(t *testing.T) {
+	f, err := ParseConfigFile("scrub.yaml", []byte("redact:\n  - customer_id\n  - /messages/*/message/params/inputs\nanonymize-salt: team\nanonymize: false\nno_default_redactions: true\nanonymise: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, warnings, err := f.RecorderConfig()
+	if err != nil {
+		t.Fatalf("RecorderConfig: %v", err)
+	}
+	want := RecorderConfig{Redactions: []string{"customer_id", "/messages/*/message/params/inputs"}, NoDefaultRedactions: true, Anonymize: true, AnonymizeSalt: "team"}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("config %+v, want %+v", cfg, want)
+	}
+	if len(warnings) != 1 || warnings[0].Suggestion != "anonymize" {
+		t.Fatalf("warnings %v", warnings)
+	}
+	for _, doc := range []string{"anonymize: maybe\n", "redact: ['[unclosed']\n"} {
+		f, err := ParseConfigFile("scrub.yaml", []byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.RecorderConfig(); err == nil {
+			t.Errorf("%q accepted", doc)
+		}
+	}
+}
+
+func TestWithConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("endpoint: unix:///run/embed.sock\nmodel: small\nunknown: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o, err := newClientOptions("", []Option{WithConfigFile(path), WithTimeout(time.Second)})
+	if err != nil {
+		t.Fatalf("WithConfigFile: %v", err)
+	}
+	if o.cfg.Transport != TransportUnix || o.cfg.SocketPath != "/run/embed.sock" || o.cfg.Model != "small" || o.cfg.ReadTimeout != time.Second {
+		t.Fatalf("unexpected config %+v", o.cfg)
+	}
+	if _, err := newClientOptions("", []Option{WithConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))}); err == nil {
+		t.Fatal("a missing file was accepted")
+	}
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/etc/xdg")
+	if got := DefaultConfigPath(); got != filepath.Join("/etc/xdg", "embednexus", "config.yaml") {
+		t.Fatalf("DefaultConfigPath() = %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// TransportConn is the default kind reported by NewConnTransport.
+const TransportConn = "conn"
+
+// errConnNotRedialable is reported if a conn transport is asked to dial again
+// after its stream was lost; the caller owns the only stream it has.
+var errConnNotRedialable = errors.New("conn transport cannot reopen a caller-supplied stream")
+
+// ConnOptions configures NewConnTransport.
+type ConnOptions struct {
+	// Kind is the transport identifier reported by Kind and recorded in
+	// transcripts. Empty selects TransportConn.
+	Kind string
+	// ReadTimeout and WriteTimeout behave as the ClientConfig fields of the
+	// same name do for stdio.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Framing and MaxFrameSize select the frame encoding as for stdio; the
+	// defaults are FramingNewline and DefaultMaxFrameSize.
+	Framing      string
+	MaxFrameSize int
+	// MaxPipelineDepth behaves as the ClientConfig field of the same name.
+	MaxPipelineDepth int
+}
+
+// NewConnTransport carries the protocol over rwc (an SSH channel, a serial
+// line, a net.Conn) with the same framing as the stdio transport.
+// The stream is used as-is: it is never redialed, and once it fails every
+// later call reports ErrConnectionLost. Close closes rwc.
+func NewConnTransport(rwc io.ReadWriteCloser, opts ConnOptions) Transport {
+	kind := opts.Kind
+	if kind == "" {
+		kind = TransportConn
+	}
+	t := newStreamTransport(kind, func(context.Context) (io.ReadWriteCloser, error) {
+		return nil, errConnNotRedialable
+	}, streamOptions{
+		timeouts:      timeouts{read: opts.ReadTimeout, write: opts.WriteTimeout},
+		framing:       newFraming(opts.Framing, opts.MaxFrameSize),
+		label:         kind + "://session",
+		pipelineDepth: opts.MaxPipelineDepth,
+	})
+	t.attach(rwc)
+	return t
+}
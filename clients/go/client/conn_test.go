@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// choppyConn accepts and returns at most a few bytes per call, as some
+// channel implementations do.
+type choppyConn struct {
+	net.Conn
+}
+
+func (c choppyConn) Read(b []byte) (int, error) {
+	if len(b) > 3 {
+		b = b[:3]
+	}
+	return c.Conn.Read(b)
+}
+
+func (c choppyConn) Write(b []byte) (int, error) {
+	if len(b) > 5 {
+		b = b[:5]
+	}
+	return c.Conn.Write(b)
+}
+
+// pipeServer serves defaultHandler on the far end of a net.Pipe and returns
+// the near end.
+func pipeServer(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	client, server = net.Pipe()
+	go func() {
+		_ = serveStream(server, server, defaultHandler)
+		server.Close()
+	}()
+	t.Cleanup(func() { server.Close() })
+	return client, server
+}
+
+func TestConnTransportOverPipe(t *testing.T) {
+	near, _ := pipeServer(t)
+	sink := &recordingSink{}
+	c := NewWithTransport(ClientConfig{Recorder: sink}, NewConnTransport(choppyConn{near}, ConnOptions{Kind: "ssh"}))
+	defer c.Close(context.Background())
+
+	ctx := context.Background()
+	init, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if init.Session.ID != fakeSessionID {
+		t.Fatalf("unexpected session %+v", init.Session)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Embed(ctx, "over the pipe"); err != nil {
+			t.Fatalf("Embed %d: %v", i, err)
+		}
+	}
+	if len(sink.entries) != 8 {
+		t.Fatalf("expected 8 recorded entries, got %d", len(sink.entries))
+	}
+	if c.Config().Transport != "ssh" {
+		t.Fatalf("expected transport kind ssh, got %q", c.Config().Transport)
+	}
+}
+
+func TestConnTransportLostStream(t *testing.T) {
+	near, far := pipeServer(t)
+	c := NewWithTransport(ClientConfig{}, NewConnTransport(near, ConnOptions{}))
+	defer c.Close(context.Background())
+
+	ctx := context.Background()
+	if _, err := c.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	far.Close()
+	for i := 0; i < 2; i++ {
+		if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, ErrConnectionLost) {
+			t.Fatalf("call %d: expected ErrConnectionLost, got %v", i, err)
+		}
+	}
+}
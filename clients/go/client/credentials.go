@@ -0,0 +1,225 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Credential kinds reported by CredentialReload.
+const (
+	CredentialClientCert = "client_cert"
+	CredentialAPIKey     = "api_key"
+)
+
+// CredentialReload describes rotated credentials taking effect, passed to
+// ClientConfig.OnCredentialReload.
+type CredentialReload struct {
+	// Kind is CredentialClientCert or CredentialAPIKey.
+	Kind string
+	// Path is the file that changed: TLSClientCert, for a certificate whose
+	// key changed too, or APIKeyFile.
+	Path string
+	// OldFingerprint and NewFingerprint identify the credentials without
+	// revealing them: the SHA-256 of the leaf certificate, or a prefix of
+	// the SHA-256 of the API key, in hex.
+	OldFingerprint, NewFingerprint string
+}
+
+// credentialFiles holds the credentials loaded from ClientConfig's
+// TLSClientCert, TLSClientKey, and APIKeyFile. With a reload interval the
+// files are checked again, at most once per interval and only when a
+// credential is used, so an idle client does no work; files whose
+// modification time or size changed are reloaded and swapped in
+// atomically. Connections already open keep the credentials they were made
+// with until they close.
+type credentialFiles struct {
+	certFile, keyFile, apiKeyFile string
+	interval                      time.Duration
+	onReload                      func(CredentialReload)
+	log                           *slog.Logger
+
+	// mu admits one reload at a time; callers arriving meanwhile use the
+	// credentials in place.
+	mu        sync.Mutex
+	nextCheck atomic.Int64
+	cert      atomic.Pointer[loadedCert]
+	key       atomic.Pointer[loadedKey]
+}
+
+// fileStamp is what a reload compares to tell that a file changed.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func (s fileStamp) same(o fileStamp) bool { return s.mod.Equal(o.mod) && s.size == o.size }
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{mod: info.ModTime(), size: info.Size()}, nil
+}
+
+type loadedCert struct {
+	cert                *tls.Certificate
+	certStamp, keyStamp fileStamp
+	fingerprint         string
+}
+
+type loadedKey struct {
+	key         Secret
+	stamp       fileStamp
+	fingerprint string
+}
+
+// needsCredentialFiles reports whether cfg loads credentials a
+// credentialFiles must hold: an APIKeyFile, or a client certificate to
+// reload.
+func (cfg ClientConfig) needsCredentialFiles() bool {
+	return cfg.APIKeyFile != "" || cfg.CredentialReloadInterval > 0 && cfg.TLSClientCert != ""
+}
+
+// withCredentials returns cfg holding its loaded credential files, loading
+// them unless that was done already.
+func (cfg ClientConfig) withCredentials() (ClientConfig, error) {
+	if cfg.creds != nil || !cfg.needsCredentialFiles() {
+		return cfg, nil
+	}
+	cf := &credentialFiles{
+		apiKeyFile: cfg.APIKeyFile,
+		interval:   cfg.CredentialReloadInterval,
+		onReload:   cfg.OnCredentialReload,
+		log:        cfg.logger(),
+	}
+	if cfg.CredentialReloadInterval > 0 {
+		cf.certFile, cf.keyFile = cfg.TLSClientCert, cfg.TLSClientKey
+	}
+	if cf.certFile != "" {
+		cert, err := loadCert(cf.certFile, cf.keyFile)
+		if err != nil {
+			return cfg, err
+		}
+		cf.cert.Store(cert)
+	}
+	if cf.apiKeyFile != "" {
+		key, err := loadAPIKey(cf.apiKeyFile)
+		if err != nil {
+			return cfg, err
+		}
+		cf.key.Store(key)
+	}
+	cf.nextCheck.Store(time.Now().Add(cf.interval).UnixNano())
+	cfg.creds = cf
+	return cfg, nil
+}
+
+func loadCert(certFile, keyFile string) (*loadedCert, error) {
+	certStamp, err := statFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	keyStamp, err := statFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	sum := sha256.Sum256(pair.Certificate[0])
+	return &loadedCert{cert: &pair, certStamp: certStamp, keyStamp: keyStamp, fingerprint: hex.EncodeToString(sum[:])}, nil
+}
+
+func loadAPIKey(path string) (*loadedKey, error) {
+	stamp, err := statFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("api key file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("api key file: %w", err)
+	}
+	key := strings.TrimRight(string(data), "\r\n")
+	if key == "" || strings.ContainsAny(key, "\r\n") {
+		return nil, fmt.Errorf("api key file %s: want the key on one line", path)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return &loadedKey{key: Secret(key), stamp: stamp, fingerprint: hex.EncodeToString(sum[:6])}, nil
+}
+
+// refresh reloads the files that changed once the interval has passed. A
+// file that fails to load leaves the previous credentials in use and is
+// tried again after another interval.
+func (cf *credentialFiles) refresh() {
+	now := time.Now()
+	if cf.interval <= 0 || now.UnixNano() < cf.nextCheck.Load() || !cf.mu.TryLock() {
+		return
+	}
+	defer cf.mu.Unlock()
+	cf.nextCheck.Store(now.Add(cf.interval).UnixNano())
+
+	if old := cf.cert.Load(); old != nil {
+		certStamp, certErr := statFile(cf.certFile)
+		keyStamp, keyErr := statFile(cf.keyFile)
+		if err := errors.Join(certErr, keyErr); err != nil {
+			cf.log.Error("credential reload failed; keeping the previous client certificate", "path", cf.certFile, "err", err)
+		} else if !certStamp.same(old.certStamp) || !keyStamp.same(old.keyStamp) {
+			if cert, err := loadCert(cf.certFile, cf.keyFile); err != nil {
+				cf.log.Error("credential reload failed; keeping the previous client certificate", "path", cf.certFile, "err", err)
+			} else {
+				cf.cert.Store(cert)
+				cf.reloaded(CredentialReload{Kind: CredentialClientCert, Path: cf.certFile, OldFingerprint: old.fingerprint, NewFingerprint: cert.fingerprint})
+			}
+		}
+	}
+	if old := cf.key.Load(); old != nil {
+		if stamp, err := statFile(cf.apiKeyFile); err != nil {
+			cf.log.Error("credential reload failed; keeping the previous api key", "path", cf.apiKeyFile, "err", err)
+		} else if !stamp.same(old.stamp) {
+			if key, err := loadAPIKey(cf.apiKeyFile); err != nil {
+				cf.log.Error("credential reload failed; keeping the previous api key", "path", cf.apiKeyFile, "err", err)
+			} else {
+				cf.key.Store(key)
+				cf.reloaded(CredentialReload{Kind: CredentialAPIKey, Path: cf.apiKeyFile, OldFingerprint: old.fingerprint, NewFingerprint: key.fingerprint})
+			}
+		}
+	}
+}
+
+func (cf *credentialFiles) reloaded(ev CredentialReload) {
+	if ev.OldFingerprint == ev.NewFingerprint {
+		return
+	}
+	cf.log.Info("credentials reloaded", "kind", ev.Kind, "path", ev.Path, "old_fingerprint", ev.OldFingerprint, "new_fingerprint", ev.NewFingerprint)
+	if cf.onReload != nil {
+		cf.onReload(ev)
+	}
+}
+
+// clientCertificate is the tls.Config.GetClientCertificate presenting the
+// current certificate to each new handshake.
+func (cf *credentialFiles) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cf.refresh()
+	return cf.cert.Load().cert, nil
+}
+
+// apiKey returns the current key of APIKeyFile, or fixed when cf holds no
+// key file; cf may be nil.
+func (cf *credentialFiles) apiKey(fixed Secret) Secret {
+	if cf == nil || cf.apiKeyFile == "" {
+		return fixed
+	}
+	cf.refresh()
+	return cf.key.Load().key
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotate replaces the file at path and moves its modification time on, so
+// the change is seen even on filesystems with coarse timestamps.
+func rotate(t *testing.T, path string, content []byte) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIKeyFileReload(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		mu.Unlock()
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads []CredentialReload
+	var logs strings.Builder
+	c, err := New(ClientConfig{
+		Endpoint:                 srv.URL,
+		APIKeyFile:               path,
+		CredentialReloadInterval: time.Millisecond,
+		OnCredentialReload:       func(ev CredentialReload) { reloads = append(reloads, ev) },
+		Logger:                   slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ping := func() {
+		t.Helper()
+		time.Sleep(5 * time.Millisecond)
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+
+	ping()
+	rotate(t, path, []byte("second\n"))
+	ping()
+	// A rotation that cannot be used keeps the key in place.
+	rotate(t, path, []byte("\n"))
+	ping()
+
+	want := []string{"Bearer first", "Bearer second", "Bearer second"}
+	if strings.Join(seen, "|") != strings.Join(want, "|") {
+		t.Fatalf("server saw %q, want %q", seen, want)
+	}
+	fingerprint := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:6])
+	}
+	if len(reloads) != 1 || reloads[0].Kind != CredentialAPIKey || reloads[0].Path != path ||
+		reloads[0].OldFingerprint != fingerprint("first") || reloads[0].NewFingerprint != fingerprint("second") {
+		t.Fatalf("reloads %+v", reloads)
+	}
+	if !strings.Contains(logs.String(), "credential reload failed") || strings.Contains(logs.String(), "second") {
+		t.Fatalf("logs miss the failed reload or leak the key:\n%s", logs.String())
+	}
+
+	if _, err := New(ClientConfig{Endpoint: srv.URL, APIKeyFile: path}); err == nil {
+		t.Fatal("an unusable api key file was accepted")
+	}
+	if _, err := New(ClientConfig{Endpoint: srv.URL, APIKeyFile: path, APIKey: "k"}); err == nil {
+		t.Fatal("an api key and an api key file were combined")
+	}
+}
+
+func TestClientCertReload(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCA.issue(t, "localhost", false, "localhost").tls},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA.pool(),
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	first := clientCA.issue(t, "first", true)
+	certPath, keyPath := first.writeFiles(t, dir, "client")
+	var reloads []CredentialReload
+	c, err := New(ClientConfig{
+		Transport:     TransportTLS,
+		Endpoint:      srv.URL,
+		TLSConfig:     &tls.Config{RootCAs: serverCA.pool()},
+		TLSClientCert: certPath,
+		TLSClientKey:  keyPath,
+		// Every request opens a connection, so each one handshakes.
+		DisableKeepAlives:        true,
+		CredentialReloadInterval: time.Millisecond,
+		OnCredentialReload:       func(ev CredentialReload) { reloads = append(reloads, ev) },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ping := func() {
+		t.Helper()
+		time.Sleep(5 * time.Millisecond)
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+
+	ping()
+	second := clientCA.issue(t, "second", true)
+	rotate(t, certPath, second.certPEM)
+	// Half a rotation, the new certificate with the old key, is not used.
+	ping()
+	rotate(t, keyPath, second.keyPEM)
+	ping()
+
+	want := []string{"first", "first", "second"}
+	if strings.Join(seen, "|") != strings.Join(want, "|") {
+		t.Fatalf("server saw client certificates %q, want %q", seen, want)
+	}
+	fingerprint := func(c *testCert) string {
+		sum := sha256.Sum256(c.leaf.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+	if len(reloads) != 1 || reloads[0].Kind != CredentialClientCert || reloads[0].OldFingerprint != fingerprint(first) || reloads[0].NewFingerprint != fingerprint(second) {
+		t.Fatalf("reloads %+v", reloads)
+	}
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// EmbedInfo describes how an Embed or EmbedBatch call produced its vectors;
+// see WithEmbedInfo.
+type EmbedInfo struct {
+	// Dimensions is the length requested with WithDimensions, or 0.
+	Dimensions int
+	// ClientTruncated reports that the model cannot truncate server-side,
+	// so the client cut each vector to Dimensions and renormalized it.
+	ClientTruncated bool
+	// TruncatedInputs lists, in order, the indexes of the inputs WithTruncate
+	// trimmed to the model's token limit.
+	TruncatedInputs []int
+	// Usage sums the tokens the server reports the call's requests used. It
+	// is zero for servers that do not report them, EmbedNexus servers
+	// among them; a request shared by several calls is counted by one.
+	Usage Usage
+	// ModelVersion is the exact model version the server reports answering
+	// with. It is empty for servers that do not report one and when every
+	// input came from the cache.
+	ModelVersion string
+	// ServerTruncatedInputs lists, in order, the indexes of the inputs the
+	// server reports cutting to the model's limit. Inputs served from the
+	// cache or by a request shared with other calls are not reported.
+	ServerTruncatedInputs []int
+	// Chunks holds, per input, the chunks ClientConfig.Preprocess split it
+	// into and their vectors; it is nil without a preprocessor. With one,
+	// TruncatedInputs and ServerTruncatedInputs list the inputs any chunk
+	// of which was cut.
+	Chunks [][]Chunk
+	// RequestBytes and ResponseBytes sum the encoded params of the call's
+	// requests and the results and errors of their responses, every
+	// attempt included, as Stats.BytesSent and BytesReceived count them;
+	// like Usage, a request shared by several calls is counted by one.
+	RequestBytes, ResponseBytes int64
+}
+
+// Usage is the token count an embed result reports, as OpenAICompat
+// servers do.
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// resultTally collects what the results of the requests of one call report
+// besides their vectors.
+type resultTally struct {
+	prompt, total atomic.Int64
+	// sent and received count the bytes of the requests and responses.
+	sent, received atomic.Int64
+
+	mu           sync.Mutex
+	modelVersion string
+	// truncated holds the inputs the server reports truncating.
+	truncated map[string]bool
+}
+
+// resultTallyKey carries the *resultTally of a WithEmbedInfo call.
+type resultTallyKey struct{}
+
+// tallyUsage returns ctx collecting the usage and the other reports of the
+// call's requests for its WithEmbedInfo target.
+func (o *embedOptions) tallyUsage(ctx context.Context) context.Context {
+	if o.info == nil {
+		return ctx
+	}
+	o.usage = &resultTally{truncated: make(map[string]bool)}
+	return context.WithValue(ctx, resultTallyKey{}, o.usage)
+}
+
+// tallyResult counts the result r of a request for inputs towards the call
+// ctx belongs to, if it tallies them.
+func tallyResult(ctx context.Context, r *embedResult, inputs []string) {
+	tally, ok := ctx.Value(resultTallyKey{}).(*resultTally)
+	if !ok {
+		return
+	}
+	if r.Usage != nil {
+		tally.prompt.Add(int64(r.Usage.PromptTokens))
+		tally.total.Add(int64(r.Usage.TotalTokens))
+	}
+	tally.mu.Lock()
+	defer tally.mu.Unlock()
+	if tally.modelVersion == "" {
+		tally.modelVersion = r.ModelVersion
+	}
+	for _, e := range r.Embeddings {
+		if e.Truncated && e.Index >= 0 && e.Index < len(inputs) {
+			tally.truncated[inputs[e.Index]] = true
+		}
+	}
+}
+
+// tallyBytes counts the sizes of a request sent with ctx and of its
+// response, nil after a transport failure, towards the call ctx belongs
+// to, if it tallies them.
+func tallyBytes(ctx context.Context, req *Request, resp *Response) {
+	tally, ok := ctx.Value(resultTallyKey{}).(*resultTally)
+	if !ok {
+		return
+	}
+	tally.sent.Add(int64(requestBytes(req)))
+	tally.received.Add(int64(responseBytes(resp)))
+}
+
+// WithDimensions asks for vectors of n components, for models trained so
+// that a prefix of the embedding is itself an embedding. Models whose
+// ListModels entry sets Features.Dimensions receive n as the request's
+// "dimensions"; for the others the client truncates each vector to n and
+// renormalizes it. The call fails when n exceeds the model's native
+// dimension or the model is not listed.
+func WithDimensions(n int) EmbedOption {
+	return func(o *embedOptions) { o.dimensions = n }
+}
+
+// WithEmbedInfo stores how the call produced its vectors in info when it
+// returns any.
+func WithEmbedInfo(info *EmbedInfo) EmbedOption {
+	return func(o *embedOptions) { o.info = info }
+}
+
+// clientDimensionsKey marks a context whose embed requests are truncated by
+// the client; exchange records the dimension in the request's Meta.
+type clientDimensionsKey struct{}
+
+// planDimensions checks a WithDimensions request against the model and
+// decides who truncates.
+func (c *Client) planDimensions(ctx context.Context, o *embedOptions) error {
+	if o.dimensions <= 0 {
+		return nil
+	}
+	model, err := c.lookupModel(ctx, o.model)
+	if err != nil {
+		return err
+	}
+	// A model listed without its dimension is taken at its word.
+	if model.Dimension > 0 && o.dimensions > model.Dimension {
+		return fmt.Errorf("dimensions %d exceed the native dimension %d of model %q", o.dimensions, model.Dimension, model.Name)
+	}
+	o.clientTruncate = !model.Features.Dimensions
+	return nil
+}
+
+// reportInfo fills the WithEmbedInfo target of a successful call of
+// inputs, as planTruncation left them.
+func (o *embedOptions) reportInfo(inputs []string) {
+	if o.info == nil {
+		return
+	}
+	*o.info = EmbedInfo{Dimensions: o.dimensions, ClientTruncated: o.clientTruncate, TruncatedInputs: o.truncated}
+	if o.usage == nil {
+		return
+	}
+	o.info.Usage = Usage{PromptTokens: int(o.usage.prompt.Load()), TotalTokens: int(o.usage.total.Load())}
+	o.info.RequestBytes, o.info.ResponseBytes = o.usage.sent.Load(), o.usage.received.Load()
+	o.usage.mu.Lock()
+	defer o.usage.mu.Unlock()
+	o.info.ModelVersion = o.usage.modelVersion
+	for i, in := range inputs {
+		if o.usage.truncated[in] {
+			o.info.ServerTruncatedInputs = append(o.info.ServerTruncatedInputs, i)
+		}
+	}
+}
+
+// truncateVectors returns unit-length copies of the first n components of
+// each vector. A prefix with no direction is returned as is.
+func truncateVectors(in [][]float32, n int) ([][]float32, error) {
+	out := make([][]float32, len(in))
+	for i, v := range in {
+		if len(v) < n {
+			return nil, fmt.Errorf("%s: vector %d has %d components, fewer than the %d requested: %w", MethodEmbed, i, len(v), n, ErrProtocol)
+		}
+		t, err := vectors.Normalized(v[:n])
+		if errors.Is(err, vectors.ErrZeroVector) {
+			t = append([]float32(nil), v[:n]...)
+		}
+		out[i] = t
+	}
+	return out, nil
+}
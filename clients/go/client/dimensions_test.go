@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dimensionsHandler serves a model that truncates server-side.
+func dimensionsHandler(req *Request) *Response {
+	switch req.Method {
+	case MethodListModels:
+		models := []ModelInfo{{Name: DefaultModel, Dimension: 3, Features: ModelFeatures{Dimensions: true}}}
+		raw, _ := json.Marshal(listModelsResult{Models: models})
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	case MethodEmbed:
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		resp := defaultHandler(req)
+		if params.Dimensions > 0 {
+			var result embedResult
+			_ = json.Unmarshal(resp.Result, &result)
+			for i := range result.Embeddings {
+				result.Embeddings[i].Vector = result.Embeddings[i].Vector[:params.Dimensions]
+			}
+			result.EncodingFormat = ""
+			resp.Result, _ = json.Marshal(result)
+		}
+		return resp
+	}
+	return defaultHandler(req)
+}
+
+// lastEmbedRequest decodes the final embed request sink recorded.
+func lastEmbedRequest(t *testing.T, sink *recordingSink) (embedParams, Meta) {
+	t.Helper()
+	for i := len(sink.entries) - 1; i >= 0; i-- {
+		var req Request
+		if json.Unmarshal(sink.entries[i].Message, &req) == nil && req.Method == MethodEmbed {
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			return params, *req.Meta
+		}
+	}
+	t.Fatal("no embed request recorded")
+	return embedParams{}, Meta{}
+}
+
+func TestWithDimensionsClientTruncates(t *testing.T) {
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var info EmbedInfo
+	v, err := c.Embed(context.Background(), "abcd", WithDimensions(2), WithEmbedInfo(&info))
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	norm := math.Hypot(4, 0.5)
+	if len(v) != 2 || math.Abs(float64(v[0])-4/norm) > 1e-6 || math.Abs(float64(v[1])-0.5/norm) > 1e-6 {
+		t.Fatalf("expected a renormalized 2-dimensional prefix, got %v", v)
+	}
+	if !reflect.DeepEqual(info, EmbedInfo{Dimensions: 2, ClientTruncated: true, RequestBytes: info.RequestBytes, ResponseBytes: info.ResponseBytes}) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	params, meta := lastEmbedRequest(t, sink)
+	if params.Dimensions != 0 || meta.ClientDimensions != 2 {
+		t.Fatalf("transcript should mark client truncation: params %+v, meta %+v", params, meta)
+	}
+
+	batch, err := c.EmbedBatch(context.Background(), []string{"a", "bb"}, WithDimensions(1), WithEmbedInfo(&info))
+	if err != nil || len(batch[1]) != 1 || batch[1][0] != 1 || !info.ClientTruncated {
+		t.Fatalf("EmbedBatch: %v, %v, %+v", batch, err, info)
+	}
+}
+
+func TestWithDimensionsServerTruncates(t *testing.T) {
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{
+		Transport: TransportInProc, Handler: inprocHandler(dimensionsHandler), Recorder: sink,
+		Cache: CacheConfig{MaxEntries: 10},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var info EmbedInfo
+	v, err := c.Embed(context.Background(), "abcd", WithDimensions(2), WithEmbedInfo(&info))
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(v) != 2 || v[0] != 4 || !reflect.DeepEqual(info, EmbedInfo{Dimensions: 2, RequestBytes: info.RequestBytes, ResponseBytes: info.ResponseBytes}) {
+		t.Fatalf("expected the server's vector untouched, got %v and %+v", v, info)
+	}
+	params, meta := lastEmbedRequest(t, sink)
+	if params.Dimensions != 2 || meta.ClientDimensions != 0 {
+		t.Fatalf("transcript should mark server truncation: params %+v, meta %+v", params, meta)
+	}
+	// The truncated vector is cached apart from the full one.
+	if full, err := c.Embed(context.Background(), "abcd"); err != nil || len(full) != 3 {
+		t.Fatalf("full embedding after a truncated one: %v, %v", full, err)
+	}
+}
+
+func TestWithDimensionsValidation(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "a", WithDimensions(4)); err == nil || !strings.Contains(err.Error(), "native dimension 3") {
+		t.Fatalf("expected an oversized dimension to fail, got %v", err)
+	}
+	if _, err := c.EmbedBatch(ctx, []string{"a"}, WithDimensions(-1)); err == nil {
+		t.Fatal("expected a negative dimension to fail")
+	}
+
+	unknown, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Model: "no-such-model"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer unknown.Close(context.Background())
+	if _, err := unknown.Embed(ctx, "a", WithDimensions(2)); !errors.Is(err, ErrModelNotFound) {
+		t.Fatalf("expected ErrModelNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,499 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCacheMagic opens every disk cache file, followed by the format
+// version.
+const diskCacheMagic = "ENXC\x00\x00\x00\x01"
+
+// minCompactBytes is the size below which a disk cache file is compacted
+// only for exceeding DiskCacheOptions.MaxBytes, not for its dead records.
+const minCompactBytes = 1 << 20
+
+// A record is its payload's length and CRC-32C, both little-endian uint32s,
+// then the payload: the write time in Unix nanoseconds, the model's length
+// as a uint16 and the model, the SHA-256 of the normalized input, and the
+// vector's float32s.
+const (
+	recordHeaderSize = 8
+	minPayloadSize   = 8 + 2 + sha256.Size
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrDiskCacheLocked is returned by OpenDiskCache for a file another
+// DiskCache, in this process or another, has open.
+var ErrDiskCacheLocked = errors.New("disk cache is in use")
+
+// DiskCacheOptions configures a DiskCache.
+type DiskCacheOptions struct {
+	// TTL expires entries once they are this old. Zero keeps them until a
+	// compaction evicts them.
+	TTL time.Duration
+	// MaxBytes bounds the file. Once a write grows it past MaxBytes it is
+	// compacted: expired and superseded records are dropped and, if the
+	// rest still exceeds three quarters of MaxBytes, the oldest entries
+	// with them. Zero means no limit; the file is still compacted once
+	// over half of it is dead records.
+	MaxBytes int64
+}
+
+// DiskCacheStats describes a DiskCache.
+type DiskCacheStats struct {
+	Path string
+	// Entries counts the live entries, and Models them by the model they
+	// are cached under: the model, then @ and the dimension for vectors the
+	// server truncated, then # and the version for servers reporting one.
+	Entries int
+	Models  map[string]int
+	// Bytes is the size of the file, and LiveBytes that of the records of
+	// the live entries.
+	Bytes, LiveBytes int64
+	// Hits, Misses, Expired, Evictions, and Compactions count lookups,
+	// lookups finding an expired entry, entries a compaction dropped to
+	// fit MaxBytes, and compactions since the cache was opened.
+	Hits, Misses, Expired, Evictions, Compactions int64
+	// Dropped is the size of the torn or corrupt tail cut from the file
+	// when it was opened.
+	Dropped int64
+}
+
+// DiskCache is a persistent embedding cache in a single file, surviving
+// restarts. Set it as CacheConfig.Disk, alone or behind the in-memory LRU.
+// Entries are keyed on the model and the SHA-256 of the normalized input,
+// and appended to the file as checksummed records; the file is rewritten
+// without dead records when it grows too large. A write torn by a crash
+// costs only the records after it: opening the file drops its tail from the
+// first record failing its checksum. Only an index of the entries is held
+// in memory. Only one DiskCache may use a file at a time: it holds a lock
+// on the file beside it named with the suffix .lock, which is left behind
+// when it closes.
+type DiskCache struct {
+	path string
+	opts DiskCacheOptions
+	now  func() time.Time
+	// lock holds the lock on the lock file until Close.
+	lock *os.File
+
+	mu    sync.Mutex
+	f     *os.File
+	size  int64
+	index map[diskKey]diskEntry
+	// live is the size of the records in index.
+	live  int64
+	stats DiskCacheStats
+	// err stops writes after one failed in a way that leaves the file's
+	// end unknown.
+	err error
+}
+
+type diskKey struct {
+	model string
+	input [sha256.Size]byte
+}
+
+// diskEntry locates the record of an entry.
+type diskEntry struct {
+	off     int64
+	size    int64
+	written int64
+}
+
+// OpenDiskCache opens the disk cache file at path, creating it when
+// missing. It fails with ErrDiskCacheLocked while another DiskCache has the
+// file open, so that two processes never interleave their writes.
+func OpenDiskCache(path string, opts DiskCacheOptions) (*DiskCache, error) {
+	if opts.TTL < 0 || opts.MaxBytes < 0 {
+		return nil, errors.New("disk cache ttl and max bytes must not be negative")
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("disk cache %s: %w", path, err)
+	}
+	d := &DiskCache{path: path, opts: opts, now: time.Now, lock: lock}
+	if err := d.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// open opens the file at d.path and loads its index, cutting a torn or
+// corrupt tail. The caller holds mu, or has not shared d.
+func (d *DiskCache) open() error {
+	f, err := os.OpenFile(d.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	d.f, d.index, d.live = f, make(map[diskKey]diskEntry), 0
+	if err := d.load(); err != nil {
+		f.Close()
+		d.f = nil
+		return fmt.Errorf("disk cache %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// load reads the index of d.f.
+func (d *DiskCache) load() error {
+	info, err := d.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := d.f.WriteAt([]byte(diskCacheMagic), 0); err != nil {
+			return err
+		}
+		d.size = int64(len(diskCacheMagic))
+		return nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(d.f, 0, info.Size()))
+	magic := make([]byte, len(diskCacheMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != diskCacheMagic {
+		return errors.New("not a disk cache file")
+	}
+	off := int64(len(magic))
+	for off < info.Size() {
+		payload, ok := readRecord(r, info.Size()-off)
+		if !ok {
+			break
+		}
+		key, written, _ := decodePayload(payload)
+		d.index[key] = diskEntry{off: off, size: recordHeaderSize + int64(len(payload)), written: written}
+		off += recordHeaderSize + int64(len(payload))
+	}
+	if off < info.Size() {
+		d.stats.Dropped = info.Size() - off
+		if err := d.f.Truncate(off); err != nil {
+			return err
+		}
+	}
+	d.size = off
+	for _, e := range d.index {
+		d.live += e.size
+	}
+	return nil
+}
+
+// readRecord reads the next record from r, at most left bytes long,
+// returning its payload, or false when the record is torn or corrupt.
+func readRecord(r io.Reader, left int64) ([]byte, bool) {
+	var header [recordHeaderSize]byte
+	if left < recordHeaderSize {
+		return nil, false
+	}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, false
+	}
+	n := int64(binary.LittleEndian.Uint32(header[:4]))
+	if n < minPayloadSize || n > left-recordHeaderSize {
+		return nil, false
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, false
+	}
+	if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, false
+	}
+	if modelLen := int64(binary.LittleEndian.Uint16(payload[8:])); n < minPayloadSize+modelLen || (n-minPayloadSize-modelLen)%4 != 0 {
+		return nil, false
+	}
+	return payload, true
+}
+
+// encodeRecord returns the record of vector under key written at written.
+func encodeRecord(key diskKey, written int64, vector []float32) []byte {
+	n := minPayloadSize + len(key.model) + 4*len(vector)
+	b := make([]byte, recordHeaderSize, recordHeaderSize+n)
+	b = binary.LittleEndian.AppendUint64(b, uint64(written))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(key.model)))
+	b = append(b, key.model...)
+	b = append(b, key.input[:]...)
+	for _, x := range vector {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(x))
+	}
+	binary.LittleEndian.PutUint32(b, uint32(n))
+	binary.LittleEndian.PutUint32(b[4:], crc32.Checksum(b[recordHeaderSize:], castagnoli))
+	return b
+}
+
+// decodePayload returns the key, write time, and vector of a payload
+// readRecord accepted.
+func decodePayload(p []byte) (diskKey, int64, []float32) {
+	written := int64(binary.LittleEndian.Uint64(p))
+	modelLen := int(binary.LittleEndian.Uint16(p[8:]))
+	key := diskKey{model: string(p[10 : 10+modelLen])}
+	rest := p[10+modelLen:]
+	copy(key.input[:], rest)
+	rest = rest[sha256.Size:]
+	vector := make([]float32, len(rest)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(rest[4*i:]))
+	}
+	return key, written, vector
+}
+
+// diskKeyOf returns the disk key of a cache key, the model and the
+// normalized input joined by a NUL.
+func diskKeyOf(key string) diskKey {
+	model, input, _ := strings.Cut(key, "\x00")
+	return diskKey{model: model, input: sha256.Sum256([]byte(input))}
+}
+
+// expired reports whether an entry written at written has outlived the
+// TTL.
+func (d *DiskCache) expired(written int64) bool {
+	return d.opts.TTL > 0 && d.now().UnixNano()-written > int64(d.opts.TTL)
+}
+
+// get returns the vector cached under key, dropping it when expired or
+// found corrupt.
+func (d *DiskCache) get(key string) ([]float32, bool) {
+	k := diskKeyOf(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.index[k]
+	if !ok || d.f == nil {
+		d.stats.Misses++
+		return nil, false
+	}
+	if d.expired(e.written) {
+		d.drop(k, e)
+		d.stats.Expired++
+		d.stats.Misses++
+		return nil, false
+	}
+	payload, ok := readRecord(io.NewSectionReader(d.f, e.off, e.size), e.size)
+	if !ok {
+		d.drop(k, e)
+		d.stats.Misses++
+		return nil, false
+	}
+	d.stats.Hits++
+	_, _, vector := decodePayload(payload)
+	return vector, true
+}
+
+// drop removes the entry k from the index, leaving its record dead. The
+// caller holds mu.
+func (d *DiskCache) drop(k diskKey, e diskEntry) {
+	delete(d.index, k)
+	d.live -= e.size
+}
+
+// put appends vector under key, compacting the file when it has grown too
+// large. Models with names over 65535 bytes are not cached.
+func (d *DiskCache) put(key string, vector []float32) {
+	k := diskKeyOf(key)
+	if len(k.model) > math.MaxUint16 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil || d.err != nil {
+		return
+	}
+	written := d.now().UnixNano()
+	rec := encodeRecord(k, written, vector)
+	if _, err := d.f.WriteAt(rec, d.size); err != nil {
+		// A partial record would be cut on the next open; cut it now so
+		// the next write lands where the index expects.
+		if terr := d.f.Truncate(d.size); terr != nil {
+			d.err = errors.Join(err, terr)
+		}
+		return
+	}
+	if old, ok := d.index[k]; ok {
+		d.drop(k, old)
+	}
+	d.index[k] = diskEntry{off: d.size, size: int64(len(rec)), written: written}
+	d.size += int64(len(rec))
+	d.live += int64(len(rec))
+	if (d.opts.MaxBytes > 0 && d.size > d.opts.MaxBytes) || (d.size > minCompactBytes && d.size-d.live > d.live) {
+		// A failed compaction leaves the file as it was.
+		_ = d.compact()
+	}
+}
+
+// Compact rewrites the file without expired and superseded records and,
+// over three quarters of MaxBytes, without the oldest entries. The new file
+// replaces the old one only once written in full.
+func (d *DiskCache) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return errors.New("disk cache: closed")
+	}
+	return d.compact()
+}
+
+// compact is Compact. The caller holds mu.
+func (d *DiskCache) compact() error {
+	type live struct {
+		key diskKey
+		diskEntry
+	}
+	entries := make([]live, 0, len(d.index))
+	for k, e := range d.index {
+		if d.expired(e.written) {
+			d.drop(k, e)
+			d.stats.Expired++
+			continue
+		}
+		entries = append(entries, live{k, e})
+	}
+	// Oldest first, in file order among equals.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].written != entries[j].written {
+			return entries[i].written < entries[j].written
+		}
+		return entries[i].off < entries[j].off
+	})
+	if limit := d.opts.MaxBytes / 4 * 3; d.opts.MaxBytes > 0 {
+		for len(entries) > 0 && d.live+int64(len(diskCacheMagic)) > limit {
+			d.drop(entries[0].key, entries[0].diskEntry)
+			d.stats.Evictions++
+			entries = entries[1:]
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("disk cache: compact: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	w.WriteString(diskCacheMagic)
+	index := make(map[diskKey]diskEntry, len(entries))
+	off := int64(len(diskCacheMagic))
+	for _, e := range entries {
+		if _, err := io.Copy(w, io.NewSectionReader(d.f, e.off, e.size)); err != nil {
+			tmp.Close()
+			return fmt.Errorf("disk cache: compact: %w", err)
+		}
+		index[e.key] = diskEntry{off: off, size: e.size, written: e.written}
+		off += e.size
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path)
+	}
+	if err != nil {
+		return fmt.Errorf("disk cache: compact: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(d.path)); err == nil {
+		// Persist the rename where the platform allows it.
+		_ = dir.Sync()
+		dir.Close()
+	}
+	d.f.Close()
+	f, err := os.OpenFile(d.path, os.O_RDWR, 0o600)
+	if err != nil {
+		d.f, d.err = nil, err
+		return fmt.Errorf("disk cache: compact: %w", err)
+	}
+	d.f, d.size, d.index, d.err = f, off, index, nil
+	d.stats.Compactions++
+	return nil
+}
+
+// Purge drops the entries of model, those of every version and the vectors
+// the server truncated to a dimension with WithDimensions included, or
+// every entry when model is empty, compacting the file. It returns the number of entries dropped.
+func (d *DiskCache) Purge(model string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return 0, errors.New("disk cache: closed")
+	}
+	n := 0
+	for k, e := range d.index {
+		if _, ok := cachedVersion(k.model, model); model == "" || ok {
+			d.drop(k, e)
+			n++
+		}
+	}
+	return n, d.compact()
+}
+
+// latestVersion returns the model version of the entry of model written
+// last, the version the server reported when the file was last written.
+func (d *DiskCache) latestVersion(model string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var version string
+	latest := int64(math.MinInt64)
+	for k, e := range d.index {
+		if v, ok := cachedVersion(k.model, model); ok && e.written > latest {
+			version, latest = v, e.written
+		}
+	}
+	return version
+}
+
+// Stats describes the cache and its activity since it was opened.
+func (d *DiskCache) Stats() DiskCacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.stats
+	s.Path, s.Bytes, s.LiveBytes, s.Entries = d.path, d.size, d.live, len(d.index)
+	s.Models = make(map[string]int)
+	for k := range d.index {
+		s.Models[k.model]++
+	}
+	return s
+}
+
+func (d *DiskCache) clear() {
+	// A failed purge leaves the entries in place, to be served again.
+	_, _ = d.Purge("")
+}
+
+func (d *DiskCache) snapshot() CacheStats {
+	s := d.Stats()
+	return CacheStats{Hits: s.Hits, Misses: s.Misses, Disk: &s}
+}
+
+// Close flushes the file to stable storage and closes it; later lookups
+// miss and later writes are dropped.
+func (d *DiskCache) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lock == nil {
+		return nil
+	}
+	var err error
+	// A failed compaction may have left no file open.
+	if d.f != nil {
+		err = errors.Join(d.f.Sync(), d.f.Close())
+	}
+	err = errors.Join(err, d.lock.Close())
+	d.f, d.lock = nil, nil
+	return err
+}
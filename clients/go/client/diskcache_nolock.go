@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package client
+
+import "os"
+
+// lockFile does nothing where the platform offers no advisory lock the
+// client can take without cgo; one DiskCache per file is left to the caller.
+func lockFile(*os.File) error { return nil }
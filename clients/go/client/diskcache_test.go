@@ -0,0 +1,309 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestDiskCache(t *testing.T, path string, opts DiskCacheOptions) *DiskCache {
+	t.Helper()
+	d, err := OpenDiskCache(path, opts)
+	if err != nil {
+		t.Fatalf("OpenDiskCache: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestDiskCacheSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	ctx := context.Background()
+	d := openTestDiskCache(t, path, DiskCacheOptions{})
+	stub, _ := embedStub()
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{Disk: d}}, stub)
+	if _, err := c.EmbedBatch(ctx, []string{"hello  world", "abc"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if s := c.CacheStats(); s.Misses != 2 || s.Disk == nil || s.Disk.Entries != 2 || s.Entries != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A restarted client is served from the file.
+	d = openTestDiskCache(t, path, DiskCacheOptions{})
+	stub, _ = embedStub()
+	c = NewWithTransport(ClientConfig{Cache: CacheConfig{Disk: d}}, stub)
+	v, err := c.Embed(ctx, " hello world")
+	if err != nil || v[0] != 12 || stub.calls.Load() != 0 {
+		t.Fatalf("Embed after a restart: %v, %v after %d calls", v, err, stub.calls.Load())
+	}
+	if s := d.Stats(); s.Hits != 1 || s.Entries != 2 || !reflect.DeepEqual(s.Models, map[string]int{DefaultModel: 2}) {
+		t.Fatalf("stats %+v", s)
+	}
+
+	c.InvalidateCache()
+	if s := d.Stats(); s.Entries != 0 || s.Bytes != int64(len(diskCacheMagic)) {
+		t.Fatalf("stats after InvalidateCache %+v", s)
+	}
+}
+
+func TestDiskCacheTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	d := openTestDiskCache(t, path, DiskCacheOptions{})
+	for i := 0; i < 3; i++ {
+		d.put(fmt.Sprintf("m\x00input %d", i), []float32{float32(i), 1})
+	}
+	d.Close()
+	info, _ := os.Stat(path)
+	full := info.Size()
+
+	// A crash halfway through the last record.
+	if err := os.Truncate(path, full-5); err != nil {
+		t.Fatal(err)
+	}
+	d = openTestDiskCache(t, path, DiskCacheOptions{})
+	s := d.Stats()
+	if s.Entries != 2 || s.Dropped == 0 {
+		t.Fatalf("stats after a torn write %+v", s)
+	}
+	if v, ok := d.get("m\x00input 1"); !ok || v[0] != 1 {
+		t.Fatalf("entry before the torn write: %v, %t", v, ok)
+	}
+	// The next write lands after the last good record and survives.
+	d.put("m\x00input 3", []float32{3, 1})
+	d.Close()
+
+	// A flipped bit is caught by the checksum, costing the records from it.
+	data, _ := os.ReadFile(path)
+	data[len(data)-2] ^= 0x40
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d = openTestDiskCache(t, path, DiskCacheOptions{})
+	if s := d.Stats(); s.Entries != 2 || s.Dropped == 0 {
+		t.Fatalf("stats after a corrupt record %+v", s)
+	}
+	if _, ok := d.get("m\x00input 3"); ok {
+		t.Fatal("the corrupt record was served")
+	}
+
+	if err := os.WriteFile(path, []byte("not a cache"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDiskCache(path, DiskCacheOptions{}); err == nil {
+		t.Fatal("OpenDiskCache accepted a file of another format")
+	}
+}
+
+func TestDiskCacheTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := openTestDiskCache(t, filepath.Join(t.TempDir(), "embeddings.cache"), DiskCacheOptions{TTL: time.Hour})
+	d.now = func() time.Time { return now }
+	d.put("m\x00old", []float32{1})
+	now = now.Add(45 * time.Minute)
+	d.put("m\x00new", []float32{2})
+	now = now.Add(30 * time.Minute)
+	if _, ok := d.get("m\x00old"); ok {
+		t.Fatal("an entry older than the TTL was served")
+	}
+	if _, ok := d.get("m\x00new"); !ok {
+		t.Fatal("an entry within the TTL missed")
+	}
+	if s := d.Stats(); s.Expired != 1 || s.Entries != 1 || s.Hits != 1 || s.Misses != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestDiskCacheCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	const maxBytes = 4096
+	d := openTestDiskCache(t, path, DiskCacheOptions{MaxBytes: maxBytes})
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { now = now.Add(time.Second); return now }
+	vector := make([]float32, 64)
+	for i := 0; i < 100; i++ {
+		d.put(fmt.Sprintf("m\x00input %d", i), vector)
+		if info, err := os.Stat(path); err != nil || info.Size() > maxBytes {
+			t.Fatalf("file of %v bytes after %d writes: %v", info.Size(), i+1, err)
+		}
+	}
+	s := d.Stats()
+	if s.Compactions == 0 || s.Evictions == 0 || s.Bytes > maxBytes {
+		t.Fatalf("stats %+v", s)
+	}
+	// The newest entry is kept, the oldest evicted.
+	if _, ok := d.get("m\x00input 99"); !ok {
+		t.Fatal("the newest entry was evicted")
+	}
+	if _, ok := d.get("m\x00input 0"); ok {
+		t.Fatal("the oldest entry survived compaction")
+	}
+	d.Close()
+	if reopened := openTestDiskCache(t, path, DiskCacheOptions{MaxBytes: maxBytes}).Stats(); reopened.Entries != s.Entries || reopened.Dropped != 0 {
+		t.Fatalf("reopened %+v, want the %d entries written", reopened, s.Entries)
+	}
+
+	// Rewriting an entry leaves a dead record for Compact to drop.
+	d = openTestDiskCache(t, filepath.Join(t.TempDir(), "embeddings.cache"), DiskCacheOptions{})
+	d.put("m\x00a", []float32{1})
+	d.put("m\x00a", []float32{2})
+	before := d.Stats()
+	if err := d.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if after := d.Stats(); after.Bytes >= before.Bytes || after.Bytes != after.LiveBytes+int64(len(diskCacheMagic)) {
+		t.Fatalf("compacted %+v from %+v", after, before)
+	}
+	if v, ok := d.get("m\x00a"); !ok || v[0] != 2 {
+		t.Fatalf("rewritten entry: %v, %t", v, ok)
+	}
+}
+
+func TestDiskCacheLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	d := openTestDiskCache(t, path, DiskCacheOptions{})
+	if _, err := OpenDiskCache(path, DiskCacheOptions{}); !errors.Is(err, ErrDiskCacheLocked) {
+		t.Fatalf("second OpenDiskCache of an open file: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	openTestDiskCache(t, path, DiskCacheOptions{})
+}
+
+// versionedStub answers embeds with the model version it is set to, each
+// vector the input's length and the version's position in versions.
+func versionedStub(versions ...string) (stub *stubTransport, set func(string), sent func() [][]string) {
+	var mu sync.Mutex
+	version, log := versions[0], [][]string(nil)
+	stub = &stubTransport{kind: "stub", fn: func(req *Request) (*Response, error) {
+		if req.Method != MethodEmbed {
+			return defaultHandler(req), nil
+		}
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		mu.Lock()
+		defer mu.Unlock()
+		log = append(log, params.Inputs)
+		gen := float32(0)
+		for i, v := range versions {
+			if v == version {
+				gen = float32(i + 1)
+			}
+		}
+		result := embedResult{Model: params.Model, ModelVersion: version}
+		for i, in := range params.Inputs {
+			result.Embeddings = append(result.Embeddings, embeddingEntry{Index: i, Vector: []float32{float32(len(in)), gen}})
+		}
+		raw, _ := json.Marshal(result)
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}, nil
+	}}
+	set = func(v string) {
+		mu.Lock()
+		defer mu.Unlock()
+		version = v
+	}
+	sent = func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]string(nil), log...)
+	}
+	return stub, set, sent
+}
+
+func TestDiskCacheModelVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	ctx := context.Background()
+	d := openTestDiskCache(t, path, DiskCacheOptions{})
+	stub, set, sent := versionedStub("v1", "v2")
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{Disk: d}}, stub)
+	if _, err := c.Embed(ctx, "a"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	// The server moves to v2: the miss reports it, and the hit cached from
+	// v1 is fetched again rather than returned beside a v2 vector.
+	set("v2")
+	vectors, err := c.EmbedBatch(ctx, []string{"a", "bb", "a"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if want := [][]float32{{1, 2}, {2, 2}, {1, 2}}; !reflect.DeepEqual(vectors, want) {
+		t.Fatalf("vectors %v, want %v", vectors, want)
+	}
+	if want := [][]string{{"a"}, {"bb"}, {"a"}}; !reflect.DeepEqual(sent(), want) {
+		t.Fatalf("requests %v, want %v", sent(), want)
+	}
+	if v, err := c.Embed(ctx, "bb"); err != nil || v[1] != 2 || len(sent()) != 3 {
+		t.Fatalf("Embed of a v2 entry: %v, %v after %d requests", v, err, len(sent()))
+	}
+	models := map[string]int{DefaultModel + "#v1": 1, DefaultModel + "#v2": 2}
+	if s := d.Stats(); !reflect.DeepEqual(s.Models, models) {
+		t.Fatalf("models %v, want %v", s.Models, models)
+	}
+	d.Close()
+
+	// A restarted client keys on the version the file was last written
+	// with.
+	d = openTestDiskCache(t, path, DiskCacheOptions{})
+	stub, _, sent = versionedStub("v2")
+	c = NewWithTransport(ClientConfig{Cache: CacheConfig{Disk: d}}, stub)
+	if v, err := c.Embed(ctx, "a"); err != nil || v[1] != 2 || len(sent()) != 0 {
+		t.Fatalf("Embed after a restart: %v, %v after %d requests", v, err, len(sent()))
+	}
+	if n, err := d.Purge(DefaultModel); err != nil || n != 3 {
+		t.Fatalf("Purge of every version: %d, %v", n, err)
+	}
+}
+
+func TestDiskCachePurge(t *testing.T) {
+	d := openTestDiskCache(t, filepath.Join(t.TempDir(), "embeddings.cache"), DiskCacheOptions{})
+	d.put("alpha\x00a", []float32{1})
+	d.put("alpha@256\x00a", []float32{1})
+	d.put("alpha@256#v2\x00a", []float32{1})
+	d.put("alphabet\x00a", []float32{1})
+	d.put("beta\x00a", []float32{1})
+	n, err := d.Purge("alpha")
+	if err != nil || n != 3 {
+		t.Fatalf("Purge: %d, %v", n, err)
+	}
+	if s := d.Stats(); !reflect.DeepEqual(s.Models, map[string]int{"alphabet": 1, "beta": 1}) {
+		t.Fatalf("models after Purge %v", s.Models)
+	}
+	if n, err := d.Purge(""); err != nil || n != 2 || d.Stats().Entries != 0 {
+		t.Fatalf("Purge of everything: %d, %v", n, err)
+	}
+}
+
+func TestLayeredCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	ctx := context.Background()
+	d := openTestDiskCache(t, path, DiskCacheOptions{})
+	d.put(CacheConfig{}.key(DefaultModel, "warm"), []float32{7, 0.5, -0.5})
+	stub, _ := embedStub()
+	c := NewWithTransport(ClientConfig{Cache: CacheConfig{MaxEntries: 10, Disk: d}}, stub)
+
+	for i := 0; i < 2; i++ {
+		if v, err := c.Embed(ctx, "warm"); err != nil || v[0] != 7 {
+			t.Fatalf("Embed: %v, %v", v, err)
+		}
+	}
+	if _, err := c.Embed(ctx, "cold"); err != nil || stub.calls.Load() != 1 {
+		t.Fatalf("Embed of a miss: %v after %d calls", err, stub.calls.Load())
+	}
+	// The disk answered once, the memory in front of it after that.
+	s := c.CacheStats()
+	if s.Hits != 2 || s.Misses != 1 || s.Entries != 2 || s.Disk == nil || s.Disk.Hits != 1 || s.Disk.Entries != 2 {
+		t.Fatalf("stats %+v, disk %+v", s, s.Disk)
+	}
+}
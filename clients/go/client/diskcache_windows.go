@@ -0,0 +1,32 @@
+//go:build windows
+
+package client
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// lockFile takes an exclusive lock on the first byte of f, held until f is
+// closed, or fails with ErrDiskCacheLocked when another holds it.
+func lockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	switch {
+	case r != 0:
+		return nil
+	case errors.Is(err, errorLockViolation):
+		return ErrDiskCacheLocked
+	}
+	return err
+}
@@ -0,0 +1,335 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The ways DNSPolicy.Spread can pick the address of a new connection.
+const (
+	// SpreadRoundRobin cycles through the addresses, the default.
+	SpreadRoundRobin = "round-robin"
+	// SpreadRandom picks one at random.
+	SpreadRandom = "random"
+)
+
+// DNSPolicy keeps the addresses behind the endpoint's host name fresh, for
+// servers whose DNS records rotate as replicas come and go. Without it a
+// name is resolved only for each new connection, and pooled connections
+// pin whichever address it resolved to first. The zero value disables it.
+//
+// It applies to the http, tls, grpc, and ws transports, each endpoint of
+// WithEndpoints resolving its own name. An endpoint given as an IP address,
+// or reached through a proxy, dials as it would without it.
+type DNSPolicy struct {
+	// Refresh is how often the name is looked up again. Zero disables the
+	// policy.
+	Refresh time.Duration
+	// Spread picks the address of each new connection: SpreadRoundRobin,
+	// the default, or SpreadRandom. A connection failing to dial one
+	// address tries the next.
+	Spread string
+	// LookupHost resolves the name to its addresses, for programs with a
+	// service discovery of their own; nil selects
+	// net.DefaultResolver.LookupHost.
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+func (p DNSPolicy) validate() error {
+	switch {
+	case p.Refresh < 0:
+		return errors.New("dns refresh interval must not be negative")
+	case p.Spread != "" && p.Spread != SpreadRoundRobin && p.Spread != SpreadRandom:
+		return fmt.Errorf("dns spread must be %s or %s, got %q", SpreadRoundRobin, SpreadRandom, p.Spread)
+	}
+	return nil
+}
+
+// WithDNSRefresh looks the endpoint's host name up again every interval,
+// spreading new connections across its addresses as spread says; see
+// ClientConfig.DNS. It overrides WithConfig's DNS.Refresh and DNS.Spread.
+func WithDNSRefresh(interval time.Duration, spread string) Option {
+	return func(o *clientOptions) error {
+		p := DNSPolicy{Refresh: interval, Spread: spread}
+		if interval <= 0 {
+			return fmt.Errorf("WithDNSRefresh: interval must be positive, got %v", interval)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("WithDNSRefresh: %w", err)
+		}
+		o.dns = &p
+		return nil
+	}
+}
+
+// AddressChangeEvent describes a change of the addresses an endpoint's
+// host name resolves to under ClientConfig.DNS.
+type AddressChangeEvent struct {
+	Transport, Endpoint string
+	// Host is the name looked up, and Addresses what it resolves to now.
+	Host      string
+	Addresses []string
+	// Added and Removed are the addresses that appeared and went away.
+	// Connections to those removed are closed as they fall idle.
+	Added, Removed []string
+}
+
+// contextDialer dials connections, as a *net.Dialer does.
+type contextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// dnsResolver is the DNSPolicy of one endpoint: it dials the endpoint's
+// host name at the addresses it last resolved to, and refreshes them from
+// the first dial until close.
+type dnsResolver struct {
+	host   string
+	policy DNSPolicy
+	dialer contextDialer
+	// closeIdle closes the transport's idle connections, and events
+	// returns the observer of its address changes, if any.
+	closeIdle func()
+	events    func() *transportEvents
+	kind      string
+	label     string
+	log       *slog.Logger
+
+	mu    sync.Mutex
+	addrs []string
+	next  int
+	// open counts the connections open to each address.
+	open    map[string]int
+	started bool
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newDNSResolver returns nil when cfg leaves DNS disabled, or its endpoint
+// is not a host name.
+func newDNSResolver(cfg ClientConfig, dialer contextDialer, closeIdle func(), events func() *transportEvents) *dnsResolver {
+	if cfg.DNS.Refresh <= 0 || cfg.ProxyURL != "" {
+		return nil
+	}
+	endpoint := cfg.Endpoint
+	if cfg.Transport == TransportGRPC {
+		endpoint, _ = grpcBase(endpoint)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return nil
+	}
+	r := &dnsResolver{
+		host:      u.Hostname(),
+		policy:    cfg.DNS,
+		dialer:    dialer,
+		closeIdle: closeIdle,
+		events:    events,
+		kind:      cfg.Transport,
+		label:     cfg.endpointLabel(),
+		log:       cfg.logger(),
+		open:      make(map[string]int),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if r.policy.LookupHost == nil {
+		r.policy.LookupHost = net.DefaultResolver.LookupHost
+	}
+	return r
+}
+
+// DialContext dials addr at one of the addresses its host resolves to,
+// trying each in the order of the policy's Spread, or as the dialer would
+// for another host or before any lookup has succeeded.
+func (r *dnsResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != r.host {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+	r.start(ctx)
+	candidates := r.order()
+	if len(candidates) == 0 {
+		return r.dialer.DialContext(ctx, network, addr)
+	}
+	var errs []error
+	for _, ip := range candidates {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return r.track(conn, ip), nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// start looks the host up on first use and starts the refresh loop.
+func (r *dnsResolver) start(ctx context.Context) {
+	r.mu.Lock()
+	if r.started || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.started = true
+	r.mu.Unlock()
+	r.refresh(ctx)
+	go r.run()
+}
+
+func (r *dnsResolver) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.policy.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.policy.Refresh)
+			r.refresh(ctx)
+			cancel()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// refresh looks the host up again. A failed or empty answer keeps the
+// addresses known, so a resolver hiccup does not take the endpoint down.
+func (r *dnsResolver) refresh(ctx context.Context) {
+	found, err := r.policy.LookupHost(ctx, r.host)
+	if err != nil || len(found) == 0 {
+		r.log.Warn("dns refresh failed", "host", r.host, "error", err)
+		r.drain()
+		return
+	}
+	found = slices.Clone(found)
+	slices.Sort(found)
+	found = slices.Compact(found)
+
+	r.mu.Lock()
+	var added, removed []string
+	for _, a := range found {
+		if !slices.Contains(r.addrs, a) {
+			added = append(added, a)
+		}
+	}
+	for _, a := range r.addrs {
+		if !slices.Contains(found, a) {
+			removed = append(removed, a)
+		}
+	}
+	first := r.addrs == nil
+	r.addrs = found
+	r.mu.Unlock()
+	r.drain()
+	// The first answer is no change, only what the dials start from.
+	if first || added == nil && removed == nil {
+		return
+	}
+	r.log.Info("dns addresses changed", "host", r.host, "added", added, "removed", removed)
+	if ev := r.events(); ev != nil {
+		ev.addressChange(AddressChangeEvent{Transport: r.kind, Endpoint: r.label, Host: r.host, Addresses: slices.Clone(found), Added: added, Removed: removed})
+	}
+}
+
+// drain closes the idle connections while any is open to an address the
+// host no longer resolves to; the others are redialed as needed.
+func (r *dnsResolver) drain() {
+	r.mu.Lock()
+	stale := false
+	for a, n := range r.open {
+		stale = stale || n > 0 && !slices.Contains(r.addrs, a)
+	}
+	r.mu.Unlock()
+	if stale {
+		r.closeIdle()
+	}
+}
+
+// order returns the addresses to try for a new connection.
+func (r *dnsResolver) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.addrs)
+	if n == 0 {
+		return nil
+	}
+	start := r.next % n
+	if r.policy.Spread == SpreadRandom {
+		start = rand.Intn(n)
+	}
+	r.next = start + 1
+	return append(slices.Clone(r.addrs[start:]), r.addrs[:start]...)
+}
+
+// track counts conn, to ip, open until it closes.
+func (r *dnsResolver) track(conn net.Conn, ip string) net.Conn {
+	r.mu.Lock()
+	r.open[ip]++
+	r.mu.Unlock()
+	return &trackedConn{Conn: conn, release: func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.open[ip]--; r.open[ip] <= 0 {
+			delete(r.open, ip)
+		}
+	}}
+}
+
+// removed reports whether the name no longer resolves to ip.
+func (r *dnsResolver) removed(ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs != nil && !slices.Contains(r.addrs, ip)
+}
+
+// addressMap returns the addresses last resolved by host, nil before the
+// first lookup succeeds.
+func (r *dnsResolver) addressMap() map[string][]string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.addrs == nil {
+		return nil
+	}
+	return map[string][]string{r.host: slices.Clone(r.addrs)}
+}
+
+// close stops the refresh loop.
+func (r *dnsResolver) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	started := r.started && !r.closed
+	r.closed = true
+	r.mu.Unlock()
+	if started {
+		close(r.stop)
+		<-r.done
+	}
+}
+
+// trackedConn runs release once when it closes.
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dnsServers serves handler on 127.0.0.1 and 127.0.0.2 at the same port,
+// counting the requests and the closed connections of each.
+type dnsServers struct {
+	port         string
+	hits, closed [2]atomic.Int64
+	addrs        [2]string
+	lookups      atomic.Int64
+
+	mu        sync.Mutex
+	answer    []string
+	answerErr error
+}
+
+func newDNSServers(t *testing.T, handler func(fakeHandler) http.Handler) *dnsServers {
+	t.Helper()
+	d := &dnsServers{addrs: [2]string{"127.0.0.1", "127.0.0.2"}}
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, d.port, _ = net.SplitHostPort(first.Addr().String())
+	second, err := net.Listen("tcp", net.JoinHostPort(d.addrs[1], d.port))
+	if err != nil {
+		first.Close()
+		t.Skipf("no second loopback address: %v", err)
+	}
+	for i, ln := range []net.Listener{first, second} {
+		i := i
+		srv := httptest.NewUnstartedServer(handler(func(req *Request) *Response {
+			d.hits[i].Add(1)
+			return defaultHandler(req)
+		}))
+		srv.Listener = ln
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				d.closed[i].Add(1)
+			}
+		}
+		srv.Start()
+		t.Cleanup(srv.Close)
+	}
+	d.answer = d.addrs[:]
+	return d
+}
+
+func (d *dnsServers) lookup(_ context.Context, host string) ([]string, error) {
+	d.lookups.Add(1)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if host != "embed.test" {
+		return nil, errors.New("no such host")
+	}
+	return d.answer, d.answerErr
+}
+
+func (d *dnsServers) resolve(answer []string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.answer, d.answerErr = answer, err
+}
+
+func (d *dnsServers) reset() {
+	for i := range d.hits {
+		d.hits[i].Store(0)
+	}
+}
+
+// newDNSClient returns a client of d under a DNS policy refreshing every
+// few milliseconds, and the address changes it reports.
+func newDNSClient(t *testing.T, d *dnsServers, cfg ClientConfig) (*Client, chan AddressChangeEvent) {
+	t.Helper()
+	changes := make(chan AddressChangeEvent, 8)
+	if cfg.Transport == "" {
+		cfg.Transport = TransportHTTP
+	}
+	scheme := "http"
+	if cfg.Transport == TransportWebSocket {
+		scheme = "ws"
+	}
+	cfg.Endpoint = scheme + "://embed.test:" + d.port
+	cfg.DNS = DNSPolicy{Refresh: 5 * time.Millisecond, Spread: cfg.DNS.Spread, LookupHost: d.lookup}
+	cfg.EventListener = EventHooks{AddressChange: func(ev AddressChangeEvent) { changes <- ev }}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, changes
+}
+
+func embedTimes(t *testing.T, c *Client, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := c.Embed(context.Background(), "text "+strconv.Itoa(i)); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+}
+
+func TestDNSRefreshSpreadsAndMoves(t *testing.T) {
+	d := newDNSServers(t, httpHandler)
+	c, changes := newDNSClient(t, d, ClientConfig{DisableKeepAlives: true})
+
+	// A connection per request, the requests alternate between the two.
+	embedTimes(t, c, 6)
+	if a, b := d.hits[0].Load(), d.hits[1].Load(); a != 3 || b != 3 {
+		t.Fatalf("requests split %d/%d, want 3/3", a, b)
+	}
+	if got := c.Stats().Addresses["embed.test"]; !slices.Equal(got, d.addrs[:]) {
+		t.Fatalf("Stats.Addresses = %v", c.Stats().Addresses)
+	}
+
+	// The first address goes away, and the traffic with it.
+	d.resolve([]string{"127.0.0.2"}, nil)
+	select {
+	case ev := <-changes:
+		if ev.Host != "embed.test" || ev.Transport != TransportHTTP || !slices.Equal(ev.Removed, []string{"127.0.0.1"}) || ev.Added != nil || !slices.Equal(ev.Addresses, []string{"127.0.0.2"}) {
+			t.Fatalf("address change %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no address change reported")
+	}
+	d.reset()
+	embedTimes(t, c, 4)
+	if a, b := d.hits[0].Load(), d.hits[1].Load(); a != 0 || b != 4 {
+		t.Fatalf("requests split %d/%d after the change, want 0/4", a, b)
+	}
+
+	// A failed lookup keeps the addresses known.
+	d.resolve(nil, errors.New("resolver down"))
+	for n := d.lookups.Load() + 2; d.lookups.Load() < n; {
+		time.Sleep(time.Millisecond)
+	}
+	embedTimes(t, c, 1)
+	if got := c.Stats().Addresses["embed.test"]; !slices.Equal(got, []string{"127.0.0.2"}) || d.hits[1].Load() != 5 {
+		t.Fatalf("after a failed lookup: addresses %v, %d requests", got, d.hits[1].Load())
+	}
+	select {
+	case ev := <-changes:
+		t.Fatalf("failed lookup reported %+v", ev)
+	default:
+	}
+}
+
+func TestDNSRefreshDrainsRemovedAddress(t *testing.T) {
+	for _, transport := range []string{TransportHTTP, TransportWebSocket} {
+		t.Run(transport, func(t *testing.T) {
+			handler := httpHandler
+			if transport == TransportWebSocket {
+				handler = wsHandler
+			}
+			d := newDNSServers(t, handler)
+			c, changes := newDNSClient(t, d, ClientConfig{Transport: transport})
+
+			// The requests share one connection, to the first address.
+			embedTimes(t, c, 3)
+			if a := d.hits[0].Load(); a != 3 {
+				t.Fatalf("%d of 3 requests to the first address", a)
+			}
+			d.resolve([]string{"127.0.0.2"}, nil)
+			<-changes
+			for deadline := time.Now().Add(5 * time.Second); d.closed[0].Load() == 0; time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the idle connection to the removed address stayed open")
+				}
+			}
+			embedTimes(t, c, 2)
+			if a, b := d.hits[0].Load(), d.hits[1].Load(); a != 3 || b != 2 {
+				t.Fatalf("requests split %d/%d, want 3/2", a, b)
+			}
+		})
+	}
+}
+
+func TestDNSRefreshRandomSpread(t *testing.T) {
+	d := newDNSServers(t, httpHandler)
+	c, _ := newDNSClient(t, d, ClientConfig{DisableKeepAlives: true, DNS: DNSPolicy{Spread: SpreadRandom}})
+	embedTimes(t, c, 40)
+	if a, b := d.hits[0].Load(), d.hits[1].Load(); a == 0 || b == 0 {
+		t.Fatalf("requests split %d/%d", a, b)
+	}
+}
+
+func TestDNSRefreshLeavesIPEndpoints(t *testing.T) {
+	d := newDNSServers(t, httpHandler)
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: "http://127.0.0.1:" + d.port, DNS: DNSPolicy{Refresh: time.Millisecond, LookupHost: d.lookup}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	embedTimes(t, c, 2)
+	time.Sleep(10 * time.Millisecond)
+	if n := d.lookups.Load(); n != 0 || c.Stats().Addresses != nil {
+		t.Fatalf("%d lookups of an IP endpoint, addresses %v", n, c.Stats().Addresses)
+	}
+}
+
+func TestDNSPolicyValidation(t *testing.T) {
+	for _, opt := range []Option{
+		WithDNSRefresh(0, ""),
+		WithDNSRefresh(time.Second, "nearest"),
+		WithConfig(ClientConfig{DNS: DNSPolicy{Refresh: -time.Second}}),
+	} {
+		if _, err := NewClient("http://embed.test:1", opt); err == nil {
+			t.Error("NewClient accepted an invalid DNS policy")
+		}
+	}
+	if _, err := NewClient("http://embed.test:1", WithDNSRefresh(time.Second, SpreadRandom)); err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+}
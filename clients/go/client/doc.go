@@ -0,0 +1,8 @@
+// Package client implements the Go MCP client used by the Zaevrynth CLI and
+// transcript tests.
+//
+// A Client exchanges JSON-RPC 2.0 envelopes with the embedding server over a
+// pluggable Transport (stdio, http, tls, http3, grpc, ws, unix, or inproc) and
+// optionally mirrors every envelope into a Recorder so sessions can be diffed
+// against the golden fixtures under tests/fixtures/go/.
+package client
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrDryRun marks a call a dry-run client did not send; see WithDryRun.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// DryRunRequest describes a request a dry-run client would have sent. It is
+// the result of the synthetic response the client answers itself with, and
+// its credentials and idempotency keys are redacted as DefaultRedactions
+// redacts them in transcripts.
+type DryRunRequest struct {
+	DryRun    bool   `json:"dry_run"`
+	Transport string `json:"transport"`
+	Endpoint  string `json:"endpoint"`
+	Method    string `json:"method"`
+	// Headers are the HTTP headers the http, tls, and http3 transports
+	// would send; the other transports send none.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Request is the envelope as it leaves the interceptor chain, and
+	// BodyBytes the size of the body on the wire, after any compression.
+	Request   json.RawMessage `json:"request"`
+	BodyBytes int             `json:"body_bytes"`
+}
+
+// DryRunError is returned by calls of a dry-run client whose result cannot
+// be decoded from the synthetic response. It carries the request the call
+// would have sent.
+type DryRunError struct {
+	Request DryRunRequest
+}
+
+func (e *DryRunError) Error() string { return ErrDryRun.Error() }
+
+func (e *DryRunError) Unwrap() error { return ErrDryRun }
+
+// WithDryRun makes the client send nothing: every request passes through
+// the whole interceptor chain, retries and recorder included, and is then
+// answered by the client itself with a response whose result is the
+// DryRunRequest. Transcripts mark those exchanges dry_run. Calls decoding
+// into a json.RawMessage get the DryRunRequest, and negotiation carries on
+// with defaults: the handshake succeeds with an empty session and the
+// batch size query falls back to DefaultMaxBatchSize. Every other call
+// fails with a *DryRunError.
+func WithDryRun() Option {
+	return func(o *clientOptions) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// dryRunHeaderer is implemented by transports that send requests with
+// headers.
+type dryRunHeaderer interface {
+	// dryRunHeaders returns the headers and body size req would be sent
+	// with.
+	dryRunHeaders(ctx context.Context, req *Request) (http.Header, int, error)
+}
+
+// answerDryRun answers req in place of the transport.
+func (c *Client) answerDryRun(ctx context.Context, req *Request) (*Response, error) {
+	envelope, err := json.Marshal(req.Wire())
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	dr := DryRunRequest{
+		DryRun:    true,
+		Transport: c.transport.Kind(),
+		Endpoint:  c.endpointLabel(),
+		Method:    req.Method,
+		Request:   envelope,
+		BodyBytes: len(envelope),
+	}
+	if h, ok := c.transport.(dryRunHeaderer); ok {
+		header, size, err := h.dryRunHeaders(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		dr.Headers = make(map[string]string, len(header))
+		for name := range header {
+			dr.Headers[name] = header.Get(name)
+		}
+		dr.BodyBytes = size
+	}
+	result, err := json.Marshal(dr)
+	if err != nil {
+		return nil, err
+	}
+	result = NewRedactor(RecorderConfig{}).Redact(0, result)
+	return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Meta: req.Meta, Result: result}, nil
+}
+
+// dryRunResult decodes the DryRunRequest answering a dry-run call into
+// result, which may be a json.RawMessage, or returns the *DryRunError the
+// call fails with.
+func dryRunResult(resp *Response, result any) error {
+	if raw, ok := result.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], resp.Result...)
+		return nil
+	}
+	dr := &DryRunError{}
+	if err := json.Unmarshal(resp.Result, &dr.Request); err != nil {
+		return fmt.Errorf("decode dry run: %w", err)
+	}
+	return dr
+}
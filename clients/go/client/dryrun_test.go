@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDryRunSendsNothing(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	sink := &recordingSink{}
+	var intercepted []string
+	c, err := NewClient(srv.URL,
+		WithConfig(ClientConfig{APIKey: "sk-live-secret"}),
+		WithDryRun(),
+		WithTranscriptRecorder(sink),
+		WithInterceptor(func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			intercepted = append(intercepted, req.Method)
+			return next(ctx, req)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	var raw json.RawMessage
+	if err := c.Call(context.Background(), MethodJobSubmit, map[string]any{"inputs": []string{"a"}}, &raw); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if strings.Contains(string(raw), "sk-live-secret") {
+		t.Fatalf("dry run leaked the api key: %s", raw)
+	}
+	var dr DryRunRequest
+	if err := json.Unmarshal(raw, &dr); err != nil {
+		t.Fatal(err)
+	}
+	if !dr.DryRun || dr.Transport != TransportHTTP || dr.Endpoint != srv.URL || dr.Method != MethodJobSubmit || dr.BodyBytes <= 0 {
+		t.Fatalf("dry run %+v", dr)
+	}
+	if !strings.HasPrefix(dr.Headers["Authorization"], redactedPrefix) || !strings.HasPrefix(dr.Headers[IdempotencyHeader], redactedPrefix) || dr.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("headers %v", dr.Headers)
+	}
+	var req Request
+	if err := json.Unmarshal(dr.Request, &req); err != nil || req.Meta == nil || !strings.HasPrefix(req.Meta.IdempotencyKey, redactedPrefix) {
+		t.Fatalf("request %s (%v)", dr.Request, err)
+	}
+
+	_, err = c.Embed(context.Background(), "text")
+	var dryErr *DryRunError
+	if !errors.Is(err, ErrDryRun) || !errors.As(err, &dryErr) || dryErr.Request.Method != MethodEmbed {
+		t.Fatalf("Embed: got %v, want a *DryRunError", err)
+	}
+
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("a dry run reached the server %d times", n)
+	}
+	if strings.Join(intercepted, ",") != "mcp.initialize,mcp.jobs.submit,mcp.embed" {
+		t.Fatalf("interceptors saw %v", intercepted)
+	}
+	if len(sink.entries) != 2*len(intercepted) {
+		t.Fatalf("recorded %d entries", len(sink.entries))
+	}
+	for _, e := range sink.entries {
+		if !e.DryRun {
+			t.Fatalf("entry not marked dry_run: %+v", e)
+		}
+	}
+}
+
+func TestRunEmbedDryRun(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "vectors.ndjson")
+	var stdout strings.Builder
+	err := RunEmbed(context.Background(), Options{
+		Config: ClientConfig{Transport: TransportInProc, Handler: func(Request) (Response, error) {
+			t.Error("a dry run reached the handler")
+			return Response{}, nil
+		}},
+		Inputs:     []string{"alpha"},
+		OutputFile: output,
+		Stdout:     &stdout,
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	var requests []DryRunRequest
+	if err := json.Unmarshal([]byte(stdout.String()), &requests); err != nil {
+		t.Fatalf("dry run output %q: %v", stdout.String(), err)
+	}
+	if len(requests) == 0 || requests[len(requests)-1].Method != MethodEmbed || !strings.Contains(string(requests[len(requests)-1].Request), `"alpha"`) {
+		t.Fatalf("dry run printed %+v", requests)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a dry run wrote the output file: %v", err)
+	}
+}
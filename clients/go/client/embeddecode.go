@@ -0,0 +1,394 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+)
+
+// plainEmbedResult decodes an embed result with encoding/json alone.
+type plainEmbedResult embedResult
+
+// UnmarshalJSON decodes an embed result in one pass over data, writing the
+// vectors into a single allocation sized from the batch and dimension hints
+// when fetchEmbeddings knows them, or from the first vector otherwise. The
+// generic decoder grows each vector by doubling and re-scans every element
+// it hands to vectorData, which for a large batch holds several times the
+// vectors' size at its peak. Any shape the scanner does not recognize, such
+// as escaped keys, nulls, or a key in another case, is decoded by
+// encoding/json instead, so the result never depends on which path ran.
+func (r *embedResult) UnmarshalJSON(data []byte) error {
+	s := embedScanner{data: data, batch: r.batch, dim: r.dim, dest: r.dest}
+	out := embedResult{batch: r.batch, dim: r.dim, dest: r.dest}
+	if s.result(&out) {
+		*r = out
+		return nil
+	}
+	var plain plainEmbedResult
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+	plain.batch, plain.dim, plain.dest = r.batch, r.dim, r.dest
+	*r = embedResult(plain)
+	return nil
+}
+
+// embedScanner parses the JSON of an embed result. Each method reports
+// false on anything it does not handle, leaving it to encoding/json.
+type embedScanner struct {
+	data []byte
+	pos  int
+
+	// batch and dim size slab; dim is learned from the first vector when
+	// no hint gave it.
+	batch, dim int
+	slab       []float32
+	// used counts the vectors handed out, base the first one slab holds.
+	used, base int
+	// dest, when set, takes the place of slab, each vector going to the
+	// row of at, the index of the result being read when it came first.
+	dest *embedDest
+	at   int
+}
+
+func (s *embedScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next byte after whitespace, or 0 at the end.
+func (s *embedScanner) peek() byte {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return 0
+	}
+	return s.data[s.pos]
+}
+
+func (s *embedScanner) consume(c byte) bool {
+	if s.peek() != c {
+		return false
+	}
+	s.pos++
+	return true
+}
+
+// str returns the contents of a string without escapes, in valid UTF-8
+// that encoding/json would not have to replace.
+func (s *embedScanner) str() ([]byte, bool) {
+	if !s.consume('"') {
+		return nil, false
+	}
+	start := s.pos
+	end := bytes.IndexByte(s.data[start:], '"')
+	if end < 0 {
+		return nil, false
+	}
+	raw := s.data[start : start+end]
+	if bytes.IndexByte(raw, '\\') >= 0 || !utf8.Valid(raw) {
+		return nil, false
+	}
+	s.pos = start + end + 1
+	return raw, true
+}
+
+// object calls field for each key of an object, whose value field must
+// consume.
+func (s *embedScanner) object(field func(key []byte) bool) bool {
+	if !s.consume('{') {
+		return false
+	}
+	if s.consume('}') {
+		return true
+	}
+	for {
+		key, ok := s.str()
+		if !ok || !s.consume(':') || !field(key) {
+			return false
+		}
+		if s.consume('}') {
+			return true
+		}
+		if !s.consume(',') {
+			return false
+		}
+	}
+}
+
+// known reports whether key names one of fields. An unknown key that
+// matches one ignoring case is rejected, as encoding/json would decode it.
+func known(key []byte, fields ...string) (string, bool) {
+	for _, f := range fields {
+		if string(key) == f {
+			return f, true
+		}
+		if bytes.EqualFold(key, []byte(f)) {
+			return "", false
+		}
+	}
+	return "", true
+}
+
+func (s *embedScanner) result(r *embedResult) bool {
+	seen := false
+	ok := s.object(func(key []byte) bool {
+		name, ok := known(key, "model", "model_version", "embeddings", "encoding_format", "usage", "checksum")
+		switch {
+		case !ok:
+			return false
+		case name == "usage":
+			start := s.pos
+			if !s.skip() {
+				return false
+			}
+			r.Usage = new(Usage)
+			return json.Unmarshal(s.data[start:s.pos], r.Usage) == nil
+		case name == "model":
+			v, ok := s.str()
+			r.Model = string(v)
+			return ok
+		case name == "model_version":
+			v, ok := s.str()
+			r.ModelVersion = string(v)
+			return ok
+		case name == "encoding_format":
+			v, ok := s.str()
+			r.EncodingFormat = string(v)
+			return ok
+		case name == "checksum":
+			v, ok := s.str()
+			r.Checksum = string(v)
+			return ok
+		case name == "embeddings":
+			if seen {
+				return false
+			}
+			seen = true
+			return s.embeddings(r)
+		}
+		return s.skip()
+	})
+	if !ok {
+		return false
+	}
+	s.skipSpace()
+	return s.pos == len(s.data)
+}
+
+func (s *embedScanner) embeddings(r *embedResult) bool {
+	if !s.consume('[') {
+		return false
+	}
+	r.Embeddings = make([]embeddingEntry, 0, s.batch)
+	if s.consume(']') {
+		return true
+	}
+	for {
+		var e embeddingEntry
+		hasVector := false
+		s.at = -1
+		ok := s.object(func(key []byte) bool {
+			name, ok := known(key, "index", "vector", "truncated", "checksum")
+			switch {
+			case !ok:
+				return false
+			case name == "index":
+				if !s.index(&e.Index) {
+					return false
+				}
+				s.at = e.Index
+				return true
+			case name == "truncated":
+				return s.boolean(&e.Truncated)
+			case name == "checksum":
+				v, ok := s.str()
+				e.Checksum = string(v)
+				return ok
+			case name == "vector":
+				if hasVector {
+					return false
+				}
+				hasVector = true
+				return s.vector(&e.Vector)
+			}
+			return s.skip()
+		})
+		if !ok {
+			return false
+		}
+		r.Embeddings = append(r.Embeddings, e)
+		if s.consume(']') {
+			return true
+		}
+		if !s.consume(',') {
+			return false
+		}
+	}
+}
+
+func (s *embedScanner) index(n *int) bool {
+	s.skipSpace()
+	start := s.pos
+	if s.pos < len(s.data) && s.data[s.pos] == '-' {
+		s.pos++
+	}
+	for s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '9' {
+		s.pos++
+	}
+	v, err := strconv.Atoi(string(s.data[start:s.pos]))
+	if err != nil || s.pos < len(s.data) && isNumberByte(s.data[s.pos]) {
+		return false
+	}
+	*n = v
+	return true
+}
+
+// boolean reads true or false, ended by what may follow a value.
+func (s *embedScanner) boolean(b *bool) bool {
+	s.skipSpace()
+	for _, lit := range []string{"true", "false"} {
+		end := s.pos + len(lit)
+		if !bytes.HasPrefix(s.data[s.pos:], []byte(lit)) {
+			continue
+		}
+		if end < len(s.data) && bytes.IndexByte([]byte(",}] \t\n\r"), s.data[end]) < 0 {
+			return false
+		}
+		*b, s.pos = lit == "true", end
+		return true
+	}
+	return false
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// next returns the empty vector to append the next one to: its row of
+// dest when its index is known, or a window of slab when the dimension is
+// known and the batch not yet full.
+func (s *embedScanner) next() []float32 {
+	if s.dest != nil {
+		if s.at >= 0 && s.at < s.batch {
+			return s.dest.slot(s.at)
+		}
+		return make([]float32, 0, s.dim)
+	}
+	k := s.used
+	s.used++
+	if s.dim > 0 && k < s.batch {
+		if s.slab == nil {
+			s.slab, s.base = make([]float32, (s.batch-k)*s.dim), k
+		}
+		off := (k - s.base) * s.dim
+		return s.slab[off : off : off+s.dim]
+	}
+	return make([]float32, 0, s.dim)
+}
+
+func (s *embedScanner) vector(v *vectorData) bool {
+	var out []float32
+	switch s.peek() {
+	case '[':
+		s.pos++
+		out = s.next()
+		if !s.consume(']') {
+			for {
+				s.skipSpace()
+				start := s.pos
+				for s.pos < len(s.data) && isNumberByte(s.data[s.pos]) {
+					s.pos++
+				}
+				if start == s.pos || s.data[start] == '+' {
+					return false
+				}
+				f, err := strconv.ParseFloat(string(s.data[start:s.pos]), 32)
+				if err != nil {
+					return false
+				}
+				out = append(out, float32(f))
+				if s.consume(']') {
+					break
+				}
+				if !s.consume(',') {
+					return false
+				}
+			}
+		}
+	case '"':
+		raw, ok := s.str()
+		if !ok {
+			return false
+		}
+		var err error
+		out, err = decodeBase64Float32s(raw, func(n int) []float32 {
+			if v := s.next(); cap(v) >= n {
+				return v[:n]
+			}
+			return make([]float32, n)
+		})
+		if err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	if s.dim == 0 {
+		s.dim = len(out)
+	}
+	*v = out
+	return true
+}
+
+// skip consumes a value of a field the result does not have.
+func (s *embedScanner) skip() bool {
+	s.skipSpace()
+	depth := 0
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c == '"':
+			if !s.skipString() {
+				return false
+			}
+		case c == '{' || c == '[':
+			depth++
+			s.pos++
+		case c == '}' || c == ']':
+			if depth == 0 {
+				// The enclosing object ends a scalar.
+				return true
+			}
+			depth--
+			s.pos++
+		case c == ',' && depth == 0:
+			return true
+		default:
+			s.pos++
+		}
+		if depth == 0 && (c == '"' || c == '}' || c == ']') {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *embedScanner) skipString() bool {
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,380 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/npyio"
+)
+
+// embedFileWindow is how many lines of an input file are read and embedded
+// at a time, which bounds the memory of a run whatever the file's size.
+const embedFileWindow = 4096
+
+// embedProgressInterval spaces the progress reports of an input file.
+const embedProgressInterval = time.Second
+
+// embedCheckpoint is the checkpoint file of an input-file run.
+type embedCheckpoint struct {
+	InputFile string `json:"input_file"`
+	// Lines counts the lines of InputFile that were embedded and written.
+	Lines int64 `json:"lines"`
+	// OutputOffset is the size of the output file after them, which a
+	// resumed run truncates the file to.
+	OutputOffset int64 `json:"output_offset,omitempty"`
+}
+
+// EmbedFileError reports an input-file run that stopped early. Lines up to
+// Resume were embedded and written; a run with ResumeFrom set to it picks
+// up where this one stopped.
+type EmbedFileError struct {
+	Path   string
+	Resume int64
+	Err    error
+	// Embedded counts the non-blank lines this run embedded and wrote.
+	Embedded int64
+	// Remaining counts the non-blank lines after Resume, the rest of the
+	// file read to count them, for a run Options.Stop wound down; it is -1
+	// for others.
+	Remaining int64
+}
+
+func (e *EmbedFileError) Error() string {
+	return fmt.Sprintf("%s: stopped after line %d: %v", e.Path, e.Resume, e.Err)
+}
+
+func (e *EmbedFileError) Unwrap() error { return e.Err }
+
+// embedLine is a record of RunEmbed; Index is the position of the input,
+// the line number counted from 0 for an input file.
+type embedLine struct {
+	Index  int64     `json:"index"`
+	Vector []float32 `json:"vector"`
+}
+
+// embedFile embeds opts.InputFile one window of lines at a time, writing a
+// record per non-empty input line, in input order, as OutputNDJSON or,
+// when opts.Output selects it, OutputCSV, OutputArrow, OutputNPY, or
+// OutputParquet. An Arrow file holds a record batch per window, and is
+// readable once its footer is written at the end of the run; a .npy file
+// gets the shape in its header then, and a Parquet file its metadata.
+func embedFile(ctx context.Context, c *Client, opts Options) error {
+	in, err := os.Open(opts.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var size int64
+	if info, err := in.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	start := opts.ResumeFrom
+	var cp embedCheckpoint
+	if opts.Checkpoint != "" {
+		if cp, err = readCheckpoint(opts.Checkpoint); err != nil {
+			return err
+		}
+		if cp.InputFile != "" && cp.InputFile != opts.InputFile {
+			return fmt.Errorf("checkpoint %s is for %s, not %s", opts.Checkpoint, cp.InputFile, opts.InputFile)
+		}
+		start = max(start, cp.Lines)
+	}
+
+	var out io.Writer = io.Discard
+	if opts.Stdout != nil {
+		out = opts.Stdout
+	}
+	var file *os.File
+	var offset int64
+	if opts.OutputFile != "" {
+		if file, err = os.OpenFile(opts.OutputFile, os.O_WRONLY|os.O_CREATE, 0o644); err != nil {
+			return err
+		}
+		defer file.Close()
+		// A resumed run appends, dropping whatever followed the last
+		// checkpoint; a fresh one starts the file over.
+		if start == 0 || cp.Lines == start {
+			offset = cp.OutputOffset
+			if err := file.Truncate(offset); err != nil {
+				return err
+			}
+		}
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	output := opts.Output
+	if output.Format == "" {
+		output.Format = OutputNDJSON
+	}
+	records := output.NewRecordWriter(w)
+	// Appending to a CSV file continues below its header.
+	records.header = offset == 0
+	var arrow *arrowFileWriter
+	var npy *npyio.Writer
+	var parquet *export.ParquetWriter
+	switch output.Format {
+	case OutputArrow:
+		arrow = newArrowFileWriter(w)
+	case OutputNPY:
+		npy = npyio.NewWriter(file)
+	case OutputParquet:
+		popts := opts.Parquet
+		if popts.CreatedBy == "" {
+			popts.CreatedBy = ClientName + " version " + ClientVersion
+		}
+		if parquet, err = export.NewParquetWriter(w, popts); err != nil {
+			return err
+		}
+	}
+
+	// info reports the bytes of each window for the summary.
+	var info EmbedInfo
+	embedOpts := []EmbedOption{WithEmbedInfo(&info)}
+	if opts.Concurrency > 0 {
+		embedOpts = append(embedOpts, WithConcurrency(opts.Concurrency))
+	}
+	counter := &countingReader{r: in}
+	scanner := bufio.NewScanner(counter)
+	scanner.Buffer(nil, DefaultMaxFrameSize)
+	progress := newEmbedProgress(opts, size)
+
+	var (
+		line      int64
+		committed = start
+		texts     []string
+		indices   []int64
+	)
+	flush := func() error {
+		if len(texts) > 0 {
+			vectors, err := c.EmbedBatch(ctx, texts, embedOpts...)
+			if err != nil {
+				return err
+			}
+			progress.sent += info.RequestBytes
+			progress.received += info.ResponseBytes
+			switch {
+			case arrow != nil:
+				err = arrow.Write(indices, texts, vectors)
+			case npy != nil:
+				err = npy.Write(vectors)
+			case parquet != nil:
+				rows := make([]export.EmbeddingRow, len(vectors))
+				for i, v := range vectors {
+					rows[i] = export.EmbeddingRow{ID: strconv.FormatInt(indices[i], 10), TextHash: export.HashText(texts[i]), Model: c.cfg.Model, Vector: v}
+				}
+				err = parquet.Write(rows)
+			default:
+				for i, v := range vectors {
+					if err = records.Write(embedLine{Index: indices[i], Vector: v}); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("write embeddings: %w", err)
+			}
+		}
+		if err := records.Flush(); err != nil {
+			return fmt.Errorf("write embeddings: %w", err)
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("write embeddings: %w", err)
+		}
+		if file != nil {
+			if err := file.Sync(); err != nil {
+				return fmt.Errorf("write embeddings: %w", err)
+			}
+			if offset, err = file.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		progress.done(int64(len(texts)), line, counter.n.Load())
+		texts, indices, committed = texts[:0], indices[:0], line
+		if opts.Checkpoint != "" {
+			return writeCheckpoint(opts.Checkpoint, embedCheckpoint{InputFile: opts.InputFile, Lines: line, OutputOffset: offset})
+		}
+		return nil
+	}
+	stopped := func() bool {
+		select {
+		case <-opts.Stop:
+			return true
+		default:
+			return false
+		}
+	}
+	// A run wound down by opts.Stop counts the lines it leaves.
+	fail := func(err error) error {
+		fileErr := &EmbedFileError{Path: opts.InputFile, Resume: committed, Err: err, Embedded: progress.lines, Remaining: -1}
+		if stopped() {
+			fileErr.Remaining = int64(len(texts))
+			for scanner.Scan() {
+				if strings.TrimSpace(scanner.Text()) != "" {
+					fileErr.Remaining++
+				}
+			}
+		}
+		return fileErr
+	}
+	for scanner.Scan() {
+		line++
+		if line <= start {
+			continue
+		}
+		if line == start+1 {
+			progress.skipped = counter.n.Load()
+		}
+		if text := strings.TrimSpace(scanner.Text()); text != "" {
+			texts = append(texts, text)
+			indices = append(indices, line-1)
+		}
+		if int(line-start)%embedFileWindow == 0 {
+			if stopped() {
+				return fail(ErrStopped)
+			}
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fail(fmt.Errorf("read %s: %w", opts.InputFile, err))
+	}
+	if stopped() {
+		return fail(ErrStopped)
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	if arrow != nil || npy != nil || parquet != nil {
+		if err := closeEmbedFile(arrow, npy, parquet, w, file); err != nil {
+			return fail(fmt.Errorf("write embeddings: %w", err))
+		}
+	}
+	progress.finish(line)
+	if opts.Checkpoint != "" {
+		// The run is complete, so a rerun starts over.
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeEmbedFile finishes the file of OutputArrow, OutputNPY, or
+// OutputParquet once every window is written.
+func closeEmbedFile(arrow *arrowFileWriter, npy *npyio.Writer, parquet *export.ParquetWriter, w *bufio.Writer, file *os.File) error {
+	if arrow != nil {
+		if err := arrow.Close(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if npy != nil {
+		if err := npy.Close(); err != nil {
+			return err
+		}
+	}
+	if parquet != nil {
+		if err := parquet.Close(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+func readCheckpoint(path string) (embedCheckpoint, error) {
+	var cp embedCheckpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint at path, never leaving a torn one.
+func writeCheckpoint(path string, cp embedCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// embedProgress reports the progress of an input-file run to
+// opts.Progress at most once per embedProgressInterval.
+type embedProgress struct {
+	w       io.Writer
+	path    string
+	size    int64
+	started time.Time
+	last    time.Time
+	lines   int64
+	// skipped is about how much of the file a resumed run read past.
+	skipped int64
+	// sent and received total the bytes of the run's requests and
+	// responses; see EmbedInfo.RequestBytes.
+	sent, received int64
+}
+
+func newEmbedProgress(opts Options, size int64) *embedProgress {
+	now := time.Now()
+	return &embedProgress{w: opts.Progress, path: opts.InputFile, size: size, started: now, last: now}
+}
+
+// done counts n more lines embedded, with line lines and read bytes of the
+// file consumed.
+func (p *embedProgress) done(n, line, read int64) {
+	p.lines += n
+	if p.w == nil || time.Since(p.last) < embedProgressInterval {
+		return
+	}
+	p.last = time.Now()
+	elapsed := p.last.Sub(p.started)
+	msg := fmt.Sprintf("%s: line %d, %d embedded, %.0f lines/s", p.path, line, p.lines, float64(p.lines)/elapsed.Seconds())
+	if p.size > 0 && read > 0 {
+		msg += fmt.Sprintf(", %d%%", min(100, read*100/p.size))
+		if remaining, embedded := p.size-read, read-p.skipped; remaining > 0 && embedded > 0 {
+			eta := time.Duration(float64(elapsed) * float64(remaining) / float64(embedded))
+			msg += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintln(p.w, msg)
+}
+
+// finish reports the totals of the run.
+func (p *embedProgress) finish(lines int64) {
+	if p.w == nil {
+		return
+	}
+	elapsed := time.Since(p.started)
+	fmt.Fprintf(p.w, "%s: %d lines, %d embedded in %s, %d bytes sent, %d received\n", p.path, lines, p.lines, elapsed.Round(time.Millisecond), p.sent, p.received)
+}
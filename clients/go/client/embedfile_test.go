@@ -0,0 +1,273 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/npyio"
+)
+
+// embedFileServer answers like defaultHandler, failing every embed request
+// with an input of "bad" while failing is set.
+func embedFileServer(failing *atomic.Bool) ClientConfig {
+	return ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		if req.Method == MethodEmbed && failing.Load() {
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			for _, in := range params.Inputs {
+				if in == "bad" {
+					return Response{}, &RPCError{Code: -32000, Message: "bad input"}
+				}
+			}
+		}
+		return *defaultHandler(&req), nil
+	}}
+}
+
+// readEmbedLines decodes an NDJSON output file.
+func readEmbedLines(t *testing.T, path string) []embedLine {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []embedLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var l embedLine
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			t.Fatalf("line %d: %v: %s", len(lines), err, scanner.Text())
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func TestRunEmbedInputFile(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.ndjson")
+	if err := os.WriteFile(input, []byte("a\n\nbbb\n  cc  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var progress strings.Builder
+	var failing atomic.Bool
+	err := RunEmbed(context.Background(), Options{
+		Config:      embedFileServer(&failing),
+		InputFile:   input,
+		OutputFile:  output,
+		Concurrency: 2,
+		Progress:    &progress,
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	// The blank line is skipped but keeps its number.
+	got := readEmbedLines(t, output)
+	want := []embedLine{{0, []float32{1, 0.5, -0.5}}, {2, []float32{3, 0.5, -0.5}}, {3, []float32{2, 0.5, -0.5}}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrote %v, want %v", got, want)
+	}
+	if summary := progress.String(); !strings.Contains(summary, "texts.txt: 4 lines, 3 embedded") || !strings.Contains(summary, "bytes sent") || strings.Contains(summary, " 0 bytes sent") {
+		t.Fatalf("progress %q", progress.String())
+	}
+
+	// A CSV file resumed by offset continues below its header.
+	csvPath := filepath.Join(dir, "vectors.csv")
+	for _, from := range []int64{0, 3} {
+		opts := Options{Config: embedFileServer(&failing), InputFile: input, OutputFile: csvPath, ResumeFrom: from, Output: Renderer{Format: OutputCSV}}
+		if err := RunEmbed(context.Background(), opts); err != nil {
+			t.Fatalf("RunEmbed csv from %d: %v", from, err)
+		}
+	}
+	if content, _ := os.ReadFile(csvPath); string(content) != "index,vector\n0,1;0.5;-0.5\n2,3;0.5;-0.5\n3,2;0.5;-0.5\n3,2;0.5;-0.5\n" {
+		t.Fatalf("csv output %q", content)
+	}
+
+	if err := RunEmbed(context.Background(), Options{Config: embedFileServer(&failing), InputFile: input, Output: Renderer{Format: OutputJSON}}); err == nil {
+		t.Fatal("an input file was written as one JSON document")
+	}
+}
+
+func TestRunEmbedInputFileResumes(t *testing.T) {
+	dir := t.TempDir()
+	input, output, checkpoint := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.ndjson"), filepath.Join(dir, "checkpoint.json")
+	const total, bad = embedFileWindow + 500, embedFileWindow + 100
+	var texts strings.Builder
+	for i := 0; i < total; i++ {
+		if i == bad {
+			texts.WriteString("bad\n")
+		} else {
+			fmt.Fprintf(&texts, "line %d\n", i)
+		}
+	}
+	if err := os.WriteFile(input, []byte(texts.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	opts := Options{Config: embedFileServer(&failing), InputFile: input, OutputFile: output, Checkpoint: checkpoint}
+
+	err := RunEmbed(context.Background(), opts)
+	var fileErr *EmbedFileError
+	if !errors.As(err, &fileErr) || fileErr.Resume != embedFileWindow {
+		t.Fatalf("expected an EmbedFileError resuming after line %d, got %v", embedFileWindow, err)
+	}
+	if n := len(readEmbedLines(t, output)); n != embedFileWindow {
+		t.Fatalf("wrote %d lines before failing, want the first window", n)
+	}
+	cp, err := readCheckpoint(checkpoint)
+	if err != nil || cp.Lines != embedFileWindow || cp.InputFile != input {
+		t.Fatalf("checkpoint %+v, %v", cp, err)
+	}
+	// Bytes written after the checkpoint, as by a run killed mid-window,
+	// are dropped on resume.
+	f, err := os.OpenFile(output, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"index":99999,"vec`)
+	f.Close()
+
+	failing.Store(false)
+	if err := RunEmbed(context.Background(), opts); err != nil {
+		t.Fatalf("resumed RunEmbed: %v", err)
+	}
+	got := readEmbedLines(t, output)
+	if len(got) != total {
+		t.Fatalf("wrote %d lines, want %d", len(got), total)
+	}
+	for i, l := range got {
+		if l.Index != int64(i) {
+			t.Fatalf("line %d has index %d", i, l.Index)
+		}
+	}
+	if _, err := os.Stat(checkpoint); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("checkpoint kept after a complete run: %v", err)
+	}
+
+	// ResumeFrom skips lines and appends.
+	if err := RunEmbed(context.Background(), Options{Config: opts.Config, InputFile: input, OutputFile: output, ResumeFrom: total - 2}); err != nil {
+		t.Fatalf("RunEmbed from an offset: %v", err)
+	}
+	if got := readEmbedLines(t, output); len(got) != total+2 || got[total].Index != total-2 {
+		t.Fatalf("appended %d lines", len(got)-total)
+	}
+}
+
+func TestRunEmbedInputFileStops(t *testing.T) {
+	dir := t.TempDir()
+	input, output, checkpoint := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.ndjson"), filepath.Join(dir, "checkpoint.json")
+	const total = embedFileWindow + 500
+	var texts strings.Builder
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&texts, "line %d\n", i)
+	}
+	if err := os.WriteFile(input, []byte(texts.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Stop closes while the first window is in flight, which finishes.
+	stop := make(chan struct{})
+	var once sync.Once
+	cfg := ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		if req.Method == MethodEmbed {
+			once.Do(func() { close(stop) })
+		}
+		return *defaultHandler(&req), nil
+	}}
+	err := RunEmbed(context.Background(), Options{Config: cfg, InputFile: input, OutputFile: output, Checkpoint: checkpoint, Stop: stop})
+	var fileErr *EmbedFileError
+	if !errors.As(err, &fileErr) || !errors.Is(err, ErrStopped) {
+		t.Fatalf("RunEmbed: %v, want an EmbedFileError wrapping ErrStopped", err)
+	}
+	if fileErr.Resume != embedFileWindow || fileErr.Embedded != embedFileWindow || fileErr.Remaining != total-embedFileWindow {
+		t.Fatalf("stopped run %+v", fileErr)
+	}
+	if n := len(readEmbedLines(t, output)); n != embedFileWindow {
+		t.Fatalf("wrote %d lines, want the first window", n)
+	}
+	if cp, err := readCheckpoint(checkpoint); err != nil || cp.Lines != embedFileWindow {
+		t.Fatalf("checkpoint %+v, %v", cp, err)
+	}
+}
+
+func TestRunEmbedNPY(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.npy")
+	if err := os.WriteFile(input, []byte("a\n\nbbb\n  cc  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var failing atomic.Bool
+	if err := RunEmbed(context.Background(), Options{Config: embedFileServer(&failing), InputFile: input, OutputFile: output, Output: Renderer{Format: OutputNPY}}); err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The non-empty lines are the rows, the shape fixed once they are all
+	// written.
+	var want bytes.Buffer
+	if err := npyio.WriteNPY(&want, [][]float32{{1, 0.5, -0.5}, {3, 0.5, -0.5}, {2, 0.5, -0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("wrote %q, want %q", got, want.Bytes())
+	}
+	if err := RunEmbed(context.Background(), Options{Config: embedFileServer(&failing), InputFile: input, Output: Renderer{Format: OutputNPY}}); err == nil {
+		t.Fatal("a .npy file was written to stdout")
+	}
+}
+
+func TestRunEmbedParquet(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.parquet")
+	if err := os.WriteFile(input, []byte("a\n\nbbb\n  cc  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var failing atomic.Bool
+	cfg := embedFileServer(&failing)
+	cfg.Model = "test-model"
+	opts := Options{Config: cfg, InputFile: input, OutputFile: output, Output: Renderer{Format: OutputParquet}, Parquet: export.ParquetOptions{RowGroupSize: 2, Compression: export.CompressionGzip}}
+	if err := RunEmbed(context.Background(), opts); err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := export.ReadParquet(f, info.Size(), export.ParquetOptions{})
+	if err != nil {
+		t.Fatalf("ReadParquet: %v", err)
+	}
+	// A row per non-empty line, identified by its line number.
+	want := []export.EmbeddingRow{
+		{ID: "0", TextHash: export.HashText("a"), Model: "test-model", Vector: []float32{1, 0.5, -0.5}},
+		{ID: "2", TextHash: export.HashText("bbb"), Model: "test-model", Vector: []float32{3, 0.5, -0.5}},
+		{ID: "3", TextHash: export.HashText("cc"), Model: "test-model", Vector: []float32{2, 0.5, -0.5}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("read back %+v, want %+v", rows, want)
+	}
+	opts.Parquet.Embedding = "floats"
+	if err := RunEmbed(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "floats") {
+		t.Fatalf("RunEmbed with an unknown embedding: %v", err)
+	}
+}
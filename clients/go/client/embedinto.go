@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownDimension reports an EmbedBatchInto or EmbedBatchIntoRows call
+// whose vectors' length the client cannot tell before sending: the model
+// is not listed with a dimension, and neither WithDimensions nor
+// WithExpectedDimension gives one.
+var ErrUnknownDimension = errors.New("embedding dimension unknown")
+
+// WithExpectedDimension states that the model's vectors have n components,
+// for EmbedBatchInto and EmbedBatchIntoRows against servers that do not
+// list the model's dimension. Unlike WithDimensions it asks for no
+// truncation: a vector of another length fails the call with a
+// *ResponseValidationError. Other calls ignore it.
+func WithExpectedDimension(n int) EmbedOption {
+	return func(o *embedOptions) { o.expectedDim = n }
+}
+
+// EmbedBatchInto embeds texts as EmbedBatch does, but writes the vector of
+// texts[i] to dst[i*dim:(i+1)*dim], row-major, instead of allocating the
+// vectors, for consumers that reuse one buffer batch after batch. It
+// returns the number of vectors written.
+//
+// dim must be known before sending: it is the n of WithDimensions or
+// WithExpectedDimension, or else the model's dimension as the server lists
+// it, the models being listed on first use. Without one the call fails
+// with ErrUnknownDimension, and with dst shorter than len(texts)*dim it
+// fails too, in both cases without a request.
+//
+// The results of each request are decoded straight into dst wherever a
+// result gives its index before its vector, as EmbedNexus servers send
+// them. Any other vector, like those from the cache, truncated by the
+// client, or shared with other calls, is copied into dst once. With
+// WithPartialResults the rows of the inputs that failed are left as they
+// were and the count leaves them out.
+func (c *Client) EmbedBatchInto(ctx context.Context, texts []string, dst []float32, opts ...EmbedOption) (int, error) {
+	return c.embedInto(ctx, texts, &embedDest{flat: dst}, opts)
+}
+
+// EmbedBatchIntoRows is EmbedBatchInto writing the vector of texts[i] to
+// rows[i] instead, each row reused at its capacity: rows must hold at
+// least len(texts) rows with room for dim components each, and the row of
+// every vector written is resliced to dim.
+func (c *Client) EmbedBatchIntoRows(ctx context.Context, texts []string, rows [][]float32, opts ...EmbedOption) (int, error) {
+	return c.embedInto(ctx, texts, &embedDest{rows: rows}, opts)
+}
+
+func (c *Client) embedInto(ctx context.Context, texts []string, d *embedDest, opts []EmbedOption) (int, error) {
+	if err := c.gate.check(ctx); err != nil {
+		return 0, err
+	}
+	o := embedOptions{model: c.cfg.Model, size: c.cfg.MaxBatchSize, concurrency: DefaultBatchConcurrency}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if route, ok := c.routes[o.model]; ok {
+		return route.embedInto(ctx, texts, d, opts)
+	}
+	if err := c.checkEmbed("EmbedBatchInto", &o); err != nil {
+		return 0, fmt.Errorf("embed batch: %w", err)
+	}
+	dim, err := c.destDimension(ctx, o)
+	if err != nil {
+		return 0, fmt.Errorf("embed batch: %w", err)
+	}
+	if err := d.fit(len(texts), dim); err != nil {
+		return 0, fmt.Errorf("embed batch: %w", err)
+	}
+	// Preprocessing splits the inputs into chunks of their own, which the
+	// rows of dst do not follow.
+	if c.preprocess == nil {
+		ctx = context.WithValue(ctx, embedDestKey{}, d)
+	}
+	vectors, err := c.EmbedBatch(ctx, texts, opts...)
+	n := 0
+	for i, v := range vectors {
+		if v == nil {
+			continue
+		}
+		if len(v) != dim {
+			return n, &ResponseValidationError{Method: MethodEmbed, Rule: RuleDimension, Index: i, Want: dim, Got: len(v)}
+		}
+		d.put(i, v)
+		n++
+	}
+	return n, err
+}
+
+// destDimension returns the length of the vectors an EmbedBatchInto call
+// with o, checked by checkEmbed, writes.
+func (c *Client) destDimension(ctx context.Context, o embedOptions) (int, error) {
+	switch {
+	case o.dimensions > 0:
+		return o.dimensions, nil
+	case o.expectedDim > 0:
+		return o.expectedDim, nil
+	}
+	if dim := c.knownDimension(o.model, 0); dim > 0 {
+		return dim, nil
+	}
+	m, err := c.lookupModel(ctx, o.model)
+	switch {
+	case err == nil && m.Dimension > 0:
+		return m.Dimension, nil
+	case ctx.Err() != nil:
+		return 0, err
+	case err != nil:
+		return 0, fmt.Errorf("%w for model %q: %w", ErrUnknownDimension, o.model, err)
+	}
+	return 0, fmt.Errorf("%w: model %q is listed without one; see WithExpectedDimension", ErrUnknownDimension, o.model)
+}
+
+// embedDestKey carries the *embedDest of an EmbedBatchInto call to the
+// requests of its chunks; a nil one marks requests whose vectors must not
+// land in it.
+type embedDestKey struct{}
+
+// embedDest is where an EmbedBatchInto call wants its vectors: flat, dim
+// components per input, or rows.
+type embedDest struct {
+	dim  int
+	flat []float32
+	rows [][]float32
+	// start is the first input of the chunk of the call whose requests
+	// carry d; see withChunkDest.
+	start int
+}
+
+// fit checks that d has room for n vectors of dim components.
+func (d *embedDest) fit(n, dim int) error {
+	d.dim = dim
+	if d.rows == nil {
+		if len(d.flat) < n*dim {
+			return fmt.Errorf("dst holds %d components, fewer than the %d of %d vectors of %d", len(d.flat), n*dim, n, dim)
+		}
+		return nil
+	}
+	if len(d.rows) < n {
+		return fmt.Errorf("%d rows for %d inputs", len(d.rows), n)
+	}
+	for i, row := range d.rows[:n] {
+		if cap(row) < dim {
+			return fmt.Errorf("row %d has room for %d components, fewer than %d", i, cap(row), dim)
+		}
+	}
+	return nil
+}
+
+// slot returns the room for the vector of input i of d's chunk, empty with
+// capacity dim, for the decoder to append the vector to.
+func (d *embedDest) slot(i int) []float32 {
+	i += d.start
+	if d.rows != nil {
+		return d.rows[i][:0:d.dim]
+	}
+	off := i * d.dim
+	return d.flat[off:off:(off + d.dim)]
+}
+
+// put makes v the vector of input i of the call, copying it unless it was
+// decoded in place.
+func (d *embedDest) put(i int, v []float32) {
+	var row []float32
+	if d.rows != nil {
+		d.rows[i] = d.rows[i][:d.dim]
+		row = d.rows[i]
+	} else {
+		row = d.flat[i*d.dim : (i+1)*d.dim]
+	}
+	if d.dim > 0 && &row[0] == &v[0] {
+		return
+	}
+	copy(row, v)
+}
+
+// requestDest returns the destination the vectors of a request sent with
+// ctx may be decoded into, or nil.
+func requestDest(ctx context.Context) *embedDest {
+	d, _ := ctx.Value(embedDestKey{}).(*embedDest)
+	return d
+}
+
+// withChunkDest narrows the destination ctx carries, if any, to the chunk
+// of the call's inputs that begins at start.
+func withChunkDest(ctx context.Context, start int) context.Context {
+	d := requestDest(ctx)
+	if d == nil {
+		return ctx
+	}
+	chunk := *d
+	chunk.start = start
+	return context.WithValue(ctx, embedDestKey{}, &chunk)
+}
+
+// withoutDest keeps the vectors of the requests sent with ctx out of the
+// destination it carries, for vectors that are kept, shared, or not
+// returned as decoded.
+func withoutDest(ctx context.Context) context.Context {
+	if requestDest(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, embedDestKey{}, (*embedDest)(nil))
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler answers as handle does, counting the embed requests.
+func countingHandler(handle fakeHandler, embeds *atomic.Int64) fakeHandler {
+	return func(req *Request) *Response {
+		if req.Method == MethodEmbed {
+			embeds.Add(1)
+		}
+		return handle(req)
+	}
+}
+
+func inprocClient(t *testing.T, cfg ClientConfig, handle fakeHandler) *Client {
+	t.Helper()
+	cfg.Transport, cfg.Handler = TransportInProc, inprocHandler(handle)
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestEmbedBatchInto(t *testing.T) {
+	ctx := context.Background()
+	c := inprocClient(t, ClientConfig{}, defaultHandler)
+	texts := batchInputs(7)
+	want, err := c.EmbedBatch(ctx, texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The room past the vectors is left alone.
+	dst := make([]float32, 3*len(texts)+2)
+	dst[len(dst)-2], dst[len(dst)-1] = 9, 9
+	n, err := c.EmbedBatchInto(ctx, texts, dst, WithBatchSize(3))
+	if err != nil || n != len(texts) {
+		t.Fatalf("EmbedBatchInto = %d, %v", n, err)
+	}
+	for i, v := range want {
+		if got := dst[3*i : 3*i+3]; !reflect.DeepEqual(got, v) {
+			t.Errorf("row %d = %v, want %v", i, got, v)
+		}
+	}
+	if dst[len(dst)-2] != 9 || dst[len(dst)-1] != 9 {
+		t.Errorf("EmbedBatchInto wrote past its rows: %v", dst[3*len(texts):])
+	}
+
+	rows := make([][]float32, len(texts))
+	backing := make([]float32, 8*len(texts))
+	for i := range rows {
+		rows[i] = backing[8*i : 8*i : 8*i+8]
+	}
+	if n, err := c.EmbedBatchIntoRows(ctx, texts, rows, WithBatchSize(3)); err != nil || n != len(texts) {
+		t.Fatalf("EmbedBatchIntoRows = %d, %v", n, err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+	for i, row := range rows {
+		if &row[0] != &backing[8*i] {
+			t.Fatalf("row %d was not reused", i)
+		}
+	}
+}
+
+func TestEmbedBatchIntoOutOfOrder(t *testing.T) {
+	// The results come in reverse, the vector of the second ahead of its
+	// index.
+	handle := func(req *Request) *Response {
+		if req.Method != MethodEmbed {
+			return defaultHandler(req)
+		}
+		resp := defaultHandler(req)
+		resp.Result = json.RawMessage(`{"model":"m","embeddings":[{"index":2,"vector":[2,2,2]},{"vector":[1,1,1],"index":1},{"index":0,"vector":"AAAAAAAAAAAAAAAA"}]}`)
+		return resp
+	}
+	c := inprocClient(t, ClientConfig{}, handle)
+	dst := make([]float32, 9)
+	if n, err := c.EmbedBatchInto(context.Background(), []string{"a", "b", "c"}, dst); err != nil || n != 3 {
+		t.Fatalf("EmbedBatchInto = %d, %v", n, err)
+	}
+	if want := []float32{0, 0, 0, 1, 1, 1, 2, 2, 2}; !reflect.DeepEqual(dst, want) {
+		t.Fatalf("dst = %v, want %v", dst, want)
+	}
+}
+
+func TestEmbedBatchIntoDimension(t *testing.T) {
+	ctx := context.Background()
+	var embeds atomic.Int64
+	// The fake lists no model by this name.
+	c := inprocClient(t, ClientConfig{Model: "unlisted"}, countingHandler(defaultHandler, &embeds))
+	dst := make([]float32, 6)
+	if _, err := c.EmbedBatchInto(ctx, []string{"a", "b"}, dst); !errors.Is(err, ErrUnknownDimension) {
+		t.Fatalf("EmbedBatchInto of an unlisted model: %v", err)
+	}
+	if _, err := c.EmbedBatchInto(ctx, []string{"a", "b", "c"}, dst, WithExpectedDimension(3)); err == nil || !strings.Contains(err.Error(), "fewer than the 9") {
+		t.Fatalf("EmbedBatchInto into too short a dst: %v", err)
+	}
+	if _, err := c.EmbedBatchIntoRows(ctx, []string{"a"}, [][]float32{make([]float32, 2)}, WithExpectedDimension(3)); err == nil {
+		t.Fatal("EmbedBatchIntoRows accepted a row too short")
+	}
+	if embeds.Load() != 0 {
+		t.Fatalf("%d embed requests sent before the dimension was known", embeds.Load())
+	}
+	if n, err := c.EmbedBatchInto(ctx, []string{"a", "b"}, dst, WithExpectedDimension(3)); err != nil || n != 2 {
+		t.Fatalf("EmbedBatchInto with an expected dimension = %d, %v", n, err)
+	}
+	// A dimension the server does not keep to fails the call, lax
+	// validation or not.
+	lax := inprocClient(t, ClientConfig{Model: "unlisted", LaxValidation: true}, defaultHandler)
+	var verr *ResponseValidationError
+	if _, err := lax.EmbedBatchInto(ctx, []string{"a"}, dst, WithExpectedDimension(2)); !errors.As(err, &verr) || verr.Rule != RuleDimension {
+		t.Fatalf("EmbedBatchInto of vectors of another dimension: %v", err)
+	}
+}
+
+func TestEmbedBatchIntoCache(t *testing.T) {
+	ctx := context.Background()
+	c := inprocClient(t, ClientConfig{Cache: CacheConfig{MaxEntries: 10}}, defaultHandler)
+	dst := make([]float32, 6)
+	if _, err := c.EmbedBatchInto(ctx, []string{"a", "bb"}, dst); err != nil {
+		t.Fatal(err)
+	}
+	// Reusing dst leaves the cached vectors as they were.
+	clear(dst)
+	v, err := c.Embed(ctx, "bb")
+	if err != nil || !reflect.DeepEqual(v, []float32{2, 0.5, -0.5}) {
+		t.Fatalf("cached vector = %v, %v", v, err)
+	}
+	if _, err := c.EmbedBatchInto(ctx, []string{"a", "bb"}, dst); err != nil || !reflect.DeepEqual(dst, []float32{1, 0.5, -0.5, 2, 0.5, -0.5}) {
+		t.Fatalf("dst from the cache = %v, %v", dst, err)
+	}
+}
+
+func TestEmbedBatchIntoAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector's allocations swamp the decoder's")
+	}
+	const batch, dim = 64, 1024
+	req, err := newRequest(1, MethodEmbed, embedParams{Model: "m", Inputs: benchWords(batch)}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := benchHandler(dim, EncodingBase64)(req).Result
+	d := &embedDest{flat: make([]float32, batch*dim)}
+	if err := d.fit(batch, dim); err != nil {
+		t.Fatal(err)
+	}
+	// Both decode with the same hints; only the destination differs.
+	decoded := func(dest *embedDest) int64 {
+		return testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := embedResult{batch: batch, dim: dim, dest: dest}
+				if err := r.UnmarshalJSON(raw); err != nil || len(r.Embeddings) != batch {
+					b.Fatalf("decoded %d embeddings, %v", len(r.Embeddings), err)
+				}
+			}
+		}).AllocedBytesPerOp()
+	}
+	standard, into := decoded(nil), decoded(d)
+	// Decoding into dst saves the vectors' allocation.
+	if vectors := int64(4 * batch * dim); standard < into+vectors*9/10 {
+		t.Fatalf("decoding allocates %d bytes, and %d into dst; want %d fewer", standard, into, vectors)
+	}
+	t.Logf("decoding allocates %d bytes, and %d into dst", standard, into)
+}
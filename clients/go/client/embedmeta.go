@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// EmbedCallResult is the outcome of an EmbedWithMeta call: its vectors and
+// what the server reported producing them. Fields the server does not
+// report are zero.
+type EmbedCallResult struct {
+	// Vectors holds one vector per input, in input order.
+	Vectors [][]float32
+	// Usage sums the tokens the call's requests used; see EmbedInfo.Usage.
+	Usage Usage
+	// ModelVersion is the exact model version the server answered with;
+	// see EmbedInfo.ModelVersion.
+	ModelVersion string
+	// Truncated reports, per input, whether the input was cut to the
+	// model's limit, by WithTruncate or by the server. Inputs served from
+	// the cache report false.
+	Truncated []bool
+	// Chunks holds, per input, the chunks ClientConfig.Preprocess split it
+	// into, with their offsets and vectors. An input split into several
+	// without MeanPool has a nil vector in Vectors; its chunks' are here.
+	Chunks [][]Chunk
+	// RequestID is the request ID every request of the call was sent with;
+	// see WithRequestID.
+	RequestID string
+	// Duration is how long the call took.
+	Duration time.Duration
+}
+
+// EmbedWithMeta is EmbedBatch returning, along with the vectors, the usage,
+// model version, and truncation the server reports for the call, for
+// billing and reproducibility. It works over every transport and protocol
+// mode. Unless ctx carries a request ID one is generated, shared by all of
+// the call's requests; calls with a request ID are never coalesced with
+// others, so what is reported is the call's own. With WithPartialResults
+// the inputs of failed chunks have nil vectors and the error is returned
+// along with the result.
+func (c *Client) EmbedWithMeta(ctx context.Context, texts []string, opts ...EmbedOption) (*EmbedCallResult, error) {
+	start := c.now()
+	ctx, id := requestID(ctx, start)
+	var info EmbedInfo
+	// The call's own WithEmbedInfo, if any, is overridden: info fills the
+	// result.
+	vecs, err := c.EmbedBatch(ctx, texts, append(slices.Clip(opts), WithEmbedInfo(&info), keepChunks())...)
+	if vecs == nil {
+		return nil, err
+	}
+	res := &EmbedCallResult{
+		Vectors:      vecs,
+		Usage:        info.Usage,
+		ModelVersion: info.ModelVersion,
+		Truncated:    make([]bool, len(texts)),
+		Chunks:       info.Chunks,
+		RequestID:    id,
+		Duration:     c.now().Sub(start),
+	}
+	for _, i := range info.TruncatedInputs {
+		res.Truncated[i] = true
+	}
+	for _, i := range info.ServerTruncatedInputs {
+		res.Truncated[i] = true
+	}
+	return res, err
+}
+
+// keepChunks has the EmbedBatch call of EmbedWithMeta report the chunks
+// of inputs the preprocessor splits instead of failing on them.
+func keepChunks() EmbedOption {
+	return func(o *embedOptions) { o.keepChunks = true }
+}
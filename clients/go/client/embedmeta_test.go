@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// metaHandler answers mcp.embed as defaultHandler does, reporting besides
+// the model version "fake@2", a token per input, and the inputs starting
+// "long" as truncated.
+func metaHandler(req *Request) *Response {
+	resp := defaultHandler(req)
+	if req.Method != MethodEmbed || resp.Error != nil {
+		return resp
+	}
+	var params embedParams
+	_ = json.Unmarshal(req.Params, &params)
+	type entry struct {
+		Index     int    `json:"index"`
+		Vector    string `json:"vector"`
+		Truncated bool   `json:"truncated,omitempty"`
+	}
+	entries := make([]entry, len(params.Inputs))
+	for i, input := range params.Inputs {
+		v := []float32{float32(len(input)), 0.5, -0.5}
+		entries[i] = entry{Index: i, Vector: encodeBase64Vector(v), Truncated: strings.HasPrefix(input, "long")}
+	}
+	resp.Result, _ = json.Marshal(map[string]any{
+		"model":           params.Model,
+		"model_version":   "fake@2",
+		"embeddings":      entries,
+		"encoding_format": EncodingBase64,
+		"usage":           Usage{PromptTokens: len(params.Inputs), TotalTokens: len(params.Inputs)},
+	})
+	return resp
+}
+
+func TestEmbedWithMeta(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(metaHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(metaHandler))
+	defer wsSrv.Close()
+	for name, cfg := range map[string]ClientConfig{
+		"inproc":    {Transport: TransportInProc, Handler: inprocHandler(metaHandler)},
+		"http":      {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"websocket": {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		// The fake gRPC server reports the model version "<model>@2".
+		"grpc": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []string
+			record := WithInterceptor(func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+				if req.Method == MethodEmbed {
+					ids = append(ids, RequestIDFromContext(ctx))
+				}
+				return next(ctx, req)
+			})
+			var c *Client
+			if name == "grpc" {
+				c = newGRPCClient(t, &fakeGRPC{}, record)
+			} else {
+				var err error
+				if c, err = NewClient("", WithConfig(cfg), record); err != nil {
+					t.Fatalf("NewClient: %v", err)
+				}
+				defer c.Close(context.Background())
+			}
+			texts := []string{"a", "long text", "bcd", "long again"}
+			res, err := c.EmbedWithMeta(context.Background(), texts, WithBatchSize(2), WithConcurrency(1))
+			if err != nil {
+				t.Fatalf("EmbedWithMeta: %v", err)
+			}
+			if len(res.Vectors) != len(texts) || res.Vectors[2][0] != 3 {
+				t.Errorf("vectors %v", res.Vectors)
+			}
+			if res.Usage != (Usage{PromptTokens: 4, TotalTokens: 4}) {
+				t.Errorf("usage %+v", res.Usage)
+			}
+			if !strings.HasSuffix(res.ModelVersion, "@2") {
+				t.Errorf("model version %q", res.ModelVersion)
+			}
+			if want := []bool{false, true, false, true}; !slices.Equal(res.Truncated, want) {
+				t.Errorf("truncated %v, want %v", res.Truncated, want)
+			}
+			if res.RequestID == "" || res.Duration <= 0 {
+				t.Errorf("request ID %q, duration %s", res.RequestID, res.Duration)
+			}
+			if len(ids) != 2 || ids[0] != res.RequestID || ids[1] != res.RequestID {
+				t.Errorf("requests sent with IDs %v, want %s for both chunks", ids, res.RequestID)
+			}
+
+			// A request ID the caller set is kept, and tallies are per call.
+			res, err = c.EmbedWithMeta(WithRequestID(context.Background(), "again"), texts[1:2])
+			if err != nil {
+				t.Fatalf("EmbedWithMeta again: %v", err)
+			}
+			if res.RequestID != "again" || res.Usage.TotalTokens != 1 || !slices.Equal(res.Truncated, []bool{true}) {
+				t.Errorf("second call reported %+v", res)
+			}
+		})
+	}
+}
+
+// TestEmbedWithMetaUnreported checks the zero values for a server that
+// reports nothing but the vectors.
+func TestEmbedWithMetaUnreported(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(shortModelHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	res, err := c.EmbedWithMeta(context.Background(), []string{"short", "one two three four five six"}, WithTruncate(TruncateEnd))
+	if err != nil {
+		t.Fatalf("EmbedWithMeta: %v", err)
+	}
+	if res.Usage != (Usage{}) || res.ModelVersion != "" {
+		t.Errorf("usage %+v, model version %q", res.Usage, res.ModelVersion)
+	}
+	// The client's own truncation is reported all the same.
+	if !slices.Equal(res.Truncated, []bool{false, true}) {
+		t.Errorf("truncated %v", res.Truncated)
+	}
+}
@@ -0,0 +1,299 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// streamingTransport is implemented by transports that can answer one
+// request with a sequence of response frames.
+type streamingTransport interface {
+	// RoundTripStream sends req and passes each frame carrying its ID to
+	// handle, in arrival order, until handle reports the last one or fails.
+	RoundTripStream(ctx context.Context, req *Request, handle frameHandler) error
+}
+
+// frameHandler consumes one frame of a streamed response and reports whether
+// more frames follow.
+type frameHandler func(resp *Response) (more bool, err error)
+
+// EmbedResult is one result delivered by EmbedStream.
+type EmbedResult struct {
+	// Index is the position of the input in the texts passed to
+	// EmbedStream, or -1 for an error that ended the stream early.
+	Index  int
+	Vector []float32
+	Err    error
+}
+
+// embedFrame is the result of one mcp.embed.stream frame: either an
+// embedding (or per-input error) for index, or the terminal done marker.
+type embedFrame struct {
+	Index  int        `json:"index"`
+	Vector vectorData `json:"vector,omitempty"`
+	Error  *RPCError  `json:"error,omitempty"`
+	Done   bool       `json:"done,omitempty"`
+	// Seq numbers the frames of a resumable stream from 1, and the first
+	// of them carries the ResumeToken naming the stream.
+	Seq         int64  `json:"seq,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Checksum is the VectorChecksum of Vector, for servers that send one.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// EmbedStream embeds texts and delivers each vector as soon as the server
+// has computed it, in the order the server produces them. The server answers
+// mcp.embed.stream with one frame per input followed by a done frame: NDJSON
+// over http and tls, one message per frame on the stream and ws transports.
+// Every frame is recorded, and so is a failure that cuts the stream short.
+// With ClientConfig.StreamResume a stream whose connection is lost resumes
+// where it stopped, or ends with a *StreamResumeError.
+// Transports without streaming support, servers
+// without it, and sessions that negotiated protocol version 1 get a single
+// mcp.embed request instead.
+//
+// The channel is closed once every result has been delivered. A failure that
+// ends the stream is delivered as a final result with Index -1. Cancelling
+// ctx stops the stream and closes the channel without further results.
+func (c *Client) EmbedStream(ctx context.Context, texts []string) (<-chan EmbedResult, error) {
+	if err := c.checkStream(); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbedStream, err)
+	}
+	resume := c.cfg.StreamResume
+	params := embedParams{Model: c.cfg.Model, Inputs: texts, EncodingFormat: EncodingBase64, Resumable: resume.enabled()}
+	req, err := newRequest(c.nextID.Add(1), MethodEmbedStream, params, c.now())
+	if err != nil {
+		return nil, err
+	}
+	req.bare = c.cfg.WireProtocol == JSONRPC2
+	ctx, req.Meta.RequestID = requestID(ctx, c.now())
+	if err := c.checkRequestSize(ctx, req); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbedStream, err)
+	}
+	if err := c.gate.enter(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", MethodEmbedStream, err)
+	}
+	// The stream holds the gate until it ends, and its fallback request
+	// rides on that.
+	release := ctx
+	ctx = context.WithValue(ctx, admittedKey{}, true)
+	out := make(chan EmbedResult)
+	send := func(r EmbedResult) error {
+		select {
+		case out <- r:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	st, ok := c.transport.(streamingTransport)
+	// Streaming arrived with protocol version 2.
+	ok = ok && c.protocolAtLeast(2)
+	go func() {
+		defer close(out)
+		defer c.gate.exit(release)
+		if !ok {
+			c.embedUnstreamed(ctx, texts, send)
+			return
+		}
+		received := 0
+		v := c.validator(MethodEmbedStream, len(texts), c.knownDimension(c.cfg.Model, 0))
+		var slow *slowWatch
+		if p := c.cfg.SlowRequests; p.FirstFrameThreshold > 0 || p.StreamThreshold > 0 {
+			slow = c.watchSlow(req, len(texts))
+		}
+		var span Span
+		var spanErr error
+		if c.tracer != nil {
+			// One span covers the stream, with an event per frame.
+			ctx, span = c.startSpan(ctx, req)
+			defer func() {
+				span.SetAttributes(Attribute{attrStreamFrames, received})
+				endSpan(span, spanErr)
+			}()
+		}
+		// rec records the stream, its frames linked to the span's trace.
+		rec := linkTrace(ctx, c.cfg.Recorder, req)
+		// ended is a failure reported by the server's final frame; unlike a
+		// transport error it leaves the connection usable.
+		var ended error
+		var rpcErr *RPCError
+		// wire, with a MaxPipelineDepth, records the attempt's envelopes as
+		// the transport writes and reads them instead.
+		var wire *wireRecorder
+		// token names a resumable stream and seq is its last frame handled;
+		// resumed marks an attempt continuing it, and refused the server
+		// declining to.
+		var token string
+		var seq, acked int64
+		resumed, attemptFrames := false, 0
+		var refused *RPCError
+		handle := func(resp *Response) (bool, error) {
+			if wire == nil {
+				noteAnswer(rec, resp, nil)
+				recordMessage(rec, DirectionResponse, resp)
+			}
+			c.metrics.received(MethodEmbedStream, resp)
+			if slow != nil && received == 0 && ended == nil {
+				slow.check(c, c.cfg.SlowRequests.FirstFrameThreshold, true, nil)
+			}
+			if resp.Error != nil {
+				if resumed && attemptFrames == 0 {
+					refused = resp.Error
+				} else {
+					rpcErr, ended = resp.Error, resp.Error
+				}
+				return false, nil
+			}
+			attemptFrames++
+			if err := c.checkFields(MethodEmbedStream, "frame", resp.Result); err != nil {
+				return false, err
+			}
+			var f embedFrame
+			if err := json.Unmarshal(resp.Result, &f); err != nil {
+				return false, fmt.Errorf("decode frame: %w: %w", ErrProtocol, err)
+			}
+			if f.ResumeToken != "" {
+				token = f.ResumeToken
+			}
+			if f.Seq > 0 {
+				if f.Seq <= seq {
+					// A resumed stream may repeat frames already handled.
+					return true, nil
+				}
+				seq = f.Seq
+			}
+			if f.Done {
+				if received != len(texts) {
+					ended = fmt.Errorf("stream ended after %d of %d results: %w", received, len(texts), ErrProtocol)
+				}
+				return false, nil
+			}
+			if err := v.place(f.Index); err != nil {
+				return false, err
+			}
+			received++
+			if span != nil {
+				span.AddEvent("frame", Attribute{attrFrameIndex, f.Index})
+			}
+			r := EmbedResult{Index: f.Index, Vector: f.Vector}
+			if f.Error != nil {
+				r.Vector, r.Err = nil, fmt.Errorf("%s: input %d: %w", MethodEmbedStream, f.Index, rpcAPIError(f.Error))
+			} else if err := v.vector(f.Index, f.Vector); err != nil {
+				// A vector that fails validation fails its input alone.
+				r.Vector, r.Err = nil, err
+			} else if err := f.verifyChecksum(c.cfg.RequireChecksums); err != nil {
+				r.Vector, r.Err = nil, err
+			}
+			if err := send(r); err != nil {
+				return false, err
+			}
+			if token != "" && resume.enabled() && seq-acked >= int64(resume.ackInterval()) {
+				// Acks only free the server's replay buffer, so a lost one
+				// costs nothing.
+				_ = c.Notify(ctx, MethodEmbedStreamAck, streamAckParams{ResumeToken: token, Seq: seq})
+				acked = seq
+			}
+			return true, nil
+		}
+		attempt := func(req *Request) error {
+			return c.guard(ctx, func() error {
+				if err := c.throttle(ctx); err != nil {
+					return err
+				}
+				if err := c.inFlight.acquire(ctx, MethodEmbedStream, PriorityNormal); err != nil {
+					return err
+				}
+				defer c.inFlight.release()
+				sendCtx, sent := ctx, req
+				if c.cfg.Recorder != nil && c.pipelined {
+					wire = newWireRecorder(rec, req, true)
+					sendCtx = context.WithValue(sendCtx, wireRecordKey{}, wire)
+				} else {
+					recordMessage(rec, DirectionRequest, c.recorded(req))
+				}
+				if c.tracer != nil {
+					sendCtx, sent = c.propagateTrace(sendCtx, sent)
+				}
+				if c.signer != nil {
+					var err error
+					if sendCtx, err = c.signContext(sendCtx, sent); err != nil {
+						return err
+					}
+				}
+				done := c.metrics.begin(MethodEmbedStream)
+				c.metrics.sent(MethodEmbedStream, sent)
+				err := st.RoundTripStream(sendCtx, sent, handle)
+				if err != nil {
+					done(err)
+				} else {
+					done(ended)
+				}
+				if wire != nil {
+					wire.finish(nil, err)
+				} else if err != nil && c.cfg.Recorder != nil {
+					// The frames delivered so far are recorded already.
+					noteAnswer(rec, nil, err)
+					rec.Record(FailureEntry(req, err))
+				}
+				return err
+			})
+		}
+		err := attempt(req)
+		for resumes := 0; err != nil && token != "" && resume.enabled() && ctx.Err() == nil && isConnectionError(err); {
+			if resumes == resume.MaxResumes {
+				err = &StreamResumeError{Delivered: received, Seq: seq, Remaining: remainingInputs(v.seen), Resumes: resumes, Err: err}
+				break
+			}
+			resumes++
+			c.log.WarnContext(ctx, "resuming stream", "rpc_id", req.ID, "after_seq", seq, "resume", resumes, "error", err)
+			if !sleepUntil(ctx, time.Now().Add(c.cfg.Retry.withDefaults().backoff(resumes, err))) {
+				break
+			}
+			next, rerr := newRequest(c.nextID.Add(1), MethodEmbedStreamResume, streamResumeParams{ResumeToken: token, AfterSeq: seq}, c.now())
+			if rerr != nil {
+				err = rerr
+				break
+			}
+			next.bare, next.Meta.RequestID = req.bare, req.Meta.RequestID
+			resumed, attemptFrames, refused = true, 0, nil
+			if err = attempt(next); err == nil && refused != nil {
+				err = &StreamResumeError{Delivered: received, Seq: seq, Remaining: remainingInputs(v.seen), Resumes: resumes, Err: rpcAPIError(refused)}
+			}
+		}
+		if err == nil && ended != nil {
+			if received == 0 && rpcErr != nil && rpcErr.Code == CodeMethodNotFound {
+				c.embedUnstreamed(ctx, texts, send)
+				return
+			}
+			err = ended
+		}
+		spanErr = err
+		if slow != nil {
+			slow.check(c, c.cfg.SlowRequests.StreamThreshold, false, err)
+		}
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		_ = send(EmbedResult{Index: -1, Err: fmt.Errorf("%s: %w", MethodEmbedStream, err)})
+	}()
+	return out, nil
+}
+
+// embedUnstreamed serves EmbedStream with a single mcp.embed request.
+func (c *Client) embedUnstreamed(ctx context.Context, texts []string, send func(EmbedResult) error) {
+	vectors, err := c.embedInputs(ctx, texts, embedOptions{model: c.cfg.Model})
+	if err != nil {
+		if ctx.Err() == nil {
+			_ = send(EmbedResult{Index: -1, Err: err})
+		}
+		return
+	}
+	for i, v := range vectors {
+		if send(EmbedResult{Index: i, Vector: v}) != nil {
+			return
+		}
+	}
+}
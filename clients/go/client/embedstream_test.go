@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collect drains an EmbedStream channel.
+func collect(t *testing.T, ch <-chan EmbedResult) []EmbedResult {
+	t.Helper()
+	var results []EmbedResult
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				return results
+			}
+			results = append(results, r)
+		case <-timeout:
+			t.Fatal("stream did not finish")
+		}
+	}
+}
+
+func TestEmbedStreamAcrossTransports(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+
+	configs := map[string]ClientConfig{
+		"stdio": {Command: helperCommand(t)},
+		"http":  {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"ws":    {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+	}
+	texts := []string{"a", "bb", "bad", "dddd"}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			sink := &recordingSink{}
+			cfg.Recorder = sink
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+
+			ch, err := c.EmbedStream(context.Background(), texts)
+			if err != nil {
+				t.Fatalf("EmbedStream: %v", err)
+			}
+			results := collect(t, ch)
+			if len(results) != len(texts) {
+				t.Fatalf("expected %d results, got %+v", len(texts), results)
+			}
+			// The fake server streams the last input first.
+			for i, r := range results {
+				if want := len(texts) - 1 - i; r.Index != want {
+					t.Fatalf("result %d has index %d, want %d", i, r.Index, want)
+				}
+				if texts[r.Index] == "bad" {
+					if r.Err == nil || r.Vector != nil {
+						t.Fatalf("expected a per-input error, got %+v", r)
+					}
+				} else if r.Err != nil || int(r.Vector[0]) != len(texts[r.Index]) {
+					t.Fatalf("unexpected result %+v", r)
+				}
+			}
+			// One request, a frame per input, and the done frame.
+			if len(sink.entries) != len(texts)+2 {
+				t.Fatalf("expected %d recorded frames, got %d", len(texts)+2, len(sink.entries))
+			}
+			var last embedFrame
+			var resp Response
+			_ = json.Unmarshal(sink.entries[len(sink.entries)-1].Message, &resp)
+			if err := json.Unmarshal(resp.Result, &last); err != nil || !last.Done {
+				t.Fatalf("last recorded frame is not the done marker: %s", sink.entries[len(sink.entries)-1].Message)
+			}
+
+			// The connection is reusable after the stream.
+			if _, err := c.Embed(context.Background(), "after"); err != nil {
+				t.Fatalf("Embed after stream: %v", err)
+			}
+		})
+	}
+}
+
+func TestEmbedStreamCancel(t *testing.T) {
+	c, err := New(ClientConfig{Command: helperCommand(t)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := c.EmbedStream(ctx, make([]string, 1000))
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	<-ch
+	cancel()
+	if results := collect(t, ch); len(results) > 1 {
+		t.Fatalf("stream kept delivering after cancel: %d results", len(results))
+	}
+}
+
+func TestEmbedStreamWithoutStreamingSupport(t *testing.T) {
+	cases := map[string]*Client{
+		"transport": NewWithTransport(ClientConfig{}, okStub("stub")),
+	}
+	inproc, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(func(req *Request) *Response {
+		if req.Method == MethodEmbedStream {
+			// A server that predates streaming.
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeMethodNotFound, Message: "method not found"}}
+		}
+		return defaultHandler(req)
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer inproc.Close(context.Background())
+	cases["server"] = inproc
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ch, err := c.EmbedStream(context.Background(), []string{"one", "three"})
+			if err != nil {
+				t.Fatalf("EmbedStream: %v", err)
+			}
+			results := collect(t, ch)
+			if len(results) != 2 || results[0].Index != 0 || results[1].Vector[0] != 5 {
+				t.Fatalf("unexpected results %+v", results)
+			}
+		})
+	}
+}
+
+func TestEmbedStreamReportsTruncatedStream(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(func(req *Request) *Response {
+		raw, _ := json.Marshal(embedFrame{Done: true})
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ch, err := c.EmbedStream(context.Background(), []string{"lost"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	results := collect(t, ch)
+	if len(results) != 1 || results[0].Index != -1 || !strings.Contains(results[0].Err.Error(), "0 of 1") {
+		t.Fatalf("expected a terminal error, got %+v", results)
+	}
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Vector encodings an embed result may use. Embed requests carry
+// "encoding_format": EncodingBase64 to say the client accepts it; servers
+// that do not know the field keep answering with numeric arrays, and each
+// vector is decoded in whichever encoding it arrived.
+const (
+	// EncodingFloat is a JSON array of numbers.
+	EncodingFloat = "float"
+	// EncodingBase64 is the standard base64 encoding of the vector's
+	// little-endian IEEE 754 float32 components, about a third the size of
+	// the array and decoded without parsing numbers.
+	EncodingBase64 = "base64"
+)
+
+// vectorData is a vector decoded from either encoding.
+type vectorData []float32
+
+func (v *vectorData) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*[]float32)(v))
+	}
+	raw := data[1 : len(data)-1]
+	if bytes.IndexByte(raw, '\\') >= 0 {
+		// An encoder escaped "/" or similar; take the slow path.
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		raw = []byte(s)
+	}
+	out, err := decodeBase64Float32s(raw, makeFloat32s)
+	if err != nil {
+		return err
+	}
+	*v = out
+	return nil
+}
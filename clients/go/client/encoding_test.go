@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVectorDataDecodesBothEncodings(t *testing.T) {
+	want := vectorData{1.5, -0.25, float32(math.Inf(1)), 3e-39}
+	encoded := encodeBase64Vector(want)
+	// Infinity has no JSON number, so only base64 carries it.
+	cases := map[string]string{
+		"base64":  `"` + encoded + `"`,
+		"escaped": `"` + strings.ReplaceAll(encoded, "/", `\/`) + `"`,
+	}
+	for name, data := range cases {
+		var got vectorData
+		if err := json.Unmarshal([]byte(data), &got); err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v, %v", name, got, err)
+		}
+	}
+
+	var v vectorData
+	if err := json.Unmarshal([]byte(`[0.5,2]`), &v); err != nil || !reflect.DeepEqual(v, vectorData{0.5, 2}) {
+		t.Fatalf("array: got %v, %v", v, err)
+	}
+	for _, bad := range []string{`"AAA="`, `"not base64!"`} {
+		if err := json.Unmarshal([]byte(bad), &v); err == nil {
+			t.Fatalf("expected an error decoding %s", bad)
+		}
+	}
+}
+
+func TestEmbedResultScannerMatchesEncodingJSON(t *testing.T) {
+	b64 := `"` + encodeBase64Vector([]float32{1.5, -2}) + `"`
+	cases := []string{
+		`{"model":"m","embeddings":[{"index":0,"vector":[0.5,-1e-3,2]},{"index":1,"vector":[]}]}`,
+		`{"model":"m","encoding_format":"base64","embeddings":[{"index":1,"vector":` + b64 + `},{"vector":` + b64 + `,"index":0}]}`,
+		"{ \"embeddings\" : [ { \"index\" : 0 , \"vector\" : [ 1 , 2 , 3 ] } ] ,\n\"model\":\"m\" }",
+		// Mixed encodings, dimensions other than the hint, extra fields.
+		`{"embeddings":[{"index":0,"vector":[1,2,3,4]},{"index":1,"vector":` + b64 + `,"norm":{"l2":[1,"}"]}}],"usage":{"tokens":3},"x":null}`,
+		// The optional model version and truncation flags.
+		`{"model":"m","model_version":"m-2024-06","embeddings":[{"index":0,"vector":[1],"truncated":true},{"index":1,"truncated" : false ,"vector":[2]}]}`,
+		// Shapes left to encoding/json.
+		`{"embeddings":[{"index":0,"vector":[1],"truncated":null}]}`,
+		`{"embeddings":[{"index":0,"vector":[1],"truncated":"yes"}]}`,
+		`{"embeddings":[{"index":0,"vector":[1],"truncated":truex}]}`,
+		`{"Model":"m","EMBEDDINGS":[{"Index":0,"Vector":[1]}]}`,
+		`{"model":"m\u00e9","embeddings":[{"index":0,"vector":[1]}]}`,
+		`{"model":"m","embeddings":null}`,
+		`{"model":"m","embeddings":[{"index":0,"vector":null}]}`,
+		`{"embeddings":[{"index":0,"vector":[1]}],"embeddings":[{"index":1,"vector":[2]}]}`,
+		`{"model":"` + "\xff" + `","embeddings":[]}`,
+		// Failures.
+		`{"embeddings":[{"index":0,"vector":[1e60]}]}`,
+		`{"embeddings":[{"index":1.5,"vector":[1]}]}`,
+		`{"embeddings":[{"index":0,"vector":"AAA="}]}`,
+		`{"embeddings":[{"index":0,"vector":[1,]}]}`,
+	}
+	for _, data := range cases {
+		var want plainEmbedResult
+		wantErr := json.Unmarshal([]byte(data), &want)
+		for _, hint := range []embedResult{{}, {batch: 2, dim: 3}} {
+			got := hint
+			err := json.Unmarshal([]byte(data), &got)
+			if (err != nil) != (wantErr != nil) {
+				t.Fatalf("%s: error %v, encoding/json %v", data, err, wantErr)
+			}
+			got.batch, got.dim = 0, 0
+			if err == nil && !reflect.DeepEqual(plainEmbedResult(got), want) {
+				t.Fatalf("%s with hint %d×%d: got %+v, encoding/json %+v", data, hint.batch, hint.dim, got, want)
+			}
+		}
+	}
+}
+
+func TestEmbedResultSharesOneAllocation(t *testing.T) {
+	entries := make([]embeddingEntry, 100)
+	for i := range entries {
+		entries[i] = embeddingEntry{Index: i, Vector: make([]float32, 64)}
+	}
+	for _, result := range []any{embedResult{Embeddings: entries}, base64EmbedResult(DefaultModel, entries)} {
+		raw, _ := json.Marshal(result)
+		allocs := testing.AllocsPerRun(10, func() {
+			r := embedResult{batch: 100, dim: 64}
+			if err := json.Unmarshal(raw, &r); err != nil || len(r.Embeddings) != 100 {
+				t.Fatalf("decode: %v", err)
+			}
+		})
+		// The entries, the vectors, the two strings, and encoding/json's
+		// own; not one per vector.
+		if allocs > 5 {
+			t.Fatalf("decoding 100 vectors took %v allocations", allocs)
+		}
+	}
+}
+
+func TestEmbedAdvertisesBase64(t *testing.T) {
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	v, err := c.Embed(context.Background(), "abc")
+	if err != nil || !reflect.DeepEqual(v, []float32{3, 0.5, -0.5}) {
+		t.Fatalf("Embed = %v, %v", v, err)
+	}
+	params, _ := lastEmbedRequest(t, sink)
+	if params.EncodingFormat != EncodingBase64 {
+		t.Fatalf("request does not advertise base64: %+v", params)
+	}
+	// The transcript shows the encoding the server picked.
+	var resp struct {
+		Result struct {
+			EncodingFormat string `json:"encoding_format"`
+			Embeddings     []struct {
+				Vector json.RawMessage `json:"vector"`
+			} `json:"embeddings"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(sink.entries[len(sink.entries)-1].Message, &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Result.EncodingFormat != EncodingBase64 || resp.Result.Embeddings[0].Vector[0] != '"' {
+		t.Fatalf("expected a base64 response, got %s", sink.entries[len(sink.entries)-1].Message)
+	}
+}
+
+func TestEmbedFallsBackToArrays(t *testing.T) {
+	// A server that predates base64 ignores the field.
+	arrays := func(req *Request) *Response {
+		if req.Method == MethodEmbed {
+			var params map[string]any
+			_ = json.Unmarshal(req.Params, &params)
+			delete(params, "encoding_format")
+			req.Params, _ = json.Marshal(params)
+		}
+		return defaultHandler(req)
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(arrays)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	got, err := c.EmbedBatch(context.Background(), []string{"a", "bb"})
+	if err != nil || !reflect.DeepEqual(got, [][]float32{{1, 0.5, -0.5}, {2, 0.5, -0.5}}) {
+		t.Fatalf("EmbedBatch = %v, %v", got, err)
+	}
+}
+
+// benchmarkEmbedResponse is a 1,000 × 1,024-dimension embed result in
+// encoding.
+func benchmarkEmbedResponse(b *testing.B, encoding string) []byte {
+	b.Helper()
+	entries := make([]embeddingEntry, 1000)
+	for i := range entries {
+		v := make([]float32, 1024)
+		for j := range v {
+			v[j] = float32(math.Sin(float64(i*1024 + j)))
+		}
+		entries[i] = embeddingEntry{Index: i, Vector: v}
+	}
+	var result any = embedResult{Model: DefaultModel, Embeddings: entries}
+	if encoding == EncodingBase64 {
+		result = base64EmbedResult(DefaultModel, entries)
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return raw
+}
+
+func BenchmarkDecodeEmbeddings(b *testing.B) {
+	for _, encoding := range []string{EncodingFloat, EncodingBase64} {
+		raw := benchmarkEmbedResponse(b, encoding)
+		b.Run(encoding, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var result embedResult
+				if err := json.Unmarshal(raw, &result); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(raw))/(1<<20), "MiB/response")
+		})
+	}
+}
+
+// BenchmarkDecodeLargeEmbedResult decodes a response of nearly 100 MB, 8,192
+// numeric vectors of 1,024 dimensions with encoding/json and with the
+// scanner, with and without the batch and dimension hints.
+func BenchmarkDecodeLargeEmbedResult(b *testing.B) {
+	const batch, dim = 8192, 1024
+	var buf strings.Builder
+	buf.WriteString(`{"model":"bench","embeddings":[`)
+	for i := 0; i < batch; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"index":%d,"vector":[`, i)
+		for j := 0; j < dim; j++ {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatFloat(math.Sin(float64(i*dim+j))/3, 'g', -1, 32))
+		}
+		buf.WriteString("]}")
+	}
+	buf.WriteString("]}")
+	raw := []byte(buf.String())
+	decoders := map[string]func() error{
+		"encoding-json": func() error {
+			var r plainEmbedResult
+			return json.Unmarshal(raw, &r)
+		},
+		"scanner": func() error {
+			var r embedResult
+			return json.Unmarshal(raw, &r)
+		},
+		"scanner-hinted": func() error {
+			r := embedResult{batch: batch, dim: dim}
+			return json.Unmarshal(raw, &r)
+		},
+	}
+	for _, name := range []string{"encoding-json", "scanner", "scanner-hinted"} {
+		decode := decoders[name]
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := decode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(raw))/(1<<20), "MiB/response")
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Endpoint is a server address resolved to the transport that reaches it.
+type Endpoint struct {
+	// Transport is the transport the scheme selects.
+	Transport string
+	// URL is the server URL of an http, tls, grpc, or ws endpoint.
+	URL string
+	// SocketPath is the socket of a unix endpoint.
+	SocketPath string
+	// Command is the server command line of a stdio endpoint.
+	Command []string
+}
+
+// ParseEndpoint resolves endpoint by its scheme: http:// selects the http
+// transport, https:// tls, grpc:// and grpcs:// grpc, ws:// and wss:// ws,
+// unix:///path the unix
+// transport on that socket, and stdio:command the stdio transport spawning
+// command, such as stdio:./server --flag.
+func ParseEndpoint(endpoint string) (Endpoint, error) {
+	if rest, ok := strings.CutPrefix(endpoint, "stdio:"); ok {
+		command := strings.Fields(strings.TrimPrefix(rest, "//"))
+		if len(command) == 0 {
+			return Endpoint{}, fmt.Errorf("endpoint %q names no server command", endpoint)
+		}
+		return Endpoint{Transport: TransportStdio, Command: command}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" {
+		return Endpoint{}, fmt.Errorf("endpoint %q is not a URL such as http://host/mcp, unix:///path, or stdio:command", endpoint)
+	}
+	switch u.Scheme {
+	case "http":
+		return Endpoint{Transport: TransportHTTP, URL: endpoint}, nil
+	case "https":
+		return Endpoint{Transport: TransportTLS, URL: endpoint}, nil
+	case "grpc", "grpcs":
+		return Endpoint{Transport: TransportGRPC, URL: endpoint}, nil
+	case "ws", "wss":
+		return Endpoint{Transport: TransportWebSocket, URL: endpoint}, nil
+	case "unix":
+		if u.Path == "" {
+			return Endpoint{}, fmt.Errorf("endpoint %q names no socket; want unix:///path", endpoint)
+		}
+		return Endpoint{Transport: TransportUnix, SocketPath: u.Path}, nil
+	}
+	return Endpoint{}, fmt.Errorf("endpoint %q has unsupported scheme %q", endpoint, u.Scheme)
+}
+
+// accepts reports whether transport can reach e. Besides the transport e
+// selects, an https endpoint is reachable over http3.
+func (e Endpoint) accepts(transport string) bool {
+	return transport == e.Transport || e.Transport == TransportTLS && transport == TransportHTTP3
+}
+
+// apply points cfg at e over transport, which must accept it.
+func (e Endpoint) apply(cfg *ClientConfig, transport string) error {
+	if !e.accepts(transport) {
+		return fmt.Errorf("the %s transport cannot reach a %s endpoint", transport, e.Transport)
+	}
+	cfg.Transport = transport
+	switch e.Transport {
+	case TransportUnix:
+		cfg.SocketPath = e.SocketPath
+	case TransportStdio:
+		cfg.Command = e.Command
+	default:
+		cfg.Endpoint = e.URL
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	for endpoint, want := range map[string]Endpoint{
+		"http://127.0.0.1:8890/mcp":  {Transport: TransportHTTP, URL: "http://127.0.0.1:8890/mcp"},
+		"https://localhost:9443/mcp": {Transport: TransportTLS, URL: "https://localhost:9443/mcp"},
+		"ws://localhost/ws":          {Transport: TransportWebSocket, URL: "ws://localhost/ws"},
+		"wss://localhost/ws":         {Transport: TransportWebSocket, URL: "wss://localhost/ws"},
+		"unix:///run/mcp.sock":       {Transport: TransportUnix, SocketPath: "/run/mcp.sock"},
+		"stdio:./server-binary":      {Transport: TransportStdio, Command: []string{"./server-binary"}},
+		"stdio:./server --model x":   {Transport: TransportStdio, Command: []string{"./server", "--model", "x"}},
+		"stdio:///usr/bin/server":    {Transport: TransportStdio, Command: []string{"/usr/bin/server"}},
+	} {
+		got, err := ParseEndpoint(endpoint)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseEndpoint(%q) = %+v, %v; want %+v", endpoint, got, err, want)
+		}
+	}
+	for endpoint, want := range map[string]string{
+		"ftp://example.com": `unsupported scheme "ftp"`,
+		"localhost:8890":    `unsupported scheme "localhost"`,
+		"/tmp/mcp.sock":     "not a URL",
+		"unix://":           "no socket",
+		"stdio:":            "no server command",
+	} {
+		if _, err := ParseEndpoint(endpoint); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseEndpoint(%q): got %v, want an error containing %q", endpoint, err, want)
+		}
+	}
+}
+
+func TestEndpointTransportMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		transport, endpoint string
+	}{
+		{TransportStdio, "https://localhost/mcp"},
+		{TransportHTTP, "https://localhost/mcp"},
+		{TransportTLS, "unix:///run/mcp.sock"},
+		{TransportWebSocket, "stdio:./server"},
+	} {
+		_, err := NewClient(tc.endpoint, WithTransport(tc.transport))
+		if err == nil || !strings.Contains(err.Error(), tc.transport+" transport cannot reach") {
+			t.Errorf("%s over %s: got %v, want a mismatch", tc.endpoint, tc.transport, err)
+		}
+	}
+	if _, err := New(ClientConfig{Transport: TransportStdio, Command: []string{"server"}, Endpoint: "https://localhost/mcp"}); err == nil || !strings.Contains(err.Error(), "selects the tls transport") {
+		t.Fatalf("New with a mismatched endpoint: %v", err)
+	}
+
+	// New infers the transport from the endpoint as NewClient does.
+	c, err := New(ClientConfig{Endpoint: "stdio:" + helperCommand(t)[0]})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if cfg := c.Config(); cfg.Transport != TransportStdio || len(cfg.Command) != 1 {
+		t.Fatalf("inferred %q with command %q", cfg.Transport, cfg.Command)
+	}
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed over the inferred transport: %v", err)
+	}
+}
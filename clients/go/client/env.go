@@ -0,0 +1,110 @@
+package client
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variable of each configuration key,
+// as in EMBEDNEXUS_REQUEST_TIMEOUT for request-timeout.
+const EnvPrefix = "EMBEDNEXUS_"
+
+// ConfigEnvVars returns the environment variables setting the
+// configuration key, its own first and then those of its aliases, as
+// EMBEDNEXUS_REQUEST_TIMEOUT and EMBEDNEXUS_TIMEOUT for request-timeout.
+func ConfigEnvVars(key string) []string {
+	vars := []string{envVar(key)}
+	var aliases []string
+	for alias, k := range configAliases {
+		if k == key {
+			aliases = append(aliases, envVar(alias))
+		}
+	}
+	sort.Strings(aliases)
+	return append(vars, aliases...)
+}
+
+func envVar(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// SecretConfigKey reports whether key holds a credential, whose value is
+// left out of debug output such as the effective configuration.
+func SecretConfigKey(key string) bool {
+	return canonicalConfigKey(key) == "api-key"
+}
+
+// envConfig collects the configuration keys set in the environment, a
+// key's own variable winning over those of its aliases. Lists are
+// comma-separated.
+func envConfig() *ConfigFile {
+	f := &ConfigFile{Path: "environment"}
+	keys := make([]string, 0, len(configFields))
+	for k := range configFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, name := range ConfigEnvVars(k) {
+			if v, ok := os.LookupEnv(name); ok {
+				f.entries = append(f.entries, configEntry{key: k, values: []string{v}, env: name})
+				break
+			}
+		}
+	}
+	return f
+}
+
+// ConfigFromEnv returns the ClientConfig the EMBEDNEXUS_ variables
+// describe, one per key ConfigFile.Config reads, such as
+// EMBEDNEXUS_ENDPOINT, EMBEDNEXUS_API_KEY, EMBEDNEXUS_TLS_CA, and
+// EMBEDNEXUS_TIMEOUT.
+func ConfigFromEnv() (ClientConfig, error) {
+	cfg, _, err := envConfig().Config()
+	return cfg, err
+}
+
+// LoadConfig returns the ClientConfig of the configuration file at path,
+// or at DefaultConfigPath when path is empty and that file exists, with
+// the EMBEDNEXUS_ variables taking precedence over the file. Options
+// passed to NewClient along with WithConfig(cfg) take precedence over
+// both, as flags do in the CLI.
+func LoadConfig(path string) (ClientConfig, []ConfigWarning, error) {
+	file, err := loadConfigOrDefault(path)
+	if err != nil {
+		return ClientConfig{}, nil, err
+	}
+	env := envConfig()
+	merged := &ConfigFile{Path: file.Path}
+	for _, e := range file.entries {
+		if _, ok := env.lookup(canonicalConfigKey(e.key)); !ok {
+			merged.entries = append(merged.entries, e)
+		}
+	}
+	merged.entries = append(merged.entries, env.entries...)
+	cfg, _, err := merged.Config()
+	if err != nil {
+		return ClientConfig{}, nil, err
+	}
+	return cfg, file.Unknown(ConfigKeys()), nil
+}
+
+// loadConfigOrDefault reads the file at path, or an empty ConfigFile
+// when path is empty and DefaultConfigPath does not exist.
+func loadConfigOrDefault(path string) (*ConfigFile, error) {
+	if path != "" {
+		return LoadConfigFile(path)
+	}
+	def := DefaultConfigPath()
+	if def == "" {
+		return &ConfigFile{}, nil
+	}
+	f, err := LoadConfigFile(def)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ConfigFile{Path: def}, nil
+	}
+	return f, err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("EMBEDNEXUS_ENDPOINT", "https://embed.internal:9443/mcp")
+	t.Setenv("EMBEDNEXUS_API_KEY", "s3cr3t")
+	t.Setenv("EMBEDNEXUS_TLS_CA", "a.pem, b.pem")
+	t.Setenv("EMBEDNEXUS_TIMEOUT", "3s")
+	t.Setenv("EMBEDNEXUS_COMMAND", "zaevrynth-server --stdio")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if cfg.Transport != TransportTLS || cfg.Endpoint != "https://embed.internal:9443/mcp" || cfg.APIKey != "s3cr3t" || cfg.ReadTimeout != 3*time.Second {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.TLSCAFiles, []string{"a.pem", "b.pem"}) || !reflect.DeepEqual(cfg.Command, []string{"zaevrynth-server", "--stdio"}) {
+		t.Fatalf("unexpected lists %q %q", cfg.TLSCAFiles, cfg.Command)
+	}
+
+	// A key's own variable wins over its alias.
+	t.Setenv("EMBEDNEXUS_REQUEST_TIMEOUT", "4s")
+	if cfg, err = ConfigFromEnv(); err != nil || cfg.ReadTimeout != 4*time.Second {
+		t.Fatalf("ReadTimeout = %s (%v), want EMBEDNEXUS_REQUEST_TIMEOUT", cfg.ReadTimeout, err)
+	}
+	t.Setenv("EMBEDNEXUS_MAX_RESTARTS", "many")
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "EMBEDNEXUS_MAX_RESTARTS: max-restarts") {
+		t.Fatalf("bad variable: %v", err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	doc := "transport: http\nendpoint: http://file.example/mcp\nmodel: from-file\ntimeout: 1s\nmodle: typo\n"
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EMBEDNEXUS_MODEL", "from-env")
+	cfg, warnings, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Endpoint != "http://file.example/mcp" || cfg.Model != "from-env" || cfg.ReadTimeout != time.Second {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if len(warnings) != 1 || warnings[0].Suggestion != "model" {
+		t.Fatalf("warnings %v", warnings)
+	}
+	// Options passed along take precedence over both.
+	o, err := newClientOptions("http://option.example/mcp", []Option{WithConfig(cfg), WithTimeout(2 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.cfg.Endpoint != "http://option.example/mcp" || o.cfg.ReadTimeout != 2*time.Second || o.cfg.Model != "from-env" {
+		t.Fatalf("unexpected merged config %+v", o.cfg)
+	}
+
+	// Without a path the default file is optional.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if cfg, _, err = LoadConfig(""); err != nil || cfg.Model != "from-env" {
+		t.Fatalf("LoadConfig without a file: %+v, %v", cfg, err)
+	}
+}
+
+func TestAPIKeyIsSentButNotShown(t *testing.T) {
+	var mu sync.Mutex
+	var auth []string
+	handler := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	sink := &recordingSink{}
+	cfg := ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, APIKey: "s3cr3t", Recorder: sink}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	mu.Lock()
+	if len(auth) == 0 || auth[len(auth)-1] != "Bearer s3cr3t" {
+		t.Fatalf("Authorization headers %q", auth)
+	}
+	mu.Unlock()
+	for _, e := range sink.entries {
+		if strings.Contains(string(e.Message), "s3cr3t") {
+			t.Fatalf("recorded the api key: %s", e.Message)
+		}
+	}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s"} {
+		if out := fmt.Sprintf(verb, cfg); strings.Contains(out, "s3cr3t") {
+			t.Fatalf("%s shows the api key: %s", verb, out)
+		}
+	}
+	if err := (ClientConfig{APIKey: "a\r\nX-Injected: 1"}).Validate(); err == nil {
+		t.Fatal("an api key with a line break validated")
+	}
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error classes shared by every transport. Test for them with errors.Is; the
+// more specific errors (ErrReadTimeout, ErrClientCertRejected, an *APIError,
+// ...) match the class they belong to.
+var (
+	// ErrTimeout matches ErrDialTimeout, ErrReadTimeout, ErrWriteTimeout, the
+	// ws handshake timeout, and HTTP 408 and 504 responses.
+	ErrTimeout = errors.New("timeout")
+	// ErrUnauthorized matches HTTP 401 and 403 responses, CodeUnauthorized,
+	// ErrClientCertRejected, and ErrAuthRefresh.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrModelNotFound matches CodeModelNotFound.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrPayloadTooLarge matches HTTP 413 responses, CodePayloadTooLarge,
+	// ErrFrameTooLarge, ErrResponseTooLarge, and ErrInputTooLong.
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrProtocol reports a response that is not a valid answer to the
+	// request, such as undecodable JSON, a mismatched ID, or
+	// ErrSignatureMismatch.
+	ErrProtocol = errors.New("protocol violation")
+)
+
+// JSON-RPC error codes the server uses for the error classes above, from
+// the implementation-defined range.
+const (
+	CodeUnauthorized    = -32001
+	CodeModelNotFound   = -32002
+	CodePayloadTooLarge = -32003
+	CodeTimeout         = -32004
+)
+
+// classError is a specific error that also matches the broader class it
+// unwraps to.
+type classError struct {
+	msg   string
+	class error
+}
+
+func (e *classError) Error() string { return e.msg }
+func (e *classError) Unwrap() error { return e.class }
+
+// APIError is a failure reported by the server, either as a JSON-RPC error
+// response or, over http and tls, as a non-2xx status.
+type APIError struct {
+	// Code is the JSON-RPC error code, or 0 for an HTTP status failure
+	// but for one whose body holds a JSON-RPC error, and those of an
+	// OpenAICompat server, whose error type and code map to the code of
+	// their class.
+	Code int
+	// Status is the HTTP status code, or 0 for a JSON-RPC error.
+	Status  int
+	Message string
+	// Retryable reports whether repeating the request may succeed: the
+	// server said so in the error data, or the status is 429 or 5xx.
+	Retryable bool
+	// RequestID is the client's ID for the failed request; see
+	// WithRequestID. The error returned by the call names it.
+	RequestID string
+	// ServerRequestID is the server's own ID for it, from the error data's
+	// request_id or the X-Request-Id header.
+	ServerRequestID string
+	// RetryAfter is the wait the server asked for in a Retry-After header,
+	// or 0.
+	RetryAfter time.Duration
+	// ErrorType and ErrorCode are the error's type and code in the error
+	// body of an OpenAICompat server, such as "invalid_request_error" and
+	// "model_not_found".
+	ErrorType, ErrorCode string
+
+	rpc *RPCError
+}
+
+func (e *APIError) Error() string {
+	var msg string
+	if e.Status != 0 {
+		msg = fmt.Sprintf("unexpected status %d %s", e.Status, http.StatusText(e.Status))
+		if e.Message != "" {
+			msg += ": " + e.Message
+		}
+	} else {
+		msg = fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+	}
+	if e.ServerRequestID != "" {
+		msg += " (server request " + e.ServerRequestID + ")"
+	}
+	return msg
+}
+
+// Unwrap exposes the underlying *RPCError, if any.
+func (e *APIError) Unwrap() error {
+	if e.rpc == nil {
+		return nil
+	}
+	return e.rpc
+}
+
+// Is matches the error classes implied by the code or status.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrTimeout:
+		return e.Code == CodeTimeout || e.Status == http.StatusRequestTimeout || e.Status == http.StatusGatewayTimeout
+	case ErrUnauthorized:
+		return e.Code == CodeUnauthorized || e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden
+	case ErrModelNotFound:
+		return e.Code == CodeModelNotFound
+	case ErrPayloadTooLarge:
+		return e.Code == CodePayloadTooLarge || e.Status == http.StatusRequestEntityTooLarge
+	case ErrMethodNotFound:
+		return e.Code == CodeMethodNotFound
+	case ErrInvalidParams:
+		return e.Code == CodeInvalidParams
+	case ErrInvalidRequest:
+		return e.Code == CodeInvalidRequest || e.Code == CodeParseError
+	}
+	return false
+}
+
+// rpcAPIError converts a JSON-RPC error response. The optional error data
+// object may carry "retryable" and "request_id".
+func rpcAPIError(rpc *RPCError) *APIError {
+	e := &APIError{Code: rpc.Code, Message: rpc.Message, rpc: rpc}
+	var data struct {
+		Retryable bool   `json:"retryable"`
+		RequestID string `json:"request_id"`
+	}
+	if len(rpc.Data) > 0 && json.Unmarshal(rpc.Data, &data) == nil {
+		e.Retryable, e.ServerRequestID = data.Retryable, data.RequestID
+	}
+	return e
+}
+
+// statusAPIError converts a non-2xx HTTP response; body is the start of
+// the response body. A body holding a JSON-RPC error response, as a server
+// answers a request it failed, lends the error its code, message, and data.
+func statusAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		Status:          resp.StatusCode,
+		Message:         strings.TrimSpace(string(body)),
+		Retryable:       resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		ServerRequestID: resp.Header.Get(RequestIDHeader),
+		RetryAfter:      parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	var envelope struct {
+		Error *RPCError `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil && envelope.Error.Code != 0 {
+		rpc := rpcAPIError(envelope.Error)
+		e.Code, e.Message, e.rpc = rpc.Code, rpc.Message, rpc.rpc
+		e.Retryable = e.Retryable || rpc.Retryable
+		if rpc.ServerRequestID != "" {
+			e.ServerRequestID = rpc.ServerRequestID
+		}
+	}
+	return e
+}
+
+// partialRead is a failure that came after n bytes of the answer had been
+// read, which FailureEntry records as Failure.BytesRead.
+type partialRead struct {
+	n   int64
+	err error
+}
+
+func (e *partialRead) Error() string { return e.err.Error() }
+func (e *partialRead) Unwrap() error { return e.err }
+
+// readFailure marks err as coming after n bytes of the answer were read.
+func readFailure(err error, n int64) error {
+	if err == nil || n <= 0 {
+		return err
+	}
+	return &partialRead{n: n, err: err}
+}
+
+// BytesRead reports how many bytes of the answer to a request had been read
+// when it failed with err: 0 when none had, or when the transport does not
+// count them.
+func BytesRead(err error) int64 {
+	var p *partialRead
+	if errors.As(err, &p) {
+		return p.n
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func statusServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-42")
+		http.Error(w, "nope", status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func rpcErrorHandler(code int, data string) Handler {
+	return func(Request) (Response, error) {
+		return Response{}, &RPCError{Code: code, Message: "refused", Data: json.RawMessage(data)}
+	}
+}
+
+func TestErrorClassesAcrossTransports(t *testing.T) {
+	cases := map[string]struct {
+		cfg   ClientConfig
+		class error
+	}{
+		"http 401":         {ClientConfig{Transport: TransportHTTP, Endpoint: statusServer(t, 401).URL}, ErrUnauthorized},
+		"http 413":         {ClientConfig{Transport: TransportHTTP, Endpoint: statusServer(t, 413).URL}, ErrPayloadTooLarge},
+		"http 504":         {ClientConfig{Transport: TransportHTTP, Endpoint: statusServer(t, 504).URL}, ErrTimeout},
+		"rpc unauthorized": {ClientConfig{Transport: TransportInProc, Handler: rpcErrorHandler(CodeUnauthorized, "")}, ErrUnauthorized},
+		"rpc model":        {ClientConfig{Transport: TransportInProc, Handler: rpcErrorHandler(CodeModelNotFound, "")}, ErrModelNotFound},
+		"rpc too large":    {ClientConfig{Transport: TransportInProc, Handler: rpcErrorHandler(CodePayloadTooLarge, "")}, ErrPayloadTooLarge},
+		"stdio timeout":    {ClientConfig{Command: helperCommandMode(t, helperSilent), ReadTimeout: 50 * time.Millisecond}, ErrTimeout},
+		"frame too large":  {ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), MaxFrameSize: 16}, ErrPayloadTooLarge},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(tc.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			err = c.Call(context.Background(), MethodPing, nil, nil)
+			// Two more layers on top of the client's own wrapping.
+			err = fmt.Errorf("outer: %w", fmt.Errorf("middle: %w", err))
+			if !errors.Is(err, tc.class) {
+				t.Fatalf("expected %v, got %v", tc.class, err)
+			}
+		})
+	}
+}
+
+func TestAPIErrorDetails(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: statusServer(t, 503).URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	err = c.Call(context.Background(), MethodPing, nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != 503 || !apiErr.Retryable || apiErr.ServerRequestID != "req-42" || apiErr.Message != "nope" {
+		t.Fatalf("unexpected API error %#v from %v", apiErr, err)
+	}
+
+	c, err = New(ClientConfig{Transport: TransportInProc, Handler: rpcErrorHandler(-32050, `{"retryable":true,"request_id":"abc"}`)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	err = c.Call(context.Background(), MethodPing, nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &apiErr) || apiErr.Code != -32050 || !apiErr.Retryable || apiErr.ServerRequestID != "abc" || !errors.As(err, &rpcErr) {
+		t.Fatalf("unexpected API error %#v from %v", apiErr, err)
+	}
+	for _, class := range []error{ErrTimeout, ErrUnauthorized, ErrModelNotFound, ErrPayloadTooLarge} {
+		if errors.Is(err, class) {
+			t.Fatalf("unclassified code matched %v", class)
+		}
+	}
+}
+
+func TestStatusErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-42")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32050,"message":"upstream failed","data":{"request_id":"abc"}}}`)
+	}))
+	defer srv.Close()
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	err = c.Call(context.Background(), MethodPing, nil, nil)
+	var apiErr *APIError
+	var rpcErr *RPCError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway || apiErr.Code != -32050 || apiErr.Message != "upstream failed" ||
+		!apiErr.Retryable || apiErr.ServerRequestID != "abc" || !errors.As(err, &rpcErr) {
+		t.Fatalf("unexpected API error %#v from %v", apiErr, err)
+	}
+}
+
+func TestProtocolViolation(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		return Response{ID: req.ID + 1}, nil
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("expected ErrProtocol, got %v", err)
+	}
+}
+
+func TestTimeoutClassesMatchErrTimeout(t *testing.T) {
+	for _, err := range []error{ErrDialTimeout, ErrReadTimeout, ErrWriteTimeout} {
+		if !errors.Is(err, ErrTimeout) {
+			t.Fatalf("%v does not match ErrTimeout", err)
+		}
+	}
+	if errors.Is(ErrReadTimeout, ErrDialTimeout) {
+		t.Fatal("timeout classes must stay distinct")
+	}
+}
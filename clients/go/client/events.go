@@ -0,0 +1,250 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEventListenerTimeout is how long an EventListener method may run
+// before the listener is dropped, when ClientConfig.EventListenerTimeout is
+// unset.
+const DefaultEventListenerTimeout = 100 * time.Millisecond
+
+// EventListener learns about a client's connections and the failures it
+// works around, to feed metrics of its own. Every transport reports its
+// connections, the inproc one included, so a listener can be tested
+// without a server.
+//
+// The methods are called synchronously, on the goroutine doing the work
+// and while the client holds locks, so they must not block or call back
+// into the Client. A method that runs longer than
+// ClientConfig.EventListenerTimeout gets the listener dropped: it receives
+// no further events and a warning is logged. EventHooks implements the
+// interface from a set of funcs.
+type EventListener interface {
+	// OnConnect reports a connection established or, for the pooled http,
+	// tls, and http3 transports, reused by a request.
+	OnConnect(ConnectEvent)
+	// OnDisconnect reports a connection closed or lost.
+	OnDisconnect(DisconnectEvent)
+	// OnFailover reports calls moving between the endpoints of
+	// WithEndpoints.
+	OnFailover(FailoverEvent)
+	// OnRetry reports a request about to be retried under
+	// ClientConfig.Retry, as RetryPolicy.OnRetry does.
+	OnRetry(attempt int, err error)
+	// OnCircuitStateChange reports a transition of
+	// ClientConfig.CircuitBreaker.
+	OnCircuitStateChange(CircuitEvent)
+	// OnPriorityWait reports a high-priority call that waited longer than
+	// ClientConfig.Scheduling allows for an in-flight slot.
+	OnPriorityWait(PriorityWaitEvent)
+	// OnAddressChange reports the addresses of an endpoint's host name
+	// changing under ClientConfig.DNS.
+	OnAddressChange(AddressChangeEvent)
+}
+
+// ConnectEvent describes a connection a transport opened or reused.
+type ConnectEvent struct {
+	Transport string
+	// Endpoint is the endpoint label, as in FailoverEvent.
+	Endpoint string
+	// TLS is the state of a TLS connection, else nil.
+	TLS *tls.ConnectionState
+	// Reused reports a request sent over a pooled connection already open.
+	Reused bool
+}
+
+// DisconnectEvent describes a connection that ended.
+type DisconnectEvent struct {
+	Transport, Endpoint string
+	// Reason is why the connection ended, such as io.EOF when the server
+	// closed it, or nil when the client closed it: on Close, or an idle
+	// pooled connection.
+	Reason error
+}
+
+// EventHooks is an EventListener calling whichever of its funcs are set.
+type EventHooks struct {
+	Connect            func(ConnectEvent)
+	Disconnect         func(DisconnectEvent)
+	Failover           func(FailoverEvent)
+	Retry              func(attempt int, err error)
+	CircuitStateChange func(CircuitEvent)
+	PriorityWait       func(PriorityWaitEvent)
+	AddressChange      func(AddressChangeEvent)
+}
+
+func (h EventHooks) OnConnect(ev ConnectEvent) {
+	if h.Connect != nil {
+		h.Connect(ev)
+	}
+}
+
+func (h EventHooks) OnDisconnect(ev DisconnectEvent) {
+	if h.Disconnect != nil {
+		h.Disconnect(ev)
+	}
+}
+
+func (h EventHooks) OnFailover(ev FailoverEvent) {
+	if h.Failover != nil {
+		h.Failover(ev)
+	}
+}
+
+func (h EventHooks) OnRetry(attempt int, err error) {
+	if h.Retry != nil {
+		h.Retry(attempt, err)
+	}
+}
+
+func (h EventHooks) OnCircuitStateChange(ev CircuitEvent) {
+	if h.CircuitStateChange != nil {
+		h.CircuitStateChange(ev)
+	}
+}
+
+func (h EventHooks) OnPriorityWait(ev PriorityWaitEvent) {
+	if h.PriorityWait != nil {
+		h.PriorityWait(ev)
+	}
+}
+
+func (h EventHooks) OnAddressChange(ev AddressChangeEvent) {
+	if h.AddressChange != nil {
+		h.AddressChange(ev)
+	}
+}
+
+// WithEventListener sets ClientConfig.EventListener.
+func WithEventListener(l EventListener) Option {
+	return func(o *clientOptions) error {
+		if l == nil {
+			return errors.New("WithEventListener: listener must not be nil")
+		}
+		o.eventListener = l
+		return nil
+	}
+}
+
+// transportEvents is how a transport reports its connections, and the
+// failover transport its moves, to the client observing it.
+type transportEvents struct {
+	connect    func(ConnectEvent)
+	disconnect func(DisconnectEvent)
+	failover   func(FailoverEvent)
+	// addressChange reports the changes of ClientConfig.DNS.
+	addressChange func(AddressChangeEvent)
+	// notification, when set, takes the notifications the server pushes.
+	notification func(Notification)
+}
+
+// observedTransport is implemented by the transports that report to
+// transportEvents.
+type observedTransport interface {
+	observe(*transportEvents)
+}
+
+// clientEvents delivers a client's events to its Stats and its
+// EventListener.
+type clientEvents struct {
+	stats    *runtimeStats
+	listener EventListener
+	timeout  time.Duration
+	log      *slog.Logger
+	dropped  atomic.Bool
+}
+
+func newClientEvents(cfg ClientConfig, stats *runtimeStats, log *slog.Logger) *clientEvents {
+	timeout := cfg.EventListenerTimeout
+	if timeout == 0 {
+		timeout = DefaultEventListenerTimeout
+	}
+	return &clientEvents{stats: stats, listener: cfg.EventListener, timeout: timeout, log: log}
+}
+
+// deliver runs fn on the listener unless it has been dropped, dropping it
+// when fn overruns the timeout.
+func (e *clientEvents) deliver(event string, fn func(EventListener)) {
+	if e.listener == nil || e.dropped.Load() {
+		return
+	}
+	start := time.Now()
+	fn(e.listener)
+	if elapsed := time.Since(start); elapsed > e.timeout && !e.dropped.Swap(true) {
+		e.log.Warn("event listener dropped", "event", event, "elapsed", elapsed, "timeout", e.timeout)
+	}
+}
+
+func (e *clientEvents) transportEvents() *transportEvents {
+	return &transportEvents{connect: e.connect, disconnect: e.disconnect, failover: e.failover, addressChange: e.addressChange}
+}
+
+func (e *clientEvents) connect(ev ConnectEvent) {
+	e.stats.connection(ev.Reused)
+	e.deliver("connect", func(l EventListener) { l.OnConnect(ev) })
+}
+
+func (e *clientEvents) disconnect(ev DisconnectEvent) {
+	e.deliver("disconnect", func(l EventListener) { l.OnDisconnect(ev) })
+}
+
+func (e *clientEvents) failover(ev FailoverEvent) {
+	e.deliver("failover", func(l EventListener) { l.OnFailover(ev) })
+}
+
+func (e *clientEvents) addressChange(ev AddressChangeEvent) {
+	e.deliver("address change", func(l EventListener) { l.OnAddressChange(ev) })
+}
+
+func (e *clientEvents) retry(attempt int, err error) {
+	e.deliver("retry", func(l EventListener) { l.OnRetry(attempt, err) })
+}
+
+func (e *clientEvents) circuit(ev CircuitEvent) {
+	e.deliver("circuit state change", func(l EventListener) { l.OnCircuitStateChange(ev) })
+}
+
+func (e *clientEvents) priorityWait(ev PriorityWaitEvent) {
+	e.deliver("priority wait", func(l EventListener) { l.OnPriorityWait(ev) })
+}
+
+// watchedConn reports the end of a pooled connection: nil when the client
+// closes it, else the read error that ended it.
+type watchedConn struct {
+	net.Conn
+	once   sync.Once
+	report func(reason error)
+	// readErr is the first error a read returned.
+	readErr atomic.Pointer[error]
+}
+
+func (c *watchedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		c.readErr.CompareAndSwap(nil, &err)
+	}
+	return n, err
+}
+
+func (c *watchedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		var reason error
+		if p := c.readErr.Load(); p != nil {
+			reason = *p
+			if errors.Is(reason, io.ErrUnexpectedEOF) {
+				reason = io.EOF
+			}
+		}
+		c.report(reason)
+	})
+	return err
+}
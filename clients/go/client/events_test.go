@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// eventLog is an EventListener recording the events it receives.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *eventLog) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+func (l *eventLog) OnConnect(ev ConnectEvent) {
+	l.add("connect %s %s reused=%t tls=%t", ev.Transport, ev.Endpoint, ev.Reused, ev.TLS != nil)
+}
+func (l *eventLog) OnDisconnect(ev DisconnectEvent) {
+	l.add("disconnect %s %s %v", ev.Transport, ev.Endpoint, ev.Reason)
+}
+func (l *eventLog) OnFailover(ev FailoverEvent)          { l.add("failover %s %s", ev.From, ev.To) }
+func (l *eventLog) OnRetry(attempt int, err error)       { l.add("retry %d", attempt) }
+func (l *eventLog) OnCircuitStateChange(ev CircuitEvent) { l.add("circuit %s %s", ev.From, ev.To) }
+func (l *eventLog) OnPriorityWait(ev PriorityWaitEvent) {
+	l.add("priority wait %s %s %s", ev.Method, ev.Priority, ev.Wait)
+}
+func (l *eventLog) OnAddressChange(ev AddressChangeEvent) {
+	l.add("address change %s %v %v", ev.Host, ev.Added, ev.Removed)
+}
+
+func checkEvents(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("events\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestEventsInProc(t *testing.T) {
+	l := &eventLog{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), EventListener: l})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	c.Close(context.Background())
+	checkEvents(t, l.list(), "connect inproc inproc://session reused=false tls=false", "disconnect inproc inproc://session <nil>")
+	if s := c.Stats(); s.NewConnections != 1 {
+		t.Fatalf("stats count %d new connections", s.NewConnections)
+	}
+}
+
+func TestEventsHTTP(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	l := &eventLog{}
+	c, err := NewClient(srv.URL, WithEventListener(l))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	c.Close(context.Background())
+	checkEvents(t, l.list(),
+		"connect http "+srv.URL+" reused=false tls=false",
+		"connect http "+srv.URL+" reused=true tls=false",
+		"disconnect http "+srv.URL+" <nil>")
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	srv := httptest.NewServer(wsHandler(defaultHandler))
+	defer srv.Close()
+	l := &eventLog{}
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv), EventListener: l})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	c.Close(context.Background())
+	checkEvents(t, l.list(), "connect ws "+wsURL(srv)+" reused=false tls=false", "disconnect ws "+wsURL(srv)+" <nil>")
+}
+
+func TestEventsFailoverCircuitRetry(t *testing.T) {
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	primary, secondary := failingStub("unix", refused), okStub("tls")
+	var failovers []FailoverEvent
+	l := &eventLog{}
+	c := NewWithTransport(ClientConfig{
+		EventListener:  l,
+		Retry:          RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		CircuitBreaker: CircuitBreaker{Threshold: 1, Cooldown: time.Hour},
+	}, newStubFailover(time.Hour, &failovers, primary, secondary))
+	defer c.Close(context.Background())
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	secondary.fn = failingStub("tls", refused).fn
+	_ = c.Call(context.Background(), MethodPing, nil, nil)
+	// The retry of the second call meets the open circuit.
+	checkEvents(t, l.list(), "failover unix://stub tls://stub", "circuit closed open", "retry 1")
+	if len(failovers) != 1 {
+		t.Fatalf("WithOnFailover saw %v", failovers)
+	}
+}
+
+func TestEventListenerDropped(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	slow := EventHooks{Connect: func(ConnectEvent) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}}
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, EventListener: slow, EventListenerTimeout: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 3; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("a listener overrunning its timeout was called %d times", calls)
+	}
+	if s := c.Stats(); s.NewConnections+s.ReusedConnections != 3 {
+		t.Fatalf("dropping the listener stopped the stats: %+v", s)
+	}
+}
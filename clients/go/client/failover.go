@@ -0,0 +1,332 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os/exec"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultFailoverCooldown is how long a failed endpoint is skipped before the
+// failover transport tries it again.
+const DefaultFailoverCooldown = 30 * time.Second
+
+// FailoverEvent reports that calls moved to a different endpoint.
+type FailoverEvent struct {
+	// From and To are the endpoint labels of the previous and new active
+	// endpoint.
+	From, To string
+	// Cause is the connection failure that moved calls off From. It is nil
+	// when calls return to a preferred endpoint after its cool-down.
+	Cause error
+}
+
+// failoverMember is one endpoint of a failoverTransport.
+type failoverMember struct {
+	label     string
+	transport Transport
+	// downAt is when the member last failed; zero while healthy.
+	downAt time.Time
+	cause  error
+	health endpointHealth
+}
+
+// failoverTransport sends each call to the most preferred healthy endpoint,
+// moving down the list when an endpoint fails with a connection-class error.
+// Failed endpoints are skipped until cooldown has passed. With a balancer,
+// each call goes where the balancer picks instead, among the endpoints
+// outlier detection has not ejected.
+type failoverTransport struct {
+	cooldown   time.Duration
+	onFailover func(FailoverEvent)
+	now        func() time.Time
+	balancer   Balancer
+	outliers   OutlierPolicy
+
+	mu      sync.Mutex
+	members []*failoverMember
+	active  int
+	events  *transportEvents
+}
+
+func newFailoverTransport(members []*failoverMember, cooldown time.Duration, onFailover func(FailoverEvent)) *failoverTransport {
+	if cooldown <= 0 {
+		cooldown = DefaultFailoverCooldown
+	}
+	for _, m := range members {
+		m.health = newEndpointHealth()
+	}
+	return &failoverTransport{members: members, cooldown: cooldown, onFailover: onFailover, now: time.Now}
+}
+
+// balance has t spread calls as b picks, ejecting outliers by p.
+func (t *failoverTransport) balance(b Balancer, p OutlierPolicy) {
+	t.balancer, t.outliers = b, p.withDefaults(t.cooldown)
+}
+
+// Kind reports the kind of the active endpoint.
+func (t *failoverTransport) Kind() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.members[t.active].transport.Kind()
+}
+
+// observe has every member report its connections to ev, and reports the
+// moves between them.
+func (t *failoverTransport) observe(ev *transportEvents) {
+	t.mu.Lock()
+	t.events = ev
+	t.mu.Unlock()
+	for _, m := range t.members {
+		if ot, ok := m.transport.(observedTransport); ok {
+			ot.observe(ev)
+		}
+	}
+}
+
+// addresses merges the addresses ClientConfig.DNS resolved the members'
+// names to.
+func (t *failoverTransport) addresses() map[string][]string {
+	var all map[string][]string
+	for _, m := range t.members {
+		if at, ok := m.transport.(interface{ addresses() map[string][]string }); ok {
+			for host, addrs := range at.addresses() {
+				if all == nil {
+					all = make(map[string][]string)
+				}
+				all[host] = addrs
+			}
+		}
+	}
+	return all
+}
+
+// endpointLabel reports the active endpoint for the handshake.
+func (t *failoverTransport) endpointLabel() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.members[t.active].label
+}
+
+// RoundTrip sends req to the first candidate, or a hedge to the second,
+// which then does not become the active endpoint by answering.
+func (t *failoverTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	var errs []error
+	order, probe := t.candidates(), -1
+	if t.balancer != nil {
+		order, probe = t.balanced()
+		defer t.endProbe(probe)
+	}
+	hedge := isHedge(ctx) && len(order) > 1
+	if hedge {
+		order = append(order[1:], order[0])
+	}
+	for _, i := range order {
+		m := t.members[i]
+		start := t.now()
+		resp, err := m.transport.RoundTrip(ctx, req)
+		if ctx.Err() == nil {
+			t.record(i, t.now().Sub(start), err)
+		}
+		if err == nil {
+			t.succeeded(i, !hedge)
+			return resp, nil
+		}
+		if ctx.Err() != nil || !isConnectionError(err) {
+			return nil, err
+		}
+		t.failed(i, err)
+		errs = append(errs, fmt.Errorf("%s: %w", m.label, err))
+		// A request that reached a server before the connection dropped is
+		// only resent elsewhere when doing so is harmless.
+		if errors.Is(err, ErrConnectionLost) && !replayableMethods[req.Method] {
+			break
+		}
+	}
+	return nil, fmt.Errorf("all endpoints failed: %w", errors.Join(errs...))
+}
+
+// candidates lists member indexes in preference order, leaving out members
+// still cooling down unless every member is.
+func (t *failoverTransport) candidates() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var ready, cooling []int
+	for i, m := range t.members {
+		if m.downAt.IsZero() || now.Sub(m.downAt) >= t.cooldown {
+			ready = append(ready, i)
+		} else {
+			cooling = append(cooling, i)
+		}
+	}
+	if len(ready) == 0 {
+		return cooling
+	}
+	return ready
+}
+
+// balanced lists the member indexes the balancer picks among those not
+// ejected, after the ejected member due a probe, if any, which it
+// returns as well. When every member is ejected, all are listed.
+func (t *failoverTransport) balanced() ([]int, int) {
+	t.mu.Lock()
+	now := t.now()
+	var admitted []EndpointScore
+	probe := -1
+	for i, m := range t.members {
+		h := &m.health
+		switch {
+		case h.ejectedUntil.IsZero():
+			admitted = append(admitted, h.score(m.label, i))
+		case now.Before(h.ejectedUntil) || h.probing:
+		case probe < 0:
+			h.probing, probe = true, i
+		}
+	}
+	t.mu.Unlock()
+	var order []int
+	if probe >= 0 {
+		order = append(order, probe)
+	}
+	seen := make(map[int]bool)
+	for _, i := range t.balancer.Pick(admitted) {
+		// Only the members offered may be picked, each once.
+		if i >= 0 && i < len(t.members) && !seen[i] && slices.ContainsFunc(admitted, func(e EndpointScore) bool { return e.Index == i }) {
+			seen[i] = true
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		for i := range t.members {
+			order = append(order, i)
+		}
+	}
+	return order, probe
+}
+
+// record counts a request member i answered or failed with err after d
+// towards its health, and with a balancer ejects or readmits it.
+func (t *failoverTransport) record(i int, d time.Duration, err error) {
+	failed := endpointFailure(err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := &t.members[i].health
+	h.observe(d, failed)
+	if t.balancer == nil {
+		return
+	}
+	probing := h.probing
+	h.probing = false
+	switch {
+	case probing && failed:
+		h.ejectedUntil = t.now().Add(t.outliers.Cooldown)
+	case probing:
+		h.ejectedUntil, h.success, h.admitted = time.Time{}, 1, 0
+	case failed && h.ejectedUntil.IsZero() && h.admitted >= t.outliers.MinRequests && 1-h.success > t.outliers.MaxErrorRate:
+		h.ejectedUntil = t.now().Add(t.outliers.Cooldown)
+	}
+}
+
+// endProbe releases the probe of member i, if the call did not settle it,
+// so a later call probes the member instead.
+func (t *failoverTransport) endProbe(i int) {
+	if i < 0 {
+		return
+	}
+	t.mu.Lock()
+	t.members[i].health.probing = false
+	t.mu.Unlock()
+}
+
+// scores reports the health of every member.
+func (t *failoverTransport) scores() []EndpointScore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	scores := make([]EndpointScore, len(t.members))
+	for i, m := range t.members {
+		scores[i] = m.health.score(m.label, i)
+		if t.balancer == nil && !m.downAt.IsZero() && now.Sub(m.downAt) < t.cooldown {
+			scores[i].Ejected, scores[i].EjectedUntil = true, m.downAt.Add(t.cooldown)
+		}
+	}
+	return scores
+}
+
+func (t *failoverTransport) failed(i int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.members[i].downAt = t.now()
+	t.members[i].cause = err
+}
+
+// succeeded marks member i healthy and, if promote is set, the active
+// endpoint. With a balancer, the active endpoint only names the last to
+// answer, and changing it is no failover.
+func (t *failoverTransport) succeeded(i int, promote bool) {
+	t.mu.Lock()
+	m := t.members[i]
+	m.downAt, m.cause = time.Time{}, nil
+	if i == t.active || !promote || t.balancer != nil {
+		if promote {
+			t.active = i
+		}
+		t.mu.Unlock()
+		return
+	}
+	prev := t.members[t.active]
+	ev := FailoverEvent{From: prev.label, To: m.label, Cause: prev.cause}
+	t.active = i
+	events := t.events
+	t.mu.Unlock()
+	if events != nil {
+		events.failover(ev)
+	}
+	if t.onFailover != nil {
+		t.onFailover(ev)
+	}
+}
+
+func (t *failoverTransport) Close() error {
+	var errs []error
+	for _, m := range t.members {
+		if err := m.transport.Close(); err != nil && !errors.Is(err, errTransportClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isConnectionError reports whether err means the endpoint could not be
+// reached or dropped the connection, as opposed to an application error or a
+// live but slow server.
+func isConnectionError(err error) bool {
+	if errors.Is(err, ErrReadTimeout) || errors.Is(err, ErrWriteTimeout) || errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	for _, target := range []error{
+		ErrConnectionLost, ErrDialTimeout, ErrUnixUnsupported,
+		ErrTLSHandshake, ErrClientCertRejected, ErrCertPinMismatch,
+		io.ErrUnexpectedEOF, syscall.ECONNREFUSED, syscall.ECONNRESET,
+		// Handshake deadlines surface as DeadlineExceeded even though the
+		// caller's context is still live.
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var execErr *exec.Error
+	var pathErr *fs.PathError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.As(err, &execErr) || errors.As(err, &pathErr)
+}
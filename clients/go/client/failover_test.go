@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubTransport answers RoundTrip with fn and counts calls.
+type stubTransport struct {
+	kind  string
+	calls atomic.Int64
+	fn    func(req *Request) (*Response, error)
+}
+
+func (s *stubTransport) Kind() string { return s.kind }
+func (s *stubTransport) Close() error { return nil }
+func (s *stubTransport) RoundTrip(_ context.Context, req *Request) (*Response, error) {
+	s.calls.Add(1)
+	return s.fn(req)
+}
+
+func okStub(kind string) *stubTransport {
+	return &stubTransport{kind: kind, fn: func(req *Request) (*Response, error) { return defaultHandler(req), nil }}
+}
+
+func failingStub(kind string, err error) *stubTransport {
+	return &stubTransport{kind: kind, fn: func(*Request) (*Response, error) { return nil, err }}
+}
+
+func newStubFailover(cooldown time.Duration, events *[]FailoverEvent, stubs ...*stubTransport) *failoverTransport {
+	members := make([]*failoverMember, len(stubs))
+	for i, s := range stubs {
+		members[i] = &failoverMember{label: s.kind + "://stub", transport: s}
+	}
+	return newFailoverTransport(members, cooldown, func(ev FailoverEvent) { *events = append(*events, ev) })
+}
+
+func TestFailoverOnConnectionError(t *testing.T) {
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	primary, secondary := failingStub("unix", refused), okStub("tls")
+	var events []FailoverEvent
+	tr := newStubFailover(time.Hour, &events, primary, secondary)
+	c := NewWithTransport(ClientConfig{}, tr)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if len(events) != 1 || events[0].From != "unix://stub" || events[0].To != "tls://stub" || !errors.Is(events[0].Cause, syscall.ECONNREFUSED) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	// The failed endpoint is skipped while it cools down.
+	if got := primary.calls.Load(); got != 1 {
+		t.Fatalf("primary tried %d times during cool-down", got)
+	}
+	if tr.Kind() != "tls" {
+		t.Fatalf("expected active kind tls, got %q", tr.Kind())
+	}
+}
+
+func TestFailoverReturnsToPreferredAfterCooldown(t *testing.T) {
+	var primaryDown atomic.Bool
+	primaryDown.Store(true)
+	primary := &stubTransport{kind: "stdio", fn: func(req *Request) (*Response, error) {
+		if primaryDown.Load() {
+			return nil, fmt.Errorf("stdio stream: %w: broken pipe", ErrConnectionLost)
+		}
+		return defaultHandler(req), nil
+	}}
+	secondary := okStub("http")
+	var events []FailoverEvent
+	tr := newStubFailover(time.Minute, &events, primary, secondary)
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+	c := NewWithTransport(ClientConfig{}, tr)
+
+	ctx := context.Background()
+	if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	primaryDown.Store(false)
+	if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+		t.Fatalf("call during cool-down: %v", err)
+	}
+	if primary.calls.Load() != 1 {
+		t.Fatal("primary retried before its cool-down elapsed")
+	}
+	now = now.Add(time.Minute)
+	if err := c.Call(ctx, MethodPing, nil, nil); err != nil {
+		t.Fatalf("call after cool-down: %v", err)
+	}
+	if len(events) != 2 || events[1].To != "stdio://stub" || events[1].Cause != nil {
+		t.Fatalf("expected a failback event, got %+v", events)
+	}
+}
+
+func TestFailoverIgnoresApplicationErrors(t *testing.T) {
+	cases := map[string]error{
+		"http status":  errors.New("http request: unexpected status 500 Internal Server Error: boom"),
+		"read timeout": fmt.Errorf("http request: %w after 1s", ErrReadTimeout),
+	}
+	for name, cause := range cases {
+		t.Run(name, func(t *testing.T) {
+			primary, secondary := failingStub("http", cause), okStub("tls")
+			var events []FailoverEvent
+			c := NewWithTransport(ClientConfig{}, newStubFailover(time.Hour, &events, primary, secondary))
+			if err := c.Call(context.Background(), MethodPing, nil, nil); err == nil {
+				t.Fatal("expected the primary's error")
+			}
+			if secondary.calls.Load() != 0 || len(events) != 0 {
+				t.Fatalf("failed over on %s", name)
+			}
+		})
+	}
+}
+
+func TestFailoverDoesNotReplayUnsafeRequest(t *testing.T) {
+	primary := failingStub("stdio", fmt.Errorf("stdio stream: %w: unexpected EOF", ErrConnectionLost))
+	secondary := okStub("http")
+	var events []FailoverEvent
+	c := NewWithTransport(ClientConfig{}, newStubFailover(time.Hour, &events, primary, secondary))
+
+	if err := c.Call(context.Background(), "jobs.submit", nil, nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if secondary.calls.Load() != 0 {
+		t.Fatal("non-replayable request was resent to the next endpoint")
+	}
+}
+
+func TestNewClientWithEndpoints(t *testing.T) {
+	var hits atomic.Int64
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		httpHandler(defaultHandler).ServeHTTP(w, r)
+	}))
+	defer backup.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	var events []FailoverEvent
+	c, err := NewClient("",
+		WithEndpoints(
+			ClientConfig{Transport: TransportHTTP, Endpoint: dead.URL},
+			ClientConfig{Transport: TransportHTTP, Endpoint: backup.URL},
+		),
+		WithOnFailover(func(ev FailoverEvent) { events = append(events, ev) }),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if hits.Load() != 1 || len(events) != 1 || events[0].To != backup.URL {
+		t.Fatalf("expected failover to the backup, hits=%d events=%+v", hits.Load(), events)
+	}
+}
+
+func TestNewClientOptionErrors(t *testing.T) {
+	_, err := NewClient("",
+		WithEndpoints(ClientConfig{Transport: TransportTLS, Endpoint: "http://insecure"}),
+		WithFailoverCooldown(-time.Second),
+	)
+	if err == nil {
+		t.Fatal("expected option errors")
+	}
+	for _, want := range []string{"WithEndpoints", "WithFailoverCooldown"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package client
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeHandler answers a single decoded request.
+type fakeHandler func(req *Request) *Response
+
+// fakeSessionID is the session assigned by defaultHandler.
+const fakeSessionID = "go-test-session"
+
+// fakeModels is the model list served by defaultHandler.
+var fakeModels = []ModelInfo{
+	{Name: DefaultModel, Dimension: 3, MaxInputTokens: 8191, Features: ModelFeatures{Normalization: true, Truncation: true, DTypes: []string{"float32", "int8"}}},
+	{Name: "text-embedding-3-small", Dimension: 3, MaxInputTokens: 8191, Features: ModelFeatures{DTypes: []string{"float32"}}},
+}
+
+// firstCommon returns the first of offered that is in supported, or "".
+func firstCommon(offered []string, supported ...string) string {
+	for _, v := range offered {
+		for _, w := range supported {
+			if v == w {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// fakeJobStore holds the jobs submitted to defaultHandler. A job reports
+// running on its first status poll and finishes on the second: it fails when
+// an input contains "fail" and succeeds otherwise.
+type fakeJobStore struct {
+	mu    sync.Mutex
+	next  int
+	jobs  map[JobID][]string
+	polls map[JobID]int
+}
+
+var fakeJobs = &fakeJobStore{jobs: make(map[JobID][]string), polls: make(map[JobID]int)}
+
+// handle answers a request for one of the job methods.
+func (s *fakeJobStore) handle(req *Request) (any, *RPCError) {
+	var params struct {
+		JobSpec
+		ID     JobID  `json:"job_id"`
+		Cursor string `json:"cursor"`
+		Limit  int    `json:"limit"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, &RPCError{Code: -32602, Message: err.Error()}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inputs, known := s.jobs[params.ID]
+	if !known && req.Method != MethodJobSubmit {
+		return nil, &RPCError{Code: -32602, Message: fmt.Sprintf("unknown job %q", params.ID)}
+	}
+	switch req.Method {
+	case MethodJobSubmit:
+		s.next++
+		id := JobID(fmt.Sprintf("job-%d", s.next))
+		s.jobs[id] = params.Inputs
+		return map[string]any{"job_id": id}, nil
+	case MethodJobStatus:
+		s.polls[params.ID]++
+		status := JobStatus{ID: params.ID, State: JobRunning, Completed: len(inputs) / 2, Total: len(inputs)}
+		if s.polls[params.ID] > 1 {
+			status.State, status.Completed = JobSucceeded, len(inputs)
+			for _, input := range inputs {
+				if strings.Contains(input, "fail") {
+					status.State = JobFailed
+					status.Error = &RPCError{Code: -32000, Message: "cannot embed input"}
+				}
+			}
+		}
+		return status, nil
+	case MethodJobResults:
+		start, _ := strconv.Atoi(params.Cursor)
+		end := len(inputs)
+		if params.Limit > 0 && start+params.Limit < end {
+			end = start + params.Limit
+		}
+		var page JobPage
+		for i := start; i < end; i++ {
+			page.Embeddings = append(page.Embeddings, JobEmbedding{Index: i, Vector: []float32{float32(len(inputs[i])), 0.5, -0.5}})
+		}
+		if end < len(inputs) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+		page.Checksum = JobPageChecksum(page.Embeddings)
+		return page, nil
+	}
+	return nil, &RPCError{Code: -32601, Message: fmt.Sprintf("method %q not found", req.Method)}
+}
+
+// defaultHandler implements the handshake, ping, capabilities, embed, model
+// listing, token counting, and job methods with fixed results.
+func defaultHandler(req *Request) *Response {
+	resp := &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Meta: req.Meta}
+	var result any
+	switch req.Method {
+	case MethodInitialize:
+		var params struct {
+			ProtocolVersions []string `json:"protocol_versions"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		result = InitializeResult{
+			Session:             Session{ID: fakeSessionID, Transport: "test", ServerVersion: "0.1.0"},
+			HeartbeatIntervalMS: 5000,
+			// The fake speaks versions 1 and 2 and picks the client's
+			// first choice among them.
+			ProtocolVersion: firstCommon(params.ProtocolVersions, "1", "2"),
+		}
+	case MethodPing:
+		result = map[string]any{"ok": true, "latency_ms": 1}
+	case MethodCapabilities:
+		result = map[string]any{"tools": []string{"search"}}
+	case MethodEmbed:
+		var params embedParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = &RPCError{Code: -32602, Message: err.Error()}
+			return resp
+		}
+		entries := make([]embeddingEntry, len(params.Inputs))
+		for i, input := range params.Inputs {
+			entries[i] = embeddingEntry{Index: i, Vector: []float32{float32(len(input)), 0.5, -0.5}}
+		}
+		result = embedResult{Model: params.Model, Embeddings: entries}
+		if params.EncodingFormat == EncodingBase64 {
+			result = base64EmbedResult(params.Model, entries)
+		}
+	case MethodListModels:
+		result = listModelsResult{Models: fakeModels}
+	case MethodCountTokens:
+		var params struct {
+			Input string `json:"input"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		// One token per word keeps server counts apart from estimates.
+		result = map[string]any{"tokens": len(strings.Fields(params.Input))}
+	case MethodJobSubmit, MethodJobStatus, MethodJobResults:
+		var rpcErr *RPCError
+		if result, rpcErr = fakeJobs.handle(req); rpcErr != nil {
+			resp.Error = rpcErr
+			return resp
+		}
+	default:
+		resp.Error = &RPCError{Code: -32601, Message: fmt.Sprintf("method %q not found", req.Method)}
+		return resp
+	}
+	raw, _ := json.Marshal(result)
+	resp.Result = raw
+	return resp
+}
+
+// base64EmbedResult is the embed result for entries in EncodingBase64.
+func base64EmbedResult(model string, entries []embeddingEntry) any {
+	type entry struct {
+		Index  int    `json:"index"`
+		Vector string `json:"vector"`
+	}
+	encoded := make([]entry, len(entries))
+	for i, e := range entries {
+		encoded[i] = entry{Index: e.Index, Vector: encodeBase64Vector(e.Vector)}
+	}
+	return map[string]any{"model": model, "embeddings": encoded, "encoding_format": EncodingBase64}
+}
+
+// encodeBase64Vector returns v in EncodingBase64.
+func encodeBase64Vector(v []float32) string {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// streamFrames answers mcp.embed.stream with one frame per input, last
+// input first, then the done frame. Inputs containing "bad" get a per-input
+// error. Any other method gets the single response from handle.
+func streamFrames(req *Request, handle fakeHandler) []*Response {
+	if req.Method != MethodEmbedStream {
+		return []*Response{handle(req)}
+	}
+	var params embedParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return []*Response{{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32602, Message: err.Error()}}}
+	}
+	frame := func(f embedFrame) *Response {
+		raw, _ := json.Marshal(f)
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}
+	var frames []*Response
+	for i := len(params.Inputs) - 1; i >= 0; i-- {
+		f := embedFrame{Index: i, Vector: []float32{float32(len(params.Inputs[i])), 0.5, -0.5}}
+		if strings.Contains(params.Inputs[i], "bad") {
+			f = embedFrame{Index: i, Error: &RPCError{Code: -32602, Message: "cannot embed input"}}
+		}
+		frames = append(frames, frame(f))
+	}
+	return append(frames, frame(embedFrame{Done: true}))
+}
+
+// serveStream answers newline-delimited requests read from r until EOF.
+func serveStream(r io.Reader, w io.Writer, handle fakeHandler) error {
+	return serveFramed(r, w, newFraming(FramingNewline, 0), handle)
+}
+
+// serveFramed answers requests framed with f until r reaches EOF.
+func serveFramed(r io.Reader, w io.Writer, f framing, handle fakeHandler) error {
+	reader := bufio.NewReader(r)
+	for {
+		payload, err := f.read(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var req Request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+		for _, resp := range streamFrames(&req, handle) {
+			out, err := json.Marshal(resp)
+			if err != nil {
+				return err
+			}
+			if err := f.write(w, out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// httpHandler adapts a fakeHandler to net/http.
+func httpHandler(handle fakeHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		frames := streamFrames(&req, handle)
+		if len(frames) == 1 || !strings.Contains(r.Header.Get("Accept"), contentTypeNDJSON) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(frames[0])
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		enc := json.NewEncoder(w)
+		for _, resp := range frames {
+			_ = enc.Encode(resp)
+			w.(http.Flusher).Flush()
+		}
+	})
+}
+
+// helperProcessEnv switches the test binary into fake stdio server mode.
+const helperProcessEnv = "EMBEDNEXUS_FAKE_STDIO_SERVER"
+
+// helperFramingEnv selects the fake stdio server's framing; empty means
+// newline framing.
+const helperFramingEnv = "EMBEDNEXUS_FAKE_FRAMING"
+
+// Fake stdio server behaviours selected through helperProcessEnv.
+const (
+	helperServe = "1"
+	// helperSilent reads requests but never answers them.
+	helperSilent = "silent"
+	// helperDeaf never reads stdin, so writes block once the pipe fills.
+	helperDeaf = "deaf"
+	// helperCrashy serves normally but exits without answering crashMethod,
+	// and exits on its first ping when crashMarkerEnv names a missing file.
+	helperCrashy = "crashy"
+	// helperLingering serves normally but keeps running once stdin closes,
+	// until SIGTERM makes it create the crashMarkerEnv file and exit.
+	helperLingering = "lingering"
+	// helperCutShort writes its first frame and half of the second, then
+	// exits.
+	helperCutShort = "cut-short"
+)
+
+// crashMethod makes the crashy helper exit as soon as it is received.
+const crashMethod = "test.crash"
+
+// crashMarkerEnv names the file the crashy helper creates before crashing on
+// a ping, so the respawned server answers it.
+const crashMarkerEnv = "EMBEDNEXUS_FAKE_CRASH_MARKER"
+
+// dyingWriter passes frames frames through, then writes half of the next
+// and exits, as a server killed mid-write leaves its output.
+type dyingWriter struct {
+	w      io.Writer
+	frames int
+}
+
+func (d *dyingWriter) Write(p []byte) (int, error) {
+	if d.frames == 0 {
+		_, _ = d.w.Write(p[:len(p)/2])
+		os.Exit(3)
+	}
+	d.frames--
+	return d.w.Write(p)
+}
+
+// crashyHandler wraps defaultHandler with the helperCrashy exit points.
+func crashyHandler(req *Request) *Response {
+	switch req.Method {
+	case crashMethod:
+		os.Exit(3)
+	case MethodPing:
+		if marker := os.Getenv(crashMarkerEnv); marker != "" {
+			if _, err := os.Stat(marker); errors.Is(err, os.ErrNotExist) {
+				_ = os.WriteFile(marker, nil, 0o600)
+				os.Exit(3)
+			}
+		}
+	}
+	return defaultHandler(req)
+}
+
+func TestMain(m *testing.M) {
+	f := newFraming(os.Getenv(helperFramingEnv), 0)
+	switch os.Getenv(helperProcessEnv) {
+	case helperServe:
+		if err := serveFramed(os.Stdin, os.Stdout, f, defaultHandler); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case helperCrashy:
+		if err := serveFramed(os.Stdin, os.Stdout, f, crashyHandler); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case helperCutShort:
+		_ = serveFramed(os.Stdin, &dyingWriter{w: os.Stdout, frames: 1}, f, defaultHandler)
+		os.Exit(0)
+	case helperSilent:
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		os.Exit(0)
+	case helperDeaf:
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case helperLingering:
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, syscall.SIGTERM)
+		_ = serveFramed(os.Stdin, os.Stdout, f, defaultHandler)
+		select {
+		case <-term:
+			_ = os.WriteFile(os.Getenv(crashMarkerEnv), nil, 0o600)
+		case <-time.After(time.Minute):
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// helperCommand returns a command line that runs the fake stdio server.
+func helperCommand(t *testing.T) []string {
+	t.Helper()
+	return helperCommandMode(t, helperServe)
+}
+
+// helperCommandMode returns a command line that runs the fake stdio server in
+// the given mode.
+func helperCommandMode(t *testing.T, mode string) []string {
+	t.Helper()
+	t.Setenv(helperProcessEnv, mode)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("resolve test executable: %v", err)
+	}
+	return []string{exe}
+}
+
+// recordingSink is an in-memory Recorder.
+type recordingSink struct {
+	entries []Entry
+}
+
+func (r *recordingSink) Record(entry Entry) { r.entries = append(r.entries, entry) }
+
+// wsHandler answers each WebSocket message with handle.
+func wsHandler(handle fakeHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(msg, &req); err != nil {
+				return
+			}
+			for _, resp := range streamFrames(&req, handle) {
+				out, _ := json.Marshal(resp)
+				if err := ws.WriteText(out); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DirectionSkipped marks a tombstone: round trips a RecordFilter left out
+// of the transcript. Its message is a Tombstone.
+const DirectionSkipped = "skipped"
+
+// transportSelector prefixes RecordFilter patterns that select a transport
+// rather than a method, as in "transport=stdio".
+const transportSelector = "transport="
+
+// filterWindow is how many round trips a Filter remembers its verdict on,
+// for the responses that follow a request, such as the frames of a
+// streamed embed.
+const filterWindow = 4096
+
+// RecordFilter selects the round trips a recorder keeps. A request and
+// the responses or failure answering it are kept or left out together.
+type RecordFilter struct {
+	// Only, when set, keeps only the round trips matching one of its
+	// patterns, and Skip leaves out those matching any of its own. A
+	// pattern is a method name, with path.Match wildcards as in "mcp.*", or
+	// "transport=<name>", matching every round trip over that transport.
+	Only []string
+	Skip []string
+	// Match, when set, keeps only the requests it returns true for.
+	Match func(*Request) bool
+	// Sample keeps 1 in every N successful round trips of the methods it
+	// names, starting with the first; failed ones, whether the server
+	// answered with an error or none came, are always kept. Sampled
+	// requests are written once their outcome is known.
+	Sample map[string]int
+	// Tombstones leaves a DirectionSkipped entry in place of each run of
+	// round trips of one method that were left out, counting them, so the
+	// transcript still shows the shape of the session.
+	Tombstones bool
+}
+
+// Tombstone is the message of a DirectionSkipped entry.
+type Tombstone struct {
+	Method string `json:"method"`
+	// Count is how many round trips of Method were left out in a row.
+	Count int `json:"count"`
+}
+
+// IsZero reports whether f keeps every round trip.
+func (f RecordFilter) IsZero() bool {
+	return len(f.Only) == 0 && len(f.Skip) == 0 && f.Match == nil && len(f.Sample) == 0
+}
+
+// Validate reports malformed patterns and sampling rates below 1.
+func (f RecordFilter) Validate() error {
+	for _, p := range append(f.Only[:len(f.Only):len(f.Only)], f.Skip...) {
+		if p == "" || p == transportSelector {
+			return fmt.Errorf("record filter: empty pattern")
+		}
+		if !strings.HasPrefix(p, transportSelector) {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("record filter %q: %w", p, err)
+			}
+		}
+	}
+	for method, n := range f.Sample {
+		if n < 1 {
+			return fmt.Errorf("record filter: sample %s 1 in %d: want at least 1", method, n)
+		}
+	}
+	return nil
+}
+
+// verdict is what a Filter decided for a round trip.
+type verdict int
+
+const (
+	verdictKeep verdict = iota
+	verdictSkip
+	// verdictHeld is a sampled request that waits on its outcome.
+	verdictHeld
+)
+
+// Filter applies a RecordFilter to the entries a recorder receives, ahead
+// of redaction, as FileRecorder and transcript.Recorder do with the Filter
+// of their Config. A nil *Filter keeps every entry.
+type Filter struct {
+	cfg RecordFilter
+
+	mu       sync.Mutex
+	verdicts map[string]verdict
+	held     map[string]Entry
+	// window holds the ids verdicts remembers, oldest at next once full.
+	window  [filterWindow]string
+	next    int
+	sampled map[string]int
+	pending []Tombstone
+}
+
+// NewFilter returns the Filter for cfg, which should be valid, or nil when
+// cfg keeps everything.
+func NewFilter(cfg RecordFilter) *Filter {
+	if cfg.IsZero() {
+		return nil
+	}
+	return &Filter{
+		cfg:      cfg,
+		verdicts: make(map[string]verdict),
+		held:     make(map[string]Entry),
+		sampled:  make(map[string]int),
+	}
+}
+
+// Filter returns the entries to record for entry, a message exchanged over
+// transport: none when its round trip is left out or its sampled request
+// is held back, or entry preceded by the tombstones and held request due
+// before it. Entries that answer no known request are kept.
+func (f *Filter) Filter(transport string, entry Entry) []Entry {
+	if f == nil {
+		return []Entry{entry}
+	}
+	var env struct {
+		ID    json.RawMessage `json:"id"`
+		Error json.RawMessage `json:"error"`
+	}
+	_ = json.Unmarshal(entry.Message, &env)
+	id := string(env.ID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if entry.Direction == DirectionRequest {
+		var req Request
+		_ = json.Unmarshal(entry.Message, &req)
+		switch {
+		case !f.selects(transport, &req):
+			f.remember(id, verdictSkip)
+			f.skipped(req.Method)
+			return nil
+		case f.cfg.Sample[req.Method] > 0:
+			f.remember(id, verdictHeld)
+			f.held[id] = entry
+			return nil
+		}
+		f.remember(id, verdictKeep)
+		return f.due(entry)
+	}
+	switch f.verdicts[id] {
+	case verdictSkip:
+		return nil
+	case verdictHeld:
+		req := f.held[id]
+		delete(f.held, id)
+		var sent Request
+		_ = json.Unmarshal(req.Message, &sent)
+		method := sent.Method
+		failed := entry.Direction == DirectionError || len(env.Error) > 0 && string(env.Error) != "null"
+		if !failed {
+			n := f.sampled[method]
+			f.sampled[method]++
+			if n%f.cfg.Sample[method] != 0 {
+				f.verdicts[id] = verdictSkip
+				f.skipped(method)
+				return nil
+			}
+		}
+		f.verdicts[id] = verdictKeep
+		return f.due(req, entry)
+	}
+	return f.due(entry)
+}
+
+// Flush returns the tombstones not yet written, for the recorder to write
+// before it closes the transcript.
+func (f *Filter) Flush() []Entry {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.due()
+}
+
+// selects reports whether the request sent over transport is recorded.
+func (f *Filter) selects(transport string, req *Request) bool {
+	if len(f.cfg.Only) > 0 && !matchesFilter(f.cfg.Only, transport, req.Method) {
+		return false
+	}
+	if matchesFilter(f.cfg.Skip, transport, req.Method) {
+		return false
+	}
+	return f.cfg.Match == nil || f.cfg.Match(req)
+}
+
+func matchesFilter(patterns []string, transport, method string) bool {
+	for _, p := range patterns {
+		if name, ok := strings.CutPrefix(p, transportSelector); ok {
+			if name == transport {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// remember stores the verdict on the request id, forgetting the oldest once
+// filterWindow are remembered. The caller holds mu.
+func (f *Filter) remember(id string, v verdict) {
+	if _, ok := f.verdicts[id]; !ok {
+		if old := f.window[f.next]; old != "" {
+			delete(f.verdicts, old)
+			delete(f.held, old)
+		}
+		f.window[f.next] = id
+		f.next = (f.next + 1) % filterWindow
+	}
+	f.verdicts[id] = v
+}
+
+// skipped counts a round trip of method left out. The caller holds mu.
+func (f *Filter) skipped(method string) {
+	if !f.cfg.Tombstones {
+		return
+	}
+	if n := len(f.pending); n > 0 && f.pending[n-1].Method == method {
+		f.pending[n-1].Count++
+		return
+	}
+	f.pending = append(f.pending, Tombstone{Method: method, Count: 1})
+}
+
+// due returns the pending tombstones followed by entries. The caller holds
+// mu.
+func (f *Filter) due(entries ...Entry) []Entry {
+	if len(f.pending) == 0 {
+		return entries
+	}
+	out := make([]Entry, 0, len(f.pending)+len(entries))
+	for _, t := range f.pending {
+		raw, _ := json.Marshal(t)
+		out = append(out, Entry{Direction: DirectionSkipped, Message: raw})
+	}
+	f.pending = nil
+	return append(out, entries...)
+}
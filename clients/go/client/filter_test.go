@@ -0,0 +1,148 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTrip returns the request and response entries of call id to method;
+// failed answers with a JSON-RPC error.
+func roundTrip(id int, method string, failed bool) []Entry {
+	resp := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{}}`, id)
+	if failed {
+		resp = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32000,"message":"busy"}}`, id)
+	}
+	return []Entry{
+		{Direction: DirectionRequest, Message: json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"meta":{"timestamp":"t","sequence":%d}}`, id, method, id))},
+		{Direction: DirectionResponse, Message: json.RawMessage(resp)},
+	}
+}
+
+// filtered runs entries through a Filter for cfg and describes what is
+// kept, one "direction method-or-id" item per entry.
+func filtered(t *testing.T, cfg RecordFilter, transport string, entries []Entry) string {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	f := NewFilter(cfg)
+	var kept []Entry
+	for _, e := range entries {
+		kept = append(kept, f.Filter(transport, e)...)
+	}
+	kept = append(kept, f.Flush()...)
+	var out []string
+	for _, e := range kept {
+		var env struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Count  int    `json:"count"`
+		}
+		if err := json.Unmarshal(e.Message, &env); err != nil {
+			t.Fatalf("decode %s: %v", e.Message, err)
+		}
+		switch e.Direction {
+		case DirectionSkipped:
+			out = append(out, fmt.Sprintf("skipped %s*%d", env.Method, env.Count))
+		case DirectionRequest:
+			out = append(out, fmt.Sprintf("request %d", env.ID))
+		default:
+			out = append(out, fmt.Sprintf("%s %d", e.Direction, env.ID))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestFilterSelects(t *testing.T) {
+	var session []Entry
+	session = append(session, roundTrip(1, MethodInitialize, false)...)
+	session = append(session, roundTrip(2, MethodEmbed, false)...)
+	session = append(session, roundTrip(3, MethodEmbed, false)...)
+	session = append(session, roundTrip(4, MethodPing, false)...)
+
+	cases := []struct {
+		name string
+		cfg  RecordFilter
+		want string
+	}{
+		{"only", RecordFilter{Only: []string{MethodEmbed}}, "request 2, response 2, request 3, response 3"},
+		{"wildcard", RecordFilter{Only: []string{"mcp.p*"}}, "request 4, response 4"},
+		{"skip", RecordFilter{Skip: []string{MethodEmbed, MethodPing}}, "request 1, response 1"},
+		{"other transport", RecordFilter{Only: []string{"transport=stdio"}}, ""},
+		{"transport", RecordFilter{Skip: []string{"transport=stdio", MethodEmbed}, Only: []string{"transport=http"}}, "request 1, response 1, request 4, response 4"},
+		{"match", RecordFilter{Match: func(r *Request) bool { return r.ID%2 == 1 }}, "request 1, response 1, request 3, response 3"},
+		{"tombstones", RecordFilter{Skip: []string{MethodEmbed}, Tombstones: true}, "request 1, response 1, skipped mcp.embed*2, request 4, response 4"},
+		{"trailing tombstones", RecordFilter{Only: []string{MethodInitialize}, Tombstones: true}, "request 1, response 1, skipped mcp.embed*2, skipped mcp.ping*1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filtered(t, tc.cfg, TransportHTTP, session); got != tc.want {
+				t.Fatalf("kept %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterSamples(t *testing.T) {
+	var session []Entry
+	for id := 1; id <= 5; id++ {
+		session = append(session, roundTrip(id, MethodEmbed, id == 4)...)
+	}
+	failure, _ := json.Marshal(Failure{ID: 6, Method: MethodEmbed, Error: "timeout", Class: "timeout", Timeout: true})
+	session = append(session, roundTrip(6, MethodEmbed, false)[0], Entry{Direction: DirectionError, Message: failure})
+	session = append(session, roundTrip(7, MethodPing, false)...)
+
+	got := filtered(t, RecordFilter{Sample: map[string]int{MethodEmbed: 2}, Tombstones: true}, TransportHTTP, session)
+	// The first and every second success are kept, and both failures.
+	want := "request 1, response 1, skipped mcp.embed*1, request 3, response 3, request 4, response 4, skipped mcp.embed*1, request 6, error 6, request 7, response 7"
+	if got != want {
+		t.Fatalf("kept %q\nwant %q", got, want)
+	}
+}
+
+func TestFilterFollowsStreamFrames(t *testing.T) {
+	trip := roundTrip(1, MethodEmbed, false)
+	session := []Entry{trip[0], trip[1], trip[1], trip[1]}
+	if got := filtered(t, RecordFilter{Skip: []string{MethodEmbed}}, TransportHTTP, session); got != "" {
+		t.Fatalf("frames of a skipped stream kept: %q", got)
+	}
+	if got := filtered(t, RecordFilter{Sample: map[string]int{MethodEmbed: 3}}, TransportHTTP, session); got != "request 1, response 1, response 1, response 1" {
+		t.Fatalf("frames of a sampled stream: %q", got)
+	}
+}
+
+func TestRecordFilterValidate(t *testing.T) {
+	for _, cfg := range []RecordFilter{
+		{Only: []string{""}},
+		{Skip: []string{"transport="}},
+		{Skip: []string{"[bad"}},
+		{Sample: map[string]int{MethodEmbed: 0}},
+	} {
+		if err := (RecorderConfig{Filter: cfg}).Validate(); err == nil {
+			t.Fatalf("%+v validated", cfg)
+		}
+	}
+	if NewFilter(RecordFilter{Tombstones: true}) != nil {
+		t.Fatal("a filter keeping everything was built")
+	}
+}
+
+func TestFileRecorderFilters(t *testing.T) {
+	r := NewFileRecorder(filepath.Join(t.TempDir(), "t.json"), TransportHTTP)
+	r.Config = RecorderConfig{Filter: RecordFilter{Skip: []string{MethodPing}, Tombstones: true}}
+	for _, e := range append(roundTrip(1, MethodEmbed, false), roundTrip(2, MethodPing, false)...) {
+		r.Record(e)
+	}
+	if len(r.entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(r.entries))
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if last := r.entries[len(r.entries)-1]; last.Direction != DirectionSkipped || string(last.Message) != `{"count":1,"method":"mcp.ping"}` {
+		t.Fatalf("last entry %s %s, want the ping tombstone", last.Direction, last.Message)
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// base64Chunk is how much of a base64 vector decodeBase64Float32s decodes
+// at a time when copying through a buffer: 4,096 characters, 3,072 bytes,
+// a whole number of float32s.
+const base64Chunk = 4096
+
+// decodeBase64Float32s decodes src, the standard base64 of little-endian
+// float32s, into the vector into returns for its component count. On a
+// little-endian host the bytes are decoded straight into the vector's
+// memory (see float32Bytes); elsewhere they pass through a buffer on the
+// stack a chunk at a time, so neither path allocates more than the vector.
+// into may hand out a window of a larger allocation the caller shares
+// between vectors.
+func decodeBase64Float32s(src []byte, into func(n int) []float32) ([]float32, error) {
+	size, ok := base64Size(src)
+	if !ok || size%4 != 0 {
+		// Line breaks, which base64 skips, or input it rejects, for which
+		// the buffered path has the errors.
+		return decodeBase64Buffered(src, into)
+	}
+	out := into(size / 4)
+	if size == 0 {
+		return out, nil
+	}
+	var err error
+	if view, ok := float32Bytes(out); ok {
+		err = decodeBase64InPlace(view, src)
+	} else {
+		err = decodeBase64Chunked(out, src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeBase64InPlace decodes src into view, exactly its decoded size.
+func decodeBase64InPlace(view []byte, src []byte) error {
+	// All but the last quantum, which may be padded, decodes to exactly
+	// its share of view.
+	bulk := len(src) - 4
+	if _, err := base64.StdEncoding.Decode(view[:bulk/4*3], src[:bulk]); err != nil {
+		return corruptBase64(err, 0)
+	}
+	var tail [3]byte
+	n, err := base64.StdEncoding.Decode(tail[:], src[bulk:])
+	if err != nil {
+		return corruptBase64(err, bulk)
+	}
+	copy(view[bulk/4*3:], tail[:n])
+	return nil
+}
+
+// decodeBase64Chunked decodes src into out, whose length is the number of
+// float32s it holds, a chunk at a time.
+func decodeBase64Chunked(out []float32, src []byte) error {
+	var buf [base64Chunk / 4 * 3]byte
+	k := 0
+	for off := 0; off < len(src); off += base64Chunk {
+		n, err := base64.StdEncoding.Decode(buf[:], src[off:min(off+base64Chunk, len(src))])
+		if err != nil {
+			return corruptBase64(err, off)
+		}
+		for i := 0; i+4 <= n; i += 4 {
+			out[k] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i:]))
+			k++
+		}
+	}
+	return nil
+}
+
+// corruptBase64 wraps the error of decoding the part of a vector at off,
+// giving the offset of a CorruptInputError within the whole.
+func corruptBase64(err error, off int) error {
+	if at, ok := err.(base64.CorruptInputError); ok {
+		err = at + base64.CorruptInputError(off)
+	}
+	return fmt.Errorf("decode base64 vector: %w", err)
+}
+
+// base64Size returns the number of bytes src decodes to, reporting false
+// when that cannot be told from its length alone. Padding is allowed only
+// at the end, so every chunk before the last decodes to its full size.
+func base64Size(src []byte) (int, bool) {
+	if len(src)%4 != 0 || bytes.ContainsAny(src, "\r\n") {
+		return 0, false
+	}
+	if len(src) > 2 && bytes.IndexByte(src[:len(src)-2], '=') >= 0 {
+		return 0, false
+	}
+	size := len(src) / 4 * 3
+	if len(src) > 0 && src[len(src)-1] == '=' {
+		size--
+		if src[len(src)-2] == '=' {
+			size--
+		}
+	}
+	return size, true
+}
+
+// decodeBase64Buffered decodes src through a buffer of its decoded size,
+// for inputs base64Size cannot measure.
+func decodeBase64Buffered(src []byte, into func(n int) []float32) ([]float32, error) {
+	buf := make([]byte, base64.StdEncoding.DecodedLen(len(src)))
+	n, err := base64.StdEncoding.Decode(buf, src)
+	if err != nil {
+		return nil, fmt.Errorf("decode base64 vector: %w", err)
+	}
+	if n%4 != 0 {
+		return nil, fmt.Errorf("decode base64 vector: %d bytes is not a whole number of float32s", n)
+	}
+	out := into(n / 4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return out, nil
+}
+
+// makeFloat32s is the into of a vector with an allocation of its own.
+func makeFloat32s(n int) []float32 { return make([]float32, n) }
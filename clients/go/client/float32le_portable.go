@@ -0,0 +1,8 @@
+//go:build purego || !(386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package client
+
+// float32Bytes reports false: on a big-endian host, or with the purego
+// tag, the memory of a vector is not its wire layout, and base64 vectors
+// are converted component by component with encoding/binary.
+func float32Bytes(v []float32) ([]byte, bool) { return nil, false }
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeBoth decodes src in place and chunked, whichever float32Bytes
+// would pick on this host, checking the two agree with the buffered path.
+func decodeBoth(t *testing.T, src string) ([]float32, error) {
+	t.Helper()
+	want, wantErr := decodeBase64Buffered([]byte(src), makeFloat32s)
+	got, err := decodeBase64Float32s([]byte(src), makeFloat32s)
+	if (err != nil) != (wantErr != nil) || err != nil && err.Error() != wantErr.Error() {
+		t.Fatalf("%.40q: error %v, buffered %v", src, err, wantErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size, ok := base64Size([]byte(src)); ok && size > 0 {
+		view := make([]byte, size)
+		if err := decodeBase64InPlace(view, []byte(src)); err != nil {
+			t.Fatalf("%.40q: in place: %v", src, err)
+		}
+		chunked := make([]float32, size/4)
+		if err := decodeBase64Chunked(chunked, []byte(src)); err != nil {
+			t.Fatalf("%.40q: chunked: %v", src, err)
+		}
+		if !reflect.DeepEqual(chunked, want) {
+			t.Fatalf("%.40q: chunked %v, buffered %v", src, chunked, want)
+		}
+		if placed := string(view); placed != string(float32sLE(want)) {
+			t.Fatalf("%.40q: decoded in place to other bytes", src)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%.40q: got %v, buffered %v", src, got, want)
+	}
+	return got, nil
+}
+
+// float32sLE is the little-endian wire layout of v.
+func float32sLE(v []float32) []byte {
+	out := make([]byte, 0, 4*len(v))
+	for _, f := range v {
+		b := math.Float32bits(f)
+		out = append(out, byte(b), byte(b>>8), byte(b>>16), byte(b>>24))
+	}
+	return out
+}
+
+func TestDecodeBase64Float32s(t *testing.T) {
+	// Lengths around the chunk size and each padding of the last quantum.
+	for _, n := range []int{0, 1, 2, 3, 767, 768, 769, 1536, 2000} {
+		want := make([]float32, n)
+		for i := range want {
+			want[i] = float32(math.Sin(float64(i))) * 1e3
+		}
+		if n > 0 {
+			want[n-1] = float32(math.Inf(-1))
+		}
+		got, err := decodeBoth(t, encodeBase64Vector(want))
+		if err != nil || len(got) != n || !reflect.DeepEqual(got, want) && n > 0 {
+			t.Fatalf("%d components: got %d, %v", n, len(got), err)
+		}
+	}
+
+	long := encodeBase64Vector(make([]float32, 1500))
+	for _, bad := range []string{
+		"AAA=",                          // three bytes
+		"AAAAAAA=",                      // five bytes
+		"AAAA!AAA",                      // not base64
+		"AA==AAAA",                      // padding before the end
+		long[:5000] + "*" + long[5001:], // corrupt past the first chunk
+		long[:len(long)-1],              // truncated
+	} {
+		if _, err := decodeBoth(t, bad); err == nil {
+			t.Fatalf("expected an error decoding %.40q", bad)
+		}
+	}
+	// Line breaks are skipped by base64, as before.
+	wrapped := long[:76] + "\r\n" + long[76:]
+	if got, err := decodeBoth(t, wrapped); err != nil || len(got) != 1500 {
+		t.Fatalf("wrapped: %d, %v", len(got), err)
+	}
+	var corrupt base64.CorruptInputError
+	if _, err := decodeBase64Float32s([]byte(long[:5000]+"*"+long[5001:]), makeFloat32s); !errors.As(err, &corrupt) || corrupt != 5000 {
+		t.Fatalf("corrupt input reported as %v, want offset 5000", err)
+	}
+}
+
+func TestDecodeBase64Float32sIntoWindow(t *testing.T) {
+	src := []byte(encodeBase64Vector(make([]float32, 768)))
+	slab := make([]float32, 4*768)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := decodeBase64Float32s(src, func(n int) []float32 { return slab[768 : 768+n] }); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("decoding into a window allocated %v times", allocs)
+	}
+}
+
+// BenchmarkDecodeBase64Vectors decodes batches of 1,024 base64 vectors of
+// 768 dimensions into one allocation, reporting the time 1M of them take:
+// in place on this host, chunked as on a big-endian one, and through a
+// buffer of the decoded bytes as before.
+func BenchmarkDecodeBase64Vectors(b *testing.B) {
+	const batch, dim = 1024, 768
+	encoded := make([][]byte, batch)
+	v := make([]float32, dim)
+	for i := range encoded {
+		for j := range v {
+			v[j] = float32(math.Sin(float64(i*dim + j)))
+		}
+		encoded[i] = []byte(encodeBase64Vector(v))
+	}
+	decoders := map[string]func(slab []float32, src []byte) error{
+		"in-place": func(slab []float32, src []byte) error {
+			view, _ := float32Bytes(slab)
+			return decodeBase64InPlace(view, src)
+		},
+		"chunked": decodeBase64Chunked,
+		"buffered": func(slab []float32, src []byte) error {
+			_, err := decodeBase64Buffered(src, func(int) []float32 { return slab })
+			return err
+		},
+	}
+	for _, name := range []string{"in-place", "chunked", "buffered"} {
+		decode := decoders[name]
+		b.Run(name, func(b *testing.B) {
+			if _, ok := float32Bytes(nil); !ok && name == "in-place" {
+				b.Skip("this host decodes base64 vectors chunked")
+			}
+			b.SetBytes(batch * dim * 4)
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				slab := make([]float32, batch*dim)
+				for k, src := range encoded {
+					if err := decode(slab[k*dim:(k+1)*dim], src); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			perVector := time.Since(start) / time.Duration(b.N*batch)
+			b.ReportMetric((perVector * 1_000_000).Seconds(), "s/1M-vectors")
+		})
+	}
+}
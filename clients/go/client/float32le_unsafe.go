@@ -0,0 +1,15 @@
+//go:build !purego && (386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package client
+
+import "unsafe"
+
+// float32Bytes returns the memory of v as bytes. On these little-endian
+// architectures that is the wire layout of a base64 vector, so it may be
+// decoded in place; the purego tag turns this off.
+func float32Bytes(v []float32) ([]byte, bool) {
+	if len(v) == 0 {
+		return nil, true
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(v))), len(v)*4), true
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Frame encodings accepted by ClientConfig.Framing for the stream transports
+// (stdio, unix, inproc, and NewConnTransport).
+const (
+	// FramingNewline terminates each JSON envelope with '\n'.
+	FramingNewline = "newline"
+	// FramingLengthPrefixed precedes each JSON envelope with its length as a
+	// 4-byte big-endian integer, so stray output between frames is never
+	// mistaken for an envelope boundary.
+	FramingLengthPrefixed = "length-prefixed"
+)
+
+// DefaultMaxFrameSize bounds a single inbound frame when ClientConfig leaves
+// MaxFrameSize unset.
+const DefaultMaxFrameSize = 64 << 20
+
+// ErrFrameTooLarge reports an inbound frame longer than the configured
+// MaxFrameSize. It is raised before the frame body is buffered, and matches
+// ErrPayloadTooLarge.
+var ErrFrameTooLarge error = &classError{"frame exceeds maximum size", ErrPayloadTooLarge}
+
+// framing reads and writes envelopes on a byte stream.
+type framing struct {
+	lengthPrefixed bool
+	maxSize        int
+}
+
+func newFraming(mode string, maxSize int) framing {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return framing{lengthPrefixed: mode == FramingLengthPrefixed, maxSize: maxSize}
+}
+
+func validFraming(mode string) bool {
+	return mode == "" || mode == FramingNewline || mode == FramingLengthPrefixed
+}
+
+// write emits payload as one frame.
+func (f framing) write(w io.Writer, payload []byte) error {
+	if !f.lengthPrefixed {
+		return writeFull(w, append(payload, '\n'))
+	}
+	if uint64(len(payload)) > math.MaxUint32 {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, len(payload))
+	}
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+	return writeFull(w, buf)
+}
+
+// read returns the next non-empty frame. io.EOF is returned only when the
+// stream ends on a frame boundary.
+func (f framing) read(r *bufio.Reader) ([]byte, error) {
+	if f.lengthPrefixed {
+		return f.readLengthPrefixed(r)
+	}
+	for {
+		line, err := f.readLine(r)
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			return trimmed, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readLine reads through the next '\n' without holding more than maxSize
+// bytes of it.
+func (f framing) readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(bytes.TrimRight(chunk, "\r\n")) > f.maxSize {
+			return nil, fmt.Errorf("%w: line longer than %d bytes", ErrFrameTooLarge, f.maxSize)
+		}
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
+
+func (f framing) readLengthPrefixed(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(f.maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes announced, limit %d", ErrFrameTooLarge, size, f.maxSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+// writeFull writes all of b, tolerating writers that accept it piecemeal.
+func writeFull(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		b = b[n:]
+	}
+	return nil
+}
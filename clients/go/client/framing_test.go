@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// transcriptBodies returns the recorded envelopes of a transcript file with
+// their timing metadata removed.
+func transcriptBodies(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("decode transcript: %v", err)
+	}
+	bodies := make([]map[string]any, len(doc.Messages))
+	for i, entry := range doc.Messages {
+		if err := json.Unmarshal(entry.Message, &bodies[i]); err != nil {
+			t.Fatalf("decode entry %d: %v", i, err)
+		}
+		delete(bodies[i], "meta")
+	}
+	return bodies
+}
+
+func TestStdioFramingsRecordIdenticalTranscripts(t *testing.T) {
+	dir := t.TempDir()
+	var transcripts [][]map[string]any
+	for _, mode := range []string{FramingNewline, FramingLengthPrefixed} {
+		t.Setenv(helperFramingEnv, mode)
+		path := filepath.Join(dir, mode+".json")
+		err := Run(context.Background(), Options{
+			Config:           ClientConfig{Command: helperCommand(t), Framing: mode},
+			RecordTranscript: path,
+		})
+		if err != nil {
+			t.Fatalf("%s: Run: %v", mode, err)
+		}
+		transcripts = append(transcripts, transcriptBodies(t, path))
+	}
+	if len(transcripts[0]) != 6 {
+		t.Fatalf("expected 6 entries, got %d", len(transcripts[0]))
+	}
+	if !reflect.DeepEqual(transcripts[0], transcripts[1]) {
+		t.Fatalf("framings recorded different transcripts:\n%v\n%v", transcripts[0], transcripts[1])
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	bigVector := make([]float32, 1024)
+	handler := func(req Request) (Response, error) {
+		raw, _ := json.Marshal(embedResult{Embeddings: []embeddingEntry{{Vector: bigVector}}})
+		return Response{Result: raw}, nil
+	}
+	for _, mode := range []string{FramingNewline, FramingLengthPrefixed} {
+		t.Run(mode, func(t *testing.T) {
+			c, err := New(ClientConfig{Transport: TransportInProc, Handler: handler, Framing: mode, MaxFrameSize: 512})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.Is(err, ErrFrameTooLarge) {
+				t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLengthPrefixedRejectsOversizedHeader(t *testing.T) {
+	near, far := net.Pipe()
+	defer far.Close()
+	go func() {
+		f := newFraming(FramingLengthPrefixed, 0)
+		if _, err := f.read(bufio.NewReader(far)); err != nil {
+			return
+		}
+		// Announce a 4 GiB frame and send nothing else.
+		_, _ = far.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}()
+
+	tr := NewConnTransport(near, ConnOptions{Framing: FramingLengthPrefixed})
+	defer tr.Close()
+	_, err := tr.RoundTrip(context.Background(), &Request{JSONRPC: JSONRPCVersion, ID: 1, Method: MethodPing})
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// fixtureEnvelopes returns the responses of the golden fixtures under
+// tests/fixtures/go, which seed the fuzz targets.
+func fixtureEnvelopes(f *testing.F) []json.RawMessage {
+	f.Helper()
+	// Variants of a transport keep their fixtures a level down.
+	root := filepath.Join("..", "..", "..", "tests", "fixtures", "go")
+	paths, err := filepath.Glob(filepath.Join(root, "*", "response.json"))
+	variants, _ := filepath.Glob(filepath.Join(root, "*", "*", "response.json"))
+	if paths = append(paths, variants...); err != nil || len(paths) == 0 {
+		f.Fatalf("no fixtures: %v", err)
+	}
+	var envelopes []json.RawMessage
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		// A fixture is a list of envelopes or a transcript of them.
+		var list []json.RawMessage
+		if json.Unmarshal(content, &list) == nil {
+			envelopes = append(envelopes, list...)
+			continue
+		}
+		var doc transcriptFile
+		if err := json.Unmarshal(content, &doc); err != nil {
+			f.Fatalf("%s: %v", path, err)
+		}
+		for _, entry := range doc.Messages {
+			envelopes = append(envelopes, entry.Message)
+		}
+	}
+	return envelopes
+}
+
+// allocated returns the bytes the heap grew by while fn ran.
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// fuzzCodecs are the codecs FuzzDecodeResponse picks from by its first
+// argument.
+var fuzzCodecs = []Codec{JSONCodec, MsgPackCodec, CBORCodec}
+
+func FuzzDecodeResponse(f *testing.F) {
+	for _, env := range fixtureEnvelopes(f) {
+		var v any
+		if err := json.Unmarshal(env, &v); err != nil {
+			f.Fatal(err)
+		}
+		for i, c := range fuzzCodecs {
+			data, err := c.Marshal(v)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(byte(i), data)
+		}
+	}
+	for _, seed := range []string{
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"x","data":{"retryable":true}}}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"x","data":[1]}}`,
+		`{"jsonrpc":"2.0","id":1,"error":null,"result":null}`,
+		`{"id":1,"result":{"embeddings":[{"index":0,"vector":"AACAPw=="},{"index":1,"vector":[1,2]}],"usage":{"prompt_tokens":1}}}`,
+		`{"id":1,"result":{"embeddings":[{"vector":[]}],"Embeddings":null}}`,
+	} {
+		f.Add(byte(0), []byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, pick byte, data []byte) {
+		c := fuzzCodecs[int(pick)%len(fuzzCodecs)]
+		var resp Response
+		var err error
+		// Each decoder transcodes to JSON at a bounded ratio, and a
+		// length field it has not the data for is an error, never an
+		// allocation.
+		if n := allocated(func() { err = decodeResponse(c, data, &resp) }); n > 64*uint64(len(data))+64<<10 {
+			t.Fatalf("%s: %d bytes allocated decoding %d", c.Name(), n, len(data))
+		}
+		if c == JSONCodec && !json.Valid(data) && err == nil {
+			t.Fatalf("invalid JSON %q decoded", data)
+		}
+		if err != nil {
+			return
+		}
+		if len(resp.Result) > 0 && !json.Valid(resp.Result) {
+			t.Fatalf("%s: result %q is not JSON", c.Name(), resp.Result)
+		}
+		// Transcripts record the envelope, and callers the error.
+		if _, err := json.Marshal(resp); err != nil {
+			t.Fatalf("%s: re-encode: %v", c.Name(), err)
+		}
+		_ = callError(&resp, nil)
+
+		// The one-pass embed decoder must agree with encoding/json, with
+		// and without hints.
+		if len(resp.Result) == 0 {
+			return
+		}
+		var plain plainEmbedResult
+		plainErr := json.Unmarshal(resp.Result, &plain)
+		for _, hint := range [][2]int{{0, 0}, {2, 3}} {
+			fast := embedResult{batch: hint[0], dim: hint[1]}
+			fastErr := json.Unmarshal(resp.Result, &fast)
+			if (fastErr == nil) != (plainErr == nil) {
+				t.Fatalf("%s: embed result %s: one-pass error %v, encoding/json %v", c.Name(), resp.Result, fastErr, plainErr)
+			}
+			plain.batch, plain.dim = hint[0], hint[1]
+			if fastErr == nil && !reflect.DeepEqual(resultBits(fast), resultBits(embedResult(plain))) {
+				t.Fatalf("%s: embed result %s:\none-pass     %+v\nencoding/json %+v", c.Name(), resp.Result, fast, plain)
+			}
+		}
+	})
+}
+
+// resultBits returns r with its vectors replaced by their bits, so that
+// results holding NaN compare equal.
+func resultBits(r embedResult) []any {
+	out := []any{r.Model, r.EncodingFormat, r.Usage, r.batch, r.dim, r.Embeddings == nil}
+	for _, e := range r.Embeddings {
+		bits := make([]uint32, len(e.Vector))
+		for i, x := range e.Vector {
+			bits[i] = math.Float32bits(x)
+		}
+		out = append(out, e.Index, e.Vector == nil, bits)
+	}
+	return out
+}
+
+// expectedFrames splits data into the frames f must read from it, ending
+// with the error f must fail with.
+func expectedFrames(f framing, data []byte) ([][]byte, error) {
+	var frames [][]byte
+	if f.lengthPrefixed {
+		for len(data) > 0 {
+			if len(data) < 4 {
+				return frames, io.ErrUnexpectedEOF
+			}
+			size := binary.BigEndian.Uint32(data)
+			if uint64(size) > uint64(f.maxSize) {
+				return frames, ErrFrameTooLarge
+			}
+			if uint64(len(data)-4) < uint64(size) {
+				return frames, io.ErrUnexpectedEOF
+			}
+			frames = append(frames, data[4:4+size])
+			data = data[4+size:]
+		}
+		return frames, io.EOF
+	}
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(bytes.TrimRight(line, "\r\n")) > f.maxSize {
+			return frames, ErrFrameTooLarge
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			frames = append(frames, trimmed)
+		}
+	}
+	return frames, io.EOF
+}
+
+func FuzzFrameReader(f *testing.F) {
+	for _, env := range fixtureEnvelopes(f) {
+		var prefixed bytes.Buffer
+		if err := newFraming(FramingLengthPrefixed, 0).write(&prefixed, env); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(true, uint16(len(env)), prefixed.Bytes())
+		f.Add(false, uint16(len(env)), append(append([]byte(nil), env...), '\n'))
+	}
+	f.Add(false, uint16(4), []byte("  \r\n{}\r\n\n12345\nabc"))
+	f.Add(true, uint16(4), []byte{0, 0, 0, 0, 0, 0, 0, 5, 1})
+	f.Add(true, uint16(4), []byte{0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, lengthPrefixed bool, maxSize uint16, data []byte) {
+		mode := FramingNewline
+		if lengthPrefixed {
+			mode = FramingLengthPrefixed
+		}
+		fr := newFraming(mode, int(maxSize)%(8<<10)+1)
+		want, wantErr := expectedFrames(fr, data)
+		// A reader smaller than most frames makes the newline framing
+		// assemble lines from several chunks.
+		r := bufio.NewReaderSize(bytes.NewReader(data), 16)
+		for i := 0; ; i++ {
+			var frame []byte
+			var err error
+			if n := allocated(func() { frame, err = fr.read(r) }); n > 4*uint64(fr.maxSize)+4<<10 {
+				t.Fatalf("%d bytes allocated reading a frame of at most %d", n, fr.maxSize)
+			}
+			if err != nil {
+				if i != len(want) || !errors.Is(err, wantErr) {
+					t.Fatalf("frame %d: error %v, want %v after %d frames", i, err, wantErr, len(want))
+				}
+				return
+			}
+			if i >= len(want) || !bytes.Equal(frame, want[i]) {
+				t.Fatalf("frame %d: %q, want %q", i, frame, want)
+			}
+			if len(frame) > fr.maxSize {
+				t.Fatalf("frame %d of %d bytes exceeds %d", i, len(frame), fr.maxSize)
+			}
+		}
+	})
+}
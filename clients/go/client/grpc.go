@@ -0,0 +1,449 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embedpb"
+)
+
+// TransportGRPC calls the Embedder service of embednexus.proto (see package
+// embedpb) over HTTP/2: grpc:// endpoints in cleartext, which net/http
+// speaks from Go 1.24, and grpcs:// ones over TLS configured by the fields
+// the tls transport reads. Embeds, streamed embeds, and model listings map
+// onto their RPCs and the heartbeat onto Check; the handshake and
+// capabilities are answered by the client itself, and the other methods
+// fail with ErrMethodNotFound. The API key, request ID, idempotency key,
+// and trace context travel as metadata, and the deadline of a call as
+// grpc-timeout. Transcripts record the messages exchanged rendered as JSON
+// under their proto field names, which are the members of the envelopes.
+// The tests of module embedgrpc run it against a grpc-go server of the
+// generated code.
+const TransportGRPC = "grpc"
+
+// DefaultGRPCEndpoint is the grpc endpoint when none is configured.
+const DefaultGRPCEndpoint = "grpc://127.0.0.1:50051"
+
+// contentTypeGRPC is the media type of gRPC requests and responses.
+const contentTypeGRPC = "application/grpc"
+
+// grpcBase returns the http or https URL the RPCs of a grpc:// or grpcs://
+// endpoint post to, without a trailing slash, and whether it is https.
+func grpcBase(endpoint string) (string, bool) {
+	if rest, ok := strings.CutPrefix(endpoint, "grpcs://"); ok {
+		return "https://" + strings.TrimSuffix(rest, "/"), true
+	}
+	return "http://" + strings.TrimSuffix(strings.TrimPrefix(endpoint, "grpc://"), "/"), false
+}
+
+// grpcTransport carries the calls of a grpc client as RPCs over an
+// httpTransport, translating the envelopes of the methods it knows into
+// proto messages and the answers back.
+type grpcTransport struct {
+	h    *httpTransport
+	base string
+}
+
+func newGRPCTransport(h *httpTransport) *grpcTransport {
+	t := &grpcTransport{h: h}
+	t.base, _ = grpcBase(h.endpoint)
+	h.client.Transport = grpcRoundTripper{h.client.Transport}
+	if h.hb != nil {
+		h.hb.probe = t.ping
+	}
+	return t
+}
+
+func (t *grpcTransport) Kind() string                   { return t.h.Kind() }
+func (t *grpcTransport) Close() error                   { return t.h.Close() }
+func (t *grpcTransport) observe(ev *transportEvents)    { t.h.observe(ev) }
+func (t *grpcTransport) addresses() map[string][]string { return t.h.addresses() }
+
+// grpcRoundTripper adds the headers gRPC requires of every call: trailers
+// accepted, and the deadline of its context as grpc-timeout.
+type grpcRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt grpcRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("Accept")
+	if deadline, ok := req.Context().Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", grpcTimeout(time.Until(deadline)))
+	}
+	return rt.next.RoundTrip(req)
+}
+
+func (rt grpcRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// grpcTimeout formats d as a grpc-timeout value: at most eight digits of
+// the finest unit that holds it, rounded up.
+func grpcTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+	for _, u := range []struct {
+		unit time.Duration
+		name string
+	}{{time.Nanosecond, "n"}, {time.Microsecond, "u"}, {time.Millisecond, "m"}, {time.Second, "S"}, {time.Minute, "M"}} {
+		if n := ceilDiv(d, u.unit); n <= 99999999 {
+			return strconv.FormatInt(n, 10) + u.name
+		}
+	}
+	return strconv.FormatInt(min(ceilDiv(d, time.Hour), 99999999), 10) + "H"
+}
+
+// ceilDiv returns d/unit rounded up, without the overflow of adding unit-1
+// to durations near the maximum.
+func ceilDiv(d, unit time.Duration) int64 {
+	n := int64(d / unit)
+	if d%unit != 0 {
+		n++
+	}
+	return n
+}
+
+// message returns the proto request req translates into, and the RPC it
+// is sent with; ok is false for the methods without one.
+func (t *grpcTransport) message(req *Request) (rpc string, in embedpb.Message, ok bool, err error) {
+	switch req.Method {
+	case MethodEmbed, MethodEmbedStream:
+		var params embedParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return "", nil, true, fmt.Errorf("%s decode %s params: %w", t.h.kind, req.Method, err)
+		}
+		rpc = embedpb.EmbedMethod
+		if req.Method == MethodEmbedStream {
+			rpc = embedpb.EmbedStreamMethod
+		}
+		return rpc, &embedpb.EmbedRequest{Model: params.Model, Inputs: params.Inputs, Dimensions: int32(params.Dimensions)}, true, nil
+	case MethodListModels:
+		var params struct {
+			Cursor string `json:"cursor"`
+			Limit  int32  `json:"limit"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return "", nil, true, fmt.Errorf("%s decode %s params: %w", t.h.kind, req.Method, err)
+			}
+		}
+		return embedpb.ListModelsMethod, &embedpb.ListModelsRequest{Cursor: params.Cursor, Limit: params.Limit}, true, nil
+	case MethodPing:
+		return embedpb.CheckMethod, &embedpb.HealthCheckRequest{}, true, nil
+	}
+	return "", nil, false, nil
+}
+
+// translate returns req as the transcript records it: with the proto
+// request it is sent as, rendered as JSON, in place of its params.
+func (t *grpcTransport) translate(req *Request) *Request {
+	_, in, ok, err := t.message(req)
+	if !ok || err != nil {
+		return req.Wire()
+	}
+	params, err := json.Marshal(in)
+	if err != nil {
+		return req.Wire()
+	}
+	wire := *req.Wire()
+	wire.Params = params
+	return &wire
+}
+
+func (t *grpcTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if t.h.hb != nil {
+		t.h.hb.begin()
+		defer t.h.hb.end()
+	}
+	resp := &Response{JSONRPC: JSONRPCVersion, ID: req.ID}
+	rpc, in, ok, err := t.message(req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		switch req.Method {
+		case MethodInitialize:
+			resp.Result, err = json.Marshal(grpcInitializeResult(req))
+		case MethodCapabilities:
+			// No capabilities beyond the service's.
+			resp.Result = json.RawMessage(`{}`)
+		default:
+			resp.Error = &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q has no gRPC method", req.Method)}
+		}
+		return resp, err
+	}
+	var out embedpb.Message
+	switch rpc {
+	case embedpb.EmbedMethod, embedpb.EmbedStreamMethod:
+		// An unstreamed call to EmbedStream is answered as Embed is.
+		rpc, out = embedpb.EmbedMethod, &embedpb.EmbedResponse{}
+	case embedpb.ListModelsMethod:
+		out = &embedpb.ListModelsResponse{}
+	case embedpb.CheckMethod:
+		out = &embedpb.HealthCheckResponse{}
+	}
+	received := 0
+	resp.Error, resp.ServerRequestID, err = t.call(ctx, rpc, req, in, func(payload []byte) error {
+		if received++; received > 1 {
+			return fmt.Errorf("%s %s answered with more than one message: %w", t.h.kind, rpc, ErrProtocol)
+		}
+		if err := out.Unmarshal(payload); err != nil {
+			return t.decodeError(rpc, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return resp, nil
+	}
+	if received == 0 {
+		return nil, fmt.Errorf("%s %s answered with no message: %w", t.h.kind, rpc, ErrProtocol)
+	}
+	var result any = out
+	if check, ok := out.(*embedpb.HealthCheckResponse); ok {
+		result = map[string]any{"ok": check.Status == embedpb.HealthCheckResponse_SERVING, "status": check.Status}
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		return nil, fmt.Errorf("%s encode %s result: %w", t.h.kind, req.Method, err)
+	}
+	return resp, nil
+}
+
+// grpcInitializeResult answers the handshake on the service's behalf, with
+// the preferred offered protocol version: the service streams embeds as
+// version 2 does.
+func grpcInitializeResult(req *Request) InitializeResult {
+	var params struct {
+		ProtocolVersions []string `json:"protocol_versions"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	result := InitializeResult{Session: Session{Transport: TransportGRPC}}
+	if len(params.ProtocolVersions) > 0 {
+		result.ProtocolVersion = params.ProtocolVersions[0]
+	}
+	return result
+}
+
+// grpcStreamFrame is the frame of mcp.embed.stream an EmbedStreamResponse
+// stands for, its error mapped as a status is.
+type grpcStreamFrame struct {
+	Index  int32     `json:"index"`
+	Vector []float32 `json:"vector,omitempty"`
+	Error  *RPCError `json:"error,omitempty"`
+	Done   bool      `json:"done,omitempty"`
+}
+
+// RoundTripStream calls EmbedStream and passes each message to handle as a
+// frame, then the status that ends the stream: an OK status as the done
+// frame, any other as an error. Other methods are answered as RoundTrip
+// answers them, in a single frame.
+func (t *grpcTransport) RoundTripStream(ctx context.Context, req *Request, handle frameHandler) error {
+	if req.Method != MethodEmbedStream {
+		resp, err := t.RoundTrip(ctx, req)
+		if err != nil {
+			return err
+		}
+		more, err := handle(resp)
+		if err == nil && more {
+			err = fmt.Errorf("%s read stream: %w", t.h.kind, io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+	if t.h.hb != nil {
+		t.h.hb.begin()
+		defer t.h.hb.end()
+	}
+	_, in, _, err := t.message(req)
+	if err != nil {
+		return err
+	}
+	// errHandled stops the stream once handle wants no more frames.
+	errHandled := errors.New("handled")
+	var handleErr error
+	frame := func(f grpcStreamFrame) error {
+		result, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		more, err := handle(&Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: result})
+		if err != nil || !more {
+			handleErr = err
+			return errHandled
+		}
+		return nil
+	}
+	status, serverID, err := t.call(ctx, embedpb.EmbedStreamMethod, req, in, func(payload []byte) error {
+		var m embedpb.EmbedStreamResponse
+		if err := m.Unmarshal(payload); err != nil {
+			return t.decodeError(embedpb.EmbedStreamMethod, err)
+		}
+		f := grpcStreamFrame{Index: m.Index, Vector: m.Vector}
+		if m.Error != nil {
+			f.Vector, f.Error = nil, grpcRPCError(int(m.Error.Code), m.Error.Message)
+		}
+		return frame(f)
+	})
+	switch {
+	case errors.Is(err, errHandled):
+		return handleErr
+	case err != nil:
+		return err
+	}
+	var more bool
+	if status != nil {
+		more, err = handle(&Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: status, ServerRequestID: serverID})
+	} else {
+		more, err = handle(&Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: json.RawMessage(`{"done":true}`), ServerRequestID: serverID})
+	}
+	if err == nil && more {
+		err = fmt.Errorf("%s read stream: %w", t.h.kind, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// decodeError reports a message of rpc that does not decode.
+func (t *grpcTransport) decodeError(rpc string, err error) error {
+	return fmt.Errorf("%s decode %s response: %w: %w", t.h.kind, rpc, ErrProtocol, err)
+}
+
+// ping is the heartbeat probe: any answer of Check proves the connection
+// alive.
+func (t *grpcTransport) ping(ctx context.Context) error {
+	_, _, err := t.call(ctx, embedpb.CheckMethod, &Request{Method: MethodPing}, &embedpb.HealthCheckRequest{}, func([]byte) error { return nil })
+	return err
+}
+
+// call posts in, with the metadata of req, to rpc and passes each message
+// of the answer to each. It returns the status ending the answer, nil when
+// it is OK, and the server's ID for the request; err is a failure to reach
+// the service or to read its answer, or the error of each.
+func (t *grpcTransport) call(ctx context.Context, rpc string, req *Request, in embedpb.Message, each func(payload []byte) error) (status *RPCError, serverID string, err error) {
+	msg := in.Marshal()
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	carrier := &Request{Method: req.Method, Meta: req.Meta, body: append(body, msg...), mediaType: contentTypeGRPC}
+	httpResp, err := t.h.sendTo(ctx, http.MethodPost, t.base+rpc, carrier, contentTypeGRPC)
+	if err != nil {
+		return nil, "", err
+	}
+	defer httpResp.Body.Close()
+	serverID = httpResp.Header.Get(RequestIDHeader)
+	if httpResp.ProtoMajor != 2 {
+		return nil, serverID, fmt.Errorf("%s %s answered over %s, not HTTP/2: %w", t.h.kind, rpc, httpResp.Proto, ErrProtocol)
+	}
+	if ct := httpResp.Header.Get("Content-Type"); !strings.HasPrefix(ct, contentTypeGRPC) {
+		return nil, serverID, fmt.Errorf("%s %s answered with Content-Type %q: %w", t.h.kind, rpc, ct, ErrProtocol)
+	}
+	// A status among the headers answers without messages.
+	if code := httpResp.Header.Get("Grpc-Status"); code != "" {
+		status, err := t.status(rpc, code, httpResp.Header.Get("Grpc-Message"))
+		return status, serverID, err
+	}
+	watch := t.h.watchBody(httpResp)
+	defer watch.stop()
+	limit := responseLimit(ctx, t.h.maxResponse)
+	var read int64
+	var prefix [5]byte
+	for {
+		if _, err := io.ReadFull(httpResp.Body, prefix[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, serverID, readFailure(fmt.Errorf("%s read %s: %w", t.h.kind, rpc, watch.classify(err)), read)
+		}
+		if prefix[0] != 0 {
+			// No grpc-accept-encoding was sent, so no message may be
+			// compressed.
+			return nil, serverID, fmt.Errorf("%s %s answered with a compressed message: %w", t.h.kind, rpc, ErrProtocol)
+		}
+		size := int64(binary.BigEndian.Uint32(prefix[1:]))
+		if read += 5 + size; read > limit {
+			return nil, serverID, responseTooLarge(read, limit)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(httpResp.Body, payload); err != nil {
+			return nil, serverID, readFailure(fmt.Errorf("%s read %s: %w", t.h.kind, rpc, watch.classify(err)), read-size)
+		}
+		if err := each(payload); err != nil {
+			return nil, serverID, err
+		}
+		watch.reset()
+	}
+	code := httpResp.Trailer.Get("Grpc-Status")
+	if code == "" {
+		return nil, serverID, fmt.Errorf("%s %s ended without a grpc-status: %w", t.h.kind, rpc, ErrProtocol)
+	}
+	status, err = t.status(rpc, code, httpResp.Trailer.Get("Grpc-Message"))
+	return status, serverID, err
+}
+
+// status converts a grpc-status and its percent-encoded grpc-message.
+func (t *grpcTransport) status(rpc, code, message string) (*RPCError, error) {
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s %s answered with grpc-status %q: %w", t.h.kind, rpc, code, ErrProtocol)
+	}
+	if n == grpcOK {
+		return nil, nil
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return grpcRPCError(n, message), nil
+}
+
+// gRPC status codes with an error class of their own.
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcAborted           = 10
+	grpcUnimplemented     = 12
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcRPCError maps a gRPC status onto the JSON-RPC error of its class:
+// NOT_FOUND onto CodeModelNotFound, UNAUTHENTICATED and PERMISSION_DENIED
+// onto CodeUnauthorized, RESOURCE_EXHAUSTED, which gRPC reports for
+// messages over the size limit, onto CodePayloadTooLarge, and so on. The
+// data keeps the code as grpc_status, and marks UNAVAILABLE and ABORTED
+// retryable.
+func grpcRPCError(code int, message string) *RPCError {
+	rpc := &RPCError{Code: CodeInternalError, Message: message}
+	switch code {
+	case grpcInvalidArgument:
+		rpc.Code = CodeInvalidParams
+	case grpcDeadlineExceeded:
+		rpc.Code = CodeTimeout
+	case grpcNotFound:
+		rpc.Code = CodeModelNotFound
+	case grpcPermissionDenied, grpcUnauthenticated:
+		rpc.Code = CodeUnauthorized
+	case grpcResourceExhausted:
+		rpc.Code = CodePayloadTooLarge
+	case grpcUnimplemented:
+		rpc.Code = CodeMethodNotFound
+	}
+	retryable := code == grpcUnavailable || code == grpcAborted
+	rpc.Data, _ = json.Marshal(map[string]any{"grpc_status": code, "retryable": retryable})
+	return rpc
+}
@@ -0,0 +1,13 @@
+//go:build go1.24
+
+package client
+
+import "net/http"
+
+// enableH2C has t speak HTTP/2 without TLS to http:// URLs, as the grpc
+// transport does to grpc:// endpoints.
+func enableH2C(t *http.Transport) error {
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return nil
+}
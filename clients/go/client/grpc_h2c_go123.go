@@ -0,0 +1,13 @@
+//go:build !go1.24
+
+package client
+
+import (
+	"errors"
+	"net/http"
+)
+
+// enableH2C fails: net/http speaks HTTP/2 without TLS from Go 1.24.
+func enableH2C(*http.Transport) error {
+	return errors.New("grpc:// endpoints need HTTP/2 without TLS, which net/http speaks from Go 1.24; use a grpcs:// endpoint")
+}
@@ -0,0 +1,27 @@
+//go:build go1.24
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGRPCCleartext(t *testing.T) {
+	srv := httptest.NewUnstartedServer(&fakeGRPC{})
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+	c, err := NewClient("grpc://" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	vec, err := c.Embed(context.Background(), "abcd")
+	if err != nil || len(vec) != 3 || vec[0] != 4 {
+		t.Errorf("Embed over h2c: %v, %v", vec, err)
+	}
+}
@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embedpb"
+)
+
+// fakeGRPC serves the Embedder service from the vectors fakeEmbedding
+// derives, recording the headers of each call. Inputs named "bad" fail
+// with INVALID_ARGUMENT and the model "missing" with NOT_FOUND.
+type fakeGRPC struct {
+	// unimplemented lists the RPCs answered with UNIMPLEMENTED.
+	unimplemented map[string]bool
+
+	mu      sync.Mutex
+	paths   []string
+	headers []http.Header
+}
+
+func fakeEmbedding(input string) []float32 {
+	return []float32{float32(len(input)), 0.5, -0.25}
+}
+
+func (s *fakeGRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.paths = append(s.paths, r.URL.Path)
+	s.headers = append(s.headers, r.Header.Clone())
+	s.mu.Unlock()
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.ProtoMajor != 2 || r.Header.Get("Content-Type") != contentTypeGRPC || len(body) < 5 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+		http.Error(w, "not a gRPC call", http.StatusBadRequest)
+		return
+	}
+	msg := body[5:]
+	w.Header().Set("Content-Type", contentTypeGRPC)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	status := func(code int, message string) {
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", url.PathEscape(message))
+	}
+	send := func(m embedpb.Message) {
+		raw := m.Marshal()
+		frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(raw)))
+		w.Write(append(frame, raw...))
+		w.(http.Flusher).Flush()
+	}
+	if s.unimplemented[r.URL.Path] {
+		status(grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	switch r.URL.Path {
+	case embedpb.EmbedMethod, embedpb.EmbedStreamMethod:
+		var req embedpb.EmbedRequest
+		if err := req.Unmarshal(msg); err != nil {
+			status(grpcInvalidArgument, err.Error())
+			return
+		}
+		if req.Model == "missing" {
+			status(grpcNotFound, "no model named missing")
+			return
+		}
+		if r.URL.Path == embedpb.EmbedStreamMethod {
+			// Streamed in reverse, as a server finishing the later inputs
+			// first might.
+			for i := len(req.Inputs) - 1; i >= 0; i-- {
+				m := &embedpb.EmbedStreamResponse{Index: int32(i), Vector: fakeEmbedding(req.Inputs[i])}
+				if req.Inputs[i] == "bad" {
+					m.Vector, m.Error = nil, &embedpb.Status{Code: grpcInvalidArgument, Message: "bad input"}
+				}
+				send(m)
+			}
+			break
+		}
+		resp := &embedpb.EmbedResponse{Model: req.Model, ModelVersion: req.Model + "@2", Usage: &embedpb.Usage{PromptTokens: int32(len(req.Inputs)), TotalTokens: int32(len(req.Inputs))}}
+		for i, input := range req.Inputs {
+			if input == "bad" {
+				status(grpcInvalidArgument, "bad input")
+				return
+			}
+			// Inputs starting "long" are reported cut to the model's limit.
+			resp.Embeddings = append(resp.Embeddings, &embedpb.Embedding{Index: int32(i), Vector: fakeEmbedding(input), Truncated: strings.HasPrefix(input, "long")})
+		}
+		send(resp)
+	case embedpb.ListModelsMethod:
+		var req embedpb.ListModelsRequest
+		if err := req.Unmarshal(msg); err != nil {
+			status(grpcInvalidArgument, err.Error())
+			return
+		}
+		if req.Cursor == "" {
+			send(&embedpb.ListModelsResponse{Models: []*embedpb.Model{{Name: "alpha", Dimension: 3, Features: &embedpb.ModelFeatures{Normalization: true, Dtypes: []string{"float32"}}}}, NextCursor: "page-2"})
+		} else {
+			send(&embedpb.ListModelsResponse{Models: []*embedpb.Model{{Name: "beta", Dimension: 3, MaxInputTokens: 512}}})
+		}
+	case embedpb.CheckMethod:
+		send(&embedpb.HealthCheckResponse{Status: embedpb.HealthCheckResponse_SERVING})
+	default:
+		status(grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	status(grpcOK, "")
+}
+
+func (s *fakeGRPC) calls() ([]string, []http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...), append([]http.Header(nil), s.headers...)
+}
+
+// newGRPCClient starts a TLS server for s and returns a grpcs:// client of
+// it built with opts.
+func newGRPCClient(t *testing.T, s *fakeGRPC, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	c, err := NewClient("grpcs://"+srv.Listener.Addr().String(), append([]Option{WithTLSConfig(&tls.Config{RootCAs: pool})}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestGRPCCalls(t *testing.T) {
+	s := &fakeGRPC{}
+	sink := &recordingSink{}
+	c := newGRPCClient(t, s, WithAPIKey("grpc-key"), WithTranscriptRecorder(sink))
+	if got := c.Config().Transport; got != TransportGRPC {
+		t.Fatalf("grpcs:// endpoint picked transport %q", got)
+	}
+	ctx, cancel := context.WithTimeout(WithRequestID(context.Background(), "req-grpc"), time.Minute)
+	defer cancel()
+
+	vecs, err := c.EmbedBatch(ctx, []string{"a", "bcd"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][0] != 3 || vecs[1][2] != -0.25 {
+		t.Errorf("vectors %v", vecs)
+	}
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "alpha" || !models[0].Features.Normalization || models[1].MaxInputTokens != 512 {
+		t.Errorf("models %+v", models)
+	}
+	if ping, err := c.Ping(ctx); err != nil || !ping.OK {
+		t.Errorf("Ping: %+v, %v", ping, err)
+	}
+
+	paths, headers := s.calls()
+	want := []string{embedpb.EmbedMethod, embedpb.ListModelsMethod, embedpb.ListModelsMethod, embedpb.CheckMethod}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Fatalf("called %v, want %v", paths, want)
+	}
+	h := headers[0]
+	if got := h.Get("Authorization"); got != "Bearer grpc-key" {
+		t.Errorf("authorization %q", got)
+	}
+	if got := h.Get(RequestIDHeader); got != "req-grpc" {
+		t.Errorf("request ID %q", got)
+	}
+	if got := h.Get("Te"); got != "trailers" {
+		t.Errorf("te %q", got)
+	}
+	if got := h.Get("Grpc-Timeout"); !strings.HasSuffix(got, "u") && !strings.HasSuffix(got, "m") {
+		t.Errorf("grpc-timeout %q for a minute's deadline", got)
+	}
+	if got := h.Get("Accept"); got != "" {
+		t.Errorf("accept %q", got)
+	}
+
+	// The transcript records the proto messages as JSON envelopes.
+	var embedReq, embedResp struct {
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result"`
+	}
+	for i, e := range sink.entries {
+		if e.Direction == "request" && strings.Contains(string(e.Message), MethodEmbed) {
+			json.Unmarshal(e.Message, &embedReq)
+			json.Unmarshal(sink.entries[i+1].Message, &embedResp)
+			break
+		}
+	}
+	if got := string(embedReq.Params); got != `{"model":"`+c.Config().Model+`","inputs":["a","bcd"]}` {
+		t.Errorf("recorded params %s", got)
+	}
+	if !strings.Contains(string(embedResp.Result), `"embeddings":[{"index":0,"vector":[1,0.5,-0.25]}`) {
+		t.Errorf("recorded result %s", embedResp.Result)
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	c := newGRPCClient(t, &fakeGRPC{})
+	_, err := c.Embed(context.Background(), "x", WithModel("missing"))
+	if !errors.Is(err, ErrModelNotFound) || !strings.Contains(err.Error(), "no model named missing") {
+		t.Errorf("NOT_FOUND: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "bad"); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("INVALID_ARGUMENT: %v", err)
+	}
+	var rpc *RPCError
+	if err := c.Call(context.Background(), "mcp.jobs.submit", map[string]any{}, nil); !errors.As(err, &rpc) || rpc.Code != CodeMethodNotFound {
+		t.Errorf("a method without an RPC: %v", err)
+	}
+
+	for code, want := range map[int]int{
+		grpcInvalidArgument:   CodeInvalidParams,
+		grpcDeadlineExceeded:  CodeTimeout,
+		grpcPermissionDenied:  CodeUnauthorized,
+		grpcUnauthenticated:   CodeUnauthorized,
+		grpcResourceExhausted: CodePayloadTooLarge,
+		grpcUnavailable:       CodeInternalError,
+	} {
+		if got := grpcRPCError(code, "m"); got.Code != want || !strings.Contains(string(got.Data), `"grpc_status":`+strconv.Itoa(code)) {
+			t.Errorf("status %d: %+v", code, got)
+		}
+	}
+	if data := string(grpcRPCError(grpcUnavailable, "").Data); !strings.Contains(data, `"retryable":true`) {
+		t.Errorf("UNAVAILABLE is not retryable: %s", data)
+	}
+}
+
+func TestGRPCEmbedStream(t *testing.T) {
+	for name, s := range map[string]*fakeGRPC{
+		"streamed": {},
+		// Without EmbedStream the client falls back to Embed, which
+		// fails the whole batch over the bad input.
+		"fallback": {unimplemented: map[string]bool{embedpb.EmbedStreamMethod: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newGRPCClient(t, s)
+			results, err := c.EmbedStream(context.Background(), []string{"a", "bad", "cc"})
+			if err != nil {
+				t.Fatalf("EmbedStream: %v", err)
+			}
+			got := map[int]EmbedResult{}
+			for r := range results {
+				got[r.Index] = r
+			}
+			paths, _ := s.calls()
+			if name == "fallback" {
+				if len(paths) != 2 || paths[1] != embedpb.EmbedMethod {
+					t.Errorf("called %v", paths)
+				}
+				if r, ok := got[-1]; !ok || !errors.Is(r.Err, ErrInvalidParams) {
+					t.Errorf("results %+v", got)
+				}
+				return
+			}
+			if len(got) != 3 || got[0].Vector[0] != 1 || got[2].Vector[0] != 2 || !errors.Is(got[1].Err, ErrInvalidParams) {
+				t.Errorf("results %+v", got)
+			}
+		})
+	}
+}
+
+func TestGRPCTimeout(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		-time.Second:                       "1n",
+		1500 * time.Nanosecond:             "1500n",
+		100 * time.Millisecond:             "100000u",
+		time.Second:                        "1000000u",
+		2 * time.Minute:                    "120000m",
+		36 * time.Hour:                     "129600S",
+		10 * 365 * 24 * time.Hour:          "5256000M",
+		time.Duration(1<<63 - 1):           "2562048H",
+		time.Millisecond + time.Nanosecond: "1000001n",
+	} {
+		if got := grpcTimeout(d); got != want {
+			t.Errorf("grpcTimeout(%v) = %s, want %s", d, got, want)
+		}
+	}
+}
+
+func TestGRPCConfig(t *testing.T) {
+	base := ClientConfig{Transport: TransportGRPC}
+	if err := base.withDefaults().Validate(); err != nil {
+		t.Errorf("the default grpc config: %v", err)
+	}
+	for name, cfg := range map[string]ClientConfig{
+		"http scheme": {Transport: TransportGRPC, Endpoint: "http://127.0.0.1:50051"},
+		"no host":     {Transport: TransportGRPC, Endpoint: "grpc://"},
+		"openai":      {Transport: TransportGRPC, Endpoint: DefaultGRPCEndpoint, WireProtocol: OpenAICompat},
+		"signing":     {Transport: TransportGRPC, Endpoint: DefaultGRPCEndpoint, Signing: SigningConfig{KeyID: "k1", Secret: "s"}},
+		"wire dump":   {Transport: TransportGRPC, Endpoint: DefaultGRPCEndpoint, WireDump: io.Discard},
+	} {
+		if err := cfg.withDefaults().Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+	if ep, err := ParseEndpoint("grpcs://embed.example:443"); err != nil || ep.Transport != TransportGRPC {
+		t.Errorf("ParseEndpoint: %+v, %v", ep, err)
+	}
+}
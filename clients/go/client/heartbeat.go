@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHeartbeatFailures is how many consecutive failed heartbeats tear
+// the connections down when ClientConfig leaves HeartbeatFailures unset.
+const DefaultHeartbeatFailures = 3
+
+// heartbeat probes a transport that has been idle for an interval and resets
+// its connections after consecutive probe failures, so a connection silently
+// dropped by a middlebox is replaced before the next call blocks on it. The
+// probe loop starts with the first call and stops on close.
+type heartbeat struct {
+	interval    time.Duration
+	timeout     time.Duration
+	maxFailures int
+	probe       func(ctx context.Context) error
+	reset       func()
+
+	// lastUse is the unix-nano time the transport last carried a call.
+	lastUse  atomic.Int64
+	inflight atomic.Int64
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newHeartbeat returns nil when cfg leaves heartbeats disabled.
+func newHeartbeat(cfg ClientConfig, probe func(ctx context.Context) error, reset func()) *heartbeat {
+	if cfg.HeartbeatInterval <= 0 {
+		return nil
+	}
+	h := &heartbeat{
+		interval:    cfg.HeartbeatInterval,
+		timeout:     cfg.HeartbeatTimeout,
+		maxFailures: cfg.HeartbeatFailures,
+		probe:       probe,
+		reset:       reset,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if h.timeout <= 0 {
+		h.timeout = h.interval
+	}
+	if h.maxFailures <= 0 {
+		h.maxFailures = DefaultHeartbeatFailures
+	}
+	return h
+}
+
+// begin marks a call in flight and starts the probe loop on first use.
+func (h *heartbeat) begin() {
+	h.inflight.Add(1)
+	h.lastUse.Store(time.Now().UnixNano())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.started || h.closed {
+		return
+	}
+	h.started = true
+	go h.run()
+}
+
+// end marks a call finished.
+func (h *heartbeat) end() {
+	h.lastUse.Store(time.Now().UnixNano())
+	h.inflight.Add(-1)
+}
+
+func (h *heartbeat) run() {
+	defer close(h.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+		if h.inflight.Load() > 0 || time.Since(time.Unix(0, h.lastUse.Load())) < h.interval {
+			continue
+		}
+		probeCtx, probeCancel := context.WithTimeout(ctx, h.timeout)
+		err := h.probe(probeCtx)
+		probeCancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if failures++; failures >= h.maxFailures {
+			h.reset()
+			failures = 0
+		}
+	}
+}
+
+// close stops the probe loop and waits for it to exit.
+func (h *heartbeat) close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	started := h.started
+	close(h.stop)
+	h.mu.Unlock()
+	if started {
+		<-h.done
+	}
+}
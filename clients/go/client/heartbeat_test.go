@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pingCounter serves defaultHandler and counts heartbeat pings, which carry
+// negative IDs.
+func pingCounter(t *testing.T, pings *atomic.Int64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method == MethodPing && req.ID < 0 {
+			pings.Add(1)
+		}
+		_ = json.NewEncoder(w).Encode(defaultHandler(&req))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPHeartbeatPingsIdleConnection(t *testing.T) {
+	var pings atomic.Int64
+	srv := pingCounter(t, &pings)
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, HeartbeatInterval: 10 * time.Millisecond, Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	time.Sleep(50 * time.Millisecond)
+	if pings.Load() != 0 {
+		t.Fatal("heartbeat ran before the first call")
+	}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pings.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pings.Load() < 2 {
+		t.Fatalf("expected heartbeats on the idle connection, got %d", pings.Load())
+	}
+	if len(sink.entries) != 2 {
+		t.Fatalf("heartbeats must not be recorded; got %d entries", len(sink.entries))
+	}
+}
+
+func TestHeartbeatResetsAfterConsecutiveFailures(t *testing.T) {
+	var probes, resets atomic.Int64
+	h := newHeartbeat(ClientConfig{HeartbeatInterval: 5 * time.Millisecond, HeartbeatFailures: 2},
+		func(context.Context) error {
+			probes.Add(1)
+			return errors.New("connection reset")
+		},
+		func() { resets.Add(1) },
+	)
+	h.begin()
+	h.end()
+	deadline := time.Now().Add(2 * time.Second)
+	for resets.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	h.close()
+	if r, p := resets.Load(), probes.Load(); r < 2 || p < 2*r {
+		t.Fatalf("expected a reset per 2 failed probes, got %d resets for %d probes", r, p)
+	}
+}
+
+func TestHeartbeatCloseStopsProbeLoop(t *testing.T) {
+	probing := make(chan struct{})
+	h := newHeartbeat(ClientConfig{HeartbeatInterval: time.Millisecond, HeartbeatTimeout: time.Hour},
+		func(ctx context.Context) error {
+			select {
+			case probing <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		func() {},
+	)
+	h.begin()
+	h.end()
+	<-probing
+
+	closed := make(chan struct{})
+	go func() {
+		h.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("close did not interrupt a probe in flight")
+	}
+	select {
+	case <-h.done:
+	default:
+		t.Fatal("probe loop still running after close")
+	}
+	// Closing twice, or closing a heartbeat that never started, is safe.
+	h.close()
+	newHeartbeat(ClientConfig{HeartbeatInterval: time.Second}, nil, nil).close()
+}
+
+func TestHeartbeatDisabledByDefault(t *testing.T) {
+	if h := newHeartbeat(ClientConfig{}, nil, nil); h != nil {
+		t.Fatal("expected heartbeats to be off without an interval")
+	}
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultHedgeBudget caps the hedges of a HedgePolicy that leaves Budget
+// unset: at most one request in twenty is a hedge.
+const DefaultHedgeBudget = 0.05
+
+// hedgeMinSamples is how many answers a HedgePolicy with a Percentile waits
+// for before it trusts its latency estimate enough to hedge.
+const hedgeMinSamples = 20
+
+// HedgePolicy cuts tail latency by sending a second copy of a request that
+// has not been answered after a delay, and taking whichever copy answers
+// first; the other is canceled. Only replayable requests are hedged: those
+// of the idempotent methods, and those carrying an idempotency key. The copy
+// goes out under a fresh request ID but the same idempotency key, as a retry
+// does, and requests of the idempotent methods get a key for it to share.
+// With several endpoints, the copy of an idempotent method goes to the next
+// one in the failover list; other copies go to the same one, which can
+// deduplicate on the key. The zero value disables hedging.
+type HedgePolicy struct {
+	// Delay is how long a request waits for its answer before its hedge is
+	// sent.
+	Delay time.Duration
+	// Percentile, when Delay is zero, has the delay follow the latencies
+	// of the answered requests: 0.95 waits for their p95. No request is
+	// hedged before 20 have been answered.
+	Percentile float64
+	// Budget caps the hedges at this fraction of the requests that could
+	// be hedged, 0.1 allowing one hedge per ten of them. Zero selects
+	// DefaultHedgeBudget.
+	Budget float64
+}
+
+func (p HedgePolicy) enabled() bool { return p.Delay > 0 || p.Percentile > 0 }
+
+func (p HedgePolicy) validate() error {
+	if p.Delay < 0 || p.Budget < 0 {
+		return errors.New("hedging delay and budget must not be negative")
+	}
+	if p.Percentile < 0 || p.Percentile >= 1 {
+		return fmt.Errorf("hedging percentile must be in [0, 1), got %g", p.Percentile)
+	}
+	if p.Budget > 1 {
+		return fmt.Errorf("hedging budget must be at most 1, got %g", p.Budget)
+	}
+	return nil
+}
+
+// WithHedging sends a copy of each replayable request not answered within
+// delay and takes the first answer, sending at most budget hedges per such
+// request; see HedgePolicy. It overrides WithConfig's Hedging.
+func WithHedging(delay time.Duration, budget float64) Option {
+	return func(o *clientOptions) error {
+		p := HedgePolicy{Delay: delay, Budget: budget}
+		if delay <= 0 {
+			return fmt.Errorf("WithHedging: delay must be positive, got %v", delay)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("WithHedging: %w", err)
+		}
+		o.hedging = &p
+		return nil
+	}
+}
+
+// hedgeKey marks the ctx of a hedge, which a failover transport sends to
+// its next endpoint.
+type hedgeKey struct{}
+
+// isHedge reports whether ctx is that of a hedge bound for another
+// endpoint.
+func isHedge(ctx context.Context) bool {
+	return ctx.Value(hedgeKey{}) != nil
+}
+
+// hedger keeps the latency estimate and the budget of a HedgePolicy.
+type hedger struct {
+	policy HedgePolicy
+
+	mu       sync.Mutex
+	latency  latencyDigest
+	requests int64
+	hedges   int64
+}
+
+func newHedger(p HedgePolicy) *hedger {
+	if p.Budget == 0 {
+		p.Budget = DefaultHedgeBudget
+	}
+	return &hedger{policy: p}
+}
+
+// admit counts a request that could be hedged and returns how long it
+// waits before its hedge, or false while there is no estimate yet.
+func (h *hedger) admit() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests++
+	if h.policy.Delay > 0 {
+		return h.policy.Delay, true
+	}
+	if h.latency.n < hedgeMinSamples {
+		return 0, false
+	}
+	return h.latency.quantile(h.policy.Percentile), true
+}
+
+// spend reports whether the budget allows one more hedge, counting it if
+// so.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if float64(h.hedges+1) > h.policy.Budget*float64(h.requests) {
+		return false
+	}
+	h.hedges++
+	return true
+}
+
+// observe adds the latency of an answer to the estimate.
+func (h *hedger) observe(elapsed time.Duration) {
+	h.mu.Lock()
+	h.latency.add(elapsed)
+	h.mu.Unlock()
+}
+
+// hedgeAnswer is the outcome of one copy of a hedged request.
+type hedgeAnswer struct {
+	resp  *Response
+	err   error
+	hedge bool
+}
+
+// interceptHedge is the Interceptor applying ClientConfig.Hedging. It sends
+// req, and if no answer came within the policy's delay and the budget
+// allows, a copy of it; the first success is returned and the other copy
+// canceled. When both fail, the error of req is returned. A failure before
+// the delay is returned at once, for the retries to handle.
+func (c *Client) interceptHedge(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	h := c.hedger
+	if !replayable(req) || inRPCBatch(ctx) {
+		return next(ctx, req)
+	}
+	delay, ok := h.admit()
+	if !ok {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		if callError(resp, err) == nil {
+			h.observe(time.Since(start))
+		}
+		return resp, err
+	}
+	if req.Meta != nil && req.Meta.IdempotencyKey == "" {
+		keyed, meta := *req, *req.Meta
+		meta.IdempotencyKey = newIdempotencyKey()
+		keyed.Meta = &meta
+		req = &keyed
+	}
+
+	answers := make(chan hedgeAnswer, 2)
+	send := func(ctx context.Context, req *Request, hedge bool) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		if callError(resp, err) == nil {
+			h.observe(time.Since(start))
+		}
+		answers <- hedgeAnswer{resp: resp, err: err, hedge: hedge}
+	}
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go send(primaryCtx, req, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	var failed *hedgeAnswer
+	for {
+		select {
+		case <-timer.C:
+			if !h.spend() {
+				continue
+			}
+			hedgeCtx := ctx
+			if replayableMethods[req.Method] {
+				hedgeCtx = context.WithValue(ctx, hedgeKey{}, true)
+			}
+			hedgeCtx, cancelHedge := context.WithCancel(hedgeCtx)
+			defer cancelHedge()
+			hedge := c.renumber(req)
+			c.metrics.hedged(req.Method)
+			c.log.DebugContext(ctx, "hedging request", "method", req.Method, "rpc_id", req.ID, "hedge_rpc_id", hedge.ID, "delay", delay)
+			go send(hedgeCtx, hedge, true)
+			pending++
+		case a := <-answers:
+			pending--
+			if callError(a.resp, a.err) == nil {
+				if a.hedge {
+					c.metrics.hedgeWon(req.Method)
+				}
+				return a.resp, a.err
+			}
+			if failed == nil || !a.hedge {
+				failed = &a
+			}
+			if pending == 0 {
+				return failed.resp, failed.err
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallStub answers as defaultHandler does, but holds the requests for
+// which stall says so until their ctx ends, recording every request and
+// how many were canceled.
+type stallStub struct {
+	kind     string
+	stall    func(n int64, req *Request) bool
+	calls    atomic.Int64
+	canceled atomic.Int64
+
+	mu   sync.Mutex
+	sent []*Request
+}
+
+func (s *stallStub) Kind() string { return s.kind }
+func (s *stallStub) Close() error { return nil }
+func (s *stallStub) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	n := s.calls.Add(1)
+	s.mu.Lock()
+	s.sent = append(s.sent, req)
+	s.mu.Unlock()
+	if s.stall(n, req) {
+		<-ctx.Done()
+		s.canceled.Add(1)
+		return nil, ctx.Err()
+	}
+	return defaultHandler(req), nil
+}
+
+func (s *stallStub) requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.sent...)
+}
+
+// waitCanceled waits for the stub to have seen n requests canceled.
+func (s *stallStub) waitCanceled(t *testing.T, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.canceled.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests canceled, want %d", s.canceled.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgeWins(t *testing.T) {
+	ctx := context.Background()
+	// The first request stalls; its hedge answers.
+	stub := &stallStub{kind: "stub", stall: func(n int64, _ *Request) bool { return n == 1 }}
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: 5 * time.Millisecond, Budget: 1}}, stub)
+
+	v, err := c.Embed(ctx, "abc")
+	if err != nil || v[0] != 3 {
+		t.Fatalf("Embed: %v, %v", v, err)
+	}
+	stub.waitCanceled(t, 1)
+	sent := stub.requests()
+	if len(sent) != 2 {
+		t.Fatalf("%d requests sent, want the request and its hedge", len(sent))
+	}
+	first, hedge := sent[0], sent[1]
+	if first.ID == hedge.ID || first.Meta.RequestID != hedge.Meta.RequestID {
+		t.Fatalf("hedge sent as rpc %d of call %s, request as rpc %d of call %s", hedge.ID, hedge.Meta.RequestID, first.ID, first.Meta.RequestID)
+	}
+	if key := first.Meta.IdempotencyKey; key == "" || hedge.Meta.IdempotencyKey != key {
+		t.Fatalf("idempotency keys %q and %q, want one shared key", key, hedge.Meta.IdempotencyKey)
+	}
+	if s := c.Stats(); s.Hedges != 1 || s.HedgeWins != 1 {
+		t.Fatalf("%d hedges, %d wins", s.Hedges, s.HedgeWins)
+	}
+
+	// A request answering in time is not hedged.
+	if _, err := c.Embed(ctx, "abcd"); err != nil || stub.calls.Load() != 3 {
+		t.Fatalf("Embed: %v after %d requests", err, stub.calls.Load())
+	}
+}
+
+func TestHedgeLoses(t *testing.T) {
+	// The request answers after its hedge was sent, which then stalls.
+	release := make(chan struct{})
+	stub := &stallStub{kind: "stub", stall: func(n int64, _ *Request) bool {
+		if n == 1 {
+			<-release
+			return false
+		}
+		close(release)
+		return true
+	}}
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: 5 * time.Millisecond, Budget: 1}}, stub)
+	if _, err := c.Embed(context.Background(), "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	stub.waitCanceled(t, 1)
+	if s := c.Stats(); s.Hedges != 1 || s.HedgeWins != 0 {
+		t.Fatalf("%d hedges, %d wins", s.Hedges, s.HedgeWins)
+	}
+}
+
+func TestHedgeBudget(t *testing.T) {
+	// The first copy of each call stalls and its hedge answers.
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	stub := &stallStub{kind: "stub", stall: func(_ int64, req *Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		first := !seen[req.Meta.RequestID]
+		seen[req.Meta.RequestID] = true
+		return first
+	}}
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: time.Millisecond, Budget: 0.1}}, stub)
+	for i := 0; i < 20; i++ {
+		// A call the budget does not hedge waits for its deadline.
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, _ = c.Embed(ctx, "abc")
+		cancel()
+	}
+	if s := c.Stats(); s.Hedges != 2 || s.HedgeWins != 2 {
+		t.Fatalf("%d hedges, %d wins, want 2 of 20 requests", s.Hedges, s.HedgeWins)
+	}
+}
+
+func TestHedgeNeedsReplayable(t *testing.T) {
+	stub := &stallStub{kind: "stub", stall: func(n int64, _ *Request) bool { return n == 1 }}
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: time.Millisecond, Budget: 1}}, stub)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// A method that is not idempotent is hedged under its idempotency key.
+	var tokens struct{ Tokens int }
+	if err := c.Call(ctx, MethodCountTokens, map[string]string{"input": "a b"}, &tokens, WithIdempotencyKey("k")); err != nil || tokens.Tokens != 2 {
+		t.Fatalf("Call: %+v, %v", tokens, err)
+	}
+	if got := stub.requests(); len(got) != 2 || got[1].Meta.IdempotencyKey != "k" {
+		t.Fatalf("%d requests sent for a keyed call", len(got))
+	}
+
+	// Without one, the request is not replayable and never hedged.
+	stub = &stallStub{kind: "stub", stall: func(int64, *Request) bool { return true }}
+	c = NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: time.Millisecond, Budget: 1}}, stub)
+	req, err := newRequest(1, MethodCountTokens, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.interceptHedge(ctx, req, stub.RoundTrip); !errors.Is(err, context.DeadlineExceeded) || stub.calls.Load() != 1 {
+		t.Fatalf("got %v after %d requests, want one request timing out", err, stub.calls.Load())
+	}
+	if s := c.Stats(); s.Hedges != 0 {
+		t.Fatalf("%d hedges of a request without a key", s.Hedges)
+	}
+}
+
+func TestHedgeAdaptiveDelay(t *testing.T) {
+	var stalling atomic.Bool
+	stub := &stallStub{kind: "stub", stall: func(n int64, _ *Request) bool { return stalling.Load() && n%2 == 1 }}
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Percentile: 0.95, Budget: 1}}, stub)
+	ctx := context.Background()
+	for i := 0; i < hedgeMinSamples; i++ {
+		if _, err := c.Embed(ctx, "abc"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	if s := c.Stats(); s.Hedges != 0 {
+		t.Fatalf("%d hedges before the latency estimate", s.Hedges)
+	}
+	// With the estimate a stalled request is hedged after about the p95 of
+	// the fast answers.
+	stalling.Store(true)
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if _, err := c.Embed(callCtx, "abcd"); err != nil {
+		t.Fatalf("Embed of a stalled request: %v", err)
+	}
+	if s := c.Stats(); s.Hedges != 1 || s.HedgeWins != 1 {
+		t.Fatalf("%d hedges, %d wins", s.Hedges, s.HedgeWins)
+	}
+}
+
+func TestHedgeGoesToNextEndpoint(t *testing.T) {
+	primary := &stallStub{kind: "primary", stall: func(int64, *Request) bool { return true }}
+	backup := &stallStub{kind: "backup", stall: func(int64, *Request) bool { return false }}
+	var events []FailoverEvent
+	ft := newFailoverTransport([]*failoverMember{
+		{label: "primary://stub", transport: primary},
+		{label: "backup://stub", transport: backup},
+	}, time.Minute, func(ev FailoverEvent) { events = append(events, ev) })
+	c := NewWithTransport(ClientConfig{Hedging: HedgePolicy{Delay: 5 * time.Millisecond, Budget: 1}}, ft)
+
+	if _, err := c.Embed(context.Background(), "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	primary.waitCanceled(t, 1)
+	if primary.calls.Load() != 1 || backup.calls.Load() != 1 {
+		t.Fatalf("primary got %d requests, backup %d", primary.calls.Load(), backup.calls.Load())
+	}
+	// A hedge winning on the backup leaves the primary active.
+	if ft.endpointLabel() != "primary://stub" || len(events) != 0 {
+		t.Fatalf("active endpoint %s after failovers %v", ft.endpointLabel(), events)
+	}
+}
+
+func TestHedgingValidation(t *testing.T) {
+	for _, p := range []HedgePolicy{
+		{Delay: -time.Second},
+		{Delay: time.Second, Budget: -0.1},
+		{Delay: time.Second, Budget: 1.5},
+		{Percentile: 1},
+	} {
+		if err := (ClientConfig{Hedging: p}).Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", p)
+		}
+	}
+	if _, err := NewClient("", WithTransport(TransportInProc), WithHedging(0, 0.1)); err == nil {
+		t.Error("WithHedging accepted a zero delay")
+	}
+}
@@ -0,0 +1,730 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxErrorBody bounds how much of a non-2xx response body is quoted in errors.
+const maxErrorBody = 4 << 10
+
+// contentTypeNDJSON is the media type of streamed http responses.
+const contentTypeNDJSON = "application/x-ndjson"
+
+// httpTransport posts each envelope to the endpoint and decodes the JSON
+// response body. It backs the http, tls, and http3 transports; they only
+// differ in their scheme, TLS configuration, and round tripper. The grpc
+// transport posts its RPCs through one too.
+type httpTransport struct {
+	kind     string
+	endpoint string
+	apiKey   Secret
+	creds    *credentialFiles
+	client   *http.Client
+	timeouts timeouts
+	codecs   contentCodecs
+	// maxResponse is ClientConfig.MaxResponseBytes.
+	maxResponse int
+	// h3 is set for the http3 transport only.
+	h3 *h3RoundTripper
+	// hb is nil unless heartbeats are enabled.
+	hb *heartbeat
+	// probeID numbers heartbeat pings downward from -1 so they never collide
+	// with client request IDs.
+	probeID atomic.Int64
+	// bare sends the pings of a JSONRPC2 client without Meta.
+	bare bool
+	// label is the endpoint label of the connection events.
+	label string
+	// events, when set, learns of the connections requests get and of the
+	// pooled ones closing.
+	events atomic.Pointer[transportEvents]
+	// quicUsed records that a request went over the HTTP/3 round tripper,
+	// whose connections net/http cannot trace.
+	quicUsed atomic.Bool
+	// codec is the codec Initialize negotiated, nil for JSON.
+	codec atomic.Pointer[wireCodec]
+	// dns is nil unless ClientConfig.DNS resolves the endpoint's name.
+	dns *dnsResolver
+}
+
+// wireCodec is a negotiated Codec and its media type.
+type wireCodec struct {
+	Codec
+	mediaType string
+}
+
+func (t *httpTransport) setCodec(codec Codec) {
+	if codec.Name() == CodecJSON {
+		t.codec.Store(nil)
+		return
+	}
+	t.codec.Store(&wireCodec{Codec: codec, mediaType: codec.ContentType()})
+}
+
+func (t *httpTransport) observe(ev *transportEvents) { t.events.Store(ev) }
+
+// addresses reports the addresses ClientConfig.DNS resolved the endpoint's
+// name to, nil without it.
+func (t *httpTransport) addresses() map[string][]string { return t.dns.addressMap() }
+
+// watch returns conn reporting its close to the observer, if any.
+func (t *httpTransport) watch(conn net.Conn) net.Conn {
+	ev := t.events.Load()
+	if ev == nil {
+		return conn
+	}
+	return &watchedConn{Conn: conn, report: func(reason error) {
+		ev.disconnect(DisconnectEvent{Transport: t.kind, Endpoint: t.label, Reason: reason})
+	}}
+}
+
+func newHTTPTransport(cfg ClientConfig) (*httpTransport, error) {
+	to := cfg.timeouts()
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		u, err := parseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+	// Where no ping can be sent on a connection (between requests on an idle
+	// pooled socket) TCP keepalive covers it at the heartbeat cadence.
+	var dialer contextDialer = &net.Dialer{KeepAlive: cfg.HeartbeatInterval}
+	log := cfg.logger()
+	dump := cfg.wireDump()
+	var t *httpTransport
+	var dns *dnsResolver
+	if cfg.Transport != TransportHTTP3 {
+		dns = newDNSResolver(cfg, dialer, func() { t.client.CloseIdleConnections() }, func() *transportEvents { return t.events.Load() })
+	}
+	if dns != nil {
+		dialer = dns
+	}
+	base := &http.Transport{
+		ForceAttemptHTTP2: true,
+		// Content codings are negotiated and decoded by contentCodecs.
+		DisableCompression:    true,
+		Proxy:                 proxy,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		TLSHandshakeTimeout:   to.dial,
+		ResponseHeaderTimeout: to.read,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialTCP(ctx, dialer, network, addr, to, log)
+			if err != nil {
+				return nil, err
+			}
+			if dump != nil && cfg.Transport == TransportHTTP {
+				conn = dump.wrapConn(conn, addr)
+			}
+			return t.watch(conn), nil
+		},
+	}
+	codecs := newContentCodecs(cfg)
+	grpcTLS := false
+	if cfg.Transport == TransportGRPC {
+		// gRPC compresses messages, not bodies, and only over HTTP/2.
+		codecs = contentCodecs{}
+		if _, grpcTLS = grpcBase(cfg.Endpoint); !grpcTLS {
+			if err := enableH2C(base); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t = &httpTransport{
+		kind:     cfg.Transport,
+		endpoint: cfg.Endpoint,
+		label:    cfg.endpointLabel(),
+		apiKey:   cfg.APIKey,
+		creds:    cfg.creds,
+		client:   &http.Client{Transport: base},
+		timeouts: to,
+		codecs:   codecs,
+
+		maxResponse: cfg.MaxResponseBytes,
+		bare:        cfg.WireProtocol == JSONRPC2,
+		dns:         dns,
+	}
+	if cfg.Transport == TransportTLS || cfg.Transport == TransportHTTP3 || grpcTLS {
+		tc, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = tc
+		if dump != nil {
+			base.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialTLSDumped(ctx, dialer, network, addr, tc, to, log, dump)
+				if err != nil {
+					return nil, err
+				}
+				return t.watch(conn), nil
+			}
+		}
+		if cfg.Transport == TransportHTTP3 {
+			t.h3 = newH3RoundTripper(cfg, tc, base)
+			t.client.Transport = t.h3
+		}
+	}
+	t.hb = newHeartbeat(cfg, t.ping, t.client.CloseIdleConnections)
+	return t, nil
+}
+
+// parseProxyURL validates an explicit proxy URL. net/http tunnels https
+// requests through http(s) proxies with CONNECT and speaks SOCKS5 itself.
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy url must use http://, https://, or socks5://, got %q", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// dialTCP dials addr within the dial timeout, logging the attempt to log,
+// and applies the write timeout to every write on the resulting connection.
+func dialTCP(ctx context.Context, d contextDialer, network, addr string, to timeouts, log *slog.Logger) (net.Conn, error) {
+	dialCtx := ctx
+	if to.dial > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, to.dial)
+		defer cancel()
+	}
+	start := time.Now()
+	conn, err := d.DialContext(dialCtx, network, addr)
+	logDial(ctx, log, addr, start, err)
+	if err != nil {
+		return nil, dialTimeoutError(ctx, dialCtx, err, to.dial)
+	}
+	if to.write > 0 {
+		conn = &writeDeadlineConn{Conn: conn, timeout: to.write}
+	}
+	return conn, nil
+}
+
+// dialTLSDumped dials addr and completes the TLS handshake itself, so the
+// wire dump sees the bytes inside TLS. HTTP/2 needs the *tls.Conn the dump
+// hides from net/http, so only HTTP/1.1 is offered.
+func dialTLSDumped(ctx context.Context, d contextDialer, network, addr string, tc *tls.Config, to timeouts, log *slog.Logger, dump *wireDump) (net.Conn, error) {
+	raw, err := dialTCP(ctx, d, network, addr, to, log)
+	if err != nil {
+		return nil, err
+	}
+	tc = tc.Clone()
+	tc.NextProtos = []string{"http/1.1"}
+	if tc.ServerName == "" {
+		tc.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	conn := tls.Client(raw, tc)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return dump.wrapConn(conn, addr), nil
+}
+
+// writeDeadlineConn arms a fresh write deadline before each Write and reports
+// expiry as ErrWriteTimeout.
+type writeDeadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *writeDeadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(b)
+	if err != nil && isTimeout(err) {
+		err = fmt.Errorf("%w after %s: %w", ErrWriteTimeout, c.timeout, err)
+	}
+	return n, err
+}
+
+// classifyTimeout maps expiry of a configured timeout inside net/http to the
+// matching timeout class. Errors caused by ctx itself are left alone.
+func (t *httpTransport) classifyTimeout(ctx context.Context, err error) error {
+	if ctx.Err() != nil || errors.Is(err, ErrDialTimeout) || errors.Is(err, ErrWriteTimeout) {
+		return err
+	}
+	if strings.Contains(err.Error(), "TLS handshake timeout") {
+		return fmt.Errorf("%w after %s: %w", ErrDialTimeout, t.timeouts.dial, err)
+	}
+	if t.timeouts.read > 0 && isTimeout(err) {
+		return fmt.Errorf("%w after %s: %w", ErrReadTimeout, t.timeouts.read, err)
+	}
+	return err
+}
+
+func (t *httpTransport) Kind() string { return t.kind }
+
+// protocol reports the HTTP version negotiated by the http3 transport, which
+// differs from the configured one after falling back. It is empty for the
+// other transports.
+func (t *httpTransport) protocol() string {
+	if t.h3 == nil {
+		return ""
+	}
+	return t.h3.protocol()
+}
+
+func (t *httpTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if t.hb != nil {
+		t.hb.begin()
+		defer t.hb.end()
+	}
+	return t.do(ctx, req)
+}
+
+// ping sends an unrecorded heartbeat. Any answer, even an RPC error, proves
+// the connection is alive.
+func (t *httpTransport) ping(ctx context.Context) error {
+	req, err := newRequest(-t.probeID.Add(1), MethodPing, nil, time.Now())
+	if err != nil {
+		return err
+	}
+	req.bare = t.bare
+	_, err = t.do(ctx, req)
+	return err
+}
+
+func (t *httpTransport) do(ctx context.Context, req *Request) (*Response, error) {
+	accept := "application/json"
+	if wc := t.codec.Load(); wc != nil {
+		body, err := wc.Marshal(req.Wire())
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		carrier := *req
+		carrier.body, carrier.mediaType = body, wc.mediaType
+		req = &carrier
+		if signed, ok := contextSignedRequest(ctx); ok {
+			ctx = context.WithValue(ctx, signedRequestKey{}, signed.withBody(body))
+		}
+		// An error the server answers before reading the body may be JSON.
+		accept = wc.mediaType + ", application/json"
+	}
+	httpResp, err := t.send(ctx, req, accept)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := t.readResponse(ctx, httpResp)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(httpResp, payload, req.ID)
+}
+
+// readResponse reads and closes the body of httpResp, within the read
+// timeout and the response limit, and verifies its signature.
+func (t *httpTransport) readResponse(ctx context.Context, httpResp *http.Response) ([]byte, error) {
+	defer httpResp.Body.Close()
+	body := t.watchBody(httpResp)
+	defer body.stop()
+
+	decoded, err := t.codecs.decodeResponse(httpResp.Header.Get("Content-Encoding"), httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s read response: %w", t.kind, err)
+	}
+	defer decoded.Close()
+	payload, err := readLimited(decoded, responseLimit(ctx, t.maxResponse))
+	if err != nil {
+		return nil, readFailure(fmt.Errorf("%s read response: %w", t.kind, body.classify(err)), int64(len(payload)))
+	}
+	if err := t.verify(ctx, httpResp, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// RoundTripStream asks for an NDJSON response and passes each line to
+// handle as it arrives; the read timeout applies to each line. A server that
+// answers with a single JSON document yields a single frame.
+func (t *httpTransport) RoundTripStream(ctx context.Context, req *Request, handle frameHandler) error {
+	if t.hb != nil {
+		t.hb.begin()
+		defer t.hb.end()
+	}
+	httpResp, err := t.send(ctx, req, contentTypeNDJSON+", application/json")
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	body := t.watchBody(httpResp)
+	defer body.stop()
+
+	decoded, err := t.codecs.decodeResponse(httpResp.Header.Get("Content-Encoding"), httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("%s read response: %w", t.kind, err)
+	}
+	defer decoded.Close()
+	if !strings.HasPrefix(httpResp.Header.Get("Content-Type"), contentTypeNDJSON) {
+		payload, err := readLimited(decoded, responseLimit(ctx, t.maxResponse))
+		if err != nil {
+			return readFailure(fmt.Errorf("%s read response: %w", t.kind, body.classify(err)), int64(len(payload)))
+		}
+		if err := t.verify(ctx, httpResp, payload); err != nil {
+			return err
+		}
+		resp, err := t.decode(httpResp, payload, req.ID)
+		if err != nil {
+			return err
+		}
+		more, err := handle(resp)
+		if err == nil && more {
+			err = fmt.Errorf("%s read stream: %w", t.kind, io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+
+	lines := newFraming(FramingNewline, DefaultMaxFrameSize)
+	budget := frameBudget{limit: responseLimit(ctx, t.maxResponse)}
+	counter := &countingReader{r: decoded}
+	reader := bufio.NewReader(counter)
+	for {
+		payload, err := budget.read(reader, lines)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return readFailure(fmt.Errorf("%s read stream: %w", t.kind, body.classify(err)), counter.n.Load())
+		}
+		resp, err := t.decode(httpResp, payload, req.ID)
+		if err != nil {
+			return err
+		}
+		more, err := handle(resp)
+		if err != nil || !more {
+			return err
+		}
+		body.reset()
+	}
+}
+
+// newRequest builds the verb request to target carrying req: a POST to the
+// endpoint but for the OpenAICompat adapter, and a GET without a body. The
+// body is read from a pooled buffer, so the caller must call release once
+// the request has been sent, and not before: the transport reads the body,
+// or a replay of it, until then.
+func (t *httpTransport) newRequest(ctx context.Context, verb, target string, req *Request, accept string) (httpReq *http.Request, release func(), err error) {
+	signed, ok := contextSignedRequest(ctx)
+	var body []byte
+	var frame *pooledFrame
+	switch {
+	case verb == http.MethodGet:
+	case ok:
+		body = signed.body
+	case req.body != nil:
+		body = req.body
+	default:
+		if frame, err = encodeFrame(req); err != nil {
+			return nil, nil, fmt.Errorf("encode request: %w", err)
+		}
+		body = frame.bytes()
+		defer func() {
+			if err != nil && frame != nil {
+				frame.release()
+			}
+		}()
+	}
+	body, contentEncoding, err := t.codecs.encodeRequest(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compress request: %w", err)
+	}
+	if contentEncoding != "" && frame != nil {
+		// The compressed copy is the body; the buffer is done with.
+		frame.release()
+		frame = nil
+	}
+	if frame == nil {
+		httpReq, err = http.NewRequestWithContext(ctx, verb, target, bytes.NewReader(body))
+		release = func() {}
+	} else if httpReq, err = http.NewRequestWithContext(ctx, verb, target, nil); err == nil {
+		httpReq.Body = frame.body()
+		httpReq.GetBody = frame.getBody
+		httpReq.ContentLength = int64(len(body))
+		release = frame.release
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("build %s request: %w", t.kind, err)
+	}
+	if verb != http.MethodGet {
+		contentType := "application/json"
+		if req.mediaType != "" {
+			contentType = req.mediaType
+		}
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	httpReq.Header.Set("Accept", accept)
+	httpReq.Header.Set("User-Agent", userAgent())
+	if t.codecs.acceptEncoding != "" {
+		httpReq.Header.Set("Accept-Encoding", t.codecs.acceptEncoding)
+	}
+	if auth, ok := contextAuthorization(ctx); ok {
+		httpReq.Header.Set("Authorization", auth)
+	} else if key := t.creds.apiKey(t.apiKey); key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+string(key))
+	}
+	if contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if req.Meta != nil && req.Meta.IdempotencyKey != "" {
+		httpReq.Header.Set(IdempotencyHeader, req.Meta.IdempotencyKey)
+	}
+	if req.Meta != nil && req.Meta.RequestID != "" {
+		httpReq.Header.Set(RequestIDHeader, req.Meta.RequestID)
+	}
+	if sc, traced := contextSpanContext(ctx); traced {
+		httpReq.Header.Set(TraceparentHeader, sc.traceparent())
+		if sc.TraceState != "" {
+			httpReq.Header.Set(TracestateHeader, sc.TraceState)
+		}
+	}
+	if ok {
+		for name, values := range signed.header {
+			httpReq.Header[name] = values
+		}
+	}
+	return httpReq, release, nil
+}
+
+// verify checks the signature of a response to a request signed by
+// interceptSign.
+func (t *httpTransport) verify(ctx context.Context, resp *http.Response, payload []byte) error {
+	signed, ok := contextSignedRequest(ctx)
+	if !ok {
+		return nil
+	}
+	if err := signed.verify(resp.Header, payload); err != nil {
+		return fmt.Errorf("%s response: %w", t.kind, err)
+	}
+	return nil
+}
+
+func (t *httpTransport) dryRunHeaders(ctx context.Context, req *Request) (http.Header, int, error) {
+	httpReq, release, err := t.newRequest(ctx, http.MethodPost, t.endpoint, req, "application/json")
+	if err != nil {
+		return nil, 0, err
+	}
+	httpReq.Body.Close()
+	release()
+	return httpReq.Header, int(httpReq.ContentLength), nil
+}
+
+// send posts req and returns the response once its status is known to be
+// 2xx. The caller must close the body.
+func (t *httpTransport) send(ctx context.Context, req *Request, accept string) (*http.Response, error) {
+	return t.sendTo(ctx, http.MethodPost, t.endpoint, req, accept)
+}
+
+// sendTo is send for a verb request to target; see newRequest.
+func (t *httpTransport) sendTo(ctx context.Context, verb, target string, req *Request, accept string) (*http.Response, error) {
+	ev := t.events.Load()
+	var traced atomic.Bool
+	if ev != nil {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				traced.Store(true)
+				connected := ConnectEvent{Transport: t.kind, Endpoint: t.label, Reused: info.Reused}
+				if tc, ok := info.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+					state := tc.ConnectionState()
+					connected.TLS = &state
+				}
+				ev.connect(connected)
+			},
+		})
+	}
+	if r, ok := ctx.Value(budgetRunKey{}).(*budgetRun); ok {
+		ctx = httptrace.WithClientTrace(ctx, r.trace())
+	}
+	httpReq, release, err := t.newRequest(ctx, verb, target, req, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	httpResp, err := t.client.Do(httpReq)
+	if err == nil && ev != nil && !traced.Load() && t.h3 != nil {
+		// HTTP/3 connections are the QUIC stack's, so the first request
+		// over it stands for the connection.
+		reused := t.quicUsed.Swap(true)
+		ev.connect(ConnectEvent{Transport: t.kind, Endpoint: t.label, TLS: httpResp.TLS, Reused: reused})
+	}
+	if err != nil {
+		err = t.classifyTimeout(ctx, err)
+		if t.kind != TransportHTTP {
+			err = classifyTLSError(err)
+		}
+		return nil, fmt.Errorf("%s request: %w", t.kind, err)
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		defer httpResp.Body.Close()
+		snippet, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBody))
+		return nil, fmt.Errorf("%s request: %w", t.kind, statusAPIError(httpResp, snippet))
+	}
+	return httpResp, nil
+}
+
+// decode parses one response envelope of httpResp, in the codec its
+// Content-Type names, and checks that it answers id. An error without an
+// ID, which a server sends when it could not read the request's, answers
+// the one request of the POST.
+func (t *httpTransport) decode(httpResp *http.Response, payload []byte, id int64) (*Response, error) {
+	var resp Response
+	if err := decodeResponse(codecFor(httpResp.Header.Get("Content-Type")), payload, &resp); err != nil {
+		return nil, fmt.Errorf("%s decode response: %w: %w", t.kind, ErrProtocol, err)
+	}
+	if resp.ID != id && (resp.ID != 0 || resp.Error == nil) {
+		return nil, fmt.Errorf("%s response id %d does not match request id %d: %w", t.kind, resp.ID, id, ErrProtocol)
+	}
+	resp.ServerRequestID = httpResp.Header.Get(RequestIDHeader)
+	return &resp, nil
+}
+
+// notify posts a notification. The server answers with any 2xx status and
+// a body, if any, that is discarded.
+func (t *httpTransport) notify(ctx context.Context, payload []byte) error {
+	httpResp, err := t.send(ctx, &Request{body: payload}, "application/json")
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(httpResp.Body, maxErrorBody))
+	return httpResp.Body.Close()
+}
+
+// roundTripBatch posts reqs as an array and reads the array of responses
+// answering them, in any order. The POST carries the headers of the first
+// request but no idempotency key, which names a single request.
+func (t *httpTransport) roundTripBatch(ctx context.Context, reqs []*Request) (map[int64]*Response, error) {
+	if t.hb != nil {
+		t.hb.begin()
+		defer t.hb.end()
+	}
+	var body bytes.Buffer
+	body.WriteByte('[')
+	for i, req := range reqs {
+		raw, err := json.Marshal(req.Wire())
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(raw)
+	}
+	body.WriteByte(']')
+	carrier := &Request{Method: reqs[0].Method, body: body.Bytes()}
+	if meta := reqs[0].Meta; meta != nil {
+		carrier.Meta = &Meta{RequestID: meta.RequestID}
+	}
+	httpResp, err := t.send(ctx, carrier, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := t.readResponse(ctx, httpResp)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '{' {
+		// A single response rejects the batch as a whole.
+		resp, err := t.decode(httpResp, payload, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error == nil {
+			return nil, fmt.Errorf("%s batch answered by a single result: %w", t.kind, ErrProtocol)
+		}
+		return nil, rpcAPIError(resp.Error)
+	}
+	var resps []*Response
+	if err := json.Unmarshal(payload, &resps); err != nil {
+		return nil, fmt.Errorf("%s decode batch response: %w: %w", t.kind, ErrProtocol, err)
+	}
+	byID := make(map[int64]*Response, len(resps))
+	for _, resp := range resps {
+		if resp != nil {
+			resp.ServerRequestID = httpResp.Header.Get(RequestIDHeader)
+			byID[resp.ID] = resp
+		}
+	}
+	return byID, nil
+}
+
+// bodyWatch closes a response body that goes a read timeout without
+// completing. ResponseHeaderTimeout only covers the headers, so the body
+// gets a ReadTimeout budget of its own.
+type bodyWatch struct {
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func (t *httpTransport) watchBody(resp *http.Response) *bodyWatch {
+	w := &bodyWatch{timeout: t.timeouts.read}
+	if w.timeout > 0 {
+		w.timer = time.AfterFunc(w.timeout, func() {
+			w.timedOut.Store(true)
+			resp.Body.Close()
+		})
+	}
+	return w
+}
+
+// reset grants a fresh budget, for example after each streamed frame.
+func (w *bodyWatch) reset() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *bodyWatch) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// classify marks a read error caused by the watch as ErrReadTimeout.
+func (w *bodyWatch) classify(err error) error {
+	if w.timedOut.Load() {
+		return fmt.Errorf("%w after %s: %w", ErrReadTimeout, w.timeout, err)
+	}
+	return err
+}
+
+func (t *httpTransport) Close() error {
+	if t.hb != nil {
+		t.hb.close()
+	}
+	t.dns.close()
+	t.client.CloseIdleConnections()
+	if t.h3 != nil {
+		t.h3.close()
+	}
+	if ev := t.events.Load(); ev != nil && t.quicUsed.Swap(false) {
+		ev.disconnect(DisconnectEvent{Transport: t.kind, Endpoint: t.label})
+	}
+	return nil
+}
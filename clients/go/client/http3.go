@@ -0,0 +1,114 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// TransportHTTP3 is the experimental HTTP/3 transport. The client does not
+// bundle a QUIC stack; ClientConfig.HTTP3RoundTripper supplies one, such as
+// that of the clients/go/embedhttp3 module.
+const TransportHTTP3 = "http3"
+
+// ErrHTTP3Unavailable marks an HTTP/3 round trip that failed before a
+// connection was established: the QUIC handshake failed or timed out, or
+// the server did not negotiate h3 by ALPN. An HTTP3RoundTripper wraps it in
+// those errors, and only those fall back to HTTP/2 under AllowFallback.
+var ErrHTTP3Unavailable = errors.New("http3 unavailable")
+
+// h3RoundTripper sends requests over HTTP/3 and, when fallback is allowed,
+// switches to HTTP/2 over TCP the first time HTTP/3 cannot be established.
+// Once fallen back it stays on HTTP/2 for the transport's lifetime; errors
+// on an established connection are returned as they are.
+type h3RoundTripper struct {
+	h3       http.RoundTripper
+	h2       *http.Transport
+	fallback bool
+
+	mu       sync.Mutex
+	fellBack bool
+	proto    string
+}
+
+func newH3RoundTripper(cfg ClientConfig, tc *tls.Config, h2 *http.Transport) *h3RoundTripper {
+	rt := &h3RoundTripper{h2: h2, fallback: cfg.AllowFallback}
+	if cfg.HTTP3RoundTripper != nil {
+		rt.h3 = cfg.HTTP3RoundTripper(tc.Clone())
+	}
+	return rt
+}
+
+func (rt *h3RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	useH2 := rt.fellBack
+	rt.mu.Unlock()
+	// Without a QUIC round tripper Validate has ensured fallback is allowed.
+	if !useH2 && rt.h3 != nil {
+		resp, err := rt.h3.RoundTrip(req)
+		if err == nil {
+			rt.negotiated(resp.Proto, false)
+			return resp, nil
+		}
+		// A cancelled caller does not fall back.
+		if !rt.fallback || !errors.Is(err, ErrHTTP3Unavailable) || req.Context().Err() != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := rt.h2.RoundTrip(req)
+	if err == nil {
+		rt.negotiated(resp.Proto, true)
+	}
+	return resp, err
+}
+
+// rewind returns a copy of req with a fresh body for resending.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be resent over http/2")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("rewind request body: %w", err)
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+func (rt *h3RoundTripper) negotiated(proto string, fellBack bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.proto = proto
+	if fellBack {
+		rt.fellBack = true
+	}
+}
+
+// protocol reports the HTTP version of the most recent response.
+func (rt *h3RoundTripper) protocol() string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.proto
+}
+
+func (rt *h3RoundTripper) CloseIdleConnections() {
+	if c, ok := rt.h3.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+	rt.h2.CloseIdleConnections()
+}
+
+// close closes the QUIC round tripper if it is an io.Closer, releasing its
+// socket along with its connections.
+func (rt *h3RoundTripper) close() {
+	if c, ok := rt.h3.(io.Closer); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeH3 stands in for a QUIC round tripper. It relays requests through an
+// HTTP/2 transport built from the TLS config it was given, reporting them as
+// HTTP/3, or fails every request with err.
+type fakeH3 struct {
+	calls atomic.Int64
+	err   error
+	relay *http.Transport
+}
+
+func (f *fakeH3) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	resp, err := f.relay.RoundTrip(req)
+	if err == nil {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/3.0", 3, 0
+	}
+	return resp, err
+}
+
+func newH2Server(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(httpHandler(defaultHandler))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return srv, roots
+}
+
+func runHTTP3(t *testing.T, cfg ClientConfig) transcriptFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "http3.json")
+	if err := Run(context.Background(), Options{Config: cfg, RecordTranscript: path}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("decode transcript: %v", err)
+	}
+	return doc
+}
+
+func TestHTTP3RecordsNegotiatedProtocol(t *testing.T) {
+	srv, roots := newH2Server(t)
+	h3 := &fakeH3{}
+	doc := runHTTP3(t, ClientConfig{
+		Transport: TransportHTTP3,
+		Endpoint:  srv.URL,
+		TLSConfig: &tls.Config{RootCAs: roots},
+		HTTP3RoundTripper: func(tc *tls.Config) http.RoundTripper {
+			// The TLS settings reach the QUIC stack.
+			h3.relay = &http.Transport{TLSClientConfig: tc, ForceAttemptHTTP2: true}
+			return h3
+		},
+	})
+	if doc.Transport != TransportHTTP3 || doc.Protocol != "HTTP/3.0" {
+		t.Fatalf("expected an http3 transcript over HTTP/3.0, got transport=%q protocol=%q", doc.Transport, doc.Protocol)
+	}
+	if h3.calls.Load() != 3 {
+		t.Fatalf("expected 3 HTTP/3 round trips, got %d", h3.calls.Load())
+	}
+}
+
+func TestHTTP3FallsBackToHTTP2(t *testing.T) {
+	srv, roots := newH2Server(t)
+	h3 := &fakeH3{err: fmt.Errorf("%w: CRYPTO_ERROR 0x178 (remote): tls: no application protocol", ErrHTTP3Unavailable)}
+	doc := runHTTP3(t, ClientConfig{
+		Transport:         TransportHTTP3,
+		Endpoint:          srv.URL,
+		TLSConfig:         &tls.Config{RootCAs: roots},
+		HTTP3RoundTripper: func(*tls.Config) http.RoundTripper { return h3 },
+		AllowFallback:     true,
+	})
+	if doc.Protocol != "HTTP/2.0" || len(doc.Messages) != 6 {
+		t.Fatalf("expected 6 entries over HTTP/2.0, got %d over %q", len(doc.Messages), doc.Protocol)
+	}
+	// After the first failure the transport stays on HTTP/2.
+	if h3.calls.Load() != 1 {
+		t.Fatalf("HTTP/3 attempted %d times", h3.calls.Load())
+	}
+}
+
+func TestHTTP3KeepsToHTTP3AfterOtherErrors(t *testing.T) {
+	srv, roots := newH2Server(t)
+	h3 := &fakeH3{err: errors.New("H3_REQUEST_CANCELLED (remote)")}
+	c, err := New(ClientConfig{
+		Transport: TransportHTTP3,
+		Endpoint:  srv.URL,
+		TLSConfig: &tls.Config{RootCAs: roots},
+		HTTP3RoundTripper: func(tc *tls.Config) http.RoundTripper {
+			h3.relay = &http.Transport{TLSClientConfig: tc, ForceAttemptHTTP2: true}
+			return h3
+		},
+		AllowFallback: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	// A stream error on an established connection is not a handshake
+	// failure: it is returned, and the next call still goes over HTTP/3.
+	if _, err := c.Initialize(context.Background()); !errors.Is(err, h3.err) {
+		t.Fatalf("expected the HTTP/3 error, got %v", err)
+	}
+	h3.err = nil
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if p := c.transport.(interface{ protocol() string }).protocol(); p != "HTTP/3.0" {
+		t.Fatalf("protocol %q after a stream error, want HTTP/3.0", p)
+	}
+}
+
+func TestHTTP3WithoutFallback(t *testing.T) {
+	srv, roots := newH2Server(t)
+	alpn := errors.New("tls: no application protocol")
+	c, err := New(ClientConfig{
+		Transport:         TransportHTTP3,
+		Endpoint:          srv.URL,
+		TLSConfig:         &tls.Config{RootCAs: roots},
+		HTTP3RoundTripper: func(*tls.Config) http.RoundTripper { return &fakeH3{err: alpn} },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); !errors.Is(err, alpn) {
+		t.Fatalf("expected the HTTP/3 error, got %v", err)
+	}
+
+	_, err = New(ClientConfig{Transport: TransportHTTP3, Endpoint: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "HTTP3RoundTripper") {
+		t.Fatalf("expected a missing round tripper error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// connStats counts the connections handed to requests traced by it.
+type connStats struct {
+	fresh, reused atomic.Int64
+}
+
+func (s *connStats) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reused.Add(1)
+			} else {
+				s.fresh.Add(1)
+			}
+		},
+	})
+}
+
+// embedConcurrently issues n embed calls from n goroutines, at most inflight
+// of them on the wire at once.
+func embedConcurrently(tb testing.TB, c *Client, n, inflight int, stats *connStats) {
+	tb.Helper()
+	ctx := stats.trace(context.Background())
+	sem := make(chan struct{}, inflight)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if _, err := c.Embed(ctx, fmt.Sprintf("input-%d", i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		tb.Fatalf("Embed: %v", err)
+	}
+}
+
+func TestHTTPConnectionReuse(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+
+	const requests, inflight = 1000, 32
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var stats connStats
+	embedConcurrently(t, c, requests, inflight, &stats)
+	if fresh := stats.fresh.Load(); fresh > inflight {
+		t.Fatalf("opened %d connections for %d requests with %d in flight", fresh, requests, inflight)
+	}
+	if reused := stats.reused.Load(); reused < requests-inflight {
+		t.Fatalf("only %d of %d requests reused a connection", reused, requests)
+	}
+}
+
+func TestHTTPDisableKeepAlives(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, DisableKeepAlives: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var stats connStats
+	embedConcurrently(t, c, 20, 4, &stats)
+	if reused := stats.reused.Load(); reused != 0 {
+		t.Fatalf("expected no reuse with keep-alives disabled, got %d", reused)
+	}
+}
+
+func BenchmarkHTTPEmbedConcurrent(b *testing.B) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL})
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	const requests = 1000
+	var stats connStats
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		embedConcurrently(b, c, requests, requests, &stats)
+	}
+	b.StopTimer()
+	if stats.reused.Load() == 0 {
+		b.Fatal("no connection was reused")
+	}
+	b.ReportMetric(float64(stats.fresh.Load())/float64(b.N), "conns/op")
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// IdempotencyHeader carries a request's idempotency key over the http, tls,
+// and http3 transports. Every transport also sends it in the envelope as
+// meta.idempotency_key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// CallOption customizes a single Call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	idempotencyKey   string
+	maxResponseBytes int
+	serverRequestID  *string
+}
+
+// WithIdempotencyKey sends the call under key instead of a generated one,
+// for callers that persist keys to deduplicate across process restarts.
+// The key is attached even to methods that are idempotent anyway.
+func WithIdempotencyKey(key string) CallOption {
+	return func(o *callOptions) { o.idempotencyKey = key }
+}
+
+// newIdempotencyKey returns a random RFC 4122 version 4 UUID.
+func newIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// replayable reports whether req may be retried against the same server
+// after it may have been received: its method is idempotent, or it carries
+// an idempotency key the server deduplicates on. Failover and stdio
+// restarts reach a server that never saw the key, so they keep to
+// replayableMethods.
+func replayable(req *Request) bool {
+	return replayableMethods[req.Method] || req.Meta != nil && req.Meta.IdempotencyKey != ""
+}
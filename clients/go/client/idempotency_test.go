@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyServer fails the first failures requests with 503 and records the
+// idempotency key of every request, from the header and the envelope.
+func keyServer(t *testing.T, failures int) (*httptest.Server, func() (headers, metas []string)) {
+	t.Helper()
+	var mu sync.Mutex
+	var headers, metas []string
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req Request
+		_ = json.Unmarshal(body, &req)
+		mu.Lock()
+		headers = append(headers, r.Header.Get(IdempotencyHeader))
+		metas = append(metas, req.Meta.IdempotencyKey)
+		n := len(headers)
+		mu.Unlock()
+		if n <= failures {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ok.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() ([]string, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), headers...), append([]string(nil), metas...)
+	}
+}
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestIdempotencyKeyReusedAcrossRetries(t *testing.T) {
+	srv, seen := keyServer(t, 2)
+	sink := &recordingSink{}
+	c, err := NewClient(srv.URL, WithRetry(3, time.Millisecond, time.Millisecond), WithTranscriptRecorder(sink))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	// A method outside the idempotent set is retried only thanks to its key.
+	if err := c.Call(context.Background(), "mcp.index.upsert", nil, nil); err == nil {
+		t.Fatal("the fake server does not implement the method")
+	}
+	headers, metas := seen()
+	if len(headers) != 3 || !uuidV4.MatchString(headers[0]) {
+		t.Fatalf("expected 3 attempts under a UUID key, got %q", headers)
+	}
+	for i := range headers {
+		if headers[i] != headers[0] || metas[i] != headers[0] {
+			t.Fatalf("attempt %d changed the key: headers %q, meta %q", i, headers, metas)
+		}
+	}
+	var recorded Request
+	if err := json.Unmarshal(sink.entries[0].Message, &recorded); err != nil || recorded.Meta.IdempotencyKey != headers[0] {
+		t.Fatalf("transcript lacks the key: %v %s", err, sink.entries[0].Message)
+	}
+
+	// Each logical request gets its own key.
+	_ = c.Call(context.Background(), "mcp.index.upsert", nil, nil)
+	if next, _ := seen(); next[3] == headers[0] {
+		t.Fatal("a new call reused the previous key")
+	}
+}
+
+func TestIdempotencyKeyOnlyForUnsafeMethods(t *testing.T) {
+	srv, seen := keyServer(t, 0)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if err := c.Call(context.Background(), MethodPing, nil, nil, WithIdempotencyKey("caller-key")); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if headers, metas := seen(); headers[0] != "" || metas[0] != "" || headers[1] != "caller-key" || metas[1] != "caller-key" {
+		t.Fatalf("unexpected keys: headers %q, meta %q", headers, metas)
+	}
+}
+
+func TestCallerIdempotencyKeySurvivesRetries(t *testing.T) {
+	srv, seen := keyServer(t, 1)
+	c, err := NewClient(srv.URL, WithRetry(2, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	_ = c.Call(context.Background(), "mcp.index.upsert", nil, nil, WithIdempotencyKey("order-17"))
+	if headers, _ := seen(); len(headers) != 2 || headers[0] != "order-17" || headers[1] != "order-17" {
+		t.Fatalf("unexpected keys %q", headers)
+	}
+}
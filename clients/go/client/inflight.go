@@ -0,0 +1,226 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPriorityAging is how long a call waits for an in-flight slot
+// before it ranks one priority higher, when SchedulingPolicy.Aging is
+// unset.
+const DefaultPriorityAging = time.Second
+
+// SchedulingPolicy orders the calls waiting for one of the
+// ClientConfig.MaxInFlight slots. A freed slot goes to the waiting call of
+// the highest priority (see WithPriority), the longest waiting first among
+// equals, so interactive calls overtake bulk ones queued before them. The
+// zero value ages calls by DefaultPriorityAging and reports nothing.
+type SchedulingPolicy struct {
+	// Aging raises a waiting call's rank one priority for each Aging it has
+	// waited, so low-priority calls still get slots under a steady stream
+	// of high-priority ones. Zero selects DefaultPriorityAging.
+	Aging time.Duration
+	// HighWaitThreshold reports PriorityHigh calls that wait longer for a
+	// slot to EventListener.OnPriorityWait, as they stop waiting. Zero
+	// disables it.
+	HighWaitThreshold time.Duration
+}
+
+func (p SchedulingPolicy) validate() error {
+	if p.Aging < 0 || p.HighWaitThreshold < 0 {
+		return errors.New("scheduling aging and wait threshold must not be negative")
+	}
+	return nil
+}
+
+// WithScheduling ages calls waiting for an in-flight slot by aging and
+// reports high-priority calls waiting longer than highWait; see
+// SchedulingPolicy. A zero duration keeps its default. It overrides
+// WithConfig's Scheduling.
+func WithScheduling(aging, highWait time.Duration) Option {
+	return func(o *clientOptions) error {
+		if aging < 0 || highWait < 0 {
+			return fmt.Errorf("WithScheduling: durations must not be negative, got %v and %v", aging, highWait)
+		}
+		o.scheduling = &SchedulingPolicy{Aging: aging, HighWaitThreshold: highWait}
+		return nil
+	}
+}
+
+// PriorityWaitEvent describes a PriorityHigh call that waited longer than
+// SchedulingPolicy.HighWaitThreshold for an in-flight slot.
+type PriorityWaitEvent struct {
+	Method   string
+	Priority Priority
+	// Wait is how long the call waited, and Threshold the limit it
+	// exceeded.
+	Wait, Threshold time.Duration
+	// Waiting counts the calls still waiting, by priority, once it stopped.
+	Waiting map[Priority]int
+	// Err is the context error that ended the wait, or nil when the call
+	// got its slot.
+	Err error
+}
+
+// inFlight counts outstanding requests and, with a limit, bounds them,
+// handing freed slots to the waiting calls in priority order.
+type inFlight struct {
+	// limit is the number of slots, 0 when unlimited.
+	limit  int
+	policy SchedulingPolicy
+	now    func() time.Time
+	// onHighWait receives the PriorityWaitEvents of policy.
+	onHighWait func(PriorityWaitEvent)
+	count      atomic.Int64
+
+	mu   sync.Mutex
+	used int
+	// queue holds the waiting calls in arrival order.
+	queue []*slotWaiter
+}
+
+// slotWaiter is a call waiting for a slot.
+type slotWaiter struct {
+	priority Priority
+	since    time.Time
+	// ready is closed when the call is granted a slot; granted and waited
+	// are set first, under mu.
+	ready   chan struct{}
+	granted bool
+	waited  time.Duration
+}
+
+func newInFlight(limit int, policy SchedulingPolicy) *inFlight {
+	if policy.Aging == 0 {
+		policy.Aging = DefaultPriorityAging
+	}
+	return &inFlight{limit: limit, policy: policy, now: time.Now}
+}
+
+// acquire takes a slot for a method call of priority p, blocking while the
+// limit is reached until one is handed to it or ctx is done. Every
+// successful acquire must be followed by release.
+func (l *inFlight) acquire(ctx context.Context, method string, p Priority) error {
+	if l.limit == 0 {
+		l.count.Add(1)
+		return nil
+	}
+	l.mu.Lock()
+	if l.used < l.limit && len(l.queue) == 0 {
+		l.used++
+		l.mu.Unlock()
+		l.count.Add(1)
+		return nil
+	}
+	w := &slotWaiter{priority: p, since: l.now(), ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	var cause error
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		cause = ctx.Err()
+		l.mu.Lock()
+		if w.granted {
+			// The slot came as the wait ended; it goes to the next call.
+			l.handOff()
+		} else {
+			l.queue = removeWaiter(l.queue, w)
+			w.waited = l.now().Sub(w.since)
+		}
+		l.mu.Unlock()
+	}
+	if threshold := l.policy.HighWaitThreshold; p == PriorityHigh && threshold > 0 && w.waited > threshold && l.onHighWait != nil {
+		l.onHighWait(PriorityWaitEvent{Method: method, Priority: p, Wait: w.waited, Threshold: threshold, Waiting: l.waiting(), Err: cause})
+	}
+	if cause != nil {
+		return fmt.Errorf("waiting for one of %d in-flight slots: %w", l.limit, cause)
+	}
+	l.count.Add(1)
+	return nil
+}
+
+func (l *inFlight) release() {
+	l.count.Add(-1)
+	if l.limit == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.handOff()
+	l.mu.Unlock()
+}
+
+// handOff gives a freed slot to the waiting call of the highest rank, or
+// returns it to the pool when none waits. The caller holds mu.
+func (l *inFlight) handOff() {
+	if len(l.queue) == 0 {
+		l.used--
+		return
+	}
+	now := l.now()
+	best := 0
+	for i := 1; i < len(l.queue); i++ {
+		if l.rank(l.queue[i], now) > l.rank(l.queue[best], now) {
+			best = i
+		}
+	}
+	w := l.queue[best]
+	l.queue = removeWaiter(l.queue, w)
+	w.granted, w.waited = true, now.Sub(w.since)
+	close(w.ready)
+}
+
+// rank is the priority of w once aged to now.
+func (l *inFlight) rank(w *slotWaiter, now time.Time) int64 {
+	return int64(w.priority) + int64(now.Sub(w.since)/l.policy.Aging)
+}
+
+// waiting counts the waiting calls by priority.
+func (l *inFlight) waiting() map[Priority]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := make(map[Priority]int, len(priorityNames))
+	for p := range priorityNames {
+		n[p] = 0
+	}
+	for _, w := range l.queue {
+		n[w.priority]++
+	}
+	return n
+}
+
+func removeWaiter(queue []*slotWaiter, w *slotWaiter) []*slotWaiter {
+	for i, q := range queue {
+		if q == w {
+			return append(queue[:i], queue[i+1:]...)
+		}
+	}
+	return queue
+}
+
+// interceptInFlight is the Interceptor applying ClientConfig.MaxInFlight.
+func (c *Client) interceptInFlight(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	opts, _ := req.Options()
+	if err := c.inFlight.acquire(ctx, req.Method, opts.Priority); err != nil {
+		return nil, err
+	}
+	defer c.inFlight.release()
+	return next(ctx, req)
+}
+
+// WithMaxInFlight bounds the requests outstanding at once across every
+// goroutine sharing the client to n; see ClientConfig.MaxInFlight.
+func WithMaxInFlight(n int) Option {
+	return func(o *clientOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("WithMaxInFlight: limit must be positive, got %d", n)
+		}
+		o.maxInFlight = n
+		return nil
+	}
+}
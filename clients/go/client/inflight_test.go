@@ -0,0 +1,320 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pollStats waits until ok accepts the client's Stats.
+func pollStats(t *testing.T, c *Client, ok func(Stats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(c.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats never settled: %+v", c.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxInFlightUnderLoad(t *testing.T) {
+	const limit, callers = 8, 1000
+	var active, peak atomic.Int32
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(100 * time.Microsecond)
+		active.Add(-1)
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithMaxInFlight(limit))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Embed(context.Background(), "x"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Embed: %v", err)
+	}
+	if peak.Load() > limit || peak.Load() == 0 {
+		t.Fatalf("server saw up to %d concurrent requests, limit %d", peak.Load(), limit)
+	}
+	if s := c.Stats(); s.InFlight != 0 || s.Waiting != 0 || s.MaxInFlight != limit {
+		t.Fatalf("unexpected stats after the load: %+v", s)
+	}
+}
+
+func TestMaxInFlightWaitHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithMaxInFlight(1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	done := make(chan error, 2)
+	go func() { done <- c.Call(context.Background(), MethodPing, nil, nil) }()
+	pollStats(t, c, func(s Stats) bool { return s.InFlight == 1 })
+	go func() { done <- c.Call(context.Background(), MethodPing, nil, nil) }()
+	pollStats(t, c, func(s Stats) bool { return s.Waiting == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to time out, got %v", err)
+	}
+	// Ping is a health check and does not queue behind the limit.
+	go func() { _, _ = c.Ping(context.Background()) }()
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Call: %v", err)
+		}
+	}
+	pollStats(t, c, func(s Stats) bool { return s.InFlight == 0 && s.Waiting == 0 })
+}
+
+func TestMaxInFlightStreamHoldsSlot(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithMaxInFlight(1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	// Nothing reads the stream, so it stays open and keeps its slot.
+	pollStats(t, c, func(s Stats) bool { return s.InFlight == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the call to wait for the stream, got %v", err)
+	}
+	if results := collect(t, ch); len(results) != 3 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	pollStats(t, c, func(s Stats) bool { return s.InFlight == 0 })
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call after the stream closed: %v", err)
+	}
+}
+
+// scheduledServer answers the embeds of a client limited to one in-flight
+// request one at a time, reporting each input as it arrives and holding
+// its answer until released.
+type scheduledServer struct {
+	arrived chan string
+	release chan struct{}
+}
+
+func newScheduledClient(t *testing.T, policy SchedulingPolicy, l EventListener) (*Client, *scheduledServer, *fakeClock) {
+	t.Helper()
+	s := &scheduledServer{arrived: make(chan string), release: make(chan struct{})}
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: inprocHandler(func(req *Request) *Response {
+			if req.Method == MethodEmbed {
+				var p embedParams
+				_ = json.Unmarshal(req.Params, &p)
+				s.arrived <- p.Inputs[0]
+				<-s.release
+			}
+			return defaultHandler(req)
+		}),
+		MaxInFlight:   1,
+		Scheduling:    policy,
+		EventListener: l,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c.inFlight.now = clock.now
+	return c, s, clock
+}
+
+// hold starts an Embed taking the free slot and waits until it reaches the
+// server.
+func (s *scheduledServer) hold(t *testing.T, c *Client, done chan<- error) {
+	t.Helper()
+	go func() {
+		_, err := c.Embed(context.Background(), "hold")
+		done <- err
+	}()
+	if got := <-s.arrived; got != "hold" {
+		t.Fatalf("first input %q", got)
+	}
+}
+
+// queue starts an Embed of text at priority p and waits until it is queued
+// for the slot.
+func (s *scheduledServer) queue(t *testing.T, c *Client, done chan<- error, text string, p Priority) {
+	t.Helper()
+	want := c.Stats().WaitingByPriority[p] + 1
+	go func() {
+		_, err := c.Embed(context.Background(), text, WithPriority(p))
+		done <- err
+	}()
+	pollStats(t, c, func(s Stats) bool { return s.WaitingByPriority[p] == want })
+}
+
+// order releases the call holding the slot and each after it, returning
+// the inputs in the order they reached the server.
+func (s *scheduledServer) order(n int) []string {
+	var got []string
+	for i := 0; i < n; i++ {
+		s.release <- struct{}{}
+		got = append(got, <-s.arrived)
+	}
+	s.release <- struct{}{}
+	return got
+}
+
+func (f *fakeClock) tick(d time.Duration) {
+	f.mu.Lock()
+	f.t = f.t.Add(d)
+	var due []func()
+	for _, timer := range f.timers {
+		if !timer.done && !timer.at.After(f.t) {
+			timer.done = true
+			due = append(due, timer.f)
+		}
+	}
+	f.mu.Unlock()
+	for _, fn := range due {
+		fn()
+	}
+}
+
+func TestPriorityScheduling(t *testing.T) {
+	l := &eventLog{}
+	c, s, clock := newScheduledClient(t, SchedulingPolicy{Aging: time.Minute, HighWaitThreshold: 50 * time.Millisecond}, l)
+	done := make(chan error, 5)
+	s.hold(t, c, done)
+	s.queue(t, c, done, "bulk 1", PriorityLow)
+	s.queue(t, c, done, "bulk 2", PriorityLow)
+	s.queue(t, c, done, "query", PriorityHigh)
+	s.queue(t, c, done, "normal", PriorityNormal)
+	st := c.Stats()
+	if want := map[Priority]int{PriorityLow: 2, PriorityNormal: 1, PriorityHigh: 1}; st.Waiting != 4 || fmt.Sprint(st.WaitingByPriority) != fmt.Sprint(want) {
+		t.Fatalf("waiting %d by priority %v, want 4 as %v", st.Waiting, st.WaitingByPriority, want)
+	}
+
+	clock.tick(time.Second)
+	got := s.order(4)
+	if want := []string{"query", "normal", "bulk 1", "bulk 2"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("served %q, want %q", got, want)
+	}
+	for i := 0; i < 5; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	var waits []string
+	for _, ev := range l.list() {
+		if strings.HasPrefix(ev, "priority wait") {
+			waits = append(waits, ev)
+		}
+	}
+	checkEvents(t, waits, "priority wait mcp.embed high 1s")
+	if st := c.Stats(); st.Waiting != 0 || st.InFlight != 0 {
+		t.Fatalf("stats after the calls: %+v", st)
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	c, s, clock := newScheduledClient(t, SchedulingPolicy{Aging: 10 * time.Second}, nil)
+	done := make(chan error, 4)
+	s.hold(t, c, done)
+	s.queue(t, c, done, "old bulk", PriorityLow)
+	// Twenty seconds of waiting raise a low call level with a fresh high
+	// one, and the longer waiting goes first among equals.
+	clock.tick(20 * time.Second)
+	s.queue(t, c, done, "query", PriorityHigh)
+	s.queue(t, c, done, "new bulk", PriorityLow)
+	got := s.order(3)
+	if want := []string{"old bulk", "query", "new bulk"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("served %q, want %q", got, want)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+}
+
+func TestPriorityWaitCancelled(t *testing.T) {
+	var waits []PriorityWaitEvent
+	var mu sync.Mutex
+	l := EventHooks{PriorityWait: func(ev PriorityWaitEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, ev)
+	}}
+	c, s, clock := newScheduledClient(t, SchedulingPolicy{HighWaitThreshold: time.Second}, l)
+	done := make(chan error, 1)
+	s.hold(t, c, done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(ctx, "query", WithPriority(PriorityHigh))
+		failed <- err
+	}()
+	pollStats(t, c, func(s Stats) bool { return s.WaitingByPriority[PriorityHigh] == 1 })
+	clock.tick(2 * time.Second)
+	cancel()
+	if err := <-failed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Embed: %v, want context.Canceled", err)
+	}
+	s.release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(waits) != 1 || waits[0].Wait != 2*time.Second || waits[0].Threshold != time.Second || !errors.Is(waits[0].Err, context.Canceled) {
+		t.Fatalf("priority wait events %+v", waits)
+	}
+	// The slot the cancelled call gave up is free again.
+	if st := c.Stats(); st.Waiting != 0 || st.InFlight != 0 {
+		t.Fatalf("stats after the calls: %+v", st)
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Handler answers a request for the inproc transport. Returning an *RPCError
+// produces a JSON-RPC error response carrying it; any other error becomes an
+// internal error (-32603). The response ID and version default to the
+// request's when left unset. A notification, a request without an ID, is
+// passed to the handler too, and its response discarded.
+type Handler func(Request) (Response, error)
+
+// newInProcTransport serves requests with handler over an in-memory pipe
+// pair. Frames take the same encode, framing, and decode path as the stdio
+// transport, so serialization bugs surface in unit tests.
+func newInProcTransport(handler Handler, opts streamOptions) *streamTransport {
+	return newStreamTransport(TransportInProc, func(context.Context) (io.ReadWriteCloser, error) {
+		return startInProc(handler, opts.framing), nil
+	}, opts)
+}
+
+// inprocConn is the client end of an in-memory session.
+type inprocConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func startInProc(handler Handler, f framing) *inprocConn {
+	toServer, fromClient := io.Pipe()
+	toClient, fromServer := io.Pipe()
+	go func() {
+		err := serveInProc(toServer, fromServer, f, handler)
+		toServer.CloseWithError(err)
+		fromServer.CloseWithError(err)
+	}()
+	return &inprocConn{r: toClient, w: fromClient}
+}
+
+// serveInProc answers framed requests until r is closed.
+func serveInProc(r io.Reader, w io.Writer, f framing, handler Handler) error {
+	reader := bufio.NewReader(r)
+	for {
+		payload, err := f.read(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return err
+		}
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(payload, &req); err != nil {
+			resp = Response{Error: &RPCError{Code: CodeParseError, Message: "parse error: " + err.Error()}}
+		} else {
+			resp = handleInProc(handler, req)
+			if isNotification(payload) {
+				continue
+			}
+		}
+		out, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		if err := f.write(w, out); err != nil {
+			return err
+		}
+	}
+}
+
+// isNotification reports whether the request in payload has no ID, which
+// makes it a notification no response answers.
+func isNotification(payload []byte) bool {
+	var envelope struct {
+		ID json.RawMessage `json:"id"`
+	}
+	return json.Unmarshal(payload, &envelope) == nil && envelope.ID == nil
+}
+
+func handleInProc(handler Handler, req Request) Response {
+	resp, err := handler(req)
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp = Response{Error: rpcErr}
+	}
+	if resp.JSONRPC == "" {
+		resp.JSONRPC = JSONRPCVersion
+	}
+	if resp.ID == 0 {
+		resp.ID = req.ID
+	}
+	return resp
+}
+
+func (c *inprocConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *inprocConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+// Close ends the session. A handler still running finishes in the
+// background and its response is discarded.
+func (c *inprocConn) Close() error {
+	c.w.Close()
+	c.r.Close()
+	return nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// inprocHandler adapts a fakeHandler to the inproc Handler signature.
+func inprocHandler(handle fakeHandler) Handler {
+	return func(req Request) (Response, error) { return *handle(&req), nil }
+}
+
+func TestInProcSession(t *testing.T) {
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx := context.Background()
+	init, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if init.Session.ID != fakeSessionID {
+		t.Fatalf("unexpected session %+v", init.Session)
+	}
+	vec, err := c.Embed(ctx, "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 3 || vec[0] != 5 {
+		t.Fatalf("unexpected vector %v", vec)
+	}
+	if len(sink.entries) != 4 {
+		t.Fatalf("expected 4 recorded entries, got %d", len(sink.entries))
+	}
+	var params struct {
+		Transport map[string]string `json:"transport"`
+	}
+	var first Request
+	if err := json.Unmarshal(sink.entries[0].Message, &first); err != nil {
+		t.Fatalf("decode recorded request: %v", err)
+	}
+	if err := json.Unmarshal(first.Params, &params); err != nil {
+		t.Fatalf("decode params: %v", err)
+	}
+	if params.Transport["kind"] != TransportInProc || params.Transport["endpoint"] != "inproc://session" {
+		t.Fatalf("unexpected transport params %v", params.Transport)
+	}
+}
+
+func TestInProcHandlerErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{"rpc error passes through", &RPCError{Code: -32000, Message: "overloaded"}, -32000},
+		{"plain error becomes internal error", errors.New("boom"), CodeInternalError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := func(Request) (Response, error) { return Response{}, tc.err }
+			c, err := New(ClientConfig{Transport: TransportInProc, Handler: handler})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+
+			err = c.Call(context.Background(), MethodPing, nil, nil)
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) || rpcErr.Code != tc.wantCode {
+				t.Fatalf("expected rpc error %d, got %v", tc.wantCode, err)
+			}
+			// The session survives handler errors.
+			if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.As(err, &rpcErr) {
+				t.Fatalf("second call: %v", err)
+			}
+		})
+	}
+}
+
+func TestInProcReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(req Request) (Response, error) {
+		<-release
+		return Response{}, nil
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: handler, ReadTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected ErrReadTimeout, got %v", err)
+	}
+}
+
+func TestInProcRequiresHandler(t *testing.T) {
+	if _, err := New(ClientConfig{Transport: TransportInProc}); err == nil {
+		t.Fatal("expected error without a handler")
+	}
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Invoker sends req and returns the server's response. A JSON-RPC error is a
+// response with Error set, not an error; errors mean no usable response.
+type Invoker func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor wraps the sending of requests. It may inspect or modify req,
+// call next any number of times or not at all, and inspect, replace, or wrap
+// what next returns. Its changes to req are what the server receives and the
+// transcript records.
+//
+// A request sent with Call passes through, outermost first: retries
+// (ClientConfig.Retry), hedging (ClientConfig.Hedging), the circuit
+// breaker, the rate limiter, the in-flight limit, the counting for Stats and
+// ClientConfig.Metrics, the tracing of ClientConfig.TracerProvider, the
+// ClientConfig.Interceptors in order, the transcript recorder, the
+// interceptor attaching ClientConfig.APIKey or TokenSource, and the one
+// signing with ClientConfig.Signing, then the transport. The unconfigured
+// built-ins are left out. Ping skips the first five. EmbedStream is paced, guarded by the breaker,
+// and holds an in-flight slot but bypasses the chain otherwise, recording
+// its frames, metrics, and span itself.
+type Interceptor func(ctx context.Context, req *Request, next Invoker) (*Response, error)
+
+// WithInterceptor appends interceptors, run in registration order after any
+// set by WithConfig.
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(o *clientOptions) error {
+		o.interceptors = append(o.interceptors, interceptors...)
+		return nil
+	}
+}
+
+// chain returns an Invoker running interceptors around invoke, the first
+// outermost.
+func chain(interceptors []Interceptor, invoke Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		intercept, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, req *Request) (*Response, error) {
+			return intercept(ctx, req, next)
+		}
+	}
+	return invoke
+}
+
+// buildChains assembles the guarded Call chain and the direct one used by
+// Ping from the configured built-ins and ClientConfig.Interceptors.
+func (c *Client) buildChains() {
+	direct := []Interceptor{c.interceptMetrics}
+	if c.tracer != nil {
+		direct = append(direct, c.interceptTrace)
+	}
+	direct = append(direct, c.cfg.Interceptors...)
+	if c.cfg.Recorder != nil {
+		direct = append(direct, c.interceptRecord)
+	}
+	if c.cfg.needsAuthInterceptor(c.transport.Kind()) {
+		direct = append(direct, c.interceptAuth)
+	}
+	if c.signer != nil {
+		direct = append(direct, c.interceptSign)
+	}
+	var guarded []Interceptor
+	if c.cfg.Retry.MaxAttempts > 1 {
+		guarded = append(guarded, c.interceptRetry)
+	}
+	if c.hedger != nil {
+		guarded = append(guarded, c.interceptHedge)
+	}
+	if c.breaker != nil {
+		guarded = append(guarded, c.interceptBreaker)
+	}
+	if c.limiter != nil {
+		guarded = append(guarded, c.interceptRateLimit)
+	}
+	guarded = append(guarded, c.interceptInFlight)
+	c.direct = chain(direct, c.roundTrip)
+	c.invoke = chain(append(guarded, direct...), c.roundTrip)
+}
+
+// roundTrip is the end of every chain.
+func (c *Client) roundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if c.tracer != nil {
+		ctx, req = c.propagateTrace(ctx, req)
+	}
+	start := time.Now()
+	markPhase(ctx, PhaseSend)
+	defer markPhase(ctx, PhaseQueue)
+	var resp *Response
+	var err error
+	switch member, _ := ctx.Value(batchMemberKey{}).(*batchMember); {
+	case c.cfg.DryRun:
+		resp, err = c.answerDryRun(ctx, req)
+	case member != nil:
+		resp, err = member.roundTrip(ctx, c.transport, req)
+	default:
+		resp, err = c.transport.RoundTrip(ctx, req)
+	}
+	if err == nil && c.cfg.WireProtocol == JSONRPC2 && !c.cfg.DryRun {
+		if err = checkEnvelope(resp); err != nil {
+			resp = nil
+		}
+	}
+	c.metrics.sent(req.Method, req)
+	c.metrics.received(req.Method, resp)
+	tallyBytes(ctx, req, resp)
+	switch {
+	case err != nil:
+		c.logExchange(ctx, req, nil, start, err)
+	case resp.Error != nil:
+		c.logExchange(ctx, req, resp, start, resp.Error)
+	default:
+		c.logExchange(ctx, req, resp, start, nil)
+	}
+	return resp, err
+}
+
+// callError is the error a chain's outcome amounts to, including a JSON-RPC
+// error response.
+func callError(resp *Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.Error != nil {
+		return rpcAPIError(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterceptorsRunInRegistrationOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			order = append(order, name+">")
+			resp, err := next(ctx, req)
+			order = append(order, "<"+name)
+			return resp, err
+		}
+	}
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Interceptors: []Interceptor{trace("config")}}),
+		WithInterceptor(trace("a"), trace("b")),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if want := []string{"config>", "a>", "b>", "<b", "<a", "<config"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("order %v, want %v", order, want)
+	}
+}
+
+func TestInterceptorShortCircuits(t *testing.T) {
+	stub := okStub(TransportHTTP)
+	c := NewWithTransport(ClientConfig{Interceptors: []Interceptor{
+		func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: json.RawMessage(`{"cached":true}`)}, nil
+		},
+	}}, stub)
+	var result struct{ Cached bool }
+	if err := c.Call(context.Background(), MethodCapabilities, nil, &result); err != nil || !result.Cached {
+		t.Fatalf("Call: %+v, %v", result, err)
+	}
+	if stub.calls.Load() != 0 {
+		t.Fatalf("the transport was reached %d times", stub.calls.Load())
+	}
+}
+
+func TestInterceptorMutatesRequestAndResponse(t *testing.T) {
+	sink := &recordingSink{}
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)}),
+		WithTranscriptRecorder(sink),
+		WithInterceptor(func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			// Route the A/B arm to another model and tag the answer.
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			params.Model = "text-embedding-3-small"
+			req.Params, _ = json.Marshal(params)
+			resp, err := next(ctx, req)
+			if err == nil {
+				resp.Result = json.RawMessage(strings.Replace(string(resp.Result), `"model":`, `"arm":"b","model":`, 1))
+			}
+			return resp, err
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	var result struct {
+		Arm   string `json:"arm"`
+		Model string `json:"model"`
+	}
+	if err := c.Call(context.Background(), MethodEmbed, embedParams{Model: DefaultModel, Inputs: []string{"x"}}, &result); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if result.Arm != "b" || result.Model != "text-embedding-3-small" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	// The recorder sits inside the interceptors and sees the mutated request.
+	params, _ := lastEmbedRequest(t, sink)
+	if params.Model != "text-embedding-3-small" {
+		t.Fatalf("transcript recorded model %q", params.Model)
+	}
+}
+
+func TestInterceptorWrapsErrors(t *testing.T) {
+	errDenied := errors.New("denied by policy")
+	c := NewWithTransport(ClientConfig{Interceptors: []Interceptor{
+		func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			if req.Method == MethodEmbed {
+				return nil, errDenied
+			}
+			resp, err := next(ctx, req)
+			if err != nil {
+				return nil, fmt.Errorf("request %d: %w", req.ID, err)
+			}
+			return resp, nil
+		},
+	}}, failingStub(TransportHTTP, ErrConnectionLost))
+	if err := c.Call(context.Background(), MethodEmbed, nil, nil); !errors.Is(err, errDenied) || !strings.HasPrefix(err.Error(), MethodEmbed+": ") {
+		t.Fatalf("expected the interceptor's error, got %v", err)
+	}
+	err := c.Call(context.Background(), MethodPing, nil, nil)
+	if !errors.Is(err, ErrConnectionLost) || !strings.Contains(err.Error(), "request 2:") {
+		t.Fatalf("expected a wrapped transport error, got %v", err)
+	}
+}
+
+func TestInterceptorsSeeEveryRetry(t *testing.T) {
+	srv, _ := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	var ids []int64
+	c, err := NewClient(srv.URL,
+		WithRetry(3, time.Millisecond, time.Millisecond),
+		WithInterceptor(func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			ids = append(ids, req.ID)
+			return next(ctx, req)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("attempt IDs %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job methods for embedding corpora too large for a single call.
+const (
+	MethodJobSubmit  = "mcp.jobs.submit"
+	MethodJobStatus  = "mcp.jobs.status"
+	MethodJobResults = "mcp.jobs.results"
+)
+
+// WaitJob polling defaults.
+const (
+	DefaultJobPollInitial = 500 * time.Millisecond
+	DefaultJobPollMax     = 10 * time.Second
+	// DefaultJobPageSize is the page size Each uses when given 0.
+	DefaultJobPageSize = 1000
+)
+
+// ErrJobFailed reports a job that ended without results: it failed or was
+// cancelled.
+var ErrJobFailed = errors.New("job failed")
+
+// JobID identifies a job queued with SubmitJob.
+type JobID string
+
+// JobSpec describes a background embedding job.
+type JobSpec struct {
+	// Model defaults to ClientConfig.Model.
+	Model  string   `json:"model"`
+	Inputs []string `json:"inputs"`
+	// Metadata is stored with the job and returned in its status.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// JobState is the lifecycle stage the server reports for a job.
+type JobState string
+
+// Job states. A job moves from queued to running to one of the last three.
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// JobStatus is a job's progress.
+type JobStatus struct {
+	ID    JobID    `json:"job_id"`
+	State JobState `json:"state"`
+	// Completed of Total inputs have been embedded.
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+	// Error explains a failed job.
+	Error    *RPCError         `json:"error,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Done reports whether the job has stopped changing.
+func (s JobStatus) Done() bool {
+	return s.State == JobSucceeded || s.State == JobFailed || s.State == JobCancelled
+}
+
+// PollInterval paces WaitJob: the first wait is Initial, and each further
+// wait doubles up to Max. Zero fields select DefaultJobPollInitial and
+// DefaultJobPollMax.
+type PollInterval struct {
+	Initial, Max time.Duration
+}
+
+// JobEmbedding is one vector of a finished job.
+type JobEmbedding struct {
+	// Index is the position of the input in JobSpec.Inputs.
+	Index  int       `json:"index"`
+	Vector []float32 `json:"vector"`
+}
+
+// JobPage is one page of a finished job's vectors.
+type JobPage struct {
+	Embeddings []JobEmbedding `json:"embeddings"`
+	// NextCursor fetches the following page; it is empty after the last.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Checksum, when the server sends one, is the JobPageChecksum of
+	// Embeddings; a page that does not match fails with
+	// ErrChecksumMismatch.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// JobResult is a finished job. Its vectors stay on the server and are
+// fetched a page at a time, so corpora of millions of inputs never have to
+// fit in memory at once; see Vectors.
+type JobResult struct {
+	Status JobStatus
+	c      *Client
+}
+
+// jobSubmitResult is the result of MethodJobSubmit.
+type jobSubmitResult struct {
+	ID JobID `json:"job_id"`
+}
+
+// SubmitJob queues spec on the server and returns its ID. The request
+// carries an idempotency key, so retries cannot queue the job twice.
+func (c *Client) SubmitJob(ctx context.Context, spec JobSpec) (JobID, error) {
+	if spec.Model == "" {
+		spec.Model = c.cfg.Model
+	}
+	v := &optionCheck{call: "SubmitJob"}
+	if len(spec.Inputs) == 0 {
+		v.addf([]string{"JobSpec.Inputs"}, "a job needs at least one input")
+	}
+	c.checkRoute(v, spec.Model)
+	if err := v.err(); err != nil {
+		return "", fmt.Errorf("%s: %w", MethodJobSubmit, err)
+	}
+	var result jobSubmitResult
+	if err := c.Call(ctx, MethodJobSubmit, spec, &result); err != nil {
+		return "", err
+	}
+	if result.ID == "" {
+		return "", fmt.Errorf("%s: no job_id in the result: %w", MethodJobSubmit, ErrProtocol)
+	}
+	return result.ID, nil
+}
+
+// JobStatus reports the progress of job id.
+func (c *Client) JobStatus(ctx context.Context, id JobID) (JobStatus, error) {
+	var status JobStatus
+	if err := c.Call(ctx, MethodJobStatus, map[string]any{"job_id": id}, &status); err != nil {
+		return JobStatus{}, err
+	}
+	if status.ID == "" {
+		status.ID = id
+	}
+	return status, nil
+}
+
+// WaitJob polls job id until it is done, waiting between polls as interval
+// describes, and returns its result. A failed or cancelled job returns an
+// error matching ErrJobFailed along with its final status; ctx ends the wait
+// early.
+func (c *Client) WaitJob(ctx context.Context, id JobID, interval PollInterval) (JobResult, error) {
+	wait, ceiling := interval.Initial, interval.Max
+	if wait <= 0 {
+		wait = DefaultJobPollInitial
+	}
+	if ceiling <= 0 {
+		ceiling = DefaultJobPollMax
+	}
+	for {
+		status, err := c.JobStatus(ctx, id)
+		if err != nil {
+			return JobResult{}, err
+		}
+		if status.Done() {
+			result := JobResult{Status: status, c: c}
+			if status.State != JobSucceeded {
+				err := fmt.Errorf("job %s %s: %w", id, status.State, ErrJobFailed)
+				if status.Error != nil {
+					err = fmt.Errorf("%w: %w", err, rpcAPIError(status.Error))
+				}
+				return result, err
+			}
+			return result, nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return JobResult{}, fmt.Errorf("wait for job %s (%s, %d/%d): %w", id, status.State, status.Completed, status.Total, ctx.Err())
+		}
+		wait = min(2*wait, ceiling)
+	}
+}
+
+// Page fetches up to limit vectors starting at cursor, which is "" for the
+// first page and JobPage.NextCursor afterwards. A limit of 0 lets the server
+// choose.
+func (r JobResult) Page(ctx context.Context, cursor string, limit int) (JobPage, error) {
+	var page JobPage
+	if err := r.fetchPage(ctx, cursor, limit, &page); err != nil {
+		return JobPage{}, err
+	}
+	return page, nil
+}
+
+// Each calls fn for every vector of the job, fetching pageSize at a time
+// (DefaultJobPageSize when 0), and stops at the first error fn returns.
+func (r JobResult) Each(ctx context.Context, pageSize int, fn func(JobEmbedding) error) error {
+	if pageSize <= 0 {
+		pageSize = DefaultJobPageSize
+	}
+	cursor := ""
+	for {
+		page, err := r.Page(ctx, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Embeddings {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fastPoll keeps WaitJob tests quick.
+var fastPoll = PollInterval{Initial: time.Millisecond, Max: 4 * time.Millisecond}
+
+// newJobClient returns a client of the in-process fake server.
+func newJobClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	c, err := NewClient("", append([]Option{WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestJobRoundTripAcrossTransports(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+
+	configs := map[string]ClientConfig{
+		"stdio":  {Command: helperCommand(t)},
+		"http":   {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"ws":     {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		"inproc": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+	}
+	inputs := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			ctx := context.Background()
+			id, err := c.SubmitJob(ctx, JobSpec{Inputs: inputs})
+			if err != nil {
+				t.Fatalf("SubmitJob: %v", err)
+			}
+			status, err := c.JobStatus(ctx, id)
+			if err != nil || status.State != JobRunning || status.Total != len(inputs) {
+				t.Fatalf("JobStatus = %+v, %v", status, err)
+			}
+			result, err := c.WaitJob(ctx, id, fastPoll)
+			if err != nil {
+				t.Fatalf("WaitJob: %v", err)
+			}
+			if result.Status.State != JobSucceeded || result.Status.Completed != len(inputs) {
+				t.Fatalf("unexpected final status %+v", result.Status)
+			}
+
+			var got []int
+			if err := result.Each(ctx, 2, func(e JobEmbedding) error {
+				if int(e.Vector[0]) != len(inputs[e.Index]) {
+					t.Errorf("vector %d is %v", e.Index, e.Vector)
+				}
+				got = append(got, e.Index)
+				return nil
+			}); err != nil {
+				t.Fatalf("Each: %v", err)
+			}
+			if len(got) != len(inputs) {
+				t.Fatalf("got indexes %v", got)
+			}
+		})
+	}
+}
+
+func TestJobResultPages(t *testing.T) {
+	c := newJobClient(t)
+	ctx := context.Background()
+	id, err := c.SubmitJob(ctx, JobSpec{Inputs: []string{"a", "b", "c"}})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	result, err := c.WaitJob(ctx, id, fastPoll)
+	if err != nil {
+		t.Fatalf("WaitJob: %v", err)
+	}
+	first, err := result.Page(ctx, "", 2)
+	if err != nil || len(first.Embeddings) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, %v", first, err)
+	}
+	last, err := result.Page(ctx, first.NextCursor, 2)
+	if err != nil || len(last.Embeddings) != 1 || last.Embeddings[0].Index != 2 || last.NextCursor != "" {
+		t.Fatalf("last page = %+v, %v", last, err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = result.Each(ctx, 1, func(JobEmbedding) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("Each should stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestWaitJobFailed(t *testing.T) {
+	c := newJobClient(t)
+	ctx := context.Background()
+	id, err := c.SubmitJob(ctx, JobSpec{Inputs: []string{"ok", "fail"}})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	result, err := c.WaitJob(ctx, id, fastPoll)
+	var apiErr *APIError
+	if !errors.Is(err, ErrJobFailed) || !errors.As(err, &apiErr) || !strings.Contains(err.Error(), "cannot embed input") {
+		t.Fatalf("expected ErrJobFailed with the server's error, got %v", err)
+	}
+	if result.Status.State != JobFailed {
+		t.Fatalf("expected the final status, got %+v", result.Status)
+	}
+}
+
+func TestWaitJobHonorsContext(t *testing.T) {
+	c := newJobClient(t)
+	id, err := c.SubmitJob(context.Background(), JobSpec{Inputs: []string{"a"}})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.WaitJob(ctx, id, PollInterval{Initial: time.Hour})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Fatalf("expected the deadline to end the wait, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestSubmitJobCarriesIdempotencyKey(t *testing.T) {
+	sink := &recordingSink{}
+	c := newJobClient(t, WithTranscriptRecorder(sink))
+	if _, err := c.SubmitJob(context.Background(), JobSpec{Inputs: []string{"a"}}); err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(sink.entries[0].Message, &req); err != nil || req.Method != MethodJobSubmit {
+		t.Fatalf("unexpected request %s", sink.entries[0].Message)
+	}
+	if req.Meta == nil || req.Meta.IdempotencyKey == "" {
+		t.Fatalf("job submission lacks an idempotency key: %s", sink.entries[0].Message)
+	}
+	if _, err := c.SubmitJob(context.Background(), JobSpec{}); err == nil {
+		t.Fatal("expected an error for a job without inputs")
+	}
+}
+
+func TestRunRecordsJobFixture(t *testing.T) {
+	dir := t.TempDir()
+	session, job := filepath.Join(dir, "stdio.json"), filepath.Join(dir, "stdio", "job.json")
+	var out strings.Builder
+	err := Run(context.Background(), Options{
+		Config:           ClientConfig{Transport: TransportStdio, Command: helperCommand(t)},
+		RecordTranscript: session,
+		RecordJob:        job,
+		Stdout:           &out,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	read := func(path string) transcriptFile {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read transcript: %v", err)
+		}
+		var doc transcriptFile
+		if err := json.Unmarshal(content, &doc); err != nil {
+			t.Fatalf("decode transcript: %v", err)
+		}
+		return doc
+	}
+	if doc := read(session); len(doc.Messages) != 6 {
+		t.Fatalf("session transcript should keep only the handshake sequence, got %d entries", len(doc.Messages))
+	}
+	doc := read(job)
+	if doc.Kind != FixtureJob || doc.Transport != TransportStdio {
+		t.Fatalf("unexpected job transcript header %+v", doc)
+	}
+	// Submit, two status polls, and two result pages.
+	var methods []string
+	for _, e := range doc.Messages {
+		if e.Direction == DirectionRequest {
+			var req Request
+			_ = json.Unmarshal(e.Message, &req)
+			methods = append(methods, req.Method)
+		}
+	}
+	want := []string{MethodJobSubmit, MethodJobStatus, MethodJobStatus, MethodJobResults, MethodJobResults}
+	if strings.Join(methods, ",") != strings.Join(want, ",") || len(doc.Messages) != 2*len(want) {
+		t.Fatalf("job transcript requests = %v (%d entries), want %v", methods, len(doc.Messages), want)
+	}
+
+	var summary SessionSummary
+	if err := json.Unmarshal([]byte(out.String()), &summary); err != nil || summary.Job == nil || summary.Job.State != JobSucceeded {
+		t.Fatalf("summary lacks the job: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// DefaultMaxBufferedVectors is the number of vectors a VectorIterator
+// holds at once when ClientConfig.MaxBufferedVectors is zero.
+const DefaultMaxBufferedVectors = 10000
+
+// ErrChecksumMismatch reports vectors that do not match the checksum the
+// server sent with them, such as a page of job results cut short on its
+// way or an embed response corrupted by a proxy; for an embed response
+// the error is a *ChecksumError saying which. It matches ErrProtocol.
+var ErrChecksumMismatch error = &classError{"checksum does not match", ErrProtocol}
+
+// JobPageChecksum returns the checksum of a page of job results, the hex
+// SHA-256 of each embedding in order: its index as a little-endian uint64,
+// then its components as little-endian IEEE 754 float32s. Servers send it
+// as JobPage.Checksum.
+func JobPageChecksum(embeddings []JobEmbedding) string {
+	h := sha256.New()
+	var buf [8]byte
+	for _, e := range embeddings {
+		binary.LittleEndian.PutUint64(buf[:], uint64(e.Index))
+		h.Write(buf[:])
+		for _, f := range e.Vector {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(f))
+			h.Write(buf[:4])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verify checks page against its checksum, when the server sent one.
+func (p *JobPage) verify(cursor string) error {
+	if p.Checksum == "" || p.Checksum == JobPageChecksum(p.Embeddings) {
+		return nil
+	}
+	at := "the first page"
+	if cursor != "" {
+		at = "page " + cursor
+	}
+	return fmt.Errorf("%s: %s of %d vectors: %w", MethodJobResults, at, len(p.Embeddings), ErrChecksumMismatch)
+}
+
+// fetchPage fetches the page at cursor into page, reusing its buffers, and
+// verifies it.
+func (r JobResult) fetchPage(ctx context.Context, cursor string, limit int, page *JobPage) error {
+	params := map[string]any{"job_id": r.Status.ID}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	if limit > 0 {
+		params["limit"] = limit
+	}
+	// encoding/json decodes into the elements and vectors already there,
+	// and leaves alone the fields an answer omits, so they are cleared
+	// first: a stale vector must never pass for a new one.
+	all := page.Embeddings[:cap(page.Embeddings)]
+	for i := range all {
+		all[i] = JobEmbedding{Vector: all[i].Vector[:0]}
+	}
+	page.Embeddings, page.NextCursor, page.Checksum = page.Embeddings[:0], "", ""
+	if err := r.c.Call(ctx, MethodJobResults, params, page); err != nil {
+		return err
+	}
+	return page.verify(cursor)
+}
+
+// VectorIterator walks the vectors of a finished job, fetching each page
+// only once the vectors before it are consumed and decoding it into the
+// buffers of the page before, so memory stays bounded by
+// ClientConfig.MaxBufferedVectors however large the job. Use it like a
+// bufio.Scanner:
+//
+//	it := result.Vectors(ctx)
+//	for it.Next() {
+//		e := it.Embedding()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type VectorIterator struct {
+	ctx    context.Context
+	result JobResult
+	limit  int
+	budget int
+
+	page JobPage
+	pos  int
+	// cursor fetches the current page, next the one after it.
+	cursor, next string
+	started      bool
+	done         bool
+
+	err error
+	// resumable reports that err came from fetching or verifying the
+	// page at next, which Resume may fetch again.
+	resumable bool
+}
+
+// Vectors returns an iterator over the job's vectors from the first page.
+// WithPageSize sets how many vectors each page asks for, capped, like the
+// server's default, at ClientConfig.MaxBufferedVectors; a page holding
+// more fails the iteration with ErrProtocol.
+func (r JobResult) Vectors(ctx context.Context, opts ...ListOption) *VectorIterator {
+	return r.VectorsFrom(ctx, "", opts...)
+}
+
+// VectorsFrom is Vectors starting at the page cursor fetches, as returned by
+// VectorIterator.Cursor, so a walk cut short can be picked up by another
+// iterator or process.
+func (r JobResult) VectorsFrom(ctx context.Context, cursor string, opts ...ListOption) *VectorIterator {
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	budget := DefaultMaxBufferedVectors
+	if r.c != nil && r.c.cfg.MaxBufferedVectors > 0 {
+		budget = r.c.cfg.MaxBufferedVectors
+	}
+	it := &VectorIterator{ctx: ctx, result: r, limit: min(budget, DefaultJobPageSize), budget: budget, next: cursor}
+	if o.pageSize > 0 {
+		it.limit = min(o.pageSize, budget)
+	}
+	if o.pageSize < 0 {
+		it.err = fmt.Errorf("page size must not be negative, got %d", o.pageSize)
+	}
+	return it
+}
+
+// Next advances to the next vector, fetching the following page when the
+// current one is exhausted. It returns false at the end of the job's
+// vectors, on error, and once ctx is done; Err tells them apart.
+func (it *VectorIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	for it.pos >= len(it.page.Embeddings) {
+		if it.done {
+			return false
+		}
+		if err := it.result.fetchPage(it.ctx, it.next, it.limit, &it.page); err != nil {
+			it.page.Embeddings = it.page.Embeddings[:0]
+			it.err, it.resumable = err, it.ctx.Err() == nil
+			return false
+		}
+		if n := len(it.page.Embeddings); n > it.budget {
+			it.page.Embeddings = it.page.Embeddings[:0]
+			it.err = fmt.Errorf("%s: page of %d vectors exceeds the budget of %d buffered vectors: %w", MethodJobResults, n, it.budget, ErrProtocol)
+			return false
+		}
+		// A server that hands back the cursor it was given would never end.
+		if it.started && it.page.NextCursor != "" && it.page.NextCursor == it.next {
+			it.err = fmt.Errorf("page token %s repeated: %w", it.next, ErrProtocol)
+			return false
+		}
+		it.cursor, it.next, it.pos, it.started = it.next, it.page.NextCursor, 0, true
+		it.done = it.next == ""
+	}
+	it.pos++
+	return true
+}
+
+// Embedding returns the vector Next advanced to. Its Vector shares the
+// page's buffer, which the next page is decoded into, so it must be copied
+// to be kept past the page.
+func (it *VectorIterator) Embedding() JobEmbedding { return it.page.Embeddings[it.pos-1] }
+
+// Err returns the error that stopped the iteration, or nil at the end of
+// the job's vectors. A page that failed to arrive or to verify against its
+// checksum can be fetched again with Resume.
+func (it *VectorIterator) Err() error { return it.err }
+
+// Resume clears the error of a page that failed to arrive or matched
+// ErrChecksumMismatch, so the next call to Next fetches that page again;
+// nothing already returned is returned twice. It reports false, leaving
+// the error, when the iteration stopped for another reason or not at all.
+func (it *VectorIterator) Resume() bool {
+	if it.err == nil || !it.resumable || it.ctx.Err() != nil {
+		return false
+	}
+	it.err, it.resumable = nil, false
+	return true
+}
+
+// Cursor returns the cursor of the page holding the vector Next would
+// advance to, "" for the first page: VectorsFrom picks the walk up there,
+// repeating the vectors of that page already seen. After the last page,
+// when there is nothing left to resume, it returns "" along with false.
+func (it *VectorIterator) Cursor() (string, bool) {
+	if it.pos < len(it.page.Embeddings) {
+		return it.cursor, true
+	}
+	if it.done && it.err == nil {
+		return "", false
+	}
+	return it.next, true
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// jobPageServer is defaultHandler with each mcp.jobs.results answer passed
+// through edit first, page counting from 0.
+type jobPageServer struct {
+	mu     sync.Mutex
+	pages  int
+	limits []int
+	edit   func(n int, page *JobPage) *RPCError
+}
+
+func (s *jobPageServer) serve(req *Request) *Response {
+	resp := defaultHandler(req)
+	if req.Method != MethodJobResults || resp.Error != nil {
+		return resp
+	}
+	var params struct {
+		Limit int `json:"limit"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	s.mu.Lock()
+	n := s.pages
+	s.pages++
+	s.limits = append(s.limits, params.Limit)
+	s.mu.Unlock()
+	var page JobPage
+	_ = json.Unmarshal(resp.Result, &page)
+	if s.edit != nil {
+		if rpcErr := s.edit(n, &page); rpcErr != nil {
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: rpcErr}
+		}
+	}
+	resp.Result, _ = json.Marshal(page)
+	return resp
+}
+
+// finishedJob runs a job of n inputs of lengths 1 to n on srv, through a
+// client holding at most budget vectors.
+func finishedJob(t *testing.T, srv *jobPageServer, n, budget int) JobResult {
+	t.Helper()
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(srv.serve), MaxBufferedVectors: budget})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("%0*d", i+1, 0)
+	}
+	ctx := context.Background()
+	id, err := c.SubmitJob(ctx, JobSpec{Inputs: inputs})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	result, err := c.WaitJob(ctx, id, fastPoll)
+	if err != nil {
+		t.Fatalf("WaitJob: %v", err)
+	}
+	return result
+}
+
+// drain walks it, checking each vector against its input, and returns the
+// indexes seen.
+func drain(t *testing.T, it *VectorIterator) []int {
+	t.Helper()
+	var seen []int
+	for it.Next() {
+		e := it.Embedding()
+		if e.Vector[0] != float32(e.Index+1) {
+			t.Fatalf("vector %v for input %d", e.Vector, e.Index)
+		}
+		seen = append(seen, e.Index)
+	}
+	return seen
+}
+
+func wantIndexes(t *testing.T, seen []int, from, to int) {
+	t.Helper()
+	if len(seen) != to-from {
+		t.Fatalf("saw inputs %v, want %d to %d", seen, from, to-1)
+	}
+	for i, idx := range seen {
+		if idx != from+i {
+			t.Fatalf("saw inputs %v, want %d to %d", seen, from, to-1)
+		}
+	}
+}
+
+func TestJobVectorsReusePagesWithinBudget(t *testing.T) {
+	srv := &jobPageServer{}
+	result := finishedJob(t, srv, 7, 3)
+	it := result.Vectors(context.Background(), WithPageSize(100))
+	var first *float32
+	var seen []int
+	for it.Next() {
+		e := it.Embedding()
+		if e.Index == 0 {
+			first = &e.Vector[0]
+		}
+		// Every page is decoded into the buffers of the first.
+		if e.Index%3 == 0 && &e.Vector[0] != first {
+			t.Fatalf("page at input %d decoded into a new buffer", e.Index)
+		}
+		seen = append(seen, e.Index)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	wantIndexes(t, seen, 0, 7)
+	if len(srv.limits) != 3 || srv.limits[0] != 3 {
+		t.Fatalf("asked for pages of %v vectors, want three of the budget of 3", srv.limits)
+	}
+	if _, ok := it.Cursor(); ok {
+		t.Fatal("a finished walk has no cursor to resume from")
+	}
+}
+
+func TestJobVectorsResumeAfterChecksumMismatch(t *testing.T) {
+	srv := &jobPageServer{edit: func(n int, page *JobPage) *RPCError {
+		switch n {
+		case 1:
+			// Cut short after the checksum was taken.
+			page.Embeddings = page.Embeddings[:1]
+		case 3:
+			return &RPCError{Code: -32000, Message: "results store unavailable"}
+		}
+		return nil
+	}}
+	result := finishedJob(t, srv, 8, 3)
+	it := result.Vectors(context.Background())
+	seen := drain(t, it)
+	if !errors.Is(it.Err(), ErrChecksumMismatch) || !errors.Is(it.Err(), ErrProtocol) {
+		t.Fatalf("truncated page: %v", it.Err())
+	}
+	wantIndexes(t, seen, 0, 3)
+	if !it.Resume() {
+		t.Fatal("Resume refused a page that failed its checksum")
+	}
+	seen = drain(t, it)
+	var apiErr *APIError
+	if !errors.As(it.Err(), &apiErr) {
+		t.Fatalf("failed page: %v", it.Err())
+	}
+	wantIndexes(t, seen, 3, 6)
+
+	// Another iterator picks the walk up where this one stopped.
+	cursor, ok := it.Cursor()
+	if !ok || cursor != "6" {
+		t.Fatalf("Cursor() = %q, %t", cursor, ok)
+	}
+	rest := result.VectorsFrom(context.Background(), cursor)
+	wantIndexes(t, drain(t, rest), 6, 8)
+	if err := rest.Err(); err != nil {
+		t.Fatalf("resumed walk: %v", err)
+	}
+}
+
+func TestJobVectorsRejectOversizedPages(t *testing.T) {
+	srv := &jobPageServer{edit: func(n int, page *JobPage) *RPCError {
+		page.Embeddings = append(page.Embeddings, page.Embeddings...)
+		page.Checksum = JobPageChecksum(page.Embeddings)
+		return nil
+	}}
+	result := finishedJob(t, srv, 4, 2)
+	it := result.Vectors(context.Background())
+	if it.Next() || !errors.Is(it.Err(), ErrProtocol) || it.Resume() {
+		t.Fatalf("a page over the budget: %v", it.Err())
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transcript formats.
+const (
+	// FormatJSON is a single indented document, written when the session
+	// ends.
+	FormatJSON = "json"
+	// FormatJSONL is one JSON value per line: the header markers first, then
+	// one line per entry. A later line without a "direction" updates the
+	// markers, such as the protocol versions negotiated after the session
+	// started, or adds the summary that ends a completed transcript. It is
+	// written append-only as the session goes.
+	FormatJSONL = "jsonl"
+)
+
+// jsonlFlushInterval bounds how long a recorded line stays buffered.
+const jsonlFlushInterval = time.Second
+
+// TranscriptFormat returns format, or, when it is empty, the format the
+// extension of path implies.
+func TranscriptFormat(path, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		return FormatJSONL
+	}
+	return FormatJSON
+}
+
+// jsonlFile appends the lines of a FormatJSONL transcript, flushing them
+// within jsonlFlushInterval of being written.
+type jsonlFile struct {
+	header transcriptHeader
+
+	mu    sync.Mutex
+	f     *os.File
+	buf   *bufio.Writer
+	timer *time.Timer
+	err   error
+}
+
+// createJSONL creates the transcript at path and writes its header line.
+func createJSONL(path string, header transcriptHeader) (*jsonlFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create transcript directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create transcript: %w", err)
+	}
+	j := &jsonlFile{header: header, f: f, buf: bufio.NewWriter(f)}
+	if err := j.writeLine(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *jsonlFile) writeLine(v any) error {
+	raw, err := marshalCanonical(v, false)
+	if err != nil {
+		return fmt.Errorf("encode transcript line: %w", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	j.buf.Write(raw)
+	if err := j.buf.WriteByte('\n'); err != nil {
+		j.err = fmt.Errorf("write transcript: %w", err)
+		return j.err
+	}
+	if j.timer == nil {
+		j.timer = time.AfterFunc(jsonlFlushInterval, j.flush)
+	}
+	return nil
+}
+
+func (j *jsonlFile) flush() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.flushLocked()
+}
+
+func (j *jsonlFile) flushLocked() {
+	j.timer = nil
+	if j.err == nil {
+		if err := j.buf.Flush(); err != nil {
+			j.err = fmt.Errorf("write transcript: %w", err)
+		}
+	}
+}
+
+func (j *jsonlFile) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.flushLocked()
+	if err := j.f.Close(); err != nil && j.err == nil {
+		j.err = fmt.Errorf("write transcript: %w", err)
+	}
+	return j.err
+}
+
+// jsonlMarkers is the line updating the markers negotiated after the
+// header was written.
+type jsonlMarkers struct {
+	Protocol        string `json:"protocol,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	Codec           string `json:"codec,omitempty"`
+}
+
+// jsonlSummary is the last line of a completed transcript.
+type jsonlSummary struct {
+	Summary TranscriptSummary `json:"summary"`
+}
+
+// closeJSONL completes a FormatJSONL transcript; the caller holds mu.
+func (r *FileRecorder) closeJSONL() error {
+	if r.jsonl == nil && r.err == nil {
+		r.jsonl, r.err = createJSONL(r.path, r.header())
+	}
+	if r.jsonl == nil {
+		return r.err
+	}
+	j := r.jsonl
+	// The window a BufferRing recorder retained.
+	for _, e := range r.entries {
+		if r.err == nil {
+			r.err = j.writeLine(e)
+		}
+	}
+	if r.err == nil && (r.Protocol != j.header.Protocol || r.ProtocolVersion != j.header.ProtocolVersion || r.Codec != j.header.Codec) {
+		r.err = j.writeLine(jsonlMarkers{Protocol: r.Protocol, ProtocolVersion: r.ProtocolVersion, Codec: r.Codec})
+	}
+	if r.err == nil {
+		r.err = j.writeLine(jsonlSummary{Summary: r.summary})
+	}
+	if err := j.close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
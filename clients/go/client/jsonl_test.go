@@ -0,0 +1,71 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscriptFormat(t *testing.T) {
+	for _, tc := range []struct{ path, format, want string }{
+		{"t.json", "", FormatJSON},
+		{"t.jsonl", "", FormatJSONL},
+		{"t.JSONL", "", FormatJSONL},
+		{"t.json", FormatJSONL, FormatJSONL},
+		{"t", "", FormatJSON},
+	} {
+		if got := TranscriptFormat(tc.path, tc.format); got != tc.want {
+			t.Errorf("TranscriptFormat(%q, %q) = %q, want %q", tc.path, tc.format, got, tc.want)
+		}
+	}
+	if err := (RecorderConfig{Format: "yaml"}).Validate(); err == nil {
+		t.Fatal("Validate accepted format yaml")
+	}
+}
+
+func TestFileRecorderJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session", "stdio.jsonl")
+	rec := NewFileRecorder(path, TransportStdio)
+	rec.MTLS = true
+	recordMessage(rec, DirectionRequest, &Request{JSONRPC: JSONRPCVersion, ID: 1, Method: "mcp.ping", Params: json.RawMessage(`{"api_key":"secret"}`)})
+	recordMessage(rec, DirectionResponse, &Response{JSONRPC: JSONRPCVersion, ID: 1, Result: json.RawMessage(`{}`)})
+	// Nothing is buffered in memory: the entries are on their way to disk.
+	if len(rec.entries) != 0 {
+		t.Fatalf("JSONL recorder kept %d entries in memory", len(rec.entries))
+	}
+	rec.MarkSession(SessionMarkers{Transport: TransportStdio, MTLS: true, ProtocolVersion: "2024-11-05"})
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(content, []byte("\n")), []byte("\n"))
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want header, 2 entries, markers, and summary:\n%s", len(lines), content)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if header["transcript_version"] != float64(TranscriptVersion) || header["transport"] != TransportStdio || header["mtls"] != true {
+		t.Fatalf("header = %s", lines[0])
+	}
+	var entry Entry
+	if err := json.Unmarshal(lines[1], &entry); err != nil || entry.Direction != DirectionRequest {
+		t.Fatalf("first entry = %s, %v", lines[1], err)
+	}
+	if bytes.Contains(lines[1], []byte("secret")) {
+		t.Fatalf("credential recorded: %s", lines[1])
+	}
+	if string(lines[3]) != `{"protocol_version":"2024-11-05"}` {
+		t.Fatalf("marker line = %s", lines[3])
+	}
+	if string(lines[4]) != `{"summary":{"messages":2,"requests":1,"responses":1,"failures":0}}` {
+		t.Fatalf("summary line = %s", lines[4])
+	}
+}
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Wire protocols, the values of ClientConfig.WireProtocol.
+const (
+	// WireNative is the protocol of EmbedNexus servers: JSON-RPC 2.0
+	// envelopes extended with a meta member carrying transcript bookkeeping
+	// and, over the transports without headers, the request ID,
+	// idempotency key, credentials, and trace context. It is the default.
+	WireNative = "native"
+	// JSONRPC2 speaks plain JSON-RPC 2.0, for servers and tooling that
+	// reject members the specification does not define. Requests carry
+	// only jsonrpc, id, method, and params; responses must carry exactly
+	// one of result and error. The values meta carries reach the server
+	// only as the headers of the http, tls, and http3 transports.
+	// EmbedBatch sends the chunks it has in flight as one batch over those
+	// transports, and Notify sends notifications over any.
+	JSONRPC2 = "jsonrpc2"
+)
+
+// WithProtocol selects the wire protocol, WireNative, JSONRPC2, or
+// OpenAICompat; see ClientConfig.WireProtocol.
+func WithProtocol(protocol string) Option {
+	return func(o *clientOptions) error {
+		if !validWireProtocol(protocol) {
+			return unknownWireProtocol(protocol)
+		}
+		o.wireProtocol = protocol
+		return nil
+	}
+}
+
+func validWireProtocol(protocol string) bool {
+	return protocol == "" || protocol == WireNative || protocol == JSONRPC2 || protocol == OpenAICompat
+}
+
+func unknownWireProtocol(protocol string) error {
+	return fmt.Errorf("unknown wire protocol %q: want %s, %s, or %s", protocol, WireNative, JSONRPC2, OpenAICompat)
+}
+
+// Error codes of the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Errors matching the standard JSON-RPC 2.0 error codes, in either wire
+// protocol. The *APIError carrying one unwraps to the *RPCError the server
+// sent, whose Data holds the error's data member, whatever its type.
+var (
+	// ErrMethodNotFound matches CodeMethodNotFound.
+	ErrMethodNotFound = errors.New("method not found")
+	// ErrInvalidParams matches CodeInvalidParams.
+	ErrInvalidParams = errors.New("invalid params")
+	// ErrInvalidRequest matches CodeInvalidRequest and CodeParseError: the
+	// server could not read the request as JSON-RPC.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// Wire returns req as it goes on the wire: req itself, or for a JSONRPC2
+// client a copy without Meta.
+func (req *Request) Wire() *Request {
+	if !req.bare || req.Meta == nil {
+		return req
+	}
+	wire := *req
+	wire.Meta = nil
+	return &wire
+}
+
+// checkEnvelope holds a response of a JSONRPC2 client to the
+// specification: version "2.0" and exactly one of result and error.
+func checkEnvelope(resp *Response) error {
+	switch {
+	case resp.JSONRPC != JSONRPCVersion:
+		return fmt.Errorf("response version %q, want %q: %w", resp.JSONRPC, JSONRPCVersion, ErrProtocol)
+	case resp.Result != nil && resp.Error != nil:
+		return fmt.Errorf("response %d carries both a result and an error: %w", resp.ID, ErrProtocol)
+	case resp.Result == nil && resp.Error == nil:
+		return fmt.Errorf("response %d carries neither a result nor an error: %w", resp.ID, ErrProtocol)
+	}
+	return nil
+}
+
+// notification is a request without an ID, which the server does not
+// answer.
+type notification struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Meta    *Meta           `json:"meta,omitempty"`
+}
+
+// notifier is implemented by transports that can send a notification,
+// written, or posted, without waiting for an answer.
+type notifier interface {
+	notify(ctx context.Context, payload []byte) error
+}
+
+// Notify sends method a JSON-RPC notification carrying params, for
+// fire-and-forget messages such as telemetry. It returns once the
+// notification is written to the stream, or once the server accepted the
+// POST over the http transports; nothing reports what the server made of
+// it. Notifications bypass the interceptors, retries, rate limiter, and
+// circuit breaker, and are not counted in Stats; the transcript records
+// each as a request without an ID. A dry run records it without sending.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	if err := c.gate.enter(ctx); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer c.gate.exit(ctx)
+	req, err := newRequest(0, method, params, c.now())
+	if err != nil {
+		return err
+	}
+	n := notification{JSONRPC: JSONRPCVersion, Method: method, Params: req.Params}
+	if c.cfg.WireProtocol != JSONRPC2 {
+		n.Meta = &Meta{Timestamp: req.Meta.Timestamp}
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("%s: encode notification: %w", method, err)
+	}
+	if c.cfg.DryRun {
+		if c.cfg.Recorder != nil {
+			recordMessage(dryRunRecorder{c.cfg.Recorder}, DirectionRequest, n)
+		}
+		return nil
+	}
+	t, ok := c.transport.(notifier)
+	if !ok {
+		return fmt.Errorf("%s: the %s transport cannot send notifications", method, c.transport.Kind())
+	}
+	recordMessage(c.cfg.Recorder, DirectionRequest, n)
+	if c.signer != nil {
+		ctx = c.signBody(ctx, payload)
+	}
+	if err := t.notify(ctx, payload); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return nil
+}
+
+// batchTransport is implemented by transports that can send several
+// requests as one JSON-RPC 2.0 batch.
+type batchTransport interface {
+	// roundTripBatch sends reqs as one batch and returns the responses by
+	// request ID. A batch the server rejects as a whole fails with the
+	// error it answered with.
+	roundTripBatch(ctx context.Context, reqs []*Request) (map[int64]*Response, error)
+}
+
+// rpcBatchSize returns how many chunks of an EmbedBatch call go out as one
+// JSON-RPC 2.0 batch, or zero to send each alone: batches need JSONRPC2
+// over a transport that sends them, and are not signed or dry run. A batch
+// holds no more chunks than MaxInFlight lets through at once, since it
+// waits for all of them.
+func (c *Client) rpcBatchSize(o embedOptions) int {
+	if c.cfg.WireProtocol != JSONRPC2 || c.cfg.DryRun || c.signer != nil {
+		return 0
+	}
+	if _, ok := c.transport.(batchTransport); !ok {
+		return 0
+	}
+	n := o.concurrency
+	if c.cfg.MaxInFlight > 0 {
+		n = min(n, c.cfg.MaxInFlight)
+	}
+	if n < 2 {
+		return 0
+	}
+	return n
+}
+
+// rpcBatch gathers the requests of a group of EmbedBatch chunks into one
+// JSON-RPC 2.0 batch. Each chunk's request passes through the interceptors
+// alone and joins the batch in place of its round trip; the batch goes out
+// once every chunk of the group has joined or finished without a request,
+// such as on a cache hit, with the context and headers of the last request
+// to join.
+type rpcBatch struct {
+	t batchTransport
+
+	mu sync.Mutex
+	// waiting counts the chunks that have neither joined nor finished.
+	waiting int
+	sent    bool
+	calls   []*batchCall
+}
+
+// batchCall is a request waiting in a batch. resp and err are set once
+// done is closed; alone asks the request to go out on its own instead.
+type batchCall struct {
+	req   *Request
+	done  chan struct{}
+	resp  *Response
+	err   error
+	alone bool
+}
+
+// batchMember is the place of one chunk in a batch, carried in the
+// chunk's context.
+type batchMember struct {
+	b *rpcBatch
+	// settled is set once the chunk joined the batch or left it.
+	settled bool
+}
+
+type batchMemberKey struct{}
+
+func newRPCBatch(t batchTransport, chunks int) *rpcBatch {
+	return &rpcBatch{t: t, waiting: chunks}
+}
+
+// inRPCBatch reports whether ctx is that of a chunk sent in a batch, whose
+// request must not be shared with other callers: it is awaited by the
+// batch itself.
+func inRPCBatch(ctx context.Context) bool {
+	return ctx.Value(batchMemberKey{}) != nil
+}
+
+// roundTrip is the round trip of a chunk's request: the first joins the
+// batch, and a retry goes out alone.
+func (m *batchMember) roundTrip(ctx context.Context, t Transport, req *Request) (*Response, error) {
+	b := m.b
+	b.mu.Lock()
+	if m.settled || b.sent {
+		b.mu.Unlock()
+		return t.RoundTrip(ctx, req)
+	}
+	m.settled = true
+	call := &batchCall{req: req, done: make(chan struct{})}
+	b.calls = append(b.calls, call)
+	b.waiting--
+	full := b.waiting == 0
+	b.sent = full
+	b.mu.Unlock()
+	if full {
+		b.send(ctx)
+	}
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.alone {
+		return t.RoundTrip(ctx, req)
+	}
+	return call.resp, call.err
+}
+
+// leave settles a chunk that finished, sending the batch if the chunk was
+// the last it waited for.
+func (m *batchMember) leave(ctx context.Context) {
+	b := m.b
+	b.mu.Lock()
+	if m.settled || b.sent {
+		b.mu.Unlock()
+		return
+	}
+	m.settled = true
+	b.waiting--
+	full := b.waiting == 0 && len(b.calls) > 0
+	b.sent = full
+	b.mu.Unlock()
+	if full {
+		b.send(ctx)
+	}
+}
+
+// send sends the batch and hands each call its response. A lone request
+// goes out as it is, and a server that rejects the batch as a whole as an
+// invalid request gets the requests one at a time.
+func (b *rpcBatch) send(ctx context.Context) {
+	if len(b.calls) == 1 {
+		b.calls[0].alone = true
+		close(b.calls[0].done)
+		return
+	}
+	reqs := make([]*Request, len(b.calls))
+	for i, call := range b.calls {
+		reqs[i] = call.req
+	}
+	resps, err := b.t.roundTripBatch(ctx, reqs)
+	for _, call := range b.calls {
+		switch {
+		case errors.Is(err, ErrInvalidRequest):
+			call.alone = true
+		case err != nil:
+			call.err = err
+		default:
+			if call.resp = resps[call.req.ID]; call.resp == nil {
+				call.err = fmt.Errorf("batch response holds no answer to request %d: %w", call.req.ID, ErrProtocol)
+			}
+		}
+		close(call.done)
+	}
+}
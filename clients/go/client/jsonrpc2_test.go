@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// envelopeKeys returns the sorted member names of a JSON object.
+func envelopeKeys(t *testing.T, raw []byte) string {
+	t.Helper()
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		t.Fatalf("envelope %s: %v", raw, err)
+	}
+	keys := make([]string, 0, len(members))
+	for k := range members {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestJSONRPC2Envelopes(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	var requestIDs []string
+	answer := map[string]string{
+		"mcp.missing": `{"jsonrpc":"2.0","id":%d,"error":{"code":-32601,"message":"no such method","data":"try mcp.embed"}}`,
+		"mcp.legacy":  `{"id":%d,"result":{}}`,
+		"mcp.both":    `{"jsonrpc":"2.0","id":%d,"result":{},"error":{"code":1,"message":"x"}}`,
+		"mcp.silent":  `{"jsonrpc":"2.0","id":%d}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+		mu.Unlock()
+		var req Request
+		_ = json.Unmarshal(body, &req)
+		w.Header().Set("Content-Type", "application/json")
+		if format, ok := answer[req.Method]; ok {
+			_, _ = io.WriteString(w, strings.Replace(format, "%d", string(mustJSON(t, req.ID)), 1))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(defaultHandler(&req))
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithProtocol(JSONRPC2))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+
+	if v, err := c.Embed(ctx, "hello"); err != nil || v[0] != 5 {
+		t.Fatalf("Embed: %v, %v", v, err)
+	}
+	// The request carries the members of the specification alone; the
+	// request ID rides in its header.
+	if got := envelopeKeys(t, bodies[0]); got != "id,jsonrpc,method,params" {
+		t.Fatalf("request members %s", got)
+	}
+	if requestIDs[0] == "" {
+		t.Fatal("request ID header missing")
+	}
+
+	err = c.Call(ctx, "mcp.missing", nil, nil)
+	var rpcErr *RPCError
+	if !errors.Is(err, ErrMethodNotFound) || !errors.As(err, &rpcErr) || string(rpcErr.Data) != `"try mcp.embed"` {
+		t.Fatalf("method not found: %v", err)
+	}
+	if errors.Is(err, ErrInvalidParams) || ErrorClass(err) != "api" {
+		t.Fatalf("method not found classed as %s", ErrorClass(err))
+	}
+	for _, method := range []string{"mcp.legacy", "mcp.both", "mcp.silent"} {
+		if err := c.Call(ctx, method, nil, nil); !errors.Is(err, ErrProtocol) {
+			t.Errorf("%s: %v, want ErrProtocol", method, err)
+		}
+	}
+
+	// Natively, the same responses are taken as they come.
+	native, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer native.Close(context.Background())
+	if err := native.Call(ctx, "mcp.legacy", nil, nil); err != nil {
+		t.Fatalf("native call: %v", err)
+	}
+	if got := envelopeKeys(t, bodies[len(bodies)-1]); got != "id,jsonrpc,meta,method" {
+		t.Fatalf("native request members %s", got)
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// batchHTTPServer answers single requests and batches with defaultHandler,
+// the responses of a batch in reverse order, and counts both; reject makes
+// it fail batches as a whole.
+type batchHTTPServer struct {
+	reject bool
+
+	mu      sync.Mutex
+	singles int
+	batches []int
+}
+
+func (s *batchHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	if !bytes.HasPrefix(body, []byte("[")) {
+		var req Request
+		_ = json.Unmarshal(body, &req)
+		s.mu.Lock()
+		s.singles++
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(defaultHandler(&req))
+		return
+	}
+	if s.reject {
+		_, _ = io.WriteString(w, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batches are not supported"}}`)
+		return
+	}
+	var reqs []*Request
+	_ = json.Unmarshal(body, &reqs)
+	s.mu.Lock()
+	s.batches = append(s.batches, len(reqs))
+	s.mu.Unlock()
+	resps := make([]*Response, len(reqs))
+	for i, req := range reqs {
+		resps[len(reqs)-1-i] = defaultHandler(req)
+	}
+	_ = json.NewEncoder(w).Encode(resps)
+}
+
+func TestJSONRPC2BatchesEmbedBatch(t *testing.T) {
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff", "ggggggg", "hhhhhhhh"}
+	for _, reject := range []bool{false, true} {
+		s := &batchHTTPServer{reject: reject}
+		srv := httptest.NewServer(s)
+		c, err := NewClient(srv.URL, WithProtocol(JSONRPC2))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		out, err := c.EmbedBatch(context.Background(), texts, WithBatchSize(2), WithConcurrency(4))
+		c.Close(context.Background())
+		srv.Close()
+		if err != nil {
+			t.Fatalf("EmbedBatch (reject %t): %v", reject, err)
+		}
+		for i, v := range out {
+			if int(v[0]) != len(texts[i]) {
+				t.Fatalf("vector %d is %v, for %q", i, v, texts[i])
+			}
+		}
+		// The four chunks go out as one batch, or one at a time to a
+		// server that rejects batches.
+		if reject {
+			if s.singles != 4 || len(s.batches) != 0 {
+				t.Fatalf("%d single requests and batches of %v, want 4 single", s.singles, s.batches)
+			}
+		} else if s.singles != 0 || len(s.batches) != 1 || s.batches[0] != 4 {
+			t.Fatalf("%d single requests and batches of %v, want one of 4", s.singles, s.batches)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	notified := make(chan Request, 1)
+	rec := &markingRecorder{}
+	c, err := New(ClientConfig{Transport: TransportInProc, WireProtocol: JSONRPC2, Recorder: rec, Handler: func(req Request) (Response, error) {
+		if req.Method == "telemetry.event" {
+			notified <- req
+			return Response{}, errors.New("not answered")
+		}
+		return *defaultHandler(&req), nil
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Notify(context.Background(), "telemetry.event", map[string]int{"count": 3}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if req := <-notified; req.ID != 0 || string(req.Params) != `{"count":3}` {
+		t.Fatalf("server got %+v", req)
+	}
+	// No response answers the notification, so the stream stays in step.
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping after a notification: %v", err)
+	}
+	if len(rec.entries) != 3 {
+		t.Fatalf("recorded %d entries, want 3", len(rec.entries))
+	}
+	if got := envelopeKeys(t, rec.entries[0].Message); got != "jsonrpc,method,params" {
+		t.Fatalf("recorded notification members %s", got)
+	}
+	if got := envelopeKeys(t, rec.entries[1].Message); got != "id,jsonrpc,method,params" {
+		t.Fatalf("recorded request members %s", got)
+	}
+
+	// Over http the server accepts it with an empty answer.
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	hc, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer hc.Close(context.Background())
+	if err := hc.Notify(context.Background(), "telemetry.event", nil); err != nil {
+		t.Fatalf("Notify over http: %v", err)
+	}
+	if got := envelopeKeys(t, body); got != "jsonrpc,meta,method" {
+		t.Fatalf("posted notification members %s", got)
+	}
+}
+
+func TestJSONRPC2TranscriptMarker(t *testing.T) {
+	rec := &markingRecorder{}
+	err := RunPing(context.Background(), Options{
+		Config: ClientConfig{Transport: TransportInProc, WireProtocol: JSONRPC2, Handler: func(Request) (Response, error) {
+			return Response{Result: json.RawMessage(`{"ok":true}`)}, nil
+		}},
+		TranscriptRecorder: rec,
+		Stdout:             io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("RunPing: %v", err)
+	}
+	if rec.markers.WireProtocol != JSONRPC2 {
+		t.Fatalf("markers = %+v", rec.markers)
+	}
+	if got := envelopeKeys(t, rec.entries[0].Message); got != "id,jsonrpc,method,params" {
+		t.Fatalf("recorded request members %s", got)
+	}
+
+	if err := (ClientConfig{Transport: TransportInProc, WireProtocol: "xml-rpc"}).Validate(); err == nil {
+		t.Fatal("Validate accepted an unknown wire protocol")
+	}
+	if _, err := NewClient("", WithProtocol("xml-rpc")); err == nil {
+		t.Fatal("WithProtocol accepted an unknown wire protocol")
+	}
+}
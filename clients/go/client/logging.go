@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"time"
+)
+
+// discardHandler drops every record. It backs the logger of a client
+// configured without ClientConfig.Logger.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// logger returns ClientConfig.Logger with every record tagged with the
+// transport, or a logger discarding everything when none is set.
+func (cfg ClientConfig) logger() *slog.Logger {
+	if cfg.Logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return cfg.Logger.With("transport", cfg.Transport)
+}
+
+// logDial reports a connection attempt to target that started at start.
+// A nil log drops it.
+func logDial(ctx context.Context, log *slog.Logger, target string, start time.Time, err error) {
+	if log == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.String("target", target), slog.Duration("elapsed", time.Since(start))}
+	if err != nil {
+		log.LogAttrs(ctx, slog.LevelInfo, "dial failed", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	log.LogAttrs(ctx, slog.LevelInfo, "dialed", attrs...)
+}
+
+// logTLS reports the TLS session negotiated with the server.
+func logTLS(log *slog.Logger, cs tls.ConnectionState) {
+	log.Info("tls handshake", "server_name", cs.ServerName, "version", tls.VersionName(cs.Version), "cipher_suite", tls.CipherSuiteName(cs.CipherSuite), "alpn", cs.NegotiatedProtocol)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logRecords collects the records of a JSON slog handler.
+type logRecords struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logRecords) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *logRecords) decode(t *testing.T) []map[string]any {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(l.buf.String()), "\n") {
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLoggerRecordsDialsHandshakesAndRequests(t *testing.T) {
+	ca := newTestCA(t, "internal-ca")
+	srv, _ := newTLSServer(t, ca)
+	run := func(level slog.Level, bodies bool) []map[string]any {
+		t.Helper()
+		logs := &logRecords{}
+		c, err := New(ClientConfig{
+			Transport:  TransportTLS,
+			Endpoint:   srv.URL,
+			TLSCAFiles: []string{writeCABundle(t, ca)},
+			Logger:     slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: level})),
+			LogBodies:  bodies,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if _, err := c.Embed(context.Background(), "confidential input"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		c.Close(context.Background())
+		return logs.decode(t)
+	}
+
+	byMsg := func(records []map[string]any) map[string]map[string]any {
+		m := make(map[string]map[string]any)
+		for _, r := range records {
+			if r["transport"] != TransportTLS {
+				t.Fatalf("record without the transport: %v", r)
+			}
+			m[r["msg"].(string)] = r
+		}
+		return m
+	}
+	info := byMsg(run(slog.LevelInfo, false))
+	if _, ok := info["dialed"]; !ok {
+		t.Fatalf("no dial record in %v", info)
+	}
+	if hs := info["tls handshake"]; hs == nil || !strings.HasPrefix(hs["version"].(string), "TLS 1.") {
+		t.Fatalf("tls handshake record %v", hs)
+	}
+	if _, ok := info["mcp request"]; ok {
+		t.Fatal("requests logged at info level")
+	}
+
+	debug := run(slog.LevelDebug, false)
+	req := byMsg(debug)["mcp request"]
+	if req == nil || req["method"] != MethodEmbed || req["request_id"] == nil || req["request_bytes"].(float64) <= 0 || req["response_bytes"].(float64) <= 0 {
+		t.Fatalf("request record %v", req)
+	}
+	for _, r := range debug {
+		if line, _ := json.Marshal(r); strings.Contains(string(line), "confidential input") {
+			t.Fatalf("logged a payload without LogBodies: %s", line)
+		}
+	}
+
+	req = byMsg(run(slog.LevelDebug, true))["mcp request"]
+	if body, _ := req["request_body"].(string); !strings.Contains(body, "confidential input") || req["response_body"] == nil {
+		t.Fatalf("LogBodies record %v", req)
+	}
+}
+
+func TestClientWithoutLoggerLogsNothing(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(context.Background())
+	if c.log == nil || c.log.Enabled(context.Background(), slog.LevelError) {
+		t.Fatal("a client without a logger has an enabled one")
+	}
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+}
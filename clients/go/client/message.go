@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSONRPCVersion is the protocol marker carried by every envelope.
+const JSONRPCVersion = "2.0"
+
+// Meta carries the transcript bookkeeping attached to each envelope.
+type Meta struct {
+	Timestamp string `json:"timestamp"`
+	Sequence  int64  `json:"sequence"`
+	// ClientDimensions is set on embed requests whose vectors the client
+	// truncates to this length itself; see WithDimensions.
+	ClientDimensions int `json:"client_dimensions,omitempty"`
+	// IdempotencyKey identifies one logical request across retries so the
+	// server can deduplicate them. Calls to methods that are not idempotent
+	// get a generated key; see WithIdempotencyKey.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Authorization carries ClientConfig.APIKey, as "Bearer <key>", over
+	// the transports without headers. It is attached after the transcript
+	// recorder has seen the request; see ClientConfig.APIKey.
+	Authorization string `json:"authorization,omitempty"`
+	// Traceparent and Tracestate carry the W3C trace context of a traced
+	// request over the transports without headers; see
+	// ClientConfig.TracerProvider.
+	Traceparent string `json:"traceparent,omitempty"`
+	Tracestate  string `json:"tracestate,omitempty"`
+	// RequestID identifies the call to the server's logs on a request, and
+	// may carry the server's own ID on a response; see WithRequestID.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Request is a JSON-RPC 2.0 request envelope.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Meta    *Meta           `json:"meta,omitempty"`
+
+	// bare marks a request of a JSONRPC2 client, whose Meta stays off the
+	// wire; see Wire.
+	bare bool
+	// body, when set, is sent over http in place of the encoded request:
+	// the array of a JSON-RPC 2.0 batch, or a notification.
+	body []byte
+	// mediaType is the Content-Type of a body in a codec other than JSON.
+	mediaType string
+	// options are the per-call options of the call sending it; see
+	// Options.
+	options *RequestOptions
+}
+
+// Response is a JSON-RPC 2.0 response envelope.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	Meta    *Meta           `json:"meta,omitempty"`
+
+	// ServerRequestID is the X-Request-Id header of an http response.
+	ServerRequestID string `json:"-"`
+}
+
+// RPCError is the error object returned by the server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func newRequest(id int64, method string, params any, now time.Time) (*Request, error) {
+	req := &Request{
+		JSONRPC: JSONRPCVersion,
+		ID:      id,
+		Method:  method,
+		Meta: &Meta{
+			Timestamp: now.UTC().Format(time.RFC3339),
+			Sequence:  id,
+		},
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s params: %w", method, err)
+		}
+		req.Params = raw
+	}
+	return req, nil
+}
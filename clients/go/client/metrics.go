@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metric names reported to a MetricsSink. They and their labels are stable:
+// a rename is a breaking change.
+const (
+	// MetricRequests counts requests sent, each retry included, by method,
+	// transport, and status: "ok" or the ErrorClass of the failure.
+	MetricRequests = "embednexus_client_requests_total"
+	// MetricRequestDuration is a histogram of request latency in seconds,
+	// by method and transport.
+	MetricRequestDuration = "embednexus_client_request_duration_seconds"
+	// MetricRequestsInFlight gauges the requests awaiting an answer, open
+	// streams included, by transport.
+	MetricRequestsInFlight = "embednexus_client_requests_in_flight"
+	// MetricRetries counts retries, by method and transport.
+	MetricRetries = "embednexus_client_retries_total"
+	// MetricHedges counts the hedges sent under ClientConfig.Hedging, and
+	// MetricHedgeWins those answering first, by method and transport.
+	MetricHedges    = "embednexus_client_hedges_total"
+	MetricHedgeWins = "embednexus_client_hedge_wins_total"
+	// MetricCacheHits and MetricCacheMisses count embedding cache lookups,
+	// by transport.
+	MetricCacheHits   = "embednexus_client_cache_hits_total"
+	MetricCacheMisses = "embednexus_client_cache_misses_total"
+	// MetricSentBytes and MetricReceivedBytes count the bytes of request
+	// params and of response results and errors, before any compression,
+	// by method and transport.
+	MetricSentBytes     = "embednexus_client_sent_bytes_total"
+	MetricReceivedBytes = "embednexus_client_received_bytes_total"
+	// MetricSpoolDepth gauges the entries of ClientConfig.Spool awaiting
+	// replay, and MetricSpoolReplayLag is a histogram of how long, in
+	// seconds, each waited from being spooled to its result, by transport.
+	MetricSpoolDepth     = "embednexus_client_spool_depth"
+	MetricSpoolReplayLag = "embednexus_client_spool_replay_lag_seconds"
+)
+
+// Metric label names.
+const (
+	LabelMethod    = "method"
+	LabelTransport = "transport"
+	LabelStatus    = "status"
+)
+
+// MetricHelp returns the help text describing the metric called name, or
+// "" for a name that is not a Metric constant.
+func MetricHelp(name string) string { return metricHelp[name] }
+
+// metricHelp describes each metric for exposition.
+var metricHelp = map[string]string{
+	MetricRequests:         "Requests sent, by method, transport, and status class.",
+	MetricRequestDuration:  "Request latency in seconds.",
+	MetricRequestsInFlight: "Requests awaiting an answer.",
+	MetricRetries:          "Requests retried.",
+	MetricHedges:           "Hedged copies of slow requests sent.",
+	MetricHedgeWins:        "Hedged copies answering before the request they copied.",
+	MetricCacheHits:        "Embedding cache hits.",
+	MetricCacheMisses:      "Embedding cache misses.",
+	MetricSentBytes:        "Bytes of request params sent.",
+	MetricReceivedBytes:    "Bytes of response results and errors received.",
+	MetricSpoolDepth:       "Spooled embed calls awaiting replay.",
+	MetricSpoolReplayLag:   "Seconds from spooling an embed call to its replayed result.",
+}
+
+// MetricsSink receives a client's metrics; see the Metric constants for the
+// names and labels. PrometheusSink is one, embedprometheus.Sink registers
+// the metrics with a client_golang registry, and adapting another metrics
+// system takes an implementation of these three methods. They are called
+// on the request path, concurrently, so they should be quick.
+type MetricsSink interface {
+	// AddCounter adds delta, never negative, to a counter.
+	AddCounter(name string, labels []Label, delta float64)
+	// AddGauge adds delta, which may be negative, to a gauge.
+	AddGauge(name string, labels []Label, delta float64)
+	// ObserveHistogram records value in a histogram.
+	ObserveHistogram(name string, labels []Label, value float64)
+}
+
+// Label is a metric label.
+type Label struct {
+	Name, Value string
+}
+
+// WithMetrics sets ClientConfig.Metrics, reporting every request to sink.
+func WithMetrics(sink MetricsSink) Option {
+	return func(o *clientOptions) error {
+		if sink == nil {
+			return errors.New("WithMetrics: metrics sink must not be nil")
+		}
+		o.metrics = sink
+		return nil
+	}
+}
+
+// clientMetrics reports a client's activity to its Stats and, when set, to
+// ClientConfig.Metrics.
+type clientMetrics struct {
+	stats     *runtimeStats
+	sink      MetricsSink
+	transport []Label
+}
+
+func newClientMetrics(sink MetricsSink, transport string) *clientMetrics {
+	return &clientMetrics{stats: newRuntimeStats(), sink: sink, transport: []Label{{LabelTransport, transport}}}
+}
+
+func (m *clientMetrics) labels(method string) []Label {
+	return []Label{{LabelMethod, method}, m.transport[0]}
+}
+
+// begin counts a request in flight; the returned func ends it with its
+// outcome err.
+func (m *clientMetrics) begin(method string) func(err error) {
+	start := time.Now()
+	if m.sink != nil {
+		m.sink.AddGauge(MetricRequestsInFlight, m.transport, 1)
+	}
+	return func(err error) {
+		elapsed := time.Since(start)
+		m.stats.request(method, err, elapsed)
+		if m.sink == nil {
+			return
+		}
+		m.sink.AddGauge(MetricRequestsInFlight, m.transport, -1)
+		labels := m.labels(method)
+		m.sink.ObserveHistogram(MetricRequestDuration, labels, elapsed.Seconds())
+		status := "ok"
+		if err != nil {
+			status = ErrorClass(err)
+		}
+		m.sink.AddCounter(MetricRequests, append(labels, Label{LabelStatus, status}), 1)
+	}
+}
+
+func (m *clientMetrics) retried(method string) {
+	m.stats.retried()
+	if m.sink != nil {
+		m.sink.AddCounter(MetricRetries, m.labels(method), 1)
+	}
+}
+
+func (m *clientMetrics) hedged(method string) {
+	m.stats.hedged(false)
+	if m.sink != nil {
+		m.sink.AddCounter(MetricHedges, m.labels(method), 1)
+	}
+}
+
+func (m *clientMetrics) hedgeWon(method string) {
+	m.stats.hedged(true)
+	if m.sink != nil {
+		m.sink.AddCounter(MetricHedgeWins, m.labels(method), 1)
+	}
+}
+
+func (m *clientMetrics) cacheLookup(hit bool) {
+	m.stats.cacheLookup(hit)
+	switch {
+	case m.sink == nil:
+	case hit:
+		m.sink.AddCounter(MetricCacheHits, m.transport, 1)
+	default:
+		m.sink.AddCounter(MetricCacheMisses, m.transport, 1)
+	}
+}
+
+// spoolDepth adds delta to the entries awaiting replay.
+func (m *clientMetrics) spoolDepth(delta int) {
+	if m.sink != nil && delta != 0 {
+		m.sink.AddGauge(MetricSpoolDepth, m.transport, float64(delta))
+	}
+}
+
+// spooled counts a call spooled, and spoolReplayed one replayed after
+// waiting lag.
+func (m *clientMetrics) spooled() {
+	m.stats.spooled()
+	m.spoolDepth(1)
+}
+
+func (m *clientMetrics) spoolReplayed(lag time.Duration) {
+	m.stats.spoolReplayed(lag)
+	m.spoolDepth(-1)
+	if m.sink != nil {
+		m.sink.ObserveHistogram(MetricSpoolReplayLag, m.transport, lag.Seconds())
+	}
+}
+
+// sent and received count the params of a request and the result or error
+// of a response of method.
+func (m *clientMetrics) sent(method string, req *Request) {
+	m.addBytes(MetricSentBytes, method, requestBytes(req))
+}
+
+func (m *clientMetrics) received(method string, resp *Response) {
+	if resp == nil {
+		return
+	}
+	m.addBytes(MetricReceivedBytes, method, responseBytes(resp))
+}
+
+// requestBytes and responseBytes are the sizes the byte counters count:
+// the params of req, and the result or error of resp, 0 when it is nil.
+func requestBytes(req *Request) int {
+	return len(req.Params)
+}
+
+func responseBytes(resp *Response) int {
+	if resp == nil {
+		return 0
+	}
+	n := len(resp.Result)
+	if resp.Error != nil {
+		n += len(resp.Error.Message) + len(resp.Error.Data)
+	}
+	return n
+}
+
+func (m *clientMetrics) addBytes(name, method string, n int) {
+	m.stats.addBytes(name == MetricSentBytes, int64(n))
+	if m.sink != nil {
+		m.sink.AddCounter(name, m.labels(method), float64(n))
+	}
+}
+
+// interceptMetrics counts each request sent in Stats and reports it to
+// ClientConfig.Metrics. It runs first in the direct chain, so every attempt
+// counts.
+func (c *Client) interceptMetrics(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	done := c.metrics.begin(req.Method)
+	resp, err := next(ctx, req)
+	done(callError(resp, err))
+	return resp, err
+}
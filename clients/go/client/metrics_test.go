@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsPrometheus(t *testing.T) {
+	var flaky atomic.Int32
+	sink := NewPrometheusSink()
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: inprocHandler(func(req *Request) *Response {
+			if req.Method == "test.flaky" {
+				if flaky.Add(1) == 1 {
+					return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32050, Message: "warming up", Data: []byte(`{"retryable":true}`)}}
+				}
+				return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: []byte(`{}`)}
+			}
+			return defaultHandler(req)
+		}),
+		Retry:   RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		Cache:   CacheConfig{MaxEntries: 10},
+		Metrics: sink,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 2; i++ {
+		if _, err := c.Embed(context.Background(), "cached"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	if err := c.Call(context.Background(), "test.flaky", nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	sink.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	scrape := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE embednexus_client_requests_total counter",
+		`embednexus_client_requests_total{method="mcp.embed",transport="inproc",status="ok"} 1`,
+		`embednexus_client_requests_total{method="test.flaky",transport="inproc",status="api"} 1`,
+		`embednexus_client_requests_total{method="test.flaky",transport="inproc",status="ok"} 1`,
+		`embednexus_client_requests_total{method="mcp.ping",transport="inproc",status="ok"} 1`,
+		`embednexus_client_retries_total{method="test.flaky",transport="inproc"} 1`,
+		`embednexus_client_cache_hits_total{transport="inproc"} 1`,
+		`embednexus_client_cache_misses_total{transport="inproc"} 1`,
+		"# TYPE embednexus_client_requests_in_flight gauge",
+		`embednexus_client_requests_in_flight{transport="inproc"} 0`,
+		"# TYPE embednexus_client_request_duration_seconds histogram",
+		`embednexus_client_request_duration_seconds_bucket{method="test.flaky",transport="inproc",le="+Inf"} 2`,
+		`embednexus_client_request_duration_seconds_count{method="test.flaky",transport="inproc"} 2`,
+		`embednexus_client_sent_bytes_total{method="mcp.embed",transport="inproc"} `,
+		`embednexus_client_received_bytes_total{method="mcp.embed",transport="inproc"} `,
+	} {
+		if !strings.Contains(scrape, want) {
+			t.Errorf("scrape misses %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Log(scrape)
+	}
+}
+
+func TestPrometheusSinkFormat(t *testing.T) {
+	sink := NewPrometheusSinkBuckets([]float64{1, 0.5})
+	labels := []Label{{"path", `a"b\c` + "\n"}}
+	sink.ObserveHistogram("h", labels, 0.75)
+	sink.ObserveHistogram("h", labels, 2)
+	sink.AddGauge("g", nil, 3)
+	sink.AddGauge("g", nil, -1)
+	var out strings.Builder
+	if _, err := sink.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE g gauge
+g 2
+# TYPE h histogram
+h_bucket{path="a\"b\\c\n",le="0.5"} 0
+h_bucket{path="a\"b\\c\n",le="1"} 1
+h_bucket{path="a\"b\\c\n",le="+Inf"} 2
+h_sum{path="a\"b\\c\n"} 2.75
+h_count{path="a\"b\\c\n"} 2
+`
+	if out.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ModelInfo describes an embedding model served by the server.
+type ModelInfo struct {
+	Name string `json:"name"`
+	// Dimension is the length of the vectors the model produces, or 0 when
+	// the listing does not say, as that of an OpenAICompat server does not.
+	Dimension int `json:"dimension"`
+	// MaxInputTokens is the longest input the model accepts, or 0 when the
+	// server does not say.
+	MaxInputTokens int           `json:"max_input_tokens,omitempty"`
+	Features       ModelFeatures `json:"features"`
+	// Source is the endpoint that listed the model, set by ListModels with
+	// WithAllRoutes.
+	Source string `json:"source,omitempty"`
+}
+
+// ModelFeatures lists the optional embedding features a model supports.
+type ModelFeatures struct {
+	// Normalization reports whether the server can return unit-length
+	// vectors.
+	Normalization bool `json:"normalization"`
+	// Truncation reports whether over-long inputs can be truncated instead
+	// of rejected.
+	Truncation bool `json:"truncation"`
+	// Dimensions reports whether the server truncates vectors to the
+	// dimension requested with WithDimensions itself.
+	Dimensions bool `json:"dimensions,omitempty"`
+	// DTypes lists the vector encodings on offer, such as "float32".
+	DTypes []string `json:"dtypes,omitempty"`
+}
+
+type listModelsResult struct {
+	Models []ModelInfo `json:"models"`
+	pageLinks
+}
+
+// ListModels returns the models the server exposes, following every page of
+// the listing. The answer is cached for ClientConfig.ValidateModel and the
+// other features needing the models' capabilities, as
+// ClientConfig.Capabilities says. With
+// WithAllRoutes the models of every WithModelRoute endpoint follow.
+func (c *Client) ListModels(ctx context.Context, opts ...ListOption) ([]ModelInfo, error) {
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.allRoutes {
+		return c.listAllRoutes(ctx)
+	}
+	return c.listModels(ctx, opts...)
+}
+
+// listModels lists every page of the models and caches the list.
+func (c *Client) listModels(ctx context.Context, opts ...ListOption) ([]ModelInfo, error) {
+	models, err := collectAll(c.Models(ctx, opts...))
+	if err != nil {
+		return nil, err
+	}
+	if models == nil {
+		models = []ModelInfo{}
+	}
+	c.capabilities.store(models, c.now())
+	return models, nil
+}
+
+// modelTableColumns are the columns of an OutputTable listing of models
+// that selects none.
+var modelTableColumns = []string{"name", "dimension", "max_input_tokens", "features.normalization", "features.truncation", "features.dtypes"}
+
+// RunModels initializes a session with the server described by opts and
+// writes the models it lists to opts.Stdout as opts.Output renders them:
+// one array for OutputJSON, and otherwise a record per model, an
+// OutputTable showing modelTableColumns unless opts.Output.Columns says
+// otherwise.
+func RunModels(ctx context.Context, opts Options) (err error) {
+	if opts.DryRun {
+		return opts.dryRun(ctx, RunModels)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p, ok := c.transport.(interface{ protocol() string }); ok {
+			markers.Protocol = p.protocol()
+		}
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	if _, err := c.Initialize(ctx); err != nil {
+		return err
+	}
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.Stdout == nil {
+		return nil
+	}
+	records := make([]any, len(models))
+	for i, m := range models {
+		records[i] = m
+	}
+	out := opts.Output
+	out.Indent = "  "
+	if out.Format == OutputTable && len(out.Columns) == 0 {
+		out.Columns = modelTableColumns
+	}
+	if err := out.Render(opts.Stdout, models, records); err != nil {
+		return fmt.Errorf("write models: %w", err)
+	}
+	return nil
+}
+
+// Models iterates over the models the server exposes, fetching a page of
+// the listing at a time; see WithPageSize.
+func (c *Client) Models(ctx context.Context, opts ...ListOption) *Iterator[ModelInfo] {
+	return newIterator(ctx, func(ctx context.Context, token pageToken, pageSize int) ([]ModelInfo, pageToken, error) {
+		var result listModelsResult
+		next, err := c.listPage(ctx, MethodListModels, token, pageSize, &result)
+		return result.Models, next, err
+	}, opts)
+}
+
+// validateModel checks model against the server's model list, fetching it
+// on first use.
+func (c *Client) validateModel(ctx context.Context, model string) error {
+	_, err := c.lookupModel(ctx, model)
+	return err
+}
+
+// lookupModel returns the server's description of model, listing the models
+// on first use and as ClientConfig.Capabilities says. A model missing from
+// a list fetched before this call has it listed again, in case the server
+// has started serving it since.
+func (c *Client) lookupModel(ctx context.Context, model string) (ModelInfo, error) {
+	models, fresh, err := c.currentModels(ctx)
+	for attempt := 0; ; attempt++ {
+		if err != nil {
+			return ModelInfo{}, fmt.Errorf("validate model: %w", err)
+		}
+		for _, m := range models {
+			if m.Name == model {
+				return m, nil
+			}
+		}
+		if fresh || attempt > 0 {
+			return ModelInfo{}, fmt.Errorf("model %q is not served (%d models listed): %w", model, len(models), ErrModelNotFound)
+		}
+		models, err = c.refreshCapabilities(ctx)
+	}
+}
+
+// knownDimension returns the length of the vectors an embed request for
+// model will return: dimensions when the server truncates to it, else the
+// model's dimension if a model list is cached, else 0. It never contacts
+// the server.
+func (c *Client) knownDimension(model string, dimensions int) int {
+	if dimensions > 0 {
+		return dimensions
+	}
+	for _, m := range c.capabilities.cached() {
+		if m.Name == model {
+			return m.Dimension
+		}
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListModelsAcrossTransports(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+
+	configs := map[string]ClientConfig{
+		"stdio":  {Command: helperCommand(t)},
+		"http":   {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"ws":     {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		"inproc": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			models, err := c.ListModels(context.Background())
+			if err != nil {
+				t.Fatalf("ListModels: %v", err)
+			}
+			if !reflect.DeepEqual(models, fakeModels) {
+				t.Fatalf("got %+v, want %+v", models, fakeModels)
+			}
+		})
+	}
+}
+
+func TestEmbedBatchValidateModel(t *testing.T) {
+	stub, sent := embedStub()
+	c := NewWithTransport(ClientConfig{Model: "text-embedding-3-small", ValidateModel: true, MaxBatchSize: 8}, stub)
+	if _, err := c.EmbedBatch(context.Background(), []string{"a", "b"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if _, err := c.EmbedBatch(context.Background(), []string{"c"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	// One listing, cached for the second batch, then one embed per batch.
+	if stub.calls.Load() != 3 {
+		t.Fatalf("expected 3 round trips, got %d", stub.calls.Load())
+	}
+
+	unknown := NewWithTransport(ClientConfig{Model: "no-such-model", ValidateModel: true}, stub)
+	before := len(sent())
+	_, err := unknown.EmbedBatch(context.Background(), []string{"a"})
+	if !errors.Is(err, ErrModelNotFound) || !strings.Contains(err.Error(), "no-such-model") {
+		t.Fatalf("expected ErrModelNotFound, got %v", err)
+	}
+	// Only the listing was sent.
+	if got := sent(); len(got) != before+1 || got[len(got)-1] != nil {
+		t.Fatalf("inputs were sent for an unknown model: %v", got[before:])
+	}
+}
+
+func TestRunRecordsModelsFixture(t *testing.T) {
+	dir := t.TempDir()
+	session, models := filepath.Join(dir, "stdio.json"), filepath.Join(dir, "stdio", "models.json")
+	var out strings.Builder
+	err := Run(context.Background(), Options{
+		Config:           ClientConfig{Transport: TransportStdio, Command: helperCommand(t)},
+		RecordTranscript: session,
+		RecordModels:     models,
+		Stdout:           &out,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	read := func(path string) transcriptFile {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read transcript: %v", err)
+		}
+		var doc transcriptFile
+		if err := json.Unmarshal(content, &doc); err != nil {
+			t.Fatalf("decode transcript: %v", err)
+		}
+		return doc
+	}
+	if doc := read(session); doc.Kind != "" || len(doc.Messages) != 6 {
+		t.Fatalf("session transcript should keep only the handshake sequence, got kind %q and %d entries", doc.Kind, len(doc.Messages))
+	}
+	doc := read(models)
+	if doc.Kind != FixtureModels || doc.Transport != TransportStdio || len(doc.Messages) != 2 {
+		t.Fatalf("unexpected models transcript %+v", doc)
+	}
+	var req Request
+	if err := json.Unmarshal(doc.Messages[0].Message, &req); err != nil || req.Method != MethodListModels {
+		t.Fatalf("unexpected models request %s", doc.Messages[0].Message)
+	}
+
+	var summary SessionSummary
+	if err := json.Unmarshal([]byte(out.String()), &summary); err != nil || len(summary.Models) != len(fakeModels) {
+		t.Fatalf("summary lacks the models: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,741 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MsgPackCodec carries envelopes as MessagePack. A value encodes as the
+// MessagePack counterpart of its JSON, maps with their keys sorted, but for
+// []byte and []float32, vectors among them, which travel as bin: the bytes,
+// or the little-endian IEEE 754 float32 components. json.Marshaler values,
+// such as the params of a Request, encode as the value their JSON holds.
+//
+// Decoding goes through JSON, which the values are then unmarshaled from:
+// a bin becomes the base64 string of its bytes, which vectors and []byte
+// read back, so the Result of a Response is the JSON a transcript records.
+// Maps with keys other than strings, extension types, and non-finite
+// floats have no JSON and fail to decode. Its ContentType is
+// application/msgpack.
+var MsgPackCodec Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return CodecMsgPack }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var e msgpackEncoder
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return e.buf, nil
+}
+
+func (msgpackCodec) ContentType() string { return "application/" + CodecMsgPack }
+
+func (c msgpackCodec) Unmarshal(data []byte, v any) error {
+	if resp, ok := v.(*Response); ok {
+		return c.decodeResponse(data, resp)
+	}
+	doc, err := c.ProjectJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(doc, v)
+}
+
+// ProjectJSON returns the JSON the document in data transcodes to.
+func (msgpackCodec) ProjectJSON(data []byte) ([]byte, error) {
+	d := msgpackDecoder{data: data}
+	return d.document()
+}
+
+func (msgpackCodec) decodeResponse(data []byte, resp *Response) error {
+	// The result stays JSON for the caller to decode; transcoding it once
+	// spares reading it again to unmarshal the envelope.
+	d := msgpackDecoder{data: data}
+	return d.response(resp)
+}
+
+// maxMsgPackDepth bounds the nesting of a decoded document, as
+// encoding/json bounds its own.
+const maxMsgPackDepth = 10000
+
+var errMsgPackShort = errors.New("msgpack: unexpected end of data")
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if v.CanInterface() && v.Type().Implements(jsonMarshalerType) {
+		raw, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return e.encodeJSON(raw)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.float64(v.Float())
+	case reflect.String:
+		e.str(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		switch v.Type().Elem().Kind() {
+		case reflect.Uint8:
+			e.bin(v.Bytes())
+			return nil
+		case reflect.Float32:
+			e.float32s(v)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Float32 {
+			e.float32s(v)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	case reflect.Pointer, reflect.Interface:
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) int(i int64) {
+	switch {
+	case i >= 0:
+		e.uint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(int8(i)))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(int32(i)))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(i))
+	}
+}
+
+func (e *msgpackEncoder) uint(u uint64) {
+	switch {
+	case u < 0x80:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), u)
+	}
+}
+
+func (e *msgpackEncoder) float64(f float64) {
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(f))
+}
+
+// header appends the header of a value of n elements or bytes: fixed
+// holds the type byte of the fixed form for n below limit, or 0 for none,
+// and wide the bytes of the 8-, 16-, and 32-bit forms, 0 when absent.
+func (e *msgpackEncoder) header(n int, fixed byte, limit int, wide [3]byte) {
+	switch {
+	case fixed != 0 && n < limit:
+		e.buf = append(e.buf, fixed|byte(n))
+	case wide[0] != 0 && n <= math.MaxUint8:
+		e.buf = append(e.buf, wide[0], byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, wide[1]), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, wide[2]), uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) str(s string) {
+	e.header(len(s), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb})
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) bin(b []byte) {
+	e.header(len(b), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) arrayHeader(n int) { e.header(n, 0x90, 16, [3]byte{0, 0xdc, 0xdd}) }
+func (e *msgpackEncoder) mapHeader(n int)   { e.header(n, 0x80, 16, [3]byte{0, 0xde, 0xdf}) }
+
+// float32s appends the float32 components of v as one bin.
+func (e *msgpackEncoder) float32s(v reflect.Value) {
+	n := v.Len()
+	e.header(4*n, 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+	for i := 0; i < n; i++ {
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Index(i).Float())))
+	}
+}
+
+func (e *msgpackEncoder) array(v reflect.Value) error {
+	e.arrayHeader(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeMap(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	e.mapHeader(len(keys))
+	for _, k := range keys {
+		e.str(k.String())
+		if err := e.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	fields := msgpackFieldsOf(v.Type())
+	values := make([]reflect.Value, len(fields))
+	n := 0
+	for i, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		values[i] = fv
+		n++
+	}
+	e.mapHeader(n)
+	for i, f := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+		e.str(f.name)
+		if err := e.encode(values[i]); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// encodeJSON appends the value of the JSON document raw.
+func (e *msgpackEncoder) encodeJSON(raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return e.encodeAny(v)
+}
+
+// encodeAny appends a value decoded from JSON, its numbers kept as
+// json.Number: integers encode as integers, the others as float64.
+func (e *msgpackEncoder) encodeAny(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xc0)
+	case bool:
+		return e.encode(reflect.ValueOf(v))
+	case string:
+		e.str(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			e.int(i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		e.float64(f)
+	case []any:
+		e.arrayHeader(len(v))
+		for _, elem := range v {
+			if err := e.encodeAny(elem); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.mapHeader(len(keys))
+		for _, k := range keys {
+			e.str(k)
+			if err := e.encodeAny(v[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// msgpackField is a struct field as encoding/json names it.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// msgpackFields caches the fields of the struct types encoded.
+var msgpackFields sync.Map
+
+// msgpackFieldsOf returns the fields of t that encoding/json encodes: the
+// exported ones not tagged "-", and those of embedded structs, a field of
+// the outer struct shadowing an embedded one of the same name.
+func msgpackFieldsOf(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFields.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+	var fields []msgpackField
+	seen := map[string]bool{}
+	level := []msgpackField{{index: nil}}
+	types := []reflect.Type{t}
+	for len(types) > 0 {
+		var nextFields []msgpackField
+		var nextTypes []reflect.Type
+		for ti, st := range types {
+			for i := 0; i < st.NumField(); i++ {
+				sf := st.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(level[ti].index[:len(level[ti].index):len(level[ti].index)], i)
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+					nextFields = append(nextFields, msgpackField{index: index})
+					nextTypes = append(nextTypes, ft)
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = sf.Name
+				}
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				fields = append(fields, msgpackField{name: name, index: index, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+			}
+		}
+		level, types = nextFields, nextTypes
+	}
+	msgpackFields.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex is v.FieldByIndex, reporting false for a field reached
+// through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// msgpackDecoder transcodes MessagePack into JSON.
+type msgpackDecoder struct {
+	data []byte
+	off  int
+}
+
+// document transcodes the one value of the data.
+func (d *msgpackDecoder) document() ([]byte, error) {
+	doc, err := d.value(nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d bytes after the value", len(d.data)-d.off)
+	}
+	return doc, nil
+}
+
+// response decodes a Response envelope, its result transcoded and the
+// other members unmarshaled from theirs.
+func (d *msgpackDecoder) response(resp *Response) error {
+	n, err := d.mapHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		key, err := d.str()
+		if err != nil {
+			return err
+		}
+		var dst []byte
+		if string(key) == "result" {
+			// Sized for the rest of the data in base64, as vectors mostly
+			// are, so the result is transcoded without growing.
+			dst = make([]byte, 0, (len(d.data)-d.off)*4/3+64)
+		}
+		member, err := d.value(dst, 1)
+		if err != nil {
+			return err
+		}
+		var target any
+		switch string(key) {
+		case "result":
+			resp.Result = member
+			continue
+		case "jsonrpc":
+			target = &resp.JSONRPC
+		case "id":
+			target = &resp.ID
+		case "error":
+			target = &resp.Error
+		case "meta":
+			target = &resp.Meta
+		default:
+			continue
+		}
+		if err := json.Unmarshal(member, target); err != nil {
+			return fmt.Errorf("msgpack: response %s: %w", key, err)
+		}
+	}
+	if d.off != len(d.data) {
+		return fmt.Errorf("msgpack: %d bytes after the response", len(d.data)-d.off)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, errMsgPackShort
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// length reads the size-byte length of a value, which the rest of the
+// data must be able to hold at one byte an element.
+func (d *msgpackDecoder) length(size int) (int, error) {
+	u, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.data)-d.off) {
+		return 0, errMsgPackShort
+	}
+	return int(u), nil
+}
+
+func (d *msgpackDecoder) mapHeader() (int, error) {
+	c, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c[0]&0xf0 == 0x80:
+		return int(c[0] & 0x0f), nil
+	case c[0] == 0xde:
+		return d.length(2)
+	case c[0] == 0xdf:
+		return d.length(4)
+	}
+	return 0, fmt.Errorf("msgpack: a value of type 0x%02x, not a map", c[0])
+}
+
+// str reads a string, such as a map key.
+func (d *msgpackDecoder) str() ([]byte, error) {
+	c, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	switch {
+	case c[0]&0xe0 == 0xa0:
+		n = int(c[0] & 0x1f)
+	case c[0] >= 0xd9 && c[0] <= 0xdb:
+		if n, err = d.length(1 << (c[0] - 0xd9)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("msgpack: a map key of type 0x%02x, not a string", c[0])
+	}
+	return d.next(n)
+}
+
+// value appends the JSON of the next value to dst.
+func (d *msgpackDecoder) value(dst []byte, depth int) ([]byte, error) {
+	if depth > maxMsgPackDepth {
+		return nil, errors.New("msgpack: exceeded max depth")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return strconv.AppendInt(dst, int64(c), 10), nil
+	case c >= 0xe0:
+		return strconv.AppendInt(dst, int64(int8(c)), 10), nil
+	case c&0xf0 == 0x80:
+		return d.object(dst, int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.array(dst, int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		s, err := d.next(int(c & 0x1f))
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(dst, s), nil
+	}
+	switch c {
+	case 0xc0:
+		return append(dst, "null"...), nil
+	case 0xc2:
+		return append(dst, "false"...), nil
+	case 0xc3:
+		return append(dst, "true"...), nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return appendBase64String(dst, raw), nil
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(dst, float64(math.Float32frombits(uint32(u))), 32)
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(dst, math.Float64frombits(u), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendUint(dst, u, 10), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the value's width.
+		shift := 64 - 8*size
+		return strconv.AppendInt(dst, int64(u<<shift)>>shift, 10), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(dst, s), nil
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(dst, n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(dst, n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+func (d *msgpackDecoder) array(dst []byte, n, depth int) ([]byte, error) {
+	dst = append(dst, '[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		var err error
+		if dst, err = d.value(dst, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (d *msgpackDecoder) object(dst []byte, n, depth int) ([]byte, error) {
+	dst = append(dst, '{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		key, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		dst = append(appendJSONString(dst, key), ':')
+		if dst, err = d.value(dst, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONString appends s as a JSON string. Invalid UTF-8 is left for
+// json.Unmarshal to replace.
+func appendJSONString(dst, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	start := 0
+	for i, c := range s {
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
+		}
+		dst = append(dst, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, `\n`...)
+		case '\r':
+			dst = append(dst, `\r`...)
+		case '\t':
+			dst = append(dst, `\t`...)
+		default:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		}
+		start = i + 1
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// appendJSONFloat appends f, of the given bit size, as encoding/json
+// formats it.
+func appendJSONFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("msgpack: unsupported float %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
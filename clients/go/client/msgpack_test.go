@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	req, err := newRequest(7, MethodEmbed, embedParams{Model: "m", Inputs: []string{"héllo", strings.Repeat("x", 300)}, Dimensions: 64}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := MsgPackCodec.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got Request
+	if err := MsgPackCodec.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !bytes.Equal(CanonicalJSON(mustJSON(t, &got)), CanonicalJSON(mustJSON(t, req))) {
+		t.Fatalf("round trip %s, want %s", mustJSON(t, &got), mustJSON(t, req))
+	}
+
+	// Vectors travel as bin of raw float32 and decode back through base64.
+	vector := []float32{1, 0.5, -0.25, 3.4028235e38, 1e-7}
+	result := map[string]any{"model": "m", "embeddings": []map[string]any{{"index": 0, "vector": vector}}}
+	raw, err = MsgPackCodec.Marshal(&Response{JSONRPC: JSONRPCVersion, ID: 7, Result: mustJSON(t, map[string]int{"n": -40000})})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var resp Response
+	if err := MsgPackCodec.Unmarshal(raw, &resp); err != nil || resp.ID != 7 || string(resp.Result) != `{"n":-40000}` {
+		t.Fatalf("response %+v, %v", resp, err)
+	}
+	raw, err = MsgPackCodec.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Contains(raw, append([]byte{0xc4, 20}, 0, 0, 0x80, 0x3f)) {
+		t.Fatalf("vector not encoded as bin of float32: % x", raw)
+	}
+	var decoded embedResult
+	if err := MsgPackCodec.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual([]float32(decoded.Embeddings[0].Vector), vector) {
+		t.Fatalf("vector %v, want %v", decoded.Embeddings[0].Vector, vector)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated":  raw[:len(raw)-1],
+		"trailing":   append(append([]byte(nil), raw...), 0xc0),
+		"ext":        {0xd4, 1, 0},
+		"int key":    {0x81, 0x01, 0xc0},
+		"NaN":        {0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 0},
+		"huge array": {0xdd, 0xff, 0xff, 0xff, 0xff},
+	} {
+		var v any
+		if err := MsgPackCodec.Unmarshal(data, &v); err == nil {
+			t.Errorf("%s: decoded %v", name, v)
+		}
+	}
+}
+
+// msgpackServer answers with defaultHandler in the codec of each request,
+// and picks the first codec the handshake offers.
+type msgpackServer struct {
+	pick string
+
+	mu           sync.Mutex
+	contentTypes []string
+	offered      []string
+}
+
+func (s *msgpackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	codec := codecFor(r.Header.Get("Content-Type"))
+	s.mu.Lock()
+	s.contentTypes = append(s.contentTypes, r.Header.Get("Content-Type"))
+	s.mu.Unlock()
+	var req Request
+	if err := codec.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := defaultHandler(&req)
+	var answer any = resp
+	switch req.Method {
+	case MethodInitialize:
+		var params struct {
+			Codecs []string `json:"codecs"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		s.mu.Lock()
+		s.offered = params.Codecs
+		s.mu.Unlock()
+		var result map[string]any
+		_ = json.Unmarshal(resp.Result, &result)
+		if s.pick != "" {
+			result["codec"] = s.pick
+		} else if len(params.Codecs) > 0 {
+			result["codec"] = params.Codecs[0]
+		}
+		resp.Result, _ = json.Marshal(result)
+	case MethodEmbed:
+		// The vectors go out as float32, which MsgPackCodec sends as bin.
+		var result embedResult
+		_ = json.Unmarshal(resp.Result, &result)
+		answer = map[string]any{"jsonrpc": resp.JSONRPC, "id": resp.ID, "result": result}
+	}
+	raw, err := codec.Marshal(answer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	_, _ = w.Write(raw)
+}
+
+func TestMsgPackNegotiation(t *testing.T) {
+	s := &msgpackServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	rec := &markingRecorder{}
+	var stdout strings.Builder
+	err := RunEmbed(context.Background(), Options{
+		Config:             ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Codecs: []string{CodecMsgPack}},
+		TranscriptRecorder: rec,
+		Inputs:             []string{"a", "bb"},
+		Stdout:             &stdout,
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	if got := strings.Join(s.offered, ","); got != "msgpack,json" {
+		t.Fatalf("offered %s", got)
+	}
+	// The handshake goes out in JSON, everything after it in msgpack.
+	if len(s.contentTypes) < 2 || s.contentTypes[0] != "application/json" || s.contentTypes[len(s.contentTypes)-1] != "application/msgpack" {
+		t.Fatalf("content types %v", s.contentTypes)
+	}
+	if !strings.Contains(stdout.String(), "[2,0.5,-0.5]") {
+		t.Fatalf("output %s", stdout.String())
+	}
+	// The transcript holds JSON, the vectors in base64, and names the codec.
+	if rec.markers.Codec != CodecMsgPack {
+		t.Fatalf("markers %+v", rec.markers)
+	}
+	last := rec.entries[len(rec.entries)-1].Message
+	var result struct {
+		Result embedResult `json:"result"`
+	}
+	if err := json.Unmarshal(last, &result); err != nil || len(result.Result.Embeddings) != 2 || result.Result.Embeddings[1].Vector[0] != 2 {
+		t.Fatalf("recorded response %s: %v", last, err)
+	}
+
+	// A server that predates codecs, or a client that offers none, stays
+	// in JSON; a pick that was not offered fails the handshake.
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil || c.Codec() != CodecJSON {
+		t.Fatalf("Initialize: codec %s, %v", c.Codec(), err)
+	}
+	s.pick = CodecCBOR
+	c, err = NewClient(srv.URL, WithCodecs(CodecMsgPack))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("Initialize with an unoffered pick: %v", err)
+	}
+
+	if _, err := NewClient(srv.URL, WithCodecs("bson")); err == nil {
+		t.Fatal("WithCodecs accepted an unknown codec")
+	}
+	if err := (ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Codecs: []string{CodecMsgPack}, Signing: SigningConfig{KeyID: "k", Secret: "s"}}).Validate(); err == nil {
+		t.Fatal("Validate accepted a codec with signing")
+	}
+}
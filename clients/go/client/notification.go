@@ -0,0 +1,214 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultNotificationBuffer is how many notifications Client.Notifications
+// holds for a slow reader under the zero NotificationPolicy.
+const DefaultNotificationBuffer = 64
+
+// Drop policies of a full notification buffer, the values of
+// NotificationPolicy.Drop.
+const (
+	// DropNewest discards the notification arriving at a full buffer,
+	// keeping those a reader has yet to take. It is the default.
+	DropNewest = "newest"
+	// DropOldest discards the oldest notification buffered to make room
+	// for the one arriving, so a reader catching up sees the latest.
+	DropOldest = "oldest"
+)
+
+// Notification is a message the server pushed over a stream transport
+// (stdio, unix, inproc, a NewConnTransport, or websocket) outside any call:
+// a frame with a method and no id, or one marked "type":"notification",
+// read between the frames answering requests.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+	// Transport is the kind of the transport it arrived on.
+	Transport string
+	// Received is when the client read it.
+	Received time.Time
+
+	// raw is the envelope as it arrived, for the transcript.
+	raw json.RawMessage
+}
+
+// NotificationPolicy bounds the notifications Client.Notifications buffers
+// for a reader that falls behind. The zero value buffers
+// DefaultNotificationBuffer and drops the newest past it.
+type NotificationPolicy struct {
+	// Buffer is the capacity of the channel; zero selects
+	// DefaultNotificationBuffer.
+	Buffer int
+	// Drop is DropNewest or DropOldest; empty selects DropNewest.
+	Drop string
+}
+
+func (p NotificationPolicy) validate() error {
+	if p.Buffer < 0 {
+		return errors.New("notification buffer must not be negative")
+	}
+	switch p.Drop {
+	case "", DropNewest, DropOldest:
+		return nil
+	}
+	return fmt.Errorf("unknown notification drop policy %q", p.Drop)
+}
+
+// WithNotifications buffers up to buffer notifications for
+// Client.Notifications, dropping by drop, DropNewest or DropOldest, once
+// they are full; see NotificationPolicy. It overrides WithConfig's
+// Notifications.
+func WithNotifications(buffer int, drop string) Option {
+	return func(o *clientOptions) error {
+		p := NotificationPolicy{Buffer: buffer, Drop: drop}
+		if buffer <= 0 {
+			return fmt.Errorf("WithNotifications: buffer must be positive, got %d", buffer)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("WithNotifications: %w", err)
+		}
+		o.notifications = &p
+		return nil
+	}
+}
+
+// Notifications returns the channel of the notifications the server pushes
+// that no HandleNotification handler takes, in the order they arrived.
+// Past ClientConfig.Notifications.Buffer unread ones the client drops by
+// its policy, counting them in Stats.NotificationsDropped, so a reader
+// that falls behind never stalls the calls sharing the stream. Close
+// closes the channel.
+func (c *Client) Notifications() <-chan Notification { return c.notes.ch }
+
+// HandleNotification has h take the notifications of method in place of
+// Notifications; a nil h removes the handler. h runs on the goroutine
+// reading the stream, which reads nothing more until it returns, so it
+// must not block.
+func (c *Client) HandleNotification(method string, h func(Notification)) {
+	c.notes.mu.Lock()
+	defer c.notes.mu.Unlock()
+	if h == nil {
+		delete(c.notes.handlers, method)
+		return
+	}
+	c.notes.handlers[method] = h
+}
+
+// notificationQueue hands the notifications the transports read to their
+// handlers and the channel of Client.Notifications.
+type notificationQueue struct {
+	ch       chan Notification
+	drop     string
+	stats    *runtimeStats
+	recorder Recorder
+
+	mu       sync.Mutex
+	handlers map[string]func(Notification)
+	closed   bool
+}
+
+func newNotificationQueue(p NotificationPolicy, stats *runtimeStats, rec Recorder) *notificationQueue {
+	size := p.Buffer
+	if size == 0 {
+		size = DefaultNotificationBuffer
+	}
+	return &notificationQueue{
+		ch:       make(chan Notification, size),
+		drop:     p.Drop,
+		stats:    stats,
+		recorder: rec,
+		handlers: make(map[string]func(Notification)),
+	}
+}
+
+// push records n and delivers it to its method's handler or, by the drop
+// policy, to the channel.
+func (q *notificationQueue) push(n Notification) {
+	q.mu.Lock()
+	closed, h := q.closed, q.handlers[n.Method]
+	q.mu.Unlock()
+	if closed {
+		return
+	}
+	if q.recorder != nil {
+		q.recorder.Record(Entry{Direction: DirectionNotification, Message: n.raw, ReceivedAt: n.Received.UTC().Format(time.RFC3339Nano)})
+	}
+	if h != nil {
+		q.stats.notified(false)
+		h(n)
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.ch <- n:
+		q.stats.notified(false)
+		return
+	default:
+	}
+	if q.drop == DropOldest {
+		select {
+		case <-q.ch:
+		default:
+		}
+		// Holding q.mu, no other push can fill the slot just freed.
+		q.ch <- n
+	}
+	q.stats.notified(true)
+}
+
+// close closes the channel; notifications read after it are dropped.
+func (q *notificationQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+}
+
+// notify hands n, read from a kind stream, to the client observing ev, if
+// any.
+func (ev *transportEvents) notify(kind string, n *Notification) {
+	if ev != nil && ev.notification != nil {
+		n.Transport = kind
+		ev.notification(*n)
+	}
+}
+
+// decodeInbound decodes payload, a frame the server sent: as a
+// notification when it carries a method and no id, or is marked
+// "type":"notification", else as a response.
+func decodeInbound(payload []byte) (*Response, *Notification, error) {
+	var msg struct {
+		Response
+		// ID shadows Response.ID, to tell a missing id from a zero one.
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		Type   string          `json:"type"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, nil, err
+	}
+	noID := len(msg.ID) == 0 || string(msg.ID) == "null"
+	if msg.Type == "notification" || msg.Method != "" && noID {
+		return nil, &Notification{Method: msg.Method, Params: msg.Params, Received: time.Now(), raw: append(json.RawMessage(nil), payload...)}, nil
+	}
+	if !noID {
+		if err := json.Unmarshal(msg.ID, &msg.Response.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &msg.Response, nil, nil
+}
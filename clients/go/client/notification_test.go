@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pushedBefore returns the notifications a server pushes ahead of its
+// answer to req: one without an id, and one with an id but marked as a
+// notification.
+func pushedBefore(req Request) [][]byte {
+	return [][]byte{
+		[]byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"progress","params":{"request":%d}}`, req.ID)),
+		[]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"type":"notification","method":"log","params":{"request":%d}}`, req.ID+1000, req.ID)),
+	}
+}
+
+// notifyingServer answers the newline-framed requests arriving on the far
+// end of a net.Pipe with defaultHandler, each preceded by pushedBefore.
+func notifyingServer(t *testing.T) net.Conn {
+	t.Helper()
+	near, far := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(far)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				return
+			}
+			resp := defaultHandler(&req)
+			resp.ID, resp.JSONRPC = req.ID, JSONRPCVersion
+			raw, _ := json.Marshal(resp)
+			for _, frame := range append(pushedBefore(req), raw) {
+				if _, err := far.Write(append(frame, '\n')); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	t.Cleanup(func() { far.Close() })
+	return near
+}
+
+// checkNotified embeds three inputs through c and checks that every answer
+// and every notification pushed ahead of it arrived where it belongs.
+func checkNotified(t *testing.T, c *Client, sink *syncSink, transport string) {
+	t.Helper()
+	for _, input := range []string{"a", "bb", "ccc"} {
+		if v, err := c.Embed(context.Background(), input); err != nil || v[0] != float32(len(input)) {
+			t.Fatalf("Embed(%q) = %v, %v", input, v, err)
+		}
+	}
+	var got []string
+	for len(got) < 6 {
+		select {
+		case n := <-c.Notifications():
+			if n.Transport != transport || n.Received.IsZero() {
+				t.Fatalf("notification %+v", n)
+			}
+			got = append(got, n.Method+" "+string(n.Params))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got notifications %q, want 6", got)
+		}
+	}
+	var want []string
+	for id := int64(1); id <= 3; id++ {
+		want = append(want, fmt.Sprintf(`progress {"request":%d}`, id), fmt.Sprintf(`log {"request":%d}`, id))
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("notifications %q, want %q", got, want)
+	}
+
+	// The transcript holds them where they arrived, between each request
+	// and its response.
+	var directions []string
+	for _, e := range sink.snapshot() {
+		directions = append(directions, e.Direction)
+		if e.Direction == DirectionNotification && (e.ReceivedAt == "" || !strings.Contains(string(e.Message), `"request"`)) {
+			t.Fatalf("notification entry %+v", e)
+		}
+	}
+	var round []string
+	for i := 0; i < 3; i++ {
+		round = append(round, DirectionRequest, DirectionNotification, DirectionNotification, DirectionResponse)
+	}
+	if !slices.Equal(directions, round) {
+		t.Fatalf("transcript directions %v, want %v", directions, round)
+	}
+	var s TranscriptSummary
+	for _, e := range sink.snapshot() {
+		s.Add(e)
+	}
+	if s.Notifications != 6 || s.Responses != 3 {
+		t.Fatalf("summary %+v", s)
+	}
+	if st := c.Stats(); st.Notifications != 6 || st.NotificationsDropped != 0 {
+		t.Fatalf("stats counted %d notifications, %d dropped", st.Notifications, st.NotificationsDropped)
+	}
+}
+
+func TestNotificationsInterleaved(t *testing.T) {
+	for _, depth := range []int{0, 4} {
+		t.Run(fmt.Sprintf("depth %d", depth), func(t *testing.T) {
+			sink := &syncSink{}
+			tr := NewConnTransport(notifyingServer(t), ConnOptions{Kind: "ssh", MaxPipelineDepth: depth})
+			c := NewWithTransport(ClientConfig{Recorder: sink}, tr)
+			defer c.Close(context.Background())
+			checkNotified(t, c, sink, "ssh")
+		})
+	}
+}
+
+func TestNotificationsWebSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(msg, &req); err != nil {
+				return
+			}
+			resp := defaultHandler(&req)
+			resp.ID, resp.JSONRPC = req.ID, JSONRPCVersion
+			raw, _ := json.Marshal(resp)
+			for _, frame := range append(pushedBefore(req), raw) {
+				if err := ws.WriteText(frame); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+
+	sink := &syncSink{}
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv), Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	checkNotified(t, c, sink, TransportWebSocket)
+}
+
+func TestNotificationPolicy(t *testing.T) {
+	push := func(c *Client, methods ...string) {
+		for _, m := range methods {
+			c.notes.push(Notification{Method: m, Received: time.Now()})
+		}
+	}
+	drain := func(c *Client) []string {
+		var got []string
+		for {
+			select {
+			case n := <-c.Notifications():
+				got = append(got, n.Method)
+			default:
+				return got
+			}
+		}
+	}
+	for _, tc := range []struct {
+		drop string
+		want []string
+	}{
+		{DropNewest, []string{"a", "b"}},
+		{DropOldest, []string{"b", "c"}},
+	} {
+		c := NewWithTransport(ClientConfig{Notifications: NotificationPolicy{Buffer: 2, Drop: tc.drop}}, okStub("stub"))
+		push(c, "a", "b", "c")
+		if got := drain(c); !slices.Equal(got, tc.want) {
+			t.Errorf("%s kept %v, want %v", tc.drop, got, tc.want)
+		}
+		if s := c.Stats(); s.Notifications != 2 || s.NotificationsDropped != 1 {
+			t.Errorf("%s counted %d delivered, %d dropped", tc.drop, s.Notifications, s.NotificationsDropped)
+		}
+		c.Close(context.Background())
+	}
+
+	// A handler takes its method's notifications off the channel until it
+	// is removed.
+	c := NewWithTransport(ClientConfig{}, okStub("stub"))
+	var handled []string
+	c.HandleNotification("progress", func(n Notification) { handled = append(handled, n.Method) })
+	push(c, "progress", "log", "progress")
+	c.HandleNotification("progress", nil)
+	push(c, "progress")
+	if got := drain(c); !slices.Equal(handled, []string{"progress", "progress"}) || !slices.Equal(got, []string{"log", "progress"}) {
+		t.Fatalf("handled %v, channel got %v", handled, got)
+	}
+	// Close ends the channel, and what arrives after it is dropped.
+	c.Close(context.Background())
+	push(c, "late")
+	if _, ok := <-c.Notifications(); ok {
+		t.Fatal("Notifications still open after Close")
+	}
+
+	for _, opt := range []Option{WithNotifications(0, DropNewest), WithNotifications(8, "sideways")} {
+		if _, err := NewClient("http://127.0.0.1:1", opt); err == nil {
+			t.Error("NewClient accepted an invalid notification policy")
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAICompat is the wire protocol of servers offering the OpenAI
+// embeddings API, over the http, tls, and http3 transports. The endpoint is
+// the API's base URL, with or without its /v1: embeds post to
+// /v1/embeddings and ListModels reads /v1/models, whose models come without
+// a dimension or features. The handshake and capabilities are answered by
+// the client itself, a ping lists the models, and the other methods fail
+// with ErrMethodNotFound. Transcripts record the native envelopes the
+// adapter translates from and to.
+const OpenAICompat = "openai"
+
+// openaiTransport carries the calls of an OpenAICompat client over an
+// httpTransport, translating the envelopes of the methods it knows into
+// requests of the OpenAI API and the answers back.
+type openaiTransport struct {
+	h *httpTransport
+	// base is the endpoint without a trailing /v1.
+	base string
+}
+
+func newOpenAITransport(h *httpTransport) *openaiTransport {
+	t := &openaiTransport{h: h, base: strings.TrimSuffix(strings.TrimSuffix(h.endpoint, "/"), "/v1")}
+	if h.hb != nil {
+		h.hb.probe = t.ping
+	}
+	return t
+}
+
+func (t *openaiTransport) Kind() string                { return t.h.Kind() }
+func (t *openaiTransport) Close() error                { return t.h.Close() }
+func (t *openaiTransport) observe(ev *transportEvents) { t.h.observe(ev) }
+func (t *openaiTransport) protocol() string            { return t.h.protocol() }
+
+// openaiEmbedRequest is the body posted to /v1/embeddings.
+type openaiEmbedRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+}
+
+// openaiEmbedResponse is the answer of /v1/embeddings, with each embedding
+// left as it arrived, a number array or a base64 string.
+type openaiEmbedResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int             `json:"index"`
+		Embedding json.RawMessage `json:"embedding"`
+	} `json:"data"`
+	Usage *Usage `json:"usage"`
+}
+
+// openaiEmbedResult is the embedResult an embed is answered with, its
+// vectors passed on still encoded.
+type openaiEmbedResult struct {
+	Model          string         `json:"model"`
+	Embeddings     []openaiVector `json:"embeddings"`
+	EncodingFormat string         `json:"encoding_format,omitempty"`
+	Usage          *Usage         `json:"usage,omitempty"`
+}
+
+// openaiVector is an embeddingEntry whose vector is still encoded.
+type openaiVector struct {
+	Index  int             `json:"index"`
+	Vector json.RawMessage `json:"vector"`
+}
+
+// openaiModels is the answer of /v1/models.
+type openaiModels struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+func (t *openaiTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if t.h.hb != nil {
+		t.h.hb.begin()
+		defer t.h.hb.end()
+	}
+	resp := &Response{JSONRPC: JSONRPCVersion, ID: req.ID}
+	var result any
+	var err error
+	switch req.Method {
+	case MethodEmbed:
+		result, resp.ServerRequestID, err = t.embed(ctx, req)
+	case MethodListModels:
+		result, resp.ServerRequestID, err = t.models(ctx, req)
+	case MethodPing:
+		_, resp.ServerRequestID, err = t.models(ctx, req)
+		result = map[string]bool{"ok": true}
+	case MethodInitialize, MethodCapabilities:
+		// No session and no capabilities beyond the embeddings.
+		result = struct{}{}
+	default:
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q has no OpenAI-compatible endpoint", req.Method)}
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		return nil, fmt.Errorf("%s encode %s result: %w", t.h.kind, req.Method, err)
+	}
+	return resp, nil
+}
+
+// embed posts the inputs of an embed request to /v1/embeddings.
+func (t *openaiTransport) embed(ctx context.Context, req *Request) (*openaiEmbedResult, string, error) {
+	var params embedParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, "", fmt.Errorf("%s decode %s params: %w", t.h.kind, req.Method, err)
+	}
+	body := openaiEmbedRequest{Model: params.Model, Input: params.Inputs, EncodingFormat: params.EncodingFormat, Dimensions: params.Dimensions}
+	if body.EncodingFormat == "" {
+		body.EncodingFormat = EncodingFloat
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("encode request: %w", err)
+	}
+	var answer openaiEmbedResponse
+	serverID, err := t.call(ctx, http.MethodPost, "/v1/embeddings", req, raw, &answer)
+	if err != nil {
+		return nil, "", err
+	}
+	result := &openaiEmbedResult{Model: answer.Model, Embeddings: make([]openaiVector, len(answer.Data)), Usage: answer.Usage}
+	for i, d := range answer.Data {
+		result.Embeddings[i] = openaiVector{Index: d.Index, Vector: d.Embedding}
+	}
+	// The answer does not name its encoding; a base64 vector is a string.
+	if len(answer.Data) > 0 && bytes.HasPrefix(bytes.TrimSpace(answer.Data[0].Embedding), []byte(`"`)) {
+		result.EncodingFormat = EncodingBase64
+	}
+	return result, serverID, nil
+}
+
+// models reads /v1/models as a single page of the listing.
+func (t *openaiTransport) models(ctx context.Context, req *Request) (*listModelsResult, string, error) {
+	var answer openaiModels
+	serverID, err := t.call(ctx, http.MethodGet, "/v1/models", req, nil, &answer)
+	if err != nil {
+		return nil, "", err
+	}
+	result := &listModelsResult{Models: make([]ModelInfo, len(answer.Data))}
+	for i, m := range answer.Data {
+		result.Models[i] = ModelInfo{Name: m.ID}
+	}
+	return result, serverID, nil
+}
+
+// ping is the heartbeat probe: any answer of /v1/models proves the
+// connection alive.
+func (t *openaiTransport) ping(ctx context.Context) error {
+	_, err := t.call(ctx, http.MethodGet, "/v1/models", &Request{Method: MethodPing}, nil, &openaiModels{})
+	return err
+}
+
+// call sends body, with the headers of req, as a verb request to path and
+// decodes the answer into out, returning the server's ID for the request.
+func (t *openaiTransport) call(ctx context.Context, verb, path string, req *Request, body []byte, out any) (string, error) {
+	carrier := &Request{Method: req.Method, Meta: req.Meta, body: body}
+	httpResp, err := t.h.sendTo(ctx, verb, t.base+path, carrier, "application/json")
+	if err != nil {
+		return "", openaiAPIError(err)
+	}
+	payload, err := t.h.readResponse(ctx, httpResp)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(payload, out); err != nil {
+		return "", fmt.Errorf("%s decode %s response: %w: %w", t.h.kind, path, ErrProtocol, err)
+	}
+	return httpResp.Header.Get(RequestIDHeader), nil
+}
+
+// openaiAPIError fills the *APIError of a non-2xx answer in from the error
+// body of the OpenAI API, {"error": {"message", "type", "code"}}: its
+// message replaces the body, and its type and code pick the JSON-RPC code
+// of the error class they describe. Other errors are returned as they are.
+func openaiAPIError(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status == 0 {
+		return err
+	}
+	var body struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(apiErr.Message), &body) != nil || body.Error == nil {
+		return err
+	}
+	apiErr.Message, apiErr.ErrorType = body.Error.Message, body.Error.Type
+	// The code is a string, or null.
+	_ = json.Unmarshal(body.Error.Code, &apiErr.ErrorCode)
+	switch {
+	case apiErr.ErrorCode == "model_not_found":
+		apiErr.Code = CodeModelNotFound
+	case apiErr.ErrorCode == "invalid_api_key" || apiErr.ErrorType == "authentication_error" || apiErr.ErrorType == "permission_error":
+		apiErr.Code = CodeUnauthorized
+	case apiErr.ErrorCode == "context_length_exceeded":
+		apiErr.Code = CodePayloadTooLarge
+	case apiErr.ErrorCode == "insufficient_quota":
+		// Waiting does not refill a quota.
+		apiErr.Retryable = false
+	case apiErr.ErrorType == "invalid_request_error":
+		apiErr.Code = CodeInvalidParams
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// openaiServer is a fake OpenAI embeddings API. Its vectors are those of
+// defaultHandler, in base64 when asked for unless floats is set, and each
+// input counts one token per byte.
+type openaiServer struct {
+	floats bool
+
+	mu     sync.Mutex
+	bodies [][]byte
+	paths  []string
+}
+
+func (s *openaiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.bodies = append(s.bodies, body)
+	s.paths = append(s.paths, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/models":
+		_, _ = io.WriteString(w, `{"object":"list","data":[{"id":"text-embedding-3-small","object":"model","owned_by":"system"}]}`)
+	case "/v1/embeddings":
+		var req openaiEmbedRequest
+		_ = json.Unmarshal(body, &req)
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":{"message":"The model does not exist","type":"invalid_request_error","param":null,"code":"model_not_found"}}`)
+			return
+		}
+		data := make([]map[string]any, len(req.Input))
+		tokens := 0
+		for i, input := range req.Input {
+			v := []float32{float32(len(input)), 0.5, -0.5}
+			tokens += len(input)
+			data[i] = map[string]any{"object": "embedding", "index": i, "embedding": v}
+			if req.EncodingFormat == EncodingBase64 && !s.floats {
+				data[i]["embedding"] = encodeBase64Vector(v)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data, "model": req.Model, "usage": map[string]int{"prompt_tokens": tokens, "total_tokens": tokens}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestOpenAICompatEmbeds(t *testing.T) {
+	for _, floats := range []bool{false, true} {
+		s := &openaiServer{floats: floats}
+		srv := httptest.NewServer(s)
+		c, err := NewClient(srv.URL+"/v1/", WithProtocol(OpenAICompat))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		ctx := context.Background()
+		if _, err := c.Initialize(ctx); err != nil {
+			t.Fatalf("Initialize: %v", err)
+		}
+		var info EmbedInfo
+		out, err := c.EmbedBatch(ctx, []string{"a", "bb", "ccc"}, WithModel("text-embedding-3-small"), WithEmbedInfo(&info))
+		if err != nil {
+			t.Fatalf("EmbedBatch (floats %t): %v", floats, err)
+		}
+		for i, v := range out {
+			if int(v[0]) != i+1 || v[1] != 0.5 {
+				t.Fatalf("vector %d is %v", i, v)
+			}
+		}
+		if info.Usage != (Usage{PromptTokens: 6, TotalTokens: 6}) {
+			t.Fatalf("usage %+v", info.Usage)
+		}
+		models, err := c.ListModels(ctx)
+		if err != nil || len(models) != 1 || models[0].Name != "text-embedding-3-small" {
+			t.Fatalf("ListModels: %v, %v", models, err)
+		}
+		if _, err := c.Ping(ctx); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		c.Close(ctx)
+		srv.Close()
+
+		// The handshake never reached the server, and the embed asked for
+		// base64 in the shape of the API.
+		if got := strings.Join(s.paths, ", "); got != "POST /v1/embeddings, GET /v1/models, GET /v1/models" {
+			t.Fatalf("requests %s", got)
+		}
+		if got := envelopeKeys(t, s.bodies[0]); got != "encoding_format,input,model" {
+			t.Fatalf("embed request members %s", got)
+		}
+		if !strings.Contains(string(s.bodies[0]), `"encoding_format":"base64"`) {
+			t.Fatalf("embed request %s", s.bodies[0])
+		}
+	}
+}
+
+func TestOpenAICompatErrors(t *testing.T) {
+	srv := httptest.NewServer(&openaiServer{})
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithProtocol(OpenAICompat))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	_, err = c.Embed(context.Background(), "hello", WithModel("missing"))
+	var apiErr *APIError
+	if !errors.Is(err, ErrModelNotFound) || !errors.As(err, &apiErr) || apiErr.ErrorType != "invalid_request_error" || apiErr.ErrorCode != "model_not_found" {
+		t.Fatalf("missing model: %v", err)
+	}
+	if apiErr.Status != http.StatusNotFound || apiErr.Message != "The model does not exist" {
+		t.Fatalf("error %+v", apiErr)
+	}
+	// Methods without an endpoint fail as the server would.
+	if err := c.Call(context.Background(), MethodJobSubmit, nil, nil); !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("job submit: %v", err)
+	}
+
+	for body, class := range map[string]error{
+		`{"error":{"message":"bad key","type":"invalid_request_error","code":"invalid_api_key"}}`:          ErrUnauthorized,
+		`{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`: ErrPayloadTooLarge,
+		`{"error":{"message":"bad input","type":"invalid_request_error","code":null}}`:                     ErrInvalidParams,
+	} {
+		err := openaiAPIError(&APIError{Status: http.StatusBadRequest, Message: body})
+		if !errors.Is(err, class) {
+			t.Errorf("%s: %v, want %v", body, err, class)
+		}
+	}
+	quota := openaiAPIError(&APIError{Status: http.StatusTooManyRequests, Retryable: true, Message: `{"error":{"message":"quota","type":"insufficient_quota","code":"insufficient_quota"}}`})
+	if quota.(*APIError).Retryable {
+		t.Fatal("an exhausted quota is retryable")
+	}
+
+	if err := (ClientConfig{Transport: TransportStdio, Command: []string{"x"}, WireProtocol: OpenAICompat}).Validate(); err == nil {
+		t.Fatal("Validate accepted the openai wire protocol over stdio")
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidOptions marks a call refused before anything was sent because
+// its options are missing a value they need or cannot be combined; the
+// error is a *ValidationError listing them.
+var ErrInvalidOptions = errors.New("invalid options")
+
+// OptionProblem is one fault of the options of a call.
+type OptionProblem struct {
+	// Options names the options at fault, such as "WithDimensions", or
+	// "JobSpec.Inputs" for the fields of a JobSpec.
+	Options []string
+	// Reason says what is wrong with them, naming them too.
+	Reason string
+}
+
+// ValidationError is returned by Embed, EmbedBatch, EmbedBatchInto,
+// EmbedStream, SubmitJob, and Rank when the options of the call fail the
+// checks the client runs before the request is built. It lists every
+// problem found rather than the first, and matches ErrInvalidOptions.
+type ValidationError struct {
+	// Call is the method of Client refused, such as "EmbedBatch".
+	Call     string
+	Problems []OptionProblem
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		reasons[i] = p.Reason
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidOptions, strings.Join(reasons, "; "))
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidOptions }
+
+// optionCheck collects the problems of the options of one call.
+type optionCheck struct {
+	call     string
+	problems []OptionProblem
+}
+
+// addf records a problem with options, its reason formatted as by
+// fmt.Sprintf.
+func (v *optionCheck) addf(options []string, format string, args ...any) {
+	v.problems = append(v.problems, OptionProblem{Options: options, Reason: fmt.Sprintf(format, args...)})
+}
+
+// err returns the *ValidationError of the problems found, or nil.
+func (v *optionCheck) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Call: v.call, Problems: v.problems}
+}
+
+// checkEmbed checks the options o of an embed call, call naming it:
+// Embed, EmbedBatch, or EmbedBatchInto.
+func (c *Client) checkEmbed(call string, o *embedOptions) error {
+	o.call = call
+	v := &optionCheck{call: call}
+	c.checkEmbedOptions(v, o)
+	return v.err()
+}
+
+// checkEmbedOptions adds the problems of the embed options o to v. Embed
+// ignores the batching options, and is the one call whose o leaves
+// concurrency zero.
+func (c *Client) checkEmbedOptions(v *optionCheck, o *embedOptions) {
+	for _, name := range o.conflicts {
+		v.addf([]string{name}, "%s given twice with different values", name)
+	}
+	if o.overrides["WithModel"] && o.model == "" {
+		v.addf([]string{"WithModel"}, "WithModel needs a model")
+	}
+	if o.overrides["WithCallTimeout"] && o.timeout <= 0 {
+		v.addf([]string{"WithCallTimeout"}, "WithCallTimeout needs a positive timeout, not %s", o.timeout)
+	}
+	if o.overrides["WithMaxRequestBytes"] && o.maxRequestBytes <= 0 {
+		v.addf([]string{"WithMaxRequestBytes"}, "WithMaxRequestBytes needs a positive limit, not %d", o.maxRequestBytes)
+	}
+	if _, ok := priorityNames[o.priority]; !ok {
+		v.addf([]string{"WithPriority"}, "WithPriority: invalid priority %d", int(o.priority))
+	}
+	if v.call != "Embed" {
+		if o.size < 0 {
+			v.addf([]string{"WithBatchSize"}, "WithBatchSize must not be negative, got %d", o.size)
+		}
+		if o.concurrency < 1 {
+			v.addf([]string{"WithConcurrency"}, "WithConcurrency needs a positive concurrency, not %d", o.concurrency)
+		}
+	}
+	if o.dimensions < 0 {
+		v.addf([]string{"WithDimensions"}, "WithDimensions needs a positive dimension, not %d", o.dimensions)
+	}
+	if o.expectedDim < 0 {
+		v.addf([]string{"WithExpectedDimension"}, "WithExpectedDimension needs a positive dimension, not %d", o.expectedDim)
+	}
+	if o.dimensions > 0 && o.expectedDim > 0 && o.dimensions != o.expectedDim {
+		v.addf([]string{"WithDimensions", "WithExpectedDimension"}, "WithDimensions(%d) and WithExpectedDimension(%d) disagree", o.dimensions, o.expectedDim)
+	}
+	if o.dimensions > 0 && o.model == "" {
+		v.addf([]string{"WithDimensions", "WithModel"}, "WithDimensions(%d) needs a model; set WithModel or ClientConfig.Model", o.dimensions)
+	}
+	if o.truncate < TruncateNone || o.truncate > TruncateError {
+		v.addf([]string{"WithTruncate"}, "WithTruncate: unknown mode %s", o.truncate)
+	} else {
+		// Only a model list already cached is consulted here; planTruncation
+		// checks the one it fetches.
+		for _, m := range c.capabilities.cached() {
+			if m.Name == o.model {
+				checkTruncation(v, o, m)
+			}
+		}
+	}
+	if o.spool {
+		switch {
+		case c.cfg.Spool == nil:
+			v.addf([]string{"WithSpoolOnFailure"}, "WithSpoolOnFailure needs a spool; see ClientConfig.Spool")
+		case v.call == "EmbedBatchInto" || v.call == "Rank":
+			v.addf([]string{"WithSpoolOnFailure"}, "WithSpoolOnFailure cannot be used with %s, whose spooled vectors only SpoolResult would carry", v.call)
+		}
+		if o.partial {
+			v.addf([]string{"WithSpoolOnFailure", "WithPartialResults"}, "WithSpoolOnFailure and WithPartialResults cannot be combined: a spooled call returns no vectors")
+		}
+	}
+}
+
+// checkTruncation adds a problem to v when o asks for truncation but model
+// reports no token limit to count the inputs against.
+func checkTruncation(v *optionCheck, o *embedOptions, model ModelInfo) {
+	if o.truncate != TruncateNone && model.MaxInputTokens <= 0 {
+		v.addf([]string{"WithTruncate"}, "WithTruncate(%s) needs a token limit, and model %q reports no MaxInputTokens", o.truncate, model.Name)
+	}
+}
+
+// checkStream checks an EmbedStream call, which takes no options: the
+// client's defaults stand in for those of the other calls.
+func (c *Client) checkStream() error {
+	v := &optionCheck{call: "EmbedStream"}
+	c.checkRoute(v, c.cfg.Model)
+	if c.cfg.DryRun {
+		v.addf([]string{"WithDryRun"}, "WithDryRun cannot be combined with EmbedStream, whose frames only a server can answer")
+	}
+	o := embedOptions{model: c.cfg.Model, size: c.cfg.MaxBatchSize, concurrency: DefaultBatchConcurrency}
+	c.checkEmbedOptions(v, &o)
+	return v.err()
+}
+
+// checkRoute adds a problem to v when model is given WithModelRoute, for
+// calls that do not follow routes and would reach the wrong server.
+func (c *Client) checkRoute(v *optionCheck, model string) {
+	if _, ok := c.routes[model]; ok {
+		v.addf([]string{"WithModelRoute"}, "%s does not follow WithModelRoute, given model %q", v.call, model)
+	}
+}
+
+// checkRank checks the options o of a Rank call, along with the embed
+// options it passes on.
+func (c *Client) checkRank(o *rankOptions) error {
+	v := &optionCheck{call: "Rank"}
+	if o.k <= 0 && !o.all {
+		v.addf([]string{"WithTopK"}, "WithTopK needs a positive k, not %d", o.k)
+	}
+	if o.threshold && (math.IsNaN(float64(o.minScore)) || o.minScore < -1 || o.minScore > 1) {
+		v.addf([]string{"WithMinScore"}, "WithMinScore needs a cosine similarity within [-1, 1], not %v", o.minScore)
+	}
+	eo := embedOptions{model: c.cfg.Model, size: c.cfg.MaxBatchSize, concurrency: DefaultBatchConcurrency}
+	for _, opt := range o.embed {
+		opt(&eo)
+	}
+	// A routed model's options are its route's to check.
+	if _, ok := c.routes[eo.model]; !ok {
+		c.checkEmbedOptions(v, &eo)
+	}
+	return v.err()
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	var requests atomic.Int64
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := ClientConfig{Transport: TransportInProc, Handler: inprocHandler(countingHandler(defaultHandler, &requests))}
+	c, err := NewClient("", WithConfig(cfg), WithModelRoute("routed", "http://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	cfg.Spool = spool
+	spooling := inprocClient(t, cfg, countingHandler(defaultHandler, &requests))
+	dryRun := inprocClient(t, ClientConfig{DryRun: true}, countingHandler(defaultHandler, &requests))
+	// The model of unlimited lists no token limit; listed has the list
+	// cached before the call, unlisted fetches it.
+	unlimited := countingHandler(func(req *Request) *Response {
+		if req.Method != MethodListModels {
+			return defaultHandler(req)
+		}
+		raw, _ := json.Marshal(listModelsResult{Models: []ModelInfo{{Name: DefaultModel, Dimension: 3}}})
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}, &requests)
+	listed, unlisted := inprocClient(t, ClientConfig{}, unlimited), inprocClient(t, ClientConfig{}, unlimited)
+	if _, err := listed.ListModels(context.Background()); err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+
+	ctx := context.Background()
+	embed := func(opts ...EmbedOption) func(*Client) error {
+		return func(c *Client) error {
+			_, err := c.Embed(ctx, "x", opts...)
+			return err
+		}
+	}
+	batch := func(opts ...EmbedOption) func(*Client) error {
+		return func(c *Client) error {
+			_, err := c.EmbedBatch(ctx, []string{"x", "y"}, opts...)
+			return err
+		}
+	}
+	into := func(opts ...EmbedOption) func(*Client) error {
+		return func(c *Client) error {
+			_, err := c.EmbedBatchInto(ctx, []string{"x"}, make([]float32, 8), opts...)
+			return err
+		}
+	}
+	rank := func(opts ...RankOption) func(*Client) error {
+		return func(c *Client) error {
+			_, err := c.Rank(ctx, "q", []string{"a", "b"}, opts...)
+			return err
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		client *Client
+		call   func(*Client) error
+		// options lists the options of each problem expected, and reason
+		// a fragment of the message.
+		options [][]string
+		reason  string
+	}{
+		{"Embed with conflicting models", c, embed(WithModel("a"), WithModel("b")), [][]string{{"WithModel"}}, "given twice with different values"},
+		{"Embed with an empty model", c, embed(WithModel("")), [][]string{{"WithModel"}}, "needs a model"},
+		{"Embed with a zero timeout", c, embed(WithCallTimeout(0)), [][]string{{"WithCallTimeout"}}, "positive timeout, not 0s"},
+		{"Embed with a zero request limit", c, embed(WithMaxRequestBytes(0)), [][]string{{"WithMaxRequestBytes"}}, "positive limit"},
+		{"Embed with an unknown priority", c, embed(WithPriority(Priority(7))), [][]string{{"WithPriority"}}, "invalid priority 7"},
+		{"Embed with negative dimensions", c, embed(WithDimensions(-8)), [][]string{{"WithDimensions"}}, "positive dimension, not -8"},
+		{"Embed with an unknown truncation", c, embed(WithTruncate(TruncateMode(9))), [][]string{{"WithTruncate"}}, "TruncateMode(9)"},
+		{"Embed with dimensions and no model", c, embed(WithModel(""), WithDimensions(8)), [][]string{{"WithModel"}, {"WithDimensions", "WithModel"}}, "WithDimensions(8) needs a model"},
+		{"Embed truncating to a limit the listed model lacks", listed, embed(WithTruncate(TruncateEnd)), [][]string{{"WithTruncate"}}, "WithTruncate(end) needs a token limit"},
+		{"Embed truncating to a limit the fetched model list lacks", unlisted, embed(WithTruncate(TruncateError)), [][]string{{"WithTruncate"}}, `model "` + DefaultModel + `" reports no MaxInputTokens`},
+		{"Embed spooling without a spool", c, embed(WithSpoolOnFailure()), [][]string{{"WithSpoolOnFailure"}}, "ClientConfig.Spool"},
+		{"EmbedBatch with a negative batch size", c, batch(WithBatchSize(-1)), [][]string{{"WithBatchSize"}}, "not be negative, got -1"},
+		{"EmbedBatch with no concurrency", c, batch(WithConcurrency(0)), [][]string{{"WithConcurrency"}}, "positive concurrency"},
+		{"EmbedBatch with disagreeing dimensions", c, batch(WithDimensions(8), WithExpectedDimension(16)), [][]string{{"WithDimensions", "WithExpectedDimension"}}, "WithDimensions(8) and WithExpectedDimension(16) disagree"},
+		{"EmbedBatch spooling partial results", spooling, batch(WithSpoolOnFailure(), WithPartialResults()), [][]string{{"WithSpoolOnFailure", "WithPartialResults"}}, "cannot be combined"},
+		{"EmbedBatch with several faults", c, batch(WithCallTimeout(0), WithPriority(Priority(-2)), WithBatchSize(-1)), [][]string{{"WithCallTimeout"}, {"WithPriority"}, {"WithBatchSize"}}, "; "},
+		{"EmbedBatchInto with a negative expected dimension", c, into(WithExpectedDimension(-1)), [][]string{{"WithExpectedDimension"}}, "positive dimension"},
+		{"EmbedBatchInto spooling", spooling, into(WithExpectedDimension(8), WithSpoolOnFailure()), [][]string{{"WithSpoolOnFailure"}}, "cannot be used with EmbedBatchInto"},
+		{"Rank with k = 0", c, rank(WithTopK(0)), [][]string{{"WithTopK"}}, "positive k, not 0"},
+		{"Rank with a score out of range", c, rank(WithMinScore(1.5)), [][]string{{"WithMinScore"}}, "within [-1, 1]"},
+		{"Rank with a NaN score", c, rank(WithMinScore(float32(math.NaN()))), [][]string{{"WithMinScore"}}, "not NaN"},
+		{"Rank with bad embed options", spooling, rank(WithTopK(-1), WithRankEmbedOptions(WithSpoolOnFailure(), WithConcurrency(-1))), [][]string{{"WithTopK"}, {"WithConcurrency"}, {"WithSpoolOnFailure"}}, "cannot be used with Rank"},
+		{"EmbedStream of a routed model", routedDefault(t, &requests), func(c *Client) error {
+			_, err := c.EmbedStream(ctx, []string{"x"})
+			return err
+		}, [][]string{{"WithModelRoute"}}, `EmbedStream does not follow WithModelRoute, given model "routed"`},
+		{"EmbedStream in a dry run", dryRun, func(c *Client) error {
+			_, err := c.EmbedStream(ctx, []string{"x"})
+			return err
+		}, [][]string{{"WithDryRun"}}, "WithDryRun cannot be combined with EmbedStream"},
+		{"SubmitJob without inputs", c, func(c *Client) error {
+			_, err := c.SubmitJob(ctx, JobSpec{})
+			return err
+		}, [][]string{{"JobSpec.Inputs"}}, "at least one input"},
+		{"SubmitJob of a routed model", c, func(c *Client) error {
+			_, err := c.SubmitJob(ctx, JobSpec{Model: "routed", Inputs: []string{"x"}})
+			return err
+		}, [][]string{{"WithModelRoute"}}, "SubmitJob does not follow"},
+	} {
+		err := tc.call(tc.client)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: %v, want a *ValidationError", tc.name, err)
+			continue
+		}
+		var options [][]string
+		for _, p := range verr.Problems {
+			options = append(options, p.Options)
+		}
+		if !reflect.DeepEqual(options, tc.options) {
+			t.Errorf("%s: problems with %v, want %v", tc.name, options, tc.options)
+		}
+		if !strings.Contains(err.Error(), tc.reason) {
+			t.Errorf("%s: %q lacks %q", tc.name, err, tc.reason)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("%d requests reached the server", n)
+	}
+
+	// The combinations that make sense go through.
+	if _, err := c.EmbedBatchInto(ctx, []string{"x"}, make([]float32, 3), WithDimensions(3), WithExpectedDimension(3)); err != nil {
+		t.Fatalf("EmbedBatchInto with agreeing dimensions: %v", err)
+	}
+	if _, err := c.Rank(ctx, "q", []string{"a"}, WithTopK(0), WithAllScores()); err != nil {
+		t.Fatalf("Rank of all scores: %v", err)
+	}
+	if _, err := c.Embed(ctx, "x", WithBatchSize(-1), WithConcurrency(0)); err != nil {
+		t.Fatalf("Embed ignoring the batching options: %v", err)
+	}
+}
+
+// routedDefault returns a client whose ClientConfig.Model has a route.
+func routedDefault(t *testing.T, requests *atomic.Int64) *Client {
+	t.Helper()
+	cfg := ClientConfig{Transport: TransportInProc, Handler: inprocHandler(countingHandler(defaultHandler, requests)), Model: "routed"}
+	c, err := NewClient("", WithConfig(cfg), WithModelRoute("routed", "http://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
@@ -0,0 +1,523 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Option configures a Client built by NewClient.
+type Option func(*clientOptions) error
+
+// clientOptions collects the settings applied by Options.
+type clientOptions struct {
+	cfg                    ClientConfig
+	endpoints              []ClientConfig
+	cooldown               time.Duration
+	onFailover             func(FailoverEvent)
+	balancer               Balancer
+	outliers               OutlierPolicy
+	retry                  *RetryPolicy
+	onRetry                func(attempt int, err error)
+	rateLimit              *RateLimit
+	breaker                *CircuitBreaker
+	hedging                *HedgePolicy
+	slow                   SlowRequestPolicy
+	streamResumes          int
+	capabilityTTL          time.Duration
+	backgroundCapabilities bool
+	eventListener          EventListener
+	notifications          *NotificationPolicy
+	preprocess             []PreprocessStep
+	dns                    *DNSPolicy
+	onCircuit              func(CircuitEvent)
+	cache                  *CacheConfig
+	spool                  *Spool
+	coalescing             *CoalescingPolicy
+	scheduling             *SchedulingPolicy
+	singleFlight           bool
+	wireProtocol           string
+	codecs                 []string
+	codec                  string
+	transport              string
+	tlsConfig              *tls.Config
+	apiKey                 Secret
+	tokenSource            TokenSource
+	signing                SigningConfig
+	tracerProvider         TracerProvider
+	metrics                MetricsSink
+	wireDump               io.Writer
+	timeout                time.Duration
+	logger                 *slog.Logger
+	recorder               Recorder
+	maxInFlight            int
+	pipelineDepth          int
+	dryRun                 bool
+	laxValidation          bool
+	requireChecksums       bool
+	strictDecoding         bool
+	// interceptors are appended to the configured ones.
+	interceptors []Interceptor
+	// model overrides ClientConfig.Model; routes set it.
+	model  string
+	routes []modelRoute
+}
+
+// NewClient builds a Client for endpoint configured by opts. The endpoint is
+// a server URL; unless WithTransport says otherwise its scheme picks the
+// transport as ParseEndpoint does, and a transport that cannot reach it is
+// an error.
+// With no options an endpoint is all a client needs. An empty endpoint
+// leaves the choice to WithConfig or WithEndpoints; with several endpoints
+// the client fails over between them in order. Every invalid option is
+// reported in one joined error.
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	o, err := newClientOptions(endpoint, opts)
+	if err != nil {
+		return nil, err
+	}
+	return o.build()
+}
+
+// newClientOptions runs opts and resolves the base configuration.
+func newClientOptions(endpoint string, opts []Option) (*clientOptions, error) {
+	o := &clientOptions{}
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	o.apply(&o.cfg)
+	if endpoint != "" {
+		if len(o.endpoints) > 0 {
+			errs = append(errs, errors.New("NewClient: an endpoint cannot be combined with WithEndpoints"))
+		} else if err := applyEndpoint(&o.cfg, endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// build creates the Client described by o, along with its model routes.
+func (o *clientOptions) build() (*Client, error) {
+	c, err := o.buildClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.buildRoutes(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// buildClient creates the Client for o's endpoints.
+func (o *clientOptions) buildClient() (*Client, error) {
+	switch len(o.endpoints) {
+	case 0:
+		return New(o.cfg)
+	case 1:
+		ep := o.endpoints[0]
+		o.apply(&ep)
+		return New(ep)
+	}
+
+	members := make([]*failoverMember, 0, len(o.endpoints))
+	for i, ep := range o.endpoints {
+		o.apply(&ep)
+		ep = ep.withDefaults()
+		transport, err := NewTransport(ep)
+		if err != nil {
+			for _, m := range members {
+				_ = m.transport.Close()
+			}
+			return nil, fmt.Errorf("endpoint %d: %w", i, err)
+		}
+		members = append(members, &failoverMember{label: ep.endpointLabel(), transport: transport})
+	}
+	cfg, err := o.cfg.withCredentials()
+	if err != nil {
+		for _, m := range members {
+			_ = m.transport.Close()
+		}
+		return nil, err
+	}
+	transport := newFailoverTransport(members, o.cooldown, o.onFailover)
+	if o.balancer != nil {
+		transport.balance(o.balancer, o.outliers)
+	}
+	return NewWithTransport(cfg, transport), nil
+}
+
+// setRecorder installs the recorder of a Run or RunPing session.
+func (o *clientOptions) setRecorder(r Recorder) {
+	o.recorder, o.cfg.Recorder = r, r
+}
+
+// applyEndpoint points cfg at a NewClient endpoint, inferring the transport
+// from its scheme when none was chosen.
+func applyEndpoint(cfg *ClientConfig, endpoint string) error {
+	e, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return fmt.Errorf("NewClient: %w", err)
+	}
+	transport := cfg.Transport
+	if transport == "" {
+		transport = e.Transport
+	}
+	if err := e.apply(cfg, transport); err != nil {
+		return fmt.Errorf("NewClient: endpoint %q: %w", endpoint, err)
+	}
+	return nil
+}
+
+// apply lets the client-wide options override the matching cfg fields.
+func (o *clientOptions) apply(cfg *ClientConfig) {
+	if o.model != "" {
+		cfg.Model = o.model
+	}
+	if o.transport != "" {
+		cfg.Transport = o.transport
+	}
+	if o.tlsConfig != nil {
+		cfg.TLSConfig = o.tlsConfig
+	}
+	if o.apiKey != "" {
+		cfg.APIKey = o.apiKey
+	}
+	if o.tokenSource != nil {
+		cfg.TokenSource = o.tokenSource
+	}
+	if o.signing.enabled() {
+		cfg.Signing = o.signing
+	}
+	if o.tracerProvider != nil {
+		cfg.TracerProvider = o.tracerProvider
+	}
+	if o.metrics != nil {
+		cfg.Metrics = o.metrics
+	}
+	if o.wireDump != nil {
+		cfg.WireDump = o.wireDump
+	}
+	if o.timeout > 0 {
+		cfg.ReadTimeout, cfg.WriteTimeout = o.timeout, o.timeout
+	}
+	if o.dryRun {
+		cfg.DryRun = true
+	}
+	if o.laxValidation {
+		cfg.LaxValidation = true
+	}
+	if o.requireChecksums {
+		cfg.RequireChecksums = true
+	}
+	if o.strictDecoding {
+		cfg.StrictDecoding = true
+	}
+	if o.wireProtocol != "" {
+		cfg.WireProtocol = o.wireProtocol
+	}
+	if len(o.codecs) > 0 {
+		cfg.Codecs = o.codecs
+	}
+	if o.codec != "" {
+		cfg.Codec = o.codec
+	}
+	if o.logger != nil {
+		cfg.Logger = o.logger
+	}
+	if o.recorder != nil {
+		cfg.Recorder = o.recorder
+	}
+	if len(o.interceptors) > 0 {
+		cfg.Interceptors = append(cfg.Interceptors[:len(cfg.Interceptors):len(cfg.Interceptors)], o.interceptors...)
+	}
+	if o.maxInFlight > 0 {
+		cfg.MaxInFlight = o.maxInFlight
+	}
+	if o.pipelineDepth > 0 {
+		cfg.MaxPipelineDepth = o.pipelineDepth
+	}
+	if o.rateLimit != nil {
+		cfg.RateLimit = *o.rateLimit
+	}
+	if o.breaker != nil {
+		onChange := cfg.CircuitBreaker.OnStateChange
+		cfg.CircuitBreaker = *o.breaker
+		cfg.CircuitBreaker.OnStateChange = onChange
+	}
+	if o.onCircuit != nil {
+		cfg.CircuitBreaker.OnStateChange = o.onCircuit
+	}
+	if o.hedging != nil {
+		cfg.Hedging = *o.hedging
+	}
+	if o.cache != nil {
+		cfg.Cache = *o.cache
+	}
+	if o.spool != nil {
+		cfg.Spool = o.spool
+	}
+	if o.coalescing != nil {
+		cfg.Coalescing = *o.coalescing
+	}
+	if o.scheduling != nil {
+		cfg.Scheduling = *o.scheduling
+	}
+	if o.singleFlight {
+		cfg.SingleFlight = true
+	}
+	if o.retry != nil {
+		onRetry := cfg.Retry.OnRetry
+		cfg.Retry = *o.retry
+		cfg.Retry.OnRetry = onRetry
+	}
+	if o.onRetry != nil {
+		cfg.Retry.OnRetry = o.onRetry
+	}
+	if o.slow.Threshold > 0 {
+		cfg.SlowRequests.Threshold = o.slow.Threshold
+	}
+	if o.slow.FirstFrameThreshold > 0 || o.slow.StreamThreshold > 0 {
+		cfg.SlowRequests.FirstFrameThreshold, cfg.SlowRequests.StreamThreshold = o.slow.FirstFrameThreshold, o.slow.StreamThreshold
+	}
+	if o.streamResumes > 0 {
+		cfg.StreamResume.MaxResumes = o.streamResumes
+	}
+	if o.capabilityTTL > 0 {
+		cfg.Capabilities.TTL = o.capabilityTTL
+	}
+	if o.backgroundCapabilities {
+		cfg.Capabilities.BackgroundRefresh = true
+	}
+	if o.eventListener != nil {
+		cfg.EventListener = o.eventListener
+	}
+	if o.notifications != nil {
+		cfg.Notifications = *o.notifications
+	}
+	if o.preprocess != nil {
+		cfg.Preprocess = o.preprocess
+	}
+	if o.dns != nil {
+		cfg.DNS.Refresh, cfg.DNS.Spread = o.dns.Refresh, o.dns.Spread
+	}
+	if o.slow.OnSlow != nil {
+		cfg.SlowRequests.OnSlow = o.slow.OnSlow
+	}
+}
+
+// WithConfig sets the base configuration, which the other options and the
+// NewClient endpoint override. With WithEndpoints it supplies the settings
+// that are not tied to an endpoint, such as Model and Recorder.
+func WithConfig(cfg ClientConfig) Option {
+	return func(o *clientOptions) error {
+		o.cfg = cfg
+		return nil
+	}
+}
+
+// WithEndpoints lists endpoints in order of preference, each with its own
+// transport settings. Calls go to the first healthy endpoint and move to the
+// next when dialing or a request fails with a connection-class error;
+// application errors are returned as-is. A respawned or different server
+// holds a different session, so callers that depend on one should
+// re-Initialize from their WithOnFailover hook or after it fires.
+func WithEndpoints(endpoints ...ClientConfig) Option {
+	return func(o *clientOptions) error {
+		if len(endpoints) == 0 {
+			return errors.New("WithEndpoints: at least one endpoint is required")
+		}
+		for i, ep := range endpoints {
+			if err := ep.withDefaults().Validate(); err != nil {
+				return fmt.Errorf("WithEndpoints: endpoint %d: %w", i, err)
+			}
+		}
+		o.endpoints = append(o.endpoints, endpoints...)
+		return nil
+	}
+}
+
+// WithFailoverCooldown sets how long a failed endpoint is skipped before it
+// is tried again. The default is DefaultFailoverCooldown.
+func WithFailoverCooldown(d time.Duration) Option {
+	return func(o *clientOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("WithFailoverCooldown: cooldown must be positive, got %s", d)
+		}
+		o.cooldown = d
+		return nil
+	}
+}
+
+// WithOnFailover registers fn to be called whenever calls move to a different
+// endpoint, including the return to a preferred endpoint.
+func WithOnFailover(fn func(FailoverEvent)) Option {
+	return func(o *clientOptions) error {
+		o.onFailover = fn
+		return nil
+	}
+}
+
+// WithRetry retries transient failures of idempotent calls up to maxAttempts
+// times in total, waiting a full-jitter backoff between baseDelay and
+// maxDelay or the server's Retry-After. It overrides WithConfig's Retry.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(o *clientOptions) error {
+		p := RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: baseDelay, MaxDelay: maxDelay}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("WithRetry: %w", err)
+		}
+		o.retry = &p
+		return nil
+	}
+}
+
+// WithOnRetry registers fn to be called before each retry with the number of
+// the failed attempt and its error.
+func WithOnRetry(fn func(attempt int, err error)) Option {
+	return func(o *clientOptions) error {
+		o.onRetry = fn
+		return nil
+	}
+}
+
+// WithRateLimit paces every request the client sends to rps per second,
+// allowing bursts of up to burst requests. Calls over the limit block until
+// their turn or until their context is done. It overrides WithConfig's
+// RateLimit.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(o *clientOptions) error {
+		r := RateLimit{RPS: rps, Burst: burst}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("WithRateLimit: %w", err)
+		}
+		o.rateLimit = &r
+		return nil
+	}
+}
+
+// WithCircuitBreaker makes calls fail fast with ErrCircuitOpen for cooldown
+// after threshold consecutive connection-class failures, then lets one probe
+// call decide whether to close the circuit again. It overrides WithConfig's
+// CircuitBreaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *clientOptions) error {
+		b := CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("WithCircuitBreaker: %w", err)
+		}
+		o.breaker = &b
+		return nil
+	}
+}
+
+// WithOnCircuitChange registers fn to be called for every circuit breaker
+// state transition.
+func WithOnCircuitChange(fn func(CircuitEvent)) Option {
+	return func(o *clientOptions) error {
+		o.onCircuit = fn
+		return nil
+	}
+}
+
+// WithCache enables the embedding cache. A config without limits keeps
+// DefaultCacheEntries entries in memory, in front of its Disk if set. It
+// overrides WithConfig's Cache.
+func WithCache(cfg CacheConfig) Option {
+	return func(o *clientOptions) error {
+		if err := cfg.validate(); err != nil {
+			return fmt.Errorf("WithCache: %w", err)
+		}
+		if !cfg.memory() {
+			cfg.MaxEntries = DefaultCacheEntries
+		}
+		o.cache = &cfg
+		return nil
+	}
+}
+
+// WithTransport selects the transport by name (see the Transport constants),
+// overriding the one inferred from the endpoint.
+func WithTransport(name string) Option {
+	return func(o *clientOptions) error {
+		switch name {
+		case TransportStdio, TransportHTTP, TransportTLS, TransportHTTP3, TransportGRPC, TransportWebSocket, TransportUnix, TransportInProc:
+			o.transport = name
+			return nil
+		}
+		return fmt.Errorf("WithTransport: unknown transport %q", name)
+	}
+}
+
+// WithTLSConfig sets the base TLS configuration for the tls, http3, and wss
+// transports; see ClientConfig.TLSConfig.
+func WithTLSConfig(tc *tls.Config) Option {
+	return func(o *clientOptions) error {
+		if tc == nil {
+			return errors.New("WithTLSConfig: config must not be nil")
+		}
+		o.tlsConfig = tc
+		return nil
+	}
+}
+
+// WithAPIKey sets ClientConfig.APIKey, the bearer token authenticating
+// every request.
+func WithAPIKey(key string) Option {
+	return func(o *clientOptions) error {
+		if key == "" {
+			return errors.New("WithAPIKey: key must not be empty")
+		}
+		if strings.ContainsAny(key, "\r\n") {
+			return errors.New("WithAPIKey: key must not contain line breaks")
+		}
+		o.apiKey = Secret(key)
+		return nil
+	}
+}
+
+// WithTimeout bounds sending each request and waiting for its response,
+// setting ClientConfig.WriteTimeout and ReadTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *clientOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("WithTimeout: timeout must be positive, got %s", d)
+		}
+		o.timeout = d
+		return nil
+	}
+}
+
+// WithLogger sets ClientConfig.Logger. Any *slog.Logger will do; records
+// carry the transport and, for requests, the request ID as attributes.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *clientOptions) error {
+		if l == nil {
+			return errors.New("WithLogger: logger must not be nil")
+		}
+		o.logger = l
+		return nil
+	}
+}
+
+// WithTranscriptRecorder sends every envelope the client exchanges to r,
+// and a DirectionError entry for each request that fails, for example a
+// FileRecorder or a transcript.Recorder.
+func WithTranscriptRecorder(r Recorder) Option {
+	return func(o *clientOptions) error {
+		if r == nil {
+			return errors.New("WithTranscriptRecorder: recorder must not be nil")
+		}
+		o.recorder = r
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientEndpointOnly(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if c.Config().Transport != TransportHTTP {
+		t.Fatalf("expected the http transport, got %q", c.Config().Transport)
+	}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+}
+
+func TestNewClientInfersTransport(t *testing.T) {
+	cases := map[string]struct {
+		endpoint string
+		opts     []Option
+		want     ClientConfig
+	}{
+		"http":  {endpoint: "http://127.0.0.1:1/mcp", want: ClientConfig{Transport: TransportHTTP, Endpoint: "http://127.0.0.1:1/mcp"}},
+		"https": {endpoint: "https://localhost/mcp", want: ClientConfig{Transport: TransportTLS, Endpoint: "https://localhost/mcp"}},
+		"wss":   {endpoint: "wss://localhost/ws", want: ClientConfig{Transport: TransportWebSocket, Endpoint: "wss://localhost/ws"}},
+		"unix":  {endpoint: "unix:///tmp/mcp.sock", want: ClientConfig{Transport: TransportUnix, SocketPath: "/tmp/mcp.sock"}},
+		"explicit transport": {
+			endpoint: "https://localhost/mcp",
+			opts:     []Option{WithTransport(TransportHTTP3), WithConfig(ClientConfig{AllowFallback: true})},
+			want:     ClientConfig{Transport: TransportHTTP3, Endpoint: "https://localhost/mcp"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o, err := newClientOptions(tc.endpoint, tc.opts)
+			if err != nil {
+				t.Fatalf("newClientOptions: %v", err)
+			}
+			if o.cfg.Transport != tc.want.Transport || o.cfg.Endpoint != tc.want.Endpoint || o.cfg.SocketPath != tc.want.SocketPath {
+				t.Fatalf("got transport %q endpoint %q socket %q", o.cfg.Transport, o.cfg.Endpoint, o.cfg.SocketPath)
+			}
+		})
+	}
+}
+
+func TestNewClientAppliesOptions(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tc := &tls.Config{ServerName: "mcp.internal"}
+	sink := &recordingSink{}
+	c, err := NewClient("",
+		WithTimeout(3*time.Second),
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), ReadTimeout: time.Second}),
+		WithTLSConfig(tc),
+		WithLogger(logger),
+		WithTranscriptRecorder(sink),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	cfg := c.Config()
+	// Options win over WithConfig whatever their order.
+	if cfg.ReadTimeout != 3*time.Second || cfg.WriteTimeout != 3*time.Second || cfg.TLSConfig != tc || cfg.Logger != logger {
+		t.Fatalf("options not applied: %+v", cfg)
+	}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if len(sink.entries) != 2 || !strings.Contains(logs.String(), "method=mcp.initialize") {
+		t.Fatalf("expected a recorded and logged handshake, got %d entries and logs %q", len(sink.entries), logs.String())
+	}
+}
+
+func TestNewClientReportsEveryInvalidOption(t *testing.T) {
+	_, err := NewClient("ftp://example.com",
+		WithTransport("carrier-pigeon"),
+		WithTimeout(-time.Second),
+		WithTLSConfig(nil),
+		WithLogger(nil),
+		WithTranscriptRecorder(nil),
+		WithRetry(-1, 0, 0),
+	)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"ftp", "WithTransport", "WithTimeout", "WithTLSConfig", "WithLogger", "WithTranscriptRecorder", "WithRetry"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	_, err = NewClient("http://127.0.0.1/mcp", WithEndpoints(ClientConfig{Transport: TransportHTTP, Endpoint: "http://127.0.0.1/mcp"}))
+	if err == nil || !strings.Contains(err.Error(), "WithEndpoints") {
+		t.Fatalf("expected an endpoint conflict, got %v", err)
+	}
+}
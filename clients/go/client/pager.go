@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// ListOption customizes a listing call such as Models.
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	pageSize  int
+	allRoutes bool
+}
+
+// WithPageSize asks the server for at most n items per page. Without it the
+// server picks the page size.
+func WithPageSize(n int) ListOption {
+	return func(o *listOptions) { o.pageSize = n }
+}
+
+// pageToken is where the next page starts: servers answer either with an
+// opaque "next_cursor" or a numeric "next_offset", and the token is sent
+// back as "cursor" or "offset" to match.
+type pageToken struct {
+	cursor string
+	offset int
+	// set distinguishes offset 0 from no further page.
+	set bool
+}
+
+func (t pageToken) String() string {
+	if t.cursor != "" {
+		return t.cursor
+	}
+	return strconv.Itoa(t.offset)
+}
+
+// params returns the listing request parameters for the page at t, or nil
+// for the first page of a listing with no page size, so such requests look
+// as they did before paging.
+func (t pageToken) params(pageSize int) map[string]any {
+	if !t.set && pageSize <= 0 {
+		return nil
+	}
+	params := make(map[string]any)
+	switch {
+	case t.cursor != "":
+		params["cursor"] = t.cursor
+	case t.set:
+		params["offset"] = t.offset
+	}
+	if pageSize > 0 {
+		params["limit"] = pageSize
+	}
+	return params
+}
+
+// pageLinks decodes the paging fields of a listing result.
+type pageLinks struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+}
+
+func (l pageLinks) next() pageToken {
+	switch {
+	case l.NextCursor != "":
+		return pageToken{cursor: l.NextCursor, set: true}
+	case l.NextOffset != nil:
+		return pageToken{offset: *l.NextOffset, set: true}
+	}
+	return pageToken{}
+}
+
+// fetchPage fetches the page at token, returning its items and where the
+// following page starts; a zero token ends the listing.
+type fetchPage[T any] func(ctx context.Context, token pageToken, pageSize int) ([]T, pageToken, error)
+
+// Iterator walks a paged listing, fetching each page only once the items
+// before it are consumed. Use it like a bufio.Scanner:
+//
+//	it := c.Models(ctx)
+//	for it.Next() {
+//		m := it.Item()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iterator[T any] struct {
+	ctx      context.Context
+	fetch    fetchPage[T]
+	pageSize int
+
+	page    []T
+	pos     int
+	next    pageToken
+	started bool
+	item    T
+	err     error
+}
+
+func newIterator[T any](ctx context.Context, fetch fetchPage[T], opts []ListOption) *Iterator[T] {
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	it := &Iterator[T]{ctx: ctx, fetch: fetch, pageSize: o.pageSize}
+	if o.pageSize < 0 {
+		it.err = fmt.Errorf("page size must not be negative, got %d", o.pageSize)
+	}
+	return it
+}
+
+// Next advances to the next item, fetching the following page when the
+// current one is exhausted. It returns false at the end of the listing, on
+// error, and once ctx is done; Err tells them apart.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	for it.pos >= len(it.page) {
+		if it.started && !it.next.set {
+			return false
+		}
+		page, next, err := it.fetch(it.ctx, it.next, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// A server that hands back the token it was given would never end.
+		if it.started && next.set && next == it.next {
+			it.err = fmt.Errorf("page token %s repeated: %w", next, ErrProtocol)
+			return false
+		}
+		it.page, it.pos, it.next, it.started = page, 0, next, true
+	}
+	it.item = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+// Item returns the item Next advanced to.
+func (it *Iterator[T]) Item() T { return it.item }
+
+// Err returns the error that stopped the iteration, or nil at the end of the
+// listing.
+func (it *Iterator[T]) Err() error { return it.err }
+
+// collectAll drains it into a slice.
+func collectAll[T any](it *Iterator[T]) ([]T, error) {
+	var items []T
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	return items, it.Err()
+}
+
+// pagedResult is a listing result that embeds pageLinks.
+type pagedResult interface {
+	links() pageLinks
+}
+
+func (l pageLinks) links() pageLinks { return l }
+
+// listPage calls a listing method for the page at token, decodes the answer
+// into result, and returns where the following page starts.
+func (c *Client) listPage(ctx context.Context, method string, token pageToken, pageSize int, result pagedResult) (pageToken, error) {
+	if err := c.Call(ctx, method, token.params(pageSize), result); err != nil {
+		return pageToken{}, err
+	}
+	return result.links().next(), nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// pagedModels serves fakeModels plus extra models two per page, linking the
+// pages with next_cursor, or next_offset when offsets is set, and ending with
+// an empty page. repeat makes every page point back at the first.
+type pagedModels struct {
+	offsets, repeat bool
+	calls           atomic.Int32
+	limits          []int
+}
+
+var pagedModelList = append(append([]ModelInfo(nil), fakeModels...),
+	ModelInfo{Name: "text-embedding-3-large", Dimension: 3},
+	ModelInfo{Name: "multilingual-e5", Dimension: 3},
+)
+
+func (p *pagedModels) handle(req *Request) *Response {
+	if req.Method != MethodListModels {
+		return defaultHandler(req)
+	}
+	p.calls.Add(1)
+	var params struct {
+		Cursor string `json:"cursor"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	p.limits = append(p.limits, params.Limit)
+	start := params.Offset
+	if params.Cursor != "" {
+		start = map[string]int{"second": 2, "third": 4}[params.Cursor]
+	}
+	end := min(start+2, len(pagedModelList))
+	result := listModelsResult{Models: pagedModelList[start:end]}
+	// Pages start at 0, 2, and 4; the third is empty and ends the listing.
+	if start < len(pagedModelList) {
+		next := map[int]string{0: "second", 2: "third"}[start]
+		if p.repeat {
+			next = "second"
+		}
+		if p.offsets {
+			n := end
+			result.NextOffset = &n
+		} else {
+			result.NextCursor = next
+		}
+	}
+	raw, _ := json.Marshal(result)
+	return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+}
+
+func newPagedClient(t *testing.T, p *pagedModels) *Client {
+	t.Helper()
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(p.handle)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestModelsIteratorFollowsPages(t *testing.T) {
+	for _, offsets := range []bool{false, true} {
+		p := &pagedModels{offsets: offsets}
+		c := newPagedClient(t, p)
+		it := c.Models(context.Background(), WithPageSize(2))
+		if p.calls.Load() != 0 {
+			t.Fatal("the first page was fetched before Next")
+		}
+		var got []ModelInfo
+		for it.Next() {
+			got = append(got, it.Item())
+			// Pages are fetched only as they are reached.
+			if want := int32((len(got) + 1) / 2); p.calls.Load() != want {
+				t.Fatalf("after %d items, %d pages were fetched, want %d", len(got), p.calls.Load(), want)
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("offsets %v: Err: %v", offsets, err)
+		}
+		if !reflect.DeepEqual(got, pagedModelList) || p.calls.Load() != 3 {
+			t.Fatalf("offsets %v: got %d models in %d pages", offsets, len(got), p.calls.Load())
+		}
+		if !reflect.DeepEqual(p.limits, []int{2, 2, 2}) {
+			t.Fatalf("page size not sent: %v", p.limits)
+		}
+	}
+}
+
+func TestListModelsDrainsPages(t *testing.T) {
+	p := &pagedModels{}
+	c := newPagedClient(t, p)
+	models, err := c.ListModels(context.Background())
+	if err != nil || !reflect.DeepEqual(models, pagedModelList) {
+		t.Fatalf("ListModels = %d models, %v", len(models), err)
+	}
+	// The listing feeds model validation, including models on later pages.
+	if _, err := c.lookupModel(context.Background(), "multilingual-e5"); err != nil {
+		t.Fatalf("lookupModel: %v", err)
+	}
+}
+
+func TestModelsIteratorStopsOnCancel(t *testing.T) {
+	p := &pagedModels{}
+	c := newPagedClient(t, p)
+	ctx, cancel := context.WithCancel(context.Background())
+	it := c.Models(ctx, WithPageSize(2))
+	if !it.Next() {
+		t.Fatalf("Next: %v", it.Err())
+	}
+	cancel()
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("expected the iteration to stop with context.Canceled, got %v", it.Err())
+	}
+	if p.calls.Load() != 1 {
+		t.Fatalf("expected no fetch after cancel, got %d pages", p.calls.Load())
+	}
+}
+
+func TestModelsIteratorRejectsRepeatedToken(t *testing.T) {
+	c := newPagedClient(t, &pagedModels{repeat: true})
+	models, err := collectAll(c.Models(context.Background()))
+	if !errors.Is(err, ErrProtocol) || len(models) != 2 {
+		t.Fatalf("expected ErrProtocol after the first page, got %d models and %v", len(models), err)
+	}
+	if it := c.Models(context.Background(), WithPageSize(-1)); it.Next() || it.Err() == nil {
+		t.Fatal("expected an error for a negative page size")
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnhealthy reports a server that answered a ping with "ok": false.
+var ErrUnhealthy = errors.New("server reported unhealthy")
+
+// PingResult is the outcome of Client.Ping.
+type PingResult struct {
+	// OK is the server's own health verdict; servers that omit it are
+	// taken to be healthy.
+	OK bool `json:"ok"`
+	// Latency is the round-trip time measured by the client.
+	Latency time.Duration `json:"-"`
+	// ServerVersion comes from the ping result, or from the session
+	// established by Initialize when the server leaves it out.
+	ServerVersion string `json:"server_version,omitempty"`
+	// ProtocolVersion is the MCP protocol version the server reports, or
+	// the one negotiated by Initialize.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+}
+
+// MarshalJSON reports Latency in milliseconds as latency_ms.
+func (r PingResult) MarshalJSON() ([]byte, error) {
+	type plain PingResult
+	return json.Marshal(struct {
+		plain
+		LatencyMS float64 `json:"latency_ms"`
+	}{plain(r), float64(r.Latency) / float64(time.Millisecond)})
+}
+
+// Ping sends a single mcp.ping and reports the round-trip latency and the
+// server's versions. It is meant for health checks: it bypasses the rate
+// limiter, retries, and circuit breaker, so it measures the server as it is
+// right now without consuming budget meant for real calls. Over stdio a
+// successful ping also proves the subprocess is alive and reading.
+func (c *Client) Ping(ctx context.Context) (PingResult, error) {
+	params := map[string]any{"transport": c.transport.Kind()}
+	if id := c.SessionID(); id != "" {
+		params["session_id"] = id
+	}
+	var raw pingWire
+	start := time.Now()
+	if err := c.exchange(ctx, MethodPing, params, &raw); err != nil {
+		return PingResult{}, err
+	}
+	result := PingResult{
+		OK:              raw.OK == nil || *raw.OK,
+		Latency:         time.Since(start),
+		ServerVersion:   raw.ServerVersion,
+		ProtocolVersion: raw.ProtocolVersion,
+	}
+	c.mu.Lock()
+	if result.ServerVersion == "" && c.session != nil {
+		result.ServerVersion = c.session.ServerVersion
+	}
+	if result.ProtocolVersion == "" {
+		result.ProtocolVersion = c.protocolVersion
+	}
+	c.mu.Unlock()
+	return result, nil
+}
+
+// pingWire is the result of MethodPing as servers send it. The latency
+// they measure and the sequence they echo are read no further.
+type pingWire struct {
+	OK              *bool           `json:"ok"`
+	ServerVersion   string          `json:"server_version"`
+	ProtocolVersion string          `json:"protocol_version"`
+	LatencyMS       json.RawMessage `json:"latency_ms"`
+	Sequence        json.RawMessage `json:"sequence"`
+}
+
+// RunPing pings the server described by opts, writes the PingResult
+// to opts.Stdout as opts.Output renders it, and fails with ErrUnhealthy when the server
+// reports itself unhealthy. No handshake is performed.
+func RunPing(ctx context.Context, opts Options) (err error) {
+	if opts.DryRun {
+		return opts.dryRun(ctx, RunPing)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	result, err := c.Ping(ctx)
+	if err != nil {
+		return err
+	}
+	markers.ProtocolVersion = result.ProtocolVersion
+	markers.Codec = c.codecMarker()
+	if opts.Stdout != nil {
+		out := opts.Output
+		out.Indent = "  "
+		if err := out.Render(opts.Stdout, result, []any{result}); err != nil {
+			return fmt.Errorf("write ping result: %w", err)
+		}
+	}
+	if !result.OK {
+		return fmt.Errorf("%s: %w", MethodPing, ErrUnhealthy)
+	}
+	return nil
+}
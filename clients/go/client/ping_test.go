@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPingAcrossTransports(t *testing.T) {
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+
+	configs := map[string]ClientConfig{
+		"stdio":  {Command: helperCommand(t)},
+		"http":   {Transport: TransportHTTP, Endpoint: httpSrv.URL},
+		"ws":     {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		"inproc": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			cfg.RateLimit = RateLimit{RPS: 0.001}
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			if _, err := c.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize: %v", err)
+			}
+			// The handshake took the only token; pings must not wait for more.
+			for i := 0; i < 3; i++ {
+				res, err := c.Ping(context.Background())
+				if err != nil {
+					t.Fatalf("Ping: %v", err)
+				}
+				if !res.OK || res.Latency <= 0 || res.ServerVersion != "0.1.0" {
+					t.Fatalf("unexpected result %+v", res)
+				}
+			}
+			if s := c.RateLimitStats(); s.Requests != 1 {
+				t.Fatalf("pings reached the rate limiter: %+v", s)
+			}
+		})
+	}
+}
+
+func TestPingSkipsRetries(t *testing.T) {
+	srv, calls := flakyServer(t, 100, http.StatusServiceUnavailable, nil)
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Ping(context.Background()); err == nil || calls.Load() != 1 {
+		t.Fatalf("expected a single failed attempt, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestPingDeadSubprocess(t *testing.T) {
+	c, err := New(ClientConfig{Command: []string{"false"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Ping(context.Background()); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+}
+
+func TestRunPing(t *testing.T) {
+	var out strings.Builder
+	err := RunPing(context.Background(), Options{
+		Config: ClientConfig{Transport: TransportInProc, Handler: func(Request) (Response, error) {
+			return Response{Result: json.RawMessage(`{"ok":true,"server_version":"1.2.3","protocol_version":"2024-11-05"}`)}, nil
+		}},
+		Stdout: &out,
+	})
+	if err != nil {
+		t.Fatalf("RunPing: %v", err)
+	}
+	var printed map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &printed); err != nil {
+		t.Fatalf("decode output: %v\n%s", err, out.String())
+	}
+	if printed["ok"] != true || printed["server_version"] != "1.2.3" || printed["protocol_version"] != "2024-11-05" {
+		t.Fatalf("unexpected output %s", out.String())
+	}
+	if _, ok := printed["latency_ms"].(float64); !ok {
+		t.Fatalf("output lacks latency_ms: %s", out.String())
+	}
+
+	err = RunPing(context.Background(), Options{Config: ClientConfig{Transport: TransportInProc, Handler: func(Request) (Response, error) {
+		return Response{Result: json.RawMessage(`{"ok":false}`)}, nil
+	}}})
+	if !errors.Is(err, ErrUnhealthy) {
+		t.Fatalf("expected ErrUnhealthy, got %v", err)
+	}
+}
+
+// markingRecorder is a session recorder that stores its SessionMarkers.
+type markingRecorder struct {
+	recordingSink
+	markers SessionMarkers
+}
+
+func (r *markingRecorder) MarkSession(m SessionMarkers) { r.markers = m }
+
+func TestRunPingTranscriptRecorder(t *testing.T) {
+	rec := &markingRecorder{}
+	err := RunPing(context.Background(), Options{
+		Config: ClientConfig{Transport: TransportInProc, Handler: func(Request) (Response, error) {
+			return Response{Result: json.RawMessage(`{"ok":true,"protocol_version":"2024-11-05"}`)}, nil
+		}},
+		TranscriptRecorder: rec,
+		Stdout:             io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("RunPing: %v", err)
+	}
+	if len(rec.entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(rec.entries))
+	}
+	want := SessionMarkers{Transport: TransportInProc, ProtocolVersion: "2024-11-05"}
+	if rec.markers != want {
+		t.Fatalf("markers = %+v, want %+v", rec.markers, want)
+	}
+}
@@ -0,0 +1,577 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithMaxPipelineDepth sets ClientConfig.MaxPipelineDepth.
+func WithMaxPipelineDepth(n int) Option {
+	return func(o *clientOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("WithMaxPipelineDepth: depth must be positive, got %d", n)
+		}
+		o.pipelineDepth = n
+		return nil
+	}
+}
+
+func (cfg ClientConfig) validatePipeline() error {
+	if cfg.MaxPipelineDepth < 0 {
+		return errors.New("max pipeline depth must not be negative")
+	}
+	if cfg.MaxPipelineDepth <= 1 {
+		return nil
+	}
+	switch cfg.Transport {
+	case TransportStdio, TransportUnix, TransportInProc:
+		return nil
+	}
+	return fmt.Errorf("max pipeline depth applies to the stdio, unix, and inproc transports, not %s", cfg.Transport)
+}
+
+// pipeline multiplexes the calls of a streamTransport with a
+// MaxPipelineDepth over its stream. Calls write their frames one at a time
+// and wait on a channel of their own; demux reads every answer and routes
+// it by ID, so the server may answer in any order, and hands the
+// notifications between them to events. A response for an ID no
+// call awaits means the two ends disagree about the stream, and ends it
+// with ErrProtocol.
+type pipeline struct {
+	kind string
+	opts *streamOptions
+	conn io.ReadWriteCloser
+	// events, set once the client observes the transport, takes the
+	// notifications demux reads.
+	events atomic.Pointer[transportEvents]
+	// wsem holds the right to write a frame.
+	wsem chan struct{}
+
+	mu      sync.Mutex
+	waiters map[int64]*pipeWaiter
+	// abandoned holds the calls given up on after their frame was written,
+	// whose answers are discarded as they arrive; stream marks those still
+	// expecting frames after the first.
+	abandoned map[int64]bool
+
+	done chan struct{}
+	once sync.Once
+	// err is why the pipeline ended, set before done is closed.
+	err error
+}
+
+// pipeFrame is a frame routed to a call, or the failure ending it.
+type pipeFrame struct {
+	resp *Response
+	err  error
+}
+
+// pipeWaiter is a call awaiting its answer.
+type pipeWaiter struct {
+	ch   chan pipeFrame
+	gone chan struct{}
+	// limit and read track the call's response against MaxResponseBytes;
+	// read is also the call's Failure.BytesRead.
+	limit int64
+	read  atomic.Int64
+	rec   *wireRecorder
+}
+
+func newPipeline(kind string, opts *streamOptions, conn io.ReadWriteCloser, reader *bufio.Reader, ev *transportEvents) *pipeline {
+	p := &pipeline{
+		kind:      kind,
+		opts:      opts,
+		conn:      conn,
+		wsem:      make(chan struct{}, 1),
+		waiters:   make(map[int64]*pipeWaiter),
+		abandoned: make(map[int64]bool),
+		done:      make(chan struct{}),
+	}
+	if ev != nil {
+		p.events.Store(ev)
+	}
+	go p.demux(reader)
+	return p
+}
+
+// fail ends the pipeline with err and closes its stream; calls waiting on
+// it return err.
+func (p *pipeline) fail(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+		_ = p.conn.Close()
+	})
+}
+
+// failure is the error ending a call of the pipeline once it is done:
+// written reports whether the call's frame went out.
+func (p *pipeline) failure(written bool) error {
+	var loss *streamLoss
+	if errors.As(p.err, &loss) {
+		return &streamLoss{written: written, err: loss.err}
+	}
+	return p.err
+}
+
+// demux reads the answers of the stream until it fails.
+func (p *pipeline) demux(reader *bufio.Reader) {
+	for {
+		payload, err := p.opts.framing.read(reader)
+		if err != nil {
+			if !errors.Is(err, ErrFrameTooLarge) {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				err = &streamLoss{written: true, err: fmt.Errorf("read: %w", err)}
+			}
+			p.fail(err)
+			return
+		}
+		resp, n, err := decodeInbound(payload)
+		if err != nil {
+			p.fail(fmt.Errorf("decode response: %w: %w", ErrProtocol, err))
+			return
+		}
+		if n != nil {
+			p.events.Load().notify(p.kind, n)
+			continue
+		}
+		if !p.route(resp, len(payload)) {
+			return
+		}
+	}
+}
+
+// route hands resp, size bytes on the wire, to the call awaiting it.
+func (p *pipeline) route(resp *Response, size int) bool {
+	p.mu.Lock()
+	w := p.waiters[resp.ID]
+	if w == nil {
+		stream, ok := p.abandoned[resp.ID]
+		if ok && (!stream || finalFrame(resp)) {
+			delete(p.abandoned, resp.ID)
+		}
+		p.mu.Unlock()
+		if !ok {
+			p.fail(fmt.Errorf("response for unknown request id %d: %w", resp.ID, ErrProtocol))
+		}
+		return ok
+	}
+	p.mu.Unlock()
+	f := pipeFrame{resp: resp}
+	if read := w.read.Add(int64(size)); w.limit > 0 && read > w.limit {
+		f = pipeFrame{err: responseTooLarge(read, w.limit)}
+	} else if w.rec != nil {
+		w.rec.read(resp)
+	}
+	select {
+	case w.ch <- f:
+	case <-w.gone:
+	case <-p.done:
+		return false
+	}
+	return true
+}
+
+// finalFrame reports whether resp ends a stream: an error, or the done
+// frame of MethodEmbedStream.
+func finalFrame(resp *Response) bool {
+	var f struct {
+		Done bool `json:"done"`
+	}
+	return resp.Error != nil || json.Unmarshal(resp.Result, &f) != nil || f.Done
+}
+
+// errIDOutstanding rejects a call reusing the ID of one still awaiting its
+// answer, which could not be told apart from it on the stream. The stream
+// itself is intact.
+var errIDOutstanding = errors.New("request id already outstanding")
+
+// register adds a call awaiting id.
+func (p *pipeline) register(id int64, w *pipeWaiter) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.done:
+		return p.failure(false)
+	default:
+	}
+	if p.waiters[id] != nil {
+		return fmt.Errorf("%w: %d on the %s stream: %w", errIDOutstanding, id, p.kind, ErrProtocol)
+	}
+	// A late answer to an abandoned call goes to its replay.
+	delete(p.abandoned, id)
+	p.waiters[id] = w
+	return nil
+}
+
+// unregister removes the call awaiting id; with abandon set its answers,
+// still to come, are discarded.
+func (p *pipeline) unregister(id int64, w *pipeWaiter, abandon, stream bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(w.gone)
+	delete(p.waiters, id)
+	if abandon {
+		p.abandoned[id] = stream
+	}
+}
+
+// alone reports whether the call awaiting id is the only one on the
+// stream.
+func (p *pipeline) alone(id int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.waiters) == 1 && p.waiters[id] != nil
+}
+
+// notify writes a notification between the frames of the calls sharing
+// the stream.
+func (p *pipeline) notify(ctx context.Context, payload []byte, closing <-chan struct{}) error {
+	select {
+	case p.wsem <- struct{}{}:
+	case <-p.done:
+		return p.failure(false)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closing:
+		return errTransportClosed
+	}
+	wrote := make(chan error, 1)
+	go func() {
+		err := p.opts.framing.write(p.conn, payload)
+		<-p.wsem
+		wrote <- err
+	}()
+	writeTimer := newPhaseTimer(p.opts.timeouts.write)
+	defer writeTimer.stop()
+	select {
+	case err := <-wrote:
+		if err != nil {
+			p.fail(&streamLoss{err: fmt.Errorf("write: %w", err)})
+			return fmt.Errorf("stream: %w: write: %w", ErrConnectionLost, err)
+		}
+		return nil
+	case <-writeTimer.C():
+		return fmt.Errorf("%w after %s", ErrWriteTimeout, p.opts.timeouts.write)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closing:
+		return errTransportClosed
+	}
+}
+
+// exchange writes frame and hands the frames answering req to handle until
+// it reports the last one, as streamTransport.exchange does, while other
+// calls share the stream. A call given up on, by its context or a timeout,
+// leaves the stream to the others.
+func (p *pipeline) exchange(ctx context.Context, frame *pooledFrame, req *Request, stream bool, handle frameHandler, closing <-chan struct{}) (err error) {
+	w := &pipeWaiter{ch: make(chan pipeFrame, 1), gone: make(chan struct{}), limit: responseLimit(ctx, p.opts.maxResponse)}
+	w.rec, _ = ctx.Value(wireRecordKey{}).(*wireRecorder)
+	if err := p.register(req.ID, w); err != nil {
+		return err
+	}
+	written, clean := false, false
+	defer func() {
+		p.unregister(req.ID, w, written && !clean, stream)
+		if err != nil && w.read.Load() > 0 {
+			err = readFailure(err, w.read.Load())
+		}
+	}()
+
+	select {
+	case p.wsem <- struct{}{}:
+	case <-p.done:
+		return p.failure(false)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closing:
+		return errTransportClosed
+	}
+	if err := ctx.Err(); err != nil {
+		// The select above may have picked the free stream over an ended
+		// context; a write never started costs nothing to give up.
+		<-p.wsem
+		return err
+	}
+	if w.rec != nil {
+		w.rec.written()
+	}
+	// Once started, the write runs to its end, so the stream never holds
+	// half a frame for the next writer, unless no other call shares the
+	// stream.
+	wrote := make(chan error, 1)
+	frame.retain()
+	go func() {
+		err := p.opts.framing.write(p.conn, frame.bytes())
+		frame.release()
+		<-p.wsem
+		wrote <- err
+	}()
+	writeTimer := newPhaseTimer(p.opts.timeouts.write)
+	defer writeTimer.stop()
+	select {
+	case err := <-wrote:
+		if err != nil {
+			loss := &streamLoss{err: fmt.Errorf("write: %w", err)}
+			p.fail(loss)
+			return loss
+		}
+	case <-writeTimer.C():
+		return fmt.Errorf("%w after %s", ErrWriteTimeout, p.opts.timeouts.write)
+	case <-ctx.Done():
+		if p.alone(req.ID) {
+			// Replacing the stream costs no other call anything, and saves
+			// the rest of a write nobody wants.
+			return fmt.Errorf("%w: %w", errWriteAbandoned, ctx.Err())
+		}
+		written = true
+		return ctx.Err()
+	case <-closing:
+		return errTransportClosed
+	}
+	written = true
+	markPhase(ctx, PhaseReceive)
+
+	for {
+		readTimer := newPhaseTimer(p.opts.timeouts.read)
+		select {
+		case f := <-w.ch:
+			readTimer.stop()
+			if f.err != nil {
+				return f.err
+			}
+			more, err := handle(f.resp)
+			if err != nil {
+				return err
+			}
+			if !more {
+				clean = true
+				return nil
+			}
+		case <-p.done:
+			readTimer.stop()
+			return p.failure(true)
+		case <-readTimer.C():
+			return fmt.Errorf("%w after %s", ErrReadTimeout, p.opts.timeouts.read)
+		case <-ctx.Done():
+			readTimer.stop()
+			return ctx.Err()
+		case <-closing:
+			readTimer.stop()
+			return errTransportClosed
+		}
+	}
+}
+
+// roundTripPipelined is roundTrip for a transport with a MaxPipelineDepth:
+// up to that many calls share the stream at once, each replayed on its own
+// when the stream is lost under it, as roundTrip would.
+func (t *streamTransport) roundTripPipelined(ctx context.Context, req *Request, frame *pooledFrame, stream bool, handle frameHandler) error {
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.closing:
+		return errTransportClosed
+	}
+	defer func() { <-t.slots }()
+
+	delivered := false
+	counted := func(r *Response) (bool, error) {
+		delivered = true
+		return handle(r)
+	}
+	for {
+		p, err := t.pipelineFor(ctx)
+		if err != nil {
+			return err
+		}
+		err = p.exchange(ctx, frame, req, stream, counted, t.closing)
+		var loss *streamLoss
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &loss):
+			lost := fmt.Errorf("%s stream: %w: %w", t.kind, ErrConnectionLost, loss.err)
+			t.mu.Lock()
+			// The first call to see the loss redials; the others join it.
+			if t.pipe == p {
+				t.drop(loss.err)
+				if t.restarts >= t.opts.policy.maxRestarts {
+					t.broken = lost
+				}
+			}
+			broken := t.broken != nil
+			t.mu.Unlock()
+			if broken || loss.written && (delivered || !replayableMethods[req.Method]) {
+				return readFailure(lost, BytesRead(err))
+			}
+		case errors.Is(err, errIDOutstanding):
+			return err
+		case errors.Is(err, errWriteAbandoned):
+			// A call joining the stream meanwhile is replayed on the next,
+			// its frame not having gone out.
+			t.mu.Lock()
+			if t.pipe == p {
+				t.drop(&streamLoss{err: err})
+			}
+			t.mu.Unlock()
+			return fmt.Errorf("%s stream: %w", t.kind, err)
+		case errors.Is(err, ErrResponseTooLarge), errors.Is(err, ErrReadTimeout):
+			// The stream is intact; the call alone is given up on.
+			return fmt.Errorf("%s stream: %w", t.kind, err)
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			return err
+		case errors.Is(err, errTransportClosed):
+			return err
+		default:
+			t.mu.Lock()
+			if t.pipe == p {
+				t.poison(fmt.Errorf("%s stream: %w", t.kind, err))
+			}
+			broken := t.broken
+			t.mu.Unlock()
+			if broken == nil {
+				broken = fmt.Errorf("%s stream: %w", t.kind, err)
+			}
+			return readFailure(broken, BytesRead(err))
+		}
+	}
+}
+
+// pipeliningTransport is implemented by the transports that may share
+// their stream between calls.
+type pipeliningTransport interface {
+	pipelined() bool
+}
+
+func (t *streamTransport) pipelined() bool { return t.slots != nil }
+
+// pipelineFor returns the pipeline of the stream, dialing it if needed.
+func (t *streamTransport) pipelineFor(ctx context.Context) (*pipeline, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.broken != nil {
+		return nil, t.broken
+	}
+	if t.conn == nil {
+		if err := t.open(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return t.pipe, nil
+}
+
+// closeOnce closes its stream once, so the pipeline and the transport may
+// each close it.
+type closeOnce struct {
+	io.ReadWriteCloser
+	once sync.Once
+	err  error
+}
+
+func (c *closeOnce) Close() error {
+	c.once.Do(func() { c.err = c.ReadWriteCloser.Close() })
+	return c.err
+}
+
+// wireRecordKey carries the wireRecorder of a call to a pipelining
+// transport.
+type wireRecordKey struct{}
+
+// wireRecorder records the envelopes of a call as a pipelining transport
+// writes and reads them, so a transcript keeps the order in which they
+// crossed the wire, however the calls sharing the stream interleave. Its
+// entries carry the call's request ID to pair them.
+type wireRecorder struct {
+	rec Recorder
+	req *Request
+	// stream records the frames of a stream untimed, as EmbedStream does.
+	stream bool
+
+	mu        sync.Mutex
+	sent      time.Time
+	wrote     bool
+	responded bool
+}
+
+func newWireRecorder(rec Recorder, req *Request, stream bool) *wireRecorder {
+	return &wireRecorder{rec: rec, req: req, stream: stream}
+}
+
+func (w *wireRecorder) record(direction string, message any, sent, received time.Time) {
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	entry := Entry{Direction: direction, Message: raw}
+	if !sent.IsZero() {
+		entry = entry.Timed(sent, received)
+	}
+	if w.req.Meta != nil {
+		entry.RequestID = w.req.Meta.RequestID
+	}
+	w.rec.Record(entry)
+}
+
+// written records the request as its frame is written.
+func (w *wireRecorder) written() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writtenLocked()
+}
+
+func (w *wireRecorder) writtenLocked() {
+	w.sent, w.wrote = time.Now(), true
+	if w.stream {
+		w.record(DirectionRequest, w.req.Wire(), time.Time{}, time.Time{})
+		return
+	}
+	w.record(DirectionRequest, w.req.Wire(), w.sent, time.Time{})
+}
+
+// read records a frame answering the request as it is read.
+func (w *wireRecorder) read(resp *Response) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.responded = true
+	noteAnswer(w.rec, resp, nil)
+	if w.stream {
+		w.record(DirectionResponse, resp, time.Time{}, time.Time{})
+		return
+	}
+	w.record(DirectionResponse, resp, w.sent, time.Now())
+}
+
+// finish records what the transport did not: the request when it never
+// reached the wire, and the outcome of the call, resp or err.
+func (w *wireRecorder) finish(resp *Response, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote {
+		w.writtenLocked()
+	}
+	noteAnswer(w.rec, resp, err)
+	switch {
+	case err != nil:
+		entry := FailureEntry(w.req, err)
+		if !w.stream {
+			entry = entry.Timed(w.sent, time.Now())
+		}
+		if w.req.Meta != nil {
+			entry.RequestID = w.req.Meta.RequestID
+		}
+		w.rec.Record(entry)
+	case resp != nil && !w.responded:
+		w.record(DirectionResponse, resp, w.sent, time.Now())
+	}
+}
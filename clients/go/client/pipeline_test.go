@@ -0,0 +1,270 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncSink is a recordingSink safe for the pipeline's reader goroutine.
+type syncSink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func (s *syncSink) Record(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *syncSink) snapshot() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+// concurrentServer answers the newline-framed requests arriving on the far
+// end of a net.Pipe each on a goroutine of its own, so its answers go out in
+// whatever order handle returns them. A nil response sends nothing.
+func concurrentServer(t *testing.T, handle func(req Request) *Response) net.Conn {
+	t.Helper()
+	near, far := net.Pipe()
+	var wmu sync.Mutex
+	go func() {
+		reader := bufio.NewReader(far)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				return
+			}
+			go func() {
+				resp := handle(req)
+				if resp == nil {
+					return
+				}
+				if resp.ID == 0 {
+					resp.ID = req.ID
+				}
+				resp.JSONRPC = JSONRPCVersion
+				raw, _ := json.Marshal(resp)
+				wmu.Lock()
+				defer wmu.Unlock()
+				_, _ = far.Write(append(raw, '\n'))
+			}()
+		}
+	}()
+	t.Cleanup(func() { far.Close() })
+	return near
+}
+
+// embedInput returns the single input of an embed request.
+func embedInput(req Request) string {
+	var params embedParams
+	_ = json.Unmarshal(req.Params, &params)
+	if len(params.Inputs) != 1 {
+		return ""
+	}
+	return params.Inputs[0]
+}
+
+func TestPipelineOutOfOrder(t *testing.T) {
+	slowArrived, release := make(chan struct{}), make(chan struct{})
+	near := concurrentServer(t, func(req Request) *Response {
+		if embedInput(req) == "slow" {
+			close(slowArrived)
+			<-release
+		}
+		return defaultHandler(&req)
+	})
+	sink := &syncSink{}
+	c := NewWithTransport(ClientConfig{Recorder: sink}, NewConnTransport(near, ConnOptions{MaxPipelineDepth: 4}))
+	defer c.Close(context.Background())
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(context.Background(), "slow")
+		slow <- err
+	}()
+	<-slowArrived
+	// The fast call overtakes the slow one on the same stream.
+	if v, err := c.Embed(context.Background(), "fast!"); err != nil || v[0] != 5 {
+		t.Fatalf("Embed(fast!) = %v, %v", v, err)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatalf("Embed(slow): %v", err)
+	}
+
+	// The transcript holds the wire order, each entry tagged with its call.
+	entries := sink.snapshot()
+	var order []string
+	ids := map[string]string{}
+	for _, e := range entries {
+		var msg struct {
+			Params embedParams `json:"params"`
+			ID     int64       `json:"id"`
+		}
+		_ = json.Unmarshal(e.Message, &msg)
+		if e.Direction == DirectionRequest {
+			ids[e.RequestID] = msg.Params.Inputs[0]
+		}
+		order = append(order, e.Direction+" "+ids[e.RequestID])
+		if e.RequestID == "" {
+			t.Fatalf("untagged entry %s", e.Message)
+		}
+	}
+	want := []string{"request slow", "request fast!", "response fast!", "response slow"}
+	if len(order) != len(want) {
+		t.Fatalf("transcript order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("transcript order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPipelineUnknownIDTearsDown(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	near := concurrentServer(t, func(req Request) *Response {
+		arrived <- struct{}{}
+		if embedInput(req) == "stray" {
+			return &Response{ID: 9999, Result: json.RawMessage(`{}`)}
+		}
+		return nil
+	})
+	c := NewWithTransport(ClientConfig{}, NewConnTransport(near, ConnOptions{MaxPipelineDepth: 4}))
+	defer c.Close(context.Background())
+
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(context.Background(), "unanswered")
+		waiting <- err
+	}()
+	<-arrived
+	if _, err := c.Embed(context.Background(), "stray"); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("stray response: %v, want ErrProtocol", err)
+	}
+	// Every call sharing the stream fails with it.
+	if err := <-waiting; !errors.Is(err, ErrProtocol) {
+		t.Fatalf("waiting call: %v, want ErrProtocol", err)
+	}
+	if _, err := c.Ping(context.Background()); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("ping after teardown: %v, want ErrProtocol", err)
+	}
+}
+
+func TestPipelineDuplicateAndAbandonedIDs(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 4)
+	near := concurrentServer(t, func(req Request) *Response {
+		arrived <- struct{}{}
+		if embedInput(req) == "held" {
+			<-release
+		}
+		return defaultHandler(&req)
+	})
+	tr := NewConnTransport(near, ConnOptions{MaxPipelineDepth: 4})
+	defer tr.Close()
+	held := func(id int64) *Request {
+		req, _ := newRequest(id, MethodEmbed, embedParams{Model: DefaultModel, Inputs: []string{"held"}}, time.Now())
+		return req
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(context.Background(), held(7))
+		first <- err
+	}()
+	<-arrived
+	if _, err := tr.RoundTrip(context.Background(), held(7)); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("duplicate id: %v, want ErrProtocol", err)
+	}
+
+	// A call given up on leaves the stream to the others, and its answer,
+	// when it comes, is discarded.
+	ctx, cancel := context.WithCancel(context.Background())
+	abandoned := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(ctx, held(8))
+		abandoned <- err
+	}()
+	<-arrived
+	cancel()
+	if err := <-abandoned; !errors.Is(err, context.Canceled) {
+		t.Fatalf("abandoned call: %v", err)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	req, _ := newRequest(9, MethodPing, nil, time.Now())
+	if _, err := tr.RoundTrip(context.Background(), req); err != nil {
+		t.Fatalf("call after the abandoned answer: %v", err)
+	}
+}
+
+func TestPipelineDepthBounds(t *testing.T) {
+	var mu sync.Mutex
+	outstanding, peak := 0, 0
+	near := concurrentServer(t, func(req Request) *Response {
+		mu.Lock()
+		outstanding++
+		peak = max(peak, outstanding)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		outstanding--
+		mu.Unlock()
+		return defaultHandler(&req)
+	})
+	c := NewWithTransport(ClientConfig{}, NewConnTransport(near, ConnOptions{MaxPipelineDepth: 3}))
+	defer c.Close(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Ping(context.Background()); err != nil {
+				t.Errorf("Ping: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak < 2 || peak > 3 {
+		t.Fatalf("peak of %d requests outstanding, want 2 to 3", peak)
+	}
+}
+
+func TestPipelineConfig(t *testing.T) {
+	if _, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: "http://localhost", MaxPipelineDepth: 4}); err == nil {
+		t.Fatal("expected http with a pipeline depth to be rejected")
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), MaxPipelineDepth: 4})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	// The inproc server answers in order, which a pipeline accepts too.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Embed(context.Background(), "inproc"); err != nil {
+				t.Errorf("Embed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,367 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrChunkedInput reports an input ChunkByTokens split into several chunks
+// in a call that returns one vector per input, under a WithPreprocessor
+// pipeline without MeanPool. EmbedWithMeta returns the chunks' vectors
+// instead.
+var ErrChunkedInput = errors.New("input splits into several chunks")
+
+// PreprocessStep is a stage of the pipeline WithPreprocessor runs inputs
+// through before embedding them: Normalize, Transform, ChunkByTokens, or
+// MeanPool.
+type PreprocessStep func(*preprocessor) error
+
+// Chunk is a piece of an input ChunkByTokens split, and its vector.
+type Chunk struct {
+	// Start and End are the byte offsets of the piece in the input as the
+	// steps before ChunkByTokens left it.
+	Start, End int
+	// Tokens is the length of the piece by EstimateTokens.
+	Tokens int
+	// Vector is the piece's embedding, nil for a piece of a failed chunk
+	// under WithPartialResults.
+	Vector []float32
+}
+
+// WithPreprocessor runs every input of Embed, EmbedBatch, and the calls
+// built on them through steps, in order, before it is embedded; see
+// ClientConfig.Preprocess. Text steps, Normalize and Transform, come
+// before ChunkByTokens, and MeanPool after it. It overrides WithConfig's
+// Preprocess.
+func WithPreprocessor(steps ...PreprocessStep) Option {
+	return func(o *clientOptions) error {
+		if _, err := newPreprocessor(steps); err != nil {
+			return fmt.Errorf("WithPreprocessor: %w", err)
+		}
+		o.preprocess = steps
+		return nil
+	}
+}
+
+// Normalize puts inputs in Unicode Normalization Form C, collapses each
+// run of whitespace to one space, and trims it from both ends, so inputs
+// differing only in those ways embed, and cache, alike.
+func Normalize() PreprocessStep {
+	return Transform(func(s string) string { return collapseSpace(norm.NFC.String(s)) })
+}
+
+// Transform rewrites each input with fn.
+func Transform(fn func(string) string) PreprocessStep {
+	return func(p *preprocessor) error {
+		if fn == nil {
+			return errors.New("transform must not be nil")
+		}
+		if p.chunks != nil {
+			return errors.New("text steps must come before ChunkByTokens")
+		}
+		p.transforms = append(p.transforms, fn)
+		return nil
+	}
+}
+
+// ChunkOption customizes ChunkByTokens.
+type ChunkOption func(*chunker)
+
+// Overlap repeats the last tokens of each chunk at the start of the next,
+// so text cut at a boundary keeps some context on both sides.
+func Overlap(tokens int) ChunkOption {
+	return func(k *chunker) { k.overlap = tokens }
+}
+
+// ChunkByTokens splits each input longer than maxTokens, by
+// EstimateTokens, into chunks of at most maxTokens, embedded apart. The
+// chunks end at token boundaries, never within a character, a combining
+// sequence, or an emoji sequence, unless one alone outruns maxTokens; the
+// same input always splits the same way. An input within maxTokens,
+// empty ones included, is one chunk of itself.
+func ChunkByTokens(maxTokens int, opts ...ChunkOption) PreprocessStep {
+	return func(p *preprocessor) error {
+		k := &chunker{max: maxTokens}
+		for _, opt := range opts {
+			opt(k)
+		}
+		switch {
+		case k.max <= 0:
+			return fmt.Errorf("chunk size must be positive, got %d", k.max)
+		case k.overlap < 0 || k.overlap >= k.max:
+			return fmt.Errorf("chunk overlap must be at least 0 and under the chunk size %d, got %d", k.max, k.overlap)
+		case p.chunks != nil:
+			return errors.New("ChunkByTokens given twice")
+		}
+		p.chunks = k
+		return nil
+	}
+}
+
+// MeanPool reduces the chunks of each input to one vector, the mean of
+// theirs, so a chunked input still gets a vector of its own.
+func MeanPool() PreprocessStep {
+	return func(p *preprocessor) error {
+		if p.chunks == nil {
+			return errors.New("MeanPool needs ChunkByTokens before it")
+		}
+		p.pool = true
+		return nil
+	}
+}
+
+// preprocessor is the pipeline of ClientConfig.Preprocess.
+type preprocessor struct {
+	transforms []func(string) string
+	chunks     *chunker
+	pool       bool
+}
+
+// newPreprocessor builds the pipeline of steps, nil for none.
+func newPreprocessor(steps []PreprocessStep) (*preprocessor, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	p := &preprocessor{}
+	for _, step := range steps {
+		if step == nil {
+			return nil, errors.New("preprocess step must not be nil")
+		}
+		if err := step(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// apply returns text as the text steps leave it, and the chunks it splits
+// into.
+func (p *preprocessor) apply(text string) (string, []Chunk) {
+	for _, fn := range p.transforms {
+		text = fn(text)
+	}
+	if p.chunks == nil {
+		return text, []Chunk{{Start: 0, End: len(text), Tokens: EstimateTokens(text)}}
+	}
+	return text, p.chunks.split(text)
+}
+
+// embedPreprocessed is EmbedBatch under c.preprocess: it embeds the chunks
+// of texts in one EmbedBatch call and gives each input the vector of its
+// only chunk or, with MeanPool, the mean of its chunks'.
+func (c *Client) embedPreprocessed(ctx context.Context, texts []string, o embedOptions, opts []EmbedOption) ([][]float32, error) {
+	inputs := make([][]Chunk, len(texts))
+	var pieces []string
+	var owners []int
+	for i, text := range texts {
+		text, chunks := c.preprocess.apply(text)
+		if len(chunks) > 1 && !c.preprocess.pool && !o.keepChunks {
+			return nil, fmt.Errorf("embed batch: input %d splits into %d chunks: %w", i, len(chunks), ErrChunkedInput)
+		}
+		for _, ch := range chunks {
+			pieces = append(pieces, text[ch.Start:ch.End])
+			owners = append(owners, i)
+		}
+		inputs[i] = chunks
+	}
+	// The call's own WithEmbedInfo, if any, is overridden: info counts the
+	// chunks, and is reported by input below.
+	var info EmbedInfo
+	vecs, err := c.EmbedBatch(ctx, pieces, append(slices.Clip(opts), withPreprocessed(), WithEmbedInfo(&info))...)
+	chunkErrorOwners(err, owners)
+	if vecs == nil {
+		return nil, err
+	}
+	out := make([][]float32, len(texts))
+	n := 0
+	for i, chunks := range inputs {
+		for j := range chunks {
+			chunks[j].Vector = vecs[n]
+			n++
+		}
+		switch {
+		case len(chunks) == 1:
+			out[i] = chunks[0].Vector
+		case c.preprocess.pool:
+			out[i] = meanPool(chunks)
+		}
+	}
+	if o.info != nil {
+		info.TruncatedInputs = chunkOwners(info.TruncatedInputs, owners)
+		info.ServerTruncatedInputs = chunkOwners(info.ServerTruncatedInputs, owners)
+		info.Chunks = inputs
+		*o.info = info
+	}
+	return out, err
+}
+
+// withPreprocessed marks the EmbedBatch call of embedPreprocessed, whose
+// inputs are preprocessed already.
+func withPreprocessed() EmbedOption {
+	return func(o *embedOptions) { o.preprocessed = true }
+}
+
+// chunkOwners maps the chunk indexes of chunks to their inputs by owners,
+// each input once.
+func chunkOwners(chunks, owners []int) []int {
+	var inputs []int
+	for _, ch := range chunks {
+		if i := owners[ch]; len(inputs) == 0 || inputs[len(inputs)-1] != i {
+			inputs = append(inputs, i)
+		}
+	}
+	return inputs
+}
+
+// chunkErrorOwners rewrites the chunk ranges of the *ChunkErrors of err
+// from pieces to the inputs they belong to by owners.
+func chunkErrorOwners(err error, owners []int) {
+	remap := func(err error) {
+		var chunkErr *ChunkError
+		if errors.As(err, &chunkErr) {
+			chunkErr.Start, chunkErr.End = owners[chunkErr.Start], owners[chunkErr.End-1]+1
+		}
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		remap(err)
+		return
+	}
+	for _, e := range batchErr.Errors {
+		remap(e)
+	}
+}
+
+// meanPool returns the mean of the vectors of chunks, nil when any is
+// missing.
+func meanPool(chunks []Chunk) []float32 {
+	mean := make([]float32, len(chunks[0].Vector))
+	for _, ch := range chunks {
+		if ch.Vector == nil || len(ch.Vector) != len(mean) {
+			return nil
+		}
+		for i, x := range ch.Vector {
+			mean[i] += x
+		}
+	}
+	for i := range mean {
+		mean[i] /= float32(len(chunks))
+	}
+	return mean
+}
+
+// collapseSpace replaces each run of whitespace in s with one space and
+// trims it from both ends.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// chunker splits inputs for ChunkByTokens.
+type chunker struct {
+	max, overlap int
+}
+
+// tokenSpan is the byte range of a token of EstimateTokens: up to four
+// characters of a word, or a punctuation mark, symbol, or character of a
+// script written without spaces. A glued one may not start a chunk.
+type tokenSpan struct {
+	start, end int
+	glued      bool
+}
+
+// split returns the chunks of text.
+func (k *chunker) split(text string) []Chunk {
+	if n := EstimateTokens(text); n <= k.max {
+		return []Chunk{{Start: 0, End: len(text), Tokens: n}}
+	}
+	spans := tokenSpans(text)
+	n := len(spans)
+	cut := func(b int) bool { return b == n || !spans[b].glued }
+	var chunks []Chunk
+	for start := 0; ; {
+		end := min(start+k.max, n)
+		for e := end; e > start; e-- {
+			if cut(e) {
+				end = e
+				break
+			}
+		}
+		piece := text[spans[start].start:spans[end-1].end]
+		chunks = append(chunks, Chunk{Start: spans[start].start, End: spans[end-1].end, Tokens: EstimateTokens(piece)})
+		if end == n {
+			return chunks
+		}
+		next := max(end-k.overlap, start+1)
+		for next < end && !cut(next) {
+			next++
+		}
+		start = next
+	}
+}
+
+// tokenSpans returns the tokens of text as EstimateTokens counts them, so
+// that the tokens of any run of them count as many.
+func tokenSpans(text string) []tokenSpan {
+	var spans []tokenSpan
+	word := 0
+	regional := 0
+	for i, r := range text {
+		size := utf8.RuneLen(r)
+		if size < 0 {
+			size = 1
+		}
+		if unicode.IsSpace(r) {
+			word, regional = 0, 0
+			continue
+		}
+		adjacent := len(spans) > 0 && spans[len(spans)-1].end == i
+		glued := adjacent && (extendsCluster(r) || strings.HasSuffix(text[:i], "\u200d"))
+		if r >= 0x1F1E6 && r <= 0x1F1FF {
+			// The second of a pair of regional indicators, one flag.
+			glued = glued || adjacent && regional%2 == 1
+			regional++
+		} else {
+			regional = 0
+		}
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			word = 0
+			spans = append(spans, tokenSpan{start: i, end: i + size, glued: glued})
+			continue
+		}
+		if word%4 == 0 {
+			spans = append(spans, tokenSpan{start: i, glued: glued})
+		}
+		spans[len(spans)-1].end = i + size
+		word++
+	}
+	return spans
+}
+
+// extendsCluster reports whether r continues the character before it: a
+// combining mark, a zero width joiner, a variation selector, an emoji
+// modifier, or a tag.
+func extendsCluster(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) || r == 0x200D ||
+		r >= 0xFE00 && r <= 0xFE0F || r >= 0x1F3FB && r <= 0x1F3FF || r >= 0xE0020 && r <= 0xE007F
+}
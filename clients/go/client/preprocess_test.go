@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	p, err := newPreprocessor([]PreprocessStep{Normalize()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, chunks := p.apply("  cafe\u0301 \t\n au lait  ")
+	if text != "caf\u00e9 au lait" || len(chunks) != 1 || chunks[0].End != len(text) {
+		t.Fatalf("apply = %+q, %+v", text, chunks)
+	}
+	if text, _ := p.apply(" \n "); text != "" {
+		t.Fatalf("whitespace normalized to %q", text)
+	}
+}
+
+// checkChunks checks that chunks of text are within max tokens, end where
+// the next one may begin, and cover text in order.
+func checkChunks(t *testing.T, text string, chunks []Chunk, max int) {
+	t.Helper()
+	if len(chunks) == 0 {
+		t.Fatalf("%q split into no chunks", text)
+	}
+	for i, ch := range chunks {
+		piece := text[ch.Start:ch.End]
+		if n := EstimateTokens(piece); n > max || n != ch.Tokens {
+			t.Fatalf("chunk %d %q has %d tokens, reports %d, limit %d", i, piece, n, ch.Tokens, max)
+		}
+		if i > 0 && (ch.Start <= chunks[i-1].Start || ch.Start > chunks[i-1].End && strings.TrimSpace(text[chunks[i-1].End:ch.Start]) != "") {
+			t.Fatalf("chunk %d %+v does not follow %+v", i, ch, chunks[i-1])
+		}
+	}
+	if strings.TrimSpace(text[:chunks[0].Start]) != "" || strings.TrimSpace(text[chunks[len(chunks)-1].End:]) != "" {
+		t.Fatalf("chunks %+v do not cover %q", chunks, text)
+	}
+}
+
+func TestChunkByTokens(t *testing.T) {
+	split := func(text string, max, overlap int) []Chunk {
+		t.Helper()
+		p, err := newPreprocessor([]PreprocessStep{ChunkByTokens(max, Overlap(overlap))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, chunks := p.apply(text)
+		checkChunks(t, text, chunks, max)
+		return chunks
+	}
+	pieces := func(text string, chunks []Chunk) []string {
+		var out []string
+		for _, ch := range chunks {
+			out = append(out, text[ch.Start:ch.End])
+		}
+		return out
+	}
+
+	// Empty inputs, and inputs at the limit, are one chunk of themselves.
+	if chunks := split("", 4, 0); len(chunks) != 1 || chunks[0].End != 0 || chunks[0].Tokens != 0 {
+		t.Fatalf("empty input split into %+v", chunks)
+	}
+	atLimit := " one two six ten "
+	if chunks := split(atLimit, 4, 1); len(chunks) != 1 || chunks[0].End != len(atLimit) || chunks[0].Tokens != 4 {
+		t.Fatalf("input at the limit split into %+v", chunks)
+	}
+	text := "one two six ten five"
+	if got := pieces(text, split(text, 4, 0)); !slices.Equal(got, []string{"one two six ten", "five"}) {
+		t.Fatalf("one over the limit split into %q", got)
+	}
+	// Words longer than a token are cut where EstimateTokens counts one.
+	long := "abcdefghij kl"
+	if got := pieces(long, split(long, 2, 0)); !slices.Equal(got, []string{"abcdefgh", "ij kl"}) {
+		t.Fatalf("long word split into %q", got)
+	}
+
+	// Overlapping chunks repeat the tokens asked for, and the same input
+	// always splits the same way.
+	doc := strings.Repeat("alpha beta, gamma; delta! ", 20)
+	first := split(doc, 8, 3)
+	for i := 1; i < len(first); i++ {
+		shared := EstimateTokens(doc[first[i].Start:first[i-1].End])
+		if first[i].Start < first[i-1].End && shared != 3 {
+			t.Fatalf("chunks %d and %d share %d tokens, want 3", i-1, i, shared)
+		}
+	}
+	if again := split(doc, 8, 3); !slices.EqualFunc(first, again, func(a, b Chunk) bool { return a.Start == b.Start && a.End == b.End }) {
+		t.Fatal("the same input split differently")
+	}
+
+	// Emoji sequences, flags, and combining marks stay whole.
+	for _, tc := range []struct {
+		text string
+		max  int
+	}{
+		{strings.Repeat("\U0001f468\u200d\U0001f469\u200d\U0001f467 ", 3), 6},
+		{"\U0001f44d\U0001f3fd\U0001f44d\U0001f3fd\U0001f44d\U0001f3fd", 3},
+		{"\u2764\ufe0f\u2764\ufe0f\u2764\ufe0f", 3},
+		{strings.Repeat("abcde\u0301", 4), 2},
+	} {
+		chunks := split(tc.text, tc.max, 0)
+		if len(chunks) < 2 {
+			t.Errorf("%+q split into %+v", tc.text, chunks)
+		}
+		for _, ch := range chunks {
+			next, _ := utf8DecodeAt(tc.text, ch.End)
+			if extendsCluster(next) || strings.HasSuffix(tc.text[:ch.End], "\u200d") {
+				t.Errorf("%+q cut at %d, within a sequence", tc.text, ch.End)
+			}
+		}
+	}
+	flags := "\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea\U0001f1ef\U0001f1f5"
+	if got := pieces(flags, split(flags, 3, 0)); !slices.Equal(got, []string{"\U0001f1eb\U0001f1f7", "\U0001f1e9\U0001f1ea", "\U0001f1ef\U0001f1f5"}) {
+		t.Fatalf("flags split into %+q", got)
+	}
+	// A sequence alone outrunning the limit is cut all the same.
+	family := "\U0001f468\u200d\U0001f469\u200d\U0001f467\u200d\U0001f466"
+	if chunks := split(family, 2, 1); len(chunks) < 2 {
+		t.Fatalf("sequence over the limit split into %+v", chunks)
+	}
+}
+
+// utf8DecodeAt returns the rune starting at byte i of s, or 0 at its end.
+func utf8DecodeAt(s string, i int) (rune, int) {
+	for _, r := range s[i:] {
+		return r, i
+	}
+	return 0, i
+}
+
+func TestPreprocessorSteps(t *testing.T) {
+	for _, steps := range [][]PreprocessStep{
+		{ChunkByTokens(0)},
+		{ChunkByTokens(4, Overlap(4))},
+		{ChunkByTokens(4, Overlap(-1))},
+		{ChunkByTokens(4), ChunkByTokens(8)},
+		{ChunkByTokens(4), Normalize()},
+		{MeanPool(), ChunkByTokens(4)},
+		{Transform(nil)},
+		{nil},
+	} {
+		if _, err := NewClient("http://127.0.0.1:1", WithPreprocessor(steps...)); err == nil {
+			t.Errorf("WithPreprocessor accepted %d steps", len(steps))
+		}
+	}
+}
+
+func TestEmbedPreprocessed(t *testing.T) {
+	newClient := func(steps ...PreprocessStep) *Client {
+		t.Helper()
+		c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Preprocess: steps})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { c.Close(context.Background()) })
+		return c
+	}
+	ctx := context.Background()
+	doc := "one two six ten five nine"
+
+	// The fake embeds an input as its length.
+	c := newClient(Normalize(), ChunkByTokens(4, Overlap(1)), MeanPool())
+	if v, err := c.Embed(ctx, "  cafe\u0301  au lait "); err != nil || v[0] != float32(len("caf\u00e9 au lait")) {
+		t.Fatalf("Embed = %v, %v", v, err)
+	}
+	var info EmbedInfo
+	vecs, err := c.EmbedBatch(ctx, []string{"short", doc}, WithEmbedInfo(&info))
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	// "one two six ten" and "ten five nine" pool to their mean length.
+	want := float32(len("one two six ten")+len("ten five nine")) / 2
+	if len(vecs) != 2 || vecs[0][0] != 5 || vecs[1][0] != want || vecs[1][1] != 0.5 {
+		t.Fatalf("EmbedBatch vectors %v, want [5 ...] [%v ...]", vecs, want)
+	}
+	if len(info.Chunks) != 2 || len(info.Chunks[1]) != 2 {
+		t.Fatalf("info chunks %+v", info.Chunks)
+	}
+	if second := info.Chunks[1][1]; doc[second.Start:second.End] != "ten five nine" || second.Tokens != 3 || second.Vector[0] != 13 {
+		t.Fatalf("second chunk %+v", second)
+	}
+	if v, err := c.Embed(ctx, doc); err != nil || v[0] != want {
+		t.Fatalf("Embed of a chunked input = %v, %v", v, err)
+	}
+
+	// Without MeanPool a chunked input has no vector of its own.
+	c = newClient(ChunkByTokens(4))
+	if _, err := c.EmbedBatch(ctx, []string{doc}); !errors.Is(err, ErrChunkedInput) {
+		t.Fatalf("EmbedBatch of a chunked input: %v", err)
+	}
+	if _, err := c.Embed(ctx, doc); !errors.Is(err, ErrChunkedInput) {
+		t.Fatalf("Embed of a chunked input: %v", err)
+	}
+	res, err := c.EmbedWithMeta(ctx, []string{doc, "short"})
+	if err != nil {
+		t.Fatalf("EmbedWithMeta: %v", err)
+	}
+	if res.Vectors[0] != nil || res.Vectors[1][0] != 5 || len(res.Chunks[0]) != 2 || res.Chunks[0][1].Vector[0] != float32(len("five nine")) {
+		t.Fatalf("EmbedWithMeta vectors %v, chunks %+v", res.Vectors, res.Chunks)
+	}
+}
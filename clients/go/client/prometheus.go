@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the histogram
+// buckets of a PrometheusSink made by NewPrometheusSink.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusSink is a MetricsSink holding the metrics in memory and serving
+// them in the Prometheus text exposition format, so a scrape target needs
+// no Prometheus client library:
+//
+//	sink := client.NewPrometheusSink()
+//	http.Handle("/metrics", sink)
+//	c, err := client.NewClient(endpoint, client.WithMetrics(sink))
+//
+// One sink may serve several clients; their series differ by transport
+// label only, so give clients sharing a transport a sink each or accept
+// their sums.
+type PrometheusSink struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	families map[string]*promFamily
+}
+
+type promFamily struct {
+	kind   string
+	series map[string]*promSeries
+}
+
+// promSeries is a counter or gauge value, or a histogram.
+type promSeries struct {
+	labels []Label
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusSink returns an empty sink with DefaultLatencyBuckets.
+func NewPrometheusSink() *PrometheusSink {
+	return NewPrometheusSinkBuckets(DefaultLatencyBuckets)
+}
+
+// NewPrometheusSinkBuckets returns an empty sink whose histograms use the
+// given ascending bucket upper bounds.
+func NewPrometheusSinkBuckets(buckets []float64) *PrometheusSink {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &PrometheusSink{buckets: b, families: make(map[string]*promFamily)}
+}
+
+// series returns the series of name with labels, creating it. The caller
+// holds mu.
+func (p *PrometheusSink) series(kind, name string, labels []Label) *promSeries {
+	f, ok := p.families[name]
+	if !ok {
+		f = &promFamily{kind: kind, series: make(map[string]*promSeries)}
+		p.families[name] = f
+	}
+	var key strings.Builder
+	for _, l := range labels {
+		key.WriteString(l.Name)
+		key.WriteByte(0)
+		key.WriteString(l.Value)
+		key.WriteByte(0)
+	}
+	s, ok := f.series[key.String()]
+	if !ok {
+		s = &promSeries{labels: append([]Label(nil), labels...)}
+		if kind == "histogram" {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+		f.series[key.String()] = s
+	}
+	return s
+}
+
+// AddCounter implements MetricsSink.
+func (p *PrometheusSink) AddCounter(name string, labels []Label, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series("counter", name, labels).value += delta
+}
+
+// AddGauge implements MetricsSink.
+func (p *PrometheusSink) AddGauge(name string, labels []Label, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series("gauge", name, labels).value += delta
+}
+
+// ObserveHistogram implements MetricsSink.
+func (p *PrometheusSink) ObserveHistogram(name string, labels []Label, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series("histogram", name, labels)
+	for i, bound := range p.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (p *PrometheusSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format,
+// families and series sorted.
+func (p *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	p.mu.Lock()
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := p.families[name]
+		if help, ok := metricHelp[name]; ok {
+			bw.WriteString("# HELP " + name + " " + help + "\n")
+		}
+		bw.WriteString("# TYPE " + name + " " + f.kind + "\n")
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != "histogram" {
+				bw.WriteString(name + promLabels(s.labels) + " " + promValue(s.value) + "\n")
+				continue
+			}
+			for i, bound := range p.buckets {
+				le := append(s.labels[:len(s.labels):len(s.labels)], Label{"le", promValue(bound)})
+				bw.WriteString(name + "_bucket" + promLabels(le) + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+			}
+			inf := append(s.labels[:len(s.labels):len(s.labels)], Label{"le", "+Inf"})
+			bw.WriteString(name + "_bucket" + promLabels(inf) + " " + strconv.FormatUint(s.count, 10) + "\n")
+			bw.WriteString(name + "_sum" + promLabels(s.labels) + " " + promValue(s.sum) + "\n")
+			bw.WriteString(name + "_count" + promLabels(s.labels) + " " + strconv.FormatUint(s.count, 10) + "\n")
+		}
+	}
+	p.mu.Unlock()
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func promLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name + `="`)
+		b.WriteString(promEscaper.Replace(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SupportedProtocolVersions lists the protocol versions this client speaks,
+// most preferred first. Version 2 added streamed embeddings.
+var SupportedProtocolVersions = []string{"2", "1"}
+
+// legacyProtocolVersion is assumed for servers that predate negotiation and
+// answer the handshake without a protocol_version.
+const legacyProtocolVersion = "1"
+
+// CodeIncompatibleProtocol is the JSON-RPC error a server returns when it
+// shares no protocol version with the client. Its data may list the
+// server's versions under "supported_versions".
+const CodeIncompatibleProtocol = -32005
+
+// ErrIncompatibleProtocol matches every *IncompatibleProtocolError.
+var ErrIncompatibleProtocol = errors.New("incompatible protocol version")
+
+// IncompatibleProtocolError reports a failed protocol negotiation.
+type IncompatibleProtocolError struct {
+	// Client lists the versions the client offered.
+	Client []string
+	// Server lists the versions the server supports, or the single version
+	// it picked when that is not one the client offered. It is empty when
+	// the server did not say.
+	Server []string
+}
+
+func (e *IncompatibleProtocolError) Error() string {
+	server := strings.Join(e.Server, ", ")
+	if server == "" {
+		server = "unknown"
+	}
+	return fmt.Sprintf("%v: client supports [%s], server supports [%s]", ErrIncompatibleProtocol, strings.Join(e.Client, ", "), server)
+}
+
+func (e *IncompatibleProtocolError) Is(target error) bool { return target == ErrIncompatibleProtocol }
+
+// offeredProtocolVersions is what the handshake advertises.
+func (cfg ClientConfig) offeredProtocolVersions() []string {
+	if cfg.ForceProtocolVersion != "" {
+		return []string{cfg.ForceProtocolVersion}
+	}
+	return SupportedProtocolVersions
+}
+
+// negotiateProtocol checks the server's pick against the offered versions.
+func (cfg ClientConfig) negotiateProtocol(picked string) (string, error) {
+	if cfg.ForceProtocolVersion != "" {
+		return cfg.ForceProtocolVersion, nil
+	}
+	if picked == "" {
+		picked = legacyProtocolVersion
+	}
+	for _, v := range SupportedProtocolVersions {
+		if v == picked {
+			return picked, nil
+		}
+	}
+	return "", &IncompatibleProtocolError{Client: SupportedProtocolVersions, Server: []string{picked}}
+}
+
+// incompatibleFromRPC converts a CodeIncompatibleProtocol error response.
+func incompatibleFromRPC(rpc *RPCError, offered []string) *IncompatibleProtocolError {
+	var data struct {
+		Supported []string `json:"supported_versions"`
+	}
+	if len(rpc.Data) > 0 {
+		_ = json.Unmarshal(rpc.Data, &data)
+	}
+	return &IncompatibleProtocolError{Client: offered, Server: data.Supported}
+}
+
+// ProtocolVersion returns the protocol version negotiated by Initialize, or
+// "" before the handshake has completed.
+func (c *Client) ProtocolVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocolVersion
+}
+
+// protocolAtLeast reports whether the negotiated protocol is major or newer.
+// Before a handshake every feature is assumed available and servers that
+// lack one answer "method not found".
+func (c *Client) protocolAtLeast(major int) bool {
+	v := c.ProtocolVersion()
+	if v == "" {
+		return true
+	}
+	n, err := strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+	return err != nil || n >= major
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// initHandler answers the handshake with answer and serves everything else
+// with defaultHandler, counting mcp.embed.stream requests.
+func initHandler(streams *atomic.Int32, answer func(req *Request) *Response) Handler {
+	return inprocHandler(func(req *Request) *Response {
+		switch req.Method {
+		case MethodInitialize:
+			return answer(req)
+		case MethodEmbedStream:
+			streams.Add(1)
+		}
+		return defaultHandler(req)
+	})
+}
+
+func initResult(req *Request, version string) *Response {
+	raw, _ := json.Marshal(InitializeResult{Session: Session{ID: fakeSessionID}, ProtocolVersion: version})
+	return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	var offered []string
+	var streams atomic.Int32
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: initHandler(&streams, func(req *Request) *Response {
+		var params struct {
+			ProtocolVersions []string `json:"protocol_versions"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		offered = params.ProtocolVersions
+		return defaultHandler(req)
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if c.ProtocolVersion() != "" {
+		t.Fatalf("version known before the handshake: %q", c.ProtocolVersion())
+	}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if !reflect.DeepEqual(offered, SupportedProtocolVersions) || c.ProtocolVersion() != "2" {
+		t.Fatalf("offered %v and negotiated %q", offered, c.ProtocolVersion())
+	}
+	ch, err := c.EmbedStream(context.Background(), []string{"a"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	if collect(t, ch); streams.Load() != 1 {
+		t.Fatal("protocol version 2 should stream embeddings")
+	}
+}
+
+func TestProtocolLegacyServerDisablesStreaming(t *testing.T) {
+	var streams atomic.Int32
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: initHandler(&streams, func(req *Request) *Response {
+		return initResult(req, "")
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if c.ProtocolVersion() != "1" {
+		t.Fatalf("expected the legacy version, got %q", c.ProtocolVersion())
+	}
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	if results := collect(t, ch); len(results) != 2 || results[1].Vector[0] != 2 || streams.Load() != 0 {
+		t.Fatalf("expected an unstreamed embed, got %+v and %d stream requests", results, streams.Load())
+	}
+}
+
+func TestProtocolIncompatible(t *testing.T) {
+	cases := map[string]struct {
+		answer func(req *Request) *Response
+		server []string
+	}{
+		"unknown pick": {func(req *Request) *Response { return initResult(req, "3") }, []string{"3"}},
+		"rpc error": {func(req *Request) *Response {
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{
+				Code: CodeIncompatibleProtocol, Message: "no common version", Data: json.RawMessage(`{"supported_versions":["3","4"]}`),
+			}}
+		}, []string{"3", "4"}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var streams atomic.Int32
+			c, err := New(ClientConfig{Transport: TransportInProc, Handler: initHandler(&streams, tc.answer)})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			_, err = c.Initialize(context.Background())
+			var incompatible *IncompatibleProtocolError
+			if !errors.Is(err, ErrIncompatibleProtocol) || !errors.As(err, &incompatible) {
+				t.Fatalf("expected ErrIncompatibleProtocol, got %v", err)
+			}
+			if !reflect.DeepEqual(incompatible.Client, SupportedProtocolVersions) || !reflect.DeepEqual(incompatible.Server, tc.server) {
+				t.Fatalf("unexpected version lists %+v", incompatible)
+			}
+			if !strings.Contains(err.Error(), "[2, 1]") || c.ProtocolVersion() != "" {
+				t.Fatalf("unexpected error text or state: %v, %q", err, c.ProtocolVersion())
+			}
+		})
+	}
+}
+
+func TestForceProtocolVersion(t *testing.T) {
+	var offered []string
+	var streams atomic.Int32
+	c, err := New(ClientConfig{Transport: TransportInProc, ForceProtocolVersion: "1", Handler: initHandler(&streams, func(req *Request) *Response {
+		var params struct {
+			ProtocolVersions []string `json:"protocol_versions"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		offered = params.ProtocolVersions
+		return initResult(req, "7")
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if !reflect.DeepEqual(offered, []string{"1"}) || c.ProtocolVersion() != "1" {
+		t.Fatalf("offered %v and negotiated %q", offered, c.ProtocolVersion())
+	}
+}
+
+func TestTranscriptRecordsProtocolVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inproc.json")
+	err := Run(context.Background(), Options{
+		Config:           ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+		RecordTranscript: path,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil || doc.ProtocolVersion != "2" {
+		t.Fatalf("transcript lacks the protocol version: %v\n%s", err, content)
+	}
+}
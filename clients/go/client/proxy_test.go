@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// pipeConns copies between a and b until either side closes.
+func pipeConns(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); _, _ = io.Copy(a, b); a.Close() }()
+	go func() { defer wg.Done(); _, _ = io.Copy(b, a); b.Close() }()
+	wg.Wait()
+}
+
+// newConnectProxy starts an HTTP proxy that only serves CONNECT tunnels and
+// requires the given basic credentials.
+func newConnectProxy(t *testing.T, user, pass string) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var tunnels atomic.Int64
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+			http.Error(w, "proxy auth required", http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		tunnels.Add(1)
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		pipeConns(conn, upstream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &tunnels
+}
+
+// newSOCKS5Stub starts a minimal RFC 1928 proxy supporting CONNECT with
+// RFC 1929 username/password authentication.
+func newSOCKS5Stub(t *testing.T, user, pass string) (string, *atomic.Int64) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var tunnels atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				upstream, err := socks5Handshake(conn, user, pass)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				tunnels.Add(1)
+				pipeConns(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), &tunnels
+}
+
+func socks5Handshake(conn net.Conn, user, pass string) (net.Conn, error) {
+	buf := make([]byte, 262)
+	// Greeting: VER NMETHODS METHODS...
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 5 {
+		return nil, errors.New("bad greeting")
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 2}); err != nil {
+		return nil, err
+	}
+	// Username/password sub-negotiation: VER ULEN UNAME PLEN PASSWD.
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	gotUser := make([]byte, buf[1])
+	if _, err := io.ReadFull(conn, gotUser); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+		return nil, err
+	}
+	gotPass := make([]byte, buf[0])
+	if _, err := io.ReadFull(conn, gotPass); err != nil {
+		return nil, err
+	}
+	if string(gotUser) != user || string(gotPass) != pass {
+		_, _ = conn.Write([]byte{1, 1})
+		return nil, errors.New("bad credentials")
+	}
+	if _, err := conn.Write([]byte{1, 0}); err != nil {
+		return nil, err
+	}
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT.
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[1] != 1 {
+		return nil, errors.New("unsupported command")
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return nil, err
+		}
+		host = net.IP(buf[:4]).String()
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return nil, err
+		}
+		name := make([]byte, buf[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		return nil, fmt.Errorf("unsupported address type %d", buf[3])
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+func TestTLSThroughConnectProxy(t *testing.T) {
+	ca := newTestCA(t, "server-ca")
+	target, _ := newTLSServer(t, ca)
+	proxy, tunnels := newConnectProxy(t, "alice", "s3cret")
+
+	cases := map[string]struct {
+		proxyURL string
+		wantErr  bool
+	}{
+		"with credentials":    {"http://alice:s3cret@" + proxy.Listener.Addr().String(), false},
+		"without credentials": {"http://" + proxy.Listener.Addr().String(), true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			before := tunnels.Load()
+			c, err := New(ClientConfig{
+				Transport: TransportTLS,
+				Endpoint:  target.URL,
+				TLSConfig: &tls.Config{RootCAs: ca.pool()},
+				ProxyURL:  tc.proxyURL,
+			})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			_, err = c.Initialize(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected the proxy to refuse the tunnel")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Initialize: %v", err)
+			}
+			if tunnels.Load() == before {
+				t.Fatal("request did not go through the proxy")
+			}
+		})
+	}
+}
+
+func TestHTTPThroughSOCKS5Proxy(t *testing.T) {
+	target := httptest.NewServer(httpHandler(defaultHandler))
+	defer target.Close()
+	addr, tunnels := newSOCKS5Stub(t, "bob", "hunter2")
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: target.URL, ProxyURL: "socks5://bob:hunter2@" + addr})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if tunnels.Load() == 0 {
+		t.Fatal("request did not go through the SOCKS5 proxy")
+	}
+}
+
+func TestProxyURLValidation(t *testing.T) {
+	for _, raw := range []string{"ftp://proxy.example:21", "http://", "://bad"} {
+		if _, err := New(ClientConfig{Transport: TransportHTTP, ProxyURL: raw}); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// WithDType selects the encoding EmbedQuantized and EmbedBatchQuantized
+// return; the default is vectors.Int8. Embed and EmbedBatch ignore it.
+func WithDType(dtype vectors.DType) EmbedOption {
+	return func(o *embedOptions) { o.dtype = dtype }
+}
+
+// EmbedQuantized is Embed with the vector converted to a compact encoding
+// after it is received; see WithDType. The cache keeps full-precision
+// vectors.
+func (c *Client) EmbedQuantized(ctx context.Context, text string, opts ...EmbedOption) (vectors.Quantized, error) {
+	out, err := c.EmbedBatchQuantized(ctx, []string{text}, opts...)
+	if err != nil {
+		return vectors.Quantized{}, err
+	}
+	return out[0], nil
+}
+
+// EmbedBatchQuantized is EmbedBatch with every vector converted to a
+// compact encoding; see WithDType. With WithPartialResults the inputs of
+// failed chunks have zero Quantized values.
+func (c *Client) EmbedBatchQuantized(ctx context.Context, texts []string, opts ...EmbedOption) ([]vectors.Quantized, error) {
+	o := embedOptions{dtype: vectors.Int8}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	floats, batchErr := c.EmbedBatch(ctx, texts, opts...)
+	if floats == nil {
+		return nil, batchErr
+	}
+	out := make([]vectors.Quantized, len(floats))
+	for i, v := range floats {
+		if v == nil {
+			continue
+		}
+		q, err := vectors.Quantize(v, o.dtype)
+		if err != nil {
+			return nil, fmt.Errorf("%s: input %d: %w", MethodEmbed, i, err)
+		}
+		out[i] = q
+	}
+	return out, batchErr
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+func TestEmbedQuantized(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	q, err := c.EmbedQuantized(context.Background(), "abcd")
+	if err != nil {
+		t.Fatalf("EmbedQuantized: %v", err)
+	}
+	if q.DType != vectors.Int8 || len(q.I8) != 3 {
+		t.Fatalf("expected an int8 vector by default, got %+v", q)
+	}
+	for i, want := range []float32{4, 0.5, -0.5} {
+		if got := q.Dequantize()[i]; math.Abs(float64(got-want)) > float64(q.Scale)/2+1e-6 {
+			t.Fatalf("component %d: %v, want %v", i, got, want)
+		}
+	}
+
+	batch, err := c.EmbedBatchQuantized(context.Background(), []string{"a", "bb"}, WithDType(vectors.Float16))
+	if err != nil {
+		t.Fatalf("EmbedBatchQuantized: %v", err)
+	}
+	if len(batch) != 2 || batch[1].DType != vectors.Float16 || batch[1].Dequantize()[0] != 2 {
+		t.Fatalf("unexpected float16 batch %+v", batch)
+	}
+	if _, err := c.EmbedQuantized(context.Background(), "a", WithDType(0)); err == nil {
+		t.Fatal("expected an unsupported dtype to fail")
+	}
+}
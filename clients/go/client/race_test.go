@@ -0,0 +1,7 @@
+//go:build race
+
+package client
+
+// raceEnabled reports a test binary built with -race, whose runtime
+// allocates on its own.
+const raceEnabled = true
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// DefaultRankK is how many candidates Rank returns without WithTopK.
+const DefaultRankK = 10
+
+// RankOption configures a Rank call.
+type RankOption func(*rankOptions)
+
+type rankOptions struct {
+	k         int
+	minScore  float32
+	threshold bool
+	all       bool
+	embed     []EmbedOption
+}
+
+// WithTopK returns the k best candidates instead of DefaultRankK.
+func WithTopK(k int) RankOption {
+	return func(o *rankOptions) { o.k = k }
+}
+
+// WithMinScore returns only the candidates scoring at least score, which
+// may leave fewer than k.
+func WithMinScore(score float32) RankOption {
+	return func(o *rankOptions) { o.minScore, o.threshold = score, true }
+}
+
+// WithAllScores returns every candidate, best first, whatever WithTopK and
+// WithMinScore say.
+func WithAllScores() RankOption {
+	return func(o *rankOptions) { o.all = true }
+}
+
+// WithRankEmbedOptions passes opts, such as WithModel, WithBatchSize, or
+// WithConcurrency, to the EmbedBatch call embedding the query and the
+// candidates.
+func WithRankEmbedOptions(opts ...EmbedOption) RankOption {
+	return func(o *rankOptions) { o.embed = append(o.embed, opts...) }
+}
+
+// RankedCandidate is one result of Rank.
+type RankedCandidate struct {
+	// Index is the position of the candidate in the candidates given.
+	Index int
+	Text  string
+	// Score is the cosine similarity of its embedding to the query's.
+	Score float32
+}
+
+// Rank orders candidates by the cosine similarity of their embeddings to
+// that of query and returns the best, opts deciding how many; see
+// WithTopK, WithMinScore, and WithAllScores. The query and the candidates
+// are embedded by one EmbedBatch call, so they are batched, share the
+// client's cache and concurrency limits, and those the cache holds cost no
+// request. Ties keep the candidates' order. Candidates embedding to a zero
+// vector are left out; a zero query vector fails the call.
+func (c *Client) Rank(ctx context.Context, query string, candidates []string, opts ...RankOption) ([]RankedCandidate, error) {
+	o := rankOptions{k: DefaultRankK}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := c.checkRank(&o); err != nil {
+		return nil, fmt.Errorf("rank: %w", err)
+	}
+	if len(candidates) == 0 {
+		return []RankedCandidate{}, nil
+	}
+	embedded, err := c.EmbedBatch(ctx, append([]string{query}, candidates...), o.embed...)
+	if err != nil {
+		return nil, fmt.Errorf("rank: %w", err)
+	}
+	k := o.k
+	if o.all {
+		k = len(candidates)
+	}
+	matches, err := vectors.TopK(embedded[0], embedded[1:], k)
+	if errors.Is(err, vectors.ErrZeroVector) {
+		return nil, fmt.Errorf("rank: the query embeds to a %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rank: %w", err)
+	}
+	ranked := make([]RankedCandidate, 0, len(matches))
+	for _, m := range matches {
+		if o.threshold && !o.all && m.Score < o.minScore {
+			break
+		}
+		ranked = append(ranked, RankedCandidate{Index: m.Index, Text: candidates[m.Index], Score: m.Score})
+	}
+	return ranked, nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fakeembed"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// rankHandler embeds with fakeembed, in 16 dimensions, so rankings are the
+// same on every machine, counting the embed requests in requests.
+func rankHandler(requests *atomic.Int32) fakeHandler {
+	return func(req *Request) *Response {
+		if req.Method != MethodEmbed {
+			return defaultHandler(req)
+		}
+		requests.Add(1)
+		var params embedParams
+		_ = json.Unmarshal(req.Params, &params)
+		entries := make([]embeddingEntry, len(params.Inputs))
+		for i, input := range params.Inputs {
+			entries[i] = embeddingEntry{Index: i, Vector: fakeembed.Vector(params.Model, input, 16)}
+			if input == "void" {
+				entries[i].Vector = make([]float32, 16)
+			}
+		}
+		raw, _ := json.Marshal(base64EmbedResult(params.Model, entries))
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}
+}
+
+var rankCandidates = []string{"apples", "bananas", "cherries", "dates", "the query", "elderberries", "figs"}
+
+func TestRank(t *testing.T) {
+	var requests atomic.Int32
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(rankHandler(&requests)), Cache: CacheConfig{MaxEntries: 100}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+
+	all, err := c.Rank(ctx, "the query", rankCandidates, WithAllScores(), WithRankEmbedOptions(WithBatchSize(3), WithConcurrency(2)))
+	if err != nil {
+		t.Fatalf("Rank: %v", err)
+	}
+	if len(all) != len(rankCandidates) || all[0].Text != "the query" || all[0].Index != 4 || all[0].Score < 0.9999 {
+		t.Fatalf("Rank: %+v, want the query itself first", all)
+	}
+	// The query and the seven candidates went out three at a time.
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("%d embed requests, want 3", n)
+	}
+	var order []int
+	for i, r := range all {
+		if i > 0 && r.Score > all[i-1].Score {
+			t.Fatalf("scores out of order: %+v", all)
+		}
+		want, _ := vectors.Cosine(fakeembed.Vector(DefaultModel, "the query", 16), fakeembed.Vector(DefaultModel, r.Text, 16))
+		if math.Abs(float64(r.Score-want)) > 1e-6 || rankCandidates[r.Index] != r.Text {
+			t.Fatalf("candidate %+v, want score %v", r, want)
+		}
+		order = append(order, r.Index)
+	}
+	// The fake embeddings never change, and so neither does the ranking.
+	if want := []int{4, 6, 1, 0, 3, 2, 5}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("ranked %v, want %v", order, want)
+	}
+
+	// Everything is cached now.
+	top, err := c.Rank(ctx, "the query", rankCandidates, WithTopK(3))
+	if err != nil || requests.Load() != 3 {
+		t.Fatalf("cached Rank: %v after %d requests", err, requests.Load())
+	}
+	if !reflect.DeepEqual(top, all[:3]) {
+		t.Fatalf("top 3 %+v, want %+v", top, all[:3])
+	}
+	above, err := c.Rank(ctx, "the query", rankCandidates, WithTopK(5), WithMinScore(all[2].Score))
+	if err != nil || !reflect.DeepEqual(above, all[:3]) {
+		t.Fatalf("Rank over %v: %+v, %v", all[2].Score, above, err)
+	}
+}
+
+func TestRankEdges(t *testing.T) {
+	var requests atomic.Int32
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(rankHandler(&requests))})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+
+	if got, err := c.Rank(ctx, "q", nil); err != nil || len(got) != 0 || requests.Load() != 0 {
+		t.Fatalf("Rank of no candidates: %v, %v after %d requests", got, err, requests.Load())
+	}
+	if _, err := c.Rank(ctx, "q", rankCandidates, WithTopK(0)); err == nil {
+		t.Fatal("Rank with k = 0 succeeded")
+	}
+	got, err := c.Rank(ctx, "q", []string{"a", "void", "b"}, WithAllScores())
+	if err != nil || len(got) != 2 || got[0].Text == "void" || got[1].Text == "void" {
+		t.Fatalf("Rank with a zero candidate: %+v, %v", got, err)
+	}
+	if _, err := c.Rank(ctx, "void", []string{"a"}); !errors.Is(err, vectors.ErrZeroVector) {
+		t.Fatalf("Rank of a zero query: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit paces requests with a token bucket: tokens refill at RPS per
+// second up to Burst, and every request takes one, waiting when none is
+// left.
+type RateLimit struct {
+	// RPS is the sustained request rate. Zero disables the limiter.
+	RPS float64
+	// Burst is how many requests may be sent back to back after the client
+	// has been idle. Zero selects 1.
+	Burst int
+}
+
+func (r RateLimit) validate() error {
+	if r.RPS < 0 || r.Burst < 0 || math.IsNaN(r.RPS) || math.IsInf(r.RPS, 0) {
+		return errors.New("rate limit must be a finite, non-negative rate and burst")
+	}
+	return nil
+}
+
+// RateLimitStats reports how much the rate limiter has delayed requests.
+type RateLimitStats struct {
+	// Requests counts the requests that reached the limiter and Delayed the
+	// ones among them that had to wait.
+	Requests int64
+	Delayed  int64
+	// TotalWait sums the waits imposed on delayed requests.
+	TotalWait time.Duration
+	// CurrentWait is how long a request made now would wait.
+	CurrentWait time.Duration
+}
+
+// rateLimiter is a token bucket shared by every goroutine using a Client.
+// Waiting requests reserve their token up front, so they are released in
+// arrival order at the configured rate.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	stats  RateLimitStats
+}
+
+func newRateLimiter(r RateLimit) *rateLimiter {
+	burst := r.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   r.RPS,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+		after:  time.After,
+	}
+}
+
+// advance refills the bucket up to now. The caller holds mu.
+func (l *rateLimiter) advance(now time.Time) {
+	if l.last.IsZero() {
+		l.last = now
+	}
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+}
+
+// delay is how long until the bucket holds a whole token. The caller holds
+// mu.
+func (l *rateLimiter) delay() time.Duration {
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - l.tokens) / l.rate * float64(time.Second)))
+}
+
+// Wait takes a token, blocking until one is available or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.advance(l.now())
+	wait := l.delay()
+	l.tokens--
+	l.stats.Requests++
+	if wait > 0 {
+		l.stats.Delayed++
+		l.stats.TotalWait += wait
+	}
+	l.mu.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-l.after(wait):
+		return nil
+	case <-ctx.Done():
+		// Hand the reservation back so later requests do not wait for it.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the limiter's counters.
+func (l *rateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.now())
+	s := l.stats
+	s.CurrentWait = l.delay()
+	return s
+}
+
+// RateLimitStats reports how much ClientConfig.RateLimit has delayed calls.
+// It is the zero value when no limit is configured.
+func (c *Client) RateLimitStats() RateLimitStats {
+	if c.limiter == nil {
+		return RateLimitStats{}
+	}
+	return c.limiter.Stats()
+}
+
+// throttle waits for the rate limiter, if one is configured.
+func (c *Client) throttle(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.Wait(ctx)
+}
+
+// interceptRateLimit is the Interceptor applying ClientConfig.RateLimit.
+func (c *Client) interceptRateLimit(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	if err := c.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
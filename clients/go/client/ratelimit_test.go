@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock drives a rateLimiter without sleeping. Each requested wait is
+// recorded and, when advance is set, moves the clock forward by that much.
+// The timers of afterFunc fire as tick passes them.
+type fakeClock struct {
+	mu      sync.Mutex
+	t       time.Time
+	advance bool
+	waits   []time.Duration
+	block   bool
+	timers  []*fakeTimer
+}
+
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) after(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waits = append(f.waits, d)
+	ch := make(chan time.Time, 1)
+	if f.block {
+		return ch
+	}
+	if f.advance {
+		f.t = f.t.Add(d)
+	}
+	ch <- f.t
+	return ch
+}
+
+func fakeLimiter(r RateLimit, clock *fakeClock) *rateLimiter {
+	l := newRateLimiter(r)
+	l.now, l.after = clock.now, clock.after
+	return l
+}
+
+func TestRateLimiterPacing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start, advance: true}
+	l := fakeLimiter(RateLimit{RPS: 2, Burst: 3}, clock)
+	for i := 0; i < 9; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	// The burst goes out at once, then one request every 500ms.
+	if elapsed := clock.now().Sub(start); elapsed != 3*time.Second {
+		t.Fatalf("9 requests at 2 rps with burst 3 took %s, want 3s", elapsed)
+	}
+	for _, w := range clock.waits {
+		if w != 500*time.Millisecond {
+			t.Fatalf("unexpected wait %s in %v", w, clock.waits)
+		}
+	}
+	s := l.Stats()
+	if s.Requests != 9 || s.Delayed != 6 || s.TotalWait != 3*time.Second || s.CurrentWait != 500*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// Idle time refills the bucket up to the burst.
+	clock.t = clock.t.Add(time.Hour)
+	if s := l.Stats(); s.CurrentWait != 0 {
+		t.Fatalf("expected a refilled bucket, got %+v", s)
+	}
+}
+
+func TestRateLimiterSharedAcrossGoroutines(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)}),
+		WithRateLimit(10, 1),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	c.limiter.now, c.limiter.after = clock.now, clock.after
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil {
+				t.Errorf("Call: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// With the clock frozen every caller queues behind the previous one.
+	sort.Slice(clock.waits, func(i, j int) bool { return clock.waits[i] < clock.waits[j] })
+	if len(clock.waits) != 19 {
+		t.Fatalf("expected 19 delayed calls, got %d", len(clock.waits))
+	}
+	for i, w := range clock.waits {
+		if want := time.Duration(i+1) * 100 * time.Millisecond; w != want {
+			t.Fatalf("wait %d is %s, want %s", i, w, want)
+		}
+	}
+	if s := c.RateLimitStats(); s.Requests != 20 || s.Delayed != 19 || s.CurrentWait != 2*time.Second {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), block: true}
+	l := fakeLimiter(RateLimit{RPS: 1}, clock)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx) }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	// The abandoned reservation is returned to the bucket.
+	if s := l.Stats(); s.CurrentWait != time.Second {
+		t.Fatalf("expected a 1s wait after cancel, got %+v", s)
+	}
+}
+
+func TestRateLimitValidation(t *testing.T) {
+	if _, err := NewClient("", WithRateLimit(-1, 0)); err == nil {
+		t.Fatal("expected a negative rate to be rejected")
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if c.limiter != nil || c.RateLimitStats() != (RateLimitStats{}) {
+		t.Fatal("expected no limiter by default")
+	}
+}
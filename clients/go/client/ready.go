@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Readiness defaults applied when ReadyOptions leaves a setting unset.
+const (
+	DefaultReadyProbeInterval    = time.Second
+	DefaultReadyMaxProbeInterval = 30 * time.Second
+)
+
+// ErrNotReady reports a server that did not pass a readiness probe before
+// Client.WaitReady gave up; see NotReadyError.
+var ErrNotReady = errors.New("server not ready")
+
+// ReadyOptions configures Client.WaitReady. The zero value waits, until
+// ctx ends, for a server that answers the handshake and a healthy ping.
+type ReadyOptions struct {
+	// MinModels is how many models the server must list; RequireModel
+	// names one it must list. Either has each probe fetch the model list,
+	// which is cached as Client.RefreshCapabilities caches it.
+	MinModels    int
+	RequireModel string
+	// ProbeInterval is the wait after the first failed probe, doubling
+	// after each one after it up to MaxProbeInterval. Zero selects
+	// DefaultReadyProbeInterval and DefaultReadyMaxProbeInterval.
+	ProbeInterval    time.Duration
+	MaxProbeInterval time.Duration
+	// Timeout bounds the wait, as a deadline on ctx would; zero leaves it
+	// to ctx.
+	Timeout time.Duration
+	// OnProbe, when set, is called after each probe, for logging.
+	OnProbe func(ReadyProbe)
+}
+
+func (o ReadyOptions) withDefaults() ReadyOptions {
+	if o.ProbeInterval == 0 {
+		o.ProbeInterval = DefaultReadyProbeInterval
+	}
+	if o.MaxProbeInterval == 0 {
+		o.MaxProbeInterval = max(DefaultReadyMaxProbeInterval, o.ProbeInterval)
+	}
+	return o
+}
+
+func (o ReadyOptions) validate() error {
+	if o.MinModels < 0 || o.ProbeInterval < 0 || o.MaxProbeInterval < 0 || o.Timeout < 0 {
+		return errors.New("readiness settings must not be negative")
+	}
+	if o.MaxProbeInterval > 0 && o.MaxProbeInterval < o.ProbeInterval {
+		return errors.New("max probe interval must not be below the probe interval")
+	}
+	return nil
+}
+
+// ReadyProbe is the outcome of one probe of Client.WaitReady.
+type ReadyProbe struct {
+	// Attempt numbers the probe from 1.
+	Attempt int
+	// Err is why the probe failed, nil for the one that passed.
+	Err error
+	// Duration is how long the probe took, and Next the wait before the
+	// next one, zero after the last.
+	Duration, Next time.Duration
+}
+
+// ReadyReport describes the probe Client.WaitReady passed.
+type ReadyReport struct {
+	// Attempts counts the probes, the one that passed included.
+	Attempts int `json:"attempts"`
+	// Duration is how long WaitReady took.
+	Duration time.Duration `json:"-"`
+	Ping     PingResult    `json:"ping"`
+	// Models counts the models listed, with MinModels or RequireModel.
+	Models int `json:"models,omitempty"`
+}
+
+// MarshalJSON reports Duration in milliseconds as duration_ms.
+func (r ReadyReport) MarshalJSON() ([]byte, error) {
+	type plain ReadyReport
+	return json.Marshal(struct {
+		plain
+		DurationMS float64 `json:"duration_ms"`
+	}{plain(r), float64(r.Duration) / float64(time.Millisecond)})
+}
+
+// NotReadyError reports a Client.WaitReady that gave up. It matches
+// ErrNotReady and unwraps to Err, so errors.Is finds the class of the last
+// failure, such as ErrUnhealthy or a refused connection.
+type NotReadyError struct {
+	// Attempts counts the probes made.
+	Attempts int
+	// Elapsed is how long WaitReady waited.
+	Elapsed time.Duration
+	// Err is the failure of the last probe to finish before the wait
+	// ended, or the end of the wait when none did.
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("%v after %d probes in %s: %v", ErrNotReady, e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+func (e *NotReadyError) Unwrap() error { return e.Err }
+
+func (e *NotReadyError) Is(target error) bool { return target == ErrNotReady }
+
+// WaitReady probes the server until it is ready to serve, for a service
+// gating its startup on it: each probe warms the client up as Warmup does
+// until that succeeds once, pings the server, which must report itself
+// healthy, and with MinModels or RequireModel lists its models. Failed
+// probes are repeated with exponential backoff between them; see
+// ReadyOptions. When ctx ends or Timeout passes first, WaitReady fails
+// with a *NotReadyError.
+func (c *Client) WaitReady(ctx context.Context, opts ReadyOptions) (*ReadyReport, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("wait ready: %w", err)
+	}
+	opts = opts.withDefaults()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	wait := opts.ProbeInterval
+	warmed := false
+	var last error
+	for attempt := 1; ; attempt++ {
+		probeStart := time.Now()
+		report, err := c.probeReady(ctx, opts, &warmed)
+		probe := ReadyProbe{Attempt: attempt, Err: err, Duration: time.Since(probeStart)}
+		if err == nil {
+			if opts.OnProbe != nil {
+				opts.OnProbe(probe)
+			}
+			report.Attempts, report.Duration = attempt, time.Since(start)
+			return report, nil
+		}
+		if errors.Is(err, ErrDryRun) {
+			// A dry run answers nothing a probe could wait on.
+			return nil, err
+		}
+		// A probe cut short by the end of the wait says less than the one
+		// before it.
+		if last == nil || ctx.Err() == nil {
+			last = err
+		}
+		if ctx.Err() == nil {
+			probe.Next = wait
+		}
+		if opts.OnProbe != nil {
+			opts.OnProbe(probe)
+		}
+		if ctx.Err() != nil {
+			return nil, &NotReadyError{Attempts: attempt, Elapsed: time.Since(start), Err: last}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &NotReadyError{Attempts: attempt, Elapsed: time.Since(start), Err: last}
+		}
+		wait = min(2*wait, opts.MaxProbeInterval)
+	}
+}
+
+// probeReady makes one probe of WaitReady, warming the client up unless
+// warmed says an earlier probe did.
+func (c *Client) probeReady(ctx context.Context, opts ReadyOptions, warmed *bool) (*ReadyReport, error) {
+	if !*warmed {
+		if _, err := c.Warmup(ctx); err != nil {
+			return nil, err
+		}
+		*warmed = true
+	}
+	ping, err := c.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ping.OK {
+		return nil, fmt.Errorf("%s: %w", MethodPing, ErrUnhealthy)
+	}
+	report := &ReadyReport{Ping: ping}
+	if opts.MinModels == 0 && opts.RequireModel == "" {
+		return report, nil
+	}
+	models, err := c.refreshCapabilities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("refresh capabilities: %w", err)
+	}
+	report.Models = len(models)
+	if len(models) < opts.MinModels {
+		return nil, fmt.Errorf("%d models listed, want at least %d", len(models), opts.MinModels)
+	}
+	if opts.RequireModel != "" && !slices.ContainsFunc(models, func(m ModelInfo) bool { return m.Name == opts.RequireModel }) {
+		return nil, fmt.Errorf("model %q not listed: %w", opts.RequireModel, ErrModelNotFound)
+	}
+	return report, nil
+}
+
+// RunReady waits for the server described by opts to pass the probes of
+// opts.Ready, reporting each failed one to opts.Progress, and writes the
+// ReadyReport to opts.Stdout as opts.Output renders it. It fails with the
+// *NotReadyError of Client.WaitReady.
+func RunReady(ctx context.Context, opts Options) (err error) {
+	if opts.DryRun {
+		return opts.dryRun(ctx, RunReady)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	ready := opts.Ready
+	if onProbe, w := ready.OnProbe, opts.Progress; w != nil {
+		ready.OnProbe = func(p ReadyProbe) {
+			if p.Err != nil {
+				msg := fmt.Sprintf("ready: probe %d failed after %s: %v", p.Attempt, p.Duration.Round(time.Millisecond), p.Err)
+				if p.Next > 0 {
+					msg += fmt.Sprintf("; next in %s", p.Next)
+				}
+				fmt.Fprintln(w, msg)
+			}
+			if onProbe != nil {
+				onProbe(p)
+			}
+		}
+	}
+	report, err := c.WaitReady(ctx, ready)
+	if err != nil {
+		return err
+	}
+	if opts.Stdout != nil {
+		out := opts.Output
+		out.Indent = "  "
+		if err := out.Render(opts.Stdout, report, []any{report}); err != nil {
+			return fmt.Errorf("write ready report: %w", err)
+		}
+	}
+	return nil
+}
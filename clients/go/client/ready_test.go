@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitReady(t *testing.T) {
+	var pings atomic.Int64
+	// The server reports itself unhealthy to its first two pings.
+	handler := func(req Request) (Response, error) {
+		if req.Method == MethodPing && pings.Add(1) <= 2 {
+			raw, _ := json.Marshal(map[string]any{"ok": false})
+			return Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}, nil
+		}
+		return *defaultHandler(&req), nil
+	}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: handler})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var probes []ReadyProbe
+	report, err := c.WaitReady(context.Background(), ReadyOptions{
+		MinModels:     1,
+		RequireModel:  DefaultModel,
+		ProbeInterval: time.Millisecond,
+		OnProbe:       func(p ReadyProbe) { probes = append(probes, p) },
+	})
+	if err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+	if report.Attempts != 3 || report.Models != 2 || !report.Ping.OK || c.SessionID() == "" {
+		t.Fatalf("report %+v", report)
+	}
+	if len(probes) != 3 || !errors.Is(probes[0].Err, ErrUnhealthy) || probes[2].Err != nil {
+		t.Fatalf("probes %+v", probes)
+	}
+	// The wait doubles after each failure.
+	if probes[0].Next != time.Millisecond || probes[1].Next != 2*time.Millisecond || probes[2].Next != 0 {
+		t.Fatalf("probes %+v", probes)
+	}
+	if models := c.capabilities.cached(); len(models) != 2 {
+		t.Fatalf("cached models %v", models)
+	}
+}
+
+func TestWaitReadyTimesOut(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.WaitReady(context.Background(), ReadyOptions{RequireModel: "missing", ProbeInterval: time.Millisecond, Timeout: 50 * time.Millisecond})
+	var notReady *NotReadyError
+	if !errors.As(err, &notReady) || !errors.Is(err, ErrNotReady) || !errors.Is(err, ErrModelNotFound) || notReady.Attempts < 2 {
+		t.Fatalf("WaitReady for a missing model: %v", err)
+	}
+
+	// A server that cannot be reached fails with the class of that.
+	srv := httptest.NewServer(nil)
+	endpoint := srv.URL
+	srv.Close()
+	unreachable, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer unreachable.Close(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = unreachable.WaitReady(ctx, ReadyOptions{ProbeInterval: 5 * time.Millisecond})
+	if !errors.As(err, &notReady) || errors.Is(err, context.DeadlineExceeded) || notReady.Attempts < 2 {
+		t.Fatalf("WaitReady for a closed server: %v", err)
+	}
+
+	if _, err := c.WaitReady(context.Background(), ReadyOptions{MinModels: -1}); err == nil || errors.Is(err, ErrNotReady) {
+		t.Fatalf("WaitReady with negative settings: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import "time"
+
+// Restart backoff applied by the stdio transport when ClientConfig leaves
+// RestartBackoff unset. The delay doubles with each restart up to
+// maxRestartBackoff.
+const (
+	DefaultRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff     = 5 * time.Second
+)
+
+// ReconnectEvent describes a completed restart of a stream transport.
+type ReconnectEvent struct {
+	// Transport is the kind of the restarted transport.
+	Transport string
+	// Attempt counts restarts over the transport's lifetime, starting at 1.
+	Attempt int
+	// Cause is the failure that brought the previous connection down.
+	Cause error
+}
+
+// restartPolicy bounds how a stream transport recovers from a lost
+// connection. The zero value never restarts.
+type restartPolicy struct {
+	maxRestarts int
+	backoff     time.Duration
+	onReconnect func(ReconnectEvent)
+}
+
+func (cfg ClientConfig) restartPolicy() restartPolicy {
+	return restartPolicy{maxRestarts: cfg.MaxRestarts, backoff: cfg.RestartBackoff, onReconnect: cfg.OnReconnect}
+}
+
+// delay returns the wait before the given restart attempt.
+func (p restartPolicy) delay(attempt int) time.Duration {
+	d := p.backoff
+	for i := 1; i < attempt && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRestartBackoff)
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newCrashyClient(t *testing.T, maxRestarts int, events *[]ReconnectEvent) *Client {
+	t.Helper()
+	c, err := New(ClientConfig{
+		Command:        helperCommandMode(t, helperCrashy),
+		MaxRestarts:    maxRestarts,
+		RestartBackoff: time.Millisecond,
+		OnReconnect:    func(ev ReconnectEvent) { *events = append(*events, ev) },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestStdioRestartReplaysRequest(t *testing.T) {
+	t.Setenv(crashMarkerEnv, filepath.Join(t.TempDir(), "crashed"))
+	var events []ReconnectEvent
+	c := newCrashyClient(t, 1, &events)
+	ctx := context.Background()
+
+	if _, err := c.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	var pong map[string]any
+	if err := c.Call(ctx, MethodPing, nil, &pong); err != nil {
+		t.Fatalf("ping after crash: %v", err)
+	}
+	if pong["ok"] != true {
+		t.Fatalf("unexpected ping result %v", pong)
+	}
+	if len(events) != 1 || events[0].Attempt != 1 || events[0].Transport != TransportStdio || events[0].Cause == nil {
+		t.Fatalf("unexpected reconnect events %+v", events)
+	}
+}
+
+func TestStdioRestartDoesNotReplayUnsafeRequest(t *testing.T) {
+	var events []ReconnectEvent
+	c := newCrashyClient(t, 1, &events)
+	ctx := context.Background()
+
+	err := c.Call(ctx, crashMethod, nil, nil)
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unsafe request was replayed: %+v", events)
+	}
+	// The next call respawns the server.
+	if _, err := c.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize after restart: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one restart, got %+v", events)
+	}
+}
+
+func TestStdioRestartBudgetExhausted(t *testing.T) {
+	var events []ReconnectEvent
+	c := newCrashyClient(t, 0, &events)
+	ctx := context.Background()
+
+	if err := c.Call(ctx, crashMethod, nil, nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected sticky ErrConnectionLost, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unexpected restarts %+v", events)
+	}
+}
+
+func TestRestartBackoffDoubles(t *testing.T) {
+	p := restartPolicy{backoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: maxRestartBackoff, 10: maxRestartBackoff} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Buffering modes of a FileRecorder, the values of BufferingPolicy.Mode.
+const (
+	// BufferAll keeps every entry of a FormatJSON transcript in memory
+	// until Close writes the document. It is the default.
+	BufferAll = "all"
+	// BufferRing keeps only the most recent entries, within the policy's
+	// Entries and MaxBytes, and lets the oldest go. Close writes the window
+	// retained, in either format, and counts the entries dropped, by
+	// method, in the TranscriptSummary.
+	BufferRing = "ring"
+	// BufferSpill keeps up to MaxBytes of encoded entries in memory and
+	// moves them to a spill file beside the transcript past that, so a
+	// FormatJSON transcript of any length holds at most MaxBytes; Close
+	// writes the document from the spill file. FormatJSONL transcripts
+	// are appended to their file as they go and need no spilling.
+	BufferSpill = "spill"
+)
+
+// BufferingPolicy bounds the memory a FileRecorder holds a session in
+// until Close, for the sessions of load tests and other long runs. The
+// zero value is BufferAll.
+type BufferingPolicy struct {
+	Mode string
+	// Entries is the most entries BufferRing keeps; zero bounds them by
+	// MaxBytes alone.
+	Entries int
+	// MaxBytes is the most bytes of entries kept in memory: BufferRing
+	// drops the oldest past it, and BufferSpill moves them to disk. Zero
+	// leaves BufferRing bounded by Entries alone; BufferSpill needs it.
+	MaxBytes int64
+}
+
+func (p BufferingPolicy) validate() error {
+	if p.Entries < 0 || p.MaxBytes < 0 {
+		return errors.New("buffering: entry and byte bounds must not be negative")
+	}
+	switch p.Mode {
+	case "", BufferAll:
+	case BufferRing:
+		if p.Entries == 0 && p.MaxBytes == 0 {
+			return fmt.Errorf("buffering %s: needs a bound on entries or bytes", p.Mode)
+		}
+	case BufferSpill:
+		if p.MaxBytes == 0 {
+			return fmt.Errorf("buffering %s: needs a bound on bytes", p.Mode)
+		}
+	default:
+		return fmt.Errorf("buffering mode %q: want %s, %s, or %s", p.Mode, BufferAll, BufferRing, BufferSpill)
+	}
+	return nil
+}
+
+// entryOverhead approximates the memory of a buffered entry beyond its
+// message and strings: the Entry itself and the slot holding it.
+const entryOverhead = 128
+
+func entrySize(e Entry) int64 {
+	return int64(len(e.Message)+len(e.Direction)+len(e.SentAt)+len(e.ReceivedAt)+len(e.RequestID)) + entryOverhead
+}
+
+// unknownMethod counts the dropped entries whose method could not be told,
+// such as responses to requests dropped before being recorded.
+const unknownMethod = "unknown"
+
+// entryRing keeps the most recent entries of a BufferRing recorder.
+type entryRing struct {
+	maxEntries int
+	maxBytes   int64
+
+	// slots is circular: n entries from start.
+	slots    []ringSlot
+	start, n int
+	bytes    int64
+
+	// pending maps the IDs of requests awaiting their outcome to their
+	// method, to count a response by the method it answers.
+	pending map[string]string
+	dropped map[string]int
+	nDrop   int
+}
+
+type ringSlot struct {
+	entry  Entry
+	method string
+	size   int64
+}
+
+func newEntryRing(p BufferingPolicy) *entryRing {
+	return &entryRing{maxEntries: p.Entries, maxBytes: p.MaxBytes, pending: make(map[string]string), dropped: make(map[string]int)}
+}
+
+// add keeps e, dropping the oldest entries it leaves no room for; an
+// entry larger than maxBytes alone is dropped at once.
+func (q *entryRing) add(e Entry) {
+	slot := ringSlot{entry: e, method: q.method(e), size: entrySize(e)}
+	if q.maxBytes > 0 && slot.size > q.maxBytes {
+		q.drop(slot.method)
+		return
+	}
+	for q.n > 0 && ((q.maxEntries > 0 && q.n >= q.maxEntries) || (q.maxBytes > 0 && q.bytes+slot.size > q.maxBytes)) {
+		q.pop()
+	}
+	if q.n == len(q.slots) {
+		q.grow()
+	}
+	q.slots[(q.start+q.n)%len(q.slots)] = slot
+	q.n++
+	q.bytes += slot.size
+}
+
+func (q *entryRing) grow() {
+	size := max(16, 2*len(q.slots))
+	if q.maxEntries > 0 {
+		size = min(size, q.maxEntries)
+	}
+	slots := make([]ringSlot, size)
+	for i := 0; i < q.n; i++ {
+		slots[i] = q.slots[(q.start+i)%len(q.slots)]
+	}
+	q.slots, q.start = slots, 0
+}
+
+func (q *entryRing) pop() {
+	slot := q.slots[q.start]
+	q.slots[q.start] = ringSlot{}
+	q.start = (q.start + 1) % len(q.slots)
+	q.n--
+	q.bytes -= slot.size
+	q.drop(slot.method)
+}
+
+func (q *entryRing) drop(method string) {
+	q.dropped[method]++
+	q.nDrop++
+}
+
+// method returns the method e belongs to: a request's own, the method a
+// response or failure answers, or the method of a tombstone.
+func (q *entryRing) method(e Entry) string {
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	_ = json.Unmarshal(e.Message, &env)
+	id := string(env.ID)
+	switch e.Direction {
+	case DirectionRequest:
+		if env.Method != "" && id != "" && id != "null" {
+			q.pending[id] = env.Method
+		}
+	case DirectionResponse:
+		env.Method = q.pending[id]
+		delete(q.pending, id)
+	case DirectionError:
+		var f Failure
+		_ = json.Unmarshal(e.Message, &f)
+		env.Method = f.Method
+		delete(q.pending, strconv.FormatInt(f.ID, 10))
+	}
+	if env.Method == "" {
+		return unknownMethod
+	}
+	return env.Method
+}
+
+// retained returns the entries kept, oldest first, and the summary of a
+// transcript holding them.
+func (q *entryRing) retained() ([]Entry, TranscriptSummary) {
+	entries := make([]Entry, q.n)
+	var s TranscriptSummary
+	for i := range entries {
+		entries[i] = q.slots[(q.start+i)%len(q.slots)].entry
+		s.Add(entries[i])
+	}
+	if q.nDrop > 0 {
+		s.Dropped, s.DroppedMethods = q.nDrop, q.dropped
+	}
+	return entries, s
+}
+
+// spillBuffer holds the entries of a BufferSpill recorder, each encoded as
+// a line of compact JSON: in memory up to max bytes, then appended to a
+// spill file in segments its index records.
+type spillBuffer struct {
+	dir string
+	max int64
+
+	mem   []byte
+	memN  int
+	f     *os.File
+	size  int64
+	index []spillSegment
+}
+
+// spillSegment is a run of entries written to the spill file at once.
+type spillSegment struct {
+	offset  int64
+	entries int
+}
+
+func newSpillBuffer(dir string, maxBytes int64) *spillBuffer {
+	return &spillBuffer{dir: dir, max: maxBytes}
+}
+
+// buffered returns the bytes of entries held in memory.
+func (s *spillBuffer) buffered() int64 { return int64(len(s.mem)) }
+
+func (s *spillBuffer) add(e Entry) error {
+	raw, err := marshalCanonical(e, false)
+	if err != nil {
+		return fmt.Errorf("encode transcript entry: %w", err)
+	}
+	raw = append(raw, '\n')
+	if int64(len(s.mem)+len(raw)) > s.max {
+		if err := s.spill(s.mem, s.memN); err != nil {
+			return err
+		}
+		s.mem, s.memN = s.mem[:0], 0
+	}
+	if int64(len(raw)) > s.max {
+		return s.spill(raw, 1)
+	}
+	if s.mem == nil {
+		s.mem = make([]byte, 0, min(s.max, 64<<10))
+	}
+	s.mem = append(s.mem, raw...)
+	s.memN++
+	return nil
+}
+
+// spill appends the n entries encoded in p to the spill file.
+func (s *spillBuffer) spill(p []byte, n int) error {
+	if n == 0 {
+		return nil
+	}
+	if s.f == nil {
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return fmt.Errorf("create transcript directory: %w", err)
+		}
+		f, err := os.CreateTemp(s.dir, ".transcript-*.spill")
+		if err != nil {
+			return fmt.Errorf("create transcript spill file: %w", err)
+		}
+		s.f = f
+	}
+	if _, err := s.f.Write(p); err != nil {
+		return fmt.Errorf("write transcript spill file: %w", err)
+	}
+	s.index = append(s.index, spillSegment{offset: s.size, entries: n})
+	s.size += int64(len(p))
+	return nil
+}
+
+// each calls fn with every entry encoded, oldest first, checking the
+// spill file against its index as it is read back.
+func (s *spillBuffer) each(fn func(raw []byte) error) error {
+	if s.f != nil {
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("read transcript spill file: %w", err)
+		}
+		br := bufio.NewReader(s.f)
+		var off int64
+		for _, seg := range s.index {
+			if off != seg.offset {
+				return fmt.Errorf("read transcript spill file: segment at %d found at %d", seg.offset, off)
+			}
+			for i := 0; i < seg.entries; i++ {
+				line, err := br.ReadBytes('\n')
+				if err != nil {
+					return fmt.Errorf("read transcript spill file: entry %d of the segment at %d: %w", i, seg.offset, err)
+				}
+				off += int64(len(line))
+				if err := fn(line[:len(line)-1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for rest := s.mem; len(rest) > 0; {
+		line, tail, _ := bytes.Cut(rest, []byte{'\n'})
+		if err := fn(line); err != nil {
+			return err
+		}
+		rest = tail
+	}
+	return nil
+}
+
+// remove deletes the spill file.
+func (s *spillBuffer) remove() {
+	if s.f != nil {
+		s.f.Close()
+		os.Remove(s.f.Name())
+		s.f = nil
+	}
+}
+
+// closeSpilled writes a BufferSpill transcript from its spill buffer, in
+// the layout Close writes the document of a BufferAll one in; the caller
+// holds mu.
+func (r *FileRecorder) closeSpilled() error {
+	defer r.spill.remove()
+	if r.err != nil {
+		return r.err
+	}
+	doc := transcriptFile{transcriptHeader: r.header(), Messages: []Entry{}, Summary: r.summary}
+	content, err := marshalCanonical(doc, true)
+	if err != nil {
+		return fmt.Errorf("encode transcript: %w", err)
+	}
+	head, tail, _ := bytes.Cut(content, []byte(`"messages": []`))
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("create transcript directory: %w", err)
+	}
+	f, err := os.Create(r.path)
+	if err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	w.Write(head)
+	w.WriteString(`"messages": [`)
+	n := 0
+	var indented bytes.Buffer
+	err = r.spill.each(func(raw []byte) error {
+		if n > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString("\n    ")
+		indented.Reset()
+		if err := json.Indent(&indented, raw, "    ", "  "); err != nil {
+			return fmt.Errorf("encode transcript entry %d: %w", n, err)
+		}
+		w.Write(indented.Bytes())
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		w.WriteString("\n  ]")
+	} else {
+		w.WriteString("]")
+	}
+	w.Write(tail)
+	w.WriteByte('\n')
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
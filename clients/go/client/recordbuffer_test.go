@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// syntheticEntries records n round trips on rec, a ping every tenth and an
+// embed otherwise, and returns the most bytes rec held in memory at once.
+func syntheticEntries(t *testing.T, rec *FileRecorder, n int) int64 {
+	t.Helper()
+	var peak int64
+	for i := 0; i < n; i++ {
+		method := MethodEmbed
+		if i%10 == 0 {
+			method = MethodPing
+		}
+		rec.Record(Entry{Direction: DirectionRequest, Message: json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q}`, i, method))})
+		rec.Record(Entry{Direction: DirectionResponse, Message: json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{}}`, i))})
+		peak = max(peak, rec.buffered())
+	}
+	return peak
+}
+
+func loadTranscriptFile(t *testing.T, path string) transcriptFile {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("transcript does not load: %v", err)
+	}
+	return doc
+}
+
+func TestRecorderBufferingStaysWithinCap(t *testing.T) {
+	const n, maxBytes = 500_000, 1 << 20
+	if testing.Short() {
+		t.Skip("records a million entries")
+	}
+	for _, mode := range []string{BufferRing, BufferSpill} {
+		mode := mode
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "load.json")
+			rec := NewFileRecorder(path, TransportInProc)
+			rec.Config = RecorderConfig{NoDefaultRedactions: true, Buffering: BufferingPolicy{Mode: mode, MaxBytes: maxBytes}}
+			if peak := syntheticEntries(t, rec, n); peak > maxBytes || peak == 0 {
+				t.Fatalf("held %d bytes of entries, cap %d", peak, maxBytes)
+			}
+			if err := rec.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			doc := loadTranscriptFile(t, path)
+			s := doc.Summary
+			if len(doc.Messages) != s.Messages || s.Messages+s.Dropped != 2*n {
+				t.Fatalf("%d messages, summary %+v", len(doc.Messages), s)
+			}
+			if mode == BufferSpill {
+				if s.Dropped != 0 {
+					t.Fatalf("spilled transcript dropped %d entries", s.Dropped)
+				}
+				if leftover, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".transcript-*")); len(leftover) > 0 {
+					t.Fatalf("spill files left behind: %v", leftover)
+				}
+				return
+			}
+			// The window ends with the last round trip, and every entry let
+			// go is counted by its method, responses included.
+			var last Response
+			if err := json.Unmarshal(doc.Messages[len(doc.Messages)-1].Message, &last); err != nil || last.ID != n-1 {
+				t.Fatalf("window ends with %s", doc.Messages[len(doc.Messages)-1].Message)
+			}
+			if got := s.DroppedMethods[MethodPing] + s.DroppedMethods[MethodEmbed]; got != s.Dropped || s.DroppedMethods[MethodEmbed] < 8*s.DroppedMethods[MethodPing] {
+				t.Fatalf("dropped %d entries, by method %v", s.Dropped, s.DroppedMethods)
+			}
+		})
+	}
+}
+
+func TestRecorderRingKeepsLastEntries(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatJSONL} {
+		path := filepath.Join(t.TempDir(), "ring."+format)
+		rec := NewFileRecorder(path, TransportInProc)
+		rec.Config.Buffering = BufferingPolicy{Mode: BufferRing, Entries: 3}
+		syntheticEntries(t, rec, 4)
+		if err := rec.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The last three entries are kept: the answer of the third round
+		// trip and the fourth, after the ping opening the session and two
+		// embeds were dropped.
+		want := `{"messages":3,"requests":1,"responses":2,"failures":0,"dropped":5,"dropped_methods":{"` + MethodEmbed + `":3,"` + MethodPing + `":2}}`
+		if got := summaryJSON(t, content, format); string(got) != want {
+			t.Fatalf("%s summary %s, want %s", format, got, want)
+		}
+	}
+}
+
+// summaryJSON returns the summary of a transcript in either format,
+// compacted.
+func summaryJSON(t *testing.T, content []byte, format string) []byte {
+	t.Helper()
+	if format == FormatJSONL {
+		lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+		content = lines[len(lines)-1]
+	}
+	var doc struct {
+		Summary json.RawMessage `json:"summary"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = json.Compact(&buf, doc.Summary)
+	return buf.Bytes()
+}
+
+func TestRecorderSpillWritesTheSameDocument(t *testing.T) {
+	dir := t.TempDir()
+	var content [2][]byte
+	for i, b := range []BufferingPolicy{{}, {Mode: BufferSpill, MaxBytes: 200}} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.json", i))
+		rec := NewFileRecorder(path, TransportInProc)
+		rec.Config.Buffering = b
+		rec.ProtocolVersion = "2025-06-18"
+		syntheticEntries(t, rec, 5)
+		if err := rec.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		var err error
+		if content[i], err = os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(content[0], content[1]) {
+		t.Fatalf("spilled transcript differs:\n%s\nwant:\n%s", content[1], content[0])
+	}
+
+	for _, b := range []BufferingPolicy{{Mode: "lru"}, {Mode: BufferRing}, {Mode: BufferSpill, Entries: 10}, {Mode: BufferRing, Entries: -1}} {
+		if err := (RecorderConfig{Buffering: b}).Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", b)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Transcript directions recorded for each envelope.
+const (
+	DirectionRequest  = "request"
+	DirectionResponse = "response"
+	// DirectionError marks a Failure: a request that got no response.
+	DirectionError = "error"
+	// DirectionNotification marks a Notification the server pushed, as it
+	// arrived between the other entries.
+	DirectionNotification = "notification"
+)
+
+// FixtureModels is the FileRecorder.Kind of ListModels transcripts, stored
+// as tests/fixtures/go/<transport>/models.json.
+const FixtureModels = "models"
+
+// FixtureJob is the FileRecorder.Kind of job transcripts (submit, status
+// polls, and result pages), stored as tests/fixtures/go/<transport>/job.json.
+const FixtureJob = "job"
+
+// ClientMarker identifies transcripts produced by this client.
+const ClientMarker = "go"
+
+// Entry is one envelope captured by a Recorder.
+type Entry struct {
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+	// SentAt is when the request was sent, in RFC 3339 with nanoseconds.
+	// Response and error entries also carry ReceivedAt, when the outcome
+	// arrived, and DurationMS, the round trip in milliseconds. Entries
+	// recorded outside a round trip, such as stream frames, carry none;
+	// notification entries carry only ReceivedAt.
+	SentAt     string  `json:"sent_at,omitempty"`
+	ReceivedAt string  `json:"received_at,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	// DryRun marks a request a dry-run client did not send and the
+	// response it answered itself with; see WithDryRun.
+	DryRun bool `json:"dry_run,omitempty"`
+	// RequestID is the request ID of the call the entry belongs to, set
+	// on the transcripts of a transport with a MaxPipelineDepth, whose
+	// calls' entries interleave in the order they crossed the wire.
+	RequestID string `json:"request_id,omitempty"`
+	// Options are the effective per-call options of a request entry whose
+	// call set any; see RequestOptions.
+	Options *RequestOptions `json:"options,omitempty"`
+	// Trace links the entries of an exchange traced with
+	// ClientConfig.TracerProvider to the server's traces and logs; nil
+	// for those of an untraced one.
+	Trace *TraceLink `json:"trace,omitempty"`
+}
+
+// Timed returns e stamped with the round trip from sent to received. A zero
+// received stamps the request entry, which carries only SentAt.
+func (e Entry) Timed(sent, received time.Time) Entry {
+	e.SentAt = sent.UTC().Format(time.RFC3339Nano)
+	if !received.IsZero() {
+		e.ReceivedAt = received.UTC().Format(time.RFC3339Nano)
+		e.DurationMS = float64(received.Sub(sent).Microseconds()) / 1000
+	}
+	return e
+}
+
+// Recorder receives every envelope exchanged by a Client, and a
+// DirectionError entry for each request that got no response.
+type Recorder interface {
+	Record(entry Entry)
+}
+
+// SessionMarkers are the transcript markers of a session. Run and RunPing
+// pass them to recorders that implement MarkSession, once the transport is
+// chosen and again, with the negotiated versions, before closing them.
+type SessionMarkers struct {
+	Transport string
+	MTLS      bool
+	// Protocol is the HTTP version the http3 transport negotiated.
+	Protocol string
+	// ProtocolVersion is the MCP protocol version the session negotiated.
+	ProtocolVersion string
+	// WireProtocol is ClientConfig.WireProtocol, for a JSONRPC2 session.
+	WireProtocol string
+	// Codec is the codec the session negotiated, when not CodecJSON.
+	Codec string
+}
+
+// sessionMarkers returns the markers of a session of cfg known before it
+// starts.
+func (cfg ClientConfig) sessionMarkers() SessionMarkers {
+	m := SessionMarkers{Transport: cfg.Transport, MTLS: cfg.usesClientCert()}
+	if cfg.WireProtocol != "" && cfg.WireProtocol != WireNative {
+		m.WireProtocol = cfg.WireProtocol
+	}
+	return m
+}
+
+// sessionMarker is implemented by recorders that store SessionMarkers.
+type sessionMarker interface {
+	MarkSession(m SessionMarkers)
+}
+
+// Failure is the message of a DirectionError entry.
+type Failure struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	Error  string `json:"error"`
+	// Class is the error class, as ErrorClass reports it.
+	Class   string `json:"class"`
+	Timeout bool   `json:"timeout,omitempty"`
+	// BytesRead is how much of the answer had arrived when the request
+	// failed, such as the frames of a stream cut short; see BytesRead.
+	BytesRead int64 `json:"bytes_read,omitempty"`
+}
+
+// FailureEntry records that req failed with err.
+func FailureEntry(req *Request, err error) Entry {
+	class := ErrorClass(err)
+	raw, _ := json.Marshal(Failure{ID: req.ID, Method: req.Method, Error: err.Error(), Class: class, Timeout: class == "timeout", BytesRead: BytesRead(err)})
+	return Entry{Direction: DirectionError, Message: raw}
+}
+
+// TranscriptSummary is the footer recorders write when they close a
+// transcript, totalling what it holds. A transcript without one was cut
+// short, for example by a crash of the recording process.
+type TranscriptSummary struct {
+	Messages  int `json:"messages"`
+	Requests  int `json:"requests"`
+	Responses int `json:"responses"`
+	Failures  int `json:"failures"`
+	// Skipped counts the round trips a RecordFilter left out, as its
+	// tombstones report them.
+	Skipped int `json:"skipped,omitempty"`
+	// Notifications counts the notifications the server pushed.
+	Notifications int `json:"notifications,omitempty"`
+	// FailureClasses counts the failures by Failure.Class.
+	FailureClasses map[string]int `json:"failure_classes,omitempty"`
+	// Dropped counts the entries a BufferRing recorder let go to stay
+	// within its bounds, which the transcript does not hold, and
+	// DroppedMethods counts them by the method they belong to.
+	Dropped        int            `json:"dropped,omitempty"`
+	DroppedMethods map[string]int `json:"dropped_methods,omitempty"`
+}
+
+// Add counts entry.
+func (s *TranscriptSummary) Add(entry Entry) {
+	s.Messages++
+	switch entry.Direction {
+	case DirectionRequest:
+		s.Requests++
+	case DirectionResponse:
+		s.Responses++
+	case DirectionError:
+		s.Failures++
+		var f Failure
+		_ = json.Unmarshal(entry.Message, &f)
+		if s.FailureClasses == nil {
+			s.FailureClasses = make(map[string]int)
+		}
+		s.FailureClasses[f.Class]++
+	case DirectionSkipped:
+		var t Tombstone
+		_ = json.Unmarshal(entry.Message, &t)
+		s.Skipped += t.Count
+	case DirectionNotification:
+		s.Notifications++
+	}
+}
+
+// ErrorClass names the class of err for transcripts and logs: "timeout",
+// "canceled", "unauthorized", "model_not_found", "payload_too_large",
+// "connection", "protocol", "closed", "api", or "other". A connection
+// lost, or one that could not be made, such as a refused dial or a failed
+// TLS handshake, is of the connection class.
+func ErrorClass(err error) string {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrModelNotFound):
+		return "model_not_found"
+	case errors.Is(err, ErrPayloadTooLarge):
+		return "payload_too_large"
+	case errors.Is(err, ErrConnectionLost), errors.Is(err, ErrCircuitOpen):
+		return "connection"
+	case errors.Is(err, ErrProtocol), errors.Is(err, ErrIncompatibleProtocol):
+		return "protocol"
+	case errors.Is(err, ErrClientClosed):
+		return "closed"
+	case isConnectionError(err):
+		return "connection"
+	case errors.As(err, &apiErr):
+		return "api"
+	}
+	return "other"
+}
+
+// TranscriptVersion is the transcript_version of the documents recorders
+// write. Bump it, and register a migration in package transcript, whenever
+// the layout changes.
+const TranscriptVersion = 2
+
+// transcriptHeader holds the markers of a transcript.
+type transcriptHeader struct {
+	Version int    `json:"transcript_version"`
+	Client  string `json:"client"`
+	// ClientBuild is the BuildInfo.UserAgent of the recording client.
+	ClientBuild string `json:"client_build,omitempty"`
+	Transport   string `json:"transport"`
+	Kind        string `json:"kind,omitempty"`
+	MTLS        bool   `json:"mtls,omitempty"`
+	// WireProtocol marks the transcripts of JSONRPC2 sessions.
+	WireProtocol string `json:"wire_protocol,omitempty"`
+	Protocol     string `json:"protocol,omitempty"`
+	// ProtocolVersion is the negotiated MCP protocol version.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	// Codec is the negotiated codec the envelopes, recorded as JSON,
+	// traveled in.
+	Codec string `json:"codec,omitempty"`
+}
+
+// transcriptFile is the on-disk layout written by FileRecorder.
+type transcriptFile struct {
+	transcriptHeader
+	Messages []Entry           `json:"messages"`
+	Summary  TranscriptSummary `json:"summary"`
+}
+
+// FileRecorder writes a transcript to a file. In FormatJSON it buffers
+// entries in memory and writes the document when closed; in FormatJSONL it
+// appends each entry to the file as it is recorded, so long sessions are
+// not held in memory. RecorderConfig.Buffering bounds the memory a
+// FormatJSON session is held in, or keeps only its last entries. Credentials are redacted as they are recorded, so
+// they are never written; see RecorderConfig. Messages are written as
+// CanonicalJSON, so the same session always yields the same bytes.
+type FileRecorder struct {
+	path      string
+	transport string
+	// Kind names the fixture kind the transcript feeds, such as
+	// FixtureModels or FixtureJob; empty for the session transcript.
+	Kind string
+	// MTLS marks transcripts captured while presenting a client certificate.
+	MTLS bool
+	// WireProtocol marks transcripts of sessions in the JSONRPC2 wire
+	// protocol, whose requests carry no meta, so fixtures of both protocols
+	// can sit side by side.
+	WireProtocol string
+	// Protocol records the HTTP version the http3 transport negotiated, such
+	// as "HTTP/3.0", or "HTTP/2.0" after falling back.
+	Protocol string
+	// ProtocolVersion records the MCP protocol version the session
+	// negotiated.
+	ProtocolVersion string
+	// Codec records the codec the session negotiated, when not CodecJSON;
+	// the messages are recorded as JSON whatever it is.
+	Codec string
+	// Config selects what is redacted before entries are kept, and the
+	// format; the zero value applies DefaultRedactions. Set it, Kind, and
+	// MTLS before recording starts.
+	Config RecorderConfig
+
+	mu       sync.Mutex
+	redactor *Redactor
+	filter   *Filter
+	entries  []Entry
+	// ring and spill hold the entries instead under a BufferRing or
+	// BufferSpill policy.
+	ring  *entryRing
+	spill *spillBuffer
+	// n counts the entries recorded, which in FormatJSONL are not kept.
+	n       int
+	summary TranscriptSummary
+	jsonl   *jsonlFile
+	err     error
+}
+
+// NewFileRecorder returns a recorder that writes the transcript for transport
+// to path.
+func NewFileRecorder(path, transport string) *FileRecorder {
+	return &FileRecorder{path: path, transport: transport}
+}
+
+// Record appends entry to the transcript, filtered and redacted as Config
+// directs.
+func (r *FileRecorder) Record(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.redactor == nil {
+		r.redactor = NewRedactor(r.Config)
+		r.filter = NewFilter(r.Config.Filter)
+		switch b := r.Config.Buffering; b.Mode {
+		case BufferRing:
+			r.ring = newEntryRing(b)
+		case BufferSpill:
+			if TranscriptFormat(r.path, r.Config.Format) == FormatJSON {
+				r.spill = newSpillBuffer(filepath.Dir(r.path), b.MaxBytes)
+			}
+		}
+	}
+	for _, e := range r.filter.Filter(r.transport, entry) {
+		r.record(e)
+	}
+}
+
+// record appends entry unfiltered; the caller holds mu.
+func (r *FileRecorder) record(entry Entry) {
+	entry.Message = CanonicalJSON(r.redactor.Redact(r.n, entry.Message))
+	r.n++
+	r.summary.Add(entry)
+	switch {
+	case r.ring != nil:
+		r.ring.add(entry)
+		return
+	case r.spill != nil:
+		if r.err == nil {
+			r.err = r.spill.add(entry)
+		}
+		return
+	case TranscriptFormat(r.path, r.Config.Format) == FormatJSON:
+		r.entries = append(r.entries, entry)
+		return
+	}
+	if r.err != nil {
+		return
+	}
+	if r.jsonl == nil {
+		if r.jsonl, r.err = createJSONL(r.path, r.header()); r.err != nil {
+			return
+		}
+	}
+	r.err = r.jsonl.writeLine(entry)
+}
+
+// Err reports the first error writing a FormatJSONL transcript or the
+// spill file of a BufferSpill one, which Close also returns.
+func (r *FileRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// header returns the markers; the caller holds mu.
+func (r *FileRecorder) header() transcriptHeader {
+	return transcriptHeader{
+		Version:         TranscriptVersion,
+		Client:          ClientMarker,
+		ClientBuild:     userAgent(),
+		Transport:       r.transport,
+		Kind:            r.Kind,
+		MTLS:            r.MTLS,
+		WireProtocol:    r.WireProtocol,
+		Protocol:        r.Protocol,
+		ProtocolVersion: r.ProtocolVersion,
+		Codec:           r.Codec,
+	}
+}
+
+// MarkSession stores the markers of the session recorded.
+func (r *FileRecorder) MarkSession(m SessionMarkers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport, r.MTLS, r.Protocol, r.ProtocolVersion = m.Transport, m.MTLS, m.Protocol, m.ProtocolVersion
+	r.WireProtocol, r.Codec = m.WireProtocol, m.Codec
+}
+
+// buffered returns the bytes of entries a BufferRing or BufferSpill
+// recorder holds in memory.
+func (r *FileRecorder) buffered() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.ring != nil:
+		return r.ring.bytes
+	case r.spill != nil:
+		return r.spill.buffered()
+	}
+	return 0
+}
+
+// Close writes the transcript, or completes a FormatJSONL one, ending it
+// with its TranscriptSummary and creating parent directories as needed.
+// Under BufferRing it writes the entries retained, in either format.
+func (r *FileRecorder) Close() error {
+	r.mu.Lock()
+	for _, e := range r.filter.Flush() {
+		r.record(e)
+	}
+	if r.ring != nil {
+		r.entries, r.summary = r.ring.retained()
+		r.ring = nil
+	}
+	if r.spill != nil {
+		defer r.mu.Unlock()
+		return r.closeSpilled()
+	}
+	if TranscriptFormat(r.path, r.Config.Format) == FormatJSONL {
+		defer r.mu.Unlock()
+		return r.closeJSONL()
+	}
+	doc := transcriptFile{transcriptHeader: r.header(), Messages: append([]Entry(nil), r.entries...), Summary: r.summary}
+	r.mu.Unlock()
+	if doc.Messages == nil {
+		doc.Messages = []Entry{}
+	}
+
+	content, err := marshalCanonical(doc, true)
+	if err != nil {
+		return fmt.Errorf("encode transcript: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("create transcript directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+func recordMessage(r Recorder, direction string, message any) {
+	recordTimed(r, direction, message, time.Time{}, time.Time{})
+}
+
+// recordTimed records message stamped, unless sent is zero, with its round
+// trip; see Entry.Timed.
+func recordTimed(r Recorder, direction string, message any, sent, received time.Time) {
+	if r == nil {
+		return
+	}
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	entry := Entry{Direction: direction, Message: raw}
+	if !sent.IsZero() {
+		entry = entry.Timed(sent, received)
+	}
+	r.Record(entry)
+}
+
+// interceptRecord is the Interceptor feeding ClientConfig.Recorder. It sits
+// innermost so the transcript holds what was actually exchanged, including
+// each attempt that failed, and times each attempt alone.
+func (c *Client) interceptRecord(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	rec := c.cfg.Recorder
+	if c.cfg.DryRun {
+		rec = dryRunRecorder{rec}
+	}
+	if opts, ok := req.Options(); ok {
+		rec = optionsRecorder{rec, &opts}
+	}
+	rec = linkTrace(ctx, rec, req)
+	if c.pipelined {
+		// The transport records the envelopes as it writes and reads them.
+		w := newWireRecorder(rec, req, false)
+		resp, err := next(context.WithValue(ctx, wireRecordKey{}, w), req)
+		w.finish(resp, err)
+		return resp, err
+	}
+	sent := time.Now()
+	recordTimed(rec, DirectionRequest, c.recorded(req), sent, time.Time{})
+	resp, err := next(ctx, req)
+	received := time.Now()
+	noteAnswer(rec, resp, err)
+	if err != nil {
+		rec.Record(FailureEntry(req, err).Timed(sent, received))
+	} else {
+		recordTimed(rec, DirectionResponse, resp, sent, received)
+	}
+	return resp, err
+}
+
+// wireTranslator is implemented by transports that send other messages in
+// place of the envelopes, such as the protos of grpc.
+type wireTranslator interface {
+	// translate returns req as the transcript records it.
+	translate(req *Request) *Request
+}
+
+// recorded returns req as the transcript records it: as it goes on the
+// wire, or as the transport translates it.
+func (c *Client) recorded(req *Request) *Request {
+	if t, ok := c.transport.(wireTranslator); ok {
+		return t.translate(req)
+	}
+	return req.Wire()
+}
+
+// dryRunRecorder marks the entries it passes on as DryRun.
+type dryRunRecorder struct {
+	Recorder
+}
+
+func (r dryRunRecorder) Record(entry Entry) {
+	entry.DryRun = true
+	r.Recorder.Record(entry)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorderKeepsFailureOfStreamCutShort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdio.json")
+	rec := NewFileRecorder(path, TransportStdio)
+	// Length prefixes tell a frame cut short from a last line left
+	// unterminated.
+	t.Setenv(helperFramingEnv, FramingLengthPrefixed)
+	c, err := New(ClientConfig{Command: helperCommandMode(t, helperCutShort), Framing: FramingLengthPrefixed, Recorder: rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	results := collect(t, ch)
+	if n := len(results); n != 2 || results[n-1].Index != -1 || ErrorClass(results[n-1].Err) != "connection" {
+		t.Fatalf("expected a frame and a connection failure, got %+v", results)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("transcript does not load: %v\n%s", err, content)
+	}
+	if len(doc.Messages) != 3 || doc.Messages[2].Direction != DirectionError {
+		t.Fatalf("expected request, frame, and failure, got %+v", doc.Messages)
+	}
+	var failure Failure
+	if err := json.Unmarshal(doc.Messages[2].Message, &failure); err != nil {
+		t.Fatal(err)
+	}
+	// The delivered frame and the half written after it were read.
+	var frame bytes.Buffer
+	if err := json.Compact(&frame, doc.Messages[1].Message); err != nil {
+		t.Fatal(err)
+	}
+	if failure.Class != "connection" || failure.BytesRead <= int64(frame.Len()) {
+		t.Fatalf("failure = %+v, want class connection and more than %d bytes read", failure, frame.Len())
+	}
+	if s := doc.Summary; s.Messages != 3 || s.Failures != 1 || s.FailureClasses["connection"] != 1 {
+		t.Fatalf("summary = %+v", s)
+	}
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DefaultRedactions are the field names a FileRecorder redacts unless
+// RecorderConfig.NoDefaultRedactions is set: credentials, and the
+// idempotency keys that would let a transcript's requests be replayed
+// against the server as the originals.
+var DefaultRedactions = []string{
+	"authorization",
+	"proxy_authorization",
+	"api_key",
+	"x_api_key",
+	"*_token",
+	"idempotency_key",
+}
+
+// redactedPrefix starts every redacted value.
+const redactedPrefix = "[REDACTED:"
+
+// RecorderConfig configures what a recorder such as FileRecorder writes.
+type RecorderConfig struct {
+	// Redactions adds to DefaultRedactions. An entry starting with "/" is a
+	// JSON pointer into the transcript document, where a "*" segment matches
+	// any key or index, so "/messages/*/message/params/inputs" redacts the
+	// inputs of every request. Any other entry is a field name matched at
+	// any depth of a message, case-insensitively and with "-" and "_" equal
+	// so JSON fields and header names such as "Idempotency-Key" match alike,
+	// and may hold path.Match wildcards such as "*_token".
+	//
+	// A redacted value, whatever its type, is replaced by the string
+	// "[REDACTED:<hash>]", where hash starts the hex SHA-256 of the value's
+	// JSON, so equal secrets stay recognizable without being readable.
+	Redactions []string
+	// NoDefaultRedactions records credentials as they went over the wire.
+	NoDefaultRedactions bool
+	// Format is FormatJSON or FormatJSONL. Empty picks JSONL for paths
+	// ending in ".jsonl" and JSON otherwise.
+	Format string
+	// Anonymize replaces payload contents with hashes after redaction; see
+	// Anonymizer. AnonymizeSalt keys them, and empty picks a random salt
+	// for each recorder.
+	Anonymize     bool
+	AnonymizeSalt string
+	// Filter selects the round trips recorded; the zero value keeps all.
+	Filter RecordFilter
+	// Buffering bounds the memory a FileRecorder holds the session in; see
+	// BufferingPolicy. Recorders streaming to their sinks ignore it.
+	Buffering BufferingPolicy
+}
+
+// Validate reports malformed redaction and filter patterns, unknown
+// formats, and buffering policies without their bounds.
+func (cfg RecorderConfig) Validate() error {
+	switch cfg.Format {
+	case "", FormatJSON, FormatJSONL:
+	default:
+		return fmt.Errorf("transcript format %q: want %s or %s", cfg.Format, FormatJSON, FormatJSONL)
+	}
+	for _, r := range cfg.Redactions {
+		if r == "" {
+			return fmt.Errorf("redaction: empty pattern")
+		}
+		if strings.HasPrefix(r, "/") {
+			continue
+		}
+		if _, err := path.Match(normalizeFieldName(r), ""); err != nil {
+			return fmt.Errorf("redaction %q: %w", r, err)
+		}
+	}
+	if err := cfg.Buffering.validate(); err != nil {
+		return err
+	}
+	return cfg.Filter.Validate()
+}
+
+// Redactor applies the redactions of a RecorderConfig to recorded
+// messages, then its anonymization, for recorders other than FileRecorder.
+type Redactor struct {
+	names      []redactionRule
+	pointers   []redactionRule
+	rules      []string
+	anonymizer *Anonymizer
+}
+
+// redactionRule is a compiled redaction: a normalized field name pattern or
+// the segments of a pointer, and the rule as configured.
+type redactionRule struct {
+	name    string
+	pointer []string
+	rule    string
+}
+
+// AnonymizeRule is the name Redactor.Rules gives the anonymization of a
+// RecorderConfig.
+const AnonymizeRule = "anonymize"
+
+// NewRedactor returns the Redactor for cfg, which should be valid.
+func NewRedactor(cfg RecorderConfig) *Redactor {
+	r := &Redactor{}
+	var patterns []string
+	if !cfg.NoDefaultRedactions {
+		patterns = append(patterns, DefaultRedactions...)
+	}
+	for _, pattern := range append(patterns, cfg.Redactions...) {
+		r.rules = append(r.rules, pattern)
+		if strings.HasPrefix(pattern, "/") {
+			r.pointers = append(r.pointers, redactionRule{pointer: splitPointer(pattern), rule: pattern})
+		} else {
+			r.names = append(r.names, redactionRule{name: normalizeFieldName(pattern), rule: pattern})
+		}
+	}
+	if cfg.Anonymize {
+		r.anonymizer = NewAnonymizer(cfg.AnonymizeSalt)
+		r.rules = append(r.rules, AnonymizeRule)
+	}
+	return r
+}
+
+// Rules lists the rules r applies, in order: its redaction patterns as
+// configured, DefaultRedactions first, then AnonymizeRule when it
+// anonymizes.
+func (r *Redactor) Rules() []string { return r.rules }
+
+// Redact returns message, the index'th of the transcript, with its
+// sensitive values replaced. A message with nothing to redact is returned
+// unchanged.
+func (r *Redactor) Redact(index int, message json.RawMessage) json.RawMessage {
+	return r.RedactCounted(index, message, nil)
+}
+
+// RedactCounted is Redact, also adding to counts, when it is not nil, the
+// number of values each rule replaced, keyed as Rules names them. A value
+// redacted already is not counted again.
+func (r *Redactor) RedactCounted(index int, message json.RawMessage, counts map[string]int) json.RawMessage {
+	message = r.redact(index, message, counts)
+	if r.anonymizer != nil {
+		var n int
+		message, n = r.anonymizer.anonymize(message)
+		if counts != nil && n > 0 {
+			counts[AnonymizeRule] += n
+		}
+	}
+	return message
+}
+
+func (r *Redactor) redact(index int, message json.RawMessage, counts map[string]int) json.RawMessage {
+	if len(r.names) == 0 && len(r.pointers) == 0 {
+		return message
+	}
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return message
+	}
+	root := []string{"messages", strconv.Itoa(index), "message"}
+	v, changed := r.walk(root, v, counts)
+	if !changed {
+		return message
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return message
+	}
+	return raw
+}
+
+func (r *Redactor) walk(path []string, v any, counts map[string]int) (any, bool) {
+	if rule, ok := r.matchesPointer(path); ok {
+		return replaced(v, rule, counts), true
+	}
+	changed := false
+	switch node := v.(type) {
+	case map[string]any:
+		for k, child := range node {
+			if rule, ok := r.matchesName(k); ok {
+				node[k] = replaced(child, rule, counts)
+				changed = true
+				continue
+			}
+			var c bool
+			if node[k], c = r.walk(append(path[:len(path):len(path)], k), child, counts); c {
+				changed = true
+			}
+		}
+	case []any:
+		for i, child := range node {
+			var c bool
+			if node[i], c = r.walk(append(path[:len(path):len(path)], strconv.Itoa(i)), child, counts); c {
+				changed = true
+			}
+		}
+	}
+	return v, changed
+}
+
+func (r *Redactor) matchesName(key string) (string, bool) {
+	key = normalizeFieldName(key)
+	for _, pattern := range r.names {
+		if ok, _ := path.Match(pattern.name, key); ok {
+			return pattern.rule, true
+		}
+	}
+	return "", false
+}
+
+func (r *Redactor) matchesPointer(path []string) (string, bool) {
+	for _, pattern := range r.pointers {
+		if len(pattern.pointer) != len(path) {
+			continue
+		}
+		match := true
+		for i, seg := range pattern.pointer {
+			if seg != "*" && seg != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return pattern.rule, true
+		}
+	}
+	return "", false
+}
+
+// replaced returns the redacted value of v, counting it against rule when
+// it changes.
+func replaced(v any, rule string, counts map[string]int) string {
+	redacted := redactedValue(v)
+	if s, ok := v.(string); counts != nil && (!ok || s != redacted) {
+		counts[rule]++
+	}
+	return redacted
+}
+
+// redactedValue replaces v. Values redacted already are kept, so a
+// transcript can be redacted again without changing.
+func redactedValue(v any) string {
+	if s, ok := v.(string); ok && strings.HasPrefix(s, redactedPrefix) {
+		return s
+	}
+	raw, _ := json.Marshal(v)
+	sum := sha256.Sum256(raw)
+	return redactedPrefix + hex.EncodeToString(sum[:6]) + "]"
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
+
+// splitPointer splits a JSON pointer into its unescaped segments.
+func splitPointer(p string) []string {
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, seg := range segs {
+		segs[i] = strings.ReplaceAll(strings.ReplaceAll(seg, "~1", "/"), "~0", "~")
+	}
+	return segs
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRedacts(t *testing.T) {
+	message := `{"method":"mcp.embed","params":{"inputs":["secret text"],"headers":{"Authorization":"Bearer abc","X-Trace":"t1"},"Session-Token":"s1"},"meta":{"sequence":1,"idempotency_key":"k1"}}`
+	decode := func(r *FileRecorder, raw string) map[string]any {
+		t.Helper()
+		r.Record(Entry{Direction: DirectionRequest, Message: json.RawMessage(raw)})
+		var v map[string]any
+		if err := json.Unmarshal(r.entries[len(r.entries)-1].Message, &v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return v
+	}
+
+	r := NewFileRecorder(filepath.Join(t.TempDir(), "t.json"), TransportHTTP)
+	v := decode(r, message)
+	params := v["params"].(map[string]any)
+	auth := params["headers"].(map[string]any)["Authorization"].(string)
+	if !strings.HasPrefix(auth, "[REDACTED:") || params["Session-Token"] == "s1" || v["meta"].(map[string]any)["idempotency_key"] == "k1" {
+		t.Fatalf("credentials recorded: %v", v)
+	}
+	if params["headers"].(map[string]any)["X-Trace"] != "t1" || params["inputs"].([]any)[0] != "secret text" {
+		t.Fatalf("unrelated fields redacted: %v", v)
+	}
+	// The same secret redacts to the same value, and redacting twice is a no-op.
+	if again := decode(r, message)["params"].(map[string]any)["headers"].(map[string]any)["Authorization"]; again != auth {
+		t.Fatalf("redaction not deterministic: %v vs %v", again, auth)
+	}
+	if v := decode(r, string(r.entries[0].Message)); v["params"].(map[string]any)["headers"].(map[string]any)["Authorization"] != auth {
+		t.Fatalf("re-redaction changed the value: %v", v)
+	}
+	// Messages without secrets are only put in canonical form.
+	r.Record(Entry{Direction: DirectionRequest, Message: json.RawMessage(`{"method": "mcp.ping"}`)})
+	if got := string(r.entries[len(r.entries)-1].Message); got != `{"method":"mcp.ping"}` {
+		t.Fatalf("plain message rewritten: %s", got)
+	}
+
+	custom := NewFileRecorder(filepath.Join(t.TempDir(), "t.json"), TransportHTTP)
+	custom.Config = RecorderConfig{Redactions: []string{"/messages/*/message/params/inputs"}, NoDefaultRedactions: true}
+	v = decode(custom, message)
+	params = v["params"].(map[string]any)
+	if _, ok := params["inputs"].(string); !ok || params["headers"].(map[string]any)["Authorization"] != "Bearer abc" {
+		t.Fatalf("custom redactions not applied: %v", v)
+	}
+
+	if err := (RecorderConfig{Redactions: []string{"[bad"}}).Validate(); err == nil {
+		t.Fatal("malformed pattern accepted")
+	}
+	err := Run(context.Background(), Options{
+		Config:           ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+		RecordTranscript: filepath.Join(t.TempDir(), "t.json"),
+		Recorder:         RecorderConfig{Redactions: []string{""}},
+	})
+	if err == nil {
+		t.Fatal("Run accepted an empty redaction")
+	}
+}
@@ -0,0 +1,384 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of a Renderer.
+const (
+	// OutputJSON writes the result as one JSON document.
+	OutputJSON = "json"
+	// OutputNDJSON writes one JSON object per record, a line each.
+	OutputNDJSON = "ndjson"
+	// OutputCSV writes a header row and one row per record, nested fields
+	// flattened to dotted column names such as "session.id".
+	OutputCSV = "csv"
+	// OutputTable writes the columns of OutputCSV aligned for reading in a
+	// terminal, under a header line.
+	OutputTable = "table"
+	// OutputArrow writes the records of an input-file run as an Arrow IPC
+	// file, also known as Feather v2: a record batch per window of lines,
+	// with the columns index, int64, text_hash, the SHA-256 of the embedded
+	// text as a fixed_size_binary(32), and embedding, a fixed_size_list of
+	// float32s. Only RunEmbed writes it, from an input file to an output
+	// file.
+	OutputArrow = "arrow"
+	// OutputNPY writes the vectors of an input-file run as a NumPy .npy
+	// file of a 2-D float32 array, a row per non-empty line; see package
+	// npyio. Only RunEmbed writes it, from an input file to an output file.
+	OutputNPY = "npy"
+	// OutputParquet writes the rows of an input-file run as an Apache
+	// Parquet file with the columns of export.EmbeddingRow, identified by
+	// line number; see package export and Options.Parquet. Only RunEmbed
+	// writes it, from an input file to an output file.
+	OutputParquet = "parquet"
+)
+
+// Encodings of the vectors in OutputCSV, applied to every array of numbers.
+const (
+	// VectorsFloats joins the components with semicolons, as "1;0.5;-0.5".
+	VectorsFloats = "floats"
+	// VectorsBase64 writes the components as little-endian float32s,
+	// base64 encoded.
+	VectorsBase64 = "base64"
+)
+
+// Renderer writes the results of the CLI subcommands, so every subcommand
+// supports every output format.
+type Renderer struct {
+	// Format is OutputJSON, the default, OutputNDJSON, OutputCSV,
+	// OutputTable, or OutputArrow, OutputNPY, or OutputParquet, which only
+	// RunEmbed writes.
+	Format string
+	// Columns selects and orders the OutputCSV and OutputTable columns, by
+	// flattened field name. Empty writes every field, in the order the
+	// records have them; columns a record lacks are left empty.
+	Columns []string
+	// Vectors is how OutputCSV and OutputTable write vectors:
+	// VectorsFloats, the default, or VectorsBase64.
+	Vectors string
+	// Indent indents OutputJSON documents, as json.Encoder.SetIndent.
+	Indent string
+}
+
+// Validate reports an unknown format or vector encoding.
+func (r Renderer) Validate() error {
+	switch r.Format {
+	case "", OutputJSON, OutputNDJSON, OutputCSV, OutputTable, OutputArrow, OutputNPY, OutputParquet:
+	default:
+		return fmt.Errorf("output %q: want %s, %s, %s, %s, %s, %s, or %s", r.Format, OutputJSON, OutputNDJSON, OutputCSV, OutputTable, OutputArrow, OutputNPY, OutputParquet)
+	}
+	switch r.Vectors {
+	case "", VectorsFloats, VectorsBase64:
+	default:
+		return fmt.Errorf("csv vectors %q: want %s or %s", r.Vectors, VectorsFloats, VectorsBase64)
+	}
+	return nil
+}
+
+// fileOnly reports whether the format is one only RunEmbed writes, to an
+// output file: OutputArrow, OutputNPY, or OutputParquet.
+func (r Renderer) fileOnly() bool {
+	return r.Format == OutputArrow || r.Format == OutputNPY || r.Format == OutputParquet
+}
+
+func (r Renderer) format() string {
+	if r.Format == "" {
+		return OutputJSON
+	}
+	return r.Format
+}
+
+// Render writes a result to w: doc as one document for OutputJSON, and
+// records, a line or row each, for the other formats but those only
+// RunEmbed writes to a file, which it rejects.
+func (r Renderer) Render(w io.Writer, doc any, records []any) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	switch {
+	case r.fileOnly():
+		return fmt.Errorf("output %s is written only by embed, from an input file to an output file", r.Format)
+	case r.format() == OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", r.Indent)
+		return enc.Encode(doc)
+	}
+	rw := r.NewRecordWriter(w)
+	if rw.columnar() && len(r.Columns) == 0 {
+		// Every record contributes its fields, as some omit empty ones.
+		rows := make([][]field, len(records))
+		for i, rec := range records {
+			var err error
+			if rows[i], err = flatten(rec); err != nil {
+				return err
+			}
+			rw.columns = appendColumns(rw.columns, rows[i])
+		}
+		for _, row := range rows {
+			if err := rw.writeRow(row); err != nil {
+				return err
+			}
+		}
+		return rw.Flush()
+	}
+	for _, rec := range records {
+		if err := rw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return rw.Flush()
+}
+
+// RecordWriter streams records in the OutputNDJSON, OutputCSV, or
+// OutputTable format of its Renderer. Without Renderer.Columns the columns
+// are those of the first record. A table is aligned, and so written, as a
+// whole on Flush.
+type RecordWriter struct {
+	r       Renderer
+	w       io.Writer
+	csv     *csv.Writer
+	table   *tabwriter.Writer
+	columns []string
+	// header is whether the header row is still to be written.
+	header bool
+}
+
+// NewRecordWriter returns a RecordWriter writing to w.
+func (r Renderer) NewRecordWriter(w io.Writer) *RecordWriter {
+	rw := &RecordWriter{r: r, w: w, columns: r.Columns, header: true}
+	switch r.format() {
+	case OutputCSV:
+		rw.csv = csv.NewWriter(w)
+	case OutputTable:
+		rw.table = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	}
+	return rw
+}
+
+// columnar reports whether records are flattened into columns.
+func (rw *RecordWriter) columnar() bool {
+	return rw.csv != nil || rw.table != nil
+}
+
+// Write writes one record.
+func (rw *RecordWriter) Write(record any) error {
+	switch rw.r.format() {
+	case OutputNDJSON:
+		return json.NewEncoder(rw.w).Encode(record)
+	case OutputCSV, OutputTable:
+		row, err := flatten(record)
+		if err != nil {
+			return err
+		}
+		if rw.columns == nil {
+			rw.columns = appendColumns(nil, row)
+		}
+		return rw.writeRow(row)
+	}
+	return fmt.Errorf("%s output is one document, not a stream of records", rw.r.format())
+}
+
+func (rw *RecordWriter) writeRow(row []field) error {
+	if rw.header {
+		if err := rw.writeCells(rw.columns); err != nil {
+			return err
+		}
+		rw.header = false
+	}
+	values := make(map[string]field, len(row))
+	for _, f := range row {
+		values[f.name] = f
+	}
+	cells := make([]string, len(rw.columns))
+	for i, col := range rw.columns {
+		f, ok := values[col]
+		if !ok {
+			continue
+		}
+		var err error
+		if cells[i], err = f.text(rw.r.Vectors); err != nil {
+			return fmt.Errorf("%s column %s: %w", rw.r.format(), col, err)
+		}
+	}
+	return rw.writeCells(cells)
+}
+
+// tableCellReplacer keeps each table cell on its line and in its column.
+var tableCellReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func (rw *RecordWriter) writeCells(cells []string) error {
+	if rw.csv != nil {
+		return rw.csv.Write(cells)
+	}
+	for i, cell := range cells {
+		if i > 0 {
+			if _, err := io.WriteString(rw.table, "\t"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(rw.table, tableCellReplacer.Replace(cell)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(rw.table, "\n")
+	return err
+}
+
+// Flush writes any buffered rows, and the header when no row has been
+// written yet but the columns are known.
+func (rw *RecordWriter) Flush() error {
+	if !rw.columnar() {
+		return nil
+	}
+	if rw.header && len(rw.columns) > 0 {
+		if err := rw.writeCells(rw.columns); err != nil {
+			return err
+		}
+		rw.header = false
+	}
+	if rw.table != nil {
+		return rw.table.Flush()
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+// field is one flattened field of a record: a scalar, in its JSON form
+// except that strings are unquoted, or a vector.
+type field struct {
+	name   string
+	value  string
+	vector []json.Number
+}
+
+func (f field) text(vectors string) (string, error) {
+	if f.vector == nil {
+		return f.value, nil
+	}
+	if vectors != VectorsBase64 {
+		parts := make([]string, len(f.vector))
+		for i, n := range f.vector {
+			parts[i] = n.String()
+		}
+		return strings.Join(parts, ";"), nil
+	}
+	buf := make([]byte, 4*len(f.vector))
+	for i, n := range f.vector {
+		v, err := strconv.ParseFloat(n.String(), 32)
+		if err != nil {
+			return "", err
+		}
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// flatten returns the fields of record as encoding/json marshals it, in
+// order, nested objects joined by dots. A record that is not an object is
+// a single field named "value".
+func flatten(record any) ([]field, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var fields []field
+	if err := flattenJSON("", data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenJSON(name string, raw json.RawMessage, fields *[]field) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return errors.New("empty JSON value")
+	}
+	switch raw[0] {
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		empty := true
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+			key := tok.(string)
+			if name != "" {
+				key = name + "." + key
+			}
+			if err := flattenJSON(key, value, fields); err != nil {
+				return err
+			}
+			empty = false
+		}
+		if empty && name != "" {
+			*fields = append(*fields, field{name: name})
+		}
+		return nil
+	case '[':
+		var numbers []json.Number
+		if err := json.Unmarshal(raw, &numbers); err == nil && len(numbers) > 0 {
+			*fields = append(*fields, field{name: orValue(name), vector: numbers})
+			return nil
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return err
+		}
+		*fields = append(*fields, field{name: orValue(name), value: compact.String()})
+		return nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		*fields = append(*fields, field{name: orValue(name), value: s})
+		return nil
+	case 'n':
+		*fields = append(*fields, field{name: orValue(name)})
+		return nil
+	}
+	*fields = append(*fields, field{name: orValue(name), value: string(raw)})
+	return nil
+}
+
+func orValue(name string) string {
+	if name == "" {
+		return "value"
+	}
+	return name
+}
+
+// appendColumns appends the names of row missing from columns.
+func appendColumns(columns []string, row []field) []string {
+	seen := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		seen[c] = true
+	}
+	for _, f := range row {
+		if !seen[f.name] {
+			seen[f.name] = true
+			columns = append(columns, f.name)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRendererCSVRoundTrips(t *testing.T) {
+	vectors := [][]float32{{1, 0.5, -0.25}, {3.1415927, -1e-7, 0}}
+	records := []any{
+		embedLine{Index: 0, Vector: vectors[0]},
+		embedLine{Index: 1, Vector: vectors[1]},
+	}
+	for _, encoding := range []string{VectorsFloats, VectorsBase64} {
+		var out strings.Builder
+		if err := (Renderer{Format: OutputCSV, Vectors: encoding}).Render(&out, nil, records); err != nil {
+			t.Fatalf("%s: Render: %v", encoding, err)
+		}
+		rows, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: encoding/csv cannot read the output: %v\n%s", encoding, err, out.String())
+		}
+		if len(rows) != 3 || !reflect.DeepEqual(rows[0], []string{"index", "vector"}) {
+			t.Fatalf("%s: rows %q", encoding, rows)
+		}
+		for i, row := range rows[1:] {
+			if row[0] != strconv.Itoa(i) {
+				t.Fatalf("%s: row %d index %q", encoding, i, row[0])
+			}
+			if got := decodeCSVVector(t, encoding, row[1]); !reflect.DeepEqual(got, vectors[i]) {
+				t.Fatalf("%s: row %d vector %v, want %v", encoding, i, got, vectors[i])
+			}
+		}
+	}
+}
+
+func decodeCSVVector(t *testing.T, encoding, cell string) []float32 {
+	t.Helper()
+	var v []float32
+	if encoding == VectorsBase64 {
+		raw, err := base64.StdEncoding.DecodeString(cell)
+		if err != nil || len(raw)%4 != 0 {
+			t.Fatalf("base64 vector %q: %v", cell, err)
+		}
+		for i := 0; i < len(raw); i += 4 {
+			v = append(v, math.Float32frombits(binary.LittleEndian.Uint32(raw[i:])))
+		}
+		return v
+	}
+	for _, part := range strings.Split(cell, ";") {
+		f, err := strconv.ParseFloat(part, 32)
+		if err != nil {
+			t.Fatalf("float vector %q: %v", cell, err)
+		}
+		v = append(v, float32(f))
+	}
+	return v
+}
+
+func TestRendererFlattensRecords(t *testing.T) {
+	type record struct {
+		Name    string          `json:"name"`
+		Session Session         `json:"session"`
+		Tags    []string        `json:"tags,omitempty"`
+		Raw     json.RawMessage `json:"raw"`
+	}
+	records := []any{
+		record{Name: "a, \"quoted\"", Session: Session{ID: "s1"}, Raw: json.RawMessage(`{"ok":true}`)},
+		record{Name: "b\nline", Tags: []string{"x", "y"}, Raw: json.RawMessage(`null`)},
+	}
+	var out strings.Builder
+	if err := (Renderer{Format: OutputCSV}).Render(&out, nil, records); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("encoding/csv: %v\n%s", err, out.String())
+	}
+	header := rows[0]
+	col := func(name string) int {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+		t.Fatalf("no column %q in %q", name, header)
+		return -1
+	}
+	if header[0] != "name" || rows[1][col("session.id")] != "s1" || rows[1][col("raw.ok")] != "true" {
+		t.Fatalf("rows %q", rows)
+	}
+	// A field only the second record has still gets a column.
+	if rows[1][col("name")] != `a, "quoted"` || rows[2][col("name")] != "b\nline" || rows[2][col("tags")] != `["x","y"]` || rows[1][col("tags")] != "" {
+		t.Fatalf("rows %q", rows)
+	}
+
+	out.Reset()
+	if err := (Renderer{Format: OutputCSV, Columns: []string{"session.id", "name", "missing"}}).Render(&out, nil, records[:1]); err != nil {
+		t.Fatalf("Render with columns: %v", err)
+	}
+	if want := "session.id,name,missing\ns1,\"a, \"\"quoted\"\"\",\n"; out.String() != want {
+		t.Fatalf("selected columns %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := (Renderer{Format: OutputCSV, Columns: []string{"name"}}).Render(&out, nil, nil); err != nil || out.String() != "name\n" {
+		t.Fatalf("no records wrote %q (%v), want the header", out.String(), err)
+	}
+}
+
+func TestRendererJSONFormats(t *testing.T) {
+	records := []any{ModelInfo{Name: "a", Dimension: 2}, ModelInfo{Name: "b", Dimension: 3}}
+	var out strings.Builder
+	if err := (Renderer{Format: OutputNDJSON}).Render(&out, "ignored", records); err != nil {
+		t.Fatalf("Render ndjson: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("ndjson %q, want a line per record", out.String())
+	}
+	var m ModelInfo
+	if err := json.Unmarshal([]byte(lines[1]), &m); err != nil || m.Name != "b" {
+		t.Fatalf("ndjson line %s (%v)", lines[1], err)
+	}
+
+	out.Reset()
+	if err := (Renderer{}).Render(&out, records, nil); err != nil {
+		t.Fatalf("Render json: %v", err)
+	}
+	var doc []ModelInfo
+	if err := json.Unmarshal([]byte(out.String()), &doc); err != nil || len(doc) != 2 {
+		t.Fatalf("json %s (%v)", out.String(), err)
+	}
+
+	for _, r := range []Renderer{{Format: "xml"}, {Format: OutputCSV, Vectors: "hex"}} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v validated", r)
+		}
+	}
+	if err := (Renderer{}).NewRecordWriter(&out).Write(records[0]); err == nil {
+		t.Error("a json record writer streamed records")
+	}
+}
+
+func TestRendererTable(t *testing.T) {
+	records := []any{
+		ModelInfo{Name: "small", Dimension: 384, MaxInputTokens: 512},
+		ModelInfo{Name: "a-much-longer-name", Dimension: 3072},
+	}
+	var out strings.Builder
+	r := Renderer{Format: OutputTable, Columns: []string{"name", "dimension", "max_input_tokens"}}
+	if err := r.Render(&out, nil, records); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "name                dimension  max_input_tokens\n" +
+		"small               384        512\n" +
+		"a-much-longer-name  3072       \n"
+	if out.String() != want {
+		t.Fatalf("table\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := (Renderer{Format: OutputTable}).Render(&out, nil, []any{map[string]string{"note": "two\tcells\non two lines"}}); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := "note\ntwo cells on two lines\n"; out.String() != want {
+		t.Fatalf("table %q, want %q", out.String(), want)
+	}
+}
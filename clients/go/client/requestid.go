@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"log/slog"
+	"time"
+)
+
+// RequestIDHeader carries the request ID over the http, tls, http3, and
+// grpc transports, and the server's own ID on their responses. The other
+// transports send it as meta.request_id.
+const RequestIDHeader = "X-Request-Id"
+
+// requestIDKey carries the request ID of a call.
+type requestIDKey struct{}
+
+// WithRequestID returns ctx making the calls made with it use id as their
+// request ID instead of a generated ULID. The ID is sent with the request
+// and appears in the client's log records, transcripts, trace spans, and
+// APIError.RequestID, so a failure can be found in the server's logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by WithRequestID or, in
+// an Interceptor, the one of the request under way.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID returns the request ID of a call made with ctx and ctx carrying
+// it, generating one unless the caller supplied it.
+func requestID(ctx context.Context, now time.Time) (context.Context, string) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return ctx, id
+	}
+	id := newULID(now)
+	return WithRequestID(ctx, id), id
+}
+
+// crockford is the base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: 48 bits of milliseconds since the epoch and 80
+// random bits, in 26 characters of Crockford base32, so IDs sort by time.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// serverRequestID returns the server's own ID for the request resp answers:
+// the X-Request-Id header of an http response, or its meta.request_id.
+func serverRequestID(resp *Response) string {
+	if resp == nil {
+		return ""
+	}
+	if resp.ServerRequestID != "" {
+		return resp.ServerRequestID
+	}
+	if resp.Meta != nil {
+		return resp.Meta.RequestID
+	}
+	return ""
+}
+
+// CaptureServerRequestID stores in dst the server's own ID for the call's
+// request, when it gives one: the X-Request-Id header of an http response,
+// or the response's meta.request_id. Failed calls carry it as
+// APIError.ServerRequestID.
+func CaptureServerRequestID(dst *string) CallOption {
+	return func(o *callOptions) { o.serverRequestID = dst }
+}
+
+// requestIDHandler adds the request ID of the ctx of each record to it.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
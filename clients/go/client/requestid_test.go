@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDHTTP(t *testing.T) {
+	type seen struct{ header, meta string }
+	var requests []seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		requests = append(requests, seen{r.Header.Get(RequestIDHeader), req.Meta.RequestID})
+		w.Header().Set(RequestIDHeader, "srv-1")
+		if req.Method == "test.fail" {
+			http.Error(w, "nope", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(defaultHandler(&req))
+	}))
+	defer srv.Close()
+	var logs strings.Builder
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{
+		Transport: TransportHTTP,
+		Endpoint:  srv.URL,
+		Logger:    slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Recorder:  sink,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	var serverID string
+	if err := c.Call(WithRequestID(context.Background(), "mine"), MethodPing, nil, nil, CaptureServerRequestID(&serverID)); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if requests[0] != (seen{"mine", "mine"}) || serverID != "srv-1" {
+		t.Fatalf("sent %+v, captured server ID %q", requests[0], serverID)
+	}
+	if !strings.Contains(logs.String(), "request_id=mine") {
+		t.Fatalf("log records miss the request ID:\n%s", logs.String())
+	}
+	if !strings.Contains(string(sink.entries[0].Message), `"request_id":"mine"`) {
+		t.Fatalf("transcript entry misses the request ID: %s", sink.entries[0].Message)
+	}
+
+	err = c.Call(context.Background(), "test.fail", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	generated := requests[1].header
+	if len(generated) != 26 || requests[1].meta != generated || apiErr.RequestID != generated || apiErr.ServerRequestID != "srv-1" {
+		t.Fatalf("sent %+v, error carries %q and %q", requests[1], apiErr.RequestID, apiErr.ServerRequestID)
+	}
+	if !strings.Contains(err.Error(), "(request "+generated+")") {
+		t.Fatalf("error %q does not name the request ID", err)
+	}
+}
+
+func TestRequestIDMeta(t *testing.T) {
+	var sent []string
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(func(req *Request) *Response {
+		sent = append(sent, req.Meta.RequestID)
+		resp := defaultHandler(req)
+		resp.Meta = &Meta{RequestID: "srv-" + req.Meta.RequestID}
+		return resp
+	})})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	var serverID string
+	if err := c.Call(WithRequestID(context.Background(), "mine"), MethodPing, nil, nil, CaptureServerRequestID(&serverID)); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if len(sent) != 1 || sent[0] != "mine" || serverID != "srv-mine" {
+		t.Fatalf("sent %q, captured server ID %q", sent, serverID)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	base := time.UnixMilli(1700000000000)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id := newULID(base.Add(time.Duration(i) * time.Millisecond))
+		if len(id) != 26 || strings.Trim(id, crockford) != "" {
+			t.Fatalf("malformed ULID %q", id)
+		}
+		ids = append(ids, id)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("ULIDs do not sort by time: %q", ids)
+	}
+	// The timestamp is the first 10 characters.
+	if ids[0][:10] != "01HF7YAT00" {
+		t.Fatalf("ULID %q encodes the wrong time", ids[0])
+	}
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrRequestTooLarge reports a request whose encoded params exceed
+// ClientConfig.MaxRequestBytes or the limit of WithMaxRequestBytes. It is
+// raised before the request is sent, and matches ErrPayloadTooLarge.
+var ErrRequestTooLarge error = &classError{"request exceeds maximum size", ErrPayloadTooLarge}
+
+// WithMaxRequestBytes bounds the encoded params of each request of one
+// call to n bytes, overriding ClientConfig.MaxRequestBytes. A chunk of
+// EmbedBatch over the limit fails with ErrRequestTooLarge unsent, and
+// with WithPartialResults fails alone, so one oversized document costs
+// only its chunk.
+func WithMaxRequestBytes(n int) EmbedOption {
+	return func(o *embedOptions) {
+		overrideCall(o, "WithMaxRequestBytes", &o.maxRequestBytes, n)
+		o.alone = true
+	}
+}
+
+// requestLimit is the limit applying to the requests sent with ctx: that
+// of the call's RequestOptions, or ClientConfig.MaxRequestBytes. Zero
+// means none.
+func (c *Client) requestLimit(ctx context.Context) int {
+	if o, ok := ctx.Value(requestOptionsKey{}).(*RequestOptions); ok {
+		return o.MaxRequestBytes
+	}
+	return c.cfg.MaxRequestBytes
+}
+
+// checkRequestSize fails req, unsent, when its params exceed the limit of
+// ctx, counting it in Stats.RequestsTooLarge.
+func (c *Client) checkRequestSize(ctx context.Context, req *Request) error {
+	limit := c.requestLimit(ctx)
+	if limit <= 0 || requestBytes(req) <= limit {
+		return nil
+	}
+	c.metrics.stats.requestTooLarge()
+	return fmt.Errorf("%w: %d bytes, limit %d", ErrRequestTooLarge, requestBytes(req), limit)
+}
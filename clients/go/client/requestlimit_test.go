@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxRequestBytes(t *testing.T) {
+	var embeds atomic.Int64
+	cfg := ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		if req.Method == MethodEmbed {
+			embeds.Add(1)
+		}
+		return *defaultHandler(&req), nil
+	}}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+
+	// The oversized document fails its chunk alone, unsent.
+	texts := []string{"a", strings.Repeat("x", 500), "b"}
+	var info EmbedInfo
+	vectors, err := c.EmbedBatch(ctx, texts, WithBatchSize(1), WithPartialResults(), WithMaxRequestBytes(200), WithEmbedInfo(&info))
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Start != 1 || !errors.Is(err, ErrRequestTooLarge) || !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if !strings.Contains(err.Error(), "limit 200") {
+		t.Fatalf("error %q does not name the limit", err)
+	}
+	if vectors[0] == nil || vectors[1] != nil || vectors[2] == nil || embeds.Load() != 2 {
+		t.Fatalf("vectors %v after %d requests", vectors, embeds.Load())
+	}
+
+	// The call's bytes are those the client counts, as it made no other.
+	st := c.Stats()
+	if st.RequestsTooLarge != 1 || info.RequestBytes == 0 || info.RequestBytes != st.BytesSent || info.ResponseBytes != st.BytesReceived {
+		t.Fatalf("info %+v, stats %+v", info, st)
+	}
+
+	// Without partial results the call fails.
+	if _, err := c.EmbedBatch(ctx, texts, WithMaxRequestBytes(200)); !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("EmbedBatch without partial results: %v", err)
+	}
+	if _, err := c.Embed(ctx, "a", WithMaxRequestBytes(0)); err == nil {
+		t.Fatal("WithMaxRequestBytes(0) accepted")
+	}
+}
+
+func TestMaxRequestBytesConfig(t *testing.T) {
+	rec := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), MaxRequestBytes: 100, Recorder: rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	long := strings.Repeat("x", 200)
+
+	if _, err := c.Embed(ctx, "a"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, err := c.Embed(ctx, long); !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("Embed over the limit: %v", err)
+	}
+	// A call's limit replaces the configured one, and is recorded.
+	if _, err := c.Embed(ctx, long, WithMaxRequestBytes(1000)); err != nil {
+		t.Fatalf("Embed with a raised limit: %v", err)
+	}
+	var recorded bool
+	for _, e := range rec.entries {
+		if e.Direction == DirectionRequest && e.Options != nil {
+			data, _ := json.Marshal(e.Options)
+			recorded = strings.Contains(string(data), `"max_request_bytes":1000`)
+		}
+	}
+	if !recorded {
+		t.Fatalf("recorded %+v", rec.entries)
+	}
+	if _, err := c.EmbedStream(ctx, []string{long}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("EmbedStream over the limit: %v", err)
+	}
+	if st := c.Stats(); st.RequestsTooLarge != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	if _, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), MaxRequestBytes: -1}); err == nil {
+		t.Fatal("a negative MaxRequestBytes was accepted")
+	}
+}
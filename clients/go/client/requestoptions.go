@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Priority ranks a call against the other calls of its client; see
+// WithPriority. The zero value is PriorityNormal.
+type Priority int
+
+// The priorities, lowest first.
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{PriorityLow: "low", PriorityNormal: "normal", PriorityHigh: "high"}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// MarshalText encodes p as "low", "normal", or "high".
+func (p Priority) MarshalText() ([]byte, error) {
+	name, ok := priorityNames[p]
+	if !ok {
+		return nil, fmt.Errorf("invalid priority %d", int(p))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes "low", "normal", or "high".
+func (p *Priority) UnmarshalText(b []byte) error {
+	for q, name := range priorityNames {
+		if strings.EqualFold(string(b), name) {
+			*p = q
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown priority %q", b)
+}
+
+// RequestOptions are the effective per-call options of the requests of an
+// Embed or EmbedBatch call given any of WithModel, WithCallTimeout,
+// WithNoRetry, WithPriority, and WithMaxRequestBytes: the values the call set and the client's
+// defaults for the rest. Interceptors read them with Request.Options, and
+// the transcript records them on each request entry as "options".
+type RequestOptions struct {
+	Model string
+	// Timeout bounds the call, retries included; zero means none.
+	Timeout time.Duration
+	// MaxAttempts is how many attempts each request may make: that of
+	// ClientConfig.Retry, at least 1, or 1 with WithNoRetry.
+	MaxAttempts int
+	Priority    Priority
+	// MaxRequestBytes bounds the encoded params of each request, that of
+	// WithMaxRequestBytes or ClientConfig.MaxRequestBytes; zero means none.
+	MaxRequestBytes int
+
+	// alone keeps the call's requests its own: they are neither coalesced
+	// nor shared with other calls, which send with other options.
+	alone bool
+}
+
+// requestOptionsJSON is RequestOptions as the transcript records it.
+type requestOptionsJSON struct {
+	Model           string   `json:"model,omitempty"`
+	TimeoutMS       float64  `json:"timeout_ms,omitempty"`
+	MaxAttempts     int      `json:"max_attempts,omitempty"`
+	Priority        Priority `json:"priority"`
+	MaxRequestBytes int      `json:"max_request_bytes,omitempty"`
+}
+
+func (o RequestOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(requestOptionsJSON{
+		Model:           o.Model,
+		TimeoutMS:       float64(o.Timeout.Microseconds()) / 1000,
+		MaxAttempts:     o.MaxAttempts,
+		Priority:        o.Priority,
+		MaxRequestBytes: o.MaxRequestBytes,
+	})
+}
+
+func (o *RequestOptions) UnmarshalJSON(data []byte) error {
+	var w requestOptionsJSON
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*o = RequestOptions{
+		Model:           w.Model,
+		Timeout:         time.Duration(w.TimeoutMS * float64(time.Millisecond)),
+		MaxAttempts:     w.MaxAttempts,
+		Priority:        w.Priority,
+		MaxRequestBytes: w.MaxRequestBytes,
+	}
+	return nil
+}
+
+// Options returns the effective per-call options of the call req was sent
+// by, and whether it set any; see RequestOptions.
+func (r *Request) Options() (RequestOptions, bool) {
+	if r.options == nil {
+		return RequestOptions{}, false
+	}
+	o := *r.options
+	o.alone = false
+	return o, true
+}
+
+// requestOptionsKey carries the *RequestOptions of a call to send.
+type requestOptionsKey struct{}
+
+// sendsAlone reports whether the call of ctx keeps its requests to itself;
+// see RequestOptions.
+func sendsAlone(ctx context.Context) bool {
+	o, ok := ctx.Value(requestOptionsKey{}).(*RequestOptions)
+	return ok && o.alone
+}
+
+// WithCallTimeout bounds one call, retries included, to d, as a deadline
+// on its ctx would. The client's ReadTimeout and WriteTimeout still bound
+// each phase of each request.
+func WithCallTimeout(d time.Duration) EmbedOption {
+	return func(o *embedOptions) {
+		overrideCall(o, "WithCallTimeout", &o.timeout, d)
+		o.alone = true
+	}
+}
+
+// WithNoRetry sends each request of one call once, whatever
+// ClientConfig.Retry says.
+func WithNoRetry() EmbedOption {
+	return func(o *embedOptions) {
+		overrideCall(o, "WithNoRetry", &o.noRetry, true)
+		o.alone = true
+	}
+}
+
+// WithPriority ranks one call against the others of its client waiting for
+// a ClientConfig.MaxInFlight slot; see SchedulingPolicy.
+func WithPriority(p Priority) EmbedOption {
+	return func(o *embedOptions) {
+		overrideCall(o, "WithPriority", &o.priority, p)
+		o.alone = true
+	}
+}
+
+// overrideCall sets the field of the per-call option name to v, noting a
+// conflict when the call set it to another value before.
+func overrideCall[T comparable](o *embedOptions, name string, field *T, v T) {
+	if o.overrides == nil {
+		o.overrides = make(map[string]bool)
+	}
+	if o.overrides[name] && *field != v && !slices.Contains(o.conflicts, name) {
+		o.conflicts = append(o.conflicts, name)
+	}
+	o.overrides[name] = true
+	*field = v
+}
+
+// planCall returns ctx carrying the effective values of the per-call
+// options of o, checked by checkEmbed, bounded by WithCallTimeout, along
+// with its cancel function. A call setting none gets ctx itself.
+func (c *Client) planCall(ctx context.Context, o *embedOptions) (context.Context, context.CancelFunc) {
+	if len(o.overrides) == 0 {
+		return ctx, func() {}
+	}
+	ro := &RequestOptions{Model: o.model, Timeout: o.timeout, MaxAttempts: max(c.cfg.Retry.MaxAttempts, 1), Priority: o.priority, alone: o.alone}
+	if o.noRetry {
+		ro.MaxAttempts = 1
+	}
+	ro.MaxRequestBytes = c.cfg.MaxRequestBytes
+	if o.maxRequestBytes > 0 {
+		ro.MaxRequestBytes = o.maxRequestBytes
+	}
+	ctx = context.WithValue(ctx, requestOptionsKey{}, ro)
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return ctx, func() {}
+}
+
+// optionsRecorder adds the effective per-call options of a request to its
+// entries.
+type optionsRecorder struct {
+	Recorder
+	options *RequestOptions
+}
+
+func (r optionsRecorder) Record(entry Entry) {
+	if entry.Direction == DirectionRequest {
+		entry.Options = r.options
+	}
+	r.Recorder.Record(entry)
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestOptionsReachInterceptors(t *testing.T) {
+	var seen []RequestOptions
+	var set []bool
+	sink := &recordingSink{}
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler:   inprocHandler(defaultHandler),
+		Retry:     RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		Recorder:  sink,
+		Interceptors: []Interceptor{func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+			// EmbedBatch asks for the server's capabilities with the
+			// options of the call too.
+			if req.Method == MethodEmbed {
+				o, ok := req.Options()
+				seen, set = append(seen, o), append(set, ok)
+			}
+			return next(ctx, req)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+
+	if _, err := c.Embed(ctx, "defaults"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, err := c.Embed(ctx, "query", WithModel("text-embedding-3-small"), WithCallTimeout(time.Second), WithNoRetry(), WithPriority(PriorityHigh)); err != nil {
+		t.Fatalf("Embed with options: %v", err)
+	}
+	if _, err := c.EmbedBatch(ctx, []string{"bulk"}, WithPriority(PriorityLow)); err != nil {
+		t.Fatalf("EmbedBatch with options: %v", err)
+	}
+	if len(seen) != 3 || set[0] {
+		t.Fatalf("interceptor saw %v %v, want no options on the first call", seen, set)
+	}
+	want := RequestOptions{Model: "text-embedding-3-small", Timeout: time.Second, MaxAttempts: 1, Priority: PriorityHigh}
+	if !set[1] || seen[1] != want {
+		t.Fatalf("interceptor saw %+v, want %+v", seen[1], want)
+	}
+	// The client's defaults fill in what the call leaves unset.
+	want = RequestOptions{Model: DefaultModel, MaxAttempts: 3, Priority: PriorityLow}
+	if !set[2] || seen[2] != want {
+		t.Fatalf("interceptor saw %+v, want %+v", seen[2], want)
+	}
+
+	var recorded []string
+	for _, e := range sink.entries {
+		if e.Direction != DirectionRequest || !strings.Contains(string(e.Message), MethodEmbed) {
+			continue
+		}
+		raw, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var back Entry
+		if err := json.Unmarshal(raw, &back); err != nil {
+			t.Fatalf("Unmarshal %s: %v", raw, err)
+		}
+		if (back.Options == nil) != (e.Options == nil) || back.Options != nil && *back.Options != *e.Options {
+			t.Fatalf("options %s reloaded as %+v", raw, back.Options)
+		}
+		opts, _ := json.Marshal(e.Options)
+		recorded = append(recorded, string(opts))
+	}
+	wantRecorded := []string{
+		"null",
+		`{"model":"text-embedding-3-small","timeout_ms":1000,"max_attempts":1,"priority":"high"}`,
+		`{"model":"` + DefaultModel + `","max_attempts":3,"priority":"low"}`,
+	}
+	if strings.Join(recorded, "\n") != strings.Join(wantRecorded, "\n") {
+		t.Fatalf("recorded options:\n%s\nwant:\n%s", strings.Join(recorded, "\n"), strings.Join(wantRecorded, "\n"))
+	}
+}
+
+func TestWithNoRetry(t *testing.T) {
+	var calls atomic.Int32
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: func(req Request) (Response, error) {
+			calls.Add(1)
+			return Response{}, &RPCError{Code: -32050, Message: "warming up", Data: []byte(`{"retryable":true}`)}
+		},
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "bulk"); err == nil || calls.Load() != 3 {
+		t.Fatalf("Embed: %v after %d attempts, want a failure after 3", err, calls.Load())
+	}
+	calls.Store(0)
+	if _, err := c.Embed(ctx, "query", WithNoRetry()); err == nil || calls.Load() != 1 {
+		t.Fatalf("Embed WithNoRetry: %v after %d attempts, want a failure after 1", err, calls.Load())
+	}
+}
+
+func TestWithCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: inprocHandler(func(req *Request) *Response {
+			if req.Method == MethodEmbed && strings.Contains(string(req.Params), "slow") {
+				<-release
+			}
+			return defaultHandler(req)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	start := time.Now()
+	_, err = c.Embed(context.Background(), "slow", WithCallTimeout(20*time.Millisecond))
+	close(release)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Embed: %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Embed returned after %s", elapsed)
+	}
+	// The timeout bounded that call alone.
+	if _, err := c.Embed(context.Background(), "fast"); err != nil {
+		t.Fatalf("Embed after the timeout: %v", err)
+	}
+}
+
+func TestInvalidRequestOptions(t *testing.T) {
+	var calls atomic.Int32
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: inprocHandler(func(req *Request) *Response {
+			calls.Add(1)
+			return defaultHandler(req)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	for name, opts := range map[string][]EmbedOption{
+		"zero timeout":           {WithCallTimeout(0)},
+		"negative timeout":       {WithCallTimeout(-time.Second)},
+		"unknown priority":       {WithPriority(Priority(7))},
+		"empty model":            {WithModel("")},
+		"conflicting priority":   {WithPriority(PriorityHigh), WithPriority(PriorityLow)},
+		"conflicting models":     {WithModel("a"), WithModel("b")},
+		"conflicting timeouts":   {WithCallTimeout(time.Second), WithCallTimeout(time.Minute)},
+		"several faults at once": {WithCallTimeout(0), WithPriority(Priority(-2))},
+	} {
+		if _, err := c.Embed(context.Background(), "x", opts...); err == nil {
+			t.Errorf("%s: Embed succeeded", name)
+		}
+		if _, err := c.EmbedBatch(context.Background(), []string{"x"}, opts...); err == nil {
+			t.Errorf("%s: EmbedBatch succeeded", name)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("%d requests reached the server", n)
+	}
+	// Repeating an option with the same value is no conflict.
+	if _, err := c.Embed(context.Background(), "x", WithPriority(PriorityHigh), WithPriority(PriorityHigh)); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+}
+
+func TestPriorityText(t *testing.T) {
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%d): %v", p, err)
+		}
+		var back Priority
+		if err := back.UnmarshalText(text); err != nil || back != p {
+			t.Fatalf("%s reloaded as %v, %v", text, back, err)
+		}
+	}
+	if _, err := Priority(3).MarshalText(); err == nil {
+		t.Fatal("MarshalText of an unknown priority succeeded")
+	}
+	var p Priority
+	if err := p.UnmarshalText([]byte("urgent")); err == nil {
+		t.Fatal(`UnmarshalText("urgent") succeeded`)
+	}
+}
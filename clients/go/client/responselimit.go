@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxResponseBytes bounds a response when ClientConfig leaves
+// MaxResponseBytes unset.
+const DefaultMaxResponseBytes = 64 << 20
+
+// ErrResponseTooLarge reports a response longer than
+// ClientConfig.MaxResponseBytes or the limit of WithMaxResponseBytes. It is
+// raised before more than the limit is buffered, and matches
+// ErrPayloadTooLarge.
+var ErrResponseTooLarge error = &classError{"response exceeds maximum size", ErrPayloadTooLarge}
+
+// WithMaxResponseBytes raises or lowers the response size limit for one
+// call, such as one fetching a large job result; n <= 0 keeps the
+// configured limit. Over stdio and unix each frame is still bounded by
+// ClientConfig.MaxFrameSize.
+func WithMaxResponseBytes(n int) CallOption {
+	return func(o *callOptions) { o.maxResponseBytes = n }
+}
+
+// maxResponseKey carries the limit of WithMaxResponseBytes to the
+// transport.
+type maxResponseKey struct{}
+
+// responseLimit is the limit applying to the response to a request sent
+// with ctx, where configured is the transport's ClientConfig.MaxResponseBytes.
+func responseLimit(ctx context.Context, configured int) int64 {
+	if n, ok := ctx.Value(maxResponseKey{}).(int); ok && n > 0 {
+		return int64(n)
+	}
+	if configured <= 0 {
+		return DefaultMaxResponseBytes
+	}
+	return int64(configured)
+}
+
+func responseTooLarge(read, limit int64) error {
+	return fmt.Errorf("%w: %d bytes read, limit %d", ErrResponseTooLarge, read, limit)
+}
+
+// readLimited reads all of r, failing with ErrResponseTooLarge once it
+// yields more than limit bytes. What was read is returned either way.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	payload, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(payload)) > limit {
+		return payload, responseTooLarge(int64(len(payload)), limit)
+	}
+	return payload, err
+}
+
+// frameBudget tracks the frames of a streamed response against its limit:
+// each is bounded by the frame size and by what is left of the limit.
+type frameBudget struct {
+	limit, used int64
+}
+
+// read reads the next frame of the response from r, bounded by f and by
+// what is left of the budget.
+func (b *frameBudget) read(r *bufio.Reader, f framing) ([]byte, error) {
+	bounded := f
+	if rest := b.limit - b.used; rest < int64(f.maxSize) {
+		bounded.maxSize = int(max(rest, 0))
+	}
+	payload, err := bounded.read(r)
+	if errors.Is(err, ErrFrameTooLarge) && bounded.maxSize < f.maxSize {
+		return nil, responseTooLarge(b.used+int64(bounded.maxSize)+1, b.limit)
+	}
+	b.used += int64(len(payload))
+	return payload, err
+}
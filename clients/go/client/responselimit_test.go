@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bigHandler answers test.big with a result of about 4 KiB.
+func bigHandler(req *Request) *Response {
+	if req.Method != "test.big" {
+		return defaultHandler(req)
+	}
+	raw, _ := json.Marshal(strings.Repeat("x", 4096))
+	return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(bigHandler))
+	defer srv.Close()
+	configs := map[string]ClientConfig{
+		"http": {Transport: TransportHTTP, Endpoint: srv.URL},
+		"inproc": {Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+			return *bigHandler(&req), nil
+		}},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			cfg.MaxResponseBytes = 1024
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+
+			err = c.Call(context.Background(), "test.big", nil, nil)
+			if !errors.Is(err, ErrResponseTooLarge) || !errors.Is(err, ErrPayloadTooLarge) || !strings.Contains(err.Error(), "limit 1024") {
+				t.Fatalf("oversized response: got %v, want ErrResponseTooLarge naming the limit", err)
+			}
+			var big string
+			if err := c.Call(context.Background(), "test.big", nil, &big, WithMaxResponseBytes(1<<20)); err != nil || len(big) != 4096 {
+				t.Fatalf("Call with a raised limit: %d bytes, %v", len(big), err)
+			}
+			if _, err := c.Embed(context.Background(), "small"); err != nil {
+				t.Fatalf("Embed after an oversized response: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxResponseBytesStream(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	configs := map[string]ClientConfig{
+		"stdio": {Command: helperCommand(t)},
+		"http":  {Transport: TransportHTTP, Endpoint: srv.URL},
+	}
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff"}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			// Room for a few frames, not for all of them.
+			cfg.MaxResponseBytes = 250
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			ch, err := c.EmbedStream(context.Background(), texts)
+			if err != nil {
+				t.Fatalf("EmbedStream: %v", err)
+			}
+			results := collect(t, ch)
+			last := results[len(results)-1]
+			if len(results) < 2 || len(results) > len(texts) || last.Index != -1 || !errors.Is(last.Err, ErrResponseTooLarge) {
+				t.Fatalf("results %+v, want some frames then ErrResponseTooLarge", results)
+			}
+			if _, err := c.Embed(context.Background(), "after"); err != nil {
+				t.Fatalf("Embed after an oversized stream: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DecodeResult decodes result, the result of a response to method, into
+// the type the client decodes it into, for tests holding the client to
+// recorded responses: the handshake into *InitializeResult, an embed into
+// its embeddings with their vectors decoded from any encoding, and so on.
+// The result of a method the client has no type for decodes as generic
+// JSON. Either kind marshals back to JSON showing what the client read.
+// Embed results and stream frames are verified against the checksums they
+// carry, as the client verifies them, so a recorded response corrupted
+// since fails with ErrChecksumMismatch.
+func DecodeResult(method string, result json.RawMessage) (any, error) {
+	var v any
+	switch method {
+	case MethodInitialize:
+		v = new(InitializeResult)
+	case MethodEmbed:
+		v = new(embedResult)
+	case MethodEmbedStream:
+		v = new(embedFrame)
+	case MethodListModels:
+		v = new(listModelsResult)
+	case MethodJobStatus:
+		v = new(JobStatus)
+	case MethodJobResults:
+		v = new(JobPage)
+	default:
+		v = new(any)
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return nil, fmt.Errorf("%s: decode result: %w: %w", method, ErrProtocol, err)
+	}
+	var err error
+	switch r := v.(type) {
+	case *embedResult:
+		err = r.verifyChecksums(false)
+	case *embedFrame:
+		err = r.verifyChecksum(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
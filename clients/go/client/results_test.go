@@ -0,0 +1,29 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecodeResult(t *testing.T) {
+	v, err := DecodeResult(MethodEmbed, json.RawMessage(`{"model":"m","encoding_format":"base64","embeddings":[{"index":0,"vector":"AACAPwAAAMA="}]}`))
+	if err != nil {
+		t.Fatalf("DecodeResult: %v", err)
+	}
+	if r, ok := v.(*embedResult); !ok || len(r.Embeddings) != 1 || r.Embeddings[0].Vector[1] != -2 {
+		t.Fatalf("decoded %#v", v)
+	}
+	v, err = DecodeResult(MethodInitialize, json.RawMessage(`{"session":{"id":"s"},"protocol_version":"2"}`))
+	if r, ok := v.(*InitializeResult); err != nil || !ok || r.Session.ID != "s" || r.ProtocolVersion != "2" {
+		t.Fatalf("decoded %#v, %v", v, err)
+	}
+	// A method without a type of its own decodes as generic JSON.
+	v, err = DecodeResult("x.custom", json.RawMessage(`{"a":[1]}`))
+	if raw, _ := json.Marshal(v); err != nil || string(raw) != `{"a":[1]}` {
+		t.Fatalf("decoded %s, %v", raw, err)
+	}
+	if _, err := DecodeResult(MethodEmbed, json.RawMessage(`{"embeddings":{}}`)); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("malformed result: %v", err)
+	}
+}
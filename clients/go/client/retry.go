@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Retry defaults applied when a RetryPolicy leaves a delay unset.
+const (
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+)
+
+// RetryPolicy retries calls that failed with a transient error. Only
+// idempotent methods (the handshake, ping, capabilities, and embed) are
+// retried, and only after connection failures, 429 and 5xx responses, and
+// API errors the server marked Retryable.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts per call, including the first. Zero or
+	// one disables retries.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the full-jitter backoff: the wait before
+	// retry n is uniformly random in [0, min(MaxDelay, BaseDelay*2^(n-1))).
+	// A Retry-After header from the server replaces the computed wait. Zero
+	// selects DefaultRetryBaseDelay and DefaultRetryMaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// OnRetry, when set, is called before each retry with the number of the
+	// attempt that failed and its error.
+	OnRetry func(attempt int, err error)
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.BaseDelay == 0 {
+		p.BaseDelay = DefaultRetryBaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = DefaultRetryMaxDelay
+	}
+	return p
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return errors.New("retry settings must not be negative")
+	}
+	return nil
+}
+
+// backoff returns the wait before the retry that follows failed attempt n.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	ceiling := p.MaxDelay
+	if n <= 32 {
+		if d := p.BaseDelay << (n - 1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// retryable reports whether req, which failed with err, may be attempted
+// again.
+func retryable(ctx context.Context, req *Request, err error) bool {
+	if !replayable(req) || ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+	// Misconfiguration looks like a connection failure but will not clear up
+	// on its own.
+	for _, target := range []error{ErrUnixUnsupported, ErrTLSHandshake, ErrClientCertRejected, ErrCertPinMismatch} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	var execErr *exec.Error
+	var pathErr *fs.PathError
+	if errors.As(err, &execErr) || errors.As(err, &pathErr) {
+		return false
+	}
+	return isConnectionError(err)
+}
+
+// interceptRetry is the Interceptor applying ClientConfig.Retry. It sends
+// each request until it succeeds, fails permanently, or the policy or ctx
+// runs out; every retry goes out under a fresh request ID but the same
+// idempotency key. A wait that would outlast the ctx deadline is not
+// started.
+func (c *Client) interceptRetry(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	p := c.cfg.Retry
+	if o, ok := req.Options(); ok {
+		p.MaxAttempts = o.MaxAttempts
+	}
+	for n := 1; ; n++ {
+		resp, err := next(context.WithValue(ctx, retryAttemptKey{}, n), req)
+		failure := callError(resp, err)
+		if failure == nil || n >= p.MaxAttempts || !retryable(ctx, req, failure) {
+			return resp, err
+		}
+		wait := p.backoff(n, failure)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		if r, ok := ctx.Value(budgetRunKey{}).(*budgetRun); ok && !r.fits(wait) {
+			c.log.DebugContext(ctx, "retry does not fit the latency budget", "method", req.Method, "rpc_id", req.ID, "attempt", n, "wait", wait)
+			return resp, err
+		}
+		c.metrics.retried(req.Method)
+		if w, ok := ctx.Value(slowWatchKey{}).(*slowWatch); ok {
+			w.retried.Store(true)
+		}
+		if p.OnRetry != nil || c.events.listener != nil {
+			retryErr := fmt.Errorf("%s: %w", req.Method, failure)
+			c.events.retry(n, retryErr)
+			if p.OnRetry != nil {
+				p.OnRetry(n, retryErr)
+			}
+		}
+		c.log.WarnContext(ctx, "retrying request", "method", req.Method, "rpc_id", req.ID, "attempt", n, "wait", wait, "error", failure)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (retry abandoned: %w)", failure, ctx.Err())
+		}
+		req = c.renumber(req)
+	}
+}
+
+// renumber returns a copy of req under the next request ID.
+func (c *Client) renumber(req *Request) *Request {
+	out := *req
+	out.ID = c.nextID.Add(1)
+	if req.Meta != nil {
+		meta := *req.Meta
+		meta.Sequence, meta.Timestamp = out.ID, c.now().UTC().Format(time.RFC3339)
+		out.Meta = &meta
+	}
+	return &out
+}
+
+// parseRetryAfter decodes a Retry-After header given in seconds or as an HTTP
+// date, returning 0 when it is absent or malformed.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
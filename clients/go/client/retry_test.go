@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, then serves
+// defaultHandler.
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			http.Error(w, "busy", status)
+			return
+		}
+		ok.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	var attempts []int
+	c, err := NewClient("",
+		WithConfig(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL}),
+		WithRetry(3, time.Millisecond, 5*time.Millisecond),
+		WithOnRetry(func(attempt int, err error) {
+			if !isRetryableStatus(err) {
+				t.Errorf("OnRetry got %v", err)
+			}
+			attempts = append(attempts, attempt)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Embed(context.Background(), "abc"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if calls.Load() != 3 || len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Fatalf("expected 3 calls and retries after attempts 1 and 2, got %d calls, %v", calls.Load(), attempts)
+	}
+}
+
+func isRetryableStatus(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Retryable
+}
+
+func TestRetrySkipsPermanentFailures(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		method string
+	}{
+		"client error":       {http.StatusBadRequest, MethodPing},
+		"exhausted attempts": {http.StatusTooManyRequests, MethodPing},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, calls := flakyServer(t, 100, tc.status, nil)
+			c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			if err := c.Call(context.Background(), tc.method, nil, nil); err == nil {
+				t.Fatal("expected an error")
+			}
+			want := int32(1)
+			if tc.status == http.StatusTooManyRequests {
+				want = 2
+			}
+			if calls.Load() != want {
+				t.Fatalf("expected %d calls, got %d", want, calls.Load())
+			}
+		})
+	}
+}
+
+func TestRetryHonorsRetryableRPCError(t *testing.T) {
+	var calls atomic.Int32
+	c, err := New(ClientConfig{
+		Transport: TransportInProc,
+		Handler: func(req Request) (Response, error) {
+			if calls.Add(1) == 1 {
+				return Response{}, &RPCError{Code: -32050, Message: "warming up", Data: []byte(`{"retryable":true}`)}
+			}
+			return Response{Result: []byte(`{}`)}, nil
+		},
+		Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Call(context.Background(), MethodPing, nil, nil); err != nil || calls.Load() != 2 {
+		t.Fatalf("expected a retried success, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	t.Run("retry-after beyond deadline", func(t *testing.T) {
+		srv, calls := flakyServer(t, 100, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+		c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Retry: RetryPolicy{MaxAttempts: 5}})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		defer c.Close(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		err = c.Call(ctx, MethodPing, nil, nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second {
+			t.Fatalf("expected the 429 with its Retry-After, got %v", err)
+		}
+		if calls.Load() != 1 || time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("waited for a retry past the deadline: %d calls in %s", calls.Load(), time.Since(start))
+		}
+	})
+	t.Run("backoff", func(t *testing.T) {
+		srv, _ := flakyServer(t, 1000, http.StatusBadGateway, nil)
+		c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Retry: RetryPolicy{MaxAttempts: 1000, BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond}})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		defer c.Close(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := c.Call(ctx, MethodPing, nil, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+			t.Fatalf("retries outlived the deadline: %s", elapsed)
+		}
+	})
+}
+
+func TestRetryBackoffBounds(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for n := 1; n < 40; n++ {
+		ceiling := min(p.MaxDelay, p.BaseDelay<<min(n-1, 32))
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(n, errors.New("reset")); d < 0 || d >= ceiling {
+				t.Fatalf("backoff(%d) = %s, want [0, %s)", n, d, ceiling)
+			}
+		}
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 00:00:03 GMT": 3 * time.Second,
+		"Sun, 31 Dec 2023 23:59:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Fatalf("parseRetryAfter(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// modelRoute is a WithModelRoute registration.
+type modelRoute struct {
+	model    string
+	endpoint string
+	opts     []Option
+}
+
+// WithModel embeds with model instead of ClientConfig.Model for one call. A
+// model given WithModelRoute is served by its route's endpoint.
+func WithModel(model string) EmbedOption {
+	return func(o *embedOptions) { overrideCall(o, "WithModel", &o.model, model) }
+}
+
+// WithModelRoute sends the Embed and EmbedBatch calls for model, whether
+// ClientConfig.Model or chosen with WithModel, to a separate client built as
+// by NewClient(endpoint, opts...) with model as its default. The route keeps
+// its own transport and connections, in-flight limit, rate limiter, breaker,
+// and cache; none of the other options of the parent client apply to it.
+// Other calls and models stay on the parent's endpoint.
+func WithModelRoute(model, endpoint string, opts ...Option) Option {
+	return func(o *clientOptions) error {
+		if model == "" {
+			return errors.New("WithModelRoute: model must not be empty")
+		}
+		for _, r := range o.routes {
+			if r.model == model {
+				return fmt.Errorf("WithModelRoute: model %q is already routed to %q", model, r.endpoint)
+			}
+		}
+		o.routes = append(o.routes, modelRoute{model: model, endpoint: endpoint, opts: opts})
+		return nil
+	}
+}
+
+// withRouteModel makes model the default of a route's client, whatever
+// configuration its options supply.
+func withRouteModel(model string) Option {
+	return func(o *clientOptions) error {
+		o.model = model
+		return nil
+	}
+}
+
+// buildRoutes creates the clients of o's model routes for c, closing the
+// ones already built when one fails.
+func (o *clientOptions) buildRoutes(c *Client) error {
+	if len(o.routes) == 0 {
+		return nil
+	}
+	c.routes = make(map[string]*Client, len(o.routes))
+	for _, r := range o.routes {
+		rc, err := NewClient(r.endpoint, append(r.opts[:len(r.opts):len(r.opts)], withRouteModel(r.model))...)
+		if err != nil {
+			return errors.Join(fmt.Errorf("route %q: %w", r.model, err), c.Close(context.Background()))
+		}
+		c.routes[r.model] = rc
+	}
+	return nil
+}
+
+// Route returns the client that serves model: its WithModelRoute client, or
+// c itself. Use it to inspect a route, for example with Stats.
+func (c *Client) Route(model string) *Client {
+	if route, ok := c.routes[model]; ok {
+		return route
+	}
+	return c
+}
+
+// routeModels returns the routed models in order.
+func (c *Client) routeModels() []string {
+	models := make([]string, 0, len(c.routes))
+	for model := range c.routes {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// WithAllRoutes makes ListModels list the parent's endpoint and then every
+// WithModelRoute endpoint in model order, setting each ModelInfo's Source.
+func WithAllRoutes() ListOption {
+	return func(o *listOptions) { o.allRoutes = true }
+}
+
+// listAllRoutes implements ListModels with WithAllRoutes.
+func (c *Client) listAllRoutes(ctx context.Context) ([]ModelInfo, error) {
+	clients := []*Client{c}
+	for _, model := range c.routeModels() {
+		clients = append(clients, c.routes[model])
+	}
+	var all []ModelInfo
+	for _, rc := range clients {
+		models, err := rc.ListModels(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list models at %s: %w", rc.cfg.endpointLabel(), err)
+		}
+		for _, m := range models {
+			m.Source = rc.cfg.endpointLabel()
+			all = append(all, m)
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// specialModel is served only by specialHandler.
+const specialModel = "model-x"
+
+// specialHandler lists specialModel alone and embeds with it. Every request
+// is counted in calls.
+func specialHandler(calls *atomic.Int32) fakeHandler {
+	return func(req *Request) *Response {
+		calls.Add(1)
+		switch req.Method {
+		case MethodListModels:
+			raw, _ := json.Marshal(listModelsResult{Models: []ModelInfo{{Name: specialModel, Dimension: 3, MaxInputTokens: 512}}})
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+		case MethodEmbed:
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			if params.Model != specialModel {
+				return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeModelNotFound, Message: "unknown model " + params.Model}}
+			}
+		}
+		return defaultHandler(req)
+	}
+}
+
+// newRoutedClient returns a client of a default http server that routes
+// specialModel to a second one, and the request counts of both servers.
+func newRoutedClient(t *testing.T, opts ...Option) (c *Client, main, special *atomic.Int32) {
+	t.Helper()
+	main, special = new(atomic.Int32), new(atomic.Int32)
+	mainSrv := httptest.NewServer(httpHandler(func(req *Request) *Response {
+		main.Add(1)
+		return defaultHandler(req)
+	}))
+	t.Cleanup(mainSrv.Close)
+	specialSrv := httptest.NewServer(httpHandler(specialHandler(special)))
+	t.Cleanup(specialSrv.Close)
+
+	c, err := NewClient(mainSrv.URL, append([]Option{WithModelRoute(specialModel, specialSrv.URL, WithMaxInFlight(2))}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, main, special
+}
+
+func TestModelRouteSendsRoutedModels(t *testing.T) {
+	c, main, special := newRoutedClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Embed(ctx, "plain"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if main.Load() != 1 || special.Load() != 0 {
+		t.Fatalf("default model should use the default endpoint: main %d, special %d", main.Load(), special.Load())
+	}
+	if _, err := c.Embed(ctx, "routed", WithModel(specialModel)); err != nil {
+		t.Fatalf("Embed with the routed model: %v", err)
+	}
+	if _, err := c.EmbedBatch(ctx, []string{"a", "b"}, WithModel(specialModel), WithTruncate(TruncateEnd)); err != nil {
+		t.Fatalf("EmbedBatch with the routed model: %v", err)
+	}
+	// The routed embed, then the listing (for WithTruncate), capabilities
+	// (for the batch size), and the batch.
+	if main.Load() != 1 || special.Load() != 4 {
+		t.Fatalf("routed model should use its endpoint: main %d, special %d", main.Load(), special.Load())
+	}
+
+	// A model that is not routed stays on the default endpoint.
+	if _, err := c.Embed(ctx, "other", WithModel("text-embedding-3-small")); err != nil || main.Load() != 2 {
+		t.Fatalf("unrouted WithModel: %v, main %d", err, main.Load())
+	}
+}
+
+func TestModelRouteKeepsSeparateStats(t *testing.T) {
+	c, _, _ := newRoutedClient(t, WithMaxInFlight(8))
+	route := c.Route(specialModel)
+	if route == c || route.Config().Model != specialModel {
+		t.Fatalf("Route returned %p (model %q) for the routed model", route, route.Config().Model)
+	}
+	if c.Route(DefaultModel) != c {
+		t.Fatal("Route should return the client itself for unrouted models")
+	}
+	if got := c.Stats().MaxInFlight; got != 8 {
+		t.Fatalf("parent MaxInFlight = %d, want 8", got)
+	}
+	if got := route.Stats().MaxInFlight; got != 2 {
+		t.Fatalf("route MaxInFlight = %d, want its own 2", got)
+	}
+}
+
+func TestListModelsAllRoutes(t *testing.T) {
+	c, _, _ := newRoutedClient(t)
+	ctx := context.Background()
+	all, err := c.ListModels(ctx, WithAllRoutes())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(all) != len(fakeModels)+1 {
+		t.Fatalf("expected %d models, got %+v", len(fakeModels)+1, all)
+	}
+	last := all[len(all)-1]
+	if last.Name != specialModel || last.Source != c.Route(specialModel).Config().Endpoint {
+		t.Fatalf("routed model lacks its source: %+v", last)
+	}
+	if all[0].Source != c.Config().Endpoint || all[0].Source == last.Source {
+		t.Fatalf("default models lack their source: %+v", all[0])
+	}
+	// The plain listing is the default endpoint's, unannotated.
+	own, err := c.ListModels(ctx)
+	if err != nil || len(own) != len(fakeModels) || own[0].Source != "" {
+		t.Fatalf("ListModels = %+v, %v", own, err)
+	}
+}
+
+func TestWithModelRouteErrors(t *testing.T) {
+	_, err := NewClient("http://127.0.0.1:1",
+		WithModelRoute("", "http://127.0.0.1:2"),
+		WithModelRoute("m", "http://127.0.0.1:2"),
+		WithModelRoute("m", "http://127.0.0.1:3"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "must not be empty") || !strings.Contains(err.Error(), "already routed") {
+		t.Fatalf("expected both route errors, got %v", err)
+	}
+	if _, err := NewClient("http://127.0.0.1:1", WithModelRoute("m", "ftp://host")); err == nil || !strings.Contains(err.Error(), `route "m"`) {
+		t.Fatalf("expected the route's endpoint error, got %v", err)
+	}
+}
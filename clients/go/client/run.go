@@ -0,0 +1,353 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+)
+
+// ErrStopped reports a session that Options.Stop wound down before it
+// finished.
+var ErrStopped = errors.New("stopped")
+
+// Options configures a scripted CLI session.
+type Options struct {
+	// Config is the base configuration. Endpoint and ClientOptions are
+	// applied on top of it as by NewClient(Endpoint, WithConfig(Config),
+	// ClientOptions...).
+	Config        ClientConfig
+	Endpoint      string
+	ClientOptions []Option
+	// RecordTranscript is the path the session transcript is written to.
+	// Empty disables recording.
+	RecordTranscript string
+	// TranscriptRecorder receives the session transcript when
+	// RecordTranscript is empty, for example a transcript.Recorder. It is
+	// told the SessionMarkers if it implements MarkSession, and the caller
+	// closes it.
+	TranscriptRecorder Recorder
+	// ListModels adds a ListModels call to the session and its answer to the
+	// summary.
+	ListModels bool
+	// RecordModels is the path the ListModels exchange is written to as a
+	// FixtureModels transcript, keeping it out of RecordTranscript. It
+	// implies ListModels.
+	RecordModels string
+	// RecordJob is the path a small embedding job, submitted and awaited
+	// after discovery, is written to as a FixtureJob transcript. Empty skips
+	// the job.
+	RecordJob string
+	// Inputs are the texts RunEmbed embeds.
+	Inputs []string
+	// Output renders what the session writes to Stdout.
+	Output Renderer
+	// InputFile, when set, is embedded line by line by RunEmbed in place
+	// of Inputs, with up to Concurrency chunks in flight (zero selects
+	// DefaultBatchConcurrency), and written to OutputFile, or Stdout when
+	// that is empty, as OutputNDJSON unless Output selects OutputCSV. ResumeFrom skips the lines before it. Checkpoint is a
+	// file recording the lines done after every window: a run finding one
+	// resumes from it, truncating OutputFile to match, and a run that
+	// completes removes it. Progress, when set, receives a report of lines
+	// per second and time left about once a second.
+	InputFile   string
+	OutputFile  string
+	Concurrency int
+	ResumeFrom  int64
+	Checkpoint  string
+	Progress    io.Writer
+	// Parquet configures the OutputParquet file; its CreatedBy defaults to
+	// the client's name and version.
+	Parquet export.ParquetOptions
+	// Recorder configures the redaction and format of every transcript the
+	// session writes.
+	Recorder RecorderConfig
+	// Stdout receives the session summary. Nil discards it.
+	Stdout io.Writer
+	// DryRun sends nothing: the session runs against a WithDryRun client
+	// and writes each DryRunRequest to Stdout, rendered by Output, in
+	// place of its usual output, ending without error at the first call
+	// that needs a real answer. Files the session would write are left
+	// alone.
+	DryRun bool
+	// Benchmark configures the load of RunBenchmark.
+	Benchmark Benchmark
+	// CompareModels names the models RunCompareModels compares.
+	CompareModels CompareModels
+	// Ready configures the probes of RunReady.
+	Ready ReadyOptions
+	// Chaos, when set, injects its faults into every request of the
+	// session, below the interceptors of ClientOptions; a benchmark reports
+	// those it injected into the measured requests. A dry run leaves it out.
+	Chaos *Chaos
+	// Stop, once closed, winds a long-running session down without
+	// cutting short what is in flight, which finishes under ctx: RunEmbed
+	// of an InputFile embeds no further window and returns an
+	// *EmbedFileError wrapping ErrStopped, and RunBenchmark starts no
+	// further request and reports the run Interrupted. Nil never stops.
+	Stop <-chan struct{}
+}
+
+// dryRun runs session as opts.DryRun describes.
+func (opts Options) dryRun(ctx context.Context, session func(context.Context, Options) error) error {
+	if err := opts.Output.Validate(); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	var requests []any
+	collect := func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+		resp, err := next(ctx, req)
+		var dr DryRunRequest
+		if err == nil && resp != nil && resp.Error == nil && json.Unmarshal(resp.Result, &dr) == nil {
+			mu.Lock()
+			requests = append(requests, dr)
+			mu.Unlock()
+		}
+		return resp, err
+	}
+	w := opts.Stdout
+	opts.DryRun, opts.Chaos = false, nil
+	opts.Stdout, opts.Progress = io.Discard, nil
+	opts.RecordModels, opts.RecordJob = "", ""
+	opts.OutputFile, opts.Checkpoint = "", ""
+	if opts.Output.fileOnly() {
+		// The requests are rendered, and those files hold only vectors.
+		opts.Output.Format = OutputNDJSON
+	}
+	opts.ClientOptions = append(opts.ClientOptions[:len(opts.ClientOptions):len(opts.ClientOptions)], WithDryRun(), WithInterceptor(collect))
+	err := session(ctx, opts)
+	if errors.Is(err, ErrDryRun) {
+		err = nil
+	}
+	if w == nil {
+		return err
+	}
+	out := opts.Output
+	out.Indent = "  "
+	mu.Lock()
+	defer mu.Unlock()
+	if werr := out.Render(w, requests, requests); werr != nil {
+		err = errors.Join(err, fmt.Errorf("write dry run: %w", werr))
+	}
+	return err
+}
+
+// resolve collects the NewClient options of the session.
+func (opts Options) resolve() (*clientOptions, error) {
+	if err := opts.Recorder.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Output.Validate(); err != nil {
+		return nil, err
+	}
+	options := append([]Option{WithConfig(opts.Config)}, opts.ClientOptions...)
+	if opts.Chaos != nil {
+		options = append(options, WithInterceptor(opts.Chaos.Intercept))
+	}
+	return newClientOptions(opts.Endpoint, options)
+}
+
+// SessionSummary is printed by Run once the scripted session completes.
+type SessionSummary struct {
+	Session      Session         `json:"session"`
+	Ping         json.RawMessage `json:"ping"`
+	Capabilities json.RawMessage `json:"capabilities"`
+	Models       []ModelInfo     `json:"models,omitempty"`
+	Job          *JobStatus      `json:"job,omitempty"`
+}
+
+// The job RecordJob runs: three inputs fetched two per page, so the
+// transcript covers polling and a follow-up page.
+var (
+	fixtureJobInputs   = []string{"alpha", "beta", "gamma"}
+	fixtureJobPageSize = 2
+	fixtureJobPoll     = PollInterval{Initial: 100 * time.Millisecond, Max: 2 * time.Second}
+)
+
+// Run executes the handshake, ping, and capability discovery sequence captured
+// by the golden transcripts, recording the exchange when requested.
+func Run(ctx context.Context, opts Options) (err error) {
+	if opts.DryRun {
+		return opts.dryRun(ctx, Run)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	split := &splitRecorder{rest: session, routes: make(map[string]Recorder), pending: make(map[string]Recorder)}
+	fixture := func(path, kind string, methods ...string) *FileRecorder {
+		if path == "" {
+			return nil
+		}
+		r := NewFileRecorder(path, cfg.Transport)
+		r.Kind = kind
+		r.Config = opts.Recorder
+		r.MarkSession(markers)
+		for _, m := range methods {
+			split.routes[m] = r
+		}
+		return r
+	}
+	modelsRecorder := fixture(opts.RecordModels, FixtureModels, MethodListModels)
+	jobRecorder := fixture(opts.RecordJob, FixtureJob, MethodJobSubmit, MethodJobStatus, MethodJobResults)
+	if len(split.routes) > 0 {
+		o.setRecorder(split)
+	}
+
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p, ok := c.transport.(interface{ protocol() string }); ok {
+			markers.Protocol = p.protocol()
+		}
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		files := []*FileRecorder{recorder, modelsRecorder, jobRecorder}
+		for _, r := range files[1:] {
+			if r != nil {
+				markSession(r, markers)
+			}
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		for _, r := range files {
+			if r != nil {
+				err = errors.Join(err, r.Close())
+			}
+		}
+	}()
+
+	init, err := c.Initialize(ctx)
+	if err != nil {
+		return err
+	}
+	summary := SessionSummary{Session: init.Session}
+
+	pingParams := map[string]any{"transport": cfg.Transport, "session_id": init.Session.ID}
+	if err := c.Call(ctx, MethodPing, pingParams, &summary.Ping); err != nil {
+		return err
+	}
+	capParams := map[string]any{
+		"requested":  []string{"prompts", "resources", "tools"},
+		"session_id": init.Session.ID,
+	}
+	if err := c.Call(ctx, MethodCapabilities, capParams, &summary.Capabilities); err != nil {
+		return err
+	}
+
+	if opts.ListModels || opts.RecordModels != "" {
+		if summary.Models, err = c.ListModels(ctx); err != nil {
+			return err
+		}
+	}
+
+	if opts.RecordJob != "" {
+		if summary.Job, err = runFixtureJob(ctx, c); err != nil {
+			return err
+		}
+	}
+
+	if opts.Stdout != nil {
+		out := opts.Output
+		out.Indent = "  "
+		if err := out.Render(opts.Stdout, summary, []any{summary}); err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+	}
+	return nil
+}
+
+// sessionRecorder returns the recorder of the session transcript, and the
+// FileRecorder Run owns when it is one for RecordTranscript.
+func (opts Options) sessionRecorder(cfg ClientConfig) (*FileRecorder, Recorder) {
+	if opts.RecordTranscript == "" {
+		return nil, opts.TranscriptRecorder
+	}
+	r := NewFileRecorder(opts.RecordTranscript, cfg.Transport)
+	r.Config = opts.Recorder
+	return r, r
+}
+
+// markSession passes m to r if it stores markers.
+func markSession(r Recorder, m SessionMarkers) {
+	if marker, ok := r.(sessionMarker); ok {
+		marker.MarkSession(m)
+	}
+}
+
+// runFixtureJob submits the fixture job, waits for it, and reads every page
+// of its results.
+func runFixtureJob(ctx context.Context, c *Client) (*JobStatus, error) {
+	id, err := c.SubmitJob(ctx, JobSpec{Inputs: fixtureJobInputs})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.WaitJob(ctx, id, fixtureJobPoll)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	if err := result.Each(ctx, fixtureJobPageSize, func(JobEmbedding) error { n++; return nil }); err != nil {
+		return nil, err
+	}
+	if n != len(fixtureJobInputs) {
+		return nil, fmt.Errorf("job %s returned %d vectors for %d inputs: %w", id, n, len(fixtureJobInputs), ErrProtocol)
+	}
+	return &result.Status, nil
+}
+
+// splitRecorder sends the exchanges of the methods in routes to their
+// fixture recorders and every other envelope to rest, so the session
+// transcript still matches the handshake fixtures.
+type splitRecorder struct {
+	rest   Recorder
+	routes map[string]Recorder
+
+	mu sync.Mutex
+	// pending maps the IDs of routed requests awaiting their response to
+	// the recorder they went to.
+	pending map[string]Recorder
+}
+
+func (r *splitRecorder) Record(entry Entry) {
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	_ = json.Unmarshal(entry.Message, &env)
+	r.mu.Lock()
+	dest, ok := r.routes[env.Method]
+	switch {
+	case ok && entry.Direction == DirectionError:
+		delete(r.pending, string(env.ID))
+	case ok:
+		r.pending[string(env.ID)] = dest
+	case env.Method == "":
+		if dest, ok = r.pending[string(env.ID)]; ok {
+			delete(r.pending, string(env.ID))
+		}
+	}
+	r.mu.Unlock()
+	switch {
+	case ok:
+		dest.Record(entry)
+	case r.rest != nil:
+		r.rest.Record(entry)
+	}
+}
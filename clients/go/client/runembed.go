@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// embedMeta is the metadata of an EmbedWithMeta call as RunEmbed writes it,
+// under "meta".
+type embedMeta struct {
+	ModelVersion string  `json:"model_version"`
+	Usage        Usage   `json:"usage"`
+	RequestID    string  `json:"request_id"`
+	DurationMS   float64 `json:"duration_ms"`
+}
+
+// embedDocMeta is the meta of an OutputJSON document, reporting the
+// truncation of every input.
+type embedDocMeta struct {
+	embedMeta
+	Truncated []bool `json:"truncated"`
+}
+
+// embedLineMeta is the meta of an OutputNDJSON record, reporting the
+// truncation of its input.
+type embedLineMeta struct {
+	embedMeta
+	Truncated bool `json:"truncated"`
+}
+
+// embedDoc is the OutputJSON document of RunEmbed: Vector for a single
+// input, else Vectors.
+type embedDoc struct {
+	Vector  []float32    `json:"vector,omitempty"`
+	Vectors [][]float32  `json:"vectors,omitempty"`
+	Meta    embedDocMeta `json:"meta"`
+}
+
+// embedMetaLine is the OutputNDJSON record of an input of RunEmbed.
+type embedMetaLine struct {
+	Index  int64         `json:"index"`
+	Vector []float32     `json:"vector"`
+	Meta   embedLineMeta `json:"meta"`
+}
+
+// RunEmbed initializes a session with the server described by opts, embeds
+// opts.Inputs with the configured model in one batch, and writes the
+// vectors to opts.Stdout as opts.Output renders them: for OutputJSON a
+// {"vector", "meta"} document for a single input, or {"vectors", "meta"}
+// for several, for OutputNDJSON one {"index", "vector", "meta"} record per
+// input, and otherwise one {"index", "vector"} record per input. The meta
+// object holds what EmbedWithMeta reports: "model_version", "usage",
+// "truncated", per input in a document, "request_id", and "duration_ms".
+//
+// With opts.InputFile set it embeds the lines of that file instead, a
+// window at a time so memory stays bounded, and writes their records to
+// opts.OutputFile, or to opts.Stdout, with each line's index its line
+// number counted from 0; blank lines are skipped. A run that stops early,
+// failing or wound down by opts.Stop after the window in flight, returns
+// an *EmbedFileError telling where to resume. OutputArrow,
+// OutputNPY, and OutputParquet write their files only to opts.OutputFile,
+// and cannot be resumed.
+func RunEmbed(ctx context.Context, opts Options) (err error) {
+	switch {
+	case opts.InputFile != "" && len(opts.Inputs) > 0:
+		return errors.New("embed: an input file and inputs cannot be combined")
+	case opts.InputFile != "" && (opts.Output.Format == OutputJSON || opts.Output.Format == OutputTable):
+		return fmt.Errorf("embed: an input file is written as %s, %s, %s, %s, or %s", OutputNDJSON, OutputCSV, OutputArrow, OutputNPY, OutputParquet)
+	case opts.Output.fileOnly() && (opts.InputFile == "" || opts.OutputFile == ""):
+		return fmt.Errorf("embed: %s output is written from an input file to an output file", opts.Output.Format)
+	case opts.Output.fileOnly() && (opts.ResumeFrom > 0 || opts.Checkpoint != ""):
+		return fmt.Errorf("embed: an %s file cannot be resumed or checkpointed", opts.Output.Format)
+	case opts.InputFile == "" && len(opts.Inputs) == 0:
+		return errors.New("embed: no inputs")
+	case opts.Concurrency < 0 || opts.ResumeFrom < 0:
+		return errors.New("embed: concurrency and resume offset must not be negative")
+	}
+	if opts.Output.Format == OutputParquet {
+		if err := opts.Parquet.Validate(); err != nil {
+			return fmt.Errorf("embed: %w", err)
+		}
+	}
+	switch {
+	case opts.DryRun:
+		return opts.dryRun(ctx, RunEmbed)
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg.withDefaults()
+	markers := cfg.sessionMarkers()
+	recorder, session := opts.sessionRecorder(cfg)
+	if session != nil {
+		markSession(session, markers)
+		o.setRecorder(session)
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p, ok := c.transport.(interface{ protocol() string }); ok {
+			markers.Protocol = p.protocol()
+		}
+		markers.ProtocolVersion = c.ProtocolVersion()
+		markers.Codec = c.codecMarker()
+		if session != nil {
+			markSession(session, markers)
+		}
+		err = errors.Join(err, c.Close(context.Background()))
+		if recorder != nil {
+			err = errors.Join(err, recorder.Close())
+		}
+	}()
+
+	if _, err := c.Initialize(ctx); err != nil {
+		return err
+	}
+	if opts.InputFile != "" {
+		return embedFile(ctx, c, opts)
+	}
+	res, err := c.EmbedWithMeta(ctx, opts.Inputs)
+	if err != nil {
+		return err
+	}
+	if opts.Stdout == nil {
+		return nil
+	}
+	meta := embedMeta{
+		ModelVersion: res.ModelVersion,
+		Usage:        res.Usage,
+		RequestID:    res.RequestID,
+		DurationMS:   float64(res.Duration.Microseconds()) / 1000,
+	}
+	doc := embedDoc{Vectors: res.Vectors, Meta: embedDocMeta{meta, res.Truncated}}
+	if len(res.Vectors) == 1 {
+		doc.Vector, doc.Vectors = res.Vectors[0], nil
+	}
+	records := make([]any, len(res.Vectors))
+	for i, v := range res.Vectors {
+		if opts.Output.format() == OutputNDJSON {
+			records[i] = embedMetaLine{Index: int64(i), Vector: v, Meta: embedLineMeta{meta, res.Truncated[i]}}
+		} else {
+			records[i] = embedLine{Index: int64(i), Vector: v}
+		}
+	}
+	if err := opts.Output.Render(opts.Stdout, doc, records); err != nil {
+		return fmt.Errorf("write embeddings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunEmbed(t *testing.T) {
+	cfg := ClientConfig{Transport: TransportStdio, Command: helperCommand(t)}
+
+	var out strings.Builder
+	if err := RunEmbed(context.Background(), Options{Config: cfg, Inputs: []string{"abc"}, Stdout: &out}); err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	var single struct {
+		Vector []float32 `json:"vector"`
+		Meta   struct {
+			Truncated []bool `json:"truncated"`
+			RequestID string `json:"request_id"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &single); err != nil || len(single.Vector) != 3 || single.Vector[0] != 3 {
+		t.Fatalf("single input printed %s, want its vector: %v", out.String(), err)
+	}
+	if len(single.Meta.Truncated) != 1 || single.Meta.RequestID == "" {
+		t.Fatalf("single input printed %s, want its metadata", out.String())
+	}
+
+	out.Reset()
+	path := filepath.Join(t.TempDir(), "embed.json")
+	err := RunEmbed(context.Background(), Options{
+		Config:           cfg,
+		Inputs:           []string{"a", "bb"},
+		Output:           Renderer{Format: OutputNDJSON},
+		RecordTranscript: path,
+		Stdout:           &out,
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed ndjson: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, want := range []string{`{"index":0,"vector":[1,0.5,-0.5],"meta":{`, `{"index":1,"vector":[2,0.5,-0.5],"meta":{`} {
+		if i >= len(lines) || !strings.HasPrefix(lines[i], want) || !strings.Contains(lines[i], `"truncated":false`) {
+			t.Fatalf("ndjson output %q, want records starting %s", out.String(), want)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("decode transcript: %v", err)
+	}
+	var methods []string
+	for _, e := range doc.Messages {
+		var req Request
+		if e.Direction == DirectionRequest && json.Unmarshal(e.Message, &req) == nil {
+			methods = append(methods, req.Method)
+		}
+	}
+	if got := strings.Join(methods, " "); !strings.HasPrefix(got, MethodInitialize) || !strings.HasSuffix(got, MethodEmbed) {
+		t.Fatalf("recorded requests %q, want the handshake then the embed", got)
+	}
+	if doc.ProtocolVersion == "" {
+		t.Fatal("transcript lacks the negotiated protocol version")
+	}
+
+	if err := RunEmbed(context.Background(), Options{Config: cfg, Inputs: []string{"a"}, Output: Renderer{Format: "xml"}}); err == nil {
+		t.Fatal("unknown output format accepted")
+	}
+	if err := RunEmbed(context.Background(), Options{Config: cfg}); err == nil {
+		t.Fatal("embedding no inputs succeeded")
+	}
+}
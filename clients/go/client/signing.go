@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request signing headers, set by the http, tls, and http3 transports when
+// ClientConfig.Signing is configured and checked on responses that carry
+// them.
+const (
+	SignatureHeader          = "X-EN-Signature"
+	SignatureTimestampHeader = "X-EN-Timestamp"
+	SignatureKeyIDHeader     = "X-EN-Key-Id"
+)
+
+// SigningHMACSHA256 is the signing algorithm, and the default one.
+const SigningHMACSHA256 = "HMAC-SHA256"
+
+// DefaultSigningClockSkew is how far a signed response's timestamp may be
+// from the local clock when SigningConfig.ClockSkew is zero.
+const DefaultSigningClockSkew = 5 * time.Minute
+
+// ErrSignatureMismatch reports a signed response whose signature does not
+// verify, or whose timestamp is outside the clock skew tolerance. It
+// matches ErrProtocol.
+var ErrSignatureMismatch error = &classError{"response signature does not verify", ErrProtocol}
+
+// SigningConfig signs requests with an HMAC over their body and a
+// timestamp, for servers that verify request integrity.
+//
+// The signature of a request is the lowercase hex HMAC, keyed with Secret,
+// of the string to sign: the algorithm, the timestamp, the key ID, and the
+// lowercase hex SHA-256 of the body, each followed by a "\n" but the last:
+//
+//	HMAC-SHA256\n1700000000\nkey-1\n<hex sha256 of the body>
+//
+// where the timestamp is in decimal Unix seconds, as sent in
+// X-EN-Timestamp, and the body is the JSON request envelope exactly as
+// sent, or its CBOR once the session negotiated CodecCBOR, before any
+// Content-Encoding is applied. The signature is sent in
+// X-EN-Signature and the key ID in X-EN-Key-Id.
+//
+// A response may be signed in turn, over the request's signature so it
+// cannot be replayed as the answer to another request:
+//
+//	HMAC-SHA256\n<timestamp>\n<key id>\n<request signature>\n<hex sha256 of the body>
+//
+// where the body is the response envelope after any Content-Encoding is
+// removed, and the timestamp and key ID are the response's own headers. A
+// response with an X-EN-Signature that does not verify, or a timestamp
+// more than ClockSkew from the local clock, fails with
+// ErrSignatureMismatch; an unsigned response is accepted. Streamed NDJSON
+// responses are not verified.
+type SigningConfig struct {
+	// KeyID names the key to the server. Signing is enabled when it is set.
+	KeyID  string
+	Secret Secret
+	// Algorithm is SigningHMACSHA256, the default.
+	Algorithm string
+	// ClockSkew is the tolerance for response timestamps, or
+	// DefaultSigningClockSkew when zero.
+	ClockSkew time.Duration
+}
+
+func (s SigningConfig) enabled() bool { return s.KeyID != "" }
+
+func (s SigningConfig) withDefaults() SigningConfig {
+	if s.Algorithm == "" {
+		s.Algorithm = SigningHMACSHA256
+	}
+	if s.ClockSkew == 0 {
+		s.ClockSkew = DefaultSigningClockSkew
+	}
+	return s
+}
+
+func (s SigningConfig) validate(transport string) error {
+	switch {
+	case !s.enabled():
+		return nil
+	case s.Secret == "":
+		return errors.New("signing: a key ID needs a secret")
+	case strings.ContainsAny(s.KeyID, "\r\n"):
+		return errors.New("signing: key ID must not contain line breaks")
+	case s.Algorithm != "" && s.Algorithm != SigningHMACSHA256:
+		return fmt.Errorf("signing: unknown algorithm %q; want %s", s.Algorithm, SigningHMACSHA256)
+	case s.ClockSkew < 0:
+		return errors.New("signing: clock skew must not be negative")
+	}
+	switch transport {
+	case "", TransportHTTP, TransportTLS, TransportHTTP3:
+		return nil
+	case TransportGRPC:
+		return errors.New("signing: the grpc transport sends proto messages, not the envelopes signatures cover")
+	}
+	return fmt.Errorf("signing: the %s transport has no headers to sign with; use http, tls, or http3", transport)
+}
+
+// WithSigning sets ClientConfig.Signing, signing every request with s.
+func WithSigning(s SigningConfig) Option {
+	return func(o *clientOptions) error {
+		if !s.enabled() {
+			return errors.New("WithSigning: key ID must not be empty")
+		}
+		o.signing = s
+		return nil
+	}
+}
+
+// signer computes and checks the signatures of a SigningConfig.
+type signer struct {
+	cfg SigningConfig
+}
+
+// mac returns the lowercase hex HMAC of the lines joined by "\n".
+func (s *signer) mac(lines ...string) string {
+	h := hmac.New(sha256.New, []byte(s.cfg.Secret))
+	h.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// signRequest returns the signature of a request body sent at ts.
+func (s *signer) signRequest(ts time.Time, body []byte) string {
+	return s.mac(s.cfg.Algorithm, strconv.FormatInt(ts.Unix(), 10), s.cfg.KeyID, bodyDigest(body))
+}
+
+// signResponse returns the signature of a response body answering the
+// request signed reqSig, with the response's timestamp and key ID headers.
+func (s *signer) signResponse(timestamp, keyID, reqSig string, body []byte) string {
+	return s.mac(s.cfg.Algorithm, timestamp, keyID, reqSig, bodyDigest(body))
+}
+
+// verifyResponse checks the signature of a response, if it has one, at now.
+func (s *signer) verifyResponse(header http.Header, reqSig string, body []byte, now time.Time) error {
+	sig := header.Get(SignatureHeader)
+	if sig == "" {
+		return nil
+	}
+	timestamp, keyID := header.Get(SignatureTimestampHeader), header.Get(SignatureKeyIDHeader)
+	if keyID != s.cfg.KeyID {
+		return fmt.Errorf("%w: signed with key %q, want %q", ErrSignatureMismatch, keyID, s.cfg.KeyID)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrSignatureMismatch, timestamp)
+	}
+	if skew := now.Sub(time.Unix(unix, 0)).Abs(); skew > s.cfg.ClockSkew {
+		return fmt.Errorf("%w: timestamp is %s off, over the %s tolerance", ErrSignatureMismatch, skew, s.cfg.ClockSkew)
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signResponse(timestamp, keyID, reqSig, body))) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// signedRequest is a request body and the signature headers covering it,
+// which the transport sends unchanged.
+type signedRequest struct {
+	signer *signer
+	body   []byte
+	header http.Header
+}
+
+// withBody returns r signing body in place of the one r signed, at the
+// same timestamp: the envelope in a negotiated codec.
+func (r *signedRequest) withBody(body []byte) *signedRequest {
+	ts, _ := strconv.ParseInt(r.header.Get(SignatureTimestampHeader), 10, 64)
+	header := r.header.Clone()
+	header.Set(SignatureHeader, r.signer.signRequest(time.Unix(ts, 0), body))
+	return &signedRequest{signer: r.signer, body: body, header: header}
+}
+
+// verify checks the signature of the response answering r.
+func (r *signedRequest) verify(header http.Header, body []byte) error {
+	return r.signer.verifyResponse(header, r.header.Get(SignatureHeader), body, time.Now())
+}
+
+// signedRequestKey carries the signedRequest interceptSign made to the
+// transport.
+type signedRequestKey struct{}
+
+// contextSignedRequest returns the signedRequest carried by ctx.
+func contextSignedRequest(ctx context.Context) (*signedRequest, bool) {
+	r, ok := ctx.Value(signedRequestKey{}).(*signedRequest)
+	return r, ok
+}
+
+// signContext encodes req and signs it, returning a ctx carrying both to
+// the transport.
+func (c *Client) signContext(ctx context.Context, req *Request) (context.Context, error) {
+	body, err := json.Marshal(req.Wire())
+	if err != nil {
+		return ctx, fmt.Errorf("encode request: %w", err)
+	}
+	return c.signBody(ctx, body), nil
+}
+
+// signBody returns ctx carrying the signature of body, the bytes the
+// transport sends.
+func (c *Client) signBody(ctx context.Context, body []byte) context.Context {
+	ts := c.now()
+	header := http.Header{}
+	header.Set(SignatureHeader, c.signer.signRequest(ts, body))
+	header.Set(SignatureTimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	header.Set(SignatureKeyIDHeader, c.signer.cfg.KeyID)
+	return context.WithValue(ctx, signedRequestKey{}, &signedRequest{signer: c.signer, body: body, header: header})
+}
+
+// interceptSign signs req with ClientConfig.Signing. It runs last, after
+// every interceptor that may change the request, and each retry is signed
+// anew with a fresh timestamp.
+func (c *Client) interceptSign(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	ctx, err := c.signContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
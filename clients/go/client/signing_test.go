@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSigningKnownAnswers(t *testing.T) {
+	s := &signer{cfg: SigningConfig{KeyID: "key-1", Secret: "s3cret"}.withDefaults()}
+	req := []byte(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}`)
+	resp := []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`)
+
+	if got, want := bodyDigest(req), "a77a14211f7839ebebda22443a439b60ce1675dbb288ff0a0904295457ba51e4"; got != want {
+		t.Fatalf("body digest = %s, want %s", got, want)
+	}
+	reqSig := s.signRequest(time.Unix(1700000000, 0), req)
+	if want := "19dcfd89b1106e0e3c936e011f888d32e08d492a5f2f4c20b9b8994328a55a99"; reqSig != want {
+		t.Fatalf("request signature = %s, want %s", reqSig, want)
+	}
+	respSig := s.signResponse("1700000005", "key-1", reqSig, resp)
+	if want := "b512e30b5d9994c89080f0130f1dcdb84f8cb69ba956cd74523bf4c683ad3a01"; respSig != want {
+		t.Fatalf("response signature = %s, want %s", respSig, want)
+	}
+
+	header := http.Header{}
+	header.Set(SignatureHeader, respSig)
+	header.Set(SignatureTimestampHeader, "1700000005")
+	header.Set(SignatureKeyIDHeader, "key-1")
+	at := time.Unix(1700000000, 0)
+	if err := s.verifyResponse(header, reqSig, resp, at); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	for name, check := range map[string]func() error{
+		"body":    func() error { return s.verifyResponse(header, reqSig, []byte(`{}`), at) },
+		"request": func() error { return s.verifyResponse(header, "00", resp, at) },
+		"skew":    func() error { return s.verifyResponse(header, reqSig, resp, at.Add(time.Hour)) },
+	} {
+		if err := check(); !errors.Is(err, ErrSignatureMismatch) || !errors.Is(err, ErrProtocol) {
+			t.Errorf("%s: got %v, want ErrSignatureMismatch", name, err)
+		}
+	}
+	if err := s.verifyResponse(http.Header{}, reqSig, resp, at); err != nil {
+		t.Fatalf("unsigned response: %v", err)
+	}
+}
+
+func TestSigningOverHTTP(t *testing.T) {
+	s := &signer{cfg: SigningConfig{KeyID: "key-1", Secret: "s3cret"}.withDefaults()}
+	var tamper bool
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+		reqSig := r.Header.Get(SignatureHeader)
+		if r.Header.Get(SignatureKeyIDHeader) != "key-1" || reqSig != s.signRequest(time.Unix(ts, 0), body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		httpHandler(defaultHandler).ServeHTTP(rec, r)
+		respBody := rec.Body.Bytes()
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		sig := s.signResponse(now, "key-1", reqSig, respBody)
+		if tamper {
+			sig = s.signResponse(now, "key-1", reqSig, nil)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(SignatureHeader, sig)
+		w.Header().Set(SignatureTimestampHeader, now)
+		w.Header().Set(SignatureKeyIDHeader, "key-1")
+		w.Write(respBody)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithSigning(SigningConfig{KeyID: "key-1", Secret: "s3cret"}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	tamper = true
+	if _, err := c.Embed(context.Background(), "text"); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("Embed with a tampered response: got %v, want ErrSignatureMismatch", err)
+	}
+	if requests != 3 {
+		t.Fatalf("server saw %d requests, want 3", requests)
+	}
+
+	if _, err := NewClient("", WithConfig(ClientConfig{Transport: TransportInProc, Handler: func(req Request) (Response, error) {
+		return *defaultHandler(&req), nil
+	}}), WithSigning(SigningConfig{KeyID: "key-1", Secret: "s3cret"})); err == nil {
+		t.Fatal("signing was accepted over a transport without headers")
+	}
+	if _, err := NewClient(srv.URL, WithSigning(SigningConfig{KeyID: "key-1"})); err == nil {
+		t.Fatal("signing without a secret was accepted")
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// WithSingleFlight shares one request between concurrent Embed calls for
+// the same input; see ClientConfig.SingleFlight.
+func WithSingleFlight() Option {
+	return func(o *clientOptions) error {
+		o.singleFlight = true
+		return nil
+	}
+}
+
+// flightGroup holds the single-input embeds in flight under
+// ClientConfig.SingleFlight, so identical concurrent calls share one.
+type flightGroup struct {
+	c *Client
+
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+}
+
+// flightKey identifies the embeds that may share a request: those of the
+// same input for the same model and dimensions.
+type flightKey struct {
+	model      string
+	dimensions int
+	// clientDimensions is the truncation the client does afterwards.
+	clientDimensions int
+	input            [sha256.Size]byte
+}
+
+// flight is an embed in flight. Its waiters read vector and err once done
+// is closed.
+type flight struct {
+	// ctx is the shared request's own, canceled once every waiter has
+	// dropped out.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// waiting counts the callers still interested in the answer.
+	waiting int
+
+	done   chan struct{}
+	vector []float32
+	err    error
+}
+
+func newFlightGroup(c *Client) *flightGroup {
+	return &flightGroup{c: c, flights: make(map[flightKey]*flight)}
+}
+
+// shareable reports whether a lookup of inputs made with ctx may share its
+// request: a single input, from a caller that has not named its request
+// with WithRequestID, outside a JSON-RPC 2.0 batch.
+func (g *flightGroup) shareable(ctx context.Context, inputs []string) bool {
+	return g != nil && len(inputs) == 1 && RequestIDFromContext(ctx) == "" && !inRPCBatch(ctx) && !sendsAlone(ctx)
+}
+
+// lookup is lookupEmbeddings for the single input of a shareable call: a
+// cached vector is returned as usual, and a miss joins the request already
+// in flight for the same input or starts one, whose vector is cached once
+// on arrival however many calls share it.
+func (g *flightGroup) lookup(ctx context.Context, input string, o embedOptions, dimensions int) ([][]float32, error) {
+	c := g.c
+	cacheKey := ""
+	if c.cache != nil && !o.noCache {
+		cacheKey = c.cfg.Cache.key(cacheModel(o.model, dimensions, c.versions.get(o.model)), input)
+		v, ok := c.cache.get(cacheKey)
+		c.metrics.cacheLookup(ok)
+		if ok {
+			return [][]float32{v}, nil
+		}
+	}
+	key := flightKey{model: o.model, dimensions: dimensions, input: sha256.Sum256([]byte(input))}
+	if n, ok := ctx.Value(clientDimensionsKey{}).(int); ok {
+		key.clientDimensions = n
+	}
+	v, err := g.do(ctx, key, func(ctx context.Context) ([]float32, error) {
+		vectors, err := c.fetchEmbeddings(ctx, o.model, []string{input}, dimensions)
+		if err != nil {
+			return nil, err
+		}
+		if cacheKey != "" {
+			// Under the version the server answered with.
+			c.cache.put(c.cfg.Cache.key(cacheModel(o.model, dimensions, c.versions.get(o.model)), input), vectors[0])
+		}
+		return vectors[0], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return [][]float32{v}, nil
+}
+
+// do returns a copy of the vector fetch returns for key, calling it only
+// when no call for key is in flight already. The first caller's fetch runs
+// with the values of its ctx but not its cancellation: a caller whose ctx
+// ends first returns its error and leaves the request to the others, and a
+// request every caller has left is canceled. A failure of the request is
+// every caller's.
+func (g *flightGroup) do(ctx context.Context, key flightKey, fetch func(ctx context.Context) ([]float32, error)) ([]float32, error) {
+	g.mu.Lock()
+	f, shared := g.flights[key]
+	if !shared {
+		f = &flight{done: make(chan struct{})}
+		f.ctx, f.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		g.flights[key] = f
+		go g.run(key, f, fetch)
+	}
+	f.waiting++
+	g.mu.Unlock()
+	if shared {
+		g.c.metrics.stats.deduplicated()
+	}
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, f.err
+		}
+		return append([]float32(nil), f.vector...), nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiting--
+		if f.waiting == 0 {
+			f.cancel()
+			// Later callers start a request of their own.
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, fmt.Errorf("%s: %w", MethodEmbed, ctx.Err())
+	}
+}
+
+func (g *flightGroup) run(key flightKey, f *flight, fetch func(ctx context.Context) ([]float32, error)) {
+	defer f.cancel()
+	f.vector, f.err = fetch(f.ctx)
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+}
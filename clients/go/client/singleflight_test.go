@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// heldServer is a batchServer answering embeds only once released.
+func heldServer() (*batchServer, func()) {
+	release := make(chan struct{})
+	srv := &batchServer{arrived: make(chan struct{}, 8), handle: func(req *Request) *Response {
+		if req.Method == MethodEmbed {
+			<-release
+		}
+		return defaultHandler(req)
+	}}
+	var once sync.Once
+	return srv, func() { once.Do(func() { close(release) }) }
+}
+
+func singleFlightClient(t *testing.T, srv *batchServer, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithConfig(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(srv.serve)}), WithSingleFlight()}, opts...)
+	c, err := NewClient("", opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+// waitDeduplicated waits for n calls of c to have joined a request in
+// flight.
+func waitDeduplicated(t *testing.T, c *Client, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Deduplicated < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls joined a request in flight, want %d", c.Stats().Deduplicated, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSingleFlightSharesIdenticalEmbeds(t *testing.T) {
+	const callers = 12
+	srv, release := heldServer()
+	defer release()
+	c := singleFlightClient(t, srv, WithCache(CacheConfig{MaxEntries: 8}))
+	vectors := make([][]float32, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vectors[i], errs[i] = c.Embed(context.Background(), "query")
+		}(i)
+	}
+	<-srv.arrived
+	waitDeduplicated(t, c, callers-1)
+	release()
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil || vectors[i][0] != 5 {
+			t.Fatalf("call %d: %v, %v", i, vectors[i], err)
+		}
+	}
+	// Each call owns its vector.
+	vectors[0][0] = -1
+	if vectors[1][0] != 5 {
+		t.Fatal("calls share a vector")
+	}
+	if got := srv.sizes(); len(got) != 1 {
+		t.Fatalf("embed requests of %v inputs, want one", got)
+	}
+
+	// The shared request filled the cache once; another input goes out
+	// alone.
+	if _, err := c.Embed(context.Background(), "query"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, err := c.Embed(context.Background(), "other"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if s := c.Stats(); s.Requests[MethodEmbed] != 2 || s.CacheHits != 1 || s.Deduplicated != callers-1 {
+		t.Fatalf("%d embed requests, %d cache hits, %d deduplicated", s.Requests[MethodEmbed], s.CacheHits, s.Deduplicated)
+	}
+	if cs := c.CacheStats(); cs.Entries != 2 {
+		t.Fatalf("cache holds %d entries, want 2", cs.Entries)
+	}
+}
+
+func TestSingleFlightOutlivesCanceledCallers(t *testing.T) {
+	srv, release := heldServer()
+	defer release()
+	c := singleFlightClient(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Embed(ctx, "query")
+		first <- err
+	}()
+	<-srv.arrived
+	second := make(chan error, 1)
+	go func() {
+		v, err := c.Embed(context.Background(), "query")
+		if err == nil && v[0] != 5 {
+			err = errors.New("vector of another input")
+		}
+		second <- err
+	}()
+	waitDeduplicated(t, c, 1)
+
+	// The caller that started the request leaves; the request stays.
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled caller: %v", err)
+	}
+	release()
+	if err := <-second; err != nil {
+		t.Fatalf("remaining caller: %v", err)
+	}
+
+	// The last caller to leave cancels the request, and the next call for
+	// the input starts one of its own.
+	key := flightKey{model: DefaultModel}
+	ctx, cancel = context.WithCancel(context.Background())
+	started, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := c.flights.do(ctx, key, func(ctx context.Context) ([]float32, error) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("do with its caller gone: %v", err)
+	}
+	<-stopped
+	v, err := c.flights.do(context.Background(), key, func(context.Context) ([]float32, error) { return []float32{1}, nil })
+	if err != nil || len(v) != 1 {
+		t.Fatalf("do after every caller left: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// SlowRequestPolicy reports calls that take longer than a threshold, as
+// they finish, without waiting for a metrics dashboard to show them. The
+// zero value reports nothing.
+type SlowRequestPolicy struct {
+	// Threshold reports calls made with Call and the methods built on it
+	// that take longer, retries and their waits included. Zero disables
+	// it.
+	Threshold time.Duration
+	// FirstFrameThreshold reports EmbedStream calls whose first frame takes
+	// longer to arrive, as it arrives. Zero disables it.
+	FirstFrameThreshold time.Duration
+	// StreamThreshold reports EmbedStream calls that take longer to finish.
+	// Zero disables it.
+	StreamThreshold time.Duration
+	// OnSlow, when set, receives every report. It runs on the calling
+	// goroutine, so it should be quick. Without it the report is a warning
+	// to ClientConfig.Logger.
+	OnSlow func(SlowRequestInfo)
+}
+
+// SlowRequestInfo describes a call that exceeded its SlowRequestPolicy
+// threshold.
+type SlowRequestInfo struct {
+	Method    string
+	Transport string
+	// RequestID is the client's request ID; see WithRequestID.
+	RequestID string
+	// Duration is how long the call took or, with FirstFrame, how long its
+	// first frame took, and Threshold the limit it exceeded.
+	Duration, Threshold time.Duration
+	// FirstFrame marks the report of a stream's time to first frame.
+	FirstFrame bool
+	// BatchSize is the number of inputs of an embed call, else zero.
+	BatchSize int
+	// Retried reports that the call was sent more than once.
+	Retried bool
+	// Err is the call's failure, or nil when it succeeded or, with
+	// FirstFrame, has not finished.
+	Err error
+}
+
+func (p SlowRequestPolicy) validate() error {
+	if p.Threshold < 0 || p.FirstFrameThreshold < 0 || p.StreamThreshold < 0 {
+		return errors.New("slow request thresholds must not be negative")
+	}
+	return nil
+}
+
+func (p SlowRequestPolicy) enabled() bool {
+	return p.Threshold > 0 || p.FirstFrameThreshold > 0 || p.StreamThreshold > 0
+}
+
+// WithSlowRequestThreshold reports every call taking longer than d to fn,
+// or, with a nil fn, logs a warning for it. It overrides WithConfig's
+// SlowRequests.Threshold and, when fn is set, SlowRequests.OnSlow.
+func WithSlowRequestThreshold(d time.Duration, fn func(SlowRequestInfo)) Option {
+	return func(o *clientOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("WithSlowRequestThreshold: threshold must be positive, got %v", d)
+		}
+		o.slow.Threshold = d
+		if fn != nil {
+			o.slow.OnSlow = fn
+		}
+		return nil
+	}
+}
+
+// WithSlowStreamThresholds reports EmbedStream calls whose first frame
+// takes longer than firstFrame, or which take longer than total to finish;
+// a zero threshold leaves its check off. The reports go where those of
+// WithSlowRequestThreshold do.
+func WithSlowStreamThresholds(firstFrame, total time.Duration) Option {
+	return func(o *clientOptions) error {
+		if firstFrame < 0 || total < 0 {
+			return errors.New("WithSlowStreamThresholds: thresholds must not be negative")
+		}
+		o.slow.FirstFrameThreshold, o.slow.StreamThreshold = firstFrame, total
+		return nil
+	}
+}
+
+// slowReporter returns the OnSlow of p, defaulting to a warning on log.
+func (p SlowRequestPolicy) slowReporter(log *slog.Logger) func(SlowRequestInfo) {
+	if p.OnSlow != nil {
+		return p.OnSlow
+	}
+	return func(info SlowRequestInfo) {
+		attrs := []any{"method", info.Method, "transport", info.Transport, "request_id", info.RequestID,
+			"elapsed", info.Duration, "threshold", info.Threshold, "batch_size", info.BatchSize, "retried", info.Retried}
+		msg := "slow request"
+		if info.FirstFrame {
+			msg = "slow first stream frame"
+		}
+		if info.Err != nil {
+			attrs = append(attrs, "error", info.Err)
+		}
+		log.Warn(msg, attrs...)
+	}
+}
+
+// slowWatchKey carries the slowWatch of a call, which interceptRetry marks
+// when it repeats the call.
+type slowWatchKey struct{}
+
+// slowWatch times one call against the thresholds of ClientConfig.SlowRequests.
+type slowWatch struct {
+	start   time.Time
+	info    SlowRequestInfo
+	retried atomic.Bool
+}
+
+// watchSlow starts timing req, a call with batch inputs.
+func (c *Client) watchSlow(req *Request, batch int) *slowWatch {
+	return &slowWatch{
+		start: time.Now(),
+		info:  SlowRequestInfo{Method: req.Method, Transport: c.transport.Kind(), RequestID: req.Meta.RequestID, BatchSize: batch},
+	}
+}
+
+// check reports the call, or with firstFrame its first frame, when it took
+// longer than a positive threshold; err is the call's outcome.
+func (w *slowWatch) check(c *Client, threshold time.Duration, firstFrame bool, err error) {
+	elapsed := time.Since(w.start)
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+	info := w.info
+	info.Duration, info.Threshold, info.FirstFrame, info.Retried, info.Err = elapsed, threshold, firstFrame, w.retried.Load(), err
+	c.onSlow(info)
+}
+
+// batchSize returns the number of inputs of embed params.
+func batchSize(params any) int {
+	if p, ok := params.(embedParams); ok {
+		return len(p.Inputs)
+	}
+	return 0
+}
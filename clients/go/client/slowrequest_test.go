@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlowRequest(t *testing.T) {
+	var logs syncBuffer
+	var attempts atomic.Int32
+	// The first embed attempt fails, the retry is slow.
+	flaky := func(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+		if req.Method != MethodEmbed {
+			return next(ctx, req)
+		}
+		if attempts.Add(1) == 1 {
+			return nil, ErrConnectionLost
+		}
+		time.Sleep(20 * time.Millisecond)
+		return next(ctx, req)
+	}
+	c, err := NewClient("", WithConfig(ClientConfig{
+		Transport: TransportInProc,
+		Handler:   inprocHandler(defaultHandler),
+		Retry:     RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}), WithInterceptor(flaky), WithSlowRequestThreshold(10*time.Millisecond, nil),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := c.Call(context.Background(), MethodEmbed, embedParams{Inputs: []string{"a", "b"}}, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	out := logs.String()
+	if strings.Count(out, "slow request") != 1 {
+		t.Fatalf("want one warning, for the embed:\n%s", out)
+	}
+	for _, want := range []string{"level=WARN", "method=mcp.embed", "transport=inproc", "batch_size=2", "retried=true", "threshold=10ms", "request_id="} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("warning misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSlowStream(t *testing.T) {
+	h := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	var mu sync.Mutex
+	var reports []SlowRequestInfo
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, SlowRequests: SlowRequestPolicy{
+		FirstFrameThreshold: 10 * time.Millisecond,
+		StreamThreshold:     time.Hour,
+		OnSlow: func(info SlowRequestInfo) {
+			mu.Lock()
+			reports = append(reports, info)
+			mu.Unlock()
+		},
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	if results := collect(t, ch); len(results) != 3 {
+		t.Fatalf("results %+v", results)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 1 {
+		t.Fatalf("want one report, of the first frame: %+v", reports)
+	}
+	r := reports[0]
+	if !r.FirstFrame || r.Method != MethodEmbedStream || r.BatchSize != 3 || r.Duration < 20*time.Millisecond || len(r.RequestID) != 26 {
+		t.Fatalf("report %+v", r)
+	}
+}
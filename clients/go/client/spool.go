@@ -0,0 +1,664 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSpoolMaxBytes bounds a Spool whose SpoolOptions set no MaxBytes.
+const DefaultSpoolMaxBytes = 64 << 20
+
+// DefaultSpoolRetryInterval is how often a Client retries the oldest entry
+// of its Spool while the server stays unreachable.
+const DefaultSpoolRetryInterval = 5 * time.Second
+
+// spoolVersion is the version of the entry files of a Spool.
+const spoolVersion = 1
+
+// spoolCorruptDir is the subdirectory OpenSpool moves unreadable entries
+// to, for an operator to look at.
+const spoolCorruptDir = "corrupt"
+
+// ErrSpooled matches the *SpooledError of a call that was spooled instead
+// of failing.
+var ErrSpooled = errors.New("spooled for replay")
+
+// ErrSpoolFull reports a call that failed to reach the server and could
+// not be spooled either, the Spool being at SpoolOptions.MaxBytes or
+// MaxEntries.
+var ErrSpoolFull = errors.New("spool full")
+
+// SpoolID names an entry of a Spool. IDs grow with every entry, and
+// replays go in their order.
+type SpoolID uint64
+
+// SpoolOptions configures a Spool.
+type SpoolOptions struct {
+	// MaxBytes bounds the entry files together. Zero selects
+	// DefaultSpoolMaxBytes.
+	MaxBytes int64
+	// MaxEntries bounds the entries. Zero means no limit beyond MaxBytes.
+	MaxEntries int
+	// RetryInterval is how long the client waits to try the oldest entry
+	// again after a replay failed to reach the server. Zero selects
+	// DefaultSpoolRetryInterval.
+	RetryInterval time.Duration
+	// OnComplete, when set, is called with the result of every entry
+	// replayed, including entries spooled before a restart, whose callers
+	// hold no SpoolHandle. It is called from the replaying goroutine, one
+	// entry at a time in order, before the entry's SpoolHandle is done, and
+	// holds up the next replay until it returns.
+	OnComplete func(SpoolResult)
+}
+
+// SpoolResult is the outcome of a spooled call once replayed.
+type SpoolResult struct {
+	ID SpoolID
+	// Model is the model the call embedded with, and Inputs its texts.
+	Model  string
+	Inputs []string
+	// Vectors holds a vector per input, as EmbedBatch returns them, or
+	// nil when Err is set.
+	Vectors [][]float32
+	// Err is the error the replay failed with, one other than the
+	// connection failures it is retried after.
+	Err error
+	// SpooledAt is when the call was spooled, and Lag how long it waited
+	// for its result.
+	SpooledAt time.Time
+	Lag       time.Duration
+}
+
+// SpoolStats describes a Spool.
+type SpoolStats struct {
+	Dir string
+	// Entries counts the entries awaiting replay, and Models them by
+	// model.
+	Entries int
+	Models  map[string]int
+	// Bytes is the size of their files.
+	Bytes int64
+	// Oldest is when the oldest entry was spooled, zero with none.
+	Oldest time.Time
+	// Corrupt counts the entries OpenSpool could not read and moved to
+	// the corrupt subdirectory.
+	Corrupt int
+}
+
+// Spool is a durable queue of embed calls made while the server was
+// unreachable, for deployments that lose connectivity and would rather
+// wait for their vectors than fail. Set it as ClientConfig.Spool, or with
+// WithSpool, and pass WithSpoolOnFailure to the calls that may wait: when
+// such a call fails because the circuit breaker is open or the server
+// cannot be reached, its inputs are written to the spool and the call
+// returns a *SpooledError instead. The client replays the entries one at
+// a time, oldest first, as soon as the server answers again, delivering
+// each result to the entry's SpoolHandle and to SpoolOptions.OnComplete.
+//
+// Each entry is a file of its own in the spool's directory, written to a
+// temporary name, synced, and renamed into place, so a crash loses at most
+// the entry being written. The entries outlive the process: OpenSpool
+// picks them up again, moving any it cannot read, such as one torn by a
+// full disk, to the corrupt subdirectory rather than give up on the rest.
+// A Spool serves one Client at a time, and only one process may use its
+// directory.
+type Spool struct {
+	dir  string
+	opts SpoolOptions
+	now  func() time.Time
+
+	mu sync.Mutex
+	// entries are those awaiting replay, in ID order.
+	entries []spoolRef
+	bytes   int64
+	next    SpoolID
+	corrupt int
+	// handles are the SpoolHandles given out for pending entries.
+	handles map[SpoolID]*SpoolHandle
+	// owner is the Client replaying the entries, and metrics its metrics.
+	owner   *Client
+	metrics *clientMetrics
+	// wake is signalled when an entry is added.
+	wake chan struct{}
+
+	// replaying serializes replays, so each entry is delivered once.
+	replaying sync.Mutex
+}
+
+// spoolRef locates a pending entry.
+type spoolRef struct {
+	id        SpoolID
+	model     string
+	size      int64
+	spooledAt time.Time
+}
+
+// spoolRecord is the content of an entry file.
+type spoolRecord struct {
+	Version    int       `json:"version"`
+	ID         SpoolID   `json:"id"`
+	SpooledAt  time.Time `json:"spooled_at"`
+	Model      string    `json:"model,omitempty"`
+	Dimensions int       `json:"dimensions,omitempty"`
+	Inputs     []string  `json:"inputs"`
+	// InputHash is the InputsHash of Inputs, which a torn or altered
+	// file fails to match.
+	InputHash string `json:"input_hash"`
+}
+
+// OpenSpool opens the spool in dir, creating the directory when it does
+// not exist, and loads the entries left in it.
+func OpenSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	if opts.MaxBytes < 0 || opts.MaxEntries < 0 || opts.RetryInterval < 0 {
+		return nil, errors.New("spool max bytes, max entries, and retry interval must not be negative")
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = DefaultSpoolMaxBytes
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = DefaultSpoolRetryInterval
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	s := &Spool{dir: dir, opts: opts, now: time.Now, next: 1, handles: make(map[SpoolID]*SpoolHandle), wake: make(chan struct{}, 1)}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("spool %s: %w", dir, err)
+	}
+	return s, nil
+}
+
+// load reads the entries of s.dir, dropping the temporary files of writes
+// a crash interrupted and setting aside the entries it cannot read.
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		id, ok := spoolFileID(name)
+		if !ok {
+			continue
+		}
+		s.next = max(s.next, id+1)
+		path := filepath.Join(s.dir, name)
+		rec, size, err := readSpoolRecord(path, id)
+		if err != nil {
+			if err := s.setAside(name); err != nil {
+				return err
+			}
+			continue
+		}
+		s.entries = append(s.entries, spoolRef{id: id, model: rec.Model, size: size, spooledAt: rec.SpooledAt})
+		s.bytes += size
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].id < s.entries[j].id })
+	return nil
+}
+
+// setAside moves the entry file name to the corrupt subdirectory.
+func (s *Spool) setAside(name string) error {
+	dir := filepath.Join(s.dir, spoolCorruptDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(s.dir, name), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	s.corrupt++
+	return nil
+}
+
+// spoolFileName is the name of the file of entry id, which sorts in ID
+// order.
+func spoolFileName(id SpoolID) string {
+	return fmt.Sprintf("%020d.json", uint64(id))
+}
+
+// spoolFileID returns the ID of the entry file name.
+func spoolFileID(name string) (SpoolID, bool) {
+	digits, ok := strings.CutSuffix(name, ".json")
+	if !ok || len(digits) != 20 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(digits, 10, 64)
+	return SpoolID(id), err == nil && id > 0
+}
+
+// readSpoolRecord reads and checks the entry file at path, which should
+// hold entry id, returning it and its size.
+func readSpoolRecord(path string, id SpoolID) (spoolRecord, int64, error) {
+	var rec spoolRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rec, 0, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, 0, err
+	}
+	switch {
+	case rec.Version != spoolVersion:
+		return rec, 0, fmt.Errorf("spool entry version %d, want %d", rec.Version, spoolVersion)
+	case rec.ID != id:
+		return rec, 0, fmt.Errorf("spool entry %d in the file of %d", rec.ID, id)
+	case rec.InputHash != InputsHash(rec.Inputs):
+		return rec, 0, errors.New("spool entry does not match its input hash")
+	}
+	return rec, int64(len(data)), nil
+}
+
+// Dir returns the spool's directory.
+func (s *Spool) Dir() string { return s.dir }
+
+// Stats describes the entries awaiting replay.
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SpoolStats{Dir: s.dir, Entries: len(s.entries), Models: make(map[string]int), Bytes: s.bytes, Corrupt: s.corrupt}
+	for _, e := range s.entries {
+		st.Models[e.model]++
+	}
+	if len(s.entries) > 0 {
+		st.Oldest = s.entries[0].spooledAt
+	}
+	return st
+}
+
+// Handle returns the SpoolHandle of entry id while it awaits replay, for
+// entries spooled before a restart; false once it has been replayed or if
+// there is no such entry.
+func (s *Spool) Handle(id SpoolID) (*SpoolHandle, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.id == id {
+			return s.handle(id), true
+		}
+	}
+	return nil, false
+}
+
+// handle returns the SpoolHandle of pending entry id, making it on first
+// use. The caller holds mu.
+func (s *Spool) handle(id SpoolID) *SpoolHandle {
+	h, ok := s.handles[id]
+	if !ok {
+		h = &SpoolHandle{id: id, done: make(chan struct{})}
+		s.handles[id] = h
+	}
+	return h
+}
+
+// depth returns the number of entries awaiting replay.
+func (s *Spool) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// attach makes c the client replaying s, failing when another one is.
+func (s *Spool) attach(c *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner != nil {
+		return fmt.Errorf("spool %s already serves another client", s.dir)
+	}
+	s.owner, s.metrics = c, c.metrics
+	s.metrics.spoolDepth(len(s.entries))
+	return nil
+}
+
+// detach releases s from c once c is closed.
+func (s *Spool) detach(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner == c {
+		s.metrics.spoolDepth(-len(s.entries))
+		s.owner, s.metrics = nil, nil
+	}
+}
+
+// add spools a call embedding inputs with model, returning its handle.
+func (s *Spool) add(model string, dimensions int, inputs []string) (*SpoolHandle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := spoolRecord{Version: spoolVersion, ID: s.next, SpooledAt: s.now().UTC(), Model: model, Dimensions: dimensions, Inputs: inputs, InputHash: InputsHash(inputs)}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(data)) + 1
+	switch {
+	case s.opts.MaxEntries > 0 && len(s.entries) >= s.opts.MaxEntries:
+		return nil, fmt.Errorf("%w: %d entries", ErrSpoolFull, len(s.entries))
+	case s.bytes+size > s.opts.MaxBytes:
+		return nil, fmt.Errorf("%w: %d of %d bytes used, the call needs %d", ErrSpoolFull, s.bytes, s.opts.MaxBytes, size)
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, spoolFileName(rec.ID)), append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	s.next++
+	s.entries = append(s.entries, spoolRef{id: rec.ID, model: model, size: size, spooledAt: rec.SpooledAt})
+	s.bytes += size
+	if s.metrics != nil {
+		s.metrics.spooled()
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.handle(rec.ID), nil
+}
+
+// head returns the oldest entry awaiting replay.
+func (s *Spool) head() (spoolRef, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return spoolRef{}, false
+	}
+	return s.entries[0], true
+}
+
+// replayHead replays the oldest entry with c, returning the result it
+// delivered, or nil with no entry to replay. An entry whose replay could
+// not reach the server, or was cut short by ctx, stays in the spool and
+// its error is returned.
+func (s *Spool) replayHead(ctx context.Context, c *Client) (*SpoolResult, error) {
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+	ref, ok := s.head()
+	if !ok {
+		return nil, nil
+	}
+	name := spoolFileName(ref.id)
+	rec, _, err := readSpoolRecord(filepath.Join(s.dir, name), ref.id)
+	if err != nil {
+		// The file changed under the spool since it was opened.
+		s.mu.Lock()
+		aerr := s.setAside(name)
+		s.mu.Unlock()
+		return s.complete(ref, SpoolResult{ID: ref.id, Model: ref.model, Err: fmt.Errorf("spool entry %d: %w", ref.id, err)}), aerr
+	}
+	opts := []EmbedOption{withoutSpool()}
+	if rec.Model != "" {
+		opts = append(opts, WithModel(rec.Model))
+	}
+	if rec.Dimensions > 0 {
+		opts = append(opts, WithDimensions(rec.Dimensions))
+	}
+	vectors, err := c.EmbedBatch(ctx, rec.Inputs, opts...)
+	if err != nil && (ctx.Err() != nil || spoolable(err)) {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	result := SpoolResult{ID: rec.ID, Model: rec.Model, Inputs: rec.Inputs, Vectors: vectors, Err: err}
+	if err != nil {
+		result.Vectors = nil
+	}
+	return s.complete(ref, result), nil
+}
+
+// complete drops the replayed entry ref and delivers its result.
+func (s *Spool) complete(ref spoolRef, result SpoolResult) *SpoolResult {
+	result.SpooledAt, result.Lag = ref.spooledAt, s.now().Sub(ref.spooledAt)
+	s.mu.Lock()
+	s.entries = s.entries[1:]
+	s.bytes -= ref.size
+	h := s.handles[ref.id]
+	delete(s.handles, ref.id)
+	if s.metrics != nil {
+		s.metrics.spoolReplayed(result.Lag)
+	}
+	s.mu.Unlock()
+	if s.opts.OnComplete != nil {
+		s.opts.OnComplete(result)
+	}
+	if h != nil {
+		h.result = result
+		close(h.done)
+	}
+	return &result
+}
+
+// spoolable reports whether err is a failure to reach the server, after
+// which a WithSpoolOnFailure call is spooled and a replay retried.
+func spoolable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || isConnectionError(err)
+}
+
+// SpoolHandle follows a spooled call until its replay.
+type SpoolHandle struct {
+	id     SpoolID
+	done   chan struct{}
+	result SpoolResult
+}
+
+// ID returns the entry's ID.
+func (h *SpoolHandle) ID() SpoolID { return h.id }
+
+// Done returns a channel closed once the entry has been replayed.
+func (h *SpoolHandle) Done() <-chan struct{} { return h.done }
+
+// Poll returns the entry's result, and false while it awaits replay.
+func (h *SpoolHandle) Poll() (SpoolResult, bool) {
+	select {
+	case <-h.done:
+		return h.result, true
+	default:
+		return SpoolResult{}, false
+	}
+}
+
+// Wait blocks until the entry has been replayed, returning its result, or
+// until ctx ends.
+func (h *SpoolHandle) Wait(ctx context.Context) (SpoolResult, error) {
+	select {
+	case <-h.done:
+		return h.result, nil
+	case <-ctx.Done():
+		return SpoolResult{}, ctx.Err()
+	}
+}
+
+// SpooledError is returned by a WithSpoolOnFailure call that failed to
+// reach the server and was spooled for replay. It matches ErrSpooled and
+// the failure that spooled it.
+type SpooledError struct {
+	// Handle follows the spooled call to its result.
+	Handle *SpoolHandle
+	// Err is the failure that spooled the call.
+	Err error
+}
+
+func (e *SpooledError) Error() string {
+	return fmt.Sprintf("spooled as entry %d for replay: %v", e.Handle.ID(), e.Err)
+}
+
+func (e *SpooledError) Unwrap() []error { return []error{ErrSpooled, e.Err} }
+
+// WithSpoolOnFailure marks a call that may wait for its vectors: when it
+// fails because the circuit breaker is open or the server cannot be
+// reached, its inputs go to ClientConfig.Spool and it returns a
+// *SpooledError whose Handle delivers the vectors once the call has been
+// replayed. The whole call is spooled, with its model and WithDimensions;
+// its other options are not kept, and the replay runs with the client's
+// defaults. Calls failing otherwise, or whose ctx ends, fail as usual, and
+// without a Spool the option has no effect.
+func WithSpoolOnFailure() EmbedOption {
+	return func(o *embedOptions) { o.spool = true }
+}
+
+// withoutSpool undoes WithSpoolOnFailure, for the call a spooling one
+// makes and for replays.
+func withoutSpool() EmbedOption {
+	return func(o *embedOptions) { o.spool = false }
+}
+
+// WithSpool sets ClientConfig.Spool. It overrides WithConfig's Spool.
+func WithSpool(s *Spool) Option {
+	return func(o *clientOptions) error {
+		if s == nil {
+			return errors.New("WithSpool: spool must not be nil")
+		}
+		o.spool = s
+		return nil
+	}
+}
+
+// embedOrSpool makes a WithSpoolOnFailure embed call of texts, with o and
+// opts, and spools it when it fails to reach the server.
+func (c *Client) embedOrSpool(ctx context.Context, texts []string, o embedOptions, opts []EmbedOption) ([][]float32, error) {
+	vectors, err := c.EmbedBatch(ctx, texts, append(opts[:len(opts):len(opts)], withoutSpool())...)
+	if err == nil || ctx.Err() != nil || !spoolable(err) {
+		return vectors, err
+	}
+	h, serr := c.cfg.Spool.add(o.model, o.dimensions, texts)
+	if serr != nil {
+		return vectors, fmt.Errorf("%w (not spooled: %w)", err, serr)
+	}
+	c.log.Info("spooled embed call", "entry", uint64(h.ID()), "inputs", len(texts), "err", err)
+	return nil, &SpooledError{Handle: h, Err: err}
+}
+
+// spoolReplayer replays the entries of ClientConfig.Spool in the
+// background until stop is closed.
+type spoolReplayer struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startSpool attaches ClientConfig.Spool to c and starts replaying it.
+func (c *Client) startSpool() {
+	s := c.cfg.Spool
+	if err := s.attach(c); err != nil {
+		c.log.Error("spool", "err", err)
+		c.cfg.Spool = nil
+		return
+	}
+	r := &spoolReplayer{stop: make(chan struct{}), done: make(chan struct{})}
+	c.spooler = r
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-r.stop
+		cancel()
+	}()
+	go func() {
+		defer close(r.done)
+		for {
+			if s.depth() == 0 {
+				select {
+				case <-s.wake:
+				case <-r.stop:
+					return
+				}
+				continue
+			}
+			if _, err := s.replayHead(ctx, c); err != nil {
+				if ctx.Err() == nil && !spoolable(err) {
+					c.log.Error("spool replay", "err", err)
+				}
+				select {
+				case <-time.After(s.opts.RetryInterval):
+				case <-r.stop:
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopSpool stops replaying ClientConfig.Spool, leaving the entries not
+// yet replayed in it, and releases it.
+func (c *Client) stopSpool() {
+	if c.spooler == nil {
+		return
+	}
+	close(c.spooler.stop)
+	<-c.spooler.done
+	c.cfg.Spool.detach(c)
+}
+
+// SpoolDrain counts what DrainSpool replayed.
+type SpoolDrain struct {
+	// Replayed counts the entries replayed, and Failed those of them
+	// whose replay failed with an error other than a connection failure.
+	Replayed, Failed int
+	// Left counts the entries still awaiting replay.
+	Left int
+}
+
+// DrainSpool replays the entries of ClientConfig.Spool now, oldest first,
+// until none is left, instead of waiting for the background replay. It
+// stops at the first replay that fails to reach the server, returning its
+// error with the entries left.
+func (c *Client) DrainSpool(ctx context.Context) (SpoolDrain, error) {
+	var d SpoolDrain
+	s := c.cfg.Spool
+	if s == nil {
+		return d, errors.New("drain spool: no spool configured")
+	}
+	for {
+		result, err := s.replayHead(ctx, c)
+		if result != nil {
+			d.Replayed++
+			if result.Err != nil {
+				d.Failed++
+			}
+		}
+		d.Left = s.depth()
+		if err != nil {
+			return d, fmt.Errorf("drain spool: %w", err)
+		}
+		if result == nil {
+			return d, nil
+		}
+	}
+}
+
+// RunSpoolDrain replays the entries of opts.Config.Spool against the
+// server described by opts, as DrainSpool does, and writes what it
+// replayed to opts.Progress. Entries whose replay failed for another
+// reason than the server being unreachable are delivered and dropped; the
+// call fails when any did, or when entries are left.
+func RunSpoolDrain(ctx context.Context, opts Options) (err error) {
+	if opts.Config.Spool == nil {
+		return errors.New("drain spool: no spool configured")
+	}
+	o, err := opts.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := o.build()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, c.Close(context.Background())) }()
+	d, err := c.DrainSpool(ctx)
+	if opts.Progress != nil {
+		fmt.Fprintf(opts.Progress, "drained %d spooled entries, %d failed, %d left\n", d.Replayed, d.Failed, d.Left)
+	}
+	if err == nil && d.Failed > 0 {
+		err = fmt.Errorf("drain spool: %d entries failed", d.Failed)
+	}
+	return err
+}
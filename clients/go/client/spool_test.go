@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyStub answers as defaultHandler does while up, and otherwise fails
+// to connect.
+func flakyStub(up *atomic.Bool) *stubTransport {
+	refused := fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	return &stubTransport{kind: "stub", fn: func(req *Request) (*Response, error) {
+		if !up.Load() {
+			return nil, refused
+		}
+		resp := defaultHandler(req)
+		if strings.Contains(string(req.Params), "rejected") {
+			resp.Result, resp.Error = nil, &RPCError{Code: -32602, Message: "input rejected"}
+		}
+		return resp, nil
+	}}
+}
+
+func TestSpoolReplaysInOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		results []SpoolResult
+	)
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{RetryInterval: time.Millisecond, OnComplete: func(r SpoolResult) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up atomic.Bool
+	sink := NewPrometheusSink()
+	c := NewWithTransport(ClientConfig{Spool: spool, Metrics: sink, CircuitBreaker: CircuitBreaker{Threshold: 1, Cooldown: time.Minute}}, flakyStub(&up))
+	defer c.Close(context.Background())
+	var elapsed atomic.Int64
+	start := time.Now()
+	c.breaker.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	ctx := context.Background()
+
+	// Without the option a call fails as usual.
+	if _, err := c.Embed(ctx, "a"); !errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, ErrSpooled) {
+		t.Fatalf("Embed without WithSpoolOnFailure: %v", err)
+	}
+	var first, second *SpooledError
+	if _, err := c.EmbedBatch(ctx, []string{"a", "bb"}, WithSpoolOnFailure()); !errors.As(err, &first) || !errors.Is(err, ErrSpooled) {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	// The breaker is open by now.
+	if _, err := c.Embed(ctx, "ccc", WithSpoolOnFailure(), WithModel("m2")); !errors.As(err, &second) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, ok := first.Handle.Poll(); ok {
+		t.Fatal("a result before the server is up")
+	}
+	if st := spool.Stats(); st.Entries != 2 || st.Models[c.Config().Model] != 1 || st.Models["m2"] != 1 {
+		t.Fatalf("spool stats %+v", st)
+	}
+
+	// Replays wait for the breaker's probe.
+	up.Store(true)
+	elapsed.Store(int64(time.Minute))
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	r1, err := first.Handle.Wait(waitCtx)
+	if err != nil || r1.Err != nil || !reflect.DeepEqual(r1.Vectors, [][]float32{{1, 0.5, -0.5}, {2, 0.5, -0.5}}) {
+		t.Fatalf("first result %+v, %v", r1, err)
+	}
+	r2, err := second.Handle.Wait(waitCtx)
+	if err != nil || r2.Model != "m2" || !reflect.DeepEqual(r2.Vectors, [][]float32{{3, 0.5, -0.5}}) {
+		t.Fatalf("second result %+v, %v", r2, err)
+	}
+	mu.Lock()
+	if len(results) != 2 || results[0].ID != first.Handle.ID() || results[1].ID != second.Handle.ID() || results[0].Lag <= 0 {
+		t.Fatalf("OnComplete got %+v", results)
+	}
+	mu.Unlock()
+	if files, _ := filepath.Glob(filepath.Join(spool.Dir(), "*.json")); len(files) != 0 {
+		t.Fatalf("replayed entries left behind: %v", files)
+	}
+
+	s := c.Stats()
+	if s.SpoolDepth != 0 || s.Spooled != 2 || s.Replayed != 2 || s.ReplayLag.Count != 2 {
+		t.Fatalf("stats: depth %d, spooled %d, replayed %d, lag %+v", s.SpoolDepth, s.Spooled, s.Replayed, s.ReplayLag)
+	}
+	rec := httptest.NewRecorder()
+	sink.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`embednexus_client_spool_depth{transport="stub"} 0`,
+		`embednexus_client_spool_replay_lag_seconds_count{transport="stub"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("scrape lacks %s:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestSpoolRecovery(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up atomic.Bool
+	c := NewWithTransport(ClientConfig{Spool: spool}, flakyStub(&up))
+	ctx := context.Background()
+	for _, text := range []string{"a", "bb", "ccc"} {
+		if _, err := c.Embed(ctx, text, WithSpoolOnFailure()); !errors.Is(err, ErrSpooled) {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+	}
+	c.Close(ctx)
+
+	// A crash tears the second entry and leaves a temporary file.
+	torn := filepath.Join(dir, spoolFileName(2))
+	data, err := os.ReadFile(torn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(torn, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, spoolFileName(4)+".123.tmp"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var replayed []string
+	spool, err = OpenSpool(dir, SpoolOptions{RetryInterval: time.Millisecond, OnComplete: func(r SpoolResult) { replayed = append(replayed, r.Inputs...) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := spool.Stats(); st.Entries != 2 || st.Corrupt != 1 || st.Oldest.IsZero() {
+		t.Fatalf("stats after recovery %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(dir, spoolCorruptDir, spoolFileName(2))); err != nil {
+		t.Fatalf("torn entry not set aside: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(files) != 0 {
+		t.Fatalf("temporary files left: %v", files)
+	}
+	h, ok := spool.Handle(3)
+	if !ok {
+		t.Fatal("no handle for a recovered entry")
+	}
+	if _, ok := spool.Handle(2); ok {
+		t.Fatal("a handle for the torn entry")
+	}
+
+	up.Store(true)
+	c = NewWithTransport(ClientConfig{Spool: spool}, flakyStub(&up))
+	defer c.Close(ctx)
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if r, err := h.Wait(waitCtx); err != nil || !reflect.DeepEqual(r.Vectors, [][]float32{{3, 0.5, -0.5}}) {
+		t.Fatalf("recovered result %+v, %v", r, err)
+	}
+	if !reflect.DeepEqual(replayed, []string{"a", "ccc"}) {
+		t.Fatalf("replayed %v", replayed)
+	}
+	// New entries follow the recovered ones.
+	up.Store(false)
+	var spooled *SpooledError
+	if _, err := c.Embed(ctx, "d", WithSpoolOnFailure()); !errors.As(err, &spooled) || spooled.Handle.ID() != 4 {
+		t.Fatalf("Embed after recovery: %v", err)
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{MaxEntries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up atomic.Bool
+	c := NewWithTransport(ClientConfig{Spool: spool}, flakyStub(&up))
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "a", WithSpoolOnFailure()); !errors.Is(err, ErrSpooled) {
+		t.Fatalf("first call: %v", err)
+	}
+	_, err = c.Embed(ctx, "b", WithSpoolOnFailure())
+	if !errors.Is(err, ErrSpoolFull) || !errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, ErrSpooled) {
+		t.Fatalf("call over MaxEntries: %v", err)
+	}
+
+	tiny, err := OpenSpool(t.TempDir(), SpoolOptions{MaxBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewWithTransport(ClientConfig{Spool: tiny}, flakyStub(&up))
+	defer c2.Close(ctx)
+	if _, err := c2.Embed(ctx, strings.Repeat("x", 100), WithSpoolOnFailure()); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("call over MaxBytes: %v", err)
+	}
+	// A second client cannot replay the same spool.
+	c3 := NewWithTransport(ClientConfig{Spool: spool}, flakyStub(&up))
+	defer c3.Close(ctx)
+	if c3.Config().Spool != nil {
+		t.Fatal("a spool attached to two clients")
+	}
+}
+
+func TestDrainSpool(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up atomic.Bool
+	c := NewWithTransport(ClientConfig{Spool: spool}, flakyStub(&up))
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	for _, text := range []string{"a", "rejected", "ccc"} {
+		if _, err := c.Embed(ctx, text, WithSpoolOnFailure()); !errors.Is(err, ErrSpooled) {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+	}
+	if d, err := c.DrainSpool(ctx); !errors.Is(err, syscall.ECONNREFUSED) || d != (SpoolDrain{Left: 3}) {
+		t.Fatalf("DrainSpool while down = %+v, %v", d, err)
+	}
+	up.Store(true)
+	// The input the server rejects is delivered and dropped.
+	h, _ := spool.Handle(2)
+	if d, err := c.DrainSpool(ctx); err != nil || d != (SpoolDrain{Replayed: 3, Failed: 1}) {
+		t.Fatalf("DrainSpool = %+v, %v", d, err)
+	}
+	var apiErr *APIError
+	if r, ok := h.Poll(); !ok || !errors.As(r.Err, &apiErr) || r.Vectors != nil {
+		t.Fatalf("rejected entry's result %+v, %v", r, ok)
+	}
+	if st := spool.Stats(); st.Entries != 0 || st.Bytes != 0 {
+		t.Fatalf("spool after draining %+v", st)
+	}
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of a Client's activity. The counters run from when
+// the client was built or last had ResetStats called, and are read together,
+// so they agree with each other.
+type Stats struct {
+	// InFlight is the number of requests sent and not yet answered,
+	// including open streams.
+	InFlight int
+	// Waiting is the number of calls blocked on ClientConfig.MaxInFlight,
+	// and WaitingByPriority the same by the priority they wait with.
+	Waiting           int
+	WaitingByPriority map[Priority]int
+	// MaxInFlight is the configured limit, or 0 when unlimited.
+	MaxInFlight int
+
+	// Requests counts the requests sent by method, each retry and stream
+	// included.
+	Requests map[string]int64
+	// Errors counts the failed requests by ErrorClass.
+	Errors map[string]int64
+	// Retries counts the requests repeated under ClientConfig.Retry.
+	Retries int64
+	// Hedges counts the copies of slow requests sent under
+	// ClientConfig.Hedging, and HedgeWins those answering first.
+	Hedges, HedgeWins int64
+	// CacheHits and CacheMisses count embedding cache lookups.
+	CacheHits, CacheMisses int64
+	// BytesSent and BytesReceived count request params and response
+	// results and errors, before any compression, and RequestsTooLarge
+	// the requests refused unsent for exceeding ClientConfig.MaxRequestBytes
+	// or WithMaxRequestBytes.
+	BytesSent, BytesReceived int64
+	RequestsTooLarge         int64
+	// NewConnections counts the connections the transports opened, stdio
+	// restarts included, and ReusedConnections the requests the http, tls,
+	// and http3 transports sent over a pooled one already open.
+	NewConnections, ReusedConnections int64
+	// Latency digests the round trips of the requests.
+	Latency LatencyStats
+	// Coalesced counts the embed inputs ClientConfig.Coalescing held for a
+	// batch, and CoalescedBatches the requests they went out in.
+	Coalesced, CoalescedBatches int64
+	// CoalesceDelay digests how long those inputs waited for their batch
+	// to be sent, the latency coalescing added to their calls.
+	CoalesceDelay LatencyStats
+	// Deduplicated counts the Embed calls ClientConfig.SingleFlight
+	// answered with a request another call already had in flight.
+	Deduplicated int64
+	// Notifications counts the notifications the server pushed that were
+	// delivered, to a handler or Client.Notifications, and
+	// NotificationsDropped those a full buffer dropped.
+	Notifications, NotificationsDropped int64
+	// Addresses is what the endpoint host names resolve to under
+	// ClientConfig.DNS, by name; nil without it.
+	Addresses map[string][]string
+	// Endpoints is the health of each endpoint of WithEndpoints, in their
+	// order; nil with a single endpoint.
+	Endpoints []EndpointScore
+	// CapabilitiesAge is how long ago the cached model list was fetched,
+	// 0 when none is, and CapabilityRefreshes counts the listings that
+	// refreshed it, each shared by the calls waiting for it.
+	CapabilitiesAge     time.Duration
+	CapabilityRefreshes int64
+	// SpoolDepth is the number of entries of ClientConfig.Spool awaiting
+	// replay. Spooled counts the WithSpoolOnFailure calls spooled, and
+	// Replayed the entries replayed, whose waits ReplayLag digests.
+	SpoolDepth        int
+	Spooled, Replayed int64
+	ReplayLag         LatencyStats
+}
+
+// LatencyStats summarizes request latencies. The percentiles are accurate
+// to within 5%.
+type LatencyStats struct {
+	Count         int64
+	P50, P95, P99 time.Duration
+	Max           time.Duration
+}
+
+// Stats reports the client's outstanding requests and its counters. It
+// takes one short lock and copies two small maps, so it is cheap enough to
+// poll.
+func (c *Client) Stats() Stats {
+	s := c.metrics.stats.snapshot()
+	s.InFlight = int(c.inFlight.count.Load())
+	s.WaitingByPriority = c.inFlight.waiting()
+	for _, n := range s.WaitingByPriority {
+		s.Waiting += n
+	}
+	s.MaxInFlight = c.inFlight.limit
+	if at, ok := c.transport.(interface{ addresses() map[string][]string }); ok {
+		s.Addresses = at.addresses()
+	}
+	if st, ok := c.transport.(interface{ scores() []EndpointScore }); ok {
+		s.Endpoints = st.scores()
+	}
+	s.CapabilitiesAge = c.capabilities.age(c.now())
+	if c.cfg.Spool != nil {
+		s.SpoolDepth = c.cfg.Spool.depth()
+	}
+	return s
+}
+
+// ResetStats zeroes the counters of Stats. Requests in flight and the
+// embedding cache's CacheStats are unaffected.
+func (c *Client) ResetStats() {
+	c.metrics.stats.reset()
+}
+
+// runtimeStats holds the counters of Stats.
+type runtimeStats struct {
+	mu            sync.Mutex
+	s             Stats
+	latency       latencyDigest
+	coalesceDelay latencyDigest
+	replayLag     latencyDigest
+}
+
+func newRuntimeStats() *runtimeStats {
+	r := &runtimeStats{}
+	r.reset()
+	return r
+}
+
+func (r *runtimeStats) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.s = Stats{Requests: make(map[string]int64), Errors: make(map[string]int64)}
+	r.latency = latencyDigest{}
+	r.coalesceDelay = latencyDigest{}
+	r.replayLag = latencyDigest{}
+}
+
+func (r *runtimeStats) snapshot() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.s
+	s.Requests = make(map[string]int64, len(r.s.Requests))
+	for k, v := range r.s.Requests {
+		s.Requests[k] = v
+	}
+	s.Errors = make(map[string]int64, len(r.s.Errors))
+	for k, v := range r.s.Errors {
+		s.Errors[k] = v
+	}
+	s.Latency = r.latency.summary()
+	s.CoalesceDelay = r.coalesceDelay.summary()
+	s.ReplayLag = r.replayLag.summary()
+	return s
+}
+
+func (r *runtimeStats) request(method string, err error, elapsed time.Duration) {
+	var class string
+	if err != nil {
+		class = ErrorClass(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.s.Requests[method]++
+	if err != nil {
+		r.s.Errors[class]++
+	}
+	r.latency.add(elapsed)
+}
+
+// coalesced counts a batch of coalesced inputs, each delayed as long as
+// delays says.
+func (r *runtimeStats) coalesced(delays []time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.s.CoalescedBatches++
+	r.s.Coalesced += int64(len(delays))
+	for _, d := range delays {
+		r.coalesceDelay.add(d)
+	}
+}
+
+func (r *runtimeStats) spooled() {
+	r.mu.Lock()
+	r.s.Spooled++
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) spoolReplayed(lag time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.s.Replayed++
+	r.replayLag.add(lag)
+}
+
+func (r *runtimeStats) capabilityRefresh() {
+	r.mu.Lock()
+	r.s.CapabilityRefreshes++
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) deduplicated() {
+	r.mu.Lock()
+	r.s.Deduplicated++
+	r.mu.Unlock()
+}
+
+// notified counts a notification delivered, or one dropped.
+func (r *runtimeStats) notified(dropped bool) {
+	r.mu.Lock()
+	if dropped {
+		r.s.NotificationsDropped++
+	} else {
+		r.s.Notifications++
+	}
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) retried() {
+	r.mu.Lock()
+	r.s.Retries++
+	r.mu.Unlock()
+}
+
+// hedged counts a hedge sent, or one that won.
+func (r *runtimeStats) hedged(won bool) {
+	r.mu.Lock()
+	if won {
+		r.s.HedgeWins++
+	} else {
+		r.s.Hedges++
+	}
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) cacheLookup(hit bool) {
+	r.mu.Lock()
+	if hit {
+		r.s.CacheHits++
+	} else {
+		r.s.CacheMisses++
+	}
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) addBytes(sent bool, n int64) {
+	r.mu.Lock()
+	if sent {
+		r.s.BytesSent += n
+	} else {
+		r.s.BytesReceived += n
+	}
+	r.mu.Unlock()
+}
+
+func (r *runtimeStats) requestTooLarge() {
+	r.mu.Lock()
+	r.s.RequestsTooLarge++
+	r.mu.Unlock()
+}
+
+// connection counts a connection an http request got.
+func (r *runtimeStats) connection(reused bool) {
+	r.mu.Lock()
+	if reused {
+		r.s.ReusedConnections++
+	} else {
+		r.s.NewConnections++
+	}
+	r.mu.Unlock()
+}
+
+// Latency buckets grow by latencyGrowth from 1µs, reaching beyond an hour.
+const (
+	latencyGrowth  = 1.05
+	latencyBuckets = 460
+)
+
+// latencyDigest is a histogram of latencies in logarithmic buckets, each
+// 5% wider than the last, so its percentiles have a bounded relative error
+// in constant space.
+type latencyDigest struct {
+	counts [latencyBuckets]uint32
+	n      int64
+	max    time.Duration
+}
+
+func (d *latencyDigest) add(elapsed time.Duration) {
+	i := 0
+	if us := float64(elapsed) / float64(time.Microsecond); us > 1 {
+		i = min(int(math.Ceil(math.Log(us)/math.Log(latencyGrowth))), latencyBuckets-1)
+	}
+	d.counts[i]++
+	d.n++
+	d.max = max(d.max, elapsed)
+}
+
+func (d *latencyDigest) summary() LatencyStats {
+	s := LatencyStats{Count: d.n, Max: d.max}
+	s.P50, s.P95, s.P99 = d.quantile(0.50), d.quantile(0.95), d.quantile(0.99)
+	return s
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile,
+// capped at the largest latency seen.
+func (d *latencyDigest) quantile(q float64) time.Duration {
+	if d.n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(d.n)))
+	var seen int64
+	for i, n := range d.counts {
+		if seen += int64(n); seen >= rank {
+			bound := time.Duration(math.Pow(latencyGrowth, float64(i)) * float64(time.Microsecond))
+			return min(bound, d.max)
+		}
+	}
+	return d.max
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	var calls atomic.Int32
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, err := New(ClientConfig{
+		Transport: TransportHTTP,
+		Endpoint:  srv.URL,
+		Retry:     RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		Cache:     CacheConfig{MaxEntries: 10},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	// Stats is read throughout, as an operator polling it would.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = c.Stats()
+			}
+		}
+	}()
+	if _, err := c.Ping(context.Background()); err == nil {
+		t.Fatal("Ping skips retries, so the 503 should have failed it")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Embed(context.Background(), "cached"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	s := c.Stats()
+	if s.Requests[MethodPing] != 1 || s.Errors["api"] != 1 || s.Retries != 0 {
+		t.Fatalf("requests %v, errors %v, retries %d", s.Requests, s.Errors, s.Retries)
+	}
+	if s.CacheHits != 2 || s.CacheMisses != 1 {
+		t.Fatalf("cache hits %d, misses %d", s.CacheHits, s.CacheMisses)
+	}
+	var total int64
+	for _, n := range s.Requests {
+		total += n
+	}
+	if s.Latency.Count != total || s.Latency.P50 > s.Latency.P95 || s.Latency.P95 > s.Latency.P99 || s.Latency.P99 > s.Latency.Max || s.Latency.Max <= 0 {
+		t.Fatalf("latency %+v for %d requests", s.Latency, total)
+	}
+	if s.BytesSent <= 0 || s.BytesReceived <= 0 || s.NewConnections < 1 || s.ReusedConnections < 1 {
+		t.Fatalf("bytes %d/%d, connections %d new, %d reused", s.BytesSent, s.BytesReceived, s.NewConnections, s.ReusedConnections)
+	}
+	if s.InFlight != 0 {
+		t.Fatalf("%d requests still in flight", s.InFlight)
+	}
+
+	// A snapshot is a copy.
+	s.Requests[MethodPing] = 100
+	if c.Stats().Requests[MethodPing] != 1 {
+		t.Fatal("changing a snapshot changed the client's counters")
+	}
+	c.ResetStats()
+	if s := c.Stats(); len(s.Requests) != 0 || len(s.Errors) != 0 || s.CacheHits != 0 || s.BytesSent != 0 || s.Latency != (LatencyStats{}) {
+		t.Fatalf("counters after ResetStats: %+v", s)
+	}
+	if c.CacheStats().Hits != 2 {
+		t.Fatal("ResetStats cleared the cache's own counters")
+	}
+}
+
+func TestLatencyDigest(t *testing.T) {
+	var d latencyDigest
+	for i := 1; i <= 1000; i++ {
+		d.add(time.Duration(i) * time.Millisecond)
+	}
+	s := d.summary()
+	within := func(got, want time.Duration) bool {
+		return got >= want && float64(got) <= float64(want)*1.05
+	}
+	if s.Count != 1000 || s.Max != time.Second || !within(s.P50, 500*time.Millisecond) ||
+		!within(s.P95, 950*time.Millisecond) || !within(s.P99, 990*time.Millisecond) {
+		t.Fatalf("summary %+v", s)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// stdioShutdownGrace bounds how long Close waits for the server to exit after
+// its stdin is closed before sending SIGTERM, and again after SIGTERM before
+// the process is killed.
+const stdioShutdownGrace = 2 * time.Second
+
+// newStdioTransport spawns command on first use and exchanges envelopes over
+// its stdin/stdout pipes. A server that exits is respawned according to
+// opts.policy.
+func newStdioTransport(command []string, opts streamOptions) *streamTransport {
+	return newStreamTransport(TransportStdio, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return startProcess(ctx, command)
+	}, opts)
+}
+
+// processConn adapts a subprocess' pipes to io.ReadWriteCloser.
+type processConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	exited chan struct{}
+	err    error
+}
+
+func startProcess(ctx context.Context, command []string) (*processConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The subprocess outlives the dial context, so it is deliberately not
+	// started with exec.CommandContext.
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	// Pipes are created by hand rather than via StdoutPipe so that the
+	// background Wait cannot close stdout while a response is still being read.
+	childIn, stdin, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, childOut, err := os.Pipe()
+	if err != nil {
+		childIn.Close()
+		stdin.Close()
+		return nil, err
+	}
+	cmd.Stdin = childIn
+	cmd.Stdout = childOut
+	err = cmd.Start()
+	childIn.Close()
+	childOut.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("start %s: %w", command[0], err)
+	}
+	p := &processConn{cmd: cmd, stdin: stdin, stdout: stdout, exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// awaitExit reports whether the process exits within d.
+func (p *processConn) awaitExit(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-p.exited:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (p *processConn) Read(b []byte) (int, error)  { return p.stdout.Read(b) }
+func (p *processConn) Write(b []byte) (int, error) { return p.stdin.Write(b) }
+
+// Close closes stdin so the server can exit cleanly, sends SIGTERM if it has
+// not done so within stdioShutdownGrace, and kills it after another grace
+// period. Where SIGTERM is unsupported the process is killed at once.
+func (p *processConn) Close() error {
+	_ = p.stdin.Close()
+	if !p.awaitExit(stdioShutdownGrace) {
+		if p.cmd.Process.Signal(syscall.SIGTERM) != nil || !p.awaitExit(stdioShutdownGrace) {
+			_ = p.cmd.Process.Kill()
+			<-p.exited
+		}
+	}
+	_ = p.stdout.Close()
+	var exitErr *exec.ExitError
+	if p.err != nil && !errors.As(p.err, &exitErr) {
+		return p.err
+	}
+	return nil
+}
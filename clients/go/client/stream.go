@@ -0,0 +1,594 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTransportClosed is returned once a stream transport has been closed.
+var errTransportClosed = errors.New("transport closed")
+
+// errWriteAbandoned marks a call whose context ended while its frame was
+// being written: the write was cut short by closing the stream, which holds
+// half a frame and is replaced before the next call.
+var errWriteAbandoned = errors.New("write abandoned")
+
+// ErrConnectionLost reports that the stream under a request failed, for
+// example because the stdio server exited, and the request was not (or could
+// not safely be) replayed.
+var ErrConnectionLost = errors.New("connection lost")
+
+// replayableMethods may be resent after a restart even if the lost server
+// had already received them: none of them changes server state that survives
+// the process.
+var replayableMethods = map[string]bool{
+	MethodInitialize:   true,
+	MethodPing:         true,
+	MethodCapabilities: true,
+	MethodEmbed:        true,
+	// Streams are only replayed before their first frame is delivered.
+	MethodEmbedStream: true,
+}
+
+// streamLoss marks a failure of the byte stream itself, as opposed to a
+// malformed or mismatched response. written reports whether the request
+// frame had been fully handed to the stream.
+type streamLoss struct {
+	written bool
+	err     error
+}
+
+func (e *streamLoss) Error() string { return e.err.Error() }
+func (e *streamLoss) Unwrap() error { return e.err }
+
+// dialFunc opens the byte stream used by a streamTransport.
+type dialFunc func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// streamTransport exchanges framed JSON envelopes over a byte
+// stream. It backs the stdio, unix, inproc, and conn transports. Requests are
+// serialized: each RoundTrip writes one frame and reads the response with the
+// matching ID, or every frame of a streamed response. With a
+// MaxPipelineDepth a pipeline shares the stream between calls instead. When the stream fails
+// underneath a request the transport redials, up to the restart policy's
+// budget.
+type streamTransport struct {
+	kind string
+	dial dialFunc
+	opts streamOptions
+
+	mu     sync.Mutex
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	// counter counts the bytes read from conn, for Failure.BytesRead.
+	counter *countingReader
+	// started is set once the first dial succeeds; later dials are restarts.
+	started  bool
+	restarts int
+	lastLoss error
+	// broken holds the sticky error that poisoned the stream, if any.
+	broken error
+	// events, when set, learns of every stream attached and closed.
+	events *transportEvents
+	// pipe demultiplexes the stream with a MaxPipelineDepth, whose calls
+	// hold slots.
+	pipe  *pipeline
+	slots chan struct{}
+	// drain is the reader of an exchange given up on after its frame was
+	// written, still reading the answer off the stream; see settle.
+	drain *streamDrain
+
+	// closing is closed by Close to abandon the request holding mu.
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// streamOptions are the per-transport settings of a streamTransport.
+type streamOptions struct {
+	timeouts timeouts
+	policy   restartPolicy
+	framing  framing
+	// maxResponse is ClientConfig.MaxResponseBytes.
+	maxResponse int
+	// log, when set, receives a record of every dial of target.
+	log    *slog.Logger
+	target string
+	// dump, when set, records the bytes of every connection.
+	dump *wireDump
+	// label is the endpoint label of the connection events.
+	label string
+	// pipelineDepth is ClientConfig.MaxPipelineDepth; see pipeline.go.
+	pipelineDepth int
+}
+
+// streamOptions returns the options shared by every stream transport. The
+// restart policy and dial target are left empty; only stdio can respawn
+// its server.
+func (cfg ClientConfig) streamOptions() streamOptions {
+	return streamOptions{timeouts: cfg.timeouts(), framing: newFraming(cfg.Framing, cfg.MaxFrameSize), maxResponse: cfg.MaxResponseBytes, log: cfg.logger(), dump: cfg.wireDump(), label: cfg.endpointLabel(), pipelineDepth: cfg.MaxPipelineDepth}
+}
+
+func newStreamTransport(kind string, dial dialFunc, opts streamOptions) *streamTransport {
+	t := &streamTransport{kind: kind, dial: dial, opts: opts, closing: make(chan struct{})}
+	if opts.pipelineDepth > 1 {
+		t.slots = make(chan struct{}, opts.pipelineDepth)
+	}
+	return t
+}
+
+func (t *streamTransport) Kind() string { return t.kind }
+
+func (t *streamTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	var resp *Response
+	err := t.roundTrip(ctx, req, false, func(r *Response) (bool, error) {
+		resp = r
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RoundTripStream sends req and passes every frame carrying its ID to handle
+// until handle reports the last one.
+func (t *streamTransport) RoundTripStream(ctx context.Context, req *Request, handle frameHandler) error {
+	return t.roundTrip(ctx, req, true, handle)
+}
+
+// notify writes a notification, which no frame answers. A write cut short
+// leaves half a frame on the stream, which is given up on as roundTrip
+// gives up on an abandoned exchange.
+func (t *streamTransport) notify(ctx context.Context, payload []byte) error {
+	if t.slots != nil {
+		p, err := t.pipelineFor(ctx)
+		if err != nil {
+			return err
+		}
+		return p.notify(ctx, payload, t.closing)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.broken != nil {
+		return t.broken
+	}
+	if err := t.settle(ctx); err != nil {
+		return err
+	}
+	if t.conn == nil {
+		if err := t.open(ctx); err != nil {
+			return err
+		}
+	}
+	conn := t.conn
+	wrote := make(chan error, 1)
+	go func() { wrote <- t.opts.framing.write(conn, payload) }()
+	writeTimer := newPhaseTimer(t.opts.timeouts.write)
+	defer writeTimer.stop()
+	select {
+	case err := <-wrote:
+		if err != nil {
+			t.drop(err)
+			return fmt.Errorf("%s stream: %w: write: %w", t.kind, ErrConnectionLost, err)
+		}
+		return nil
+	case <-writeTimer.C():
+		err := fmt.Errorf("%w after %s", ErrWriteTimeout, t.opts.timeouts.write)
+		t.poison(fmt.Errorf("%s stream: %w", t.kind, err))
+		return err
+	case <-ctx.Done():
+		t.poison(fmt.Errorf("%s stream abandoned: %w", t.kind, ctx.Err()))
+		return ctx.Err()
+	}
+}
+
+func (t *streamTransport) roundTrip(ctx context.Context, req *Request, stream bool, handle frameHandler) error {
+	frame, err := encodeFrame(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	defer frame.release()
+	if t.slots != nil {
+		return t.roundTripPipelined(ctx, req, frame, stream, handle)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Once a frame has been handed over, replaying would deliver it twice.
+	delivered := false
+	counted := func(r *Response) (bool, error) {
+		delivered = true
+		return handle(r)
+	}
+	for {
+		if t.broken != nil {
+			return t.broken
+		}
+		if err := t.settle(ctx); err != nil {
+			return err
+		}
+		if t.conn == nil {
+			if err := t.open(ctx); err != nil {
+				return err
+			}
+		}
+
+		// Bytes already buffered were read for an earlier request.
+		counter := t.counter
+		start := counter.n.Load() - int64(t.reader.Buffered())
+		err := t.exchange(ctx, frame, req.ID, stream, counted)
+		read := counter.n.Load() - start
+		var loss *streamLoss
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &loss):
+			t.drop(loss.err)
+			lost := fmt.Errorf("%s stream: %w: %w", t.kind, ErrConnectionLost, loss.err)
+			if t.restarts >= t.opts.policy.maxRestarts {
+				t.broken = lost
+				return readFailure(lost, read)
+			}
+			// A request the server may already have acted on is only resent
+			// when doing so is harmless.
+			if loss.written && (delivered || !replayableMethods[req.Method]) {
+				return readFailure(lost, read)
+			}
+		case errors.Is(err, ErrResponseTooLarge):
+			// The rest of the response is unread; a fresh stream replaces
+			// the connection, leaving the transport usable by later calls.
+			t.drop(err)
+			return readFailure(fmt.Errorf("%s stream: %w", t.kind, err), read)
+		case errors.Is(err, errWriteAbandoned):
+			t.drop(err)
+			return fmt.Errorf("%s stream: %w", t.kind, err)
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			// The exchange's reader goes on to the end of the answer, which
+			// the next call waits for.
+			return readFailure(err, read)
+		default:
+			t.poison(fmt.Errorf("%s stream: %w", t.kind, err))
+			return readFailure(t.broken, read)
+		}
+	}
+}
+
+// streamDrain is the reader of an exchange given up on after its frame was
+// written. It reads the rest of the answer, discarding it, then closes
+// idle, err saying why the stream cannot be read on when it failed.
+type streamDrain struct {
+	idle chan struct{}
+	err  error
+}
+
+// settle waits for the reader of an exchange given up on to reach the end
+// of its answer, so the next frame read answers the next call. The answer
+// must arrive within the read timeout; a stream it does not arrive on, or
+// whose reader failed, is replaced. The caller must hold t.mu.
+func (t *streamTransport) settle(ctx context.Context) error {
+	d := t.drain
+	if d == nil {
+		return nil
+	}
+	readTimer := newPhaseTimer(t.opts.timeouts.read)
+	defer readTimer.stop()
+	select {
+	case <-d.idle:
+		t.drain = nil
+		if d.err != nil {
+			t.drop(d.err)
+		}
+		return nil
+	case <-readTimer.C():
+		t.drain = nil
+		t.drop(fmt.Errorf("answer to an abandoned request: %w after %s", ErrReadTimeout, t.opts.timeouts.read))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.closing:
+		return errTransportClosed
+	}
+}
+
+// open dials the stream. Every dial after the first counts as a restart and
+// waits out the backoff first. The caller must hold t.mu.
+func (t *streamTransport) open(ctx context.Context) error {
+	restart := t.started
+	if restart {
+		t.restarts++
+		timer := time.NewTimer(t.opts.policy.delay(t.restarts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-t.closing:
+			timer.Stop()
+			return errTransportClosed
+		}
+	}
+	markPhase(ctx, PhaseDial)
+	conn, err := t.connect(ctx)
+	if err != nil {
+		if restart {
+			return fmt.Errorf("%s restart %d: %w", t.kind, t.restarts, err)
+		}
+		return fmt.Errorf("%s dial: %w", t.kind, err)
+	}
+	t.attach(conn)
+	markPhase(ctx, PhaseSend)
+	if restart && t.opts.policy.onReconnect != nil {
+		t.opts.policy.onReconnect(ReconnectEvent{Transport: t.kind, Attempt: t.restarts, Cause: t.lastLoss})
+	}
+	return nil
+}
+
+// attach makes conn the stream of the transport. The caller must hold t.mu.
+func (t *streamTransport) attach(conn io.ReadWriteCloser) {
+	if t.slots != nil {
+		conn = &closeOnce{ReadWriteCloser: conn}
+	}
+	t.conn = conn
+	t.counter = &countingReader{r: conn}
+	t.reader = bufio.NewReader(t.counter)
+	t.started = true
+	if t.slots != nil {
+		t.pipe = newPipeline(t.kind, &t.opts, conn, t.reader, t.events)
+	}
+	if t.events != nil {
+		t.events.connect(ConnectEvent{Transport: t.kind, Endpoint: t.opts.label})
+	}
+}
+
+// detach closes the stream for reason, nil when the client ends it. The
+// caller must hold t.mu.
+func (t *streamTransport) detach(reason error) error {
+	if t.conn == nil {
+		return nil
+	}
+	if t.pipe != nil {
+		cause := reason
+		if cause == nil {
+			cause = errTransportClosed
+		}
+		t.pipe.fail(cause)
+		t.pipe = nil
+	}
+	err := t.conn.Close()
+	t.conn, t.drain = nil, nil
+	if t.events != nil {
+		t.events.disconnect(DisconnectEvent{Transport: t.kind, Endpoint: t.opts.label, Reason: reason})
+	}
+	return err
+}
+
+// observe reports the stream's connections to ev, starting with one
+// attached already, as a conn transport's is.
+func (t *streamTransport) observe(ev *transportEvents) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = ev
+	if t.pipe != nil {
+		t.pipe.events.Store(ev)
+	}
+	if t.conn != nil {
+		ev.connect(ConnectEvent{Transport: t.kind, Endpoint: t.opts.label})
+	}
+}
+
+// countingReader counts the bytes read through it. The count may be read
+// while another goroutine reads.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// exchange writes one request frame and hands the frames answering it to
+// handle until it reports the last one, enforcing the write timeout and a
+// read timeout per frame. Failures of the underlying stream are reported as
+// *streamLoss. An exchange whose context ends while it writes reports
+// errWriteAbandoned. Once the frame is written the reader reads the whole
+// answer, stream telling whether more than one frame makes it, even past
+// the end of an exchange given up on; it is left as t.drain for the next
+// exchange to wait for. The caller must hold t.mu.
+func (t *streamTransport) exchange(ctx context.Context, frame *pooledFrame, id int64, stream bool, handle frameHandler) error {
+	type result struct {
+		resp *Response
+		err  error
+	}
+	if err := ctx.Err(); err != nil {
+		// Nothing has been written, so the stream is as it was.
+		return err
+	}
+	written := make(chan error, 1)
+	frames := make(chan result, 1)
+	// The reader waits for next before each further frame so that it never
+	// consumes a frame belonging to the following request.
+	next := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	conn, reader, events := t.conn, t.reader, t.events
+	budget := &frameBudget{limit: responseLimit(ctx, t.opts.maxResponse)}
+	drain := &streamDrain{idle: make(chan struct{})}
+	// The writer may outlive an exchange that gives up on it.
+	frame.retain()
+	go func() {
+		defer close(drain.idle)
+		err := t.opts.framing.write(conn, frame.bytes())
+		frame.release()
+		if err != nil {
+			drain.err = err
+			written <- &streamLoss{err: fmt.Errorf("write: %w", err)}
+			return
+		}
+		written <- nil
+		for {
+			resp, err := readResponse(reader, t.opts.framing, budget, id, t.kind, events)
+			frames <- result{resp, err}
+			if err != nil {
+				drain.err = err
+				return
+			}
+			select {
+			case <-next:
+				continue
+			case <-stop:
+			}
+			// Given up on, or done: the frames left of the answer are
+			// the exchange's to read, not the next one's.
+			for stream && !finalFrame(resp) {
+				if resp, err = readResponse(reader, t.opts.framing, budget, id, t.kind, events); err != nil {
+					drain.err = err
+					return
+				}
+			}
+			return
+		}
+	}()
+
+	// The stream position is unknown once a frame is cut short, so the
+	// caller discards the connection, and with it the half-written frame,
+	// on any error but one that came after the frame was whole. Closing it
+	// unblocks the goroutine.
+	writeTimer := newPhaseTimer(t.opts.timeouts.write)
+	defer writeTimer.stop()
+	select {
+	case err := <-written:
+		if err != nil {
+			return err
+		}
+	case <-writeTimer.C():
+		return fmt.Errorf("%w after %s", ErrWriteTimeout, t.opts.timeouts.write)
+	case <-ctx.Done():
+		select {
+		case err := <-written:
+			// The frame went out whole after all.
+			if err != nil {
+				return err
+			}
+			t.drain = drain
+			return ctx.Err()
+		default:
+		}
+		return fmt.Errorf("%w: %w", errWriteAbandoned, ctx.Err())
+	case <-t.closing:
+		return errTransportClosed
+	}
+	// However the exchange ends, its reader is done with the stream only
+	// once it has read the whole answer.
+	t.drain = drain
+	markPhase(ctx, PhaseReceive)
+
+	for {
+		readTimer := newPhaseTimer(t.opts.timeouts.read)
+		select {
+		case r := <-frames:
+			readTimer.stop()
+			if r.err != nil {
+				return r.err
+			}
+			more, err := handle(r.resp)
+			if err != nil || !more {
+				return err
+			}
+			next <- struct{}{}
+		case <-readTimer.C():
+			return fmt.Errorf("%w after %s", ErrReadTimeout, t.opts.timeouts.read)
+		case <-ctx.Done():
+			readTimer.stop()
+			return ctx.Err()
+		case <-t.closing:
+			readTimer.stop()
+			return errTransportClosed
+		}
+	}
+}
+
+// connect dials the stream, bounding the attempt by the dial timeout.
+func (t *streamTransport) connect(ctx context.Context) (conn io.ReadWriteCloser, err error) {
+	start := time.Now()
+	defer func() {
+		logDial(ctx, t.opts.log, t.opts.target, start, err)
+		if err == nil && t.opts.dump != nil {
+			conn = t.opts.dump.wrap(conn, t.opts.target)
+		}
+	}()
+	if t.opts.timeouts.dial <= 0 {
+		return t.dial(ctx)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, t.opts.timeouts.dial)
+	defer cancel()
+	if conn, err = t.dial(dialCtx); err != nil {
+		return nil, dialTimeoutError(ctx, dialCtx, err, t.opts.timeouts.dial)
+	}
+	return conn, nil
+}
+
+// readResponse reads the next frame, which must answer id, charging it to
+// budget. The notifications read before it go to ev, uncharged.
+func readResponse(r *bufio.Reader, f framing, budget *frameBudget, id int64, kind string, ev *transportEvents) (*Response, error) {
+	for {
+		payload, err := budget.read(r, f)
+		if err != nil {
+			if errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrResponseTooLarge) {
+				return nil, err
+			}
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, &streamLoss{written: true, err: fmt.Errorf("read: %w", err)}
+		}
+		resp, n, err := decodeInbound(payload)
+		if err != nil {
+			return nil, fmt.Errorf("decode response: %w: %w", ErrProtocol, err)
+		}
+		if n != nil {
+			// A notification is no part of the response it interrupts.
+			budget.used -= int64(len(payload))
+			ev.notify(kind, n)
+			continue
+		}
+		if resp.ID != id {
+			return nil, fmt.Errorf("response id %d does not match request id %d: %w", resp.ID, id, ErrProtocol)
+		}
+		return resp, nil
+	}
+}
+
+// drop discards a connection that failed underneath the transport, leaving it
+// free to be redialed. The caller must hold t.mu.
+func (t *streamTransport) drop(cause error) {
+	t.lastLoss = cause
+	_ = t.detach(cause)
+}
+
+// poison records err as the stream's terminal state and closes the
+// connection. The caller must hold t.mu.
+func (t *streamTransport) poison(err error) {
+	if t.broken == nil {
+		t.broken = err
+	}
+	_ = t.detach(err)
+}
+
+func (t *streamTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closing) })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.detach(nil)
+	t.broken = errTransportClosed
+	return err
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MethodEmbedStreamResume continues a resumable mcp.embed.stream whose
+	// connection was lost, after the last frame the client handled.
+	MethodEmbedStreamResume = "mcp.embed.stream.resume"
+	// MethodEmbedStreamAck is the notification acknowledging the frames of
+	// a resumable stream up to a sequence number, so the server may drop
+	// them from its replay buffer.
+	MethodEmbedStreamAck = "mcp.embed.stream.ack"
+)
+
+// CodeStreamNotResumable is the error code of a server refusing
+// mcp.embed.stream.resume, for example because the stream's replay buffer
+// has expired.
+const CodeStreamNotResumable = -32006
+
+// DefaultStreamAckInterval is the number of frames between acks when
+// StreamResumePolicy.AckInterval is zero.
+const DefaultStreamAckInterval = 16
+
+// ErrStreamNotResumable reports a stream cut short whose resumption the
+// server refused, or which ran out of resumptions. The error is a
+// *StreamResumeError telling what was delivered before the cut.
+var ErrStreamNotResumable = errors.New("stream not resumable")
+
+// StreamResumePolicy has EmbedStream survive lost connections. The request
+// asks for a resumable stream; the server numbers its frames and names the
+// stream with a resume token on the first one. The client acks every
+// AckInterval frames, and when the connection fails it reconnects and sends
+// mcp.embed.stream.resume with the token and the last sequence number it
+// handled, and the server continues from there. Frames the server sends
+// again are dropped, so each input is delivered once.
+//
+// Streams from servers that send no token fail as they would without the
+// policy. The zero value disables resumption.
+type StreamResumePolicy struct {
+	// MaxResumes bounds the resumptions of one stream. Zero disables
+	// resumption.
+	MaxResumes int
+	// AckInterval is the number of frames between acks; zero selects
+	// DefaultStreamAckInterval.
+	AckInterval int
+}
+
+func (p StreamResumePolicy) enabled() bool { return p.MaxResumes > 0 }
+
+func (p StreamResumePolicy) validate() error {
+	if p.MaxResumes < 0 || p.AckInterval < 0 {
+		return errors.New("stream resume limits must not be negative")
+	}
+	return nil
+}
+
+func (p StreamResumePolicy) ackInterval() int {
+	if p.AckInterval == 0 {
+		return DefaultStreamAckInterval
+	}
+	return p.AckInterval
+}
+
+// WithStreamResume has EmbedStream resume a stream up to maxResumes times
+// after losing its connection; see StreamResumePolicy. It overrides
+// WithConfig's StreamResume.MaxResumes.
+func WithStreamResume(maxResumes int) Option {
+	return func(o *clientOptions) error {
+		if maxResumes <= 0 {
+			return fmt.Errorf("WithStreamResume: resumptions must be positive, got %d", maxResumes)
+		}
+		o.streamResumes = maxResumes
+		return nil
+	}
+}
+
+// StreamResumeError is the final EmbedStream result of a stream that could
+// not be resumed. It matches ErrStreamNotResumable and, through Err, the
+// cause: the server's refusal or the last connection failure.
+type StreamResumeError struct {
+	// Delivered counts the results delivered before the stream ended, and
+	// Seq is the sequence number of the last frame handled.
+	Delivered int
+	Seq       int64
+	// Remaining lists, in ascending order, the indexes of the inputs
+	// without a result, for a caller restarting the stream with them alone.
+	Remaining []int
+	// Resumes is the number of resumptions made.
+	Resumes int
+	Err     error
+}
+
+func (e *StreamResumeError) Error() string {
+	return fmt.Sprintf("stream not resumable after %d results and %d resumptions: %v", e.Delivered, e.Resumes, e.Err)
+}
+
+func (e *StreamResumeError) Unwrap() []error { return []error{ErrStreamNotResumable, e.Err} }
+
+// streamResumeParams are the params of mcp.embed.stream.resume.
+type streamResumeParams struct {
+	ResumeToken string `json:"resume_token"`
+	// AfterSeq is the last sequence number the client handled; the server
+	// continues with the frame after it.
+	AfterSeq int64 `json:"after_seq"`
+}
+
+// streamAckParams are the params of mcp.embed.stream.ack.
+type streamAckParams struct {
+	ResumeToken string `json:"resume_token"`
+	Seq         int64  `json:"seq"`
+}
+
+// remainingInputs returns the indexes of the inputs not yet seen.
+func remainingInputs(seen []bool) []int {
+	var rest []int
+	for i, ok := range seen {
+		if !ok {
+			rest = append(rest, i)
+		}
+	}
+	return rest
+}
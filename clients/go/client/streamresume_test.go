@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resumableServer answers mcp.embed.stream over ws with numbered frames,
+// keeps each resumable stream for mcp.embed.stream.resume, and kills the
+// first connection, or with cutEvery every one, after cutAfter frames.
+type resumableServer struct {
+	cutAfter int
+	cutEvery bool
+	refuse   bool
+
+	mu      sync.Mutex
+	conns   int
+	streams map[string][]embedFrame
+	acks    []int64
+}
+
+func (s *resumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := acceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	s.mu.Lock()
+	s.conns++
+	cut := s.conns == 1 || s.cutEvery
+	s.mu.Unlock()
+	sent := 0
+	for {
+		msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req Request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		var frames []embedFrame
+		switch req.Method {
+		case MethodEmbedStreamAck:
+			var ack streamAckParams
+			_ = json.Unmarshal(req.Params, &ack)
+			s.mu.Lock()
+			s.acks = append(s.acks, ack.Seq)
+			s.mu.Unlock()
+			continue
+		case MethodEmbedStream:
+			var params embedParams
+			_ = json.Unmarshal(req.Params, &params)
+			for i, input := range params.Inputs {
+				frames = append(frames, embedFrame{Index: i, Vector: []float32{float32(len(input)), 0.5, -0.5}})
+			}
+			frames = append(frames, embedFrame{Done: true})
+			if params.Resumable {
+				for i := range frames {
+					frames[i].Seq = int64(i + 1)
+				}
+				frames[0].ResumeToken = fmt.Sprintf("stream-%d", req.ID)
+				s.mu.Lock()
+				if s.streams == nil {
+					s.streams = make(map[string][]embedFrame)
+				}
+				s.streams[frames[0].ResumeToken] = frames
+				s.mu.Unlock()
+			}
+		case MethodEmbedStreamResume:
+			var params streamResumeParams
+			_ = json.Unmarshal(req.Params, &params)
+			s.mu.Lock()
+			stream, ok := s.streams[params.ResumeToken]
+			s.mu.Unlock()
+			if !ok || s.refuse {
+				out, _ := json.Marshal(Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeStreamNotResumable, Message: "stream expired"}})
+				if ws.WriteText(out) != nil {
+					return
+				}
+				continue
+			}
+			// Resend the last frame handled too, which the client drops.
+			frames = stream[max(params.AfterSeq-1, 0):]
+		default:
+			out, _ := json.Marshal(defaultHandler(&req))
+			if ws.WriteText(out) != nil {
+				return
+			}
+			continue
+		}
+		for _, f := range frames {
+			if cut && sent == s.cutAfter {
+				return
+			}
+			raw, _ := json.Marshal(f)
+			out, _ := json.Marshal(Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw})
+			if ws.WriteText(out) != nil {
+				return
+			}
+			sent++
+		}
+	}
+}
+
+func TestEmbedStreamResume(t *testing.T) {
+	texts := []string{"a", "bb", "ccc", "dddd", "e", "ff", "ggg", "hhhh", "i", "jj"}
+	stream := func(t *testing.T, srv *resumableServer, policy StreamResumePolicy) ([]EmbedResult, *recordingSink) {
+		t.Helper()
+		hs := httptest.NewServer(srv)
+		t.Cleanup(hs.Close)
+		sink := &recordingSink{}
+		c, err := New(ClientConfig{
+			Transport:    TransportWebSocket,
+			Endpoint:     wsURL(hs),
+			Recorder:     sink,
+			Retry:        RetryPolicy{BaseDelay: time.Millisecond},
+			StreamResume: policy,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { c.Close(context.Background()) })
+		ch, err := c.EmbedStream(context.Background(), texts)
+		if err != nil {
+			t.Fatalf("EmbedStream: %v", err)
+		}
+		return collect(t, ch), sink
+	}
+	recorded := func(sink *recordingSink, method string) int {
+		n := 0
+		for _, e := range sink.entries {
+			if strings.Contains(string(e.Message), fmt.Sprintf("%q:%q", "method", method)) {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("resumes after the cut", func(t *testing.T) {
+		srv := &resumableServer{cutAfter: 4}
+		results, sink := stream(t, srv, StreamResumePolicy{MaxResumes: 2, AckInterval: 3})
+		if len(results) != len(texts) {
+			t.Fatalf("got %d results: %+v", len(results), results)
+		}
+		for i, r := range results {
+			if r.Index != i || r.Err != nil || int(r.Vector[0]) != len(texts[i]) {
+				t.Fatalf("result %d: %+v", i, r)
+			}
+		}
+		// The acks of the cut connection may be lost; the server reads
+		// the others after the stream has ended.
+		var conns int
+		var acks []int64
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			srv.mu.Lock()
+			conns, acks = srv.conns, srv.acks
+			srv.mu.Unlock()
+			if len(acks) > 0 && acks[len(acks)-1] == 9 {
+				break
+			}
+		}
+		if conns != 2 {
+			t.Fatalf("%d connections, want the cut one and its resumption", conns)
+		}
+		if len(acks) == 0 || acks[len(acks)-1] != 9 {
+			t.Fatalf("acks %v", acks)
+		}
+		// The transcript holds the resume request, an ack every three
+		// frames, and the numbered frames.
+		if recorded(sink, MethodEmbedStreamResume) != 1 || recorded(sink, MethodEmbedStreamAck) != 3 {
+			t.Fatalf("recorded %d resumes and %d acks", recorded(sink, MethodEmbedStreamResume), recorded(sink, MethodEmbedStreamAck))
+		}
+		var resp Response
+		var first embedFrame
+		for _, e := range sink.entries {
+			if e.Direction == DirectionResponse {
+				_ = json.Unmarshal(e.Message, &resp)
+				_ = json.Unmarshal(resp.Result, &first)
+				break
+			}
+		}
+		if first.Seq != 1 || first.ResumeToken == "" {
+			t.Fatalf("first recorded frame %+v", first)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		results, _ := stream(t, &resumableServer{cutAfter: 4, refuse: true}, StreamResumePolicy{MaxResumes: 2})
+		if len(results) != 5 || results[4].Index != -1 {
+			t.Fatalf("results %+v", results)
+		}
+		err := results[4].Err
+		var resumeErr *StreamResumeError
+		var apiErr *APIError
+		if !errors.Is(err, ErrStreamNotResumable) || !errors.As(err, &resumeErr) || !errors.As(err, &apiErr) || apiErr.Code != CodeStreamNotResumable {
+			t.Fatalf("final result: %v", err)
+		}
+		if resumeErr.Delivered != 4 || resumeErr.Seq != 4 || resumeErr.Resumes != 1 || fmt.Sprint(resumeErr.Remaining) != "[4 5 6 7 8 9]" {
+			t.Fatalf("progress %+v", resumeErr)
+		}
+	})
+
+	t.Run("out of resumptions", func(t *testing.T) {
+		results, _ := stream(t, &resumableServer{cutAfter: 3, cutEvery: true}, StreamResumePolicy{MaxResumes: 2})
+		last := results[len(results)-1]
+		var resumeErr *StreamResumeError
+		if last.Index != -1 || !errors.As(last.Err, &resumeErr) || !errors.Is(last.Err, ErrConnectionLost) {
+			t.Fatalf("final result: %v", last.Err)
+		}
+		// Each connection delivers two new frames after resending one.
+		if resumeErr.Resumes != 2 || resumeErr.Delivered != 7 || len(results) != 8 {
+			t.Fatalf("progress %+v after %d results: %+v", resumeErr, len(results), results)
+		}
+	})
+
+	t.Run("without the policy", func(t *testing.T) {
+		srv := &resumableServer{cutAfter: 4}
+		results, sink := stream(t, srv, StreamResumePolicy{})
+		last := results[len(results)-1]
+		if len(results) != 5 || last.Index != -1 || errors.Is(last.Err, ErrStreamNotResumable) || !errors.Is(last.Err, ErrConnectionLost) {
+			t.Fatalf("results %+v", results)
+		}
+		if strings.Contains(string(sink.entries[0].Message), "resumable") || len(srv.streams) != 0 {
+			t.Fatalf("asked for a resumable stream: %s", sink.entries[0].Message)
+		}
+	})
+}
+
+func TestStreamResumeOptions(t *testing.T) {
+	c, err := NewClient("ws://localhost:1", WithStreamResume(3))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	if c.cfg.StreamResume.MaxResumes != 3 || c.cfg.StreamResume.ackInterval() != DefaultStreamAckInterval {
+		t.Fatalf("policy %+v", c.cfg.StreamResume)
+	}
+	if _, err := NewClient("ws://localhost:1", WithStreamResume(0)); err == nil {
+		t.Fatal("WithStreamResume(0) accepted")
+	}
+	if _, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: "ws://localhost:1", StreamResume: StreamResumePolicy{AckInterval: -1}}); err == nil {
+		t.Fatal("a negative ack interval was accepted")
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stressGoroutines share one client in TestConcurrentUse.
+const stressGoroutines = 500
+
+// stressOps are the calls TestConcurrentUse mixes, each reporting the error
+// of its call, or nil for those that cannot fail.
+var stressOps = []func(ctx context.Context, c *Client, n int) error{
+	func(ctx context.Context, c *Client, n int) error {
+		_, err := c.Embed(ctx, fmt.Sprintf("text %d", n%32))
+		return err
+	},
+	func(ctx context.Context, c *Client, n int) error {
+		_, err := c.EmbedBatch(ctx, []string{fmt.Sprintf("text %d", n%32), fmt.Sprintf("batch %d", n)})
+		return err
+	},
+	func(ctx context.Context, c *Client, n int) error {
+		_, err := c.Ping(ctx)
+		return err
+	},
+	func(ctx context.Context, c *Client, n int) error {
+		if s := c.Stats(); s.InFlight < 0 || s.Waiting < 0 {
+			return fmt.Errorf("stats %+v", s)
+		}
+		_ = c.CacheStats()
+		return nil
+	},
+	func(ctx context.Context, c *Client, n int) error {
+		if n%16 == 0 {
+			c.InvalidateCache()
+			c.ResetStats()
+		}
+		return nil
+	},
+}
+
+func TestConcurrentUse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	httpSrv := httptest.NewServer(httpHandler(defaultHandler))
+	defer httpSrv.Close()
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+	for name, cfg := range map[string]ClientConfig{
+		"inproc": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+		"stdio":  {Command: helperCommand(t)},
+		"http":   {Transport: TransportHTTP, Endpoint: httpSrv.URL, MaxInFlight: 32},
+		"ws":     {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+		// The stream multiplexer, request sharing, and input merging hold
+		// state of their own across calls.
+		"pipelined": {Command: helperCommand(t), MaxPipelineDepth: 8, SingleFlight: true},
+		"coalesced": {Transport: TransportInProc, Handler: inprocHandler(defaultHandler), Coalescing: CoalescingPolicy{MaxDelay: time.Millisecond}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewClient("", WithConfig(cfg), WithCache(CacheConfig{MaxEntries: 16}))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				stress(t, c)
+			}()
+			select {
+			case <-done:
+			case <-time.After(30 * time.Second):
+				buf := make([]byte, 1<<20)
+				t.Fatalf("deadlocked:\n%s", buf[:runtime.Stack(buf, true)])
+			}
+		})
+	}
+}
+
+// stress runs stressOps on c from stressGoroutines goroutines, closes c
+// while they run, and checks that each call made after Close returned
+// fails with ErrClientClosed.
+func stress(t *testing.T, c *Client) {
+	var (
+		calls   atomic.Int64
+		closing atomic.Bool
+		started = make(chan struct{})
+		closed  = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	ctx := context.Background()
+	for i := 0; i < stressGoroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-started
+			for n := i; ; n++ {
+				err := stressOps[n%len(stressOps)](ctx, c, n)
+				calls.Add(1)
+				if err == nil {
+					continue
+				}
+				// Calls under way when Close begins may fail as it tears
+				// the transport down; none may fail before.
+				if !closing.Load() {
+					t.Errorf("goroutine %d: %v", i, err)
+				}
+				break
+			}
+			<-closed
+			if _, err := c.Embed(ctx, "late"); !errors.Is(err, ErrClientClosed) {
+				t.Errorf("Embed after Close: %v", err)
+			}
+			if _, err := c.EmbedBatch(ctx, []string{"late"}); !errors.Is(err, ErrClientClosed) {
+				t.Errorf("EmbedBatch after Close: %v", err)
+			}
+			if _, err := c.Ping(ctx); !errors.Is(err, ErrClientClosed) {
+				t.Errorf("Ping after Close: %v", err)
+			}
+		}(i)
+	}
+	close(started)
+	for calls.Load() < 4*stressGoroutines {
+		time.Sleep(time.Millisecond)
+	}
+	closing.Store(true)
+	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := c.Close(closeCtx); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	close(closed)
+	wg.Wait()
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownField reports a response holding a field the client has no
+// place for, under ClientConfig.StrictDecoding; see UnknownFieldError. It
+// matches ErrProtocol.
+var ErrUnknownField error = &classError{"unknown field", ErrProtocol}
+
+// UnknownFieldError is a response rejected by ClientConfig.StrictDecoding
+// for a field the client's type for it lacks. It matches ErrUnknownField
+// and ErrProtocol.
+type UnknownFieldError struct {
+	// Method is the request answered, and Message the kind of message
+	// holding the field: "result", or "frame" for a stream frame.
+	Method, Message string
+	// Field is the JSON pointer to the field within the message.
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("%s: %s %s in the %s", e.Method, ErrUnknownField, e.Field, e.Message)
+}
+
+func (e *UnknownFieldError) Unwrap() error { return ErrUnknownField }
+
+// WithStrictDecoding rejects every response holding a field the client
+// does not know with an *UnknownFieldError, as encoding/json does with
+// DisallowUnknownFields, rather than ignore it. Results and stream frames
+// are held to the client's type for their method, whatever codec carried
+// them; the results of methods the client has no type for, such as
+// mcp.capabilities, pass as before.
+func WithStrictDecoding() Option {
+	return func(o *clientOptions) error {
+		o.strictDecoding = true
+		return nil
+	}
+}
+
+// resultSchema is the type the client holds a result of method to, nil
+// for a method whose results it reads as generic JSON.
+func resultSchema(method string) reflect.Type {
+	var v any
+	switch method {
+	case MethodInitialize:
+		v = InitializeResult{}
+	case MethodPing:
+		v = pingWire{}
+	case MethodEmbed:
+		v = embedResult{}
+	case MethodEmbedStream, MethodEmbedStreamResume:
+		v = embedFrame{}
+	case MethodListModels:
+		v = listModelsResult{}
+	case MethodJobSubmit:
+		v = jobSubmitResult{}
+	case MethodJobStatus:
+		v = JobStatus{}
+	case MethodJobResults:
+		v = JobPage{}
+	case MethodCountTokens:
+		v = countTokensResult{}
+	default:
+		return nil
+	}
+	return reflect.TypeOf(v)
+}
+
+// UnknownFields lists the JSON pointers, into result, of the fields a
+// result of method holds that the client's type for it has no place for,
+// each field once however many array elements hold it; nil for a method
+// whose results the client reads as generic JSON. Client-side checks of a
+// recorded session use it to notice protocol drift before
+// WithStrictDecoding would reject it.
+func UnknownFields(method string, result json.RawMessage) ([]string, error) {
+	t := resultSchema(method)
+	if t == nil {
+		return nil, nil
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(result))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: decode result: %w: %w", method, ErrProtocol, err)
+	}
+	w := fieldWalker{seen: make(map[string]bool)}
+	w.walk(nil, nil, doc, t)
+	return w.found, nil
+}
+
+// checkFields fails data, a message of kind part answering method, with
+// an *UnknownFieldError under ClientConfig.StrictDecoding.
+func (c *Client) checkFields(method, part string, data json.RawMessage) error {
+	if !c.cfg.StrictDecoding || len(data) == 0 {
+		return nil
+	}
+	unknown, err := UnknownFields(method, data)
+	if err != nil || len(unknown) == 0 {
+		// A result that does not parse fails as it decodes.
+		return nil
+	}
+	return &UnknownFieldError{Method: method, Message: part, Field: unknown[0]}
+}
+
+// fieldWalker collects the fields of a generic JSON document that a Go
+// type lacks, each at most once per schema location.
+type fieldWalker struct {
+	found []string
+	seen  map[string]bool
+}
+
+// walk checks v, at path and at loc, its path with array indexes left
+// out, against t. A value whose shape t does not describe, such as a
+// vector encoded as a string, is not descended into.
+func (w *fieldWalker) walk(path, loc []string, v any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch doc := v.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Map:
+			for _, k := range sortedKeys(doc) {
+				w.walk(append(path, k), append(loc, "*"), doc[k], t.Elem())
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for _, k := range sortedKeys(doc) {
+				ft, ok := fields[k]
+				if !ok {
+					ft, ok = foldField(fields, k)
+				}
+				if !ok {
+					if key := strings.Join(append(loc, k), "/"); !w.seen[key] {
+						w.seen[key] = true
+						w.found = append(w.found, "/"+strings.Join(escapePointer(append(path, k)), "/"))
+					}
+					continue
+				}
+				w.walk(append(path, k), append(loc, k), doc[k], ft)
+			}
+		}
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for i, item := range doc {
+			w.walk(append(path, strconv.Itoa(i)), append(loc, "[]"), item, t.Elem())
+		}
+	}
+}
+
+// jsonFields maps the JSON names of t's fields, those of its embedded
+// structs included, to their types, as encoding/json names them.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, f := range reflect.VisibleFields(t) {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !f.IsExported() && !f.Anonymous:
+			continue
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			// Its fields are visible in their own right.
+			continue
+		case name == "":
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// foldField finds the field named key regardless of case, as encoding/json
+// matches keys.
+func foldField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes the segments of a JSON pointer.
+func escapePointer(path []string) []string {
+	out := make([]string, len(path))
+	for i, seg := range path {
+		out[i] = strings.ReplaceAll(strings.ReplaceAll(seg, "~", "~0"), "/", "~1")
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withExtraField adds field, set to true, to the object at path in a
+// result, taking the first element of each array on the way.
+func withExtraField(raw json.RawMessage, field string, path ...string) json.RawMessage {
+	var doc map[string]any
+	_ = json.Unmarshal(raw, &doc)
+	target := doc
+	for _, key := range path {
+		switch v := target[key].(type) {
+		case map[string]any:
+			target = v
+		case []any:
+			target = v[0].(map[string]any)
+		}
+	}
+	target[field] = true
+	out, _ := json.Marshal(doc)
+	return out
+}
+
+func TestStrictDecoding(t *testing.T) {
+	// The server adds a field to the first embedding of each embed result.
+	handler := func(req Request) (Response, error) {
+		resp := defaultHandler(&req)
+		if req.Method == MethodEmbed {
+			resp.Result = withExtraField(resp.Result, "norm", "embeddings")
+		}
+		return *resp, nil
+	}
+	lenient, err := New(ClientConfig{Transport: TransportInProc, Handler: handler})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer lenient.Close(context.Background())
+	ctx := context.Background()
+	if _, err := lenient.Embed(ctx, "a"); err != nil {
+		t.Fatalf("lenient Embed: %v", err)
+	}
+
+	strict, err := New(ClientConfig{Transport: TransportInProc, Handler: handler, StrictDecoding: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer strict.Close(context.Background())
+	// What the fake sends otherwise is all in the client's types, the
+	// latency of a ping included.
+	if _, err := strict.Initialize(ctx); err != nil {
+		t.Fatalf("strict Initialize: %v", err)
+	}
+	if _, err := strict.Ping(ctx); err != nil {
+		t.Fatalf("strict Ping: %v", err)
+	}
+	if _, err := strict.ListModels(ctx); err != nil {
+		t.Fatalf("strict ListModels: %v", err)
+	}
+	_, err = strict.Embed(ctx, "a", WithNoCache())
+	var unknown *UnknownFieldError
+	if !errors.As(err, &unknown) || unknown.Method != MethodEmbed || unknown.Message != "result" || unknown.Field != "/embeddings/0/norm" {
+		t.Fatalf("strict Embed: %v", err)
+	}
+	if !errors.Is(err, ErrUnknownField) || !errors.Is(err, ErrProtocol) {
+		t.Fatalf("strict Embed: %v does not match its classes", err)
+	}
+}
+
+func TestStrictDecodingStreamFrames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		frames := streamFrames(&req, defaultHandler)
+		if req.Method != MethodEmbedStream {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(frames[0])
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		for _, resp := range frames {
+			resp.Result = withExtraField(resp.Result, "score")
+			_ = json.NewEncoder(w).Encode(resp)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithStrictDecoding())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	results := collect(t, ch)
+	last := results[len(results)-1]
+	var unknown *UnknownFieldError
+	if last.Index != -1 || !errors.As(last.Err, &unknown) || unknown.Message != "frame" || unknown.Field != "/score" {
+		t.Fatalf("results %+v", results)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	for _, tc := range []struct {
+		method, result string
+		want           []string
+	}{
+		// Each field is reported once, at its first element.
+		{MethodEmbed, `{"model":"m","embeddings":[{"index":0,"vector":[1],"norm":1},{"index":1,"vector":[2],"norm":2}],"extra":{}}`, []string{"/embeddings/0/norm", "/extra"}},
+		// Keys match in any case, and a vector need not be an array.
+		{MethodEmbed, `{"Model":"m","embeddings":[{"index":0,"vector":"AACAPw=="}]}`, nil},
+		{MethodInitialize, `{"session":{"id":"s","a/b":1},"heartbeat_interval_ms":5}`, []string{"/session/a~1b"}},
+		{MethodListModels, `{"models":[{"name":"m","features":{"dtypes":["float32"],"sparse":true}}],"next_cursor":"c"}`, []string{"/models/0/features/sparse"}},
+		{MethodJobStatus, `{"job_id":"j","state":"running","metadata":{"k":"v"}}`, nil},
+		// A method without a type takes anything.
+		{MethodCapabilities, `{"tools":["search"],"anything":1}`, nil},
+	} {
+		got, err := UnknownFields(tc.method, json.RawMessage(tc.result))
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("UnknownFields(%s, %s) = %v, %v; want %v", tc.method, tc.result, got, err, tc.want)
+		}
+	}
+	if _, err := UnknownFields(MethodEmbed, json.RawMessage(`{`)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("UnknownFields of malformed JSON: %v", err)
+	}
+}
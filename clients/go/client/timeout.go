@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Timeout classes surfaced when a ClientConfig timeout expires. They let
+// callers tell a server that cannot be reached (ErrDialTimeout) from one that
+// is reachable but slow (ErrReadTimeout, ErrWriteTimeout). All three match
+// ErrTimeout.
+var (
+	ErrDialTimeout  error = &classError{"dial timeout", ErrTimeout}
+	ErrReadTimeout  error = &classError{"read timeout", ErrTimeout}
+	ErrWriteTimeout error = &classError{"write timeout", ErrTimeout}
+)
+
+// timeouts groups the per-phase limits applied by a transport. Zero disables
+// a limit.
+type timeouts struct {
+	dial  time.Duration
+	read  time.Duration
+	write time.Duration
+}
+
+func (cfg ClientConfig) timeouts() timeouts {
+	return timeouts{dial: cfg.DialTimeout, read: cfg.ReadTimeout, write: cfg.WriteTimeout}
+}
+
+// phaseTimer is a stoppable timer whose channel is nil when disabled, so it
+// never fires in a select.
+type phaseTimer struct{ t *time.Timer }
+
+func newPhaseTimer(d time.Duration) phaseTimer {
+	if d <= 0 {
+		return phaseTimer{}
+	}
+	return phaseTimer{time.NewTimer(d)}
+}
+
+func (p phaseTimer) C() <-chan time.Time {
+	if p.t == nil {
+		return nil
+	}
+	return p.t.C
+}
+
+func (p phaseTimer) stop() {
+	if p.t != nil {
+		p.t.Stop()
+	}
+}
+
+// dialTimeoutError converts a dial failure caused by the dial timeout (rather
+// than the caller's own context) into ErrDialTimeout.
+func dialTimeoutError(parent, dialCtx context.Context, err error, limit time.Duration) error {
+	if parent.Err() == nil && dialCtx.Err() != nil {
+		return fmt.Errorf("%w after %s: %v", ErrDialTimeout, limit, err)
+	}
+	return err
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
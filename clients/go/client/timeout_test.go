@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stallListener accepts TCP connections and holds them open without ever
+// reading from or writing to them.
+func stallListener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var held []net.Conn
+		defer func() {
+			for _, c := range held {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			held = append(held, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestStdioReadTimeout(t *testing.T) {
+	c, err := New(ClientConfig{Command: helperCommandMode(t, helperSilent), ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Initialize(context.Background())
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected ErrReadTimeout, got %v", err)
+	}
+	// The abandoned stream cannot be reused.
+	if err := c.Call(context.Background(), MethodPing, nil, nil); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected sticky ErrReadTimeout, got %v", err)
+	}
+}
+
+func TestStdioWriteTimeout(t *testing.T) {
+	c, err := New(ClientConfig{Command: helperCommandMode(t, helperDeaf), WriteTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	// Far larger than any pipe buffer, so the write blocks on the deaf server.
+	_, err = c.Embed(context.Background(), strings.Repeat("x", 8<<20))
+	if !errors.Is(err, ErrWriteTimeout) {
+		t.Fatalf("expected ErrWriteTimeout, got %v", err)
+	}
+}
+
+func TestHTTPReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, ReadTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Initialize(context.Background())
+	if !errors.Is(err, ErrReadTimeout) || errors.Is(err, ErrDialTimeout) {
+		t.Fatalf("expected ErrReadTimeout, got %v", err)
+	}
+}
+
+func TestHTTPReadTimeoutLeavesCallerDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, ReadTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.Initialize(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+}
+
+func TestTLSDialTimeout(t *testing.T) {
+	// The listener accepts the TCP connection but never answers the
+	// ClientHello, so the handshake stalls.
+	addr := stallListener(t)
+	c, err := New(ClientConfig{Transport: TransportTLS, Endpoint: "https://" + addr + "/mcp", DialTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Initialize(context.Background())
+	if !errors.Is(err, ErrDialTimeout) || errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected ErrDialTimeout, got %v", err)
+	}
+}
+
+func TestHTTPWriteTimeout(t *testing.T) {
+	addr := stallListener(t)
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: "http://" + addr + "/mcp", WriteTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	// Large enough to overflow the loopback socket buffers.
+	_, err = c.Embed(context.Background(), strings.Repeat("x", 64<<20))
+	if !errors.Is(err, ErrWriteTimeout) {
+		t.Fatalf("expected ErrWriteTimeout, got %v", err)
+	}
+}
+
+func TestStreamDialTimeout(t *testing.T) {
+	tr := newStreamTransport("test", func(ctx context.Context) (io.ReadWriteCloser, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, streamOptions{timeouts: timeouts{dial: 50 * time.Millisecond}})
+	defer tr.Close()
+
+	_, err := tr.RoundTrip(context.Background(), &Request{JSONRPC: JSONRPCVersion, ID: 1, Method: MethodPing})
+	if !errors.Is(err, ErrDialTimeout) {
+		t.Fatalf("expected ErrDialTimeout, got %v", err)
+	}
+}
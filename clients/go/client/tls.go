@@ -0,0 +1,333 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLS failure classes surfaced by the tls and wss transports. Errors wrap
+// both the class and the underlying crypto/tls error.
+var (
+	// ErrClientCertRejected reports that the server refused the client
+	// certificate (or required one that was not presented). It matches
+	// ErrUnauthorized.
+	ErrClientCertRejected error = &classError{"server rejected client certificate", ErrUnauthorized}
+	// ErrTLSHandshake reports any other TLS handshake failure.
+	ErrTLSHandshake = errors.New("tls handshake failed")
+	// ErrCertPinMismatch reports that the server leaf certificate's SPKI hash
+	// matched none of the configured pins.
+	ErrCertPinMismatch = errors.New("server certificate does not match pinned SPKI hash")
+	// ErrSANNotAllowed reports that the server leaf certificate names a DNS
+	// SAN outside ClientConfig.TLSAllowedSANs.
+	ErrSANNotAllowed = errors.New("server certificate SANs are not allowed")
+	// ErrTLSVersionTooLow reports that the server offered no protocol version
+	// at or above the client's minimum.
+	ErrTLSVersionTooLow = errors.New("server tls version below configured minimum")
+)
+
+// tlsVersions maps TLSMinVersion values to crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientCertAlerts are the TLS alerts a server sends when client
+// authentication fails (RFC 8446 §6.2).
+var clientCertAlerts = []string{
+	"bad certificate",
+	"unsupported certificate",
+	"certificate revoked",
+	"certificate expired",
+	"certificate unknown",
+	"unknown certificate authority",
+	"access denied",
+	"certificate required",
+}
+
+// tlsConfig builds the client TLS configuration shared by the tls, http3, and
+// wss transports, loading the client key pair when one is configured.
+func (cfg ClientConfig) tlsConfig() (*tls.Config, error) {
+	var tc *tls.Config
+	if cfg.TLSConfig != nil {
+		tc = cfg.TLSConfig.Clone()
+	} else {
+		tc = &tls.Config{}
+	}
+	if cfg.TLSMinVersion != "" {
+		v, err := parseTLSVersion(cfg.TLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tc.MinVersion = v
+	}
+	if tc.MinVersion == 0 {
+		tc.MinVersion = tls.VersionTLS12
+	}
+	if len(cfg.TLSCipherSuites) > 0 {
+		suites, err := parseCipherSuites(cfg.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tc.CipherSuites = suites
+	}
+	if cfg.creds != nil && cfg.creds.certFile != "" {
+		tc.GetClientCertificate = cfg.creds.clientCertificate
+	} else if cfg.TLSClientCert != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.TLSClientCert, cfg.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tc.Certificates = append(tc.Certificates, pair)
+	}
+	if len(cfg.TLSCAFiles) > 0 {
+		pool, err := loadCAPool(tc.RootCAs, cfg.TLSCAFiles)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	if len(cfg.TLSPinSHA256) > 0 {
+		pins, err := parsePins(cfg.TLSPinSHA256)
+		if err != nil {
+			return nil, err
+		}
+		// VerifyConnection runs after chain verification, so pinning applies
+		// on top of (not instead of) the CA bundle.
+		verify := tc.VerifyConnection
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			return verifyPins(cs, pins)
+		}
+	}
+	if len(cfg.TLSAllowedSANs) > 0 {
+		allowed, err := parseSANPatterns(cfg.TLSAllowedSANs)
+		if err != nil {
+			return nil, err
+		}
+		// Like pinning, this narrows what chain and hostname verification
+		// already accepted.
+		verify := tc.VerifyConnection
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			return verifySANs(cs, allowed)
+		}
+	}
+	if cfg.Logger != nil {
+		log, verify := cfg.logger(), tc.VerifyConnection
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			logTLS(log, cs)
+			return nil
+		}
+	}
+	return tc, nil
+}
+
+// parseTLSVersion maps "1.0" through "1.3" (optionally prefixed "TLS") to
+// the matching crypto/tls version.
+func parseTLSVersion(name string) (uint16, error) {
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("unknown tls version %q: want 1.0, 1.1, 1.2, or 1.3", name)
+	}
+	return v, nil
+}
+
+// parseCipherSuites resolves IANA suite names such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Only the secure TLS 1.0-1.2 suites
+// known to crypto/tls are accepted; TLS 1.3 suites are not configurable.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := map[string]*tls.CipherSuite{}
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs
+	}
+	insecure := map[string]bool{}
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		cs, ok := known[name]
+		switch {
+		case insecure[name]:
+			return nil, fmt.Errorf("tls cipher suite %s is insecure and not supported", name)
+		case !ok:
+			return nil, fmt.Errorf("unknown tls cipher suite %q: see crypto/tls.CipherSuites for valid names", name)
+		case len(cs.SupportedVersions) == 1 && cs.SupportedVersions[0] == tls.VersionTLS13:
+			return nil, fmt.Errorf("tls cipher suite %s is TLS 1.3-only; TLS 1.3 suites cannot be configured", name)
+		}
+		ids = append(ids, cs.ID)
+	}
+	return ids, nil
+}
+
+// loadCAPool returns a pool holding base (if any) plus every certificate in
+// files. The system trust store is deliberately not consulted.
+func loadCAPool(base *x509.CertPool, files []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if base != nil {
+		pool = base.Clone()
+	}
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", path)
+		}
+	}
+	return pool, nil
+}
+
+// parsePins decodes SPKI SHA-256 pins given as hex (colons optional) or
+// standard base64.
+func parsePins(values []string) ([][]byte, error) {
+	pins := make([][]byte, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "sha256/")
+		var pin []byte
+		if raw, err := hex.DecodeString(strings.ReplaceAll(v, ":", "")); err == nil && len(raw) == sha256.Size {
+			pin = raw
+		} else if raw, err := base64.StdEncoding.DecodeString(v); err == nil && len(raw) == sha256.Size {
+			pin = raw
+		} else {
+			return nil, fmt.Errorf("invalid SPKI pin %q: want a SHA-256 digest in hex or base64", v)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// spkiHash returns the SHA-256 digest of cert's SubjectPublicKeyInfo.
+func spkiHash(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+func verifyPins(cs tls.ConnectionState, pins [][]byte) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrCertPinMismatch
+	}
+	got := spkiHash(cs.PeerCertificates[0])
+	for _, pin := range pins {
+		if bytes.Equal(pin, got) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: presented %s", ErrCertPinMismatch, hex.EncodeToString(got))
+}
+
+// parseSANPatterns normalizes TLSAllowedSANs entries: DNS names, matched
+// exactly and case-insensitively, or patterns whose leftmost label is "*",
+// matching any single label in its place.
+func parseSANPatterns(values []string) ([]string, error) {
+	patterns := make([]string, 0, len(values))
+	for _, v := range values {
+		p := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(v), "."))
+		rest, wildcard := strings.CutPrefix(p, "*.")
+		if p == "" || strings.Contains(rest, "*") || wildcard && !strings.Contains(rest, ".") {
+			return nil, fmt.Errorf("invalid allowed SAN %q: want a DNS name, optionally with a leading *. label", v)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// sanAllowed reports whether the DNS SAN name matches one of patterns. A
+// wildcard SAN matches only the identical pattern.
+func sanAllowed(name string, patterns []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, p := range patterns {
+		if name == p {
+			return true
+		}
+		if rest, ok := strings.CutPrefix(p, "*."); ok {
+			label, domain, found := strings.Cut(name, ".")
+			if found && label != "" && label != "*" && domain == rest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySANs requires every DNS SAN of the leaf to be allowed, so a
+// certificate naming further hosts fails even when one name matches.
+func verifySANs(cs tls.ConnectionState, patterns []string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrSANNotAllowed
+	}
+	sans := cs.PeerCertificates[0].DNSNames
+	ok := len(sans) > 0
+	for _, name := range sans {
+		ok = ok && sanAllowed(name, patterns)
+	}
+	if ok {
+		return nil
+	}
+	if len(sans) == 0 {
+		return fmt.Errorf("%w: the certificate has no DNS SANs", ErrSANNotAllowed)
+	}
+	return fmt.Errorf("%w: presented %s", ErrSANNotAllowed, strings.Join(sans, ", "))
+}
+
+// usesClientCert reports whether the configuration presents a client
+// certificate.
+func (cfg ClientConfig) usesClientCert() bool {
+	return cfg.TLSClientCert != "" || (cfg.TLSConfig != nil && len(cfg.TLSConfig.Certificates) > 0)
+}
+
+// classifyTLSError wraps err with ErrClientCertRejected, ErrTLSVersionTooLow,
+// or ErrTLSHandshake when it originates from the TLS layer, and returns it
+// unchanged otherwise.
+func classifyTLSError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	// The server either alerts that no common version exists or answers with
+	// one below MinVersion.
+	if strings.Contains(msg, "tls: protocol version not supported") || strings.Contains(msg, "tls: server selected unsupported protocol version") {
+		return fmt.Errorf("%w: %w", ErrTLSVersionTooLow, err)
+	}
+	const remote = "remote error: tls: "
+	if i := strings.Index(msg, remote); i >= 0 {
+		alert := msg[i+len(remote):]
+		for _, a := range clientCertAlerts {
+			if strings.HasPrefix(alert, a) {
+				return fmt.Errorf("%w: %w", ErrClientCertRejected, err)
+			}
+		}
+		return fmt.Errorf("%w: %w", ErrTLSHandshake, err)
+	}
+	var verifyErr *tls.CertificateVerificationError
+	var headerErr tls.RecordHeaderError
+	if errors.As(err, &verifyErr) || errors.As(err, &headerErr) || strings.Contains(msg, "tls: ") {
+		return fmt.Errorf("%w: %w", ErrTLSHandshake, err)
+	}
+	return err
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newMTLSServer starts a TLS server that requires client certificates signed
+// by clientCA.
+func newMTLSServer(t *testing.T, serverCA, clientCA *testCA) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(httpHandler(defaultHandler))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCA.issue(t, "localhost", false, "localhost").tls},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA.pool(),
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTLSMutualAuthRecordsTranscript(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	srv := newMTLSServer(t, serverCA, clientCA)
+
+	dir := t.TempDir()
+	certPath, keyPath := clientCA.issue(t, "go-client", true).writeFiles(t, dir, "client")
+	transcript := filepath.Join(dir, "tls.json")
+	err := Run(context.Background(), Options{
+		Config: ClientConfig{
+			Transport:     TransportTLS,
+			Endpoint:      srv.URL,
+			TLSConfig:     &tls.Config{RootCAs: serverCA.pool()},
+			TLSClientCert: certPath,
+			TLSClientKey:  keyPath,
+		},
+		RecordTranscript: transcript,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	content, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	var doc transcriptFile
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("decode transcript: %v", err)
+	}
+	if doc.Transport != TransportTLS || !doc.MTLS {
+		t.Fatalf("expected tls transcript marked mtls, got transport=%q mtls=%v", doc.Transport, doc.MTLS)
+	}
+	if len(doc.Messages) != 6 {
+		t.Fatalf("expected 6 entries, got %d", len(doc.Messages))
+	}
+}
+
+func TestTLSClientCertRejected(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	rogueCA := newTestCA(t, "rogue-ca")
+	srv := newMTLSServer(t, serverCA, clientCA)
+
+	dir := t.TempDir()
+	cases := map[string]ClientConfig{
+		"untrusted certificate": func() ClientConfig {
+			certPath, keyPath := rogueCA.issue(t, "rogue", true).writeFiles(t, dir, "rogue")
+			return ClientConfig{TLSClientCert: certPath, TLSClientKey: keyPath}
+		}(),
+		"missing certificate": {},
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg.Transport = TransportTLS
+			cfg.Endpoint = srv.URL
+			cfg.TLSConfig = &tls.Config{RootCAs: serverCA.pool()}
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			_, err = c.Initialize(context.Background())
+			if !errors.Is(err, ErrClientCertRejected) {
+				t.Fatalf("expected ErrClientCertRejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSHandshakeFailureIsDistinct(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	srv := newMTLSServer(t, serverCA, clientCA)
+
+	dir := t.TempDir()
+	certPath, keyPath := clientCA.issue(t, "go-client", true).writeFiles(t, dir, "client")
+	// No RootCAs: the client cannot verify the server.
+	c, err := New(ClientConfig{Transport: TransportTLS, Endpoint: srv.URL, TLSClientCert: certPath, TLSClientKey: keyPath})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	_, err = c.Initialize(context.Background())
+	if !errors.Is(err, ErrTLSHandshake) || errors.Is(err, ErrClientCertRejected) {
+		t.Fatalf("expected ErrTLSHandshake only, got %v", err)
+	}
+}
+
+func TestTLSClientCertConfigErrors(t *testing.T) {
+	if _, err := New(ClientConfig{Transport: TransportTLS, TLSClientCert: "client.crt"}); err == nil {
+		t.Fatal("expected error for certificate without key")
+	}
+	_, err := New(ClientConfig{Transport: TransportTLS, TLSClientCert: "missing.crt", TLSClientKey: "missing.key"})
+	if err == nil {
+		t.Fatal("expected error for unreadable key pair")
+	}
+}
+
+// newTLSServer starts a TLS server presenting a leaf issued by ca.
+func newTLSServer(t *testing.T, ca *testCA) (*httptest.Server, *testCert) {
+	t.Helper()
+	leaf := ca.issue(t, "localhost", false, "localhost")
+	srv := httptest.NewUnstartedServer(httpHandler(defaultHandler))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{leaf.tls}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, leaf
+}
+
+func writeCABundle(t *testing.T, cas ...*testCA) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	var bundle []byte
+	for _, ca := range cas {
+		bundle = append(bundle, ca.pem...)
+	}
+	if err := os.WriteFile(path, bundle, 0o600); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	return path
+}
+
+func TestTLSCustomCABundleAndPinning(t *testing.T) {
+	ca := newTestCA(t, "internal-ca")
+	other := newTestCA(t, "other-ca")
+	srv, leaf := newTLSServer(t, ca)
+	bundle := writeCABundle(t, other, ca)
+
+	pin := spkiHash(leaf.leaf)
+	wrongPin := spkiHash(ca.issue(t, "elsewhere", false).leaf)
+	cases := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{"ca only", nil, nil},
+		{"hex pin", []string{hex.EncodeToString(pin)}, nil},
+		{"base64 pin among several", []string{hex.EncodeToString(wrongPin), base64.StdEncoding.EncodeToString(pin)}, nil},
+		{"pin mismatch despite trusted ca", []string{hex.EncodeToString(wrongPin)}, ErrCertPinMismatch},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(ClientConfig{Transport: TransportTLS, Endpoint: srv.URL, TLSCAFiles: []string{bundle}, TLSPinSHA256: tc.pins})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			_, err = c.Initialize(context.Background())
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("Initialize: %v", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTLSAllowedSANs(t *testing.T) {
+	ca := newTestCA(t, "internal-ca")
+	leaf := ca.issue(t, "terminator", false, "localhost", "*.svc.example.com", "api.example.com")
+	srv := httptest.NewUnstartedServer(httpHandler(defaultHandler))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{leaf.tls}}
+	srv.StartTLS()
+	defer srv.Close()
+	bundle := writeCABundle(t, ca)
+	pin := hex.EncodeToString(spkiHash(leaf.leaf))
+	wrongPin := hex.EncodeToString(spkiHash(ca.issue(t, "elsewhere", false).leaf))
+
+	cases := []struct {
+		name    string
+		allowed []string
+		pins    []string
+		wantErr error
+	}{
+		{"exact names", []string{"LOCALHOST", "*.svc.example.com", "api.example.com"}, nil, nil},
+		{"pattern covers a name", []string{"localhost", "*.svc.example.com", "*.example.com"}, []string{pin}, nil},
+		{"one name outside", []string{"localhost", "*.svc.example.com"}, nil, ErrSANNotAllowed},
+		{"pattern does not cover the wildcard", []string{"localhost", "db.svc.example.com", "api.example.com"}, nil, ErrSANNotAllowed},
+		{"pattern spans one label", []string{"localhost", "*.example.com"}, nil, ErrSANNotAllowed},
+		{"pin still applies", []string{"localhost", "*.svc.example.com", "api.example.com"}, []string{wrongPin}, ErrCertPinMismatch},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(ClientConfig{Transport: TransportTLS, Endpoint: srv.URL, TLSCAFiles: []string{bundle}, TLSPinSHA256: tc.pins, TLSAllowedSANs: tc.allowed})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			_, err = c.Initialize(context.Background())
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("Initialize: %v", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr == ErrSANNotAllowed && !strings.Contains(err.Error(), "localhost, *.svc.example.com, api.example.com") {
+				t.Fatalf("error does not list the presented SANs: %v", err)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "*", "*.com", "api.*.example.com"} {
+		if _, err := New(ClientConfig{Transport: TransportTLS, TLSAllowedSANs: []string{bad}}); err == nil {
+			t.Errorf("allowed SAN %q was accepted", bad)
+		}
+	}
+}
+
+func TestTLSCABundleReplacesSystemStore(t *testing.T) {
+	srv, _ := newTLSServer(t, newTestCA(t, "server-ca"))
+	bundle := writeCABundle(t, newTestCA(t, "unrelated-ca"))
+	c, err := New(ClientConfig{Transport: TransportTLS, Endpoint: srv.URL, TLSCAFiles: []string{bundle}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); !errors.Is(err, ErrTLSHandshake) {
+		t.Fatalf("expected verification failure, got %v", err)
+	}
+}
+
+func TestTLSTrustConfigErrors(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]ClientConfig{
+		"missing bundle": {TLSCAFiles: []string{filepath.Join(t.TempDir(), "absent.pem")}},
+		"empty bundle":   {TLSCAFiles: []string{empty}},
+		"short pin":      {TLSPinSHA256: []string{"abcd"}},
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg.Transport = TransportTLS
+			if _, err := New(cfg); err == nil {
+				t.Fatal("expected construction error")
+			}
+		})
+	}
+}
+
+func TestTLSRefusesLegacyServer(t *testing.T) {
+	ca := newTestCA(t, "server-ca")
+	leaf := ca.issue(t, "localhost", false, "localhost")
+	srv := httptest.NewUnstartedServer(httpHandler(defaultHandler))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{leaf.tls},
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS10,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for name, min := range map[string]string{"default": "", "min 1.2": "1.2", "min 1.3": "1.3"} {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(ClientConfig{
+				Transport:     TransportTLS,
+				Endpoint:      srv.URL,
+				TLSConfig:     &tls.Config{RootCAs: ca.pool()},
+				TLSMinVersion: min,
+			})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(context.Background())
+			if _, err := c.Initialize(context.Background()); !errors.Is(err, ErrTLSVersionTooLow) {
+				t.Fatalf("expected ErrTLSVersionTooLow, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSVersionAndCipherConfig(t *testing.T) {
+	cfg := ClientConfig{
+		TLSMinVersion:   "TLS1.3",
+		TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_rsa_with_chacha20_poly1305_sha256"},
+	}
+	tc, err := cfg.tlsConfig()
+	if err != nil {
+		t.Fatalf("tlsConfig: %v", err)
+	}
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256}
+	if tc.MinVersion != tls.VersionTLS13 || !reflect.DeepEqual(tc.CipherSuites, want) {
+		t.Fatalf("unexpected config: min %x suites %x", tc.MinVersion, tc.CipherSuites)
+	}
+
+	cases := map[string]struct {
+		cfg  ClientConfig
+		want string
+	}{
+		"unknown version": {ClientConfig{TLSMinVersion: "1.4"}, `unknown tls version "1.4"`},
+		"unknown suite":   {ClientConfig{TLSCipherSuites: []string{"TLS_ROT13_WITH_NOTHING"}}, `unknown tls cipher suite "TLS_ROT13_WITH_NOTHING"`},
+		"insecure suite":  {ClientConfig{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, "insecure"},
+		"tls 1.3 suite":   {ClientConfig{TLSCipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}, "TLS 1.3-only"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.cfg.Transport = TransportTLS
+			_, err := New(tc.cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// MethodCountTokens asks the server how many tokens a model reads from an
+// input.
+const MethodCountTokens = "mcp.tokens.count"
+
+// ErrInputTooLong reports an input over the model's MaxInputTokens under
+// WithTruncate(TruncateError). It matches ErrPayloadTooLarge.
+var ErrInputTooLong error = &classError{msg: "input exceeds the model's token limit", class: ErrPayloadTooLarge}
+
+// TruncateMode selects what WithTruncate does with an input longer than the
+// model accepts.
+type TruncateMode int
+
+const (
+	// TruncateNone sends inputs as they are; the server decides.
+	TruncateNone TruncateMode = iota
+	// TruncateEnd keeps the start of the input and drops the rest.
+	TruncateEnd
+	// TruncateStart keeps the end of the input and drops its start.
+	TruncateStart
+	// TruncateError fails the call with ErrInputTooLong before sending it.
+	TruncateError
+)
+
+func (m TruncateMode) String() string {
+	switch m {
+	case TruncateNone:
+		return "none"
+	case TruncateEnd:
+		return "end"
+	case TruncateStart:
+		return "start"
+	case TruncateError:
+		return "error"
+	}
+	return fmt.Sprintf("TruncateMode(%d)", int(m))
+}
+
+// WithTruncate checks every input against the MaxInputTokens ListModels
+// reports for the model and, per mode, trims the over-long ones or fails the
+// call before any input is sent. Lengths are measured with EstimateTokens,
+// so trimming stays local; a model without a limit fails the call with a
+// *ValidationError. The indexes of trimmed inputs are reported through
+// WithEmbedInfo.
+func WithTruncate(mode TruncateMode) EmbedOption {
+	return func(o *embedOptions) { o.truncate = mode }
+}
+
+// countTokensResult is the result of MethodCountTokens.
+type countTokensResult struct {
+	Tokens int `json:"tokens"`
+}
+
+// CountTokens returns the number of tokens model reads from text, defaulting
+// to ClientConfig.Model. It asks the server through MethodCountTokens and,
+// once a server has answered that it lacks the method, estimates locally
+// with EstimateTokens instead.
+func (c *Client) CountTokens(ctx context.Context, model, text string) (int, error) {
+	if model == "" {
+		model = c.cfg.Model
+	}
+	c.mu.Lock()
+	local := c.countTokensUnsupported
+	c.mu.Unlock()
+	if local {
+		return EstimateTokens(text), nil
+	}
+
+	var result countTokensResult
+	err := c.Call(ctx, MethodCountTokens, map[string]any{"model": model, "input": text}, &result)
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr) && rpcErr.Code == CodeMethodNotFound:
+		c.mu.Lock()
+		c.countTokensUnsupported = true
+		c.mu.Unlock()
+		return EstimateTokens(text), nil
+	case err != nil:
+		return 0, err
+	}
+	return result.Tokens, nil
+}
+
+// EstimateTokens approximates the token count of text the way common BPE
+// vocabularies split it: about four characters per token within a word, one
+// token per punctuation mark, and one per character of scripts written
+// without spaces. It tends to overcount, which keeps trimmed inputs within
+// the limit.
+func EstimateTokens(text string) int {
+	tokens, word := 0, 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		default:
+			word++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// planTruncation applies o.truncate to texts, returning them unchanged when
+// nothing needs trimming and recording the trimmed indexes in o.
+func (c *Client) planTruncation(ctx context.Context, texts []string, o *embedOptions) ([]string, error) {
+	if o.truncate == TruncateNone {
+		return texts, nil
+	}
+	model, err := c.lookupModel(ctx, o.model)
+	if err != nil {
+		return nil, err
+	}
+	limit := model.MaxInputTokens
+	if limit <= 0 {
+		v := &optionCheck{call: o.call}
+		checkTruncation(v, o, model)
+		return nil, v.err()
+	}
+	out := texts
+	for i, text := range texts {
+		n := EstimateTokens(text)
+		if n <= limit {
+			continue
+		}
+		if o.truncate == TruncateError {
+			return nil, fmt.Errorf("input %d has about %d tokens, over the %d of model %q: %w", i, n, limit, model.Name, ErrInputTooLong)
+		}
+		if len(o.truncated) == 0 {
+			out = append([]string(nil), texts...)
+		}
+		out[i] = trimTokens(text, limit, o.truncate == TruncateStart)
+		o.truncated = append(o.truncated, i)
+	}
+	return out, nil
+}
+
+// trimTokens returns the longest prefix of text, or suffix when fromStart
+// is set, that EstimateTokens puts within limit.
+func trimTokens(text string, limit int, fromStart bool) string {
+	runes := []rune(text)
+	cut := func(n int) string {
+		if fromStart {
+			return string(runes[len(runes)-n:])
+		}
+		return string(runes[:n])
+	}
+	// Estimates never shrink as a prefix or suffix grows, so search for the
+	// longest one that fits.
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EstimateTokens(cut(mid)) <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return cut(lo)
+}
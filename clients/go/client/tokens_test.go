@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// shortModelHandler serves a model that reads at most 4 tokens.
+func shortModelHandler(req *Request) *Response {
+	if req.Method == MethodListModels {
+		models := []ModelInfo{{Name: DefaultModel, Dimension: 3, MaxInputTokens: 4}}
+		raw, _ := json.Marshal(listModelsResult{Models: models})
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}
+	return defaultHandler(req)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{
+		"":                     0,
+		"a":                    1,
+		"abcd":                 1,
+		"abcde":                2,
+		"hello world":          4,
+		"hi, there!":           5,
+		"  spaced   out  ":     3,
+		"日本語":                  3,
+		"internationalization": 5,
+	}
+	for text, want := range cases {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	// The fake counts words, unlike the estimate.
+	if n, err := c.CountTokens(context.Background(), "", "internationalization of everything"); err != nil || n != 3 {
+		t.Fatalf("CountTokens = %d, %v; want the server's 3", n, err)
+	}
+
+	sink := &recordingSink{}
+	unsupported := func(req *Request) *Response {
+		if req.Method == MethodCountTokens {
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: CodeMethodNotFound, Message: "method not found"}}
+		}
+		return defaultHandler(req)
+	}
+	local, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(unsupported), Recorder: sink})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer local.Close(context.Background())
+	for i := 0; i < 2; i++ {
+		if n, err := local.CountTokens(context.Background(), "", "internationalization"); err != nil || n != 5 {
+			t.Fatalf("CountTokens = %d, %v; want the estimate 5", n, err)
+		}
+	}
+	// Only the first call asked the server.
+	if len(sink.entries) != 2 {
+		t.Fatalf("expected one exchange, got %d entries", len(sink.entries))
+	}
+}
+
+func TestWithTruncate(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(shortModelHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ctx := context.Background()
+	long := "one two three four five six"
+
+	for _, tc := range []struct {
+		mode TruncateMode
+		// kept is the trimmed input; the fake's first component is its length.
+		kept string
+	}{
+		{TruncateEnd, "one two three "},
+		{TruncateStart, "hree four five six"},
+	} {
+		var info EmbedInfo
+		got, err := c.EmbedBatch(ctx, []string{"short", long}, WithTruncate(tc.mode), WithEmbedInfo(&info))
+		if err != nil {
+			t.Fatalf("%v: EmbedBatch: %v", tc.mode, err)
+		}
+		if got[0][0] != 5 || int(got[1][0]) != len(tc.kept) {
+			t.Fatalf("%v: expected %q to be sent, got vectors %v", tc.mode, tc.kept, got)
+		}
+		if !reflect.DeepEqual(info.TruncatedInputs, []int{1}) {
+			t.Fatalf("%v: truncation not reported: %+v", tc.mode, info)
+		}
+	}
+
+	var info EmbedInfo
+	if _, err := c.Embed(ctx, "short", WithTruncate(TruncateEnd), WithEmbedInfo(&info)); err != nil || info.TruncatedInputs != nil {
+		t.Fatalf("short input: %v, %+v", err, info)
+	}
+	_, err = c.Embed(ctx, long, WithTruncate(TruncateError))
+	if !errors.Is(err, ErrInputTooLong) || !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrInputTooLong, got %v", err)
+	}
+}
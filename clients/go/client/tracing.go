@@ -0,0 +1,291 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// TraceparentHeader and TracestateHeader carry the W3C trace context of a
+// request over the http, tls, http3, and grpc transports. The others send them
+// as meta.traceparent and meta.tracestate.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// tracerName names the Tracer a client asks its TracerProvider for.
+const tracerName = "github.com/Zaevrynth/Zaevrynth/clients/go/client"
+
+// TracerProvider supplies the Tracer instrumenting a client. It mirrors the
+// interfaces of go.opentelemetry.io/otel/trace, which the module does not
+// depend on; the embedotel module adapts an OpenTelemetry TracerProvider:
+//
+//	c, err := client.NewClient(endpoint, embedotel.WithTracerProvider(tp))
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+// Tracer starts spans. Start returns ctx carrying the new span, a child
+// of the span ctx already carries, if any. The spans a client starts are
+// client spans.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	// SetStatusError marks the span failed.
+	SetStatusError(description string)
+	// SpanContext identifies the span to the server.
+	SpanContext() SpanContext
+	End()
+}
+
+// Attribute is a key and a string, int, int64, or bool value.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanContext is the part of a span propagated to the server.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+// traceparent formats sc as a W3C traceparent value, or returns "" for a
+// span without IDs, such as one of a no-op tracer.
+func (sc SpanContext) traceparent() string {
+	if sc.TraceID == [16]byte{} || sc.SpanID == [8]byte{} {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// Span attribute keys. The rpc.* keys follow the OpenTelemetry semantic
+// conventions.
+const (
+	attrRPCSystem    = "rpc.system"
+	attrRPCMethod    = "rpc.method"
+	attrTransport    = "embednexus.transport"
+	attrEndpoint     = "embednexus.endpoint"
+	attrModel        = "embednexus.model"
+	attrBatchSize    = "embednexus.batch_size"
+	attrRetryAttempt = "embednexus.retry.attempt"
+	attrRequestID    = "embednexus.request_id"
+	attrResponseSize = "embednexus.response.size"
+	attrErrorType    = "error.type"
+	attrFrameIndex   = "embednexus.frame.index"
+	attrStreamFrames = "embednexus.stream.frames"
+)
+
+// WithTracerProvider sets ClientConfig.TracerProvider, tracing every
+// request.
+func WithTracerProvider(tp TracerProvider) Option {
+	return func(o *clientOptions) error {
+		if tp == nil {
+			return errors.New("WithTracerProvider: tracer provider must not be nil")
+		}
+		o.tracerProvider = tp
+		return nil
+	}
+}
+
+// retryAttemptKey carries the attempt number interceptRetry is on.
+type retryAttemptKey struct{}
+
+// spanKey carries the span of a request to roundTrip, which propagates it.
+type spanKey struct{}
+
+// startSpan starts the span of req, named after its method.
+func (c *Client) startSpan(ctx context.Context, req *Request) (context.Context, Span) {
+	ctx, span := c.tracer.Start(ctx, req.Method)
+	attrs := []Attribute{
+		{attrRPCSystem, "jsonrpc"},
+		{attrRPCMethod, req.Method},
+		{attrTransport, c.transport.Kind()},
+		{attrEndpoint, c.cfg.endpointLabel()},
+	}
+	if req.Meta != nil && req.Meta.RequestID != "" {
+		attrs = append(attrs, Attribute{attrRequestID, req.Meta.RequestID})
+	}
+	var params struct {
+		Model  string            `json:"model"`
+		Inputs []json.RawMessage `json:"inputs"`
+	}
+	if json.Unmarshal(req.Params, &params) == nil {
+		if params.Model != "" {
+			attrs = append(attrs, Attribute{attrModel, params.Model})
+		}
+		if params.Inputs != nil {
+			attrs = append(attrs, Attribute{attrBatchSize, len(params.Inputs)})
+		}
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// endSpan records the outcome err of span, which ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		class := ErrorClass(err)
+		span.SetAttributes(Attribute{attrErrorType, class})
+		span.RecordError(err)
+		span.SetStatusError(class)
+	}
+	span.End()
+}
+
+// interceptTrace traces each attempt at a request with a span of
+// ClientConfig.TracerProvider. It runs first in the direct chain, so retries
+// get a span each.
+func (c *Client) interceptTrace(ctx context.Context, req *Request, next Invoker) (*Response, error) {
+	ctx, span := c.startSpan(ctx, req)
+	attempt, ok := ctx.Value(retryAttemptKey{}).(int)
+	if !ok {
+		attempt = 1
+	}
+	span.SetAttributes(Attribute{attrRetryAttempt, attempt})
+	resp, err := next(ctx, req)
+	if resp != nil {
+		span.SetAttributes(Attribute{attrResponseSize, len(resp.Result)})
+	}
+	endSpan(span, callError(resp, err))
+	return resp, err
+}
+
+// propagateTrace attaches the trace context of the span in ctx to req: as
+// a header, carried to the transport by ctx, over http, tls, and http3,
+// and in a copy of req's meta otherwise. It runs at the end of the chain,
+// so transcripts do not record it.
+func (c *Client) propagateTrace(ctx context.Context, req *Request) (context.Context, *Request) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return ctx, req
+	}
+	traceparent := span.SpanContext().traceparent()
+	if traceparent == "" {
+		return ctx, req
+	}
+	ctx = context.WithValue(ctx, traceparentKey{}, span.SpanContext())
+	switch c.transport.Kind() {
+	case TransportHTTP, TransportTLS, TransportHTTP3, TransportGRPC:
+		return ctx, req
+	}
+	traced := *req
+	var meta Meta
+	if req.Meta != nil {
+		meta = *req.Meta
+	}
+	meta.Traceparent, meta.Tracestate = traceparent, span.SpanContext().TraceState
+	traced.Meta = &meta
+	return ctx, &traced
+}
+
+// traceparentKey carries the SpanContext the http transport sends as
+// headers.
+type traceparentKey struct{}
+
+// contextSpanContext returns the SpanContext propagateTrace left in ctx.
+func contextSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(traceparentKey{}).(SpanContext)
+	return sc, ok
+}
+
+// TraceLink ties the entries of a traced exchange to the server's traces
+// and logs; see Entry.Trace.
+type TraceLink struct {
+	// TraceID and SpanID identify, in hex, the span the request was sent
+	// under, as its traceparent does.
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+	// RequestID is the client's request ID, and ServerRequestID the
+	// server's own, from the entries recorded once its answer gave one;
+	// see CaptureServerRequestID.
+	RequestID       string `json:"request_id,omitempty"`
+	ServerRequestID string `json:"server_request_id,omitempty"`
+}
+
+// String formats l as "trace <id> span <id> request <id> server request
+// <id>", leaving out the request IDs it lacks.
+func (l TraceLink) String() string {
+	parts := []string{"trace " + l.TraceID, "span " + l.SpanID}
+	if l.RequestID != "" {
+		parts = append(parts, "request "+l.RequestID)
+	}
+	if l.ServerRequestID != "" {
+		parts = append(parts, "server request "+l.ServerRequestID)
+	}
+	return strings.Join(parts, " ")
+}
+
+// traceRecorder stamps the entries of a traced exchange with its
+// TraceLink.
+type traceRecorder struct {
+	Recorder
+	mu   sync.Mutex
+	link TraceLink
+}
+
+// linkTrace returns rec stamping the entries of req with the trace of the
+// span in ctx, or rec itself for a request not traced.
+func linkTrace(ctx context.Context, rec Recorder, req *Request) Recorder {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok || rec == nil {
+		return rec
+	}
+	sc := span.SpanContext()
+	if sc.traceparent() == "" {
+		return rec
+	}
+	link := TraceLink{TraceID: hex.EncodeToString(sc.TraceID[:]), SpanID: hex.EncodeToString(sc.SpanID[:])}
+	if req.Meta != nil {
+		link.RequestID = req.Meta.RequestID
+	}
+	return &traceRecorder{Recorder: rec, link: link}
+}
+
+// answered takes the server's ID for the request from its answer, resp or
+// err, for the entries recorded after it.
+func (r *traceRecorder) answered(resp *Response, err error) {
+	id := serverRequestID(resp)
+	var apiErr *APIError
+	if id == "" && errors.As(err, &apiErr) {
+		id = apiErr.ServerRequestID
+	}
+	if id == "" {
+		return
+	}
+	r.mu.Lock()
+	r.link.ServerRequestID = id
+	r.mu.Unlock()
+}
+
+func (r *traceRecorder) Record(entry Entry) {
+	r.mu.Lock()
+	link := r.link
+	r.mu.Unlock()
+	entry.Trace = &link
+	r.Recorder.Record(entry)
+}
+
+// noteAnswer passes the answer to a request to rec, when it links the
+// request's trace.
+func noteAnswer(rec Recorder, resp *Response, err error) {
+	if r, ok := rec.(*traceRecorder); ok {
+		r.answered(resp, err)
+	}
+}
@@ -0,0 +1,273 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTracer records the spans it starts, numbering them from 1.
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (tr *fakeTracer) Tracer(string) Tracer { return tr }
+
+func (tr *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	span := &fakeSpan{name: name, attrs: map[string]any{}}
+	span.sc.TraceID[15] = 1
+	span.sc.SpanID[7] = byte(len(tr.spans) + 1)
+	span.sc.Sampled = true
+	tr.spans = append(tr.spans, span)
+	return ctx, span
+}
+
+func (tr *fakeTracer) ended() []*fakeSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	var ended []*fakeSpan
+	for _, s := range tr.spans {
+		if s.ended {
+			ended = append(ended, s)
+		}
+	}
+	return ended
+}
+
+type fakeSpan struct {
+	name   string
+	sc     SpanContext
+	attrs  map[string]any
+	events []Attribute
+	status string
+	err    error
+	ended  bool
+}
+
+func (s *fakeSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *fakeSpan) AddEvent(name string, attrs ...Attribute) {
+	s.events = append(s.events, attrs...)
+}
+
+func (s *fakeSpan) RecordError(err error)             { s.err = err }
+func (s *fakeSpan) SetStatusError(description string) { s.status = description }
+func (s *fakeSpan) SpanContext() SpanContext          { return s.sc }
+func (s *fakeSpan) End()                              { s.ended = true }
+
+func TestTracingHTTP(t *testing.T) {
+	var calls atomic.Int32
+	var traceparents []string
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get(TraceparentHeader))
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	tracer := &fakeTracer{}
+	c, err := New(ClientConfig{
+		Transport:      TransportHTTP,
+		Endpoint:       srv.URL,
+		Retry:          RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		TracerProvider: tracer,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	params := embedParams{Model: "mini", Inputs: []string{"a", "b"}}
+	if err := c.Call(context.Background(), MethodEmbed, params, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("server saw %d calls, want 2", calls.Load())
+	}
+
+	spans := tracer.ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want one per attempt", len(spans))
+	}
+	for i, s := range spans {
+		if s.name != MethodEmbed || s.attrs[attrRetryAttempt] != i+1 || s.attrs[attrTransport] != TransportHTTP ||
+			s.attrs[attrModel] != "mini" || s.attrs[attrBatchSize] != 2 {
+			t.Fatalf("span %d: %s %v", i, s.name, s.attrs)
+		}
+		if want := s.sc.traceparent(); traceparents[i] != want {
+			t.Fatalf("attempt %d sent traceparent %q, want %q", i+1, traceparents[i], want)
+		}
+	}
+	if spans[0].status != "api" || spans[0].attrs[attrErrorType] != "api" || spans[0].err == nil {
+		t.Fatalf("failed attempt: status %q, attrs %v", spans[0].status, spans[0].attrs)
+	}
+	if spans[1].status != "" || spans[1].attrs[attrResponseSize] == nil {
+		t.Fatalf("successful attempt: status %q, attrs %v", spans[1].status, spans[1].attrs)
+	}
+}
+
+func TestTracingMeta(t *testing.T) {
+	var seen []*Meta
+	tracer := &fakeTracer{}
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(func(req *Request) *Response {
+		seen = append(seen, req.Meta)
+		if req.Method == "test.fail" {
+			return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &RPCError{Code: -32000, Message: "broken"}}
+		}
+		return defaultHandler(req)
+	}), TracerProvider: tracer})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	seen = nil
+	before := len(tracer.ended())
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := c.Call(context.Background(), "test.fail", nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	spans := tracer.ended()[before:]
+	if len(spans) != 2 || len(seen) != 2 {
+		t.Fatalf("%d spans for %d requests, want 2", len(spans), len(seen))
+	}
+	for i, s := range spans {
+		if seen[i] == nil || seen[i].Traceparent != s.sc.traceparent() {
+			t.Fatalf("request %d carried meta %+v, want traceparent %q", i, seen[i], s.sc.traceparent())
+		}
+	}
+	if spans[0].name != MethodPing || spans[0].attrs[attrTransport] != TransportInProc || spans[0].status != "" {
+		t.Fatalf("ping span: %s %v status %q", spans[0].name, spans[0].attrs, spans[0].status)
+	}
+	if spans[1].name != "test.fail" || spans[1].status != "api" || spans[1].err == nil {
+		t.Fatalf("failed call: %s status %q, error %v", spans[1].name, spans[1].status, spans[1].err)
+	}
+}
+
+func TestTracingStream(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	tracer := &fakeTracer{}
+	rec := &recordingSink{}
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, TracerProvider: tracer, Recorder: rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	ch, err := c.EmbedStream(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	if results := collect(t, ch); len(results) != 3 {
+		t.Fatalf("results %+v", results)
+	}
+
+	// The span ends before the channel closes.
+	var stream *fakeSpan
+	for _, s := range tracer.ended() {
+		if s.name == MethodEmbedStream {
+			stream = s
+		}
+	}
+	if stream == nil {
+		t.Fatal("no span ended for the stream")
+	}
+	if len(stream.events) != 3 || stream.attrs[attrStreamFrames] != 3 || stream.attrs[attrBatchSize] != 3 {
+		t.Fatalf("stream span: events %v, attrs %v", stream.events, stream.attrs)
+	}
+	// The request and every frame are linked to the stream's span.
+	var streamEntries int
+	for _, e := range rec.entries {
+		if e.Trace != nil && e.Trace.SpanID == hex.EncodeToString(stream.sc.SpanID[:]) {
+			streamEntries++
+		}
+	}
+	if streamEntries != 5 {
+		t.Fatalf("%d of %d entries linked to the stream span, want 5", streamEntries, len(rec.entries))
+	}
+}
+
+func TestTracingTranscriptLinks(t *testing.T) {
+	var calls atomic.Int32
+	ok := httpHandler(defaultHandler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set(RequestIDHeader, fmt.Sprintf("srv-%d", n))
+		if n == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	tracer := &fakeTracer{}
+	rec := &recordingSink{}
+	c, err := New(ClientConfig{
+		Transport:      TransportHTTP,
+		Endpoint:       srv.URL,
+		Retry:          RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		TracerProvider: tracer,
+		Recorder:       rec,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if err := c.Call(WithRequestID(context.Background(), "req-1"), MethodPing, nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	// Each attempt's entries carry its span, and those after the answer
+	// the server's ID too.
+	want := []TraceLink{
+		{TraceID: "00000000000000000000000000000001", SpanID: "0000000000000001", RequestID: "req-1"},
+		{TraceID: "00000000000000000000000000000001", SpanID: "0000000000000001", RequestID: "req-1", ServerRequestID: "srv-1"},
+		{TraceID: "00000000000000000000000000000001", SpanID: "0000000000000002", RequestID: "req-1"},
+		{TraceID: "00000000000000000000000000000001", SpanID: "0000000000000002", RequestID: "req-1", ServerRequestID: "srv-2"},
+	}
+	if len(rec.entries) != len(want) {
+		t.Fatalf("%d entries recorded, want %d", len(rec.entries), len(want))
+	}
+	for i, e := range rec.entries {
+		if e.Trace == nil || *e.Trace != want[i] {
+			t.Fatalf("entry %d (%s): trace %+v, want %+v", i, e.Direction, e.Trace, want[i])
+		}
+	}
+	if got := want[3].String(); got != "trace 00000000000000000000000000000001 span 0000000000000002 request req-1 server request srv-2" {
+		t.Fatalf("String() = %q", got)
+	}
+
+	untraced := &recordingSink{}
+	plain, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, Recorder: untraced})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer plain.Close(context.Background())
+	if _, err := plain.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	for i, e := range untraced.entries {
+		if e.Trace != nil {
+			t.Fatalf("untraced entry %d: trace %+v", i, e.Trace)
+		}
+	}
+}
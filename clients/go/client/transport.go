@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnixUnsupported is returned when the unix transport is requested on a
+// platform without AF_UNIX support.
+var ErrUnixUnsupported = errors.New("unix transport is not supported on windows; use stdio, http, or tls")
+
+// Transport carries request envelopes to the server and returns the matching
+// responses. Implementations connect lazily on the first RoundTrip so that
+// constructing a client never performs I/O.
+type Transport interface {
+	// Kind reports the transport identifier recorded in transcripts.
+	Kind() string
+	// RoundTrip sends req and waits for the response carrying the same ID.
+	RoundTrip(ctx context.Context, req *Request) (*Response, error)
+	// Close releases the underlying connection or subprocess.
+	Close() error
+}
+
+// NewTransport builds the transport selected by cfg without connecting it.
+func NewTransport(cfg ClientConfig) (Transport, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := cfg.withCredentials()
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Transport {
+	case TransportStdio:
+		opts := cfg.streamOptions()
+		opts.policy, opts.target = cfg.restartPolicy(), cfg.Command[0]
+		return newStdioTransport(cfg.Command, opts), nil
+	case TransportHTTP, TransportTLS, TransportHTTP3:
+		t, err := newHTTPTransport(cfg)
+		if err != nil || cfg.WireProtocol != OpenAICompat {
+			return t, err
+		}
+		return newOpenAITransport(t), nil
+	case TransportGRPC:
+		t, err := newHTTPTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newGRPCTransport(t), nil
+	case TransportWebSocket:
+		return newWSTransport(cfg)
+	case TransportInProc:
+		return newInProcTransport(cfg.Handler, cfg.streamOptions()), nil
+	case TransportUnix:
+		opts := cfg.streamOptions()
+		opts.target = cfg.SocketPath
+		return newUnixTransport(cfg.SocketPath, opts)
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// newUnixTransport exchanges envelopes over an AF_UNIX stream socket using the
+// same framing as the stdio transport. The socket is dialed on first use and
+// the dial honors the request context's deadline.
+func newUnixTransport(path string, opts streamOptions) (Transport, error) {
+	return newStreamTransport(TransportUnix, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}, opts), nil
+}
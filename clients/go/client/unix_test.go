@@ -0,0 +1,94 @@
+//go:build !windows
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listenUnix serves the fake protocol on a fresh socket and returns its path.
+// Socket paths are kept short because sun_path is limited to ~104 bytes.
+func listenUnix(t *testing.T, handle fakeHandler) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "enx")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "s.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = serveStream(conn, conn, handle)
+			}()
+		}
+	}()
+	return path
+}
+
+func TestUnixTransportSession(t *testing.T) {
+	path := listenUnix(t, defaultHandler)
+	var rec recordingSink
+	c, err := New(ClientConfig{Transport: TransportUnix, SocketPath: path, Recorder: &rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := c.Embed(ctx, "socket"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(rec.entries) != 4 {
+		t.Fatalf("expected 4 recorded entries, got %d", len(rec.entries))
+	}
+	if c.transport.Kind() != TransportUnix {
+		t.Fatalf("unexpected kind %q", c.transport.Kind())
+	}
+}
+
+func TestUnixTransportDialHonorsContext(t *testing.T) {
+	path := listenUnix(t, defaultHandler)
+	c, err := New(ClientConfig{Transport: TransportUnix, SocketPath: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Initialize(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestUnixTransportMissingSocket(t *testing.T) {
+	c, err := New(ClientConfig{Transport: TransportUnix, SocketPath: "/nonexistent/embednexus.sock"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Initialize(context.Background()); err == nil {
+		t.Fatal("expected dial failure")
+	}
+}
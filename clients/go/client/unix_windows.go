@@ -0,0 +1,7 @@
+//go:build windows
+
+package client
+
+func newUnixTransport(string, streamOptions) (Transport, error) {
+	return nil, ErrUnixUnsupported
+}
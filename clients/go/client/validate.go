@@ -0,0 +1,142 @@
+package client
+
+import (
+	"fmt"
+	"math"
+)
+
+// ErrInvalidResponse marks an embed response that fails validation; the
+// error is a *ResponseValidationError saying how. It matches ErrProtocol.
+var ErrInvalidResponse error = &classError{"invalid embed response", ErrProtocol}
+
+// The rules a ResponseValidationError reports broken.
+const (
+	// RuleCount: the response holds another number of results than there
+	// were inputs.
+	RuleCount = "count"
+	// RuleIndex: a result's index is out of range or repeats another's.
+	RuleIndex = "index"
+	// RuleDimension: a vector's length is not the model's dimension.
+	RuleDimension = "dimension"
+	// RuleFinite: a vector holds a NaN or an infinity.
+	RuleFinite = "finite"
+)
+
+// ResponseValidationError is an embed response that breaks one of the
+// rules the client checks; see WithLaxValidation.
+type ResponseValidationError struct {
+	// Method is the request answered, MethodEmbed or MethodEmbedStream.
+	Method string
+	// Rule is the rule broken, one of RuleCount, RuleIndex, RuleDimension,
+	// and RuleFinite.
+	Rule string
+	// Index is the index of the offending result, -1 for RuleCount.
+	Index int
+	// Want and Got are the expected and actual number of results for
+	// RuleCount and length of the vector for RuleDimension; Want is the
+	// number of inputs for RuleIndex.
+	Want, Got int
+	// Component is the position of the value in the vector for
+	// RuleFinite, and Value the value.
+	Component int
+	Value     float32
+}
+
+func (e *ResponseValidationError) Error() string {
+	var detail string
+	switch e.Rule {
+	case RuleCount:
+		detail = fmt.Sprintf("%d results for %d inputs", e.Got, e.Want)
+	case RuleIndex:
+		if e.Index < 0 || e.Index >= e.Want {
+			detail = fmt.Sprintf("index %d out of range for %d inputs", e.Index, e.Want)
+		} else {
+			detail = fmt.Sprintf("index %d repeated", e.Index)
+		}
+	case RuleDimension:
+		detail = fmt.Sprintf("vector %d has %d components, want %d", e.Index, e.Got, e.Want)
+	case RuleFinite:
+		detail = fmt.Sprintf("vector %d component %d is %v", e.Index, e.Component, e.Value)
+	default:
+		detail = e.Rule
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Method, ErrInvalidResponse, detail)
+}
+
+func (e *ResponseValidationError) Unwrap() error { return ErrInvalidResponse }
+
+// WithLaxValidation turns off the checks of the vectors in embed
+// responses, their length against the model's dimension and their values
+// against NaN and infinity, passing them through as the server sent them.
+// The results are still counted against the inputs and their indices
+// checked, without which they cannot be put in input order.
+func WithLaxValidation() Option {
+	return func(o *clientOptions) error {
+		o.laxValidation = true
+		return nil
+	}
+}
+
+// responseValidator checks the results of one embed request as they are
+// read.
+type responseValidator struct {
+	method string
+	inputs int
+	// dim is the length every vector must have: the model's dimension when
+	// known, else that of the first vector checked.
+	dim  int
+	lax  bool
+	seen []bool
+}
+
+// validator returns the checker of the results of a method request for
+// inputs inputs, whose vectors are dim long when that is known.
+func (c *Client) validator(method string, inputs, dim int) *responseValidator {
+	return &responseValidator{method: method, inputs: inputs, dim: dim, lax: c.cfg.LaxValidation, seen: make([]bool, inputs)}
+}
+
+// count checks that the response holds n results.
+func (v *responseValidator) count(n int) error {
+	if n != v.inputs {
+		return &ResponseValidationError{Method: v.method, Rule: RuleCount, Index: -1, Want: v.inputs, Got: n}
+	}
+	return nil
+}
+
+// check checks the result of the input at index, whose vector is vector.
+func (v *responseValidator) check(index int, vector []float32) error {
+	if err := v.place(index); err != nil {
+		return err
+	}
+	return v.vector(index, vector)
+}
+
+// place checks that a result for the input at index is in range and the
+// first for it.
+func (v *responseValidator) place(index int) error {
+	if index < 0 || index >= v.inputs || v.seen[index] {
+		return &ResponseValidationError{Method: v.method, Rule: RuleIndex, Index: index, Want: v.inputs}
+	}
+	v.seen[index] = true
+	return nil
+}
+
+// vector checks the vector of the input at index, unless validation is
+// lax.
+func (v *responseValidator) vector(index int, vector []float32) error {
+	if v.lax {
+		return nil
+	}
+	if v.dim == 0 {
+		v.dim = len(vector)
+	}
+	if len(vector) != v.dim {
+		return &ResponseValidationError{Method: v.method, Rule: RuleDimension, Index: index, Want: v.dim, Got: len(vector)}
+	}
+	for i, x := range vector {
+		if f := float64(x); math.IsNaN(f) || math.IsInf(f, 0) {
+			return &ResponseValidationError{Method: v.method, Rule: RuleFinite, Index: index, Component: i, Value: x}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestResponseValidator(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(-1))
+	for _, tc := range []struct {
+		name    string
+		dim     int
+		lax     bool
+		results int
+		entries []embeddingEntry
+		// want is the rule broken, empty for a valid response.
+		want  string
+		index int
+		// wantDim and gotDim are the lengths a RuleDimension error reports.
+		wantDim, gotDim int
+	}{
+		{name: "valid", dim: 3, results: 2, entries: []embeddingEntry{{Index: 1, Vector: []float32{1, 2, 3}}, {Index: 0, Vector: []float32{4, 5, 6}}}},
+		{name: "too few", dim: 3, results: 1, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}}, want: RuleCount, index: -1},
+		{name: "too many", dim: 3, results: 3, want: RuleCount, index: -1},
+		{name: "negative index", dim: 3, results: 2, entries: []embeddingEntry{{Index: -1, Vector: []float32{1, 2, 3}}}, want: RuleIndex, index: -1},
+		{name: "index out of range", dim: 3, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}, {Index: 2, Vector: []float32{1, 2, 3}}}, want: RuleIndex, index: 2},
+		{name: "repeated index", dim: 3, results: 2, entries: []embeddingEntry{{Index: 1, Vector: []float32{1, 2, 3}}, {Index: 1, Vector: []float32{1, 2, 3}}}, want: RuleIndex, index: 1},
+		{name: "wrong dimension", dim: 3, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}, {Index: 1, Vector: []float32{1, 2}}}, want: RuleDimension, index: 1, wantDim: 3, gotDim: 2},
+		{name: "all of another dimension", dim: 4, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}}, want: RuleDimension, index: 0, wantDim: 4, gotDim: 3},
+		{name: "dimensions disagree", results: 2, entries: []embeddingEntry{{Index: 1, Vector: []float32{1, 2}}, {Index: 0, Vector: []float32{1, 2, 3}}}, want: RuleDimension, index: 0, wantDim: 2, gotDim: 3},
+		{name: "NaN", dim: 3, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, nan, 3}}}, want: RuleFinite, index: 0},
+		{name: "infinity", dim: 3, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}, {Index: 1, Vector: []float32{inf, 2, 3}}}, want: RuleFinite, index: 1},
+		{name: "lax dimension", dim: 3, lax: true, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2}}, {Index: 1, Vector: []float32{nan}}}},
+		{name: "lax index", dim: 3, lax: true, results: 2, entries: []embeddingEntry{{Index: 0, Vector: []float32{1, 2, 3}}, {Index: 0, Vector: []float32{1, 2, 3}}}, want: RuleIndex, index: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{cfg: ClientConfig{LaxValidation: tc.lax}}
+			v := c.validator(MethodEmbed, 2, tc.dim)
+			err := v.count(tc.results)
+			for _, e := range tc.entries {
+				if err != nil {
+					break
+				}
+				err = v.check(e.Index, e.Vector)
+			}
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("valid response rejected: %v", err)
+				}
+				return
+			}
+			var invalid *ResponseValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidResponse) || !errors.Is(err, ErrProtocol) {
+				t.Fatalf("got %v, want a *ResponseValidationError matching ErrInvalidResponse and ErrProtocol", err)
+			}
+			if invalid.Rule != tc.want || invalid.Index != tc.index {
+				t.Fatalf("got rule %q at index %d (%v), want %q at %d", invalid.Rule, invalid.Index, err, tc.want, tc.index)
+			}
+			switch tc.want {
+			case RuleCount:
+				if invalid.Want != 2 || invalid.Got != tc.results {
+					t.Fatalf("count: want %d, got %d", invalid.Want, invalid.Got)
+				}
+			case RuleDimension:
+				if invalid.Want != tc.wantDim || invalid.Got != tc.gotDim {
+					t.Fatalf("dimension: want %d, got %d", invalid.Want, invalid.Got)
+				}
+			case RuleFinite:
+				if x := float64(invalid.Value); !math.IsNaN(x) && !math.IsInf(x, 0) {
+					t.Fatalf("value %v at component %d is finite", invalid.Value, invalid.Component)
+				}
+			}
+		})
+	}
+}
+
+// badEmbedHandler answers mcp.embed with entries, in EncodingBase64 so that
+// they may hold NaNs, and the rest as defaultHandler does.
+func badEmbedHandler(entries []embeddingEntry) fakeHandler {
+	return func(req *Request) *Response {
+		if req.Method != MethodEmbed {
+			return defaultHandler(req)
+		}
+		raw, _ := json.Marshal(base64EmbedResult(DefaultModel, entries))
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: raw}
+	}
+}
+
+func TestEmbedValidation(t *testing.T) {
+	ctx := context.Background()
+	// The fake models are 3 long.
+	short := []embeddingEntry{{Index: 0, Vector: []float32{0.5, 0.5}}, {Index: 1, Vector: []float32{0.5, 0.5}}}
+	newClient := func(t *testing.T, entries []embeddingEntry, opts ...Option) *Client {
+		t.Helper()
+		cfg := ClientConfig{Transport: TransportInProc, Handler: inprocHandler(badEmbedHandler(entries))}
+		c, err := NewClient("", append([]Option{WithConfig(cfg)}, opts...)...)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		t.Cleanup(func() { c.Close(ctx) })
+		if _, err := c.ListModels(ctx); err != nil {
+			t.Fatalf("ListModels: %v", err)
+		}
+		return c
+	}
+
+	c := newClient(t, short)
+	_, err := c.EmbedBatch(ctx, []string{"a", "b"})
+	var invalid *ResponseValidationError
+	if !errors.As(err, &invalid) || invalid.Rule != RuleDimension || invalid.Want != 3 || invalid.Got != 2 {
+		t.Fatalf("EmbedBatch of vectors shorter than the model's: %v", err)
+	}
+
+	c = newClient(t, short, WithLaxValidation())
+	vecs, err := c.EmbedBatch(ctx, []string{"a", "b"})
+	if err != nil || len(vecs[0]) != 2 {
+		t.Fatalf("lax EmbedBatch: %v, %v", vecs, err)
+	}
+
+	c = newClient(t, []embeddingEntry{{Index: 0, Vector: []float32{1, float32(math.NaN()), 1}}})
+	if _, err := c.Embed(ctx, "a"); !errors.As(err, &invalid) || invalid.Rule != RuleFinite || invalid.Component != 1 {
+		t.Fatalf("Embed of a NaN: %v", err)
+	}
+
+	c = newClient(t, []embeddingEntry{{Index: 0, Vector: []float32{1, 1, 1}}, {Index: 0, Vector: []float32{1, 1, 1}}}, WithLaxValidation())
+	if _, err := c.EmbedBatch(ctx, []string{"a", "b"}); !errors.As(err, &invalid) || invalid.Rule != RuleIndex || invalid.Index != 0 {
+		t.Fatalf("lax EmbedBatch with a repeated index: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WarmupOption configures a Warmup call.
+type WarmupOption func(*warmupOptions)
+
+type warmupOptions struct {
+	connections int
+	models      bool
+}
+
+// WithWarmConnections has Warmup open n connections to the endpoints of the
+// http, tls, and grpc transports instead of one, for a client about to
+// send n requests at once. An HTTP/2 server takes them all over one
+// connection. The other transports have a single connection to open.
+func WithWarmConnections(n int) WarmupOption {
+	return func(o *warmupOptions) { o.connections = n }
+}
+
+// WithWarmModels has Warmup also fetch ListModels and the server's embed
+// batch limit, so that the first embeds find both cached.
+func WithWarmModels() WarmupOption {
+	return func(o *warmupOptions) { o.models = true }
+}
+
+// WarmupReport describes what Warmup established, for logging at startup.
+type WarmupReport struct {
+	Transport string
+	// Endpoint is the endpoint label of the active endpoint.
+	Endpoint string
+	// Addresses are those the endpoint's host name resolved to, empty for
+	// an endpoint given by address or reached without a network.
+	Addresses []string
+	// Connections counts the connections Warmup opened, the stdio
+	// transport's subprocess included. Those already open are not counted.
+	Connections int
+	// TLSVersion, such as "TLS 1.3", and ALPN describe the TLS connection
+	// Warmup opened, and are empty without one.
+	TLSVersion, ALPN string
+	// ProtocolVersion, Codec, and SessionID are those of the handshake.
+	ProtocolVersion, Codec, SessionID string
+	// Models and MaxBatchSize are the models listed and the embed batch
+	// limit, with WithWarmModels.
+	Models       int
+	MaxBatchSize int
+	// Duration is how long Warmup took.
+	Duration time.Duration
+}
+
+// warmingTransport is a transport that can open its connections before
+// the first request needs them.
+type warmingTransport interface {
+	// warm opens up to n connections and reports what it opened.
+	warm(ctx context.Context, n int) (warmed, error)
+}
+
+// warmed is what a warmingTransport opened.
+type warmed struct {
+	addrs  []string
+	opened int
+	// tls is the state of the first TLS connection opened.
+	tls *tls.ConnectionState
+}
+
+// Warmup pays the cost of the client's first request ahead of it: it
+// resolves the endpoint's host, opens its connections, or spawns the
+// stdio server, and performs the handshake negotiating the protocol
+// version and codec, unless the client has a session already. See
+// WithWarmConnections and WithWarmModels for the options. It is safe to
+// call while other calls are in flight, and its heartbeats and handshake
+// count in Stats as theirs do.
+func (c *Client) Warmup(ctx context.Context, opts ...WarmupOption) (*WarmupReport, error) {
+	o := warmupOptions{connections: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.connections <= 0 {
+		return nil, fmt.Errorf("warmup: connections must be positive, got %d", o.connections)
+	}
+	start := time.Now()
+	if err := c.gate.enter(ctx); err != nil {
+		return nil, fmt.Errorf("warmup: %w", err)
+	}
+	report := &WarmupReport{Transport: c.transport.Kind(), Endpoint: c.endpointLabel()}
+	var w warmed
+	var err error
+	if wt, ok := c.transport.(warmingTransport); ok && !c.cfg.DryRun {
+		w, err = wt.warm(ctx, o.connections)
+	}
+	c.gate.exit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("warmup: %w", err)
+	}
+	report.Addresses, report.Connections = w.addrs, w.opened
+	if w.tls != nil {
+		report.TLSVersion, report.ALPN = tls.VersionName(w.tls.Version), w.tls.NegotiatedProtocol
+	}
+
+	if c.SessionID() == "" {
+		if _, err := c.Initialize(ctx); err != nil {
+			return nil, fmt.Errorf("warmup: %w", err)
+		}
+	}
+	report.ProtocolVersion, report.Codec, report.SessionID = c.ProtocolVersion(), c.Codec(), c.SessionID()
+	if o.models {
+		models, err := c.ListModels(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("warmup: %w", err)
+		}
+		report.Models = len(models)
+		if report.MaxBatchSize, err = c.negotiatedBatchSize(ctx); err != nil {
+			return nil, fmt.Errorf("warmup: %w", err)
+		}
+	}
+	report.Duration = time.Since(start)
+	c.log.InfoContext(ctx, "warmed up", "connections", report.Connections, "tls", report.TLSVersion, "protocol_version", report.ProtocolVersion, "elapsed", report.Duration)
+	return report, nil
+}
+
+// resolveHost looks up the host of endpoint, returning nothing for one
+// given by address. A failure is not the endpoint's: a proxy may resolve
+// names the client cannot, and a dial that fails reports it.
+func resolveHost(ctx context.Context, endpoint string) []string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return nil
+	}
+	addrs, _ := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	return addrs
+}
+
+// warm opens n connections by sending n concurrent heartbeats, each taking
+// an idle pooled connection or opening one; HTTP/2 multiplexes them over
+// one.
+func (t *httpTransport) warm(ctx context.Context, n int) (warmed, error) {
+	return t.warmWith(ctx, n, t.ping)
+}
+
+func (t *httpTransport) warmWith(ctx context.Context, n int, ping func(context.Context) error) (warmed, error) {
+	w := warmed{addrs: resolveHost(ctx, t.endpoint)}
+	var mu sync.Mutex
+	traced := false
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			traced = true
+			if info.Reused {
+				return
+			}
+			w.opened++
+			if tc, ok := info.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok && w.tls == nil {
+				state := tc.ConnectionState()
+				w.tls = &state
+			}
+		},
+	})
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- ping(ctx) }()
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return warmed{}, err
+	}
+	if !traced && t.h3 != nil && !t.quicUsed.Swap(true) {
+		// The QUIC stack's connection cannot be traced.
+		w.opened = 1
+	}
+	return w, nil
+}
+
+func (t *grpcTransport) warm(ctx context.Context, n int) (warmed, error) {
+	return t.h.warmWith(ctx, n, t.ping)
+}
+
+// warm dials the session unless one is live.
+func (t *wsTransport) warm(ctx context.Context, _ int) (warmed, error) {
+	w := warmed{addrs: resolveHost(ctx, t.endpoint.String())}
+	t.mu.Lock()
+	prev := t.session
+	t.mu.Unlock()
+	s, err := t.connect(ctx)
+	if err != nil {
+		return warmed{}, err
+	}
+	if s != prev {
+		w.opened, w.tls = 1, s.tls
+	}
+	return w, nil
+}
+
+// warm dials the stream, or spawns the stdio server, unless it is open.
+func (t *streamTransport) warm(ctx context.Context, _ int) (warmed, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.broken != nil {
+		return warmed{}, t.broken
+	}
+	if t.conn != nil {
+		return warmed{}, nil
+	}
+	if err := t.open(ctx); err != nil {
+		return warmed{}, err
+	}
+	return warmed{opened: 1}, nil
+}
+
+// warm warms the endpoint calls go to first.
+func (t *failoverTransport) warm(ctx context.Context, n int) (warmed, error) {
+	m := t.members[t.candidates()[0]]
+	wt, ok := m.transport.(warmingTransport)
+	if !ok {
+		return warmed{}, nil
+	}
+	w, err := wt.warm(ctx, n)
+	if err != nil {
+		return warmed{}, fmt.Errorf("%s: %w", m.label, err)
+	}
+	return w, nil
+}
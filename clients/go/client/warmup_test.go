@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarmupHTTP(t *testing.T) {
+	ctx := context.Background()
+	var handshakes atomic.Int64
+	srv := httptest.NewUnstartedServer(httpHandler(func(req *Request) *Response {
+		if req.Method == MethodInitialize {
+			handshakes.Add(1)
+		}
+		return defaultHandler(req)
+	}))
+	var opened atomic.Int64
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			opened.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	// A host name, for Warmup to resolve.
+	endpoint := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	c, err := NewClient(endpoint)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(ctx)
+
+	report, err := c.Warmup(ctx, WithWarmConnections(3), WithWarmModels())
+	if err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	if report.Connections != 3 || opened.Load() != 3 {
+		t.Fatalf("Warmup reported %d connections, the server saw %d, want 3", report.Connections, opened.Load())
+	}
+	if !slices.Contains(report.Addresses, "127.0.0.1") {
+		t.Fatalf("localhost resolved to %v", report.Addresses)
+	}
+	if report.Transport != TransportHTTP || report.SessionID != fakeSessionID || report.ProtocolVersion == "" || report.Codec != CodecJSON || report.TLSVersion != "" {
+		t.Fatalf("report %+v", report)
+	}
+	if report.Models != len(fakeModels) || report.MaxBatchSize != DefaultMaxBatchSize {
+		t.Fatalf("warmed %d models and a batch limit of %d", report.Models, report.MaxBatchSize)
+	}
+
+	// Calls reuse the warm connections, also while Warmup runs again; the
+	// handshake is not repeated.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Embed(ctx, "abc"); err != nil {
+				t.Errorf("Embed: %v", err)
+			}
+		}()
+	}
+	again, err := c.Warmup(ctx)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Warmup again: %v", err)
+	}
+	if again.SessionID != fakeSessionID || handshakes.Load() != 1 {
+		t.Fatalf("session %q after %d handshakes", again.SessionID, handshakes.Load())
+	}
+	// Four requests at once need one connection besides the warm three.
+	if opened.Load() > 4 {
+		t.Fatalf("%d connections opened, the three warm ones not reused", opened.Load())
+	}
+}
+
+func TestWarmupTLS(t *testing.T) {
+	c := newGRPCClient(t, &fakeGRPC{})
+	report, err := c.Warmup(context.Background())
+	if err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	if report.Connections != 1 || report.TLSVersion != "TLS 1.3" || report.ALPN != "h2" || report.Transport != TransportGRPC {
+		t.Fatalf("report %+v", report)
+	}
+}
+
+func TestWarmupStreams(t *testing.T) {
+	wsSrv := httptest.NewServer(wsHandler(defaultHandler))
+	defer wsSrv.Close()
+	for name, cfg := range map[string]ClientConfig{
+		"inproc":    {Transport: TransportInProc, Handler: inprocHandler(defaultHandler)},
+		"websocket": {Transport: TransportWebSocket, Endpoint: wsURL(wsSrv)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer c.Close(ctx)
+			for i, want := range []int{1, 0} {
+				report, err := c.Warmup(ctx)
+				if err != nil {
+					t.Fatalf("Warmup %d: %v", i+1, err)
+				}
+				if report.Connections != want || report.SessionID != fakeSessionID {
+					t.Fatalf("Warmup %d: %+v, want %d connections", i+1, report, want)
+				}
+			}
+			if s := c.Stats(); s.NewConnections != 1 {
+				t.Fatalf("%d connections opened", s.NewConnections)
+			}
+		})
+	}
+
+	c, err := New(ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Warmup(context.Background(), WithWarmConnections(0)); err == nil {
+		t.Fatal("Warmup accepted zero connections")
+	}
+}
@@ -0,0 +1,281 @@
+package client
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes (RFC 6455 §5.2).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsMaxMessage bounds a reassembled message so a misbehaving peer cannot make
+// the reader allocate without limit.
+const wsMaxMessage = 64 << 20
+
+// wsAcceptGUID is the fixed suffix hashed into Sec-WebSocket-Accept.
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var errWSClosed = errors.New("websocket closed by peer")
+
+// wsConn is a minimal RFC 6455 connection. Client-role connections mask every
+// frame they write; server-role connections (used by the test fakes) do not.
+type wsConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool
+
+	wmu sync.Mutex
+	// onPong is invoked from the read loop whenever a pong arrives.
+	onPong func()
+}
+
+func newWSConn(conn net.Conn, r *bufio.Reader, client bool) *wsConn {
+	if r == nil {
+		r = bufio.NewReader(conn)
+	}
+	return &wsConn{conn: conn, r: r, client: client}
+}
+
+// wsAcceptKey computes the Sec-WebSocket-Accept value for key.
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// acceptWebSocket completes the server side of the opening handshake.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", wsAcceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newWSConn(conn, rw.Reader, false), nil
+}
+
+// WebSocketHandler serves the server side of TransportWebSocket for fakes,
+// such as the one gen-fixtures records against: it completes each opening
+// handshake and answers every message of the session with the one answer
+// returns, ending the session when answer fails.
+func WebSocketHandler(answer func(msg []byte) ([]byte, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			out, err := answer(msg)
+			if err != nil || ws.WriteText(out) != nil {
+				return
+			}
+		}
+	})
+}
+
+// wsHandshake performs the client opening handshake over conn, presenting
+// authorization as the Authorization header when set.
+func wsHandshake(conn net.Conn, u *url.URL, authorization string) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	path := u.RequestURI()
+	var auth string
+	if authorization != "" {
+		auth = "Authorization: " + authorization + "\r\n"
+	}
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n%s\r\n", path, u.Host, userAgent(), key, auth)
+	if _, err := io.WriteString(conn, req); err != nil {
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket handshake: %w", statusAPIError(resp, snippet))
+	}
+	resp.Body.Close()
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return nil, errors.New("websocket handshake: missing Upgrade header")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, errors.New("websocket handshake: invalid Sec-WebSocket-Accept")
+	}
+	return newWSConn(conn, br, true), nil
+}
+
+// writeFrame writes a single unfragmented frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|opcode)
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// WriteText sends payload as a text message.
+func (c *wsConn) WriteText(payload []byte) error { return c.writeFrame(wsOpText, payload) }
+
+// Ping sends a ping control frame.
+func (c *wsConn) Ping() error { return c.writeFrame(wsOpPing, nil) }
+
+// CloseHandshake sends a normal-closure close frame.
+func (c *wsConn) CloseHandshake() error {
+	return c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, 1000))
+}
+
+// ReadMessage returns the next data message, answering pings and recording
+// pongs transparently. It returns errWSClosed when the peer closes.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			if c.onPong != nil {
+				c.onPong()
+			}
+			continue
+		case wsOpClose:
+			_ = c.writeFrame(wsOpClose, payload)
+			return nil, errWSClosed
+		case wsOpText, wsOpBinary, wsOpContinuation:
+		default:
+			return nil, fmt.Errorf("websocket: unsupported opcode %#x", opcode)
+		}
+		if len(message)+len(payload) > wsMaxMessage {
+			return nil, fmt.Errorf("websocket: message exceeds %d bytes", wsMaxMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessage {
+		err = fmt.Errorf("websocket: frame of %d bytes exceeds limit", length)
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// Close closes the underlying connection without a close handshake.
+func (c *wsConn) Close() error { return c.conn.Close() }
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWireDumpMaxBytes bounds each read or write a wire dump shows when
+// ClientConfig.WireDumpMaxBytes is unset.
+const DefaultWireDumpMaxBytes = 512
+
+// ErrWireDumpUnsafe rejects a wire dump of a configuration whose requests
+// carry credentials, which the dump would show in the clear, unless
+// ClientConfig.WireDumpUnsafe accepts that.
+var ErrWireDumpUnsafe = errors.New("wire dump would show credentials; set WireDumpUnsafe (--wire-dump-unsafe) to allow it")
+
+// WithWireDump sets ClientConfig.WireDump, hex-dumping the raw bytes the
+// client exchanges to w.
+func WithWireDump(w io.Writer) Option {
+	return func(o *clientOptions) error {
+		if w == nil {
+			return errors.New("WithWireDump: writer must not be nil")
+		}
+		o.wireDump = w
+		return nil
+	}
+}
+
+// validateWireDump checks that the bytes cfg would dump are plain and free
+// of credentials.
+func (cfg ClientConfig) validateWireDump() error {
+	if cfg.WireDump == nil {
+		return nil
+	}
+	if cfg.WireDumpMaxBytes < 0 {
+		return errors.New("wire dump max bytes must not be negative")
+	}
+	switch cfg.Transport {
+	case TransportHTTP3:
+		return errors.New("the http3 transport cannot be wire-dumped: its QUIC stack is the caller's")
+	case TransportInProc:
+		return errors.New("the inproc transport has no wire to dump")
+	case TransportGRPC:
+		return errors.New("the grpc transport cannot be wire-dumped: HTTP/2 frames are binary")
+	}
+	if cfg.WireDumpUnsafe {
+		return nil
+	}
+	proxyAuth := false
+	if u, err := url.Parse(cfg.ProxyURL); err == nil && u.User != nil {
+		proxyAuth = true
+	}
+	if cfg.APIKey != "" || cfg.APIKeyFile != "" || cfg.TokenSource != nil || proxyAuth {
+		return ErrWireDumpUnsafe
+	}
+	return nil
+}
+
+// wireDump writes the bytes of the connections it wraps to a writer. Each
+// read or write becomes one record, written with a single Write so records
+// of concurrent connections do not interleave.
+type wireDump struct {
+	w   io.Writer
+	max int
+	now func() time.Time
+}
+
+// connSeq numbers the connections of every wire dump.
+var connSeq atomic.Int64
+
+// wireDump returns the dump of cfg, or nil without one.
+func (cfg ClientConfig) wireDump() *wireDump {
+	if cfg.WireDump == nil {
+		return nil
+	}
+	limit := cfg.WireDumpMaxBytes
+	if limit == 0 {
+		limit = DefaultWireDumpMaxBytes
+	}
+	return &wireDump{w: cfg.WireDump, max: limit, now: time.Now}
+}
+
+// record writes one record of conn: a header line of the time, the
+// connection, the direction marker (">>>" sent, "<<<" received), and the
+// size, then a hex dump of at most max bytes of b.
+func (d *wireDump) record(conn int64, marker, what string, b []byte) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s conn %d %s %s", d.now().UTC().Format(time.RFC3339Nano), conn, marker, what)
+	if b == nil {
+		buf.WriteByte('\n')
+		_, _ = d.w.Write(buf.Bytes())
+		return
+	}
+	fmt.Fprintf(&buf, " %d bytes\n", len(b))
+	shown := b[:min(len(b), d.max)]
+	buf.WriteString(hex.Dump(shown))
+	if rest := len(b) - len(shown); rest > 0 {
+		fmt.Fprintf(&buf, "... %d more bytes not shown\n", rest)
+	}
+	_, _ = d.w.Write(buf.Bytes())
+}
+
+// open numbers a new connection to target and records it.
+func (d *wireDump) open(target string) int64 {
+	id := connSeq.Add(1)
+	d.record(id, "===", "opened to "+target, nil)
+	return id
+}
+
+// dumpedStream records what passes through a stream of d.
+type dumpedStream struct {
+	d      *wireDump
+	id     int64
+	closed atomic.Bool
+}
+
+func (s *dumpedStream) read(b []byte, n int, err error) (int, error) {
+	if n > 0 {
+		s.d.record(s.id, "<<<", "received", b[:n])
+	}
+	return n, err
+}
+
+func (s *dumpedStream) write(b []byte, n int, err error) (int, error) {
+	if n > 0 {
+		s.d.record(s.id, ">>>", "sent", b[:n])
+	}
+	return n, err
+}
+
+func (s *dumpedStream) close(err error) error {
+	if !s.closed.Swap(true) {
+		s.d.record(s.id, "===", "closed", nil)
+	}
+	return err
+}
+
+// wrap returns rwc dumping its traffic to d.
+func (d *wireDump) wrap(rwc io.ReadWriteCloser, target string) io.ReadWriteCloser {
+	return &dumpedRWC{rwc: rwc, s: &dumpedStream{d: d, id: d.open(target)}}
+}
+
+// wrapConn returns conn dumping its traffic to d.
+func (d *wireDump) wrapConn(conn net.Conn, target string) net.Conn {
+	return &dumpedConn{Conn: conn, s: &dumpedStream{d: d, id: d.open(target)}}
+}
+
+type dumpedRWC struct {
+	rwc io.ReadWriteCloser
+	s   *dumpedStream
+}
+
+func (c *dumpedRWC) Read(b []byte) (int, error) {
+	n, err := c.rwc.Read(b)
+	return c.s.read(b, n, err)
+}
+
+func (c *dumpedRWC) Write(b []byte) (int, error) {
+	n, err := c.rwc.Write(b)
+	return c.s.write(b, n, err)
+}
+
+func (c *dumpedRWC) Close() error { return c.s.close(c.rwc.Close()) }
+
+type dumpedConn struct {
+	net.Conn
+	s *dumpedStream
+}
+
+func (c *dumpedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	return c.s.read(b, n, err)
+}
+
+func (c *dumpedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	return c.s.write(b, n, err)
+}
+
+func (c *dumpedConn) Close() error { return c.s.close(c.Conn.Close()) }
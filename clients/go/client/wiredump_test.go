@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a strings.Builder safe for the concurrent writes of a dump.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestWireDumpHTTP(t *testing.T) {
+	srv := httptest.NewServer(httpHandler(defaultHandler))
+	defer srv.Close()
+	var dump syncBuffer
+	c, err := New(ClientConfig{Transport: TransportHTTP, Endpoint: srv.URL, WireDump: &dump, WireDumpMaxBytes: 64})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	c.Close(context.Background())
+
+	out := dump.String()
+	for _, want := range []string{
+		"=== opened to " + srv.Listener.Addr().String(),
+		">>> sent",
+		"<<< received",
+		"50 4f 53 54", // "POST", the request line
+		"more bytes not shown",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("dump misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWireDumpRefusesCredentials(t *testing.T) {
+	cfg := ClientConfig{Transport: TransportHTTP, Endpoint: "http://localhost:1", APIKey: "sk-secret", WireDump: &syncBuffer{}}
+	if _, err := New(cfg); !errors.Is(err, ErrWireDumpUnsafe) {
+		t.Fatalf("expected ErrWireDumpUnsafe, got %v", err)
+	}
+	cfg.WireDumpUnsafe = true
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New with WireDumpUnsafe: %v", err)
+	}
+	c.Close(context.Background())
+
+	cfg = ClientConfig{Transport: TransportInProc, Handler: inprocHandler(defaultHandler), WireDump: &syncBuffer{}}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("inproc has no wire, yet its dump was accepted")
+	}
+}
@@ -0,0 +1,526 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default WebSocket timings applied when ClientConfig leaves them unset.
+const (
+	DefaultWSHandshakeTimeout = 10 * time.Second
+	DefaultWSPingInterval     = 30 * time.Second
+)
+
+// wsCloseGrace bounds how long Close waits for the peer's close frame.
+const wsCloseGrace = time.Second
+
+// wsTransport keeps one long-lived WebSocket connection and multiplexes
+// requests over it by ID, so responses may arrive in any order. A dropped
+// connection fails the calls waiting on it and is redialed by the next call.
+type wsTransport struct {
+	endpoint         *url.URL
+	apiKey           Secret
+	creds            *credentialFiles
+	tlsConfig        *tls.Config
+	handshakeTimeout time.Duration
+	pingInterval     time.Duration
+	log              *slog.Logger
+	dump             *wireDump
+	// label is the endpoint label of the connection events.
+	label string
+	// dialer dials the connections, through dns when ClientConfig.DNS
+	// resolves the endpoint's name.
+	dialer contextDialer
+	dns    *dnsResolver
+
+	mu      sync.Mutex
+	events  *transportEvents
+	session *wsSession
+	closed  bool
+}
+
+// wsSession is a single dialed connection and the calls waiting on it.
+type wsSession struct {
+	conn *wsConn
+	done chan struct{}
+	// lastPong is the unix-nano time of the most recent pong.
+	lastPong atomic.Int64
+	// closing is set by Close, whose close handshake ends the session.
+	closing atomic.Bool
+	// retired is set once the session is no longer handed to new calls; it
+	// ends when the last of its calls does.
+	retired atomic.Bool
+	// onEnd, when set, reports the end of the session.
+	onEnd func(reason error)
+	// events, when set, takes the notifications the session reads.
+	events *transportEvents
+	// tls is the state of a wss connection, else nil.
+	tls *tls.ConnectionState
+	// remote is the IP address the connection was dialed to.
+	remote string
+
+	mu      sync.Mutex
+	pending map[int64]*wsWaiter
+	err     error
+}
+
+// wsWaiter receives the responses for one request ID. A plain call takes a
+// single response; a stream stays registered until its caller is done, which
+// closes gone.
+type wsWaiter struct {
+	ch     chan *Response
+	stream bool
+	gone   chan struct{}
+}
+
+func newWSTransport(cfg ClientConfig) (*wsTransport, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+	t := &wsTransport{
+		endpoint:         u,
+		apiKey:           cfg.APIKey,
+		creds:            cfg.creds,
+		handshakeTimeout: cfg.WSHandshakeTimeout,
+		pingInterval:     cfg.WSPingInterval,
+		log:              cfg.logger(),
+		dump:             cfg.wireDump(),
+		label:            cfg.endpointLabel(),
+		dialer:           &net.Dialer{},
+	}
+	t.dns = newDNSResolver(cfg, t.dialer, t.retireSession, func() *transportEvents {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.events
+	})
+	if t.dns != nil {
+		t.dialer = t.dns
+	}
+	if u.Scheme == "wss" {
+		if t.tlsConfig, err = cfg.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *wsTransport) Kind() string { return TransportWebSocket }
+
+func (t *wsTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	var resp *Response
+	err := t.roundTrip(ctx, req, false, func(r *Response) (bool, error) {
+		resp = r
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RoundTripStream sends req and passes each message carrying its ID to
+// handle. Messages are handed over in order, so a slow handler delays the
+// other calls sharing the connection.
+func (t *wsTransport) RoundTripStream(ctx context.Context, req *Request, handle frameHandler) error {
+	return t.roundTrip(ctx, req, true, handle)
+}
+
+func (t *wsTransport) roundTrip(ctx context.Context, req *Request, stream bool, handle frameHandler) error {
+	frame, err := encodeFrame(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	s, err := t.connect(ctx)
+	if err != nil {
+		frame.release()
+		return err
+	}
+
+	w := &wsWaiter{ch: make(chan *Response, 1), stream: stream}
+	if stream {
+		w.gone = make(chan struct{})
+	}
+	err = s.register(req.ID, w)
+	if err != nil && s.retired.Load() {
+		// The session ended between connect and register; a new one takes
+		// the call.
+		if s, err = t.connect(ctx); err == nil {
+			err = s.register(req.ID, w)
+		}
+	}
+	if err != nil {
+		frame.release()
+		return err
+	}
+	defer s.unregister(req.ID)
+
+	wrote := make(chan error, 1)
+	go func() {
+		err := s.conn.WriteText(frame.bytes())
+		frame.release()
+		wrote <- err
+	}()
+	select {
+	case err := <-wrote:
+		if err != nil {
+			s.fail(fmt.Errorf("ws write: %w", err))
+			return s.failure()
+		}
+	case <-s.done:
+		return s.failure()
+	case <-ctx.Done():
+		// Closing the connection cuts the message short, which only a call
+		// alone on it can afford; otherwise the write runs to its end for
+		// the others and the answer is dropped.
+		if s.alone(req.ID) {
+			s.fail(fmt.Errorf("ws write abandoned: %w", ctx.Err()))
+		}
+		return ctx.Err()
+	}
+	markPhase(ctx, PhaseReceive)
+
+	for {
+		select {
+		case resp := <-w.ch:
+			more, err := handle(resp)
+			if err != nil || !more {
+				return err
+			}
+		case <-s.done:
+			// A frame read before the connection failed is still handled.
+			select {
+			case resp := <-w.ch:
+				if more, err := handle(resp); err != nil || !more {
+					return err
+				}
+			default:
+			}
+			return s.failure()
+		case <-ctx.Done():
+			// Only this call is abandoned; the connection keeps serving others.
+			return ctx.Err()
+		}
+	}
+}
+
+// notify sends a notification as a text message of its own.
+func (t *wsTransport) notify(ctx context.Context, payload []byte) error {
+	s, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.WriteText(payload); err != nil {
+		s.fail(fmt.Errorf("ws write: %w", err))
+		return s.failure()
+	}
+	return nil
+}
+
+// connect returns the live session, dialing a new one if needed.
+func (t *wsTransport) connect(ctx context.Context) (*wsSession, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errTransportClosed
+	}
+	if t.session != nil {
+		select {
+		case <-t.session.done:
+			t.session = nil
+		default:
+			return t.session, nil
+		}
+	}
+
+	markPhase(ctx, PhaseDial)
+	dialCtx, cancel := context.WithTimeout(ctx, t.handshakeTimeout)
+	defer cancel()
+	conn, state, err := t.dial(dialCtx)
+	if err != nil {
+		if ctx.Err() == nil && dialCtx.Err() != nil {
+			err = fmt.Errorf("%w after %s: %w", ErrDialTimeout, t.handshakeTimeout, err)
+		}
+		return nil, fmt.Errorf("ws dial: %w", err)
+	}
+	s := &wsSession{conn: conn, done: make(chan struct{}), pending: map[int64]*wsWaiter{}, tls: state}
+	s.remote, _, _ = net.SplitHostPort(conn.conn.RemoteAddr().String())
+	s.lastPong.Store(time.Now().UnixNano())
+	conn.onPong = func() { s.lastPong.Store(time.Now().UnixNano()) }
+	s.events = t.events
+	if ev := t.events; ev != nil {
+		s.onEnd = func(reason error) {
+			ev.disconnect(DisconnectEvent{Transport: TransportWebSocket, Endpoint: t.label, Reason: reason})
+		}
+	}
+	go s.readLoop()
+	if t.pingInterval > 0 {
+		go s.keepalive(t.pingInterval)
+	}
+	t.session = s
+	markPhase(ctx, PhaseSend)
+	if t.events != nil {
+		t.events.connect(ConnectEvent{Transport: TransportWebSocket, Endpoint: t.label, TLS: state})
+	}
+	return s, nil
+}
+
+func (t *wsTransport) observe(ev *transportEvents) {
+	t.mu.Lock()
+	t.events = ev
+	t.mu.Unlock()
+}
+
+// dial connects and upgrades to the endpoint, returning the TLS state of a
+// wss connection.
+func (t *wsTransport) dial(ctx context.Context) (*wsConn, *tls.ConnectionState, error) {
+	host := t.endpoint.Host
+	if t.endpoint.Port() == "" {
+		port := "80"
+		if t.tlsConfig != nil {
+			port = "443"
+		}
+		host = net.JoinHostPort(t.endpoint.Hostname(), port)
+	}
+	start := time.Now()
+	raw, err := t.dialer.DialContext(ctx, "tcp", host)
+	logDial(ctx, t.log, host, start, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+	}
+	conn := raw
+	var state *tls.ConnectionState
+	if t.tlsConfig != nil {
+		tc := t.tlsConfig.Clone()
+		if tc.ServerName == "" {
+			tc.ServerName = t.endpoint.Hostname()
+		}
+		tlsConn := tls.Client(raw, tc)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, nil, classifyTLSError(err)
+		}
+		cs := tlsConn.ConnectionState()
+		conn, state = tlsConn, &cs
+	}
+	if t.dump != nil {
+		conn = t.dump.wrapConn(conn, host)
+	}
+	var auth string
+	if key := t.creds.apiKey(t.apiKey); key != "" {
+		auth = "Bearer " + string(key)
+	}
+	if v, ok := contextAuthorization(ctx); ok {
+		auth = v
+	}
+	ws, err := wsHandshake(conn, t.endpoint, auth)
+	if err != nil {
+		conn.Close()
+		if t.tlsConfig != nil {
+			// Under TLS 1.3 a rejected client certificate is only reported
+			// on the first read, which happens during the upgrade.
+			err = classifyTLSError(err)
+		}
+		var netErr net.Error
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ctxErr, err)
+		} else if errors.As(err, &netErr) && netErr.Timeout() {
+			// The socket deadline mirrors the handshake deadline.
+			return nil, nil, fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+		}
+		return nil, nil, err
+	}
+	_ = raw.SetDeadline(time.Time{})
+	return ws, state, nil
+}
+
+// retireSession hands new calls to a new connection when the current one
+// is to an address the endpoint's name no longer resolves to, ending it
+// once its calls are done.
+func (t *wsTransport) retireSession() {
+	t.mu.Lock()
+	s := t.session
+	if s == nil || !t.dns.removed(s.remote) {
+		t.mu.Unlock()
+		return
+	}
+	t.session = nil
+	t.mu.Unlock()
+	s.retired.Store(true)
+	s.endIfIdle()
+}
+
+// addresses reports the addresses ClientConfig.DNS resolved the endpoint's
+// name to, nil without it.
+func (t *wsTransport) addresses() map[string][]string { return t.dns.addressMap() }
+
+func (t *wsTransport) Close() error {
+	t.dns.close()
+	t.mu.Lock()
+	s := t.session
+	t.session = nil
+	t.closed = true
+	t.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	s.closing.Store(true)
+	_ = s.conn.CloseHandshake()
+	select {
+	case <-s.done:
+	case <-time.After(wsCloseGrace):
+	}
+	s.fail(errTransportClosed)
+	return nil
+}
+
+func (s *wsSession) register(id int64, w *wsWaiter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.failureLocked()
+	}
+	if _, dup := s.pending[id]; dup {
+		return fmt.Errorf("ws: request id %d already in flight", id)
+	}
+	s.pending[id] = w
+	return nil
+}
+
+func (s *wsSession) unregister(id int64) {
+	s.mu.Lock()
+	if w, ok := s.pending[id]; ok {
+		delete(s.pending, id)
+		if w.gone != nil {
+			close(w.gone)
+		}
+	}
+	s.mu.Unlock()
+	if s.retired.Load() {
+		s.endIfIdle()
+	}
+}
+
+// endIfIdle closes a session no call is waiting on.
+func (s *wsSession) endIfIdle() {
+	s.mu.Lock()
+	idle := len(s.pending) == 0 && s.err == nil
+	s.mu.Unlock()
+	if idle {
+		s.closing.Store(true)
+		_ = s.conn.CloseHandshake()
+		s.fail(errTransportClosed)
+	}
+}
+
+// alone reports whether the call awaiting id is the only one on the
+// connection.
+func (s *wsSession) alone(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending) == 1 && s.pending[id] != nil
+}
+
+// failure reports why the session died, as ErrConnectionLost unless the
+// transport was closed deliberately.
+func (s *wsSession) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failureLocked()
+}
+
+func (s *wsSession) failureLocked() error {
+	if s.err == nil || errors.Is(s.err, errTransportClosed) {
+		return s.err
+	}
+	return fmt.Errorf("%w: %w", ErrConnectionLost, s.err)
+}
+
+// fail marks the session dead, closes the socket, and wakes every waiter.
+func (s *wsSession) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	_ = s.conn.Close()
+	close(s.done)
+	if s.onEnd != nil {
+		reason := err
+		if s.closing.Load() || errors.Is(err, errTransportClosed) {
+			reason = nil
+		}
+		s.onEnd(reason)
+	}
+}
+
+func (s *wsSession) readLoop() {
+	for {
+		msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, errWSClosed) {
+				s.fail(errWSClosed)
+			} else {
+				s.fail(fmt.Errorf("ws read: %w", err))
+			}
+			return
+		}
+		resp, n, err := decodeInbound(msg)
+		if err != nil {
+			s.fail(fmt.Errorf("ws decode response: %w: %w", ErrProtocol, err))
+			return
+		}
+		if n != nil {
+			s.events.notify(TransportWebSocket, n)
+			continue
+		}
+		s.mu.Lock()
+		w := s.pending[resp.ID]
+		if w != nil && !w.stream {
+			delete(s.pending, resp.ID)
+		}
+		s.mu.Unlock()
+		// Responses for abandoned calls are dropped.
+		if w != nil {
+			select {
+			case w.ch <- resp:
+			case <-w.gone:
+			}
+		}
+	}
+}
+
+// keepalive pings the server every interval and tears the session down when
+// no pong has arrived within two intervals.
+func (s *wsSession) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			last := time.Unix(0, s.lastPong.Load())
+			if time.Since(last) > 2*interval {
+				s.fail(errors.New("ws keepalive: no pong received"))
+				return
+			}
+			if err := s.conn.Ping(); err != nil {
+				s.fail(fmt.Errorf("ws ping: %w", err))
+				return
+			}
+		}
+	}
+}
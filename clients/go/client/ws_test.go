@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWebSocketTransportSession(t *testing.T) {
+	srv := httptest.NewServer(wsHandler(defaultHandler))
+	defer srv.Close()
+
+	var rec recordingSink
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv), Recorder: &rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	vec, err := c.Embed(ctx, "frames")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if vec[0] != 6 {
+		t.Fatalf("unexpected vector %v", vec)
+	}
+	directions := make([]string, len(rec.entries))
+	for i, e := range rec.entries {
+		directions[i] = e.Direction
+	}
+	if got := strings.Join(directions, ","); got != "request,response,request,response" {
+		t.Fatalf("unexpected recording order %s", got)
+	}
+}
+
+func TestWebSocketTransportOutOfOrderResponses(t *testing.T) {
+	// The server holds the first two requests and answers them in reverse.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		var held []*Request
+		for len(held) < 2 {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req Request
+			_ = json.Unmarshal(msg, &req)
+			held = append(held, &req)
+		}
+		for i := len(held) - 1; i >= 0; i-- {
+			out, _ := json.Marshal(defaultHandler(held[i]))
+			_ = ws.WriteText(out)
+		}
+		_, _ = ws.ReadMessage()
+	}))
+	defer srv.Close()
+
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	results := make([][]float32, 2)
+	errs := make([]error, 2)
+	for i, text := range []string{"a", "bbbb"} {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			results[i], errs[i] = c.Embed(ctx, text)
+		}(i, text)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if results[0][0] != 1 || results[1][0] != 4 {
+		t.Fatalf("responses were misrouted: %v", results)
+	}
+}
+
+func TestWebSocketTransportCancelKeepsConnection(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(wsHandler(func(req *Request) *Response {
+		if req.Method == MethodPing {
+			<-release
+		}
+		return defaultHandler(req)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c, err := New(ClientConfig{Transport: TransportWebSocket, Endpoint: wsURL(srv)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, MethodPing, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	release <- struct{}{}
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("connection unusable after cancellation: %v", err)
+	}
+}
+
+func TestWebSocketTransportHandshakeTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, err := New(ClientConfig{
+		Transport:          TransportWebSocket,
+		Endpoint:           "ws://" + ln.Addr().String() + "/mcp",
+		WSHandshakeTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	start := time.Now()
+	if _, err := c.Initialize(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected handshake deadline, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("handshake timeout not honored")
+	}
+}
+
+func TestWebSocketTransportKeepaliveDetectsDeadPeer(t *testing.T) {
+	// The server completes the handshake and then never reads, so pings are
+	// never answered.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		time.Sleep(time.Second)
+		ws.Close()
+	}))
+	defer srv.Close()
+
+	c, err := New(ClientConfig{
+		Transport:      TransportWebSocket,
+		Endpoint:       wsURL(srv),
+		WSPingInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = c.Call(ctx, MethodPing, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "keepalive") {
+		t.Fatalf("expected keepalive failure, got %v", err)
+	}
+}
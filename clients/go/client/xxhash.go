@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The primes of XXH64.
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 computes XXH64 with seed 0 over what is written to it, so a
+// batch of vectors is hashed without copying them into one buffer.
+type xxhash64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+func newXXHash64() *xxhash64 {
+	var seed uint64
+	return &xxhash64{v1: seed + xxPrime1 + xxPrime2, v2: seed + xxPrime2, v3: seed, v4: seed - xxPrime1}
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMerge(acc, v uint64) uint64 {
+	acc ^= xxRound(0, v)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (h *xxhash64) Write(p []byte) {
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		k := copy(h.buf[h.n:], p)
+		h.n += k
+		p = p[k:]
+		if h.n < len(h.buf) {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for len(p) >= 32 {
+		h.stripe(p[:32])
+		p = p[32:]
+	}
+	h.n = copy(h.buf[:], p)
+}
+
+func (h *xxhash64) stripe(b []byte) {
+	h.v1 = xxRound(h.v1, binary.LittleEndian.Uint64(b))
+	h.v2 = xxRound(h.v2, binary.LittleEndian.Uint64(b[8:]))
+	h.v3 = xxRound(h.v3, binary.LittleEndian.Uint64(b[16:]))
+	h.v4 = xxRound(h.v4, binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxhash64) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v1, 1) + bits.RotateLeft64(h.v2, 7) + bits.RotateLeft64(h.v3, 12) + bits.RotateLeft64(h.v4, 18)
+		sum = xxMerge(sum, h.v1)
+		sum = xxMerge(sum, h.v2)
+		sum = xxMerge(sum, h.v3)
+		sum = xxMerge(sum, h.v4)
+	} else {
+		sum = xxPrime5
+	}
+	sum += h.total
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		sum ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		sum = bits.RotateLeft64(sum, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		sum = bits.RotateLeft64(sum, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		sum ^= uint64(c) * xxPrime5
+		sum = bits.RotateLeft64(sum, 11) * xxPrime1
+	}
+	sum ^= sum >> 33
+	sum *= xxPrime2
+	sum ^= sum >> 29
+	sum *= xxPrime3
+	sum ^= sum >> 32
+	return sum
+}
@@ -2,89 +2,119 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
-	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fixtures"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
 )
 
 var updateTranscripts = flag.Bool("update-transcripts", false, "regenerate client transcripts")
 
-func fixturePath(t *testing.T, transport, kind string) string {
-	t.Helper()
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		t.Fatalf("unable to resolve caller path")
-	}
-	repoRoot := filepath.Dir(filepath.Dir(filepath.Dir(filename)))
-	return filepath.Join(repoRoot, "tests", "fixtures", "go", transport, kind+".json")
-}
+// cliProcessEnv makes the test binary run as the embednexus CLI, so the
+// transcript tests drive the CLI as a subprocess without building it.
+const cliProcessEnv = "EMBEDNEXUS_TEST_CLI"
 
-func loadFixture(t *testing.T, transport, kind string) map[string]any {
-        t.Helper()
-        path := fixturePath(t, transport, kind)
-        content, err := os.ReadFile(path)
-        if err != nil {
-                if os.IsNotExist(err) {
-                        t.Skipf("download GitHub Action artifact to populate %s fixtures", transport)
-                }
-                t.Fatalf("failed to read %s: %v", path, err)
-        }
-	var payload map[string]any
-	if err := json.Unmarshal(content, &payload); err != nil {
-		t.Fatalf("failed to unmarshal %s: %v", path, err)
+// fakeArgs returns the CLI flags reaching the server cfg describes.
+func fakeArgs(cfg client.ClientConfig) []string {
+	args := []string{"--transport", cfg.Transport}
+	if cfg.Endpoint != "" {
+		args = append(args, "--endpoint", cfg.Endpoint)
+	}
+	if len(cfg.Command) > 0 {
+		args = append(args, "--command", strings.Join(cfg.Command, " "))
+	}
+	if cfg.SocketPath != "" {
+		args = append(args, "--socket", cfg.SocketPath)
 	}
-	return payload
+	for _, ca := range cfg.TLSCAFiles {
+		args = append(args, "--tls-ca", ca)
+	}
+	return args
 }
 
+// TestGoClientTranscripts runs the CLI against the fake embedder over each
+// transport and compares the envelopes it records with the goldens under
+// tests/fixtures/go/<transport>/fake, which -update-transcripts
+// regenerates. Fixtures gen-fixtures writes into tests/fixtures/local take
+// their place when present; those recorded against a live server are
+// validated by validate-fixtures instead.
 func TestGoClientTranscripts(t *testing.T) {
-	transports := []string{"stdio", "http", "tls"}
+	// The transports gen-fixtures records are checked even without
+	// fixtures, so that their skips say how to record them, and any other
+	// with fixtures on disk as well.
+	transports := append([]string(nil), genFixtureTransports...)
+	for _, k := range fixtures.Discover(t, fixtures.Key{Lang: client.ClientMarker, Kind: "request"}) {
+		if k.Variant == "" && !containsString(transports, k.Transport) {
+			transports = append(transports, k.Transport)
+		}
+	}
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
 		t.Fatalf("unable to resolve caller path")
 	}
 	repoRoot := filepath.Dir(filepath.Dir(filepath.Dir(filename)))
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for _, transport := range transports {
 		transport := transport
 		t.Run(transport, func(t *testing.T) {
-			requestPayload := loadFixture(t, transport, "request")
-			responsePayload := loadFixture(t, transport, "response")
-
-			if requestPayload["client"] != "go" {
-				t.Fatalf("unexpected client marker: %v", requestPayload["client"])
+			kinds := map[string]string{"request": client.DirectionRequest, "response": client.DirectionResponse}
+			goldens := make(map[string]string)
+			for kind := range kinds {
+				goldens[kind] = fixtures.Key{Lang: client.ClientMarker, Transport: transport, Variant: fakeFixtureVariant, Kind: kind}.File(fixtures.Root())
+				if *updateTranscripts {
+					continue
+				}
+				if local, ok := fixtures.Find(fixtures.Key{Lang: client.ClientMarker, Transport: transport, Kind: kind}); ok && local.Local {
+					goldens[kind] = local.Path
+				}
 			}
-			if responsePayload["transport"] != transport {
-				t.Fatalf("unexpected transport marker: %v", responsePayload["transport"])
+			fake, err := serveFake(transport, t.TempDir())
+			if err != nil {
+				if containsString(genFixtureTransports, transport) {
+					t.Fatal(err)
+				}
+				t.Skip(err)
 			}
+			defer fake.Close()
 
-			cliArgs := []string{
-				"run",
-				filepath.Join(repoRoot, "clients", "go"),
-				"--transport", transport,
-				"--record-transcript",
-				filepath.Join(repoRoot, "artifacts", "go", transport+".json"),
-			}
+			artifact := filepath.Join(repoRoot, "artifacts", "go", transport+".json")
+			cliArgs := append(fakeArgs(fake.Config), "--record-transcript", artifact)
 			if *updateTranscripts {
 				cliArgs = append(cliArgs, "--update-transcripts")
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), genFixtureTimeout)
 			defer cancel()
-			cmd := exec.CommandContext(ctx, "go", cliArgs...)
+			cmd := exec.CommandContext(ctx, exe, cliArgs...)
 			cmd.Dir = repoRoot
-			if err := cmd.Run(); err == nil {
-				t.Fatalf("expected command failure while implementation is pending")
-			}
-			if ctx.Err() == context.DeadlineExceeded {
-				t.Fatalf("command timed out before failing as expected")
+			cmd.Env = append(os.Environ(), cliProcessEnv+"=1")
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("embednexus %s: %v\n%s", strings.Join(cliArgs, " "), err, stderr.String())
 			}
 
-			t.Fatalf("not yet implemented: go client subprocess invocation and transcript diffing (update=%v)", *updateTranscripts)
+			recorded, err := transcript.Load(artifact)
+			if err != nil {
+				t.Fatalf("load recorded transcript: %v", err)
+			}
+			if recorded, err = fake.Normalize(recorded); err != nil {
+				t.Fatal(err)
+			}
+			for kind, direction := range kinds {
+				transcript.CompareOrUpdate(t, goldens[kind], fixtureOf(recorded, direction), *updateTranscripts)
+			}
 		})
 	}
 }
@@ -0,0 +1,237 @@
+// Command benchcheck compares the output of a benchmark run with a baseline
+// and fails when a benchmark regressed by more than a threshold, so CI can
+// guard the suite without tools from outside the standard library.
+//
+//	go test -run=NONE -bench=. -benchmem -count=5 -json ./... \
+//		| benchcheck --baseline bench/baseline.txt --threshold 20
+//
+// It reads the output of go test -bench on stdin, either as text or as the
+// events of go test -json, and takes the median of each benchmark's runs.
+// The baseline is the text form, the one benchstat reads; --text writes the
+// run in that form, to record a new baseline or to hand to benchstat.
+// Benchmarks are matched by package and name without the GOMAXPROCS
+// suffix; a benchmark missing from either side is reported and skipped.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Process exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// exitRegressed reports a benchmark slower than the threshold allows.
+	exitRegressed = 3
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("benchcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baselinePath := fs.String("baseline", "", "benchmark output to compare against, in text form")
+	threshold := fs.Float64("threshold", 20, "percentage by which a metric may grow over the baseline")
+	metrics := fs.String("metrics", "ns/op", "comma-separated units to compare, such as ns/op,allocs/op")
+	textPath := fs.String("text", "", "also write the run to this file in text form")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if (*baselinePath == "" && *textPath == "") || *threshold < 0 || fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "benchcheck: --baseline or --text is required, and --threshold must not be negative")
+		return exitUsage
+	}
+
+	text, err := benchText(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "benchcheck: reading the run: %v\n", err)
+		return exitFailure
+	}
+	if *textPath != "" {
+		if err := os.WriteFile(*textPath, text, 0o644); err != nil {
+			fmt.Fprintf(stderr, "benchcheck: %v\n", err)
+			return exitFailure
+		}
+	}
+	current := parse(text)
+	if len(current) == 0 {
+		fmt.Fprintln(stderr, "benchcheck: the run holds no benchmark results")
+		return exitFailure
+	}
+	if *baselinePath == "" {
+		return exitOK
+	}
+	raw, err := os.ReadFile(*baselinePath)
+	if err != nil {
+		fmt.Fprintf(stderr, "benchcheck: %v\n", err)
+		return exitFailure
+	}
+	if compare(stdout, parse(raw), current, strings.Split(*metrics, ","), *threshold) {
+		fmt.Fprintf(stderr, "benchcheck: regressed by more than %g%% against %s\n", *threshold, *baselinePath)
+		return exitRegressed
+	}
+	return exitOK
+}
+
+// testEvent is the part of a go test -json event benchcheck reads.
+type testEvent struct {
+	Action string
+	Output string
+}
+
+// benchText returns the benchmark output read from r, unwrapping the
+// events of go test -json when r holds them, less the lines -json adds to
+// announce each benchmark.
+func benchText(r io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return raw, nil
+	}
+	var out bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		var ev testEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			return out.Bytes(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		f := strings.Fields(ev.Output)
+		announce := strings.HasPrefix(ev.Output, "=== ") || len(f) == 1 && strings.HasPrefix(f[0], "Benchmark") && strings.HasSuffix(ev.Output, "\n")
+		if ev.Action == "output" && !announce {
+			out.WriteString(ev.Output)
+		}
+	}
+}
+
+// results maps a benchmark, keyed by the last element of its package path
+// and its name, to the values each
+// of its runs reported per unit.
+type results map[string]map[string][]float64
+
+// parse collects the benchmark result lines of text, in the format of
+// go test -bench: a name, an iteration count, then value and unit pairs.
+func parse(text []byte) results {
+	res := make(results)
+	pkg := ""
+	sc := bufio.NewScanner(bytes.NewReader(text))
+	for sc.Scan() {
+		line := sc.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = path.Base(strings.TrimSpace(p))
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		key := pkg + "." + trimProcs(fields[0])
+		if res[key] == nil {
+			res[key] = make(map[string][]float64)
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			res[key][fields[i+1]] = append(res[key][fields[i+1]], v)
+		}
+	}
+	return res
+}
+
+// trimProcs cuts the -N GOMAXPROCS suffix go test adds to a name.
+func trimProcs(name string) string {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return name
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return name
+	}
+	return name[:i]
+}
+
+func median(vs []float64) float64 {
+	s := append([]float64(nil), vs...)
+	sort.Float64s(s)
+	if n := len(s); n%2 == 0 {
+		return (s[n/2-1] + s[n/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+// compare writes a table of the medians of current against those of base
+// for each of units, marking the metrics that grew by more than threshold
+// percent, and reports whether any did.
+func compare(w io.Writer, base, current results, units []string, threshold float64) bool {
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tunit\tbaseline\tcurrent\tdelta\t")
+	regressed := false
+	for _, name := range names {
+		for _, unit := range units {
+			unit = strings.TrimSpace(unit)
+			cur, ok := current[name][unit]
+			if !ok {
+				continue
+			}
+			was, ok := base[name][unit]
+			if !ok {
+				fmt.Fprintf(tw, "%s\t%s\t-\t%.4g\tnot in baseline\t\n", name, unit, median(cur))
+				continue
+			}
+			b, c := median(was), median(cur)
+			delta, mark := 0.0, ""
+			if b > 0 {
+				delta = (c - b) / b * 100
+			} else if c > 0 {
+				delta = 100
+			}
+			if delta > threshold {
+				mark, regressed = "REGRESSED", true
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.4g\t%.4g\t%+.1f%%\t%s\n", name, unit, b, c, delta, mark)
+		}
+	}
+	var missing []string
+	for name := range base {
+		if _, ok := current[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		fmt.Fprintf(tw, "%s\t\t\t\tnot run\t\n", name)
+	}
+	tw.Flush()
+	return regressed
+}
@@ -0,0 +1,118 @@
+// Command embednexus-mock replays a recorded transcript as a server, so
+// downstream integration tests can run against recorded sessions instead of
+// a server with model weights.
+//
+//	embednexus-mock --transcript artifacts/go/http.json --listen :8099
+//	embednexus-mock --transcript artifacts/go/stdio.json --stdio
+//
+// Requests are answered with the recorded responses of matching requests;
+// see transcript.Replayer. Unmatched requests get status 409 over HTTP and
+// a JSON-RPC error over stdio, both carrying the diff of the closest
+// recorded request.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// Process exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return fmt.Sprint(*l) }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("embednexus-mock", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("transcript", "", "recorded transcript to replay (required)")
+	listen := fs.String("listen", "", "address to serve HTTP on, such as :8099")
+	stdio := fs.Bool("stdio", false, "replay newline-delimited requests read from stdin on stdout")
+	var match, ignore stringList
+	fs.Var(&match, "match", "match requests on the value at this JSON pointer, such as /method, instead of the whole request (repeatable)")
+	fs.Var(&ignore, "ignore", "leave this JSON pointer out of whole-request matching (repeatable; default /id and /meta)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *path == "" || (*listen == "") == !*stdio {
+		fmt.Fprintln(stderr, "embednexus-mock: --transcript and exactly one of --listen or --stdio are required")
+		return exitUsage
+	}
+
+	t, err := transcript.Load(*path)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus-mock: %v\n", err)
+		return exitFailure
+	}
+	opts := transcript.ReplayOptions{Match: match}
+	if len(ignore) > 0 {
+		opts.Ignore = ignore
+	}
+	replayer, err := transcript.NewReplayer(t, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus-mock: %s: %v\n", *path, err)
+		return exitFailure
+	}
+
+	if *stdio {
+		err = replayer.ServeStdio(stdin, stdout)
+	} else {
+		err = serveHTTP(ctx, *listen, replayer, stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus-mock: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// serveHTTP serves replayer on addr until ctx is done.
+func serveHTTP(ctx context.Context, addr string, replayer http.Handler, stderr io.Writer) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "embednexus-mock: replaying on http://%s\n", ln.Addr())
+	srv := &http.Server{Handler: replayer, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
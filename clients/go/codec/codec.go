@@ -0,0 +1,141 @@
+// Package codec defines the encodings the envelopes of a session can travel
+// in, and the registry they are found in by name and media type.
+//
+// JSON is registered by this package and is what every session speaks
+// until its handshake negotiates another codec. The client package
+// registers MessagePack and CBOR; third parties add theirs with Register,
+// typically from an init function, and offer them by name as they do the
+// built-in ones:
+//
+//	func init() { codec.Register(yamlCodec{}) }
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JSONName is the name of the JSON codec.
+const JSONName = "json"
+
+// Codec encodes the envelopes of a session. Marshal and Unmarshal take the
+// values encoding/json does and honor their json struct tags, so a codec
+// carries the same envelopes as JSON in other bytes.
+type Codec interface {
+	// Name names the codec in the handshake, in lowercase.
+	Name() string
+	// ContentType is the media type of a body in the codec, such as
+	// "application/json", without parameters.
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Projector is implemented by codecs that render a message they encoded
+// as JSON themselves, more cheaply or faithfully than Project's default.
+type Projector interface {
+	// ProjectJSON returns the JSON of the message data encodes.
+	ProjectJSON(data []byte) ([]byte, error)
+}
+
+// Project returns the JSON projection of data, a message c encoded, as
+// transcripts record it: what c's ProjectJSON returns, or else the message
+// unmarshaled into an any and marshaled with encoding/json.
+func Project(c Codec, data []byte) (json.RawMessage, error) {
+	if p, ok := c.(Projector); ok {
+		return p.ProjectJSON(data)
+	}
+	var v any
+	if err := c.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// JSON is encoding/json, the codec of every session that did not
+// negotiate another.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return JSONName }
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) ProjectJSON(data []byte) ([]byte, error) {
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("codec: the %s message is not valid JSON", JSONName)
+	}
+	return data, nil
+}
+
+var (
+	mu     sync.RWMutex
+	byName = map[string]Codec{JSONName: JSON}
+	byType = map[string]Codec{"application/json": JSON}
+)
+
+// Register makes c available by its name and content type. It panics, as
+// database/sql.Register does, if c is nil, its name is empty or not
+// lowercase, its content type does not parse, or either is already
+// registered.
+func Register(c Codec) {
+	if c == nil {
+		panic("codec: Register of a nil codec")
+	}
+	name := c.Name()
+	if name == "" || name != strings.ToLower(name) || strings.ContainsAny(name, " ,") {
+		panic(fmt.Sprintf("codec: Register of a codec named %q", name))
+	}
+	mediaType, params, err := mime.ParseMediaType(c.ContentType())
+	if err != nil || len(params) > 0 || mediaType != c.ContentType() || !strings.Contains(mediaType, "/") {
+		panic(fmt.Sprintf("codec: Register of codec %s with content type %q", name, c.ContentType()))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := byName[name]; dup {
+		panic("codec: Register called twice for codec " + name)
+	}
+	if other, dup := byType[mediaType]; dup {
+		panic(fmt.Sprintf("codec: Register of codec %s with the content type of %s", name, other.Name()))
+	}
+	byName[name], byType[mediaType] = c, c
+}
+
+// Lookup returns the codec registered as name.
+func Lookup(name string) (Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := byName[name]
+	return c, ok
+}
+
+// ForContentType returns the codec of a body of contentType, whose
+// parameters, such as a charset, are ignored.
+func ForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := byType[mediaType]
+	return c, ok
+}
+
+// Names returns the names of the registered codecs, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
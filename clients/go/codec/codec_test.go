@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// hexCodec is JSON in hex, a codec without a Projector.
+type hexCodec struct{ name, contentType string }
+
+func (c hexCodec) Name() string        { return c.name }
+func (c hexCodec) ContentType() string { return c.contentType }
+
+func (hexCodec) Marshal(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	return []byte(hex.EncodeToString(raw)), err
+}
+
+func (hexCodec) Unmarshal(data []byte, v any) error {
+	raw, err := hex.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func TestRegister(t *testing.T) {
+	hx := hexCodec{"hex", "application/x-hex"}
+	Register(hx)
+	if c, ok := Lookup("hex"); !ok || c != hx {
+		t.Fatalf("Lookup: %v, %v", c, ok)
+	}
+	if c, ok := ForContentType("application/x-hex; charset=utf-8"); !ok || c != hx {
+		t.Fatalf("ForContentType: %v, %v", c, ok)
+	}
+	if c, ok := ForContentType("application/json"); !ok || c != JSON {
+		t.Fatalf("ForContentType(json): %v, %v", c, ok)
+	}
+	if _, ok := ForContentType("text/plain"); ok {
+		t.Fatal("an unregistered content type has a codec")
+	}
+	if got := strings.Join(Names(), ","); got != "hex,json" {
+		t.Fatalf("Names: %s", got)
+	}
+
+	for name, c := range map[string]Codec{
+		"nil":                  nil,
+		"empty name":           hexCodec{"", "application/x-empty"},
+		"uppercase name":       hexCodec{"Hex2", "application/x-hex2"},
+		"list name":            hexCodec{"a,b", "application/x-ab"},
+		"parameters":           hexCodec{"hex3", "application/x-hex3; v=1"},
+		"bad content type":     hexCodec{"hex4", "x-hex4"},
+		"duplicate name":       hexCodec{"hex", "application/x-hex5"},
+		"duplicate media type": hexCodec{"hex6", "application/x-hex"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: registered", name)
+				}
+			}()
+			Register(c)
+		}()
+	}
+}
+
+func TestProject(t *testing.T) {
+	hx := hexCodec{"hex7", "application/x-hex7"}
+	data, err := hx.Marshal(map[string]any{"b": []int{1, 2}, "a": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a Projector the message goes through an any.
+	if doc, err := Project(hx, data); err != nil || string(doc) != `{"a":"x","b":[1,2]}` {
+		t.Fatalf("Project: %s, %v", doc, err)
+	}
+	if _, err := Project(hx, []byte("zz")); err == nil {
+		t.Fatal("projected a message that does not decode")
+	}
+	// JSON projects to itself, unchanged.
+	if doc, err := Project(JSON, []byte(`{"b": 1, "a": 2}`)); err != nil || string(doc) != `{"b": 1, "a": 2}` {
+		t.Fatalf("Project(JSON): %s, %v", doc, err)
+	}
+	if _, err := Project(JSON, []byte(`{`)); err == nil {
+		t.Fatal("projected invalid JSON")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// completeModelsCommand is the hidden subcommand completion scripts run to
+// complete --model. It takes the flags already on the command line, so the
+// models come from the server the command would reach.
+const completeModelsCommand = "__complete-models"
+
+// completionTimeout bounds how long completing --model waits for the
+// server.
+const completionTimeout = 2 * time.Second
+
+// completionSubcommands are the subcommands scripts complete in first
+// position.
+var completionSubcommands = []string{
+	"ping", "embed", "models", "benchmark", "compare-models", "ready", "config", "completion",
+	"transcript", "auditlog", "cache", "spool", "validate-fixtures", "gen-fixtures", "serve-mock", "version",
+}
+
+// writeCompletion writes the completion script for shell, completing the
+// subcommands and the flags of fs. Generating it contacts no server: the
+// script runs completeModelsCommand only when --model is completed.
+func writeCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	tmpl, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("completion: unknown shell %q; want bash, zsh, or fish", shell)
+	}
+	type completionFlag struct {
+		Name, Usage string
+		Value       bool
+	}
+	var flags []completionFlag
+	var valued []string
+	fs.VisitAll(func(f *flag.Flag) {
+		b, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		value := !isBool || !b.IsBoolFlag()
+		usage, _, _ := strings.Cut(f.Usage, " (")
+		flags = append(flags, completionFlag{Name: f.Name, Usage: usage, Value: value})
+		if value && f.Name != "model" {
+			valued = append(valued, "--"+f.Name, "-"+f.Name)
+		}
+	})
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "--" + f.Name
+	}
+	return tmpl.Execute(w, map[string]any{
+		"Subcommands":    strings.Join(completionSubcommands, " "),
+		"Flags":          strings.Join(names, " "),
+		"ValueFlags":     strings.Join(valued, "|"),
+		"FlagList":       flags,
+		"CompleteModels": completeModelsCommand,
+	})
+}
+
+// completeModels prints the names of the server's models, a line each, for
+// completion scripts. It prints nothing when the server cannot be reached
+// within completionTimeout, and never waits longer, so a missing or hung
+// server only means no suggestions.
+func completeModels(ctx context.Context, opts client.Options, stdout io.Writer) int {
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	names := make(chan []string, 1)
+	go func() {
+		defer close(names)
+		c, err := client.NewClient(opts.Endpoint, append([]client.Option{client.WithConfig(opts.Config)}, opts.ClientOptions...)...)
+		if err != nil {
+			return
+		}
+		defer c.Close(ctx)
+		if _, err := c.Initialize(ctx); err != nil {
+			return
+		}
+		models, err := c.ListModels(ctx)
+		if err != nil {
+			return
+		}
+		var list []string
+		for _, m := range models {
+			list = append(list, m.Name)
+		}
+		names <- list
+	}()
+	select {
+	case list := <-names:
+		for _, name := range list {
+			fmt.Fprintln(stdout, name)
+		}
+	case <-ctx.Done():
+	}
+	return exitOK
+}
+
+// fishQuote quotes s for a fish script.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+var completionScripts = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Parse(`# bash completion for embednexus. Load it with
+#   source <(embednexus completion bash)
+_embednexus() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "{{.Subcommands}}" -- "$cur"))
+		return
+	fi
+	case "$prev" in
+	--model|-model)
+		COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" {{.CompleteModels}} "${COMP_WORDS[@]:1:COMP_CWORD-2}" 2>/dev/null)" -- "$cur"))
+		return
+		;;
+	{{.ValueFlags}})
+		return
+		;;
+	esac
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "{{.Flags}}" -- "$cur"))
+	fi
+}
+complete -o default -F _embednexus embednexus
+`)),
+	"zsh": template.Must(template.New("zsh").Parse(`#compdef embednexus
+# zsh completion for embednexus. Load it with
+#   source <(embednexus completion zsh)
+# or save it as _embednexus in a directory of $fpath.
+_embednexus() {
+	local cur=${words[CURRENT]} prev=${words[CURRENT-1]}
+	if (( CURRENT == 2 )) && [[ $cur != -* ]]; then
+		compadd -- {{.Subcommands}}
+		return
+	fi
+	case $prev in
+	--model|-model)
+		compadd -- ${(f)"$(${words[1]} {{.CompleteModels}} ${words[2,CURRENT-2]} 2>/dev/null)"}
+		return
+		;;
+	{{.ValueFlags}})
+		_files
+		return
+		;;
+	esac
+	if [[ $cur == -* ]]; then
+		compadd -- {{.Flags}}
+	else
+		_files
+	fi
+}
+if [[ $funcstack[1] = _embednexus ]]; then
+	_embednexus "$@"
+else
+	compdef _embednexus embednexus
+fi
+`)),
+	"fish": template.Must(template.New("fish").Funcs(template.FuncMap{"quote": fishQuote}).Parse(`# fish completion for embednexus. Load it with
+#   embednexus completion fish | source
+function __embednexus_models
+	set -l words (commandline -opc)
+	set -e words[1]
+	if test (count $words) -gt 0; and contains -- $words[-1] --model -model
+		set -e words[-1]
+	end
+	command embednexus {{.CompleteModels}} $words 2>/dev/null
+end
+complete -c embednexus -n __fish_use_subcommand -f -a '{{.Subcommands}}'
+{{range .FlagList}}complete -c embednexus -l {{.Name}} -d {{quote .Usage}}{{if eq .Name "model"}} -x -a '(__embednexus_models)'{{else if .Value}} -r{{end}}
+{{end}}`)),
+}
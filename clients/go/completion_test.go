@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var stdout, stderr strings.Builder
+		if code := run(context.Background(), []string{"completion", shell}, &stdout, &stderr); code != exitOK {
+			t.Fatalf("%s: exit %d: %s", shell, code, stderr.String())
+		}
+		script := stdout.String()
+		for _, want := range []string{"benchmark", "--input-file", completeModelsCommand} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script lacks %q", shell, want)
+			}
+		}
+		// Check the syntax with the shell itself where it is installed.
+		if path, err := exec.LookPath(shell); err == nil {
+			file := filepath.Join(t.TempDir(), "completion."+shell)
+			if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, "-n", file).CombinedOutput(); err != nil {
+				t.Errorf("%s -n: %v\n%s", shell, err, out)
+			}
+		}
+	}
+	if code := run(context.Background(), []string{"completion", "powershell"}, &strings.Builder{}, &strings.Builder{}); code != exitUsage {
+		t.Fatalf("unknown shell: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestCompleteModels(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout strings.Builder
+	args := []string{completeModelsCommand, "embed", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, "some", "text"}
+	if code := run(context.Background(), args, &stdout, &strings.Builder{}); code != exitOK || strings.TrimSpace(stdout.String()) != client.DefaultModel {
+		t.Fatalf("exit %d, printed %q, want %s", code, stdout.String(), client.DefaultModel)
+	}
+
+	// Without a server there are no suggestions, and no error either.
+	for _, args := range [][]string{
+		{completeModelsCommand, "--endpoint", "unix://" + filepath.Join(t.TempDir(), "missing.sock")},
+		{completeModelsCommand, "--no-such-flag"},
+	} {
+		stdout.Reset()
+		start := time.Now()
+		if code := run(context.Background(), args, &stdout, &strings.Builder{}); code != exitOK || stdout.Len() != 0 {
+			t.Errorf("%v: exit %d, printed %q", args, code, stdout.String())
+		}
+		if elapsed := time.Since(start); elapsed > completionTimeout+time.Second {
+			t.Errorf("%v: took %s", args, elapsed)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// configFlag names the flag that selects the configuration file.
+const configFlag = "config"
+
+// flagEnv returns the environment variable setting the flag name, as
+// EMBEDNEXUS_REQUEST_TIMEOUT for --request-timeout.
+func flagEnv(name string) string {
+	return client.ConfigEnvVars(name)[0]
+}
+
+// applyConfig gives every flag not set on the command line its value from
+// the environment or, failing that, the configuration file, so flags win
+// over the environment, the environment over the file, and the file over
+// the defaults. The file is --config, $EMBEDNEXUS_CONFIG, or
+// client.DefaultConfigPath when it exists. Unknown keys in it are warned
+// about on stderr. applyConfig returns where each flag's value came from.
+func applyConfig(flags *flag.FlagSet, stderr io.Writer) (map[string]string, error) {
+	sources := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) { sources[f.Name] = "flag" })
+
+	path := flags.Lookup(configFlag).Value.String()
+	if v, ok := os.LookupEnv(flagEnv(configFlag)); path == "" && ok {
+		path, sources[configFlag] = v, "env "+flagEnv(configFlag)
+	}
+	var file *client.ConfigFile
+	if path == "" {
+		if def := client.DefaultConfigPath(); def != "" {
+			f, err := client.LoadConfigFile(def)
+			switch {
+			case err == nil:
+				file = f
+				sources[configFlag] = "default"
+				_ = flags.Set(configFlag, def)
+			case !errors.Is(err, fs.ErrNotExist):
+				return nil, err
+			}
+		}
+	} else {
+		f, err := client.LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		_ = flags.Set(configFlag, path)
+	}
+
+	if file != nil {
+		known := client.ConfigKeys()
+		flags.VisitAll(func(f *flag.Flag) {
+			if f.Name != configFlag {
+				known = append(known, f.Name)
+			}
+		})
+		for _, w := range file.Unknown(known) {
+			fmt.Fprintf(stderr, "embednexus: warning: %s\n", w)
+		}
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if _, ok := sources[f.Name]; ok || f.Name == configFlag {
+			return
+		}
+		for _, name := range client.ConfigEnvVars(f.Name) {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			values := []string{v}
+			if repeatable(f) {
+				values = splitList(v)
+			}
+			if err := setFlag(f, values); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			sources[f.Name] = "env " + name
+			return
+		}
+		if file == nil {
+			return
+		}
+		if values, ok := file.Lookup(f.Name); ok {
+			if err := setFlag(f, values); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %s: %w", file.Path, file.Line(f.Name), f.Name, err))
+			}
+			sources[f.Name] = fmt.Sprintf("%s:%d", file.Path, file.Line(f.Name))
+		}
+	})
+	return sources, errors.Join(errs...)
+}
+
+// repeatable reports whether f collects every value it is given.
+func repeatable(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, sampleRates:
+		return true
+	}
+	return false
+}
+
+// setFlag sets f from a configuration value: each item of a list for a
+// repeatable flag, the items joined by spaces for --command, and otherwise
+// a single value.
+func setFlag(f *flag.Flag, values []string) error {
+	switch {
+	case repeatable(f):
+		for _, v := range values {
+			if err := f.Value.Set(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	case f.Name == "command":
+		return f.Value.Set(strings.Join(values, " "))
+	case len(values) != 1:
+		return fmt.Errorf("want a single value, got %d", len(values))
+	}
+	return f.Value.Set(values[0])
+}
+
+// printConfig writes the value of every flag as a configuration file, in
+// flag name order, each line noting where the value came from. Credentials
+// are printed as "[REDACTED]", and so is the password of a proxy URL.
+func printConfig(w io.Writer, flags *flag.FlagSet, sources map[string]string) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value := yamlValue(f.Value.String())
+		switch {
+		case client.SecretConfigKey(f.Name) && f.Value.String() != "":
+			value = yamlValue(client.Secret(f.Value.String()).String())
+		case f.Name == "proxy-url":
+			if u, perr := url.Parse(f.Value.String()); perr == nil {
+				value = yamlValue(u.Redacted())
+			}
+		case repeatable(f):
+			items := splitList(f.Value.String())
+			for i, item := range items {
+				items[i] = yamlValue(item)
+			}
+			value = "[" + strings.Join(items, ", ") + "]"
+		}
+		source := sources[f.Name]
+		if source == "" {
+			source = "default"
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%s: %s # %s\n", f.Name, value, source)
+		}
+	})
+	return err
+}
+
+// yamlValue quotes v when it would not read back as the same plain scalar.
+func yamlValue(v string) string {
+	if v == "" || v == "~" || v == "null" || strings.TrimSpace(v) != v || strings.ContainsAny(v, ":#,[]{}\"'") || strings.HasPrefix(v, "-") && !isNumber(v) {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func isNumber(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
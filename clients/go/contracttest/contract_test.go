@@ -0,0 +1,14 @@
+//go:build contract
+
+package contracttest
+
+import "testing"
+
+// TestContract runs the suite against the server of EndpointEnv.
+func TestContract(t *testing.T) {
+	s, ok := FromEnv(t)
+	if !ok {
+		t.Skipf("%s is not set", EndpointEnv)
+	}
+	s.Run(t)
+}
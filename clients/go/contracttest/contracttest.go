@@ -0,0 +1,268 @@
+// Package contracttest checks a live server against the semantics the
+// client relies on, which the golden fixtures, recorded against a fake,
+// cannot:
+//
+//   - ListModels returns at least one model of positive dimension.
+//   - Embedding the same text twice returns identical vectors.
+//   - A batch returns its vectors in the order of its inputs.
+//   - An oversize input fails with CodePayloadTooLarge or HTTP 413.
+//   - A call whose deadline passes fails at the deadline, and the server
+//     answers the next.
+//
+// Run the suite with go test -tags=contract ./contracttest, with
+// EMBEDNEXUS_CONTRACT_ENDPOINT naming the server and the other EMBEDNEXUS_
+// variables, such as EMBEDNEXUS_API_KEY and EMBEDNEXUS_TLS_CA, configuring
+// the client as they do the CLI. Without the endpoint the suite is
+// skipped. Each check runs on a client of its own, and a failing check
+// logs the transcript of its exchange.
+//
+// Other test packages run the suite with Suite.Run, against a server they
+// start themselves.
+package contracttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/vectors"
+)
+
+// EndpointEnv names the variable holding the endpoint of the server under
+// test.
+const EndpointEnv = "EMBEDNEXUS_CONTRACT_ENDPOINT"
+
+// DefaultOversizeBytes is the length of the input the oversize check sends
+// when Suite leaves OversizeBytes unset.
+const DefaultOversizeBytes = 8 << 20
+
+// DefaultDeadline is the deadline of the timeout check when Suite leaves
+// Deadline unset.
+const DefaultDeadline = time.Millisecond
+
+// maxLoggedString bounds the strings of the transcript a failing check
+// logs, which the oversize input would otherwise fill.
+const maxLoggedString = 1 << 10
+
+// Suite is the contract suite against one server.
+type Suite struct {
+	// Endpoint is the server's URL, as client.NewClient takes it; empty
+	// leaves the transport to Config.
+	Endpoint string
+	// Config configures the client of each check. An empty Model embeds
+	// with the first model of positive dimension ListModels returns.
+	Config client.ClientConfig
+	// OversizeBytes is the length of an input the server must reject as
+	// too large; 0 means DefaultOversizeBytes.
+	OversizeBytes int
+	// Deadline is the deadline of the timeout check, short enough that the
+	// server cannot answer within it; 0 means DefaultDeadline.
+	Deadline time.Duration
+}
+
+// FromEnv returns the suite EndpointEnv and the EMBEDNEXUS_ variables
+// describe, reporting false when EndpointEnv is unset.
+func FromEnv(t testing.TB) (Suite, bool) {
+	t.Helper()
+	endpoint := os.Getenv(EndpointEnv)
+	if endpoint == "" {
+		return Suite{}, false
+	}
+	cfg, err := client.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("contracttest: %v", err)
+	}
+	return Suite{Endpoint: endpoint, Config: cfg}, true
+}
+
+// Run runs each check of the suite as a subtest of t.
+func (s Suite) Run(t *testing.T) {
+	t.Helper()
+	t.Run("ListModels", func(t *testing.T) {
+		if _, err := firstModel(s.client(t)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	model := s.Config.Model
+	if model == "" {
+		var err error
+		if model, err = firstModel(s.client(t)); err != nil {
+			t.Fatalf("contracttest: no model to embed with: %v", err)
+		}
+	}
+	embed := []client.EmbedOption{client.WithModel(model), client.WithNoCache()}
+
+	t.Run("Deterministic", func(t *testing.T) {
+		c := s.client(t)
+		const text = "The same text embeds as the same vector."
+		first, err := c.Embed(context.Background(), text, embed...)
+		if err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		second, err := c.Embed(context.Background(), text, embed...)
+		if err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if len(first) == 0 || !slices.Equal(first, second) {
+			t.Fatalf("embedding the same text twice returned\n%v\n%v", first, second)
+		}
+	})
+
+	t.Run("BatchOrder", func(t *testing.T) {
+		c := s.client(t)
+		texts := []string{"alpha", "a longer second input", "3", "the fourth of five inputs", "omega"}
+		batch, err := c.EmbedBatch(context.Background(), texts, embed...)
+		if err != nil {
+			t.Fatalf("EmbedBatch: %v", err)
+		}
+		if len(batch) != len(texts) {
+			t.Fatalf("EmbedBatch returned %d vectors for %d inputs", len(batch), len(texts))
+		}
+		single := make([][]float32, len(texts))
+		for i, text := range texts {
+			if single[i], err = c.Embed(context.Background(), text, embed...); err != nil {
+				t.Fatalf("Embed %q: %v", text, err)
+			}
+		}
+		// A batch may be computed in other floating-point order than a
+		// single input, so each vector need only be nearest its own.
+		for i, v := range batch {
+			matches, err := vectors.TopK(v, single, 1)
+			if err != nil {
+				t.Fatalf("vector %d: %v", i, err)
+			}
+			if matches[0].Index != i {
+				t.Errorf("vector %d of the batch is nearest the embedding of input %d, %q", i, matches[0].Index, texts[matches[0].Index])
+			}
+		}
+	})
+
+	t.Run("Oversize", func(t *testing.T) {
+		c := s.client(t)
+		n := s.OversizeBytes
+		if n <= 0 {
+			n = DefaultOversizeBytes
+		}
+		_, err := c.Embed(context.Background(), strings.Repeat("a", n), embed...)
+		var apiErr *client.APIError
+		if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrPayloadTooLarge) {
+			t.Fatalf("an input of %d bytes: got %v, want an error with code %d or HTTP 413", n, err, client.CodePayloadTooLarge)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		c := s.client(t)
+		// Start the session first, so the deadline bounds the call alone.
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		d := s.Deadline
+		if d <= 0 {
+			d = DefaultDeadline
+		}
+		texts := make([]string, 64)
+		for i := range texts {
+			texts[i] = fmt.Sprintf("input %d of a batch too large to embed within the deadline", i)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		start := time.Now()
+		_, err := c.EmbedBatch(ctx, texts, embed...)
+		elapsed := time.Since(start)
+		if err == nil {
+			t.Skipf("the server embedded %d inputs within %s; raise the batch or lower Deadline", len(texts), d)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, client.ErrTimeout) {
+			t.Fatalf("a call past its %s deadline: got %v, want a timeout", d, err)
+		}
+		if grace := d + time.Second; elapsed > grace {
+			t.Errorf("a call with a %s deadline returned after %s", d, elapsed)
+		}
+		// A stream transport that timed out is not reused, so a second
+		// client checks that the server still answers.
+		if _, err := s.client(t).Embed(context.Background(), texts[0], embed...); err != nil {
+			t.Fatalf("Embed after the timeout: %v", err)
+		}
+	})
+}
+
+// firstModel returns the first model of positive dimension c lists.
+func firstModel(c *client.Client) (string, error) {
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("ListModels: %w", err)
+	}
+	for _, m := range models {
+		if m.Dimension > 0 {
+			return m.Name, nil
+		}
+	}
+	return "", fmt.Errorf("ListModels returned no model of positive dimension: %+v", models)
+}
+
+// client returns a client for one check, which logs the transcript of its
+// exchange if the check fails.
+func (s Suite) client(t *testing.T) *client.Client {
+	t.Helper()
+	sink := &transcript.MemorySink{}
+	recorder := transcript.NewRecorder(sink)
+	c, err := client.NewClient(s.Endpoint, client.WithConfig(s.Config), client.WithTranscriptRecorder(recorder))
+	if err != nil {
+		t.Fatalf("contracttest: build client: %v", err)
+	}
+	recorder.Header.Transport = c.Config().Transport
+	t.Cleanup(func() {
+		c.Close(context.Background())
+		if t.Failed() {
+			t.Logf("transcript of the exchange:\n%s", logged(sink.Transcript()))
+		}
+	})
+	return c
+}
+
+// logged renders tr for a test log, its long strings shortened.
+func logged(tr transcript.Transcript) string {
+	for i, e := range tr.Messages {
+		var v any
+		if json.Unmarshal(e.Message, &v) != nil {
+			continue
+		}
+		if short, err := json.Marshal(shorten(v)); err == nil {
+			tr.Messages[i].Message = short
+		}
+	}
+	var buf bytes.Buffer
+	if err := transcript.Encode(&buf, tr, client.FormatJSON); err != nil {
+		return fmt.Sprintf("(unencodable: %v)", err)
+	}
+	return buf.String()
+}
+
+// shorten returns v with each string over maxLoggedString cut, noting how
+// much was left out.
+func shorten(v any) any {
+	switch v := v.(type) {
+	case string:
+		if len(v) > maxLoggedString {
+			return fmt.Sprintf("%s... (%d more bytes)", v[:maxLoggedString], len(v)-maxLoggedString)
+		}
+	case []any:
+		for i := range v {
+			v[i] = shorten(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = shorten(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,46 @@
+package contracttest
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embednexustest"
+)
+
+func TestMain(m *testing.M) {
+	embednexustest.MaybeServeStdio()
+	os.Exit(m.Run())
+}
+
+// TestSuiteAgainstFake runs the suite against the fake server, which keeps
+// the contract.
+func TestSuiteAgainstFake(t *testing.T) {
+	srv := embednexustest.NewServer(t,
+		embednexustest.WithModel("fake", 16),
+		embednexustest.WithMaxInputBytes(1<<10),
+		embednexustest.WithLatency(20*time.Millisecond),
+	)
+	for _, transport := range []string{client.TransportHTTP, client.TransportStdio} {
+		t.Run(transport, func(t *testing.T) {
+			cfg := srv.ClientConfig(transport)
+			// The suite picks the model from ListModels.
+			cfg.Model = ""
+			Suite{Config: cfg, OversizeBytes: 2 << 10, Deadline: 5 * time.Millisecond}.Run(t)
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EndpointEnv, "")
+	if _, ok := FromEnv(t); ok {
+		t.Fatal("FromEnv without an endpoint")
+	}
+	t.Setenv(EndpointEnv, "https://embed.example:8443/mcp")
+	t.Setenv("EMBEDNEXUS_API_KEY", "secret")
+	s, ok := FromEnv(t)
+	if !ok || s.Endpoint != "https://embed.example:8443/mcp" || s.Config.APIKey != "secret" {
+		t.Fatalf("FromEnv = %+v, %v", s, ok)
+	}
+}
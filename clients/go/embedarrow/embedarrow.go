@@ -0,0 +1,87 @@
+// Package embedarrow embeds texts into Apache Arrow record batches, for
+// analytics stacks that consume Arrow. It is a module of its own, so the
+// client module and the CLI take no Arrow dependency; the CLI writes the
+// same columns to a file with embed --output arrow.
+package embedarrow
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Schema is the schema of the record batches of vectors of dim
+// components: index, the position of the text, text_hash, its SHA-256, and
+// embedding, its vector. No column is nullable.
+func Schema(dim int) *arrow.Schema {
+	return arrow.NewSchema([]arrow.Field{
+		{Name: "index", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "text_hash", Type: &arrow.FixedSizeBinaryType{ByteWidth: sha256.Size}},
+		{Name: "embedding", Type: arrow.FixedSizeListOfNonNullable(int32(dim), arrow.PrimitiveTypes.Float32)},
+	}, nil)
+}
+
+// EmbedBatchArrow embeds texts as c.EmbedBatch does and returns the vectors
+// as a record batch of Schema, a row per text in order. The columns are
+// built over three flat allocations, whatever the number of rows, so the
+// batch is ready for an ipc.FileWriter or a Feather file. The caller
+// releases it.
+func EmbedBatchArrow(ctx context.Context, c *client.Client, texts []string, opts ...client.EmbedOption) (arrow.RecordBatch, error) {
+	vectors, err := c.EmbedBatch(ctx, texts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordBatch(texts, vectors)
+}
+
+// NewRecordBatch returns the record batch of Schema holding texts and their
+// vectors, which must all have the same number of components.
+func NewRecordBatch(texts []string, vectors [][]float32) (arrow.RecordBatch, error) {
+	if len(texts) != len(vectors) {
+		return nil, fmt.Errorf("embedarrow: %d texts and %d vectors", len(texts), len(vectors))
+	}
+	n, dim := len(vectors), 0
+	if n > 0 {
+		dim = len(vectors[0])
+	}
+	indices := make([]int64, n)
+	hashes := make([]byte, n*sha256.Size)
+	floats := make([]float32, 0, n*dim)
+	var text []byte
+	for i, v := range vectors {
+		if len(v) != dim {
+			return nil, fmt.Errorf("embedarrow: vector %d has %d components, want %d", i, len(v), dim)
+		}
+		indices[i] = int64(i)
+		text = append(text[:0], texts[i]...)
+		sum := sha256.Sum256(text)
+		copy(hashes[i*sha256.Size:], sum[:])
+		floats = append(floats, v...)
+	}
+
+	schema := Schema(dim)
+	items := array.NewData(arrow.PrimitiveTypes.Float32, n*dim, []*memory.Buffer{nil, memory.NewBufferBytes(arrow.Float32Traits.CastToBytes(floats))}, nil, 0, 0)
+	defer items.Release()
+	data := []*array.Data{
+		array.NewData(schema.Field(0).Type, n, []*memory.Buffer{nil, memory.NewBufferBytes(arrow.Int64Traits.CastToBytes(indices))}, nil, 0, 0),
+		array.NewData(schema.Field(1).Type, n, []*memory.Buffer{nil, memory.NewBufferBytes(hashes)}, nil, 0, 0),
+		array.NewData(schema.Field(2).Type, n, []*memory.Buffer{nil}, []arrow.ArrayData{items}, 0, 0),
+	}
+	cols := make([]arrow.Array, len(data))
+	for i, d := range data {
+		cols[i] = array.MakeFromData(d)
+		d.Release()
+	}
+	defer func() {
+		for _, col := range cols {
+			col.Release()
+		}
+	}()
+	return array.NewRecordBatch(schema, cols, int64(n)), nil
+}
@@ -0,0 +1,152 @@
+package embedarrow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// vectorOf is the vector the test server answers for text, with
+// components that only survive a round trip bit for bit.
+func vectorOf(text string) []float32 {
+	return []float32{float32(len(text)) / 3, float32(math.Copysign(0, -1)), math.SmallestNonzeroFloat32, math.MaxFloat32}
+}
+
+func serverConfig() client.ClientConfig {
+	return client.ClientConfig{Transport: client.TransportInProc, Handler: func(req client.Request) (client.Response, error) {
+		if req.Method != client.MethodEmbed {
+			return client.Response{Result: json.RawMessage(`{}`)}, nil
+		}
+		var params struct {
+			Inputs []string `json:"inputs"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return client.Response{}, err
+		}
+		type entry struct {
+			Index  int       `json:"index"`
+			Vector []float32 `json:"vector"`
+		}
+		entries := make([]entry, len(params.Inputs))
+		for i, input := range params.Inputs {
+			entries[i] = entry{Index: i, Vector: vectorOf(input)}
+		}
+		result, err := json.Marshal(map[string]any{"model": "m", "embeddings": entries})
+		return client.Response{Result: result}, err
+	}}
+}
+
+// checkRecord compares a record batch of Schema with the rows of texts at
+// indices, bit for bit.
+func checkRecord(t *testing.T, rec arrow.RecordBatch, indices []int64, texts []string) {
+	t.Helper()
+	if !rec.Schema().Equal(Schema(4)) {
+		t.Fatalf("schema %s, want %s", rec.Schema(), Schema(4))
+	}
+	if rec.NumRows() != int64(len(texts)) {
+		t.Fatalf("%d rows, want %d", rec.NumRows(), len(texts))
+	}
+	index := rec.Column(0).(*array.Int64)
+	hash := rec.Column(1).(*array.FixedSizeBinary)
+	items := rec.Column(2).(*array.FixedSizeList).ListValues().(*array.Float32).Float32Values()
+	for i, text := range texts {
+		sum := sha256.Sum256([]byte(text))
+		if index.Value(i) != indices[i] || !bytes.Equal(hash.Value(i), sum[:]) {
+			t.Fatalf("row %d: index %d, hash %x", i, index.Value(i), hash.Value(i))
+		}
+		for j, want := range vectorOf(text) {
+			if got := items[4*i+j]; math.Float32bits(got) != math.Float32bits(want) {
+				t.Fatalf("row %d component %d is %v, want %v", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestEmbedBatchArrowRoundTrip(t *testing.T) {
+	c, err := client.NewClient("", client.WithConfig(serverConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(context.Background())
+	texts := []string{"a", "bbb", "héllo"}
+	rec, err := EmbedBatchArrow(context.Background(), c, texts)
+	if err != nil {
+		t.Fatalf("EmbedBatchArrow: %v", err)
+	}
+	defer rec.Release()
+	checkRecord(t, rec, []int64{0, 1, 2}, texts)
+
+	var file bytes.Buffer
+	w, err := ipc.NewFileWriter(&file, ipc.WithSchema(rec.Schema()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ipc.NewFileReader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	back, err := r.RecordBatch(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecord(t, back, []int64{0, 1, 2}, texts)
+
+	if _, err := NewRecordBatch([]string{"a", "b"}, [][]float32{{1}, {1, 2}}); err == nil {
+		t.Fatal("NewRecordBatch accepted vectors of different dimensions")
+	}
+}
+
+// The CLI writes the file itself, without this module; arrow-go must read
+// it as it reads its own.
+func TestReadEmbedOutputArrow(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.arrow")
+	if err := os.WriteFile(input, []byte("a\n\nbbb\n  héllo  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := client.RunEmbed(context.Background(), client.Options{
+		Config:     serverConfig(),
+		InputFile:  input,
+		OutputFile: output,
+		Output:     client.Renderer{Format: client.OutputArrow},
+	})
+	if err != nil {
+		t.Fatalf("RunEmbed: %v", err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := ipc.NewFileReader(f)
+	if err != nil {
+		t.Fatalf("NewFileReader: %v", err)
+	}
+	defer r.Close()
+	if r.NumRecords() != 1 {
+		t.Fatalf("%d record batches, want 1", r.NumRecords())
+	}
+	rec, err := r.RecordBatch(0)
+	if err != nil {
+		t.Fatalf("RecordBatch: %v", err)
+	}
+	checkRecord(t, rec, []int64{0, 2, 3}, []string{"a", "bbb", "héllo"})
+}
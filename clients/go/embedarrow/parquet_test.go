@@ -0,0 +1,100 @@
+package embedarrow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+)
+
+// TestParquetExportReadsInArrow checks the files of export against the
+// Parquet reader of Apache Arrow, zstd included.
+func TestParquetExportReadsInArrow(t *testing.T) {
+	rows := make([]export.EmbeddingRow, 11)
+	for i := range rows {
+		text := fmt.Sprint("text ", i)
+		if i == 3 {
+			text = ""
+		}
+		rows[i] = export.EmbeddingRow{ID: fmt.Sprint(i), TextHash: export.HashText(text), Model: "test-model", Vector: vectorOf(text)}
+	}
+	for _, embedding := range []string{export.EmbeddingList, export.EmbeddingBinary} {
+		for _, compression := range []string{export.CompressionNone, export.CompressionGzip, export.CompressionZstd} {
+			opts := export.ParquetOptions{
+				RowGroupSize: 4,
+				Embedding:    embedding,
+				Compression:  compression,
+				CreatedBy:    "embedarrow test",
+			}
+			var buf bytes.Buffer
+			if err := export.WriteParquet(&buf, rows, opts); err != nil {
+				t.Fatal(err)
+			}
+			name := embedding + " " + compression
+			back, err := export.ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), opts)
+			if err != nil || !reflect.DeepEqual(back, rows) {
+				t.Fatalf("%s: read back %v, %v", name, back, err)
+			}
+
+			pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if pf.NumRowGroups() != 3 || pf.MetaData().GetCreatedBy() != "embedarrow test" {
+				t.Errorf("%s: %d row groups, created by %q", name, pf.NumRowGroups(), pf.MetaData().GetCreatedBy())
+			}
+			fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			table, err := fr.ReadTable(context.Background())
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			checkTable(t, name, table, rows, embedding == export.EmbeddingBinary)
+			table.Release()
+		}
+	}
+}
+
+func checkTable(t *testing.T, name string, table arrow.Table, rows []export.EmbeddingRow, binaryEmbedding bool) {
+	t.Helper()
+	if table.NumRows() != int64(len(rows)) || table.NumCols() != 5 {
+		t.Fatalf("%s: %d rows of %d columns", name, table.NumRows(), table.NumCols())
+	}
+	row := 0
+	tr := array.NewTableReader(table, 0)
+	defer tr.Release()
+	for tr.Next() {
+		rec := tr.RecordBatch()
+		ids := rec.Column(0).(*array.String)
+		hashes := rec.Column(1).(*array.FixedSizeBinary)
+		models := rec.Column(2).(*array.String)
+		dims := rec.Column(3).(*array.Int32)
+		for i := 0; i < int(rec.NumRows()); i, row = i+1, row+1 {
+			want := rows[row]
+			var vector []float32
+			if binaryEmbedding {
+				raw := rec.Column(4).(*array.FixedSizeBinary).Value(i)
+				vector = append([]float32(nil), arrow.Float32Traits.CastFromBytes(raw)...)
+			} else {
+				list := rec.Column(4).(*array.List)
+				start, end := list.ValueOffsets(i)
+				vector = list.ListValues().(*array.Float32).Float32Values()[start:end]
+			}
+			if ids.Value(i) != want.ID || !bytes.Equal(hashes.Value(i), want.TextHash[:]) || models.Value(i) != want.Model ||
+				int(dims.Value(i)) != len(want.Vector) || !reflect.DeepEqual(vector, want.Vector) {
+				t.Errorf("%s: row %d is %q %x %q %d %v, want %+v", name, row, ids.Value(i), hashes.Value(i), models.Value(i), dims.Value(i), vector, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Package embedgrpc holds the code protoc-gen-go and protoc-gen-go-grpc
+// generate from embedpb/embednexus.proto, for servers and clients of the
+// Embedder service built on grpc-go:
+//
+//	s := grpc.NewServer()
+//	embedgrpc.RegisterEmbedderServer(s, embedder)
+//
+// It is a module of its own, so the client module and the CLI take no
+// protobuf runtime: their grpc transport encodes the messages of package
+// embedpb rather than these. This module's tests hold
+// both to the generated code, and make proto-check in clients/go fails
+// when regenerating it with the plugins tools/go.mod pins would change it.
+package embedgrpc
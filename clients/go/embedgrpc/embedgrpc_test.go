@@ -0,0 +1,216 @@
+package embedgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embedpb"
+)
+
+// messages pairs each generated message, with every field set, with the
+// embedpb message of the same name.
+var messages = []struct {
+	generated proto.Message
+	stub      embedpb.Message
+}{
+	{&EmbedRequest{Model: "m", Inputs: []string{"a", "", "\u00e9"}, Dimensions: 256}, &embedpb.EmbedRequest{}},
+	{&EmbedResponse{
+		Model:        "m",
+		Embeddings:   []*Embedding{{Index: 0, Vector: []float32{0.5, -1}}, {Index: 1, Vector: []float32{2}, Truncated: true}},
+		Usage:        &Usage{PromptTokens: 3, TotalTokens: 4},
+		ModelVersion: "m@2",
+	}, &embedpb.EmbedResponse{}},
+	{&Embedding{Index: -1, Vector: []float32{0.25, 1e-9}, Truncated: true}, &embedpb.Embedding{}},
+	{&Usage{PromptTokens: 1, TotalTokens: 1 << 30}, &embedpb.Usage{}},
+	{&EmbedStreamResponse{Index: 2, Vector: []float32{1}, Error: &Status{Code: 3, Message: "bad input"}}, &embedpb.EmbedStreamResponse{}},
+	{&Status{Code: 14, Message: "unavailable"}, &embedpb.Status{}},
+	{&ListModelsRequest{Cursor: "page-2", Limit: 50}, &embedpb.ListModelsRequest{}},
+	{&ListModelsResponse{
+		Models:     []*Model{{Name: "alpha", Dimension: 3, MaxInputTokens: 512, Features: &ModelFeatures{Normalization: true, Truncation: true, Dimensions: true, Dtypes: []string{"float32", "int8"}}}},
+		NextCursor: "page-3",
+	}, &embedpb.ListModelsResponse{}},
+	{&Model{Name: "beta", Dimension: 8, Features: &ModelFeatures{}}, &embedpb.Model{}},
+	{&ModelFeatures{Dimensions: true, Dtypes: []string{"binary"}}, &embedpb.ModelFeatures{}},
+	{&HealthCheckRequest{Service: "embednexus.v1.Embedder"}, &embedpb.HealthCheckRequest{}},
+	{&HealthCheckResponse{Status: HealthCheckResponse_NOT_SERVING}, &embedpb.HealthCheckResponse{}},
+}
+
+func TestStubsMatchGenerated(t *testing.T) {
+	for _, m := range messages {
+		name := string(m.generated.ProtoReflect().Descriptor().Name())
+		if got := reflect.TypeOf(m.stub).Elem().Name(); got != name {
+			t.Fatalf("%s paired with embedpb.%s", name, got)
+		}
+		want, err := proto.MarshalOptions{Deterministic: true}.Marshal(m.generated)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := m.stub.Unmarshal(want); err != nil {
+			t.Errorf("%s: the stub decodes the generated encoding: %v", name, err)
+			continue
+		}
+		// The stub reproduces the generated encoding byte for byte.
+		if got := m.stub.Marshal(); !bytes.Equal(got, want) {
+			t.Errorf("%s: the stub encodes\n%x\nwhere the generated code encodes\n%x", name, got, want)
+		}
+		// And renders JSON that protojson reads back as the message.
+		stubJSON, err := json.Marshal(m.stub)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded := m.generated.ProtoReflect().New().Interface()
+		if err := protojson.Unmarshal(stubJSON, decoded); err != nil {
+			t.Errorf("%s: protojson reads %s: %v", name, stubJSON, err)
+		} else if !proto.Equal(decoded, m.generated) {
+			t.Errorf("%s: protojson reads %s as %v", name, stubJSON, decoded)
+		}
+	}
+	if n, want := len(messages), File_embednexus_proto.Messages().Len(); n != want {
+		t.Errorf("%d messages compared of the %d in the .proto", n, want)
+	}
+}
+
+func TestMethodNames(t *testing.T) {
+	for stub, generated := range map[string]string{
+		embedpb.EmbedMethod:       Embedder_Embed_FullMethodName,
+		embedpb.EmbedStreamMethod: Embedder_EmbedStream_FullMethodName,
+		embedpb.ListModelsMethod:  Embedder_ListModels_FullMethodName,
+		embedpb.CheckMethod:       Embedder_Check_FullMethodName,
+	} {
+		if stub != generated {
+			t.Errorf("embedpb names %s, the generated code %s", stub, generated)
+		}
+	}
+}
+
+// embedder serves the Embedder service with grpc-go: each input's vector
+// is its length followed by 0.5, the model "missing" is NOT_FOUND, and
+// inputs named "bad" are INVALID_ARGUMENT.
+type embedder struct {
+	UnimplementedEmbedderServer
+	// authorization is the metadata of the last call.
+	authorization []string
+}
+
+func vector(input string) []float32 { return []float32{float32(len(input)), 0.5} }
+
+func (e *embedder) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	e.authorization = md.Get("authorization")
+	if req.Model == "missing" {
+		return nil, status.Error(codes.NotFound, "no model named missing")
+	}
+	resp := &EmbedResponse{Model: req.Model, ModelVersion: req.Model + "@2", Usage: &Usage{PromptTokens: int32(len(req.Inputs)), TotalTokens: int32(len(req.Inputs))}}
+	for i, input := range req.Inputs {
+		if input == "bad" {
+			return nil, status.Error(codes.InvalidArgument, "bad input")
+		}
+		resp.Embeddings = append(resp.Embeddings, &Embedding{Index: int32(i), Vector: vector(input)})
+	}
+	return resp, nil
+}
+
+func (e *embedder) EmbedStream(req *EmbedRequest, stream grpc.ServerStreamingServer[EmbedStreamResponse]) error {
+	for i := len(req.Inputs) - 1; i >= 0; i-- {
+		m := &EmbedStreamResponse{Index: int32(i), Vector: vector(req.Inputs[i])}
+		if req.Inputs[i] == "bad" {
+			m.Vector, m.Error = nil, &Status{Code: int32(codes.InvalidArgument), Message: "bad input"}
+		}
+		if err := stream.Send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *embedder) ListModels(_ context.Context, req *ListModelsRequest) (*ListModelsResponse, error) {
+	if req.Cursor == "" {
+		return &ListModelsResponse{Models: []*Model{{Name: "alpha", Dimension: 2, Features: &ModelFeatures{Normalization: true}}}, NextCursor: "page-2"}, nil
+	}
+	return &ListModelsResponse{Models: []*Model{{Name: "beta", Dimension: 2, MaxInputTokens: 512}}}, nil
+}
+
+func (e *embedder) Check(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error) {
+	return &HealthCheckResponse{Status: HealthCheckResponse_SERVING}, nil
+}
+
+// serve starts a cleartext grpc-go server of e and returns a client of it.
+func serve(t *testing.T, e *embedder) *client.Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	RegisterEmbedderServer(s, e)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	c, err := client.NewClient("grpc://"+ln.Addr().String(), client.WithAPIKey("grpc-key"), client.WithConfig(client.ClientConfig{Model: "alpha"}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestClientAgainstGRPCGo(t *testing.T) {
+	e := &embedder{}
+	c := serve(t, e)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	vecs, err := c.EmbedBatch(ctx, []string{"a", "bcd"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][0] != 3 || vecs[1][1] != 0.5 {
+		t.Errorf("vectors %v", vecs)
+	}
+	if strings.Join(e.authorization, " ") != "Bearer grpc-key" {
+		t.Errorf("authorization %q", e.authorization)
+	}
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "alpha" || !models[0].Features.Normalization || models[1].MaxInputTokens != 512 {
+		t.Errorf("models %+v", models)
+	}
+	if ping, err := c.Ping(ctx); err != nil || !ping.OK {
+		t.Errorf("Ping: %+v, %v", ping, err)
+	}
+
+	results, err := c.EmbedStream(ctx, []string{"a", "bad", "cc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	got := map[int]client.EmbedResult{}
+	for r := range results {
+		got[r.Index] = r
+	}
+	if len(got) != 3 || got[0].Vector[0] != 1 || got[2].Vector[0] != 2 || !errors.Is(got[1].Err, client.ErrInvalidParams) {
+		t.Errorf("streamed results %+v", got)
+	}
+
+	if _, err := c.Embed(ctx, "x", client.WithModel("missing")); !errors.Is(err, client.ErrModelNotFound) || !strings.Contains(err.Error(), "no model named missing") {
+		t.Errorf("NOT_FOUND: %v", err)
+	}
+	if _, err := c.Embed(ctx, "bad"); !errors.Is(err, client.ErrInvalidParams) {
+		t.Errorf("INVALID_ARGUMENT: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// The gRPC service of EmbedNexus servers, which the grpc transport of the Go
+// client calls. Field names match the members of the JSON-RPC envelopes, so
+// the JSON rendering of each message is the envelope's result.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: embednexus.proto
+
+package embedgrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Embedder_Embed_FullMethodName       = "/embednexus.v1.Embedder/Embed"
+	Embedder_EmbedStream_FullMethodName = "/embednexus.v1.Embedder/EmbedStream"
+	Embedder_ListModels_FullMethodName  = "/embednexus.v1.Embedder/ListModels"
+	Embedder_Check_FullMethodName       = "/embednexus.v1.Embedder/Check"
+)
+
+// EmbedderClient is the client API for Embedder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EmbedderClient interface {
+	// Embed answers mcp.embed.
+	Embed(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (*EmbedResponse, error)
+	// EmbedStream answers mcp.embed.stream with a message per input, in the
+	// order the server computes them; the status ends the stream.
+	EmbedStream(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EmbedStreamResponse], error)
+	// ListModels answers mcp.models.list, a page at a time.
+	ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (*ListModelsResponse, error)
+	// Check answers the heartbeat, as grpc.health.v1.Health/Check does.
+	Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
+}
+
+type embedderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEmbedderClient(cc grpc.ClientConnInterface) EmbedderClient {
+	return &embedderClient{cc}
+}
+
+func (c *embedderClient) Embed(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (*EmbedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EmbedResponse)
+	err := c.cc.Invoke(ctx, Embedder_Embed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embedderClient) EmbedStream(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EmbedStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Embedder_ServiceDesc.Streams[0], Embedder_EmbedStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EmbedRequest, EmbedStreamResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Embedder_EmbedStreamClient = grpc.ServerStreamingClient[EmbedStreamResponse]
+
+func (c *embedderClient) ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (*ListModelsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListModelsResponse)
+	err := c.cc.Invoke(ctx, Embedder_ListModels_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embedderClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthCheckResponse)
+	err := c.cc.Invoke(ctx, Embedder_Check_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EmbedderServer is the server API for Embedder service.
+// All implementations must embed UnimplementedEmbedderServer
+// for forward compatibility.
+type EmbedderServer interface {
+	// Embed answers mcp.embed.
+	Embed(context.Context, *EmbedRequest) (*EmbedResponse, error)
+	// EmbedStream answers mcp.embed.stream with a message per input, in the
+	// order the server computes them; the status ends the stream.
+	EmbedStream(*EmbedRequest, grpc.ServerStreamingServer[EmbedStreamResponse]) error
+	// ListModels answers mcp.models.list, a page at a time.
+	ListModels(context.Context, *ListModelsRequest) (*ListModelsResponse, error)
+	// Check answers the heartbeat, as grpc.health.v1.Health/Check does.
+	Check(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
+	mustEmbedUnimplementedEmbedderServer()
+}
+
+// UnimplementedEmbedderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEmbedderServer struct{}
+
+func (UnimplementedEmbedderServer) Embed(context.Context, *EmbedRequest) (*EmbedResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Embed not implemented")
+}
+func (UnimplementedEmbedderServer) EmbedStream(*EmbedRequest, grpc.ServerStreamingServer[EmbedStreamResponse]) error {
+	return status.Error(codes.Unimplemented, "method EmbedStream not implemented")
+}
+func (UnimplementedEmbedderServer) ListModels(context.Context, *ListModelsRequest) (*ListModelsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListModels not implemented")
+}
+func (UnimplementedEmbedderServer) Check(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedEmbedderServer) mustEmbedUnimplementedEmbedderServer() {}
+func (UnimplementedEmbedderServer) testEmbeddedByValue()                  {}
+
+// UnsafeEmbedderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EmbedderServer will
+// result in compilation errors.
+type UnsafeEmbedderServer interface {
+	mustEmbedUnimplementedEmbedderServer()
+}
+
+func RegisterEmbedderServer(s grpc.ServiceRegistrar, srv EmbedderServer) {
+	// If the following call panics, it indicates UnimplementedEmbedderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Embedder_ServiceDesc, srv)
+}
+
+func _Embedder_Embed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbedderServer).Embed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Embedder_Embed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbedderServer).Embed(ctx, req.(*EmbedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Embedder_EmbedStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EmbedRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EmbedderServer).EmbedStream(m, &grpc.GenericServerStream[EmbedRequest, EmbedStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Embedder_EmbedStreamServer = grpc.ServerStreamingServer[EmbedStreamResponse]
+
+func _Embedder_ListModels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListModelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbedderServer).ListModels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Embedder_ListModels_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbedderServer).ListModels(ctx, req.(*ListModelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Embedder_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthCheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbedderServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Embedder_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbedderServer).Check(ctx, req.(*HealthCheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Embedder_ServiceDesc is the grpc.ServiceDesc for Embedder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Embedder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "embednexus.v1.Embedder",
+	HandlerType: (*EmbedderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Embed",
+			Handler:    _Embedder_Embed_Handler,
+		},
+		{
+			MethodName: "ListModels",
+			Handler:    _Embedder_ListModels_Handler,
+		},
+		{
+			MethodName: "Check",
+			Handler:    _Embedder_Check_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EmbedStream",
+			Handler:       _Embedder_EmbedStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "embednexus.proto",
+}
@@ -0,0 +1,73 @@
+// Package embedhttp3 gives the client's http3 transport a QUIC stack, that
+// of quic-go. It is a module of its own, so the client module and the CLI
+// take no QUIC dependency:
+//
+//	c, err := client.New(client.ClientConfig{
+//		Transport:         client.TransportHTTP3,
+//		Endpoint:          "https://embed.example:8443/mcp",
+//		HTTP3RoundTripper: embedhttp3.RoundTripper,
+//		AllowFallback:     true,
+//	})
+package embedhttp3
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// RoundTripper returns a round tripper sending requests over HTTP/3 with
+// the TLS configuration tc, for ClientConfig.HTTP3RoundTripper. Its errors
+// wrap client.ErrHTTP3Unavailable when no QUIC connection could be
+// established, so under AllowFallback those, and only those, switch the
+// client to HTTP/2.
+func RoundTripper(tc *tls.Config) http.RoundTripper {
+	return &roundTripper{t: &http3.Transport{TLSClientConfig: tc}}
+}
+
+type roundTripper struct {
+	t *http3.Transport
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.t.RoundTrip(req)
+	if err != nil && unavailable(err) {
+		return nil, fmt.Errorf("%w: %w", client.ErrHTTP3Unavailable, err)
+	}
+	return resp, err
+}
+
+func (rt *roundTripper) CloseIdleConnections() { rt.t.CloseIdleConnections() }
+
+// Close closes the QUIC connections and the UDP socket, which the client
+// does when it is closed.
+func (rt *roundTripper) Close() error { return rt.t.Close() }
+
+// unavailable reports whether err ended a round trip before a connection
+// was established: a handshake that failed, a TLS alert such as
+// no_application_protocol when the server does not speak h3 included, or
+// one that timed out, as it does where UDP is blocked.
+func unavailable(err error) bool {
+	var (
+		transportErr *quic.TransportError
+		timeoutErr   *quic.HandshakeTimeoutError
+		versionErr   *quic.VersionNegotiationError
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.As(err, &transportErr):
+		return transportErr.ErrorCode.IsCryptoError()
+	case errors.As(err, &timeoutErr), errors.As(err, &versionErr):
+		return true
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial" || opErr.Op == "listen"
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package embedhttp3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embednexustest"
+)
+
+// server serves the fake over HTTP/2 on a TCP port, and over HTTP/3 on the
+// UDP port of the same number once serveHTTP3 is called, counting the
+// requests of each version.
+type server struct {
+	h2, h3 atomic.Int64
+	// abort resets the streams of the next HTTP/3 requests while it is
+	// positive.
+	abort atomic.Int64
+
+	fake    http.Handler
+	tcp     *httptest.Server
+	udp     net.PacketConn
+	roots   *x509.CertPool
+	handler http.Handler
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	s := &server{fake: embednexustest.NewServer(t).Handler()}
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 3 {
+			s.h2.Add(1)
+		} else if s.abort.Add(-1) >= 0 {
+			panic(http.ErrAbortHandler)
+		} else {
+			s.h3.Add(1)
+		}
+		s.fake.ServeHTTP(w, r)
+	})
+	s.tcp = httptest.NewUnstartedServer(s.handler)
+	s.tcp.EnableHTTP2 = true
+	s.tcp.StartTLS()
+	t.Cleanup(s.tcp.Close)
+	udp, err := net.ListenPacket("udp", s.tcp.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { udp.Close() })
+	s.udp = udp
+	s.roots = x509.NewCertPool()
+	s.roots.AddCert(s.tcp.Certificate())
+	return s
+}
+
+// serveHTTP3 answers over HTTP/3 on the UDP port.
+func (s *server) serveHTTP3(t *testing.T) {
+	h3 := &http3.Server{Handler: s.handler, TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: s.tcp.TLS.Certificates})}
+	go h3.Serve(s.udp)
+	t.Cleanup(func() { h3.Close() })
+}
+
+// refuseH3 accepts QUIC on the UDP port but offers no h3 by ALPN.
+func (s *server) refuseH3(t *testing.T) {
+	ln, err := quic.Listen(s.udp, &tls.Config{Certificates: s.tcp.TLS.Certificates, NextProtos: []string{"not-h3"}}, nil)
+	if err != nil {
+		t.Fatalf("quic listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+}
+
+func (s *server) client(t *testing.T, fallback bool) *client.Client {
+	t.Helper()
+	c, err := client.New(client.ClientConfig{
+		Transport:         client.TransportHTTP3,
+		Endpoint:          s.tcp.URL + "/mcp",
+		Model:             embednexustest.DefaultModel,
+		TLSConfig:         &tls.Config{RootCAs: s.roots},
+		HTTP3RoundTripper: RoundTripper,
+		AllowFallback:     fallback,
+	})
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestHTTP3(t *testing.T) {
+	s := newServer(t)
+	s.serveHTTP3(t)
+	vec, err := s.client(t, false).Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != embednexustest.DefaultDimension {
+		t.Fatalf("vector of %d components", len(vec))
+	}
+	if s.h3.Load() == 0 || s.h2.Load() != 0 {
+		t.Fatalf("%d requests over HTTP/3 and %d over HTTP/2, want them all over HTTP/3", s.h3.Load(), s.h2.Load())
+	}
+}
+
+func TestFallbackOnALPN(t *testing.T) {
+	s := newServer(t)
+	s.refuseH3(t)
+	if _, err := s.client(t, false).Embed(context.Background(), "hello"); !errors.Is(err, client.ErrHTTP3Unavailable) {
+		t.Fatalf("Embed without fallback: %v, want ErrHTTP3Unavailable", err)
+	}
+	if _, err := s.client(t, true).Embed(context.Background(), "hello"); err != nil {
+		t.Fatalf("Embed with fallback: %v", err)
+	}
+	if s.h3.Load() != 0 || s.h2.Load() == 0 {
+		t.Fatalf("%d requests over HTTP/3 and %d over HTTP/2, want them all over HTTP/2", s.h3.Load(), s.h2.Load())
+	}
+}
+
+func TestNoFallbackOnStreamErrors(t *testing.T) {
+	s := newServer(t)
+	s.serveHTTP3(t)
+	c := s.client(t, true)
+	ctx := context.Background()
+	if _, err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	// A reset stream on the established connection fails the call rather
+	// than moving the client to HTTP/2.
+	s.abort.Store(1)
+	if _, err := c.Ping(ctx); err == nil || errors.Is(err, client.ErrHTTP3Unavailable) {
+		t.Fatalf("Ping of a reset stream: %v", err)
+	}
+	if _, err := c.Embed(ctx, "hello"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if s.h2.Load() != 0 {
+		t.Fatalf("%d requests over HTTP/2 after a stream error", s.h2.Load())
+	}
+}
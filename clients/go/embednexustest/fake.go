@@ -0,0 +1,236 @@
+package embednexustest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fakeembed"
+)
+
+// fake answers the calls of one Server or stdio subprocess.
+type fake struct {
+	cfg config
+	// done closes when the server does, ending the calls held by
+	// FaultTimeout.
+	done chan struct{}
+	// log, when set, receives each request as a line of JSON.
+	log io.Writer
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	requests []client.Request
+	// scripted are the faults of Server.Fail by method, with the calls
+	// left to fail; negative counts never run out.
+	scripted map[string]scriptedFault
+}
+
+type scriptedFault struct {
+	fault Fault
+	left  int
+}
+
+func newFake(cfg config) *fake {
+	return &fake{cfg: cfg, done: make(chan struct{}), rng: rand.New(rand.NewSource(cfg.Seed)), scripted: make(map[string]scriptedFault)}
+}
+
+func (f *fake) fail(method string, fault Fault, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n == 0 {
+		delete(f.scripted, method)
+		return
+	}
+	f.scripted[method] = scriptedFault{fault: fault, left: n}
+}
+
+func (f *fake) received() []client.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]client.Request(nil), f.requests...)
+}
+
+// record keeps req and picks the fault to answer it with, if any.
+func (f *fake) record(req client.Request) (Fault, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.log != nil {
+		line, err := json.Marshal(req)
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.log.Write(append(line, '\n')); err != nil {
+			return "", err
+		}
+	}
+	if s, ok := f.scripted[req.Method]; ok {
+		if s.left > 0 {
+			if s.left--; s.left == 0 {
+				delete(f.scripted, req.Method)
+			} else {
+				f.scripted[req.Method] = s
+			}
+		}
+		return s.fault, nil
+	}
+	if fault, ok := f.cfg.Faults[req.Method]; ok {
+		return fault, nil
+	}
+	if f.cfg.ErrorRate > 0 && req.Method != client.MethodInitialize && f.rng.Float64() < f.cfg.ErrorRate {
+		return FaultInternal, nil
+	}
+	return "", nil
+}
+
+// answer is the outcome of one call: the body to send, or that the call
+// goes unanswered or, for Fault, is answered as the fault says.
+type answer struct {
+	body       []byte
+	unanswered bool
+	fault      Fault
+}
+
+// garbage is what FaultMalformed answers with.
+var garbage = []byte("}{ not json")
+
+func (f *fake) answer(ctx context.Context, payload []byte) (answer, error) {
+	var req client.Request
+	if err := json.Unmarshal(payload, &req); err != nil {
+		body, err := json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, Error: &client.RPCError{Code: -32700, Message: "parse error: " + err.Error()}})
+		return answer{body: body}, err
+	}
+	fault, err := f.record(req)
+	if err != nil {
+		return answer{}, err
+	}
+	if !wait(ctx, f.done, f.cfg.Latency) {
+		return answer{unanswered: true}, nil
+	}
+	resp := client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Meta: req.Meta}
+	switch fault {
+	case FaultTimeout:
+		return answer{unanswered: true}, nil
+	case FaultMalformed:
+		return answer{body: garbage}, nil
+	case FaultRateLimit:
+		resp.Error = &client.RPCError{Code: codeRateLimited, Message: "rate limited (injected)", Data: json.RawMessage(`{"retryable":true}`)}
+	case FaultInternal:
+		resp.Error = &client.RPCError{Code: client.CodeInternalError, Message: "internal error (injected)", Data: json.RawMessage(`{"retryable":true}`)}
+	default:
+		result, rpcErr := f.result(req)
+		if rpcErr != nil {
+			resp.Error = rpcErr
+		} else if resp.Result, err = json.Marshal(result); err != nil {
+			return answer{}, err
+		}
+	}
+	body, err := json.Marshal(resp)
+	return answer{body: body, fault: fault}, err
+}
+
+// codeRateLimited is the JSON-RPC error FaultRateLimit answers with over
+// stdio.
+const codeRateLimited = -32029
+
+func (f *fake) model(name string) (Model, bool) {
+	if name == "" {
+		return f.cfg.Models[0], true
+	}
+	for _, m := range f.cfg.Models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+func (f *fake) result(req client.Request) (any, *client.RPCError) {
+	switch req.Method {
+	case client.MethodInitialize:
+		var params struct {
+			Transport struct {
+				Kind string `json:"kind"`
+			} `json:"transport"`
+			ProtocolVersions []string `json:"protocol_versions"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		init := client.InitializeResult{Session: client.Session{ID: "embednexustest-" + params.Transport.Kind, Transport: params.Transport.Kind, ServerVersion: client.ClientVersion}}
+		if len(params.ProtocolVersions) > 0 {
+			init.ProtocolVersion = params.ProtocolVersions[0]
+		}
+		return init, nil
+	case client.MethodPing:
+		return map[string]any{"ok": true}, nil
+	case client.MethodCapabilities:
+		return map[string]any{"tools": []string{}, "resources": []string{}}, nil
+	case client.MethodEmbed:
+		var params struct {
+			Model      string   `json:"model"`
+			Inputs     []string `json:"inputs"`
+			Dimensions int      `json:"dimensions"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &client.RPCError{Code: client.CodeInvalidParams, Message: err.Error()}
+		}
+		m, ok := f.model(params.Model)
+		if !ok {
+			return nil, &client.RPCError{Code: client.CodeModelNotFound, Message: fmt.Sprintf("model %q not found", params.Model)}
+		}
+		for i, input := range params.Inputs {
+			if f.cfg.MaxInput > 0 && len(input) > f.cfg.MaxInput {
+				return nil, &client.RPCError{Code: client.CodePayloadTooLarge, Message: fmt.Sprintf("input %d is %d bytes, over the limit of %d", i, len(input), f.cfg.MaxInput)}
+			}
+		}
+		dim := m.Dimension
+		if params.Dimensions > 0 && params.Dimensions < dim {
+			dim = params.Dimensions
+		}
+		embeddings := make([]map[string]any, len(params.Inputs))
+		vectors := make([][]float32, len(params.Inputs))
+		for i, input := range params.Inputs {
+			vectors[i] = fakeembed.Seeded(f.cfg.Seed, m.Name, input, dim)
+			embeddings[i] = map[string]any{"index": i, "vector": vectors[i], "checksum": client.VectorChecksum(vectors[i])}
+		}
+		return map[string]any{"model": m.Name, "embeddings": embeddings, "checksum": client.VectorChecksum(vectors...)}, nil
+	case client.MethodListModels:
+		models := make([]client.ModelInfo, len(f.cfg.Models))
+		for i, m := range f.cfg.Models {
+			models[i] = client.ModelInfo{Name: m.Name, Dimension: m.Dimension}
+		}
+		return map[string]any{"models": models}, nil
+	}
+	return nil, &client.RPCError{Code: client.CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+}
+
+// ServeHTTP answers a request posted as the http and tls transports send
+// them.
+func (f *fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a, err := f.answer(r.Context(), payload)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case a.unanswered:
+		select {
+		case <-r.Context().Done():
+		case <-f.done:
+		}
+	case a.fault == FaultRateLimit:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "rate limited (injected)", http.StatusTooManyRequests)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(a.body)
+	}
+}
@@ -0,0 +1,247 @@
+// Package embednexustest provides a scriptable fake EmbedNexus server for
+// testing code built on the client:
+//
+//	srv := embednexustest.NewServer(t,
+//		embednexustest.WithModel("fake", 384),
+//		embednexustest.WithLatency(20*time.Millisecond),
+//		embednexustest.WithErrorRate(0.01),
+//	)
+//	c, err := client.New(srv.ClientConfig(client.TransportHTTP))
+//
+// The server answers the handshake, ping, capabilities, embed, and model
+// listing methods over http and over tls with a self-signed certificate,
+// and, through StdioCommand, as a subprocess for the stdio transport. Its
+// vectors are those of fakeembed.Seeded, so a test sees the same ones on
+// every run, each sent with its client.VectorChecksum. Faults injected per method
+// stand in for timeouts, rate limiting, malformed answers, and server
+// errors, and every request received is kept for Requests.
+package embednexustest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// The model a server without WithModel serves.
+const (
+	DefaultModel     = "fake"
+	DefaultDimension = 8
+)
+
+// Fault is a failure the server answers a call with instead of its result.
+type Fault string
+
+const (
+	// FaultTimeout leaves the call unanswered until the client gives up.
+	FaultTimeout Fault = "timeout"
+	// FaultRateLimit answers with HTTP 429 and a Retry-After of a second,
+	// or over stdio, which has no status, with a retryable JSON-RPC error.
+	FaultRateLimit Fault = "rate-limit"
+	// FaultMalformed answers with a body that is not JSON.
+	FaultMalformed Fault = "malformed"
+	// FaultInternal answers with a retryable JSON-RPC internal error, as
+	// WithErrorRate does.
+	FaultInternal Fault = "internal"
+)
+
+// Model is a model the server embeds with.
+type Model struct {
+	Name      string `json:"name"`
+	Dimension int    `json:"dimension"`
+}
+
+// config is what the options set. It travels to stdio subprocesses as
+// JSON.
+type config struct {
+	Models    []Model          `json:"models"`
+	Seed      int64            `json:"seed"`
+	Latency   time.Duration    `json:"latency"`
+	ErrorRate float64          `json:"error_rate"`
+	Faults    map[string]Fault `json:"faults"`
+	MaxInput  int              `json:"max_input"`
+}
+
+// Option configures a Server.
+type Option func(*config)
+
+// WithModel adds a model of dimension to those served. The first model
+// added embeds the calls that name none; without any, the server serves
+// DefaultModel.
+func WithModel(name string, dimension int) Option {
+	return func(c *config) { c.Models = append(c.Models, Model{Name: name, Dimension: dimension}) }
+}
+
+// WithSeed varies the vectors, and which calls WithErrorRate fails. The
+// zero seed is the default.
+func WithSeed(seed int64) Option {
+	return func(c *config) { c.Seed = seed }
+}
+
+// WithLatency delays every answer by d.
+func WithLatency(d time.Duration) Option {
+	return func(c *config) { c.Latency = d }
+}
+
+// WithErrorRate fails that fraction of the calls, the handshake aside,
+// with FaultInternal, which calls is decided by a generator seeded as
+// WithSeed says.
+func WithErrorRate(rate float64) Option {
+	return func(c *config) { c.ErrorRate = rate }
+}
+
+// WithMaxInputBytes rejects an embed whose inputs include one longer than
+// n bytes with client.CodePayloadTooLarge, as servers do past their limit.
+func WithMaxInputBytes(n int) Option {
+	return func(c *config) { c.MaxInput = n }
+}
+
+// WithFault answers every call of method with fault; see Server.Fail to
+// fail only some.
+func WithFault(method string, fault Fault) Option {
+	return func(c *config) {
+		if c.Faults == nil {
+			c.Faults = make(map[string]Fault)
+		}
+		c.Faults[method] = fault
+	}
+}
+
+// Server is a fake server listening on loopback over http and tls.
+type Server struct {
+	// URL is the http endpoint, and TLSURL the https one, both with the
+	// path /mcp.
+	URL    string
+	TLSURL string
+
+	t        testing.TB
+	cfg      config
+	fake     *fake
+	http     *httptest.Server
+	tls      *httptest.Server
+	stdioLog string
+}
+
+// NewServer starts a server configured by opts, which is closed when the
+// test ends.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.Models) == 0 {
+		cfg.Models = []Model{{Name: DefaultModel, Dimension: DefaultDimension}}
+	}
+	s := &Server{t: t, cfg: cfg, fake: newFake(cfg), stdioLog: filepath.Join(t.TempDir(), "stdio-requests.jsonl")}
+	handler := http.HandlerFunc(s.fake.ServeHTTP)
+	s.http = httptest.NewServer(handler)
+	s.tls = httptest.NewTLSServer(handler)
+	s.URL, s.TLSURL = s.http.URL+"/mcp", s.tls.URL+"/mcp"
+	t.Cleanup(func() {
+		// Calls held by FaultTimeout end with their connections.
+		close(s.fake.done)
+		for _, srv := range []*httptest.Server{s.http, s.tls} {
+			srv.CloseClientConnections()
+			srv.Close()
+		}
+	})
+	return s
+}
+
+// Handler returns the handler of the http and tls listeners, for serving
+// the fake over another stack, such as an HTTP/3 server.
+func (s *Server) Handler() http.Handler { return http.HandlerFunc(s.fake.ServeHTTP) }
+
+// Certificate returns the self-signed certificate of the tls listener.
+func (s *Server) Certificate() *x509.Certificate { return s.tls.Certificate() }
+
+// TLSConfig returns a client configuration trusting Certificate.
+func (s *Server) TLSConfig() *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	return &tls.Config{RootCAs: roots}
+}
+
+// ClientConfig returns the configuration reaching the server over
+// transport: client.TransportHTTP, TransportTLS, or TransportStdio, which
+// spawns StdioCommand. Its model is the first the server serves.
+func (s *Server) ClientConfig(transport string) client.ClientConfig {
+	s.t.Helper()
+	model := s.cfg.Models[0].Name
+	switch transport {
+	case client.TransportHTTP:
+		return client.ClientConfig{Transport: transport, Endpoint: s.URL, Model: model}
+	case client.TransportTLS:
+		return client.ClientConfig{Transport: transport, Endpoint: s.TLSURL, TLSConfig: s.TLSConfig(), Model: model}
+	case client.TransportStdio:
+		return client.ClientConfig{Transport: transport, Command: s.StdioCommand(), Model: model}
+	}
+	s.t.Fatalf("embednexustest: no %s listener", transport)
+	return client.ClientConfig{}
+}
+
+// Fail answers the next n calls of method over http and tls with fault,
+// before the faults of the options; a negative n fails every later call.
+// Stdio subprocesses keep to their options.
+func (s *Server) Fail(method string, fault Fault, n int) {
+	s.fake.fail(method, fault, n)
+}
+
+// Requests returns the requests received over http and tls, in order,
+// then those of the stdio subprocesses.
+func (s *Server) Requests() []client.Request {
+	s.t.Helper()
+	requests := s.fake.received()
+	f, err := os.Open(s.stdioLog)
+	if os.IsNotExist(err) {
+		return requests
+	}
+	if err != nil {
+		s.t.Fatalf("embednexustest: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLine)
+	for scanner.Scan() {
+		var req client.Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			s.t.Fatalf("embednexustest: read stdio request: %v", err)
+		}
+		requests = append(requests, req)
+	}
+	if err := scanner.Err(); err != nil {
+		s.t.Fatalf("embednexustest: read stdio requests: %v", err)
+	}
+	return requests
+}
+
+// maxLine bounds a request read from stdin or the request log.
+const maxLine = 64 << 20
+
+// wait sleeps for d unless ctx ends or done closes first, reporting
+// whether it slept the whole of d.
+func wait(ctx context.Context, done <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+	case <-done:
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package embednexustest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fakeembed"
+)
+
+func TestMain(m *testing.M) {
+	MaybeServeStdio()
+	os.Exit(m.Run())
+}
+
+func newClient(t *testing.T, cfg client.ClientConfig) *client.Client {
+	t.Helper()
+	c, err := client.New(cfg)
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c
+}
+
+func TestTransports(t *testing.T) {
+	srv := NewServer(t, WithModel("fake", 384), WithModel("small", 4), WithSeed(7))
+	for _, transport := range []string{client.TransportHTTP, client.TransportTLS, client.TransportStdio} {
+		t.Run(transport, func(t *testing.T) {
+			c := newClient(t, srv.ClientConfig(transport))
+			ctx := context.Background()
+			vec, err := c.Embed(ctx, "hello")
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			if want := fakeembed.Seeded(7, "fake", "hello", 384); !reflect.DeepEqual(vec, want) {
+				t.Fatalf("vector %v, want %v", vec[:4], want[:4])
+			}
+			if vec, err := c.Embed(ctx, "hello", client.WithModel("small")); err != nil || len(vec) != 4 {
+				t.Fatalf("Embed with small: %v, %v", vec, err)
+			}
+			if _, err := c.Embed(ctx, "hello", client.WithModel("missing")); !errors.Is(err, client.ErrModelNotFound) {
+				t.Fatalf("Embed with a missing model: %v", err)
+			}
+			models, err := c.ListModels(ctx)
+			if err != nil || len(models) != 2 || models[1].Name != "small" || models[1].Dimension != 4 {
+				t.Fatalf("ListModels: %+v, %v", models, err)
+			}
+		})
+	}
+	var embeds int
+	for _, req := range srv.Requests() {
+		if req.Method == client.MethodEmbed {
+			embeds++
+		}
+	}
+	if embeds != 9 {
+		t.Fatalf("received %d embeds over the three transports, want 9", embeds)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv := NewServer(t, WithFault(client.MethodCapabilities, FaultMalformed))
+	c := newClient(t, srv.ClientConfig(client.TransportHTTP))
+	ctx := context.Background()
+
+	srv.Fail(client.MethodEmbed, FaultRateLimit, 1)
+	var apiErr *client.APIError
+	if _, err := c.Embed(ctx, "a"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests || apiErr.RetryAfter != time.Second {
+		t.Fatalf("rate limited: %v", err)
+	}
+	if _, err := c.Embed(ctx, "a"); err != nil {
+		t.Fatalf("the fault outlived its count: %v", err)
+	}
+	srv.Fail(client.MethodEmbed, FaultInternal, -1)
+	for range [2]struct{}{} {
+		if _, err := c.Embed(ctx, "a"); !errors.As(err, &apiErr) || apiErr.Code != client.CodeInternalError || !apiErr.Retryable {
+			t.Fatalf("internal: %v", err)
+		}
+	}
+	srv.Fail(client.MethodEmbed, FaultTimeout, 1)
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Embed(short, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("timeout: %v", err)
+	}
+	if err := c.Call(ctx, client.MethodCapabilities, nil, nil); !errors.Is(err, client.ErrProtocol) {
+		t.Fatalf("malformed: %v", err)
+	}
+
+	limited := newClient(t, NewServer(t, WithMaxInputBytes(3)).ClientConfig(client.TransportHTTP))
+	if _, err := limited.Embed(ctx, "abcd"); !errors.Is(err, client.ErrPayloadTooLarge) {
+		t.Fatalf("oversize input: %v", err)
+	}
+
+	// Over stdio the subprocess keeps to the options.
+	stdio := newClient(t, srv.ClientConfig(client.TransportStdio))
+	if err := stdio.Call(ctx, client.MethodCapabilities, nil, nil); err == nil {
+		t.Fatal("a malformed answer over stdio decoded")
+	}
+}
+
+func TestErrorRateAndLatency(t *testing.T) {
+	failures := func(seed int64) []int {
+		srv := NewServer(t, WithErrorRate(0.5), WithSeed(seed), WithLatency(time.Millisecond))
+		c := newClient(t, srv.ClientConfig(client.TransportHTTP))
+		var failed []int
+		for i := range make([]struct{}, 20) {
+			if _, err := c.Ping(context.Background()); err != nil {
+				failed = append(failed, i)
+			}
+		}
+		return failed
+	}
+	a := failures(3)
+	if len(a) == 0 || len(a) == 20 || !reflect.DeepEqual(a, failures(3)) {
+		t.Fatalf("failed pings %v are not a seeded half", a)
+	}
+
+	srv := NewServer(t, WithLatency(30*time.Millisecond))
+	c := newClient(t, srv.ClientConfig(client.TransportTLS))
+	start := time.Now()
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("answered in %v", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package embednexustest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdioMarker is the argument StdioCommand starts the test binary with,
+// followed by the options, as base64 JSON, and the request log's path.
+const stdioMarker = "embednexustest-stdio"
+
+// StdioCommand returns the command the stdio transport spawns to reach a
+// server with this one's options: the running test binary, whose TestMain
+// must call MaybeServeStdio before anything else. Each process serves one
+// session on its stdin and stdout, and Requests reports what it received.
+func (s *Server) StdioCommand() []string {
+	s.t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		s.t.Fatalf("embednexustest: %v", err)
+	}
+	cfg, err := json.Marshal(s.cfg)
+	if err != nil {
+		s.t.Fatalf("embednexustest: %v", err)
+	}
+	return []string{exe, stdioMarker, base64.RawURLEncoding.EncodeToString(cfg), s.stdioLog}
+}
+
+// MaybeServeStdio serves the session of a process StdioCommand started,
+// then exits; in any other process it returns at once. Call it first in
+// TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		embednexustest.MaybeServeStdio()
+//		os.Exit(m.Run())
+//	}
+func MaybeServeStdio() {
+	if len(os.Args) != 4 || os.Args[1] != stdioMarker {
+		return
+	}
+	if err := serveStdio(os.Args[2], os.Args[3], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "embednexustest: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serveStdio answers the newline-delimited requests of r on w until r
+// ends, with the options encoded in options, appending each request to
+// the file at logPath.
+func serveStdio(options, logPath string, r io.Reader, w io.Writer) error {
+	raw, err := base64.RawURLEncoding.DecodeString(options)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	f := newFake(cfg)
+	f.log = log
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		a, err := f.answer(context.Background(), scanner.Bytes())
+		if err != nil {
+			return err
+		}
+		if a.unanswered {
+			continue
+		}
+		if _, err := w.Write(append(a.body, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
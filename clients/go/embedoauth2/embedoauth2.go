@@ -0,0 +1,36 @@
+// Package embedoauth2 authenticates the client with the tokens of a
+// golang.org/x/oauth2 TokenSource, such as that of a client-credentials
+// config. It is a module of its own, so the client module and the CLI take
+// no dependency on golang.org/x/oauth2:
+//
+//	conf := &clientcredentials.Config{ClientID: id, ClientSecret: secret, TokenURL: tokenURL}
+//	c, err := client.NewClient(endpoint, embedoauth2.WithTokenSource(conf.TokenSource(ctx)))
+package embedoauth2
+
+import (
+	"golang.org/x/oauth2"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// TokenSource adapts ts to a client.TokenSource. The client caches the
+// token and fetches the next shortly before it expires, so ts need not be
+// wrapped in oauth2.ReuseTokenSource.
+func TokenSource(ts oauth2.TokenSource) client.TokenSource {
+	return client.TokenSourceFunc(func() (*client.Token, error) {
+		t, err := ts.Token()
+		if err != nil {
+			return nil, err
+		}
+		return &client.Token{AccessToken: client.Secret(t.AccessToken), TokenType: t.Type(), Expiry: t.Expiry}, nil
+	})
+}
+
+// WithTokenSource is client.WithTokenSource of the tokens ts supplies.
+func WithTokenSource(ts oauth2.TokenSource) client.Option {
+	if ts == nil {
+		// Fails as client.WithTokenSource(nil) does.
+		return client.WithTokenSource(nil)
+	}
+	return client.WithTokenSource(TokenSource(ts))
+}
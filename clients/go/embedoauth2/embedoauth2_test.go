@@ -0,0 +1,73 @@
+package embedoauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embednexustest"
+)
+
+func TestTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Round(0)
+	tok, err := TokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "abc", TokenType: "bearer", Expiry: expiry})).Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tok.AccessToken != "abc" || tok.TokenType != "Bearer" || !tok.Expiry.Equal(expiry) {
+		t.Fatalf("token %+v", tok)
+	}
+	if _, err := client.NewClient("http://127.0.0.1:1", WithTokenSource(nil)); err == nil {
+		t.Fatal("WithTokenSource(nil) accepted")
+	}
+}
+
+// TestClientCredentials authenticates against a server accepting the last
+// token issued by a client-credentials endpoint.
+func TestClientCredentials(t *testing.T) {
+	var issued atomic.Int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			http.Error(w, "bad client", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": fmt.Sprintf("tok-%d", issued.Add(1)), "token_type": "bearer", "expires_in": 3600})
+	}))
+	t.Cleanup(tokens.Close)
+	fake := embednexustest.NewServer(t).Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer tok-%d", issued.Load()) {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	conf := &clientcredentials.Config{ClientID: "id", ClientSecret: "secret", TokenURL: tokens.URL}
+	c, err := client.NewClient(srv.URL+"/mcp", client.WithConfig(client.ClientConfig{Model: embednexustest.DefaultModel}), WithTokenSource(conf.TokenSource(ctx)))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(ctx)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Embed(ctx, "hello"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	// The token is cached until it nears its expiry.
+	if n := issued.Load(); n != 1 {
+		t.Fatalf("%d tokens issued, want 1", n)
+	}
+}
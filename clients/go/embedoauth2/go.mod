@@ -0,0 +1,14 @@
+module github.com/Zaevrynth/Zaevrynth/clients/go/embedoauth2
+
+go 1.26.0
+
+require github.com/Zaevrynth/Zaevrynth/clients/go v0.0.0
+
+require golang.org/x/oauth2 v0.37.0
+
+require (
+	github.com/klauspost/compress v1.17.11 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
+
+replace github.com/Zaevrynth/Zaevrynth/clients/go => ../
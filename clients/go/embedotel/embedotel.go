@@ -0,0 +1,95 @@
+// Package embedotel traces the client with an OpenTelemetry
+// TracerProvider, such as that of go.opentelemetry.io/otel/sdk/trace. It
+// is a module of its own, so the client module and the CLI take no
+// dependency on OpenTelemetry:
+//
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+//	c, err := client.NewClient(endpoint, embedotel.WithTracerProvider(tp))
+//
+// Each request gets a client span named after its method, carrying the
+// attributes, status, and events client.TracerProvider documents.
+package embedotel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// TracerProvider adapts tp to a client.TracerProvider, for
+// ClientConfig.TracerProvider.
+func TracerProvider(tp trace.TracerProvider) client.TracerProvider {
+	return provider{tp}
+}
+
+// WithTracerProvider is client.WithTracerProvider of the tracers tp
+// supplies.
+func WithTracerProvider(tp trace.TracerProvider) client.Option {
+	if tp == nil {
+		// Fails as client.WithTracerProvider(nil) does.
+		return client.WithTracerProvider(nil)
+	}
+	return client.WithTracerProvider(TracerProvider(tp))
+}
+
+type provider struct {
+	tp trace.TracerProvider
+}
+
+func (p provider) Tracer(name string) client.Tracer { return tracer{p.tp.Tracer(name)} }
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, client.Span) {
+	ctx, s := t.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span{s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s span) SetAttributes(attrs ...client.Attribute) { s.s.SetAttributes(keyValues(attrs)...) }
+
+func (s span) AddEvent(name string, attrs ...client.Attribute) {
+	s.s.AddEvent(name, trace.WithAttributes(keyValues(attrs)...))
+}
+
+func (s span) RecordError(err error) { s.s.RecordError(err) }
+
+func (s span) SetStatusError(description string) { s.s.SetStatus(codes.Error, description) }
+
+func (s span) SpanContext() client.SpanContext {
+	sc := s.s.SpanContext()
+	return client.SpanContext{TraceID: sc.TraceID(), SpanID: sc.SpanID(), Sampled: sc.IsSampled(), TraceState: sc.TraceState().String()}
+}
+
+func (s span) End() { s.s.End() }
+
+// keyValues converts attrs, whose values are strings, ints, int64s, or
+// bools; any other value is recorded as its fmt.Sprint string.
+func keyValues(attrs []client.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
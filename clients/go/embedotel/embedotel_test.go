@@ -0,0 +1,286 @@
+package embedotel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embednexustest"
+)
+
+func TestMain(m *testing.M) {
+	embednexustest.MaybeServeStdio()
+	os.Exit(m.Run())
+}
+
+// newClient returns a client of cfg traced into the recorder it returns.
+func newClient(t *testing.T, cfg client.ClientConfig) (*client.Client, *tracetest.SpanRecorder) {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	c, err := client.NewClient("", client.WithConfig(cfg), WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, rec
+}
+
+// spanNamed returns the one ended span called name.
+func spanNamed(t *testing.T, rec *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	var found []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.Name() == name {
+			found = append(found, s)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("%d spans named %s, want 1", len(found), name)
+	}
+	return found[0]
+}
+
+func attrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+// traceparent returns the W3C traceparent of s.
+func traceparent(s sdktrace.ReadOnlySpan) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), s.SpanContext()), carrier)
+	return carrier.Get("traceparent")
+}
+
+func TestSpanOverHTTP(t *testing.T) {
+	srv := embednexustest.NewServer(t)
+	// sent keeps the traceparent of each request by its method.
+	var mu sync.Mutex
+	sent := map[string][]string{}
+	traced := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req client.Request
+		_ = json.Unmarshal(body, &req)
+		mu.Lock()
+		sent[req.Method] = append(sent[req.Method], r.Header.Get("traceparent"))
+		mu.Unlock()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		srv.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(traced.Close)
+	cfg := srv.ClientConfig(client.TransportHTTP)
+	cfg.Endpoint = traced.URL + "/mcp"
+	c, rec := newClient(t, cfg)
+	if _, err := c.EmbedBatch(context.Background(), []string{"a", "bb"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+
+	s := spanNamed(t, rec, client.MethodEmbed)
+	if s.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span kind %v", s.SpanKind())
+	}
+	a := attrs(s)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"rpc.system":               attribute.StringValue("jsonrpc"),
+		"rpc.method":               attribute.StringValue(client.MethodEmbed),
+		"embednexus.transport":     attribute.StringValue(client.TransportHTTP),
+		"embednexus.endpoint":      attribute.StringValue(cfg.Endpoint),
+		"embednexus.model":         attribute.StringValue(embednexustest.DefaultModel),
+		"embednexus.batch_size":    attribute.IntValue(2),
+		"embednexus.retry.attempt": attribute.IntValue(1),
+	} {
+		if got := a[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if size := a["embednexus.response.size"]; size.Type() != attribute.INT64 || size.AsInt64() <= 0 {
+		t.Errorf("embednexus.response.size = %v", size.Emit())
+	}
+	if s.Status().Code == codes.Error {
+		t.Errorf("status %+v of a call that succeeded", s.Status())
+	}
+	if got := sent[client.MethodEmbed]; len(got) != 1 || got[0] != traceparent(s) {
+		t.Errorf("sent traceparent %q, want %q", got, traceparent(s))
+	}
+}
+
+func TestSpanOfAFailure(t *testing.T) {
+	srv := embednexustest.NewServer(t, embednexustest.WithFault(client.MethodEmbed, embednexustest.FaultInternal))
+	c, rec := newClient(t, srv.ClientConfig(client.TransportHTTP))
+	_, err := c.Embed(context.Background(), "a")
+	if err == nil {
+		t.Fatal("Embed of an injected fault succeeded")
+	}
+	class := client.ErrorClass(err)
+	s := spanNamed(t, rec, client.MethodEmbed)
+	if s.Status().Code != codes.Error || s.Status().Description != class {
+		t.Errorf("status %+v, want an error described %q", s.Status(), class)
+	}
+	if got := attrs(s)["error.type"].AsString(); got != class {
+		t.Errorf("error.type %q, want %q", got, class)
+	}
+	var recorded bool
+	for _, e := range s.Events() {
+		recorded = recorded || e.Name == "exception"
+	}
+	if !recorded {
+		t.Errorf("events %+v record no exception", s.Events())
+	}
+}
+
+func TestTraceparentInMetaOverStdio(t *testing.T) {
+	srv := embednexustest.NewServer(t)
+	c, rec := newClient(t, srv.ClientConfig(client.TransportStdio))
+	if _, err := c.Embed(context.Background(), "a"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	s := spanNamed(t, rec, client.MethodEmbed)
+	if got := attrs(s)["embednexus.transport"].AsString(); got != client.TransportStdio {
+		t.Errorf("embednexus.transport %q", got)
+	}
+	var found bool
+	for _, req := range srv.Requests() {
+		if req.Method == client.MethodEmbed {
+			found = true
+			if req.Meta == nil || req.Meta.Traceparent != traceparent(s) {
+				t.Errorf("request meta %+v, want traceparent %q", req.Meta, traceparent(s))
+			}
+		}
+	}
+	if !found {
+		t.Fatal("the stdio server received no embed")
+	}
+}
+
+// answer answers mcp.embed with a two-component vector per input and any
+// other method with ok, keeping the meta of each embed in metas.
+func answer(metas chan<- *client.Meta) func(msg []byte) ([]byte, error) {
+	return func(msg []byte) ([]byte, error) {
+		var req client.Request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+		var result any = map[string]bool{"ok": true}
+		if req.Method == client.MethodEmbed {
+			metas <- req.Meta
+			var params struct {
+				Model  string   `json:"model"`
+				Inputs []string `json:"inputs"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			embeddings := make([]map[string]any, len(params.Inputs))
+			for i := range params.Inputs {
+				embeddings[i] = map[string]any{"index": i, "vector": []float32{1, 0.5}}
+			}
+			result = map[string]any{"model": params.Model, "embeddings": embeddings}
+		}
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Result: raw})
+	}
+}
+
+func TestTraceparentInMetaOverWebSocket(t *testing.T) {
+	metas := make(chan *client.Meta, 1)
+	srv := httptest.NewServer(client.WebSocketHandler(answer(metas)))
+	t.Cleanup(srv.Close)
+	c, rec := newClient(t, client.ClientConfig{Transport: client.TransportWebSocket, Endpoint: "ws" + strings.TrimPrefix(srv.URL, "http"), Model: "m"})
+	if _, err := c.Embed(context.Background(), "a"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	s := spanNamed(t, rec, client.MethodEmbed)
+	if got := attrs(s)["embednexus.transport"].AsString(); got != client.TransportWebSocket {
+		t.Errorf("embednexus.transport %q", got)
+	}
+	if meta := <-metas; meta == nil || meta.Traceparent != traceparent(s) {
+		t.Errorf("request meta %+v, want traceparent %q", meta, traceparent(s))
+	}
+}
+
+// streamHandler answers mcp.embed.stream over NDJSON with a frame per
+// input, last input first, then the done frame.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	var req client.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != client.MethodEmbedStream {
+		http.Error(w, "want mcp.embed.stream", http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		Inputs []string `json:"inputs"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	frame := func(f map[string]any) {
+		raw, _ := json.Marshal(f)
+		enc.Encode(client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Result: raw})
+		w.(http.Flusher).Flush()
+	}
+	for i := len(params.Inputs) - 1; i >= 0; i-- {
+		frame(map[string]any{"index": i, "vector": []float32{float32(len(params.Inputs[i])), 0.5}})
+	}
+	frame(map[string]any{"done": true})
+}
+
+func TestStreamFrameEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(streamHandler))
+	t.Cleanup(srv.Close)
+	c, rec := newClient(t, client.ClientConfig{Transport: client.TransportHTTP, Endpoint: srv.URL, Model: "m"})
+	results, err := c.EmbedStream(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("EmbedStream: %v", err)
+	}
+	for r := range results {
+		if r.Err != nil {
+			t.Fatalf("input %d: %v", r.Index, r.Err)
+		}
+	}
+
+	s := spanNamed(t, rec, client.MethodEmbedStream)
+	var indexes []int64
+	for _, e := range s.Events() {
+		if e.Name != "frame" {
+			continue
+		}
+		for _, kv := range e.Attributes {
+			if kv.Key == "embednexus.frame.index" {
+				indexes = append(indexes, kv.Value.AsInt64())
+			}
+		}
+	}
+	if len(indexes) != 3 || indexes[0] != 2 || indexes[1] != 1 || indexes[2] != 0 {
+		t.Errorf("frame events of indexes %v, want 2 1 0", indexes)
+	}
+	a := attrs(s)
+	if a["embednexus.stream.frames"].AsInt64() != 3 || a["embednexus.batch_size"].AsInt64() != 3 {
+		t.Errorf("attributes %v", s.Attributes())
+	}
+}
+
+func TestWithNilTracerProvider(t *testing.T) {
+	if _, err := client.NewClient("http://127.0.0.1:1", WithTracerProvider(nil)); err == nil || !strings.Contains(err.Error(), "WithTracerProvider") {
+		t.Fatalf("NewClient with a nil provider: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package embedpb
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// messages are the stub's messages by their names in the .proto.
+var messages = map[string]Message{
+	"EmbedRequest":        &EmbedRequest{},
+	"EmbedResponse":       &EmbedResponse{},
+	"Embedding":           &Embedding{},
+	"Usage":               &Usage{},
+	"EmbedStreamResponse": &EmbedStreamResponse{},
+	"Status":              &Status{},
+	"ListModelsRequest":   &ListModelsRequest{},
+	"ListModelsResponse":  &ListModelsResponse{},
+	"Model":               &Model{},
+	"ModelFeatures":       &ModelFeatures{},
+	"HealthCheckRequest":  &HealthCheckRequest{},
+	"HealthCheckResponse": &HealthCheckResponse{},
+}
+
+// wireTypes are the tag encodings of the .proto's field types; the others
+// are messages and enums.
+var wireTypes = map[string]string{"string": "bytes", "int32": "varint", "bool": "varint", "float": "fixed32"}
+
+func TestStubMatchesProto(t *testing.T) {
+	src, err := os.ReadFile("embednexus.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := regexp.MustCompile(`(?m)^message (\w+) \{`)
+	fieldLine := regexp.MustCompile(`(?m)^  (repeated )?(\w+) (\w+) = (\d+);`)
+	seen := 0
+	for _, loc := range message.FindAllSubmatchIndex(src, -1) {
+		name := string(src[loc[2]:loc[3]])
+		m, ok := messages[name]
+		if !ok {
+			t.Errorf("message %s has no stub", name)
+			continue
+		}
+		seen++
+		body := src[loc[1]:]
+		body = body[:bytes.Index(body, []byte("\n}\n"))]
+		typ := reflect.TypeOf(m).Elem()
+		fields := fieldLine.FindAllSubmatch(body, -1)
+		if len(fields) != typ.NumField() {
+			t.Errorf("%s: %d fields in the .proto, %d in the stub", name, len(fields), typ.NumField())
+			continue
+		}
+		for i, f := range fields {
+			kind, ok := wireTypes[string(f[2])]
+			if !ok {
+				kind = "bytes"
+				if strings.HasSuffix(string(f[2]), "Status") && string(f[2]) != "Status" {
+					kind = "varint"
+				}
+			}
+			label := "opt"
+			if len(f[1]) > 0 {
+				label = "rep"
+				if kind == "fixed32" {
+					label += ",packed"
+				}
+			}
+			want := kind + "," + string(f[4]) + "," + label + ",name=" + string(f[3])
+			got := typ.Field(i).Tag.Get("protobuf")
+			if !strings.HasPrefix(got, want+",proto3") {
+				t.Errorf("%s.%s: tag %q, want %s", name, typ.Field(i).Name, got, want)
+			}
+			if jsonName, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ","); jsonName != string(f[3]) {
+				t.Errorf("%s.%s: json name %q, want %s", name, typ.Field(i).Name, jsonName, f[3])
+			}
+		}
+	}
+	if seen != len(messages) {
+		t.Errorf("%d of the %d stubs are in the .proto", seen, len(messages))
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, m := range []Message{
+		&EmbedRequest{Model: "m", Inputs: []string{"héllo", "", "x"}, Dimensions: 64},
+		&EmbedResponse{Model: "m", Embeddings: []*Embedding{{Index: 0, Vector: []float32{1, -0.5, float32(math.Inf(1))}}, {Index: 1, Vector: []float32{0}, Truncated: true}}, Usage: &Usage{PromptTokens: 3, TotalTokens: 3}, ModelVersion: "m-2024-06"},
+		&EmbedStreamResponse{Index: 2, Error: &Status{Code: 3, Message: "input too long"}},
+		&ListModelsRequest{Cursor: "c", Limit: 10},
+		&ListModelsResponse{Models: []*Model{{Name: "a", Dimension: 4, MaxInputTokens: 512, Features: &ModelFeatures{Normalization: true, Dtypes: []string{"float32", "int8"}}}, {Name: "b"}}, NextCursor: "next"},
+		&HealthCheckRequest{Service: "embednexus.v1.Embedder"},
+		&HealthCheckResponse{Status: HealthCheckResponse_NOT_SERVING},
+	} {
+		back := reflect.New(reflect.TypeOf(m).Elem()).Interface().(Message)
+		if err := back.Unmarshal(m.Marshal()); err != nil || !reflect.DeepEqual(back, m) {
+			t.Errorf("%T: read back %+v, %v", m, back, err)
+		}
+	}
+}
+
+func TestWireEncoding(t *testing.T) {
+	// What protoc-gen-go writes for the same messages, negative varints
+	// sign-extended to ten bytes.
+	req := &EmbedRequest{Model: "m", Inputs: []string{"a", ""}, Dimensions: -1}
+	want := []byte{0x0a, 1, 'm', 0x12, 1, 'a', 0x12, 0, 0x18, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	if got := req.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("EmbedRequest % x, want % x", got, want)
+	}
+	e := &Embedding{Index: 1, Vector: []float32{1, -2}}
+	want = []byte{0x08, 1, 0x12, 8, 0, 0, 0x80, 0x3f, 0, 0, 0, 0xc0}
+	if got := e.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("Embedding % x, want % x", got, want)
+	}
+	if got := (&EmbedRequest{}).Marshal(); len(got) != 0 {
+		t.Errorf("an empty message encodes to % x", got)
+	}
+
+	// Unpacked floats read as packed ones do, and unknown fields of every
+	// wire type are skipped.
+	var back Embedding
+	unpacked := []byte{0x15, 0, 0, 0x80, 0x3f, 0x15, 0, 0, 0, 0xc0, 0x08, 1, 0x38, 0x96, 0x01, 0x21, 1, 2, 3, 4, 5, 6, 7, 8, 0x2a, 2, 'h', 'i', 0x35, 1, 2, 3, 4}
+	if err := back.Unmarshal(unpacked); err != nil || !reflect.DeepEqual(&back, e) {
+		t.Errorf("unpacked %+v, %v", back, err)
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"truncated tag":    {0x80},
+		"truncated string": {0x0a, 5, 'a'},
+		"truncated fixed":  {0x15, 0, 0},
+		"wrong wire type":  {0x08, 1},
+		"field zero":       {0x02, 0},
+		"group":            {0x0b},
+		"invalid utf-8":    {0x0a, 1, 0xff},
+	} {
+		var m EmbedRequest
+		if err := m.Unmarshal(data); err == nil {
+			t.Errorf("%s: read %+v", name, m)
+		}
+	}
+	var e Embedding
+	if err := e.Unmarshal([]byte{0x12, 3, 0, 0, 0}); err == nil {
+		t.Error("read a packed field of partial floats")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// The JSON names are the proto field names, and the enum renders by
+	// name.
+	for m, want := range map[Message]string{
+		&EmbedResponse{Model: "m", Embeddings: []*Embedding{{Vector: []float32{0.5}}}}:    `{"model":"m","embeddings":[{"index":0,"vector":[0.5]}]}`,
+		&HealthCheckResponse{Status: HealthCheckResponse_SERVING}:                         `{"status":"SERVING"}`,
+		&HealthCheckResponse{Status: 9}:                                                   `{"status":9}`,
+		&ListModelsResponse{Models: []*Model{{Name: "a", Dimension: 4}}, NextCursor: "c"}: `{"models":[{"name":"a","dimension":4,"features":null}],"next_cursor":"c"}`,
+	} {
+		got, err := json.Marshal(m)
+		if err != nil || string(got) != want {
+			t.Errorf("%T: %s, %v, want %s", m, got, err, want)
+		}
+	}
+	if got := HealthCheckResponse_ServingStatus(7).String(); got != strconv.Itoa(7) {
+		t.Errorf("status 7 is %q", got)
+	}
+}
@@ -0,0 +1,398 @@
+// Package embedpb holds the messages of the EmbedNexus gRPC service,
+// embednexus.proto, with their protobuf encoding and the full names of the
+// service's methods.
+//
+// The module depends on no protobuf runtime, so the messages are written
+// to the .proto by hand; the protoc-gen-go code generated from it is in
+// the module embedgrpc, whose tests hold these to it. Their struct tags
+// carry the field numbers as generated code's do. Fields encode as
+// proto3 encodes them, byte for byte as the generated code does: defaults
+// are left out, repeated scalars are packed, and unknown fields are
+// skipped. The json tags are the proto field names, so encoding/json
+// renders each message as JSON protojson reads back; the members every
+// envelope carries, such as an embedding's index, are kept when zero.
+package embedpb
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// The full names of the Embedder methods, the paths gRPC posts them to.
+const (
+	EmbedMethod       = "/embednexus.v1.Embedder/Embed"
+	EmbedStreamMethod = "/embednexus.v1.Embedder/EmbedStream"
+	ListModelsMethod  = "/embednexus.v1.Embedder/ListModels"
+	CheckMethod       = "/embednexus.v1.Embedder/Check"
+)
+
+// Message is a message of embednexus.proto.
+type Message interface {
+	// Marshal returns the protobuf encoding of the message.
+	Marshal() []byte
+	// Unmarshal replaces the message with the one b encodes.
+	Unmarshal(b []byte) error
+}
+
+type EmbedRequest struct {
+	Model      string   `protobuf:"bytes,1,opt,name=model,proto3" json:"model,omitempty"`
+	Inputs     []string `protobuf:"bytes,2,rep,name=inputs,proto3" json:"inputs,omitempty"`
+	Dimensions int32    `protobuf:"varint,3,opt,name=dimensions,proto3" json:"dimensions,omitempty"`
+}
+
+func (m *EmbedRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Model)
+	for _, s := range m.Inputs {
+		b = appendRawString(b, 2, s)
+	}
+	return appendInt32(b, 3, m.Dimensions)
+}
+
+func (m *EmbedRequest) Unmarshal(b []byte) error {
+	*m = EmbedRequest{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Model, err = f.string()
+		case 2:
+			var s string
+			s, err = f.string()
+			m.Inputs = append(m.Inputs, s)
+		case 3:
+			m.Dimensions, err = f.int32()
+		}
+		return err
+	})
+}
+
+type EmbedResponse struct {
+	Model        string       `protobuf:"bytes,1,opt,name=model,proto3" json:"model,omitempty"`
+	Embeddings   []*Embedding `protobuf:"bytes,2,rep,name=embeddings,proto3" json:"embeddings"`
+	Usage        *Usage       `protobuf:"bytes,3,opt,name=usage,proto3" json:"usage,omitempty"`
+	ModelVersion string       `protobuf:"bytes,4,opt,name=model_version,proto3" json:"model_version,omitempty"`
+}
+
+func (m *EmbedResponse) Marshal() []byte {
+	b := appendString(nil, 1, m.Model)
+	for _, e := range m.Embeddings {
+		b = appendMessage(b, 2, e)
+	}
+	if m.Usage != nil {
+		b = appendMessage(b, 3, m.Usage)
+	}
+	return appendString(b, 4, m.ModelVersion)
+}
+
+func (m *EmbedResponse) Unmarshal(b []byte) error {
+	*m = EmbedResponse{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Model, err = f.string()
+		case 2:
+			e := &Embedding{}
+			err = f.message(e)
+			m.Embeddings = append(m.Embeddings, e)
+		case 3:
+			m.Usage = &Usage{}
+			err = f.message(m.Usage)
+		case 4:
+			m.ModelVersion, err = f.string()
+		}
+		return err
+	})
+}
+
+// Embedding is one vector of an EmbedResponse. Its index and vector are
+// rendered even when empty, as every other transport's embeddings are.
+type Embedding struct {
+	Index     int32     `protobuf:"varint,1,opt,name=index,proto3" json:"index"`
+	Vector    []float32 `protobuf:"fixed32,2,rep,packed,name=vector,proto3" json:"vector"`
+	Truncated bool      `protobuf:"varint,3,opt,name=truncated,proto3" json:"truncated,omitempty"`
+}
+
+func (m *Embedding) Marshal() []byte {
+	return appendBool(appendFloats(appendInt32(nil, 1, m.Index), 2, m.Vector), 3, m.Truncated)
+}
+
+func (m *Embedding) Unmarshal(b []byte) error {
+	*m = Embedding{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Index, err = f.int32()
+		case 2:
+			m.Vector, err = f.appendFloats(m.Vector)
+		case 3:
+			m.Truncated, err = f.bool()
+		}
+		return err
+	})
+}
+
+type Usage struct {
+	PromptTokens int32 `protobuf:"varint,1,opt,name=prompt_tokens,proto3" json:"prompt_tokens"`
+	TotalTokens  int32 `protobuf:"varint,2,opt,name=total_tokens,proto3" json:"total_tokens"`
+}
+
+func (m *Usage) Marshal() []byte {
+	return appendInt32(appendInt32(nil, 1, m.PromptTokens), 2, m.TotalTokens)
+}
+
+func (m *Usage) Unmarshal(b []byte) error {
+	*m = Usage{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.PromptTokens, err = f.int32()
+		case 2:
+			m.TotalTokens, err = f.int32()
+		}
+		return err
+	})
+}
+
+// EmbedStreamResponse is one message of the EmbedStream stream: the
+// vector of the input at index, or the error it failed with.
+type EmbedStreamResponse struct {
+	Index  int32     `protobuf:"varint,1,opt,name=index,proto3" json:"index"`
+	Vector []float32 `protobuf:"fixed32,2,rep,packed,name=vector,proto3" json:"vector,omitempty"`
+	Error  *Status   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (m *EmbedStreamResponse) Marshal() []byte {
+	b := appendFloats(appendInt32(nil, 1, m.Index), 2, m.Vector)
+	if m.Error != nil {
+		b = appendMessage(b, 3, m.Error)
+	}
+	return b
+}
+
+func (m *EmbedStreamResponse) Unmarshal(b []byte) error {
+	*m = EmbedStreamResponse{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Index, err = f.int32()
+		case 2:
+			m.Vector, err = f.appendFloats(m.Vector)
+		case 3:
+			m.Error = &Status{}
+			err = f.message(m.Error)
+		}
+		return err
+	})
+}
+
+type Status struct {
+	Code    int32  `protobuf:"varint,1,opt,name=code,proto3" json:"code"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message"`
+}
+
+func (m *Status) Marshal() []byte {
+	return appendString(appendInt32(nil, 1, m.Code), 2, m.Message)
+}
+
+func (m *Status) Unmarshal(b []byte) error {
+	*m = Status{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Code, err = f.int32()
+		case 2:
+			m.Message, err = f.string()
+		}
+		return err
+	})
+}
+
+type ListModelsRequest struct {
+	Cursor string `protobuf:"bytes,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit  int32  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *ListModelsRequest) Marshal() []byte {
+	return appendInt32(appendString(nil, 1, m.Cursor), 2, m.Limit)
+}
+
+func (m *ListModelsRequest) Unmarshal(b []byte) error {
+	*m = ListModelsRequest{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Cursor, err = f.string()
+		case 2:
+			m.Limit, err = f.int32()
+		}
+		return err
+	})
+}
+
+type ListModelsResponse struct {
+	Models     []*Model `protobuf:"bytes,1,rep,name=models,proto3" json:"models"`
+	NextCursor string   `protobuf:"bytes,2,opt,name=next_cursor,proto3" json:"next_cursor,omitempty"`
+}
+
+func (m *ListModelsResponse) Marshal() []byte {
+	var b []byte
+	for _, model := range m.Models {
+		b = appendMessage(b, 1, model)
+	}
+	return appendString(b, 2, m.NextCursor)
+}
+
+func (m *ListModelsResponse) Unmarshal(b []byte) error {
+	*m = ListModelsResponse{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			model := &Model{}
+			err = f.message(model)
+			m.Models = append(m.Models, model)
+		case 2:
+			m.NextCursor, err = f.string()
+		}
+		return err
+	})
+}
+
+// Model is a model of the listing. Its features are rendered even when
+// unset, as the listings of the other transports render them.
+type Model struct {
+	Name           string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name"`
+	Dimension      int32          `protobuf:"varint,2,opt,name=dimension,proto3" json:"dimension"`
+	MaxInputTokens int32          `protobuf:"varint,3,opt,name=max_input_tokens,proto3" json:"max_input_tokens,omitempty"`
+	Features       *ModelFeatures `protobuf:"bytes,4,opt,name=features,proto3" json:"features"`
+}
+
+func (m *Model) Marshal() []byte {
+	b := appendInt32(appendInt32(appendString(nil, 1, m.Name), 2, m.Dimension), 3, m.MaxInputTokens)
+	if m.Features != nil {
+		b = appendMessage(b, 4, m.Features)
+	}
+	return b
+}
+
+func (m *Model) Unmarshal(b []byte) error {
+	*m = Model{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Name, err = f.string()
+		case 2:
+			m.Dimension, err = f.int32()
+		case 3:
+			m.MaxInputTokens, err = f.int32()
+		case 4:
+			m.Features = &ModelFeatures{}
+			err = f.message(m.Features)
+		}
+		return err
+	})
+}
+
+type ModelFeatures struct {
+	Normalization bool     `protobuf:"varint,1,opt,name=normalization,proto3" json:"normalization"`
+	Truncation    bool     `protobuf:"varint,2,opt,name=truncation,proto3" json:"truncation"`
+	Dimensions    bool     `protobuf:"varint,3,opt,name=dimensions,proto3" json:"dimensions,omitempty"`
+	Dtypes        []string `protobuf:"bytes,4,rep,name=dtypes,proto3" json:"dtypes,omitempty"`
+}
+
+func (m *ModelFeatures) Marshal() []byte {
+	b := appendBool(appendBool(appendBool(nil, 1, m.Normalization), 2, m.Truncation), 3, m.Dimensions)
+	for _, s := range m.Dtypes {
+		b = appendRawString(b, 4, s)
+	}
+	return b
+}
+
+func (m *ModelFeatures) Unmarshal(b []byte) error {
+	*m = ModelFeatures{}
+	return eachField(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.Normalization, err = f.bool()
+		case 2:
+			m.Truncation, err = f.bool()
+		case 3:
+			m.Dimensions, err = f.bool()
+		case 4:
+			var s string
+			s, err = f.string()
+			m.Dtypes = append(m.Dtypes, s)
+		}
+		return err
+	})
+}
+
+type HealthCheckRequest struct {
+	Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+}
+
+func (m *HealthCheckRequest) Marshal() []byte {
+	return appendString(nil, 1, m.Service)
+}
+
+func (m *HealthCheckRequest) Unmarshal(b []byte) error {
+	*m = HealthCheckRequest{}
+	return eachField(b, func(f field) (err error) {
+		if f.num == 1 {
+			m.Service, err = f.string()
+		}
+		return err
+	})
+}
+
+type HealthCheckResponse struct {
+	Status HealthCheckResponse_ServingStatus `protobuf:"varint,1,opt,name=status,proto3,enum=embednexus.v1.HealthCheckResponse_ServingStatus" json:"status"`
+}
+
+func (m *HealthCheckResponse) Marshal() []byte {
+	return appendInt32(nil, 1, int32(m.Status))
+}
+
+func (m *HealthCheckResponse) Unmarshal(b []byte) error {
+	*m = HealthCheckResponse{}
+	return eachField(b, func(f field) (err error) {
+		if f.num == 1 {
+			var v int32
+			v, err = f.int32()
+			m.Status = HealthCheckResponse_ServingStatus(v)
+		}
+		return err
+	})
+}
+
+// HealthCheckResponse_ServingStatus is named as protoc-gen-go names nested
+// enums.
+type HealthCheckResponse_ServingStatus int32
+
+const (
+	HealthCheckResponse_UNKNOWN         HealthCheckResponse_ServingStatus = 0
+	HealthCheckResponse_SERVING         HealthCheckResponse_ServingStatus = 1
+	HealthCheckResponse_NOT_SERVING     HealthCheckResponse_ServingStatus = 2
+	HealthCheckResponse_SERVICE_UNKNOWN HealthCheckResponse_ServingStatus = 3
+)
+
+var servingStatusNames = map[HealthCheckResponse_ServingStatus]string{
+	HealthCheckResponse_UNKNOWN:         "UNKNOWN",
+	HealthCheckResponse_SERVING:         "SERVING",
+	HealthCheckResponse_NOT_SERVING:     "NOT_SERVING",
+	HealthCheckResponse_SERVICE_UNKNOWN: "SERVICE_UNKNOWN",
+}
+
+func (s HealthCheckResponse_ServingStatus) String() string {
+	if name, ok := servingStatusNames[s]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+// MarshalJSON renders s by its name, or by its number when it has none,
+// as protojson does.
+func (s HealthCheckResponse_ServingStatus) MarshalJSON() ([]byte, error) {
+	if name, ok := servingStatusNames[s]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int32(s))
+}
@@ -0,0 +1,183 @@
+package embedpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// wireType is the protobuf encoding of a field's value.
+type wireType uint8
+
+const (
+	wireVarint  wireType = 0
+	wireFixed64 wireType = 1
+	wireBytes   wireType = 2
+	wireFixed32 wireType = 5
+)
+
+func appendTag(b []byte, num int, t wireType) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(t))
+}
+
+func appendString(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendRawString(b, num, s)
+}
+
+// appendRawString appends s even when empty, as the elements of repeated
+// fields are.
+func appendRawString(b []byte, num int, s string) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendInt32(b []byte, num int, v int32) []byte {
+	if v == 0 {
+		return b
+	}
+	// Negative values take ten bytes, sign-extended as int64s are.
+	return binary.AppendUvarint(appendTag(b, num, wireVarint), uint64(int64(v)))
+}
+
+func appendBool(b []byte, num int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return append(appendTag(b, num, wireVarint), 1)
+}
+
+// appendFloats appends v packed, as proto3 encodes repeated scalars.
+func appendFloats(b []byte, num int, v []float32) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(4*len(v)))
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(x))
+	}
+	return b
+}
+
+// appendMessage appends m as a length-delimited field.
+func appendMessage(b []byte, num int, m Message) []byte {
+	raw := m.Marshal()
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(raw)))
+	return append(b, raw...)
+}
+
+// field is one field read from an encoded message: its varint or fixed
+// value in v, or its bytes in data.
+type field struct {
+	num  int
+	typ  wireType
+	v    uint64
+	data []byte
+}
+
+var errTruncated = errors.New("embedpb: truncated message")
+
+// eachField calls fn with each field of the encoded message b, in order.
+func eachField(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := field{typ: wireType(key & 7)}
+		if key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return fmt.Errorf("embedpb: invalid field number %d", key>>3)
+		}
+		f.num = int(key >> 3)
+		switch f.typ {
+		case wireVarint:
+			if f.v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errTruncated
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			// Groups are proto2 only.
+			return fmt.Errorf("embedpb: field %d has unsupported wire type %d", f.num, f.typ)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f field) want(t wireType) error {
+	if f.typ != t {
+		return fmt.Errorf("embedpb: field %d has wire type %d, want %d", f.num, f.typ, t)
+	}
+	return nil
+}
+
+func (f field) string() (string, error) {
+	if err := f.want(wireBytes); err != nil {
+		return "", err
+	}
+	if !utf8.Valid(f.data) {
+		return "", fmt.Errorf("embedpb: field %d is not valid UTF-8", f.num)
+	}
+	return string(f.data), nil
+}
+
+func (f field) int32() (int32, error) {
+	// Truncation is how int32 reads the sign-extended varint.
+	return int32(f.v), f.want(wireVarint)
+}
+
+func (f field) bool() (bool, error) {
+	return f.v != 0, f.want(wireVarint)
+}
+
+// appendFloats appends the floats of f to v, packed or not.
+func (f field) appendFloats(v []float32) ([]float32, error) {
+	switch f.typ {
+	case wireFixed32:
+		return append(v, math.Float32frombits(uint32(f.v))), nil
+	case wireBytes:
+		if len(f.data)%4 != 0 {
+			return v, fmt.Errorf("embedpb: field %d packs %d bytes, not whole floats", f.num, len(f.data))
+		}
+		v = append(v, make([]float32, len(f.data)/4)...)
+		out := v[len(v)-len(f.data)/4:]
+		for i := range out {
+			out[i] = math.Float32frombits(binary.LittleEndian.Uint32(f.data[4*i:]))
+		}
+		return v, nil
+	}
+	return v, f.want(wireFixed32)
+}
+
+func (f field) message(m Message) error {
+	if err := f.want(wireBytes); err != nil {
+		return err
+	}
+	return m.Unmarshal(f.data)
+}
@@ -0,0 +1,155 @@
+// Package embedprometheus reports the client's metrics to a registry of
+// github.com/prometheus/client_golang. It is a module of its own, so the
+// client module and the CLI take no dependency on client_golang:
+//
+//	reg := prometheus.NewRegistry()
+//	sink, err := embedprometheus.NewSink(reg)
+//	c, err := client.NewClient(endpoint, client.WithMetrics(sink))
+//	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+//
+// The metrics are the client.Metric constants, under the labels they
+// document: counters are CounterVecs, latencies HistogramVecs, and the
+// requests in flight and the spool depth GaugeVecs. client.PrometheusSink
+// serves the same series with no Prometheus library.
+package embedprometheus
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Sink is a client.MetricsSink whose metrics are registered with a
+// prometheus.Registerer. One sink may serve several clients; their series
+// differ by transport label only. Names and labels other than those the
+// client.Metric constants document are dropped rather than panicking on
+// the request path.
+type Sink struct {
+	counters   map[string]vec[*prometheus.CounterVec]
+	gauges     map[string]vec[*prometheus.GaugeVec]
+	histograms map[string]vec[*prometheus.HistogramVec]
+}
+
+// vec is a metric vector and its label names, in order.
+type vec[V any] struct {
+	v      V
+	labels []string
+}
+
+var (
+	byMethod = []string{client.LabelMethod, client.LabelTransport}
+	byStatus = []string{client.LabelMethod, client.LabelTransport, client.LabelStatus}
+	byClient = []string{client.LabelTransport}
+)
+
+// NewSink registers the client metrics with reg, their histograms using
+// client.DefaultLatencyBuckets, and returns the sink reporting to them.
+func NewSink(reg prometheus.Registerer) (*Sink, error) {
+	return NewSinkBuckets(reg, client.DefaultLatencyBuckets)
+}
+
+// NewSinkBuckets is NewSink with histograms of the given ascending bucket
+// upper bounds. It fails when reg does, as when another sink registered
+// the metrics first.
+func NewSinkBuckets(reg prometheus.Registerer, buckets []float64) (*Sink, error) {
+	if reg == nil {
+		return nil, errors.New("embedprometheus: registerer must not be nil")
+	}
+	s := &Sink{
+		counters:   make(map[string]vec[*prometheus.CounterVec]),
+		gauges:     make(map[string]vec[*prometheus.GaugeVec]),
+		histograms: make(map[string]vec[*prometheus.HistogramVec]),
+	}
+	var collectors []prometheus.Collector
+	for name, labels := range map[string][]string{
+		client.MetricRequests:      byStatus,
+		client.MetricRetries:       byMethod,
+		client.MetricHedges:        byMethod,
+		client.MetricHedgeWins:     byMethod,
+		client.MetricCacheHits:     byClient,
+		client.MetricCacheMisses:   byClient,
+		client.MetricSentBytes:     byMethod,
+		client.MetricReceivedBytes: byMethod,
+	} {
+		v := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: client.MetricHelp(name)}, labels)
+		s.counters[name] = vec[*prometheus.CounterVec]{v, labels}
+		collectors = append(collectors, v)
+	}
+	for _, name := range []string{client.MetricRequestsInFlight, client.MetricSpoolDepth} {
+		v := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: client.MetricHelp(name)}, byClient)
+		s.gauges[name] = vec[*prometheus.GaugeVec]{v, byClient}
+		collectors = append(collectors, v)
+	}
+	for name, labels := range map[string][]string{
+		client.MetricRequestDuration: byMethod,
+		client.MetricSpoolReplayLag:  byClient,
+	} {
+		v := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: client.MetricHelp(name), Buckets: buckets}, labels)
+		s.histograms[name] = vec[*prometheus.HistogramVec]{v, labels}
+		collectors = append(collectors, v)
+	}
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			for _, registered := range collectors[:i] {
+				reg.Unregister(registered)
+			}
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddCounter implements client.MetricsSink.
+func (s *Sink) AddCounter(name string, labels []client.Label, delta float64) {
+	if v, ok := s.counters[name]; ok {
+		if values, ok := labelValues(v.labels, labels); ok {
+			v.v.WithLabelValues(values...).Add(delta)
+		}
+	}
+}
+
+// AddGauge implements client.MetricsSink.
+func (s *Sink) AddGauge(name string, labels []client.Label, delta float64) {
+	if v, ok := s.gauges[name]; ok {
+		if values, ok := labelValues(v.labels, labels); ok {
+			v.v.WithLabelValues(values...).Add(delta)
+		}
+	}
+}
+
+// ObserveHistogram implements client.MetricsSink.
+func (s *Sink) ObserveHistogram(name string, labels []client.Label, value float64) {
+	if v, ok := s.histograms[name]; ok {
+		if values, ok := labelValues(v.labels, labels); ok {
+			v.v.WithLabelValues(values...).Observe(value)
+		}
+	}
+}
+
+// labelValues returns the values of labels in the order of names, false
+// unless labels name each of names once.
+func labelValues(names []string, labels []client.Label) ([]string, bool) {
+	if len(labels) != len(names) {
+		return nil, false
+	}
+	values := make([]string, len(names))
+	for i, name := range names {
+		if labels[i].Name == name {
+			values[i] = labels[i].Value
+			continue
+		}
+		found := false
+		for _, l := range labels {
+			if l.Name == name {
+				values[i], found = l.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return values, true
+}
@@ -0,0 +1,183 @@
+package embedprometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embednexustest"
+)
+
+// gather returns the value of each series of reg by its name and sorted
+// labels, a histogram's being its count of observations under its name
+// with "_count", and the type of each family.
+func gather(t *testing.T, reg *prometheus.Registry) (map[string]float64, map[string]dto.MetricType) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	series := map[string]float64{}
+	types := map[string]dto.MetricType{}
+	for _, f := range families {
+		types[f.GetName()] = f.GetType()
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			key := f.GetName() + "{" + strings.Join(labels, ",") + "}"
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				series[key] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				series[key] = m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				series[f.GetName()+"_count{"+strings.Join(labels, ",")+"}"] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return series, types
+}
+
+func TestSinkSeries(t *testing.T) {
+	srv := embednexustest.NewServer(t)
+	reg := prometheus.NewRegistry()
+	sink, err := NewSink(reg)
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	cfg := srv.ClientConfig(client.TransportHTTP)
+	cfg.Retry = client.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	cfg.Cache = client.CacheConfig{MaxEntries: 10}
+	c, err := client.NewClient("", client.WithConfig(cfg), client.WithMetrics(sink))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	srv.Fail(client.MethodEmbed, embednexustest.FaultInternal, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Embed(context.Background(), "cached"); err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+	}
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	series, types := gather(t, reg)
+	for name, typ := range map[string]dto.MetricType{
+		client.MetricRequests:         dto.MetricType_COUNTER,
+		client.MetricRetries:          dto.MetricType_COUNTER,
+		client.MetricCacheHits:        dto.MetricType_COUNTER,
+		client.MetricCacheMisses:      dto.MetricType_COUNTER,
+		client.MetricSentBytes:        dto.MetricType_COUNTER,
+		client.MetricReceivedBytes:    dto.MetricType_COUNTER,
+		client.MetricRequestsInFlight: dto.MetricType_GAUGE,
+		client.MetricRequestDuration:  dto.MetricType_HISTOGRAM,
+	} {
+		if got, ok := types[name]; !ok || got != typ {
+			t.Errorf("%s gathered as %v, want %v", name, got, typ)
+		}
+	}
+
+	// The failed embed and its retry are two requests, the cached one none.
+	want := map[string]float64{
+		`embednexus_client_requests_total{method=mcp.embed,status=api,transport=http}`:      1,
+		`embednexus_client_requests_total{method=mcp.embed,status=ok,transport=http}`:       1,
+		`embednexus_client_requests_total{method=mcp.ping,status=ok,transport=http}`:        1,
+		`embednexus_client_retries_total{method=mcp.embed,transport=http}`:                  1,
+		`embednexus_client_cache_hits_total{transport=http}`:                                1,
+		`embednexus_client_cache_misses_total{transport=http}`:                              1,
+		`embednexus_client_requests_in_flight{transport=http}`:                              0,
+		`embednexus_client_request_duration_seconds_count{method=mcp.embed,transport=http}`: 2,
+		`embednexus_client_request_duration_seconds_count{method=mcp.ping,transport=http}`:  1,
+	}
+	// The byte counters add up to the client's own counts.
+	stats := c.Stats()
+	var sent, received float64
+	for key, got := range series {
+		switch {
+		case strings.HasPrefix(key, client.MetricSentBytes+"{"):
+			sent += got
+		case strings.HasPrefix(key, client.MetricReceivedBytes+"{"):
+			received += got
+		default:
+			if value, ok := want[key]; !ok || got != value {
+				t.Errorf("%s = %v, want %v (expected %t)", key, got, value, ok)
+			}
+		}
+	}
+	for key := range want {
+		if _, ok := series[key]; !ok {
+			t.Errorf("%s not gathered", key)
+		}
+	}
+	if sent != float64(stats.BytesSent) || received != float64(stats.BytesReceived) || sent == 0 || received == 0 {
+		t.Errorf("%v bytes sent and %v received, Stats counts %d and %d", sent, received, stats.BytesSent, stats.BytesReceived)
+	}
+	for _, key := range []string{
+		`embednexus_client_sent_bytes_total{method=mcp.embed,transport=http}`,
+		`embednexus_client_received_bytes_total{method=mcp.ping,transport=http}`,
+	} {
+		if series[key] <= 0 {
+			t.Errorf("%s = %v, want some bytes", key, series[key])
+		}
+	}
+	if t.Failed() {
+		t.Log(series)
+	}
+}
+
+func TestSecondSinkOfARegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewSink(reg)
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	if _, err := NewSink(reg); err == nil {
+		t.Fatal("a second sink registered the same metrics")
+	}
+	// The failed registration leaves the first sink's metrics in place.
+	sink.AddCounter(client.MetricCacheHits, []client.Label{{Name: client.LabelTransport, Value: "http"}}, 2)
+	if series, _ := gather(t, reg); series[`embednexus_client_cache_hits_total{transport=http}`] != 2 {
+		t.Errorf("series %v", series)
+	}
+	if _, err := NewSink(nil); err == nil {
+		t.Error("NewSink of a nil registerer succeeded")
+	}
+}
+
+func TestUnknownSeriesDropped(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewSink(reg)
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	transport := client.Label{Name: client.LabelTransport, Value: "http"}
+	sink.AddCounter("other_total", []client.Label{transport}, 1)
+	sink.AddCounter(client.MetricRetries, []client.Label{transport}, 1)
+	sink.ObserveHistogram(client.MetricSpoolReplayLag, []client.Label{transport, {Name: "extra", Value: "x"}}, 1)
+	// Labels out of order still name the series.
+	sink.AddGauge(client.MetricSpoolDepth, []client.Label{transport}, 3)
+	sink.AddCounter(client.MetricHedges, []client.Label{transport, {Name: client.LabelMethod, Value: "mcp.embed"}}, 1)
+	series, _ := gather(t, reg)
+	want := map[string]float64{
+		`embednexus_client_spool_depth{transport=http}`:                   3,
+		`embednexus_client_hedges_total{method=mcp.embed,transport=http}`: 1,
+	}
+	if len(series) != len(want) {
+		t.Errorf("series %v, want %v", series, want)
+	}
+	for key, value := range want {
+		if series[key] != value {
+			t.Errorf("%s = %v, want %v", key, series[key], value)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// errorsFixture is the gen-fixtures target recording each of
+// errorScenarios, the whole session with its failure, into
+// <out>/go/<transport>/errors/<scenario>.json.
+const errorsFixture = "errors"
+
+// errorFixtureDir is the directory of a transport's error scenarios below
+// <tree>/go/<transport>.
+const errorFixtureDir = "errors"
+
+// faultRateLimited answers mcp.embed over http with 429 and a Retry-After
+// of rateLimitedRetryAfter.
+const faultRateLimited = "rate-limited"
+
+// rateLimitedRetryAfter is the Retry-After, in seconds, of faultRateLimited.
+const rateLimitedRetryAfter = 7
+
+// errorScenario is a failure recorded over one transport.
+type errorScenario struct {
+	// Name names its fixture.
+	Name      string
+	Transport string
+	// Fault is the fault the fake embedder injects, if the failure is not
+	// one of the connection.
+	Fault string
+	// Stream embeds with EmbedStream rather than Embed.
+	Stream bool
+}
+
+// errorScenarios are the failures the errors target records.
+var errorScenarios = []errorScenario{
+	{Name: "refused", Transport: client.TransportHTTP},
+	{Name: "refused", Transport: client.TransportUnix},
+	{Name: "tls-handshake", Transport: client.TransportTLS},
+	{Name: "rate-limited", Transport: client.TransportHTTP, Fault: faultRateLimited},
+	{Name: "server-error", Transport: client.TransportHTTP, Fault: faultServerError},
+	{Name: "truncated", Transport: client.TransportHTTP, Fault: faultTruncate},
+	{Name: "truncated", Transport: client.TransportStdio, Fault: faultTruncate},
+	{Name: "stream-disconnect", Transport: client.TransportStdio, Fault: faultDisconnect, Stream: true},
+}
+
+// File returns the path of s's fixture below tree.
+func (s errorScenario) File(tree string) string {
+	return filepath.Join(tree, client.ClientMarker, s.Transport, errorFixtureDir, s.Name+".json")
+}
+
+// errorFixturesExist reports whether tree holds the fixture of any of
+// errorScenarios.
+func errorFixturesExist(tree string) bool {
+	for _, s := range errorScenarios {
+		if fileExists(s.File(tree)) {
+			return true
+		}
+	}
+	return false
+}
+
+// genErrorFixtures records each of errorScenarios and writes its fixture
+// below tree.
+func genErrorFixtures(ctx context.Context, tree string, rules *transcript.Normalizer) error {
+	for _, s := range errorScenarios {
+		t, _, err := recordErrorScenario(ctx, s, rules)
+		if err != nil {
+			return fmt.Errorf("%s over %s: %w", s.Name, s.Transport, err)
+		}
+		if err := transcript.Save(s.File(tree), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordErrorScenario embeds embedFixtureInputs against the fake embedder
+// failing as s says and returns the session, normalized, and the error the
+// client surfaced; err reports a failure to record it.
+func recordErrorScenario(ctx context.Context, s errorScenario, rules *transcript.Normalizer) (t transcript.Transcript, surfaced, err error) {
+	tmp, err := os.MkdirTemp("", "embednexus-fixtures-")
+	if err != nil {
+		return t, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	ctx, cancel := context.WithTimeout(ctx, genFixtureTimeout)
+	defer cancel()
+
+	fake, err := serveFaulty(s, tmp)
+	if err != nil {
+		return t, nil, err
+	}
+	defer fake.Close()
+	sink := &transcript.MemorySink{}
+	recorder := transcript.NewRecorder(sink)
+	c, err := client.NewClient("", client.WithConfig(fake.Config), client.WithTranscriptRecorder(recorder))
+	if err != nil {
+		return t, nil, err
+	}
+	recorder.Header.Transport = c.Config().Transport
+	if s.Stream {
+		results, err := c.EmbedStream(ctx, embedFixtureInputs)
+		if err != nil {
+			surfaced = err
+		}
+		for r := range results {
+			if r.Index < 0 {
+				surfaced = r.Err
+			}
+		}
+	} else {
+		_, surfaced = c.Embed(ctx, embedFixtureInputs[0])
+	}
+	if surfaced == nil {
+		c.Close(ctx)
+		return t, nil, fmt.Errorf("the client surfaced no error")
+	}
+	if err := c.Close(ctx); err != nil {
+		return t, nil, err
+	}
+	if err := recorder.Close(); err != nil {
+		return t, nil, err
+	}
+	if t, err = rules.Normalize(sink.Transcript()); err != nil {
+		return t, nil, err
+	}
+	if t, err = fake.Normalize(t); err != nil {
+		return t, nil, err
+	}
+	return t, surfaced, nil
+}
+
+// serveFaulty serves the fake embedder over s.Transport, failing as s
+// says, keeping its socket and certificate files in dir. The refused
+// scenarios serve nothing.
+func serveFaulty(s errorScenario, dir string) (*fakeServer, error) {
+	fake := &fakeServer{Config: client.ClientConfig{Transport: s.Transport}, close: func() {}}
+	switch {
+	case s.Name == "refused" && s.Transport == client.TransportHTTP:
+		// A port just listened on is, for the moment, one that refuses.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		ln.Close()
+		fake.Config.Endpoint = "http://" + ln.Addr().String() + "/mcp"
+	case s.Name == "refused" && s.Transport == client.TransportUnix:
+		fake.Config.SocketPath = filepath.Join(dir, "embednexus.sock")
+		fake.volatile = fake.Config.SocketPath
+	case s.Transport == client.TransportTLS:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		// The client trusts another certificate than the one served.
+		tc, err := selfSignedTLS(filepath.Join(dir, "server.pem"))
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		caFile := filepath.Join(dir, "ca.pem")
+		if _, err := selfSignedTLS(caFile); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		// The server would log the handshake the client aborts.
+		srv := &http.Server{Handler: defaultFake, ReadHeaderTimeout: genFixtureTimeout, ErrorLog: log.New(io.Discard, "", 0)}
+		go srv.Serve(tls.NewListener(ln, tc))
+		fake.close = func() { srv.Close() }
+		fake.Config.Endpoint, fake.Config.TLSCAFiles = "https://"+ln.Addr().String()+"/mcp", []string{caFile}
+	case s.Transport == client.TransportHTTP:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		srv := &http.Server{Handler: defaultFake.faulty(s.Fault), ReadHeaderTimeout: genFixtureTimeout}
+		go srv.Serve(ln)
+		fake.close = func() { srv.Close() }
+		fake.Config.Endpoint = "http://" + ln.Addr().String() + "/mcp"
+	case s.Transport == client.TransportStdio:
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		fake.Config.Command = []string{exe, serveFakeCommand, s.Fault}
+	default:
+		return nil, fmt.Errorf("the fake embedder cannot fail %q over %s", s.Name, s.Transport)
+	}
+	return fake, nil
+}
+
+// faulty returns a handler answering as ServeHTTP does but for mcp.embed,
+// which it fails as fault says: faultRateLimited, faultServerError with a
+// JSON-RPC error body, or faultTruncate with half the body its
+// Content-Length announces.
+func (f fakeEmbedder) faulty(fault string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req client.Request
+		if json.Unmarshal(payload, &req) != nil || req.Method != client.MethodEmbed {
+			r.Body = io.NopCloser(bytes.NewReader(payload))
+			f.ServeHTTP(w, r)
+			return
+		}
+		switch fault {
+		case faultRateLimited:
+			w.Header().Set("Retry-After", strconv.Itoa(rateLimitedRetryAfter))
+			http.Error(w, fault+" (injected)", http.StatusTooManyRequests)
+		case faultServerError:
+			out, err := json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Error: &client.RPCError{
+				Code:    fakeFaultCodes[fault],
+				Message: fault + " (injected)",
+				Data:    json.RawMessage(`{"retryable":true,"request_id":"fake-request"}`),
+			}})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(out)
+		case faultTruncate:
+			out, err := f.answerPayload(payload)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+			w.Write(out[:len(out)/2])
+		default:
+			http.Error(w, "unknown fault "+fault, http.StatusInternalServerError)
+		}
+	})
+}
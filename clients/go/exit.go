@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"syscall"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Process exit codes. Scripts can branch on the failure class without
+// parsing stderr.
+const (
+	exitOK              = 0
+	exitFailure         = 1
+	exitUsage           = 2
+	exitTimeout         = 3
+	exitUnauthorized    = 4
+	exitModelNotFound   = 5
+	exitPayloadTooLarge = 6
+	exitConnection      = 7
+	exitProtocol        = 8
+	exitAPI             = 9
+	exitMismatch        = 10
+	// exitInterrupted, 128 plus SIGINT's number as shells report it, ends
+	// a run stopped by SIGINT or SIGTERM.
+	exitInterrupted = 130
+)
+
+// exitCode maps err onto the exit code of its error class. A server that
+// cannot be reached at all, refusing the connection, failing the TLS
+// handshake, or not starting, is a connection failure like one that drops
+// the connection.
+func exitCode(err error) int {
+	var apiErr *client.APIError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, client.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, client.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, client.ErrModelNotFound):
+		return exitModelNotFound
+	case errors.Is(err, client.ErrPayloadTooLarge):
+		return exitPayloadTooLarge
+	case errors.Is(err, client.ErrConnectionLost), errors.Is(err, client.ErrCircuitOpen), unreachable(err):
+		return exitConnection
+	case errors.Is(err, client.ErrProtocol), errors.Is(err, client.ErrIncompatibleProtocol):
+		return exitProtocol
+	case errors.As(err, &apiErr):
+		return exitAPI
+	default:
+		return exitFailure
+	}
+}
+
+// unreachable reports whether err means the server could not be reached.
+func unreachable(err error) bool {
+	for _, target := range []error{
+		client.ErrTLSHandshake, client.ErrCertPinMismatch, client.ErrTLSVersionTooLow,
+		client.ErrUnixUnsupported, syscall.ECONNREFUSED, syscall.ECONNRESET,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var execErr *exec.Error
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.As(err, &execErr)
+}
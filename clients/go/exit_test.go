@@ -0,0 +1,1044 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("boom"), exitFailure},
+		{client.ErrReadTimeout, exitTimeout},
+		{context.DeadlineExceeded, exitTimeout},
+		{client.ErrClientCertRejected, exitUnauthorized},
+		{&client.APIError{Code: client.CodeModelNotFound}, exitModelNotFound},
+		{&client.APIError{Status: 413}, exitPayloadTooLarge},
+		{client.ErrConnectionLost, exitConnection},
+		{client.ErrCircuitOpen, exitConnection},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, exitConnection},
+		{client.ErrTLSHandshake, exitConnection},
+		{&exec.Error{Name: "zaevrynth-server", Err: exec.ErrNotFound}, exitConnection},
+		{client.ErrProtocol, exitProtocol},
+		{&client.IncompatibleProtocolError{Client: []string{"2"}}, exitProtocol},
+		{&client.APIError{Status: 500}, exitAPI},
+	}
+	for _, tc := range cases {
+		err := fmt.Errorf("run: %w", tc.err)
+		if tc.err == nil {
+			err = nil
+		}
+		if got := exitCode(err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", err, got, tc.want)
+		}
+	}
+}
+
+func TestRunRejectsStrayArguments(t *testing.T) {
+	var stderr strings.Builder
+	if code := run(context.Background(), []string{"--transport", "http", "ping"}, io.Discard, &stderr); code != exitUsage {
+		t.Fatalf("expected exit %d, got %d (%s)", exitUsage, code, stderr.String())
+	}
+}
+
+func TestExitRecordFilters(t *testing.T) {
+	var stderr strings.Builder
+	if code := run(context.Background(), []string{"--record-sample", "mcp.embed=0"}, io.Discard, &stderr); code != exitUsage {
+		t.Fatalf("bad --record-sample: expected exit %d, got %d (%s)", exitUsage, code, stderr.String())
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session.json")
+	args := []string{"--transport", "stdio", "--command", exe + " " + serveFakeCommand, "--record-transcript", path, "--record-only", "mcp.ping", "--record-tombstones"}
+	if code := run(context.Background(), args, io.Discard, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if errs := transcript.Validate(path); errs != nil {
+		t.Fatalf("filtered transcript invalid: %v", errs)
+	}
+	got, err := transcript.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var directions []string
+	for _, e := range got.Messages {
+		directions = append(directions, e.Direction)
+	}
+	if want := "skipped request response skipped"; strings.Join(directions, " ") != want {
+		t.Fatalf("directions %q, want %q", directions, want)
+	}
+}
+
+func TestEmbedSubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "embed.json")
+	var stdout, stderr strings.Builder
+	args := []string{"embed", "--transport", "stdio", "--command", exe + " " + serveFakeCommand, "--record-transcript", path, "--output", "ndjson", "alpha", "beta"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("printed %d lines, want one per input:\n%s", len(lines), stdout.String())
+	}
+	for i, line := range lines {
+		var got struct {
+			Index  int       `json:"index"`
+			Vector []float32 `json:"vector"`
+		}
+		if err := json.Unmarshal([]byte(line), &got); err != nil || got.Index != i || len(got.Vector) != fakeDimension {
+			t.Fatalf("line %d: %s (%v)", i, line, err)
+		}
+	}
+	if errs := transcript.Validate(path); errs != nil {
+		t.Fatalf("embed transcript invalid: %v", errs)
+	}
+	recorded, err := transcript.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last client.Request
+	if err := json.Unmarshal(recorded.Messages[len(recorded.Messages)-2].Message, &last); err != nil || last.Method != client.MethodEmbed {
+		t.Fatalf("last request recorded is %q (%v), want the embed", last.Method, err)
+	}
+
+	// A dry run needs no server.
+	stdout.Reset()
+	if code := run(context.Background(), []string{"embed", "--dry-run", "--endpoint", "http://127.0.0.1:1/mcp", "--output", "ndjson", "alpha"}, &stdout, &stderr); code != exitOK || !strings.Contains(stdout.String(), `"method":"mcp.embed"`) {
+		t.Fatalf("embed --dry-run: exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"embed"}, exitUsage},
+		{[]string{"embed", "--output", "xml", "text"}, exitUsage},
+		{[]string{"ping", "--output", "csv", "--csv-vectors", "hex"}, exitUsage},
+		{[]string{"ping", "--transport", "stdio", "--endpoint", "https://localhost/mcp"}, exitFailure},
+		{[]string{"ping", "--endpoint", "stdio:" + exe + " " + serveFakeCommand}, exitOK},
+		{[]string{"benchmark", "--duration", "100ms", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, "alpha"}, exitOK},
+		{[]string{"benchmark", "--duration", "0s", "alpha"}, exitUsage},
+		{[]string{"benchmark"}, exitUsage},
+	} {
+		stderr.Reset()
+		if code := run(context.Background(), tc.args, io.Discard, &stderr); code != tc.want {
+			t.Errorf("%v: exit %d, want %d (%s)", tc.args, code, tc.want, stderr.String())
+		}
+	}
+}
+
+func TestEmbedParquetZstd(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.parquet")
+	if err := os.WriteFile(input, []byte("alpha\nbeta\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	args := []string{"embed", "--transport", "stdio", "--command", exe + " " + serveFakeCommand,
+		"--input-file", input, "--output", "parquet", "--output-file", output, "--parquet-compression", "zstd"}
+	if code := run(context.Background(), args, io.Discard, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := export.ReadParquet(bytes.NewReader(data), int64(len(data)), export.ParquetOptions{})
+	if err != nil {
+		t.Fatalf("ReadParquet: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d rows, want 2", len(rows))
+	}
+	for i, text := range []string{"alpha", "beta"} {
+		if rows[i].ID != fmt.Sprint(i) || rows[i].Model == "" || rows[i].TextHash != export.HashText(text) || len(rows[i].Vector) != fakeDimension {
+			t.Errorf("row %d: %+v", i, rows[i])
+		}
+	}
+}
+
+func TestChaosFlag(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chaos.json")
+	if err := os.WriteFile(path, []byte(`{"seed": 3, "faults": [{"kind": "error", "probability": 0.5, "class": "timeout", "methods": ["mcp.embed"]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr strings.Builder
+	args := []string{"benchmark", "--duration", "200ms", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, "--chaos", path, "alpha"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	var report client.BenchmarkReport
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil {
+		t.Fatalf("report %q: %v", stdout.String(), err)
+	}
+	if report.Errors == 0 || report.ErrorsByClass["timeout"] != report.Errors || report.FaultsInjected["error"] != report.Errors {
+		t.Fatalf("report %+v", report)
+	}
+	if !strings.Contains(stderr.String(), "chaos seed 3") {
+		t.Fatalf("stderr lacks the seed:\n%s", stderr.String())
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"faults": [{"kind": "flood", "probability": 1}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := run(context.Background(), []string{"ping", "--chaos", bad}, io.Discard, &stderr); code != exitUsage || !strings.Contains(stderr.String(), "chaos fault 0") {
+		t.Fatalf("bad chaos file: exit %d: %s", code, stderr.String())
+	}
+}
+
+func TestCompareModelsSubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "stdio:" + exe + " " + serveFakeCommand
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"compare-models", "--endpoint", endpoint, "--model-a", "m1", "--model-b", "m1", "alpha", "beta"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	var report client.ModelComparison
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil {
+		t.Fatalf("report %q: %v", stdout.String(), err)
+	}
+	if report.Compared != 2 || report.Similarity.Min < 0.9999 || len(report.Worst) != 2 || report.Worst[0].Text == "" {
+		t.Fatalf("one model against itself: %+v", report)
+	}
+
+	stdout.Reset()
+	args := []string{"compare-models", "--endpoint", endpoint, "--model-a", "m1", "--model-b", "m2", "--output", "ndjson", "alpha", "beta", "gamma"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[2], `"index":2`) {
+		t.Fatalf("ndjson:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "compare-models: m2 against m1: 3 inputs, 3 compared") {
+		t.Fatalf("stderr:\n%s", stderr.String())
+	}
+
+	for _, args := range [][]string{
+		{"compare-models", "--model-a", "m1", "alpha"},
+		{"compare-models", "--model-a", "m1", "--model-b", "m2"},
+		{"compare-models", "--model-a", "m1", "--model-b", "m2", "--worst", "-1", "alpha"},
+	} {
+		if code := run(context.Background(), args, io.Discard, io.Discard); code != exitUsage {
+			t.Errorf("%v: exit %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestReadySubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "stdio:" + exe + " " + serveFakeCommand
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"ready", "--endpoint", endpoint, "--min-models", "1"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	var report client.ReadyReport
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil || report.Attempts != 1 || report.Models != 1 {
+		t.Fatalf("report %q: %v", stdout.String(), err)
+	}
+
+	// A model the server never lists fails the wait with its class.
+	stderr.Reset()
+	args := []string{"ready", "--endpoint", endpoint, "--require-model", "missing", "--ready-timeout", "300ms", "--probe-interval", "20ms"}
+	if code := run(context.Background(), args, io.Discard, &stderr); code != exitModelNotFound {
+		t.Fatalf("exit %d, want %d: %s", code, exitModelNotFound, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "ready: probe 1 failed") || !strings.Contains(stderr.String(), "server not ready after") {
+		t.Fatalf("stderr:\n%s", stderr.String())
+	}
+	if code := run(context.Background(), []string{"ready", "--min-models", "-1"}, io.Discard, io.Discard); code != exitUsage {
+		t.Errorf("negative --min-models: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestAPIKeyFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer from-file" {
+			http.Error(w, "bad key", http.StatusUnauthorized)
+			return
+		}
+		defaultFake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(flagEnv("api-key"), "from-env")
+
+	var stderr strings.Builder
+	if code := run(context.Background(), []string{"ping", "--endpoint", srv.URL, "--api-key-file", path}, io.Discard, &stderr); code != exitOK {
+		t.Fatalf("--api-key-file: exit %d: %s", code, stderr.String())
+	}
+	stderr.Reset()
+	if code := run(context.Background(), []string{"ping", "--endpoint", srv.URL}, io.Discard, &stderr); code != exitUnauthorized || !strings.Contains(stderr.String(), "bad key") {
+		t.Fatalf("wrong key: exit %d, want %d with the server's message: %s", code, exitUnauthorized, stderr.String())
+	}
+	if code := run(context.Background(), []string{"ping", "--api-key", "k", "--api-key-file", path}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("both key flags: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestCacheSubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "embeddings.cache")
+	var stdout, stderr strings.Builder
+	for _, model := range []string{"alpha", "beta"} {
+		args := []string{"embed", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, "--cache-file", path, "--model", model, "one", "two"}
+		if code := run(context.Background(), args, io.Discard, &stderr); code != exitOK {
+			t.Fatalf("embed --cache-file: exit %d: %s", code, stderr.String())
+		}
+	}
+	if code := run(context.Background(), []string{"cache", "stats", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("stats: exit %d: %s", code, stderr.String())
+	}
+	if got := stdout.String(); !strings.Contains(got, ": 4 entries, ") || !strings.Contains(got, "  alpha: 2\n  beta: 2\n") {
+		t.Fatalf("stats:\n%s", got)
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{"cache", "purge", "--model", "alpha", path}, &stdout, &stderr); code != exitOK || stdout.String() != "purged 2 entries\n" {
+		t.Fatalf("purge: exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"cache", "stats", path}, &stdout, &stderr); code != exitOK || strings.Contains(stdout.String(), "alpha") {
+		t.Fatalf("stats after purge: exit %d: %s", code, stdout.String())
+	}
+	if code := run(context.Background(), []string{"cache", "purge", path}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("purge without --model or --all: exit %d, want %d", code, exitUsage)
+	}
+	if code := run(context.Background(), []string{"cache"}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("cache without a command: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestSpoolSubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "spool")
+	spool, err := client.OpenSpool(dir, client.SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on port 1.
+	c, err := client.NewClient("http://127.0.0.1:1/mcp", client.WithSpool(spool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.Embed(ctx, "alpha", client.WithSpoolOnFailure()); !errors.Is(err, client.ErrSpooled) {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, err := c.EmbedBatch(ctx, []string{"beta", "gamma"}, client.WithSpoolOnFailure(), client.WithModel("m2")); !errors.Is(err, client.ErrSpooled) {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	c.Close(ctx)
+
+	var stdout, stderr strings.Builder
+	if code := run(ctx, []string{"spool", "status", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("status: exit %d: %s", code, stderr.String())
+	}
+	if got := stdout.String(); !strings.Contains(got, ": 2 entries, ") || !strings.Contains(got, "  m2: 1\n") {
+		t.Fatalf("status:\n%s", got)
+	}
+	stdout.Reset()
+	if code := run(ctx, []string{"spool", "drain", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("drain: exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "drained 2 spooled entries, 0 failed, 0 left") {
+		t.Fatalf("drain summary: %s", stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"spool_id":1,`) || !strings.Contains(lines[1], `"inputs":["beta","gamma"],"vectors":[[`) {
+		t.Fatalf("drain output:\n%s", stdout.String())
+	}
+	stdout.Reset()
+	if code := run(ctx, []string{"spool", "status", dir}, &stdout, &stderr); code != exitOK || !strings.Contains(stdout.String(), ": 0 entries, 0 bytes\n") {
+		t.Fatalf("status after drain: exit %d: %s", code, stdout.String())
+	}
+	for _, args := range [][]string{{"spool"}, {"spool", "drain"}, {"spool", "status"}} {
+		if code := run(ctx, args, io.Discard, io.Discard); code != exitUsage {
+			t.Fatalf("%v: exit %d, want %d", args, code, exitUsage)
+		}
+	}
+	if code := run(ctx, []string{"spool", "status", filepath.Join(dir, "missing")}, io.Discard, io.Discard); code != exitFailure {
+		t.Fatalf("status of a missing directory: exit %d, want %d", code, exitFailure)
+	}
+}
+
+func TestVersionSubcommand(t *testing.T) {
+	var stdout strings.Builder
+	if code := run(context.Background(), []string{"version", "--output", "json"}, &stdout, io.Discard); code != exitOK {
+		t.Fatalf("version --output json: exit %d", code)
+	}
+	var got client.BuildInfo
+	if err := json.Unmarshal([]byte(stdout.String()), &got); err != nil || !reflect.DeepEqual(got, client.Build()) {
+		t.Fatalf("version --output json = %s (%v)", stdout.String(), err)
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"--version"}, &stdout, io.Discard); code != exitOK || !strings.HasPrefix(stdout.String(), client.ClientName+" "+client.ClientVersion+"\n") || !strings.Contains(stdout.String(), "protocol versions:  2, 1\n") {
+		t.Fatalf("--version: exit %d:\n%s", code, stdout.String())
+	}
+	if code := run(context.Background(), []string{"version", "--output", "yaml"}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("version --output yaml: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestAuditLogSubcommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var stdout, stderr strings.Builder
+	args := []string{"embed", "--endpoint", "stdio:" + exe + " " + serveFakeCommand, "--audit-log", path, "--audit-log-sync", "alpha"}
+	if code := run(context.Background(), args, io.Discard, &stderr); code != exitOK {
+		t.Fatalf("embed --audit-log: exit %d: %s", code, stderr.String())
+	}
+	if code := run(context.Background(), []string{"auditlog", "verify", path}, &stdout, &stderr); code != exitOK || !strings.HasPrefix(stdout.String(), "ok: ") {
+		t.Fatalf("verify: exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "alpha") || !strings.Contains(string(data), `"method":"mcp.embed"`) {
+		t.Fatalf("audit log:\n%s", data)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), `"status":"ok"`, `"status":"api"`, 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code := run(context.Background(), []string{"auditlog", "verify", path}, io.Discard, io.Discard); code != exitMismatch {
+		t.Fatalf("verify of an edited log: exit %d, want %d", code, exitMismatch)
+	}
+	if code := run(context.Background(), []string{"auditlog"}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("auditlog without a command: exit %d, want %d", code, exitUsage)
+	}
+}
+
+func TestConfigValidateSubcommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	doc := "transport: http\nendpoint: http://file.example/mcp\nmodel: from-file\ntls-ca: [a.pem, b.pem]\nrequest-timout: 5s\n"
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(flagEnv("model"), "from-env")
+	t.Setenv(flagEnv("endpoint"), "http://env.example/mcp")
+	t.Setenv("EMBEDNEXUS_API_KEY", "s3cr3t")
+	t.Setenv("EMBEDNEXUS_TIMEOUT", "7s")
+	var stdout, stderr strings.Builder
+	args := []string{"config", "validate", "--config", path, "--endpoint", "http://flag.example/mcp"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{
+		`endpoint: "http://flag.example/mcp" # flag`,
+		"model: from-env # env EMBEDNEXUS_MODEL",
+		"transport: http # " + path + ":1",
+		"tls-ca: [a.pem, b.pem] # " + path + ":4",
+		`api-key: "[REDACTED]" # env EMBEDNEXUS_API_KEY`,
+		"request-timeout: 7s # env EMBEDNEXUS_TIMEOUT",
+		"dial-timeout: 0s # default",
+	} {
+		if !strings.Contains(stdout.String(), want+"\n") {
+			t.Errorf("effective configuration lacks %q:\n%s", want, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), "s3cr3t") {
+		t.Errorf("effective configuration shows the api key:\n%s", stdout.String())
+	}
+	if want := path + `:5: unknown key "request-timout" (did you mean "request-timeout"?)`; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr lacks the unknown key warning: %s", stderr.String())
+	}
+
+	if err := os.WriteFile(path, []byte("dial-timeout: soon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := run(context.Background(), []string{"config", "validate", "--config", path}, io.Discard, &stderr); code != exitUsage || !strings.Contains(stderr.String(), path+":1: dial-timeout") {
+		t.Fatalf("bad value: exit %d: %s", code, stderr.String())
+	}
+	if code := run(context.Background(), []string{"config", "validate", "--config", path + ".missing"}, io.Discard, &stderr); code != exitUsage {
+		t.Fatalf("missing config file: exit %d", code)
+	}
+}
+
+func TestValidateFixturesSubcommand(t *testing.T) {
+	dir := t.TempDir()
+	valid := `{"client":"go","transport":"http","messages":[]}`
+	if err := os.WriteFile(filepath.Join(dir, "good.json"), []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"validate-fixtures", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("valid fixtures: exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"transport":"http","messages":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"validate-fixtures", dir}, &stdout, &stderr); code != exitFailure {
+		t.Fatalf("invalid fixture: exit %d", code)
+	}
+	if !strings.Contains(stdout.String(), `bad.json: field "client" missing (/client)`) {
+		t.Fatalf("unexpected report: %s", stdout.String())
+	}
+}
+
+func TestNormalizeRecorded(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(rules, []byte(`{"rules":[{"pointer":"/messages/*/message/meta/timestamp","placeholder":"<timestamp>"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "http.json")
+	doc := `{"client":"go","transport":"http","messages":[{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2026-10-14T08:00:00Z"}}}]}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := normalizeRecorded(rules, path, ""); err != nil {
+		t.Fatalf("normalizeRecorded: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"timestamp": "<timestamp>"`) {
+		t.Fatalf("timestamp not normalized:\n%s", content)
+	}
+	if err := normalizeRecorded(filepath.Join(dir, "missing.json"), path); err == nil {
+		t.Fatal("missing explicit rules file accepted")
+	}
+}
+
+func TestTranscriptConvert(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "http.json")
+	doc := `{"client":"go","transport":"http","messages":[{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2026-10-14T08:00:00Z"}}}]}`
+	if err := os.WriteFile(in, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr strings.Builder
+	jsonl := filepath.Join(dir, "http.jsonl")
+	if code := run(context.Background(), []string{"transcript", "convert", in, jsonl}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("convert to jsonl: exit %d: %s", code, stderr.String())
+	}
+	content, err := os.ReadFile(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Fatalf("got %d lines:\n%s", lines, content)
+	}
+	back := filepath.Join(dir, "back.out")
+	if code := run(context.Background(), []string{"transcript", "convert", "--format", "json", jsonl, back}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("convert to json: exit %d: %s", code, stderr.String())
+	}
+	if errs := transcript.Validate(back); errs != nil {
+		t.Fatalf("converted transcript invalid: %v", errs)
+	}
+	if code := run(context.Background(), []string{"transcript", "convert", in}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("convert without output: exit %d", code)
+	}
+}
+
+func TestTranscriptScrub(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "http.jsonl")
+	doc := `{"transcript_version":2,"client":"go","transport":"http"}
+{"direction":"request","message":{"id":1,"jsonrpc":"2.0","method":"mcp.embed","params":{"api_key":"sk-1","inputs":["customer text"],"model":"small"}}}
+`
+	if err := os.WriteFile(in, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules := filepath.Join(dir, "scrub.yaml")
+	if err := os.WriteFile(rules, []byte("redact: [/messages/*/message/params/inputs]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "clean.jsonl")
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"transcript", "scrub", in, "--rules", rules, "--out", out}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("scrub: exit %d: %s", code, stderr.String())
+	}
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "sk-1") || strings.Contains(string(content), "customer text") || strings.Count(string(content), "\n") != 2 {
+		t.Fatalf("scrubbed transcript:\n%s", content)
+	}
+	if !strings.Contains(stdout.String(), "1 of 1 messages changed") || !regexp.MustCompile(`(?m)^api_key +1$`).MatchString(stdout.String()) || !regexp.MustCompile(`(?m)^/messages/\*/message/params/inputs +1$`).MatchString(stdout.String()) {
+		t.Fatalf("report:\n%s", stdout.String())
+	}
+
+	if code := run(context.Background(), []string{"transcript", "scrub", in, "--out", in}, &stdout, &stderr); code != exitUsage || !strings.Contains(stderr.String(), "pass --in-place") {
+		t.Fatalf("scrub over the input: exit %d: %s", code, stderr.String())
+	}
+	for _, args := range [][]string{
+		{in},
+		{in, "--in-place", "--out", out},
+		{in, "--out", out, "--output", "yaml"},
+	} {
+		stderr.Reset()
+		if code := run(context.Background(), append([]string{"transcript", "scrub"}, args...), &stdout, &stderr); code != exitUsage {
+			t.Errorf("scrub %q: exit %d", args, code)
+		}
+	}
+	if original, _ := os.ReadFile(in); string(original) != doc {
+		t.Fatal("the input was overwritten")
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{"transcript", "scrub", "--in-place", "--output", "json", in}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("scrub --in-place: exit %d: %s", code, stderr.String())
+	}
+	var report transcript.ScrubReport
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil || report.Changed != 1 || report.Messages != 1 {
+		t.Fatalf("report %s: %v", stdout.String(), err)
+	}
+	if original, _ := os.ReadFile(in); strings.Contains(string(original), "sk-1") {
+		t.Fatalf("not scrubbed in place:\n%s", original)
+	}
+}
+
+func TestTranscriptGenTests(t *testing.T) {
+	// The committed cases are those of the repository's fixtures, and
+	// regenerating them changes nothing.
+	out := filepath.Join(t.TempDir(), "compat_test.go")
+	var stdout, stderr strings.Builder
+	args := []string{"transcript", "gen-tests", "--in", filepath.Join("..", "..", "tests", "fixtures", "go"), "--out", out, "--package", "main"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("gen-tests: exit %d: %s", code, stderr.String())
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("generated_compat_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, committed) {
+		t.Fatal("generated_compat_test.go is stale; run: go run . transcript gen-tests --in ../../tests/fixtures/go --out generated_compat_test.go")
+	}
+
+	// Without --package the test joins the package beside it.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.go"), []byte("package compat\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out = filepath.Join(dir, "compat_test.go")
+	if code := run(context.Background(), []string{"transcript", "gen-tests", "--in", filepath.Join("transcript", "testdata", "v1"), "--out", out}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("gen-tests: exit %d: %s", code, stderr.String())
+	}
+	if got, err := os.ReadFile(out); err != nil || !bytes.Contains(got, []byte("\npackage compat\n")) {
+		t.Fatalf("generated %s, %v", got, err)
+	}
+	if code := run(context.Background(), []string{"transcript", "gen-tests", "--out", out}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("gen-tests without --in: exit %d", code)
+	}
+}
+
+func TestTranscriptCrosscheck(t *testing.T) {
+	dir := t.TempDir()
+	write := func(lang, params string) {
+		t.Helper()
+		path := filepath.Join(dir, lang, "http", "request.json")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		doc := `[{"jsonrpc":"2.0","id":1,"method":"mcp.embed","params":` + params + `}]`
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go", `{"input_text":"a"}`)
+	write("python", `{"input_text":"b"}`)
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"transcript", "crosscheck", "--fixtures", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("matching clients: exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	write("python", `{"inputText":"b"}`)
+	stdout.Reset()
+	if code := run(context.Background(), []string{"transcript", "crosscheck", "--fixtures", dir, "http"}, &stdout, &stderr); code != exitMismatch {
+		t.Fatalf("drifting clients: exit %d", code)
+	}
+	if want := `http: go vs python: mcp.embed request 1: /params/input_text: sent by go as "input_text", by python as "inputText"`; !strings.Contains(stdout.String(), want) {
+		t.Fatalf("unexpected report: %s", stdout.String())
+	}
+	// With --strict a response field the Go client does not know is drift
+	// too.
+	write("python", `{"input_text":"b"}`)
+	response := `[{"jsonrpc":"2.0","id":1,"result":{"model":"m","embeddings":[],"norms":[]}}]`
+	if err := os.WriteFile(filepath.Join(dir, "python", "http", "response.json"), []byte(response), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run(context.Background(), []string{"transcript", "crosscheck", "--fixtures", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("lenient: exit %d", code)
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"transcript", "crosscheck", "--strict", "--fixtures", dir}, &stdout, &stderr); code != exitMismatch {
+		t.Fatalf("strict: exit %d", code)
+	}
+	if want := "http: python: mcp.embed request 1: /result/norms: response field not in the Go client's schema\n"; stdout.String() != want {
+		t.Fatalf("unexpected strict report: %s", stdout.String())
+	}
+}
+
+func TestTranscriptStats(t *testing.T) {
+	timed := filepath.Join("transcript", "testdata", "timed.json")
+	var stdout, stderr strings.Builder
+	if code := run(context.Background(), []string{"transcript", "stats", timed}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("stats: exit %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "method") {
+		t.Fatalf("unexpected table:\n%s", stdout.String())
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "mcp.embed 3 1 9.5ms 5000.0ms 5000.0ms" {
+		t.Fatalf("unexpected row: %q", lines[2])
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"transcript", "stats", "--json", timed}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("stats --json: exit %d: %s", code, stderr.String())
+	}
+	var stats []transcript.MethodStats
+	if err := json.Unmarshal([]byte(stdout.String()), &stats); err != nil || len(stats) != 2 {
+		t.Fatalf("stats --json = %s (%v)", stdout.String(), err)
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{"transcript", "stats", "--output", "csv", "--csv-columns", "method,calls", timed}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("stats --output csv: exit %d: %s", code, stderr.String())
+	}
+	rows, err := csv.NewReader(strings.NewReader(stdout.String())).ReadAll()
+	if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != "method,calls" || strings.Join(rows[2], ",") != "mcp.embed,3" {
+		t.Fatalf("stats --output csv = %q (%v)", rows, err)
+	}
+	if code := run(context.Background(), []string{"transcript", "stats"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("stats without a transcript: exit %d", code)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := []string{"--transport", "stdio", "--command", exe + " " + serveFakeCommand}
+	cli := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr strings.Builder
+		if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+			t.Fatalf("%v: exit %d: %s", args, code, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(cli(append(append([]string{"embed"}, server...), "--output", "csv", "a", "b")...))).ReadAll()
+	if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != "index,vector" || len(strings.Split(rows[1][1], ";")) != fakeDimension {
+		t.Fatalf("embed --output csv = %q (%v)", rows, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(cli(append([]string{"models"}, append(server, "--output", "ndjson")...)...)), "\n")
+	var model client.ModelInfo
+	if err := json.Unmarshal([]byte(lines[0]), &model); err != nil || len(lines) != 1 || model.Dimension != fakeDimension {
+		t.Fatalf("models --output ndjson = %q (%v)", lines, err)
+	}
+	var models []client.ModelInfo
+	if out := cli(append([]string{"models"}, server...)...); json.Unmarshal([]byte(out), &models) != nil || len(models) != 1 {
+		t.Fatalf("models = %s", out)
+	}
+
+	rows, err = csv.NewReader(strings.NewReader(cli(append([]string{"ping"}, append(server, "--output", "csv", "--csv-columns", "ok")...)...))).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][0] != "true" {
+		t.Fatalf("ping --output csv = %q (%v)", rows, err)
+	}
+}
+
+func TestTranscriptDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, dimension string, build ...string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		doc := `{"transcript_version":2,"client":"go","client_build":"` + strings.Join(build, "") + `","transport":"http","messages":[{"direction":"response","message":{"jsonrpc":"2.0","id":1,"result":{"dimension":` + dimension + `}},"duration_ms":3}]}`
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, actual := filepath.Join(dir, "expected"), filepath.Join(dir, "actual")
+	write(filepath.Join(expected, "go", "http.json"), "384")
+	write(filepath.Join(actual, "go", "http.json"), "384")
+	rules := filepath.Join("..", "..", "tests", "fixtures", transcript.NormalizeRulesFile)
+	diff := func(args ...string) (int, string) {
+		var stdout, stderr strings.Builder
+		code := run(context.Background(), append([]string{"transcript", "diff", "--normalize-rules", rules}, args...), &stdout, &stderr)
+		return code, stdout.String()
+	}
+	if code, out := diff(filepath.Join(expected, "go", "http.json"), filepath.Join(actual, "go", "http.json")); code != exitOK || out != "" {
+		t.Fatalf("equal files: exit %d: %s", code, out)
+	}
+
+	// Different builds alone are no difference, but lead the report of one.
+	builds := filepath.Join(dir, "builds")
+	write(filepath.Join(builds, "old.json"), "384", "zaevrynth-go-client/0.1.0 (1a2b3c4d5e6f)")
+	write(filepath.Join(builds, "new.json"), "384", "zaevrynth-go-client/0.2.0 (6f5e4d3c2b1a)")
+	write(filepath.Join(builds, "changed.json"), "768", "zaevrynth-go-client/0.2.0 (6f5e4d3c2b1a)")
+	if code, out := diff(filepath.Join(builds, "old.json"), filepath.Join(builds, "new.json")); code != exitOK || out != "" {
+		t.Fatalf("different builds: exit %d: %s", code, out)
+	}
+	note := "recorded by different client builds: expected zaevrynth-go-client/0.1.0 (1a2b3c4d5e6f), actual zaevrynth-go-client/0.2.0 (6f5e4d3c2b1a)\n--- expected\n"
+	if code, out := diff(filepath.Join(builds, "old.json"), filepath.Join(builds, "changed.json")); code != exitMismatch || !strings.HasPrefix(out, note) {
+		t.Fatalf("different builds and results: exit %d:\n%s", code, out)
+	}
+	var single transcript.Report
+	if _, out := diff("--format", "json", filepath.Join(builds, "old.json"), filepath.Join(builds, "changed.json")); json.Unmarshal([]byte(out), &single) != nil || len(single.ClientBuilds) != 2 || len(single.Differences) != 1 {
+		t.Fatalf("json report of different builds:\n%s", out)
+	}
+
+	// The trace of a message that differs leads its report too.
+	traced := filepath.Join(builds, "traced.json")
+	doc := `{"transcript_version":2,"client":"go","transport":"http","messages":[{"direction":"response","message":{"jsonrpc":"2.0","id":1,"result":{"dimension":384}},"trace":{"trace_id":"0af7651916cd43dd8448eb211c80319c","span_id":"b7ad6b7169203331","request_id":"01J0","server_request_id":"srv-1"}}]}`
+	if err := os.WriteFile(traced, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := diff(filepath.Join(builds, "old.json"), traced); code != exitOK || out != "" {
+		t.Fatalf("traced alone: exit %d: %s", code, out)
+	}
+	trace := "/messages/0: expected trace 0af7651916cd43dd8448eb211c80319c span b7ad6b7169203331 request 01J0 server request srv-1; actual untraced\n--- expected\n"
+	if code, out := diff(traced, filepath.Join(builds, "changed.json")); code != exitMismatch || !strings.HasPrefix(out, trace) {
+		t.Fatalf("traced and different: exit %d:\n%s", code, out)
+	}
+	if _, out := diff("--format", "json", traced, filepath.Join(builds, "changed.json")); json.Unmarshal([]byte(out), &single) != nil || len(single.Traces) != 1 || single.Traces[0].Expected.ServerRequestID != "srv-1" {
+		t.Fatalf("json report of a traced difference:\n%s", out)
+	}
+
+	write(filepath.Join(actual, "go", "http.json"), "768")
+	write(filepath.Join(actual, "go", "tls.json"), "384")
+	code, out := diff(expected, actual)
+	if code != exitMismatch || !strings.Contains(out, "diff go/http.json\n") || !strings.Contains(out, "@@ /messages/0/message/result/dimension (changed) @@") || !strings.Contains(out, "only in actual: go/tls.json") {
+		t.Fatalf("differing directories: exit %d:\n%s", code, out)
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Fatalf("colored output to a non-terminal:\n%s", out)
+	}
+	if _, out := diff("--color", "always", expected, actual); !strings.Contains(out, "\x1b[31m-384") {
+		t.Fatalf("--color always:\n%s", out)
+	}
+	code, out = diff("--format", "json", expected, actual)
+	var report struct {
+		Equal bool `json:"equal"`
+		Files []struct {
+			Path   string `json:"path"`
+			OnlyIn string `json:"only_in"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil || code != exitMismatch || report.Equal || len(report.Files) != 2 || report.Files[1].OnlyIn != "actual" {
+		t.Fatalf("json report: exit %d, %v:\n%s", code, err, out)
+	}
+
+	if code, out := diff("--update", expected, actual); code != exitOK {
+		t.Fatalf("--update: exit %d:\n%s", code, out)
+	}
+	if code, out := diff(expected, actual); code != exitOK {
+		t.Fatalf("after --update: exit %d:\n%s", code, out)
+	}
+	updated, err := os.ReadFile(filepath.Join(expected, "go", "tls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(updated), "duration_ms") {
+		t.Fatalf("--update kept timings:\n%s", updated)
+	}
+	if code, _ := diff(expected, filepath.Join(actual, "go", "http.json")); code != exitUsage {
+		t.Fatalf("directory against file: exit %d", code)
+	}
+}
+
+func TestTranscriptMerge(t *testing.T) {
+	dir := t.TempDir()
+	artifacts := filepath.Join(dir, "artifacts", "go")
+	write := func(path, transport, dimension string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		doc := `{"transcript_version":2,"client":"go","transport":"` + transport + `","messages":[` +
+			`{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.embed","meta":{"timestamp":"2026-10-14T08:00:00Z","sequence":1}},"sent_at":"2026-10-14T08:00:00Z"},` +
+			`{"direction":"response","message":{"jsonrpc":"2.0","id":1,"result":{"dimension":` + dimension + `}},"sent_at":"2026-10-14T08:00:00Z","received_at":"2026-10-14T08:00:00.004Z","duration_ms":4}]}`
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(artifacts, "http.json"), "http", "384")
+	write(filepath.Join(artifacts, "stdio.json"), "stdio", "384")
+	suitePath := filepath.Join(artifacts, "suite.json")
+	cli := func(args ...string) (int, string, string) {
+		var stdout, stderr strings.Builder
+		code := run(context.Background(), append([]string{"transcript"}, args...), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+	merge := func() {
+		t.Helper()
+		if code, _, stderr := cli("merge", "--commit", "abc123", suitePath, artifacts); code != exitOK {
+			t.Fatalf("merge: exit %d: %s", code, stderr)
+		}
+	}
+	merge()
+	// Merging again skips the suite itself.
+	merge()
+	suite, err := transcript.LoadSuite(suitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(suite.SectionNames(), " "); got != "go/http go/stdio" {
+		t.Fatalf("sections %q", got)
+	}
+	src := suite.Manifest.Sources[0]
+	if suite.Manifest.Commit != "abc123" || suite.Manifest.MergedAt == "" || src.Transport != "http" || src.Messages != 2 || src.StartedAt != "2026-10-14T08:00:00Z" || src.EndedAt != "2026-10-14T08:00:00.004Z" {
+		t.Fatalf("manifest %+v", suite.Manifest)
+	}
+
+	code, out, _ := cli("stats", suitePath)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); code != exitOK || len(lines) != 3 || !strings.HasPrefix(lines[0], "section") || !strings.HasPrefix(lines[2], "go/stdio") {
+		t.Fatalf("suite stats: exit %d:\n%s", code, out)
+	}
+	code, out, _ = cli("stats", "--json", "--section", "go/http", suitePath)
+	var stats []transcript.MethodStats
+	if err := json.Unmarshal([]byte(out), &stats); err != nil || code != exitOK || len(stats) != 1 || stats[0].Calls != 1 {
+		t.Fatalf("section stats: exit %d: %s", code, out)
+	}
+	if code, _, stderr := cli("stats", "--section", "go/ws", suitePath); code != exitFailure || !strings.Contains(stderr, "sections: go/http, go/stdio") {
+		t.Fatalf("missing section: exit %d: %s", code, stderr)
+	}
+
+	rules := filepath.Join("..", "..", "tests", "fixtures", transcript.NormalizeRulesFile)
+	changed := filepath.Join(dir, "changed")
+	write(filepath.Join(changed, "http.json"), "http", "768")
+	write(filepath.Join(changed, "tls.json"), "tls", "384")
+	other := filepath.Join(dir, "other.json")
+	if code, _, stderr := cli("merge", other, changed); code != exitOK {
+		t.Fatalf("merge: exit %d: %s", code, stderr)
+	}
+	if code, out, _ := cli("diff", "--normalize-rules", rules, suitePath, suitePath); code != exitOK || out != "" {
+		t.Fatalf("equal suites: exit %d:\n%s", code, out)
+	}
+	code, out, _ = cli("diff", "--normalize-rules", rules, suitePath, other)
+	if code != exitMismatch || !strings.Contains(out, "diff go/http\n") || !strings.Contains(out, "only in expected: go/stdio") || !strings.Contains(out, "only in actual: go/tls") {
+		t.Fatalf("differing suites: exit %d:\n%s", code, out)
+	}
+	if code, out, _ := cli("diff", "--normalize-rules", rules, "--section", "go/http", suitePath, filepath.Join(artifacts, "http.json")); code != exitOK {
+		t.Fatalf("section against its transcript: exit %d:\n%s", code, out)
+	}
+	if code, _, _ := cli("diff", "--normalize-rules", rules, suitePath, filepath.Join(artifacts, "http.json")); code != exitUsage {
+		t.Fatalf("suite against transcript without --section: exit %d", code)
+	}
+	if code, _, stderr := cli("diff", "--normalize-rules", rules, "--update", suitePath, other); code != exitFailure || !strings.Contains(stderr, "cannot update suite") {
+		t.Fatalf("--update on a suite: exit %d: %s", code, stderr)
+	}
+}
+
+// TestExitCodesAgainstFaultyServer runs the CLI as a subprocess against a
+// fake server injecting each class of failure and checks the exit code and
+// the message scripts would see.
+func TestExitCodesAgainstFaultyServer(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + ln.Addr().String() + "/mcp"
+	ln.Close()
+	fault := func(name string) []string {
+		return []string{"--transport", "stdio", "--command", exe + " " + serveFakeCommand + " " + name}
+	}
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		want   int
+		stderr string
+	}{
+		{"usage", []string{"--no-such-flag"}, exitUsage, "flag provided but not defined"},
+		{"unauthorized", fault(faultUnauthorized), exitUnauthorized, "unauthorized (injected)"},
+		{"model not found", fault(faultModelNotFound), exitModelNotFound, "model-not-found (injected)"},
+		{"payload too large", fault(faultTooLarge), exitPayloadTooLarge, "too-large (injected)"},
+		{"server error", fault(faultServerError), exitAPI, "rpc error -32603"},
+		{"protocol", fault(faultGarbage), exitProtocol, "protocol violation"},
+		{"timeout", append(fault(faultHang), "--request-timeout", "300ms"), exitTimeout, "timeout"},
+		{"server exits", fault(faultExit), exitConnection, "connection lost"},
+		{"refused", []string{"--endpoint", closed}, exitConnection, "connection refused"},
+		{"no server command", []string{"--transport", "stdio", "--command", "embednexus-no-such-server"}, exitConnection, "executable file not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, exe, append([]string{"embed"}, append(tc.args, "text")...)...)
+			cmd.Env = append(os.Environ(), cliProcessEnv+"=1")
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("run: %v\n%s", err, stderr.String())
+			}
+			if code := exitErr.ExitCode(); code != tc.want || !strings.Contains(stderr.String(), tc.stderr) {
+				t.Fatalf("exit %d, want %d with %q in stderr:\n%s", code, tc.want, tc.stderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,594 @@
+// Package export writes embeddings for data lakes as Apache Parquet files,
+// a row per embedding with its identifier, the hash of its text, its model,
+// and its dimension, and reads those files back.
+//
+// The files are written by hand: PLAIN-encoded data pages, RLE levels,
+// and the Thrift compact metadata of the Parquet format, uncompressed or
+// compressed with gzip or, through github.com/klauspost/compress, zstd.
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EmbeddingRow is a row of a Parquet file of embeddings.
+type EmbeddingRow struct {
+	// ID identifies the input, such as its line number or a document key.
+	ID string
+	// TextHash is the SHA-256 of the embedded text; see HashText.
+	TextHash [sha256.Size]byte
+	// Model names the model that produced Vector.
+	Model  string
+	Vector []float32
+}
+
+// HashText returns the TextHash of text.
+func HashText(text string) [sha256.Size]byte { return sha256.Sum256([]byte(text)) }
+
+// Encodings of the embedding column, the values of
+// ParquetOptions.Embedding.
+const (
+	// EmbeddingList writes each vector as a list<float>, the default.
+	// Vectors may differ in length.
+	EmbeddingList = "list"
+	// EmbeddingBinary writes each vector as a fixed_len_byte_array of its
+	// little-endian float32s, which readers take as they are but which
+	// needs every vector of the file to have the same length.
+	EmbeddingBinary = "binary"
+)
+
+// Compressions of ParquetOptions.Compression.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultRowGroupSize is the number of rows of a row group unless
+// ParquetOptions.RowGroupSize says otherwise.
+const DefaultRowGroupSize = 4096
+
+// parquetPageSize is about how large a data page grows before the next
+// row starts another.
+const parquetPageSize = 1 << 20
+
+// ParquetOptions configures WriteParquet and ParquetWriter.
+type ParquetOptions struct {
+	// RowGroupSize is the number of rows of each row group but the last,
+	// DefaultRowGroupSize when zero. A writer holds a row group's rows
+	// until it is written.
+	RowGroupSize int
+	// Embedding is EmbeddingList, the default, or EmbeddingBinary.
+	Embedding string
+	// Compression is CompressionNone, the default, CompressionGzip, or
+	// CompressionZstd.
+	Compression string
+	// ZstdEncoder, when set, appends src compressed with zstd to dst in
+	// place of the built-in encoder, as the EncodeAll method of a
+	// github.com/klauspost/compress/zstd Encoder of other options does.
+	ZstdEncoder func(src, dst []byte) []byte
+	// ZstdDecoder, when set, appends src decompressed to dst in place of
+	// the built-in decoder, for ReadParquet.
+	ZstdDecoder func(src, dst []byte) ([]byte, error)
+	// CreatedBy names the writer in the file's metadata.
+	CreatedBy string
+}
+
+// Validate reports an unknown encoding or compression.
+func (o ParquetOptions) Validate() error {
+	switch o.Embedding {
+	case "", EmbeddingList, EmbeddingBinary:
+	default:
+		return fmt.Errorf("parquet embedding %q: want %s or %s", o.Embedding, EmbeddingList, EmbeddingBinary)
+	}
+	switch o.Compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("parquet compression %q: want %s, %s, or %s", o.Compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+	if o.RowGroupSize < 0 {
+		return errors.New("parquet row group size must not be negative")
+	}
+	return nil
+}
+
+// Enumerations of the Parquet format.
+const (
+	parquetInt32             = 1
+	parquetFloat             = 4
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+
+	parquetRequired = 0
+	parquetRepeated = 2
+
+	parquetUTF8 = 0
+	parquetList = 3
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+	parquetZstd         = 6
+
+	parquetDataPage = 0
+)
+
+const parquetMagic = "PAR1"
+
+// The leaf columns of a file, in schema order.
+const (
+	columnID = iota
+	columnTextHash
+	columnModel
+	columnDimension
+	columnEmbedding
+	parquetColumns
+)
+
+// columnChunk is where a column's pages in a row group are, and what they
+// hold.
+type columnChunk struct {
+	offset       int64
+	values       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type rowGroup struct {
+	rows    int64
+	columns [parquetColumns]columnChunk
+}
+
+// ParquetWriter streams rows into a Parquet file a row group at a time.
+// The metadata that makes the file readable is written by Close.
+type ParquetWriter struct {
+	w      io.Writer
+	opts   ParquetOptions
+	off    int64
+	rows   []EmbeddingRow
+	groups []rowGroup
+	// dim is the length of the vectors of an EmbeddingBinary file, set by
+	// the first row; -1 until then.
+	dim int
+	// page and packed are the scratch space of a page, before and after
+	// compression.
+	page, packed []byte
+}
+
+// NewParquetWriter returns a ParquetWriter writing to w.
+func NewParquetWriter(w io.Writer, opts ParquetOptions) (*ParquetWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Embedding == "" {
+		opts.Embedding = EmbeddingList
+	}
+	if opts.RowGroupSize == 0 {
+		opts.RowGroupSize = DefaultRowGroupSize
+	}
+	return &ParquetWriter{w: w, opts: opts, dim: -1}, nil
+}
+
+func (pw *ParquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.off += int64(n)
+	return err
+}
+
+// Write adds rows to the file, writing each row group as it fills. The
+// rows, vectors included, are held until their row group is written, so
+// the caller must leave them alone until then, at the latest Close.
+func (pw *ParquetWriter) Write(rows []EmbeddingRow) error {
+	if pw.off == 0 {
+		if err := pw.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if pw.opts.Embedding == EmbeddingBinary {
+			if pw.dim < 0 {
+				pw.dim = len(row.Vector)
+			}
+			if len(row.Vector) != pw.dim {
+				return fmt.Errorf("parquet: row %s has %d dimensions, want %d", row.ID, len(row.Vector), pw.dim)
+			}
+		}
+		pw.rows = append(pw.rows, row)
+		if len(pw.rows) == pw.opts.RowGroupSize {
+			if err := pw.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the rows held as a row group.
+func (pw *ParquetWriter) flush() error {
+	if len(pw.rows) == 0 {
+		return nil
+	}
+	g := rowGroup{rows: int64(len(pw.rows))}
+	for col := 0; col < parquetColumns; col++ {
+		chunk := &g.columns[col]
+		chunk.offset = pw.off
+		for start := 0; start < len(pw.rows); {
+			end, size := start, 0
+			for end < len(pw.rows) && (end == start || size < parquetPageSize) {
+				size += rowSize(col, &pw.rows[end])
+				end++
+			}
+			if err := pw.writePage(col, pw.rows[start:end], chunk); err != nil {
+				return err
+			}
+			start = end
+		}
+	}
+	pw.groups = append(pw.groups, g)
+	clear(pw.rows)
+	pw.rows = pw.rows[:0]
+	return nil
+}
+
+// rowSize is about how many bytes a row takes in a column's page.
+func rowSize(col int, row *EmbeddingRow) int {
+	switch col {
+	case columnID:
+		return 4 + len(row.ID)
+	case columnTextHash:
+		return sha256.Size
+	case columnModel:
+		return 4 + len(row.Model)
+	case columnDimension:
+		return 4
+	}
+	return 4 * len(row.Vector)
+}
+
+// writePage writes a data page of a column of rows.
+func (pw *ParquetWriter) writePage(col int, rows []EmbeddingRow, chunk *columnChunk) error {
+	values, page := pw.encode(col, rows, pw.page[:0])
+	pw.page = page
+	packed, err := pw.compress(page)
+	if err != nil {
+		return err
+	}
+	t := newThriftWriter()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(len(page)))
+	t.i32(3, int32(len(packed)))
+	t.structField(5, func() {
+		t.i32(1, int32(values))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+	})
+	header := t.end()
+	if err := pw.write(header); err != nil {
+		return err
+	}
+	if err := pw.write(packed); err != nil {
+		return err
+	}
+	chunk.values += int64(values)
+	chunk.uncompressed += int64(len(header) + len(page))
+	chunk.compressed += int64(len(header) + len(packed))
+	return nil
+}
+
+// encode appends the page of a column of rows to page, returning the
+// number of values it holds, levels included.
+func (pw *ParquetWriter) encode(col int, rows []EmbeddingRow, page []byte) (int, []byte) {
+	switch col {
+	case columnID, columnModel:
+		for i := range rows {
+			s := rows[i].ID
+			if col == columnModel {
+				s = rows[i].Model
+			}
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(s)))
+			page = append(page, s...)
+		}
+		return len(rows), page
+	case columnTextHash:
+		for i := range rows {
+			page = append(page, rows[i].TextHash[:]...)
+		}
+		return len(rows), page
+	case columnDimension:
+		for i := range rows {
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(rows[i].Vector)))
+		}
+		return len(rows), page
+	}
+	if pw.opts.Embedding == EmbeddingBinary {
+		for i := range rows {
+			page = appendFloats(page, rows[i].Vector)
+		}
+		return len(rows), page
+	}
+	// A list's first element has repetition level 0 and the rest 1; an
+	// empty list is a single entry of definition level 0 and no value.
+	values := 0
+	var rep, def rleRuns
+	for i := range rows {
+		n := len(rows[i].Vector)
+		values += max(n, 1)
+		rep.add(0, 1)
+		rep.add(1, n-1)
+		if n == 0 {
+			def.add(0, 1)
+		} else {
+			def.add(1, n)
+		}
+	}
+	page = rep.appendTo(page)
+	page = def.appendTo(page)
+	for i := range rows {
+		page = appendFloats(page, rows[i].Vector)
+	}
+	return values, page
+}
+
+func appendFloats(page []byte, v []float32) []byte {
+	for _, x := range v {
+		page = binary.LittleEndian.AppendUint32(page, math.Float32bits(x))
+	}
+	return page
+}
+
+// rleRuns encodes levels of bit width 1 as the RLE runs of Parquet's
+// RLE/bit-packing hybrid.
+type rleRuns struct {
+	buf   []byte
+	value byte
+	count int
+}
+
+func (r *rleRuns) add(value byte, n int) {
+	if n <= 0 {
+		return
+	}
+	if r.count > 0 && value != r.value {
+		r.flush()
+	}
+	r.value = value
+	r.count += n
+}
+
+func (r *rleRuns) flush() {
+	if r.count > 0 {
+		r.buf = binary.AppendUvarint(r.buf, uint64(r.count)<<1)
+		r.buf = append(r.buf, r.value)
+		r.count = 0
+	}
+}
+
+// appendTo appends the runs to page after their length, as a data page
+// holds them.
+func (r *rleRuns) appendTo(page []byte) []byte {
+	r.flush()
+	page = binary.LittleEndian.AppendUint32(page, uint32(len(r.buf)))
+	return append(page, r.buf...)
+}
+
+func (pw *ParquetWriter) codec() int32 {
+	switch pw.opts.Compression {
+	case CompressionGzip:
+		return parquetGzip
+	case CompressionZstd:
+		return parquetZstd
+	}
+	return parquetUncompressed
+}
+
+func (pw *ParquetWriter) compress(page []byte) ([]byte, error) {
+	switch pw.opts.Compression {
+	case CompressionGzip:
+		buf := bytes.NewBuffer(pw.packed[:0])
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(page); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		pw.packed = buf.Bytes()
+		return pw.packed, nil
+	case CompressionZstd:
+		if pw.opts.ZstdEncoder != nil {
+			pw.packed = pw.opts.ZstdEncoder(page, pw.packed[:0])
+			return pw.packed, nil
+		}
+		codec, err := builtinZstd()
+		if err != nil {
+			return nil, err
+		}
+		pw.packed = codec.enc.EncodeAll(page, pw.packed[:0])
+		return pw.packed, nil
+	}
+	return page, nil
+}
+
+// zstdCodec is the built-in zstd encoder and decoder, shared by every
+// writer and reader: EncodeAll and DecodeAll may run concurrently.
+type zstdCodec struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+// zstdMaxPage bounds the pages the built-in decoder inflates: Parquet
+// page sizes are int32s.
+const zstdMaxPage = math.MaxInt32
+
+// builtinZstd makes the built-in codec on first use.
+var builtinZstd = sync.OnceValues(func() (zstdCodec, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return zstdCodec{}, err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(zstdMaxPage))
+	if err != nil {
+		return zstdCodec{}, err
+	}
+	return zstdCodec{enc, dec}, nil
+})
+
+// Close writes the last row group and the file metadata.
+func (pw *ParquetWriter) Close() error {
+	if pw.off == 0 {
+		if err := pw.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	meta := pw.metadata()
+	if err := pw.write(meta); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(meta)))
+	if err := pw.write(size[:]); err != nil {
+		return err
+	}
+	return pw.write([]byte(parquetMagic))
+}
+
+// paths are the schema paths of the leaf columns, with that of a list
+// embedding.
+var paths = [parquetColumns][]string{{"id"}, {"text_hash"}, {"model"}, {"dimension"}, {"embedding", "list", "element"}}
+
+// metadata encodes the FileMetaData of the file.
+func (pw *ParquetWriter) metadata() []byte {
+	binaryEmbedding := pw.opts.Embedding == EmbeddingBinary
+	var rows int64
+	for _, g := range pw.groups {
+		rows += g.rows
+	}
+	t := newThriftWriter()
+	t.i32(1, 1)
+	type element struct {
+		name                                string
+		typ, length, children, rep, logical int32
+		converted                           int32
+	}
+	// typ -1 is a group, and converted and logical -1 none.
+	schema := []element{
+		{name: "schema", typ: -1, children: parquetColumns, converted: -1, logical: -1},
+		{name: "id", typ: parquetByteArray, converted: parquetUTF8, logical: 1},
+		{name: "text_hash", typ: parquetFixedLenByteArray, length: sha256.Size, converted: -1, logical: -1},
+		{name: "model", typ: parquetByteArray, converted: parquetUTF8, logical: 1},
+		{name: "dimension", typ: parquetInt32, converted: -1, logical: -1},
+	}
+	if binaryEmbedding {
+		schema = append(schema, element{name: "embedding", typ: parquetFixedLenByteArray, length: int32(4 * max(pw.dim, 0)), converted: -1, logical: -1})
+	} else {
+		schema = append(schema,
+			element{name: "embedding", typ: -1, children: 1, converted: parquetList, logical: 3},
+			element{name: "list", typ: -1, children: 1, rep: parquetRepeated, converted: -1, logical: -1},
+			element{name: "element", typ: parquetFloat, converted: -1, logical: -1},
+		)
+	}
+	t.list(2, ctStruct, len(schema))
+	for i, e := range schema {
+		t.structElement(func() {
+			if e.typ >= 0 {
+				t.i32(1, e.typ)
+			}
+			if e.length > 0 {
+				t.i32(2, e.length)
+			}
+			if i > 0 {
+				t.i32(3, e.rep)
+			}
+			t.binary(4, e.name)
+			if e.children > 0 {
+				t.i32(5, e.children)
+			}
+			if e.converted >= 0 {
+				t.i32(6, e.converted)
+			}
+			if e.logical >= 0 {
+				// A LogicalType union of an empty STRING or LIST struct.
+				t.structField(10, func() { t.structField(int16(e.logical), func() {}) })
+			}
+		})
+	}
+	t.i64(3, rows)
+	t.list(4, ctStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		t.structElement(func() {
+			var size int64
+			t.list(1, ctStruct, parquetColumns)
+			for col, chunk := range g.columns {
+				size += chunk.uncompressed
+				t.structElement(func() {
+					t.i64(2, chunk.offset)
+					t.structField(3, func() {
+						path, typ := paths[col], int32(parquetByteArray)
+						switch {
+						case col == columnTextHash:
+							typ = parquetFixedLenByteArray
+						case col == columnDimension:
+							typ = parquetInt32
+						case col == columnEmbedding && binaryEmbedding:
+							path, typ = path[:1], parquetFixedLenByteArray
+						case col == columnEmbedding:
+							typ = parquetFloat
+						}
+						t.i32(1, typ)
+						if len(path) > 1 {
+							t.list(2, ctI32, 2)
+							t.buf = binary.AppendVarint(t.buf, parquetPlain)
+							t.buf = binary.AppendVarint(t.buf, parquetRLE)
+						} else {
+							t.list(2, ctI32, 1)
+							t.buf = binary.AppendVarint(t.buf, parquetPlain)
+						}
+						t.list(3, ctBinary, len(path))
+						for _, p := range path {
+							t.element(p)
+						}
+						t.i32(4, pw.codec())
+						t.i64(5, chunk.values)
+						t.i64(6, chunk.uncompressed)
+						t.i64(7, chunk.compressed)
+						t.i64(9, chunk.offset)
+					})
+				})
+			}
+			t.i64(2, size)
+			t.i64(3, g.rows)
+		})
+	}
+	if pw.opts.CreatedBy != "" {
+		t.binary(6, pw.opts.CreatedBy)
+	}
+	return t.end()
+}
+
+// WriteParquet writes rows to w as a Parquet file.
+func WriteParquet(w io.Writer, rows []EmbeddingRow, opts ParquetOptions) error {
+	pw, err := NewParquetWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if err := pw.Write(rows); err != nil {
+		return err
+	}
+	return pw.Close()
+}
@@ -0,0 +1,210 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func testRows(n, dim int) []EmbeddingRow {
+	rows := make([]EmbeddingRow, n)
+	for i := range rows {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(i) + float32(j)*0.25
+		}
+		rows[i] = EmbeddingRow{ID: fmt.Sprint(i), TextHash: HashText(fmt.Sprint("text ", i)), Model: "test-model", Vector: v}
+	}
+	return rows
+}
+
+func roundTrip(t *testing.T, rows []EmbeddingRow, opts ParquetOptions) []EmbeddingRow {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, rows, opts); err != nil {
+		t.Fatalf("WriteParquet: %v", err)
+	}
+	back, err := ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), opts)
+	if err != nil {
+		t.Fatalf("ReadParquet: %v", err)
+	}
+	return back
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	rows := testRows(10, 3)
+	// An empty input still has its row, hash, and vector.
+	rows[4] = EmbeddingRow{ID: "", TextHash: HashText(""), Model: "test-model", Vector: []float32{float32(math.Inf(-1)), float32(math.Copysign(0, -1)), math.MaxFloat32}}
+	for _, embedding := range []string{EmbeddingList, EmbeddingBinary} {
+		for _, compression := range []string{CompressionNone, CompressionGzip} {
+			opts := ParquetOptions{RowGroupSize: 4, Embedding: embedding, Compression: compression, CreatedBy: "test"}
+			if back := roundTrip(t, rows, opts); !reflect.DeepEqual(back, rows) {
+				t.Errorf("%s %s: read back\n%v\nwant\n%v", embedding, compression, back, rows)
+			}
+		}
+	}
+}
+
+func TestParquetHighDimension(t *testing.T) {
+	// Rows of 256 KiB span pages of their own.
+	rows := testRows(9, 65536)
+	for _, embedding := range []string{EmbeddingList, EmbeddingBinary} {
+		if back := roundTrip(t, rows, ParquetOptions{Embedding: embedding}); !reflect.DeepEqual(back, rows) {
+			t.Errorf("%s: the vectors do not survive", embedding)
+		}
+	}
+}
+
+func TestParquetLists(t *testing.T) {
+	// Lists may differ in length, and be empty.
+	rows := testRows(5, 2)
+	rows[1].Vector = []float32{}
+	rows[3].Vector = []float32{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if back := roundTrip(t, rows, ParquetOptions{RowGroupSize: 2}); !reflect.DeepEqual(back, rows) {
+		t.Errorf("read back\n%v\nwant\n%v", back, rows)
+	}
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, rows, ParquetOptions{Embedding: EmbeddingBinary}); err == nil {
+		t.Error("a binary embedding accepted vectors of different lengths")
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	if back := roundTrip(t, nil, ParquetOptions{}); len(back) != 0 {
+		t.Errorf("read back %v from an empty file", back)
+	}
+}
+
+func TestScanParquet(t *testing.T) {
+	rows := testRows(7, 3)
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, rows, ParquetOptions{RowGroupSize: 2}); err != nil {
+		t.Fatalf("WriteParquet: %v", err)
+	}
+	var got []EmbeddingRow
+	stop := errors.New("stop")
+	err := ScanParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ParquetOptions{}, func(row EmbeddingRow) error {
+		got = append(got, row)
+		if len(got) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !reflect.DeepEqual(got, rows[:3]) {
+		t.Fatalf("ScanParquet = %v after\n%v", err, got)
+	}
+}
+
+func TestParquetZstd(t *testing.T) {
+	rows := testRows(6, 4)
+	// Empty inputs keep their rows, hashes, and vectors.
+	rows[1] = EmbeddingRow{ID: "", TextHash: HashText(""), Model: "test-model", Vector: []float32{0, float32(math.Copysign(0, -1)), 1, -1}}
+	rows[4].TextHash = HashText("")
+	high := testRows(3, 65536)
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	for _, tc := range []struct {
+		embedding string
+		rows      []EmbeddingRow
+	}{
+		{EmbeddingList, append(append([]EmbeddingRow(nil), rows...), high[0])},
+		{EmbeddingBinary, rows},
+		{EmbeddingBinary, high},
+	} {
+		opts := ParquetOptions{RowGroupSize: 4, Embedding: tc.embedding, Compression: CompressionZstd, CreatedBy: "test"}
+		var buf bytes.Buffer
+		if err := WriteParquet(&buf, tc.rows, opts); err != nil {
+			t.Fatalf("%s: WriteParquet: %v", tc.embedding, err)
+		}
+		back, err := ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ParquetOptions{})
+		if err != nil {
+			t.Fatalf("%s: ReadParquet: %v", tc.embedding, err)
+		}
+		// The pages are zstd frames a decoder of its own reads.
+		var frames int
+		checked := ParquetOptions{ZstdDecoder: func(src, dst []byte) ([]byte, error) {
+			frames++
+			return dec.DecodeAll(src, dst)
+		}}
+		if again, err := ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), checked); err != nil || frames == 0 || !reflect.DeepEqual(again, back) {
+			t.Errorf("%s: %d frames decoded by klauspost/compress: %v", tc.embedding, frames, err)
+		}
+		if !reflect.DeepEqual(back, tc.rows) {
+			t.Errorf("%s: %d rows of dimension %d do not survive zstd", tc.embedding, len(tc.rows), len(tc.rows[len(tc.rows)-1].Vector))
+		}
+	}
+}
+
+func TestParquetZstdCodecOptions(t *testing.T) {
+	// Stand-ins for another zstd codec that reverse the bytes.
+	reverse := func(src, dst []byte) []byte {
+		for i := len(src) - 1; i >= 0; i-- {
+			dst = append(dst, src[i])
+		}
+		return dst
+	}
+	opts := ParquetOptions{
+		Compression: CompressionZstd,
+		ZstdEncoder: reverse,
+		ZstdDecoder: func(src, dst []byte) ([]byte, error) { return reverse(src, dst), nil },
+	}
+	rows := testRows(3, 4)
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, rows, opts); err != nil {
+		t.Fatal(err)
+	}
+	if back, err := ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), opts); err != nil || !reflect.DeepEqual(back, rows) {
+		t.Fatalf("read back %v, %v", back, err)
+	}
+	// The built-in decoder finds no zstd frames in the reversed pages.
+	if _, err := ReadParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ParquetOptions{}); err == nil {
+		t.Fatal("the built-in decoder read pages the encoder option wrote")
+	}
+}
+
+func TestParquetOptionsValidate(t *testing.T) {
+	for _, opts := range []ParquetOptions{
+		{Embedding: "floats"},
+		{Compression: "snappy"},
+		{RowGroupSize: -1},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v passed validation", opts)
+		}
+		if _, err := NewParquetWriter(io.Discard, opts); err == nil {
+			t.Errorf("NewParquetWriter accepted %+v", opts)
+		}
+	}
+}
+
+func TestReadParquetRejects(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, testRows(3, 2), ParquetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"not":       []byte("not a parquet file at all"),
+		"truncated": file[:len(file)-1],
+	} {
+		if _, err := ReadParquet(bytes.NewReader(data), int64(len(data)), ParquetOptions{}); err == nil {
+			t.Errorf("%s: read", name)
+		}
+	}
+	// Every truncation of the file's start fails to read rather than panicking.
+	for cut := 1; cut < len(file)-12; cut++ {
+		if _, err := ReadParquet(bytes.NewReader(file[cut:]), int64(len(file)-cut), ParquetOptions{}); err == nil {
+			t.Fatalf("read the file without its first %d bytes", cut)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrNotEmbeddings reports a Parquet file ReadParquet cannot read: one not
+// laid out as WriteParquet writes them.
+var ErrNotEmbeddings = errors.New("not a parquet file of embeddings")
+
+// ReadParquet reads the rows of a file WriteParquet or a ParquetWriter
+// wrote, of size bytes, from r. Of opts only ZstdDecoder matters, when set,
+// for files compressed with zstd. ScanParquet reads files too large to
+// hold.
+func ReadParquet(r io.ReaderAt, size int64, opts ParquetOptions) ([]EmbeddingRow, error) {
+	var rows []EmbeddingRow
+	err := ScanParquet(r, size, opts, func(row EmbeddingRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []EmbeddingRow{}
+	}
+	return rows, nil
+}
+
+// ScanParquet reads the rows of a file as ReadParquet does, calling fn with
+// each in turn, and stops at the first error fn returns. It decodes a row
+// group at a time, so it holds one group's column chunks and rows however
+// large the file; ParquetOptions.RowGroupSize bounds them.
+func ScanParquet(r io.ReaderAt, size int64, opts ParquetOptions, fn func(EmbeddingRow) error) error {
+	if size < 12 {
+		return ErrNotEmbeddings
+	}
+	var tail [8]byte
+	if _, err := r.ReadAt(tail[:], size-8); err != nil {
+		return err
+	}
+	metaLen := int64(binary.LittleEndian.Uint32(tail[:]))
+	if string(tail[4:]) != parquetMagic || metaLen > size-12 {
+		return ErrNotEmbeddings
+	}
+	raw := make([]byte, metaLen)
+	if _, err := r.ReadAt(raw, size-8-metaLen); err != nil {
+		return err
+	}
+	meta, err := (&thriftReader{data: raw}).readStruct()
+	if err != nil {
+		return err
+	}
+	schema := meta.list(2)
+	names := make([]string, 0, len(schema))
+	for _, e := range schema {
+		s, _ := e.(thriftStruct)
+		names = append(names, string(s.bytes(4)))
+	}
+	// dim is the length of the vectors of an EmbeddingBinary file, and -1
+	// for lists.
+	dim := -1
+	switch fmt.Sprint(names) {
+	case "[schema id text_hash model dimension embedding]":
+		dim = int(schema[5].(thriftStruct).int(2) / 4)
+	case "[schema id text_hash model dimension embedding list element]":
+	default:
+		return fmt.Errorf("%w: columns %v", ErrNotEmbeddings, names[min(1, len(names)):])
+	}
+
+	// Every row takes more than a byte of the file.
+	total := meta.int(3)
+	if total < 0 || total > size {
+		return fmt.Errorf("%w: %d rows", ErrNotEmbeddings, total)
+	}
+	left := total
+	for _, item := range meta.list(4) {
+		g, _ := item.(thriftStruct)
+		n := g.int(3)
+		if n < 0 || n > left {
+			return fmt.Errorf("%w: row group of %d rows", ErrNotEmbeddings, n)
+		}
+		group := make([]EmbeddingRow, n)
+		chunks := g.list(1)
+		if len(chunks) != parquetColumns {
+			return fmt.Errorf("%w: row group of %d columns", ErrNotEmbeddings, len(chunks))
+		}
+		for col, item := range chunks {
+			chunk, _ := item.(thriftStruct)
+			cm := chunk.strct(3)
+			if cm.int(7) < 0 || cm.int(9) < 0 || cm.int(7) > size-cm.int(9) {
+				return fmt.Errorf("%w: column chunk out of the file", ErrNotEmbeddings)
+			}
+			data := make([]byte, cm.int(7))
+			if _, err := r.ReadAt(data, cm.int(9)); err != nil {
+				return fmt.Errorf("column %s: %w", paths[col][0], err)
+			}
+			if err := readColumn(group, col, dim, data, cm, opts); err != nil {
+				return fmt.Errorf("column %s: %w", paths[col][0], err)
+			}
+		}
+		for _, row := range group {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		left -= n
+	}
+	return nil
+}
+
+// readColumn decodes the pages of a column chunk, data, into rows.
+func readColumn(rows []EmbeddingRow, col, dim int, data []byte, cm thriftStruct, opts ParquetOptions) error {
+	codec := cm.int(4)
+	t := &thriftReader{data: data}
+	row := 0
+	for values := int64(0); values < cm.int(5); {
+		header, err := t.readStruct()
+		if err != nil {
+			return err
+		}
+		n := header.int(3)
+		if header.int(1) != parquetDataPage || n < 0 || n > int64(len(data)-t.off) {
+			return fmt.Errorf("%w: page type %d of %d bytes", ErrNotEmbeddings, header.int(1), n)
+		}
+		page, err := decompress(codec, data[t.off:t.off+int(n)], int(header.int(2)), opts)
+		if err != nil {
+			return err
+		}
+		t.off += int(n)
+		count := header.strct(5).int(1)
+		values += count
+		if row, err = decodePage(rows, row, col, dim, page, int(count)); err != nil {
+			return err
+		}
+	}
+	if row != len(rows) {
+		return fmt.Errorf("%w: %d of %d rows", ErrNotEmbeddings, row, len(rows))
+	}
+	return nil
+}
+
+func decompress(codec int64, page []byte, size int, opts ParquetOptions) ([]byte, error) {
+	switch codec {
+	case parquetUncompressed:
+		return page, nil
+	case parquetGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		out := bytes.NewBuffer(make([]byte, 0, max(size, 0)))
+		if _, err := io.Copy(out, zr); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	case parquetZstd:
+		if opts.ZstdDecoder != nil {
+			return opts.ZstdDecoder(page, make([]byte, 0, max(size, 0)))
+		}
+		codec, err := builtinZstd()
+		if err != nil {
+			return nil, err
+		}
+		return codec.dec.DecodeAll(page, make([]byte, 0, max(size, 0)))
+	}
+	return nil, fmt.Errorf("%w: compression codec %d", ErrNotEmbeddings, codec)
+}
+
+// pageReader reads the values of a PLAIN page.
+type pageReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (p *pageReader) next(n int) []byte {
+	if p.err != nil || n < 0 || n > len(p.data)-p.off {
+		p.err = fmt.Errorf("%w: page ends early", ErrNotEmbeddings)
+		return nil
+	}
+	b := p.data[p.off : p.off+n]
+	p.off += n
+	return b
+}
+
+func (p *pageReader) uint32() uint32 {
+	if b := p.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (p *pageReader) floats(n int) []float32 {
+	b := p.next(4 * n)
+	if b == nil {
+		return nil
+	}
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+// decodePage decodes a page of count values of a column into the rows
+// from row on, returning the row after them. dim is that of ReadParquet.
+func decodePage(rows []EmbeddingRow, row, col, dim int, page []byte, count int) (int, error) {
+	p := &pageReader{data: page}
+	if col == columnEmbedding && dim < 0 {
+		rep, err := readLevels(p, count)
+		if err != nil {
+			return row, err
+		}
+		def, err := readLevels(p, count)
+		if err != nil {
+			return row, err
+		}
+		// Each row is the values from its level-0 repetition to the next.
+		for i := 0; i < count; {
+			if row >= len(rows) || rep[i] != 0 {
+				return row, fmt.Errorf("%w: list levels", ErrNotEmbeddings)
+			}
+			end := i + 1
+			for end < count && rep[end] == 1 {
+				end++
+			}
+			if def[i] == 0 {
+				rows[row].Vector = []float32{}
+			} else {
+				rows[row].Vector = p.floats(end - i)
+			}
+			row, i = row+1, end
+		}
+		return row, p.err
+	}
+	if row+count > len(rows) {
+		return row, fmt.Errorf("%w: more values than rows", ErrNotEmbeddings)
+	}
+	for i := 0; i < count; i++ {
+		r := &rows[row+i]
+		switch col {
+		case columnID:
+			r.ID = string(p.next(int(p.uint32())))
+		case columnTextHash:
+			copy(r.TextHash[:], p.next(len(r.TextHash)))
+		case columnModel:
+			r.Model = string(p.next(int(p.uint32())))
+		case columnDimension:
+			p.uint32()
+		case columnEmbedding:
+			r.Vector = p.floats(dim)
+		}
+	}
+	return row + count, p.err
+}
+
+// readLevels decodes count levels of bit width 1, stored with their
+// length in the RLE/bit-packing hybrid.
+func readLevels(p *pageReader, count int) ([]byte, error) {
+	data := p.next(int(p.uint32()))
+	if p.err != nil {
+		return nil, p.err
+	}
+	levels := make([]byte, 0, count)
+	for off := 0; len(levels) < count; {
+		h, n := binary.Uvarint(data[off:])
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: levels end early", ErrNotEmbeddings)
+		}
+		off += n
+		if h&1 == 0 {
+			// A run of one value.
+			if off >= len(data) || h>>1 > uint64(count-len(levels)) {
+				return nil, fmt.Errorf("%w: level run", ErrNotEmbeddings)
+			}
+			for i := uint64(0); i < h>>1; i++ {
+				levels = append(levels, data[off]&1)
+			}
+			off++
+			continue
+		}
+		// Groups of 8 bit-packed values, a byte each at width 1.
+		groups := int(h >> 1)
+		if groups > len(data)-off {
+			return nil, fmt.Errorf("%w: bit-packed levels", ErrNotEmbeddings)
+		}
+		for _, b := range data[off : off+groups] {
+			for bit := 0; bit < 8 && len(levels) < count; bit++ {
+				levels = append(levels, b>>bit&1)
+			}
+		}
+		off += groups
+	}
+	return levels, nil
+}
@@ -0,0 +1,287 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Types of the Thrift compact protocol, in which Parquet writes its page
+// headers and file metadata.
+const (
+	ctTrue   = 1
+	ctFalse  = 2
+	ctByte   = 3
+	ctI16    = 4
+	ctI32    = 5
+	ctI64    = 6
+	ctDouble = 7
+	ctBinary = 8
+	ctList   = 9
+	ctSet    = 10
+	ctMap    = 11
+	ctStruct = 12
+)
+
+// thriftWriter encodes a struct in the compact protocol. Fields are written
+// in increasing order of ID within each struct.
+type thriftWriter struct {
+	buf []byte
+	// last holds the ID of the last field written in each open struct.
+	last []int16
+}
+
+func newThriftWriter() *thriftWriter { return &thriftWriter{last: []int16{0}} }
+
+func (t *thriftWriter) header(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.header(id, ctI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.header(id, ctI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.header(id, ctBinary)
+	t.element(s)
+}
+
+// element writes s as an element of a list of binaries.
+func (t *thriftWriter) element(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// list starts a list of n elements of type elem, which the caller writes:
+// as element, binary.AppendVarint, or structs.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.header(id, ctList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
+
+// structField writes the struct body fills as field id.
+func (t *thriftWriter) structField(id int16, body func()) {
+	t.header(id, ctStruct)
+	t.structElement(body)
+}
+
+// structElement writes the struct body fills as an element of a list.
+func (t *thriftWriter) structElement(body func()) {
+	t.last = append(t.last, 0)
+	body()
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// end ends the top-level struct.
+func (t *thriftWriter) end() []byte { return append(t.buf, 0) }
+
+// thriftStruct is a decoded struct: its fields by ID, booleans as bool,
+// integers as int64, binaries as []byte, lists as []any, and structs as
+// thriftStruct. Doubles, sets, and maps, which the metadata read here does
+// not use, are skipped.
+type thriftStruct map[int16]any
+
+func (s thriftStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStruct) bytes(id int16) []byte {
+	v, _ := s[id].([]byte)
+	return v
+}
+
+func (s thriftStruct) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+func (s thriftStruct) strct(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+var errThrift = errors.New("corrupt thrift metadata")
+
+// thriftMaxDepth bounds the nesting of the structs and lists decoded.
+const thriftMaxDepth = 64
+
+// thriftReader decodes compact protocol structs from data.
+type thriftReader struct {
+	data  []byte
+	off   int
+	depth int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.off >= len(r.data) {
+		return 0, errThrift
+	}
+	b := r.data[r.off]
+	r.off++
+	return b, nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		return 0, errThrift
+	}
+	r.off += n
+	return v, nil
+}
+
+func (r *thriftReader) varint() (int64, error) {
+	v, n := binary.Varint(r.data[r.off:])
+	if n <= 0 {
+		return 0, errThrift
+	}
+	r.off += n
+	return v, nil
+}
+
+// readStruct decodes a struct, through its stop field.
+func (r *thriftReader) readStruct() (thriftStruct, error) {
+	if r.depth++; r.depth > thriftMaxDepth {
+		return nil, errThrift
+	}
+	defer func() { r.depth-- }()
+	s := make(thriftStruct)
+	var last int16
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return s, nil
+		}
+		typ, id := b&0x0f, last+int16(b>>4)
+		if b>>4 == 0 {
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		last = id
+		switch typ {
+		case ctTrue, ctFalse:
+			s[id] = typ == ctTrue
+			continue
+		}
+		v, err := r.value(typ)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			s[id] = v
+		}
+	}
+}
+
+// value decodes a value of typ, an element of a list or the value of a
+// field that is not a boolean.
+func (r *thriftReader) value(typ byte) (any, error) {
+	switch typ {
+	case ctTrue, ctFalse:
+		b, err := r.byte()
+		return b == ctTrue, err
+	case ctByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case ctI16, ctI32, ctI64:
+		return r.varint()
+	case ctDouble:
+		if len(r.data)-r.off < 8 {
+			return nil, errThrift
+		}
+		r.off += 8
+		return nil, nil
+	case ctBinary:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.data)-r.off) {
+			return nil, errThrift
+		}
+		b := r.data[r.off : r.off+int(n)]
+		r.off += int(n)
+		return b, nil
+	case ctList, ctSet:
+		if r.depth++; r.depth > thriftMaxDepth {
+			return nil, errThrift
+		}
+		defer func() { r.depth-- }()
+		h, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		n, elem := uint64(h>>4), h&0x0f
+		if n == 15 {
+			if n, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		// Every element takes at least a byte.
+		if n > uint64(len(r.data)-r.off) {
+			return nil, errThrift
+		}
+		list := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := r.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if typ == ctSet {
+			return nil, nil
+		}
+		return list, nil
+	case ctMap:
+		n, err := r.uvarint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		kv, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.data)-r.off) {
+			return nil, errThrift
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.value(kv >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.value(kv & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case ctStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("%w: type %d", errThrift, typ)
+}
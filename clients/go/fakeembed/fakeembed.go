@@ -0,0 +1,69 @@
+// Package fakeembed derives deterministic pseudo-embeddings, for the fake
+// servers of the fixture generator, serve-mock, and embednexustest, so that
+// fixtures recorded against them regenerate byte for byte on any machine.
+//
+// A vector is a function of the model, the text, the dimension, and a seed
+// alone. Its components are read as integers from SHA-256 sums and scaled
+// to unit length with one square root and one division each, both of which
+// IEEE 754 rounds exactly, so no platform, architecture, or Go release
+// computes a different float32.
+package fakeembed
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// domain prefixes every hashed message, so that changing how vectors are
+// derived means changing it and the fixtures together.
+const domain = "fakeembed/v1\x00"
+
+// perSum is the number of components read from one SHA-256 sum.
+const perSum = sha256.Size / 2
+
+// Vector returns the unit-length vector of dim components that model
+// embeds text as, under the zero seed.
+func Vector(model, text string, dim int) []float32 {
+	return Seeded(0, model, text, dim)
+}
+
+// Seeded returns the unit-length vector of dim components that model
+// embeds text as under seed. Every seed, model, and text gives an
+// independent vector, and the same ones always give the same vector.
+func Seeded(seed int64, model, text string, dim int) []float32 {
+	raw := make([]int16, dim)
+	var sum [sha256.Size]byte
+	for i := range raw {
+		if i%perSum == 0 {
+			h := sha256.New()
+			h.Write([]byte(domain))
+			// Fixed-width fields keep (model, text) pairs from colliding
+			// by concatenation.
+			_ = binary.Write(h, binary.BigEndian, [2]int64{seed, int64(len(model))})
+			h.Write([]byte(model))
+			_ = binary.Write(h, binary.BigEndian, int64(i/perSum))
+			h.Write([]byte(text))
+			h.Sum(sum[:0])
+		}
+		raw[i] = int16(binary.BigEndian.Uint16(sum[2*(i%perSum):]))
+	}
+	// The sum of squares is exact in integers; at 2^30 a component it
+	// cannot overflow below 2^33 components.
+	var squares uint64
+	for _, c := range raw {
+		squares += uint64(int64(c) * int64(c))
+	}
+	v := make([]float32, dim)
+	if squares == 0 {
+		if dim > 0 {
+			v[0] = 1
+		}
+		return v
+	}
+	norm := math.Sqrt(float64(squares))
+	for i, c := range raw {
+		v[i] = float32(float64(c) / norm)
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package fakeembed
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestVectorBits(t *testing.T) {
+	// Recorded fixtures hold these bits; a change here means regenerating
+	// them and bumping domain.
+	for _, tc := range []struct {
+		v    []float32
+		want []uint32
+	}{
+		{Vector("fake", "hello", 4), []uint32{0xbe444404, 0xbf33cb3e, 0xbf2aedcc, 0x3e1f4bb4}},
+		{Seeded(42, "text-embedding-3-large", "alpha", 3), []uint32{0x3f262549, 0x3ecc9697, 0x3f25bbbc}},
+	} {
+		got := make([]uint32, len(tc.v))
+		for i, x := range tc.v {
+			got[i] = math.Float32bits(x)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("bits %#08x, want %#08x", got, tc.want)
+		}
+	}
+}
+
+func TestVector(t *testing.T) {
+	v := Vector("m", "x", 384)
+	if !reflect.DeepEqual(v, Vector("m", "x", 384)) {
+		t.Fatal("vector is not deterministic")
+	}
+	var squares float64
+	for _, x := range v {
+		squares += float64(x) * float64(x)
+	}
+	if math.Abs(squares-1) > 1e-5 {
+		t.Fatalf("squared norm %v", squares)
+	}
+	if reflect.DeepEqual(v[:16], v[16:32]) {
+		t.Fatal("vector blocks repeat")
+	}
+	for name, other := range map[string][]float32{
+		"model": Vector("n", "x", 384),
+		"text":  Vector("m", "y", 384),
+		"seed":  Seeded(1, "m", "x", 384),
+		// Lengths are hashed, so moving bytes between the two differs.
+		"split": Vector("mx", "", 384),
+	} {
+		if reflect.DeepEqual(v, other) {
+			t.Errorf("changing the %s leaves the vector", name)
+		}
+	}
+	if v := Vector("m", "x", 0); len(v) != 0 {
+		t.Fatalf("zero-dimensional vector %v", v)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// defaultFixtureDir is where validate-fixtures looks without arguments.
+const defaultFixtureDir = "tests/fixtures"
+
+// defaultNormalizeRules is the shared rules file --update-transcripts
+// applies unless --normalize-rules names another.
+var defaultNormalizeRules = filepath.Join(defaultFixtureDir, transcript.NormalizeRulesFile)
+
+// normalizeRecorded rewrites each recorded transcript in paths, skipping
+// empty ones, with the rules at rulesPath, or those at
+// defaultNormalizeRules when rulesPath is empty and that file exists.
+func normalizeRecorded(rulesPath string, paths ...string) error {
+	if rulesPath == "" {
+		if _, err := os.Stat(defaultNormalizeRules); err != nil {
+			return nil
+		}
+		rulesPath = defaultNormalizeRules
+	}
+	n, err := transcript.LoadNormalizer(rulesPath)
+	if err != nil {
+		return fmt.Errorf("normalization rules: %w", err)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		t, err := transcript.Load(path)
+		if err != nil {
+			return err
+		}
+		if t, err = n.Normalize(t); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := transcript.Save(path, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runValidateFixtures implements "embednexus validate-fixtures [path ...]":
+// every file named, or .json or .jsonl file found below a named directory,
+// is checked against the transcript schema. Violations go to stdout one per
+// line, and the exit code is exitFailure when any file is invalid.
+func runValidateFixtures(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus validate-fixtures", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: embednexus validate-fixtures [path ...] (default %s)\n", defaultFixtureDir)
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{defaultFixtureDir}
+	}
+	files, err := fixtureFiles(roots)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+	invalid := 0
+	for _, path := range files {
+		errs := transcript.Validate(path)
+		if len(errs) > 0 {
+			invalid++
+		}
+		for _, e := range errs {
+			fmt.Fprintf(stdout, "%s: %v\n", path, e)
+		}
+	}
+	if invalid > 0 {
+		fmt.Fprintf(stderr, "embednexus: %d of %d fixtures invalid\n", invalid, len(files))
+		return exitFailure
+	}
+	fmt.Fprintf(stderr, "embednexus: %d fixtures valid\n", len(files))
+	return exitOK
+}
+
+// fixtureFiles expands roots into the sorted .json and .jsonl files they
+// name.
+func fixtureFiles(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// The shared normalization rules live among the fixtures but
+			// are not a transcript.
+			if d.Name() == transcript.NormalizeRulesFile && path != root {
+				return nil
+			}
+			if !d.IsDir() && (path == root || strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".jsonl")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
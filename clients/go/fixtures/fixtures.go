@@ -0,0 +1,211 @@
+// Package fixtures finds and loads the transcript fixtures under
+// tests/fixtures, laid out as
+//
+//	<lang>/<transport>/<kind>.json
+//	<lang>/<transport>/<variant>/<kind>.json
+//
+// where a variant, such as the openai wire protocol or the cbor codec,
+// records the same transport in another mode. A test names the fixture it
+// needs by Key:
+//
+//	tr := fixtures.Load(t, fixtures.Key{Lang: "go", Transport: "http", Variant: "openai", Kind: "response"})
+//
+// and a table-driven test iterates whatever Discover finds on disk. A
+// fixture written by gen-fixtures into tests/fixtures/local wins over the
+// downloaded one, and either may be stored as JSONL, which wins over JSON.
+// Load skips the test, saying how to record the fixture, when neither
+// exists.
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// Key names a fixture.
+type Key struct {
+	// Lang is the client that recorded it, such as "go".
+	Lang string
+	// Transport is the transport it was recorded over.
+	Transport string
+	// Variant is the mode of the transport recorded, such as a wire
+	// protocol, codec, or error scenario; empty for the plain session.
+	Variant string
+	// Kind is the fixture of the session, such as "request", "response",
+	// or "models".
+	Kind string
+}
+
+// String returns k as the path of its fixture below a tree, without its
+// extension.
+func (k Key) String() string {
+	return filepath.ToSlash(k.base())
+}
+
+func (k Key) base() string {
+	return filepath.Join(k.Lang, k.Transport, k.Variant, k.Kind)
+}
+
+// File returns the path of k's JSON fixture below root, whether or not it
+// exists.
+func (k Key) File(root string) string {
+	return filepath.Join(root, k.base()) + ".json"
+}
+
+// Root returns the absolute path of tests/fixtures.
+func Root() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		panic("fixtures: cannot locate the source tree")
+	}
+	return filepath.Join(filepath.Dir(file), "..", "..", "..", "tests", "fixtures")
+}
+
+// LocalRoot returns the absolute path of tests/fixtures/local, where
+// gen-fixtures writes and which git ignores.
+func LocalRoot() string {
+	return filepath.Join(Root(), "local")
+}
+
+// Fixture is a fixture found on disk.
+type Fixture struct {
+	Key
+	// Path is its file.
+	Path string
+	// Local reports whether it lies below LocalRoot, recorded against the
+	// fake embedder rather than downloaded.
+	Local bool
+}
+
+// Find returns the fixture k names, preferring LocalRoot to Root and JSONL
+// to JSON, and reports whether there is one.
+func Find(k Key) (Fixture, bool) {
+	for _, root := range []string{LocalRoot(), Root()} {
+		base := filepath.Join(root, k.base())
+		for _, path := range []string{base + ".jsonl", base + ".json"} {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return Fixture{Key: k, Path: path, Local: root != Root()}, true
+			}
+		}
+	}
+	return Fixture{}, false
+}
+
+// Load returns the transcript k names, as Find picks it. It skips the test
+// when there is none and fails it when the fixture is not a valid
+// transcript.
+func Load(t testing.TB, k Key) transcript.Transcript {
+	t.Helper()
+	f, ok := Find(k)
+	if !ok {
+		t.Skipf("no fixture %s in %s: %s", k, Root(), Hint(k))
+	}
+	if errs := transcript.Validate(f.Path); len(errs) > 0 {
+		var lines []string
+		for _, e := range errs {
+			lines = append(lines, e.Error())
+		}
+		t.Fatalf("%s is not a valid transcript:\n%s", f.Path, strings.Join(lines, "\n"))
+	}
+	payload, err := transcript.Load(f.Path)
+	if err != nil {
+		t.Fatalf("load %s: %v", f.Path, err)
+	}
+	return payload
+}
+
+// Hint says how to record the fixture k names.
+func Hint(k Key) string {
+	artifact := fmt.Sprintf("download the GitHub Action artifact into %s", filepath.Join("tests", "fixtures", k.Lang))
+	// The error scenarios are sessions of their own, all recorded by one
+	// target.
+	scenario := k.Variant == "errors"
+	if k.Lang != "go" || (k.Kind != "request" && k.Kind != "response" && !scenario) {
+		return artifact
+	}
+	target := k.Transport
+	if k.Variant == "fake" {
+		return "run go test -update-transcripts in clients/go to record it against the fake embedder"
+	}
+	if k.Variant != "" {
+		target = k.Variant
+	}
+	return fmt.Sprintf("run \"go run . gen-fixtures %s\" in clients/go to record it against the fake embedder, or %s", target, artifact)
+}
+
+// Discover returns the keys of the fixtures below Root and LocalRoot that
+// match pattern, whose empty fields match anything, sorted and each once.
+// Only the tree of pattern.Lang is searched when it is set; the rest of
+// tests/fixtures holds files other than transcripts.
+func Discover(t testing.TB, pattern Key) []Key {
+	t.Helper()
+	var keys []Key
+	for _, root := range []string{Root(), LocalRoot()} {
+		found, err := discover(root, pattern.Lang)
+		if err != nil {
+			t.Fatalf("fixtures: %v", err)
+		}
+		for _, k := range found {
+			if pattern.matches(k) && !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	slices.SortFunc(keys, func(a, b Key) int { return strings.Compare(a.String(), b.String()) })
+	return keys
+}
+
+func (p Key) matches(k Key) bool {
+	return (p.Lang == "" || p.Lang == k.Lang) &&
+		(p.Transport == "" || p.Transport == k.Transport) &&
+		(p.Variant == "" || p.Variant == k.Variant) &&
+		(p.Kind == "" || p.Kind == k.Kind)
+}
+
+// discover returns the keys of the fixtures below root/lang, which need not
+// exist.
+func discover(root, lang string) ([]Key, error) {
+	var keys []Key
+	top := filepath.Join(root, lang)
+	err := filepath.WalkDir(top, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == top && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// The local tree is searched as a root of its own.
+			if rel == "local" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".json" && ext != ".jsonl" {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, ext)), "/")
+		switch len(parts) {
+		case 3:
+			keys = append(keys, Key{Lang: parts[0], Transport: parts[1], Kind: parts[2]})
+		case 4:
+			keys = append(keys, Key{Lang: parts[0], Transport: parts[1], Variant: parts[2], Kind: parts[3]})
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,88 @@
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"go/http/request.json",
+		"go/http/response.jsonl",
+		"go/http/openai/error-429.json",
+		"go/http/README.md",
+		"go/README.md",
+		"go/stray.json",
+		"python/stdio/request.json",
+		"local/go/unix/request.json",
+	} {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := discover(root, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Key{
+		{Lang: "go", Transport: "http", Variant: "openai", Kind: "error-429"},
+		{Lang: "go", Transport: "http", Kind: "request"},
+		{Lang: "go", Transport: "http", Kind: "response"},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("discover: %+v, want %+v", keys, want)
+	}
+	if keys, err := discover(filepath.Join(root, "none"), "go"); err != nil || len(keys) != 0 {
+		t.Fatalf("discover of a missing tree: %v, %v", keys, err)
+	}
+}
+
+func TestRepoFixtures(t *testing.T) {
+	keys := Discover(t, Key{Lang: "go", Transport: "http", Kind: "request"})
+	var variants []string
+	for _, k := range keys {
+		variants = append(variants, k.Variant)
+	}
+	for _, variant := range []string{"", "openai", "cbor"} {
+		if !slices.Contains(variants, variant) {
+			t.Errorf("Discover found variants %q, not %q", variants, variant)
+		}
+	}
+	k := Key{Lang: "go", Transport: "http", Variant: "openai", Kind: "request"}
+	f, ok := Find(k)
+	if !ok || filepath.Base(f.Path) != "request.json" {
+		t.Fatalf("Find(%s): %+v, %v", k, f, ok)
+	}
+	if tr := Load(t, k); tr.WireProtocol != "openai" {
+		t.Fatalf("Load(%s): wire protocol %q", k, tr.WireProtocol)
+	}
+	if _, ok := Find(Key{Lang: "go", Transport: "http", Kind: "no-such-kind"}); ok {
+		t.Fatal("Find found a missing fixture")
+	}
+}
+
+func TestHint(t *testing.T) {
+	for k, want := range map[Key]string{
+		{Lang: "go", Transport: "unix", Kind: "request"}:                       `gen-fixtures unix"`,
+		{Lang: "go", Transport: "http", Variant: "cbor", Kind: "response"}:     `gen-fixtures cbor"`,
+		{Lang: "go", Transport: "stdio", Variant: "errors", Kind: "truncated"}: `gen-fixtures errors"`,
+		{Lang: "go", Transport: "http", Variant: "openai", Kind: "error-429"}:  "GitHub Action artifact",
+		{Lang: "python", Transport: "http", Kind: "request"}:                   filepath.Join("tests", "fixtures", "python"),
+	} {
+		if got := Hint(k); !strings.Contains(got, want) {
+			t.Errorf("Hint(%s) = %q, want it to mention %q", k, got, want)
+		}
+	}
+	if got := Hint(Key{Lang: "go", Transport: "http", Variant: "openai", Kind: "error-429"}); strings.Contains(got, "gen-fixtures") {
+		t.Errorf("Hint of a kind gen-fixtures does not record: %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// sampleRates is a repeatable method=N flag, recording 1 in N round trips
+// of method.
+type sampleRates map[string]int
+
+func (r sampleRates) String() string {
+	items := make([]string, 0, len(r))
+	for method, n := range r {
+		items = append(items, fmt.Sprintf("%s=%d", method, n))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (r sampleRates) Set(v string) error {
+	method, rate, ok := strings.Cut(v, "=")
+	n, err := strconv.Atoi(rate)
+	if !ok || method == "" || err != nil || n < 1 {
+		return fmt.Errorf("want method=N with N at least 1, got %q", v)
+	}
+	r[method] = n
+	return nil
+}
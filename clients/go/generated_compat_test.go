@@ -0,0 +1,257 @@
+// Code generated by "embednexus transcript gen-tests"; DO NOT EDIT.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// TestGeneratedCompat holds the client's encoder and decoder to the
+// recorded transcripts the cases were generated from.
+func TestGeneratedCompat(t *testing.T) {
+	n := transcript.DefaultNormalizer()
+	for _, c := range generatedCompatCases {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Check(n); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+var generatedCompatCases = []transcript.CompatCase{
+	{
+		Name:     "grpc/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"grpcs://127.0.0.1:<port>","kind":"grpc"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","result":{"heartbeat_interval_ms":0,"protocol_version":"2","session":{"id":"","server_version":"","transport":"grpc"}}}`,
+		Result:   `{"session":{"id":"","transport":"grpc","server_version":""},"heartbeat_interval_ms":0,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "grpc/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","result":{"ok":true,"status":"SERVING"}}`,
+		Result:   `{"ok":true,"status":"SERVING"}`,
+	},
+	{
+		Name:     "grpc/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":""}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","result":{}}`,
+		Result:   `{}`,
+	},
+	{
+		Name:     "http/cbor/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"cbor_typed_arrays":true,"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"codecs":["cbor","json"],"protocol_versions":["2","1"],"transport":{"endpoint":"http://127.0.0.1:<port>/mcp","kind":"http"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"cbor_typed_arrays":true,"codec":"cbor","heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-http-session","server_version":"0.1.0","transport":"http"}}}`,
+		Result:   `{"session":{"id":"go-http-session","transport":"http","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2","codec":"cbor","cbor_typed_arrays":true}`,
+	},
+	{
+		Name:     "http/cbor/request.json/2 mcp.capabilities",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["embed"],"session_id":"go-http-session"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:     "http/cbor/request.json/3 mcp.embed",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha","beta"],"model":"text-embedding-3-large"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"checksum":"0e49c3602c046c42","embeddings":[{"checksum":"49fefe92bd76f6e2","index":0,"vector":"h/gCv8/1C77GAh6/V/cUPw=="},{"checksum":"17eb673a216f046b","index":1,"vector":"sIQoP6GXJz/NkgS+2Fiyvg=="}],"model":"text-embedding-3-large"}}`,
+		Result:   `{"model":"text-embedding-3-large","embeddings":[{"index":0,"vector":[-0.5116047,-0.13667987,-0.6172298,0.5818991],"checksum":"49fefe92bd76f6e2"},{"index":1,"vector":[0.65827465,0.6546574,-0.12946625,-0.34833407],"checksum":"17eb673a216f046b"}],"checksum":"0e49c3602c046c42"}`,
+	},
+	{
+		Name:    "http/errors/rate-limited.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:    "http/errors/refused.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:    "http/errors/server-error.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:    "http/errors/truncated.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:     "http/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"http://127.0.0.1:<port>/mcp","kind":"http"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-http-session","server_version":"0.1.0","transport":"http"}}}`,
+		Result:   `{"session":{"id":"go-http-session","transport":"http","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "http/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{"session_id":"go-http-session","transport":"http"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"ok":true}}`,
+		Result:   `{"ok":true}`,
+	},
+	{
+		Name:     "http/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-http-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:     "http/openai/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"http://127.0.0.1:<port>/v1","kind":"http"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","result":{}}`,
+		Result:   `{"session":{"id":"","transport":"","server_version":""},"heartbeat_interval_ms":0}`,
+	},
+	{
+		Name:     "http/openai/request.json/2 mcp.capabilities",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["embed"]}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","result":{}}`,
+		Result:   `{}`,
+	},
+	{
+		Name:     "http/openai/request.json/3 mcp.embed",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha","beta"],"model":"text-embedding-3-large"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","result":{"embeddings":[{"index":0,"vector":"h/gCv8/1C77GAh6/V/cUPw=="},{"index":1,"vector":"sIQoP6GXJz/NkgS+2Fiyvg=="}],"encoding_format":"base64","model":"text-embedding-3-large","usage":{"prompt_tokens":9,"total_tokens":9}}}`,
+		Result:   `{"model":"text-embedding-3-large","embeddings":[{"index":0,"vector":[-0.5116047,-0.13667987,-0.6172298,0.5818991]},{"index":1,"vector":[0.65827465,0.6546574,-0.12946625,-0.34833407]}],"encoding_format":"base64","usage":{"prompt_tokens":9,"total_tokens":9}}`,
+	},
+	{
+		Name:     "http/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:05:00Z"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","version":"0.1.0"},"transport":{"endpoint":"http://127.0.0.1:8890/mcp","headers":{"x-session-id":"go-http-session"},"kind":"http"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:05:00Z"},"result":{"heartbeat_interval_ms":5000,"session":{"id":"go-http-session","server_version":"0.1.0","sse_endpoint":"http://127.0.0.1:8890/mcp/events","transport":"http"}}}`,
+		Result:   `{"session":{"id":"go-http-session","transport":"http","server_version":"0.1.0","sse_endpoint":"http://127.0.0.1:8890/mcp/events"},"heartbeat_interval_ms":5000}`,
+	},
+	{
+		Name:     "http/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:05:01Z"},"method":"mcp.ping","params":{"sequence":63,"session_id":"go-http-session","transport":"http"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:05:01Z"},"result":{"latency_ms":16,"ok":true,"sequence":63}}`,
+		Result:   `{"latency_ms":16,"ok":true,"sequence":63}`,
+	},
+	{
+		Name:     "http/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:05:02Z"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-http-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:05:02Z"},"result":{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"],"transport":{"kind":"http","supports_compression":true}}}`,
+		Result:   `{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"],"transport":{"kind":"http","supports_compression":true}}`,
+	},
+	{
+		Name:     "stdio/errors/stream-disconnect.json/1 mcp.embed.stream",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed.stream","params":{"encoding_format":"base64","inputs":["alpha","beta"],"model":"text-embedding-3-large"}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","result":{"checksum":"49fefe92bd76f6e2","index":0,"vector":[-0.5116047,-0.13667987,-0.6172298,0.5818991]}}`,
+		Result:   `{"index":0,"vector":[-0.5116047,-0.13667987,-0.6172298,0.5818991],"checksum":"49fefe92bd76f6e2"}`,
+	},
+	{
+		Name:    "stdio/errors/truncated.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:     "stdio/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"stdio://session","kind":"stdio"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-stdio-session","server_version":"0.1.0","transport":"stdio"}}}`,
+		Result:   `{"session":{"id":"go-stdio-session","transport":"stdio","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "stdio/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{"session_id":"go-stdio-session","transport":"stdio"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"ok":true}}`,
+		Result:   `{"ok":true}`,
+	},
+	{
+		Name:     "stdio/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-stdio-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:     "stdio/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:00:00Z"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","version":"0.1.0"},"transport":{"endpoint":"stdio://session","kind":"stdio"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:00:00Z"},"result":{"heartbeat_interval_ms":5000,"session":{"id":"go-stdio-session","server_version":"0.1.0","transport":"stdio"}}}`,
+		Result:   `{"session":{"id":"go-stdio-session","transport":"stdio","server_version":"0.1.0"},"heartbeat_interval_ms":5000}`,
+	},
+	{
+		Name:     "stdio/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:00:01Z"},"method":"mcp.ping","params":{"session_id":"go-stdio-session","transport":"stdio"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:00:01Z"},"result":{"latency_ms":13,"ok":true}}`,
+		Result:   `{"latency_ms":13,"ok":true}`,
+	},
+	{
+		Name:     "stdio/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:00:02Z"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-stdio-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:00:02Z"},"result":{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:    "tls/errors/tls-handshake.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:     "tls/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"https://127.0.0.1:<port>/mcp","kind":"tls"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-tls-session","server_version":"0.1.0","transport":"tls"}}}`,
+		Result:   `{"session":{"id":"go-tls-session","transport":"tls","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "tls/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{"session_id":"go-tls-session","transport":"tls"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"ok":true}}`,
+		Result:   `{"ok":true}`,
+	},
+	{
+		Name:     "tls/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-tls-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:     "tls/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:10:00Z"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","version":"0.1.0"},"transport":{"ca_bundle":"tests/certs/root-ca.pem","endpoint":"https://localhost:9443/mcp","kind":"tls","sni":"localhost"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"sequence":1,"timestamp":"2024-01-17T10:10:00Z"},"result":{"heartbeat_interval_ms":3000,"peer_certificate":{"fingerprint":"AB:CD:EF:03","subject":"CN=localhost"},"session":{"alpn":"h2","id":"go-tls-session","server_version":"0.1.0","transport":"tls"}}}`,
+		Result:   `{"session":{"id":"go-tls-session","transport":"tls","server_version":"0.1.0","alpn":"h2"},"heartbeat_interval_ms":3000,"peer_certificate":{"subject":"CN=localhost","fingerprint":"AB:CD:EF:03"}}`,
+	},
+	{
+		Name:     "tls/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:10:01Z"},"method":"mcp.ping","params":{"sequence":35,"session_id":"go-tls-session","transport":"tls"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"sequence":2,"timestamp":"2024-01-17T10:10:01Z"},"result":{"latency_ms":20,"ok":true,"sequence":35}}`,
+		Result:   `{"latency_ms":20,"ok":true,"sequence":35}`,
+	},
+	{
+		Name:     "tls/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:10:02Z"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-tls-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"sequence":3,"timestamp":"2024-01-17T10:10:02Z"},"result":{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"],"transport":{"kind":"tls","modes":["mutual","server"]}}}`,
+		Result:   `{"prompts":["summarize","rewrite"],"resources":["vector-store"],"tools":["search"],"transport":{"kind":"tls","modes":["mutual","server"]}}`,
+	},
+	{
+		Name:    "unix/errors/refused.json/1 mcp.embed",
+		Request: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.embed","params":{"encoding_format":"base64","inputs":["alpha"],"model":"text-embedding-3-large"}}`,
+	},
+	{
+		Name:     "unix/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"unix://<socket>","kind":"unix"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-unix-session","server_version":"0.1.0","transport":"unix"}}}`,
+		Result:   `{"session":{"id":"go-unix-session","transport":"unix","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "unix/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{"session_id":"go-unix-session","transport":"unix"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"ok":true}}`,
+		Result:   `{"ok":true}`,
+	},
+	{
+		Name:     "unix/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-unix-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+	{
+		Name:     "ws/fake/request.json/1 mcp.initialize",
+		Request:  `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"method":"mcp.initialize","params":{"capabilities":["handshake","ping","capabilities"],"client":{"language":"go","name":"zaevrynth-go-client","user_agent":"<user-agent>","version":"0.1.0"},"protocol_versions":["2","1"],"transport":{"endpoint":"ws://127.0.0.1:<port>/mcp","kind":"ws"}}}`,
+		Response: `{"id":1,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":1,"timestamp":"<timestamp>"},"result":{"heartbeat_interval_ms":5000,"protocol_version":"2","session":{"id":"go-ws-session","server_version":"0.1.0","transport":"ws"}}}`,
+		Result:   `{"session":{"id":"go-ws-session","transport":"ws","server_version":"0.1.0"},"heartbeat_interval_ms":5000,"protocol_version":"2"}`,
+	},
+	{
+		Name:     "ws/fake/request.json/2 mcp.ping",
+		Request:  `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"method":"mcp.ping","params":{"session_id":"go-ws-session","transport":"ws"}}`,
+		Response: `{"id":2,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":2,"timestamp":"<timestamp>"},"result":{"ok":true}}`,
+		Result:   `{"ok":true}`,
+	},
+	{
+		Name:     "ws/fake/request.json/3 mcp.capabilities",
+		Request:  `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"method":"mcp.capabilities","params":{"requested":["prompts","resources","tools"],"session_id":"go-ws-session"}}`,
+		Response: `{"id":3,"jsonrpc":"2.0","meta":{"request_id":"<request-id>","sequence":3,"timestamp":"<timestamp>"},"result":{"resources":["vector-store"],"tools":["search"]}}`,
+		Result:   `{"resources":["vector-store"],"tools":["search"]}`,
+	},
+}
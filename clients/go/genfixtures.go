@@ -0,0 +1,796 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/embedpb"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fakeembed"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// localFixtureDir is where gen-fixtures writes by default. The transcript
+// tests prefer the fixtures below it to the downloaded ones.
+var localFixtureDir = filepath.Join(defaultFixtureDir, "local")
+
+// genFixtureTransports are the transports gen-fixtures can serve.
+var genFixtureTransports = []string{client.TransportStdio, client.TransportHTTP, client.TransportTLS, client.TransportUnix, client.TransportGRPC, client.TransportWebSocket}
+
+// openaiFixture is the gen-fixtures target recording an embed of
+// embedFixtureInputs through the OpenAICompat adapter, against the fake
+// embedder serving the OpenAI API over http.
+const openaiFixture = "openai"
+
+// fakeFixtureVariant is the directory below each transport's of
+// gen-fixtures holding the committed goldens of the scripted session
+// recorded against the fake embedder, which TestGoClientTranscripts
+// compares with. The request.json and response.json beside it were
+// recorded against a live server.
+const fakeFixtureVariant = "fake"
+
+// cborFixture is the gen-fixtures target recording an embed of
+// embedFixtureInputs over http with the CBOR codec negotiated, vectors
+// answered as typed arrays.
+const cborFixture = "cbor"
+
+var embedFixtureInputs = []string{"alpha", "beta"}
+
+// genFixtureTargets are the transports and other targets gen-fixtures
+// records.
+var genFixtureTargets = append(append([]string(nil), genFixtureTransports...), openaiFixture, cborFixture, errorsFixture)
+
+// fixtureVariants maps the targets recording a variant of a transport to
+// that transport, in whose directory their own is kept.
+var fixtureVariants = map[string]string{openaiFixture: client.TransportHTTP, cborFixture: client.TransportHTTP}
+
+// fixtureDir returns the directory of target's fixtures below <tree>/go.
+func fixtureDir(target string) string {
+	if transport, ok := fixtureVariants[target]; ok {
+		return filepath.Join(transport, target)
+	}
+	return target
+}
+
+// serveFakeCommand is the hidden subcommand serving the fake embedder on
+// stdin and stdout, which gen-fixtures spawns for the stdio transport. An
+// argument names a fault to inject, such as "serve-fake hang".
+const serveFakeCommand = "serve-fake"
+
+// genFixtureTimeout bounds the session recorded for one transport.
+const genFixtureTimeout = 30 * time.Second
+
+// runGenFixtures implements "embednexus gen-fixtures [transport ...]": for
+// each transport, a deterministic fake embedder is served locally, the
+// scripted session is run against it, and its requests and responses are
+// written, normalized, to <out>/go/<transport>/request.json and
+// response.json; the openai and cbor targets record an embed over the
+// OpenAI API, or one in CBOR, into <out>/go/http/openai and
+// <out>/go/http/cbor instead, and the errors target the sessions of
+// errorScenarios into <out>/go/<transport>/errors. Without arguments it
+// covers every target with fixtures in <fixtures>/go.
+func runGenFixtures(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus gen-fixtures", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	out := flags.String("out", localFixtureDir, "fixture tree to write <out>/go/<transport>/request.json and response.json into")
+	dir := flags.String("fixtures", defaultFixtureDir, "fixture tree whose go/<transport> directories pick the default transports")
+	rulesPath := flags.String("normalize-rules", "", "normalization rules applied to the fixtures (default <fixtures>/"+transcript.NormalizeRulesFile+" when present)")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: embednexus gen-fixtures [flags] [transport ...] (transports: %v)\n", genFixtureTargets)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	transports := flags.Args()
+	if len(transports) == 0 {
+		for _, transport := range genFixtureTargets {
+			if transport == errorsFixture {
+				if errorFixturesExist(*dir) {
+					transports = append(transports, transport)
+				}
+			} else if fileExists(filepath.Join(*dir, client.ClientMarker, fixtureDir(transport), "request.json")) ||
+				fileExists(filepath.Join(*dir, client.ClientMarker, transport, fakeFixtureVariant, "request.json")) {
+				transports = append(transports, transport)
+			}
+		}
+	}
+	for _, transport := range transports {
+		if !containsString(genFixtureTargets, transport) {
+			fmt.Fprintf(stderr, "embednexus: gen-fixtures cannot serve transport %q (supported: %v)\n", transport, genFixtureTargets)
+			return exitUsage
+		}
+	}
+	if *rulesPath == "" {
+		if candidate := filepath.Join(*dir, transcript.NormalizeRulesFile); fileExists(candidate) {
+			*rulesPath = candidate
+		}
+	}
+	var rules *transcript.Normalizer
+	if *rulesPath != "" {
+		var err error
+		if rules, err = transcript.LoadNormalizer(*rulesPath); err != nil {
+			fmt.Fprintf(stderr, "embednexus: normalization rules: %v\n", err)
+			return exitUsage
+		}
+	}
+	for _, transport := range transports {
+		if transport == errorsFixture {
+			if err := genErrorFixtures(ctx, *out, rules); err != nil {
+				fmt.Fprintf(stderr, "embednexus: %s: %v\n", transport, err)
+				return exitFailure
+			}
+			fmt.Fprintf(stderr, "embednexus: wrote error fixtures to %s\n", filepath.Join(*out, client.ClientMarker, "*", errorFixtureDir))
+			continue
+		}
+		target := filepath.Join(*out, client.ClientMarker, fixtureDir(transport))
+		if err := genFixture(ctx, transport, target, rules); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %s: %v\n", transport, err)
+			return exitFailure
+		}
+		fmt.Fprintf(stderr, "embednexus: wrote %s fixtures to %s\n", transport, target)
+	}
+	return exitOK
+}
+
+// genFixture records the scripted session over transport against the fake
+// embedder and writes its request and response fixtures into dir.
+func genFixture(ctx context.Context, transport, dir string, rules *transcript.Normalizer) error {
+	tmp, err := os.MkdirTemp("", "embednexus-fixtures-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	ctx, cancel := context.WithTimeout(ctx, genFixtureTimeout)
+	defer cancel()
+
+	fake, err := serveFake(transport, tmp)
+	if err != nil {
+		return err
+	}
+	defer fake.Close()
+	session := filepath.Join(tmp, "session.json")
+	opts := client.Options{Config: fake.Config, RecordTranscript: session}
+	run := client.Run
+	if transport == openaiFixture || transport == cborFixture {
+		opts.Inputs, run = embedFixtureInputs, client.RunEmbed
+	}
+	if err := run(ctx, opts); err != nil {
+		return err
+	}
+	t, err := transcript.Load(session)
+	if err != nil {
+		return err
+	}
+	if t, err = rules.Normalize(t); err != nil {
+		return err
+	}
+	if t, err = fake.Normalize(t); err != nil {
+		return err
+	}
+	for kind, direction := range map[string]string{"request": client.DirectionRequest, "response": client.DirectionResponse} {
+		if err := transcript.Save(filepath.Join(dir, kind+".json"), fixtureOf(t, direction)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixtureOf returns the direction entries of t, as the request and response
+// fixtures hold them, without the summary of the whole session.
+func fixtureOf(t transcript.Transcript, direction string) transcript.Transcript {
+	fixture := t
+	fixture.Messages, fixture.Summary = nil, nil
+	for _, e := range t.Messages {
+		if e.Direction == direction {
+			fixture.Messages = append(fixture.Messages, e)
+		}
+	}
+	return fixture
+}
+
+// fakeServer is the fake embedder served over one transport.
+type fakeServer struct {
+	// Config reaches the server.
+	Config client.ClientConfig
+	// volatile is a value of this run that reaches the transcript, such as
+	// a temporary socket path.
+	volatile string
+	close    func()
+}
+
+// serveFake serves the fake embedder over transport, one of
+// genFixtureTargets, keeping its socket and certificate files in dir.
+// The stdio server is spawned by the client, through serveFakeCommand.
+func serveFake(transport, dir string) (*fakeServer, error) {
+	fake := &fakeServer{Config: client.ClientConfig{Transport: transport}, close: func() {}}
+	switch transport {
+	case client.TransportStdio:
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		fake.Config.Command = []string{exe, serveFakeCommand}
+	case client.TransportHTTP, client.TransportTLS:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		scheme := "http"
+		if transport == client.TransportTLS {
+			caFile := filepath.Join(dir, "ca.pem")
+			tc, err := selfSignedTLS(caFile)
+			if err != nil {
+				ln.Close()
+				return nil, err
+			}
+			ln = tls.NewListener(ln, tc)
+			scheme, fake.Config.TLSCAFiles = "https", []string{caFile}
+		}
+		srv := &http.Server{Handler: defaultFake, ReadHeaderTimeout: genFixtureTimeout}
+		go srv.Serve(ln)
+		fake.close = func() { srv.Close() }
+		fake.Config.Endpoint = scheme + "://" + ln.Addr().String() + "/mcp"
+	case openaiFixture:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(defaultFake.serveOpenAI), ReadHeaderTimeout: genFixtureTimeout}
+		go srv.Serve(ln)
+		fake.close = func() { srv.Close() }
+		fake.Config = client.ClientConfig{Transport: client.TransportHTTP, WireProtocol: client.OpenAICompat, Endpoint: "http://" + ln.Addr().String() + "/v1"}
+	case cborFixture:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(defaultFake.serveCBOR), ReadHeaderTimeout: genFixtureTimeout}
+		go srv.Serve(ln)
+		fake.close = func() { srv.Close() }
+		fake.Config = client.ClientConfig{Transport: client.TransportHTTP, Codecs: []string{client.CodecCBOR}, Endpoint: "http://" + ln.Addr().String() + "/mcp"}
+	case client.TransportGRPC:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		caFile := filepath.Join(dir, "ca.pem")
+		tc, err := selfSignedTLS(caFile)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		// ServeTLS offers h2, which gRPC requires.
+		srv := &http.Server{Handler: http.HandlerFunc(defaultFake.serveGRPC), TLSConfig: tc, ReadHeaderTimeout: genFixtureTimeout}
+		go srv.ServeTLS(ln, "", "")
+		fake.close = func() { srv.Close() }
+		fake.Config.Endpoint, fake.Config.TLSCAFiles = "grpcs://"+ln.Addr().String(), []string{caFile}
+	case client.TransportWebSocket:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		srv := &http.Server{Handler: client.WebSocketHandler(defaultFake.answerPayload), ReadHeaderTimeout: genFixtureTimeout}
+		go srv.Serve(ln)
+		fake.close = func() { srv.Close() }
+		fake.Config.Endpoint = "ws://" + ln.Addr().String() + "/mcp"
+	case client.TransportUnix:
+		fake.Config.SocketPath = filepath.Join(dir, "embednexus.sock")
+		ln, err := net.Listen("unix", fake.Config.SocketPath)
+		if err != nil {
+			return nil, err
+		}
+		go defaultFake.accept(ln)
+		fake.close = func() { ln.Close() }
+		fake.volatile = fake.Config.SocketPath
+	default:
+		return nil, fmt.Errorf("the fake embedder cannot serve transport %q", transport)
+	}
+	return fake, nil
+}
+
+// Normalize replaces the values of this run that reach the transcript and
+// the shared rules leave alone, such as the socket path, by placeholders.
+func (f *fakeServer) Normalize(t transcript.Transcript) (transcript.Transcript, error) {
+	if f.volatile == "" {
+		return t, nil
+	}
+	n, err := transcript.NewNormalizer(transcript.Rule{Match: regexp.QuoteMeta(f.volatile), Placeholder: "<socket>"})
+	if err != nil {
+		return t, err
+	}
+	return n.Normalize(t)
+}
+
+// Close stops the server.
+func (f *fakeServer) Close() {
+	f.close()
+}
+
+// fakeEmbedder answers the handshake, ping, capabilities, embed, and model
+// listing methods with results that depend only on the request, the
+// dimension, and the seed, so every run records the same fixtures.
+type fakeEmbedder struct {
+	// dim is the length of the vectors returned.
+	dim int
+	// seed varies the vectors; the fixtures are recorded with the zero
+	// seed.
+	seed int64
+}
+
+// defaultFake is the embedder gen-fixtures and serve-fake serve.
+var defaultFake = fakeEmbedder{dim: fakeDimension}
+
+// answer returns the response to req.
+func (f fakeEmbedder) answer(req client.Request) (client.Response, error) {
+	result, err := f.result(req)
+	if err != nil {
+		return client.Response{}, err
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return client.Response{}, err
+	}
+	return client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Meta: req.Meta, Result: raw}, nil
+}
+
+// result returns the result of req, vectors as []float32.
+func (f fakeEmbedder) result(req client.Request) (any, error) {
+	var result any
+	switch req.Method {
+	case client.MethodInitialize:
+		var params struct {
+			Transport struct {
+				Kind string `json:"kind"`
+			} `json:"transport"`
+			ProtocolVersions []string `json:"protocol_versions"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		init := client.InitializeResult{
+			Session:             client.Session{ID: "go-" + params.Transport.Kind + "-session", Transport: params.Transport.Kind, ServerVersion: client.ClientVersion},
+			HeartbeatIntervalMS: 5000,
+		}
+		if len(params.ProtocolVersions) > 0 {
+			init.ProtocolVersion = params.ProtocolVersions[0]
+		}
+		result = init
+	case client.MethodPing:
+		result = map[string]any{"ok": true}
+	case client.MethodCapabilities:
+		result = map[string]any{"tools": []string{"search"}, "resources": []string{"vector-store"}}
+	case client.MethodEmbed:
+		var params struct {
+			Model  string   `json:"model"`
+			Inputs []string `json:"inputs"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &client.RPCError{Code: -32602, Message: err.Error()}
+		}
+		embeddings := make([]map[string]any, len(params.Inputs))
+		vectors := make([][]float32, len(params.Inputs))
+		for i, input := range params.Inputs {
+			vectors[i] = f.vector(params.Model, input)
+			embeddings[i] = map[string]any{"index": i, "vector": vectors[i], "checksum": client.VectorChecksum(vectors[i])}
+		}
+		result = map[string]any{"model": params.Model, "embeddings": embeddings, "checksum": client.VectorChecksum(vectors...)}
+	case client.MethodListModels:
+		result = map[string]any{"models": []client.ModelInfo{{Name: client.DefaultModel, Dimension: f.dim}}}
+	default:
+		return nil, &client.RPCError{Code: -32601, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+	return result, nil
+}
+
+// fakeDimension is the length of the vectors defaultFake returns.
+const fakeDimension = 4
+
+// vector returns the vector model embeds input as, which fakeembed derives
+// from the request and the seed alone.
+func (f fakeEmbedder) vector(model, input string) []float32 {
+	return fakeembed.Seeded(f.seed, model, input, f.dim)
+}
+
+// answerPayload decodes one request and encodes the answer to it.
+func (f fakeEmbedder) answerPayload(payload []byte) ([]byte, error) {
+	var req client.Request
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, Error: &client.RPCError{Code: -32700, Message: "parse error: " + err.Error()}})
+	}
+	resp, err := f.answer(req)
+	if err != nil {
+		var rpcErr *client.RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &client.RPCError{Code: -32603, Message: err.Error()}
+		}
+		resp = client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Error: rpcErr}
+	}
+	return json.Marshal(resp)
+}
+
+// Faults "serve-fake <fault>" injects into its answers to mcp.embed, one
+// per class of failure the CLI exit code tells apart.
+const (
+	faultUnauthorized  = "unauthorized"
+	faultModelNotFound = "model-not-found"
+	faultTooLarge      = "too-large"
+	faultServerError   = "server-error"
+	// faultGarbage answers with a line that is not JSON, faultHang never
+	// answers, and faultExit exits.
+	faultGarbage = "garbage"
+	faultHang    = "hang"
+	faultExit    = "exit"
+	// faultTruncate exits halfway through writing the answer, and
+	// faultDisconnect exits after the first frame of an mcp.embed.stream
+	// answer, leaving mcp.embed alone.
+	faultTruncate   = "truncate"
+	faultDisconnect = "disconnect"
+	// faultSlow answers after faultSlowDelay, for runs long enough to
+	// interrupt.
+	faultSlow = "slow"
+)
+
+// faultSlowDelay is how long faultSlow holds each answer.
+const faultSlowDelay = 20 * time.Millisecond
+
+// fakeFaultCodes are the error codes of the faults answered with a JSON-RPC
+// error.
+var fakeFaultCodes = map[string]int{
+	faultUnauthorized:  client.CodeUnauthorized,
+	faultModelNotFound: client.CodeModelNotFound,
+	faultTooLarge:      client.CodePayloadTooLarge,
+	faultServerError:   -32603,
+}
+
+// isFakeFault reports whether serve-fake knows fault.
+func isFakeFault(fault string) bool {
+	_, ok := fakeFaultCodes[fault]
+	return ok || fault == faultGarbage || fault == faultHang || fault == faultExit || fault == faultTruncate || fault == faultDisconnect || fault == faultSlow
+}
+
+// serveStream answers newline-delimited requests from r on w until r ends,
+// as the stdio and unix transports frame them, misbehaving as fault says
+// when it is not empty.
+func (f fakeEmbedder) serveStream(r io.Reader, w io.Writer, fault string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var req client.Request
+		parsed := json.Unmarshal(scanner.Bytes(), &req) == nil
+		if parsed && req.Method == client.MethodEmbedStream {
+			frames, err := f.streamFrames(req)
+			if err != nil {
+				return err
+			}
+			for i, frame := range frames {
+				if fault == faultDisconnect && i == 1 {
+					return nil
+				}
+				if _, err := w.Write(append(frame, '\n')); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		out, err := f.answerPayload(scanner.Bytes())
+		if fault != "" && parsed && req.Method == client.MethodEmbed {
+			switch fault {
+			case faultGarbage:
+				out = []byte("}{ not json")
+			case faultHang:
+				continue
+			case faultExit:
+				return nil
+			case faultTruncate:
+				_, err := w.Write(out[:len(out)/2])
+				return err
+			case faultDisconnect:
+				// Only a stream is cut off.
+			case faultSlow:
+				time.Sleep(faultSlowDelay)
+			default:
+				out, err = json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Error: &client.RPCError{Code: fakeFaultCodes[fault], Message: fault + " (injected)"}})
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(out, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// streamFrames returns the frames answering the mcp.embed.stream request
+// req: one per input, each with the vector mcp.embed would return for it,
+// then the done frame.
+func (f fakeEmbedder) streamFrames(req client.Request) ([][]byte, error) {
+	var params struct {
+		Model  string   `json:"model"`
+		Inputs []string `json:"inputs"`
+	}
+	var results []any
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		results = append(results, map[string]any{"index": 0, "error": &client.RPCError{Code: -32602, Message: err.Error()}})
+	}
+	for i, input := range params.Inputs {
+		v := f.vector(params.Model, input)
+		results = append(results, map[string]any{"index": i, "vector": v, "checksum": client.VectorChecksum(v)})
+	}
+	results = append(results, map[string]any{"done": true})
+	frames := make([][]byte, len(results))
+	for i, result := range results {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if frames[i], err = json.Marshal(client.Response{JSONRPC: client.JSONRPCVersion, ID: req.ID, Result: raw}); err != nil {
+			return nil, err
+		}
+	}
+	return frames, nil
+}
+
+// accept serves each connection accepted from ln until ln closes.
+func (f fakeEmbedder) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			f.serveStream(conn, conn, "")
+		}()
+	}
+}
+
+// ServeHTTP answers a request posted as the http and tls transports send
+// them.
+func (f fakeEmbedder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := f.answerPayload(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// serveCBOR answers as ServeHTTP does, but picks the CBOR codec in the
+// handshake and answers requests posted in CBOR with CBOR, vectors as
+// RFC 8746 typed arrays.
+func (f fakeEmbedder) serveCBOR(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/"+client.CodecCBOR {
+		out, err := f.answerPayload(payload)
+		var req client.Request
+		if json.Unmarshal(payload, &req) == nil && req.Method == client.MethodInitialize {
+			result, _ := f.result(req)
+			init := result.(client.InitializeResult)
+			init.Codec, init.CBORTypedArrays = client.CodecCBOR, true
+			out, err = json.Marshal(map[string]any{"jsonrpc": client.JSONRPCVersion, "id": req.ID, "meta": req.Meta, "result": init})
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+	var req client.Request
+	answer := map[string]any{"jsonrpc": client.JSONRPCVersion}
+	if err := client.CBORCodec.Unmarshal(payload, &req); err != nil {
+		answer["error"] = &client.RPCError{Code: -32700, Message: "parse error: " + err.Error()}
+	} else if result, err := f.result(req); err != nil {
+		var rpcErr *client.RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &client.RPCError{Code: -32603, Message: err.Error()}
+		}
+		answer["id"], answer["error"] = req.ID, rpcErr
+	} else {
+		answer["id"], answer["result"] = req.ID, result
+		if req.Meta != nil {
+			answer["meta"] = req.Meta
+		}
+	}
+	out, err := client.CBORTypedArrayCodec.Marshal(answer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/"+client.CodecCBOR)
+	w.Write(out)
+}
+
+// grpcMethods are the JSON-RPC methods the RPCs of the Embedder service
+// answer.
+var grpcMethods = map[string]string{
+	embedpb.EmbedMethod:      client.MethodEmbed,
+	embedpb.ListModelsMethod: client.MethodListModels,
+	embedpb.CheckMethod:      client.MethodPing,
+}
+
+// serveGRPC answers the unary RPCs of the Embedder service with the results
+// of the methods they stand for, converted through their JSON renderings,
+// whose names the messages share.
+func (f fakeEmbedder) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+		http.Error(w, "not a gRPC message", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	status := func(code int, message string) {
+		w.Header().Set("Grpc-Status", fmt.Sprint(code))
+		w.Header().Set("Grpc-Message", url.PathEscape(message))
+	}
+	method, ok := grpcMethods[r.URL.Path]
+	if !ok {
+		// UNIMPLEMENTED
+		status(12, "unknown method "+r.URL.Path)
+		return
+	}
+	var in, out embedpb.Message
+	switch method {
+	case client.MethodEmbed:
+		in, out = &embedpb.EmbedRequest{}, &embedpb.EmbedResponse{}
+	case client.MethodListModels:
+		in, out = &embedpb.ListModelsRequest{}, &embedpb.ListModelsResponse{}
+	default:
+		in, out = &embedpb.HealthCheckRequest{}, &embedpb.HealthCheckResponse{}
+	}
+	if err := in.Unmarshal(body[5:]); err != nil {
+		// INVALID_ARGUMENT
+		status(3, err.Error())
+		return
+	}
+	params, err := json.Marshal(in)
+	if err == nil {
+		var result any
+		if result, err = f.result(client.Request{Method: method, Params: params}); err == nil {
+			var raw []byte
+			if raw, err = json.Marshal(result); err == nil && method != client.MethodPing {
+				err = json.Unmarshal(raw, out)
+			}
+		}
+	}
+	if err != nil {
+		// INTERNAL
+		status(13, err.Error())
+		return
+	}
+	if check, ok := out.(*embedpb.HealthCheckResponse); ok {
+		check.Status = embedpb.HealthCheckResponse_SERVING
+	}
+	raw := out.Marshal()
+	w.Write(append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(raw))), raw...))
+	status(0, "")
+}
+
+// serveOpenAI answers as the OpenAI API does: /v1/embeddings with the
+// vectors of the embed method, in base64 when asked for, and a token per
+// input byte, and /v1/models with the default model.
+func (f fakeEmbedder) serveOpenAI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var answer any
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/models":
+		answer = map[string]any{"object": "list", "data": []map[string]any{{"id": client.DefaultModel, "object": "model", "owned_by": "embednexus"}}}
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/embeddings":
+		var req struct {
+			Model          string   `json:"model"`
+			Input          []string `json:"input"`
+			EncodingFormat string   `json:"encoding_format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			answer = map[string]any{"error": map[string]any{"message": err.Error(), "type": "invalid_request_error", "code": nil}}
+			break
+		}
+		data := make([]map[string]any, len(req.Input))
+		tokens := 0
+		for i, input := range req.Input {
+			var embedding any = f.vector(req.Model, input)
+			if req.EncodingFormat == client.EncodingBase64 {
+				embedding = base64Vector(f.vector(req.Model, input))
+			}
+			data[i] = map[string]any{"object": "embedding", "index": i, "embedding": embedding}
+			tokens += len(input)
+		}
+		answer = map[string]any{"object": "list", "data": data, "model": req.Model, "usage": map[string]int{"prompt_tokens": tokens, "total_tokens": tokens}}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		answer = map[string]any{"error": map[string]any{"message": "unknown url " + r.URL.Path, "type": "invalid_request_error", "code": "unknown_url"}}
+	}
+	_ = json.NewEncoder(w).Encode(answer)
+}
+
+// base64Vector encodes v as the base64 encoding format does: its
+// little-endian float32 components.
+func base64Vector(v []float32) string {
+	raw := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// selfSignedTLS returns a server configuration with a fresh certificate for
+// 127.0.0.1 and localhost, writing the certificate to caFile for the client
+// to trust.
+func selfSignedTLS(caFile string) (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fixtures"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// TestMain lets gen-fixtures spawn the test binary as the fake stdio server.
+func TestMain(m *testing.M) {
+	// The fake stdio server and the CLI under test are the test binary
+	// itself, re-executed.
+	if len(os.Args) > 1 && os.Args[1] == serveFakeCommand || os.Getenv(cliProcessEnv) != "" {
+		os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr))
+	}
+	// Keep the configuration file of whoever runs the tests out of them.
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(os.TempDir(), "embednexus-test-no-config"))
+	os.Exit(m.Run())
+}
+
+func TestGenFixtures(t *testing.T) {
+	out := t.TempDir()
+	rules := filepath.Join("..", "..", "tests", "fixtures", transcript.NormalizeRulesFile)
+	gen := func(dir string) {
+		t.Helper()
+		var stderr strings.Builder
+		args := append([]string{"gen-fixtures", "--out", dir, "--normalize-rules", rules}, genFixtureTransports...)
+		if code := run(context.Background(), args, &strings.Builder{}, &stderr); code != exitOK {
+			t.Fatalf("gen-fixtures: exit %d: %s", code, stderr.String())
+		}
+	}
+	gen(out)
+	for _, transport := range genFixtureTransports {
+		for _, kind := range []string{"request", "response"} {
+			path := filepath.Join(out, client.ClientMarker, transport, kind+".json")
+			if errs := transcript.Validate(path); errs != nil {
+				t.Fatalf("%s: %v", path, errs)
+			}
+			fixture, err := transcript.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fixture.Transport != transport || len(fixture.Messages) != 3 || fixture.Messages[0].Direction != kind {
+				t.Fatalf("%s: markers %q, %d messages", path, fixture.Transport, len(fixture.Messages))
+			}
+		}
+	}
+
+	// A second run writes the same files.
+	again := t.TempDir()
+	gen(again)
+	for _, transport := range genFixtureTransports {
+		a, _ := os.ReadFile(filepath.Join(out, client.ClientMarker, transport, "request.json"))
+		b, _ := os.ReadFile(filepath.Join(again, client.ClientMarker, transport, "request.json"))
+		if string(a) != string(b) {
+			t.Fatalf("%s request fixture not byte-identical:\n%s\n%s", transport, a, b)
+		}
+	}
+
+	if code := run(context.Background(), []string{"gen-fixtures", "--out", out, client.TransportInProc}, &strings.Builder{}, &strings.Builder{}); code != exitUsage {
+		t.Fatalf("gen-fixtures inproc: exit %d", code)
+	}
+}
+
+// TestOpenAIFixtures records the openai target and compares it with the
+// fixtures under tests/fixtures/go/http/openai, which -update-transcripts
+// regenerates.
+func TestOpenAIFixtures(t *testing.T) {
+	out := t.TempDir()
+	rules := filepath.Join("..", "..", "tests", "fixtures", transcript.NormalizeRulesFile)
+	var stderr strings.Builder
+	if code := run(context.Background(), []string{"gen-fixtures", "--out", out, "--normalize-rules", rules, openaiFixture}, &strings.Builder{}, &stderr); code != exitOK {
+		t.Fatalf("gen-fixtures openai: exit %d: %s", code, stderr.String())
+	}
+	for _, kind := range []string{"request", "response"} {
+		key := fixtures.Key{Lang: client.ClientMarker, Transport: client.TransportHTTP, Variant: openaiFixture, Kind: kind}
+		path := key.File(out)
+		if errs := transcript.Validate(path); errs != nil {
+			t.Fatalf("%s: %v", path, errs)
+		}
+		fixture, err := transcript.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixture.WireProtocol != client.OpenAICompat {
+			t.Fatalf("%s: wire protocol %q", path, fixture.WireProtocol)
+		}
+		transcript.CompareOrUpdate(t, key.File(fixtures.Root()), fixture, *updateTranscripts)
+	}
+}
+
+// TestCBORFixtures records the cbor target and compares it with the
+// fixtures under tests/fixtures/go/http/cbor, which -update-transcripts
+// regenerates.
+func TestCBORFixtures(t *testing.T) {
+	out := t.TempDir()
+	rules := filepath.Join("..", "..", "tests", "fixtures", transcript.NormalizeRulesFile)
+	var stderr strings.Builder
+	if code := run(context.Background(), []string{"gen-fixtures", "--out", out, "--normalize-rules", rules, cborFixture}, &strings.Builder{}, &stderr); code != exitOK {
+		t.Fatalf("gen-fixtures cbor: exit %d: %s", code, stderr.String())
+	}
+	for _, kind := range []string{"request", "response"} {
+		key := fixtures.Key{Lang: client.ClientMarker, Transport: client.TransportHTTP, Variant: cborFixture, Kind: kind}
+		path := key.File(out)
+		if errs := transcript.Validate(path); errs != nil {
+			t.Fatalf("%s: %v", path, errs)
+		}
+		fixture, err := transcript.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixture.Codec != client.CodecCBOR {
+			t.Fatalf("%s: codec %q", path, fixture.Codec)
+		}
+		transcript.CompareOrUpdate(t, key.File(fixtures.Root()), fixture, *updateTranscripts)
+	}
+}
+
+// errorFixtureChecks check the error each of errorScenarios surfaces, by
+// the transport and name of the scenario, and name its class.
+var errorFixtureChecks = map[string]struct {
+	class string
+	check func(err error) bool
+}{
+	"http/refused": {"connection", func(err error) bool { return errors.Is(err, syscall.ECONNREFUSED) }},
+	"unix/refused": {"connection", func(err error) bool { return errors.Is(err, fs.ErrNotExist) }},
+	"tls/tls-handshake": {"connection", func(err error) bool {
+		var unknown x509.UnknownAuthorityError
+		return errors.Is(err, client.ErrTLSHandshake) && errors.As(err, &unknown)
+	}},
+	"http/rate-limited": {"api", func(err error) bool {
+		var apiErr *client.APIError
+		return errors.As(err, &apiErr) && apiErr.Status == 429 && apiErr.Retryable && apiErr.RetryAfter == rateLimitedRetryAfter*time.Second
+	}},
+	"http/server-error": {"api", func(err error) bool {
+		var apiErr *client.APIError
+		var rpcErr *client.RPCError
+		return errors.As(err, &apiErr) && apiErr.Status == 500 && apiErr.Code == fakeFaultCodes[faultServerError] &&
+			apiErr.Retryable && apiErr.ServerRequestID == "fake-request" && errors.As(err, &rpcErr)
+	}},
+	"http/truncated": {"connection", func(err error) bool {
+		return errors.Is(err, io.ErrUnexpectedEOF) && client.BytesRead(err) > 0
+	}},
+	"stdio/truncated": {"protocol", func(err error) bool { return errors.Is(err, client.ErrProtocol) }},
+	"stdio/stream-disconnect": {"connection", func(err error) bool {
+		return errors.Is(err, client.ErrConnectionLost) && !errors.Is(err, client.ErrProtocol)
+	}},
+}
+
+// TestErrorFixtures records each of errorScenarios, checks the error the
+// client surfaced and the failure entry that ends the session, and compares
+// the session with its fixture under tests/fixtures/go/<transport>/errors,
+// which -update-transcripts regenerates.
+func TestErrorFixtures(t *testing.T) {
+	rules, err := transcript.LoadNormalizer(filepath.Join(fixtures.Root(), transcript.NormalizeRulesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range errorScenarios {
+		name := s.Transport + "/" + s.Name
+		t.Run(name, func(t *testing.T) {
+			want, ok := errorFixtureChecks[name]
+			if !ok {
+				t.Fatalf("no check for %s", name)
+			}
+			session, surfaced, err := recordErrorScenario(context.Background(), s, rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !want.check(surfaced) {
+				t.Errorf("surfaced %v (%T)", surfaced, errors.Unwrap(surfaced))
+			}
+			if class := client.ErrorClass(surfaced); class != want.class {
+				t.Errorf("surfaced an error of class %s, want %s", class, want.class)
+			}
+			path := s.File(t.TempDir())
+			if err := transcript.Save(path, session); err != nil {
+				t.Fatal(err)
+			}
+			if errs := transcript.Validate(path); errs != nil {
+				t.Fatalf("%s: %v", path, errs)
+			}
+			last := session.Messages[len(session.Messages)-1]
+			var failure client.Failure
+			if last.Direction != client.DirectionError || json.Unmarshal(last.Message, &failure) != nil || failure.Class != want.class {
+				t.Fatalf("the session ends with %s %s, want a failure of class %s", last.Direction, last.Message, want.class)
+			}
+			transcript.CompareOrUpdate(t, s.File(fixtures.Root()), session, *updateTranscripts)
+		})
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/Zaevrynth/Zaevrynth/clients/go
 
 go 1.21
+
+require (
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/text v0.22.0
+)
@@ -0,0 +1,628 @@
+// Command embednexus is the Go MCP client used for transcript capture and
+// ad-hoc interaction with the embedding server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/export"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses args, executes the requested session, and returns the process
+// exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	// The optional subcommand precedes the flags; without one the CLI runs
+	// the scripted session.
+	if len(args) > 0 && (args[0] == "version" || args[0] == "--version" || args[0] == "-version") {
+		return runVersion(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "validate-fixtures" {
+		return runValidateFixtures(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "transcript" {
+		return runTranscript(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "auditlog" {
+		return runAuditLog(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "cache" {
+		return runCache(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "spool" && (len(args) == 1 || args[1] != "drain") {
+		return runSpool(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "gen-fixtures" {
+		return runGenFixtures(ctx, args[1:], stderr)
+	}
+	if len(args) > 0 && args[0] == "serve-mock" {
+		return runServeMock(ctx, args[1:], os.Stdin, stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == serveFakeCommand {
+		var fault string
+		if len(args) > 1 {
+			fault = args[1]
+		}
+		if fault != "" && !isFakeFault(fault) {
+			fmt.Fprintf(stderr, "embednexus: unknown fault %q\n", fault)
+			return exitUsage
+		}
+		if err := defaultFake.serveStream(os.Stdin, os.Stdout, fault); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	var subcommand string
+	switch {
+	case len(args) > 0 && (args[0] == "ping" || args[0] == "embed" || args[0] == "models" || args[0] == "benchmark" || args[0] == "compare-models" || args[0] == "ready"):
+		subcommand, args = args[0], args[1:]
+	case len(args) > 0 && args[0] == "completion":
+		subcommand, args = args[0], args[1:]
+	case len(args) > 0 && args[0] == completeModelsCommand:
+		// The words of the command line being completed, which may begin
+		// with its subcommand; parse errors only mean no suggestions.
+		subcommand, args, stderr = args[0], args[1:], io.Discard
+		if len(args) > 0 && slices.Contains(completionSubcommands, args[0]) {
+			args = args[1:]
+		}
+	case len(args) > 1 && args[0] == "config" && args[1] == "validate":
+		subcommand, args = "config validate", args[2:]
+	case len(args) > 1 && args[0] == "spool" && args[1] == "drain":
+		subcommand, args = "spool drain", args[2:]
+	case len(args) > 0 && args[0] == "config":
+		fmt.Fprintln(stderr, "embednexus: usage: embednexus config validate [flags]")
+		return exitUsage
+	}
+	fs := flag.NewFlagSet("embednexus", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.String(configFlag, "", "YAML file of flag values, overridden by EMBEDNEXUS_<FLAG> variables and by flags (default $XDG_CONFIG_HOME/embednexus/config.yaml when present)")
+	transport := fs.String("transport", "", "transport to use: stdio, http, tls, http3, grpc, ws, or unix (default: inferred from the --endpoint scheme, else stdio)")
+	endpoint := fs.String("endpoint", "", "server to reach: http://, https:// (tls), grpc:// or grpcs://, ws:// or wss://, unix:///path, or stdio:command")
+	command := fs.String("command", "", "server command line spawned by the stdio transport")
+	socket := fs.String("socket", "", "socket path for the unix transport")
+	apiKey := fs.String("api-key", "", "bearer token authenticating every request, sent as a header over http, tls, http3, and ws and in the request meta over stdio and unix (prefer $EMBEDNEXUS_API_KEY or --api-key-file, which process listings do not show)")
+	apiKeyFile := fs.String("api-key-file", "", "read --api-key from this file, trailing newline trimmed")
+	credentialReload := fs.Duration("credential-reload-interval", 0, "check --api-key-file and --tls-client-cert/--tls-client-key for rotated contents this often, picking them up without a restart (0 disables)")
+	signingKeyID := fs.String("signing-key-id", "", "sign every http, tls, and http3 request with HMAC-SHA256 under this key ID, verifying signed responses")
+	signingSecretFile := fs.String("signing-secret-file", "", "read the --signing-key-id secret from this file, trailing newline trimmed")
+	signingSkew := fs.Duration("signing-clock-skew", client.DefaultSigningClockSkew, "how far a signed response's timestamp may be from the local clock")
+	tlsClientCert := fs.String("tls-client-cert", "", "PEM client certificate presented for mutual TLS")
+	tlsClientKey := fs.String("tls-client-key", "", "PEM private key for --tls-client-cert")
+	var tlsCAs, tlsPins, tlsSANs stringList
+	fs.Var(&tlsCAs, "tls-ca", "PEM CA bundle trusted instead of the system store (repeatable)")
+	fs.Var(&tlsPins, "tls-pin-sha256", "pin the server leaf SPKI SHA-256 digest, hex or base64 (repeatable)")
+	fs.Var(&tlsSANs, "tls-allowed-san", "DNS SAN the server certificate may name, exact or *.domain; every SAN must be allowed (repeatable)")
+	tlsMinVersion := fs.String("tls-min-version", "", "lowest TLS version accepted from the server: 1.0, 1.1, 1.2, or 1.3 (default 1.2)")
+	tlsCiphers := fs.String("tls-ciphers", "", "comma-separated TLS 1.0-1.2 cipher suite names to offer (default: Go's selection)")
+	wsHandshake := fs.Duration("ws-handshake-timeout", client.DefaultWSHandshakeTimeout, "WebSocket dial and handshake timeout")
+	wsPing := fs.Duration("ws-ping-interval", client.DefaultWSPingInterval, "WebSocket keepalive ping interval")
+	dialTimeout := fs.Duration("dial-timeout", 0, "connection setup timeout for the http, tls, stdio, and unix transports (0 disables)")
+	requestTimeout := fs.Duration("request-timeout", 0, "per-request write and read timeout for the http, tls, stdio, and unix transports (0 disables)")
+	framing := fs.String("framing", client.FramingNewline, "stdio and unix frame encoding: newline or length-prefixed")
+	wireProtocol := fs.String("wire-protocol", client.WireNative, "envelopes exchanged with the server: native, jsonrpc2 for plain JSON-RPC 2.0 servers, or openai for OpenAI-compatible embeddings APIs")
+	codecs := fs.String("codecs", "", "comma-separated codecs to offer the server besides json, msgpack or cbor (http transports only)")
+	codecName := fs.String("codec", "", "codec to send every envelope in without negotiating it, such as cbor, for servers expecting it (http transports only)")
+	maxFrameSize := fs.Int("max-frame-size", client.DefaultMaxFrameSize, "largest inbound stdio or unix frame in bytes")
+	maxPipelineDepth := fs.Int("max-pipeline-depth", 0, "requests the stdio, unix, and inproc transports may have outstanding on one stream at once (0 or 1 serializes them)")
+	maxResponseBytes := fs.Int("max-response-bytes", client.DefaultMaxResponseBytes, "largest response to one request in bytes, a stream's frames counted together")
+	maxRequestBytes := fs.Int("max-request-bytes", 0, "largest encoded params of one request in bytes, failing larger ones unsent; 0 for no limit")
+	proxyURL := fs.String("proxy-url", "", "http://, https://, or socks5:// proxy for the http and tls transports (default: HTTP_PROXY/HTTPS_PROXY/NO_PROXY)")
+	dnsRefresh := fs.Duration("dns-refresh", 0, "look the endpoint's host name up again this often, spreading new connections across its addresses (0 disables)")
+	dnsSpread := fs.String("dns-spread", client.SpreadRoundRobin, "how --dns-refresh picks the address of a new connection: round-robin or random")
+	compressAbove := fs.Int("compress-requests-above", 0, "gzip http and tls request bodies larger than this many bytes (0 disables)")
+	capabilityTTL := fs.Duration("capability-ttl", 0, "list the server's models again once the cached list is this old (0 keeps it until the server's answers show it stale)")
+	heartbeatInterval := fs.Duration("heartbeat-interval", 0, "ping idle http and tls connections this often (0 disables)")
+	heartbeatTimeout := fs.Duration("heartbeat-timeout", 0, "bound on each heartbeat ping (default: the interval)")
+	maxRestarts := fs.Int("max-restarts", 0, "times the stdio transport may respawn a server that exits")
+	allowFallback := fs.Bool("allow-fallback", false, "let the http3 transport fall back to HTTP/2 (required: this build has no QUIC stack)")
+	forceProtocol := fs.String("force-protocol-version", "", "offer only this protocol version and use it regardless of the server's answer (debugging)")
+	logInfo := fs.Bool("v", false, "log dials, TLS handshakes, retries, and circuit breaker changes to stderr")
+	logDebug := fs.Bool("vv", false, "also log every request with its ID and envelope sizes (implies -v)")
+	verbose := fs.Bool("verbose", false, "same as -vv")
+	logBodies := fs.Bool("log-bodies", false, "include request and response envelopes, inputs and vectors included, in -vv logs")
+	auditLog := fs.String("audit-log", "", "append a hash-chained JSON line for every request, its input hashed, to this file (check it with embednexus auditlog verify)")
+	auditLogSync := fs.Bool("audit-log-sync", false, "fsync --audit-log after every entry")
+	auditLogMaxBytes := fs.Int64("audit-log-max-bytes", 0, "rotate --audit-log once it reaches this size, continuing the chain in a new file (0 never rotates)")
+	chaos := fs.String("chaos", "", "inject the latency, errors, dropped connections, and duplicates this JSON file describes into every request, below retries (resilience testing)")
+	cacheFile := fs.String("cache-file", "", "keep embeddings in this file across runs, serving repeated inputs without a request (inspect it with embednexus cache stats)")
+	cacheTTL := fs.Duration("cache-ttl", 0, "expire --cache-file entries this old (0 keeps them)")
+	cacheMaxBytes := fs.Int64("cache-max-bytes", 0, "compact --cache-file once it grows past this size, evicting the oldest entries (0 means no limit)")
+	slowThreshold := fs.Duration("slow-request-threshold", 0, "warn on stderr about every request taking longer than this, retries included (0 disables)")
+	wireDump := fs.String("wire-dump", "", "hex-dump every byte sent and received, below the JSON encoding, to this file (debugging framing)")
+	wireDumpMax := fs.Int("wire-dump-max-bytes", client.DefaultWireDumpMaxBytes, "bytes of each read or write --wire-dump shows")
+	wireDumpUnsafe := fs.Bool("wire-dump-unsafe", false, "let --wire-dump run with credentials configured, writing them to the dump in the clear")
+	dryRun := fs.Bool("dry-run", false, "print each request the session would send, headers included and credentials redacted, without contacting the server")
+	model := fs.String("model", client.DefaultModel, "embedding model identifier")
+	output := fs.String("output", "", "output format: json, one document, ndjson, one object per result, csv, table, aligned columns, or, for embed --input-file written to --output-file, arrow, an Arrow IPC file, npy, a NumPy array, or parquet, a Parquet file (default json, ndjson for embed --input-file)")
+	csvColumns := fs.String("csv-columns", "", "comma-separated columns of --output csv or table, nested fields as dotted names such as session.id (default: every field; models tables show name, dimension, and token limit)")
+	csvVectors := fs.String("csv-vectors", client.VectorsFloats, "how --output csv and table write vectors: floats, joined by semicolons, or base64 of little-endian float32s")
+	inputFile := fs.String("input-file", "", "embed the lines of this file, a window at a time, as ndjson (benchmark: cycle through its lines)")
+	outputFile := fs.String("output-file", "", "write the vectors of --input-file here instead of stdout")
+	concurrency := fs.Int("concurrency", 0, "embed requests of --input-file or benchmark in flight at once (default "+fmt.Sprint(client.DefaultBatchConcurrency)+")")
+	duration := fs.Duration("duration", 30*time.Second, "how long benchmark measures requests")
+	warmup := fs.Duration("warmup", 0, "how long benchmark sends requests before measuring them")
+	rps := fs.Float64("rps", 0, "start benchmark requests at this constant rate, timing queued ones from when they were due, instead of keeping --concurrency in flight")
+	modelA := fs.String("model-a", "", "compare-models: the model whose embeddings are the baseline")
+	modelB := fs.String("model-b", "", "compare-models: the model compared against --model-a")
+	worst := fs.Int("worst", client.DefaultCompareWorst, "compare-models: how many of the least similar inputs to list")
+	readyTimeout := fs.Duration("ready-timeout", 30*time.Second, "ready: how long to wait for the server to pass a probe (0 waits until interrupted)")
+	probeInterval := fs.Duration("probe-interval", client.DefaultReadyProbeInterval, "ready: wait after the first failed probe, doubling after each further one")
+	minModels := fs.Int("min-models", 0, "ready: how many models the server must list")
+	requireModel := fs.String("require-model", "", "ready: a model the server must list")
+	resumeFrom := fs.Int64("resume-from", 0, "skip this many lines of --input-file, appending to --output-file")
+	checkpoint := fs.String("checkpoint", "", "record the progress of --input-file here and resume from it when it exists")
+	shutdownGrace := fs.Duration("shutdown-grace", defaultShutdownGrace, "after SIGINT or SIGTERM, how long the requests in flight may finish before they are cut short; a second signal exits at once")
+	parquetRowGroup := fs.Int("parquet-row-group-size", export.DefaultRowGroupSize, "rows of each row group of --output parquet")
+	parquetEmbedding := fs.String("parquet-embedding", export.EmbeddingList, "how --output parquet writes vectors: list, a list of floats, or binary, their little-endian float32s, for vectors of one length")
+	parquetCompression := fs.String("parquet-compression", export.CompressionNone, "compression of --output parquet pages: none, gzip, or zstd")
+	record := fs.String("record-transcript", "", "write the session transcript to this path")
+	listModels := fs.Bool("list-models", false, "list the server's models and include them in the summary")
+	recordModels := fs.String("record-models", "", "write the model listing exchange to this path as a models fixture (implies --list-models)")
+	var redactions stringList
+	fs.Var(&redactions, "redact", "also redact this field name (wildcards allowed, e.g. '*_secret') or /json/pointer in recorded transcripts (repeatable)")
+	noDefaultRedactions := fs.Bool("no-default-redactions", false, "record credentials and idempotency keys instead of redacting them")
+	anonymize := fs.Bool("anonymize", false, "replace request inputs, response texts, and vectors in recorded transcripts with salted hashes, keeping their structure")
+	anonymizeSalt := fs.String("anonymize-salt", "", "salt for --anonymize, so repeated runs hash alike (implies --anonymize; default: random per transcript)")
+	var recordOnly, recordSkip stringList
+	fs.Var(&recordOnly, "record-only", "record only the round trips of this method (wildcards allowed, e.g. 'mcp.*') or transport=<name> (repeatable)")
+	fs.Var(&recordSkip, "record-skip", "leave the round trips of this method (wildcards allowed) or transport=<name> out of recorded transcripts (repeatable)")
+	recordSample := sampleRates{}
+	fs.Var(recordSample, "record-sample", "record 1 in N successful round trips of a method, given as method=N, and every failed one (repeatable)")
+	recordTombstones := fs.Bool("record-tombstones", false, "leave a skipped entry counting each run of filtered-out round trips in recorded transcripts")
+	recordJob := fs.String("record-job", "", "run a small embedding job and write its exchange to this path as a job fixture")
+	transcriptFormat := fs.String("transcript-format", "", "format of recorded transcripts: json or jsonl, appended line by line (default: jsonl for .jsonl paths, else json)")
+	// Fixture regeneration is driven by the test harness, which passes the
+	// flag through; the recorded transcripts are normalized so regenerated
+	// fixtures do not depend on the machine or the clock.
+	updateTranscripts := fs.Bool("update-transcripts", false, "regenerate golden transcripts: normalize the recorded ones with --normalize-rules (used by go test)")
+	normalizeRules := fs.String("normalize-rules", "", "normalization rules applied by --update-transcripts (default "+defaultNormalizeRules+" when present)")
+
+	if subcommand == "completion" {
+		if len(args) != 1 {
+			fmt.Fprintln(stderr, "embednexus: usage: embednexus completion bash|zsh|fish")
+			return exitUsage
+		}
+		if err := writeCompletion(stdout, args[0], fs); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		return exitOK
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) || subcommand == completeModelsCommand {
+			return exitOK
+		}
+		return exitUsage
+	}
+	sources, err := applyConfig(fs, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+	if *apiKeyFile != "" {
+		switch {
+		case sources["api-key"] == "flag" && sources["api-key-file"] == "flag":
+			fmt.Fprintln(stderr, "embednexus: --api-key and --api-key-file cannot be combined")
+			return exitUsage
+		case sources["api-key"] != "flag":
+			// The file, even from the environment or the configuration file,
+			// outranks a key that is not given as a flag. It is read here to
+			// fail early, and again by the client, which reloads it.
+			if _, err := readSecretFile("api key", *apiKeyFile); err != nil {
+				fmt.Fprintf(stderr, "embednexus: %v\n", err)
+				return exitUsage
+			}
+			*apiKey = ""
+		default:
+			*apiKeyFile = ""
+		}
+	}
+	var signing client.SigningConfig
+	if *signingKeyID != "" || *signingSecretFile != "" {
+		if *signingKeyID == "" || *signingSecretFile == "" {
+			fmt.Fprintln(stderr, "embednexus: --signing-key-id and --signing-secret-file must be given together")
+			return exitUsage
+		}
+		secret, err := readSecretFile("signing secret", *signingSecretFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		signing = client.SigningConfig{KeyID: *signingKeyID, Secret: client.Secret(secret), ClockSkew: *signingSkew}
+	}
+	renderer := client.Renderer{Format: *output, Columns: splitList(*csvColumns), Vectors: *csvVectors}
+	if err := renderer.Validate(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+	fileOnly := *output == client.OutputArrow || *output == client.OutputNPY || *output == client.OutputParquet
+	if fileOnly && subcommand != "embed" {
+		fmt.Fprintf(stderr, "embednexus: --output %s is written only by embed\n", *output)
+		return exitUsage
+	}
+	parquet := export.ParquetOptions{RowGroupSize: *parquetRowGroup, Embedding: *parquetEmbedding, Compression: *parquetCompression}
+	if *parquetRowGroup <= 0 {
+		fmt.Fprintln(stderr, "embednexus: --parquet-row-group-size must be positive")
+		return exitUsage
+	}
+	if err := parquet.Validate(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+	var inputs []string
+	switch {
+	case subcommand == "embed":
+		var err error
+		if inputs, err = embedInputs(fs.Args(), os.Stdin); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		switch {
+		case len(inputs) == 0 && *inputFile == "":
+			fmt.Fprintln(stderr, `embednexus: embed needs text to embed (embednexus embed [flags] "text" ..., - for stdin, or --input-file)`)
+			return exitUsage
+		case len(inputs) > 0 && *inputFile != "":
+			fmt.Fprintln(stderr, "embednexus: embed takes text arguments or --input-file, not both")
+			return exitUsage
+		case *inputFile != "" && (*output == client.OutputJSON || *output == client.OutputTable):
+			fmt.Fprintln(stderr, "embednexus: --input-file writes ndjson, csv, arrow, npy, or parquet")
+			return exitUsage
+		case fileOnly && (*inputFile == "" || *outputFile == ""):
+			fmt.Fprintf(stderr, "embednexus: --output %s writes --input-file to --output-file\n", *output)
+			return exitUsage
+		case fileOnly && (*resumeFrom > 0 || *checkpoint != ""):
+			fmt.Fprintf(stderr, "embednexus: --output %s cannot be combined with --resume-from or --checkpoint\n", *output)
+			return exitUsage
+		case *concurrency < 0 || *resumeFrom < 0:
+			fmt.Fprintln(stderr, "embednexus: --concurrency and --resume-from must not be negative")
+			return exitUsage
+		}
+	case subcommand == "benchmark":
+		var err error
+		if inputs, err = embedInputs(fs.Args(), os.Stdin); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		switch {
+		case (len(inputs) == 0) == (*inputFile == ""):
+			fmt.Fprintln(stderr, `embednexus: benchmark needs text arguments or --input-file (embednexus benchmark [flags] --input-file samples.txt)`)
+			return exitUsage
+		case *duration <= 0:
+			fmt.Fprintln(stderr, "embednexus: --duration must be positive")
+			return exitUsage
+		case *concurrency < 0 || *warmup < 0 || *rps < 0:
+			fmt.Fprintln(stderr, "embednexus: --concurrency, --warmup, and --rps must not be negative")
+			return exitUsage
+		}
+	case subcommand == "compare-models":
+		var err error
+		if inputs, err = embedInputs(fs.Args(), os.Stdin); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		switch {
+		case *modelA == "" || *modelB == "":
+			fmt.Fprintln(stderr, `embednexus: compare-models needs --model-a and --model-b (embednexus compare-models --model-a v1 --model-b v2 --input-file sample.txt)`)
+			return exitUsage
+		case (len(inputs) == 0) == (*inputFile == ""):
+			fmt.Fprintln(stderr, `embednexus: compare-models needs text arguments or --input-file`)
+			return exitUsage
+		case *concurrency < 0 || *worst < 0:
+			fmt.Fprintln(stderr, "embednexus: --concurrency and --worst must not be negative")
+			return exitUsage
+		}
+	case subcommand == "ready" && (*readyTimeout < 0 || *probeInterval < 0 || *minModels < 0):
+		fmt.Fprintln(stderr, "embednexus: --ready-timeout, --probe-interval, and --min-models must not be negative")
+		return exitUsage
+	case subcommand == completeModelsCommand:
+	case subcommand == "spool drain":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(stderr, "embednexus: usage: embednexus spool drain [flags] <dir>")
+			return exitUsage
+		}
+	case fs.NArg() > 0:
+		fmt.Fprintf(stderr, "embednexus: unexpected argument %q (subcommands go first: embednexus ping [flags])\n", fs.Arg(0))
+		return exitUsage
+	case subcommand == "config validate":
+		if err := printConfig(stdout, fs, sources); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	// Flags with a NewClient option go through it; the rest have no option
+	// and are passed as the base configuration.
+	var clientOpts []client.Option
+	if *transport != "" {
+		clientOpts = append(clientOpts, client.WithTransport(*transport))
+	}
+	if *requestTimeout > 0 {
+		clientOpts = append(clientOpts, client.WithTimeout(*requestTimeout))
+	}
+	if *logInfo || *logDebug || *verbose {
+		level := slog.LevelInfo
+		if *logDebug || *verbose {
+			level = slog.LevelDebug
+		}
+		logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+		clientOpts = append(clientOpts, client.WithLogger(logger))
+	}
+	recorderConfig := client.RecorderConfig{
+		Redactions:          redactions,
+		NoDefaultRedactions: *noDefaultRedactions,
+		Format:              *transcriptFormat,
+		Anonymize:           *anonymize || *anonymizeSalt != "",
+		AnonymizeSalt:       *anonymizeSalt,
+		Filter: client.RecordFilter{
+			Only:       recordOnly,
+			Skip:       recordSkip,
+			Sample:     recordSample,
+			Tombstones: *recordTombstones,
+		},
+	}
+	opts := client.Options{
+		Endpoint:      *endpoint,
+		ClientOptions: clientOpts,
+		Config: client.ClientConfig{
+			Command:    strings.Fields(*command),
+			SocketPath: *socket,
+			APIKey:     client.Secret(*apiKey),
+			APIKeyFile: *apiKeyFile,
+			Signing:    signing,
+			Model:      *model,
+
+			CredentialReloadInterval: *credentialReload,
+
+			TLSClientCert:         *tlsClientCert,
+			TLSClientKey:          *tlsClientKey,
+			TLSCAFiles:            tlsCAs,
+			TLSPinSHA256:          tlsPins,
+			TLSAllowedSANs:        tlsSANs,
+			TLSMinVersion:         *tlsMinVersion,
+			TLSCipherSuites:       splitList(*tlsCiphers),
+			WSHandshakeTimeout:    *wsHandshake,
+			WSPingInterval:        *wsPing,
+			DialTimeout:           *dialTimeout,
+			Framing:               *framing,
+			WireProtocol:          *wireProtocol,
+			Codecs:                splitList(*codecs),
+			Codec:                 *codecName,
+			MaxFrameSize:          *maxFrameSize,
+			MaxPipelineDepth:      *maxPipelineDepth,
+			MaxResponseBytes:      *maxResponseBytes,
+			MaxRequestBytes:       *maxRequestBytes,
+			ProxyURL:              *proxyURL,
+			DNS:                   client.DNSPolicy{Refresh: *dnsRefresh, Spread: *dnsSpread},
+			CompressRequestsAbove: *compressAbove,
+			Capabilities:          client.CapabilityPolicy{TTL: *capabilityTTL},
+			HeartbeatInterval:     *heartbeatInterval,
+			HeartbeatTimeout:      *heartbeatTimeout,
+			MaxRestarts:           *maxRestarts,
+			AllowFallback:         *allowFallback,
+			ForceProtocolVersion:  *forceProtocol,
+			LogBodies:             *logBodies,
+			WireDumpMaxBytes:      *wireDumpMax,
+			WireDumpUnsafe:        *wireDumpUnsafe,
+			OnReconnect: func(ev client.ReconnectEvent) {
+				fmt.Fprintf(stderr, "embednexus: restarted %s server (restart %d): %v\n", ev.Transport, ev.Attempt, ev.Cause)
+			},
+			SlowRequests: client.SlowRequestPolicy{
+				Threshold: *slowThreshold,
+				OnSlow: func(info client.SlowRequestInfo) {
+					fmt.Fprintf(stderr, "embednexus: slow %s request %s: %v (threshold %v, batch of %d, retried %t)\n", info.Method, info.RequestID, info.Duration.Round(time.Millisecond), info.Threshold, info.BatchSize, info.Retried)
+				},
+			},
+			OnCredentialReload: func(ev client.CredentialReload) {
+				fmt.Fprintf(stderr, "embednexus: reloaded %s from %s (%s -> %s)\n", ev.Kind, ev.Path, ev.OldFingerprint, ev.NewFingerprint)
+			},
+		},
+		ListModels:    *listModels,
+		RecordModels:  *recordModels,
+		RecordJob:     *recordJob,
+		Inputs:        inputs,
+		Output:        renderer,
+		InputFile:     *inputFile,
+		OutputFile:    *outputFile,
+		Concurrency:   *concurrency,
+		ResumeFrom:    *resumeFrom,
+		Checkpoint:    *checkpoint,
+		Progress:      stderr,
+		Parquet:       parquet,
+		Recorder:      recorderConfig,
+		Stdout:        stdout,
+		DryRun:        *dryRun,
+		Benchmark:     client.Benchmark{Duration: *duration, Warmup: *warmup, RPS: *rps},
+		CompareModels: client.CompareModels{ModelA: *modelA, ModelB: *modelB, Worst: *worst},
+		Ready:         client.ReadyOptions{MinModels: *minModels, RequireModel: *requireModel, ProbeInterval: *probeInterval, Timeout: *readyTimeout},
+	}
+	if subcommand == completeModelsCommand {
+		return completeModels(ctx, opts, stdout)
+	}
+	if *auditLog != "" {
+		audit, err := client.OpenAuditLog(*auditLog, client.AuditLogOptions{Sync: *auditLogSync, MaxBytes: *auditLogMaxBytes})
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		defer audit.Close()
+		opts.ClientOptions = append(opts.ClientOptions, client.WithInterceptor(audit.Intercept))
+	}
+	if *chaos != "" {
+		c, err := client.LoadChaos(*chaos)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "embednexus: chaos seed %d\n", c.Seed())
+		opts.Chaos = c
+	}
+	if *cacheFile != "" {
+		cache, err := client.OpenDiskCache(*cacheFile, client.DiskCacheOptions{TTL: *cacheTTL, MaxBytes: *cacheMaxBytes})
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		defer cache.Close()
+		opts.Config.Cache.Disk = cache
+	}
+	if subcommand == "spool drain" {
+		spool, err := openSpoolDir(fs.Arg(0), client.SpoolOptions{OnComplete: spoolResultWriter(stdout, stderr)})
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		opts.Config.Spool = spool
+	}
+	if *wireDump != "" {
+		f, err := os.OpenFile(*wireDump, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: wire dump: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		opts.Config.WireDump = f
+	}
+	// The session transcript is written as it is recorded, so a session
+	// that fails or is interrupted leaves the exchange up to that point.
+	var session *transcript.Recorder
+	if *record != "" {
+		sink, err := transcript.NewFileSink(*record, *transcriptFormat)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		session = transcript.NewRecorder(sink)
+		session.Config = recorderConfig
+		opts.TranscriptRecorder = session
+	}
+	runSession := client.Run
+	switch subcommand {
+	case "ping":
+		runSession = client.RunPing
+	case "embed":
+		runSession = client.RunEmbed
+	case "models":
+		runSession = client.RunModels
+	case "benchmark":
+		runSession = client.RunBenchmark
+	case "compare-models":
+		runSession = client.RunCompareModels
+	case "ready":
+		runSession = client.RunReady
+	case "spool drain":
+		runSession = client.RunSpoolDrain
+	}
+	// A signal winds the session down: an input file stops after the
+	// window in flight and a benchmark reports what it measured.
+	ctx, sh := handleShutdown(ctx, *shutdownGrace, stderr)
+	defer sh.release()
+	opts.Stop = sh.stopping.Done()
+	err = runSession(ctx, opts)
+	if session != nil {
+		if cerr := session.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("record transcript: %w", cerr))
+		}
+	}
+	if sig := sh.interrupted(); sig != nil {
+		reportInterrupted(stderr, sig, err, *checkpoint)
+		return exitInterrupted
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		var fileErr *client.EmbedFileError
+		switch {
+		case errors.As(err, &fileErr) && *checkpoint != "":
+			fmt.Fprintf(stderr, "embednexus: rerun with the same --checkpoint to resume after line %d\n", fileErr.Resume)
+		case errors.As(err, &fileErr):
+			fmt.Fprintf(stderr, "embednexus: rerun with --resume-from %d to resume\n", fileErr.Resume)
+		}
+		return exitCode(err)
+	}
+	if *updateTranscripts {
+		if err := normalizeRecorded(*normalizeRules, *record, *recordModels, *recordJob); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+	}
+	return exitOK
+}
+
+// reportInterrupted tells what a session stopped by sig left behind: for
+// an input file, the lines embedded and remaining and how to resume.
+func reportInterrupted(stderr io.Writer, sig os.Signal, err error, checkpoint string) {
+	var fileErr *client.EmbedFileError
+	if !errors.As(err, &fileErr) {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		}
+		fmt.Fprintf(stderr, "embednexus: interrupted by %v\n", sig)
+		return
+	}
+	if !errors.Is(err, client.ErrStopped) && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+	}
+	summary := fmt.Sprintf("embednexus: interrupted by %v: %s: %d lines embedded", sig, fileErr.Path, fileErr.Embedded)
+	if fileErr.Remaining >= 0 {
+		summary += fmt.Sprintf(", %d remaining", fileErr.Remaining)
+	}
+	fmt.Fprintln(stderr, summary)
+	if checkpoint != "" {
+		fmt.Fprintf(stderr, "embednexus: checkpoint %s records line %d; rerun with the same --checkpoint to resume\n", checkpoint, fileErr.Resume)
+	} else {
+		fmt.Fprintf(stderr, "embednexus: rerun with --resume-from %d to resume\n", fileErr.Resume)
+	}
+}
+
+// readSecretFile returns the secret, such as an api key, stored in path,
+// without the trailing newline editors add.
+func readSecretFile(what, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s file: %w", what, err)
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" || strings.ContainsAny(secret, "\r\n") {
+		return "", fmt.Errorf("%s file %s: want the %s on one line", what, path, what)
+	}
+	return secret, nil
+}
+
+// embedInputs returns the texts the embed subcommand was given, reading one
+// per non-empty line of stdin in place of a "-" argument.
+func embedInputs(args []string, stdin io.Reader) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if arg != "-" {
+			inputs = append(inputs, arg)
+			continue
+		}
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(nil, client.DefaultMaxFrameSize)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				inputs = append(inputs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,327 @@
+// Package npyio writes embeddings as NumPy files: a .npy of a 2-D float32
+// array, a row per vector, which numpy.load reads as it reads its own, and
+// a .npz archive bundling that array with the identifiers of its rows.
+//
+// Headers are written as numpy.save writes them, format version 1.0 with
+// the data aligned to 64 bytes and the spare room numpy leaves for the row
+// count to grow, so the files are byte for byte those numpy would write for
+// the same array. That spare room lets Writer stream rows of unknown count
+// and fix the shape once it knows it. Reader streams the rows of such a
+// file back, for files too large to load.
+package npyio
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	magic = "\x93NUMPY\x01\x00"
+	// align is the alignment of the data after the header, numpy's
+	// ARRAY_ALIGN.
+	align = 64
+	// growthDigits is the room numpy leaves for the digits of the row
+	// count, its GROWTH_AXIS_MAX_DIGITS.
+	growthDigits = 21
+)
+
+// header is the header of a .npy of rows vectors of dim float32s.
+func header(rows, dim int) []byte {
+	count := strconv.Itoa(rows)
+	dict := "{'descr': '<f4', 'fortran_order': False, 'shape': (" + count + ", " + strconv.Itoa(dim) + "), }"
+	for i := len(count); i < growthDigits; i++ {
+		dict += " "
+	}
+	// The dict, its padding, and a newline fill the header to a multiple
+	// of align; padding never comes to nothing.
+	size := len(dict) + 1
+	pad := align - (len(magic)+2+size)%align
+	h := make([]byte, 0, len(magic)+2+size+pad)
+	h = append(h, magic...)
+	h = binary.LittleEndian.AppendUint16(h, uint16(size+pad))
+	h = append(h, dict...)
+	for i := 0; i < pad; i++ {
+		h = append(h, ' ')
+	}
+	return append(h, '\n')
+}
+
+// dimOf returns the length common to vectors, or an error naming the
+// first that differs.
+func dimOf(vectors [][]float32, dim int) (int, error) {
+	if dim < 0 && len(vectors) > 0 {
+		dim = len(vectors[0])
+	}
+	for i, v := range vectors {
+		if len(v) != dim {
+			return 0, fmt.Errorf("npyio: vector %d has %d components, want %d", i, len(v), dim)
+		}
+	}
+	return max(dim, 0), nil
+}
+
+// writeRows writes vectors as little-endian float32s through row, scratch
+// space for one.
+func writeRows(w io.Writer, vectors [][]float32, row []byte) ([]byte, error) {
+	for _, v := range vectors {
+		row = row[:0]
+		for _, x := range v {
+			row = binary.LittleEndian.AppendUint32(row, math.Float32bits(x))
+		}
+		if _, err := w.Write(row); err != nil {
+			return row, err
+		}
+	}
+	return row, nil
+}
+
+// WriteNPY writes vectors, which must all have the same length, to w as a
+// .npy file of shape (len(vectors), dim).
+func WriteNPY(w io.Writer, vectors [][]float32) error {
+	dim, err := dimOf(vectors, -1)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header(len(vectors), dim)); err != nil {
+		return err
+	}
+	if _, err := writeRows(bw, vectors, make([]byte, 0, 4*dim)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Names of the members of a .npz archive, which numpy.load returns under
+// "vectors" and "ids.json".
+const (
+	VectorsMember = "vectors.npy"
+	IDsMember     = "ids.json"
+)
+
+// WriteNPZ writes a .npz archive to w holding vectors as VectorsMember and
+// ids, the identifier of each row, as IDsMember, a JSON array. numpy.load
+// returns the member that is not an array as its bytes, so
+// json.loads(npz["ids.json"]) reads the identifiers back.
+func WriteNPZ(w io.Writer, vectors [][]float32, ids []string) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("npyio: %d identifiers for %d vectors", len(ids), len(vectors))
+	}
+	if _, err := dimOf(vectors, -1); err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	// numpy.savez stores its members uncompressed.
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: VectorsMember, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if err := WriteNPY(f, vectors); err != nil {
+		return err
+	}
+	if f, err = zw.CreateHeader(&zip.FileHeader{Name: IDsMember, Method: zip.Store}); err != nil {
+		return err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	if err := json.NewEncoder(f).Encode(ids); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Writer streams a .npy file a batch of rows at a time, for runs whose row
+// count is not known until they end. It writes the header with a count of
+// none, and Close rewrites it with the count written, in the same
+// number of bytes. The dimension is that of the first vector written.
+type Writer struct {
+	ws    io.WriteSeeker
+	w     *bufio.Writer
+	start int64
+	rows  int
+	dim   int
+	row   []byte
+}
+
+// NewWriter returns a Writer writing a .npy file to ws from its current
+// offset on.
+func NewWriter(ws io.WriteSeeker) *Writer {
+	return &Writer{ws: ws, w: bufio.NewWriter(ws), dim: -1}
+}
+
+// Write appends vectors, which must have the dimension of the file, as
+// rows.
+func (w *Writer) Write(vectors [][]float32) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+	if w.dim < 0 {
+		if err := w.begin(len(vectors[0])); err != nil {
+			return err
+		}
+	}
+	if _, err := dimOf(vectors, w.dim); err != nil {
+		return err
+	}
+	var err error
+	if w.row, err = writeRows(w.w, vectors, w.row); err != nil {
+		return err
+	}
+	w.rows += len(vectors)
+	return nil
+}
+
+func (w *Writer) begin(dim int) error {
+	var err error
+	if w.start, err = w.ws.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	}
+	w.dim = dim
+	_, err = w.w.Write(header(0, dim))
+	return err
+}
+
+// Close writes the shape of the rows written into the header, leaving ws
+// at the end of the file. A file without rows has the shape (0, 0).
+func (w *Writer) Close() error {
+	if w.dim < 0 {
+		if err := w.begin(0); err != nil {
+			return err
+		}
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	end, err := w.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.ws.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.ws.Write(header(w.rows, w.dim)); err != nil {
+		return err
+	}
+	_, err = w.ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// ErrFormat reports a file Reader cannot read: one that is not a .npy of a
+// 2-D little-endian float32 array in C order, as this package writes them.
+var ErrFormat = errors.New("npyio: not a .npy of float32 rows")
+
+// Fields of a header dict, as numpy writes them.
+var (
+	descrField   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	fortranField = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	shapeField   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// Reader streams the rows of a .npy file a vector at a time, holding one
+// row however many the file has. It reads the files WriteNPY and Writer
+// write, and those numpy.save writes of a 2-D float32 array.
+type Reader struct {
+	r         *bufio.Reader
+	rows, dim int
+	read      int
+	row       []byte
+}
+
+// NewReader reads the header of a .npy file from r, leaving the rows to
+// Read.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var prefix [len(magic) + 2]byte
+	if _, err := io.ReadFull(br, prefix[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if string(prefix[:6]) != magic[:6] {
+		return nil, ErrFormat
+	}
+	// Versions 2.0 and 3.0 count the header in four bytes rather than two.
+	var size int
+	switch prefix[6] {
+	case 1:
+		size = int(binary.LittleEndian.Uint16(prefix[8:]))
+	case 2, 3:
+		var rest [2]byte
+		if _, err := io.ReadFull(br, rest[:]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		size = int(binary.LittleEndian.Uint32(append(prefix[8:], rest[:]...)))
+	default:
+		return nil, fmt.Errorf("%w: format version %d.%d", ErrFormat, prefix[6], prefix[7])
+	}
+	dict := make([]byte, size)
+	if _, err := io.ReadFull(br, dict); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	rows, dim, err := parseHeader(string(dict))
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: br, rows: rows, dim: dim, row: make([]byte, 4*dim)}, nil
+}
+
+// parseHeader returns the shape a header dict describes.
+func parseHeader(dict string) (rows, dim int, err error) {
+	descr := descrField.FindStringSubmatch(dict)
+	fortran := fortranField.FindStringSubmatch(dict)
+	shape := shapeField.FindStringSubmatch(dict)
+	switch {
+	case descr == nil || fortran == nil || shape == nil:
+		return 0, 0, fmt.Errorf("%w: header %q", ErrFormat, strings.TrimSpace(dict))
+	case descr[1] != "<f4":
+		return 0, 0, fmt.Errorf("%w: dtype %s", ErrFormat, descr[1])
+	case fortran[1] != "False":
+		return 0, 0, fmt.Errorf("%w: Fortran order", ErrFormat)
+	}
+	var axes []int
+	for _, axis := range strings.Split(shape[1], ",") {
+		if axis = strings.TrimSpace(axis); axis == "" {
+			continue
+		}
+		n, err := strconv.Atoi(axis)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: shape (%s)", ErrFormat, shape[1])
+		}
+		axes = append(axes, n)
+	}
+	if len(axes) != 2 {
+		return 0, 0, fmt.Errorf("%w: shape (%s) is not 2-D", ErrFormat, shape[1])
+	}
+	return axes[0], axes[1], nil
+}
+
+// Shape returns the number of rows of the file and their dimension.
+func (r *Reader) Shape() (rows, dim int) { return r.rows, r.dim }
+
+// Read returns the next row, or io.EOF after the last. A file that ends
+// before its shape says fails with io.ErrUnexpectedEOF.
+func (r *Reader) Read() ([]float32, error) {
+	if r.read == r.rows {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(r.r, r.row); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("npyio: row %d: %w", r.read, err)
+	}
+	r.read++
+	v := make([]float32, r.dim)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(r.row[4*i:]))
+	}
+	return v, nil
+}
@@ -0,0 +1,168 @@
+package npyio
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The references are what numpy.save writes for these arrays;
+// testdata/gen.py regenerates them with numpy.
+var references = map[string][][]float32{
+	"vectors.npy": {
+		{1, 0.5, -0.25, 3.4028235e38},
+		{float32(math.Copysign(0, -1)), 1e-45, 2, -3},
+		{0.1, 0.2, 0.3, 1.0 / 3},
+	},
+	"tall.npy":  tall(),
+	"empty.npy": nil,
+}
+
+func tall() [][]float32 {
+	rows := make([][]float32, 1000)
+	for i := range rows {
+		rows[i] = []float32{float32(i) * 0.25, float32(-i)}
+	}
+	return rows
+}
+
+func readReference(t *testing.T, name string) []byte {
+	t.Helper()
+	want, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return want
+}
+
+func TestWriteNPYMatchesNumPy(t *testing.T) {
+	for name, vectors := range references {
+		var buf bytes.Buffer
+		if err := WriteNPY(&buf, vectors); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := readReference(t, name); !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: wrote\n%q\nwant\n%q", name, buf.Bytes(), want)
+		}
+	}
+	if err := WriteNPY(io.Discard, [][]float32{{1, 2}, {3}}); err == nil {
+		t.Fatal("WriteNPY accepted vectors of different lengths")
+	}
+}
+
+func TestWriterMatchesNumPy(t *testing.T) {
+	for name, vectors := range references {
+		path := filepath.Join(t.TempDir(), name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Rows arrive in batches of any size, and the shape is only known
+		// at the end.
+		w := NewWriter(f)
+		for start := 0; start < len(vectors); start += 7 {
+			if err := w.Write(vectors[start:min(start+7, len(vectors))]); err != nil {
+				t.Fatalf("%s: Write: %v", name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+		f.Close()
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := readReference(t, name); !bytes.Equal(got, want) {
+			t.Errorf("%s: wrote\n%q\nwant\n%q", name, got, want)
+		}
+	}
+}
+
+func TestReaderReadsNumPy(t *testing.T) {
+	for name, want := range references {
+		r, err := NewReader(bytes.NewReader(readReference(t, name)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if rows, dim := r.Shape(); rows != len(want) || rows > 0 && dim != len(want[0]) {
+			t.Fatalf("%s: shape (%d, %d)", name, rows, dim)
+		}
+		var got [][]float32
+		for {
+			v, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got = append(got, v)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read\n%v\nwant\n%v", name, got, want)
+		}
+	}
+
+	full := readReference(t, "vectors.npy")
+	r, err := NewReader(bytes.NewReader(full[:len(full)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read()
+	r.Read()
+	if _, err := r.Read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("a truncated row read as %v", err)
+	}
+	for _, bad := range [][]byte{
+		[]byte("not a npy file"),
+		bytes.Replace(full, []byte("'<f4'"), []byte("'<f8'"), 1),
+		bytes.Replace(full, []byte("False"), []byte("True "), 1),
+		bytes.Replace(full, []byte("(3, 4)"), []byte("(12,) "), 1),
+	} {
+		if _, err := NewReader(bytes.NewReader(bad)); !errors.Is(err, ErrFormat) {
+			t.Errorf("NewReader(%.40q) = %v", bad, err)
+		}
+	}
+}
+
+func TestWriteNPZ(t *testing.T) {
+	var buf bytes.Buffer
+	ids := []string{"doc-1", "doc-2", "doc-3"}
+	if err := WriteNPZ(&buf, references["vectors.npy"], ids); err != nil {
+		t.Fatalf("WriteNPZ: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	members := make(map[string][]byte)
+	for _, f := range zr.File {
+		if f.Method != zip.Store {
+			t.Errorf("%s is compressed", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	if len(members) != 2 || !bytes.Equal(members[VectorsMember], readReference(t, "vectors.npy")) {
+		t.Fatalf("members %v, vectors %q", len(members), members[VectorsMember])
+	}
+	var back []string
+	if err := json.Unmarshal(members[IDsMember], &back); err != nil || len(back) != 3 || back[2] != "doc-3" {
+		t.Fatalf("ids %s: %v", members[IDsMember], err)
+	}
+	if err := WriteNPZ(io.Discard, references["vectors.npy"], ids[:2]); err == nil {
+		t.Fatal("WriteNPZ accepted fewer identifiers than vectors")
+	}
+}
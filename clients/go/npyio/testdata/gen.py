@@ -0,0 +1,14 @@
+# Regenerates the reference files of the npyio tests with numpy:
+#
+#	python3 gen.py
+#
+# The tests compare what npyio writes with these bytes exactly.
+import numpy as np
+
+np.save("vectors.npy", np.array([
+    [1, 0.5, -0.25, 3.4028235e38],
+    [-0.0, 1e-45, 2, -3],
+    [0.1, 0.2, 0.3, 1 / 3],
+], dtype="<f4"))
+np.save("tall.npy", np.array([[i * 0.25, -i] for i in range(1000)], dtype="<f4"))
+np.save("empty.npy", np.zeros((0, 0), dtype="<f4"))
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// serveMockShutdownTimeout bounds how long serve-mock waits for requests in
+// flight once its context ends.
+const serveMockShutdownTimeout = 5 * time.Second
+
+// runServeMock implements "embednexus serve-mock": it serves a recorded
+// transcript, or the fake embedder, over HTTP, TLS, or stdio until stdin
+// ends or the process is interrupted, logging each request to stderr.
+func runServeMock(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus serve-mock", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	path := flags.String("transcript", "", "recorded transcript to replay")
+	fake := flags.Bool("fake-embedder", false, "answer with deterministic synthetic vectors instead of a transcript")
+	dim := flags.Int("dim", fakeDimension, "length of the fake embedder's vectors")
+	seed := flags.Int64("seed", 0, "seed varying the fake embedder's vectors")
+	listen := flags.String("listen", "", "address to serve HTTP on, such as :8080")
+	useTLS := flags.Bool("tls", false, "serve HTTPS with a self-signed certificate written to a temporary directory")
+	stdio := flags.Bool("stdio", false, "answer newline-delimited requests read from stdin on stdout")
+	grace := flags.Duration("shutdown-grace", defaultShutdownGrace, "after SIGINT or SIGTERM, how long the requests in flight may finish before they are cut short; a second signal exits at once")
+	var match, ignore stringList
+	flags.Var(&match, "match", "match requests on the value at this JSON pointer, such as /method, instead of the whole request (repeatable)")
+	flags.Var(&ignore, "ignore", "leave this JSON pointer out of whole-request matching (repeatable; default /id and /meta)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus serve-mock (--transcript <file> | --fake-embedder) (--listen <addr> [--tls] | --stdio) [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	switch {
+	case flags.NArg() > 0:
+		fmt.Fprintf(stderr, "embednexus: serve-mock takes no arguments, got %q\n", flags.Args())
+		return exitUsage
+	case (*path == "") == !*fake:
+		fmt.Fprintln(stderr, "embednexus: serve-mock needs exactly one of --transcript or --fake-embedder")
+		return exitUsage
+	case (*listen == "") == !*stdio:
+		fmt.Fprintln(stderr, "embednexus: serve-mock needs exactly one of --listen or --stdio")
+		return exitUsage
+	case *useTLS && *stdio:
+		fmt.Fprintln(stderr, "embednexus: serve-mock --tls needs --listen")
+		return exitUsage
+	case *fake && *dim <= 0:
+		fmt.Fprintf(stderr, "embednexus: serve-mock --dim must be positive, got %d\n", *dim)
+		return exitUsage
+	case *fake && (len(match) > 0 || len(ignore) > 0):
+		fmt.Fprintln(stderr, "embednexus: serve-mock --match and --ignore apply to --transcript only")
+		return exitUsage
+	}
+
+	var handler http.Handler
+	var serveStdio func(in io.Reader, out io.Writer) error
+	if *fake {
+		embedder := fakeEmbedder{dim: *dim, seed: *seed}
+		handler = embedder
+		serveStdio = func(in io.Reader, out io.Writer) error { return embedder.serveStream(in, out, "") }
+	} else {
+		t, err := loadReplayTranscript(*path)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		opts := transcript.ReplayOptions{Match: match}
+		if len(ignore) > 0 {
+			opts.Ignore = ignore
+		}
+		replayer, err := transcript.NewReplayer(t, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %s: %v\n", *path, err)
+			return exitFailure
+		}
+		handler, serveStdio = replayer, replayer.ServeStdio
+	}
+
+	ctx, sh := handleShutdown(ctx, *grace, stderr)
+	defer sh.release()
+	log := &requestLog{w: stderr}
+	var err error
+	if *stdio {
+		err = serveStdio(log.stream(sh.stopping, stdin), stdout)
+	} else {
+		err = serveMockHTTP(ctx, sh.stopping, *listen, *useTLS, log.handler(handler), stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: serve-mock: %v\n", err)
+		return exitFailure
+	}
+	if sig := sh.interrupted(); sig != nil {
+		fmt.Fprintf(stderr, "embednexus: interrupted by %v\n", sig)
+		return exitInterrupted
+	}
+	return exitOK
+}
+
+// loadReplayTranscript loads the transcript at path. A fixture holding only
+// responses, such as go/http/response.json, is paired with the request.json
+// beside it so its exchanges can be replayed.
+func loadReplayTranscript(path string) (transcript.Transcript, error) {
+	t, err := transcript.Load(path)
+	if err != nil {
+		return t, err
+	}
+	for _, m := range t.Messages {
+		if m.Direction != client.DirectionResponse {
+			return t, nil
+		}
+	}
+	requestPath := filepath.Join(filepath.Dir(path), "request.json")
+	if requestPath == filepath.Clean(path) || !fileExists(requestPath) {
+		return t, nil
+	}
+	requests, err := transcript.Load(requestPath)
+	if err != nil {
+		return t, err
+	}
+	t.Messages = append(requests.Messages, t.Messages...)
+	return t, nil
+}
+
+// serveMockHTTP serves handler on addr until stopping ends, over TLS with a
+// fresh self-signed certificate when useTLS is set. The requests in flight
+// then finish, until ctx ends, or for serveMockShutdownTimeout when ctx
+// ended first.
+func serveMockHTTP(ctx, stopping context.Context, addr string, useTLS bool, handler http.Handler, stderr io.Writer) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if useTLS {
+		dir, err := os.MkdirTemp("", "embednexus-serve-mock-")
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		caFile := filepath.Join(dir, "ca.pem")
+		cfg, err := selfSignedTLS(caFile)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln, scheme = tls.NewListener(ln, cfg), "https"
+		fmt.Fprintf(stderr, "embednexus: serve-mock certificate written to %s (pass it to --tls-ca)\n", caFile)
+	}
+	fmt.Fprintf(stderr, "embednexus: serve-mock listening on %s://%s/mcp\n", scheme, ln.Addr())
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	select {
+	case err := <-done:
+		return err
+	case <-stopping.Done():
+		shutdownCtx, ended := ctx, ctx.Err() != nil
+		if ended {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(context.Background(), serveMockShutdownTimeout)
+			defer cancel()
+		}
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			if ended {
+				return err
+			}
+			// The grace period is over: cut short what is left.
+			srv.Close()
+		}
+		fmt.Fprintln(stderr, "embednexus: serve-mock stopped")
+		return nil
+	}
+}
+
+// requestLog writes a line per served request.
+type requestLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *requestLog) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "embednexus: serve-mock: "+format+"\n", args...)
+}
+
+// requestSummary names the JSON-RPC method and id of payload.
+func requestSummary(payload []byte) string {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if json.Unmarshal(payload, &req) != nil || req.Method == "" {
+		return fmt.Sprintf("unparsable request (%d bytes)", len(payload))
+	}
+	if len(req.ID) == 0 {
+		return req.Method
+	}
+	return fmt.Sprintf("%s id=%s", req.Method, req.ID)
+}
+
+// statusRecorder keeps the status code an http.Handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// handler logs each request next answers with its status and duration.
+func (l *requestLog) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		payload, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+		summary := requestSummary(payload)
+		if r.Header.Get("Content-Encoding") != "" {
+			summary = fmt.Sprintf("%s request (%d bytes)", r.Header.Get("Content-Encoding"), len(payload))
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		l.printf("%s %s: %d in %s", r.RemoteAddr, summary, rec.status, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// stream returns a reader passing on the lines of in, logging each
+// request, that ends when in does or ctx is done.
+func (l *requestLog) stream(ctx context.Context, in io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			l.printf("stdio %s", requestSummary(line))
+			if _, err := pw.Write(append(append([]byte(nil), line...), '\n')); err != nil {
+				return
+			}
+		}
+		pw.CloseWithError(scanner.Err())
+	}()
+	go func() {
+		<-ctx.Done()
+		pw.Close()
+	}()
+	return pr
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/fakeembed"
+)
+
+// lockedBuilder is a strings.Builder safe for a server goroutine to write
+// while the test reads it.
+type lockedBuilder struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (l *lockedBuilder) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *lockedBuilder) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.String()
+}
+
+func TestServeMockFakeEmbedderOverTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var serverLog lockedBuilder
+	done := make(chan int, 1)
+	go func() {
+		done <- runServeMock(ctx, []string{"--fake-embedder", "--dim", "20", "--seed", "42", "--listen", "127.0.0.1:0", "--tls"}, strings.NewReader(""), &strings.Builder{}, &serverLog)
+	}()
+	listening := regexp.MustCompile(`certificate written to (\S+) .*\n.*listening on (https://\S+)`)
+	var m []string
+	for deadline := time.Now().Add(10 * time.Second); m == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("serve-mock did not start:\n%s", serverLog.String())
+		}
+		m = listening.FindStringSubmatch(serverLog.String())
+	}
+
+	var stdout, stderr strings.Builder
+	args := []string{"embed", "--transport", "tls", "--endpoint", m[2], "--tls-ca", m[1], "--output", "ndjson", "alpha"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("embed: exit %d: %s", code, stderr.String())
+	}
+	var line struct {
+		Vector []float32 `json:"vector"`
+	}
+	if err := json.Unmarshal([]byte(stdout.String()), &line); err != nil {
+		t.Fatalf("embed output %q: %v", stdout.String(), err)
+	}
+	if want := fakeembed.Seeded(42, client.DefaultModel, "alpha", 20); !reflect.DeepEqual(line.Vector, want) {
+		t.Fatalf("vector %v, want %v", line.Vector, want)
+	}
+	if !strings.Contains(serverLog.String(), client.MethodEmbed+" id=") {
+		t.Fatalf("embed request not logged:\n%s", serverLog.String())
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != exitOK || !strings.Contains(serverLog.String(), "serve-mock stopped") {
+			t.Fatalf("interrupted serve-mock: exit %d:\n%s", code, serverLog.String())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve-mock did not shut down")
+	}
+}
+
+func TestServeMockReplaysFixtureOverStdio(t *testing.T) {
+	fixture := filepath.Join("..", "..", "tests", "fixtures", client.ClientMarker, client.TransportHTTP, "response.json")
+	var stdout, stderr strings.Builder
+	stdin := strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"mcp.ping"}` + "\n")
+	args := []string{"--transcript", fixture, "--stdio", "--match", "/method"}
+	if code := runServeMock(context.Background(), args, stdin, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	var resp client.Response
+	if err := json.Unmarshal([]byte(stdout.String()), &resp); err != nil || resp.ID != 7 || resp.Error != nil {
+		t.Fatalf("replayed %q (%v)", stdout.String(), err)
+	}
+	if !strings.Contains(stderr.String(), "stdio mcp.ping id=7") {
+		t.Fatalf("request not logged: %s", stderr.String())
+	}
+
+	for _, args := range [][]string{
+		{"--stdio"},
+		{"--fake-embedder", "--transcript", fixture, "--stdio"},
+		{"--fake-embedder"},
+		{"--fake-embedder", "--stdio", "--tls"},
+		{"--fake-embedder", "--stdio", "--dim", "0"},
+	} {
+		if code := runServeMock(context.Background(), args, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+			t.Errorf("%v: exit %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestFakeEmbedderVectors(t *testing.T) {
+	if got := defaultFake.vector("m", "alpha"); !reflect.DeepEqual(got, fakeembed.Vector("m", "alpha", fakeDimension)) {
+		t.Fatalf("default vector %v", got)
+	}
+	a, b := fakeEmbedder{dim: 40, seed: 1}, fakeEmbedder{dim: 40, seed: 2}
+	if reflect.DeepEqual(a.vector("m", "x"), b.vector("m", "x")) {
+		t.Fatal("vectors do not follow the seed")
+	}
+}
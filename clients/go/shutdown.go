@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownGrace is how long an interrupted subcommand lets the work
+// in flight finish before cutting it short.
+const defaultShutdownGrace = 10 * time.Second
+
+// shutdown is the SIGINT and SIGTERM handling the subcommands share. The
+// first signal ends stopping, so the run starts nothing new, and cancels
+// the run's context once the grace period is over, cutting short what is
+// still in flight; the run then writes out what it finished and ends. A
+// second signal exits at once with exitInterrupted.
+type shutdown struct {
+	// stopping ends at the first signal, or with the run's context.
+	stopping context.Context
+	stop     context.CancelFunc
+	cancel   context.CancelFunc
+	signals  chan os.Signal
+	done     chan struct{}
+
+	mu     sync.Mutex
+	signal os.Signal
+}
+
+// handleShutdown handles signals for a run under the returned context until
+// release is called.
+func handleShutdown(ctx context.Context, grace time.Duration, stderr io.Writer) (context.Context, *shutdown) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopping, stop := context.WithCancel(ctx)
+	s := &shutdown{stopping: stopping, stop: stop, cancel: cancel, signals: make(chan os.Signal, 2), done: make(chan struct{})}
+	signal.Notify(s.signals, os.Interrupt, syscall.SIGTERM)
+	go s.watch(grace, stderr)
+	return ctx, s
+}
+
+func (s *shutdown) watch(grace time.Duration, stderr io.Writer) {
+	select {
+	case sig := <-s.signals:
+		s.mu.Lock()
+		s.signal = sig
+		s.mu.Unlock()
+		fmt.Fprintf(stderr, "embednexus: %v: finishing the work in flight, for up to %v; signal again to exit now\n", sig, grace)
+		s.stop()
+	case <-s.done:
+		return
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	expired := timer.C
+	for {
+		select {
+		case sig := <-s.signals:
+			fmt.Fprintf(stderr, "embednexus: %v again: exiting now\n", sig)
+			os.Exit(exitInterrupted)
+		case <-expired:
+			fmt.Fprintln(stderr, "embednexus: grace period over: cancelling the work in flight")
+			s.cancel()
+			expired = nil
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// interrupted returns the signal that stopped the run, nil when none did.
+func (s *shutdown) interrupted() os.Signal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signal
+}
+
+// release stops handling signals, leaving them to their default action.
+func (s *shutdown) release() {
+	signal.Stop(s.signals)
+	close(s.done)
+	s.cancel()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// startCLI starts the CLI as a subprocess with args, its stderr collected.
+func startCLI(t *testing.T, args ...string) (*exec.Cmd, *lockedBuilder) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), cliProcessEnv+"=1")
+	stderr := &lockedBuilder{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+	return cmd, stderr
+}
+
+// waitExit waits for cmd and returns its exit code.
+func waitExit(t *testing.T, cmd *exec.Cmd, stderr *lockedBuilder) int {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			t.Fatalf("wait: %v\n%s", err, stderr.String())
+		}
+		return cmd.ProcessState.ExitCode()
+	case <-time.After(30 * time.Second):
+		t.Fatalf("the CLI did not exit:\n%s", stderr.String())
+		return 0
+	}
+}
+
+// waitFor polls until ok holds.
+func waitFor(t *testing.T, what string, stderr *lockedBuilder, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(20 * time.Second); !ok(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s:\n%s", what, stderr.String())
+		}
+	}
+}
+
+func TestShutdownInputFile(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.ndjson")
+	checkpoint, record := filepath.Join(dir, "checkpoint.json"), filepath.Join(dir, "session.json")
+	const window, total = 4096, 3 * 4096
+	var texts strings.Builder
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&texts, "line %d\n", i)
+	}
+	if err := os.WriteFile(input, []byte(texts.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"embed", "--transport", "stdio", "--command", exe + " " + serveFakeCommand + " " + faultSlow,
+		"--input-file", input, "--output-file", output, "--checkpoint", checkpoint, "--record-transcript", record}
+
+	// Interrupted once the first window is written, the run finishes the
+	// window in flight and stops.
+	cmd, stderr := startCLI(t, args...)
+	waitFor(t, "the first checkpoint", stderr, func() bool { return fileExists(checkpoint) })
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	if code := waitExit(t, cmd, stderr); code != exitInterrupted {
+		t.Fatalf("exit %d, want %d:\n%s", code, exitInterrupted, stderr.String())
+	}
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp struct{ Lines int64 }
+	if err := json.Unmarshal(data, &cp); err != nil || cp.Lines == 0 || cp.Lines%window != 0 || cp.Lines == total {
+		t.Fatalf("checkpoint %s, %v", data, err)
+	}
+	if n := countLines(t, output); int64(n) != cp.Lines {
+		t.Fatalf("wrote %d lines, checkpoint records %d", n, cp.Lines)
+	}
+	summary := fmt.Sprintf("interrupted by interrupt: %s: %d lines embedded, %d remaining", input, cp.Lines, total-cp.Lines)
+	if !strings.Contains(stderr.String(), summary) || !strings.Contains(stderr.String(), "checkpoint "+checkpoint) {
+		t.Fatalf("stderr lacks %q:\n%s", summary, stderr.String())
+	}
+	if _, err := transcript.Load(record); err != nil {
+		t.Fatalf("transcript of the interrupted run: %v", err)
+	}
+
+	// Rerun, it picks up from the checkpoint and completes.
+	cmd, stderr = startCLI(t, args...)
+	if code := waitExit(t, cmd, stderr); code != exitOK {
+		t.Fatalf("resumed run: exit %d:\n%s", code, stderr.String())
+	}
+	if n := countLines(t, output); n != total {
+		t.Fatalf("wrote %d lines after resuming, want %d", n, total)
+	}
+}
+
+func TestShutdownSecondSignal(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A request that never answers holds the first signal's grace period,
+	// which the second cuts short.
+	cmd, stderr := startCLI(t, "embed", "-vv", "--transport", "stdio", "--command", exe+" "+serveFakeCommand+" "+faultHang, "--shutdown-grace", "1m", "text")
+	waitFor(t, "the session to start", stderr, func() bool { return strings.Contains(stderr.String(), "method=mcp.initialize") })
+	start := time.Now()
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first signal to be handled", stderr, func() bool { return strings.Contains(stderr.String(), "signal again to exit now") })
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if code := waitExit(t, cmd, stderr); code != exitInterrupted || time.Since(start) > 20*time.Second {
+		t.Fatalf("exit %d after %v, want %d at once:\n%s", code, time.Since(start), exitInterrupted, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "exiting now") {
+		t.Fatalf("stderr:\n%s", stderr.String())
+	}
+}
+
+func TestShutdownServeMock(t *testing.T) {
+	cmd, stderr := startCLI(t, "serve-mock", "--fake-embedder", "--listen", "127.0.0.1:0")
+	waitFor(t, "serve-mock to listen", stderr, func() bool { return strings.Contains(stderr.String(), "listening on") })
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if code := waitExit(t, cmd, stderr); code != exitInterrupted || !strings.Contains(stderr.String(), "serve-mock stopped") {
+		t.Fatalf("exit %d, want %d:\n%s", code, exitInterrupted, stderr.String())
+	}
+}
+
+// countLines returns the number of lines of path.
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// spoolUsage lists the spool subcommands.
+const spoolUsage = `usage: embednexus spool <command> [arguments]
+
+commands:
+  status <dir>           report the entries of a spool directory awaiting replay, by model
+  drain [flags] <dir>    replay them now against the server the flags name, writing the results as ndjson
+`
+
+// runSpool implements "embednexus spool status", the tool inspecting the
+// spool directories of client.OpenSpool; "spool drain" connects to a
+// server and runs as a session.
+func runSpool(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, spoolUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "status":
+		return runSpoolStatus(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, spoolUsage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "embednexus: unknown spool command %q\n%s", args[0], spoolUsage)
+	return exitUsage
+}
+
+// runSpoolStatus implements "embednexus spool status dir".
+func runSpoolStatus(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus spool status", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprintln(stderr, "usage: embednexus spool status <dir>") }
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	spool, err := openSpoolDir(flags.Arg(0), client.SpoolOptions{})
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	s := spool.Stats()
+	fmt.Fprintf(stdout, "%s: %d entries, %d bytes", s.Dir, s.Entries, s.Bytes)
+	if !s.Oldest.IsZero() {
+		fmt.Fprintf(stdout, ", oldest spooled %s ago", time.Since(s.Oldest).Round(time.Second))
+	}
+	fmt.Fprintln(stdout)
+	if s.Corrupt > 0 {
+		fmt.Fprintf(stdout, "note: set aside %d unreadable entries in the corrupt subdirectory\n", s.Corrupt)
+	}
+	models := make([]string, 0, len(s.Models))
+	for model := range s.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Fprintf(stdout, "  %s: %d\n", model, s.Models[model])
+	}
+	return exitOK
+}
+
+// openSpoolDir opens the spool in dir, which must exist: OpenSpool would
+// create a misspelled one.
+func openSpoolDir(dir string, opts client.SpoolOptions) (*client.Spool, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("spool: %s is not a directory", dir)
+	}
+	return client.OpenSpool(dir, opts)
+}
+
+// spoolResultLine is the ndjson record "spool drain" writes of each entry
+// it replays.
+type spoolResultLine struct {
+	ID        client.SpoolID `json:"spool_id"`
+	Model     string         `json:"model,omitempty"`
+	SpooledAt time.Time      `json:"spooled_at"`
+	LagMS     int64          `json:"lag_ms"`
+	Inputs    []string       `json:"inputs,omitempty"`
+	Vectors   [][]float32    `json:"vectors,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// spoolResultWriter returns the SpoolOptions.OnComplete of "spool drain",
+// writing each result to w.
+func spoolResultWriter(w io.Writer, stderr io.Writer) func(client.SpoolResult) {
+	enc := json.NewEncoder(w)
+	return func(r client.SpoolResult) {
+		line := spoolResultLine{ID: r.ID, Model: r.Model, SpooledAt: r.SpooledAt, LagMS: r.Lag.Milliseconds(), Inputs: r.Inputs, Vectors: r.Vectors}
+		if r.Err != nil {
+			line.Error = r.Err.Error()
+		}
+		if err := enc.Encode(line); err != nil {
+			fmt.Fprintf(stderr, "embednexus: write spool entry %d: %v\n", r.ID, err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// CompatCase is one recorded exchange a compatibility test holds the
+// client to; GenerateCompatTests writes them as the table of a Go test.
+type CompatCase struct {
+	// Name is the path of the transcript holding the request, relative to
+	// the directory searched, the position of the request in it, and its
+	// method, such as "http/request.json/2 mcp.ping".
+	Name string
+	// Request is the recorded request envelope.
+	Request string
+	// Response is the recorded response envelope answering it, empty for
+	// a request recorded without one.
+	Response string
+	// Result is the response's result as client.DecodeResult decodes it,
+	// marshaled back to JSON, and Error the error of an error response.
+	Result string
+	Error  string
+}
+
+// Check holds the client to c: the request, decoded into a client.Request
+// and encoded again as the client encodes it, must match the recorded one
+// once n has normalized both, and the response must decode to Result or
+// Error. The encoded requests are compared in canonical JSON, with sorted
+// keys, so only their content counts.
+func (c CompatCase) Check(n *Normalizer) error {
+	var req client.Request
+	if err := json.Unmarshal([]byte(c.Request), &req); err != nil {
+		return fmt.Errorf("%s: decode request: %w", c.Name, err)
+	}
+	encoded, err := json.Marshal(req.Wire())
+	if err != nil {
+		return fmt.Errorf("%s: encode request: %w", c.Name, err)
+	}
+	recorded := normalizedMessage(n, client.DirectionRequest, json.RawMessage(c.Request))
+	produced := normalizedMessage(n, client.DirectionRequest, encoded)
+	if diffs := diffValues(recorded, produced, nil); len(diffs) > 0 {
+		return fmt.Errorf("%s: encoded request differs from the recorded one:\n%s", c.Name, joinDifferences(diffs))
+	}
+	if c.Response == "" {
+		return nil
+	}
+	result, rpcErr, err := decodeCompatResponse(req.Method, c.Response)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Name, err)
+	}
+	if result != c.Result || rpcErr != c.Error {
+		return fmt.Errorf("%s: response decoded to result %s, error %s; want result %s, error %s", c.Name, orNone(result), orNone(rpcErr), orNone(c.Result), orNone(c.Error))
+	}
+	return nil
+}
+
+// decodeCompatResponse decodes response, a response to method, as the
+// client does, returning its result or error in JSON.
+func decodeCompatResponse(method, response string) (result, rpcErr string, err error) {
+	var resp client.Response
+	if err := json.Unmarshal([]byte(response), &resp); err != nil {
+		return "", "", fmt.Errorf("decode response: %w", err)
+	}
+	if resp.Error != nil {
+		raw, err := marshal(resp.Error)
+		return "", string(raw), err
+	}
+	if len(resp.Result) == 0 {
+		return "", "", nil
+	}
+	v, err := client.DecodeResult(method, resp.Result)
+	if err != nil {
+		return "", "", err
+	}
+	raw, err := marshal(v)
+	return string(raw), "", err
+}
+
+// normalizedMessage returns msg, a message of direction, as n normalizes it
+// in a transcript, in the generic form Diff walks.
+func normalizedMessage(n *Normalizer, direction string, msg json.RawMessage) any {
+	doc := n.apply(tree(Transcript{Messages: []client.Entry{{Direction: direction, Message: msg}}}))
+	v, _ := lookup(doc, []string{"messages", "0", "message"})
+	return v
+}
+
+func joinDifferences(diffs []Difference) string {
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = "  " + d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// CompatCases collects the exchanges of the transcripts below root, in
+// the order of their sorted paths and, within a transcript, of their
+// requests. A request is answered by the next response with its id in the
+// same transcript or, for fixtures recording a session's requests and
+// responses apart, such as request.json and response.json, in another
+// transcript of the same directory. Stream frames after the first are not
+// cases of their own.
+func CompatCases(root string) ([]CompatCase, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() == NormalizeRulesFile {
+			return nil
+		}
+		if strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".jsonl") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var requests []*compatRequest
+	// The responses of each directory no request of their transcript
+	// awaited, for the requests of its other transcripts.
+	spare := make(map[string][]*compatResponse)
+	var unanswered []*compatRequest
+	for _, path := range files {
+		t, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Dir(path)
+		var pending []*compatRequest
+		answered := make(map[string]bool)
+		n := 0
+		for _, e := range t.Messages {
+			var msg struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			if json.Unmarshal(e.Message, &msg) != nil {
+				return nil, fmt.Errorf("%s: message %s is not an envelope", path, e.Message)
+			}
+			switch e.Direction {
+			case client.DirectionRequest:
+				n++
+				r := &compatRequest{
+					name:    fmt.Sprintf("%s/%d %s", filepath.ToSlash(rel), n, msg.Method),
+					dir:     dir,
+					method:  msg.Method,
+					id:      string(msg.ID),
+					message: e.Message,
+				}
+				requests = append(requests, r)
+				if r.id != "" {
+					pending = append(pending, r)
+				}
+			case client.DirectionResponse:
+				id := string(msg.ID)
+				i := slices.IndexFunc(pending, func(r *compatRequest) bool { return r.id == id })
+				switch {
+				case i >= 0:
+					pending[i].response = e.Message
+					pending = slices.Delete(pending, i, i+1)
+					answered[id] = true
+				case !answered[id]:
+					spare[dir] = append(spare[dir], &compatResponse{id: id, message: e.Message})
+				}
+			}
+		}
+		unanswered = append(unanswered, pending...)
+	}
+	for _, r := range unanswered {
+		for _, resp := range spare[r.dir] {
+			if !resp.used && resp.id == r.id {
+				resp.used, r.response = true, resp.message
+				break
+			}
+		}
+	}
+
+	cases := make([]CompatCase, 0, len(requests))
+	for _, r := range requests {
+		c := CompatCase{Name: r.name}
+		if err := compactInto(&c.Request, r.message); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
+		if r.response != nil {
+			if err := compactInto(&c.Response, r.response); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.name, err)
+			}
+			if c.Result, c.Error, err = decodeCompatResponse(r.method, c.Response); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.name, err)
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// compatRequest is a request CompatCases found, and its response.
+type compatRequest struct {
+	name, dir, method string
+	id                string
+	message, response json.RawMessage
+}
+
+// compatResponse is a response CompatCases found no request for in its
+// transcript.
+type compatResponse struct {
+	id      string
+	message json.RawMessage
+	used    bool
+}
+
+func compactInto(dst *string, msg json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, msg); err != nil {
+		return err
+	}
+	*dst = buf.String()
+	return nil
+}
+
+// GenerateCompatTests writes the Go source of a test in package pkg that
+// runs Check, under transcript.DefaultNormalizer, on each of cases. The
+// same cases always produce the same source.
+func GenerateCompatTests(w io.Writer, pkg string, cases []CompatCase) error {
+	if pkg == "" {
+		return errors.New("generate compatibility tests: no package name")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by "embednexus transcript gen-tests"; DO NOT EDIT.
+
+package %s
+
+import (
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// TestGeneratedCompat holds the client's encoder and decoder to the
+// recorded transcripts the cases were generated from.
+func TestGeneratedCompat(t *testing.T) {
+	n := transcript.DefaultNormalizer()
+	for _, c := range generatedCompatCases {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Check(n); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+var generatedCompatCases = []transcript.CompatCase{
+`, pkg)
+	for _, c := range cases {
+		buf.WriteString("{\n")
+		fmt.Fprintf(&buf, "Name: %s,\n", strconv.Quote(c.Name))
+		fmt.Fprintf(&buf, "Request: %s,\n", goString(c.Request))
+		for _, field := range []struct{ name, value string }{{"Response", c.Response}, {"Result", c.Result}, {"Error", c.Error}} {
+			if field.value != "" {
+				fmt.Fprintf(&buf, "%s: %s,\n", field.name, goString(field.value))
+			}
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("generate compatibility tests: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goString returns s as a Go string literal, raw where it can be.
+func goString(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
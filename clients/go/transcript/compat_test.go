@@ -0,0 +1,151 @@
+package transcript
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestCompatCases(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, doc string) {
+		t.Helper()
+		path := filepath.Join(dir, "http", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Requests and responses recorded apart, as the oldest fixtures are.
+	write("request.json", `[
+		{"jsonrpc":"2.0","id":1,"method":"mcp.initialize","params":{"client":{"name":"go"}},"meta":{"timestamp":"2024-01-17T10:05:00Z","sequence":1}},
+		{"jsonrpc":"2.0","id":2,"method":"mcp.embed","params":{"inputs":["a"],"model":"m","encoding_format":"base64"}}
+	]`)
+	write("response.json", `[
+		{"jsonrpc":"2.0","id":2,"result":{"model":"m","embeddings":[{"index":0,"vector":"AACAPwAAAMA="}]}},
+		{"jsonrpc":"2.0","id":1,"result":{"session":{"id":"s","transport":"http","server_version":"1"},"heartbeat_interval_ms":5000}}
+	]`)
+	// A stream answered in two frames, and a call answered with an error.
+	write("stream.json", `{"transcript_version":2,"client":"go","transport":"http","messages":[
+		{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.embed.stream","params":{"inputs":["a","b"]}}},
+		{"direction":"response","message":{"jsonrpc":"2.0","id":1,"result":{"index":0}}},
+		{"direction":"response","message":{"jsonrpc":"2.0","id":1,"result":{"index":1,"done":true}}},
+		{"direction":"request","message":{"jsonrpc":"2.0","id":2,"method":"mcp.tokens.count","params":{"input":"a"}}},
+		{"direction":"response","message":{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"no such method"}}}
+	]}`)
+
+	cases, err := CompatCases(dir)
+	if err != nil {
+		t.Fatalf("CompatCases: %v", err)
+	}
+	var names []string
+	for _, c := range cases {
+		names = append(names, c.Name)
+		if err := c.Check(DefaultNormalizer()); err != nil {
+			t.Errorf("Check: %v", err)
+		}
+	}
+	want := "http/request.json/1 mcp.initialize,http/request.json/2 mcp.embed,http/stream.json/1 mcp.embed.stream,http/stream.json/2 mcp.tokens.count"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("cases %v", names)
+	}
+	if c := cases[1]; c.Result != `{"model":"m","embeddings":[{"index":0,"vector":[1,-2]}]}` {
+		t.Fatalf("embed decoded to %s", c.Result)
+	}
+	if c := cases[2]; c.Result != `{"index":0}` {
+		t.Fatalf("stream paired with %s, want its first frame", c.Response)
+	}
+	if c := cases[3]; c.Result != "" || !strings.Contains(c.Error, "no such method") {
+		t.Fatalf("error response decoded to result %q, error %q", c.Result, c.Error)
+	}
+
+	// A field the client does not encode, and a result the client reads
+	// differently, fail the check.
+	dropped := cases[0]
+	dropped.Request = strings.Replace(dropped.Request, `"method"`, `"trace":"x","method"`, 1)
+	if err := dropped.Check(DefaultNormalizer()); err == nil || !strings.Contains(err.Error(), "/trace") {
+		t.Fatalf("Check of a request with a dropped field: %v", err)
+	}
+	changed := cases[1]
+	changed.Result = strings.Replace(changed.Result, "-2", "2", 1)
+	if err := changed.Check(DefaultNormalizer()); err == nil {
+		t.Fatal("Check accepted a result the client decodes differently")
+	}
+}
+
+func TestGenerateCompatTests(t *testing.T) {
+	cases := []CompatCase{
+		{Name: "http/request.json/1 mcp.ping", Request: `{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}`, Response: `{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`, Result: `{"ok":true}`},
+		{Name: "raw", Request: "{\"method\":\"a`b\"}"},
+	}
+	var first, second strings.Builder
+	if err := GenerateCompatTests(&first, "compat", cases); err != nil {
+		t.Fatalf("GenerateCompatTests: %v", err)
+	}
+	if err := GenerateCompatTests(&second, "compat", cases); err != nil {
+		t.Fatal(err)
+	}
+	src := first.String()
+	if src != second.String() {
+		t.Fatal("generated source differs between runs")
+	}
+	for _, want := range []string{
+		"// Code generated by \"embednexus transcript gen-tests\"; DO NOT EDIT.",
+		"package compat\n",
+		"Request:  `{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"mcp.ping\"}`,",
+		`Request: "{\"method\":\"a` + "`" + `b\"}",`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source lacks %s:\n%s", want, src)
+		}
+	}
+	if err := GenerateCompatTests(&first, "", cases); err == nil {
+		t.Error("GenerateCompatTests accepted an empty package name")
+	}
+}
+
+// TestCompatChecksums holds the checksummed fixtures gen-fixtures records
+// to their checksums: as recorded they pass, and corrupted they fail the
+// way the client fails a corrupted response.
+func TestCompatChecksums(t *testing.T) {
+	cases, err := CompatCases(filepath.Join("..", "..", "..", "tests", "fixtures", client.ClientMarker))
+	if err != nil {
+		t.Fatalf("CompatCases: %v", err)
+	}
+	checked := 0
+	for _, c := range cases {
+		if !strings.Contains(c.Response, `"checksum"`) {
+			continue
+		}
+		checked++
+		if err := c.Check(DefaultNormalizer()); err != nil {
+			t.Errorf("Check: %v", err)
+		}
+		// Changing a digit of the first component, in either encoding,
+		// keeps the response well formed.
+		corrupted := c
+		switch {
+		case strings.Contains(c.Response, `"vector":"h`):
+			corrupted.Response = strings.Replace(c.Response, `"vector":"h`, `"vector":"i`, 1)
+		case strings.Contains(c.Response, `"vector":[-0.5`):
+			corrupted.Response = strings.Replace(c.Response, `"vector":[-0.5`, `"vector":[-0.6`, 1)
+		default:
+			t.Fatalf("%s: no vector to corrupt in %s", c.Name, c.Response)
+		}
+		err := corrupted.Check(DefaultNormalizer())
+		var ce *client.ChecksumError
+		if !errors.Is(err, client.ErrChecksumMismatch) || !errors.As(err, &ce) || len(ce.Indices) != 1 || ce.Indices[0] != 0 {
+			t.Errorf("Check of a corrupted %s: %v", c.Name, err)
+		}
+	}
+	// The cbor embed and the stream-disconnect frame.
+	if checked < 2 {
+		t.Fatalf("%d checksummed exchanges in the fixtures", checked)
+	}
+}
@@ -0,0 +1,301 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// DefaultCrossCheckValues are the request fields whose values, not only
+// their shapes, every client must agree on.
+var DefaultCrossCheckValues = []string{"/jsonrpc", "/params/protocol_version"}
+
+// CrossCheckOptions tunes CrossCheck.
+type CrossCheckOptions struct {
+	// Normalizer, when set, is applied to both transcripts first.
+	Normalizer *Normalizer
+	// Ignore lists JSON pointers into requests, such as "/params/client",
+	// left unchecked along with the fields below them. A "*" segment matches
+	// any key or index.
+	Ignore []string
+	// Values lists JSON pointers into requests whose values must be equal;
+	// nil means DefaultCrossCheckValues.
+	Values []string
+}
+
+// Incompatibility is one way the requests of two clients disagree.
+type Incompatibility struct {
+	// Method is the request method, and Call its position among the
+	// requests for Method, counting from 0.
+	Method string `json:"method,omitempty"`
+	Call   int    `json:"call"`
+	// Pointer is the JSON pointer into the request, or into the transcript
+	// for its markers.
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Incompatibility) String() string {
+	switch {
+	case i.Method == "":
+		return fmt.Sprintf("%s: %s", i.Pointer, i.Message)
+	case i.Pointer == "":
+		return fmt.Sprintf("%s: %s", i.Method, i.Message)
+	}
+	return fmt.Sprintf("%s request %d: %s: %s", i.Method, i.Call+1, i.Pointer, i.Message)
+}
+
+// CrossCheck compares the requests two clients recorded for the same
+// transport: the negotiated protocol version, which methods each calls and
+// how often, and, call by call, the shape of each request, that is its
+// fields and their JSON types, descending into objects and arrays. Values
+// are compared only at opts.Values, since session ids and client names
+// differ by design. A field one client sends and the other does not is
+// reported with the other client's spelling when the two differ only in
+// case or separators, such as inputText and input_text. CrossCheck returns
+// nil when the clients agree.
+func CrossCheck(a, b Transcript, opts CrossCheckOptions) []Incompatibility {
+	values := opts.Values
+	if values == nil {
+		values = DefaultCrossCheckValues
+	}
+	c := crossChecker{
+		a:      clientName(a, "first"),
+		b:      clientName(b, "second"),
+		ignore: differ{ignore: compileIgnores(opts.Ignore)},
+		values: differ{ignore: compileIgnores(values)},
+	}
+	if c.a == c.b {
+		c.a, c.b = c.a+" (first)", c.b+" (second)"
+	}
+	if wireProtocol(a) != wireProtocol(b) {
+		c.add("", 0, []string{"wire_protocol"}, "wire protocol %s in %s, %s in %s", wireProtocol(a), c.a, wireProtocol(b), c.b)
+	}
+	if a.ProtocolVersion != "" && b.ProtocolVersion != "" && a.ProtocolVersion != b.ProtocolVersion {
+		c.add("", 0, []string{"protocol_version"}, "protocol version %s in %s, %s in %s", a.ProtocolVersion, c.a, b.ProtocolVersion, c.b)
+	}
+	ra := requestsByMethod(opts.Normalizer.apply(tree(a)))
+	rb := requestsByMethod(opts.Normalizer.apply(tree(b)))
+	for _, method := range methodUnion(ra, rb) {
+		ca, cb := ra.calls[method], rb.calls[method]
+		if len(ca) != len(cb) {
+			c.add(method, 0, nil, "sent %s by %s, %s by %s", times(len(ca)), c.a, times(len(cb)), c.b)
+		}
+		for i := 0; i < len(ca) && i < len(cb); i++ {
+			c.compare(method, i, nil, ca[i], cb[i])
+		}
+	}
+	return c.found
+}
+
+// clientName labels t in messages.
+func clientName(t Transcript, fallback string) string {
+	if t.Client != "" {
+		return t.Client
+	}
+	return fallback
+}
+
+// wireProtocol names the wire protocol of t, which transcripts of native
+// sessions leave unmarked.
+func wireProtocol(t Transcript) string {
+	if t.WireProtocol == "" {
+		return client.WireNative
+	}
+	return t.WireProtocol
+}
+
+func times(n int) string {
+	if n == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// methodRequests are a transcript's requests grouped by method, with the
+// methods in the order first sent.
+type methodRequests struct {
+	order []string
+	calls map[string][]map[string]any
+}
+
+func requestsByMethod(doc any) methodRequests {
+	m := methodRequests{calls: make(map[string][]map[string]any)}
+	root, _ := doc.(map[string]any)
+	messages, _ := root["messages"].([]any)
+	for _, item := range messages {
+		entry, _ := item.(map[string]any)
+		if entry["direction"] != client.DirectionRequest {
+			continue
+		}
+		req, ok := entry["message"].(map[string]any)
+		if !ok {
+			continue
+		}
+		method, _ := req["method"].(string)
+		if _, seen := m.calls[method]; !seen {
+			m.order = append(m.order, method)
+		}
+		m.calls[method] = append(m.calls[method], req)
+	}
+	return m
+}
+
+// methodUnion lists the methods of a in order, then those only b sends.
+func methodUnion(a, b methodRequests) []string {
+	methods := append([]string(nil), a.order...)
+	for _, m := range b.order {
+		if _, ok := a.calls[m]; !ok {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+type crossChecker struct {
+	a, b   string
+	ignore differ
+	values differ
+	found  []Incompatibility
+}
+
+func (c *crossChecker) add(method string, call int, path []string, format string, args ...any) {
+	c.found = append(c.found, Incompatibility{Method: method, Call: call, Pointer: pointer(path), Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *crossChecker) compare(method string, call int, path []string, va, vb any) {
+	if c.ignore.ignored(path) {
+		return
+	}
+	if len(path) > 0 && c.values.ignored(path) {
+		if !bytes.Equal(compact(va), compact(vb)) {
+			c.add(method, call, path, "%s in %s, %s in %s", compact(va), c.a, compact(vb), c.b)
+		}
+		return
+	}
+	ta, tb := typeName(va), typeName(vb)
+	if ta != tb {
+		c.add(method, call, path, "%s in %s, %s in %s", ta, c.a, tb, c.b)
+		return
+	}
+	switch na := va.(type) {
+	case map[string]any:
+		nb := vb.(map[string]any)
+		c.compareFields(method, call, path, na, nb, c.a, c.b, true)
+		c.compareFields(method, call, path, nb, na, c.b, c.a, false)
+		keys := make([]string, 0, len(na))
+		for k := range na {
+			if _, ok := nb[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c.compare(method, call, append(path[:len(path):len(path)], k), na[k], nb[k])
+		}
+	case []any:
+		nb := vb.([]any)
+		for i := 0; i < len(na) && i < len(nb); i++ {
+			c.compare(method, call, append(path[:len(path):len(path)], fmt.Sprint(i)), na[i], nb[i])
+		}
+	}
+}
+
+// compareFields reports the fields of x, sent by client xName, that y,
+// from yName, lacks. Fields y spells differently are reported only with
+// aliases set, so each is reported once.
+func (c *crossChecker) compareFields(method string, call int, path []string, x, y map[string]any, xName, yName string, aliases bool) {
+	keys := make([]string, 0, len(x))
+	for k := range x {
+		if _, ok := y[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		at := append(path[:len(path):len(path)], k)
+		if c.ignore.ignored(at) {
+			continue
+		}
+		if alias, ok := spelledAlike(k, y); ok {
+			if aliases {
+				c.add(method, call, at, "sent by %s as %q, by %s as %q", xName, k, yName, alias)
+			}
+			continue
+		}
+		c.add(method, call, at, "sent by %s but not by %s", xName, yName)
+	}
+}
+
+// spelledAlike finds the key of fields that names the same field as key
+// spelled differently, as camelCase and snake_case spell it.
+func spelledAlike(key string, fields map[string]any) (string, bool) {
+	folded := foldFieldName(key)
+	for k := range fields {
+		if k != key && foldFieldName(k) == folded {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func foldFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// SchemaDrift reports, for each response in ts that answers a request in
+// them, the fields of its result the Go client's type for the method has
+// no place for, which client.WithStrictDecoding would reject. The
+// requests and responses of a session may be recorded apart, as in
+// request.json and response.json, and are paired by id in the order
+// given. Methods the client reads as generic JSON are not checked.
+func SchemaDrift(ts ...Transcript) []Incompatibility {
+	type call struct {
+		method string
+		n      int
+	}
+	calls := make(map[string]call)
+	sent := make(map[string]int)
+	// The frames of a stream share the call, which reports each field once.
+	reported := make(map[Incompatibility]bool)
+	var found []Incompatibility
+	for _, t := range ts {
+		for _, e := range t.Messages {
+			var msg struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+				Result json.RawMessage `json:"result"`
+			}
+			if json.Unmarshal(e.Message, &msg) != nil || len(msg.ID) == 0 {
+				continue
+			}
+			switch e.Direction {
+			case client.DirectionRequest:
+				calls[string(msg.ID)] = call{msg.Method, sent[msg.Method]}
+				sent[msg.Method]++
+			case client.DirectionResponse:
+				c, ok := calls[string(msg.ID)]
+				if !ok || len(msg.Result) == 0 {
+					continue
+				}
+				fields, err := client.UnknownFields(c.method, msg.Result)
+				if err != nil {
+					found = append(found, Incompatibility{Method: c.method, Call: c.n, Pointer: "/result", Message: err.Error()})
+					continue
+				}
+				for _, f := range fields {
+					inc := Incompatibility{Method: c.method, Call: c.n, Pointer: "/result" + f, Message: "response field not in the Go client's schema"}
+					if !reported[inc] {
+						reported[inc] = true
+						found = append(found, inc)
+					}
+				}
+			}
+		}
+	}
+	return found
+}
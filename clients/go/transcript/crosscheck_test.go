@@ -0,0 +1,140 @@
+package transcript
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// TestCrossCheckFixtures holds every client to the requests the go client
+// sends over the same transport.
+func TestCrossCheckFixtures(t *testing.T) {
+	rules := sharedRules(t)
+	for _, other := range []string{"python", "node"} {
+		for _, transport := range []string{"http", "stdio", "tls"} {
+			goPath := filepath.Join(fixturesDir, "go", transport, "request.json")
+			otherPath := filepath.Join(fixturesDir, other, transport, "request.json")
+			if _, err := os.Stat(otherPath); err != nil {
+				continue
+			}
+			a, err := Load(goPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Load(otherPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, inc := range CrossCheck(a, b, CrossCheckOptions{Normalizer: rules}) {
+				t.Errorf("%s %s: %s", other, transport, inc)
+			}
+		}
+	}
+}
+
+func TestCrossCheckReportsDrift(t *testing.T) {
+	goSession := session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.embed","params":{"input_text":"a","model":"m","options":{"dimensions":8}}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"mcp.ping","params":{}}`,
+	)
+	goSession.Client, goSession.ProtocolVersion = "go", "2024-11-05"
+	pySession := session(
+		`{"jsonrpc":"2.0","id":7,"method":"mcp.embed","params":{"inputText":"b","model":"n","options":{"dimensions":"8"},"trace":true}}`,
+		`{"jsonrpc":"2.0","id":7,"result":{}}`,
+	)
+	pySession.Client, pySession.ProtocolVersion = "python", "2025-03-26"
+
+	var got []string
+	for _, inc := range CrossCheck(goSession, pySession, CrossCheckOptions{}) {
+		got = append(got, inc.String())
+	}
+	want := []string{
+		`/protocol_version: protocol version 2024-11-05 in go, 2025-03-26 in python`,
+		`mcp.embed request 1: /params/input_text: sent by go as "input_text", by python as "inputText"`,
+		`mcp.embed request 1: /params/trace: sent by python but not by go`,
+		`mcp.embed request 1: /params/options/dimensions: number in go, string in python`,
+		`mcp.ping: sent once by go, 0 times by python`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("incompatibilities:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	opts := CrossCheckOptions{Ignore: []string{"/params/options", "/params/trace", "/params/input_text", "/params/inputText"}}
+	if n := len(CrossCheck(goSession, pySession, opts)); n != 2 {
+		t.Fatalf("with ignores: %d incompatibilities, want the protocol version and mcp.ping", n)
+	}
+}
+
+// TestSchemaDriftFixtures holds the response fixtures of every client to
+// the Go client's schema.
+func TestSchemaDriftFixtures(t *testing.T) {
+	for _, lang := range []string{"go", "python", "node"} {
+		for _, transport := range []string{"http", "stdio", "tls"} {
+			dir := filepath.Join(fixturesDir, lang, transport)
+			if _, err := os.Stat(filepath.Join(dir, "response.json")); err != nil {
+				continue
+			}
+			requests, err := Load(filepath.Join(dir, "request.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			responses, err := Load(filepath.Join(dir, "response.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, inc := range SchemaDrift(requests, responses) {
+				t.Errorf("%s %s: %s", lang, transport, inc)
+			}
+		}
+	}
+}
+
+func TestSchemaDrift(t *testing.T) {
+	// The requests and responses are recorded apart, as fixtures are.
+	apart := func(direction string, messages ...string) Transcript {
+		var t Transcript
+		for _, m := range messages {
+			t.Messages = append(t.Messages, client.Entry{Direction: direction, Message: json.RawMessage(m)})
+		}
+		return t
+	}
+	requests := apart(client.DirectionRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"mcp.embed.stream","params":{"inputs":["a","b"]}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"mcp.capabilities","params":{}}`,
+	)
+	responses := apart(client.DirectionResponse,
+		`{"jsonrpc":"2.0","id":1,"result":{"ok":true,"uptime_s":5}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"index":0,"vector":[1],"score":0.5}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"index":1,"vector":[2],"score":0.5}}`,
+		`{"jsonrpc":"2.0","id":3,"result":{"anything":true}}`,
+	)
+	var got []string
+	for _, inc := range SchemaDrift(requests, responses) {
+		got = append(got, inc.String())
+	}
+	// A stream reports a field once, and methods without a type nothing.
+	want := []string{
+		`mcp.ping request 1: /result/uptime_s: response field not in the Go client's schema`,
+		`mcp.embed.stream request 1: /result/score: response field not in the Go client's schema`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("drift:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCrossCheckReportsWireProtocol(t *testing.T) {
+	native := session(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","params":{}}`)
+	native.Client = "go"
+	bare := native
+	bare.Client, bare.WireProtocol = "python", client.JSONRPC2
+	got := CrossCheck(native, bare, CrossCheckOptions{})
+	if len(got) != 1 || got[0].String() != `/wire_protocol: wire protocol native in go, jsonrpc2 in python` {
+		t.Fatalf("incompatibilities %v", got)
+	}
+}
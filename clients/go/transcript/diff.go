@@ -0,0 +1,501 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Kinds of Difference.
+const (
+	// DiffChanged is a value present on both sides that differs.
+	DiffChanged = "changed"
+	// DiffMissing is a value the expected transcript has and the actual one
+	// lacks.
+	DiffMissing = "missing"
+	// DiffUnexpected is a value only the actual transcript has.
+	DiffUnexpected = "unexpected"
+)
+
+// DiffOptions tunes Diff.
+type DiffOptions struct {
+	// Ignore lists JSON pointers, relative to the transcript document, whose
+	// values are not compared; the fields below them are skipped too. A "*"
+	// segment matches any key or index, so "/messages/*/message/meta/timestamp"
+	// ignores the timestamp of every envelope.
+	Ignore []string
+	// Normalizer, when set, is applied to both transcripts before they are
+	// compared, so values its rules replace compare equal.
+	Normalizer *Normalizer
+	// Anonymizer, when set, anonymizes both transcripts first. With the salt
+	// an anonymized transcript was recorded with, it compares equal to the
+	// raw transcript of the same session.
+	Anonymizer *client.Anonymizer
+}
+
+// Difference is one place where two transcripts disagree.
+type Difference struct {
+	// Pointer is the JSON pointer (RFC 6901) of the value in the transcript
+	// document, such as "/messages/3/message/result/dimension".
+	Pointer string `json:"pointer"`
+	Kind    string `json:"kind"`
+	// Expected and Actual are the compact JSON of each side's value; the
+	// side that lacks the value leaves it empty.
+	Expected json.RawMessage `json:"expected,omitempty"`
+	Actual   json.RawMessage `json:"actual,omitempty"`
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffMissing:
+		return fmt.Sprintf("%s: missing, expected %s", d.Pointer, d.Expected)
+	case DiffUnexpected:
+		return fmt.Sprintf("%s: unexpected %s", d.Pointer, d.Actual)
+	}
+	return fmt.Sprintf("%s: expected %s, got %s", d.Pointer, d.Expected, d.Actual)
+}
+
+// Diff compares actual against expected: first the markers, then each
+// message in turn, descending into objects and arrays so every difference
+// is reported at the deepest pointer where the sides disagree. Object keys
+// are visited in sorted order, so the result is deterministic. Numbers are
+// compared by value, so 1 and 1.0 are equal. The summaries are left
+// uncompared, since they follow from the messages, and so are the client
+// builds, which differ between any two builds recording the same session;
+// ClientBuildNote reports them. Diff returns nil when the transcripts
+// match.
+func Diff(expected, actual Transcript, opts DiffOptions) []Difference {
+	expected.Summary, actual.Summary = nil, nil
+	expected.ClientBuild, actual.ClientBuild = "", ""
+	if opts.Anonymizer != nil {
+		expected, actual = anonymized(expected, opts.Anonymizer), anonymized(actual, opts.Anonymizer)
+	}
+	return diffValues(opts.Normalizer.apply(tree(expected)), opts.Normalizer.apply(tree(actual)), opts.Ignore)
+}
+
+// DiffFiles compares the transcripts at expectedPath and actualPath as Diff
+// compares them, returning the Report of the comparison with the client
+// builds and the trace linkage of the differing messages. A JSONL
+// transcript is read through OpenJSONL a message at a time rather than
+// loaded, so the comparison holds the longest line of each side and the
+// differences found, not the transcripts; other files are loaded with
+// LoadSection.
+func DiffFiles(expectedPath, actualPath string, opts DiffOptions) (Report, error) {
+	expected, err := openEntries(expectedPath)
+	if err != nil {
+		return Report{}, err
+	}
+	defer expected.close()
+	actual, err := openEntries(actualPath)
+	if err != nil {
+		return Report{}, err
+	}
+	defer actual.close()
+
+	d := differ{ignore: compileIgnores(opts.Ignore)}
+	var traces []MessageTrace
+	for i := 0; ; i++ {
+		e, eTrace, inExpected, err := expected.entry(opts)
+		if err != nil {
+			return Report{}, err
+		}
+		a, aTrace, inActual, err := actual.entry(opts)
+		if err != nil {
+			return Report{}, err
+		}
+		if !inExpected && !inActual {
+			break
+		}
+		path := []string{"messages", strconv.Itoa(i)}
+		found := len(d.diffs)
+		switch {
+		case !inActual:
+			if !d.ignored(path) {
+				d.add(path, DiffMissing, e, nil)
+			}
+		case !inExpected:
+			if !d.ignored(path) {
+				d.add(path, DiffUnexpected, nil, a)
+			}
+		default:
+			d.compare(path, e, a)
+		}
+		if len(d.diffs) > found && (eTrace != nil || aTrace != nil) {
+			traces = append(traces, MessageTrace{Message: i, Expected: eTrace, Actual: aTrace})
+		}
+	}
+
+	// The markers go around the messages, in the order Diff visits the
+	// keys of the document.
+	eh, ah := expected.header(), actual.header()
+	h := differ{ignore: d.ignore}
+	h.compare(nil, opts.Normalizer.apply(headerTree(eh)), opts.Normalizer.apply(headerTree(ah)))
+	var diffs []Difference
+	for _, diff := range h.diffs {
+		if key := splitPointer(diff.Pointer); len(key) == 0 || key[0] < "messages" {
+			diffs = append(diffs, diff)
+		}
+	}
+	diffs = append(diffs, d.diffs...)
+	for _, diff := range h.diffs {
+		if key := splitPointer(diff.Pointer); len(key) > 0 && key[0] > "messages" {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	r := Report{Equal: len(diffs) == 0, Differences: diffs, Traces: traces}
+	if !r.Equal && ClientBuildNote(eh, ah, "expected", "actual") != "" {
+		r.ClientBuilds = []string{eh.ClientBuild, ah.ClientBuild}
+	}
+	return r, nil
+}
+
+// headerTree is the tree of t's markers that Diff compares.
+func headerTree(t Transcript) any {
+	t.Summary, t.ClientBuild, t.Messages = nil, "", nil
+	return tree(t)
+}
+
+// entrySource yields the messages of one side of DiffFiles.
+type entrySource struct {
+	next   func() (client.Entry, error)
+	header func() Transcript
+	close  func() error
+	// read counts the messages read, those the normalizer removes
+	// included.
+	read int
+}
+
+// openEntries streams the JSONL transcript at path, or loads any other.
+func openEntries(path string) (*entrySource, error) {
+	r, err := OpenJSONL(path)
+	if err == nil {
+		return &entrySource{next: r.Next, header: r.Header, close: r.Close}, nil
+	}
+	if !errors.Is(err, ErrNotJSONL) {
+		return nil, err
+	}
+	t, err := LoadSection(path, "")
+	if err != nil {
+		return nil, err
+	}
+	s := &entrySource{header: func() Transcript { return t }, close: func() error { return nil }}
+	s.next = func() (client.Entry, error) {
+		if s.read >= len(t.Messages) {
+			return client.Entry{}, io.EOF
+		}
+		return t.Messages[s.read], nil
+	}
+	return s, nil
+}
+
+// entry returns the next message opts keep, in the form Diff compares it,
+// and its trace linkage; false after the last.
+func (s *entrySource) entry(opts DiffOptions) (any, *client.TraceLink, bool, error) {
+	for {
+		e, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil, false, nil
+		}
+		if err != nil {
+			return nil, nil, false, err
+		}
+		at := []string{"messages", strconv.Itoa(s.read)}
+		s.read++
+		trace := e.Trace
+		if opts.Anonymizer != nil {
+			e.Message = opts.Anonymizer.Anonymize(e.Message)
+		}
+		var v any
+		if raw, err := marshal(e); err != nil {
+			v = fmt.Sprintf("<invalid message: %v>", err)
+		} else {
+			v = decodeValue(raw)
+		}
+		if opts.Normalizer != nil {
+			if v = opts.Normalizer.walk(at, v); v == removed {
+				continue
+			}
+		}
+		return v, trace, true, nil
+	}
+}
+
+// ClientBuildNote names the client builds that recorded a and b, labeled
+// as the two sides of a comparison, when their ClientBuild markers differ:
+// reported ahead of the differences between the transcripts, it points at
+// the change between the builds as their likely cause. It returns "" when
+// the builds match or either transcript does not say.
+func ClientBuildNote(a, b Transcript, aLabel, bLabel string) string {
+	if a.ClientBuild == "" || b.ClientBuild == "" || a.ClientBuild == b.ClientBuild {
+		return ""
+	}
+	return fmt.Sprintf("recorded by different client builds: %s %s, %s %s", aLabel, a.ClientBuild, bLabel, b.ClientBuild)
+}
+
+// MessageTrace is the trace linkage of a message a comparison found
+// differences in, from each side that recorded one.
+type MessageTrace struct {
+	// Message indexes the message in the transcripts.
+	Message  int               `json:"message"`
+	Expected *client.TraceLink `json:"expected,omitempty"`
+	Actual   *client.TraceLink `json:"actual,omitempty"`
+}
+
+func (m MessageTrace) String() string {
+	side := func(label string, l *client.TraceLink) string {
+		if l == nil {
+			return label + " untraced"
+		}
+		return label + " " + l.String()
+	}
+	return fmt.Sprintf("/messages/%d: %s; %s", m.Message, side("expected", m.Expected), side("actual", m.Actual))
+}
+
+// Traces returns the trace linkage of the messages diffs fall in, in
+// message order, for each message either side has one for. The
+// normalization rules drop the linkage before comparing, so expected and
+// actual are the transcripts as loaded; reported ahead of the
+// differences, it finds the exchanges in the server's traces and logs.
+func Traces(expected, actual Transcript, diffs []Difference) []MessageTrace {
+	link := func(t Transcript, i int) *client.TraceLink {
+		if i < len(t.Messages) {
+			return t.Messages[i].Trace
+		}
+		return nil
+	}
+	var out []MessageTrace
+	seen := make(map[int]bool)
+	for _, d := range diffs {
+		rest, ok := strings.CutPrefix(d.Pointer, "/messages/")
+		if !ok {
+			continue
+		}
+		index, _, _ := strings.Cut(rest, "/")
+		i, err := strconv.Atoi(index)
+		if err != nil || seen[i] {
+			continue
+		}
+		seen[i] = true
+		m := MessageTrace{Message: i, Expected: link(expected, i), Actual: link(actual, i)}
+		if m.Expected != nil || m.Actual != nil {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Message < out[b].Message })
+	return out
+}
+
+// anonymized returns t with the messages a anonymizes.
+func anonymized(t Transcript, a *client.Anonymizer) Transcript {
+	messages := make([]client.Entry, len(t.Messages))
+	for i, e := range t.Messages {
+		e.Message = a.Anonymize(e.Message)
+		messages[i] = e
+	}
+	t.Messages = messages
+	return t
+}
+
+// diffValues compares two decoded JSON values, with pointers relative to
+// them.
+func diffValues(expected, actual any, ignore []string) []Difference {
+	d := differ{ignore: compileIgnores(ignore)}
+	d.compare(nil, expected, actual)
+	return d.diffs
+}
+
+// tree converts t to the generic form Diff walks.
+func tree(t Transcript) any {
+	if t.Messages == nil {
+		t.Messages = []client.Entry{}
+	}
+	raw, err := marshal(t)
+	if err != nil {
+		// Only a message holding invalid JSON gets here; compare it as text.
+		return fmt.Sprintf("<invalid transcript: %v>", err)
+	}
+	return decodeValue(raw)
+}
+
+func decodeValue(raw []byte) any {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return string(raw)
+	}
+	return v
+}
+
+type differ struct {
+	ignore [][]string
+	diffs  []Difference
+}
+
+func (d *differ) compare(path []string, expected, actual any) {
+	if d.ignored(path) {
+		return
+	}
+	switch e := expected.(type) {
+	case map[string]any:
+		if a, ok := actual.(map[string]any); ok {
+			d.compareObjects(path, e, a)
+			return
+		}
+	case []any:
+		if a, ok := actual.([]any); ok {
+			d.compareArrays(path, e, a)
+			return
+		}
+	default:
+		if scalarsEqual(expected, actual) {
+			return
+		}
+	}
+	d.add(path, DiffChanged, expected, actual)
+}
+
+func (d *differ) compareObjects(path []string, expected, actual map[string]any) {
+	keys := make([]string, 0, len(expected)+len(actual))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	for k := range actual {
+		if _, ok := expected[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := append(path[:len(path):len(path)], k)
+		e, inExpected := expected[k]
+		a, inActual := actual[k]
+		switch {
+		case !inActual:
+			if !d.ignored(child) {
+				d.add(child, DiffMissing, e, nil)
+			}
+		case !inExpected:
+			if !d.ignored(child) {
+				d.add(child, DiffUnexpected, nil, a)
+			}
+		default:
+			d.compare(child, e, a)
+		}
+	}
+}
+
+func (d *differ) compareArrays(path []string, expected, actual []any) {
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		child := append(path[:len(path):len(path)], strconv.Itoa(i))
+		switch {
+		case i >= len(actual):
+			if !d.ignored(child) {
+				d.add(child, DiffMissing, expected[i], nil)
+			}
+		case i >= len(expected):
+			if !d.ignored(child) {
+				d.add(child, DiffUnexpected, nil, actual[i])
+			}
+		default:
+			d.compare(child, expected[i], actual[i])
+		}
+	}
+}
+
+func (d *differ) add(path []string, kind string, expected, actual any) {
+	diff := Difference{Pointer: pointer(path), Kind: kind}
+	if kind != DiffUnexpected {
+		diff.Expected = compact(expected)
+	}
+	if kind != DiffMissing {
+		diff.Actual = compact(actual)
+	}
+	d.diffs = append(d.diffs, diff)
+}
+
+// ignored reports whether path is at or below an ignored pointer.
+func (d *differ) ignored(path []string) bool {
+	for _, pattern := range d.ignore {
+		if len(pattern) > len(path) {
+			continue
+		}
+		match := true
+		for i, seg := range pattern {
+			if seg != "*" && seg != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarsEqual(expected, actual any) bool {
+	if en, ok := expected.(json.Number); ok {
+		an, ok := actual.(json.Number)
+		if !ok {
+			return false
+		}
+		if en == an {
+			return true
+		}
+		ef, err1 := en.Float64()
+		af, err2 := an.Float64()
+		return err1 == nil && err2 == nil && ef == af
+	}
+	return expected == actual
+}
+
+func compact(v any) json.RawMessage {
+	raw, err := marshal(v)
+	if err != nil {
+		return json.RawMessage(strconv.Quote(fmt.Sprint(v)))
+	}
+	return raw
+}
+
+// compileIgnores splits the ignore pointers into unescaped segments.
+func compileIgnores(pointers []string) [][]string {
+	patterns := make([][]string, 0, len(pointers))
+	for _, p := range pointers {
+		patterns = append(patterns, splitPointer(p))
+	}
+	return patterns
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func pointer(path []string) string {
+	var b strings.Builder
+	for _, seg := range path {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(seg))
+	}
+	return b.String()
+}
+
+func splitPointer(p string) []string {
+	if p == "" {
+		return nil
+	}
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, seg := range segs {
+		segs[i] = pointerUnescaper.Replace(seg)
+	}
+	return segs
+}
@@ -0,0 +1,183 @@
+package transcript
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func session(messages ...string) Transcript {
+	t := Transcript{Client: client.ClientMarker, Transport: "http"}
+	for i, m := range messages {
+		direction := client.DirectionRequest
+		if i%2 == 1 {
+			direction = client.DirectionResponse
+		}
+		t.Messages = append(t.Messages, client.Entry{Direction: direction, Message: json.RawMessage(m)})
+	}
+	return t
+}
+
+func TestDiffEqual(t *testing.T) {
+	a := session(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}`, `{"jsonrpc":"2.0","id":1,"result":{"ok":true,"n":1}}`)
+	b := session(`{"method":"mcp.ping","id":1,"jsonrpc":"2.0"}`, `{"jsonrpc":"2.0","id":1.0,"result":{"n":1,"ok":true}}`)
+	if diffs := Diff(a, b, DiffOptions{}); diffs != nil {
+		t.Fatalf("expected no differences, got %v", diffs)
+	}
+	if RenderText(nil) != "" {
+		t.Fatal("RenderText of no differences is not empty")
+	}
+}
+
+func TestDiffReportsPointers(t *testing.T) {
+	expected := session(
+		`{"id":1,"method":"mcp.embed","params":{"inputs":["a"],"model":"m"}}`,
+		`{"id":1,"result":{"dimension":3}}`,
+		`{"id":2,"method":"mcp.ping"}`,
+	)
+	actual := session(
+		`{"id":1,"method":"mcp.embed","params":{"inputs":["a","b"],"model/v2":"m"}}`,
+		`{"id":1,"result":{"dimension":4}}`,
+	)
+	actual.Transport = "ws"
+
+	got := Diff(expected, actual, DiffOptions{})
+	want := []Difference{
+		{Pointer: "/messages/0/message/params/inputs/1", Kind: DiffUnexpected, Actual: json.RawMessage(`"b"`)},
+		{Pointer: "/messages/0/message/params/model", Kind: DiffMissing, Expected: json.RawMessage(`"m"`)},
+		{Pointer: "/messages/0/message/params/model~1v2", Kind: DiffUnexpected, Actual: json.RawMessage(`"m"`)},
+		{Pointer: "/messages/1/message/result/dimension", Kind: DiffChanged, Expected: json.RawMessage(`3`), Actual: json.RawMessage(`4`)},
+		{Pointer: "/messages/2", Kind: DiffMissing, Expected: json.RawMessage(`{"direction":"request","message":{"id":2,"method":"mcp.ping"}}`)},
+		{Pointer: "/transport", Kind: DiffChanged, Expected: json.RawMessage(`"http"`), Actual: json.RawMessage(`"ws"`)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("differences:\n%s", RenderText(got))
+	}
+
+	text := RenderText(got)
+	for _, line := range []string{"--- expected", "+++ actual", "@@ /messages/1/message/result/dimension (changed) @@", "-3", "+4", `+"ws"`} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("text diff lacks %q:\n%s", line, text)
+		}
+	}
+
+	raw, err := RenderJSON(got)
+	if err != nil {
+		t.Fatalf("RenderJSON: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(raw, &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Equal || len(report.Differences) != len(want) || report.Differences[3].Pointer != want[3].Pointer {
+		t.Fatalf("unexpected report: %s", raw)
+	}
+}
+
+func TestDiffIgnore(t *testing.T) {
+	expected := session(
+		`{"id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z","sequence":1}}`,
+		`{"id":1,"result":{"latency_ms":4,"ok":true}}`,
+	)
+	actual := session(
+		`{"id":1,"method":"mcp.ping","meta":{"timestamp":"2026-10-14T08:00:00Z","sequence":1}}`,
+		`{"id":1,"result":{"latency_ms":9,"ok":true,"extra":{"nested":1}}}`,
+	)
+	opts := DiffOptions{Ignore: []string{
+		"/messages/*/message/meta/timestamp",
+		"/messages/1/message/result/latency_ms",
+		"/messages/1/message/result/extra",
+	}}
+	if diffs := Diff(expected, actual, opts); diffs != nil {
+		t.Fatalf("ignored fields were compared: %v", diffs)
+	}
+	diffs := Diff(expected, actual, DiffOptions{Ignore: opts.Ignore[:1]})
+	if len(diffs) != 2 {
+		t.Fatalf("expected latency and extra to differ, got %v", diffs)
+	}
+}
+
+func TestDiffAnonymized(t *testing.T) {
+	raw := session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.embed","params":{"input_text":"customer text"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"vector":[0.25,-0.5,1]}}`,
+	)
+	salted := client.NewAnonymizer("salt")
+	anon := raw
+	anon.Messages = nil
+	for _, e := range raw.Messages {
+		e.Message = salted.Anonymize(e.Message)
+		anon.Messages = append(anon.Messages, e)
+	}
+	if Diff(raw, anon, DiffOptions{}) == nil {
+		t.Fatal("anonymized transcript equals the raw one")
+	}
+	if diffs := Diff(raw, anon, DiffOptions{Anonymizer: client.NewAnonymizer("salt")}); diffs != nil {
+		t.Fatalf("anonymized transcript differs under its salt:\n%s", RenderText(diffs))
+	}
+	if Diff(raw, anon, DiffOptions{Anonymizer: client.NewAnonymizer("pepper")}) == nil {
+		t.Fatal("anonymized transcript equals the raw one under another salt")
+	}
+}
+
+func TestDiffClientBuild(t *testing.T) {
+	older := session(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}`)
+	older.ClientBuild = "zaevrynth-go-client/0.1.0 (1a2b3c4d5e6f)"
+	newer := older
+	newer.ClientBuild = "zaevrynth-go-client/0.2.0"
+	if diffs := Diff(older, newer, DiffOptions{}); diffs != nil {
+		t.Fatalf("client builds compared:\n%s", RenderText(diffs))
+	}
+	want := "recorded by different client builds: expected zaevrynth-go-client/0.1.0 (1a2b3c4d5e6f), actual zaevrynth-go-client/0.2.0"
+	if note := ClientBuildNote(older, newer, "expected", "actual"); note != want {
+		t.Fatalf("note %q", note)
+	}
+	unmarked := older
+	unmarked.ClientBuild = ""
+	if note := ClientBuildNote(older, older, "a", "b") + ClientBuildNote(older, unmarked, "a", "b"); note != "" {
+		t.Fatalf("note %q for matching or unmarked builds", note)
+	}
+}
+
+func TestTraces(t *testing.T) {
+	link := func(span, server string) *client.TraceLink {
+		return &client.TraceLink{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: span, RequestID: "01J0", ServerRequestID: server}
+	}
+	expected := session(`{"id":1,"method":"mcp.ping"}`, `{"id":1,"result":{"ok":true}}`, `{"id":2,"method":"mcp.ping"}`, `{"id":2,"result":{"ok":true}}`)
+	actual := session(`{"id":1,"method":"mcp.ping"}`, `{"id":1,"result":{"ok":true}}`, `{"id":2,"method":"mcp.ping"}`, `{"id":2,"result":{"ok":false}}`)
+	for i := range actual.Messages {
+		actual.Messages[i].Trace = link("b7ad6b7169203331", "")
+	}
+	actual.Messages[3].Trace = link("b7ad6b7169203331", "srv-7")
+	expected.Messages[3].Trace = link("00f067aa0ba902b7", "srv-3")
+
+	// The rules drop the linkage, which differs throughout, from the
+	// comparison.
+	diffs := Diff(expected, actual, DiffOptions{Normalizer: DefaultNormalizer()})
+	if len(diffs) != 1 || diffs[0].Pointer != "/messages/3/message/result/ok" {
+		t.Fatalf("differences:\n%s", RenderText(diffs))
+	}
+	traces := Traces(expected, actual, diffs)
+	if len(traces) != 1 || traces[0].Message != 3 {
+		t.Fatalf("traces %+v", traces)
+	}
+	want := "/messages/3: expected trace 0af7651916cd43dd8448eb211c80319c span 00f067aa0ba902b7 request 01J0 server request srv-3; " +
+		"actual trace 0af7651916cd43dd8448eb211c80319c span b7ad6b7169203331 request 01J0 server request srv-7\n"
+	if got := RenderTraces(traces); got != want {
+		t.Fatalf("RenderTraces:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A message only one side traced, or has, is reported once.
+	actual.Messages = append(actual.Messages, client.Entry{Direction: client.DirectionRequest, Message: json.RawMessage(`{"id":3}`), Trace: link("b7ad6b7169203331", "")})
+	diffs = Diff(expected, actual, DiffOptions{Normalizer: DefaultNormalizer()})
+	traces = Traces(expected, actual, append(diffs, diffs...))
+	if len(traces) != 2 || traces[1].Message != 4 || traces[1].Expected != nil || !strings.Contains(traces[1].String(), "expected untraced") {
+		t.Fatalf("traces %+v", traces)
+	}
+	if Traces(session(`{}`), session(`{"id":1}`), Diff(session(`{}`), session(`{"id":1}`), DiffOptions{})) != nil {
+		t.Fatal("untraced messages reported")
+	}
+}
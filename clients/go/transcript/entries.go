@@ -0,0 +1,280 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// ErrNotJSONL reports a transcript OpenJSONL cannot stream: a document in
+// client.FormatJSON, a single JSON value that Load reads whole.
+var ErrNotJSONL = errors.New("not a JSONL transcript")
+
+// sniffLimit bounds the first line OpenJSONL reads of a file not named
+// .jsonl to tell a JSONL transcript from a document; a header line is far
+// shorter.
+const sniffLimit = 1 << 20
+
+// mapFiles turns memory mapping off, in tests of the buffered fallback.
+var mapFiles = true
+
+// EntryReader reads a JSONL transcript an entry at a time, so tools can
+// process transcripts larger than memory. Where the platform can, it maps
+// the file into memory, and elsewhere, as on Windows, it reads a buffered
+// stream. Either way it holds a line at a time and copies each entry out of
+// it, so its heap stays within a few times the longest line whatever the
+// size of the file.
+type EntryReader struct {
+	path  string
+	f     *os.File
+	lines lineSource
+	// markers are the keys of the header line, and of a footer once Next
+	// has read it.
+	markers map[string]json.RawMessage
+	line    int
+}
+
+// OpenJSONL opens the JSONL transcript at path, reading its header line. A
+// path not ending in ".jsonl" is taken for JSONL when its first line is a
+// whole JSON value and more follows, as Load tells the formats apart;
+// anything else fails with ErrNotJSONL. A header at an older version is
+// migrated as Load migrates it.
+func OpenJSONL(path string) (*EntryReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newEntryReader(path, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newEntryReader(path string, f *os.File) (*EntryReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if client.TranscriptFormat(path, "") != client.FormatJSONL {
+		jsonl, err := sniffJSONL(f, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		if !jsonl {
+			return nil, fmt.Errorf("%s: %w", path, ErrNotJSONL)
+		}
+	}
+	r := &EntryReader{path: path, f: f, lines: openLines(f, info.Size())}
+	header, err := r.header()
+	if err != nil {
+		r.lines.close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.markers = header
+	return r, nil
+}
+
+// sniffJSONL reports whether the first line of f, of size bytes, is a
+// whole JSON value followed by more.
+func sniffJSONL(f *os.File, size int64) (bool, error) {
+	buf := make([]byte, min(size, sniffLimit))
+	if _, err := f.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	first, rest, ok := bytes.Cut(buf, []byte("\n"))
+	if !ok || !json.Valid(first) {
+		return false, nil
+	}
+	return len(bytes.TrimSpace(rest)) > 0 || int64(len(buf)) < size, nil
+}
+
+// header reads the first line, the transcript's markers, migrated to
+// CurrentVersion.
+func (r *EntryReader) header() (map[string]json.RawMessage, error) {
+	for {
+		line, _, err := r.lines.next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("decode transcript: no header line")
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		doc, err := decodeDocument(line)
+		if err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", r.line, err)
+		}
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("transcript line %d is %s, not an object", r.line, typeName(doc))
+		}
+		if obj["direction"] != nil {
+			return nil, fmt.Errorf("transcript line %d: an entry before the header", r.line)
+		}
+		from, err := documentVersion(doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = migrate(doc, from, r.path); err != nil {
+			return nil, err
+		}
+		raw, err := marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var markers map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &markers); err != nil {
+			return nil, err
+		}
+		return markers, nil
+	}
+}
+
+// Header returns the transcript's markers, without messages. Once Next has
+// returned io.EOF it holds the Summary of the footer too.
+func (r *EntryReader) Header() Transcript {
+	var t Transcript
+	if raw, err := json.Marshal(r.markers); err == nil {
+		_ = json.Unmarshal(raw, &t)
+	}
+	t.Messages = nil
+	return t
+}
+
+// Next returns the next entry, or io.EOF after the last. A final line cut
+// short, as a crash mid-write leaves it, is dropped, as Load drops it.
+func (r *EntryReader) Next() (client.Entry, error) {
+	for {
+		line, terminated, err := r.lines.next()
+		if err != nil {
+			return client.Entry{}, err
+		}
+		r.line++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e client.Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if !terminated {
+				return client.Entry{}, io.EOF
+			}
+			return client.Entry{}, fmt.Errorf("%s: transcript line %d: %w", r.path, r.line, err)
+		}
+		if e.Direction != "" {
+			return e, nil
+		}
+		// A line that is no entry, such as the footer, adds to the markers.
+		var footer map[string]json.RawMessage
+		if err := json.Unmarshal(line, &footer); err != nil {
+			return client.Entry{}, fmt.Errorf("%s: transcript line %d: %w", r.path, r.line, err)
+		}
+		for k, v := range footer {
+			r.markers[k] = v
+		}
+	}
+}
+
+// Close releases the file.
+func (r *EntryReader) Close() error {
+	err := r.lines.close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// lineSource yields the lines of a file.
+type lineSource interface {
+	// next returns the next line without its newline, valid until the
+	// following call, and whether a newline ended it; io.EOF after the
+	// last.
+	next() ([]byte, bool, error)
+	close() error
+}
+
+// openLines reads the lines of f, of size bytes, from a memory mapping
+// where mapFile can make one, and through a buffer otherwise.
+func openLines(f *os.File, size int64) lineSource {
+	if mapFiles {
+		if data, unmap, err := mapFile(f, size); err == nil {
+			return &mappedLines{data: data, unmap: unmap}
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return &bufferedLines{err: err}
+	}
+	return &bufferedLines{r: bufio.NewReaderSize(f, 64<<10)}
+}
+
+// mappedLines are the lines of a mapped file.
+type mappedLines struct {
+	data  []byte
+	off   int
+	unmap func() error
+}
+
+func (m *mappedLines) next() ([]byte, bool, error) {
+	if m.off >= len(m.data) {
+		return nil, false, io.EOF
+	}
+	rest := m.data[m.off:]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		m.off = len(m.data)
+		return rest, false, nil
+	}
+	m.off += i + 1
+	return rest[:i], true, nil
+}
+
+func (m *mappedLines) close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.data, m.unmap = nil, nil
+	return err
+}
+
+// bufferedLines are the lines of a file read through a buffer, which grows
+// to the longest line.
+type bufferedLines struct {
+	r   *bufio.Reader
+	buf []byte
+	err error
+}
+
+func (b *bufferedLines) next() ([]byte, bool, error) {
+	if b.err != nil {
+		return nil, false, b.err
+	}
+	b.buf = b.buf[:0]
+	for {
+		chunk, err := b.r.ReadSlice('\n')
+		b.buf = append(b.buf, chunk...)
+		switch {
+		case err == nil:
+			return b.buf[:len(b.buf)-1], true, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(b.buf) > 0:
+			b.err = io.EOF
+			return b.buf, false, nil
+		}
+		b.err = err
+		return nil, false, err
+	}
+}
+
+func (b *bufferedLines) close() error { return nil }
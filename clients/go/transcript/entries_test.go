@@ -0,0 +1,303 @@
+package transcript
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// eachLineSource runs fn with the file mapped and again with it read
+// through a buffer, as on platforms without mapping.
+func eachLineSource(t *testing.T, fn func(t *testing.T)) {
+	t.Run("mapped", fn)
+	t.Run("buffered", func(t *testing.T) {
+		mapFiles = false
+		defer func() { mapFiles = true }()
+		fn(t)
+	})
+}
+
+// readEntries reads the transcript at path through OpenJSONL.
+func readEntries(path string) (Transcript, error) {
+	r, err := OpenJSONL(path)
+	if err != nil {
+		return Transcript{}, err
+	}
+	defer r.Close()
+	var messages []client.Entry
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Transcript{}, err
+		}
+		messages = append(messages, e)
+	}
+	got := r.Header()
+	got.Messages = messages
+	return got, nil
+}
+
+func TestEntryReaderMatchesLoad(t *testing.T) {
+	want, err := Load(filepath.Join("testdata", "timed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Summary = &client.TranscriptSummary{Requests: 4}
+	dir := t.TempDir()
+	if err := Save(filepath.Join(dir, "timed.jsonl"), want); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "timed.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the extension the first line says JSONL.
+	if err := os.WriteFile(filepath.Join(dir, "timed.log"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	eachLineSource(t, func(t *testing.T) {
+		for _, name := range []string{"timed.jsonl", "timed.log"} {
+			got, err := readEntries(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+				t.Fatalf("%s read through OpenJSONL differs:\n%s", name, RenderText(diffs))
+			}
+			if got.Summary == nil || got.Summary.Requests != 4 {
+				t.Fatalf("%s: footer summary %+v", name, got.Summary)
+			}
+		}
+	})
+	if _, err := OpenJSONL(filepath.Join("testdata", "timed.json")); !errors.Is(err, ErrNotJSONL) {
+		t.Fatalf("OpenJSONL of a JSON document: %v", err)
+	}
+}
+
+func TestEntryReaderTruncatedLastLine(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	doc := `{"transcript_version":1,"transport":"stdio"}
+{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}}
+{"direction":"response","message":{"jsonrpc":"2.0","id":1,"res`
+	truncated := write("truncated.log", doc)
+	malformed := write("malformed.jsonl", doc[:len(doc)-4]+"\n"+`{"direction":"response"}`+"\n")
+	headless := write("headless.jsonl", `{"direction":"request","message":{"id":1}}`+"\n")
+	eachLineSource(t, func(t *testing.T) {
+		got, err := readEntries(truncated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The version 1 header is migrated.
+		if got.Version != CurrentVersion || got.Transport != client.TransportStdio || len(got.Messages) != 1 {
+			t.Fatalf("got %+v", got)
+		}
+		if _, err := readEntries(malformed); err == nil || !strings.Contains(err.Error(), "transcript line 3") {
+			t.Fatalf("malformed line mid-transcript: %v", err)
+		}
+		if _, err := readEntries(headless); err == nil || !strings.Contains(err.Error(), "an entry before the header") {
+			t.Fatalf("entry before the header: %v", err)
+		}
+	})
+}
+
+func TestDiffFilesMatchesDiff(t *testing.T) {
+	expected := session(
+		`{"id":1,"method":"mcp.embed","params":{"inputs":["a"],"model":"m"}}`,
+		`{"id":1,"result":{"dimension":3}}`,
+		`{"id":2,"method":"mcp.ping"}`,
+	)
+	actual := session(
+		`{"id":1,"method":"mcp.embed","params":{"inputs":["a","b"],"model/v2":"m"}}`,
+		`{"id":1,"result":{"dimension":4}}`,
+	)
+	expected.Protocol, actual.Transport = "HTTP/1.1", "ws"
+	expected.ClientBuild, actual.ClientBuild = "go/1", "go/2"
+	// Markers differ either side of the messages.
+	actual.Codec = client.CodecCBOR
+	actual.Messages[1].Trace = &client.TraceLink{TraceID: strings.Repeat("a", 32), SpanID: strings.Repeat("b", 16)}
+	dir := t.TempDir()
+	paths := map[string]string{}
+	for name, tr := range map[string]Transcript{"expected.jsonl": expected, "actual.jsonl": actual, "actual.json": actual} {
+		paths[name] = filepath.Join(dir, name)
+		if err := Save(paths[name], tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, opts := range []DiffOptions{
+		{},
+		{Ignore: []string{"/messages/0/message/params", "/protocol"}},
+		{Normalizer: DefaultNormalizer()},
+	} {
+		diffs := Diff(expected, actual, opts)
+		want := Report{Equal: diffs == nil, Differences: diffs, ClientBuilds: []string{"go/1", "go/2"}, Traces: Traces(expected, actual, diffs)}
+		eachLineSource(t, func(t *testing.T) {
+			// The JSON document is loaded rather than streamed.
+			for _, side := range []string{"actual.jsonl", "actual.json"} {
+				got, err := DiffFiles(paths["expected.jsonl"], paths[side], opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("DiffFiles(%s, %+v) =\n%+v\nwant\n%+v", side, opts, got, want)
+				}
+			}
+		})
+	}
+	// A rule removing whole messages renumbers those that follow, as Diff
+	// does.
+	n, err := NewNormalizer(Rule{Pointer: "/messages/0", Remove: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DiffOptions{Normalizer: n}
+	got, err := DiffFiles(paths["expected.jsonl"], paths["actual.jsonl"], opts)
+	if diffs := Diff(expected, actual, opts); err != nil || !reflect.DeepEqual(got.Differences, diffs) {
+		t.Fatalf("DiffFiles with a removed message = %v, %v; want %v", got.Differences, err, diffs)
+	}
+}
+
+func TestStatsFile(t *testing.T) {
+	timed, err := Load(filepath.Join("testdata", "timed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "timed.jsonl")
+	if err := Save(path, timed); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path, filepath.Join("testdata", "timed.json")} {
+		got, err := StatsFile(p, "")
+		if err != nil || !reflect.DeepEqual(got, Stats(timed)) {
+			t.Fatalf("StatsFile(%s) = %+v, %v; want %+v", p, got, err, Stats(timed))
+		}
+	}
+}
+
+// largeTranscript writes a JSONL transcript of at least size bytes to dir:
+// timed embed round trips whose responses each carry a vector of some 64
+// KiB.
+func largeTranscript(t *testing.T, dir string, size int64) (path string, calls int) {
+	path = filepath.Join(dir, "large.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, 1<<20)
+	var vector strings.Builder
+	for i := 0; i < 8192; i++ {
+		if i > 0 {
+			vector.WriteByte(',')
+		}
+		fmt.Fprintf(&vector, "%.4f", float64(i%1000)/1000)
+	}
+	fmt.Fprintf(w, `{"transcript_version":%d,"client":"go","transport":"http"}`+"\n", CurrentVersion)
+	var written int64
+	for written < size {
+		calls++
+		n, _ := fmt.Fprintf(w, `{"direction":"request","message":{"jsonrpc":"2.0","id":%d,"method":"mcp.embed","params":{"input_text":"x"}},"sent_at":"2026-10-14T08:00:00Z"}`+"\n", calls)
+		m, _ := fmt.Fprintf(w, `{"direction":"response","message":{"jsonrpc":"2.0","id":%d,"result":{"vector":[%s]}},"sent_at":"2026-10-14T08:00:00Z","received_at":"2026-10-14T08:00:01Z","duration_ms":%d}`+"\n", calls, vector.String(), calls%100)
+		written += int64(n + m)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path, calls
+}
+
+// peakHeap runs fn, sampling runtime.MemStats meanwhile, and returns the
+// most heap it saw in use beyond what was in use before.
+func peakHeap(fn func()) uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	base := m.HeapInuse
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > base {
+				peak = max(peak, m.HeapInuse-base)
+			}
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	return peak
+}
+
+// largeTranscriptEnv set to 1 has TestStatsFileLargeTranscript read a
+// 2 GiB transcript, which takes minutes, instead of one of 32 MiB.
+const largeTranscriptEnv = "EMBEDNEXUS_LARGE_TRANSCRIPT_TEST"
+
+func TestStatsFileLargeTranscript(t *testing.T) {
+	size, ceiling := int64(32<<20), uint64(16<<20)
+	if os.Getenv(largeTranscriptEnv) == "1" {
+		size, ceiling = 2<<30, 64<<20
+	}
+	path, calls := largeTranscript(t, t.TempDir(), size)
+	eachLineSource(t, func(t *testing.T) {
+		var stats []MethodStats
+		var err error
+		peak := peakHeap(func() { stats, err = StatsFile(path, "") })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != 1 || stats[0].Method != client.MethodEmbed || stats[0].Calls != calls || stats[0].MaxMS != 99 {
+			t.Fatalf("stats of %d calls: %+v", calls, stats)
+		}
+		if peak > ceiling {
+			t.Fatalf("heap peaked at %d MiB reading a %d MiB transcript; ceiling %d MiB", peak>>20, int64(size)>>20, ceiling>>20)
+		}
+		t.Logf("heap peaked at %.1f MiB", float64(peak)/(1<<20))
+	})
+}
+
+func TestDiffFilesBoundedMemory(t *testing.T) {
+	// Comparing a transcript to itself reads both sides a message at a
+	// time.
+	path, _ := largeTranscript(t, t.TempDir(), 16<<20)
+	var report Report
+	var err error
+	peak := peakHeap(func() { report, err = DiffFiles(path, path, DiffOptions{Normalizer: DefaultNormalizer()}) })
+	if err != nil || !report.Equal {
+		t.Fatalf("DiffFiles of a transcript against itself = %+v, %v", report, err)
+	}
+	if peak > 16<<20 {
+		t.Fatalf("heap peaked at %d MiB comparing a 16 MiB transcript", peak>>20)
+	}
+}
@@ -0,0 +1,75 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func FuzzTranscriptLoad(f *testing.F) {
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join(fixturesDir, "go", "*", "response.json"),
+		filepath.Join(fixturesDir, "go", "*", "*", "response.json"),
+		filepath.Join("testdata", "*.json"),
+		filepath.Join("testdata", "v1", "*.json"),
+		filepath.Join("testdata", "v1", "go", "*", "*.json"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		f.Fatal("no transcripts to seed from")
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(false, content)
+		if t, err := Parse(content); err == nil {
+			var jsonl bytes.Buffer
+			if err := Encode(&jsonl, t, client.FormatJSONL); err != nil {
+				f.Fatal(err)
+			}
+			f.Add(true, jsonl.Bytes())
+		}
+	}
+	f.Fuzz(func(t *testing.T, jsonl bool, data []byte) {
+		path := "fuzz.json"
+		if jsonl {
+			path = "fuzz.jsonl"
+		}
+		_ = ValidateBytes(data)
+		tr, err := parse(data, path)
+		if err != nil {
+			return
+		}
+		if !isJSONL(path, data) && !json.Valid(data) {
+			t.Fatalf("invalid JSON %q loaded", data)
+		}
+		// A loaded transcript saves, and reloads as itself.
+		var saved bytes.Buffer
+		if err := Encode(&saved, tr, client.FormatJSON); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		again, err := Parse(saved.Bytes())
+		if err != nil {
+			t.Fatalf("reload %s: %v", saved.Bytes(), err)
+		}
+		var resaved bytes.Buffer
+		if err := Encode(&resaved, again, client.FormatJSON); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if !bytes.Equal(saved.Bytes(), resaved.Bytes()) {
+			t.Fatalf("reloaded transcript differs:\n%s\n%s", saved.Bytes(), resaved.Bytes())
+		}
+	})
+}
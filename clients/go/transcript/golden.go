@@ -0,0 +1,56 @@
+package transcript
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// CompareOrUpdate checks actual against the golden transcript at
+// goldenPath, both normalized with DefaultNormalizer, and fails t with the
+// differences as a unified diff. With update set it writes actual,
+// normalized, to goldenPath instead, and logs how that changed the file. A
+// missing golden file fails t unless update is set.
+func CompareOrUpdate(t testing.TB, goldenPath string, actual Transcript, update bool) {
+	t.Helper()
+	n := DefaultNormalizer()
+	got, err := n.Normalize(actual)
+	if err != nil {
+		t.Fatalf("normalize %s: %v", goldenPath, err)
+		return
+	}
+	// Compare what Save would write.
+	got.Version = CurrentVersion
+	want, err := Load(goldenPath)
+	missing := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !(missing && update) {
+		if missing {
+			t.Fatalf("%s does not exist; rerun with the update flag set to record it", goldenPath)
+		} else {
+			t.Fatalf("load golden transcript: %v", err)
+		}
+		return
+	}
+	var diffs []Difference
+	if !missing {
+		diffs = Diff(want, got, DiffOptions{Normalizer: n})
+	}
+	if !update {
+		if diffs != nil {
+			t.Fatalf("transcript differs from %s in %d places:\n%s%s", goldenPath, len(diffs), RenderTraces(Traces(want, actual, diffs)), RenderText(diffs))
+		}
+		return
+	}
+	if err := Save(goldenPath, got); err != nil {
+		t.Fatalf("update golden transcript: %v", err)
+		return
+	}
+	switch {
+	case missing:
+		t.Logf("created %s", goldenPath)
+	case diffs == nil:
+		t.Logf("rewrote %s; no differences", goldenPath)
+	default:
+		t.Logf("updated %s in %d places:\n%s", goldenPath, len(diffs), RenderText(diffs))
+	}
+}
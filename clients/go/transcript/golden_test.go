@@ -0,0 +1,69 @@
+package transcript
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// goldenT records what CompareOrUpdate reports instead of failing the test.
+type goldenT struct {
+	*testing.T
+	fatal, logs []string
+}
+
+func (g *goldenT) Fatalf(format string, args ...any) {
+	g.fatal = append(g.fatal, fmt.Sprintf(format, args...))
+}
+func (g *goldenT) Logf(format string, args ...any) {
+	g.logs = append(g.logs, fmt.Sprintf(format, args...))
+}
+
+func TestCompareOrUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden", "http.json")
+	recorded := session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`,
+	)
+	g := &goldenT{T: t}
+	CompareOrUpdate(g, path, recorded, false)
+	if len(g.fatal) != 1 || !strings.Contains(g.fatal[0], "does not exist") {
+		t.Fatalf("missing golden file: %q", g.fatal)
+	}
+
+	g = &goldenT{T: t}
+	CompareOrUpdate(g, path, recorded, true)
+	if g.fatal != nil || len(g.logs) != 1 || !strings.HasPrefix(g.logs[0], "created") {
+		t.Fatalf("update: fatal %q, logs %q", g.fatal, g.logs)
+	}
+	// The golden file holds the normalized session: a later run recorded at
+	// another time still matches.
+	saved, err := Load(path)
+	if err != nil || string(client.CanonicalJSON(saved.Messages[0].Message)) != `{"id":1,"jsonrpc":"2.0","meta":{"timestamp":"<timestamp>"},"method":"mcp.ping"}` {
+		t.Fatalf("golden file holds %+v, %v", saved.Messages, err)
+	}
+	later := session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-06-01T08:00:00Z"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`,
+	)
+	g = &goldenT{T: t}
+	CompareOrUpdate(g, path, later, false)
+	if g.fatal != nil {
+		t.Fatalf("matching session failed: %q", g.fatal)
+	}
+
+	changed := session(string(later.Messages[0].Message), `{"jsonrpc":"2.0","id":1,"result":{"ok":false}}`)
+	g = &goldenT{T: t}
+	CompareOrUpdate(g, path, changed, false)
+	if len(g.fatal) != 1 || !strings.Contains(g.fatal[0], "/messages/1/message/result/ok") {
+		t.Fatalf("changed session: %q", g.fatal)
+	}
+	g = &goldenT{T: t}
+	CompareOrUpdate(g, path, changed, true)
+	if len(g.logs) != 1 || !strings.Contains(g.logs[0], "updated") || !strings.Contains(g.logs[0], "/messages/1/message/result/ok") {
+		t.Fatalf("update logs %q", g.logs)
+	}
+}
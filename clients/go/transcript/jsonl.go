@@ -0,0 +1,183 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// isJSONL reports whether data, read from path, is a client.FormatJSONL
+// transcript: path says so, or data holds more than one JSON value.
+func isJSONL(path string, data []byte) bool {
+	if path != "" && client.TranscriptFormat(path, "") == client.FormatJSONL {
+		return true
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return false
+	}
+	return dec.More()
+}
+
+// decodeJSONL assembles the lines of a JSONL transcript into the document
+// they describe. A final line cut short, as a crash mid-write leaves it, is
+// dropped.
+func decodeJSONL(data []byte) (any, error) {
+	doc := map[string]any{}
+	messages := []any{}
+	lines := bytes.Split(data, []byte("\n"))
+	header := true
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		value, err := decodeDocument(line)
+		if err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("transcript line %d: %w", i+1, err)
+		}
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("transcript line %d is %s, not an object", i+1, typeName(value))
+		}
+		if _, entry := obj["direction"]; entry && !header {
+			messages = append(messages, obj)
+			continue
+		}
+		if header && obj["direction"] != nil {
+			return nil, fmt.Errorf("transcript line %d: an entry before the header", i+1)
+		}
+		header = false
+		for k, v := range obj {
+			doc[k] = v
+		}
+	}
+	if header {
+		return nil, fmt.Errorf("decode transcript: no header line")
+	}
+	doc["messages"] = messages
+	return doc, nil
+}
+
+// Encode writes t to w in format, client.FormatJSON or client.FormatJSONL,
+// at CurrentVersion, its messages as client.CanonicalJSON, so encoding the
+// same transcript always yields the same bytes.
+func Encode(w io.Writer, t Transcript, format string) error {
+	t.Version = CurrentVersion
+	t.Messages = canonicalMessages(t.Messages)
+	switch format {
+	case client.FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(t); err != nil {
+			return fmt.Errorf("encode transcript: %w", err)
+		}
+		return nil
+	case client.FormatJSONL:
+		bw := bufio.NewWriter(w)
+		header, err := marshal(headerOf(t))
+		if err != nil {
+			return fmt.Errorf("encode transcript: %w", err)
+		}
+		bw.Write(append(header, '\n'))
+		for _, e := range t.Messages {
+			line, err := marshal(e)
+			if err != nil {
+				return fmt.Errorf("encode transcript: %w", err)
+			}
+			bw.Write(append(line, '\n'))
+		}
+		if t.Summary != nil {
+			line, err := marshal(map[string]any{"summary": t.Summary})
+			if err != nil {
+				return fmt.Errorf("encode transcript: %w", err)
+			}
+			bw.Write(append(line, '\n'))
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("write transcript: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("transcript format %q: want %s or %s", format, client.FormatJSON, client.FormatJSONL)
+}
+
+// canonicalMessages returns a copy of messages, never nil, with each
+// message rewritten as client.CanonicalJSON.
+func canonicalMessages(messages []client.Entry) []client.Entry {
+	out := make([]client.Entry, len(messages))
+	for i, e := range messages {
+		e.Message = client.CanonicalJSON(e.Message)
+		out[i] = e
+	}
+	return out
+}
+
+// jsonlHeader is the first line of a JSONL transcript: its markers.
+type jsonlHeader struct {
+	Version         int    `json:"transcript_version"`
+	Client          string `json:"client"`
+	ClientBuild     string `json:"client_build,omitempty"`
+	Transport       string `json:"transport"`
+	Kind            string `json:"kind,omitempty"`
+	MTLS            bool   `json:"mtls,omitempty"`
+	WireProtocol    string `json:"wire_protocol,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	Codec           string `json:"codec,omitempty"`
+}
+
+func headerOf(t Transcript) jsonlHeader {
+	return jsonlHeader{
+		Version:         t.Version,
+		Client:          t.Client,
+		ClientBuild:     t.ClientBuild,
+		Transport:       t.Transport,
+		Kind:            t.Kind,
+		MTLS:            t.MTLS,
+		WireProtocol:    t.WireProtocol,
+		Protocol:        t.Protocol,
+		ProtocolVersion: t.ProtocolVersion,
+		Codec:           t.Codec,
+	}
+}
+
+// jsonlSink appends entries with a client.FileRecorder in FormatJSONL; the
+// Recorder feeding it has redacted them already.
+type jsonlSink struct {
+	r       *client.FileRecorder
+	started bool
+}
+
+func newJSONLSink(path string) *jsonlSink {
+	r := client.NewFileRecorder(path, "")
+	r.Config = client.RecorderConfig{NoDefaultRedactions: true, Format: client.FormatJSONL}
+	return &jsonlSink{r: r}
+}
+
+func (s *jsonlSink) mark(h Transcript) {
+	if !s.started {
+		s.started = true
+		s.r.Kind = h.Kind
+	}
+	s.r.MarkSession(client.SessionMarkers{Transport: h.Transport, MTLS: h.MTLS, Protocol: h.Protocol, ProtocolVersion: h.ProtocolVersion, WireProtocol: h.WireProtocol, Codec: h.Codec})
+}
+
+func (s *jsonlSink) WriteEntry(h Transcript, _ int, e client.Entry) error {
+	s.mark(h)
+	s.r.Record(e)
+	return s.r.Err()
+}
+
+func (s *jsonlSink) Close(h Transcript) error {
+	s.mark(h)
+	return s.r.Close()
+}
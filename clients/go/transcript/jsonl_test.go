@@ -0,0 +1,130 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestJSONLRoundTrip(t *testing.T) {
+	want, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.ProtocolVersion = "2024-11-05"
+	path := filepath.Join(t.TempDir(), "http.jsonl")
+	if err := Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+		t.Fatalf("JSONL round trip differs:\n%s", RenderText(diffs))
+	}
+	if errs := Validate(path); errs != nil {
+		t.Fatal(errs)
+	}
+	// Without the extension the content itself says JSONL.
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(content); err != nil {
+		t.Fatalf("Parse JSONL: %v", err)
+	}
+}
+
+func TestJSONLSinkMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	jsonl, err := NewFileSink(filepath.Join(dir, "session.log"), client.FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder(FileSink(filepath.Join(dir, "session.json")), jsonl)
+	rec.MarkSession(client.SessionMarkers{Transport: client.TransportHTTP})
+	for _, e := range session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z"},"params":{"api_key":"secret"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{}}`,
+	).Messages {
+		rec.Record(e)
+	}
+	rec.MarkSession(client.SessionMarkers{Transport: client.TransportHTTP, Protocol: "HTTP/3.0", ProtocolVersion: "2024-11-05"})
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want, err := Load(filepath.Join(dir, "session.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(filepath.Join(dir, "session.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+		t.Fatalf("JSONL sink differs from the JSON one:\n%s", RenderText(diffs))
+	}
+	if _, err := NewFileSink("t.json", "yaml"); err == nil {
+		t.Fatal("NewFileSink accepted format yaml")
+	}
+}
+
+func TestJSONLTruncatedLastLine(t *testing.T) {
+	doc := `{"transcript_version":2,"client":"go","transport":"stdio"}
+{"direction":"request","message":{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z"}}}
+{"direction":"response","message":{"jsonrpc":"2.0","id":1,"res`
+	got, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got.Transport != client.TransportStdio || len(got.Messages) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	// A malformed line before the last is an error, not a truncation.
+	if _, err := Parse([]byte(doc[:len(doc)-4] + "\n" + `{"direction":"response"}` + "\n")); err == nil {
+		t.Fatal("Parse accepted a malformed line mid-transcript")
+	}
+}
+
+func TestEncodeIsCanonical(t *testing.T) {
+	fields := map[string]string{"model": `"m"`, "dimension": `3`, "scale": `0.50`, "limit": `1e2`, "note": `"<a&b>"`, "tags": `{"z": 1, "a": 2}`}
+	want := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		// Map iteration lays the fields out in a different order each time.
+		var parts []string
+		for k, v := range fields {
+			parts = append(parts, fmt.Sprintf("%q: %s", k, v))
+		}
+		tr := Transcript{Client: client.ClientMarker, Transport: client.TransportHTTP, Messages: []client.Entry{{
+			Direction: client.DirectionResponse,
+			Message:   json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "result": {` + strings.Join(parts, ", ") + `}}`),
+		}}}
+		for _, format := range []string{client.FormatJSON, client.FormatJSONL} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tr, format); err != nil {
+				t.Fatal(err)
+			}
+			if want[format] == nil {
+				want[format] = buf.Bytes()
+			} else if !bytes.Equal(buf.Bytes(), want[format]) {
+				t.Fatalf("%s encoding %d differs:\n%s\nwant:\n%s", format, i, buf.Bytes(), want[format])
+			}
+		}
+	}
+	line := bytes.Split(want[client.FormatJSONL], []byte("\n"))[1]
+	if string(line) != `{"direction":"response","message":{"id":1,"jsonrpc":"2.0","result":{"dimension":3,"limit":100,"model":"m","note":"<a&b>","scale":0.5,"tags":{"a":2,"z":1}}}}` {
+		t.Fatalf("message encoded as %s", line)
+	}
+	for _, l := range bytes.Split(want[client.FormatJSON], []byte("\n")) {
+		if len(l) > 0 && (l[len(l)-1] == ' ' || l[len(l)-1] == '\t') {
+			t.Fatalf("trailing whitespace in %q", l)
+		}
+	}
+}
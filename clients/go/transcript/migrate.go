@@ -0,0 +1,137 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// CurrentVersion is the transcript_version this package reads natively and
+// writes.
+const CurrentVersion = client.TranscriptVersion
+
+// ErrClientTooOld is returned for a transcript written at a version newer
+// than CurrentVersion, which only a newer client can read.
+var ErrClientTooOld = errors.New("client too old")
+
+// migration upgrades a decoded document by one version. path is where the
+// document was read from, or empty.
+type migration func(doc any, path string) (any, error)
+
+// migrations[v-1] upgrades a version v document to version v+1, so there is
+// one per version below CurrentVersion.
+var migrations = []migration{
+	migrateV1,
+}
+
+// Migrate upgrades a transcript document to CurrentVersion, returning it
+// re-encoded along with the version it was written at. A current document
+// is returned as is. path, when not empty, is where data was read from:
+// version 1 fixtures may take their markers from it.
+func Migrate(data []byte, path string) ([]byte, int, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := documentVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from == CurrentVersion {
+		return data, from, nil
+	}
+	if doc, err = migrate(doc, from, path); err != nil {
+		return nil, from, err
+	}
+	raw, err := marshal(doc)
+	if err != nil {
+		return nil, from, fmt.Errorf("encode migrated transcript: %w", err)
+	}
+	return raw, from, nil
+}
+
+// migrate upgrades doc, at version from, to CurrentVersion.
+func migrate(doc any, from int, path string) (any, error) {
+	if from > CurrentVersion {
+		return nil, fmt.Errorf("transcript_version %d is newer than this client supports (%d): %w", from, CurrentVersion, ErrClientTooOld)
+	}
+	for v := from; v < CurrentVersion; v++ {
+		var err error
+		if doc, err = migrations[v-1](doc, path); err != nil {
+			return nil, fmt.Errorf("migrate transcript from version %d: %w", v, err)
+		}
+	}
+	return doc, nil
+}
+
+func decodeDocument(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode transcript: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decode transcript: data after the document at offset %d", dec.InputOffset())
+	}
+	return doc, nil
+}
+
+// documentVersion reads the transcript_version of doc. Documents without
+// one predate versioning and are version 1.
+func documentVersion(doc any) (int, error) {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return 1, nil
+	}
+	raw, ok := obj["transcript_version"]
+	if !ok {
+		return 1, nil
+	}
+	if n, ok := raw.(json.Number); ok {
+		if v, err := n.Int64(); err == nil && v >= 1 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("transcript_version %s is not a positive integer", compact(raw))
+}
+
+// migrateV1 upgrades the unversioned layouts. Version 1 documents are either
+// the current layout without transcript_version, or, in the oldest
+// fixtures, a bare array of envelopes. An array becomes a document: each
+// envelope with a method is a request and the others responses, and the
+// client and transport markers come from the fixture's
+// tests/fixtures/<client>/<transport>/ directory.
+func migrateV1(doc any, path string) (any, error) {
+	switch node := doc.(type) {
+	case map[string]any:
+		node["transcript_version"] = json.Number("2")
+		return node, nil
+	case []any:
+		messages := make([]any, len(node))
+		for i, env := range node {
+			obj, ok := env.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("element %d is %s, not an envelope", i, typeName(env))
+			}
+			direction := client.DirectionResponse
+			if _, ok := obj["method"]; ok {
+				direction = client.DirectionRequest
+			}
+			messages[i] = map[string]any{"direction": direction, "message": obj}
+		}
+		out := map[string]any{"transcript_version": json.Number("2"), "messages": messages}
+		if abs, err := filepath.Abs(path); path != "" && err == nil {
+			dir := filepath.Dir(abs)
+			out["transport"] = filepath.Base(dir)
+			out["client"] = filepath.Base(filepath.Dir(dir))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("a transcript is an object or an array of envelopes, not %s", typeName(doc))
+}
@@ -0,0 +1,97 @@
+package transcript
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	if len(migrations) != CurrentVersion-1 {
+		t.Fatalf("%d migrations registered for CurrentVersion %d", len(migrations), CurrentVersion)
+	}
+}
+
+func TestLoadMigratesV1Document(t *testing.T) {
+	old, err := Load(filepath.Join("testdata", "v1", "document.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Version != CurrentVersion {
+		t.Fatalf("Version = %d, want %d", old.Version, CurrentVersion)
+	}
+	if diffs := Diff(current, old, DiffOptions{}); diffs != nil {
+		t.Fatalf("migrated document differs from the current one:\n%s", RenderText(diffs))
+	}
+}
+
+func TestLoadMigratesV1EnvelopeArrays(t *testing.T) {
+	for _, name := range []string{"request.json", "response.json"} {
+		path := filepath.Join("testdata", "v1", "go", "http", name)
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.Version != CurrentVersion || got.Client != client.ClientMarker || got.Transport != client.TransportHTTP {
+			t.Fatalf("%s: markers = %+v", name, got)
+		}
+		want := client.DirectionRequest
+		if name == "response.json" {
+			want = client.DirectionResponse
+		}
+		if len(got.Messages) != 2 || got.Messages[0].Direction != want || got.Messages[1].Direction != want {
+			t.Fatalf("%s: messages = %+v", name, got.Messages)
+		}
+		if errs := Validate(path); errs != nil {
+			t.Fatalf("%s: %v", name, errs)
+		}
+	}
+}
+
+func TestMigrateRewritesAtCurrentVersion(t *testing.T) {
+	t1, err := Load(filepath.Join("testdata", "v1", "go", "http", "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "request.json")
+	if err := Save(path, t1); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, from, err := Migrate(content, path); err != nil || from != CurrentVersion {
+		t.Fatalf("saved transcript at version %d, %v", from, err)
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "future.json")
+	doc := `{"transcript_version": 99, "client": "go", "transport": "http", "messages": []}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if !errors.Is(err, ErrClientTooOld) {
+		t.Fatalf("Load = %v, want ErrClientTooOld", err)
+	}
+	if _, err := Parse([]byte(`{"transcript_version": "2"}`)); err == nil {
+		t.Fatal("Parse accepted a string transcript_version")
+	}
+}
+
+func TestParseRejectsTrailingData(t *testing.T) {
+	for _, doc := range []string{`{}}0`, `{"transcript_version": 1} x`, `[] []`} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Parse accepted %q", doc)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package transcript
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile fails where the standard library cannot map files, as on
+// Windows, so EntryReader falls back to a buffered stream.
+func mapFile(*os.File, int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory mapping is not supported on this platform")
+}
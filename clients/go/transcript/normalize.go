@@ -0,0 +1,253 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// NormalizeRulesFile is the name of the shared rules file,
+// tests/fixtures/normalize.json.
+const NormalizeRulesFile = "normalize.json"
+
+// Rule maps the values that change from run to run, such as timestamps and
+// ports, to a stable placeholder. At least one of Pointer, Field, and Match
+// selects the values:
+//
+//   - Pointer is a JSON pointer into the transcript document, where a "*"
+//     segment matches any key or index.
+//   - Field is a field name, matched at any depth with path.Match
+//     wildcards.
+//   - Match is a regular expression. On its own it rewrites every match
+//     within every string value; with Pointer or Field it rewrites only
+//     the selected values, and only where it matches.
+//
+// A rule without Match replaces the whole selected value with Placeholder.
+// With Match, Placeholder is a regexp replacement template, so "$1:<port>"
+// keeps the first group. A Remove rule drops the selected fields instead,
+// for values such as timings whose type a placeholder would change; it
+// takes Pointer or Field and no Placeholder.
+type Rule struct {
+	Pointer     string `json:"pointer,omitempty"`
+	Field       string `json:"field,omitempty"`
+	Match       string `json:"match,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+	Remove      bool   `json:"remove,omitempty"`
+}
+
+// DefaultRules are the rules of the shared rules file, for callers outside
+// this repository, such as transcripttest, that cannot read it. They are
+// kept in step with tests/fixtures/normalize.json.
+var DefaultRules = []Rule{
+	{Pointer: "/messages/*/sent_at", Remove: true},
+	{Pointer: "/messages/*/received_at", Remove: true},
+	{Pointer: "/messages/*/duration_ms", Remove: true},
+	{Pointer: "/messages/*/trace", Remove: true},
+	{Pointer: "/messages/*/message/meta/timestamp", Placeholder: "<timestamp>"},
+	{Pointer: "/messages/*/message/params/client/user_agent", Placeholder: "<user-agent>"},
+	{Field: "*_at", Match: `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`, Placeholder: "<timestamp>"},
+	{Field: "request_id", Placeholder: "<request-id>"},
+	{Match: `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, Placeholder: "<uuid>"},
+	{Field: "latency_ms", Placeholder: "<duration>"},
+	{Field: "*_duration_ms", Placeholder: "<duration>"},
+	{Field: "duration_ms", Placeholder: "<duration>"},
+	{Match: `(127\.0\.0\.1|localhost|\[::1\]):\d+`, Placeholder: "$1:<port>"},
+}
+
+// DefaultNormalizer returns a Normalizer applying DefaultRules.
+func DefaultNormalizer() *Normalizer {
+	n, err := NewNormalizer(DefaultRules...)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// rulesFile is the layout of NormalizeRulesFile.
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+type compiledRule struct {
+	Rule
+	pointer []string
+	match   *regexp.Regexp
+}
+
+// Normalizer applies Rules to transcripts. A nil *Normalizer leaves
+// transcripts unchanged.
+type Normalizer struct {
+	rules []compiledRule
+}
+
+// NewNormalizer compiles rules, applied in order.
+func NewNormalizer(rules ...Rule) (*Normalizer, error) {
+	n := &Normalizer{}
+	for i, r := range rules {
+		c := compiledRule{Rule: r}
+		if r.Pointer == "" && r.Field == "" && r.Match == "" {
+			return nil, fmt.Errorf("rule %d: one of pointer, field, or match is required", i)
+		}
+		switch {
+		case r.Remove && r.Pointer == "" && r.Field == "":
+			return nil, fmt.Errorf("rule %d: remove needs a pointer or field", i)
+		case r.Remove && r.Placeholder != "":
+			return nil, fmt.Errorf("rule %d: remove takes no placeholder", i)
+		case !r.Remove && r.Placeholder == "":
+			return nil, fmt.Errorf("rule %d: placeholder is required", i)
+		}
+		if r.Pointer != "" {
+			c.pointer = splitPointer(r.Pointer)
+		}
+		if r.Field != "" {
+			if _, err := path.Match(r.Field, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: field %q: %w", i, r.Field, err)
+			}
+		}
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			c.match = re
+		}
+		n.rules = append(n.rules, c)
+	}
+	return n, nil
+}
+
+// LoadNormalizer reads a rules file such as tests/fixtures/normalize.json:
+// {"rules": [Rule, ...]}.
+func LoadNormalizer(path string) (*Normalizer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f rulesFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	n, err := NewNormalizer(f.Rules...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Normalize returns t with the values its rules select replaced by their
+// placeholders. Normalizing twice changes nothing further.
+func (n *Normalizer) Normalize(t Transcript) (Transcript, error) {
+	if n == nil || len(n.rules) == 0 {
+		return t, nil
+	}
+	raw, err := marshal(n.apply(tree(t)))
+	if err != nil {
+		return Transcript{}, fmt.Errorf("normalize transcript: %w", err)
+	}
+	var out Transcript
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Transcript{}, fmt.Errorf("normalize transcript: %w", err)
+	}
+	return out, nil
+}
+
+// apply normalizes a transcript document in the generic form Diff walks.
+func (n *Normalizer) apply(doc any) any {
+	if n == nil {
+		return doc
+	}
+	if v := n.walk(nil, doc); v != removed {
+		return v
+	}
+	return nil
+}
+
+// removedValue is the type of removed, what walk returns for a value a
+// Remove rule drops.
+type removedValue struct{}
+
+var removed any = removedValue{}
+
+func (n *Normalizer) walk(at []string, v any) any {
+	for _, r := range n.rules {
+		if r.pointer == nil && r.Field == "" {
+			continue
+		}
+		if r.pointer != nil && !pointerMatches(r.pointer, at) {
+			continue
+		}
+		if r.Field != "" {
+			if len(at) == 0 {
+				continue
+			}
+			if ok, _ := path.Match(r.Field, at[len(at)-1]); !ok {
+				continue
+			}
+		}
+		if r.match == nil {
+			if r.Remove {
+				return removed
+			}
+			return r.Placeholder
+		}
+		if s, ok := scalarText(v); ok && r.match.MatchString(s) {
+			if r.Remove {
+				return removed
+			}
+			return r.match.ReplaceAllString(s, r.Placeholder)
+		}
+	}
+	switch node := v.(type) {
+	case map[string]any:
+		for k, child := range node {
+			if c := n.walk(append(at[:len(at):len(at)], k), child); c != removed {
+				node[k] = c
+			} else {
+				delete(node, k)
+			}
+		}
+	case []any:
+		kept := node[:0]
+		for i, child := range node {
+			if c := n.walk(append(at[:len(at):len(at)], strconv.Itoa(i)), child); c != removed {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	case string:
+		for _, r := range n.rules {
+			if r.pointer == nil && r.Field == "" {
+				node = r.match.ReplaceAllString(node, r.Placeholder)
+			}
+		}
+		return node
+	}
+	return v
+}
+
+// scalarText is the text a Match rule sees for v: a string's contents or a
+// number's digits.
+func scalarText(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	}
+	return "", false
+}
+
+func pointerMatches(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, seg := range pattern {
+		if seg != "*" && seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
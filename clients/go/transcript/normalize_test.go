@@ -0,0 +1,166 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixturesDir is tests/fixtures, relative to this package.
+var fixturesDir = filepath.Join("..", "..", "..", "tests", "fixtures")
+
+// sharedRules loads tests/fixtures/normalize.json.
+func sharedRules(t *testing.T) *Normalizer {
+	t.Helper()
+	n, err := LoadNormalizer(filepath.Join(fixturesDir, NormalizeRulesFile))
+	if err != nil {
+		t.Fatalf("LoadNormalizer: %v", err)
+	}
+	return n
+}
+
+func TestDefaultRulesMatchSharedFile(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join(fixturesDir, NormalizeRulesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f rulesFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.Rules, DefaultRules) {
+		t.Fatalf("DefaultRules drifted from %s:\n got %+v\nwant %+v", NormalizeRulesFile, DefaultRules, f.Rules)
+	}
+	DefaultNormalizer()
+}
+
+func TestNormalizeSharedRules(t *testing.T) {
+	n := sharedRules(t)
+	run := func(stamp, port, key string, latency string) Transcript {
+		return session(
+			`{"jsonrpc":"2.0","id":1,"method":"mcp.initialize","params":{"endpoint":"http://127.0.0.1:`+port+`/mcp"},"meta":{"timestamp":"`+stamp+`","sequence":1,"idempotency_key":"`+key+`"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":{"latency_ms":`+latency+`,"started_at":"`+stamp+`","sse_endpoint":"http://localhost:`+port+`/events"}}`,
+		)
+	}
+	a := run("2024-01-17T10:05:00Z", "8890", "5b0f3c3e-8a8e-4f7e-9d55-0f1c2b7a9e10", "4.2")
+	b := run("2026-10-14T08:00:00.123Z", "41233", "0d5e1f7a-1111-4c2b-8e3d-9a8b7c6d5e4f", "17")
+
+	if Diff(a, b, DiffOptions{}) == nil {
+		t.Fatal("runs should differ before normalization")
+	}
+	if diffs := Diff(a, b, DiffOptions{Normalizer: n}); diffs != nil {
+		t.Fatalf("normalized runs differ:\n%s", RenderText(diffs))
+	}
+
+	// Fixtures written from either run are byte-identical, and normalizing
+	// again changes nothing.
+	var files [2][]byte
+	for i, tr := range []Transcript{a, b} {
+		normalized, err := n.Normalize(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := n.Normalize(normalized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "http.json")
+		if err := Save(path, again); err != nil {
+			t.Fatal(err)
+		}
+		if files[i], err = os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(files[0], files[1]) {
+		t.Fatalf("normalized fixtures differ:\n%s\n%s", files[0], files[1])
+	}
+	for _, want := range []string{`"<timestamp>"`, `"<uuid>"`, `"<duration>"`, `127.0.0.1:<port>/mcp`, `localhost:<port>/events`} {
+		if !bytes.Contains(files[0], []byte(want)) {
+			t.Errorf("normalized fixture lacks %s:\n%s", want, files[0])
+		}
+	}
+}
+
+func TestNormalizerRules(t *testing.T) {
+	if _, err := NewNormalizer(Rule{Placeholder: "<x>"}); err == nil {
+		t.Error("rule without a selector accepted")
+	}
+	if _, err := NewNormalizer(Rule{Field: "id"}); err == nil {
+		t.Error("rule without a placeholder accepted")
+	}
+	if _, err := NewNormalizer(Rule{Match: "(", Placeholder: "<x>"}); err == nil {
+		t.Error("invalid regexp accepted")
+	}
+	if _, err := NewNormalizer(Rule{Match: "x", Remove: true}); err == nil {
+		t.Error("remove rule without a pointer or field accepted")
+	}
+	if _, err := NewNormalizer(Rule{Field: "id", Remove: true, Placeholder: "<x>"}); err == nil {
+		t.Error("remove rule with a placeholder accepted")
+	}
+
+	// A pointer with a match rewrites only matching values at the pointer.
+	n, err := NewNormalizer(Rule{Pointer: "/messages/*/message/id", Match: `^\d+$`, Placeholder: "<id>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Normalize(session(`{"id":7,"params":{"id":8}}`, `{"id":"abc"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := session(`{"id":"<id>","params":{"id":8}}`, `{"id":"abc"}`)
+	if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+		t.Fatalf("unexpected normalization:\n%s", RenderText(diffs))
+	}
+	var none *Normalizer
+	if tr, err := none.Normalize(want); err != nil || Diff(want, tr, DiffOptions{}) != nil {
+		t.Fatalf("nil normalizer changed the transcript: %v", err)
+	}
+}
+
+func TestNormalizeSharedRulesDropTimings(t *testing.T) {
+	timed, err := Load(filepath.Join("testdata", "timed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	untimed := timed
+	untimed.Messages = nil
+	for _, e := range timed.Messages {
+		e.SentAt, e.ReceivedAt, e.DurationMS = "", "", 0
+		untimed.Messages = append(untimed.Messages, e)
+	}
+	n := sharedRules(t)
+	if diffs := Diff(untimed, timed, DiffOptions{Normalizer: n}); diffs != nil {
+		t.Fatalf("timings diffed:\n%s", RenderText(diffs))
+	}
+	got, err := n.Normalize(timed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range got.Messages {
+		if e.SentAt != "" || e.ReceivedAt != "" || e.DurationMS != 0 {
+			t.Fatalf("message %d kept its timings: %+v", i, e)
+		}
+	}
+	if len(got.Messages) != len(timed.Messages) {
+		t.Fatalf("normalizing dropped messages: %d of %d left", len(got.Messages), len(timed.Messages))
+	}
+}
+
+func TestNormalizeRemove(t *testing.T) {
+	n, err := NewNormalizer(Rule{Field: "trace", Remove: true}, Rule{Pointer: "/messages/*/message/tags/1", Remove: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Normalize(session(`{"id":1,"trace":"x","params":{"trace":{"span":2}},"tags":["a","b","c"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := session(`{"id":1,"params":{},"tags":["a","c"]}`)
+	if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+		t.Fatalf("unexpected normalization:\n%s", RenderText(diffs))
+	}
+}
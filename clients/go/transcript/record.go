@@ -0,0 +1,444 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Sink stores the entries of a Recorder as they are recorded.
+type Sink interface {
+	// WriteEntry stores entry, the index'th of the transcript whose markers
+	// are header.
+	WriteEntry(header Transcript, index int, entry client.Entry) error
+	// Close completes the transcript; header holds the final markers.
+	Close(header Transcript) error
+}
+
+// Recorder records a client session into its sinks, entry by entry, so a
+// session that ends abruptly still leaves the transcript of what happened
+// up to that point. Requests that fail without a response, including
+// timeouts, are recorded as client.DirectionError entries.
+//
+// Attach it to a client with client.WithTranscriptRecorder, or as the
+// innermost client.WithInterceptor by passing its Intercept method; not
+// both, or every envelope is recorded twice.
+type Recorder struct {
+	// Header holds the markers written ahead of the messages. Client
+	// defaults to client.ClientMarker, and with it ClientBuild to this
+	// build's; client.Run and client.RunPing fill in the rest through
+	// MarkSession. Set it before recording starts.
+	Header Transcript
+	// Config selects what is redacted before entries reach the sinks; the
+	// zero value applies client.DefaultRedactions. Set it before recording
+	// starts.
+	Config client.RecorderConfig
+
+	mu       sync.Mutex
+	sinks    []Sink
+	redactor *client.Redactor
+	filter   *client.Filter
+	n        int
+	summary  client.TranscriptSummary
+	err      error
+	closed   bool
+}
+
+// NewRecorder returns a Recorder writing to sinks.
+func NewRecorder(sinks ...Sink) *Recorder {
+	return &Recorder{sinks: sinks}
+}
+
+// Record filters and redacts entry and writes it to every sink, its message
+// as client.CanonicalJSON. The first
+// sink error is kept for Err and Close; recording goes on in the other
+// sinks.
+func (r *Recorder) Record(entry client.Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if r.redactor == nil {
+		r.redactor = client.NewRedactor(r.Config)
+		r.filter = client.NewFilter(r.Config.Filter)
+	}
+	for _, e := range r.filter.Filter(r.Header.Transport, entry) {
+		r.record(e)
+	}
+}
+
+// record writes entry unfiltered; the caller holds mu.
+func (r *Recorder) record(entry client.Entry) {
+	entry.Message = client.CanonicalJSON(r.redactor.Redact(r.n, entry.Message))
+	header := r.header()
+	for _, s := range r.sinks {
+		if err := s.WriteEntry(header, r.n, entry); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	r.n++
+	r.summary.Add(entry)
+}
+
+// Intercept is a client.Interceptor recording req, then the response or the
+// failure next returns, each stamped with the round trip.
+func (r *Recorder) Intercept(ctx context.Context, req *client.Request, next client.Invoker) (*client.Response, error) {
+	sent := time.Now()
+	r.recordMessage(client.DirectionRequest, req, sent, time.Time{})
+	resp, err := next(ctx, req)
+	received := time.Now()
+	if err != nil {
+		r.Record(client.FailureEntry(req, err).Timed(sent, received))
+	} else {
+		r.recordMessage(client.DirectionResponse, resp, sent, received)
+	}
+	return resp, err
+}
+
+func (r *Recorder) recordMessage(direction string, message any, sent, received time.Time) {
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	r.Record(client.Entry{Direction: direction, Message: raw}.Timed(sent, received))
+}
+
+// MarkSession stores the markers of the session recorded.
+func (r *Recorder) MarkSession(m client.SessionMarkers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Header.Transport, r.Header.MTLS = m.Transport, m.MTLS
+	r.Header.Protocol, r.Header.ProtocolVersion = m.Protocol, m.ProtocolVersion
+	r.Header.WireProtocol, r.Header.Codec = m.WireProtocol, m.Codec
+}
+
+// Err returns the first error a sink reported.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close completes the transcript in every sink, ending it with a
+// client.TranscriptSummary, and reports the first error any sink returned
+// while recording, joined with those of closing. Entries recorded
+// afterwards are dropped.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	for _, e := range r.filter.Flush() {
+		r.record(e)
+	}
+	r.closed = true
+	errs := []error{r.err}
+	header := r.header()
+	summary := r.summary
+	header.Summary = &summary
+	for _, s := range r.sinks {
+		errs = append(errs, s.Close(header))
+	}
+	r.err = errors.Join(errs...)
+	return r.err
+}
+
+// header returns Header with its defaults and without messages or summary.
+func (r *Recorder) header() Transcript {
+	h := r.Header
+	h.Version = CurrentVersion
+	if h.Client == "" {
+		h.Client = client.ClientMarker
+	}
+	if h.ClientBuild == "" && h.Client == client.ClientMarker {
+		h.ClientBuild = client.Build().UserAgent()
+	}
+	h.Messages, h.Summary = nil, nil
+	return h
+}
+
+// documentWriter renders a transcript document piece by piece, in the
+// layout client.FileRecorder writes. The markers known when recording
+// starts lead the document; the protocol markers, negotiated later, and
+// the summary follow the messages.
+type documentWriter struct {
+	n int
+}
+
+// head opens the document up to its first message.
+func (d *documentWriter) head(h Transcript) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	writeField(&buf, "transcript_version", h.Version)
+	writeField(&buf, "client", h.Client)
+	if h.ClientBuild != "" {
+		writeField(&buf, "client_build", h.ClientBuild)
+	}
+	writeField(&buf, "transport", h.Transport)
+	if h.Kind != "" {
+		writeField(&buf, "kind", h.Kind)
+	}
+	if h.MTLS {
+		writeField(&buf, "mtls", true)
+	}
+	if h.WireProtocol != "" {
+		writeField(&buf, "wire_protocol", h.WireProtocol)
+	}
+	buf.WriteString(`  "messages": [`)
+	return buf.Bytes()
+}
+
+// entry renders the next message.
+func (d *documentWriter) entry(e client.Entry) ([]byte, error) {
+	raw, err := marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("encode transcript entry: %w", err)
+	}
+	var buf bytes.Buffer
+	if d.n > 0 {
+		buf.WriteByte(',')
+	}
+	buf.WriteString("\n    ")
+	if err := json.Indent(&buf, raw, "    ", "  "); err != nil {
+		return nil, fmt.Errorf("encode transcript entry: %w", err)
+	}
+	d.n++
+	return buf.Bytes(), nil
+}
+
+// tail closes the document after the messages written so far, while more
+// may follow.
+func (d *documentWriter) tail() []byte {
+	return []byte("\n  ]\n}\n")
+}
+
+// end closes the completed document.
+func (d *documentWriter) end(h Transcript) []byte {
+	var buf bytes.Buffer
+	if d.n > 0 {
+		buf.WriteString("\n  ]")
+	} else {
+		buf.WriteString("]")
+	}
+	if h.Protocol != "" {
+		buf.WriteString(",\n")
+		writeMember(&buf, "protocol", h.Protocol)
+	}
+	if h.ProtocolVersion != "" {
+		buf.WriteString(",\n")
+		writeMember(&buf, "protocol_version", h.ProtocolVersion)
+	}
+	if h.Codec != "" {
+		buf.WriteString(",\n")
+		writeMember(&buf, "codec", h.Codec)
+	}
+	if h.Summary != nil {
+		buf.WriteString(",\n")
+		writeMember(&buf, "summary", h.Summary)
+	}
+	buf.WriteString("\n}\n")
+	return buf.Bytes()
+}
+
+func writeField(buf *bytes.Buffer, name string, value any) {
+	writeMember(buf, name, value)
+	buf.WriteString(",\n")
+}
+
+func writeMember(buf *bytes.Buffer, name string, value any) {
+	raw, _ := marshal(value)
+	fmt.Fprintf(buf, "  %q: %s", name, raw)
+}
+
+// FileSink returns a Sink writing the transcript to path, creating parent
+// directories as needed, in the format its extension implies. After every
+// entry a JSON file holds a complete, valid document, so it survives a
+// crash of the recording process; see NewFileSink for JSONL.
+func FileSink(path string) Sink {
+	sink, _ := NewFileSink(path, "")
+	return sink
+}
+
+// NewFileSink returns a Sink writing the transcript to path in format, or
+// in the format the extension of path implies when format is empty. A
+// client.FormatJSONL sink appends each entry as a line, flushed within a
+// second, and never holds the session in memory; a crash loses at most
+// the lines not yet flushed.
+func NewFileSink(path, format string) (Sink, error) {
+	switch client.TranscriptFormat(path, format) {
+	case client.FormatJSON:
+		return &fileSink{path: path}, nil
+	case client.FormatJSONL:
+		return newJSONLSink(path), nil
+	}
+	return nil, fmt.Errorf("transcript format %q: want %s or %s", format, client.FormatJSON, client.FormatJSONL)
+}
+
+type fileSink struct {
+	path string
+	f    *os.File
+	doc  documentWriter
+	// end is the offset where the document's tail starts.
+	end int64
+	err error
+}
+
+func (s *fileSink) open(h Transcript) error {
+	if s.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create transcript directory: %w", err)
+	}
+	f, err := os.Create(s.path)
+	if err != nil {
+		return fmt.Errorf("create transcript: %w", err)
+	}
+	s.f = f
+	return s.writeAt(s.doc.head(h))
+}
+
+// writeAt writes p at the end of the messages.
+func (s *fileSink) writeAt(p []byte) error {
+	if _, err := s.f.WriteAt(p, s.end); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	s.end += int64(len(p))
+	return nil
+}
+
+func (s *fileSink) WriteEntry(h Transcript, _ int, e client.Entry) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.writeEntry(h, e)
+	return s.err
+}
+
+func (s *fileSink) writeEntry(h Transcript, e client.Entry) error {
+	if err := s.open(h); err != nil {
+		return err
+	}
+	raw, err := s.doc.entry(e)
+	if err != nil {
+		return err
+	}
+	if err := s.writeAt(raw); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(s.doc.tail(), s.end); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) Close(h Transcript) error {
+	if s.f == nil && s.err == nil {
+		s.err = s.open(h)
+	}
+	if s.f == nil {
+		return s.err
+	}
+	err := s.err
+	if err == nil {
+		err = s.writeAt(s.doc.end(h))
+	}
+	if err == nil {
+		if terr := s.f.Truncate(s.end); terr != nil {
+			err = fmt.Errorf("write transcript: %w", terr)
+		}
+	}
+	if cerr := s.f.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("write transcript: %w", cerr)
+	}
+	return err
+}
+
+// WriterSink returns a Sink streaming the transcript document to w as it
+// is recorded. The document is complete once the sink is closed; w itself
+// is left open.
+func WriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	w       io.Writer
+	doc     documentWriter
+	started bool
+	err     error
+}
+
+func (s *writerSink) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	if _, err := s.w.Write(p); err != nil {
+		s.err = fmt.Errorf("write transcript: %w", err)
+	}
+}
+
+func (s *writerSink) start(h Transcript) {
+	if !s.started {
+		s.started = true
+		s.write(s.doc.head(h))
+	}
+}
+
+func (s *writerSink) WriteEntry(h Transcript, _ int, e client.Entry) error {
+	s.start(h)
+	raw, err := s.doc.entry(e)
+	if err != nil {
+		return err
+	}
+	s.write(raw)
+	return s.err
+}
+
+func (s *writerSink) Close(h Transcript) error {
+	s.start(h)
+	s.write(s.doc.end(h))
+	return s.err
+}
+
+// MemorySink keeps the transcript in memory, for tests. The zero value is
+// ready to use.
+type MemorySink struct {
+	mu sync.Mutex
+	t  Transcript
+}
+
+func (s *MemorySink) WriteEntry(h Transcript, _ int, e client.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.Messages = append(s.t.Messages, e)
+	s.t = h
+	return nil
+}
+
+func (s *MemorySink) Close(h Transcript) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.Messages = s.t.Messages
+	s.t = h
+	return nil
+}
+
+// Transcript returns what has been recorded so far.
+func (s *MemorySink) Transcript() Transcript {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.t
+	t.Messages = append([]client.Entry(nil), t.Messages...)
+	return t
+}
@@ -0,0 +1,224 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestFileSinkIsValidMidSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session", "http.json")
+	mem := &MemorySink{}
+	rec := NewRecorder(FileSink(path), mem)
+	rec.MarkSession(client.SessionMarkers{Transport: client.TransportHTTP})
+
+	for i, e := range session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:01Z"},"params":{"api_key":"secret"}}`,
+	).Messages {
+		rec.Record(e)
+		// Every write leaves a complete document behind.
+		if errs := Validate(path); errs != nil {
+			t.Fatalf("after entry %d: %v", i, errs)
+		}
+		got, err := Load(path)
+		if err != nil || len(got.Messages) != i+1 || got.Transport != client.TransportHTTP || got.Summary != nil {
+			t.Fatalf("after entry %d: %+v, %v", i, got, err)
+		}
+	}
+	rec.MarkSession(client.SessionMarkers{Transport: client.TransportHTTP, ProtocolVersion: "2024-11-05"})
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Client != client.ClientMarker || got.ProtocolVersion != "2024-11-05" {
+		t.Fatalf("markers = %+v", got)
+	}
+	if s := got.Summary; s == nil || s.Messages != 3 || s.Requests != 2 || s.Responses != 1 || s.Failures != 0 {
+		t.Fatalf("summary = %+v", got.Summary)
+	}
+	if bytes.Contains(got.Messages[2].Message, []byte("secret")) {
+		t.Fatalf("credential recorded: %s", got.Messages[2].Message)
+	}
+	if diffs := Diff(got, mem.Transcript(), DiffOptions{}); diffs != nil {
+		t.Fatalf("file and memory sinks differ:\n%s", RenderText(diffs))
+	}
+}
+
+func TestFileSinkEmptySession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.json")
+	rec := NewRecorder(FileSink(path))
+	rec.Header.Transport = client.TransportStdio
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if errs := Validate(path); errs != nil {
+		t.Fatal(errs)
+	}
+}
+
+func TestWriterSinkMatchesFileRecorder(t *testing.T) {
+	entries := session(
+		`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2024-01-17T10:05:00Z"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`,
+	).Messages
+	path := filepath.Join(t.TempDir(), "file.json")
+	file := client.NewFileRecorder(path, client.TransportStdio)
+	file.Protocol = "HTTP/3.0"
+	var buf bytes.Buffer
+	rec := NewRecorder(WriterSink(&buf))
+	rec.MarkSession(client.SessionMarkers{Transport: client.TransportStdio, Protocol: "HTTP/3.0"})
+	for _, e := range entries {
+		file.Record(e)
+		rec.Record(e)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("streamed document: %v\n%s", err, buf.Bytes())
+	}
+	if diffs := Diff(want, got, DiffOptions{}); diffs != nil {
+		t.Fatalf("writer sink differs from FileRecorder:\n%s", RenderText(diffs))
+	}
+	if build := client.Build().UserAgent(); want.ClientBuild != build || got.ClientBuild != build {
+		t.Fatalf("client builds %q and %q, want %q", want.ClientBuild, got.ClientBuild, build)
+	}
+}
+
+func TestRecorderRecordsFailures(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(req client.Request) (client.Response, error) {
+		if req.Method == "mcp.ping" {
+			<-release
+		}
+		return client.Response{Result: json.RawMessage(`{}`)}, nil
+	}
+	mem := &MemorySink{}
+	rec := NewRecorder(mem)
+	rec.Header.Transport = client.TransportInProc
+	c, err := client.New(client.ClientConfig{Transport: client.TransportInProc, Handler: handler, Recorder: rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Ping(ctx); err == nil {
+		t.Fatal("Ping succeeded past its deadline")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mem.Transcript()
+	if len(got.Messages) != 2 || got.Messages[1].Direction != client.DirectionError {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	var failure client.Failure
+	if err := json.Unmarshal(got.Messages[1].Message, &failure); err != nil {
+		t.Fatal(err)
+	}
+	if failure.Method != "mcp.ping" || failure.Class != "timeout" || !failure.Timeout {
+		t.Fatalf("failure = %+v", failure)
+	}
+	raw, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateBytes(raw); errs != nil {
+		t.Fatalf("transcript with a failure invalid: %v", errs)
+	}
+}
+
+func TestRecorderIntercept(t *testing.T) {
+	mem := &MemorySink{}
+	rec := NewRecorder(mem)
+	rec.Header.Transport = client.TransportInProc
+	handler := func(req client.Request) (client.Response, error) {
+		return client.Response{Result: json.RawMessage(`{}`)}, nil
+	}
+	c, err := client.New(client.ClientConfig{
+		Transport:    client.TransportInProc,
+		Handler:      handler,
+		Interceptors: []client.Interceptor{rec.Intercept},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	got := mem.Transcript().Messages
+	if len(got) != 2 || got[0].Direction != client.DirectionRequest || got[1].Direction != client.DirectionResponse {
+		t.Fatalf("messages = %+v", got)
+	}
+	if got[0].SentAt == "" || got[0].ReceivedAt != "" || got[1].SentAt != got[0].SentAt || got[1].ReceivedAt == "" {
+		t.Fatalf("timings = %+v", got)
+	}
+	raw, err := json.Marshal(mem.Transcript())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateBytes(raw); errs != nil {
+		t.Fatalf("timed transcript invalid: %v", errs)
+	}
+}
+
+func TestRecorderFilters(t *testing.T) {
+	mem := &MemorySink{}
+	rec := NewRecorder(mem)
+	rec.Header.Transport = client.TransportInProc
+	rec.Config.Filter = client.RecordFilter{Skip: []string{"mcp.ping"}, Tombstones: true}
+	handler := func(req client.Request) (client.Response, error) {
+		return client.Response{Result: json.RawMessage(`{}`)}, nil
+	}
+	c, err := client.New(client.ClientConfig{Transport: client.TransportInProc, Handler: handler, Recorder: rec})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close(context.Background())
+	for i := 0; i < 3; i++ {
+		if _, err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	}
+	if got := mem.Transcript().Messages; len(got) != 0 {
+		t.Fatalf("skipped pings recorded: %+v", got)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := mem.Transcript()
+	if len(got.Messages) != 1 || got.Messages[0].Direction != client.DirectionSkipped || string(got.Messages[0].Message) != `{"count":3,"method":"mcp.ping"}` {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	raw, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateBytes(raw); errs != nil {
+		t.Fatalf("transcript with a tombstone invalid: %v", errs)
+	}
+}
@@ -0,0 +1,53 @@
+package transcript
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// redactedPaths are the fields of testdata/unredacted.json that the default
+// redactions replace.
+var redactedPaths = []string{
+	"/messages/0/message/params/transport/headers/Authorization",
+	"/messages/1/message/result/refresh_token",
+	"/messages/2/message/params/api_key",
+	"/messages/*/message/meta/idempotency_key",
+}
+
+func TestRedactedFixturesDiffCleanly(t *testing.T) {
+	raw, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted, err := Load(filepath.Join("testdata", "redacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recording the raw session again reproduces the redacted fixture.
+	path := filepath.Join(t.TempDir(), "http.json")
+	rec := client.NewFileRecorder(path, raw.Transport)
+	for _, e := range raw.Messages {
+		rec.Record(e)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(redacted, again, DiffOptions{}); diffs != nil {
+		t.Fatalf("re-recorded transcript differs from the fixture:\n%s", RenderText(diffs))
+	}
+
+	diffs := Diff(raw, redacted, DiffOptions{})
+	if len(diffs) != len(redactedPaths) {
+		t.Fatalf("expected %d redacted fields, got:\n%s", len(redactedPaths), RenderText(diffs))
+	}
+	if diffs := Diff(raw, redacted, DiffOptions{Ignore: redactedPaths}); diffs != nil {
+		t.Fatalf("redacted and unredacted runs differ beyond the redacted paths:\n%s", RenderText(diffs))
+	}
+}
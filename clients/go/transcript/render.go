@@ -0,0 +1,96 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// RenderText formats diffs as a unified diff, one hunk per difference headed
+// by its pointer, with expected lines prefixed "-" and actual lines "+".
+// It returns "" when diffs is empty.
+func RenderText(diffs []Difference) string {
+	return renderText(diffs, false)
+}
+
+// RenderColor is RenderText with ANSI colors for terminals: removed lines
+// red, added lines green, and hunk headers cyan.
+func RenderColor(diffs []Difference) string {
+	return renderText(diffs, true)
+}
+
+// RenderTraces formats traces a line each, to lead the differences they
+// link. It returns "" when traces is empty.
+func RenderTraces(traces []MessageTrace) string {
+	var b strings.Builder
+	for _, m := range traces {
+		b.WriteString(m.String() + "\n")
+	}
+	return b.String()
+}
+
+// ANSI escapes RenderColor uses.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[0m"
+)
+
+func renderText(diffs []Difference, color bool) string {
+	if len(diffs) == 0 {
+		return ""
+	}
+	paint := func(code, line string) string {
+		if !color {
+			return line + "\n"
+		}
+		return code + line + ansiReset + "\n"
+	}
+	var b strings.Builder
+	b.WriteString(paint(ansiBold, "--- expected"))
+	b.WriteString(paint(ansiBold, "+++ actual"))
+	for _, d := range diffs {
+		b.WriteString(paint(ansiCyan, "@@ "+d.Pointer+" ("+d.Kind+") @@"))
+		writeLines(&b, "-", d.Expected, func(line string) string { return paint(ansiRed, line) })
+		writeLines(&b, "+", d.Actual, func(line string) string { return paint(ansiGreen, line) })
+	}
+	return b.String()
+}
+
+func writeLines(b *strings.Builder, prefix string, value json.RawMessage, paint func(string) string) {
+	if len(value) == 0 {
+		return
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, value, "", "  "); err != nil {
+		pretty.Reset()
+		pretty.Write(value)
+	}
+	for _, line := range strings.Split(pretty.String(), "\n") {
+		b.WriteString(paint(prefix + line))
+	}
+}
+
+// Report is the machine-readable form of a comparison.
+type Report struct {
+	Equal       bool         `json:"equal"`
+	Differences []Difference `json:"differences"`
+	// ClientBuilds are the ClientBuild markers of the expected and actual
+	// transcripts of a comparison that found differences, when they
+	// differ too.
+	ClientBuilds []string `json:"client_builds,omitempty"`
+	// Traces link the messages that differ to the server's traces and
+	// logs, when either transcript recorded them; see Traces.
+	Traces []MessageTrace `json:"traces,omitempty"`
+}
+
+// RenderJSON formats diffs as an indented Report.
+func RenderJSON(diffs []Difference) ([]byte, error) {
+	report := Report{Equal: len(diffs) == 0, Differences: diffs}
+	if report.Differences == nil {
+		report.Differences = []Difference{}
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
@@ -0,0 +1,397 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// DefaultReplayIgnore are the request fields whole-request matching skips:
+// the envelope ID, which the replayed response takes from the live request,
+// and the metadata that changes on every run.
+var DefaultReplayIgnore = []string{"/id", "/meta"}
+
+// CodeReplayMismatch is the JSON-RPC error code a stdio replay answers
+// unmatched requests with; over HTTP they get status 409.
+const CodeReplayMismatch = -32009
+
+// maxReplayBody bounds the HTTP request bodies a Replayer reads.
+const maxReplayBody = 64 << 20
+
+// ReplayOptions tunes how a Replayer matches requests.
+type ReplayOptions struct {
+	// Match lists JSON pointers into the request envelope, such as
+	// "/method" and "/params/inputs"; a request matches a recorded one when
+	// the values at these pointers agree. Empty compares whole requests.
+	Match []string
+	// Ignore lists request pointers whole-request matching skips. Nil means
+	// DefaultReplayIgnore.
+	Ignore []string
+}
+
+// exchange is a recorded request and the response that answered it.
+type exchange struct {
+	request  any
+	method   string
+	response map[string]json.RawMessage
+	// trace links the exchange to the recorded server's traces and logs.
+	trace *client.TraceLink
+}
+
+// Replayer answers requests with the responses of a recorded transcript,
+// standing in for the server it was recorded against.
+//
+// Each request is matched against the recorded ones in order. The first
+// matching exchange not yet replayed answers it; once all matching ones are
+// used, the last of them answers again, so repeated calls such as pings
+// keep working. The response keeps its recorded result or error and takes
+// the live request's ID. It echoes the IDs that link a traced session to
+// the server's traces and logs, so a replayed session stays correlatable:
+// the server request ID the exchange was recorded with, as
+// meta.request_id, and the live request's meta.traceparent and
+// meta.tracestate. An untraced request replaying an untraced exchange
+// gets the response as recorded.
+type Replayer struct {
+	exchanges []exchange
+	match     [][]string
+	ignore    []string
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewReplayer pairs the requests of t with their responses. Requests that
+// were never answered, such as notifications, are left out.
+func NewReplayer(t Transcript, opts ReplayOptions) (*Replayer, error) {
+	r := &Replayer{ignore: opts.Ignore}
+	if r.ignore == nil {
+		r.ignore = DefaultReplayIgnore
+	}
+	for _, p := range opts.Match {
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("replay match %q: not a JSON pointer", p)
+		}
+		r.match = append(r.match, splitPointer(p))
+	}
+	pending := make(map[string]int)
+	for i, entry := range t.Messages {
+		var env map[string]json.RawMessage
+		if err := json.Unmarshal(entry.Message, &env); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		id := string(env["id"])
+		switch entry.Direction {
+		case client.DirectionRequest:
+			if id == "" || id == "null" {
+				continue
+			}
+			var method string
+			_ = json.Unmarshal(env["method"], &method)
+			pending[id] = len(r.exchanges)
+			r.exchanges = append(r.exchanges, exchange{request: decodeValue(entry.Message), method: method, trace: entry.Trace})
+		case client.DirectionResponse:
+			if n, ok := pending[id]; ok {
+				r.exchanges[n].response = env
+				if entry.Trace != nil {
+					r.exchanges[n].trace = entry.Trace
+				}
+				delete(pending, id)
+			}
+		}
+	}
+	answered := r.exchanges[:0]
+	for _, ex := range r.exchanges {
+		if ex.response != nil {
+			answered = append(answered, ex)
+		}
+	}
+	r.exchanges = answered
+	if len(r.exchanges) == 0 {
+		return nil, errors.New("transcript has no answered requests to replay")
+	}
+	r.used = make([]bool, len(r.exchanges))
+	return r, nil
+}
+
+// Mismatch reports a request no recorded exchange matches, with the
+// differences from the closest one.
+type Mismatch struct {
+	// Closest indexes the closest recorded exchange, counting answered
+	// requests from 0, and Method is its method.
+	Closest     int          `json:"closest"`
+	Method      string       `json:"method"`
+	Differences []Difference `json:"differences"`
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("no recorded exchange matches the request; closest is #%d (%s):\n%s", m.Closest, m.Method, RenderText(m.Differences))
+}
+
+// Reply returns the recorded response to request, or a *Mismatch when no
+// exchange matches it.
+func (r *Replayer) Reply(request []byte) ([]byte, error) {
+	resp, _, err := r.reply(request)
+	return resp, err
+}
+
+// reply is Reply, also returning the server request ID the response
+// carries.
+func (r *Replayer) reply(request []byte) ([]byte, string, error) {
+	live := decodeValue(request)
+	env, ok := live.(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("request is not a JSON object: %w", client.ErrProtocol)
+	}
+	method, _ := env["method"].(string)
+
+	var best *Mismatch
+	r.mu.Lock()
+	last := -1
+	chosen := -1
+	for i, ex := range r.exchanges {
+		diffs := r.compare(ex.request, live)
+		if len(diffs) == 0 {
+			last = i
+			if !r.used[i] {
+				chosen = i
+				break
+			}
+			continue
+		}
+		if best == nil || closer(ex.method == method, len(diffs), best.Method == method, len(best.Differences)) {
+			best = &Mismatch{Closest: i, Method: ex.method, Differences: diffs}
+		}
+	}
+	if chosen < 0 {
+		chosen = last
+	}
+	if chosen >= 0 {
+		r.used[chosen] = true
+	}
+	r.mu.Unlock()
+	if chosen < 0 {
+		return nil, "", best
+	}
+
+	ex := r.exchanges[chosen]
+	resp := make(map[string]json.RawMessage, len(ex.response))
+	for k, v := range ex.response {
+		resp[k] = v
+	}
+	id, err := json.Marshal(env["id"])
+	if err != nil {
+		return nil, "", err
+	}
+	resp["id"] = id
+	serverID, err := echoTrace(resp, env, ex.trace)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := json.Marshal(resp)
+	return out, serverID, err
+}
+
+// echoTrace adds to resp, answering the live request env, the IDs that
+// link it to the traces and logs of the recorded session, and returns the
+// server request ID resp carries.
+func echoTrace(resp map[string]json.RawMessage, env map[string]any, trace *client.TraceLink) (string, error) {
+	meta := make(map[string]any)
+	if raw, ok := resp["meta"]; ok {
+		if m, ok := decodeValue(raw).(map[string]any); ok {
+			meta = m
+		}
+	}
+	changed := false
+	if _, ok := meta["request_id"]; !ok && trace != nil && trace.ServerRequestID != "" {
+		meta["request_id"], changed = trace.ServerRequestID, true
+	}
+	if liveMeta, ok := env["meta"].(map[string]any); ok {
+		for _, key := range []string{"traceparent", "tracestate"} {
+			if v, ok := liveMeta[key].(string); ok && v != "" {
+				meta[key], changed = v, true
+			}
+		}
+	}
+	serverID, _ := meta["request_id"].(string)
+	if !changed {
+		return serverID, nil
+	}
+	raw, err := marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	resp["meta"] = raw
+	return serverID, nil
+}
+
+// closer reports whether a candidate beats the best so far: a candidate for
+// the same method wins, then the one with fewer differences.
+func closer(sameMethod bool, n int, bestSameMethod bool, bestN int) bool {
+	if sameMethod != bestSameMethod {
+		return sameMethod
+	}
+	return n < bestN
+}
+
+func (r *Replayer) compare(recorded, live any) []Difference {
+	if len(r.match) == 0 {
+		return diffValues(recorded, live, r.ignore)
+	}
+	var diffs []Difference
+	for _, path := range r.match {
+		e, inRecorded := lookup(recorded, path)
+		a, inLive := lookup(live, path)
+		switch {
+		case !inRecorded && !inLive:
+		case !inLive:
+			diffs = append(diffs, Difference{Pointer: pointer(path), Kind: DiffMissing, Expected: compact(e)})
+		case !inRecorded:
+			diffs = append(diffs, Difference{Pointer: pointer(path), Kind: DiffUnexpected, Actual: compact(a)})
+		default:
+			for _, d := range diffValues(e, a, nil) {
+				d.Pointer = pointer(path) + d.Pointer
+				diffs = append(diffs, d)
+			}
+		}
+	}
+	return diffs
+}
+
+// lookup resolves path in v.
+func lookup(v any, path []string) (any, bool) {
+	for _, seg := range path {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// ServeHTTP answers a POSTed JSON-RPC request. An unmatched request gets
+// status 409 and a JSON body holding the Mismatch and its text diff. A
+// replayed response echoes the traceparent and tracestate headers of the
+// request, and sends the server request ID it carries as X-Request-Id, or
+// echoes the request's own when it carries none.
+func (r *Replayer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "replay accepts POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = http.MaxBytesReader(w, req.Body, maxReplayBody)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, serverID, err := r.reply(payload)
+	w.Header().Set("Content-Type", "application/json")
+	var mismatch *Mismatch
+	switch {
+	case errors.As(err, &mismatch):
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			*Mismatch
+			Diff string `json:"diff"`
+		}{"no recorded exchange matches the request", mismatch, RenderText(mismatch.Differences)})
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		for _, key := range []string{client.TraceparentHeader, client.TracestateHeader} {
+			if v := req.Header.Get(key); v != "" {
+				w.Header().Set(key, v)
+			}
+		}
+		if serverID == "" {
+			serverID = req.Header.Get(client.RequestIDHeader)
+		}
+		if serverID != "" {
+			w.Header().Set(client.RequestIDHeader, serverID)
+		}
+		_, _ = w.Write(resp)
+	}
+}
+
+// ServeStdio replays newline-delimited requests read from in, writing one
+// response line to out for each, until in ends. An unmatched request is
+// answered with a CodeReplayMismatch error whose data is the Mismatch.
+func (r *Replayer) ServeStdio(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayBody)
+	w := bufio.NewWriter(out)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		resp, err := r.Reply(line)
+		if err != nil {
+			resp, err = replayError(line, err)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(append(resp, '\n')); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// replayError builds the JSON-RPC error answering an unreplayable request.
+func replayError(request []byte, cause error) ([]byte, error) {
+	var env struct {
+		ID json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(request, &env)
+	if env.ID == nil {
+		env.ID = json.RawMessage("null")
+	}
+	rpcErr := client.RPCError{Code: client.CodeInvalidRequest, Message: cause.Error()}
+	var mismatch *Mismatch
+	if errors.As(cause, &mismatch) {
+		rpcErr = client.RPCError{Code: CodeReplayMismatch, Message: "no recorded exchange matches the request"}
+		rpcErr.Data, _ = json.Marshal(mismatch)
+	}
+	return json.Marshal(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      json.RawMessage  `json:"id"`
+		Error   *client.RPCError `json:"error"`
+	}{client.JSONRPCVersion, env.ID, &rpcErr})
+}
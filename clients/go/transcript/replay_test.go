@@ -0,0 +1,160 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func loadReplayer(t *testing.T, opts ReplayOptions) *Replayer {
+	t.Helper()
+	tr, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReplayer(tr, opts)
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+	return r
+}
+
+func TestReplayHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(loadReplayer(t, ReplayOptions{Match: []string{"/method"}}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "http.json")
+	rec := client.NewFileRecorder(path, client.TransportHTTP)
+	c, err := client.NewClient(srv.URL, client.WithTranscriptRecorder(rec))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ctx := context.Background()
+	init, err := c.Initialize(ctx)
+	if err != nil || init.Session.ID != "go-http-session" {
+		t.Fatalf("Initialize = %+v, %v", init, err)
+	}
+	id, err := c.SubmitJob(ctx, client.JobSpec{Inputs: []string{"anything"}})
+	if err != nil || id != "job-1" {
+		t.Fatalf("SubmitJob = %q, %v", id, err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// What the client records of a replayed session is itself a valid
+	// transcript.
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(path); errs != nil {
+		t.Fatalf("recorded transcript invalid: %v", errs)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	srv := httptest.NewServer(loadReplayer(t, ReplayOptions{}))
+	defer srv.Close()
+	body := `{"jsonrpc":"2.0","id":7,"method":"mcp.jobs.submit","params":{"model":"text-embedding-3-small","inputs":["alpha","gamma"],"api_key":"key-7d31"}}`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("status %d, want 409", resp.StatusCode)
+	}
+	var report struct {
+		Mismatch
+		Diff string `json:"diff"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Closest != 1 || report.Method != "mcp.jobs.submit" || len(report.Differences) != 1 ||
+		report.Differences[0].Pointer != "/params/inputs/1" || !strings.Contains(report.Diff, `+"gamma"`) {
+		t.Fatalf("unexpected mismatch report: %+v", report)
+	}
+}
+
+func TestReplayStdio(t *testing.T) {
+	r := loadReplayer(t, ReplayOptions{Match: []string{"/method"}})
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":41,"method":"mcp.initialize"}`,
+		`{"jsonrpc":"2.0","id":42,"method":"mcp.initialize"}`,
+		`{"jsonrpc":"2.0","id":43,"method":"mcp.embed"}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := r.ServeStdio(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("ServeStdio: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 responses, got %q", out.String())
+	}
+	var resps [4]client.Response
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &resps[i]); err != nil {
+			t.Fatalf("response %d: %v", i, err)
+		}
+	}
+	// A repeated request is answered again, under its own ID.
+	if resps[0].ID != 41 || resps[1].ID != 42 || !bytes.Equal(resps[0].Result, resps[1].Result) || resps[0].Result == nil {
+		t.Fatalf("initialize not replayed: %s", out.String())
+	}
+	if resps[2].ID != 43 || resps[2].Error == nil || resps[2].Error.Code != CodeReplayMismatch || !strings.Contains(string(resps[2].Error.Data), "/method") {
+		t.Fatalf("unmatched request not reported: %s", lines[2])
+	}
+	if resps[3].Error == nil || resps[3].Error.Code != client.CodeInvalidRequest {
+		t.Fatalf("invalid line not reported: %s", lines[3])
+	}
+}
+
+func TestReplayEchoesTrace(t *testing.T) {
+	tr := session(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping"}`, `{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"mcp.embed"}`, `{"jsonrpc":"2.0","id":2,"result":{"embeddings":[]}}`)
+	tr.Messages[3].Trace = &client.TraceLink{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331", RequestID: "01J0", ServerRequestID: "srv-3"}
+	r, err := NewReplayer(tr, ReplayOptions{Match: []string{"/method"}})
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+
+	// An untraced request for an untraced exchange gets it as recorded.
+	resp, err := r.Reply([]byte(`{"jsonrpc":"2.0","id":9,"method":"mcp.ping"}`))
+	if err != nil || string(resp) != `{"id":9,"jsonrpc":"2.0","result":{"ok":true}}` {
+		t.Fatalf("Reply = %s, %v", resp, err)
+	}
+	// A traced exchange answers with the recorded server's ID, and a traced
+	// request gets its trace context back.
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	resp, err = r.Reply([]byte(`{"jsonrpc":"2.0","id":10,"method":"mcp.embed","meta":{"traceparent":"` + traceparent + `","request_id":"live"}}`))
+	var got struct {
+		Meta client.Meta `json:"meta"`
+	}
+	if err != nil || json.Unmarshal(resp, &got) != nil || got.Meta.RequestID != "srv-3" || got.Meta.Traceparent != traceparent {
+		t.Fatalf("Reply = %s, %v", resp, err)
+	}
+
+	// Over HTTP the trace context and the request ID travel as headers.
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	for _, tc := range []struct{ method, want string }{{"mcp.embed", "srv-3"}, {"mcp.ping", "live"}} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":11,"method":"`+tc.method+`"}`))
+		req.Header.Set(client.TraceparentHeader, traceparent)
+		req.Header.Set(client.RequestIDHeader, "live")
+		httpResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp.Body.Close()
+		if httpResp.Header.Get(client.TraceparentHeader) != traceparent || httpResp.Header.Get(client.RequestIDHeader) != tc.want {
+			t.Fatalf("%s: headers %v", tc.method, httpResp.Header)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package transcript
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// ScrubReport tells what Scrub replaced.
+type ScrubReport struct {
+	// Rules counts the values each rule replaced, in the order the rules
+	// apply, rules that matched nothing included.
+	Rules []RuleCount `json:"rules"`
+	// Changed is the number of messages with a value replaced, of
+	// Messages.
+	Changed  int `json:"changed"`
+	Messages int `json:"messages"`
+}
+
+// RuleCount is the number of values a rule of a ScrubReport replaced. Rule
+// is a redaction pattern as configured or client.AnonymizeRule.
+type RuleCount struct {
+	Rule   string `json:"rule"`
+	Values int    `json:"values"`
+}
+
+// Scrub applies the redactions and anonymization of cfg to the messages of
+// t, recorded before cfg was, as a recorder configured with cfg would have
+// when recording them. Values redacted or anonymized already are left as
+// they are, so scrubbing twice changes nothing further.
+func Scrub(t Transcript, cfg client.RecorderConfig) (Transcript, ScrubReport) {
+	r := client.NewRedactor(cfg)
+	counts := make(map[string]int)
+	report := ScrubReport{Messages: len(t.Messages)}
+	messages := make([]client.Entry, len(t.Messages))
+	for i, e := range t.Messages {
+		scrubbed := r.RedactCounted(i, e.Message, counts)
+		if !bytes.Equal(client.CanonicalJSON(scrubbed), client.CanonicalJSON(e.Message)) {
+			report.Changed++
+		}
+		e.Message = scrubbed
+		messages[i] = e
+	}
+	t.Messages = messages
+	for _, rule := range r.Rules() {
+		report.Rules = append(report.Rules, RuleCount{Rule: rule, Values: counts[rule]})
+	}
+	return t, report
+}
+
+// ScrubFile scrubs the transcript at in, as Scrub does, and writes it to
+// out in the format in is in. Its messages are written as
+// client.CanonicalJSON, as recorders write them, so only the replaced
+// values differ from a transcript recorded at the current version. out may
+// be in: the file is replaced whole once the scrubbed transcript is
+// written, keeping the permissions of in.
+func ScrubFile(in, out string, cfg client.RecorderConfig) (ScrubReport, error) {
+	info, err := os.Stat(in)
+	if err != nil {
+		return ScrubReport{}, err
+	}
+	content, err := os.ReadFile(in)
+	if err != nil {
+		return ScrubReport{}, err
+	}
+	t, err := parse(content, in)
+	if err != nil {
+		return ScrubReport{}, fmt.Errorf("%s: %w", in, err)
+	}
+	format := client.FormatJSON
+	if isJSONL(in, content) {
+		format = client.FormatJSONL
+	}
+	t, report := Scrub(t, cfg)
+	var buf bytes.Buffer
+	if err := Encode(&buf, t, format); err != nil {
+		return ScrubReport{}, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
+	if err != nil {
+		return ScrubReport{}, fmt.Errorf("write transcript: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Chmod(info.Mode().Perm())
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), out)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return ScrubReport{}, fmt.Errorf("write transcript: %w", err)
+	}
+	return report, nil
+}
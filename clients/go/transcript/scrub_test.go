@@ -0,0 +1,93 @@
+package transcript
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+func TestScrubFile(t *testing.T) {
+	dir := t.TempDir()
+	redacted, err := Load(filepath.Join("testdata", "redacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scrubbing the raw session after the fact gives what recording it
+	// with the default redactions did.
+	out := filepath.Join(dir, "clean.json")
+	report, err := ScrubFile(filepath.Join("testdata", "unredacted.json"), out, client.RecorderConfig{})
+	if err != nil {
+		t.Fatalf("ScrubFile: %v", err)
+	}
+	scrubbed, err := Load(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(redacted, scrubbed, DiffOptions{}); diffs != nil {
+		t.Fatalf("scrubbed transcript differs from the fixture:\n%s", RenderText(diffs))
+	}
+	counts := map[string]int{}
+	total := 0
+	for _, r := range report.Rules {
+		counts[r.Rule] = r.Values
+		total += r.Values
+	}
+	if len(report.Rules) != len(client.DefaultRedactions) || counts["authorization"] != 1 || counts["*_token"] != 1 || counts["api_key"] != 1 || total != len(redactedPaths)-1+counts["idempotency_key"] {
+		t.Fatalf("report %+v", report)
+	}
+	if report.Messages == 0 || report.Changed == 0 || report.Changed > report.Messages {
+		t.Fatalf("report %+v", report)
+	}
+
+	// A JSONL transcript stays JSONL, and of one written canonically only
+	// the replaced values change.
+	jsonl := filepath.Join(dir, "clean.jsonl")
+	if err := Save(jsonl, scrubbed); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(jsonl)
+	if report, err = ScrubFile(jsonl, jsonl, client.RecorderConfig{}); err != nil || report.Changed != 0 {
+		t.Fatalf("ScrubFile: %+v, %v", report, err)
+	}
+	if after, _ := os.ReadFile(jsonl); !bytes.Equal(before, after) {
+		t.Fatalf("scrubbing a scrubbed transcript changed it:\n%s", after)
+	}
+	report, err = ScrubFile(jsonl, jsonl, client.RecorderConfig{Redactions: []string{"/messages/*/message/params/inputs"}})
+	if err != nil {
+		t.Fatalf("ScrubFile: %v", err)
+	}
+	after, _ := os.ReadFile(jsonl)
+	if report.Changed != 1 || report.Rules[len(report.Rules)-1].Values != 1 || bytes.Count(after, []byte("\n")) != bytes.Count(before, []byte("\n")) {
+		t.Fatalf("report %+v for:\n%s", report, after)
+	}
+	if lines := diffLines(before, after); lines != 1 {
+		t.Fatalf("%d lines changed:\n%s", lines, after)
+	}
+
+	// Anonymizing counts each value hashed under its own rule.
+	anonymized, report := Scrub(scrubbed, client.RecorderConfig{Anonymize: true, AnonymizeSalt: "s"})
+	last := report.Rules[len(report.Rules)-1]
+	if last.Rule != client.AnonymizeRule || last.Values == 0 || report.Changed == 0 {
+		t.Fatalf("report %+v", report)
+	}
+	if _, again := Scrub(anonymized, client.RecorderConfig{Anonymize: true, AnonymizeSalt: "s"}); again.Changed != 0 {
+		t.Fatalf("anonymizing twice changed %+v", again)
+	}
+}
+
+// diffLines counts the lines that differ between a and b, which have as
+// many.
+func diffLines(a, b []byte) int {
+	al, bl := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	n := 0
+	for i := range al {
+		if !bytes.Equal(al[i], bl[i]) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package transcript
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// MethodStats summarizes the timed round trips of one method.
+type MethodStats struct {
+	Method string `json:"method"`
+	// Calls counts the timed round trips, and Failures those that ended in
+	// a client.DirectionError entry rather than a response.
+	Calls    int `json:"calls"`
+	Failures int `json:"failures"`
+	// P50MS, P95MS, and MaxMS are latencies in milliseconds, the
+	// percentiles by nearest rank.
+	P50MS float64 `json:"p50_ms"`
+	P95MS float64 `json:"p95_ms"`
+	MaxMS float64 `json:"max_ms"`
+}
+
+// Stats summarizes the latencies t records, one MethodStats per method in
+// the order first answered. A response is attributed to the method of the
+// latest request with its id; entries without a duration, such as those of
+// transcripts recorded before timings were, are skipped.
+func Stats(t Transcript) []MethodStats {
+	c := newStatsCounter()
+	for _, e := range t.Messages {
+		c.add(e)
+	}
+	return c.stats()
+}
+
+// StatsFile summarizes the transcript at path as Stats does, the section
+// of a suite when section is not empty. A JSONL transcript is read an
+// entry at a time through OpenJSONL rather than loaded, so its size is not
+// bounded by memory: beyond the longest line, StatsFile holds 8 bytes per
+// timed call and the method of each request id.
+func StatsFile(path, section string) ([]MethodStats, error) {
+	if section == "" {
+		r, err := OpenJSONL(path)
+		switch {
+		case err == nil:
+			defer r.Close()
+			c := newStatsCounter()
+			for {
+				e, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					return c.stats(), nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				c.add(e)
+			}
+		case !errors.Is(err, ErrNotJSONL):
+			return nil, err
+		}
+	}
+	t, err := LoadSection(path, section)
+	if err != nil {
+		return nil, err
+	}
+	return Stats(t), nil
+}
+
+// statsCounter accumulates the latencies of entries for Stats.
+type statsCounter struct {
+	// methods maps the id of each request to its method.
+	methods   map[string]string
+	order     []string
+	durations map[string][]float64
+	failures  map[string]int
+}
+
+func newStatsCounter() *statsCounter {
+	return &statsCounter{
+		methods:   make(map[string]string),
+		durations: make(map[string][]float64),
+		failures:  make(map[string]int),
+	}
+}
+
+func (c *statsCounter) add(e client.Entry) {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if json.Unmarshal(e.Message, &msg) != nil {
+		return
+	}
+	method := msg.Method
+	switch e.Direction {
+	case client.DirectionRequest:
+		if len(msg.ID) > 0 {
+			c.methods[string(msg.ID)] = msg.Method
+		}
+		return
+	case client.DirectionResponse:
+		method = c.methods[string(msg.ID)]
+	case client.DirectionNotification:
+		return
+	}
+	if e.ReceivedAt == "" {
+		return
+	}
+	if _, seen := c.durations[method]; !seen {
+		c.order = append(c.order, method)
+	}
+	c.durations[method] = append(c.durations[method], e.DurationMS)
+	if e.Direction == client.DirectionError {
+		c.failures[method]++
+	}
+}
+
+func (c *statsCounter) stats() []MethodStats {
+	stats := make([]MethodStats, 0, len(c.order))
+	for _, method := range c.order {
+		d := c.durations[method]
+		sort.Float64s(d)
+		stats = append(stats, MethodStats{
+			Method:   method,
+			Calls:    len(d),
+			Failures: c.failures[method],
+			P50MS:    percentile(d, 0.50),
+			P95MS:    percentile(d, 0.95),
+			MaxMS:    d[len(d)-1],
+		})
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,37 @@
+package transcript
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	timed, err := Load(filepath.Join("testdata", "timed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MethodStats{
+		{Method: "mcp.initialize", Calls: 1, P50MS: 12, P95MS: 12, MaxMS: 12},
+		{Method: "mcp.embed", Calls: 3, Failures: 1, P50MS: 9.5, P95MS: 5000, MaxMS: 5000},
+	}
+	if got := Stats(timed); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Stats =\n%+v\nwant\n%+v", got, want)
+	}
+	untimed, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Stats(untimed); len(got) != 0 {
+		t.Fatalf("Stats of an untimed transcript = %+v", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	for _, c := range []struct{ p, want float64 }{{0.50, 10}, {0.95, 19}, {1, 20}, {0, 1}} {
+		if got := percentile(sorted, c.p); got != c.want {
+			t.Errorf("percentile(%v) = %v, want %v", c.p, got, c.want)
+		}
+	}
+}
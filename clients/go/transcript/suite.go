@@ -0,0 +1,219 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SuiteVersion is the suite_version of the suite documents SaveSuite writes.
+const SuiteVersion = 1
+
+// Suite is several transcripts merged into one artifact, such as the
+// session transcripts of every transport a CI run covers, one Section per
+// source, with a Manifest describing where each came from.
+type Suite struct {
+	Version  int       `json:"suite_version"`
+	Manifest Manifest  `json:"manifest"`
+	Sections []Section `json:"sections"`
+}
+
+// Manifest describes a Suite and its sources.
+type Manifest struct {
+	// Commit is the commit SHA the transcripts were recorded at, when known.
+	Commit string `json:"commit,omitempty"`
+	// MergedAt is when the suite was assembled, in RFC 3339.
+	MergedAt string   `json:"merged_at"`
+	Sources  []Source `json:"sources"`
+}
+
+// Source describes the transcript a Section holds.
+type Source struct {
+	Section   string `json:"section"`
+	Path      string `json:"path"`
+	Client    string `json:"client"`
+	Transport string `json:"transport"`
+	Kind      string `json:"kind,omitempty"`
+	Messages  int    `json:"messages"`
+	// StartedAt and EndedAt bound the timed messages of the transcript;
+	// transcripts recorded without timings leave them empty.
+	StartedAt string `json:"started_at,omitempty"`
+	EndedAt   string `json:"ended_at,omitempty"`
+}
+
+// Section is one transcript of a Suite, named by SectionName.
+type Section struct {
+	Name       string     `json:"name"`
+	Transcript Transcript `json:"transcript"`
+}
+
+// SectionName names the section of t: "<client>/<transport>", followed by
+// "/<kind>" for transcripts of a fixture kind, as in "go/http/models".
+func SectionName(t Transcript) string {
+	name := t.Client + "/" + t.Transport
+	if t.Kind != "" {
+		name += "/" + t.Kind
+	}
+	return name
+}
+
+// NewSuite returns an empty Suite recorded at commit and merged at the
+// given time.
+func NewSuite(commit string, mergedAt time.Time) *Suite {
+	return &Suite{
+		Version:  SuiteVersion,
+		Manifest: Manifest{Commit: commit, MergedAt: mergedAt.UTC().Format(time.RFC3339), Sources: []Source{}},
+		Sections: []Section{},
+	}
+}
+
+// Add appends t, read from path, as the next section, its messages in the
+// order recorded. Two sources with the same SectionName are an error.
+func (s *Suite) Add(path string, t Transcript) error {
+	name := SectionName(t)
+	for _, src := range s.Manifest.Sources {
+		if src.Section == name {
+			return fmt.Errorf("%s: section %s is already merged from %s", path, name, src.Path)
+		}
+	}
+	src := Source{Section: name, Path: filepath.ToSlash(path), Client: t.Client, Transport: t.Transport, Kind: t.Kind, Messages: len(t.Messages)}
+	for _, e := range t.Messages {
+		if src.StartedAt == "" {
+			src.StartedAt = e.SentAt
+		}
+		if e.ReceivedAt != "" {
+			src.EndedAt = e.ReceivedAt
+		} else if e.SentAt != "" {
+			src.EndedAt = e.SentAt
+		}
+	}
+	s.Manifest.Sources = append(s.Manifest.Sources, src)
+	s.Sections = append(s.Sections, Section{Name: name, Transcript: t})
+	return nil
+}
+
+// Section returns the transcript of the section named name.
+func (s *Suite) Section(name string) (Transcript, bool) {
+	for _, sec := range s.Sections {
+		if sec.Name == name {
+			return sec.Transcript, true
+		}
+	}
+	return Transcript{}, false
+}
+
+// SectionNames lists the sections in order.
+func (s *Suite) SectionNames() []string {
+	names := make([]string, len(s.Sections))
+	for i, sec := range s.Sections {
+		names[i] = sec.Name
+	}
+	return names
+}
+
+// IsSuite reports whether data is a suite document rather than a
+// transcript.
+func IsSuite(data []byte) bool {
+	var doc struct {
+		Version *int `json:"suite_version"`
+	}
+	return json.Unmarshal(data, &doc) == nil && doc.Version != nil
+}
+
+// ParseSuite decodes a suite document, migrating each section's transcript
+// as Parse does.
+func ParseSuite(data []byte) (*Suite, error) {
+	var doc struct {
+		Version  int          `json:"suite_version"`
+		Manifest Manifest     `json:"manifest"`
+		Sections []rawSection `json:"sections"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode suite: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > SuiteVersion {
+		return nil, fmt.Errorf("suite_version %d is not supported (want 1 to %d)", doc.Version, SuiteVersion)
+	}
+	s := &Suite{Version: doc.Version, Manifest: doc.Manifest, Sections: make([]Section, 0, len(doc.Sections))}
+	for _, sec := range doc.Sections {
+		t, err := Parse(sec.Transcript)
+		if err != nil {
+			return nil, fmt.Errorf("section %s: %w", sec.Name, err)
+		}
+		s.Sections = append(s.Sections, Section{Name: sec.Name, Transcript: t})
+	}
+	return s, nil
+}
+
+type rawSection struct {
+	Name       string          `json:"name"`
+	Transcript json.RawMessage `json:"transcript"`
+}
+
+// LoadSuite reads the suite document at path.
+func LoadSuite(path string) (*Suite, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseSuite(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// SaveSuite writes s to path as an indented document, its sections at
+// CurrentVersion with their messages in canonical form, as Encode writes
+// them, creating parent directories as needed.
+func SaveSuite(path string, s *Suite) error {
+	doc := *s
+	doc.Sections = make([]Section, len(s.Sections))
+	for i, sec := range s.Sections {
+		sec.Transcript.Version = CurrentVersion
+		sec.Transcript.Messages = canonicalMessages(sec.Transcript.Messages)
+		doc.Sections[i] = sec
+	}
+	raw, err := marshal(doc)
+	if err != nil {
+		return fmt.Errorf("encode suite: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return fmt.Errorf("encode suite: %w", err)
+	}
+	buf.WriteByte('\n')
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create suite directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write suite: %w", err)
+	}
+	return nil
+}
+
+// LoadSection reads the transcript at path, or, when path holds a suite,
+// the transcript of its section named section. A plain transcript is
+// returned whatever section names.
+func LoadSection(path, section string) (Transcript, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Transcript{}, err
+	}
+	if !IsSuite(content) {
+		return Load(path)
+	}
+	s, err := ParseSuite(content)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("%s: %w", path, err)
+	}
+	t, ok := s.Section(section)
+	if !ok {
+		return Transcript{}, fmt.Errorf("%s: no section %q (sections: %s)", path, section, strings.Join(s.SectionNames(), ", "))
+	}
+	return t, nil
+}
@@ -0,0 +1,60 @@
+package transcript
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuiteRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	http := session(`{"jsonrpc":"2.0","id":1,"method":"mcp.ping","meta":{"timestamp":"2026-10-14T08:00:00Z","sequence":1}}`, `{"jsonrpc":"2.0","id":1,"result":{}}`)
+	http.Version = CurrentVersion
+	models := http
+	models.Kind = "models"
+	suite := NewSuite("abc123", time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC))
+	if err := suite.Add("http.json", http); err != nil {
+		t.Fatal(err)
+	}
+	if err := suite.Add("models.json", models); err != nil {
+		t.Fatal(err)
+	}
+	if err := suite.Add("again.json", http); err == nil || !strings.Contains(err.Error(), "already merged from http.json") {
+		t.Fatalf("duplicate section: %v", err)
+	}
+	path := filepath.Join(dir, "suite.json")
+	if err := SaveSuite(path, suite); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(loaded.SectionNames(), " "); got != "go/http go/http/models" || loaded.Manifest.MergedAt != "2026-10-14T08:00:00Z" {
+		t.Fatalf("sections %q, manifest %+v", got, loaded.Manifest)
+	}
+	section, err := LoadSection(path, "go/http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := Diff(http, section, DiffOptions{}); diffs != nil {
+		t.Fatalf("section changed by the round trip:\n%s", RenderText(diffs))
+	}
+
+	plain := filepath.Join(dir, "http.json")
+	if err := Save(plain, http); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(plain)
+	if IsSuite(content) {
+		t.Fatal("a transcript reads as a suite")
+	}
+	if _, err := LoadSection(plain, "go/anything"); err != nil {
+		t.Fatalf("plain transcript with a section: %v", err)
+	}
+	if _, err := ParseSuite([]byte(`{"suite_version":9,"sections":[]}`)); err == nil {
+		t.Fatal("future suite_version parsed")
+	}
+}
@@ -0,0 +1,125 @@
+// Package transcript records client sessions, reads the transcripts written
+// by Recorder and client.FileRecorder, and compares them with the golden
+// fixtures under tests/fixtures/go/.
+//
+// A Transcript is compared field by field and message by message; each
+// difference names the JSON pointer where the two documents part ways, so
+// a failing comparison says exactly which envelope changed and how, instead
+// of only that the files differ.
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// Transcript is a recorded session: the markers identifying how it was
+// captured and the envelopes exchanged, in order.
+type Transcript struct {
+	// Version is the transcript_version of the document; Load and Parse
+	// return every transcript migrated to CurrentVersion.
+	Version int    `json:"transcript_version"`
+	Client  string `json:"client"`
+	// ClientBuild identifies the build of the client that recorded the
+	// session, as client.BuildInfo.UserAgent does; Diff leaves it
+	// uncompared, and ClientBuildNote reports it apart.
+	ClientBuild string `json:"client_build,omitempty"`
+	Transport   string `json:"transport"`
+	Kind        string `json:"kind,omitempty"`
+	MTLS        bool   `json:"mtls,omitempty"`
+	// WireProtocol is client.JSONRPC2 for a session in plain JSON-RPC 2.0,
+	// and empty otherwise.
+	WireProtocol    string `json:"wire_protocol,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	// Codec is the codec the session's envelopes traveled in, when not
+	// client.CodecJSON; Messages hold their JSON all the same.
+	Codec    string         `json:"codec,omitempty"`
+	Messages []client.Entry `json:"messages"`
+	// Summary is the footer a recorder writes when it closes the
+	// transcript; nil for one cut short, or recorded before footers.
+	Summary *client.TranscriptSummary `json:"summary,omitempty"`
+}
+
+// Load reads the transcript at path, in either format, migrating documents
+// of older versions in memory; see Migrate.
+func Load(path string) (Transcript, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Transcript{}, err
+	}
+	t, err := parse(content, path)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Parse decodes a transcript document or JSONL transcript, migrating it
+// from an older version.
+func Parse(data []byte) (Transcript, error) {
+	return parse(data, "")
+}
+
+func parse(data []byte, path string) (Transcript, error) {
+	data, err := documentBytes(data, path)
+	if err != nil {
+		return Transcript{}, err
+	}
+	data, _, err = Migrate(data, path)
+	if err != nil {
+		return Transcript{}, err
+	}
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Transcript{}, fmt.Errorf("decode transcript: %w", err)
+	}
+	return t, nil
+}
+
+// documentBytes returns data, read from path, as a single document: JSONL
+// transcripts are assembled into the layout of FormatJSON.
+func documentBytes(data []byte, path string) ([]byte, error) {
+	if !isJSONL(path, data) {
+		return data, nil
+	}
+	doc, err := decodeJSONL(data)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(doc)
+}
+
+// Save writes t to path at CurrentVersion, as an indented document or, for
+// a path ending in ".jsonl", as JSONL, creating parent directories as
+// needed.
+func Save(path string, t Transcript) error {
+	var buf bytes.Buffer
+	if err := Encode(&buf, t, client.TranscriptFormat(path, "")); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create transcript directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+// marshal encodes v without escaping "<", ">", and "&", so placeholders such
+// as "<timestamp>" stay readable in fixtures and diffs.
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
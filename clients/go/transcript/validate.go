@@ -0,0 +1,272 @@
+package transcript
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the JSON Schema (draft 2020-12) of transcript documents, shared
+// with the other language clients that write fixtures.
+//
+//go:embed schema.json
+var Schema []byte
+
+// ValidationError is one way a transcript document breaks Schema.
+type ValidationError struct {
+	// Pointer is the JSON pointer of the offending value, or of the missing
+	// field.
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	segs := splitPointer(e.Pointer)
+	if len(segs) >= 2 && segs[0] == "messages" {
+		if _, err := strconv.Atoi(segs[1]); err == nil {
+			return fmt.Sprintf("%s at message %s (%s)", e.Message, segs[1], e.Pointer)
+		}
+	}
+	if e.Pointer == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Pointer)
+}
+
+// Validate checks the transcript at path against Schema, returning every
+// violation found, or nil for a valid transcript. Documents of older
+// versions are checked as Load would migrate them. A file that cannot be
+// read, parsed, or migrated yields a single error at the document root.
+func Validate(path string) []ValidationError {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return []ValidationError{{Message: err.Error()}}
+	}
+	return validateBytes(content, path)
+}
+
+// ValidateBytes checks a transcript document or JSONL transcript against
+// Schema.
+func ValidateBytes(data []byte) []ValidationError {
+	return validateBytes(data, "")
+}
+
+func validateBytes(data []byte, path string) []ValidationError {
+	data, err := documentBytes(data, path)
+	if err != nil {
+		return []ValidationError{{Message: err.Error()}}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return []ValidationError{{Message: fmt.Sprintf("not JSON: %v", err)}}
+	}
+	from, err := documentVersion(doc)
+	if err == nil && from != CurrentVersion {
+		doc, err = migrate(doc, from, path)
+	}
+	if err != nil {
+		return []ValidationError{{Message: err.Error()}}
+	}
+	v := validator{root: transcriptSchema}
+	v.check(nil, doc, transcriptSchema)
+	return v.errs
+}
+
+// schema is the subset of JSON Schema that Schema uses.
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Defs       map[string]*schema `json:"$defs"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	Enum       []any              `json:"enum"`
+	Const      json.RawMessage    `json:"const"`
+	MinLength  *int               `json:"minLength"`
+	Minimum    *float64           `json:"minimum"`
+	Format     string             `json:"format"`
+	If         *schema            `json:"if"`
+	Then       *schema            `json:"then"`
+	Else       *schema            `json:"else"`
+	AnyOf      []*schema          `json:"anyOf"`
+}
+
+var transcriptSchema = mustParseSchema(Schema)
+
+// placeholderPattern matches a whole value a normalization Rule wrote, such
+// as "<timestamp>".
+var placeholderPattern = regexp.MustCompile(`^<[a-z][a-z0-9-]*>$`)
+
+func mustParseSchema(data []byte) *schema {
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		panic(fmt.Sprintf("transcript: invalid schema.json: %v", err))
+	}
+	return &s
+}
+
+type validator struct {
+	root *schema
+	errs []ValidationError
+}
+
+func (v *validator) fail(path []string, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{Pointer: pointer(path), Message: fmt.Sprintf(format, args...)})
+}
+
+// valid reports whether value satisfies s without recording errors, for
+// the "if" and "anyOf" keywords.
+func (v *validator) valid(path []string, value any, s *schema) bool {
+	probe := validator{root: v.root}
+	probe.check(path, value, s)
+	return len(probe.errs) == 0
+}
+
+func (v *validator) check(path []string, value any, s *schema) {
+	if s.Ref != "" {
+		s = v.resolve(s.Ref)
+	}
+	if s.Type != "" && !hasType(value, s.Type) {
+		v.fail(path, "expected %s, got %s", s.Type, typeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		v.fail(path, "%s is not one of %s", compact(value), enumList(s.Enum))
+	}
+	if s.Const != nil && !scalarsEqual(decodeValue(s.Const), value) {
+		v.fail(path, "expected %s, got %s", s.Const, compact(value))
+	}
+	switch node := value.(type) {
+	case string:
+		if s.MinLength != nil && len(node) < *s.MinLength {
+			if *s.MinLength == 1 {
+				v.fail(path, "must not be empty")
+			} else {
+				v.fail(path, "shorter than %d characters", *s.MinLength)
+			}
+		}
+		// Normalized fixtures hold placeholders such as "<timestamp>" where
+		// the recorded transcript held date-times.
+		if s.Format == "date-time" && !placeholderPattern.MatchString(node) {
+			if _, err := time.Parse(time.RFC3339Nano, node); err != nil {
+				v.fail(path, "%q is not an RFC 3339 date-time", node)
+			}
+		}
+	case json.Number:
+		if f, err := node.Float64(); err == nil && s.Minimum != nil && f < *s.Minimum {
+			v.fail(path, "%s is below the minimum %v", node, *s.Minimum)
+		}
+	case map[string]any:
+		for _, field := range s.Required {
+			if _, ok := node[field]; !ok {
+				v.fail(append(path[:len(path):len(path)], field), "field %q missing", field)
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if child, ok := node[k]; ok {
+				v.check(append(path[:len(path):len(path)], k), child, s.Properties[k])
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, child := range node {
+				v.check(append(path[:len(path):len(path)], strconv.Itoa(i)), child, s.Items)
+			}
+		}
+	}
+	if s.If != nil {
+		if v.valid(path, value, s.If) {
+			if s.Then != nil {
+				v.check(path, value, s.Then)
+			}
+		} else if s.Else != nil {
+			v.check(path, value, s.Else)
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		var reasons []string
+		for _, alt := range s.AnyOf {
+			probe := validator{root: v.root}
+			probe.check(path, value, alt)
+			if len(probe.errs) == 0 {
+				return
+			}
+			reasons = append(reasons, probe.errs[0].Message)
+		}
+		v.fail(path, "matches no alternative: %s", strings.Join(reasons, "; or "))
+	}
+}
+
+// resolve looks up a "#/$defs/name" reference.
+func (v *validator) resolve(ref string) *schema {
+	name := strings.TrimPrefix(ref, "#/$defs/")
+	if s, ok := v.root.Defs[name]; ok {
+		return s
+	}
+	panic(fmt.Sprintf("transcript: schema.json has no definition for %q", ref))
+}
+
+func hasType(value any, want string) bool {
+	switch want {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	}
+	return typeName(value) == want
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		parts[i] = string(compact(e))
+	}
+	return strings.Join(parts, ", ")
+}
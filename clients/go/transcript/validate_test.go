@@ -0,0 +1,76 @@
+package transcript
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateFixtures(t *testing.T) {
+	for _, name := range []string{"unredacted.json", "redacted.json"} {
+		if errs := Validate(filepath.Join("testdata", name)); errs != nil {
+			t.Errorf("%s: %v", name, errs)
+		}
+	}
+}
+
+func TestValidateReportsPointers(t *testing.T) {
+	doc := `{
+  "transport": "http",
+  "messages": [
+    {"direction": "request", "message": {"jsonrpc": "2.0", "id": 1, "method": "mcp.ping", "meta": {"timestamp": "2024-01-17T10:05:00Z"}}},
+    {"direction": "response", "message": {"jsonrpc": "2.0", "id": 1, "result": {}}, "trace": {"trace_id": "0af7651916cd43dd8448eb211c80319c", "span_id": "b7ad6b7169203331", "server_request_id": "srv-1"}},
+    {"direction": "sideways", "message": {"jsonrpc": "2.0", "id": 2, "result": {}}},
+    {"direction": "request", "message": {"jsonrpc": "2.0", "id": 3, "method": "mcp.ping", "meta": {"sequence": -1}}},
+    {"direction": "response", "message": {"jsonrpc": "1.0", "id": 3}},
+    {"direction": "request", "message": {"jsonrpc": "2.0", "id": 4, "method": "mcp.ping", "meta": {"timestamp": "yesterday"}}},
+    {"direction": "notification", "message": {"jsonrpc": "2.0", "method": "progress", "params": {}}, "received_at": "2024-01-17T10:05:01Z"},
+    {"direction": "notification", "message": {"jsonrpc": "2.0", "params": {}}},
+    {"direction": "response", "message": {"jsonrpc": "2.0", "id": 4, "result": {}}, "trace": {"trace_id": "0af7651916cd43dd8448eb211c80319c"}}
+  ]
+}`
+	var got []string
+	for _, e := range ValidateBytes([]byte(doc)) {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`field "client" missing (/client)`,
+		`"sideways" is not one of "request", "response", "error", "skipped", "notification" at message 2 (/messages/2/direction)`,
+		`-1 is below the minimum 0 at message 3 (/messages/3/message/meta/sequence)`,
+		`field "timestamp" missing at message 3 (/messages/3/message/meta/timestamp)`,
+		`expected "2.0", got "1.0" at message 4 (/messages/4/message/jsonrpc)`,
+		`matches no alternative: field "result" missing; or field "error" missing at message 4 (/messages/4/message)`,
+		`"yesterday" is not an RFC 3339 date-time at message 5 (/messages/5/message/meta/timestamp)`,
+		`field "method" missing at message 7 (/messages/7/message/method)`,
+		`matches no alternative: expected null, got object; or field "span_id" missing at message 8 (/messages/8/trace)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A document from a newer client is not validated against this schema.
+	errs := ValidateBytes([]byte(`{"transcript_version": 99, "messages": "elsewhere"}`))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "client too old") {
+		t.Fatalf("newer document: %v", errs)
+	}
+	if errs := ValidateBytes([]byte(`{"client":`)); len(errs) != 1 || !strings.HasPrefix(errs[0].Message, "not JSON") {
+		t.Fatalf("truncated document: %v", errs)
+	}
+}
+
+func TestValidateAcceptsNormalized(t *testing.T) {
+	tr, err := Load(filepath.Join("testdata", "unredacted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, err = sharedRules(t).Normalize(tr); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "normalized.json")
+	if err := Save(path, tr); err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(path); errs != nil {
+		t.Fatalf("normalized transcript invalid: %v", errs)
+	}
+}
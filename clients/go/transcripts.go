@@ -0,0 +1,1003 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+// transcriptUsage lists the transcript subcommands.
+const transcriptUsage = `usage: embednexus transcript <command> [arguments]
+
+commands:
+  convert [--format json|jsonl] <in> <out>   rewrite a transcript in another format
+  diff [--format text|json] [--section name] [--update] <expected> <actual>
+                                             compare two transcripts or directories of them
+  crosscheck [--clients go,python] [--strict] [transport ...]
+                                             compare the request fixtures of two clients
+  stats [--output table|json|ndjson|csv] [--section name] <transcript>
+                                             print p50/p95/max latency per method
+  merge [--commit sha] <out> <in> ...        merge transcripts into one suite document
+  scrub <in> [--rules file] (--out file | --in-place) [--output text|json]
+                                             redact and anonymize a recorded transcript
+  gen-tests --in <dir> --out <file> [--package name]
+                                             generate compatibility tests from transcripts
+`
+
+// runTranscript implements "embednexus transcript <command>", the tools
+// working on recorded transcripts.
+func runTranscript(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, transcriptUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "convert":
+		return runTranscriptConvert(args[1:], stderr)
+	case "crosscheck":
+		return runTranscriptCrosscheck(args[1:], stdout, stderr)
+	case "diff":
+		return runTranscriptDiff(args[1:], stdout, stderr)
+	case "merge":
+		return runTranscriptMerge(args[1:], stderr)
+	case "scrub":
+		return runTranscriptScrub(args[1:], stdout, stderr)
+	case "gen-tests":
+		return runTranscriptGenTests(args[1:], stderr)
+	case "stats":
+		return runTranscriptStats(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, transcriptUsage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "embednexus: unknown transcript command %q\n%s", args[0], transcriptUsage)
+	return exitUsage
+}
+
+// runTranscriptConvert implements "embednexus transcript convert in out":
+// the transcript at in, in either format and at any supported version, is
+// written to out at the current version, in the format --format names or
+// the extension of out implies.
+func runTranscriptConvert(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", "output format: json or jsonl (default: from the extension of <out>)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript convert [--format json|jsonl] <in> <out>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	in, out := flags.Arg(0), flags.Arg(1)
+	if err := (client.RecorderConfig{Format: *format}).Validate(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+	t, err := transcript.Load(in)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	err = transcript.Encode(f, t, client.TranscriptFormat(out, *format))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %s: %v\n", out, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runTranscriptDiff implements "embednexus transcript diff expected actual":
+// the two transcripts, the sections of two suites matched by name, or the
+// transcripts below two directories matched by relative path, are
+// normalized and compared, and the differences go to stdout as a unified
+// diff or, with --format json, a report. --section compares one section of
+// either side that is a suite. The exit code
+// is exitMismatch on any mismatch. With --update each differing or new
+// actual transcript is normalized and written over the expected one, as
+// --update-transcripts does, and only mismatches left are failures.
+func runTranscriptDiff(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var ignore stringList
+	flags.Var(&ignore, "ignore", "JSON pointer into the transcripts left uncompared, with a \"*\" segment matching any key or index (repeatable)")
+	format := flags.String("format", "text", "output: text, a unified diff, or json, a difference report")
+	color := flags.String("color", "auto", "color the text diff: auto (when stdout is a terminal), always, or never")
+	rulesPath := flags.String("normalize-rules", "", "normalization rules applied to both sides (default "+defaultNormalizeRules+" when present)")
+	salt := flags.String("anonymize-salt", "", "anonymize both sides with this salt first, so a transcript recorded with --anonymize matches the raw one")
+	update := flags.Bool("update", false, "write each differing actual transcript, normalized, over the expected one")
+	section := flags.String("section", "", "compare only this section, such as go/http, of each side that is a suite")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript diff [flags] <expected> <actual>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "embednexus: --format %q: want text or json\n", *format)
+		return exitUsage
+	}
+	colored, ok := useColor(*color, stdout)
+	if !ok {
+		fmt.Fprintf(stderr, "embednexus: --color %q: want auto, always, or never\n", *color)
+		return exitUsage
+	}
+	if *rulesPath == "" && fileExists(defaultNormalizeRules) {
+		*rulesPath = defaultNormalizeRules
+	}
+	opts := transcript.DiffOptions{Ignore: ignore}
+	if *rulesPath != "" {
+		var err error
+		if opts.Normalizer, err = transcript.LoadNormalizer(*rulesPath); err != nil {
+			fmt.Fprintf(stderr, "embednexus: normalization rules: %v\n", err)
+			return exitUsage
+		}
+	}
+	if *salt != "" {
+		opts.Anonymizer = client.NewAnonymizer(*salt)
+	}
+	expected, actual := flags.Arg(0), flags.Arg(1)
+	pairs, several, err := diffPairs(expected, actual, *section)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitUsage
+	}
+
+	var reports []fileDiff
+	mismatches := 0
+	for _, p := range pairs {
+		r, err := p.diff(opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		if r.Equal {
+			reports = append(reports, r)
+			continue
+		}
+		if *update && p.hasActual {
+			if err := updateExpected(p, opts.Normalizer); err != nil {
+				fmt.Fprintf(stderr, "embednexus: %v\n", err)
+				return exitFailure
+			}
+			fmt.Fprintf(stderr, "embednexus: updated %s\n", p.expected)
+			r.Updated = true
+		} else {
+			mismatches++
+		}
+		reports = append(reports, r)
+	}
+
+	if *format == "json" {
+		var out []byte
+		if several {
+			out, err = json.MarshalIndent(dirDiff{Equal: mismatches == 0, Files: reports}, "", "  ")
+		} else {
+			report := reports[0].Report
+			if report.Differences == nil {
+				report.Differences = []transcript.Difference{}
+			}
+			out, err = json.MarshalIndent(report, "", "  ")
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "%s\n", out)
+	} else {
+		render := transcript.RenderText
+		if colored {
+			render = transcript.RenderColor
+		}
+		for _, r := range reports {
+			if r.Equal {
+				continue
+			}
+			if r.ClientBuilds != nil {
+				// The builds lead, the likeliest explanation of what follows.
+				note := fmt.Sprintf("recorded by different client builds: expected %s, actual %s", r.ClientBuilds[0], r.ClientBuilds[1])
+				if several {
+					note = r.Path + ": " + note
+				}
+				if colored {
+					note = "\x1b[1m" + note + "\x1b[0m"
+				}
+				fmt.Fprintln(stdout, note)
+			}
+			// So do the traces of the messages that differ, to look up on
+			// the server.
+			for _, m := range r.Traces {
+				note := m.String()
+				if several {
+					note = r.Path + ": " + note
+				}
+				if colored {
+					note = "\x1b[1m" + note + "\x1b[0m"
+				}
+				fmt.Fprintln(stdout, note)
+			}
+			switch {
+			case r.OnlyIn != "":
+				fmt.Fprintf(stdout, "only in %s: %s\n", r.OnlyIn, r.Path)
+			case several:
+				fmt.Fprintf(stdout, "diff %s\n%s", r.Path, render(r.Differences))
+			default:
+				fmt.Fprint(stdout, render(r.Differences))
+			}
+		}
+	}
+	if mismatches > 0 {
+		fmt.Fprintf(stderr, "embednexus: %d of %d transcripts differ\n", mismatches, len(reports))
+		return exitMismatch
+	}
+	return exitOK
+}
+
+// diffPair is an expected transcript and the actual one compared with it.
+// In a directory comparison either may be missing, and expected is then
+// where the actual one would go. When either path holds a suite, section
+// names the transcript of it compared.
+type diffPair struct {
+	rel, expected, actual  string
+	section                string
+	hasExpected, hasActual bool
+}
+
+// fileDiff is the comparison of one diffPair.
+type fileDiff struct {
+	Path string `json:"path"`
+	transcript.Report
+	// OnlyIn names the side, "expected" or "actual", holding the only copy.
+	OnlyIn  string `json:"only_in,omitempty"`
+	Updated bool   `json:"updated,omitempty"`
+}
+
+// dirDiff is the --format json report of comparing directories or suites.
+type dirDiff struct {
+	Equal bool       `json:"equal"`
+	Files []fileDiff `json:"files"`
+}
+
+func (p diffPair) diff(opts transcript.DiffOptions) (fileDiff, error) {
+	r := fileDiff{Path: p.rel}
+	switch {
+	case !p.hasActual:
+		r.OnlyIn = "expected"
+		return r, nil
+	case !p.hasExpected:
+		r.OnlyIn = "actual"
+		return r, nil
+	}
+	if p.section == "" {
+		// Whole transcripts are compared a message at a time, so neither
+		// need fit in memory.
+		report, err := transcript.DiffFiles(p.expected, p.actual, opts)
+		if err != nil {
+			return r, err
+		}
+		r.Report = report
+		return r, nil
+	}
+	expected, err := transcript.LoadSection(p.expected, p.section)
+	if err != nil {
+		return r, err
+	}
+	actual, err := transcript.LoadSection(p.actual, p.section)
+	if err != nil {
+		return r, err
+	}
+	r.Differences = transcript.Diff(expected, actual, opts)
+	r.Equal = len(r.Differences) == 0
+	if !r.Equal && transcript.ClientBuildNote(expected, actual, "expected", "actual") != "" {
+		r.ClientBuilds = []string{expected.ClientBuild, actual.ClientBuild}
+	}
+	r.Traces = transcript.Traces(expected, actual, r.Differences)
+	return r, nil
+}
+
+// updateExpected writes the actual transcript of p, normalized by rules,
+// over the expected one, in the format its path implies.
+func updateExpected(p diffPair, rules *transcript.Normalizer) error {
+	if content, err := os.ReadFile(p.expected); err == nil && transcript.IsSuite(content) {
+		return fmt.Errorf("cannot update suite %s: merge the updated transcripts again", p.expected)
+	}
+	t, err := transcript.LoadSection(p.actual, p.section)
+	if err != nil {
+		return err
+	}
+	if t, err = rules.Normalize(t); err != nil {
+		return fmt.Errorf("%s: %w", p.actual, err)
+	}
+	return transcript.Save(p.expected, t)
+}
+
+// diffPairs pairs the transcripts to compare: expected and actual
+// themselves when both are files, their sections by name when both are
+// suites and no section is picked, or, when both are directories, the
+// transcripts below them by relative path. It reports true for the last
+// two.
+func diffPairs(expected, actual, section string) ([]diffPair, bool, error) {
+	ei, err := os.Stat(expected)
+	if err != nil {
+		return nil, false, err
+	}
+	ai, err := os.Stat(actual)
+	if err != nil {
+		return nil, false, err
+	}
+	if ei.IsDir() != ai.IsDir() {
+		return nil, false, fmt.Errorf("cannot compare %s with %s: only one is a directory", expected, actual)
+	}
+	if !ei.IsDir() {
+		return filePairs(expected, actual, section)
+	}
+	byRel := make(map[string]*diffPair)
+	var rels []string
+	for i, root := range []string{expected, actual} {
+		files, err := fixtureFiles([]string{root})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, path := range files {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return nil, false, err
+			}
+			p, ok := byRel[rel]
+			if !ok {
+				p = &diffPair{rel: rel, expected: filepath.Join(expected, rel), actual: filepath.Join(actual, rel), section: section}
+				byRel[rel] = p
+				rels = append(rels, rel)
+			}
+			if i == 0 {
+				p.hasExpected = true
+			} else {
+				p.hasActual = true
+			}
+		}
+	}
+	sort.Strings(rels)
+	pairs := make([]diffPair, 0, len(rels))
+	for _, rel := range rels {
+		pairs = append(pairs, *byRel[rel])
+	}
+	return pairs, true, nil
+}
+
+// filePairs pairs the files expected and actual, section by section when
+// both are suites and section is empty.
+func filePairs(expected, actual, section string) ([]diffPair, bool, error) {
+	single := []diffPair{{rel: expected, expected: expected, actual: actual, section: section, hasExpected: true, hasActual: true}}
+	if section != "" {
+		return single, false, nil
+	}
+	var suites [2]*transcript.Suite
+	for i, path := range []string{expected, actual} {
+		var err error
+		if suites[i], err = loadSuite(path); err != nil {
+			return nil, false, err
+		}
+	}
+	switch {
+	case suites[0] == nil && suites[1] == nil:
+		return single, false, nil
+	case suites[0] == nil || suites[1] == nil:
+		return nil, false, fmt.Errorf("cannot compare %s with %s: only one is a suite; pick a section with --section", expected, actual)
+	}
+	var pairs []diffPair
+	for _, name := range suites[0].SectionNames() {
+		_, inActual := suites[1].Section(name)
+		pairs = append(pairs, diffPair{rel: name, expected: expected, actual: actual, section: name, hasExpected: true, hasActual: inActual})
+	}
+	for _, name := range suites[1].SectionNames() {
+		if _, ok := suites[0].Section(name); !ok {
+			pairs = append(pairs, diffPair{rel: name, expected: expected, actual: actual, section: name, hasActual: true})
+		}
+	}
+	return pairs, true, nil
+}
+
+// loadSuite reads the suite at path, or returns nil for a transcript. A
+// JSONL transcript, which is never a suite, is not read whole to tell.
+func loadSuite(path string) (*transcript.Suite, error) {
+	if r, err := transcript.OpenJSONL(path); err == nil {
+		r.Close()
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !transcript.IsSuite(content) {
+		return nil, nil
+	}
+	s, err := transcript.ParseSuite(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// useColor resolves a --color setting for output to w.
+func useColor(setting string, w io.Writer) (colored, ok bool) {
+	switch setting {
+	case "always":
+		return true, true
+	case "never":
+		return false, true
+	case "auto":
+		f, isFile := w.(*os.File)
+		if !isFile || os.Getenv("NO_COLOR") != "" {
+			return false, true
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, true
+	}
+	return false, false
+}
+
+// runTranscriptCrosscheck implements "embednexus transcript crosscheck":
+// for each transport, the request fixtures of every client named by
+// --clients are normalized and compared with those of the first, and each
+// incompatibility goes to stdout. With --strict, so do the fields of each
+// client's response fixtures missing from the Go client's schema; see
+// transcript.SchemaDrift. The exit code is exitMismatch when any
+// client disagrees.
+func runTranscriptCrosscheck(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript crosscheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dir := flags.String("fixtures", defaultFixtureDir, "fixture tree holding <client>/<transport>/request.json")
+	clients := flags.String("clients", "go,python", "comma-separated clients to compare; the first is the reference")
+	rulesPath := flags.String("normalize-rules", "", "normalization rules applied first (default <fixtures>/"+transcript.NormalizeRulesFile+" when present)")
+	strict := flags.Bool("strict", false, "also report response fields absent from the Go client's schema, which strict decoding rejects")
+	var ignore stringList
+	flags.Var(&ignore, "ignore", "JSON pointer into requests left unchecked (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript crosscheck [flags] [transport ...] (default: every transport of the first client)")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	names := splitList(*clients)
+	if len(names) < 2 {
+		fmt.Fprintln(stderr, "embednexus: --clients needs at least two clients")
+		return exitUsage
+	}
+	if *rulesPath == "" {
+		if candidate := filepath.Join(*dir, transcript.NormalizeRulesFile); fileExists(candidate) {
+			*rulesPath = candidate
+		}
+	}
+	var rules *transcript.Normalizer
+	if *rulesPath != "" {
+		var err error
+		if rules, err = transcript.LoadNormalizer(*rulesPath); err != nil {
+			fmt.Fprintf(stderr, "embednexus: normalization rules: %v\n", err)
+			return exitUsage
+		}
+	}
+	transports := flags.Args()
+	if len(transports) == 0 {
+		entries, err := os.ReadDir(filepath.Join(*dir, names[0]))
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				transports = append(transports, e.Name())
+			}
+		}
+	}
+
+	opts := transcript.CrossCheckOptions{Normalizer: rules, Ignore: ignore}
+	found, compared := 0, 0
+	// drift reports the response fields of client name the Go client's
+	// schema lacks, with -strict.
+	drift := func(name, transport string, requests transcript.Transcript) error {
+		if !*strict {
+			return nil
+		}
+		responses, _, err := loadFixture(*dir, name, transport, "response")
+		if err != nil {
+			return err
+		}
+		for _, inc := range transcript.SchemaDrift(requests, responses) {
+			found++
+			fmt.Fprintf(stdout, "%s: %s: %s\n", transport, name, inc)
+		}
+		return nil
+	}
+	for _, transport := range transports {
+		reference, ok, err := loadFixture(*dir, names[0], transport, "request")
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		if !ok {
+			fmt.Fprintf(stderr, "embednexus: no %s request fixture for %s\n", names[0], transport)
+			return exitFailure
+		}
+		if err := drift(names[0], transport, reference); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		for _, name := range names[1:] {
+			other, ok, err := loadFixture(*dir, name, transport, "request")
+			if err != nil {
+				fmt.Fprintf(stderr, "embednexus: %v\n", err)
+				return exitFailure
+			}
+			if !ok {
+				fmt.Fprintf(stderr, "embednexus: skipping %s %s: no request fixture\n", name, transport)
+				continue
+			}
+			compared++
+			if err := drift(name, transport, other); err != nil {
+				fmt.Fprintf(stderr, "embednexus: %v\n", err)
+				return exitFailure
+			}
+			incompatible := transcript.CrossCheck(reference, other, opts)
+			if note := transcript.ClientBuildNote(reference, other, names[0], name); note != "" && len(incompatible) > 0 {
+				fmt.Fprintf(stdout, "%s: %s vs %s: %s\n", transport, names[0], name, note)
+			}
+			for _, inc := range incompatible {
+				found++
+				fmt.Fprintf(stdout, "%s: %s vs %s: %s\n", transport, names[0], name, inc)
+			}
+		}
+	}
+	if found > 0 {
+		fmt.Fprintf(stderr, "embednexus: %d incompatibilities\n", found)
+		return exitMismatch
+	}
+	fmt.Fprintf(stderr, "embednexus: %d client pairs agree\n", compared)
+	return exitOK
+}
+
+// runTranscriptStats implements "embednexus transcript stats": the
+// latencies the transcript records are summarized per method, as a table or,
+// with --output, as client.Renderer renders transcript.MethodStats; --json
+// is short for --output json. A suite is summarized section by section, or
+// only in the section --section names.
+func runTranscriptStats(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript stats", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("output", statsTable, "output format: table, json, ndjson, or csv")
+	asJSON := flags.Bool("json", false, "print JSON instead of a table (--output json)")
+	csvColumns := flags.String("csv-columns", "", "comma-separated columns of --output csv (default: every field)")
+	section := flags.String("section", "", "summarize only this section, such as go/http, of a suite")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript stats [--output table|json|ndjson|csv] [--section name] <transcript>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	var renderer *client.Renderer
+	if *asJSON {
+		*output = client.OutputJSON
+	}
+	if *output != statsTable {
+		renderer = &client.Renderer{Format: *output, Columns: splitList(*csvColumns), Indent: "  "}
+		if err := renderer.Validate(); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+	}
+	path := flags.Arg(0)
+	if *section == "" {
+		suite, err := loadSuite(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		if suite != nil {
+			return printSuiteStats(path, renderer, stdout, stderr)
+		}
+	}
+	stats, err := transcript.StatsFile(path, *section)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	if renderer != nil {
+		records := make([]any, len(stats))
+		for i, s := range stats {
+			records[i] = s
+		}
+		return render(*renderer, stats, records, stdout, stderr)
+	}
+	if len(stats) == 0 {
+		fmt.Fprintf(stderr, "embednexus: %s records no timed round trips\n", path)
+		return exitOK
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "method\tcalls\tfailures\tp50\tp95\tmax")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", s.Method, s.Calls, s.Failures, millis(s.P50MS), millis(s.P95MS), millis(s.MaxMS))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// statsTable is the default format of "transcript stats", an aligned table.
+const statsTable = "table"
+
+// sectionStats are the stats of one section of a suite, as
+// "transcript stats --json" prints them for a whole suite.
+type sectionStats struct {
+	Section string                   `json:"section"`
+	Methods []transcript.MethodStats `json:"methods"`
+}
+
+// sectionMethodStats is a record of the stats of a suite: one method of
+// one section.
+type sectionMethodStats struct {
+	Section string `json:"section"`
+	transcript.MethodStats
+}
+
+// printSuiteStats prints the stats of every section of the suite at path,
+// as one table with a section column or, with a renderer, as sectionStats
+// documents or sectionMethodStats records.
+func printSuiteStats(path string, renderer *client.Renderer, stdout, stderr io.Writer) int {
+	suite, err := transcript.LoadSuite(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	all := make([]sectionStats, 0, len(suite.Sections))
+	var records []any
+	for _, sec := range suite.Sections {
+		stats := transcript.Stats(sec.Transcript)
+		all = append(all, sectionStats{Section: sec.Name, Methods: stats})
+		for _, s := range stats {
+			records = append(records, sectionMethodStats{Section: sec.Name, MethodStats: s})
+		}
+	}
+	if renderer != nil {
+		return render(*renderer, all, records, stdout, stderr)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "section\tmethod\tcalls\tfailures\tp50\tp95\tmax")
+	for _, sec := range all {
+		for _, s := range sec.Methods {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", sec.Section, s.Method, s.Calls, s.Failures, millis(s.P50MS), millis(s.P95MS), millis(s.MaxMS))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// render writes doc or records to stdout as r renders them.
+func render(r client.Renderer, doc any, records []any, stdout, stderr io.Writer) int {
+	if err := r.Render(stdout, doc, records); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runTranscriptMerge implements "embednexus transcript merge out in...":
+// the transcripts named, and those below the directories named, are merged
+// in order into the suite document out, one section each, under a manifest
+// recording --commit and when they were merged. The sections of suites
+// among them are merged as they are, and out itself is skipped, so
+// "transcript merge artifacts/go/suite.json artifacts/go" can be rerun.
+func runTranscriptMerge(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript merge", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	commit := flags.String("commit", os.Getenv("GITHUB_SHA"), "commit SHA recorded in the manifest (default $GITHUB_SHA)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript merge [--commit sha] <out> <transcript or directory> ...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	out := flags.Arg(0)
+	suite := transcript.NewSuite(*commit, time.Now())
+	for _, root := range flags.Args()[1:] {
+		files, err := fixtureFiles([]string{root})
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		for _, path := range files {
+			if sameFile(path, out) {
+				continue
+			}
+			if err := mergeInto(suite, path); err != nil {
+				fmt.Fprintf(stderr, "embednexus: %v\n", err)
+				return exitFailure
+			}
+		}
+	}
+	if err := transcript.SaveSuite(out, suite); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stderr, "embednexus: merged %d transcripts into %s\n", len(suite.Sections), out)
+	return exitOK
+}
+
+// runTranscriptScrub implements "embednexus transcript scrub in": the
+// redactions and anonymization of the --rules file, read as
+// ConfigFile.RecorderConfig reads it, are applied to the transcript at in
+// as a recorder would have applied them, and the result is written to
+// --out, or over in with --in-place. The values each rule replaced are
+// reported on stdout. Without --rules the default redactions apply.
+func runTranscriptScrub(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript scrub", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	rules := flags.String("rules", "", "YAML file of redact, no-default-redactions, anonymize, and anonymize-salt, as the flags of the same names")
+	out := flags.String("out", "", "write the scrubbed transcript here")
+	inPlace := flags.Bool("in-place", false, "overwrite the input transcript")
+	output := flags.String("output", "text", "report format: text or json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript scrub <in> [--rules file] (--out file | --in-place) [--output text|json]")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	var in string
+	if err == nil && flags.NArg() > 0 {
+		// The flags may follow the input too.
+		in = flags.Arg(0)
+		err = flags.Parse(flags.Args()[1:])
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if in == "" || flags.NArg() > 0 || *inPlace == (*out != "") {
+		flags.Usage()
+		return exitUsage
+	}
+	if *output != "text" && *output != client.OutputJSON {
+		fmt.Fprintf(stderr, "embednexus: --output %q: want text or json\n", *output)
+		return exitUsage
+	}
+	if *inPlace {
+		*out = in
+	} else if sameFile(in, *out) {
+		fmt.Fprintf(stderr, "embednexus: %s is the input transcript; pass --in-place to overwrite it\n", *out)
+		return exitUsage
+	}
+	var cfg client.RecorderConfig
+	if *rules != "" {
+		f, err := client.LoadConfigFile(*rules)
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		var warnings []client.ConfigWarning
+		if cfg, warnings, err = f.RecorderConfig(); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitUsage
+		}
+		// A misspelled rule would leave what it names in the transcript.
+		if len(warnings) > 0 {
+			for _, w := range warnings {
+				fmt.Fprintf(stderr, "embednexus: %s\n", w)
+			}
+			return exitUsage
+		}
+	}
+	report, err := transcript.ScrubFile(in, *out, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	if *output == client.OutputJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	fmt.Fprintf(stdout, "scrubbed %s into %s: %d of %d messages changed\n", in, *out, report.Changed, report.Messages)
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "rule\tvalues")
+	for _, r := range report.Rules {
+		fmt.Fprintf(w, "%s\t%d\n", r.Rule, r.Values)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// mergeInto adds the transcript at path, or the sections of the suite
+// there, to suite.
+func mergeInto(suite *transcript.Suite, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !transcript.IsSuite(content) {
+		t, err := transcript.Load(path)
+		if err != nil {
+			return err
+		}
+		return suite.Add(path, t)
+	}
+	merged, err := transcript.ParseSuite(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, sec := range merged.Sections {
+		if err := suite.Add(path, sec.Transcript); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameFile reports whether a and b name the same existing file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// millis formats a latency in milliseconds.
+func millis(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 1, 64) + "ms"
+}
+
+// loadFixture loads <dir>/<name>/<transport>/<kind>.json, kind being
+// request or response, or the .jsonl variant when there is one, reporting
+// false when neither exists.
+func loadFixture(dir, name, transport, kind string) (transcript.Transcript, bool, error) {
+	base := filepath.Join(dir, name, transport, kind)
+	for _, path := range []string{base + ".jsonl", base + ".json"} {
+		if !fileExists(path) {
+			continue
+		}
+		t, err := transcript.Load(path)
+		return t, err == nil, err
+	}
+	return transcript.Transcript{}, false, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// runTranscriptGenTests implements "embednexus transcript gen-tests": the
+// exchanges of the transcripts below --in become the cases of a generated
+// test, written to --out, holding the client's encoder and decoder to them;
+// see transcript.CompatCases. The test is in --package, by default that of
+// the other Go files beside --out.
+func runTranscriptGenTests(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus transcript gen-tests", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	in := flags.String("in", "", "directory of transcripts to generate the cases from")
+	out := flags.String("out", "", "Go test file to write")
+	pkg := flags.String("package", "", "package of the test (default: that of the Go files beside --out)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus transcript gen-tests --in <dir> --out <file> [--package name]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *in == "" || *out == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *pkg == "" {
+		*pkg = packageOf(filepath.Dir(*out))
+	}
+	cases, err := transcript.CompatCases(*in)
+	if err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	var buf bytes.Buffer
+	if err := transcript.GenerateCompatTests(&buf, *pkg, cases); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(stderr, "embednexus: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stderr, "embednexus: wrote %d cases to %s\n", len(cases), *out)
+	return exitOK
+}
+
+// packageOf returns the package of the Go files in dir other than tests,
+// or the name of dir when it has none.
+func packageOf(dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "main"
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(filepath.Base(abs))
+}
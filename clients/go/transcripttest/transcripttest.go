@@ -0,0 +1,147 @@
+// Package transcripttest checks the wire traffic of a client in tests
+// against golden transcripts:
+//
+//	rec := transcripttest.Record(t, client.WithConfig(client.ClientConfig{
+//		Transport: client.TransportInProc,
+//		Handler:   handler,
+//	}))
+//	if _, err := rec.Client.EmbedBatch(ctx, texts); err != nil {
+//		t.Fatal(err)
+//	}
+//	rec.AssertGolden(t, "testdata/embed_batch.json")
+//
+// Run go test -update to write the golden files from what the tests
+// record. The package registers the -update flag, so a test package using
+// it must not register its own.
+package transcripttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+	"github.com/Zaevrynth/Zaevrynth/clients/go/transcript"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden transcripts checked by transcripttest.AssertGolden")
+
+// Recording is the session of a client under test, recorded in memory.
+type Recording struct {
+	// Client is the client recording into the Recording. It is closed when
+	// the test ends.
+	Client *client.Client
+	// Normalizer is applied to the session before it is compared or saved;
+	// nil means transcript.DefaultNormalizer.
+	Normalizer *transcript.Normalizer
+	// Ignore lists JSON pointers left uncompared, as transcript.DiffOptions
+	// takes them.
+	Ignore []string
+
+	t        testing.TB
+	recorder *transcript.Recorder
+	sink     *transcript.MemorySink
+}
+
+// Record builds a client from opts, as client.NewClient does with an empty
+// endpoint, recording every envelope it exchanges. It fails the test if the
+// client cannot be built.
+func Record(t testing.TB, opts ...client.Option) *Recording {
+	t.Helper()
+	sink := &transcript.MemorySink{}
+	recorder := transcript.NewRecorder(sink)
+	c, err := client.NewClient("", append(opts[:len(opts):len(opts)], client.WithTranscriptRecorder(recorder))...)
+	if err != nil {
+		t.Fatalf("transcripttest: build client: %v", err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	recorder.Header.Transport = c.Config().Transport
+	return &Recording{Client: c, t: t, recorder: recorder, sink: sink}
+}
+
+// Transcript returns the session recorded so far, unnormalized.
+func (r *Recording) Transcript() transcript.Transcript {
+	t := r.sink.Transcript()
+	if t.Version == 0 {
+		t = r.recorder.Header
+		t.Version = transcript.CurrentVersion
+		if t.Client == "" {
+			t.Client = client.ClientMarker
+		}
+	}
+	return t
+}
+
+// Requests returns the requests recorded so far, in the order sent.
+func (r *Recording) Requests() []client.Request {
+	var requests []client.Request
+	for _, raw := range r.messages(client.DirectionRequest) {
+		var req client.Request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			r.t.Fatalf("transcripttest: decode request: %v", err)
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// Responses returns the responses recorded so far, in the order received.
+// Calls that failed without a response have none.
+func (r *Recording) Responses() []client.Response {
+	var responses []client.Response
+	for _, raw := range r.messages(client.DirectionResponse) {
+		var resp client.Response
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			r.t.Fatalf("transcripttest: decode response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func (r *Recording) messages(direction string) []json.RawMessage {
+	var messages []json.RawMessage
+	for _, e := range r.Transcript().Messages {
+		if e.Direction == direction {
+			messages = append(messages, e.Message)
+		}
+	}
+	return messages
+}
+
+// AssertGolden compares the normalized session with the golden transcript
+// at path and reports each difference as a unified diff. With -update it
+// writes the session to path instead. A missing golden file fails the test
+// at once.
+func (r *Recording) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+	n := r.Normalizer
+	if n == nil {
+		n = transcript.DefaultNormalizer()
+	}
+	recorded := r.Transcript()
+	got, err := n.Normalize(recorded)
+	if err != nil {
+		t.Fatalf("transcripttest: %v", err)
+	}
+	if *update {
+		if err := transcript.Save(path, got); err != nil {
+			t.Fatalf("transcripttest: %v", err)
+		}
+		t.Logf("transcripttest: updated %s", path)
+		return
+	}
+	want, err := transcript.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("transcripttest: %s does not exist; run go test -update to record it", path)
+	}
+	if err != nil {
+		t.Fatalf("transcripttest: %v", err)
+	}
+	if diffs := transcript.Diff(want, got, transcript.DiffOptions{Normalizer: n, Ignore: r.Ignore}); diffs != nil {
+		t.Errorf("transcripttest: session differs from %s (go test -update rewrites it):\n%s%s", path, transcript.RenderTraces(transcript.Traces(want, recorded, diffs)), transcript.RenderText(diffs))
+	}
+}
@@ -0,0 +1,85 @@
+package transcripttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// embedder answers mcp.embed with vectors scaled by scale.
+func embedder(scale float32) client.Handler {
+	return func(req client.Request) (client.Response, error) {
+		if req.Method != client.MethodEmbed {
+			return client.Response{}, &client.RPCError{Code: -32601, Message: fmt.Sprintf("method %q not found", req.Method)}
+		}
+		var params struct {
+			Model  string   `json:"model"`
+			Inputs []string `json:"inputs"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return client.Response{}, &client.RPCError{Code: -32602, Message: err.Error()}
+		}
+		embeddings := make([]map[string]any, len(params.Inputs))
+		for i, input := range params.Inputs {
+			embeddings[i] = map[string]any{"index": i, "vector": []float32{scale * float32(len(input)), 0.5}}
+		}
+		result, _ := json.Marshal(map[string]any{"model": params.Model, "embeddings": embeddings})
+		return client.Response{Result: result}, nil
+	}
+}
+
+func recordBatch(t *testing.T, scale float32) *Recording {
+	rec := Record(t, client.WithConfig(client.ClientConfig{Transport: client.TransportInProc, Handler: embedder(scale)}))
+	if _, err := rec.Client.EmbedBatch(context.Background(), []string{"alpha", "beta"}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	return rec
+}
+
+func TestRecordAssertGolden(t *testing.T) {
+	rec := recordBatch(t, 1)
+	requests, responses := rec.Requests(), rec.Responses()
+	if len(requests) == 0 || len(requests) != len(responses) {
+		t.Fatalf("recorded %d requests and %d responses", len(requests), len(responses))
+	}
+	if last := requests[len(requests)-1]; last.Method != client.MethodEmbed || responses[len(responses)-1].ID != last.ID {
+		t.Fatalf("last request %+v, response %+v", last, responses[len(responses)-1])
+	}
+	if tr := rec.Transcript(); tr.Transport != client.TransportInProc || tr.Messages[0].SentAt == "" {
+		t.Fatalf("transcript markers %+v", tr)
+	}
+	rec.AssertGolden(t, "testdata/embed_batch.json")
+}
+
+// failures records the failures reported to it instead of failing the test.
+type failures struct {
+	*testing.T
+	errors []string
+}
+
+func (f *failures) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertGoldenReportsDifferences(t *testing.T) {
+	if *update {
+		t.Skip("-update rewrites the golden file")
+	}
+	rec := recordBatch(t, 2)
+	f := &failures{T: t}
+	rec.AssertGolden(f, "testdata/embed_batch.json")
+	if len(f.errors) != 1 || !strings.Contains(f.errors[0], "/vector/0") || !strings.Contains(f.errors[0], "-") {
+		t.Fatalf("failures = %q", f.errors)
+	}
+
+	rec.Ignore = []string{"/messages/*/message/result/embeddings/*/vector"}
+	f.errors = nil
+	rec.AssertGolden(f, "testdata/embed_batch.json")
+	if f.errors != nil {
+		t.Fatalf("ignored vectors still differ: %q", f.errors)
+	}
+}
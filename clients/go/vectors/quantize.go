@@ -0,0 +1,191 @@
+package vectors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DType is a compact vector encoding produced by Quantize.
+type DType uint8
+
+const (
+	// Float16 stores each component as an IEEE 754 half-precision float,
+	// halving memory. Components of magnitude at least 2^-14 come back with
+	// a relative error of at most 2^-11; smaller ones with an absolute error
+	// of at most 2^-25.
+	Float16 DType = iota + 1
+	// Int8 maps each component affinely onto a signed byte, quartering
+	// memory. Every component comes back within Scale/2 of its original,
+	// Scale being 1/255 of the vector's range.
+	Int8
+)
+
+func (d DType) String() string {
+	switch d {
+	case Float16:
+		return "float16"
+	case Int8:
+		return "int8"
+	default:
+		return fmt.Sprintf("DType(%d)", uint8(d))
+	}
+}
+
+// ErrNonFinite reports a NaN or infinite component, which has no quantized
+// form.
+var ErrNonFinite = errors.New("non-finite vector component")
+
+// Quantized is a vector in a compact encoding. Exactly one of F16 and I8 is
+// set, according to DType.
+type Quantized struct {
+	DType DType
+	// F16 holds the half-precision bit patterns of a Float16 vector.
+	F16 []uint16
+	// I8 holds the components of an Int8 vector; component i stands for
+	// Scale * (I8[i] - ZeroPoint).
+	I8        []int8
+	Scale     float32
+	ZeroPoint int8
+}
+
+// Quantize encodes v as dtype. The Int8 range always includes zero, so
+// ZeroPoint fits in a byte and zero components round-trip exactly.
+func Quantize(v []float32, dtype DType) (Quantized, error) {
+	for i, x := range v {
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return Quantized{}, fmt.Errorf("component %d: %w", i, ErrNonFinite)
+		}
+	}
+	switch dtype {
+	case Float16:
+		out := make([]uint16, len(v))
+		for i, x := range v {
+			out[i] = toFloat16(x)
+		}
+		return Quantized{DType: Float16, F16: out}, nil
+	case Int8:
+		var lo, hi float32
+		for _, x := range v {
+			lo, hi = min(lo, x), max(hi, x)
+		}
+		scale := (hi - lo) / 255
+		if scale == 0 {
+			// Every component is zero.
+			return Quantized{DType: Int8, I8: make([]int8, len(v)), Scale: 1}, nil
+		}
+		zp := clampInt8(math.Round(float64(-128 - lo/scale)))
+		out := make([]int8, len(v))
+		for i, x := range v {
+			out[i] = clampInt8(math.Round(float64(x/scale)) + float64(zp))
+		}
+		return Quantized{DType: Int8, I8: out, Scale: scale, ZeroPoint: zp}, nil
+	default:
+		return Quantized{}, fmt.Errorf("quantize: unsupported dtype %v", dtype)
+	}
+}
+
+func clampInt8(x float64) int8 {
+	return int8(max(math.MinInt8, min(math.MaxInt8, x)))
+}
+
+// Len returns the number of components.
+func (q Quantized) Len() int {
+	if q.DType == Float16 {
+		return len(q.F16)
+	}
+	return len(q.I8)
+}
+
+// Dequantize returns the approximate float32 vector q encodes.
+func (q Quantized) Dequantize() []float32 {
+	out := make([]float32, q.Len())
+	switch q.DType {
+	case Float16:
+		for i, h := range q.F16 {
+			out[i] = fromFloat16(h)
+		}
+	case Int8:
+		for i, x := range q.I8 {
+			out[i] = q.Scale * float32(int32(x)-int32(q.ZeroPoint))
+		}
+	}
+	return out
+}
+
+// CosineQuantized is Cosine for quantized vectors. Two Int8 vectors are
+// compared in integer arithmetic without being decoded; other pairs,
+// including mixed encodings, are decoded first.
+func CosineQuantized(a, b Quantized) (float32, error) {
+	if a.Len() != b.Len() {
+		return 0, fmt.Errorf("%w: %d and %d", ErrLengthMismatch, a.Len(), b.Len())
+	}
+	if a.DType != Int8 || b.DType != Int8 {
+		return Cosine(a.Dequantize(), b.Dequantize())
+	}
+	// The scales cancel out of the cosine, leaving the offset components.
+	za, zb := int64(a.ZeroPoint), int64(b.ZeroPoint)
+	var d, na, nb int64
+	for i := range a.I8 {
+		x, y := int64(a.I8[i])-za, int64(b.I8[i])-zb
+		d += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0, ErrZeroVector
+	}
+	return clamp(float32(float64(d) / math.Sqrt(float64(na)) / math.Sqrt(float64(nb)))), nil
+}
+
+// toFloat16 converts a finite float32 to half precision, rounding to
+// nearest even and saturating at the largest finite half.
+func toFloat16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	var h uint32
+	switch {
+	case exp >= 0x1f:
+		return sign | 0x7bff
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h = mant >> shift
+		if rem, half := mant&(1<<shift-1), uint32(1)<<(shift-1); rem > half || rem == half && h&1 == 1 {
+			h++
+		}
+	default:
+		h = uint32(exp)<<10 | mant>>13
+		if rem := mant & 0x1fff; rem > 0x1000 || rem == 0x1000 && h&1 == 1 {
+			h++
+		}
+		if h >= 0x7c00 {
+			h = 0x7bff
+		}
+	}
+	return sign | uint16(h)
+}
+
+func fromFloat16(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		// Subnormal: mant * 2^-24.
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
@@ -0,0 +1,108 @@
+package vectors
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFloat16RoundTripsEveryHalf(t *testing.T) {
+	for h := 0; h <= math.MaxUint16; h++ {
+		f := fromFloat16(uint16(h))
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			continue
+		}
+		if got := toFloat16(f); got != uint16(h) {
+			t.Fatalf("half %#04x -> %v -> %#04x", h, f, got)
+		}
+	}
+	if got := toFloat16(1e6); got != 0x7bff {
+		t.Fatalf("expected saturation at the largest half, got %#04x", got)
+	}
+}
+
+func TestQuantizeErrorBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 50; trial++ {
+		v, _ := Normalized(randomVector(rng, 768))
+		half, err := Quantize(v, Float16)
+		if err != nil {
+			t.Fatalf("Quantize float16: %v", err)
+		}
+		for i, got := range half.Dequantize() {
+			bound := max(math.Abs(float64(v[i]))/(1<<11), 1.0/(1<<25))
+			if diff := math.Abs(float64(got - v[i])); diff > bound {
+				t.Fatalf("float16 component %d: %v -> %v exceeds %v", i, v[i], got, bound)
+			}
+		}
+
+		q, err := Quantize(v, Int8)
+		if err != nil {
+			t.Fatalf("Quantize int8: %v", err)
+		}
+		if len(q.I8) != len(v) || q.F16 != nil {
+			t.Fatalf("unexpected int8 encoding %+v", q)
+		}
+		// Allow for float32 rounding in the scale itself.
+		bound := float64(q.Scale)/2 + 1e-6
+		for i, got := range q.Dequantize() {
+			if diff := math.Abs(float64(got - v[i])); diff > bound {
+				t.Fatalf("int8 component %d: %v -> %v exceeds %v", i, v[i], got, bound)
+			}
+		}
+	}
+}
+
+func TestQuantizeEdgeCases(t *testing.T) {
+	zero, err := Quantize(make([]float32, 4), Int8)
+	if err != nil || zero.Scale != 1 {
+		t.Fatalf("zero vector: %+v, %v", zero, err)
+	}
+	for _, x := range zero.Dequantize() {
+		if x != 0 {
+			t.Fatalf("zero vector did not round-trip: %v", zero.Dequantize())
+		}
+	}
+	// Zero is always representable exactly, even in an all-positive vector.
+	pos, _ := Quantize([]float32{0, 0.25, 1}, Int8)
+	if pos.Dequantize()[0] != 0 {
+		t.Fatalf("zero component became %v", pos.Dequantize()[0])
+	}
+	if _, err := Quantize([]float32{1, float32(math.NaN())}, Int8); !errors.Is(err, ErrNonFinite) {
+		t.Fatalf("expected ErrNonFinite, got %v", err)
+	}
+	if _, err := Quantize([]float32{1}, DType(0)); err == nil {
+		t.Fatal("expected an unsupported dtype to fail")
+	}
+}
+
+func TestCosineQuantized(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for trial := 0; trial < 50; trial++ {
+		a, b := randomVector(rng, 384), randomVector(rng, 384)
+		want, _ := Cosine(a, b)
+		qa, _ := Quantize(a, Int8)
+		qb, _ := Quantize(b, Int8)
+		ha, _ := Quantize(a, Float16)
+		for name, pair := range map[string][2]Quantized{"int8": {qa, qb}, "mixed": {ha, qb}} {
+			got, err := CosineQuantized(pair[0], pair[1])
+			if err != nil || math.Abs(float64(got-want)) > 0.01 {
+				t.Fatalf("%s cosine %v (%v), want %v", name, got, err, want)
+			}
+		}
+		if got, _ := CosineQuantized(ha, ha); !near(got, 1) {
+			t.Fatalf("float16 self-similarity %v", got)
+		}
+	}
+
+	short, _ := Quantize([]float32{1, 2}, Int8)
+	long, _ := Quantize([]float32{1, 2, 3}, Int8)
+	if _, err := CosineQuantized(short, long); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("expected ErrLengthMismatch, got %v", err)
+	}
+	zero, _ := Quantize(make([]float32, 2), Int8)
+	if _, err := CosineQuantized(short, zero); !errors.Is(err, ErrZeroVector) {
+		t.Fatalf("expected ErrZeroVector, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package vectors implements the vector math applications run on embeddings
+// returned by the client: dot products, cosine similarity, normalization,
+// and top-k search.
+//
+// Every function works in float32, the precision the server returns, and
+// reports mismatched lengths as errors instead of panicking. The inner
+// loops accumulate into four independent sums so the compiler can keep them
+// in registers and the loads pipeline; this matters for TopK over large
+// corpora.
+package vectors
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	// ErrLengthMismatch reports vectors of different dimensions.
+	ErrLengthMismatch = errors.New("vector length mismatch")
+	// ErrZeroVector reports a vector with no direction, which has no
+	// cosine similarity and cannot be normalized.
+	ErrZeroVector = errors.New("zero vector")
+)
+
+func checkLengths(a, b []float32) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%w: %d and %d", ErrLengthMismatch, len(a), len(b))
+	}
+	return nil
+}
+
+// dot assumes len(a) == len(b).
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+// dotAndNorm returns a·b and b·b in one pass; it assumes len(a) == len(b).
+func dotAndNorm(a, b []float32) (float32, float32) {
+	b = b[:len(a)]
+	var d0, d1, n0, n1 float32
+	i := 0
+	for ; i+2 <= len(a); i += 2 {
+		d0 += a[i] * b[i]
+		n0 += b[i] * b[i]
+		d1 += a[i+1] * b[i+1]
+		n1 += b[i+1] * b[i+1]
+	}
+	if i < len(a) {
+		d0 += a[i] * b[i]
+		n0 += b[i] * b[i]
+	}
+	return d0 + d1, n0 + n1
+}
+
+// Dot returns the dot product of a and b.
+func Dot(a, b []float32) (float32, error) {
+	if err := checkLengths(a, b); err != nil {
+		return 0, err
+	}
+	return dot(a, b), nil
+}
+
+// Norm returns the Euclidean length of v.
+func Norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}
+
+// Cosine returns the cosine similarity of a and b, in [-1, 1]. It does not
+// assume either vector is normalized.
+func Cosine(a, b []float32) (float32, error) {
+	if err := checkLengths(a, b); err != nil {
+		return 0, err
+	}
+	na, nb := Norm(a), Norm(b)
+	if na == 0 || nb == 0 {
+		return 0, ErrZeroVector
+	}
+	return clamp(dot(a, b) / (na * nb)), nil
+}
+
+// clamp keeps rounding error from pushing a cosine outside [-1, 1].
+func clamp(c float32) float32 {
+	return max(-1, min(1, c))
+}
+
+// Normalize scales v to unit length in place.
+func Normalize(v []float32) error {
+	n := Norm(v)
+	if n == 0 {
+		return ErrZeroVector
+	}
+	inv := 1 / n
+	for i := range v {
+		v[i] *= inv
+	}
+	return nil
+}
+
+// Normalized returns a unit-length copy of v, leaving v unchanged.
+func Normalized(v []float32) ([]float32, error) {
+	out := append([]float32(nil), v...)
+	if err := Normalize(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Match is one TopK result.
+type Match struct {
+	// Index is the position of the vector in the corpus.
+	Index int
+	// Score is its cosine similarity to the query.
+	Score float32
+}
+
+// matchHeap is a min-heap on Score, so the weakest of the current top k is
+// at the root. Ties keep the lower index.
+type matchHeap []Match
+
+func (h matchHeap) Len() int { return len(h) }
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	return h[i].Index > h[j].Index
+}
+func (h matchHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x any)   { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+// TopK returns the k corpus vectors most similar to query by cosine
+// similarity, best first, with ties broken by lower index. Zero corpus
+// vectors are skipped. Fewer than k matches are returned when the corpus is
+// smaller; k <= 0 returns none. A corpus vector whose length differs from
+// the query's fails the call.
+func TopK(query []float32, corpus [][]float32, k int) ([]Match, error) {
+	if k <= 0 {
+		return nil, nil
+	}
+	qn := Norm(query)
+	if qn == 0 {
+		return nil, ErrZeroVector
+	}
+	h := make(matchHeap, 0, min(k, len(corpus)))
+	for i, v := range corpus {
+		if len(v) != len(query) {
+			return nil, fmt.Errorf("corpus vector %d: %w: %d and %d", i, ErrLengthMismatch, len(query), len(v))
+		}
+		d, vn := dotAndNorm(query, v)
+		if vn == 0 {
+			continue
+		}
+		m := Match{Index: i, Score: clamp(d / (qn * float32(math.Sqrt(float64(vn)))))}
+		switch {
+		case len(h) < k:
+			heap.Push(&h, m)
+		case m.Score > h[0].Score:
+			h[0] = m
+			heap.Fix(&h, 0)
+		}
+	}
+	sort.Slice(h, func(i, j int) bool { return h.Less(j, i) })
+	return h, nil
+}
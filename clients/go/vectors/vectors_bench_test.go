@@ -0,0 +1,64 @@
+package vectors
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// The benchmarks of the suite `make bench` runs against bench/baseline.txt,
+// each on vectors drawn from a seeded source, so runs compare.
+
+func BenchmarkDot(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 1536), randomVector(rng, 1536)
+	b.SetBytes(2 * 4 * 1536)
+	for i := 0; i < b.N; i++ {
+		_, _ = Dot(x, y)
+	}
+}
+
+func BenchmarkCosine(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := randomVector(rng, 1536), randomVector(rng, 1536)
+	for i := 0; i < b.N; i++ {
+		_, _ = Cosine(x, y)
+	}
+}
+
+// BenchmarkTopK100k searches 100,000 vectors of 256 dimensions.
+func BenchmarkTopK100k(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	query, corpus := randomVector(rng, 256), randomCorpus(rng, 100_000, 256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := TopK(query, corpus, 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTopK10kNormalized searches 10,000 normalized vectors of 768
+// dimensions, the shape of a typical embedding index.
+func BenchmarkTopK10kNormalized(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	corpus := randomCorpus(rng, 10_000, 768)
+	for _, v := range corpus {
+		_ = Normalize(v)
+	}
+	query, _ := Normalized(randomVector(rng, 768))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := TopK(query, corpus, 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCosineQuantized(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x, _ := Quantize(randomVector(rng, 1536), Int8)
+	y, _ := Quantize(randomVector(rng, 1536), Int8)
+	for i := 0; i < b.N; i++ {
+		_, _ = CosineQuantized(x, y)
+	}
+}
@@ -0,0 +1,127 @@
+package vectors
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func near(a, b float32) bool { return math.Abs(float64(a-b)) < 1e-5 }
+
+func TestDotAndCosine(t *testing.T) {
+	a := []float32{1, 2, 3, 4, 5}
+	b := []float32{5, 4, 3, 2, 1}
+	if d, err := Dot(a, b); err != nil || d != 35 {
+		t.Fatalf("Dot = %v, %v", d, err)
+	}
+	if c, err := Cosine(a, b); err != nil || !near(c, 35.0/55) {
+		t.Fatalf("Cosine = %v, %v", c, err)
+	}
+	// Cosine must not depend on magnitude.
+	scaled := []float32{10, 20, 30, 40, 50}
+	if c, err := Cosine(a, scaled); err != nil || c != 1 {
+		t.Fatalf("Cosine of parallel vectors = %v, %v", c, err)
+	}
+
+	if _, err := Dot(a, b[:3]); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("expected ErrLengthMismatch, got %v", err)
+	}
+	if _, err := Cosine(a, make([]float32, 5)); !errors.Is(err, ErrZeroVector) {
+		t.Fatalf("expected ErrZeroVector, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	v := []float32{3, 4}
+	copied, err := Normalized(v)
+	if err != nil || !near(copied[0], 0.6) || !near(copied[1], 0.8) || v[0] != 3 {
+		t.Fatalf("Normalized = %v, %v (input now %v)", copied, err, v)
+	}
+	if err := Normalize(v); err != nil || !near(Norm(v), 1) {
+		t.Fatalf("Normalize left norm %v, %v", Norm(v), err)
+	}
+	if err := Normalize([]float32{0, 0}); !errors.Is(err, ErrZeroVector) {
+		t.Fatalf("expected ErrZeroVector, got %v", err)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	query := []float32{1, 0}
+	corpus := [][]float32{
+		{0, 1},   // 0
+		{1, 1},   // cos 0.707
+		{2, 0},   // 1
+		{0, 0},   // skipped
+		{-1, 0},  // -1
+		{5, 5},   // ties with index 1
+		{1, 0.1}, // 0.995
+	}
+	got, err := TopK(query, corpus, 3)
+	if err != nil {
+		t.Fatalf("TopK: %v", err)
+	}
+	var idx []int
+	for _, m := range got {
+		idx = append(idx, m.Index)
+	}
+	if want := []int{2, 6, 1}; !reflect.DeepEqual(idx, want) {
+		t.Fatalf("TopK indexes %v, want %v (%+v)", idx, want, got)
+	}
+
+	all, _ := TopK(query, corpus, 100)
+	if len(all) != 6 || all[len(all)-1].Index != 4 {
+		t.Fatalf("expected every non-zero vector, worst last: %+v", all)
+	}
+	if m, err := TopK(query, corpus, 0); m != nil || err != nil {
+		t.Fatalf("k=0 should return nothing, got %v, %v", m, err)
+	}
+	if _, err := TopK(query, append(corpus, []float32{1}), 2); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("expected ErrLengthMismatch, got %v", err)
+	}
+}
+
+func TestTopKMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	query, corpus := randomVector(rng, 37), randomCorpus(rng, 500, 37)
+	got, err := TopK(query, corpus, 10)
+	if err != nil {
+		t.Fatalf("TopK: %v", err)
+	}
+	for i, m := range got {
+		want, _ := Cosine(query, corpus[m.Index])
+		if !near(m.Score, want) {
+			t.Fatalf("match %d score %v, want %v", i, m.Score, want)
+		}
+		if i > 0 && m.Score > got[i-1].Score {
+			t.Fatalf("matches out of order: %+v", got)
+		}
+	}
+	// Nothing outside the result may beat the weakest match.
+	in := map[int]bool{}
+	for _, m := range got {
+		in[m.Index] = true
+	}
+	for i, v := range corpus {
+		if c, _ := Cosine(query, v); !in[i] && c > got[len(got)-1].Score {
+			t.Fatalf("vector %d (score %v) missing from %+v", i, c, got)
+		}
+	}
+}
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+func randomCorpus(rng *rand.Rand, n, dim int) [][]float32 {
+	corpus := make([][]float32, n)
+	for i := range corpus {
+		corpus[i] = randomVector(rng, dim)
+	}
+	return corpus
+}
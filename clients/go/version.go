@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Zaevrynth/Zaevrynth/clients/go/client"
+)
+
+// runVersion implements "embednexus version" and --version: the build of
+// the binary, as text or, with --output json, client.BuildInfo.
+func runVersion(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("embednexus version", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("output", "text", "output format: text or json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: embednexus version [--output text|json]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	b := client.Build()
+	switch *output {
+	case "json":
+		out, err := json.MarshalIndent(b, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "embednexus: %v\n", err)
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "%s\n", out)
+	case "text":
+		fmt.Fprintf(stdout, "%s %s\n", b.Name, b.Version)
+		commit := b.Commit
+		if commit == "" {
+			commit = "unknown"
+		}
+		if b.Modified {
+			commit += " (modified)"
+		}
+		fmt.Fprintf(stdout, "commit:             %s\n", commit)
+		if b.Date != "" {
+			fmt.Fprintf(stdout, "built:              %s\n", b.Date)
+		}
+		fmt.Fprintf(stdout, "go:                 %s\n", b.GoVersion)
+		fmt.Fprintf(stdout, "protocol versions:  %s\n", strings.Join(b.ProtocolVersions, ", "))
+		fmt.Fprintf(stdout, "transcript version: %d\n", b.TranscriptVersion)
+	default:
+		fmt.Fprintf(stderr, "embednexus: --output %q: want text or json\n", *output)
+		return exitUsage
+	}
+	return exitOK
+}